@@ -0,0 +1,85 @@
+// Command anonymize copies a database and rewrites the copy so it can be
+// shared for debugging and load testing. The source is only read. Every user
+// of the copy is renamed to role-id (admin-1, scanner-4, ...) and signs in
+// with the password given by -password.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"receipter/infrastructure/anonymize"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/sqlite"
+)
+
+const usage = `usage:
+  anonymize -out FILE [-in FILE] [-salt SALT] [-password PASSWORD]`
+
+func main() {
+	in := flag.String("in", getenv("SQLITE_PATH", "receipter.db"), "database to copy")
+	out := flag.String("out", "", "anonymized copy to write; must not exist")
+	salt := flag.String("salt", "", "salt for the fakes; repeat it to get the same fakes again (default random)")
+	password := flag.String("password", anonymize.DefaultPassword, "password set on every user of the copy")
+	flag.Parse()
+	if *out == "" {
+		log.Fatal(usage)
+	}
+
+	// Client names and comments are encrypted at rest, so the copy is read
+	// and rewritten under the instance's key.
+	keyring, err := fieldcrypt.LoadFromEnv()
+	if err != nil {
+		log.Fatalf("load field encryption key: %v", err)
+	}
+	fieldcrypt.Configure(keyring)
+
+	ctx := context.Background()
+	src, err := sqlite.OpenDB(*in)
+	if err != nil {
+		log.Fatalf("open %s: %v", *in, err)
+	}
+	if err := anonymize.Snapshot(ctx, src, *out); err != nil {
+		_ = src.Close()
+		log.Fatalf("copy %s to %s: %v", *in, *out, err)
+	}
+	_ = src.Close()
+
+	db, err := sqlite.OpenDB(*out)
+	if err != nil {
+		log.Fatalf("open %s: %v", *out, err)
+	}
+	defer db.Close()
+	if err := sqlite.ApplyEmbeddedMigrations(ctx, db); err != nil {
+		log.Fatalf("apply migrations: %v", err)
+	}
+
+	result, err := anonymize.Run(ctx, db, anonymize.Options{Salt: *salt, Password: *password})
+	if err != nil {
+		// A half-rewritten copy still holds client data.
+		_ = db.Close()
+		_ = os.Remove(*out)
+		log.Fatalf("anonymize %s: %v", *out, err)
+	}
+
+	fmt.Printf("anonymized copy of %s written to %s\n", *in, *out)
+	steps := make([]string, 0, len(result))
+	for name := range result {
+		steps = append(steps, name)
+	}
+	sort.Strings(steps)
+	for _, name := range steps {
+		fmt.Printf("  %-12s %d rows\n", name, result[name])
+	}
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -1,8 +1,16 @@
 package main
 
-import "fmt"
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
 
 func main() {
 	fmt.Println("APP_ADDR=:8080")
 	fmt.Println("SQLITE_PATH=receipter.db")
+
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	fmt.Println("FIELD_ENCRYPTION_KEY=k1:" + base64.StdEncoding.EncodeToString(key))
 }
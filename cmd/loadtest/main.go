@@ -0,0 +1,47 @@
+// Command loadtest simulates scanners posting receipts and admins watching
+// progress against a running instance, then prints latency percentiles per
+// operation. Point it at a disposable copy (see cmd/anonymize): every run
+// leaves a pallet of load-test lines per scanner behind.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"receipter/infrastructure/loadtest"
+)
+
+func main() {
+	cfg := loadtest.Config{}
+	flag.StringVar(&cfg.BaseURL, "url", "http://localhost:8080", "base url of the instance")
+	flag.Int64Var(&cfg.ProjectID, "project", 0, "project to load (default the admin's current project)")
+	flag.IntVar(&cfg.Scanners, "scanners", 10, "concurrent scanners posting receipts")
+	flag.IntVar(&cfg.Admins, "admins", 2, "concurrent admins polling progress and the SKU view")
+	flag.DurationVar(&cfg.Duration, "duration", 30*time.Second, "how long to run")
+	flag.DurationVar(&cfg.ScanInterval, "scan-interval", 2*time.Second, "pause between a scanner's receipts; 0 runs flat out")
+	flag.DurationVar(&cfg.PollInterval, "poll-interval", 5*time.Second, "pause between an admin's page loads")
+	flag.IntVar(&cfg.SKUs, "skus", 50, "distinct SKUs scanners pick from")
+	flag.StringVar(&cfg.AdminUsername, "admin-user", "admin", "admin account")
+	flag.StringVar(&cfg.AdminPassword, "admin-password", os.Getenv("LOADTEST_ADMIN_PASSWORD"), "admin password (or LOADTEST_ADMIN_PASSWORD)")
+	flag.StringVar(&cfg.ScannerUsername, "scanner-user", "scanner1", "scanner account shared by every simulated scanner")
+	flag.StringVar(&cfg.ScannerPassword, "scanner-password", os.Getenv("LOADTEST_SCANNER_PASSWORD"), "scanner password (or LOADTEST_SCANNER_PASSWORD)")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := loadtest.Run(ctx, cfg)
+	if err != nil {
+		log.Fatalf("load test: %v", err)
+	}
+	report.Write(os.Stdout)
+	for _, s := range report.Ops {
+		if s.Errors > 0 {
+			os.Exit(1)
+		}
+	}
+}
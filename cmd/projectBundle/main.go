@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/projectbundle"
+	"receipter/infrastructure/sqlite"
+)
+
+const usage = `usage:
+  projectBundle export -project ID [-out FILE]
+  projectBundle import -in FILE [-code CODE] [-user USERNAME]`
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+
+	// Bundles carry encrypted columns as plaintext, so both sides need the
+	// instance's key.
+	keyring, err := fieldcrypt.LoadFromEnv()
+	if err != nil {
+		log.Fatalf("load field encryption key: %v", err)
+	}
+	fieldcrypt.Configure(keyring)
+
+	dbPath := getenv("SQLITE_PATH", "receipter.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		log.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if err := sqlite.ApplyEmbeddedMigrations(ctx, db); err != nil {
+		log.Fatalf("apply migrations: %v", err)
+	}
+
+	switch os.Args[1] {
+	case "export":
+		runExport(ctx, db, os.Args[2:])
+	case "import":
+		runImport(ctx, db, os.Args[2:])
+	default:
+		log.Fatal(usage)
+	}
+}
+
+func runExport(ctx context.Context, db *sqlite.DB, args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	projectID := fs.Int64("project", 0, "project id to export")
+	out := fs.String("out", "", "output file (default project-<code>.zip)")
+	_ = fs.Parse(args)
+	if *projectID <= 0 {
+		log.Fatal(usage)
+	}
+
+	var buf bytes.Buffer
+	manifest, err := projectbundle.Export(ctx, db, *projectID, &buf)
+	if err != nil {
+		log.Fatalf("export project %d: %v", *projectID, err)
+	}
+	path := *out
+	if path == "" {
+		path = fmt.Sprintf("project-%s.zip", manifest.ProjectCode)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		log.Fatalf("write %s: %v", path, err)
+	}
+	fmt.Printf("exported project %d (%s) to %s, %d files\n", *projectID, manifest.ProjectCode, path, len(manifest.Files))
+}
+
+func runImport(ctx context.Context, db *sqlite.DB, args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	in := fs.String("in", "", "bundle file to import")
+	code := fs.String("code", "", "project code to use instead of the bundle's")
+	username := fs.String("user", "admin", "user recorded against the import audit entry")
+	_ = fs.Parse(args)
+	if *in == "" {
+		log.Fatal(usage)
+	}
+
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		log.Fatalf("read %s: %v", *in, err)
+	}
+
+	var userID int64
+	if err := db.R.NewRaw(`SELECT id FROM users WHERE username = ?`, *username).Scan(ctx, &userID); err != nil {
+		log.Fatalf("find user %s: %v", *username, err)
+	}
+
+	result, err := projectbundle.Import(ctx, db, audit.NewService(), bytes.NewReader(data), int64(len(data)), projectbundle.ImportOptions{
+		UserID: userID,
+		Code:   *code,
+	})
+	if err != nil {
+		log.Fatalf("import %s: %v", *in, err)
+	}
+
+	fmt.Printf("imported project %d from %s\n", result.ProjectID, *in)
+	tables := make([]string, 0, len(result.Rows))
+	for name := range result.Rows {
+		tables = append(tables, name)
+	}
+	sort.Strings(tables)
+	for _, name := range tables {
+		fmt.Printf("  %-22s %d rows\n", name, result.Rows[name])
+	}
+
+	// Printed labels carry the source pallet IDs, so list the mapping for
+	// relabelling.
+	oldIDs := make([]int64, 0, len(result.PalletIDs))
+	for oldID := range result.PalletIDs {
+		oldIDs = append(oldIDs, oldID)
+	}
+	sort.Slice(oldIDs, func(i, j int) bool { return oldIDs[i] < oldIDs[j] })
+	for _, oldID := range oldIDs {
+		fmt.Printf("  pallet %d -> %d\n", oldID, result.PalletIDs[oldID])
+	}
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
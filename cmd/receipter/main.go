@@ -5,11 +5,16 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 
 	"receipter/infrastructure/audit"
 	"receipter/infrastructure/cache"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/gsheets"
 	httpserver "receipter/infrastructure/http"
+	"receipter/infrastructure/ratelimit"
 	"receipter/infrastructure/rbac"
 	"receipter/infrastructure/sqlite"
 )
@@ -18,23 +23,100 @@ func main() {
 	addr := getenv("APP_ADDR", ":8881")
 	dbPath := getenv("SQLITE_PATH", "receipter.db")
 
+	keyring, err := fieldcrypt.LoadFromEnv()
+	if err != nil {
+		log.Fatalf("load field encryption key: %v", err)
+	}
+	if keyring == nil {
+		log.Printf("%s is not set; client names and comments are stored unencrypted", fieldcrypt.EnvKey)
+	}
+	fieldcrypt.Configure(keyring)
+
 	db, err := sqlite.OpenDB(dbPath)
 	if err != nil {
 		log.Fatalf("open db: %v", err)
 	}
 	defer db.Close()
 
+	// A failed migration is recorded in schema_migrations rather than being
+	// fatal: the server starts with writes blocked so an admin can see the
+	// failure on /tasker/admin/system and re-run once it is fixed.
 	if err := sqlite.ApplyEmbeddedMigrations(context.Background(), db); err != nil {
-		log.Fatalf("apply migrations: %v", err)
+		log.Printf("apply migrations: %v (writes are blocked until resolved)", err)
 	}
 
-	sessionCache := cache.NewUserSessionCache()
+	// Sessions are cached in memory by default. SESSION_STORE=sqlite reads
+	// them from the database on every request instead, so logins survive a
+	// restart and several instances can share one database.
+	sessionCache, err := cache.NewSessionStore(getenv("SESSION_STORE", cache.SessionStoreMemory), db)
+	if err != nil {
+		log.Fatalf("session store: %v", err)
+	}
 	userCache := cache.NewUserCache()
 	rbacCache := cache.NewRbacRolesCache()
 	rbacSvc := rbac.New(rbacCache)
 	auditSvc := audit.NewService()
 
 	server := httpserver.NewServer(addr, db, sessionCache, userCache, rbacSvc, rbacCache, auditSvc)
+	// Nightly integrity results are always on the admin health page; the
+	// summary is also emailed when a recipient is configured.
+	server.Integrity.EmailTo = getenv("INTEGRITY_EMAIL_TO", "")
+	// Pallets past their project's receiving SLA are flagged on the progress
+	// page; this address is also alerted once per breach.
+	server.PalletSLA.EmailTo = getenv("SLA_ALERT_EMAIL_TO", "")
+	// Created pallets left without lines are cancelled per project setting;
+	// this address is told which pallets each sweep cancelled.
+	server.PalletSweep.EmailTo = getenv("PALLET_CLEANUP_EMAIL_TO", "")
+	// Ops can put the app into read-only maintenance by creating this file,
+	// e.g. around a backup; removing it lifts maintenance.
+	server.Maintenance.FlagFile = getenv("MAINTENANCE_FLAG_FILE", "")
+	// Client replies to comment emails are posted by the mail provider to
+	// /inbound/email/<secret>; inbound email is off while this is unset.
+	server.ReplyMail.Secret = getenv("INBOUND_EMAIL_SECRET", "")
+	// Replies must pass the provider's SPF or DKIM check unless they are sent
+	// to a thread's own reply address on this mailbox, such as
+	// comments@receipter.example; client users see those addresses while it
+	// is set.
+	server.ReplyMail.Address = getenv("INBOUND_EMAIL_ADDRESS", "")
+	// Photos of inactive projects can be moved out of the database into this
+	// directory. The hourly sweep moves those of projects inactive for
+	// COLD_STORAGE_IDLE_DAYS with at least COLD_STORAGE_MIN_MB of photos;
+	// cold storage is off while the directory is unset.
+	server.ColdStorage.Dir = getenv("COLD_STORAGE_DIR", "")
+	server.ColdStorage.MinBytes = int64(getenvInt("COLD_STORAGE_MIN_MB", int(server.ColdStorage.MinBytes>>20))) << 20
+	server.ColdStorage.IdleDays = getenvInt("COLD_STORAGE_IDLE_DAYS", server.ColdStorage.IdleDays)
+	// Password reset emails link to this address, such as
+	// https://receipter.example.com; self-service resets are off while it is
+	// unset.
+	server.PasswordResets.BaseURL = getenv("PUBLIC_BASE_URL", "")
+	// Label PDFs render on LABEL_RENDER_WORKERS workers with up to
+	// LABEL_RENDER_QUEUE prints waiting; prints past that get a 503 and
+	// are asked to retry.
+	server.LabelRenders.Workers = getenvInt("LABEL_RENDER_WORKERS", server.LabelRenders.Workers)
+	server.LabelRenders.QueueSize = getenvInt("LABEL_RENDER_QUEUE", server.LabelRenders.QueueSize)
+	// Scheduled exports are delivered to Google Sheets as this service
+	// account; without it the schedules page says so and runs fail.
+	sheets, err := gsheets.LoadFromEnv()
+	if err != nil {
+		log.Fatalf("load google sheets credentials: %v", err)
+	}
+	if sheets != nil {
+		server.SheetExports.Sheets = sheets
+	}
+	// Per-caller request limits by route class, such as RATE_LIMIT_EXPORT=30/m;
+	// "off" lifts a class's limit.
+	for _, class := range ratelimit.Classes {
+		key := "RATE_LIMIT_" + strings.ToUpper(class)
+		v := os.Getenv(key)
+		if v == "" {
+			continue
+		}
+		limit, err := ratelimit.ParseLimit(v)
+		if err != nil {
+			log.Fatalf("%s: %v", key, err)
+		}
+		server.RateLimit.SetLimit(class, limit)
+	}
 	if err := server.Start(); err != nil {
 		log.Fatalf("start server: %v", err)
 	}
@@ -55,3 +137,15 @@ func getenv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func getenvInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Fatalf("%s: must be a whole number, got %q", key, v)
+	}
+	return n
+}
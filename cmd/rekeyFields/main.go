@@ -0,0 +1,61 @@
+// Command rekeyFields rewrites the encrypted client columns under the current
+// FIELD_ENCRYPTION_KEY. Run it after rotating the key, keeping the old key in
+// FIELD_ENCRYPTION_PREVIOUS_KEYS until it finishes, or once after enabling
+// encryption to encrypt existing plaintext rows.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/sqlite"
+)
+
+func main() {
+	keyring, err := fieldcrypt.LoadFromEnv()
+	if err != nil {
+		log.Fatalf("load field encryption key: %v", err)
+	}
+	if keyring == nil {
+		log.Fatalf("%s is not set", fieldcrypt.EnvKey)
+	}
+	fieldcrypt.Configure(keyring)
+
+	dbPath := getenv("SQLITE_PATH", "receipter.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		log.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if err := sqlite.ApplyEmbeddedMigrations(ctx, db); err != nil {
+		log.Fatalf("apply migrations: %v", err)
+	}
+
+	result, err := fieldcrypt.Rekey(ctx, db, keyring)
+	if err != nil {
+		log.Fatalf("rekey: %v", err)
+	}
+
+	fmt.Printf("re-keyed fields under key %s\n", keyring.CurrentKeyID())
+	columns := make([]string, 0, len(result))
+	for name := range result {
+		columns = append(columns, name)
+	}
+	sort.Strings(columns)
+	for _, name := range columns {
+		fmt.Printf("  %-30s %d rows\n", name, result[name])
+	}
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
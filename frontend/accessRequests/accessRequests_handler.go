@@ -0,0 +1,77 @@
+package accessrequests
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/sqlite"
+)
+
+func AccessRequestsPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		data := PageData{
+			Status:       r.URL.Query().Get("status"),
+			ErrorMessage: r.URL.Query().Get("error"),
+		}
+		projects, err := projectinfra.ListClientProjects(r.Context(), db, session.UserID)
+		if err != nil {
+			http.Error(w, "failed to load projects", http.StatusInternalServerError)
+			return
+		}
+		for _, p := range projects {
+			data.Projects = append(data.Projects, ProjectView{Name: p.Name, Code: p.Code})
+		}
+		data.Requests, err = projectinfra.ListAccessRequests(r.Context(), db, "", session.UserID)
+		if err != nil {
+			http.Error(w, "failed to load access requests", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := AccessRequestsPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render access requests page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func CreateAccessRequestCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/access-requests?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		_, err := projectinfra.RequestClientProjectAccess(r.Context(), db, auditSvc, session.UserID, r.FormValue("project_code"), r.FormValue("note"))
+		if err != nil {
+			msg := "failed to submit access request"
+			for _, known := range []error{
+				projectinfra.ErrAccessRequestCodeRequired,
+				projectinfra.ErrAccessRequestUnknownProject,
+				projectinfra.ErrAccessRequestAlreadyGranted,
+				projectinfra.ErrAccessRequestDuplicate,
+				projectinfra.ErrAccessRequestNoteTooLong,
+			} {
+				if errors.Is(err, known) {
+					msg = err.Error()
+				}
+			}
+			http.Redirect(w, r, "/tasker/access-requests?error="+url.QueryEscape(msg), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/tasker/access-requests?status="+url.QueryEscape("access request sent"), http.StatusSeeOther)
+	}
+}
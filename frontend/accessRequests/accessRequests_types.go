@@ -0,0 +1,15 @@
+package accessrequests
+
+import projectinfra "receipter/infrastructure/project"
+
+type PageData struct {
+	Projects     []ProjectView
+	Requests     []projectinfra.AccessRequest
+	Status       string
+	ErrorMessage string
+}
+
+type ProjectView struct {
+	Name string
+	Code string
+}
@@ -0,0 +1,28 @@
+package adminapitokens
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/apitoken"
+	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/sqlite"
+)
+
+func LoadPageData(ctx context.Context, db *sqlite.DB) (PageData, error) {
+	data := PageData{Users: make([]UserOption, 0)}
+	tokens, err := apitoken.List(ctx, db)
+	if err != nil {
+		return data, err
+	}
+	data.Tokens = tokens
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT id, username, role
+FROM users
+WHERE role IN (?, ?)
+ORDER BY username ASC`, rbac.RoleAdmin, rbac.RoleClient).Scan(ctx, &data.Users)
+	})
+	return data, err
+}
@@ -0,0 +1,97 @@
+package adminapitokens
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/apitoken"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+func APITokensPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := LoadPageData(r.Context(), db)
+		if err != nil {
+			http.Error(w, "failed to load api tokens", http.StatusInternalServerError)
+			return
+		}
+		data.Status = r.URL.Query().Get("status")
+		data.ErrorMessage = r.URL.Query().Get("error")
+		renderPage(w, r, data)
+	}
+}
+
+// IssueAPITokenCommandHandler renders the page directly instead of
+// redirecting so the plaintext token never appears in a URL or log.
+func IssueAPITokenCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/admin/api-tokens?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		userID, err := strconv.ParseInt(strings.TrimSpace(r.FormValue("user_id")), 10, 64)
+		if err != nil || userID <= 0 {
+			http.Redirect(w, r, "/tasker/admin/api-tokens?error="+url.QueryEscape("select a user for the token"), http.StatusSeeOther)
+			return
+		}
+		plaintext, token, err := apitoken.Issue(r.Context(), db, auditSvc, session.UserID, userID, r.FormValue("name"))
+		if err != nil {
+			if !errors.Is(err, apitoken.ErrNameRequired) && !errors.Is(err, apitoken.ErrUnknownUser) {
+				http.Redirect(w, r, "/tasker/admin/api-tokens?error="+url.QueryEscape("failed to issue token"), http.StatusSeeOther)
+				return
+			}
+			http.Redirect(w, r, "/tasker/admin/api-tokens?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+
+		data, err := LoadPageData(r.Context(), db)
+		if err != nil {
+			http.Error(w, "failed to load api tokens", http.StatusInternalServerError)
+			return
+		}
+		data.IssuedToken = plaintext
+		data.IssuedName = token.Name
+		w.Header().Set("Cache-Control", "no-store")
+		renderPage(w, r, data)
+	}
+}
+
+func RevokeAPITokenCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		tokenID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || tokenID <= 0 {
+			http.Redirect(w, r, "/tasker/admin/api-tokens?error="+url.QueryEscape("invalid token id"), http.StatusSeeOther)
+			return
+		}
+		if err := apitoken.Revoke(r.Context(), db, auditSvc, session.UserID, tokenID); err != nil {
+			http.Redirect(w, r, "/tasker/admin/api-tokens?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/tasker/admin/api-tokens?status="+url.QueryEscape("token revoked"), http.StatusSeeOther)
+	}
+}
+
+func renderPage(w http.ResponseWriter, r *http.Request, data PageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := APITokensPage(data).Render(r.Context(), w); err != nil {
+		http.Error(w, "failed to render api tokens page", http.StatusInternalServerError)
+		return
+	}
+}
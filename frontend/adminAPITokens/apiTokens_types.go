@@ -0,0 +1,30 @@
+package adminapitokens
+
+import (
+	"time"
+
+	"receipter/infrastructure/apitoken"
+)
+
+type UserOption struct {
+	ID       int64  `bun:"id"`
+	Username string `bun:"username"`
+	Role     string `bun:"role"`
+}
+
+type PageData struct {
+	Tokens       []apitoken.TokenView
+	Users        []UserOption
+	Status       string
+	ErrorMessage string
+	// IssuedToken is the plaintext of a just-issued token; it is shown once.
+	IssuedToken string
+	IssuedName  string
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
@@ -0,0 +1,144 @@
+package admincomments
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/replymail"
+	"receipter/infrastructure/sqlite"
+)
+
+// inboundLimit caps how many recent email replies the page lists.
+const inboundLimit = 20
+
+// pageLimit caps how many comments the moderation list renders at once;
+// narrow the filter to reach older rows.
+const pageLimit = 200
+
+var ErrNoCommentsSelected = errors.New("select at least one comment to delete")
+
+func LoadPageData(ctx context.Context, db *sqlite.DB, filter Filter) (PageData, error) {
+	filter.Username = strings.TrimSpace(filter.Username)
+	filter.Query = strings.TrimSpace(filter.Query)
+	data := PageData{
+		Filter:     filter,
+		Comments:   make([]CommentView, 0),
+		TopPosters: make([]PosterView, 0),
+	}
+
+	where := []string{"1 = 1"}
+	args := make([]any, 0, 2)
+	if filter.Username != "" {
+		where = append(where, "u.username = ?")
+		args = append(args, filter.Username)
+	}
+	// Comment text is encrypted at rest, so the text filter runs over the
+	// decrypted rows instead of in SQL and the limit is applied afterwards.
+	limit := ""
+	if filter.Query == "" {
+		limit = "LIMIT ?"
+		args = append(args, pageLimit+1)
+	}
+
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`
+SELECT c.id, c.project_id, COALESCE(p.name, '') AS project_name, c.pallet_id, c.sku, c.comment,
+       COALESCE(u.username, '') AS username, CAST(c.created_at AS TEXT) AS created_at
+FROM sku_client_comments c
+LEFT JOIN projects p ON p.id = c.project_id
+LEFT JOIN users u ON u.id = c.created_by_user_id
+WHERE `+strings.Join(where, " AND ")+`
+ORDER BY c.created_at DESC, c.id DESC
+`+limit, args...).Scan(ctx, &data.Comments); err != nil {
+			return err
+		}
+		if filter.Query != "" {
+			data.Comments = matchingComments(data.Comments, filter.Query)
+		}
+		if len(data.Comments) > pageLimit {
+			data.Comments = data.Comments[:pageLimit]
+			data.Truncated = true
+		}
+
+		return tx.NewRaw(`
+SELECT c.created_by_user_id AS user_id, COALESCE(u.username, '') AS username, COUNT(1) AS comment_count
+FROM sku_client_comments c
+LEFT JOIN users u ON u.id = c.created_by_user_id
+WHERE c.created_at >= datetime('now', '-1 day')
+GROUP BY c.created_by_user_id
+ORDER BY comment_count DESC, username ASC
+LIMIT 10`).Scan(ctx, &data.TopPosters)
+	})
+	if err != nil {
+		return data, err
+	}
+	data.InboundEmails, err = replymail.ListRecent(ctx, db, inboundLimit)
+	return data, err
+}
+
+// DeleteComments removes the selected client comments in one transaction,
+// writing an audit entry per comment. The entry records which comment and SKU
+// were removed but not the text, since audit_logs is not encrypted at rest.
+func DeleteComments(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID int64, ids []int64) (int, error) {
+	if len(ids) == 0 {
+		return 0, ErrNoCommentsSelected
+	}
+
+	deleted := 0
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, id := range ids {
+			var before CommentView
+			err := tx.NewRaw(`
+SELECT c.id, c.project_id, c.pallet_id, c.sku, c.comment,
+       COALESCE(u.username, '') AS username, CAST(c.created_at AS TEXT) AS created_at
+FROM sku_client_comments c
+LEFT JOIN users u ON u.id = c.created_by_user_id
+WHERE c.id = ?`, id).Scan(ctx, &before)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			if _, err := tx.ExecContext(ctx, `DELETE FROM sku_client_comments WHERE id = ?`, id); err != nil {
+				return err
+			}
+			if err := auditSvc.Write(ctx, tx, userID, "sku_comment.delete", "sku_client_comments", strconv.FormatInt(id, 10), map[string]any{
+				"comment_id": before.ID,
+				"project_id": before.ProjectID,
+				"pallet_id":  before.PalletID,
+				"sku":        before.SKU,
+				"created_by": before.Username,
+				"created_at": before.CreatedAt,
+			}, nil); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// matchingComments keeps comments containing query, ignoring case like the
+// LIKE filter it replaces.
+func matchingComments(comments []CommentView, query string) []CommentView {
+	needle := strings.ToLower(query)
+	out := comments[:0]
+	for _, c := range comments {
+		if strings.Contains(strings.ToLower(string(c.Comment)), needle) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
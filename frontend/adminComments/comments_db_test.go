@@ -0,0 +1,138 @@
+package admincomments
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/sqlite"
+)
+
+func openAdminCommentsTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	db, err := sqlite.OpenDB(filepath.Join(t.TempDir(), "admin-comments-test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "..", "infrastructure", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'Inbound', 'Site inbound', '2026-02-01', 'Acme', 'acme', 'active')`,
+			`INSERT INTO users (id, username, password_hash, role, client_project_id) VALUES (1, 'admin', 'x', 'admin', NULL), (2, 'client-bot', 'x', 'client', 1), (3, 'client-ok', 'x', 'client', 1)`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open')`,
+			`INSERT INTO sku_client_comments (id, project_id, pallet_id, sku, comment, created_by_user_id) VALUES
+				(1, 1, 1, 'SKU1', 'BUY CHEAP WATCHES', 2),
+				(2, 1, 1, 'SKU1', 'BUY CHEAP WATCHES again', 2),
+				(3, 1, 1, 'SKU1', 'Please photograph the seal', 3)`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return db
+}
+
+func TestLoadPageData_FiltersAndRanksPosters(t *testing.T) {
+	db := openAdminCommentsTestDB(t)
+
+	data, err := LoadPageData(context.Background(), db, Filter{Query: "watches"})
+	if err != nil {
+		t.Fatalf("load page data: %v", err)
+	}
+	if len(data.Comments) != 2 {
+		t.Fatalf("expected 2 matching comments, got %+v", data.Comments)
+	}
+	if len(data.TopPosters) != 2 || data.TopPosters[0].Username != "client-bot" || data.TopPosters[0].CommentCount != 2 {
+		t.Fatalf("unexpected top posters: %+v", data.TopPosters)
+	}
+
+	data, err = LoadPageData(context.Background(), db, Filter{Username: "client-ok"})
+	if err != nil {
+		t.Fatalf("load page data by user: %v", err)
+	}
+	if len(data.Comments) != 1 || data.Comments[0].ID != 3 {
+		t.Fatalf("expected only client-ok comment, got %+v", data.Comments)
+	}
+}
+
+func TestLoadPageData_FiltersEncryptedComments(t *testing.T) {
+	db := openAdminCommentsTestDB(t)
+	keyring, err := fieldcrypt.ParseKeyring("k1:"+base64.StdEncoding.EncodeToString(make([]byte, 32)), "")
+	if err != nil {
+		t.Fatalf("parse keyring: %v", err)
+	}
+	fieldcrypt.Configure(keyring)
+	t.Cleanup(func() { fieldcrypt.Configure(nil) })
+	if _, err := fieldcrypt.Rekey(context.Background(), db, keyring); err != nil {
+		t.Fatalf("encrypt comments: %v", err)
+	}
+
+	data, err := LoadPageData(context.Background(), db, Filter{Query: "seal"})
+	if err != nil {
+		t.Fatalf("load page data: %v", err)
+	}
+	if len(data.Comments) != 1 || data.Comments[0].Comment != "Please photograph the seal" {
+		t.Fatalf("expected decrypted match, got %+v", data.Comments)
+	}
+}
+
+func TestDeleteComments_RemovesAndAudits(t *testing.T) {
+	db := openAdminCommentsTestDB(t)
+	ctx := context.Background()
+
+	if _, err := DeleteComments(ctx, db, audit.NewService(), 1, nil); !errors.Is(err, ErrNoCommentsSelected) {
+		t.Fatalf("expected ErrNoCommentsSelected, got %v", err)
+	}
+
+	deleted, err := DeleteComments(ctx, db, audit.NewService(), 1, []int64{1, 2, 99})
+	if err != nil {
+		t.Fatalf("delete comments: %v", err)
+	}
+	if deleted != 2 {
+		t.Fatalf("expected 2 deleted, got %d", deleted)
+	}
+
+	var remaining int
+	var logs []struct {
+		EntityID   string `bun:"entity_id"`
+		BeforeJSON string `bun:"before_json"`
+	}
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM sku_client_comments`).Scan(ctx, &remaining); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT entity_id, before_json FROM audit_logs WHERE action = 'sku_comment.delete' ORDER BY id`).Scan(ctx, &logs)
+	})
+	if err != nil {
+		t.Fatalf("load results: %v", err)
+	}
+	if remaining != 1 {
+		t.Fatalf("expected 1 remaining comment, got %d", remaining)
+	}
+	if len(logs) != 2 || logs[0].EntityID != "1" || strings.Contains(logs[0].BeforeJSON, "BUY CHEAP WATCHES") || !strings.Contains(logs[0].BeforeJSON, `"comment_id":1`) || !strings.Contains(logs[0].BeforeJSON, `"project_id":1`) {
+		t.Fatalf("unexpected audit logs: %+v", logs)
+	}
+}
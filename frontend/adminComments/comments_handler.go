@@ -0,0 +1,86 @@
+package admincomments
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+func CommentsPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		data, err := LoadPageData(r.Context(), db, Filter{
+			Username: query.Get("user"),
+			Query:    query.Get("q"),
+		})
+		if err != nil {
+			http.Error(w, "failed to load comments", http.StatusInternalServerError)
+			return
+		}
+		data.Status = query.Get("status")
+		data.ErrorMessage = query.Get("error")
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := CommentsPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render comments page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func DeleteCommentsCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/admin/comments?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+
+		// Keep the admin on the filtered view they were moderating.
+		back := url.Values{}
+		if v := strings.TrimSpace(r.FormValue("user")); v != "" {
+			back.Set("user", v)
+		}
+		if v := strings.TrimSpace(r.FormValue("q")); v != "" {
+			back.Set("q", v)
+		}
+
+		ids, err := parseCommentIDs(r.Form["comment_id"])
+		if err == nil {
+			var deleted int
+			deleted, err = DeleteComments(r.Context(), db, auditSvc, session.UserID, ids)
+			if err == nil {
+				back.Set("status", fmt.Sprintf("%d comments deleted", deleted))
+			}
+		}
+		if err != nil {
+			back.Set("error", err.Error())
+		}
+		http.Redirect(w, r, "/tasker/admin/comments?"+back.Encode(), http.StatusSeeOther)
+	}
+}
+
+var errInvalidCommentID = errors.New("invalid comment selection")
+
+func parseCommentIDs(raw []string) ([]int64, error) {
+	ids := make([]int64, 0, len(raw))
+	for _, v := range raw {
+		id, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil || id <= 0 {
+			return nil, errInvalidCommentID
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,39 @@
+package admincomments
+
+import (
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/replymail"
+)
+
+type CommentView struct {
+	ID          int64             `bun:"id"`
+	ProjectID   int64             `bun:"project_id"`
+	ProjectName string            `bun:"project_name"`
+	PalletID    int64             `bun:"pallet_id"`
+	SKU         string            `bun:"sku"`
+	Comment     fieldcrypt.String `bun:"comment"`
+	Username    string            `bun:"username"`
+	CreatedAt   string            `bun:"created_at"`
+}
+
+type PosterView struct {
+	UserID       int64  `bun:"user_id"`
+	Username     string `bun:"username"`
+	CommentCount int64  `bun:"comment_count"`
+}
+
+type Filter struct {
+	Username string
+	Query    string
+}
+
+type PageData struct {
+	Filter     Filter
+	Comments   []CommentView
+	TopPosters []PosterView
+	// InboundEmails are the latest email replies and whether they were added.
+	InboundEmails []replymail.InboundEmail
+	Truncated     bool
+	Status        string
+	ErrorMessage  string
+}
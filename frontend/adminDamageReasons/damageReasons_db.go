@@ -0,0 +1,21 @@
+package admindamagereasons
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func LoadPageData(ctx context.Context, db *sqlite.DB) (PageData, error) {
+	data := PageData{Reasons: make([]ReasonView, 0)}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT dr.code, dr.label, dr.sort_order, dr.active,
+       (SELECT COUNT(1) FROM pallet_receipts pr WHERE pr.damage_reason = dr.code) AS line_count
+FROM damage_reasons dr
+ORDER BY dr.sort_order ASC, dr.label ASC, dr.code ASC`).Scan(ctx, &data.Reasons)
+	})
+	return data, err
+}
@@ -0,0 +1,98 @@
+package admindamagereasons
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/damage"
+	"receipter/infrastructure/sqlite"
+)
+
+func DamageReasonsPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := LoadPageData(r.Context(), db)
+		if err != nil {
+			http.Error(w, "failed to load damage reasons", http.StatusInternalServerError)
+			return
+		}
+		data.Status = r.URL.Query().Get("status")
+		data.ErrorMessage = r.URL.Query().Get("error")
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := DamageReasonsPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render damage reasons page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func CreateDamageReasonCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/admin/damage-reasons?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		sortOrder, err := parseSortOrder(r.FormValue("sort_order"))
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/damage-reasons?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		if _, err := damage.Create(r.Context(), db, auditSvc, session.UserID, r.FormValue("code"), r.FormValue("label"), sortOrder); err != nil {
+			http.Redirect(w, r, "/tasker/admin/damage-reasons?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/tasker/admin/damage-reasons?status="+url.QueryEscape("damage reason created"), http.StatusSeeOther)
+	}
+}
+
+func UpdateDamageReasonCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		code := strings.TrimSpace(chi.URLParam(r, "code"))
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/admin/damage-reasons?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		sortOrder, err := parseSortOrder(r.FormValue("sort_order"))
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/damage-reasons?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		active := r.FormValue("active") != ""
+		if err := damage.Update(r.Context(), db, auditSvc, session.UserID, code, r.FormValue("label"), sortOrder, active); err != nil {
+			http.Redirect(w, r, "/tasker/admin/damage-reasons?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/tasker/admin/damage-reasons?status="+url.QueryEscape("damage reason updated"), http.StatusSeeOther)
+	}
+}
+
+var errInvalidSortOrder = errors.New("sort order must be a whole number")
+
+func parseSortOrder(raw string) (int, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, errInvalidSortOrder
+	}
+	return v, nil
+}
@@ -0,0 +1,15 @@
+package admindamagereasons
+
+type ReasonView struct {
+	Code      string
+	Label     string
+	SortOrder int
+	Active    bool
+	LineCount int64
+}
+
+type PageData struct {
+	Reasons      []ReasonView
+	Status       string
+	ErrorMessage string
+}
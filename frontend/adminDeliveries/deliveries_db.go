@@ -0,0 +1,98 @@
+package admindeliveries
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/delivery"
+	"receipter/infrastructure/sqlite"
+)
+
+// pageLimit caps how many deliveries the list renders at once; filter by
+// status to reach older rows.
+const pageLimit = 200
+
+const deliveryColumns = `
+SELECT id, kind, endpoint, event, status, attempts, max_attempts, last_error,
+       CAST(next_attempt_at AS TEXT) AS next_attempt_at,
+       COALESCE(CAST(delivered_at AS TEXT), '') AS delivered_at,
+       CAST(created_at AS TEXT) AS created_at,
+       CAST(updated_at AS TEXT) AS updated_at
+FROM deliveries`
+
+func LoadPageData(ctx context.Context, db *sqlite.DB, statusFilter string) (PageData, error) {
+	switch statusFilter {
+	case delivery.StatusPending, delivery.StatusDelivered, delivery.StatusDead:
+	default:
+		statusFilter = ""
+	}
+	data := PageData{
+		StatusFilter: statusFilter,
+		Counts:       make([]StatusCount, 0, 3),
+		Deliveries:   make([]DeliveryView, 0),
+		OpenCircuits: make([]EndpointView, 0),
+	}
+
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT status, COUNT(1) AS count FROM deliveries GROUP BY status ORDER BY status`).Scan(ctx, &data.Counts); err != nil {
+			return err
+		}
+
+		query, args := deliveryColumns, []any{}
+		if statusFilter != "" {
+			query += ` WHERE status = ?`
+			args = append(args, statusFilter)
+		}
+		query += ` ORDER BY id DESC LIMIT ?`
+		args = append(args, pageLimit+1)
+		if err := tx.NewRaw(query, args...).Scan(ctx, &data.Deliveries); err != nil {
+			return err
+		}
+		if len(data.Deliveries) > pageLimit {
+			data.Deliveries = data.Deliveries[:pageLimit]
+			data.Truncated = true
+		}
+
+		return tx.NewRaw(`
+SELECT endpoint, consecutive_failures, CAST(open_until AS TEXT) AS open_until
+FROM delivery_endpoints
+WHERE open_until > ?
+ORDER BY open_until DESC`, time.Now().UTC()).Scan(ctx, &data.OpenCircuits)
+	})
+	return data, err
+}
+
+func LoadDetailPageData(ctx context.Context, db *sqlite.DB, id int64) (DetailPageData, error) {
+	var data DetailPageData
+	var payload string
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(deliveryColumns+` WHERE id = ?`, id).Scan(ctx, &data.Delivery); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT payload FROM deliveries WHERE id = ?`, id).Scan(ctx, &payload)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return data, delivery.ErrNotFound
+	}
+	if err != nil {
+		return data, err
+	}
+	data.Payload = formatPayload(payload)
+	return data, nil
+}
+
+// formatPayload indents JSON payloads for reading and leaves anything else,
+// such as email bodies, as stored.
+func formatPayload(payload string) string {
+	var out bytes.Buffer
+	if err := json.Indent(&out, []byte(payload), "", "  "); err != nil {
+		return payload
+	}
+	return out.String()
+}
@@ -0,0 +1,103 @@
+package admindeliveries
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/delivery"
+	"receipter/infrastructure/sqlite"
+)
+
+func openAdminDeliveriesTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	db, err := sqlite.OpenDB(filepath.Join(t.TempDir(), "admin-deliveries-test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "..", "infrastructure", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO deliveries (id, kind, endpoint, event, payload, status, attempts, last_error) VALUES
+				(1, 'webhook', 'https://a.test/hook', 'pallet.closed', '{"pallet_id":1}', 'delivered', 1, ''),
+				(2, 'webhook', 'https://b.test/hook', 'pallet.closed', '{"pallet_id":2}', 'dead', 8, 'endpoint returned 500'),
+				(3, 'email', 'ops@example.test', 'digest', 'plain text body', 'pending', 2, 'no sender configured for this delivery kind')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO delivery_endpoints (endpoint, consecutive_failures, open_until) VALUES (?, 5, ?), (?, 1, NULL)`,
+			"https://b.test/hook", time.Now().UTC().Add(time.Hour), "https://a.test/hook")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed deliveries: %v", err)
+	}
+	return db
+}
+
+func TestLoadPageDataFiltersByStatusAndListsOpenCircuits(t *testing.T) {
+	db := openAdminDeliveriesTestDB(t)
+
+	data, err := LoadPageData(context.Background(), db, delivery.StatusDead)
+	if err != nil {
+		t.Fatalf("load page data: %v", err)
+	}
+	if len(data.Deliveries) != 1 || data.Deliveries[0].ID != 2 {
+		t.Fatalf("expected only the dead delivery, got %+v", data.Deliveries)
+	}
+	if len(data.OpenCircuits) != 1 || data.OpenCircuits[0].Endpoint != "https://b.test/hook" {
+		t.Fatalf("expected one open circuit, got %+v", data.OpenCircuits)
+	}
+	if countFor(data.Counts, delivery.StatusPending) != 1 || countFor(data.Counts, delivery.StatusDelivered) != 1 {
+		t.Fatalf("expected counts across all statuses, got %+v", data.Counts)
+	}
+
+	data, err = LoadPageData(context.Background(), db, "bogus")
+	if err != nil {
+		t.Fatalf("load page data: %v", err)
+	}
+	if data.StatusFilter != "" || len(data.Deliveries) != 3 {
+		t.Fatalf("expected unknown filter to show all deliveries, got filter=%q rows=%d", data.StatusFilter, len(data.Deliveries))
+	}
+}
+
+func TestLoadDetailPageDataIndentsJSONPayloads(t *testing.T) {
+	db := openAdminDeliveriesTestDB(t)
+
+	data, err := LoadDetailPageData(context.Background(), db, 2)
+	if err != nil {
+		t.Fatalf("load detail: %v", err)
+	}
+	if data.Payload != "{\n  \"pallet_id\": 2\n}" {
+		t.Fatalf("expected indented payload, got %q", data.Payload)
+	}
+
+	data, err = LoadDetailPageData(context.Background(), db, 3)
+	if err != nil {
+		t.Fatalf("load detail: %v", err)
+	}
+	if data.Payload != "plain text body" {
+		t.Fatalf("expected non-JSON payload unchanged, got %q", data.Payload)
+	}
+
+	if _, err := LoadDetailPageData(context.Background(), db, 99); !errors.Is(err, delivery.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package admindeliveries
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/delivery"
+	"receipter/infrastructure/sqlite"
+)
+
+func DeliveriesPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		data, err := LoadPageData(r.Context(), db, query.Get("filter"))
+		if err != nil {
+			http.Error(w, "failed to load deliveries", http.StatusInternalServerError)
+			return
+		}
+		data.Status = query.Get("status")
+		data.ErrorMessage = query.Get("error")
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := DeliveriesPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render deliveries page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func DeliveryDetailPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "invalid delivery id", http.StatusBadRequest)
+			return
+		}
+		data, err := LoadDetailPageData(r.Context(), db, id)
+		if errors.Is(err, delivery.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to load delivery", http.StatusInternalServerError)
+			return
+		}
+		data.Status = r.URL.Query().Get("status")
+		data.ErrorMessage = r.URL.Query().Get("error")
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := DeliveryDetailPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render delivery page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func RetryDeliveryCommandHandler(db *sqlite.DB, auditSvc *audit.Service, worker *delivery.Worker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Redirect(w, r, "/tasker/admin/deliveries?error="+url.QueryEscape("invalid delivery id"), http.StatusSeeOther)
+			return
+		}
+		back := "/tasker/admin/deliveries/" + strconv.FormatInt(id, 10)
+		if err := delivery.Retry(r.Context(), db, auditSvc, session.UserID, id); err != nil {
+			http.Redirect(w, r, back+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		worker.Notify()
+		http.Redirect(w, r, back+"?status="+url.QueryEscape("delivery queued for retry"), http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,44 @@
+package admindeliveries
+
+type DeliveryView struct {
+	ID            int64  `bun:"id"`
+	Kind          string `bun:"kind"`
+	Endpoint      string `bun:"endpoint"`
+	Event         string `bun:"event"`
+	Status        string `bun:"status"`
+	Attempts      int    `bun:"attempts"`
+	MaxAttempts   int    `bun:"max_attempts"`
+	LastError     string `bun:"last_error"`
+	NextAttemptAt string `bun:"next_attempt_at"`
+	DeliveredAt   string `bun:"delivered_at"`
+	CreatedAt     string `bun:"created_at"`
+	UpdatedAt     string `bun:"updated_at"`
+}
+
+type StatusCount struct {
+	Status string `bun:"status"`
+	Count  int64  `bun:"count"`
+}
+
+type EndpointView struct {
+	Endpoint            string `bun:"endpoint"`
+	ConsecutiveFailures int    `bun:"consecutive_failures"`
+	OpenUntil           string `bun:"open_until"`
+}
+
+type PageData struct {
+	StatusFilter string
+	Counts       []StatusCount
+	Deliveries   []DeliveryView
+	OpenCircuits []EndpointView
+	Truncated    bool
+	Status       string
+	ErrorMessage string
+}
+
+type DetailPageData struct {
+	Delivery     DeliveryView
+	Payload      string
+	Status       string
+	ErrorMessage string
+}
@@ -0,0 +1,26 @@
+package adminembeds
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/embedwidget"
+	"receipter/infrastructure/sqlite"
+)
+
+func LoadPageData(ctx context.Context, db *sqlite.DB) (PageData, error) {
+	data := PageData{Projects: make([]ProjectOption, 0)}
+	tokens, err := embedwidget.List(ctx, db)
+	if err != nil {
+		return data, err
+	}
+	data.Tokens = tokens
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT id, name, client_name, status
+FROM projects
+ORDER BY status = 'active' DESC, name ASC`).Scan(ctx, &data.Projects)
+	})
+	return data, err
+}
@@ -0,0 +1,112 @@
+package adminembeds
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/embedwidget"
+	"receipter/infrastructure/sqlite"
+)
+
+func EmbedsPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := LoadPageData(r.Context(), db)
+		if err != nil {
+			http.Error(w, "failed to load widgets", http.StatusInternalServerError)
+			return
+		}
+		data.Status = r.URL.Query().Get("status")
+		data.ErrorMessage = r.URL.Query().Get("error")
+		renderPage(w, r, data)
+	}
+}
+
+// IssueEmbedCommandHandler renders the page directly instead of redirecting
+// so the widget URL never appears in a redirect or log.
+func IssueEmbedCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/admin/embeds?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		projectIDs := make([]int64, 0, len(r.Form["project_id"]))
+		for _, raw := range r.Form["project_id"] {
+			id, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+			if err != nil {
+				http.Redirect(w, r, "/tasker/admin/embeds?error="+url.QueryEscape("invalid project id"), http.StatusSeeOther)
+				return
+			}
+			projectIDs = append(projectIDs, id)
+		}
+		plaintext, token, err := embedwidget.Issue(r.Context(), db, auditSvc, session.UserID, r.FormValue("name"), projectIDs)
+		if err != nil {
+			message := "failed to issue widget"
+			if errors.Is(err, embedwidget.ErrNameRequired) || errors.Is(err, embedwidget.ErrProjectsRequired) || errors.Is(err, embedwidget.ErrUnknownProject) {
+				message = err.Error()
+			}
+			http.Redirect(w, r, "/tasker/admin/embeds?error="+url.QueryEscape(message), http.StatusSeeOther)
+			return
+		}
+
+		data, err := LoadPageData(r.Context(), db)
+		if err != nil {
+			http.Error(w, "failed to load widgets", http.StatusInternalServerError)
+			return
+		}
+		base := widgetBaseURL(r, plaintext)
+		data.WidgetURL = base + "/summary"
+		data.JSONURL = base + "/summary.json"
+		data.BoardURL = base + "/board"
+		data.IssuedName = token.Name
+		w.Header().Set("Cache-Control", "no-store")
+		renderPage(w, r, data)
+	}
+}
+
+func RevokeEmbedCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		tokenID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || tokenID <= 0 {
+			http.Redirect(w, r, "/tasker/admin/embeds?error="+url.QueryEscape("invalid widget id"), http.StatusSeeOther)
+			return
+		}
+		if err := embedwidget.Revoke(r.Context(), db, auditSvc, session.UserID, tokenID); err != nil {
+			http.Redirect(w, r, "/tasker/admin/embeds?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/tasker/admin/embeds?status="+url.QueryEscape("widget revoked"), http.StatusSeeOther)
+	}
+}
+
+func widgetBaseURL(r *http.Request, token string) string {
+	scheme := "http"
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/embed/" + url.PathEscape(token)
+}
+
+func renderPage(w http.ResponseWriter, r *http.Request, data PageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := EmbedsPage(data).Render(r.Context(), w); err != nil {
+		http.Error(w, "failed to render widgets page", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,35 @@
+package adminembeds
+
+import (
+	"time"
+
+	"receipter/infrastructure/embedwidget"
+	"receipter/infrastructure/fieldcrypt"
+)
+
+type ProjectOption struct {
+	ID         int64             `bun:"id"`
+	Name       string            `bun:"name"`
+	ClientName fieldcrypt.String `bun:"client_name"`
+	Status     string            `bun:"status"`
+}
+
+type PageData struct {
+	Tokens       []embedwidget.TokenView
+	Projects     []ProjectOption
+	Status       string
+	ErrorMessage string
+	// WidgetURL, JSONURL and BoardURL carry a just-issued token; they are
+	// shown once.
+	WidgetURL  string
+	JSONURL    string
+	BoardURL   string
+	IssuedName string
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
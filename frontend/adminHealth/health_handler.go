@@ -0,0 +1,72 @@
+package adminhealth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/uptrace/bun"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/integrity"
+	"receipter/infrastructure/sqlite"
+)
+
+// recentRunsLimit caps the run history shown under the latest results.
+const recentRunsLimit = 14
+
+func HealthPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := PageData{
+			Status:       r.URL.Query().Get("status"),
+			ErrorMessage: r.URL.Query().Get("error"),
+		}
+		var err error
+		data.Latest, data.HasRun, err = integrity.LatestRun(r.Context(), db)
+		if err != nil {
+			http.Error(w, "failed to load integrity results", http.StatusInternalServerError)
+			return
+		}
+		data.Runs, err = integrity.ListRuns(r.Context(), db, recentRunsLimit)
+		if err != nil {
+			http.Error(w, "failed to load integrity runs", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := HealthPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render health page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// RunChecksCommandHandler runs the integrity checks straight away instead of
+// waiting for the nightly run.
+func RunChecksCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		run, err := integrity.Run(r.Context(), db, integrity.Options{Trigger: integrity.TriggerManual, ActorUserID: session.UserID})
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/health?error="+url.QueryEscape("failed to run integrity checks: "+err.Error()), http.StatusSeeOther)
+			return
+		}
+		if err := db.WithWriteTx(r.Context(), func(ctx context.Context, tx bun.Tx) error {
+			return auditSvc.Write(ctx, tx, session.UserID, "integrity.run", "integrity_runs", strconv.FormatInt(run.ID, 10), nil, map[string]any{
+				"checks_run":    run.ChecksRun,
+				"checks_failed": run.ChecksFailed,
+			})
+		}); err != nil {
+			http.Redirect(w, r, "/tasker/admin/health?error="+url.QueryEscape("checks ran, but failed to write audit log"), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/tasker/admin/health?status="+url.QueryEscape(run.Subject()), http.StatusSeeOther)
+	}
+}
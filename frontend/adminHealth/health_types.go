@@ -0,0 +1,11 @@
+package adminhealth
+
+import "receipter/infrastructure/integrity"
+
+type PageData struct {
+	Latest       integrity.RunView
+	HasRun       bool
+	Runs         []integrity.RunView
+	Status       string
+	ErrorMessage string
+}
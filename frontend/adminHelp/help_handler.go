@@ -0,0 +1,148 @@
+package adminhelp
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/helpnotice"
+	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/sqlite"
+)
+
+const pagePath = "/tasker/admin/help"
+
+// HelpNoticesPageQueryHandler lists the help notices admins have written
+// for each role.
+func HelpNoticesPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		notices, err := helpnotice.List(r.Context(), db)
+		if err != nil {
+			http.Error(w, "failed to load help notices", http.StatusInternalServerError)
+			return
+		}
+		projects, err := projectinfra.List(r.Context(), db, "all")
+		if err != nil {
+			http.Error(w, "failed to load projects", http.StatusInternalServerError)
+			return
+		}
+		data := PageData{
+			Notices:      notices,
+			Projects:     projects,
+			Roles:        helpnotice.Roles,
+			Status:       r.URL.Query().Get("status"),
+			ErrorMessage: r.URL.Query().Get("error"),
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := HelpNoticesPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render help notices page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func CreateHelpNoticeCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		in, err := parseInput(r)
+		if err != nil {
+			http.Redirect(w, r, pagePath+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		if _, err := helpnotice.Create(r.Context(), db, auditSvc, session.UserID, in); err != nil {
+			redirectError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, pagePath+"?status="+url.QueryEscape("help notice created"), http.StatusSeeOther)
+	}
+}
+
+func UpdateHelpNoticeCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "invalid notice id", http.StatusBadRequest)
+			return
+		}
+		in, err := parseInput(r)
+		if err != nil {
+			http.Redirect(w, r, pagePath+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		if err := helpnotice.Update(r.Context(), db, auditSvc, session.UserID, id, in); err != nil {
+			redirectError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, pagePath+"?status="+url.QueryEscape("help notice updated"), http.StatusSeeOther)
+	}
+}
+
+func DeleteHelpNoticeCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "invalid notice id", http.StatusBadRequest)
+			return
+		}
+		if err := helpnotice.Delete(r.Context(), db, auditSvc, session.UserID, id); err != nil {
+			redirectError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, pagePath+"?status="+url.QueryEscape("help notice deleted"), http.StatusSeeOther)
+	}
+}
+
+var errInvalidProject = errors.New("invalid project")
+
+func parseInput(r *http.Request) (helpnotice.Input, error) {
+	if err := r.ParseForm(); err != nil {
+		return helpnotice.Input{}, errors.New("invalid form data")
+	}
+	in := helpnotice.Input{
+		Role:          r.FormValue("role"),
+		Title:         r.FormValue("title"),
+		Body:          r.FormValue("body"),
+		ShowOnReceipt: r.FormValue("show_on_receipt") != "",
+		Active:        r.FormValue("active") != "",
+	}
+	if raw := strings.TrimSpace(r.FormValue("project_id")); raw != "" {
+		projectID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || projectID <= 0 {
+			return in, errInvalidProject
+		}
+		in.ProjectID = &projectID
+	}
+	return in, nil
+}
+
+func redirectError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, helpnotice.ErrTitleRequired), errors.Is(err, helpnotice.ErrTitleTooLong),
+		errors.Is(err, helpnotice.ErrBodyTooLong), errors.Is(err, helpnotice.ErrInvalidRole),
+		errors.Is(err, helpnotice.ErrNotFound):
+		http.Redirect(w, r, pagePath+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+	default:
+		http.Error(w, "failed to save help notice", http.StatusInternalServerError)
+	}
+}
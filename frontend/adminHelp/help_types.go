@@ -0,0 +1,30 @@
+package adminhelp
+
+import (
+	"receipter/infrastructure/helpnotice"
+	"receipter/models"
+)
+
+type PageData struct {
+	Notices      []helpnotice.Notice
+	Projects     []models.Project
+	Roles        []string
+	Status       string
+	ErrorMessage string
+}
+
+func projectSelected(n helpnotice.Notice, projectID int64) bool {
+	return n.ProjectID != nil && *n.ProjectID == projectID
+}
+
+func roleLabel(role string) string {
+	switch role {
+	case "scanner":
+		return "Scanners"
+	case "admin":
+		return "Admins"
+	case "client":
+		return "Clients"
+	}
+	return role
+}
@@ -0,0 +1,38 @@
+package adminkiosks
+
+import (
+	"context"
+
+	kioskinfra "receipter/infrastructure/kiosk"
+	"receipter/infrastructure/site"
+	"receipter/infrastructure/sqlite"
+)
+
+// LoadPageData lists the kiosks in scope and the scanners who can use them:
+// with a site picked, its scanners and those with no site.
+func LoadPageData(ctx context.Context, db *sqlite.DB, scope site.Scope) (PageData, error) {
+	data := PageData{Scope: scope, SiteNames: map[int64]string{}}
+	devices, err := kioskinfra.ListDevices(ctx, db)
+	if err != nil {
+		return data, err
+	}
+	scanners, err := kioskinfra.ListPINUsers(ctx, db, false, scope.ActiveID())
+	if err != nil {
+		return data, err
+	}
+	sites, err := site.List(ctx, db, true)
+	if err != nil {
+		return data, err
+	}
+	for _, s := range sites {
+		data.SiteNames[s.ID] = s.Name
+	}
+	data.HasSites = len(sites) > 0
+	for _, d := range devices {
+		if scope.Includes(d.SiteID) {
+			data.Devices = append(data.Devices, d)
+		}
+	}
+	data.Scanners = scanners
+	return data, nil
+}
@@ -0,0 +1,220 @@
+package adminkiosks
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/cache"
+	kioskinfra "receipter/infrastructure/kiosk"
+	"receipter/infrastructure/site"
+	"receipter/infrastructure/sqlite"
+)
+
+func KiosksPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		scope, err := site.ResolveScope(r.Context(), db, session.UserID, session.ActiveSiteID)
+		if err != nil {
+			http.Error(w, "failed to load sites", http.StatusInternalServerError)
+			return
+		}
+		data, err := LoadPageData(r.Context(), db, scope)
+		if err != nil {
+			http.Error(w, "failed to load kiosks", http.StatusInternalServerError)
+			return
+		}
+		data.Status = r.URL.Query().Get("status")
+		data.ErrorMessage = r.URL.Query().Get("error")
+		renderPage(w, r, data)
+	}
+}
+
+// CreateKioskCommandHandler renders the page directly instead of redirecting
+// so the enrollment link never appears in a URL or log.
+func CreateKioskCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/admin/kiosks?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		siteID, err := site.ParseID(r.FormValue("site_id"))
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/kiosks?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		scope, err := site.ResolveScope(r.Context(), db, session.UserID, session.ActiveSiteID)
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/kiosks?error="+url.QueryEscape("failed to load sites"), http.StatusSeeOther)
+			return
+		}
+		if !scope.CanAssign(siteID) {
+			http.Redirect(w, r, "/tasker/admin/kiosks?error="+url.QueryEscape("pick one of your sites for the kiosk"), http.StatusSeeOther)
+			return
+		}
+		token, device, err := kioskinfra.Create(r.Context(), db, auditSvc, session.UserID, r.FormValue("name"), siteID)
+		if err != nil {
+			message := "failed to create kiosk"
+			if errors.Is(err, kioskinfra.ErrNameRequired) {
+				message = err.Error()
+			}
+			http.Redirect(w, r, "/tasker/admin/kiosks?error="+url.QueryEscape(message), http.StatusSeeOther)
+			return
+		}
+
+		data, err := LoadPageData(r.Context(), db, scope)
+		if err != nil {
+			http.Error(w, "failed to load kiosks", http.StatusInternalServerError)
+			return
+		}
+		data.EnrollmentURL = enrollmentURL(r, token)
+		data.CreatedName = device.Name
+		w.Header().Set("Cache-Control", "no-store")
+		renderPage(w, r, data)
+	}
+}
+
+func RevokeKioskCommandHandler(db *sqlite.DB, auditSvc *audit.Service, sessionCache cache.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		deviceID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || deviceID <= 0 {
+			http.Redirect(w, r, "/tasker/admin/kiosks?error="+url.QueryEscape("invalid kiosk id"), http.StatusSeeOther)
+			return
+		}
+		ended, err := kioskinfra.Revoke(r.Context(), db, auditSvc, session.UserID, deviceID)
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/kiosks?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		for _, id := range ended {
+			sessionCache.DeleteSessionBySessionToken(id)
+		}
+		http.Redirect(w, r, "/tasker/admin/kiosks?status="+url.QueryEscape("kiosk revoked"), http.StatusSeeOther)
+	}
+}
+
+// SetKioskSiteCommandHandler moves a kiosk to another site. Its PIN screen
+// then lists that site's scanners.
+func SetKioskSiteCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		deviceID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || deviceID <= 0 {
+			http.Redirect(w, r, "/tasker/admin/kiosks?error="+url.QueryEscape("invalid kiosk id"), http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/admin/kiosks?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		siteID, err := site.ParseID(r.FormValue("site_id"))
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/kiosks?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		devices, err := kioskinfra.ListDevices(r.Context(), db)
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/kiosks?error="+url.QueryEscape("failed to load kiosks"), http.StatusSeeOther)
+			return
+		}
+		var current *kioskinfra.DeviceView
+		for i := range devices {
+			if devices[i].ID == deviceID {
+				current = &devices[i]
+			}
+		}
+		if current == nil {
+			http.Redirect(w, r, "/tasker/admin/kiosks?error="+url.QueryEscape(kioskinfra.ErrNotFound.Error()), http.StatusSeeOther)
+			return
+		}
+		scope, err := site.ResolveScope(r.Context(), db, session.UserID, nil)
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/kiosks?error="+url.QueryEscape("failed to load sites"), http.StatusSeeOther)
+			return
+		}
+		if !scope.Includes(current.SiteID) || !scope.CanAssign(siteID) {
+			http.Redirect(w, r, "/tasker/admin/kiosks?error="+url.QueryEscape("pick one of your sites for the kiosk"), http.StatusSeeOther)
+			return
+		}
+		if err := site.SetKioskSite(r.Context(), db, auditSvc, session.UserID, deviceID, siteID); err != nil {
+			http.Redirect(w, r, "/tasker/admin/kiosks?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/tasker/admin/kiosks?status="+url.QueryEscape("kiosk site updated"), http.StatusSeeOther)
+	}
+}
+
+// SetPINCommandHandler sets or, with an empty PIN, clears a scanner's kiosk
+// PIN.
+func SetPINCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || userID <= 0 {
+			http.Redirect(w, r, "/tasker/admin/kiosks?error="+url.QueryEscape("invalid user id"), http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/admin/kiosks?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		pin := strings.TrimSpace(r.FormValue("pin"))
+		if err := kioskinfra.SetPIN(r.Context(), db, auditSvc, session.UserID, userID, pin); err != nil {
+			message := "failed to update PIN"
+			if errors.Is(err, kioskinfra.ErrPINFormat) || errors.Is(err, kioskinfra.ErrInvalidPINUser) {
+				message = err.Error()
+			}
+			http.Redirect(w, r, "/tasker/admin/kiosks?error="+url.QueryEscape(message), http.StatusSeeOther)
+			return
+		}
+		status := "PIN updated"
+		if pin == "" {
+			status = "PIN cleared"
+		}
+		http.Redirect(w, r, "/tasker/admin/kiosks?status="+url.QueryEscape(status), http.StatusSeeOther)
+	}
+}
+
+func enrollmentURL(r *http.Request, token string) string {
+	scheme := "http"
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/kiosk/enroll?token=" + url.QueryEscape(token)
+}
+
+func renderPage(w http.ResponseWriter, r *http.Request, data PageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := KiosksPage(data).Render(r.Context(), w); err != nil {
+		http.Error(w, "failed to render kiosks page", http.StatusInternalServerError)
+		return
+	}
+}
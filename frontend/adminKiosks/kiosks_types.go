@@ -0,0 +1,52 @@
+package adminkiosks
+
+import (
+	"time"
+
+	kioskinfra "receipter/infrastructure/kiosk"
+	"receipter/infrastructure/site"
+)
+
+type PageData struct {
+	Devices      []kioskinfra.DeviceView
+	Scanners     []kioskinfra.PINUser
+	Status       string
+	ErrorMessage string
+	// EnrollmentURL carries a just-created kiosk's device token; it is shown
+	// once.
+	EnrollmentURL string
+	CreatedName   string
+	// Scope is the admin's sites; HasSites hides the site column until the
+	// first site exists.
+	Scope     site.Scope
+	HasSites  bool
+	SiteNames map[int64]string
+}
+
+func (d PageData) siteSelected(siteID *int64, optionID int64) bool {
+	return siteID != nil && *siteID == optionID
+}
+
+// siteOutOfScope reports a device site the admin cannot pick, such as an
+// inactive one, so the picker can still show it.
+func (d PageData) siteOutOfScope(siteID *int64) bool {
+	return siteID != nil && !d.Scope.CanAssign(siteID)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func deviceState(d kioskinfra.DeviceView) (label, class string) {
+	switch {
+	case d.RevokedAt != nil:
+		return "Revoked", "badge badge-soft badge-ghost"
+	case d.EnrolledAt == nil:
+		return "Awaiting enrollment", "badge badge-soft badge-warning"
+	default:
+		return "Enrolled", "badge badge-soft badge-success"
+	}
+}
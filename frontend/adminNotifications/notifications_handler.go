@@ -0,0 +1,129 @@
+package adminnotifications
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/notification"
+	"receipter/infrastructure/sqlite"
+)
+
+const pageURL = "/tasker/admin/notifications"
+
+func parseFilter(values url.Values) notification.Filter {
+	filter := notification.Filter{UnreadOnly: values.Get("unread") == "1"}
+	kind := strings.TrimSpace(values.Get("kind"))
+	for _, known := range notification.Kinds {
+		if kind == known {
+			filter.Kind = kind
+		}
+	}
+	return filter
+}
+
+func filterQuery(filter notification.Filter) string {
+	values := url.Values{}
+	if filter.Kind != "" {
+		values.Set("kind", filter.Kind)
+	}
+	if filter.UnreadOnly {
+		values.Set("unread", "1")
+	}
+	return values.Encode()
+}
+
+func backURL(filter notification.Filter, status string) string {
+	values, _ := url.ParseQuery(filterQuery(filter))
+	if status != "" {
+		values.Set("status", status)
+	}
+	if encoded := values.Encode(); encoded != "" {
+		return pageURL + "?" + encoded
+	}
+	return pageURL
+}
+
+func NotificationsPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		query := r.URL.Query()
+		data := PageData{Filter: parseFilter(query), Status: query.Get("status")}
+		now := time.Now().UTC()
+		var err error
+		if data.Items, err = notification.List(r.Context(), db, session.UserID, data.Filter, now); err != nil {
+			http.Error(w, "failed to load notifications", http.StatusInternalServerError)
+			return
+		}
+		if data.Unread, err = notification.UnreadCount(r.Context(), db, session.UserID, now); err != nil {
+			http.Error(w, "failed to load notifications", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := NotificationsPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render notifications page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// OpenNotificationCommandHandler marks a notification read and follows its
+// link, or returns to the list when it has none.
+func OpenNotificationCommandHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		_ = r.ParseForm()
+		filter := parseFilter(r.Form)
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Redirect(w, r, backURL(filter, "Invalid notification"), http.StatusSeeOther)
+			return
+		}
+		item, err := notification.MarkRead(r.Context(), db, session.UserID, id)
+		if err != nil {
+			status := "Failed to open notification"
+			if errors.Is(err, notification.ErrNotFound) {
+				status = err.Error()
+			}
+			http.Redirect(w, r, backURL(filter, status), http.StatusSeeOther)
+			return
+		}
+		if r.FormValue("follow") == "1" && strings.HasPrefix(item.Link, "/tasker/") {
+			http.Redirect(w, r, item.Link, http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, backURL(filter, ""), http.StatusSeeOther)
+	}
+}
+
+func MarkAllReadCommandHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		_ = r.ParseForm()
+		filter := parseFilter(r.Form)
+		status := "All notifications marked read"
+		if err := notification.MarkAllRead(r.Context(), db, session.UserID, time.Now().UTC()); err != nil {
+			status = "Failed to mark notifications read"
+		}
+		http.Redirect(w, r, backURL(filter, status), http.StatusSeeOther)
+	}
+}
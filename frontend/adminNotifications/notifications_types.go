@@ -0,0 +1,10 @@
+package adminnotifications
+
+import "receipter/infrastructure/notification"
+
+type PageData struct {
+	Filter notification.Filter
+	Items  []notification.Item
+	Unread int64
+	Status string
+}
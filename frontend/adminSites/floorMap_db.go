@@ -0,0 +1,80 @@
+package adminsites
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/floormap"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+func LoadSite(ctx context.Context, db *sqlite.DB, siteID int64) (models.Site, error) {
+	var s models.Site
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewSelect().Model(&s).Where("st.id = ?", siteID).Limit(1).Scan(ctx)
+	})
+	return s, err
+}
+
+// LoadFloorMapPageData lays a site's map out row by row and, when cell names
+// a cell on the map, lists the pallets stored there.
+func LoadFloorMapPageData(ctx context.Context, db *sqlite.DB, s models.Site, cell string) (FloorMapPageData, error) {
+	data := FloorMapPageData{Site: s, StatusTotals: make(map[string]int)}
+	m, err := floormap.Load(ctx, db, s.ID)
+	if err != nil {
+		return data, err
+	}
+	data.Map = m
+	if !m.Configured() {
+		return data, nil
+	}
+	summaries, err := floormap.Summaries(ctx, db, s.ID)
+	if err != nil {
+		return data, err
+	}
+	selectedRow, selectedCol, err := floormap.ParseCell(cell)
+	if err != nil || !m.Contains(selectedRow, selectedCol) {
+		selectedRow, selectedCol = 0, 0
+	}
+
+	data.Columns = make([]string, 0, m.Cols)
+	for col := 1; col <= m.Cols; col++ {
+		data.Columns = append(data.Columns, floormap.ColumnLetters(col))
+	}
+	data.Rows = make([]FloorMapRow, 0, m.Rows)
+	for row := 1; row <= m.Rows; row++ {
+		r := FloorMapRow{Row: row, Cells: make([]FloorMapCell, 0, m.Cols)}
+		for col := 1; col <= m.Cols; col++ {
+			c := FloorMapCell{
+				Row:      row,
+				Col:      col,
+				Label:    floormap.CellLabel(row, col),
+				Summary:  summaries[floormap.Cell{Row: row, Col: col}],
+				Selected: row == selectedRow && col == selectedCol,
+			}
+			if z, ok := m.ZoneAt(row, col); ok {
+				c.ZoneCode = z.Code
+			}
+			r.Cells = append(r.Cells, c)
+		}
+		data.Rows = append(data.Rows, r)
+	}
+	for _, summary := range summaries {
+		for status, count := range summary.Counts {
+			data.StatusTotals[status] += count
+		}
+	}
+
+	if selectedRow > 0 {
+		data.SelectedCell = floormap.CellLabel(selectedRow, selectedCol)
+		if z, ok := m.ZoneAt(selectedRow, selectedCol); ok {
+			data.SelectedZone = z.Name
+		}
+		if data.CellPallets, err = floormap.CellPallets(ctx, db, s.ID, selectedRow, selectedCol); err != nil {
+			return data, err
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,210 @@
+package adminsites
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/floormap"
+	"receipter/infrastructure/palletlabel"
+	"receipter/infrastructure/site"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+// userFloorMapErrors are the failures shown to the user as they are; anything
+// else is logged and reported generically.
+var userFloorMapErrors = []error{
+	floormap.ErrInvalidSize,
+	floormap.ErrNotConfigured,
+	floormap.ErrInvalidCell,
+	floormap.ErrCellOutside,
+	floormap.ErrCellsOccupied,
+	floormap.ErrZonesOutside,
+	floormap.ErrZoneCodeRequired,
+	floormap.ErrZoneNameRequired,
+	floormap.ErrZoneCodeExists,
+	floormap.ErrZoneNotFound,
+	floormap.ErrPalletNotFound,
+	floormap.ErrPalletOtherSite,
+	floormap.ErrPalletCancelled,
+	floormap.ErrPalletNotPlaced,
+	palletlabel.ErrInvalidCode,
+}
+
+func FloorMapPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s, ok := loadFloorMapSite(w, r, db)
+		if !ok {
+			return
+		}
+		data, err := LoadFloorMapPageData(r.Context(), db, s, r.URL.Query().Get("cell"))
+		if err != nil {
+			slog.Error("load floor map failed", slog.Any("err", err))
+			http.Error(w, "failed to load floor map", http.StatusInternalServerError)
+			return
+		}
+		data.Status = r.URL.Query().Get("status")
+		data.ErrorMessage = r.URL.Query().Get("error")
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := FloorMapPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render floor map", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func ConfigureFloorMapCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return floorMapCommand(db, func(r *http.Request, userID int64, s models.Site) (string, string, error) {
+		rows, _ := strconv.Atoi(strings.TrimSpace(r.FormValue("rows")))
+		cols, _ := strconv.Atoi(strings.TrimSpace(r.FormValue("cols")))
+		return "floor map saved", "", floormap.Configure(r.Context(), db, auditSvc, userID, s.ID, rows, cols)
+	})
+}
+
+func AddFloorMapZoneCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return floorMapCommand(db, func(r *http.Request, userID int64, s models.Site) (string, string, error) {
+		z, err := floormap.AddZone(r.Context(), db, auditSvc, userID, s.ID, r.FormValue("code"), r.FormValue("name"), r.FormValue("from_cell"), r.FormValue("to_cell"))
+		return "zone added: " + z.Code, "", err
+	})
+}
+
+func DeleteFloorMapZoneCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return floorMapCommand(db, func(r *http.Request, userID int64, s models.Site) (string, string, error) {
+		zoneID, err := strconv.ParseInt(chi.URLParam(r, "zoneID"), 10, 64)
+		if err != nil || zoneID <= 0 {
+			return "", "", floormap.ErrZoneNotFound
+		}
+		return "zone deleted", "", floormap.DeleteZone(r.Context(), db, auditSvc, userID, s.ID, zoneID)
+	})
+}
+
+// PlacePalletCommandHandler stores a pallet, scanned or typed by its code, in
+// a cell and returns to that cell's list.
+func PlacePalletCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return floorMapCommand(db, func(r *http.Request, userID int64, s models.Site) (string, string, error) {
+		cell := strings.ToUpper(strings.TrimSpace(r.FormValue("cell")))
+		row, col, err := floormap.ParseCell(cell)
+		if err != nil {
+			return "", "", err
+		}
+		palletID, _, err := palletlabel.ParseCode(r.FormValue("pallet"))
+		if err != nil {
+			return "", cell, err
+		}
+		err = floormap.Place(r.Context(), db, auditSvc, userID, s.ID, palletID, row, col)
+		return fmt.Sprintf("%s placed in %s", palletlabel.Code(palletID, 0), floormap.CellLabel(row, col)), floormap.CellLabel(row, col), err
+	})
+}
+
+func RemovePalletLocationCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return floorMapCommand(db, func(r *http.Request, userID int64, s models.Site) (string, string, error) {
+		cell := strings.ToUpper(strings.TrimSpace(r.FormValue("cell")))
+		palletID, err := strconv.ParseInt(chi.URLParam(r, "palletID"), 10, 64)
+		if err != nil || palletID <= 0 {
+			return "", cell, floormap.ErrPalletNotFound
+		}
+		err = floormap.Remove(r.Context(), db, auditSvc, userID, s.ID, palletID)
+		return palletlabel.Code(palletID, 0) + " removed from the map", cell, err
+	})
+}
+
+// floorMapCommand runs a floor map form post and redirects back to the map
+// with its outcome, keeping the cell the action returns when it names one.
+func floorMapCommand(db *sqlite.DB, run func(r *http.Request, userID int64, s models.Site) (status, cell string, err error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		s, ok := loadFloorMapSite(w, r, db)
+		if !ok {
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, floorMapURL(s.ID, "", "error", "invalid form data"), http.StatusSeeOther)
+			return
+		}
+		status, cell, err := run(r, session.UserID, s)
+		if err != nil {
+			message := "failed to update floor map"
+			if isUserFloorMapError(err) {
+				message = err.Error()
+			} else {
+				slog.Error("floor map update failed", slog.Any("err", err))
+			}
+			http.Redirect(w, r, floorMapURL(s.ID, cell, "error", message), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, floorMapURL(s.ID, cell, "status", status), http.StatusSeeOther)
+	}
+}
+
+// loadFloorMapSite loads the site in the URL, answering 404 for sites the
+// user is not assigned to.
+func loadFloorMapSite(w http.ResponseWriter, r *http.Request, db *sqlite.DB) (models.Site, bool) {
+	session, ok := context.GetSessionFromContext(r.Context())
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return models.Site{}, false
+	}
+	siteID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || siteID <= 0 {
+		http.Error(w, "invalid site id", http.StatusBadRequest)
+		return models.Site{}, false
+	}
+	scope, err := site.ResolveScope(r.Context(), db, session.UserID, nil)
+	if err != nil {
+		http.Error(w, "failed to load sites", http.StatusInternalServerError)
+		return models.Site{}, false
+	}
+	if scope.Restricted && !scope.CanAssign(&siteID) {
+		http.Error(w, "site not found", http.StatusNotFound)
+		return models.Site{}, false
+	}
+	s, err := LoadSite(r.Context(), db, siteID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "site not found", http.StatusNotFound)
+			return models.Site{}, false
+		}
+		http.Error(w, "failed to load site", http.StatusInternalServerError)
+		return models.Site{}, false
+	}
+	return s, true
+}
+
+func isUserFloorMapError(err error) bool {
+	for _, target := range userFloorMapErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func floorMapURL(siteID int64, cell, key, message string) string {
+	q := url.Values{}
+	if cell != "" {
+		q.Set("cell", cell)
+	}
+	if message != "" {
+		q.Set(key, message)
+	}
+	path := fmt.Sprintf("/tasker/admin/sites/%d/floor-map", siteID)
+	if len(q) == 0 {
+		return path
+	}
+	return path + "?" + q.Encode()
+}
@@ -0,0 +1,35 @@
+package adminsites
+
+import (
+	"receipter/infrastructure/floormap"
+	"receipter/models"
+)
+
+type FloorMapCell struct {
+	Row      int
+	Col      int
+	Label    string
+	ZoneCode string
+	Summary  floormap.CellSummary
+	Selected bool
+}
+
+type FloorMapRow struct {
+	Row   int
+	Cells []FloorMapCell
+}
+
+type FloorMapPageData struct {
+	Site    models.Site
+	Map     floormap.Map
+	Columns []string
+	Rows    []FloorMapRow
+	// StatusTotals counts the pallets on the map by status, for the legend.
+	StatusTotals map[string]int
+	// SelectedCell is the label of the cell whose pallets are listed, if any.
+	SelectedCell string
+	SelectedZone string
+	CellPallets  []floormap.StoredPallet
+	Status       string
+	ErrorMessage string
+}
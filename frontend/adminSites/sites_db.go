@@ -0,0 +1,29 @@
+package adminsites
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func LoadPageData(ctx context.Context, db *sqlite.DB) (PageData, error) {
+	data := PageData{Sites: make([]SiteView, 0)}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`
+SELECT st.id, st.code, st.name, st.active,
+       (SELECT COUNT(1) FROM projects p WHERE p.site_id = st.id) AS project_count,
+       (SELECT COUNT(1) FROM kiosk_devices kd WHERE kd.site_id = st.id AND kd.revoked_at IS NULL) AS kiosk_count,
+       (SELECT COUNT(1) FROM user_sites us WHERE us.site_id = st.id) AS user_count
+FROM sites st
+ORDER BY st.active DESC, st.name COLLATE NOCASE ASC, st.id ASC`).Scan(ctx, &data.Sites); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM projects WHERE site_id IS NULL`).Scan(ctx, &data.UnassignedProjects); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT COUNT(1) FROM kiosk_devices WHERE site_id IS NULL AND revoked_at IS NULL`).Scan(ctx, &data.UnassignedKiosks)
+	})
+	return data, err
+}
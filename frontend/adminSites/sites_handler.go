@@ -0,0 +1,123 @@
+package adminsites
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/frontend/shared/context"
+	"receipter/frontend/shared/nav"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/cache"
+	"receipter/infrastructure/site"
+	"receipter/infrastructure/sqlite"
+)
+
+func SitesPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := LoadPageData(r.Context(), db)
+		if err != nil {
+			http.Error(w, "failed to load sites", http.StatusInternalServerError)
+			return
+		}
+		data.Status = r.URL.Query().Get("status")
+		data.ErrorMessage = r.URL.Query().Get("error")
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := SitesPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render sites page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func CreateSiteCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/admin/sites?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		created, err := site.Create(r.Context(), db, auditSvc, session.UserID, r.FormValue("code"), r.FormValue("name"))
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/sites?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/tasker/admin/sites?status="+url.QueryEscape("site created: "+created.Name), http.StatusSeeOther)
+	}
+}
+
+func UpdateSiteCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		siteID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || siteID <= 0 {
+			http.Redirect(w, r, "/tasker/admin/sites?error="+url.QueryEscape("invalid site id"), http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/admin/sites?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		active := r.FormValue("active") != ""
+		if err := site.Update(r.Context(), db, auditSvc, session.UserID, siteID, r.FormValue("name"), active); err != nil {
+			http.Redirect(w, r, "/tasker/admin/sites?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/tasker/admin/sites?status="+url.QueryEscape("site updated"), http.StatusSeeOther)
+	}
+}
+
+// SwitchSiteCommandHandler stores the site picked in the switcher on the
+// session and returns to the page it was picked on.
+func SwitchSiteCommandHandler(db *sqlite.DB, sessionCache cache.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form data", http.StatusBadRequest)
+			return
+		}
+		returnTo := nav.ReturnPath(r.FormValue("return_to"), "/tasker/projects")
+
+		siteID, err := site.ParseID(r.FormValue("site_id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if siteID != nil {
+			scope, err := site.ResolveScope(r.Context(), db, session.UserID, siteID)
+			if err != nil {
+				http.Error(w, "failed to load sites", http.StatusInternalServerError)
+				return
+			}
+			if scope.Active == nil {
+				http.Error(w, "site not available", http.StatusForbidden)
+				return
+			}
+		}
+
+		if err := site.SetSessionActiveSiteID(r.Context(), db, session.ID, siteID); err != nil {
+			http.Error(w, "failed to switch site", http.StatusInternalServerError)
+			return
+		}
+		session.ActiveSiteID = siteID
+		if sessionCache != nil {
+			sessionCache.AddSession(session)
+		}
+		http.Redirect(w, r, returnTo, http.StatusSeeOther)
+	}
+}
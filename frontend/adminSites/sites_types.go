@@ -0,0 +1,20 @@
+package adminsites
+
+type SiteView struct {
+	ID           int64  `bun:"id"`
+	Code         string `bun:"code"`
+	Name         string `bun:"name"`
+	Active       bool   `bun:"active"`
+	ProjectCount int64  `bun:"project_count"`
+	KioskCount   int64  `bun:"kiosk_count"`
+	UserCount    int64  `bun:"user_count"`
+}
+
+type PageData struct {
+	Sites []SiteView
+	// Unassigned counts projects and kiosks not yet given a site.
+	UnassignedProjects int64
+	UnassignedKiosks   int64
+	Status             string
+	ErrorMessage       string
+}
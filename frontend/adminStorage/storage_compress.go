@@ -0,0 +1,85 @@
+package adminstorage
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+)
+
+const (
+	compressMaxDimension = 1600
+	compressJPEGQuality  = 70
+	// compressMinSavingPercent stops repeat runs from re-encoding photos that
+	// are already compressed, losing quality for a few hundred bytes.
+	compressMinSavingPercent = 10
+)
+
+// compressPhoto downscales a JPEG or PNG so its longest side is at most
+// compressMaxDimension and re-encodes it as JPEG. ok is false when the blob is
+// not a supported image or the result would not be meaningfully smaller.
+func compressPhoto(blob []byte) ([]byte, bool) {
+	switch http.DetectContentType(blob) {
+	case "image/jpeg", "image/png":
+	default:
+		return nil, false
+	}
+	src, _, err := image.Decode(bytes.NewReader(blob))
+	if err != nil {
+		return nil, false
+	}
+
+	// Flatten onto white so transparent PNG areas do not turn black as JPEG.
+	bounds := src.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), src, bounds.Min, draw.Over)
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, downscale(flat, compressMaxDimension), &jpeg.Options{Quality: compressJPEGQuality}); err != nil {
+		return nil, false
+	}
+	if out.Len()*100 > len(blob)*(100-compressMinSavingPercent) {
+		return nil, false
+	}
+	return out.Bytes(), true
+}
+
+// downscale shrinks src so neither side exceeds maxDim, averaging the source
+// pixels covered by each destination pixel.
+func downscale(src *image.RGBA, maxDim int) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if w <= maxDim && h <= maxDim {
+		return src
+	}
+	dw, dh := maxDim, h*maxDim/w
+	if h > w {
+		dw, dh = w*maxDim/h, maxDim
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					b += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
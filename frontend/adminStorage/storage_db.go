@@ -0,0 +1,342 @@
+package adminstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/coldstorage"
+	"receipter/infrastructure/photoorphan"
+	"receipter/infrastructure/photoquota"
+	"receipter/infrastructure/photoretention"
+	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/sqlite"
+)
+
+const (
+	largestPalletsLimit   = 10
+	recentRedactionsLimit = 20
+	recentOrphanSweeps    = 10
+	recentColdStorageRuns = 10
+)
+
+var (
+	ErrProjectNotFound = errors.New("project not found")
+	ErrProjectActive   = errors.New("photos can only be pruned or compressed for inactive projects")
+)
+
+// photoBlobsCTE lists every stored photo with its owning project and pallet:
+// the gallery photos in receipt_photos and the original single stock photo
+// kept on pallet_receipts. Photos in cold storage have an empty blob and are
+// left out.
+const photoBlobsCTE = `
+WITH photo_blobs AS (
+    SELECT pr.project_id, pr.pallet_id, LENGTH(rp.photo_blob) AS bytes
+    FROM receipt_photos rp
+    JOIN pallet_receipts pr ON pr.id = rp.pallet_receipt_id
+    WHERE LENGTH(rp.photo_blob) > 0
+    UNION ALL
+    SELECT project_id, pallet_id, LENGTH(stock_photo_blob) AS bytes
+    FROM pallet_receipts
+    WHERE LENGTH(stock_photo_blob) > 0
+)`
+
+func LoadPageData(ctx context.Context, db *sqlite.DB) (PageData, error) {
+	data := PageData{
+		Tables:   make([]TableView, 0),
+		Projects: make([]ProjectPhotoView, 0),
+		Pallets:  make([]PalletView, 0),
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`
+SELECT pc.page_count * ps.page_size, fc.freelist_count * ps.page_size
+FROM pragma_page_count() pc, pragma_page_size() ps, pragma_freelist_count() fc`).Scan(ctx, &data.Summary.DatabaseBytes, &data.Summary.FreeBytes); err != nil {
+			return err
+		}
+		tables, err := loadTableSizes(ctx, tx)
+		if err != nil {
+			return err
+		}
+		data.Tables = tables
+
+		if err := tx.NewRaw(photoBlobsCTE+`
+SELECT p.id AS project_id, p.name AS project_name, p.client_name, p.status,
+       COUNT(pb.bytes) AS photo_count,
+       COALESCE(SUM(pb.bytes), 0) AS photo_bytes
+FROM projects p
+LEFT JOIN photo_blobs pb ON pb.project_id = p.id
+GROUP BY p.id
+ORDER BY photo_bytes DESC, p.name ASC`).Scan(ctx, &data.Projects); err != nil {
+			return err
+		}
+		for i, project := range data.Projects {
+			data.Summary.PhotoCount += project.PhotoCount
+			data.Summary.PhotoBytes += project.PhotoBytes
+			settings, err := projectsettings.LoadTx(ctx, tx, project.ProjectID)
+			if err != nil {
+				return err
+			}
+			data.Projects[i].QuotaBytes = photoquota.LoadConfig(settings).QuotaBytes
+		}
+
+		if err := tx.NewRaw(photoBlobsCTE+`
+SELECT pb.pallet_id, p.name AS project_name, pl.status,
+       COUNT(1) AS photo_count,
+       SUM(pb.bytes) AS photo_bytes
+FROM photo_blobs pb
+JOIN pallets pl ON pl.id = pb.pallet_id
+JOIN projects p ON p.id = pb.project_id
+GROUP BY pb.pallet_id
+ORDER BY photo_bytes DESC, pb.pallet_id ASC
+LIMIT ?`, largestPalletsLimit).Scan(ctx, &data.Pallets); err != nil {
+			return err
+		}
+
+		return tx.NewRaw(`SELECT COALESCE(SUM(LENGTH(data)), 0) FROM photo_upload_chunks`).Scan(ctx, &data.Summary.StagedUploadSize)
+	})
+	if err != nil {
+		return data, err
+	}
+	if data.Retention, err = photoretention.LoadUpcoming(ctx, db, time.Now().UTC()); err != nil {
+		return data, err
+	}
+	if data.Redactions, err = photoretention.ListStubs(ctx, db, 0, recentRedactionsLimit); err != nil {
+		return data, err
+	}
+	if data.Orphans, err = photoorphan.Detect(ctx, db); err != nil {
+		return data, err
+	}
+	data.OrphanSweeps, data.OrphanBytesReclaimed, err = photoorphan.ListRuns(ctx, db, recentOrphanSweeps)
+	if err != nil {
+		return data, err
+	}
+	archived, err := coldstorage.ListArchived(ctx, db)
+	if err != nil {
+		return data, err
+	}
+	for i := range data.Projects {
+		data.Projects[i].ArchivedCount = archived[data.Projects[i].ProjectID].Photos
+		data.Projects[i].ArchivedBytes = archived[data.Projects[i].ProjectID].Bytes
+	}
+	data.ColdStorageRuns, err = coldstorage.ListRuns(ctx, db, recentColdStorageRuns)
+	return data, err
+}
+
+// loadTableSizes approximates each table's footprint by summing the stored
+// length of every column. The sqlite3 driver is built without DBSTAT, so
+// exact page usage per table is not available.
+func loadTableSizes(ctx context.Context, tx bun.Tx) ([]TableView, error) {
+	var names []string
+	if err := tx.NewRaw(`
+SELECT name FROM sqlite_master
+WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+ORDER BY name ASC`).Scan(ctx, &names); err != nil {
+		return nil, err
+	}
+	tables := make([]TableView, 0, len(names))
+	for _, name := range names {
+		var columns []string
+		if err := tx.NewRaw(`SELECT name FROM pragma_table_info(?)`, name).Scan(ctx, &columns); err != nil {
+			return nil, err
+		}
+		lengths := make([]string, 0, len(columns))
+		for _, column := range columns {
+			lengths = append(lengths, fmt.Sprintf("COALESCE(LENGTH(%s), 0)", quoteIdent(column)))
+		}
+		table := TableView{Name: name}
+		query := fmt.Sprintf(`SELECT COUNT(1), COALESCE(SUM(%s), 0) FROM %s`, strings.Join(lengths, " + "), quoteIdent(name))
+		if err := tx.NewRaw(query).Scan(ctx, &table.RowCount, &table.Bytes); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	sort.SliceStable(tables, func(i, j int) bool { return tables[i].Bytes > tables[j].Bytes })
+	return tables, nil
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// PrunePhotos deletes every stored photo for an inactive project. With dryRun
+// set it only reports how many photos and bytes would be removed.
+func PrunePhotos(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID int64, dryRun bool) (ToolResult, error) {
+	result := ToolResult{DryRun: dryRun}
+	run := db.WithWriteTx
+	if dryRun {
+		run = db.WithReadTx
+	}
+	err := run(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := requireInactiveProject(ctx, tx, projectID); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(photoBlobsCTE+`
+SELECT COUNT(1), COALESCE(SUM(bytes), 0) FROM photo_blobs WHERE project_id = ?`, projectID).Scan(ctx, &result.Photos, &result.BytesSaved); err != nil {
+			return err
+		}
+		if dryRun || result.Photos == 0 {
+			return nil
+		}
+		if _, err := tx.ExecContext(ctx, `
+DELETE FROM receipt_photos
+WHERE pallet_receipt_id IN (SELECT id FROM pallet_receipts WHERE project_id = ?)`, projectID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+UPDATE pallet_receipts
+SET stock_photo_blob = NULL, stock_photo_mime = NULL, stock_photo_name = NULL
+WHERE project_id = ? AND stock_photo_blob IS NOT NULL`, projectID); err != nil {
+			return err
+		}
+		if auditSvc == nil {
+			return nil
+		}
+		return auditSvc.Write(ctx, tx, userID, "project.photos_prune", "projects", strconv.FormatInt(projectID, 10), nil, map[string]any{
+			"project_id":  projectID,
+			"photos":      result.Photos,
+			"bytes_freed": result.BytesSaved,
+		})
+	})
+	return result, err
+}
+
+type photoRef struct {
+	Source string `bun:"source"`
+	ID     int64  `bun:"id"`
+}
+
+// CompressPhotos re-encodes an inactive project's photos as smaller JPEGs,
+// keeping the original wherever recompression would not save space. With
+// dryRun set nothing is written and the savings are only estimated.
+func CompressPhotos(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID int64, dryRun bool) (ToolResult, error) {
+	result := ToolResult{DryRun: dryRun}
+	var refs []photoRef
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := requireInactiveProject(ctx, tx, projectID); err != nil {
+			return err
+		}
+		return tx.NewRaw(`
+SELECT 'receipt_photos' AS source, rp.id
+FROM receipt_photos rp
+JOIN pallet_receipts pr ON pr.id = rp.pallet_receipt_id
+WHERE pr.project_id = ?
+UNION ALL
+SELECT 'pallet_receipts' AS source, id
+FROM pallet_receipts
+WHERE project_id = ? AND stock_photo_blob IS NOT NULL
+ORDER BY source, id`, projectID, projectID).Scan(ctx, &refs)
+	})
+	if err != nil {
+		return result, err
+	}
+
+	// Photos are handled one at a time so a large project never holds every
+	// blob in memory or keeps the writer locked for the whole run.
+	for _, ref := range refs {
+		var blob []byte
+		var name string
+		err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+			return tx.NewRaw(photoSelectSQL(ref.Source), ref.ID).Scan(ctx, &blob, &name)
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		compressed, ok := compressPhoto(blob)
+		if !ok {
+			continue
+		}
+		result.Photos++
+		result.BytesSaved += int64(len(blob) - len(compressed))
+		if dryRun {
+			continue
+		}
+		name = strings.TrimSuffix(name, filepath.Ext(name)) + ".jpg"
+		err = db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+			_, err := tx.ExecContext(ctx, photoUpdateSQL(ref.Source), compressed, "image/jpeg", name, ref.ID)
+			return err
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if dryRun || result.Photos == 0 || auditSvc == nil {
+		return result, nil
+	}
+	err = db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return auditSvc.Write(ctx, tx, userID, "project.photos_compress", "projects", strconv.FormatInt(projectID, 10), nil, map[string]any{
+			"project_id":  projectID,
+			"photos":      result.Photos,
+			"bytes_freed": result.BytesSaved,
+		})
+	})
+	return result, err
+}
+
+func photoSelectSQL(source string) string {
+	if source == "pallet_receipts" {
+		return `SELECT stock_photo_blob, COALESCE(stock_photo_name, 'photo.jpg') FROM pallet_receipts WHERE id = ? AND stock_photo_blob IS NOT NULL`
+	}
+	return `SELECT photo_blob, photo_name FROM receipt_photos WHERE id = ?`
+}
+
+func photoUpdateSQL(source string) string {
+	if source == "pallet_receipts" {
+		return `UPDATE pallet_receipts SET stock_photo_blob = ?, stock_photo_mime = ?, stock_photo_name = ? WHERE id = ?`
+	}
+	return `UPDATE receipt_photos SET photo_blob = ?, photo_mime = ?, photo_name = ? WHERE id = ?`
+}
+
+func requireInactiveProject(ctx context.Context, tx bun.Tx, projectID int64) error {
+	var status string
+	err := tx.NewRaw(`SELECT status FROM projects WHERE id = ?`, projectID).Scan(ctx, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrProjectNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if status == projectinfra.StatusActive {
+		return ErrProjectActive
+	}
+	return nil
+}
+
+// Vacuum rebuilds the database file so space freed by pruning is returned to
+// the filesystem. It returns how many bytes the file shrank by.
+func Vacuum(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID int64) (int64, error) {
+	var before, after int64
+	sizeQuery := `SELECT pc.page_count * ps.page_size FROM pragma_page_count() pc, pragma_page_size() ps`
+	if err := db.WriteSQL.QueryRowContext(ctx, sizeQuery).Scan(&before); err != nil {
+		return 0, err
+	}
+	// VACUUM cannot run inside a transaction, so it goes straight to the
+	// single writer connection.
+	if _, err := db.WriteSQL.ExecContext(ctx, `VACUUM`); err != nil {
+		return 0, err
+	}
+	if err := db.WriteSQL.QueryRowContext(ctx, sizeQuery).Scan(&after); err != nil {
+		return 0, err
+	}
+	freed := before - after
+	if auditSvc == nil {
+		return freed, nil
+	}
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return auditSvc.Write(ctx, tx, userID, "database.vacuum", "database", "main", map[string]any{"bytes": before}, map[string]any{"bytes": after})
+	})
+	return freed, err
+}
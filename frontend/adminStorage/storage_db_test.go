@@ -0,0 +1,244 @@
+package adminstorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func openAdminStorageTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "admin-storage-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "..", "infrastructure", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	return db
+}
+
+// noisyPNG builds a photo-like image that PNG stores poorly, so recompressing
+// it as a downscaled JPEG always saves space.
+func noisyPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// seedStorageProjects creates an active project 1 and an inactive project 2,
+// each with one pallet holding a gallery photo and a stock photo.
+func seedStorageProjects(t *testing.T, db *sqlite.DB, photo []byte) {
+	t.Helper()
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO users (id, username, password_hash, role, created_at, updated_at) VALUES (1, 'admin1', 'hash', 'admin', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`); err != nil {
+			return err
+		}
+		for _, status := range []string{"active", "inactive"} {
+			var projectID int64
+			if err := tx.NewRaw(`
+INSERT INTO projects (name, description, project_date, client_name, code, status, created_at, updated_at)
+VALUES (?, 'storage', DATE('now'), 'Client A', ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+RETURNING id`, "Project "+status, "project-"+status, status).Scan(ctx, &projectID); err != nil {
+				return err
+			}
+			var palletID int64
+			if err := tx.NewRaw(`INSERT INTO pallets (project_id, status, created_at) VALUES (?, 'closed', CURRENT_TIMESTAMP) RETURNING id`, projectID).Scan(ctx, &palletID); err != nil {
+				return err
+			}
+			var receiptID int64
+			if err := tx.NewRaw(`
+INSERT INTO pallet_receipts (project_id, pallet_id, sku, description, scanned_by_user_id, qty, stock_photo_blob, stock_photo_mime, stock_photo_name, created_at, updated_at)
+VALUES (?, ?, 'SKU1', 'Item 1', 1, 1, ?, 'image/png', 'stock.png', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+RETURNING id`, projectID, palletID, photo).Scan(ctx, &receiptID); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `INSERT INTO receipt_photos (pallet_receipt_id, photo_blob, photo_mime, photo_name) VALUES (?, ?, 'image/png', 'gallery.png')`, receiptID, photo); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed storage projects: %v", err)
+	}
+}
+
+func countProjectPhotos(t *testing.T, db *sqlite.DB, projectID int64) int {
+	t.Helper()
+	var count int
+	err := db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT (SELECT COUNT(1) FROM receipt_photos rp JOIN pallet_receipts pr ON pr.id = rp.pallet_receipt_id WHERE pr.project_id = ?)
+     + (SELECT COUNT(1) FROM pallet_receipts WHERE project_id = ? AND stock_photo_blob IS NOT NULL)`, projectID, projectID).Scan(ctx, &count)
+	})
+	if err != nil {
+		t.Fatalf("count photos: %v", err)
+	}
+	return count
+}
+
+func TestLoadPageData_ReportsPhotoTotalsPerProjectAndPallet(t *testing.T) {
+	db := openAdminStorageTestDB(t)
+	photo := []byte("\x89PNG\r\n\x1a\nfake-photo-bytes")
+	seedStorageProjects(t, db, photo)
+
+	data, err := LoadPageData(context.Background(), db)
+	if err != nil {
+		t.Fatalf("load page data: %v", err)
+	}
+	if data.Summary.DatabaseBytes <= 0 {
+		t.Fatalf("expected database size, got %d", data.Summary.DatabaseBytes)
+	}
+	if data.Summary.PhotoCount != 4 || data.Summary.PhotoBytes != int64(4*len(photo)) {
+		t.Fatalf("unexpected photo summary: %+v", data.Summary)
+	}
+	if len(data.Projects) != 2 || data.Projects[0].PhotoCount != 2 || data.Projects[0].PhotoBytes != int64(2*len(photo)) {
+		t.Fatalf("unexpected project totals: %+v", data.Projects)
+	}
+	if len(data.Pallets) != 2 || data.Pallets[0].PhotoCount != 2 {
+		t.Fatalf("unexpected largest pallets: %+v", data.Pallets)
+	}
+	var photosTable *TableView
+	for i := range data.Tables {
+		if data.Tables[i].Name == "receipt_photos" {
+			photosTable = &data.Tables[i]
+		}
+	}
+	if photosTable == nil || photosTable.RowCount != 2 || photosTable.Bytes < int64(2*len(photo)) {
+		t.Fatalf("unexpected receipt_photos table size: %+v", photosTable)
+	}
+}
+
+func TestPrunePhotos_DryRunEstimatesThenApplyDeletes(t *testing.T) {
+	db := openAdminStorageTestDB(t)
+	photo := []byte("\x89PNG\r\n\x1a\nfake-photo-bytes")
+	seedStorageProjects(t, db, photo)
+
+	estimate, err := PrunePhotos(context.Background(), db, nil, 1, 2, true)
+	if err != nil {
+		t.Fatalf("dry run prune: %v", err)
+	}
+	if !estimate.DryRun || estimate.Photos != 2 || estimate.BytesSaved != int64(2*len(photo)) {
+		t.Fatalf("unexpected estimate: %+v", estimate)
+	}
+	if got := countProjectPhotos(t, db, 2); got != 2 {
+		t.Fatalf("expected dry run to keep photos, got %d", got)
+	}
+
+	result, err := PrunePhotos(context.Background(), db, nil, 1, 2, false)
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if result.Photos != estimate.Photos || result.BytesSaved != estimate.BytesSaved {
+		t.Fatalf("expected prune to match estimate, got %+v", result)
+	}
+	if got := countProjectPhotos(t, db, 2); got != 0 {
+		t.Fatalf("expected inactive project photos removed, got %d", got)
+	}
+	if got := countProjectPhotos(t, db, 1); got != 2 {
+		t.Fatalf("expected active project photos kept, got %d", got)
+	}
+}
+
+func TestPhotoTools_RefuseActiveProjects(t *testing.T) {
+	db := openAdminStorageTestDB(t)
+	seedStorageProjects(t, db, []byte("\x89PNG\r\n\x1a\nfake-photo-bytes"))
+
+	if _, err := PrunePhotos(context.Background(), db, nil, 1, 1, false); !errors.Is(err, ErrProjectActive) {
+		t.Fatalf("expected ErrProjectActive from prune, got %v", err)
+	}
+	if _, err := CompressPhotos(context.Background(), db, nil, 1, 1, false); !errors.Is(err, ErrProjectActive) {
+		t.Fatalf("expected ErrProjectActive from compress, got %v", err)
+	}
+	if _, err := PrunePhotos(context.Background(), db, nil, 1, 99, true); !errors.Is(err, ErrProjectNotFound) {
+		t.Fatalf("expected ErrProjectNotFound, got %v", err)
+	}
+}
+
+func TestCompressPhotos_ReencodesAsSmallerDownscaledJPEG(t *testing.T) {
+	db := openAdminStorageTestDB(t)
+	photo := noisyPNG(t, compressMaxDimension+200, 120)
+	seedStorageProjects(t, db, photo)
+
+	estimate, err := CompressPhotos(context.Background(), db, nil, 1, 2, true)
+	if err != nil {
+		t.Fatalf("dry run compress: %v", err)
+	}
+	if estimate.Photos != 2 || estimate.BytesSaved <= 0 {
+		t.Fatalf("unexpected estimate: %+v", estimate)
+	}
+
+	result, err := CompressPhotos(context.Background(), db, nil, 1, 2, false)
+	if err != nil {
+		t.Fatalf("compress: %v", err)
+	}
+	if result != (ToolResult{Photos: estimate.Photos, BytesSaved: estimate.BytesSaved}) {
+		t.Fatalf("expected compress to match estimate %+v, got %+v", estimate, result)
+	}
+
+	var stored struct {
+		Blob []byte `bun:"photo_blob"`
+		MIME string `bun:"photo_mime"`
+		Name string `bun:"photo_name"`
+	}
+	err = db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT rp.photo_blob, rp.photo_mime, rp.photo_name
+FROM receipt_photos rp
+JOIN pallet_receipts pr ON pr.id = rp.pallet_receipt_id
+WHERE pr.project_id = 2`).Scan(ctx, &stored)
+	})
+	if err != nil {
+		t.Fatalf("load compressed photo: %v", err)
+	}
+	if stored.MIME != "image/jpeg" || stored.Name != "gallery.jpg" || len(stored.Blob) >= len(photo) {
+		t.Fatalf("unexpected compressed photo: mime=%q name=%q len=%d", stored.MIME, stored.Name, len(stored.Blob))
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(stored.Blob))
+	if err != nil {
+		t.Fatalf("decode compressed photo: %v", err)
+	}
+	if cfg.Width != compressMaxDimension {
+		t.Fatalf("expected width %d, got %d", compressMaxDimension, cfg.Width)
+	}
+
+	// Already compressed photos are left alone on a second run.
+	again, err := CompressPhotos(context.Background(), db, nil, 1, 2, false)
+	if err != nil {
+		t.Fatalf("compress again: %v", err)
+	}
+	if again.Photos != 0 {
+		t.Fatalf("expected nothing left to compress, got %+v", again)
+	}
+}
@@ -0,0 +1,135 @@
+package adminstorage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/coldstorage"
+	"receipter/infrastructure/sqlite"
+)
+
+func StoragePageQueryHandler(db *sqlite.DB, coldStore *coldstorage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := LoadPageData(r.Context(), db)
+		if err != nil {
+			http.Error(w, "failed to load storage usage", http.StatusInternalServerError)
+			return
+		}
+		data.ColdStorageEnabled = coldStore.Enabled()
+		data.Status = r.URL.Query().Get("status")
+		data.ErrorMessage = r.URL.Query().Get("error")
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := StoragePage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render storage page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+type photoTool func(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID int64, dryRun bool) (ToolResult, error)
+
+func PrunePhotosCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return photoToolCommandHandler(db, auditSvc, PrunePhotos, "removed", "would be removed")
+}
+
+func CompressPhotosCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return photoToolCommandHandler(db, auditSvc, CompressPhotos, "compressed", "would be compressed")
+}
+
+func photoToolCommandHandler(db *sqlite.DB, auditSvc *audit.Service, tool photoTool, doneVerb, dryRunVerb string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/admin/storage?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		projectID, err := strconv.ParseInt(strings.TrimSpace(r.FormValue("project_id")), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/admin/storage?error="+url.QueryEscape("choose a project"), http.StatusSeeOther)
+			return
+		}
+		dryRun := r.FormValue("dry_run") != ""
+		result, err := tool(r.Context(), db, auditSvc, session.UserID, projectID, dryRun)
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/storage?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		verb, prefix := doneVerb, ""
+		if result.DryRun {
+			verb, prefix = dryRunVerb, "Dry run: "
+		}
+		status := fmt.Sprintf("%s%d photos %s, freeing %s", prefix, result.Photos, verb, FormatBytes(result.BytesSaved))
+		http.Redirect(w, r, "/tasker/admin/storage?status="+url.QueryEscape(status), http.StatusSeeOther)
+	}
+}
+
+func VacuumCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		freed, err := Vacuum(r.Context(), db, auditSvc, session.UserID)
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/storage?error="+url.QueryEscape("failed to compact database"), http.StatusSeeOther)
+			return
+		}
+		status := "database compacted, reclaimed " + FormatBytes(max(freed, 0))
+		http.Redirect(w, r, "/tasker/admin/storage?status="+url.QueryEscape(status), http.StatusSeeOther)
+	}
+}
+
+type coldStorageRun func(ctx context.Context, userID, projectID int64) (coldstorage.Result, error)
+
+// ArchiveProjectCommandHandler moves an inactive project's photos to cold
+// storage now rather than waiting for the sweeper.
+func ArchiveProjectCommandHandler(coldStore *coldstorage.Store) http.HandlerFunc {
+	return coldStorageCommandHandler(coldStore.Archive, func(result coldstorage.Result) string {
+		return fmt.Sprintf("%d photos moved to cold storage (%s), database shrank by %s", result.Photos, FormatBytes(result.Bytes), FormatBytes(result.DBBytesFreed))
+	})
+}
+
+// RehydrateProjectCommandHandler moves a project's photos back from cold
+// storage into the database.
+func RehydrateProjectCommandHandler(coldStore *coldstorage.Store) http.HandlerFunc {
+	return coldStorageCommandHandler(coldStore.Rehydrate, func(result coldstorage.Result) string {
+		return fmt.Sprintf("%d photos restored from cold storage (%s)", result.Photos, FormatBytes(result.Bytes))
+	})
+}
+
+func coldStorageCommandHandler(run coldStorageRun, describe func(coldstorage.Result) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/admin/storage?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		projectID, err := strconv.ParseInt(strings.TrimSpace(r.FormValue("project_id")), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/admin/storage?error="+url.QueryEscape("choose a project"), http.StatusSeeOther)
+			return
+		}
+		result, err := run(r.Context(), session.UserID, projectID)
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/storage?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/tasker/admin/storage?status="+url.QueryEscape(describe(result)), http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,105 @@
+package adminstorage
+
+import (
+	"fmt"
+
+	"receipter/infrastructure/coldstorage"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/photoorphan"
+	"receipter/infrastructure/photoquota"
+	"receipter/infrastructure/photoretention"
+)
+
+type Summary struct {
+	DatabaseBytes    int64
+	FreeBytes        int64
+	PhotoBytes       int64
+	PhotoCount       int64
+	StagedUploadSize int64
+}
+
+type TableView struct {
+	Name     string `bun:"name"`
+	RowCount int64  `bun:"row_count"`
+	Bytes    int64  `bun:"bytes"`
+}
+
+type ProjectPhotoView struct {
+	ProjectID   int64             `bun:"project_id"`
+	ProjectName string            `bun:"project_name"`
+	ClientName  fieldcrypt.String `bun:"client_name"`
+	Status      string            `bun:"status"`
+	PhotoCount  int64             `bun:"photo_count"`
+	PhotoBytes  int64             `bun:"photo_bytes"`
+	// ArchivedCount and ArchivedBytes are the photos in cold storage, which
+	// PhotoCount and PhotoBytes no longer include.
+	ArchivedCount int64 `bun:"-"`
+	ArchivedBytes int64 `bun:"-"`
+	// QuotaBytes is the project's photo storage quota; 0 means no limit.
+	QuotaBytes int64 `bun:"-"`
+}
+
+// QuotaPercent is the share of the quota the stored photos use.
+func (p ProjectPhotoView) QuotaPercent() int64 {
+	return photoquota.Usage{Photos: p.PhotoCount, Bytes: p.PhotoBytes}.Percent(p.QuotaBytes)
+}
+
+type PalletView struct {
+	PalletID    int64  `bun:"pallet_id"`
+	ProjectName string `bun:"project_name"`
+	Status      string `bun:"status"`
+	PhotoCount  int64  `bun:"photo_count"`
+	PhotoBytes  int64  `bun:"photo_bytes"`
+}
+
+type PageData struct {
+	Summary      Summary
+	Tables       []TableView
+	Projects     []ProjectPhotoView
+	Pallets      []PalletView
+	Status       string
+	ErrorMessage string
+	// Retention lists the photos due for deletion by project retention
+	// periods; Redactions are the latest redaction stubs.
+	Retention  []photoretention.Upcoming
+	Redactions []photoretention.Stub
+	// Orphans is photo data still waiting for the hourly orphan sweep;
+	// OrphanSweeps are the latest sweeps that removed some, and
+	// OrphanBytesReclaimed totals every sweep.
+	Orphans              photoorphan.Report
+	OrphanSweeps         []photoorphan.Run
+	OrphanBytesReclaimed int64
+	// ColdStorageEnabled is set when COLD_STORAGE_DIR is configured;
+	// ColdStorageRuns are the latest archive and rehydrate runs.
+	ColdStorageEnabled bool
+	ColdStorageRuns    []coldstorage.Run
+}
+
+// ToolResult reports what a prune or compress run changed, or would change
+// when DryRun is set.
+type ToolResult struct {
+	DryRun     bool
+	Photos     int
+	BytesSaved int64
+}
+
+func orphanSummary(r photoorphan.Report) string {
+	if r.Empty() {
+		return "none"
+	}
+	return fmt.Sprintf("%d photos, %d uploads, %d chunks (%s)", r.Photos, r.Uploads, r.Chunks, FormatBytes(r.Bytes))
+}
+
+// FormatBytes renders a byte count for display, e.g. "4.2 MB".
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
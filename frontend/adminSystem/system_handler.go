@@ -0,0 +1,97 @@
+package adminsystem
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/uptrace/bun"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/maintenance"
+	"receipter/infrastructure/ratelimit"
+	"receipter/infrastructure/renderpool"
+	"receipter/infrastructure/sqlite"
+)
+
+func SystemPageQueryHandler(monitor *sqlite.SchemaMonitor, maint *maintenance.Monitor, limiter *ratelimit.Limiter, renders *renderpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := PageData{
+			Maintenance:  maint.Status(),
+			Migrations:   monitor.Refresh(r.Context()),
+			RateLimits:   limiter.Stats(),
+			LabelRenders: renders.Stats(),
+			Status:       r.URL.Query().Get("status"),
+			ErrorMessage: r.URL.Query().Get("error"),
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := SystemPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render system page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// RetryMigrationsCommandHandler re-runs the embedded migrations, typically
+// after an admin has fixed whatever made one fail, and lifts the write block
+// once the schema is current.
+func RetryMigrationsCommandHandler(db *sqlite.DB, auditSvc *audit.Service, monitor *sqlite.SchemaMonitor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		before := monitor.Status()
+		applyErr := sqlite.ApplyEmbeddedMigrations(r.Context(), db)
+		after := monitor.Refresh(r.Context())
+		if err := db.WithWriteTx(r.Context(), func(ctx context.Context, tx bun.Tx) error {
+			return auditSvc.Write(ctx, tx, session.UserID, "database.migrations_retry", "database", "main",
+				map[string]any{"summary": before.Summary()},
+				map[string]any{"summary": after.Summary()})
+		}); err != nil {
+			http.Redirect(w, r, "/tasker/admin/system?error="+url.QueryEscape("migrations re-run, but failed to write audit log"), http.StatusSeeOther)
+			return
+		}
+
+		if applyErr != nil {
+			http.Redirect(w, r, "/tasker/admin/system?error="+url.QueryEscape(applyErr.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/tasker/admin/system?status="+url.QueryEscape(after.Summary()), http.StatusSeeOther)
+	}
+}
+
+// MaintenanceCommandHandler starts or ends read-only maintenance mode. It is
+// the one write the maintenance middleware lets through.
+func MaintenanceCommandHandler(auditSvc *audit.Service, maint *maintenance.Monitor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/admin/system?error="+url.QueryEscape("invalid form"), http.StatusSeeOther)
+			return
+		}
+
+		enabled := r.FormValue("enabled") == "1"
+		if _, err := maint.Set(r.Context(), auditSvc, session.UserID, enabled, r.FormValue("message")); err != nil {
+			http.Redirect(w, r, "/tasker/admin/system?error="+url.QueryEscape("failed to update maintenance mode"), http.StatusSeeOther)
+			return
+		}
+
+		status := "Maintenance mode ended. Changes are allowed again."
+		if enabled {
+			status = "Maintenance mode started. The app is read-only until you end it."
+		}
+		if !enabled && maint.Status().FromFile {
+			status = "Maintenance switch turned off, but the flag file on the server still keeps the app read-only."
+		}
+		http.Redirect(w, r, "/tasker/admin/system?status="+url.QueryEscape(status), http.StatusSeeOther)
+	}
+}
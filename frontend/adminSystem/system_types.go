@@ -0,0 +1,17 @@
+package adminsystem
+
+import (
+	"receipter/infrastructure/maintenance"
+	"receipter/infrastructure/ratelimit"
+	"receipter/infrastructure/renderpool"
+	"receipter/infrastructure/sqlite"
+)
+
+type PageData struct {
+	Maintenance  maintenance.State
+	Migrations   sqlite.MigrationStatus
+	RateLimits   []ratelimit.ClassStats
+	LabelRenders renderpool.Stats
+	Status       string
+	ErrorMessage string
+}
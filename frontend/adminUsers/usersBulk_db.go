@@ -0,0 +1,341 @@
+package adminusers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/sqlite"
+)
+
+const (
+	BulkDisable        = "disable"
+	BulkEnable         = "enable"
+	BulkRole           = "role"
+	BulkDisableProject = "disable_project"
+
+	bulkChangeListLimit = 10
+)
+
+var (
+	ErrNoUsersSelected      = errors.New("select at least one user")
+	ErrSelfBulkChange       = errors.New("you cannot disable or change the role of your own account")
+	ErrLastAdmin            = errors.New("at least one enabled admin must remain")
+	ErrNothingToChange      = errors.New("none of the users needed changing")
+	ErrUnknownBulkAction    = errors.New("unknown bulk action")
+	ErrBulkChangeNotFound   = errors.New("bulk change not found")
+	ErrBulkChangeUndone     = errors.New("bulk change has already been undone")
+	ErrProjectRequired      = errors.New("select a project")
+	ErrBulkClientNoProjects = errors.New("users without client project access cannot be made clients")
+)
+
+// BulkResult describes an applied or undone bulk change. SessionIDs are the
+// sessions it ended, which callers also drop from the session cache.
+type BulkResult struct {
+	ChangeID   int64
+	Usernames  []string
+	SessionIDs []string
+}
+
+// BulkChangeView is one recent bulk change as listed on the users page.
+type BulkChangeView struct {
+	ID          int64      `bun:"id"`
+	Action      string     `bun:"action"`
+	NewRole     string     `bun:"new_role"`
+	ProjectName string     `bun:"project_name"`
+	PerformedBy string     `bun:"performed_by"`
+	Usernames   string     `bun:"usernames"`
+	UserCount   int        `bun:"user_count"`
+	CreatedAt   time.Time  `bun:"created_at"`
+	UndoneAt    *time.Time `bun:"undone_at"`
+}
+
+// Summary describes the change in a few words.
+func (v BulkChangeView) Summary() string {
+	switch v.Action {
+	case BulkDisable:
+		return fmt.Sprintf("Disabled %d users", v.UserCount)
+	case BulkEnable:
+		return fmt.Sprintf("Enabled %d users", v.UserCount)
+	case BulkRole:
+		return fmt.Sprintf("Changed %d users to %s", v.UserCount, v.NewRole)
+	case BulkDisableProject:
+		return fmt.Sprintf("Disabled %d users only on %s", v.UserCount, v.ProjectName)
+	}
+	return v.Action
+}
+
+type bulkUserState struct {
+	ID         int64      `bun:"id"`
+	Username   string     `bun:"username"`
+	Role       string     `bun:"role"`
+	DisabledAt *time.Time `bun:"disabled_at"`
+}
+
+// BulkChangeUsers disables, enables or changes the role of the selected
+// users. Users already in the requested state are left out of the change.
+func BulkChangeUsers(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID int64, action, role string, userIDs []int64) (BulkResult, error) {
+	userIDs = normalizeProjectIDs(userIDs)
+	if len(userIDs) == 0 {
+		return BulkResult{}, ErrNoUsersSelected
+	}
+	switch action {
+	case BulkDisable, BulkEnable:
+		role = ""
+	case BulkRole:
+		role = strings.ToLower(strings.TrimSpace(role))
+		if role != rbac.RoleAdmin && role != rbac.RoleScanner && role != rbac.RoleClient {
+			return BulkResult{}, ErrInvalidRole
+		}
+	default:
+		return BulkResult{}, ErrUnknownBulkAction
+	}
+	for _, id := range userIDs {
+		if id == actorUserID {
+			return BulkResult{}, ErrSelfBulkChange
+		}
+	}
+	return applyBulkChange(ctx, db, auditSvc, actorUserID, action, role, nil, func(ctx context.Context, tx bun.Tx) ([]int64, error) {
+		return userIDs, nil
+	})
+}
+
+// DisableProjectOnlyUsers disables the users who only ever worked on one
+// project: clients whose sole project access is the project, and scanners
+// whose every receipt line is on it. Admins are never included.
+func DisableProjectOnlyUsers(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID, projectID int64) (BulkResult, error) {
+	if projectID <= 0 {
+		return BulkResult{}, ErrProjectRequired
+	}
+	return applyBulkChange(ctx, db, auditSvc, actorUserID, BulkDisableProject, "", &projectID, func(ctx context.Context, tx bun.Tx) ([]int64, error) {
+		var exists int
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM projects WHERE id = ?`, projectID).Scan(ctx, &exists); err != nil {
+			return nil, err
+		}
+		if exists == 0 {
+			return nil, ErrProjectRequired
+		}
+		return projectOnlyUserIDs(ctx, tx, projectID)
+	})
+}
+
+func projectOnlyUserIDs(ctx context.Context, tx bun.Tx, projectID int64) ([]int64, error) {
+	ids := make([]int64, 0)
+	err := tx.NewRaw(`
+SELECT u.id
+FROM users u
+WHERE u.disabled_at IS NULL
+  AND (
+    (u.role = ?
+     AND EXISTS (SELECT 1 FROM client_project_access cpa WHERE cpa.user_id = u.id AND cpa.project_id = ?)
+     AND NOT EXISTS (SELECT 1 FROM client_project_access cpa WHERE cpa.user_id = u.id AND cpa.project_id <> ?))
+    OR
+    (u.role = ?
+     AND EXISTS (SELECT 1 FROM pallet_receipts pr WHERE pr.scanned_by_user_id = u.id AND pr.project_id = ?)
+     AND NOT EXISTS (SELECT 1 FROM pallet_receipts pr WHERE pr.scanned_by_user_id = u.id AND pr.project_id <> ?))
+  )
+ORDER BY u.id`, rbac.RoleClient, projectID, projectID, rbac.RoleScanner, projectID, projectID).Scan(ctx, &ids)
+	return ids, err
+}
+
+func applyBulkChange(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID int64, action, role string, projectID *int64, selectUsers func(context.Context, bun.Tx) ([]int64, error)) (BulkResult, error) {
+	var result BulkResult
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		userIDs, err := selectUsers(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if len(userIDs) == 0 {
+			return ErrNothingToChange
+		}
+		users := make([]bulkUserState, 0, len(userIDs))
+		if err := tx.NewRaw(`SELECT id, username, role, disabled_at FROM users WHERE id IN (?) ORDER BY id`, bun.In(userIDs)).Scan(ctx, &users); err != nil {
+			return err
+		}
+		changing := make([]bulkUserState, 0, len(users))
+		for _, u := range users {
+			switch {
+			case action == BulkEnable && u.DisabledAt != nil,
+				(action == BulkDisable || action == BulkDisableProject) && u.DisabledAt == nil,
+				action == BulkRole && u.Role != role:
+				changing = append(changing, u)
+			}
+		}
+		if len(changing) == 0 {
+			return ErrNothingToChange
+		}
+		ids := make([]int64, 0, len(changing))
+		for _, u := range changing {
+			ids = append(ids, u.ID)
+			result.Usernames = append(result.Usernames, u.Username)
+		}
+		if action == BulkRole && role == rbac.RoleClient {
+			var withAccess int
+			if err := tx.NewRaw(`SELECT COUNT(DISTINCT user_id) FROM client_project_access WHERE user_id IN (?)`, bun.In(ids)).Scan(ctx, &withAccess); err != nil {
+				return err
+			}
+			if withAccess != len(ids) {
+				return ErrBulkClientNoProjects
+			}
+		}
+
+		res, err := tx.ExecContext(ctx, `
+INSERT INTO user_bulk_changes (action, new_role, project_id, performed_by_user_id, created_at)
+VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)`, action, role, projectID, actorUserID)
+		if err != nil {
+			return err
+		}
+		if result.ChangeID, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		for _, u := range changing {
+			if _, err := tx.ExecContext(ctx, `
+INSERT INTO user_bulk_change_users (bulk_change_id, user_id, previous_role, previous_disabled_at)
+VALUES (?, ?, ?, ?)`, result.ChangeID, u.ID, u.Role, u.DisabledAt); err != nil {
+				return err
+			}
+		}
+
+		switch action {
+		case BulkEnable:
+			_, err = tx.ExecContext(ctx, `UPDATE users SET disabled_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id IN (?)`, bun.In(ids))
+		case BulkRole:
+			// Clients need users.client_project_id set, as an anchor for the
+			// legacy schema constraint.
+			_, err = tx.ExecContext(ctx, `
+UPDATE users
+SET role = ?,
+    client_project_id = COALESCE(client_project_id, (SELECT MIN(cpa.project_id) FROM client_project_access cpa WHERE cpa.user_id = users.id)),
+    updated_at = CURRENT_TIMESTAMP
+WHERE id IN (?)`, role, bun.In(ids))
+		default:
+			_, err = tx.ExecContext(ctx, `UPDATE users SET disabled_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id IN (?)`, bun.In(ids))
+		}
+		if err != nil {
+			return err
+		}
+		if err := ensureEnabledAdmin(ctx, tx); err != nil {
+			return err
+		}
+		if result.SessionIDs, err = endUserSessions(ctx, tx, ids); err != nil {
+			return err
+		}
+		return auditSvc.Write(ctx, tx, actorUserID, "user.bulk_"+action, "user_bulk_changes", strconv.FormatInt(result.ChangeID, 10), nil, map[string]any{
+			"user_ids":   ids,
+			"usernames":  result.Usernames,
+			"role":       role,
+			"project_id": projectID,
+		})
+	})
+	return result, err
+}
+
+// UndoBulkChange puts every user touched by a bulk change back to the role
+// and disabled state recorded before it.
+func UndoBulkChange(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID, changeID int64) (BulkResult, error) {
+	result := BulkResult{ChangeID: changeID}
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var undoneAt *time.Time
+		if err := tx.QueryRowContext(ctx, `SELECT undone_at FROM user_bulk_changes WHERE id = ?`, changeID).Scan(&undoneAt); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrBulkChangeNotFound
+			}
+			return err
+		}
+		if undoneAt != nil {
+			return ErrBulkChangeUndone
+		}
+		items := make([]struct {
+			UserID             int64      `bun:"user_id"`
+			Username           string     `bun:"username"`
+			PreviousRole       string     `bun:"previous_role"`
+			PreviousDisabledAt *time.Time `bun:"previous_disabled_at"`
+		}, 0)
+		if err := tx.NewRaw(`
+SELECT bcu.user_id, u.username, bcu.previous_role, bcu.previous_disabled_at
+FROM user_bulk_change_users bcu
+JOIN users u ON u.id = bcu.user_id
+WHERE bcu.bulk_change_id = ?
+ORDER BY bcu.user_id`, changeID).Scan(ctx, &items); err != nil {
+			return err
+		}
+		ids := make([]int64, 0, len(items))
+		for _, item := range items {
+			if _, err := tx.ExecContext(ctx, `UPDATE users SET role = ?, disabled_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, item.PreviousRole, item.PreviousDisabledAt, item.UserID); err != nil {
+				return err
+			}
+			ids = append(ids, item.UserID)
+			result.Usernames = append(result.Usernames, item.Username)
+		}
+		if err := ensureEnabledAdmin(ctx, tx); err != nil {
+			return err
+		}
+		var err error
+		if result.SessionIDs, err = endUserSessions(ctx, tx, ids); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE user_bulk_changes SET undone_at = CURRENT_TIMESTAMP, undone_by_user_id = ? WHERE id = ?`, actorUserID, changeID); err != nil {
+			return err
+		}
+		return auditSvc.Write(ctx, tx, actorUserID, "user.bulk_undo", "user_bulk_changes", strconv.FormatInt(changeID, 10), nil, map[string]any{
+			"user_ids":  ids,
+			"usernames": result.Usernames,
+		})
+	})
+	return result, err
+}
+
+// ListBulkChanges returns the most recent bulk changes, newest first.
+func ListBulkChanges(ctx context.Context, db *sqlite.DB) ([]BulkChangeView, error) {
+	changes := make([]BulkChangeView, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT bc.id, bc.action, bc.new_role, COALESCE(p.name, '') AS project_name,
+       COALESCE(actor.username, '') AS performed_by,
+       COALESCE((SELECT GROUP_CONCAT(u.username, ', ')
+                 FROM user_bulk_change_users bcu
+                 JOIN users u ON u.id = bcu.user_id
+                 WHERE bcu.bulk_change_id = bc.id), '') AS usernames,
+       (SELECT COUNT(1) FROM user_bulk_change_users bcu WHERE bcu.bulk_change_id = bc.id) AS user_count,
+       bc.created_at, bc.undone_at
+FROM user_bulk_changes bc
+LEFT JOIN projects p ON p.id = bc.project_id
+LEFT JOIN users actor ON actor.id = bc.performed_by_user_id
+ORDER BY bc.id DESC
+LIMIT ?`, bulkChangeListLimit).Scan(ctx, &changes)
+	})
+	return changes, err
+}
+
+func ensureEnabledAdmin(ctx context.Context, tx bun.Tx) error {
+	var admins int
+	if err := tx.NewRaw(`SELECT COUNT(1) FROM users WHERE role = ? AND disabled_at IS NULL`, rbac.RoleAdmin).Scan(ctx, &admins); err != nil {
+		return err
+	}
+	if admins == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// endUserSessions deletes the users' sessions so role and disabled changes
+// take effect on their next request.
+func endUserSessions(ctx context.Context, tx bun.Tx, userIDs []int64) ([]string, error) {
+	sessionIDs := make([]string, 0)
+	if len(userIDs) == 0 {
+		return sessionIDs, nil
+	}
+	if err := tx.NewRaw(`SELECT id FROM sessions WHERE user_id IN (?)`, bun.In(userIDs)).Scan(ctx, &sessionIDs); err != nil {
+		return nil, err
+	}
+	_, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE user_id IN (?)`, bun.In(userIDs))
+	return sessionIDs, err
+}
@@ -0,0 +1,163 @@
+package adminusers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+func seedBulkUsers(t *testing.T, ctx context.Context, db *sqlite.DB) {
+	t.Helper()
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+				(1, 'Summer', 'd', '2026-06-01', 'Acme', 'summer', 'active'),
+				(2, 'Winter', 'd', '2026-12-01', 'Acme', 'winter', 'active')`,
+			`INSERT INTO users (id, username, password_hash, role, client_project_id) VALUES
+				(1, 'boss', 'x', 'admin', NULL),
+				(2, 'temp1', 'x', 'scanner', NULL),
+				(3, 'temp2', 'x', 'scanner', NULL),
+				(4, 'regular', 'x', 'scanner', NULL),
+				(5, 'acme', 'x', 'client', 1),
+				(6, 'multi', 'x', 'client', 1)`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open'), (2, 2, 'open')`,
+			`INSERT INTO pallet_receipts (project_id, pallet_id, sku, description, scanned_by_user_id, qty) VALUES
+				(1, 1, 'SKU-A', 'Widget', 2, 1),
+				(1, 1, 'SKU-A', 'Widget', 3, 1),
+				(1, 1, 'SKU-A', 'Widget', 4, 1),
+				(2, 2, 'SKU-A', 'Widget', 4, 1)`,
+			`INSERT INTO client_project_access (user_id, project_id) VALUES (5, 1), (6, 1), (6, 2)`,
+			`INSERT INTO sessions (id, user_id, expires_at) VALUES ('s-temp1', 2, datetime('now', '+1 day')), ('s-boss', 1, datetime('now', '+1 day'))`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+}
+
+func disabledUsernames(t *testing.T, ctx context.Context, db *sqlite.DB) []string {
+	t.Helper()
+	names := make([]string, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT username FROM users WHERE disabled_at IS NOT NULL ORDER BY id`).Scan(ctx, &names)
+	})
+	if err != nil {
+		t.Fatalf("load disabled users: %v", err)
+	}
+	return names
+}
+
+func TestDisableProjectOnlyUsers_DisablesAndUndoRestores(t *testing.T) {
+	db := openAdminUsersTestDB(t)
+	ctx := context.Background()
+	seedBulkUsers(t, ctx, db)
+	auditSvc := audit.NewService()
+
+	result, err := DisableProjectOnlyUsers(ctx, db, auditSvc, 1, 1)
+	if err != nil {
+		t.Fatalf("disable project users: %v", err)
+	}
+	if got := disabledUsernames(t, ctx, db); len(got) != 3 || got[0] != "temp1" || got[1] != "temp2" || got[2] != "acme" {
+		t.Fatalf("expected only project-only users disabled, got %v", got)
+	}
+	if len(result.SessionIDs) != 1 || result.SessionIDs[0] != "s-temp1" {
+		t.Fatalf("expected temp1 session ended, got %v", result.SessionIDs)
+	}
+	var sessions int
+	if err := db.R.QueryRowContext(ctx, `SELECT COUNT(1) FROM sessions`).Scan(&sessions); err != nil {
+		t.Fatalf("count sessions: %v", err)
+	}
+	if sessions != 1 {
+		t.Fatalf("expected only the admin session left, got %d", sessions)
+	}
+
+	if _, err := DisableProjectOnlyUsers(ctx, db, auditSvc, 1, 1); !errors.Is(err, ErrNothingToChange) {
+		t.Fatalf("expected nothing left to disable, got %v", err)
+	}
+
+	if _, err := UndoBulkChange(ctx, db, auditSvc, 1, result.ChangeID); err != nil {
+		t.Fatalf("undo: %v", err)
+	}
+	if got := disabledUsernames(t, ctx, db); len(got) != 0 {
+		t.Fatalf("expected undo to re-enable everyone, got %v", got)
+	}
+	if _, err := UndoBulkChange(ctx, db, auditSvc, 1, result.ChangeID); !errors.Is(err, ErrBulkChangeUndone) {
+		t.Fatalf("expected second undo rejected, got %v", err)
+	}
+
+	changes, err := ListBulkChanges(ctx, db)
+	if err != nil {
+		t.Fatalf("list changes: %v", err)
+	}
+	if len(changes) != 1 || changes[0].UndoneAt == nil || changes[0].Summary() != "Disabled 3 users only on Summer" {
+		t.Fatalf("unexpected bulk change list: %+v", changes)
+	}
+	var audits int
+	if err := db.R.QueryRowContext(ctx, `SELECT COUNT(1) FROM audit_logs WHERE action IN ('user.bulk_disable_project', 'user.bulk_undo')`).Scan(&audits); err != nil {
+		t.Fatalf("count audit: %v", err)
+	}
+	if audits != 2 {
+		t.Fatalf("expected change and undo audited, got %d", audits)
+	}
+}
+
+func TestBulkChangeUsers_RoleChangeUndoneToPreviousRoles(t *testing.T) {
+	db := openAdminUsersTestDB(t)
+	ctx := context.Background()
+	seedBulkUsers(t, ctx, db)
+	auditSvc := audit.NewService()
+
+	result, err := BulkChangeUsers(ctx, db, auditSvc, 1, BulkRole, "admin", []int64{2, 4})
+	if err != nil {
+		t.Fatalf("bulk role: %v", err)
+	}
+	if len(result.Usernames) != 2 {
+		t.Fatalf("expected two users changed, got %v", result.Usernames)
+	}
+	if _, err := UndoBulkChange(ctx, db, auditSvc, 1, result.ChangeID); err != nil {
+		t.Fatalf("undo: %v", err)
+	}
+	var admins int
+	if err := db.R.QueryRowContext(ctx, `SELECT COUNT(1) FROM users WHERE role = 'admin'`).Scan(&admins); err != nil {
+		t.Fatalf("count admins: %v", err)
+	}
+	if admins != 1 {
+		t.Fatalf("expected roles restored, got %d admins", admins)
+	}
+}
+
+func TestBulkChangeUsers_Rejections(t *testing.T) {
+	db := openAdminUsersTestDB(t)
+	ctx := context.Background()
+	seedBulkUsers(t, ctx, db)
+	auditSvc := audit.NewService()
+
+	if _, err := BulkChangeUsers(ctx, db, auditSvc, 1, BulkDisable, "", nil); !errors.Is(err, ErrNoUsersSelected) {
+		t.Fatalf("expected empty selection rejected, got %v", err)
+	}
+	if _, err := BulkChangeUsers(ctx, db, auditSvc, 1, BulkDisable, "", []int64{1, 2}); !errors.Is(err, ErrSelfBulkChange) {
+		t.Fatalf("expected own account rejected, got %v", err)
+	}
+	if _, err := BulkChangeUsers(ctx, db, auditSvc, 1, "delete", "", []int64{2}); !errors.Is(err, ErrUnknownBulkAction) {
+		t.Fatalf("expected unknown action rejected, got %v", err)
+	}
+	if _, err := BulkChangeUsers(ctx, db, auditSvc, 1, BulkRole, "client", []int64{2}); !errors.Is(err, ErrBulkClientNoProjects) {
+		t.Fatalf("expected client role without projects rejected, got %v", err)
+	}
+	if _, err := BulkChangeUsers(ctx, db, auditSvc, 2, BulkRole, "scanner", []int64{1}); !errors.Is(err, ErrLastAdmin) {
+		t.Fatalf("expected last admin demotion rejected, got %v", err)
+	}
+	if _, err := BulkChangeUsers(ctx, db, auditSvc, 1, BulkEnable, "", []int64{2}); !errors.Is(err, ErrNothingToChange) {
+		t.Fatalf("expected enabling an enabled user to change nothing, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package adminusers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/cache"
+	"receipter/infrastructure/sqlite"
+)
+
+// BulkUsersCommandHandler disables, enables or changes the role of the users
+// ticked on the users page.
+func BulkUsersCommandHandler(db *sqlite.DB, auditSvc *audit.Service, sessionCache cache.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		userIDs, err := parseClientProjectIDs(r, "user_ids")
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape("invalid user selection"), http.StatusSeeOther)
+			return
+		}
+		action := strings.TrimSpace(r.FormValue("bulk_action"))
+		result, err := BulkChangeUsers(r.Context(), db, auditSvc, session.UserID, action, r.FormValue("bulk_role"), userIDs)
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		dropSessions(sessionCache, result.SessionIDs)
+		verb := map[string]string{BulkDisable: "disabled", BulkEnable: "enabled", BulkRole: "changed to " + strings.ToLower(strings.TrimSpace(r.FormValue("bulk_role")))}[action]
+		status := fmt.Sprintf("%s %s", strings.Join(result.Usernames, ", "), verb)
+		http.Redirect(w, r, "/tasker/admin/users?status="+url.QueryEscape(status), http.StatusSeeOther)
+	}
+}
+
+// DisableProjectUsersCommandHandler disables every user who only worked on
+// the chosen project, for use when a project finishes.
+func DisableProjectUsersCommandHandler(db *sqlite.DB, auditSvc *audit.Service, sessionCache cache.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		projectID, _ := strconv.ParseInt(strings.TrimSpace(r.FormValue("project_id")), 10, 64)
+		result, err := DisableProjectOnlyUsers(r.Context(), db, auditSvc, session.UserID, projectID)
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		dropSessions(sessionCache, result.SessionIDs)
+		status := fmt.Sprintf("disabled %d project-only users: %s", len(result.Usernames), strings.Join(result.Usernames, ", "))
+		http.Redirect(w, r, "/tasker/admin/users?status="+url.QueryEscape(status), http.StatusSeeOther)
+	}
+}
+
+// UndoBulkChangeCommandHandler reverts a recorded bulk change.
+func UndoBulkChangeCommandHandler(db *sqlite.DB, auditSvc *audit.Service, sessionCache cache.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		changeID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || changeID <= 0 {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape("invalid bulk change"), http.StatusSeeOther)
+			return
+		}
+		result, err := UndoBulkChange(r.Context(), db, auditSvc, session.UserID, changeID)
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		dropSessions(sessionCache, result.SessionIDs)
+		status := fmt.Sprintf("bulk change undone for %s", strings.Join(result.Usernames, ", "))
+		http.Redirect(w, r, "/tasker/admin/users?status="+url.QueryEscape(status), http.StatusSeeOther)
+	}
+}
+
+func dropSessions(sessionCache cache.SessionStore, sessionIDs []string) {
+	if sessionCache == nil {
+		return
+	}
+	for _, id := range sessionIDs {
+		sessionCache.DeleteSessionBySessionToken(id)
+	}
+}
@@ -10,7 +10,10 @@ import (
 
 	"receipter/frontend/login"
 	"receipter/infrastructure/argon"
+	"receipter/infrastructure/fieldcrypt"
+	projectinfra "receipter/infrastructure/project"
 	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/site"
 	"receipter/infrastructure/sqlite"
 )
 
@@ -22,20 +25,46 @@ var (
 	ErrClientProjectRequired = errors.New("client project is required")
 )
 
-func LoadUsersPageData(ctx context.Context, db *sqlite.DB) (PageData, error) {
+// LoadUsersPageData lists the users and projects in scope. A user is in
+// scope when they work at one of the scope's sites.
+func LoadUsersPageData(ctx context.Context, db *sqlite.DB, scope site.Scope) (PageData, error) {
 	data := PageData{
 		Users:       make([]UserView, 0),
 		Projects:    make([]ProjectOption, 0),
 		ClientUsers: make([]ClientUserOption, 0),
+		Scope:       scope,
 	}
 	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		siteRows := make([]struct {
+			UserID int64  `bun:"user_id"`
+			SiteID int64  `bun:"site_id"`
+			Name   string `bun:"name"`
+		}, 0)
+		if err := tx.NewRaw(`
+SELECT us.user_id, us.site_id, st.name
+FROM user_sites us
+JOIN sites st ON st.id = us.site_id
+ORDER BY us.user_id ASC, st.name COLLATE NOCASE ASC`).Scan(ctx, &siteRows); err != nil {
+			return err
+		}
+		siteIDsByUser := make(map[int64][]int64, len(siteRows))
+		siteNamesByUser := make(map[int64][]string, len(siteRows))
+		for _, row := range siteRows {
+			siteIDsByUser[row.UserID] = append(siteIDsByUser[row.UserID], row.SiteID)
+			siteNamesByUser[row.UserID] = append(siteNamesByUser[row.UserID], row.Name)
+		}
+		if err := tx.NewRaw(`SELECT EXISTS (SELECT 1 FROM sites)`).Scan(ctx, &data.HasSites); err != nil {
+			return err
+		}
+
 		userRows := make([]struct {
 			ID       int64  `bun:"id"`
 			Username string `bun:"username"`
 			Role     string `bun:"role"`
+			Disabled bool   `bun:"disabled"`
 		}, 0)
 		if err := tx.NewRaw(`
-SELECT u.id, u.username, u.role
+SELECT u.id, u.username, u.role, u.disabled_at IS NOT NULL AS disabled
 FROM users u
 ORDER BY u.id ASC`).Scan(ctx, &userRows); err != nil {
 			return err
@@ -54,6 +83,30 @@ WHERE u.role = 'client'
 ORDER BY cpa.user_id ASC, p.project_date DESC, p.id DESC`).Scan(ctx, &accessRows); err != nil {
 			return err
 		}
+		exportRows := make([]struct {
+			UserID int64 `bun:"user_id"`
+			projectinfra.ClientExports
+		}, 0)
+		if err := tx.NewRaw(`
+SELECT user_id, summary_csv, detail_csv, photo_zip
+FROM client_export_permissions`).Scan(ctx, &exportRows); err != nil {
+			return err
+		}
+		replyRows := make([]struct {
+			UserID int64  `bun:"user_id"`
+			Email  string `bun:"email"`
+		}, 0)
+		if err := tx.NewRaw(`SELECT user_id, email FROM client_reply_addresses`).Scan(ctx, &replyRows); err != nil {
+			return err
+		}
+		replyEmailByUser := make(map[int64]string, len(replyRows))
+		for _, row := range replyRows {
+			replyEmailByUser[row.UserID] = row.Email
+		}
+		exportsByUser := make(map[int64]projectinfra.ClientExports, len(exportRows))
+		for _, row := range exportRows {
+			exportsByUser[row.UserID] = row.ClientExports
+		}
 		accessByUser := make(map[int64][]string, len(accessRows))
 		for _, row := range accessRows {
 			name := strings.TrimSpace(row.ProjectName)
@@ -63,11 +116,20 @@ ORDER BY cpa.user_id ASC, p.project_date DESC, p.id DESC`).Scan(ctx, &accessRows
 			accessByUser[row.UserID] = append(accessByUser[row.UserID], name)
 		}
 		for _, row := range userRows {
+			if !scope.IncludesAny(siteIDsByUser[row.ID]) {
+				continue
+			}
 			projects := strings.Join(accessByUser[row.ID], ", ")
+			exports := ""
 			if row.Role != rbac.RoleClient {
 				projects = ""
 			}
 			if row.Role == rbac.RoleClient {
+				perms, ok := exportsByUser[row.ID]
+				if !ok {
+					perms = projectinfra.AllClientExports
+				}
+				exports = clientExportsLabel(perms)
 				data.ClientUsers = append(data.ClientUsers, ClientUserOption{
 					ID:    row.ID,
 					Label: fmt.Sprintf("%s (ID %d)", row.Username, row.ID),
@@ -78,22 +140,30 @@ ORDER BY cpa.user_id ASC, p.project_date DESC, p.id DESC`).Scan(ctx, &accessRows
 				Username:       row.Username,
 				Role:           row.Role,
 				ClientProjects: projects,
+				ClientExports:  exports,
+				ReplyEmail:     replyEmailByUser[row.ID],
+				Disabled:       row.Disabled,
+				Sites:          strings.Join(siteNamesByUser[row.ID], ", "),
 			})
 		}
 
 		rows := make([]struct {
-			ID         int64  `bun:"id"`
-			Name       string `bun:"name"`
-			ClientName string `bun:"client_name"`
-			Status     string `bun:"status"`
+			ID         int64             `bun:"id"`
+			Name       string            `bun:"name"`
+			ClientName fieldcrypt.String `bun:"client_name"`
+			Status     string            `bun:"status"`
+			SiteID     *int64            `bun:"site_id"`
 		}, 0)
 		if err := tx.NewRaw(`
-SELECT id, name, client_name, status
+SELECT id, name, client_name, status, site_id
 FROM projects
 ORDER BY project_date DESC, id DESC`).Scan(ctx, &rows); err != nil {
 			return err
 		}
 		for _, row := range rows {
+			if !scope.Includes(row.SiteID) {
+				continue
+			}
 			data.Projects = append(data.Projects, ProjectOption{
 				ID:    row.ID,
 				Label: fmt.Sprintf("%s (%s) - %s", row.Name, row.ClientName, row.Status),
@@ -104,7 +174,26 @@ ORDER BY project_date DESC, id DESC`).Scan(ctx, &rows); err != nil {
 	return data, err
 }
 
-func CreateUser(ctx context.Context, db *sqlite.DB, username, rawPassword, role string, clientProjectIDs []int64) error {
+func clientExportsLabel(perms projectinfra.ClientExports) string {
+	labels := make([]string, 0, 3)
+	if perms.SummaryCSV {
+		labels = append(labels, "Summary CSV")
+	}
+	if perms.DetailCSV {
+		labels = append(labels, "Detailed CSV")
+	}
+	if perms.PhotoZIP {
+		labels = append(labels, "Photo ZIP")
+	}
+	if len(labels) == 0 {
+		return "None"
+	}
+	return strings.Join(labels, ", ")
+}
+
+// CreateUser adds a login. siteIDs are the sites the user works at; none
+// means every site.
+func CreateUser(ctx context.Context, db *sqlite.DB, username, rawPassword, role string, clientProjectIDs, siteIDs []int64) error {
 	username = strings.TrimSpace(username)
 	if username == "" {
 		return ErrUsernameRequired
@@ -168,13 +257,20 @@ func CreateUser(ctx context.Context, db *sqlite.DB, username, rawPassword, role
 			}
 			return err
 		}
-		if role != rbac.RoleClient {
-			return nil
-		}
 		userID, err := res.LastInsertId()
 		if err != nil {
 			return err
 		}
+		for _, siteID := range normalizeProjectIDs(siteIDs) {
+			if _, err := tx.ExecContext(ctx, `
+INSERT INTO user_sites (user_id, site_id, created_at)
+VALUES (?, ?, CURRENT_TIMESTAMP)`, userID, siteID); err != nil {
+				return err
+			}
+		}
+		if role != rbac.RoleClient {
+			return nil
+		}
 		for _, projectID := range clientProjectIDs {
 			if _, err := tx.ExecContext(ctx, `
 INSERT INTO client_project_access (user_id, project_id, created_at)
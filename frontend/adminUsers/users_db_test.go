@@ -37,7 +37,7 @@ func openAdminUsersTestDB(t *testing.T) *sqlite.DB {
 func TestCreateUser_HappyPathStoresHashAndRole(t *testing.T) {
 	db := openAdminUsersTestDB(t)
 
-	if err := CreateUser(context.Background(), db, "scanner2", "Scanner123!Strong", "scanner", nil); err != nil {
+	if err := CreateUser(context.Background(), db, "scanner2", "Scanner123!Strong", "scanner", nil, nil); err != nil {
 		t.Fatalf("create user: %v", err)
 	}
 
@@ -67,10 +67,10 @@ func TestCreateUser_HappyPathStoresHashAndRole(t *testing.T) {
 func TestCreateUser_DuplicateUsernameRejectedCaseInsensitive(t *testing.T) {
 	db := openAdminUsersTestDB(t)
 
-	if err := CreateUser(context.Background(), db, "CaseUser", "Case123!Password", "scanner", nil); err != nil {
+	if err := CreateUser(context.Background(), db, "CaseUser", "Case123!Password", "scanner", nil, nil); err != nil {
 		t.Fatalf("seed user: %v", err)
 	}
-	err := CreateUser(context.Background(), db, "caseuser", "Case456!Password", "admin", nil)
+	err := CreateUser(context.Background(), db, "caseuser", "Case456!Password", "admin", nil, nil)
 	if !errors.Is(err, ErrUsernameExists) {
 		t.Fatalf("expected ErrUsernameExists, got %v", err)
 	}
@@ -79,7 +79,7 @@ func TestCreateUser_DuplicateUsernameRejectedCaseInsensitive(t *testing.T) {
 func TestCreateUser_InvalidRoleRejected(t *testing.T) {
 	db := openAdminUsersTestDB(t)
 
-	err := CreateUser(context.Background(), db, "ops", "Ops123!Password", "operator", nil)
+	err := CreateUser(context.Background(), db, "ops", "Ops123!Password", "operator", nil, nil)
 	if !errors.Is(err, ErrInvalidRole) {
 		t.Fatalf("expected ErrInvalidRole, got %v", err)
 	}
@@ -88,7 +88,7 @@ func TestCreateUser_InvalidRoleRejected(t *testing.T) {
 func TestCreateUser_PasswordPolicyEnforced(t *testing.T) {
 	db := openAdminUsersTestDB(t)
 
-	err := CreateUser(context.Background(), db, "weakuser", "abcd", "scanner", nil)
+	err := CreateUser(context.Background(), db, "weakuser", "abcd", "scanner", nil, nil)
 	if err == nil {
 		t.Fatalf("expected password policy error")
 	}
@@ -100,7 +100,7 @@ func TestCreateUser_PasswordPolicyEnforced(t *testing.T) {
 func TestCreateUser_ClientRequiresProject(t *testing.T) {
 	db := openAdminUsersTestDB(t)
 
-	err := CreateUser(context.Background(), db, "client1", "Client123!Pass", "client", nil)
+	err := CreateUser(context.Background(), db, "client1", "Client123!Pass", "client", nil, nil)
 	if !errors.Is(err, ErrClientProjectRequired) {
 		t.Fatalf("expected ErrClientProjectRequired, got %v", err)
 	}
@@ -121,7 +121,7 @@ VALUES (1, 'Client Project', 'for client user test', DATE('now'), 'Test Client',
 	}
 
 	projectID := int64(1)
-	if err := CreateUser(context.Background(), db, "client1", "Client123!Pass", "client", []int64{projectID}); err != nil {
+	if err := CreateUser(context.Background(), db, "client1", "Client123!Pass", "client", []int64{projectID}, nil); err != nil {
 		t.Fatalf("create client user: %v", err)
 	}
 
@@ -169,7 +169,7 @@ VALUES
 		t.Fatalf("seed projects: %v", err)
 	}
 
-	if err := CreateUser(context.Background(), db, "client2", "Client123!Pass", "client", []int64{1}); err != nil {
+	if err := CreateUser(context.Background(), db, "client2", "Client123!Pass", "client", []int64{1}, nil); err != nil {
 		t.Fatalf("create client user: %v", err)
 	}
 
@@ -2,33 +2,69 @@ package adminusers
 
 import (
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
 
 	"receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
 	"receipter/infrastructure/cache"
+	"receipter/infrastructure/passwordreset"
+	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/replymail"
+	"receipter/infrastructure/site"
 	"receipter/infrastructure/sqlite"
 )
 
 // UsersPageQueryHandler renders the admin users list page.
 func UsersPageQueryHandler(db *sqlite.DB, _ *cache.UserCache) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		_, ok := context.GetSessionFromContext(r.Context())
+		session, ok := context.GetSessionFromContext(r.Context())
 		if !ok {
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
 
-		data, err := LoadUsersPageData(r.Context(), db)
+		scope, err := site.ResolveScope(r.Context(), db, session.UserID, session.ActiveSiteID)
+		if err != nil {
+			slog.Error("admin users: failed to load sites", slog.Any("err", err))
+			http.Error(w, "failed to load users", http.StatusInternalServerError)
+			return
+		}
+		data, err := LoadUsersPageData(r.Context(), db, scope)
 		if err != nil {
 			slog.Error("admin users: failed to load data", slog.Any("err", err))
 			http.Error(w, "failed to load users", http.StatusInternalServerError)
 			return
 		}
 
+		data.AccessRequests, err = projectinfra.ListAccessRequests(r.Context(), db, projectinfra.AccessRequestPending, 0)
+		if err != nil {
+			slog.Error("admin users: failed to load access requests", slog.Any("err", err))
+			http.Error(w, "failed to load users", http.StatusInternalServerError)
+			return
+		}
+
+		data.BulkChanges, err = ListBulkChanges(r.Context(), db)
+		if err != nil {
+			slog.Error("admin users: failed to load bulk changes", slog.Any("err", err))
+			http.Error(w, "failed to load users", http.StatusInternalServerError)
+			return
+		}
+
+		data.PasswordResets, err = passwordreset.ListOutstanding(r.Context(), db, time.Now())
+		if err != nil {
+			slog.Error("admin users: failed to load password resets", slog.Any("err", err))
+			http.Error(w, "failed to load users", http.StatusInternalServerError)
+			return
+		}
+
 		data.Status = r.URL.Query().Get("status")
 		data.ErrorMessage = r.URL.Query().Get("error")
 
@@ -42,7 +78,8 @@ func UsersPageQueryHandler(db *sqlite.DB, _ *cache.UserCache) http.HandlerFunc {
 
 func CreateUserCommandHandler(db *sqlite.DB, _ *cache.UserCache) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if _, ok := context.GetSessionFromContext(r.Context()); !ok {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
@@ -61,7 +98,22 @@ func CreateUserCommandHandler(db *sqlite.DB, _ *cache.UserCache) http.HandlerFun
 			return
 		}
 
-		if err := CreateUser(r.Context(), db, username, password, role, clientProjectIDs); err != nil {
+		siteIDs, err := parseSiteIDs(r, "site_ids")
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		scope, err := site.ResolveScope(r.Context(), db, session.UserID, nil)
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape("failed to load sites"), http.StatusSeeOther)
+			return
+		}
+		if !canAssignSites(scope, siteIDs) {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape(errPickOwnSites.Error()), http.StatusSeeOther)
+			return
+		}
+
+		if err := CreateUser(r.Context(), db, username, password, role, clientProjectIDs, siteIDs); err != nil {
 			switch {
 			case errors.Is(err, ErrUsernameRequired),
 				errors.Is(err, ErrPasswordRequired),
@@ -109,6 +161,145 @@ func UpdateClientProjectAccessCommandHandler(db *sqlite.DB, _ *cache.UserCache)
 	}
 }
 
+// UpdateClientExportsCommandHandler sets which SKU view exports a client
+// user may download.
+func UpdateClientExportsCommandHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := context.GetSessionFromContext(r.Context()); !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		userID, err := strconv.ParseInt(strings.TrimSpace(r.FormValue("export_user_id")), 10, 64)
+		if err != nil || userID <= 0 {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape("invalid client user"), http.StatusSeeOther)
+			return
+		}
+		perms := projectinfra.ClientExports{
+			SummaryCSV: r.FormValue("export_summary_csv") != "",
+			DetailCSV:  r.FormValue("export_detail_csv") != "",
+			PhotoZIP:   r.FormValue("export_photo_zip") != "",
+		}
+		if err := projectinfra.SetClientExports(r.Context(), db, userID, perms); err != nil {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/tasker/admin/users?status="+url.QueryEscape("client export permissions updated"), http.StatusSeeOther)
+	}
+}
+
+// UpdateClientReplyEmailCommandHandler sets the address a client user answers
+// comment emails from.
+func UpdateClientReplyEmailCommandHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := context.GetSessionFromContext(r.Context()); !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		userID, err := strconv.ParseInt(strings.TrimSpace(r.FormValue("reply_user_id")), 10, 64)
+		if err != nil || userID <= 0 {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape("invalid client user"), http.StatusSeeOther)
+			return
+		}
+		if err := replymail.SetClientAddress(r.Context(), db, userID, r.FormValue("reply_email")); err != nil {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/tasker/admin/users?status="+url.QueryEscape("client reply email updated"), http.StatusSeeOther)
+	}
+}
+
+// UpdateUserSitesCommandHandler replaces the sites a user works at. Admins
+// restricted to particular sites only change assignments to their own sites;
+// the user keeps any others.
+func UpdateUserSitesCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		userID, err := strconv.ParseInt(strings.TrimSpace(r.FormValue("site_user_id")), 10, 64)
+		if err != nil || userID <= 0 {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape("invalid user"), http.StatusSeeOther)
+			return
+		}
+		siteIDs, err := parseSiteIDs(r, "site_ids_update")
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		scope, err := site.ResolveScope(r.Context(), db, session.UserID, nil)
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape("failed to load sites"), http.StatusSeeOther)
+			return
+		}
+		current, err := site.UserSiteIDs(r.Context(), db, userID)
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape("failed to load user sites"), http.StatusSeeOther)
+			return
+		}
+		if !scope.IncludesAny(current) || !canAssignSites(scope, siteIDs) {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape(errPickOwnSites.Error()), http.StatusSeeOther)
+			return
+		}
+		if scope.Restricted {
+			for _, id := range current {
+				if !scope.CanAssign(&id) {
+					siteIDs = append(siteIDs, id)
+				}
+			}
+		}
+		if err := site.SetUserSites(r.Context(), db, auditSvc, session.UserID, userID, siteIDs); err != nil {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/tasker/admin/users?status="+url.QueryEscape("user sites updated"), http.StatusSeeOther)
+	}
+}
+
+var errPickOwnSites = errors.New("pick one or more of your sites")
+
+// canAssignSites reports whether the admin may give a user exactly siteIDs.
+// Restricted admins must pick at least one site, since a user with none
+// sees every site.
+func canAssignSites(scope site.Scope, siteIDs []int64) bool {
+	if len(siteIDs) == 0 {
+		return !scope.Restricted
+	}
+	for _, id := range siteIDs {
+		if !scope.CanAssign(&id) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseSiteIDs(r *http.Request, field string) ([]int64, error) {
+	ids := make([]int64, 0, len(r.Form[field]))
+	for _, raw := range r.Form[field] {
+		id, err := site.ParseID(raw)
+		if err != nil {
+			return nil, err
+		}
+		if id != nil {
+			ids = append(ids, *id)
+		}
+	}
+	return ids, nil
+}
+
 func parseClientProjectIDs(r *http.Request, field string) ([]int64, error) {
 	values := r.Form[field]
 	ids := make([]int64, 0, len(values))
@@ -125,3 +316,53 @@ func parseClientProjectIDs(r *http.Request, field string) ([]int64, error) {
 	}
 	return ids, nil
 }
+
+// DecideAccessRequestCommandHandler approves or denies a client's pending
+// project access request.
+func DecideAccessRequestCommandHandler(db *sqlite.DB, auditSvc *audit.Service, approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		requestID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || requestID <= 0 {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape("invalid access request"), http.StatusSeeOther)
+			return
+		}
+		req, err := projectinfra.DecideAccessRequest(r.Context(), db, auditSvc, session.UserID, requestID, approve)
+		if err != nil {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		status := fmt.Sprintf("access to %s %s for %s", req.ProjectName, req.Status, req.Username)
+		http.Redirect(w, r, "/tasker/admin/users?status="+url.QueryEscape(status), http.StatusSeeOther)
+	}
+}
+
+// CancelPasswordResetCommandHandler stops an outstanding password reset link
+// from working.
+func CancelPasswordResetCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		resetID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || resetID <= 0 {
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape("invalid password reset"), http.StatusSeeOther)
+			return
+		}
+		if err := passwordreset.Cancel(r.Context(), db, auditSvc, session.UserID, resetID); err != nil {
+			msg := "failed to cancel password reset"
+			if errors.Is(err, passwordreset.ErrNotFound) {
+				msg = err.Error()
+			}
+			http.Redirect(w, r, "/tasker/admin/users?error="+url.QueryEscape(msg), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/tasker/admin/users?status="+url.QueryEscape("password reset link cancelled"), http.StatusSeeOther)
+	}
+}
@@ -1,10 +1,23 @@
 package adminusers
 
+import (
+	"receipter/infrastructure/passwordreset"
+	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/site"
+)
+
 type UserView struct {
 	ID             int64
 	Username       string
 	Role           string
 	ClientProjects string
+	// ClientExports lists the SKU view exports a client may download.
+	ClientExports string
+	// ReplyEmail is the address a client answers comment emails from.
+	ReplyEmail string
+	Disabled   bool
+	// Sites lists the user's site names; blank means every site.
+	Sites string
 }
 
 type ProjectOption struct {
@@ -18,9 +31,23 @@ type ClientUserOption struct {
 }
 
 type PageData struct {
-	Users        []UserView
-	Projects     []ProjectOption
-	ClientUsers  []ClientUserOption
-	Status       string
-	ErrorMessage string
+	Users       []UserView
+	Projects    []ProjectOption
+	ClientUsers []ClientUserOption
+	// AccessRequests are pending client requests for additional projects.
+	AccessRequests []projectinfra.AccessRequest
+	// BulkChanges are the most recent bulk user changes, which can be undone.
+	BulkChanges []BulkChangeView
+	// PasswordResets are emailed reset links that still work.
+	PasswordResets []passwordreset.Outstanding
+	Status         string
+	ErrorMessage   string
+	// Scope is the admin's sites; HasSites hides site fields until the first
+	// site exists.
+	Scope    site.Scope
+	HasSites bool
+}
+
+func (d PageData) siteSelected(siteID *int64, optionID int64) bool {
+	return siteID != nil && *siteID == optionID
 }
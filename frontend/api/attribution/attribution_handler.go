@@ -0,0 +1,79 @@
+package attributionapi
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/phase"
+	"receipter/infrastructure/receipts"
+	"receipter/infrastructure/sqlite"
+)
+
+const maxRequestBytes = 64 << 10
+
+// ReassignScannedByCommandHandler credits receipt lines of the project to
+// another user from a JSON body of receiptIds, userId and reason, and
+// optionally palletId to keep the change to one pallet. Lines already
+// credited to the user are skipped; the response counts the lines changed.
+func ReassignScannedByCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid project id")
+			return
+		}
+		var req receipts.Reassignment
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "request body must be a JSON object with receiptIds, userId and reason")
+			return
+		}
+		req.ProjectID = projectID
+
+		changed, err := receipts.ReassignScannedBy(r.Context(), db, auditSvc, session.UserID, req)
+		if err != nil {
+			switch {
+			case errors.Is(err, receipts.ErrLineNotFound), errors.Is(err, receipts.ErrPalletNotFound), errors.Is(err, receipts.ErrProjectMismatch):
+				writeError(w, http.StatusNotFound, err.Error())
+			case errors.Is(err, receipts.ErrNoLinesSelected), errors.Is(err, receipts.ErrReasonRequired),
+				errors.Is(err, receipts.ErrReasonTooLong), errors.Is(err, receipts.ErrScannerNotFound):
+				writeError(w, http.StatusBadRequest, err.Error())
+			case errors.Is(err, phase.ErrClosed):
+				writeError(w, http.StatusConflict, err.Error())
+			default:
+				slog.Error("attribution api: reassign failed", slog.Int64("project_id", projectID), slog.Any("err", err))
+				writeError(w, http.StatusInternalServerError, "failed to reassign lines")
+			}
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"reassigned": changed})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("attribution api: write response failed", slog.Any("err", err))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{
+		"errors": []map[string]string{{"message": message}},
+	})
+}
@@ -0,0 +1,110 @@
+package bookingapi
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/booking"
+	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/sqlite"
+)
+
+const maxRequestBytes = 64 << 10
+
+// SlotsQueryHandler lists a day's delivery slots and how many places each
+// has left, so a carrier can pick one to book. Other carriers' bookings are
+// not shown.
+func SlotsQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		date, err := booking.ParseDate(r.URL.Query().Get("date"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		slots, err := booking.ListSlots(r.Context(), db, date, false)
+		if err != nil {
+			slog.Error("booking api: list slots failed", slog.Any("err", err))
+			writeError(w, http.StatusInternalServerError, "failed to load delivery slots")
+			return
+		}
+		type slotView struct {
+			booking.Slot
+			Remaining int64 `json:"remaining"`
+		}
+		views := make([]slotView, 0, len(slots))
+		for _, slot := range slots {
+			views = append(views, slotView{Slot: slot, Remaining: slot.Remaining()})
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"date": date, "slots": views})
+	}
+}
+
+// BookCommandHandler books a delivery onto a slot from a JSON body of
+// slotId, projectId, carrier, deliveryReference and expectedPallets. Client
+// tokens can only book for their assigned projects.
+func BookCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		var req booking.Request
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "request body must be a JSON object with slotId, projectId and carrier")
+			return
+		}
+		if session.User.Role == rbac.RoleClient {
+			allowed, err := projectinfra.ClientHasProjectAccess(r.Context(), db, session.UserID, req.ProjectID)
+			if err != nil {
+				slog.Error("booking api: check client access failed", slog.Any("err", err))
+				writeError(w, http.StatusInternalServerError, "failed to load project access")
+				return
+			}
+			if !allowed {
+				writeError(w, http.StatusNotFound, "project not found")
+				return
+			}
+		}
+
+		created, err := booking.Book(r.Context(), db, auditSvc, session.UserID, booking.SourceAPI, req, time.Now())
+		if err != nil {
+			switch {
+			case errors.Is(err, booking.ErrSlotNotFound), errors.Is(err, booking.ErrProjectNotFound):
+				writeError(w, http.StatusNotFound, err.Error())
+			case errors.Is(err, booking.ErrSlotFull), errors.Is(err, booking.ErrSlotPast), errors.Is(err, booking.ErrProjectInactive):
+				writeError(w, http.StatusConflict, err.Error())
+			case errors.Is(err, booking.ErrCarrierRequired), errors.Is(err, booking.ErrInvalidPallets):
+				writeError(w, http.StatusBadRequest, err.Error())
+			default:
+				slog.Error("booking api: book failed", slog.Any("err", err))
+				writeError(w, http.StatusInternalServerError, "failed to book delivery")
+			}
+			return
+		}
+		writeJSON(w, http.StatusCreated, created)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("booking api: write response failed", slog.Any("err", err))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{
+		"errors": []map[string]string{{"message": message}},
+	})
+}
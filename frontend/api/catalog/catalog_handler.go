@@ -0,0 +1,192 @@
+package catalogapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/catalog"
+	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+const maxRequestBytes = 2 << 20
+
+type deactivateRequest struct {
+	SKU string `json:"sku"`
+}
+
+type batchRequest struct {
+	Upsert     []catalog.Item `json:"upsert"`
+	Deactivate []string       `json:"deactivate"`
+}
+
+// StockItemsQueryHandler lists a project's stock items, so an integration
+// can diff its master file against what we hold.
+func StockItemsQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		project, _, ok := loadProject(w, r, db, false)
+		if !ok {
+			return
+		}
+		records, err := catalog.List(r.Context(), db, project.ID)
+		if err != nil {
+			slog.Error("catalog api: list stock items failed", slog.Any("err", err))
+			writeError(w, http.StatusInternalServerError, "failed to load stock items")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"projectId": project.ID, "items": records})
+	}
+}
+
+// UpsertStockItemCommandHandler creates or updates one stock item from a
+// JSON body of sku, description and uom.
+func UpsertStockItemCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		project, actor, ok := loadProject(w, r, db, true)
+		if !ok {
+			return
+		}
+		var item catalog.Item
+		if !decode(w, r, &item, "request body must be a JSON object with sku, description and uom") {
+			return
+		}
+		if err := item.Normalize(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		sync(w, r, db, auditSvc, actor, project.ID, []catalog.Item{item}, nil)
+	}
+}
+
+// DeactivateStockItemCommandHandler deactivates one stock item by SKU.
+func DeactivateStockItemCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		project, actor, ok := loadProject(w, r, db, true)
+		if !ok {
+			return
+		}
+		var req deactivateRequest
+		if !decode(w, r, &req, "request body must be a JSON object with sku") {
+			return
+		}
+		sync(w, r, db, auditSvc, actor, project.ID, nil, []string{req.SKU})
+	}
+}
+
+// SyncStockItemsCommandHandler applies a batch of upserts and deactivations.
+// Invalid items are reported in the summary and skipped; the rest apply.
+func SyncStockItemsCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		project, actor, ok := loadProject(w, r, db, true)
+		if !ok {
+			return
+		}
+		var req batchRequest
+		if !decode(w, r, &req, "request body must be a JSON object with upsert and/or deactivate") {
+			return
+		}
+		sync(w, r, db, auditSvc, actor, project.ID, req.Upsert, req.Deactivate)
+	}
+}
+
+func sync(w http.ResponseWriter, r *http.Request, db *sqlite.DB, auditSvc *audit.Service, actor catalog.Actor, projectID int64, upserts []catalog.Item, deactivate []string) {
+	summary, err := catalog.Sync(r.Context(), db, auditSvc, actor, projectID, upserts, deactivate)
+	if err != nil {
+		if errors.Is(err, catalog.ErrEmptyBatch) || errors.Is(err, catalog.ErrBatchTooLarge) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		slog.Error("catalog api: sync failed", slog.Int64("project_id", projectID), slog.Any("err", err))
+		writeError(w, http.StatusInternalServerError, "failed to sync stock items")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"projectId": projectID, "summary": summary})
+}
+
+// loadProject resolves the project in the URL for the token's user: admin
+// tokens reach every project, client tokens only their assigned ones. Writes
+// are refused on inactive projects, as in the CSV import.
+func loadProject(w http.ResponseWriter, r *http.Request, db *sqlite.DB, write bool) (models.Project, catalog.Actor, bool) {
+	var project models.Project
+	session, ok := context.GetSessionFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return project, catalog.Actor{}, false
+	}
+	actor := catalog.Actor{UserID: session.UserID}
+	if token, ok := context.APITokenFromContext(r.Context()); ok {
+		actor.TokenID = token.ID
+		actor.TokenName = token.Name
+	}
+	projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || projectID <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid project id")
+		return project, actor, false
+	}
+	switch session.User.Role {
+	case rbac.RoleAdmin:
+	case rbac.RoleClient:
+		allowed, err := projectinfra.ClientHasProjectAccess(r.Context(), db, session.UserID, projectID)
+		if err != nil {
+			slog.Error("catalog api: check client access failed", slog.Any("err", err))
+			writeError(w, http.StatusInternalServerError, "failed to load project access")
+			return project, actor, false
+		}
+		if !allowed {
+			writeError(w, http.StatusNotFound, "project not found")
+			return project, actor, false
+		}
+	default:
+		writeError(w, http.StatusForbidden, "role is not permitted to manage stock items")
+		return project, actor, false
+	}
+	project, err = projectinfra.LoadByID(r.Context(), db, projectID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "project not found")
+			return project, actor, false
+		}
+		writeError(w, http.StatusInternalServerError, "failed to load project")
+		return project, actor, false
+	}
+	if write && project.Status != projectinfra.StatusActive {
+		writeError(w, http.StatusConflict, "inactive projects are read-only")
+		return project, actor, false
+	}
+	return project, actor, true
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any, message string) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, message)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("catalog api: write response failed", slog.Any("err", err))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{
+		"errors": []map[string]string{{"message": message}},
+	})
+}
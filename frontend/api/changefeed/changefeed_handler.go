@@ -0,0 +1,108 @@
+package changefeedapi
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/changefeed"
+	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/sqlite"
+)
+
+// ChangesQueryHandler serves the audit change feed after the cursor in the
+// after query parameter, optionally narrowed by a comma-separated entity list
+// and a project id. Admin tokens see every project; client tokens only the
+// changes of their assigned projects. Consumers store nextCursor and pass it
+// as after on the next call.
+func ChangesQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		params := r.URL.Query()
+		q := changefeed.Query{}
+		if raw := strings.TrimSpace(params.Get("after")); raw != "" {
+			after, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || after < 0 {
+				writeError(w, http.StatusBadRequest, "after must be a non-negative event id")
+				return
+			}
+			q.After = after
+		}
+		if raw := strings.TrimSpace(params.Get("limit")); raw != "" {
+			limit, err := strconv.Atoi(raw)
+			if err != nil || limit < 1 || limit > changefeed.MaxLimit {
+				writeError(w, http.StatusBadRequest, changefeed.ErrInvalidLimit.Error())
+				return
+			}
+			q.Limit = limit
+		}
+		entityTypes, err := changefeed.ParseEntityTypes(params.Get("entity"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		q.EntityTypes = entityTypes
+
+		projectID := int64(0)
+		if raw := strings.TrimSpace(params.Get("project")); raw != "" {
+			projectID, err = strconv.ParseInt(raw, 10, 64)
+			if err != nil || projectID <= 0 {
+				writeError(w, http.StatusBadRequest, "invalid project id")
+				return
+			}
+		}
+		switch session.User.Role {
+		case rbac.RoleAdmin:
+			if projectID > 0 {
+				q.ProjectIDs = []int64{projectID}
+			}
+		case rbac.RoleClient:
+			projectIDs, err := projectinfra.ListClientProjectIDs(r.Context(), db, session.UserID)
+			if err != nil {
+				slog.Error("changes api: list client projects failed", slog.Any("err", err))
+				writeError(w, http.StatusInternalServerError, "failed to load project access")
+				return
+			}
+			if projectID > 0 {
+				if !slices.Contains(projectIDs, projectID) {
+					writeError(w, http.StatusNotFound, "project not found")
+					return
+				}
+				projectIDs = []int64{projectID}
+			}
+			q.ProjectIDs = projectIDs
+			q.Restricted = true
+		default:
+			writeError(w, http.StatusForbidden, "role is not permitted to read the change feed")
+			return
+		}
+
+		page, err := changefeed.Read(r.Context(), db, q)
+		if err != nil {
+			slog.Error("changes api: read feed failed", slog.Any("err", err))
+			writeError(w, http.StatusInternalServerError, "failed to load changes")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(page)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"errors": []map[string]string{{"message": message}},
+	})
+}
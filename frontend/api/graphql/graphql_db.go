@@ -0,0 +1,352 @@
+package graphqlapi
+
+import (
+	"context"
+	"strings"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/photovisibility"
+	"receipter/infrastructure/sqlite"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 500
+)
+
+type projectRow struct {
+	ID          int64             `bun:"id"`
+	Name        string            `bun:"name"`
+	Description string            `bun:"description"`
+	ClientName  fieldcrypt.String `bun:"client_name"`
+	Code        string            `bun:"code"`
+	Status      string            `bun:"status"`
+	ProjectDate string            `bun:"project_date"`
+}
+
+func (r projectRow) toMap() map[string]any {
+	return map[string]any{
+		"id":          r.ID,
+		"name":        r.Name,
+		"description": r.Description,
+		"clientName":  string(r.ClientName),
+		"code":        r.Code,
+		"status":      r.Status,
+		"projectDate": r.ProjectDate,
+	}
+}
+
+type palletRow struct {
+	ID         int64  `bun:"id"`
+	ProjectID  int64  `bun:"project_id"`
+	Status     string `bun:"status"`
+	CreatedAt  string `bun:"created_at"`
+	ClosedAt   string `bun:"closed_at"`
+	ReopenedAt string `bun:"reopened_at"`
+	LineCount  int64  `bun:"line_count"`
+	TotalQty   int64  `bun:"total_qty"`
+}
+
+func (r palletRow) toMap() map[string]any {
+	return map[string]any{
+		"id":         r.ID,
+		"projectId":  r.ProjectID,
+		"status":     r.Status,
+		"createdAt":  r.CreatedAt,
+		"closedAt":   nullableString(r.ClosedAt),
+		"reopenedAt": nullableString(r.ReopenedAt),
+		"lineCount":  r.LineCount,
+		"totalQty":   r.TotalQty,
+	}
+}
+
+type receiptRow struct {
+	ID            int64  `bun:"id"`
+	ProjectID     int64  `bun:"project_id"`
+	PalletID      int64  `bun:"pallet_id"`
+	SKU           string `bun:"sku"`
+	Description   string `bun:"description"`
+	UOM           string `bun:"uom"`
+	Qty           int64  `bun:"qty"`
+	CaseSize      int64  `bun:"case_size"`
+	UnknownSKU    bool   `bun:"unknown_sku"`
+	Damaged       bool   `bun:"damaged"`
+	DamagedQty    int64  `bun:"damaged_qty"`
+	DamageReason  string `bun:"damage_reason"`
+	BatchNumber   string `bun:"batch_number"`
+	ExpiryDate    string `bun:"expiry_date"`
+	ItemBarcode   string `bun:"item_barcode"`
+	CartonBarcode string `bun:"carton_barcode"`
+	Comment       string `bun:"comment"`
+	ScannedBy     string `bun:"scanned_by"`
+	PhotoCount    int64  `bun:"photo_count"`
+	CreatedAt     string `bun:"created_at"`
+	UpdatedAt     string `bun:"updated_at"`
+}
+
+func (r receiptRow) toMap() map[string]any {
+	return map[string]any{
+		"id":            r.ID,
+		"projectId":     r.ProjectID,
+		"palletId":      r.PalletID,
+		"sku":           r.SKU,
+		"description":   r.Description,
+		"uom":           r.UOM,
+		"qty":           r.Qty,
+		"caseSize":      r.CaseSize,
+		"unknownSku":    r.UnknownSKU,
+		"damaged":       r.Damaged,
+		"damagedQty":    r.DamagedQty,
+		"damageReason":  nullableString(r.DamageReason),
+		"batchNumber":   r.BatchNumber,
+		"expiryDate":    nullableString(r.ExpiryDate),
+		"itemBarcode":   r.ItemBarcode,
+		"cartonBarcode": r.CartonBarcode,
+		"comment":       r.Comment,
+		"scannedBy":     r.ScannedBy,
+		"photoCount":    r.PhotoCount,
+		"createdAt":     r.CreatedAt,
+		"updatedAt":     r.UpdatedAt,
+	}
+}
+
+type skuSummaryRow struct {
+	SKU         string `bun:"sku"`
+	Description string `bun:"description"`
+	UOM         string `bun:"uom"`
+	BatchNumber string `bun:"batch_number"`
+	ExpiryDate  string `bun:"expiry_date"`
+	IsExpired   bool   `bun:"is_expired"`
+	TotalQty    int64  `bun:"total_qty"`
+	SuccessQty  int64  `bun:"success_qty"`
+	UnknownQty  int64  `bun:"unknown_qty"`
+	DamagedQty  int64  `bun:"damaged_qty"`
+	PalletCount int64  `bun:"pallet_count"`
+}
+
+func (r skuSummaryRow) toMap() map[string]any {
+	return map[string]any{
+		"sku":         r.SKU,
+		"description": r.Description,
+		"uom":         r.UOM,
+		"batchNumber": r.BatchNumber,
+		"expiryDate":  nullableString(r.ExpiryDate),
+		"isExpired":   r.IsExpired,
+		"totalQty":    r.TotalQty,
+		"successQty":  r.SuccessQty,
+		"unknownQty":  r.UnknownQty,
+		"damagedQty":  r.DamagedQty,
+		"palletCount": r.PalletCount,
+	}
+}
+
+type commentRow struct {
+	ID          int64             `bun:"id"`
+	ProjectID   int64             `bun:"project_id"`
+	PalletID    int64             `bun:"pallet_id"`
+	SKU         string            `bun:"sku"`
+	UOM         string            `bun:"uom"`
+	BatchNumber string            `bun:"batch_number"`
+	ExpiryDate  string            `bun:"expiry_date"`
+	Comment     fieldcrypt.String `bun:"comment"`
+	CreatedBy   string            `bun:"created_by"`
+	CreatedAt   string            `bun:"created_at"`
+}
+
+func (r commentRow) toMap() map[string]any {
+	return map[string]any{
+		"id":          r.ID,
+		"projectId":   r.ProjectID,
+		"palletId":    r.PalletID,
+		"sku":         r.SKU,
+		"uom":         r.UOM,
+		"batchNumber": r.BatchNumber,
+		"expiryDate":  nullableString(r.ExpiryDate),
+		"comment":     string(r.Comment),
+		"createdBy":   r.CreatedBy,
+		"createdAt":   r.CreatedAt,
+	}
+}
+
+func nullableString(v string) any {
+	if v == "" {
+		return nil
+	}
+	return v
+}
+
+// page is a keyset page over id-ordered lists: rows with id > After, at most Limit.
+type page struct {
+	Limit int64
+	After int64
+}
+
+const projectSelect = `
+SELECT p.id, p.name, p.description, p.client_name, p.code, p.status,
+       COALESCE(date(p.project_date), '') AS project_date
+FROM projects p`
+
+func loadProjects(ctx context.Context, db *sqlite.DB, projectIDs []int64, status string) ([]projectRow, error) {
+	rows := make([]projectRow, 0)
+	if projectIDs != nil && len(projectIDs) == 0 {
+		return rows, nil
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		q := projectSelect + " WHERE 1 = 1"
+		args := make([]any, 0)
+		if projectIDs != nil {
+			q += " AND p.id IN (?)"
+			args = append(args, bun.In(projectIDs))
+		}
+		if status != "" {
+			q += " AND p.status = ?"
+			args = append(args, status)
+		}
+		q += " ORDER BY p.project_date DESC, p.id DESC"
+		return tx.NewRaw(q, args...).Scan(ctx, &rows)
+	})
+	return rows, err
+}
+
+func loadPallets(ctx context.Context, db *sqlite.DB, projectID int64, palletID int64, status string, pg page) ([]palletRow, error) {
+	rows := make([]palletRow, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		q := `
+SELECT p.id, p.project_id, p.status,
+       strftime('%Y-%m-%dT%H:%M:%SZ', p.created_at) AS created_at,
+       COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', p.closed_at), '') AS closed_at,
+       COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', p.reopened_at), '') AS reopened_at,
+       (SELECT COUNT(*) FROM pallet_receipts pr WHERE pr.pallet_id = p.id) AS line_count,
+       (SELECT COALESCE(SUM(pr.qty), 0) FROM pallet_receipts pr WHERE pr.pallet_id = p.id) AS total_qty
+FROM pallets p
+WHERE p.id > ?`
+		args := []any{pg.After}
+		if projectID > 0 {
+			q += " AND p.project_id = ?"
+			args = append(args, projectID)
+		}
+		if palletID > 0 {
+			q += " AND p.id = ?"
+			args = append(args, palletID)
+		}
+		if status != "" {
+			q += " AND p.status = ?"
+			args = append(args, status)
+		}
+		q += " ORDER BY p.id ASC LIMIT ?"
+		args = append(args, pg.Limit)
+		return tx.NewRaw(q, args...).Scan(ctx, &rows)
+	})
+	return rows, err
+}
+
+type receiptFilter struct {
+	ProjectID int64
+	PalletID  int64
+	SKU       string
+	Damaged   *bool
+	// HideInternalPhotos leaves internal photos out of photo_count for
+	// client tokens.
+	HideInternalPhotos bool
+}
+
+func loadReceipts(ctx context.Context, db *sqlite.DB, filter receiptFilter, pg page) ([]receiptRow, error) {
+	primaryVisible, galleryVisible := "1", "1"
+	if filter.HideInternalPhotos {
+		primaryVisible = photovisibility.ClientVisibleSQL(photovisibility.SourcePrimary, "pr.id")
+		galleryVisible = photovisibility.ClientVisibleSQL(photovisibility.SourceGallery, "rp.id")
+	}
+	rows := make([]receiptRow, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		q := `
+SELECT pr.id, pr.project_id, pr.pallet_id, pr.sku, pr.description, COALESCE(pr.uom, '') AS uom,
+       pr.qty, pr.case_size, pr.unknown_sku, pr.damaged, pr.damaged_qty, pr.damage_reason,
+       COALESCE(pr.batch_number, '') AS batch_number,
+       COALESCE(date(pr.expiry_date), '') AS expiry_date,
+       COALESCE(pr.item_barcode, '') AS item_barcode,
+       COALESCE(pr.carton_barcode, '') AS carton_barcode,
+       COALESCE(pr.comment, '') AS comment,
+       COALESCE(u.username, '') AS scanned_by,
+       (CASE WHEN pr.stock_photo_blob IS NOT NULL AND length(pr.stock_photo_blob) > 0 AND ` + primaryVisible + ` THEN 1 ELSE 0 END)
+         + (SELECT COUNT(*) FROM receipt_photos rp WHERE rp.pallet_receipt_id = pr.id AND ` + galleryVisible + `) AS photo_count,
+       strftime('%Y-%m-%dT%H:%M:%SZ', pr.created_at) AS created_at,
+       strftime('%Y-%m-%dT%H:%M:%SZ', pr.updated_at) AS updated_at
+FROM pallet_receipts pr
+LEFT JOIN users u ON u.id = pr.scanned_by_user_id
+WHERE pr.id > ?`
+		args := []any{pg.After}
+		if filter.ProjectID > 0 {
+			q += " AND pr.project_id = ?"
+			args = append(args, filter.ProjectID)
+		}
+		if filter.PalletID > 0 {
+			q += " AND pr.pallet_id = ?"
+			args = append(args, filter.PalletID)
+		}
+		if sku := strings.TrimSpace(filter.SKU); sku != "" {
+			q += " AND pr.sku = ?"
+			args = append(args, sku)
+		}
+		if filter.Damaged != nil {
+			q += " AND pr.damaged = ?"
+			args = append(args, *filter.Damaged)
+		}
+		q += " ORDER BY pr.id ASC LIMIT ?"
+		args = append(args, pg.Limit)
+		return tx.NewRaw(q, args...).Scan(ctx, &rows)
+	})
+	return rows, err
+}
+
+func loadSKUSummary(ctx context.Context, db *sqlite.DB, projectID int64, limit, offset int64) ([]skuSummaryRow, error) {
+	rows := make([]skuSummaryRow, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT pr.sku,
+       MAX(pr.description) AS description,
+       COALESCE(pr.uom, '') AS uom,
+       COALESCE(pr.batch_number, '') AS batch_number,
+       COALESCE(date(pr.expiry_date), '') AS expiry_date,
+       COALESCE(SUM(pr.qty), 0) AS total_qty,
+       MAX(CASE WHEN pr.expiry_date IS NOT NULL AND date(pr.expiry_date) < date('now') THEN 1 ELSE 0 END) AS is_expired,
+       COALESCE(SUM(CASE
+         WHEN pr.unknown_sku = 0 AND pr.damaged = 0 AND (pr.expiry_date IS NULL OR date(pr.expiry_date) >= date('now')) THEN pr.qty
+         ELSE 0
+       END), 0) AS success_qty,
+       COALESCE(SUM(CASE WHEN pr.unknown_sku = 1 THEN pr.qty ELSE 0 END), 0) AS unknown_qty,
+       COALESCE(SUM(CASE WHEN pr.damaged = 1 THEN pr.qty ELSE 0 END), 0) AS damaged_qty,
+       COUNT(DISTINCT pr.pallet_id) AS pallet_count
+FROM pallet_receipts pr
+WHERE pr.project_id = ?
+GROUP BY pr.sku, COALESCE(pr.uom, ''), COALESCE(pr.batch_number, ''), COALESCE(date(pr.expiry_date), '')
+ORDER BY pr.sku COLLATE NOCASE ASC, COALESCE(date(pr.expiry_date), '') ASC, COALESCE(pr.batch_number, '') ASC, COALESCE(pr.uom, '') ASC
+LIMIT ? OFFSET ?`, projectID, limit, offset).Scan(ctx, &rows)
+	})
+	return rows, err
+}
+
+func loadComments(ctx context.Context, db *sqlite.DB, projectID int64, sku string, pg page) ([]commentRow, error) {
+	rows := make([]commentRow, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		q := `
+SELECT c.id, c.project_id, c.pallet_id, c.sku, c.uom, c.batch_number,
+       COALESCE(date(c.expiry_date), '') AS expiry_date,
+       c.comment,
+       COALESCE(u.username, '') AS created_by,
+       strftime('%Y-%m-%dT%H:%M:%SZ', c.created_at) AS created_at
+FROM sku_client_comments c
+LEFT JOIN users u ON u.id = c.created_by_user_id
+WHERE c.project_id = ? AND c.id > ?`
+		args := []any{projectID, pg.After}
+		if sku = strings.TrimSpace(sku); sku != "" {
+			q += " AND c.sku = ?"
+			args = append(args, sku)
+		}
+		q += " ORDER BY c.id ASC LIMIT ?"
+		args = append(args, pg.Limit)
+		return tx.NewRaw(q, args...).Scan(ctx, &rows)
+	})
+	return rows, err
+}
@@ -0,0 +1,97 @@
+package graphqlapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/graphql"
+	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/sqlite"
+)
+
+const maxRequestBytes = 64 << 10
+
+// GraphQLQueryHandler serves read-only reporting queries. Admin tokens see
+// every project; client tokens only see their assigned projects and have
+// internal fields masked.
+func GraphQLQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			writeJSON(w, http.StatusUnauthorized, graphql.Response{Errors: []graphql.Error{{Message: "authentication required"}}})
+			return
+		}
+
+		acc := access{projectIDs: map[int64]bool{}}
+		switch session.User.Role {
+		case rbac.RoleAdmin:
+			acc.isAdmin = true
+		case rbac.RoleClient:
+			ids, err := projectinfra.ListClientProjectIDs(r.Context(), db, session.UserID)
+			if err != nil {
+				slog.Error("graphql: load client projects failed", slog.Any("err", err))
+				writeJSON(w, http.StatusInternalServerError, graphql.Response{Errors: []graphql.Error{{Message: "failed to load project access"}}})
+				return
+			}
+			for _, id := range ids {
+				acc.projectIDs[id] = true
+			}
+		default:
+			writeJSON(w, http.StatusForbidden, graphql.Response{Errors: []graphql.Error{{Message: "role is not permitted to query reporting data"}}})
+			return
+		}
+
+		req, err := parseRequest(w, r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, graphql.Response{Errors: []graphql.Error{{Message: err.Error()}}})
+			return
+		}
+
+		resp := newSchema(db, acc).Execute(r.Context(), req)
+		if resp.Data == nil {
+			writeJSON(w, http.StatusBadRequest, resp)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+func parseRequest(w http.ResponseWriter, r *http.Request) (graphql.Request, error) {
+	var req graphql.Request
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if raw := strings.TrimSpace(q.Get("variables")); raw != "" {
+			dec := json.NewDecoder(strings.NewReader(raw))
+			dec.UseNumber()
+			if err := dec.Decode(&req.Variables); err != nil {
+				return req, fmt.Errorf("variables must be a JSON object")
+			}
+		}
+	} else {
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+		dec.UseNumber()
+		if err := dec.Decode(&req); err != nil {
+			return req, fmt.Errorf("request body must be a JSON object with a query")
+		}
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		return req, fmt.Errorf("query is required")
+	}
+	return req, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("graphql: write response failed", slog.Any("err", err))
+	}
+}
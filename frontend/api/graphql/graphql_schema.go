@@ -0,0 +1,292 @@
+package graphqlapi
+
+import (
+	"context"
+	"fmt"
+
+	"receipter/infrastructure/graphql"
+	"receipter/infrastructure/sqlite"
+)
+
+// access is the caller's visibility: admins see every project, clients only
+// their assigned ones.
+type access struct {
+	isAdmin    bool
+	projectIDs map[int64]bool
+}
+
+func (a access) canSeeProject(projectID int64) bool {
+	return a.isAdmin || a.projectIDs[projectID]
+}
+
+func (a access) projectIDList() []int64 {
+	if a.isAdmin {
+		return nil
+	}
+	ids := make([]int64, 0, len(a.projectIDs))
+	for id := range a.projectIDs {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+var errProjectNotFound = fmt.Errorf("project not found")
+
+func newSchema(db *sqlite.DB, acc access) *graphql.Schema {
+	adminOnly := func(context.Context) bool { return acc.isAdmin }
+
+	comment := &graphql.Object{Name: "Comment", Fields: scalarFields(
+		"id", "projectId", "palletId", "sku", "uom", "batchNumber", "expiryDate", "comment", "createdBy", "createdAt",
+	)}
+	skuSummary := &graphql.Object{Name: "SkuSummary", Fields: scalarFields(
+		"sku", "description", "uom", "batchNumber", "expiryDate", "isExpired",
+		"totalQty", "successQty", "unknownQty", "damagedQty", "palletCount",
+	)}
+	receipt := &graphql.Object{Name: "Receipt", Fields: scalarFields(
+		"id", "projectId", "palletId", "sku", "description", "uom", "qty", "caseSize",
+		"unknownSku", "damaged", "damagedQty", "damageReason", "batchNumber", "expiryDate",
+		"itemBarcode", "cartonBarcode", "comment", "scannedBy", "photoCount", "createdAt", "updatedAt",
+	)}
+	// Warehouse staff identities are internal.
+	receipt.Fields["scannedBy"].Visible = adminOnly
+
+	pallet := &graphql.Object{Name: "Pallet", Fields: scalarFields(
+		"id", "projectId", "status", "createdAt", "closedAt", "reopenedAt", "lineCount", "totalQty",
+	)}
+	pallet.Fields["receipts"] = &graphql.Field{Type: receipt, List: true, Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+		pg, err := pageArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		return receiptsResolver(ctx, db, receiptFilter{PalletID: int64Field(source, "id"), HideInternalPhotos: !acc.isAdmin}, args, pg)
+	}}
+
+	project := &graphql.Object{Name: "Project", Fields: scalarFields(
+		"id", "name", "description", "clientName", "code", "status", "projectDate",
+	)}
+	project.Fields["pallets"] = &graphql.Field{Type: pallet, List: true, Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+		return palletsResolver(ctx, db, int64Field(source, "id"), args)
+	}}
+	project.Fields["receipts"] = &graphql.Field{Type: receipt, List: true, Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+		pg, err := pageArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		return receiptsResolver(ctx, db, receiptFilter{ProjectID: int64Field(source, "id"), HideInternalPhotos: !acc.isAdmin}, args, pg)
+	}}
+	project.Fields["skuSummary"] = &graphql.Field{Type: skuSummary, List: true, Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+		return skuSummaryResolver(ctx, db, int64Field(source, "id"), args)
+	}}
+	project.Fields["comments"] = &graphql.Field{Type: comment, List: true, Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+		return commentsResolver(ctx, db, int64Field(source, "id"), args)
+	}}
+
+	// requireProject validates the projectId argument against the caller's access.
+	requireProject := func(args graphql.Args) (int64, error) {
+		projectID, err := args.Int("projectId", 0)
+		if err != nil {
+			return 0, err
+		}
+		if projectID <= 0 || !acc.canSeeProject(projectID) {
+			return 0, errProjectNotFound
+		}
+		return projectID, nil
+	}
+
+	query := &graphql.Object{Name: "Query", Fields: map[string]*graphql.Field{
+		"projects": {Type: project, List: true, Resolve: func(ctx context.Context, _ any, args graphql.Args) (any, error) {
+			status, err := args.String("status")
+			if err != nil {
+				return nil, err
+			}
+			rows, err := loadProjects(ctx, db, acc.projectIDList(), status)
+			if err != nil {
+				return nil, err
+			}
+			return mapRows(rows, projectRow.toMap), nil
+		}},
+		"project": {Type: project, Resolve: func(ctx context.Context, _ any, args graphql.Args) (any, error) {
+			id, err := args.Int("id", 0)
+			if err != nil {
+				return nil, err
+			}
+			if id <= 0 || !acc.canSeeProject(id) {
+				return nil, nil
+			}
+			rows, err := loadProjects(ctx, db, []int64{id}, "")
+			if err != nil || len(rows) == 0 {
+				return nil, err
+			}
+			return rows[0].toMap(), nil
+		}},
+		"pallets": {Type: pallet, List: true, Resolve: func(ctx context.Context, _ any, args graphql.Args) (any, error) {
+			projectID, err := requireProject(args)
+			if err != nil {
+				return nil, err
+			}
+			return palletsResolver(ctx, db, projectID, args)
+		}},
+		"pallet": {Type: pallet, Resolve: func(ctx context.Context, _ any, args graphql.Args) (any, error) {
+			id, err := args.Int("id", 0)
+			if err != nil {
+				return nil, err
+			}
+			if id <= 0 {
+				return nil, nil
+			}
+			rows, err := loadPallets(ctx, db, 0, id, "", page{Limit: 1})
+			if err != nil || len(rows) == 0 || !acc.canSeeProject(rows[0].ProjectID) {
+				return nil, err
+			}
+			return rows[0].toMap(), nil
+		}},
+		"receipts": {Type: receipt, List: true, Resolve: func(ctx context.Context, _ any, args graphql.Args) (any, error) {
+			projectID, err := requireProject(args)
+			if err != nil {
+				return nil, err
+			}
+			palletID, err := args.Int("palletId", 0)
+			if err != nil {
+				return nil, err
+			}
+			pg, err := pageArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			return receiptsResolver(ctx, db, receiptFilter{ProjectID: projectID, PalletID: palletID, HideInternalPhotos: !acc.isAdmin}, args, pg)
+		}},
+		"skuSummary": {Type: skuSummary, List: true, Resolve: func(ctx context.Context, _ any, args graphql.Args) (any, error) {
+			projectID, err := requireProject(args)
+			if err != nil {
+				return nil, err
+			}
+			return skuSummaryResolver(ctx, db, projectID, args)
+		}},
+		"comments": {Type: comment, List: true, Resolve: func(ctx context.Context, _ any, args graphql.Args) (any, error) {
+			projectID, err := requireProject(args)
+			if err != nil {
+				return nil, err
+			}
+			return commentsResolver(ctx, db, projectID, args)
+		}},
+	}}
+
+	return &graphql.Schema{Query: query, ListSize: defaultPageSize}
+}
+
+func palletsResolver(ctx context.Context, db *sqlite.DB, projectID int64, args graphql.Args) (any, error) {
+	status, err := args.String("status")
+	if err != nil {
+		return nil, err
+	}
+	pg, err := pageArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := loadPallets(ctx, db, projectID, 0, status, pg)
+	if err != nil {
+		return nil, err
+	}
+	return mapRows(rows, palletRow.toMap), nil
+}
+
+func receiptsResolver(ctx context.Context, db *sqlite.DB, filter receiptFilter, args graphql.Args, pg page) (any, error) {
+	sku, err := args.String("sku")
+	if err != nil {
+		return nil, err
+	}
+	damaged, err := args.Bool("damaged")
+	if err != nil {
+		return nil, err
+	}
+	filter.SKU = sku
+	filter.Damaged = damaged
+	rows, err := loadReceipts(ctx, db, filter, pg)
+	if err != nil {
+		return nil, err
+	}
+	return mapRows(rows, receiptRow.toMap), nil
+}
+
+func skuSummaryResolver(ctx context.Context, db *sqlite.DB, projectID int64, args graphql.Args) (any, error) {
+	limit, err := pageSize(args)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := args.Int("offset", 0)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("argument \"offset\" must not be negative")
+	}
+	rows, err := loadSKUSummary(ctx, db, projectID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return mapRows(rows, skuSummaryRow.toMap), nil
+}
+
+func commentsResolver(ctx context.Context, db *sqlite.DB, projectID int64, args graphql.Args) (any, error) {
+	sku, err := args.String("sku")
+	if err != nil {
+		return nil, err
+	}
+	pg, err := pageArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := loadComments(ctx, db, projectID, sku, pg)
+	if err != nil {
+		return nil, err
+	}
+	return mapRows(rows, commentRow.toMap), nil
+}
+
+func pageSize(args graphql.Args) (int64, error) {
+	first, err := args.Int("first", defaultPageSize)
+	if err != nil {
+		return 0, err
+	}
+	if first <= 0 || first > maxPageSize {
+		return 0, fmt.Errorf("argument \"first\" must be between 1 and %d", maxPageSize)
+	}
+	return first, nil
+}
+
+func pageArgs(args graphql.Args) (page, error) {
+	limit, err := pageSize(args)
+	if err != nil {
+		return page{}, err
+	}
+	after, err := args.Int("after", 0)
+	if err != nil {
+		return page{}, err
+	}
+	return page{Limit: limit, After: after}, nil
+}
+
+func scalarFields(names ...string) map[string]*graphql.Field {
+	fields := make(map[string]*graphql.Field, len(names))
+	for _, name := range names {
+		fields[name] = &graphql.Field{}
+	}
+	return fields
+}
+
+func mapRows[T any](rows []T, toMap func(T) map[string]any) []map[string]any {
+	out := make([]map[string]any, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, toMap(row))
+	}
+	return out
+}
+
+func int64Field(source any, name string) int64 {
+	m, ok := source.(map[string]any)
+	if !ok {
+		return 0
+	}
+	v, _ := m[name].(int64)
+	return v
+}
@@ -0,0 +1,121 @@
+package kpiapi
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/kpi"
+	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/sqlite"
+)
+
+type projectRef struct {
+	ID   int64  `json:"id"`
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+type seriesResponse struct {
+	Project projectRef `json:"project"`
+	From    string     `json:"from"`
+	To      string     `json:"to"`
+	Days    []kpi.Day  `json:"days"`
+}
+
+// ProjectKPIQueryHandler serves a project's daily KPI snapshots between the
+// from and to query dates (YYYY-MM-DD, UTC), for BI tools to poll. Admin
+// tokens see every project; client tokens only their assigned projects. The
+// ETag lets a poller skip unchanged series with If-None-Match.
+func ProjectKPIQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid project id")
+			return
+		}
+		switch session.User.Role {
+		case rbac.RoleAdmin:
+		case rbac.RoleClient:
+			allowed, err := projectinfra.ClientHasProjectAccess(r.Context(), db, session.UserID, projectID)
+			if err != nil {
+				slog.Error("kpi api: check client access failed", slog.Any("err", err))
+				writeError(w, http.StatusInternalServerError, "failed to load project access")
+				return
+			}
+			if !allowed {
+				writeError(w, http.StatusNotFound, "project not found")
+				return
+			}
+		default:
+			writeError(w, http.StatusForbidden, "role is not permitted to read project KPIs")
+			return
+		}
+
+		project, err := projectinfra.LoadByID(r.Context(), db, projectID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				writeError(w, http.StatusNotFound, "project not found")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, "failed to load project")
+			return
+		}
+		from, to, err := kpi.ParseRange(r.URL.Query().Get("from"), r.URL.Query().Get("to"), time.Now())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		days, err := kpi.Series(r.Context(), db, project.ID, from, to)
+		if err != nil {
+			slog.Error("kpi api: load series failed", slog.Any("err", err))
+			writeError(w, http.StatusInternalServerError, "failed to load project KPIs")
+			return
+		}
+
+		body, err := json.Marshal(seriesResponse{
+			Project: projectRef{ID: project.ID, Code: project.Code, Name: project.Name},
+			From:    from.Format(kpi.DateLayout),
+			To:      to.Format(kpi.DateLayout),
+			Days:    days,
+		})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to encode project KPIs")
+			return
+		}
+		sum := sha256.Sum256(body)
+		etag := `"kpi-` + hex.EncodeToString(sum[:8]) + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "private, no-cache")
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(append(body, '\n'))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"errors": []map[string]string{{"message": message}},
+	})
+}
@@ -0,0 +1,70 @@
+package palletsapi
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 500
+)
+
+type palletRow struct {
+	ID                int64  `bun:"id"`
+	ProjectID         int64  `bun:"project_id"`
+	Status            string `bun:"status"`
+	PalletType        string `bun:"pallet_type"`
+	DeliveryReference string `bun:"delivery_reference"`
+	CreatedAt         string `bun:"created_at"`
+	ClosedAt          string `bun:"closed_at"`
+	LineCount         int64  `bun:"line_count"`
+	TotalQty          int64  `bun:"total_qty"`
+}
+
+type palletFilter struct {
+	ProjectID int64
+	PalletID  int64
+	Status    string
+	After     int64
+	Limit     int64
+}
+
+const palletSelect = `
+SELECT p.id, p.project_id, p.status,
+       COALESCE(pa.pallet_type, '') AS pallet_type,
+       COALESCE(pa.delivery_reference, '') AS delivery_reference,
+       strftime('%Y-%m-%dT%H:%M:%SZ', p.created_at) AS created_at,
+       COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', p.closed_at), '') AS closed_at,
+       (SELECT COUNT(*) FROM pallet_receipts pr WHERE pr.pallet_id = p.id) AS line_count,
+       (SELECT COALESCE(SUM(pr.qty), 0) FROM pallet_receipts pr WHERE pr.pallet_id = p.id) AS total_qty
+FROM pallets p
+LEFT JOIN pallet_attributes pa ON pa.pallet_id = p.id`
+
+func loadPallets(ctx context.Context, db *sqlite.DB, filter palletFilter) ([]palletRow, error) {
+	rows := make([]palletRow, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		q := palletSelect + `
+WHERE p.id > ?`
+		args := []any{filter.After}
+		if filter.ProjectID > 0 {
+			q += " AND p.project_id = ?"
+			args = append(args, filter.ProjectID)
+		}
+		if filter.PalletID > 0 {
+			q += " AND p.id = ?"
+			args = append(args, filter.PalletID)
+		}
+		if filter.Status != "" {
+			q += " AND p.status = ?"
+			args = append(args, filter.Status)
+		}
+		q += " ORDER BY p.id ASC LIMIT ?"
+		args = append(args, filter.Limit)
+		return tx.NewRaw(q, args...).Scan(ctx, &rows)
+	})
+	return rows, err
+}
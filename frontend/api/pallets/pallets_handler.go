@@ -0,0 +1,492 @@
+// Package palletsapi is version 1 of the JSON API for pallets and their
+// receipt lines, for WMS integrations and mobile apps. Receipt lines go
+// through the same checks as the receipt form.
+package palletsapi
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/frontend/pallets/receipt"
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/catalog"
+	"receipter/infrastructure/customfield"
+	"receipter/infrastructure/formtoken"
+	"receipter/infrastructure/live"
+	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/sqlite"
+)
+
+const maxRequestBytes = 1 << 20
+
+// receiptFields maps receipt form fields to their names in the JSON body,
+// so field errors name what the caller sent.
+var receiptFields = map[string]string{
+	"sku":               "sku",
+	"qty":               "qty",
+	"case_size":         "caseSize",
+	"batch_number":      "batchNumber",
+	"expiry_date":       "expiryDate",
+	"country_of_origin": "countryOfOrigin",
+	"hs_code":           "hsCode",
+	"serials":           "serials",
+	"damaged_qty":       "damagedQty",
+	"damage_reason":     "damageReason",
+	"carton_barcode":    "cartonBarcode",
+	"item_barcode":      "itemBarcode",
+	"photos":            "photos",
+}
+
+type palletResponse struct {
+	ID                int64  `json:"id"`
+	Code              string `json:"code"`
+	ProjectID         int64  `json:"projectId"`
+	Status            string `json:"status"`
+	PalletType        string `json:"palletType"`
+	DeliveryReference string `json:"deliveryReference"`
+	CreatedAt         string `json:"createdAt"`
+	ClosedAt          any    `json:"closedAt"`
+	LineCount         int64  `json:"lineCount"`
+	TotalQty          int64  `json:"totalQty"`
+	LabelURL          string `json:"labelUrl"`
+}
+
+func newPalletResponse(row palletRow) palletResponse {
+	var closedAt any
+	if row.ClosedAt != "" {
+		closedAt = row.ClosedAt
+	}
+	return palletResponse{
+		ID:                row.ID,
+		Code:              fmt.Sprintf("P%08d", row.ID),
+		ProjectID:         row.ProjectID,
+		Status:            row.Status,
+		PalletType:        row.PalletType,
+		DeliveryReference: row.DeliveryReference,
+		CreatedAt:         row.CreatedAt,
+		ClosedAt:          closedAt,
+		LineCount:         row.LineCount,
+		TotalQty:          row.TotalQty,
+		LabelURL:          fmt.Sprintf("/tasker/pallets/%d/label", row.ID),
+	}
+}
+
+type customValueResponse struct {
+	FieldID int64  `json:"fieldId"`
+	Key     string `json:"key"`
+	Label   string `json:"label"`
+	Value   string `json:"value"`
+}
+
+type receiptResponse struct {
+	ID              int64                 `json:"id"`
+	SKU             string                `json:"sku"`
+	Description     string                `json:"description"`
+	UOM             string                `json:"uom"`
+	Comment         string                `json:"comment"`
+	Qty             int64                 `json:"qty"`
+	CaseSize        int64                 `json:"caseSize"`
+	UnknownSKU      bool                  `json:"unknownSku"`
+	Damaged         bool                  `json:"damaged"`
+	DamagedQty      int64                 `json:"damagedQty"`
+	DamageReason    string                `json:"damageReason"`
+	BatchNumber     string                `json:"batchNumber"`
+	ExpiryDate      string                `json:"expiryDate"`
+	CartonBarcode   string                `json:"cartonBarcode"`
+	ItemBarcode     string                `json:"itemBarcode"`
+	CountryOfOrigin string                `json:"countryOfOrigin"`
+	HSCode          string                `json:"hsCode"`
+	Serials         []string              `json:"serials"`
+	PhotoCount      int                   `json:"photoCount"`
+	CustomValues    []customValueResponse `json:"customValues"`
+}
+
+func newReceiptResponse(line receipt.ReceiptLineView) receiptResponse {
+	out := receiptResponse{
+		ID:              line.ID,
+		SKU:             line.SKU,
+		Description:     line.Description,
+		UOM:             line.UOM,
+		Comment:         line.Comment,
+		Qty:             line.Qty,
+		CaseSize:        line.CaseSize,
+		UnknownSKU:      line.UnknownSKU,
+		Damaged:         line.Damaged,
+		DamagedQty:      line.DamagedQty,
+		DamageReason:    line.DamageReason,
+		BatchNumber:     line.BatchNumber,
+		ExpiryDate:      line.ExpiryDateISO,
+		CartonBarcode:   line.CartonBarcode,
+		ItemBarcode:     line.ItemBarcode,
+		CountryOfOrigin: line.CountryOfOrigin,
+		HSCode:          line.HSCode,
+		Serials:         line.Serials,
+		PhotoCount:      line.PhotoCount,
+		CustomValues:    make([]customValueResponse, 0, len(line.CustomValues)),
+	}
+	if out.Serials == nil {
+		out.Serials = []string{}
+	}
+	for _, value := range line.CustomValues {
+		out.CustomValues = append(out.CustomValues, customValueResponse{FieldID: value.FieldID, Key: value.Key, Label: value.Label, Value: value.Value})
+	}
+	return out
+}
+
+// receiptRequest is one receipt line. The override flags match the receipt
+// form's checkboxes; photos and unknown SKUs need the receipt page.
+type receiptRequest struct {
+	SKU                 string            `json:"sku"`
+	Description         string            `json:"description"`
+	UOM                 string            `json:"uom"`
+	Comment             string            `json:"comment"`
+	Qty                 int64             `json:"qty"`
+	CaseSize            int64             `json:"caseSize"`
+	DamagedQty          int64             `json:"damagedQty"`
+	DamageReason        string            `json:"damageReason"`
+	BatchNumber         string            `json:"batchNumber"`
+	ExpiryDate          string            `json:"expiryDate"`
+	CartonBarcode       string            `json:"cartonBarcode"`
+	ItemBarcode         string            `json:"itemBarcode"`
+	NoOuterBarcode      bool              `json:"noOuterBarcode"`
+	NoInnerBarcode      bool              `json:"noInnerBarcode"`
+	CountryOfOrigin     string            `json:"countryOfOrigin"`
+	HSCode              string            `json:"hsCode"`
+	Serials             []string          `json:"serials"`
+	CustomValues        map[string]string `json:"customValues"`
+	KeepFailedBarcodes  bool              `json:"keepFailedBarcodes"`
+	ExpiryCheckOverride bool              `json:"expiryCheckOverride"`
+	HighValueConfirmed  bool              `json:"highValueConfirmed"`
+	// IdempotencyKey, when set, makes a request retried within a day save
+	// the line once.
+	IdempotencyKey string `json:"idempotencyKey"`
+}
+
+// values is the request as the receipt form would have posted it.
+func (req receiptRequest) values() url.Values {
+	form := url.Values{}
+	set := func(name, value string) {
+		if value != "" {
+			form.Set(name, value)
+		}
+	}
+	flag := func(name string, on bool) {
+		if on {
+			form.Set(name, "1")
+		}
+	}
+	set("sku", req.SKU)
+	set("description", req.Description)
+	set("uom", req.UOM)
+	set("comment", req.Comment)
+	form.Set("qty", strconv.FormatInt(req.Qty, 10))
+	if req.CaseSize != 0 {
+		form.Set("case_size", strconv.FormatInt(req.CaseSize, 10))
+	}
+	if req.DamagedQty != 0 {
+		form.Set("damaged_qty", strconv.FormatInt(req.DamagedQty, 10))
+	}
+	set("damage_reason", req.DamageReason)
+	set("batch_number", req.BatchNumber)
+	set("expiry_date", req.ExpiryDate)
+	set("carton_barcode", req.CartonBarcode)
+	set("item_barcode", req.ItemBarcode)
+	flag("no_outer_barcode", req.NoOuterBarcode)
+	flag("no_inner_barcode", req.NoInnerBarcode)
+	set("country_of_origin", req.CountryOfOrigin)
+	set("hs_code", req.HSCode)
+	set("serials", strings.Join(req.Serials, "\n"))
+	for fieldID, value := range req.CustomValues {
+		form.Set(customfield.FormPrefix+fieldID, value)
+	}
+	flag("barcode_check_override", req.KeepFailedBarcodes)
+	flag("expiry_check_override", req.ExpiryCheckOverride)
+	return form
+}
+
+// PalletsQueryHandler lists a project's pallets with their line counts,
+// oldest first. Pages are keyed on pallet id: pass the last id seen as after.
+func PalletsQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		projectID, err := strconv.ParseInt(query.Get("projectId"), 10, 64)
+		if err != nil || projectID <= 0 {
+			writeError(w, http.StatusBadRequest, "projectId is required")
+			return
+		}
+		filter := palletFilter{ProjectID: projectID, Status: strings.TrimSpace(query.Get("status")), Limit: defaultPageSize}
+		if raw := query.Get("after"); raw != "" {
+			if filter.After, err = strconv.ParseInt(raw, 10, 64); err != nil || filter.After < 0 {
+				writeError(w, http.StatusBadRequest, "after must be a pallet id")
+				return
+			}
+		}
+		if raw := query.Get("limit"); raw != "" {
+			if filter.Limit, err = strconv.ParseInt(raw, 10, 64); err != nil || filter.Limit <= 0 || filter.Limit > maxPageSize {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+				return
+			}
+		}
+		if !checkProject(w, r, db, projectID) {
+			return
+		}
+		rows, err := loadPallets(r.Context(), db, filter)
+		if err != nil {
+			slog.Error("pallets api: list pallets failed", slog.Int64("project_id", projectID), slog.Any("err", err))
+			writeError(w, http.StatusInternalServerError, "failed to load pallets")
+			return
+		}
+		pallets := make([]palletResponse, 0, len(rows))
+		for _, row := range rows {
+			pallets = append(pallets, newPalletResponse(row))
+		}
+		var next any
+		if int64(len(rows)) == filter.Limit {
+			next = rows[len(rows)-1].ID
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"projectId": projectID, "pallets": pallets, "nextAfter": next})
+	}
+}
+
+// PalletQueryHandler returns one pallet with its receipt lines.
+func PalletQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pallet, ok := loadPallet(w, r, db)
+		if !ok {
+			return
+		}
+		lines, ok := loadLines(w, r, db, pallet.ID)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"pallet": newPalletResponse(pallet), "receipts": lines})
+	}
+}
+
+// ReceiptsQueryHandler returns a pallet's receipt lines.
+func ReceiptsQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pallet, ok := loadPallet(w, r, db)
+		if !ok {
+			return
+		}
+		lines, ok := loadLines(w, r, db, pallet.ID)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"palletId": pallet.ID, "receipts": lines})
+	}
+}
+
+// CreateReceiptCommandHandler adds a receipt line to a pallet. The line is
+// checked the way the receipt form is, and every field problem comes back
+// at once as a 422 naming the JSON field. A line matching one already on the
+// pallet is merged into it, as on the receipt page.
+func CreateReceiptCommandHandler(db *sqlite.DB, auditSvc *audit.Service, hub *live.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pallet, ok := loadPallet(w, r, db)
+		if !ok {
+			return
+		}
+		var req receiptRequest
+		if !decode(w, r, &req, "request body must be a JSON receipt line object with sku and qty") {
+			return
+		}
+		session, _ := context.GetSessionFromContext(r.Context())
+		form := req.values()
+		errs, err := receipt.ValidateReceiptValues(r.Context(), db, pallet.ID, session.UserRoles, form)
+		if err != nil {
+			slog.Error("pallets api: validate receipt failed", slog.Int64("pallet_id", pallet.ID), slog.Any("err", err))
+			writeError(w, http.StatusInternalServerError, "failed to validate receipt")
+			return
+		}
+		if errs.Form != "" {
+			writeError(w, http.StatusConflict, errs.Form)
+			return
+		}
+		if !errs.Valid() {
+			writeFieldErrors(w, errs.InFormOrder())
+			return
+		}
+
+		input, err := receipt.ReceiptInputFromValues(r.Context(), db, pallet.ProjectID, pallet.ID, form)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to read receipt")
+			return
+		}
+		highValue, err := catalog.IsHighValue(r.Context(), db, pallet.ProjectID, input.SKU)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to save receipt")
+			return
+		}
+		if highValue && !req.HighValueConfirmed {
+			writeFieldErrors(w, []receipt.ReceiptFieldMessage{{Field: "sku", Message: input.SKU + " is a high-value item; check its details and resend with highValueConfirmed"}})
+			return
+		}
+		input.HighValueConfirmed = highValue
+		if key := strings.TrimSpace(req.IdempotencyKey); key != "" {
+			input.FormToken = idempotencyToken(session.UserID, key)
+		}
+
+		saved, err := receipt.SaveReceiptWithUploads(r.Context(), db, auditSvc, session.UserID, input)
+		if errors.Is(err, formtoken.ErrUsed) {
+			writeError(w, http.StatusConflict, "a receipt with this idempotencyKey was already saved")
+			return
+		}
+		if err != nil {
+			if receipt.IsRefusedReceipt(err) {
+				writeError(w, http.StatusUnprocessableEntity, err.Error())
+				return
+			}
+			slog.Error("pallets api: save receipt failed", slog.Int64("pallet_id", pallet.ID), slog.Any("err", err))
+			writeError(w, http.StatusInternalServerError, "failed to save receipt")
+			return
+		}
+		hub.Publish(pallet.ID, live.EventLines)
+
+		lines, ok := loadLines(w, r, db, pallet.ID)
+		if !ok {
+			return
+		}
+		for _, line := range lines {
+			if line.ID == saved.ReceiptID {
+				writeJSON(w, http.StatusCreated, map[string]any{"palletId": pallet.ID, "receipt": line})
+				return
+			}
+		}
+		writeJSON(w, http.StatusCreated, map[string]any{"palletId": pallet.ID, "receipt": map[string]any{"id": saved.ReceiptID}})
+	}
+}
+
+// idempotencyToken turns a caller's idempotency key into a form token, so a
+// retry is refused the way a double-submitted receipt form is. Keys are
+// scoped to the user so two integrations cannot collide.
+func idempotencyToken(userID int64, key string) string {
+	sum := sha256.Sum256([]byte(strconv.FormatInt(userID, 10) + ":" + key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// loadPallet resolves the pallet in the URL for the token's user.
+func loadPallet(w http.ResponseWriter, r *http.Request, db *sqlite.DB) (palletRow, bool) {
+	palletID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || palletID <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid pallet id")
+		return palletRow{}, false
+	}
+	rows, err := loadPallets(r.Context(), db, palletFilter{PalletID: palletID, Limit: 1})
+	if err != nil {
+		slog.Error("pallets api: load pallet failed", slog.Int64("pallet_id", palletID), slog.Any("err", err))
+		writeError(w, http.StatusInternalServerError, "failed to load pallet")
+		return palletRow{}, false
+	}
+	if len(rows) == 0 {
+		writeError(w, http.StatusNotFound, "pallet not found")
+		return palletRow{}, false
+	}
+	if !checkProject(w, r, db, rows[0].ProjectID) {
+		return palletRow{}, false
+	}
+	return rows[0], true
+}
+
+// checkProject checks the token's user may reach the project: admin and
+// scanner tokens reach every project, client tokens only their assigned
+// ones, and a project a client cannot see is reported as not found.
+func checkProject(w http.ResponseWriter, r *http.Request, db *sqlite.DB, projectID int64) bool {
+	session, ok := context.GetSessionFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "authentication required")
+		return false
+	}
+	switch session.User.Role {
+	case rbac.RoleAdmin, rbac.RoleScanner:
+	case rbac.RoleClient:
+		allowed, err := projectinfra.ClientHasProjectAccess(r.Context(), db, session.UserID, projectID)
+		if err != nil {
+			slog.Error("pallets api: check client access failed", slog.Any("err", err))
+			writeError(w, http.StatusInternalServerError, "failed to load project access")
+			return false
+		}
+		if !allowed {
+			writeError(w, http.StatusNotFound, "project not found")
+			return false
+		}
+	default:
+		writeError(w, http.StatusForbidden, "role is not permitted to use the pallets api")
+		return false
+	}
+	if _, err := projectinfra.LoadByID(r.Context(), db, projectID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "project not found")
+			return false
+		}
+		writeError(w, http.StatusInternalServerError, "failed to load project")
+		return false
+	}
+	return true
+}
+
+func loadLines(w http.ResponseWriter, r *http.Request, db *sqlite.DB, palletID int64) ([]receiptResponse, bool) {
+	data, err := receipt.LoadPageData(r.Context(), db, palletID)
+	if err != nil {
+		slog.Error("pallets api: load receipts failed", slog.Int64("pallet_id", palletID), slog.Any("err", err))
+		writeError(w, http.StatusInternalServerError, "failed to load receipts")
+		return nil, false
+	}
+	lines := make([]receiptResponse, 0, len(data.Lines))
+	for _, line := range data.Lines {
+		lines = append(lines, newReceiptResponse(line))
+	}
+	return lines, true
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any, message string) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, message)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("pallets api: write response failed", slog.Any("err", err))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{
+		"errors": []map[string]string{{"message": message}},
+	})
+}
+
+// writeFieldErrors reports receipt field problems, each naming its JSON field.
+func writeFieldErrors(w http.ResponseWriter, messages []receipt.ReceiptFieldMessage) {
+	errs := make([]map[string]string, 0, len(messages))
+	for _, message := range messages {
+		field := receiptFields[message.Field]
+		if field == "" {
+			field = message.Field
+		}
+		errs = append(errs, map[string]string{"field": field, "message": message.Message})
+	}
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"errors": errs})
+}
@@ -0,0 +1,26 @@
+package auditor
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+// LoadFrame loads the project the link opens.
+func LoadFrame(ctx context.Context, db *sqlite.DB, link models.AuditorLink, token, section string) (Frame, error) {
+	frame := Frame{
+		Token:       token,
+		AuditorName: link.AuditorName,
+		ExpiresAt:   link.ExpiresAt,
+		Section:     section,
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT name, client_name FROM projects WHERE id = ?`, link.ProjectID).
+			Scan(ctx, &frame.ProjectName, fieldcrypt.Dest(&frame.ClientName))
+	})
+	return frame, err
+}
@@ -0,0 +1,141 @@
+package auditor
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/go-chi/chi/v5"
+
+	palletlabels "receipter/frontend/pallets/labels"
+	"receipter/frontend/pallets/progress"
+	"receipter/frontend/projects"
+	"receipter/infrastructure/accesslog"
+	"receipter/infrastructure/auditorlink"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+// SKUsPageQueryHandler is the landing page of an auditor link: the
+// project's SKU totals.
+func SKUsPageQueryHandler(db *sqlite.DB, recorder *accesslog.Recorder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link, frame, ok := authenticate(w, r, db, SectionSKUs)
+		if !ok {
+			return
+		}
+		skus, err := progress.LoadSKUSummary(r.Context(), db, link.ProjectID, r.URL.Query().Get("filter"))
+		if err != nil {
+			http.Error(w, "failed to load SKUs", http.StatusInternalServerError)
+			return
+		}
+		render(w, r, recorder, link, SKUsPage(SKUsPageData{Frame: frame, SKUs: skus}))
+	}
+}
+
+func PalletsPageQueryHandler(db *sqlite.DB, recorder *accesslog.Recorder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link, frame, ok := authenticate(w, r, db, SectionPallets)
+		if !ok {
+			return
+		}
+		pallets, err := progress.LoadSummary(r.Context(), db, link.ProjectID, r.URL.Query().Get("status"))
+		if err != nil {
+			http.Error(w, "failed to load pallets", http.StatusInternalServerError)
+			return
+		}
+		render(w, r, recorder, link, PalletsPage(PalletsPageData{Frame: frame, Pallets: pallets}))
+	}
+}
+
+func PalletPageQueryHandler(db *sqlite.DB, recorder *accesslog.Recorder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link, frame, ok := authenticate(w, r, db, SectionPallets)
+		if !ok {
+			return
+		}
+		palletID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || palletID <= 0 {
+			http.Error(w, "pallet not found", http.StatusNotFound)
+			return
+		}
+		pallet, lines, err := palletlabels.LoadPalletContent(r.Context(), db, palletID, "all")
+		// Pallets of other projects are reported as missing, not forbidden.
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && pallet.ProjectID != link.ProjectID) {
+			http.Error(w, "pallet not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to load pallet", http.StatusInternalServerError)
+			return
+		}
+		events, err := palletlabels.LoadPalletEventLog(r.Context(), db, palletID)
+		if err != nil {
+			http.Error(w, "failed to load pallet history", http.StatusInternalServerError)
+			return
+		}
+		render(w, r, recorder, link, PalletPage(PalletPageData{Frame: frame, Pallet: pallet, Lines: lines, Events: events}))
+	}
+}
+
+func LogsPageQueryHandler(db *sqlite.DB, recorder *accesslog.Recorder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link, frame, ok := authenticate(w, r, db, SectionLogs)
+		if !ok {
+			return
+		}
+		logs, err := projects.LoadProjectLogsPageData(r.Context(), db, link.ProjectID)
+		if err != nil {
+			http.Error(w, "failed to load project logs", http.StatusInternalServerError)
+			return
+		}
+		render(w, r, recorder, link, LogsPage(LogsPageData{Frame: frame, Logs: logs}))
+	}
+}
+
+// authenticate resolves the link in the URL. The link is a credential, so
+// no response may be cached, indexed or leak it in a Referer header.
+func authenticate(w http.ResponseWriter, r *http.Request, db *sqlite.DB, section string) (models.AuditorLink, Frame, bool) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+	token := chi.URLParam(r, "token")
+	link, err := auditorlink.Authenticate(r.Context(), db, token, time.Now().UTC())
+	if err != nil {
+		if !errors.Is(err, auditorlink.ErrInvalidToken) {
+			slog.Error("auditor link authentication failed", slog.Any("err", err))
+		}
+		http.Error(w, "This link has expired or been revoked.", http.StatusNotFound)
+		return link, Frame{}, false
+	}
+	frame, err := LoadFrame(r.Context(), db, link, token, section)
+	if err != nil {
+		http.Error(w, "failed to load project", http.StatusInternalServerError)
+		return link, Frame{}, false
+	}
+	return link, frame, true
+}
+
+// render writes the page and logs the view against the project under the
+// auditor's name. The token is replaced by its prefix so the log does not
+// hold a working link.
+func render(w http.ResponseWriter, r *http.Request, recorder *accesslog.Recorder, link models.AuditorLink, page templ.Component) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := page.Render(r.Context(), w); err != nil {
+		http.Error(w, "failed to render page", http.StatusInternalServerError)
+		return
+	}
+	recorder.Record(accesslog.Entry{
+		ProjectID: link.ProjectID,
+		Username:  auditorlink.AccessLogName(link.AuditorName),
+		Kind:      accesslog.KindPage,
+		Path:      strings.Replace(r.URL.Path, chi.URLParam(r, "token"), link.TokenPrefix+"...", 1),
+		Query:     r.URL.RawQuery,
+		At:        time.Now().UTC(),
+	})
+}
@@ -0,0 +1,62 @@
+package auditor
+
+import (
+	"fmt"
+	"time"
+
+	palletlabels "receipter/frontend/pallets/labels"
+	"receipter/frontend/pallets/progress"
+	"receipter/frontend/projects"
+	"receipter/models"
+)
+
+// Sections of the auditor preview, in tab order.
+const (
+	SectionSKUs    = "skus"
+	SectionPallets = "pallets"
+	SectionLogs    = "logs"
+)
+
+// Frame is what every auditor page shows around its content: which project
+// the link opens, who it was issued to and until when.
+type Frame struct {
+	Token       string
+	AuditorName string
+	ExpiresAt   time.Time
+	ProjectName string
+	ClientName  string
+	Section     string
+}
+
+// URL is the address of a page of the preview, relative to its root.
+func (f Frame) URL(path string) string {
+	return "/audit/" + f.Token + path
+}
+
+// Watermark is stamped across every page so screenshots and printouts
+// carry who they were shared with.
+func (f Frame) Watermark() string {
+	return fmt.Sprintf("Read-only · %s · expires %s", f.AuditorName, f.ExpiresAt.Local().Format("02/01/2006 15:04"))
+}
+
+type SKUsPageData struct {
+	Frame
+	SKUs progress.SKUSummaryPageData
+}
+
+type PalletsPageData struct {
+	Frame
+	Pallets progress.Summary
+}
+
+type PalletPageData struct {
+	Frame
+	Pallet models.Pallet
+	Lines  []palletlabels.ContentLine
+	Events []palletlabels.PalletEvent
+}
+
+type LogsPageData struct {
+	Frame
+	Logs projects.ProjectLogsPageData
+}
@@ -0,0 +1,241 @@
+package bookings
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/booking"
+	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/sqlite"
+)
+
+// BookingsPageQueryHandler renders a day's delivery slots and bookings.
+func BookingsPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		today := time.Now().Format(booking.DateLayout)
+		date, err := booking.ParseDate(r.URL.Query().Get("date"))
+		if err != nil {
+			date = today
+		}
+		day, _ := time.Parse(booking.DateLayout, date)
+
+		slots, err := booking.ListSlots(r.Context(), db, date, true)
+		if err != nil {
+			http.Error(w, "failed to load delivery slots", http.StatusInternalServerError)
+			return
+		}
+		projects, err := projectinfra.List(r.Context(), db, projectinfra.StatusActive)
+		if err != nil {
+			http.Error(w, "failed to load projects", http.StatusInternalServerError)
+			return
+		}
+		data := PageData{
+			Date:         date,
+			PrevDate:     day.AddDate(0, 0, -1).Format(booking.DateLayout),
+			NextDate:     day.AddDate(0, 0, 1).Format(booking.DateLayout),
+			IsToday:      date == today,
+			Slots:        slots,
+			Projects:     projects,
+			Status:       r.URL.Query().Get("status"),
+			ErrorMessage: r.URL.Query().Get("error"),
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := BookingsPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render bookings page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func CreateSlotCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, bookingsURL("", "", "invalid form data"), http.StatusSeeOther)
+			return
+		}
+		date := r.FormValue("date")
+		capacity, _ := strconv.ParseInt(r.FormValue("capacity"), 10, 64)
+		slot, err := booking.CreateSlot(r.Context(), db, auditSvc, session.UserID, date, r.FormValue("start_time"), r.FormValue("end_time"), capacity)
+		if err != nil {
+			http.Redirect(w, r, bookingsURL(date, "", err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, bookingsURL(slot.Date, "slot opened: "+slot.StartTime+"-"+slot.EndTime, ""), http.StatusSeeOther)
+	}
+}
+
+func DeleteSlotCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		date := r.FormValue("date")
+		slotID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || slotID <= 0 {
+			http.Redirect(w, r, bookingsURL(date, "", "invalid slot id"), http.StatusSeeOther)
+			return
+		}
+		if err := booking.DeleteSlot(r.Context(), db, auditSvc, session.UserID, slotID); err != nil {
+			http.Redirect(w, r, bookingsURL(date, "", err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, bookingsURL(date, "slot removed", ""), http.StatusSeeOther)
+	}
+}
+
+func CreateBookingCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, bookingsURL("", "", "invalid form data"), http.StatusSeeOther)
+			return
+		}
+		date := r.FormValue("date")
+		slotID, _ := strconv.ParseInt(r.FormValue("slot_id"), 10, 64)
+		projectID, _ := strconv.ParseInt(r.FormValue("project_id"), 10, 64)
+		expected, _ := strconv.ParseInt(r.FormValue("expected_pallets"), 10, 64)
+		created, err := booking.Book(r.Context(), db, auditSvc, session.UserID, booking.SourceWeb, booking.Request{
+			SlotID:            slotID,
+			ProjectID:         projectID,
+			Carrier:           r.FormValue("carrier"),
+			DeliveryReference: r.FormValue("delivery_reference"),
+			ExpectedPallets:   expected,
+		}, time.Now())
+		if err != nil {
+			http.Redirect(w, r, bookingsURL(date, "", err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, bookingsURL(created.Date, "delivery booked: "+created.Carrier, ""), http.StatusSeeOther)
+	}
+}
+
+func CancelBookingCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		date := r.FormValue("date")
+		bookingID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || bookingID <= 0 {
+			http.Redirect(w, r, bookingsURL(date, "", "invalid booking id"), http.StatusSeeOther)
+			return
+		}
+		if err := booking.Cancel(r.Context(), db, auditSvc, session.UserID, bookingID); err != nil {
+			http.Redirect(w, r, bookingsURL(date, "", err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, bookingsURL(date, "booking cancelled", ""), http.StatusSeeOther)
+	}
+}
+
+// GatehousePageQueryHandler lists today's bookings for checking in trucks
+// as they arrive.
+func GatehousePageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		date := time.Now().Format(booking.DateLayout)
+		bookings, err := booking.ListDay(r.Context(), db, date)
+		if err != nil {
+			http.Error(w, "failed to load bookings", http.StatusInternalServerError)
+			return
+		}
+		data := GatehousePageData{
+			Date:         date,
+			Bookings:     bookings,
+			Status:       r.URL.Query().Get("status"),
+			ErrorMessage: r.URL.Query().Get("error"),
+		}
+		for _, b := range bookings {
+			data.Expected++
+			if b.Status == booking.StatusArrived {
+				data.Arrived++
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := GatehousePage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render gatehouse page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func CheckInCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		bookingID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || bookingID <= 0 {
+			http.Redirect(w, r, gatehouseURL("", "invalid booking id"), http.StatusSeeOther)
+			return
+		}
+		if err := booking.CheckIn(r.Context(), db, auditSvc, session.UserID, bookingID, time.Now()); err != nil {
+			if errors.Is(err, booking.ErrNotFound) || errors.Is(err, booking.ErrNotBooked) {
+				http.Redirect(w, r, gatehouseURL("", err.Error()), http.StatusSeeOther)
+				return
+			}
+			http.Redirect(w, r, gatehouseURL("", "failed to check in delivery"), http.StatusSeeOther)
+			return
+		}
+		checked, err := booking.Load(r.Context(), db, bookingID)
+		if err != nil {
+			http.Redirect(w, r, gatehouseURL("delivery checked in", ""), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, gatehouseURL("checked in: "+checked.Carrier, ""), http.StatusSeeOther)
+	}
+}
+
+func bookingsURL(date, status, errMsg string) string {
+	q := url.Values{}
+	if parsed, err := booking.ParseDate(date); err == nil {
+		q.Set("date", parsed)
+	}
+	if status != "" {
+		q.Set("status", status)
+	}
+	if errMsg != "" {
+		q.Set("error", errMsg)
+	}
+	if len(q) == 0 {
+		return "/tasker/bookings"
+	}
+	return "/tasker/bookings?" + q.Encode()
+}
+
+func gatehouseURL(status, errMsg string) string {
+	q := url.Values{}
+	if status != "" {
+		q.Set("status", status)
+	}
+	if errMsg != "" {
+		q.Set("error", errMsg)
+	}
+	if len(q) == 0 {
+		return "/tasker/gatehouse"
+	}
+	return "/tasker/gatehouse?" + q.Encode()
+}
@@ -0,0 +1,28 @@
+package bookings
+
+import (
+	"receipter/infrastructure/booking"
+	"receipter/models"
+)
+
+type PageData struct {
+	// Date is the day shown; PrevDate and NextDate step through days.
+	Date     string
+	PrevDate string
+	NextDate string
+	IsToday  bool
+	Slots    []booking.Slot
+	// Projects are the active projects a booking can be made for.
+	Projects     []models.Project
+	Status       string
+	ErrorMessage string
+}
+
+type GatehousePageData struct {
+	Date         string
+	Bookings     []booking.Booking
+	Expected     int
+	Arrived      int
+	Status       string
+	ErrorMessage string
+}
@@ -0,0 +1,172 @@
+package embed
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/infrastructure/embedwidget"
+	"receipter/infrastructure/sqlite"
+)
+
+// SummaryWidgetQueryHandler renders the receiving summary for a widget token
+// as a small HTML page meant to sit in a client's iframe.
+func SummaryWidgetQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		summary, ok := loadWidgetSummary(w, r, db)
+		if !ok {
+			return
+		}
+		if !writeCacheHeaders(w, r, summary, "html") {
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := SummaryWidget(summary).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render widget", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// SummaryJSONQueryHandler serves the same summary as JSON for clients that
+// build their own widget.
+func SummaryJSONQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		summary, ok := loadWidgetSummary(w, r, db)
+		if !ok {
+			return
+		}
+		if !writeCacheHeaders(w, r, summary, "json") {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		_ = json.NewEncoder(w).Encode(summary)
+	}
+}
+
+// BoardQueryHandler renders the full-screen warehouse display board for a
+// widget token. The page reloads itself every embedwidget.BoardPollInterval.
+func BoardQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		board, ok := loadWidgetBoard(w, r, db)
+		if !ok {
+			return
+		}
+		if !writeBoardCacheHeaders(w, r, board, "board-html") {
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := DisplayBoard(board).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render board", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// BoardJSONQueryHandler serves the display board as JSON for boards that
+// poll and draw themselves.
+func BoardJSONQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		board, ok := loadWidgetBoard(w, r, db)
+		if !ok {
+			return
+		}
+		if !writeBoardCacheHeaders(w, r, board, "board-json") {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		_ = json.NewEncoder(w).Encode(board)
+	}
+}
+
+func authenticateWidget(w http.ResponseWriter, r *http.Request, db *sqlite.DB) (string, []int64, bool) {
+	token, projectIDs, err := embedwidget.Authenticate(r.Context(), db, chi.URLParam(r, "token"))
+	if err != nil {
+		if !errors.Is(err, embedwidget.ErrInvalidToken) {
+			slog.Error("embed widget authentication failed", slog.Any("err", err))
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		http.Error(w, "widget not found", http.StatusNotFound)
+		return "", nil, false
+	}
+	return token.Name, projectIDs, true
+}
+
+func loadWidgetBoard(w http.ResponseWriter, r *http.Request, db *sqlite.DB) (embedwidget.Board, bool) {
+	name, projectIDs, ok := authenticateWidget(w, r, db)
+	if !ok {
+		return embedwidget.Board{}, false
+	}
+	board, err := embedwidget.LoadBoard(r.Context(), db, name, projectIDs, time.Now())
+	if err != nil {
+		w.Header().Set("Cache-Control", "no-store")
+		http.Error(w, "failed to load board", http.StatusInternalServerError)
+		return embedwidget.Board{}, false
+	}
+	return board, true
+}
+
+func loadWidgetSummary(w http.ResponseWriter, r *http.Request, db *sqlite.DB) (embedwidget.Summary, bool) {
+	name, projectIDs, ok := authenticateWidget(w, r, db)
+	if !ok {
+		return embedwidget.Summary{}, false
+	}
+	summary, err := embedwidget.LoadSummary(r.Context(), db, name, projectIDs)
+	if err != nil {
+		w.Header().Set("Cache-Control", "no-store")
+		http.Error(w, "failed to load widget summary", http.StatusInternalServerError)
+		return embedwidget.Summary{}, false
+	}
+	return summary, true
+}
+
+// writeCacheHeaders lets the widget be framed from any site and cached for
+// embedwidget.CacheMaxAge. It answers 304 and reports false when the
+// caller's copy is still current.
+func writeCacheHeaders(w http.ResponseWriter, r *http.Request, summary embedwidget.Summary, variant string) bool {
+	w.Header().Del("X-Frame-Options")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors *")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(embedwidget.CacheMaxAge.Seconds())))
+
+	// The ETag covers the figures only, not GeneratedAt, so an unchanged
+	// summary revalidates instead of downloading again.
+	return writeETag(w, r, variant, struct {
+		Projects []embedwidget.ProjectSummary
+		Totals   embedwidget.Totals
+	}{summary.Projects, summary.Totals})
+}
+
+// writeBoardCacheHeaders makes every board poll revalidate, so the floor
+// sees a change on the next poll while an unchanged board costs a 304.
+func writeBoardCacheHeaders(w http.ResponseWriter, r *http.Request, board embedwidget.Board, variant string) bool {
+	w.Header().Del("X-Frame-Options")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors *")
+	w.Header().Set("Cache-Control", "no-cache")
+	return writeETag(w, r, variant, struct {
+		Projects    []embedwidget.BoardProject
+		OpenPallets []embedwidget.BoardPallet
+	}{board.Projects, board.OpenPallets})
+}
+
+// writeETag sets an ETag over figures and answers 304, reporting false, when
+// it matches the caller's copy.
+func writeETag(w http.ResponseWriter, r *http.Request, variant string, figures any) bool {
+	payload, _ := json.Marshal(figures)
+	sum := sha256.Sum256(payload)
+	etag := `"` + variant + "-" + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+package exports
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/infrastructure/exportrun"
+	"receipter/infrastructure/sqlite"
+)
+
+func ExportRunsPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		records, err := exportrun.List(r.Context(), db, 200)
+		if err != nil {
+			http.Error(w, "failed to load export history", http.StatusInternalServerError)
+			return
+		}
+		data := ExportRunsPageData{Runs: make([]ExportRunView, 0, len(records))}
+		for _, record := range records {
+			data.Runs = append(data.Runs, exportRunView(record))
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := ExportRunsPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render export history page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func ExportRunDetailPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		record, ok := loadExportRunFromRequest(w, r, db)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := ExportRunDetailPage(ExportRunDetailPageData{Run: exportRunView(record)}).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render export run page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func ExportRunDownloadHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		record, ok := loadExportRunFromRequest(w, r, db)
+		if !ok {
+			return
+		}
+		if record.FileRef == "" {
+			http.Error(w, "no file was retained for this export", http.StatusNotFound)
+			return
+		}
+		info, err := os.Stat(record.FileRef)
+		if err != nil || info.IsDir() {
+			http.Error(w, "export file is no longer retained", http.StatusGone)
+			return
+		}
+		w.Header().Set("Content-Disposition", "attachment; filename="+filepath.Base(record.FileRef))
+		http.ServeFile(w, r, record.FileRef)
+	}
+}
+
+func loadExportRunFromRequest(w http.ResponseWriter, r *http.Request, db *sqlite.DB) (exportrun.Record, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid export run id", http.StatusBadRequest)
+		return exportrun.Record{}, false
+	}
+	record, err := exportrun.Load(r.Context(), db, id)
+	if err != nil {
+		if errors.Is(err, exportrun.ErrRunNotFound) {
+			http.Error(w, "export run not found", http.StatusNotFound)
+			return exportrun.Record{}, false
+		}
+		http.Error(w, "failed to load export run", http.StatusInternalServerError)
+		return exportrun.Record{}, false
+	}
+	return record, true
+}
+
+func exportRunView(record exportrun.Record) ExportRunView {
+	view := ExportRunView{
+		ID:          record.ID,
+		CreatedAt:   record.CreatedAt,
+		Username:    record.Username,
+		ExportType:  record.ExportType,
+		Params:      make([]ExportRunParam, 0),
+		RowCount:    record.RowCount,
+		Duration:    (time.Duration(record.DurationMS) * time.Millisecond).String(),
+		HasFile:     record.FileRef != "",
+		Destination: record.Destination,
+	}
+	if view.Username == "" {
+		view.Username = "-"
+	}
+	if record.ProjectID == nil {
+		view.Project = "All assigned projects"
+	} else {
+		view.Project = fmt.Sprintf("%s (#%d)", record.ProjectName, *record.ProjectID)
+	}
+	view.RerunURL, view.CanRerun = exportrun.RerunURL(record)
+
+	params, err := url.ParseQuery(record.Params)
+	if err == nil {
+		names := make([]string, 0, len(params))
+		for name := range params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, value := range params[name] {
+				view.Params = append(view.Params, ExportRunParam{Name: name, Value: value})
+			}
+		}
+	}
+	return view
+}
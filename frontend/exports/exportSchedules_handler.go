@@ -0,0 +1,181 @@
+package exports
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/exportschedule"
+	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/sqlite"
+)
+
+const schedulesPath = "/tasker/exports/schedules"
+
+var (
+	errInvalidScheduleForm     = errors.New("invalid form data")
+	errScheduleProjectRequired = errors.New("choose a project")
+	errScheduleProjectNotFound = errors.New("selected project not found")
+)
+
+// ExportSchedulesPageQueryHandler lists the scheduled exports and whether
+// Google Sheets delivery is configured.
+func ExportSchedulesPageQueryHandler(db *sqlite.DB, runner *exportschedule.Runner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schedules, err := exportschedule.List(r.Context(), db)
+		if err != nil {
+			http.Error(w, "failed to load export schedules", http.StatusInternalServerError)
+			return
+		}
+		projects, err := projectinfra.List(r.Context(), db, "active")
+		if err != nil {
+			http.Error(w, "failed to load projects", http.StatusInternalServerError)
+			return
+		}
+		options := make([]ProjectOption, 0, len(projects))
+		for _, p := range projects {
+			options = append(options, ProjectOption{
+				ID:    p.ID,
+				Label: fmt.Sprintf("%s (%s)", p.Name, p.ClientName),
+			})
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := ExportSchedulesPage(ExportSchedulesPageData{
+			Schedules:     schedules,
+			Projects:      options,
+			Intervals:     exportschedule.Intervals,
+			SheetsAccount: runner.Account(),
+			Status:        r.URL.Query().Get("status"),
+			ErrorMessage:  r.URL.Query().Get("error"),
+		}).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render export schedules page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func CreateExportScheduleCommandHandler(db *sqlite.DB, auditSvc *audit.Service, runner *exportschedule.Runner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			redirectScheduleError(w, r, errInvalidScheduleForm)
+			return
+		}
+		projectID, err := strconv.ParseInt(r.FormValue("project_id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			redirectScheduleError(w, r, errScheduleProjectRequired)
+			return
+		}
+		if _, err := projectinfra.LoadByID(r.Context(), db, projectID); err != nil {
+			redirectScheduleError(w, r, errScheduleProjectNotFound)
+			return
+		}
+		intervalHours, _ := strconv.Atoi(r.FormValue("interval_hours"))
+		in := exportschedule.Input{
+			Name:          r.FormValue("name"),
+			ProjectID:     projectID,
+			ExportType:    r.FormValue("export_type"),
+			SpreadsheetID: r.FormValue("spreadsheet"),
+			SheetTab:      r.FormValue("sheet_tab"),
+			WriteMode:     r.FormValue("write_mode"),
+			IntervalHours: intervalHours,
+		}
+		if _, err := exportschedule.Create(r.Context(), db, auditSvc, session.UserID, in); err != nil {
+			redirectScheduleError(w, r, err)
+			return
+		}
+		runner.Notify()
+		http.Redirect(w, r, schedulesPath+"?status="+url.QueryEscape("Export schedule created"), http.StatusSeeOther)
+	}
+}
+
+func ToggleExportScheduleCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		id, ok := scheduleIDFromRequest(w, r)
+		if !ok {
+			return
+		}
+		active := r.FormValue("active") == "1"
+		if err := exportschedule.SetActive(r.Context(), db, auditSvc, session.UserID, id, active); err != nil {
+			redirectScheduleError(w, r, err)
+			return
+		}
+		status := "Export schedule paused"
+		if active {
+			status = "Export schedule resumed"
+		}
+		http.Redirect(w, r, schedulesPath+"?status="+url.QueryEscape(status), http.StatusSeeOther)
+	}
+}
+
+func RunExportScheduleCommandHandler(db *sqlite.DB, runner *exportschedule.Runner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := scheduleIDFromRequest(w, r)
+		if !ok {
+			return
+		}
+		if err := exportschedule.RunNow(r.Context(), db, id); err != nil {
+			redirectScheduleError(w, r, err)
+			return
+		}
+		runner.Notify()
+		http.Redirect(w, r, schedulesPath+"?status="+url.QueryEscape("Export queued; refresh to see the result"), http.StatusSeeOther)
+	}
+}
+
+func DeleteExportScheduleCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		id, ok := scheduleIDFromRequest(w, r)
+		if !ok {
+			return
+		}
+		if err := exportschedule.Delete(r.Context(), db, auditSvc, session.UserID, id); err != nil {
+			redirectScheduleError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, schedulesPath+"?status="+url.QueryEscape("Export schedule deleted"), http.StatusSeeOther)
+	}
+}
+
+func scheduleIDFromRequest(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid export schedule id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func redirectScheduleError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errInvalidScheduleForm), errors.Is(err, errScheduleProjectRequired), errors.Is(err, errScheduleProjectNotFound),
+		errors.Is(err, exportschedule.ErrNameRequired), errors.Is(err, exportschedule.ErrNameTooLong),
+		errors.Is(err, exportschedule.ErrInvalidType), errors.Is(err, exportschedule.ErrInvalidMode),
+		errors.Is(err, exportschedule.ErrInvalidInterval), errors.Is(err, exportschedule.ErrSpreadsheetRequired),
+		errors.Is(err, exportschedule.ErrTabRequired), errors.Is(err, exportschedule.ErrNotFound):
+		http.Redirect(w, r, schedulesPath+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+	default:
+		http.Error(w, "failed to save export schedule", http.StatusInternalServerError)
+	}
+}
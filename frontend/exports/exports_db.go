@@ -5,42 +5,48 @@ import (
 	"encoding/csv"
 	"io"
 	"strconv"
+	"time"
 
 	"github.com/uptrace/bun"
 
+	"receipter/infrastructure/customfield"
+	"receipter/infrastructure/exportformat"
 	"receipter/infrastructure/sqlite"
 )
 
-func writeReceiptCSV(ctx context.Context, db *sqlite.DB, w io.Writer, projectID int64, palletID *int64) error {
-	writer := csv.NewWriter(w)
-	defer writer.Flush()
-
-	header := []string{"pallet_id", "sku", "description", "uom", "qty", "case_size", "item_barcode", "carton_barcode", "expiry", "batch_number"}
-	if err := writer.Write(header); err != nil {
-		return err
-	}
+func writeReceiptCSV(ctx context.Context, db *sqlite.DB, w io.Writer, projectID int64, palletID *int64, version int) (int64, error) {
+	return writeReceiptCSVSince(ctx, db, w, projectID, palletID, nil, 0, version)
+}
 
+// writeReceiptCSVSince writes the receipt export, limited to lines captured
+// after since when it is set and to the pallets of phaseID when it is not 0.
+func writeReceiptCSVSince(ctx context.Context, db *sqlite.DB, w io.Writer, projectID int64, palletID *int64, since *time.Time, phaseID int64, version int) (int64, error) {
 	type row struct {
-		PalletID      int64  `bun:"pallet_id"`
-		SKU           string `bun:"sku"`
-		Description   string `bun:"description"`
-		UOM           string `bun:"uom"`
-		Qty           int64  `bun:"qty"`
-		CaseSize      int64  `bun:"case_size"`
-		ItemBarcode   string `bun:"item_barcode"`
-		CartonBarcode string `bun:"carton_barcode"`
-		Expiry        string `bun:"expiry"`
-		BatchNumber   string `bun:"batch_number"`
+		ID              int64  `bun:"id"`
+		PalletID        int64  `bun:"pallet_id"`
+		SKU             string `bun:"sku"`
+		Description     string `bun:"description"`
+		UOM             string `bun:"uom"`
+		Qty             int64  `bun:"qty"`
+		CaseSize        int64  `bun:"case_size"`
+		ItemBarcode     string `bun:"item_barcode"`
+		CartonBarcode   string `bun:"carton_barcode"`
+		Expiry          string `bun:"expiry"`
+		BatchNumber     string `bun:"batch_number"`
+		CheckFailed     bool   `bun:"barcode_check_failed"`
+		CountryOfOrigin string `bun:"country_of_origin"`
+		HSCode          string `bun:"hs_code"`
 	}
 
 	rows := make([]row, 0)
 	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
 		q := `
-	SELECT pr.pallet_id, pr.sku, pr.description, COALESCE(pr.uom, '') AS uom, pr.qty, pr.case_size,
+	SELECT pr.id, pr.pallet_id, pr.sku, pr.description, COALESCE(pr.uom, '') AS uom, pr.qty, pr.case_size,
 	       COALESCE(pr.item_barcode, '') AS item_barcode,
 	       COALESCE(pr.carton_barcode, '') AS carton_barcode,
 	       COALESCE(strftime('%d/%m/%Y', pr.expiry_date), '') AS expiry,
-	       COALESCE(pr.batch_number, '') AS batch_number
+	       COALESCE(pr.batch_number, '') AS batch_number,
+	       pr.barcode_check_failed, pr.country_of_origin, pr.hs_code
 FROM pallet_receipts pr`
 		args := make([]any, 0)
 		q += " WHERE pr.project_id = ?"
@@ -49,15 +55,34 @@ FROM pallet_receipts pr`
 			q += " AND pr.pallet_id = ?"
 			args = append(args, *palletID)
 		}
+		if since != nil {
+			q += " AND julianday(pr.created_at) > julianday(?)"
+			args = append(args, since.UTC())
+		}
+		if phaseID > 0 {
+			q += " AND pr.pallet_id IN (SELECT pallet_id FROM pallet_phases WHERE phase_id = ?)"
+			args = append(args, phaseID)
+		}
 		q += " ORDER BY pr.pallet_id ASC, pr.sku ASC"
 		return tx.NewRaw(q, args...).Scan(ctx, &rows)
 	})
 	if err != nil {
-		return err
+		return 0, err
+	}
+	var custom customfield.ExportSet
+	if exportformat.Receipts.IncludesCustomFields(version) {
+		if custom, err = customfield.LoadExport(ctx, db, projectID); err != nil {
+			return 0, err
+		}
 	}
 
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+	if err := writer.Write(append(exportformat.Receipts.Header(version), custom.Header()...)); err != nil {
+		return 0, err
+	}
 	for _, r := range rows {
-		record := []string{
+		record := exportformat.Receipts.Record(version, []string{
 			toString(r.PalletID),
 			r.SKU,
 			r.Description,
@@ -68,19 +93,24 @@ FROM pallet_receipts pr`
 			r.CartonBarcode,
 			r.Expiry,
 			r.BatchNumber,
-		}
-		if err := writer.Write(record); err != nil {
-			return err
+			yesNo(r.CheckFailed),
+			r.CountryOfOrigin,
+			r.HSCode,
+		})
+		if err := writer.Write(append(record, custom.Record(r.ID)...)); err != nil {
+			return 0, err
 		}
 	}
-	return writer.Error()
+	return int64(len(rows)), writer.Error()
 }
 
-func writePalletStatusCSV(ctx context.Context, db *sqlite.DB, w io.Writer, projectID int64) error {
+// writePalletStatusCSV writes the pallet status export, limited to the
+// pallets of phaseID when it is not 0.
+func writePalletStatusCSV(ctx context.Context, db *sqlite.DB, w io.Writer, projectID, phaseID int64, version int) (int64, error) {
 	writer := csv.NewWriter(w)
 	defer writer.Flush()
-	if err := writer.Write([]string{"pallet_id", "status", "line_count", "created_at", "closed_at", "reopened_at"}); err != nil {
-		return err
+	if err := writer.Write(exportformat.PalletStatus.Header(version)); err != nil {
+		return 0, err
 	}
 
 	type row struct {
@@ -94,41 +124,33 @@ func writePalletStatusCSV(ctx context.Context, db *sqlite.DB, w io.Writer, proje
 
 	rows := make([]row, 0)
 	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
-		return tx.NewRaw(`
+		q := `
 SELECT p.id, p.status,
        (SELECT COUNT(*) FROM pallet_receipts pr WHERE pr.pallet_id = p.id) AS line_count,
        strftime('%d/%m/%Y %H:%M', p.created_at) AS created_at,
        COALESCE(strftime('%d/%m/%Y %H:%M', p.closed_at), '') AS closed_at,
        COALESCE(strftime('%d/%m/%Y %H:%M', p.reopened_at), '') AS reopened_at
 FROM pallets p
-WHERE p.project_id = ?
-ORDER BY p.id ASC`, projectID).Scan(ctx, &rows)
+WHERE p.project_id = ?`
+		args := []any{projectID}
+		if phaseID > 0 {
+			q += " AND p.id IN (SELECT pallet_id FROM pallet_phases WHERE phase_id = ?)"
+			args = append(args, phaseID)
+		}
+		q += " ORDER BY p.id ASC"
+		return tx.NewRaw(q, args...).Scan(ctx, &rows)
 	})
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	for _, r := range rows {
-		if err := writer.Write([]string{toString(r.ID), r.Status, toString(r.LineCount), r.CreatedAt, r.ClosedAt, r.ReopenedAt}); err != nil {
-			return err
+		record := exportformat.PalletStatus.Record(version, []string{toString(r.ID), r.Status, toString(r.LineCount), r.CreatedAt, r.ClosedAt, r.ReopenedAt})
+		if err := writer.Write(record); err != nil {
+			return 0, err
 		}
 	}
-	return writer.Error()
-}
-
-func recordExportRun(ctx context.Context, db *sqlite.DB, userID *int64, projectID *int64, exportType string) error {
-	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
-		var uid any = nil
-		var pid any = nil
-		if userID != nil {
-			uid = *userID
-		}
-		if projectID != nil {
-			pid = *projectID
-		}
-		_, err := tx.ExecContext(ctx, `INSERT INTO export_runs (user_id, project_id, export_type, created_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)`, uid, pid, exportType)
-		return err
-	})
+	return int64(len(rows)), writer.Error()
 }
 
 func palletBelongsToProject(ctx context.Context, db *sqlite.DB, projectID, palletID int64) (bool, error) {
@@ -145,3 +167,88 @@ func palletBelongsToProject(ctx context.Context, db *sqlite.DB, projectID, palle
 func exportTypePallet(palletID int64) string {
 	return "pallet_csv:" + strconv.FormatInt(palletID, 10)
 }
+
+// CapturesScope selects the lines of one user's captures export: lines
+// they scanned on the project, on PalletID and/or on Day (YYYY-MM-DD, UTC)
+// when set.
+type CapturesScope struct {
+	ProjectID int64
+	UserID    int64
+	Username  string
+	PalletID  *int64
+	Day       string
+}
+
+func writeMyCapturesCSV(ctx context.Context, db *sqlite.DB, w io.Writer, scope CapturesScope, exportedAt time.Time, version int) (int64, error) {
+	type row struct {
+		ID          int64  `bun:"id"`
+		PalletID    int64  `bun:"pallet_id"`
+		ScannedAt   string `bun:"scanned_at"`
+		SKU         string `bun:"sku"`
+		Description string `bun:"description"`
+		UOM         string `bun:"uom"`
+		Qty         int64  `bun:"qty"`
+		CaseSize    int64  `bun:"case_size"`
+		UnknownSKU  bool   `bun:"unknown_sku"`
+		Damaged     bool   `bun:"damaged"`
+		DamagedQty  int64  `bun:"damaged_qty"`
+		BatchNumber string `bun:"batch_number"`
+		Expiry      string `bun:"expiry"`
+	}
+
+	rows := make([]row, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		q := `
+SELECT pr.id, pr.pallet_id, strftime('%d/%m/%Y %H:%M', pr.created_at) AS scanned_at,
+       pr.sku, pr.description, COALESCE(pr.uom, '') AS uom, pr.qty, pr.case_size,
+       pr.unknown_sku, pr.damaged, pr.damaged_qty,
+       COALESCE(pr.batch_number, '') AS batch_number,
+       COALESCE(strftime('%d/%m/%Y', pr.expiry_date), '') AS expiry
+FROM pallet_receipts pr
+WHERE pr.project_id = ? AND pr.scanned_by_user_id = ?`
+		args := []any{scope.ProjectID, scope.UserID}
+		if scope.PalletID != nil {
+			q += " AND pr.pallet_id = ?"
+			args = append(args, *scope.PalletID)
+		}
+		if scope.Day != "" {
+			q += " AND date(pr.created_at) = ?"
+			args = append(args, scope.Day)
+		}
+		q += " ORDER BY pr.created_at ASC, pr.id ASC"
+		return tx.NewRaw(q, args...).Scan(ctx, &rows)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+	if err := writer.Write(exportformat.MyCaptures.Header(version)); err != nil {
+		return 0, err
+	}
+	stamp := exportedAt.UTC().Format("02/01/2006 15:04")
+	for _, r := range rows {
+		record := exportformat.MyCaptures.Record(version, []string{
+			toString(r.PalletID),
+			toString(r.ID),
+			r.ScannedAt,
+			r.SKU,
+			r.Description,
+			r.UOM,
+			toString(r.Qty),
+			toString(r.CaseSize),
+			yesNo(r.UnknownSKU),
+			yesNo(r.Damaged),
+			toString(r.DamagedQty),
+			r.BatchNumber,
+			r.Expiry,
+			scope.Username,
+			stamp,
+		})
+		if err := writer.Write(record); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(rows)), writer.Error()
+}
@@ -1,7 +1,242 @@
 package exports
 
-import "testing"
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
 
-func TestPlaceholder(t *testing.T) {
-	// Placeholder test file to establish slice testing pattern.
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/coldstorage"
+	"receipter/infrastructure/exportformat"
+	"receipter/infrastructure/exportjob"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite export golden files in testdata")
+
+func openExportsTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "exports-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "..", "infrastructure", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	return db
+}
+
+// seedExportContractData uses fixed timestamps and values that need CSV
+// quoting so the golden files pin both columns and encoding.
+func seedExportContractData(t *testing.T, db *sqlite.DB) {
+	t.Helper()
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO projects (id, name, description, project_date, client_name, code, status, created_at, updated_at)
+VALUES (1, 'Export Contract', 'golden files', '2026-01-05', 'Client A', 'export-contract', 'active', '2026-01-05 08:00:00', '2026-01-05 08:00:00')`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO users (id, username, password_hash, role, created_at, updated_at) VALUES (1, 'scanner1', 'hash', 'scanner', '2026-01-05 08:00:00', '2026-01-05 08:00:00')`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO pallets (id, project_id, status, created_at, closed_at, reopened_at) VALUES
+    (1, 1, 'closed', '2026-01-05 09:15:00', '2026-01-05 11:30:00', NULL),
+    (2, 1, 'open', '2026-01-06 07:45:00', '2026-01-06 08:00:00', '2026-01-06 08:20:00')`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO pallet_receipts (
+    id, project_id, pallet_id, sku, description, uom, scanned_by_user_id, qty, case_size,
+    batch_number, expiry_date, carton_barcode, item_barcode, created_at, updated_at
+) VALUES
+    (10, 1, 1, 'SKU-B', 'Widget, large "XL"', 'case', 1, 4, 12, 'B-7', '2027-03-31', '15012345678907', '5012345678900', '2026-01-05 10:00:00', '2026-01-05 10:00:00'),
+    (11, 1, 1, 'SKU-A', 'Plain item', 'unit', 1, 10, 1, NULL, NULL, NULL, NULL, '2026-01-05 10:05:00', '2026-01-05 10:05:00'),
+    (12, 1, 2, 'SKU-C', 'Multi
+line', '', 1, 1, 1, 'C1', '2026-12-01', NULL, '0000000000017', '2026-01-06 08:10:00', '2026-01-06 08:10:00')`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO project_custom_fields (id, project_id, key, label, field_type, required, sort_order, active) VALUES
+    (1, 1, 'po_line', 'PO line', 'number', 0, 20, 1),
+    (2, 1, 'country_of_origin', 'Country of origin', 'text', 1, 10, 1)`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO receipt_custom_values (pallet_receipt_id, field_id, value) VALUES
+    (10, 1, '40'),
+    (10, 2, 'Viet Nam, North'),
+    (12, 2, 'UK')`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE pallet_receipts SET barcode_check_failed = 1 WHERE id = 12`); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE pallet_receipts SET country_of_origin = 'VN', hs_code = '8471300000' WHERE id = 10`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed export data: %v", err)
+	}
+}
+
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatalf("create testdata: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("write golden %s: %v", name, err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden %s (run go test -update to create it): %v", name, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s no longer matches its published format; add a new format version instead of changing it.\n--- got ---\n%s\n--- want ---\n%s", name, got, want)
+	}
+}
+
+// Every published version of every export must keep producing exactly its
+// golden file.
+func TestExportFormats_MatchGoldenFiles(t *testing.T) {
+	db := openExportsTestDB(t)
+	seedExportContractData(t, db)
+	palletID := int64(1)
+
+	exports := []struct {
+		format exportformat.Format
+		golden string
+		write  func(buf *bytes.Buffer, version int) (int64, error)
+	}{
+		{exportformat.Receipts, "receipts", func(buf *bytes.Buffer, version int) (int64, error) {
+			return writeReceiptCSV(context.Background(), db, buf, 1, nil, version)
+		}},
+		{exportformat.Receipts, "pallet", func(buf *bytes.Buffer, version int) (int64, error) {
+			return writeReceiptCSV(context.Background(), db, buf, 1, &palletID, version)
+		}},
+		{exportformat.PalletStatus, "pallet_status", func(buf *bytes.Buffer, version int) (int64, error) {
+			return writePalletStatusCSV(context.Background(), db, buf, 1, 0, version)
+		}},
+		{exportformat.MyCaptures, "my_captures", func(buf *bytes.Buffer, version int) (int64, error) {
+			scope := CapturesScope{ProjectID: 1, UserID: 1, Username: "scanner1", Day: "2026-01-05"}
+			return writeMyCapturesCSV(context.Background(), db, buf, scope, time.Date(2026, 1, 7, 9, 30, 0, 0, time.UTC), version)
+		}},
+	}
+	for _, export := range exports {
+		for version := 1; version <= export.format.Latest; version++ {
+			name := fmt.Sprintf("%s_v%d.csv", export.golden, version)
+			t.Run(name, func(t *testing.T) {
+				var buf bytes.Buffer
+				if _, err := export.write(&buf, version); err != nil {
+					t.Fatalf("write export: %v", err)
+				}
+				assertGolden(t, name, buf.Bytes())
+			})
+		}
+	}
+}
+
+func TestBuildProjectBundle_FilesCSVsAndArchivedPhotosByPalletAndLine(t *testing.T) {
+	db := openExportsTestDB(t)
+	seedExportContractData(t, db)
+	ctx := context.Background()
+
+	primary := []byte{0x89, 0x50, 0x4e, 0x47}
+	gallery := []byte{0xff, 0xd8, 0xff}
+	if _, err := db.W.ExecContext(ctx, `UPDATE pallet_receipts SET stock_photo_blob = ?, stock_photo_mime = 'image/png', stock_photo_name = 'p.png' WHERE id = 10`, primary); err != nil {
+		t.Fatalf("seed stock photo: %v", err)
+	}
+	if _, err := db.W.ExecContext(ctx, `INSERT INTO receipt_photos (id, pallet_receipt_id, photo_blob, photo_mime, photo_name) VALUES (5, 12, ?, 'image/jpeg', 'g.jpg')`, gallery); err != nil {
+		t.Fatalf("seed gallery photo: %v", err)
+	}
+	// A closed project's photos may already be in cold storage.
+	if _, err := db.W.ExecContext(ctx, `UPDATE projects SET status = 'inactive' WHERE id = 1`); err != nil {
+		t.Fatalf("deactivate project: %v", err)
+	}
+	store := coldstorage.NewStore(db, nil)
+	store.Dir = t.TempDir()
+	if result, err := store.Archive(ctx, 1, 1); err != nil || result.Photos != 2 {
+		t.Fatalf("archive photos = %+v, %v", result, err)
+	}
+
+	// Internal photos never reach the client's handover bundle.
+	if _, err := db.W.ExecContext(ctx, `INSERT INTO receipt_photos (id, pallet_receipt_id, photo_blob, photo_mime, photo_name) VALUES (6, 12, X'FFD8FF00', 'image/jpeg', 'internal.jpg')`); err != nil {
+		t.Fatalf("seed internal photo: %v", err)
+	}
+	if _, err := db.W.ExecContext(ctx, `INSERT INTO internal_photos (source, photo_id, pallet_receipt_id, marked_at) VALUES ('receipt_photos', 6, 12, CURRENT_TIMESTAMP)`); err != nil {
+		t.Fatalf("mark photo internal: %v", err)
+	}
+
+	result, err := BuildProjectBundle(ctx, db, models.ExportJob{Kind: exportjob.KindProjectBundle, ProjectID: 1})
+	if err != nil {
+		t.Fatalf("build project bundle: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Remove(result.Path) })
+	if result.RowCount != 3 {
+		t.Fatalf("expected 3 receipt rows, got %d", result.RowCount)
+	}
+	if result.Path == "" || result.Data != nil {
+		t.Fatalf("expected bundle written to a temporary file, got %+v", result)
+	}
+	zr, err := zip.OpenReader(result.Path)
+	if err != nil {
+		t.Fatalf("open bundle: %v", err)
+	}
+	defer zr.Close()
+	files := make(map[string][]byte, len(zr.File))
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+		files[f.Name] = data
+	}
+	for _, name := range []string{"receipts.csv", "pallet-status.csv", "pallets/P00000001.csv", "pallets/P00000002.csv", "sku-summary.csv", "sku-detail.csv", "photos/manifest.csv"} {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("expected %s in bundle, got %v", name, zr.File)
+		}
+	}
+	if !bytes.Equal(files["photos/P00000001/line-10/primary.png"], primary) {
+		t.Fatalf("expected archived stock photo filed under its pallet and line")
+	}
+	if !bytes.Equal(files["photos/P00000002/line-12/photo-5.jpg"], gallery) {
+		t.Fatalf("expected archived gallery photo filed under its pallet and line")
+	}
+	if bytes.Contains(files["pallets/P00000001.csv"], []byte("SKU-C")) {
+		t.Fatalf("expected pallet CSV to hold only its own lines:\n%s", files["pallets/P00000001.csv"])
+	}
+	if _, ok := files["photos/P00000002/line-12/photo-6.jpg"]; ok {
+		t.Fatalf("expected internal photo left out of the bundle")
+	}
+	if lines := bytes.Count(files["photos/manifest.csv"], []byte("\n")); lines != 3 {
+		t.Fatalf("expected manifest header and 2 photos, got %d lines", lines)
+	}
 }
@@ -1,16 +1,22 @@
 package exports
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
 	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/exportformat"
+	"receipter/infrastructure/exportjob"
+	"receipter/infrastructure/exportrun"
+	"receipter/infrastructure/phase"
 	projectinfra "receipter/infrastructure/project"
 	"receipter/infrastructure/sqlite"
 )
@@ -36,6 +42,16 @@ func ExportsPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
 			http.Error(w, "failed to load projects", http.StatusInternalServerError)
 			return
 		}
+		bundles, err := exportjob.ListForProject(r.Context(), db, project.ID, exportjob.KindProjectBundle, 5)
+		if err != nil {
+			http.Error(w, "failed to load project bundles", http.StatusInternalServerError)
+			return
+		}
+		phases, err := phase.List(r.Context(), db, project.ID)
+		if err != nil {
+			http.Error(w, "failed to load project phases", http.StatusInternalServerError)
+			return
+		}
 		options := make([]ProjectOption, 0, len(projects))
 		for _, p := range projects {
 			options = append(options, ProjectOption{
@@ -49,9 +65,12 @@ func ExportsPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
 		if err := ExportsPage(PageData{
 			ProjectID:     project.ID,
 			ProjectName:   project.Name,
-			ClientName:    project.ClientName,
+			ClientName:    string(project.ClientName),
 			ProjectStatus: project.Status,
 			Projects:      options,
+			Bundles:       bundles,
+			Phases:        phases,
+			Status:        strings.TrimSpace(r.URL.Query().Get("status")),
 		}).Render(r.Context(), w); err != nil {
 			http.Error(w, "failed to render exports page", http.StatusInternalServerError)
 			return
@@ -84,13 +103,19 @@ func PalletExportCSVHandler(db *sqlite.DB) http.HandlerFunc {
 			http.Error(w, "pallet not found", http.StatusNotFound)
 			return
 		}
+		version, ok := requestedFormatVersion(w, r, exportformat.Receipts)
+		if !ok {
+			return
+		}
+		startedAt := time.Now()
 		w.Header().Set("Content-Type", "text/csv")
 		w.Header().Set("Content-Disposition", "attachment; filename=pallet-"+strconv.FormatInt(id, 10)+".csv")
-		if err := writeReceiptCSV(r.Context(), db, w, projectID, &id); err != nil {
+		rowCount, err := writeReceiptCSV(r.Context(), db, w, projectID, &id, version)
+		if err != nil {
 			http.Error(w, "failed to export csv", http.StatusInternalServerError)
 			return
 		}
-		if err := recordExportRun(r.Context(), db, sessionUserIDFromContext(r), int64Ptr(projectID), exportTypePallet(id)); err != nil {
+		if err := recordExportRun(r, db, projectID, exportTypePallet(id), version, 0, rowCount, startedAt); err != nil {
 			slog.Error("record export run failed", slog.String("type", exportTypePallet(id)), slog.Any("err", err))
 		}
 	}
@@ -107,13 +132,23 @@ func ReceiptsExportCSVHandler(db *sqlite.DB) http.HandlerFunc {
 			http.Error(w, "no project selected", http.StatusForbidden)
 			return
 		}
+		phaseID, ok := requestedPhaseID(w, r, db, projectID)
+		if !ok {
+			return
+		}
+		version, ok := requestedFormatVersion(w, r, exportformat.Receipts)
+		if !ok {
+			return
+		}
+		startedAt := time.Now()
 		w.Header().Set("Content-Type", "text/csv")
 		w.Header().Set("Content-Disposition", "attachment; filename=receipts.csv")
-		if err := writeReceiptCSV(r.Context(), db, w, projectID, nil); err != nil {
+		rowCount, err := writeReceiptCSVSince(r.Context(), db, w, projectID, nil, nil, phaseID, version)
+		if err != nil {
 			http.Error(w, "failed to export csv", http.StatusInternalServerError)
 			return
 		}
-		if err := recordExportRun(r.Context(), db, sessionUserIDFromContext(r), int64Ptr(projectID), "receipts_csv"); err != nil {
+		if err := recordExportRun(r, db, projectID, "receipts_csv", version, phaseID, rowCount, startedAt); err != nil {
 			slog.Error("record export run failed", slog.String("type", "receipts_csv"), slog.Any("err", err))
 		}
 	}
@@ -130,18 +165,163 @@ func PalletStatusCSVHandler(db *sqlite.DB) http.HandlerFunc {
 			http.Error(w, "no project selected", http.StatusForbidden)
 			return
 		}
+		phaseID, ok := requestedPhaseID(w, r, db, projectID)
+		if !ok {
+			return
+		}
+		version, ok := requestedFormatVersion(w, r, exportformat.PalletStatus)
+		if !ok {
+			return
+		}
+		startedAt := time.Now()
 		w.Header().Set("Content-Type", "text/csv")
 		w.Header().Set("Content-Disposition", "attachment; filename=pallet-status.csv")
-		if err := writePalletStatusCSV(r.Context(), db, w, projectID); err != nil {
+		rowCount, err := writePalletStatusCSV(r.Context(), db, w, projectID, phaseID, version)
+		if err != nil {
 			http.Error(w, "failed to export status csv", http.StatusInternalServerError)
 			return
 		}
-		if err := recordExportRun(r.Context(), db, sessionUserIDFromContext(r), int64Ptr(projectID), "pallet_status_csv"); err != nil {
+		if err := recordExportRun(r, db, projectID, "pallet_status_csv", version, phaseID, rowCount, startedAt); err != nil {
 			slog.Error("record export run failed", slog.String("type", "pallet_status_csv"), slog.Any("err", err))
 		}
 	}
 }
 
+// MyCapturesCSVHandler lets a user download the lines they scanned
+// themselves on the active project, for one pallet (?pallet_id=) and/or one
+// day (?date=YYYY-MM-DD). Lines scanned by anyone else are never included.
+func MyCapturesCSVHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		projectID, ok := activeProjectIDFromContext(r)
+		if !ok {
+			http.Error(w, "no active project selected", http.StatusForbidden)
+			return
+		}
+		scope := CapturesScope{ProjectID: projectID, UserID: session.UserID, Username: session.User.Username}
+		query := r.URL.Query()
+		if raw := strings.TrimSpace(query.Get("pallet_id")); raw != "" {
+			palletID, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || palletID <= 0 {
+				http.Error(w, "invalid pallet id", http.StatusBadRequest)
+				return
+			}
+			belongs, err := palletBelongsToProject(r.Context(), db, projectID, palletID)
+			if err != nil {
+				http.Error(w, "failed to validate pallet project", http.StatusInternalServerError)
+				return
+			}
+			if !belongs {
+				http.Error(w, "pallet not found", http.StatusNotFound)
+				return
+			}
+			scope.PalletID = &palletID
+		}
+		if raw := strings.TrimSpace(query.Get("date")); raw != "" {
+			day, err := time.Parse("2006-01-02", raw)
+			if err != nil {
+				http.Error(w, "invalid date", http.StatusBadRequest)
+				return
+			}
+			scope.Day = day.Format("2006-01-02")
+		}
+		if scope.PalletID == nil && scope.Day == "" {
+			http.Error(w, "choose a pallet or a date", http.StatusBadRequest)
+			return
+		}
+		version, ok := requestedFormatVersion(w, r, exportformat.MyCaptures)
+		if !ok {
+			return
+		}
+
+		startedAt := time.Now()
+		fileName := "captures-" + scope.Username
+		params := url.Values{}
+		params.Set(exportformat.QueryParam, strconv.Itoa(version))
+		if scope.PalletID != nil {
+			fileName += "-pallet-" + toString(*scope.PalletID)
+			params.Set("pallet_id", toString(*scope.PalletID))
+		}
+		if scope.Day != "" {
+			fileName += "-" + scope.Day
+			params.Set("date", scope.Day)
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename="+fileName+".csv")
+		rowCount, err := writeMyCapturesCSV(r.Context(), db, w, scope, startedAt, version)
+		if err != nil {
+			http.Error(w, "failed to export csv", http.StatusInternalServerError)
+			return
+		}
+		if err := exportrun.Save(r.Context(), db, exportrun.Run{
+			UserID:     int64Ptr(session.UserID),
+			ProjectID:  int64Ptr(projectID),
+			ExportType: exportformat.MyCaptures.Name,
+			Params:     params,
+			RowCount:   rowCount,
+			Duration:   time.Since(startedAt),
+		}); err != nil {
+			slog.Error("record export run failed", slog.String("type", exportformat.MyCaptures.Name), slog.Any("err", err))
+		}
+	}
+}
+
+// requestedFormatVersion resolves ?format_version= and reports it in the
+// response header. It writes a 400 and returns false for unknown versions.
+func requestedFormatVersion(w http.ResponseWriter, r *http.Request, format exportformat.Format) (int, bool) {
+	version, err := format.ParseVersion(r.URL.Query().Get(exportformat.QueryParam))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: latest is %d", err.Error(), format.Latest), http.StatusBadRequest)
+		return 0, false
+	}
+	w.Header().Set(exportformat.ResponseHeader, strconv.Itoa(version))
+	return version, true
+}
+
+// requestedPhaseID resolves ?phase_id=, which limits an export to one phase
+// of the project, or returns 0 for every pallet. It writes the error and
+// returns false when the phase is not one of the project's.
+func requestedPhaseID(w http.ResponseWriter, r *http.Request, db *sqlite.DB, projectID int64) (int64, bool) {
+	raw := strings.TrimSpace(r.URL.Query().Get("phase_id"))
+	if raw == "" {
+		return 0, true
+	}
+	phaseID, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || phaseID <= 0 {
+		http.Error(w, "invalid phase id", http.StatusBadRequest)
+		return 0, false
+	}
+	if _, err := phase.Load(r.Context(), db, projectID, phaseID); err != nil {
+		if errors.Is(err, phase.ErrNotFound) {
+			http.Error(w, "phase not found", http.StatusNotFound)
+			return 0, false
+		}
+		http.Error(w, "failed to load phase", http.StatusInternalServerError)
+		return 0, false
+	}
+	return phaseID, true
+}
+
+func recordExportRun(r *http.Request, db *sqlite.DB, projectID int64, exportType string, version int, phaseID, rowCount int64, startedAt time.Time) error {
+	params := url.Values{}
+	params.Set(exportformat.QueryParam, strconv.Itoa(version))
+	if phaseID > 0 {
+		params.Set("phase_id", strconv.FormatInt(phaseID, 10))
+	}
+	return exportrun.Save(r.Context(), db, exportrun.Run{
+		UserID:     sessionUserIDFromContext(r),
+		ProjectID:  int64Ptr(projectID),
+		ExportType: exportType,
+		Params:     params,
+		RowCount:   rowCount,
+		Duration:   time.Since(startedAt),
+	})
+}
+
 func sessionUserIDFromContext(r *http.Request) *int64 {
 	session, ok := sessioncontext.GetSessionFromContext(r.Context())
 	if !ok || session.UserID <= 0 {
@@ -1,5 +1,11 @@
 package exports
 
+import (
+	"receipter/infrastructure/exportjob"
+	"receipter/infrastructure/exportschedule"
+	"receipter/infrastructure/phase"
+)
+
 type ProjectOption struct {
 	ID       int64
 	Label    string
@@ -12,4 +18,48 @@ type PageData struct {
 	ClientName    string
 	ProjectStatus string
 	Projects      []ProjectOption
+	// Bundles are the project's most recent handover bundle jobs.
+	Bundles []exportjob.View
+	// Phases are the project's receiving phases, each of which the receipt
+	// and pallet status CSVs can be limited to.
+	Phases []phase.Phase
+	Status string
+}
+
+type ExportRunParam struct {
+	Name  string
+	Value string
+}
+
+type ExportRunView struct {
+	ID         int64
+	CreatedAt  string
+	Username   string
+	Project    string
+	ExportType string
+	Params     []ExportRunParam
+	RowCount   int64
+	Duration   string
+	RerunURL   string
+	CanRerun   bool
+	HasFile    bool
+	// Destination is where a scheduled export was delivered.
+	Destination string
+}
+
+type ExportRunsPageData struct {
+	Runs []ExportRunView
+}
+
+type ExportRunDetailPageData struct {
+	Run ExportRunView
+}
+
+type ExportSchedulesPageData struct {
+	Schedules     []exportschedule.Schedule
+	Projects      []ProjectOption
+	Intervals     []int
+	SheetsAccount string
+	Status        string
+	ErrorMessage  string
 }
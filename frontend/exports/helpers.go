@@ -5,3 +5,10 @@ import "strconv"
 func toString(v int64) string {
 	return strconv.FormatInt(v, 10)
 }
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,200 @@
+package exports
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	palletlabels "receipter/frontend/pallets/labels"
+	"receipter/infrastructure/exportformat"
+	"receipter/infrastructure/exportjob"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+type bundlePhoto struct {
+	ReceiptID   int64  `bun:"receipt_id"`
+	PhotoID     int64  `bun:"photo_id"`
+	SKU         string `bun:"sku"`
+	BatchNumber string `bun:"batch_number"`
+	Expiry      string `bun:"expiry"`
+	MIME        string `bun:"mime"`
+	CapturedAt  string `bun:"captured_at"`
+	Blob        []byte `bun:"blob"`
+}
+
+// BuildPalletBundle is the export job builder for a pallet bundle: a ZIP
+// holding the lines CSV in the latest receipts format, the pallet's event
+// history, and every line photo with a manifest describing them.
+func BuildPalletBundle(ctx context.Context, db *sqlite.DB, job models.ExportJob) (exportjob.Result, error) {
+	var result exportjob.Result
+	if job.PalletID == nil {
+		return result, fmt.Errorf("pallet bundle job has no pallet")
+	}
+	palletID := *job.PalletID
+	belongs, err := palletBelongsToProject(ctx, db, job.ProjectID, palletID)
+	if err != nil {
+		return result, err
+	}
+	if !belongs {
+		return result, fmt.Errorf("pallet %d is not in project %d", palletID, job.ProjectID)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	lines, err := zw.Create("lines.csv")
+	if err != nil {
+		return result, err
+	}
+	rowCount, err := writeReceiptCSV(ctx, db, lines, job.ProjectID, &palletID, exportformat.Receipts.Latest)
+	if err != nil {
+		return result, err
+	}
+
+	events, err := palletlabels.LoadPalletEventLog(ctx, db, palletID)
+	if err != nil {
+		return result, err
+	}
+	eventsFile, err := zw.Create("events.csv")
+	if err != nil {
+		return result, err
+	}
+	ew := csv.NewWriter(eventsFile)
+	if err := ew.Write([]string{"timestamp", "user", "action", "details"}); err != nil {
+		return result, err
+	}
+	for _, e := range events {
+		if err := ew.Write([]string{e.TimestampUK, e.Actor, e.Action, e.Details}); err != nil {
+			return result, err
+		}
+	}
+	ew.Flush()
+	if err := ew.Error(); err != nil {
+		return result, err
+	}
+
+	if err := writeBundlePhotos(ctx, db, zw, palletID); err != nil {
+		return result, err
+	}
+	if err := zw.Close(); err != nil {
+		return result, err
+	}
+
+	result.FileName = fmt.Sprintf("pallet-%d-bundle-%s.zip", palletID, time.Now().Format("20060102-150405"))
+	result.Data = buf.Bytes()
+	result.RowCount = rowCount
+	return result, nil
+}
+
+// writeBundlePhotos adds each photo under photos/ and a manifest.csv listing
+// them against their receipt line. Photos are read one line at a time so a
+// large pallet does not hold every blob in memory twice.
+func writeBundlePhotos(ctx context.Context, db *sqlite.DB, zw *zip.Writer, palletID int64) error {
+	var receiptIDs []int64
+	if err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT id FROM pallet_receipts WHERE pallet_id = ? ORDER BY id`, palletID).Scan(ctx, &receiptIDs)
+	}); err != nil {
+		return err
+	}
+
+	manifest, err := zw.Create("photos/manifest.csv")
+	if err != nil {
+		return err
+	}
+	mw := csv.NewWriter(manifest)
+	if err := mw.Write([]string{"file", "receipt_line_id", "photo_id", "primary", "sku", "batch_number", "expiry", "mime_type", "size_bytes", "captured_at"}); err != nil {
+		return err
+	}
+	pending := make([]bundlePhoto, 0)
+	for _, receiptID := range receiptIDs {
+		photos := make([]bundlePhoto, 0)
+		err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+			return tx.NewRaw(`
+SELECT pr.id AS receipt_id, 0 AS photo_id, pr.sku, COALESCE(pr.batch_number, '') AS batch_number,
+       COALESCE(strftime('%d/%m/%Y', pr.expiry_date), '') AS expiry,
+       COALESCE(pr.stock_photo_mime, '') AS mime,
+       COALESCE(strftime('%d/%m/%Y %H:%M', pr.created_at), '') AS captured_at,
+       pr.stock_photo_blob AS blob
+FROM pallet_receipts pr
+WHERE pr.id = ? AND pr.stock_photo_blob IS NOT NULL AND length(pr.stock_photo_blob) > 0
+UNION ALL
+SELECT pr.id, rp.id, pr.sku, COALESCE(pr.batch_number, ''),
+       COALESCE(strftime('%d/%m/%Y', pr.expiry_date), ''),
+       COALESCE(rp.photo_mime, ''),
+       COALESCE(strftime('%d/%m/%Y %H:%M', rp.created_at), ''),
+       rp.photo_blob
+FROM receipt_photos rp
+JOIN pallet_receipts pr ON pr.id = rp.pallet_receipt_id
+WHERE pr.id = ?
+ORDER BY photo_id`, receiptID, receiptID).Scan(ctx, &photos)
+		})
+		if err != nil {
+			return err
+		}
+		for _, p := range photos {
+			if err := mw.Write([]string{
+				bundlePhotoName(p),
+				strconv.FormatInt(p.ReceiptID, 10),
+				strconv.FormatInt(p.PhotoID, 10),
+				strconv.FormatBool(p.PhotoID == 0),
+				p.SKU,
+				p.BatchNumber,
+				p.Expiry,
+				p.MIME,
+				strconv.Itoa(len(p.Blob)),
+				p.CapturedAt,
+			}); err != nil {
+				return err
+			}
+		}
+		pending = append(pending, photos...)
+	}
+	mw.Flush()
+	if err := mw.Error(); err != nil {
+		return err
+	}
+
+	// The zip writer closes each entry when the next is created, so the
+	// manifest is finished before any photo is written.
+	for _, p := range pending {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: bundlePhotoName(p), Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(p.Blob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func bundlePhotoName(p bundlePhoto) string {
+	if p.PhotoID == 0 {
+		return fmt.Sprintf("photos/line-%d-primary%s", p.ReceiptID, photoExtension(p.MIME))
+	}
+	return fmt.Sprintf("photos/line-%d-photo-%d%s", p.ReceiptID, p.PhotoID, photoExtension(p.MIME))
+}
+
+func photoExtension(mimeType string) string {
+	switch mimeType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	case "image/heic":
+		return ".heic"
+	default:
+		return ".bin"
+	}
+}
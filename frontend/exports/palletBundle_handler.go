@@ -0,0 +1,81 @@
+package exports
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/infrastructure/exportjob"
+	"receipter/infrastructure/sqlite"
+)
+
+// QueuePalletBundleCommandHandler queues a bundle export for the pallet and
+// returns to its content page, where the job's progress is listed.
+func QueuePalletBundleCommandHandler(db *sqlite.DB, jobs *exportjob.Worker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := requestedProjectID(r)
+		if err != nil {
+			http.Error(w, "invalid project id", http.StatusBadRequest)
+			return
+		}
+		if projectID <= 0 {
+			http.Error(w, "no project selected", http.StatusForbidden)
+			return
+		}
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "invalid pallet id", http.StatusBadRequest)
+			return
+		}
+		belongs, err := palletBelongsToProject(r.Context(), db, projectID, id)
+		if err != nil {
+			http.Error(w, "failed to validate pallet project", http.StatusInternalServerError)
+			return
+		}
+		if !belongs {
+			http.Error(w, "pallet not found", http.StatusNotFound)
+			return
+		}
+		var userID int64
+		if sessionUserID := sessionUserIDFromContext(r); sessionUserID != nil {
+			userID = *sessionUserID
+		}
+		if _, err := exportjob.EnqueuePalletBundle(r.Context(), db, userID, projectID, id); err != nil {
+			slog.Error("queue pallet bundle failed", slog.Int64("pallet_id", id), slog.Any("err", err))
+			http.Error(w, "failed to queue export bundle", http.StatusInternalServerError)
+			return
+		}
+		jobs.Notify()
+		http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(id, 10)+"/content-label", http.StatusSeeOther)
+	}
+}
+
+// ExportJobDownloadHandler serves a finished export job's file.
+func ExportJobDownloadHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "invalid export job id", http.StatusBadRequest)
+			return
+		}
+		name, size, err := exportjob.LoadFileInfo(r.Context(), db, id)
+		switch {
+		case errors.Is(err, exportjob.ErrNotFound):
+			http.Error(w, "export job not found", http.StatusNotFound)
+			return
+		case errors.Is(err, exportjob.ErrNotReady):
+			http.Error(w, "export is not ready yet", http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, "failed to load export", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", "attachment; filename="+name)
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		_, _ = exportjob.CopyFile(r.Context(), db, id, w)
+	}
+}
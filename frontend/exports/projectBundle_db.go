@@ -0,0 +1,222 @@
+package exports
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	palletprogress "receipter/frontend/pallets/progress"
+	"receipter/infrastructure/coldstorage"
+	"receipter/infrastructure/exportformat"
+	"receipter/infrastructure/exportjob"
+	"receipter/infrastructure/photovisibility"
+	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+type projectBundlePhoto struct {
+	PalletID    int64  `bun:"pallet_id"`
+	ReceiptID   int64  `bun:"receipt_id"`
+	PhotoID     int64  `bun:"photo_id"`
+	SKU         string `bun:"sku"`
+	BatchNumber string `bun:"batch_number"`
+	Expiry      string `bun:"expiry"`
+	MIME        string `bun:"mime"`
+	CapturedAt  string `bun:"captured_at"`
+}
+
+// BuildProjectBundle is the export job builder for a project handover
+// bundle: a ZIP holding the bulk receipts and pallet status CSVs, one lines
+// CSV per pallet, the SKU summary and detail CSVs, and every receipt photo
+// filed by pallet and receipt line, with a manifest describing them.
+// Photos moved to cold storage are read back from their files, and photos
+// marked internal are left out because the bundle is handed to the client.
+// The ZIP is written to a temporary file that the export worker stores.
+func BuildProjectBundle(ctx context.Context, db *sqlite.DB, job models.ExportJob) (result exportjob.Result, err error) {
+	project, err := projectinfra.LoadByID(ctx, db, job.ProjectID)
+	if err != nil {
+		return result, err
+	}
+
+	f, err := os.CreateTemp("", "project-bundle-*.zip")
+	if err != nil {
+		return result, err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(f.Name())
+			result = exportjob.Result{}
+		}
+	}()
+	zw := zip.NewWriter(f)
+
+	rowCount, err := writeBundleCSV(zw, "receipts.csv", func(w io.Writer) (int64, error) {
+		return writeReceiptCSV(ctx, db, w, project.ID, nil, exportformat.Receipts.Latest)
+	})
+	if err != nil {
+		return result, err
+	}
+	if _, err := writeBundleCSV(zw, "pallet-status.csv", func(w io.Writer) (int64, error) {
+		return writePalletStatusCSV(ctx, db, w, project.ID, 0, exportformat.PalletStatus.Latest)
+	}); err != nil {
+		return result, err
+	}
+
+	var palletIDs []int64
+	if err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT id FROM pallets WHERE project_id = ? ORDER BY id`, project.ID).Scan(ctx, &palletIDs)
+	}); err != nil {
+		return result, err
+	}
+	for _, palletID := range palletIDs {
+		if _, err := writeBundleCSV(zw, "pallets/"+bundlePalletCode(palletID)+".csv", func(w io.Writer) (int64, error) {
+			return writeReceiptCSV(ctx, db, w, project.ID, &palletID, exportformat.Receipts.Latest)
+		}); err != nil {
+			return result, err
+		}
+	}
+
+	if _, err := writeBundleCSV(zw, "sku-summary.csv", func(w io.Writer) (int64, error) {
+		return palletprogress.WriteProjectSKUSummaryCSV(ctx, db, w, project.ID)
+	}); err != nil {
+		return result, err
+	}
+	if _, err := writeBundleCSV(zw, "sku-detail.csv", func(w io.Writer) (int64, error) {
+		return palletprogress.WriteProjectSKUDetailedCSV(ctx, db, w, project.ID)
+	}); err != nil {
+		return result, err
+	}
+
+	if err := writeProjectBundlePhotos(ctx, db, zw, project.ID); err != nil {
+		return result, err
+	}
+	if err := zw.Close(); err != nil {
+		return result, err
+	}
+
+	result.FileName = fmt.Sprintf("project-%d-bundle-%s.zip", project.ID, time.Now().Format("20060102-150405"))
+	result.Path = f.Name()
+	result.RowCount = rowCount
+	return result, nil
+}
+
+func writeBundleCSV(zw *zip.Writer, name string, write func(w io.Writer) (int64, error)) (int64, error) {
+	f, err := zw.Create(name)
+	if err != nil {
+		return 0, err
+	}
+	return write(f)
+}
+
+// writeProjectBundlePhotos adds every photo of the project under photos/ and
+// then photos/manifest.csv listing them, skipping photos marked internal. Blobs are read one at a time so the
+// project's photos are never all held in memory outside the archive.
+func writeProjectBundlePhotos(ctx context.Context, db *sqlite.DB, zw *zip.Writer, projectID int64) error {
+	photos := make([]projectBundlePhoto, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT pr.pallet_id, pr.id AS receipt_id, 0 AS photo_id, pr.sku, COALESCE(pr.batch_number, '') AS batch_number,
+       COALESCE(strftime('%d/%m/%Y', pr.expiry_date), '') AS expiry,
+       COALESCE(pr.stock_photo_mime, '') AS mime,
+       COALESCE(strftime('%d/%m/%Y %H:%M', pr.created_at), '') AS captured_at
+FROM pallet_receipts pr
+WHERE pr.project_id = ?
+  AND `+photovisibility.ClientVisibleSQL(photovisibility.SourcePrimary, "pr.id")+`
+  AND (length(pr.stock_photo_blob) > 0
+       OR EXISTS (SELECT 1 FROM cold_storage_photos cs WHERE cs.source = ? AND cs.photo_id = pr.id))
+UNION ALL
+SELECT pr.pallet_id, pr.id, rp.id, pr.sku, COALESCE(pr.batch_number, ''),
+       COALESCE(strftime('%d/%m/%Y', pr.expiry_date), ''),
+       COALESCE(rp.photo_mime, ''),
+       COALESCE(strftime('%d/%m/%Y %H:%M', rp.created_at), '')
+FROM receipt_photos rp
+JOIN pallet_receipts pr ON pr.id = rp.pallet_receipt_id
+WHERE pr.project_id = ?
+  AND `+photovisibility.ClientVisibleSQL(photovisibility.SourceGallery, "rp.id")+`
+ORDER BY pallet_id, receipt_id, photo_id`, projectID, coldstorage.SourcePrimary, projectID).Scan(ctx, &photos)
+	})
+	if err != nil {
+		return err
+	}
+
+	records := make([][]string, 0, len(photos))
+	for _, p := range photos {
+		var blob []byte
+		source, photoID := coldstorage.SourceGallery, p.PhotoID
+		err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+			if p.PhotoID == 0 {
+				return tx.NewRaw(`SELECT stock_photo_blob FROM pallet_receipts WHERE id = ?`, p.ReceiptID).Scan(ctx, &blob)
+			}
+			return tx.NewRaw(`SELECT photo_blob FROM receipt_photos WHERE id = ?`, p.PhotoID).Scan(ctx, &blob)
+		})
+		if err != nil {
+			return err
+		}
+		if p.PhotoID == 0 {
+			source, photoID = coldstorage.SourcePrimary, p.ReceiptID
+		}
+		if blob, err = coldstorage.Fill(ctx, db, source, photoID, blob); err != nil {
+			return err
+		}
+		if len(blob) == 0 {
+			continue
+		}
+		name := projectBundlePhotoName(p)
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(blob); err != nil {
+			return err
+		}
+		records = append(records, []string{
+			name,
+			strconv.FormatInt(p.PalletID, 10),
+			strconv.FormatInt(p.ReceiptID, 10),
+			strconv.FormatInt(p.PhotoID, 10),
+			strconv.FormatBool(p.PhotoID == 0),
+			p.SKU,
+			p.BatchNumber,
+			p.Expiry,
+			p.MIME,
+			strconv.Itoa(len(blob)),
+			p.CapturedAt,
+		})
+	}
+
+	manifest, err := zw.Create("photos/manifest.csv")
+	if err != nil {
+		return err
+	}
+	mw := csv.NewWriter(manifest)
+	if err := mw.Write([]string{"file", "pallet_id", "receipt_line_id", "photo_id", "primary", "sku", "batch_number", "expiry", "mime_type", "size_bytes", "captured_at"}); err != nil {
+		return err
+	}
+	if err := mw.WriteAll(records); err != nil {
+		return err
+	}
+	return mw.Error()
+}
+
+func projectBundlePhotoName(p projectBundlePhoto) string {
+	dir := fmt.Sprintf("photos/%s/line-%d", bundlePalletCode(p.PalletID), p.ReceiptID)
+	if p.PhotoID == 0 {
+		return dir + "/primary" + photoExtension(p.MIME)
+	}
+	return fmt.Sprintf("%s/photo-%d%s", dir, p.PhotoID, photoExtension(p.MIME))
+}
+
+func bundlePalletCode(palletID int64) string {
+	return fmt.Sprintf("P%08d", palletID)
+}
@@ -0,0 +1,44 @@
+package exports
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"receipter/infrastructure/exportjob"
+	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/sqlite"
+)
+
+// QueueProjectBundleCommandHandler queues a handover bundle for the project
+// and returns to the exports page, where the job's progress is listed.
+func QueueProjectBundleCommandHandler(db *sqlite.DB, jobs *exportjob.Worker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := requestedProjectID(r)
+		if err != nil {
+			http.Error(w, "invalid project id", http.StatusBadRequest)
+			return
+		}
+		if projectID <= 0 {
+			http.Error(w, "no project selected", http.StatusForbidden)
+			return
+		}
+		if _, err := projectinfra.LoadByID(r.Context(), db, projectID); err != nil {
+			http.Error(w, "project not found", http.StatusNotFound)
+			return
+		}
+		var userID int64
+		if sessionUserID := sessionUserIDFromContext(r); sessionUserID != nil {
+			userID = *sessionUserID
+		}
+		if _, err := exportjob.EnqueueProjectBundle(r.Context(), db, userID, projectID); err != nil {
+			slog.Error("queue project bundle failed", slog.Int64("project_id", projectID), slog.Any("err", err))
+			http.Error(w, "failed to queue project bundle", http.StatusInternalServerError)
+			return
+		}
+		jobs.Notify()
+		status := "Project bundle queued. It will be listed below when ready."
+		http.Redirect(w, r, "/tasker/exports?project_id="+strconv.FormatInt(projectID, 10)+"&status="+url.QueryEscape(status), http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,46 @@
+package exports
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"time"
+
+	"receipter/infrastructure/exportformat"
+	"receipter/infrastructure/exportschedule"
+	"receipter/infrastructure/sqlite"
+)
+
+// BuildScheduledExport is the export schedule builder. It produces the same
+// columns as the matching CSV download in its latest format, so a sheet and a
+// download of the same project line up.
+func BuildScheduledExport(ctx context.Context, db *sqlite.DB, s exportschedule.Schedule, since *time.Time) (exportschedule.Table, error) {
+	var table exportschedule.Table
+	var buf bytes.Buffer
+	switch s.ExportType {
+	case exportschedule.TypeReceipts:
+		table.FormatVersion = exportformat.Receipts.Latest
+		if _, err := writeReceiptCSVSince(ctx, db, &buf, s.ProjectID, nil, since, 0, table.FormatVersion); err != nil {
+			return table, err
+		}
+	case exportschedule.TypePalletStatus:
+		table.FormatVersion = exportformat.PalletStatus.Latest
+		if _, err := writePalletStatusCSV(ctx, db, &buf, s.ProjectID, 0, table.FormatVersion); err != nil {
+			return table, err
+		}
+	default:
+		return table, fmt.Errorf("unsupported export type %q", s.ExportType)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		return table, err
+	}
+	if len(records) == 0 {
+		return table, fmt.Errorf("export produced no header")
+	}
+	table.Header = records[0]
+	table.Rows = records[1:]
+	return table, nil
+}
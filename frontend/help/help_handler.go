@@ -1,13 +1,22 @@
 package help
 
 import (
+	"errors"
+	"log/slog"
 	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
 
 	sessioncontext "receipter/frontend/shared/context"
+	"receipter/frontend/shared/nav"
+	"receipter/infrastructure/helpnotice"
+	projectinfra "receipter/infrastructure/project"
 	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/sqlite"
 )
 
-func HelpPageQueryHandler() http.HandlerFunc {
+func HelpPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		session, ok := sessioncontext.GetSessionFromContext(r.Context())
 		if !ok {
@@ -25,6 +34,26 @@ func HelpPageQueryHandler() http.HandlerFunc {
 			IsClient:  isClient,
 		}
 
+		// Clients see notes for every project they can access; staff see
+		// notes for the project they are working in.
+		projectIDs := make([]int64, 0)
+		if isClient {
+			ids, err := projectinfra.ListClientProjectIDs(r.Context(), db, session.UserID)
+			if err != nil {
+				http.Error(w, "failed to load projects", http.StatusInternalServerError)
+				return
+			}
+			projectIDs = ids
+		} else if session.ActiveProjectID != nil {
+			projectIDs = append(projectIDs, *session.ActiveProjectID)
+		}
+		notices, err := helpnotice.ForHelpPage(r.Context(), db, session.User.Role, projectIDs)
+		if err != nil {
+			// Site notes add to the built-in help; show that without them.
+			slog.Error("help page: load notices failed", slog.Any("err", err))
+		}
+		data.Notices = notices
+
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		if err := HelpPage(data).Render(r.Context(), w); err != nil {
 			http.Error(w, "failed to render help page", http.StatusInternalServerError)
@@ -32,3 +61,33 @@ func HelpPageQueryHandler() http.HandlerFunc {
 		}
 	}
 }
+
+// DismissNoticeCommandHandler hides a receipt banner for the user and
+// returns to the page it was dismissed from.
+func DismissNoticeCommandHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "invalid notice id", http.StatusBadRequest)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form data", http.StatusBadRequest)
+			return
+		}
+		if err := helpnotice.Dismiss(r.Context(), db, session.UserID, id); err != nil {
+			if errors.Is(err, helpnotice.ErrNotFound) {
+				http.Error(w, "notice not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to dismiss notice", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, nav.ReturnPath(r.FormValue("return_to"), "/tasker/help"), http.StatusSeeOther)
+	}
+}
@@ -1,7 +1,11 @@
 package help
 
+import "receipter/infrastructure/helpnotice"
+
 type PageData struct {
 	IsAdmin   bool
 	IsScanner bool
 	IsClient  bool
+	// Notices are the site-specific notes admins wrote for this role.
+	Notices []helpnotice.Notice
 }
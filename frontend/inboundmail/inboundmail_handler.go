@@ -0,0 +1,91 @@
+package inboundmail
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/infrastructure/replymail"
+)
+
+// maxMessageBytes bounds an inbound post, attachments included; only the
+// text parts are read.
+const maxMessageBytes = 10 << 20
+
+// ReceiveCommandHandler accepts a message posted by the mail provider's
+// inbound webhook. Providers post form fields (Mailgun's sender, recipient,
+// body-plain, X-Mailgun-Spf and X-Mailgun-Dkim-Check-Result, or SendGrid's
+// from, to, text, SPF and dkim) or a JSON object with from, to, subject,
+// text, spf and dkim. Rejected replies still answer 200 so the provider does
+// not retry them; the reason is logged and returned.
+func ReceiveCommandHandler(receiver *replymail.Receiver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret := chi.URLParam(r, "secret")
+		if receiver.Secret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(receiver.Secret)) != 1 {
+			http.NotFound(w, r)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxMessageBytes)
+		msg, err := parseMessage(r)
+		if err != nil {
+			http.Error(w, "invalid inbound message", http.StatusBadRequest)
+			return
+		}
+		result, err := receiver.Receive(r.Context(), msg)
+		if err != nil {
+			slog.Error("inbound email failed", slog.String("from", msg.From), slog.Any("err", err))
+			http.Error(w, "failed to record inbound message", http.StatusInternalServerError)
+			return
+		}
+		if result.Status == replymail.StatusRejected {
+			slog.Warn("inbound email rejected", slog.String("from", msg.From), slog.String("reason", result.Reason))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(result)
+	}
+}
+
+func parseMessage(r *http.Request) (replymail.Message, error) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var msg struct {
+			From    string `json:"from"`
+			To      string `json:"to"`
+			Subject string `json:"subject"`
+			Text    string `json:"text"`
+			SPF     string `json:"spf"`
+			DKIM    string `json:"dkim"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			return replymail.Message{}, err
+		}
+		return replymail.Message{From: msg.From, To: msg.To, Subject: msg.Subject, Text: msg.Text, SPF: msg.SPF, DKIM: msg.DKIM}, nil
+	}
+
+	if err := r.ParseMultipartForm(maxMessageBytes); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return replymail.Message{}, err
+	}
+	return replymail.Message{
+		From:    firstValue(r, "from", "sender"),
+		To:      firstValue(r, "to", "recipient"),
+		Subject: firstValue(r, "subject"),
+		Text:    firstValue(r, "text", "body-plain"),
+		SPF:     firstValue(r, "X-Mailgun-Spf", "SPF", "spf"),
+		DKIM:    firstValue(r, "X-Mailgun-Dkim-Check-Result", "dkim"),
+	}, nil
+}
+
+// firstValue returns the first of the named form fields that is set.
+func firstValue(r *http.Request, names ...string) string {
+	for _, name := range names {
+		if v := r.PostFormValue(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
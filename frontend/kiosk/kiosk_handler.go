@@ -0,0 +1,175 @@
+package kiosk
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"receipter/frontend/login"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/cache"
+	kioskinfra "receipter/infrastructure/kiosk"
+	sessioncookie "receipter/infrastructure/session"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+func EnrollPageQueryHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := EnrollPageData{
+			Token:        strings.TrimSpace(r.URL.Query().Get("token")),
+			ErrorMessage: r.URL.Query().Get("error"),
+		}
+		if data.Token == "" && data.ErrorMessage == "" {
+			data.ErrorMessage = "enrollment link is missing its token"
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := EnrollPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render kiosk enrollment page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// EnrollCommandHandler binds this browser as a kiosk. Enrolling is a POST so
+// link previews in chat apps cannot use up the one-time link.
+func EnrollCommandHandler(db *sqlite.DB, sessionCache cache.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/kiosk/enroll?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		token := strings.TrimSpace(r.FormValue("token"))
+		device, err := kioskinfra.Enroll(r.Context(), db, token)
+		if err != nil {
+			message := "failed to enroll kiosk"
+			if errors.Is(err, kioskinfra.ErrInvalidDevice) || errors.Is(err, kioskinfra.ErrAlreadyEnrolled) {
+				message = err.Error()
+			}
+			http.Redirect(w, r, "/kiosk/enroll?error="+url.QueryEscape(message), http.StatusSeeOther)
+			return
+		}
+
+		// Whoever opened the link on the tablet is signed out; from here on
+		// the tablet only opens sessions by PIN.
+		endSession(w, r, db, sessionCache)
+		http.SetCookie(w, sessioncookie.KioskCookie(token, sessioncookie.KioskCookieMaxAge))
+		http.Redirect(w, r, "/kiosk?status="+url.QueryEscape(device.Name+" enrolled as a kiosk"), http.StatusSeeOther)
+	}
+}
+
+func PINPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		device, ok := authenticateDevice(w, r, db)
+		if !ok {
+			return
+		}
+		users, err := kioskinfra.ListPINUsers(r.Context(), db, true, device.SiteID)
+		if err != nil {
+			http.Error(w, "failed to load kiosk users", http.StatusInternalServerError)
+			return
+		}
+		cookie, err := r.Cookie(sessioncookie.CookieName)
+		data := PINPageData{
+			DeviceName:   device.Name,
+			Users:        users,
+			SignedIn:     err == nil && cookie.Value != "",
+			Status:       r.URL.Query().Get("status"),
+			ErrorMessage: r.URL.Query().Get("error"),
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := PINPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render kiosk page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// SwitchUserCommandHandler checks the picked scanner's PIN and replaces the
+// tablet's session with one for them, so everything captured next is
+// attributed to the person at the tablet.
+func SwitchUserCommandHandler(db *sqlite.DB, sessionCache cache.SessionStore, userCache *cache.UserCache, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		device, ok := authenticateDevice(w, r, db)
+		if !ok {
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/kiosk?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		userID, err := strconv.ParseInt(strings.TrimSpace(r.FormValue("user_id")), 10, 64)
+		if err != nil || userID <= 0 {
+			http.Redirect(w, r, "/kiosk?error="+url.QueryEscape("pick who is scanning"), http.StatusSeeOther)
+			return
+		}
+
+		user, err := kioskinfra.VerifyPIN(r.Context(), db, userID, r.FormValue("pin"), device.SiteID)
+		if err != nil {
+			message := "failed to check PIN"
+			if errors.Is(err, kioskinfra.ErrInvalidPIN) || errors.Is(err, kioskinfra.ErrPINLocked) || errors.Is(err, kioskinfra.ErrWrongSite) {
+				message = err.Error()
+			}
+			http.Redirect(w, r, "/kiosk?error="+url.QueryEscape(message), http.StatusSeeOther)
+			return
+		}
+
+		endSession(w, r, db, sessionCache)
+		session, err := login.StartKioskSession(r.Context(), db, sessionCache, userCache, user, device.ID)
+		if err != nil {
+			http.Redirect(w, r, "/kiosk?error="+url.QueryEscape("failed to start session"), http.StatusSeeOther)
+			return
+		}
+		if err := kioskinfra.RecordSwitch(r.Context(), db, auditSvc, device, user.ID); err != nil {
+			slog.Error("kiosk switch audit failed", slog.Int64("kiosk_id", device.ID), slog.Int64("user_id", user.ID), slog.Any("err", err))
+		}
+		http.SetCookie(w, sessioncookie.SessionCookie(session.ID, 12*60*60))
+		http.Redirect(w, r, kioskinfra.HomePath, http.StatusSeeOther)
+	}
+}
+
+// LockCommandHandler ends the current kiosk session and returns to the PIN
+// screen, for when a scanner walks away from the tablet.
+func LockCommandHandler(db *sqlite.DB, sessionCache cache.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endSession(w, r, db, sessionCache)
+		http.Redirect(w, r, "/kiosk", http.StatusSeeOther)
+	}
+}
+
+// authenticateDevice resolves the kiosk cookie. Browsers without a valid one
+// are sent to the normal login, and a revoked kiosk forgets its cookie.
+func authenticateDevice(w http.ResponseWriter, r *http.Request, db *sqlite.DB) (device models.KioskDevice, ok bool) {
+	cookie, err := r.Cookie(sessioncookie.KioskCookieName)
+	if err != nil || cookie.Value == "" {
+		http.Redirect(w, r, "/login?error="+url.QueryEscape(kioskinfra.ErrInvalidDevice.Error()), http.StatusSeeOther)
+		return device, false
+	}
+	device, err = kioskinfra.AuthenticateDevice(r.Context(), db, cookie.Value)
+	if err != nil {
+		if !errors.Is(err, kioskinfra.ErrInvalidDevice) {
+			slog.Error("kiosk device lookup failed", slog.Any("err", err))
+			http.Error(w, "failed to load kiosk", http.StatusInternalServerError)
+			return device, false
+		}
+		http.SetCookie(w, sessioncookie.KioskCookie("", -1))
+		http.Redirect(w, r, "/login?error="+url.QueryEscape(kioskinfra.ErrInvalidDevice.Error()), http.StatusSeeOther)
+		return device, false
+	}
+	return device, true
+}
+
+func endSession(w http.ResponseWriter, r *http.Request, db *sqlite.DB, sessionCache cache.SessionStore) {
+	cookie, err := r.Cookie(sessioncookie.CookieName)
+	if err != nil || cookie.Value == "" {
+		return
+	}
+	sessionCache.DeleteSessionBySessionToken(cookie.Value)
+	if err := login.DeleteSessionByToken(r.Context(), db, cookie.Value); err != nil {
+		slog.Error("kiosk: delete previous session failed", slog.Any("err", err))
+	}
+	http.SetCookie(w, sessioncookie.SessionCookie("", -1))
+}
@@ -0,0 +1,16 @@
+package kiosk
+
+import kioskinfra "receipter/infrastructure/kiosk"
+
+type EnrollPageData struct {
+	Token        string
+	ErrorMessage string
+}
+
+type PINPageData struct {
+	DeviceName   string
+	Users        []kioskinfra.PINUser
+	SignedIn     bool
+	Status       string
+	ErrorMessage string
+}
@@ -19,6 +19,7 @@ func findUserByUsername(ctx context.Context, tx bun.Tx, username string) (models
 	err := tx.NewSelect().
 		Model(&user).
 		Where("LOWER(username) = ?", strings.ToLower(strings.TrimSpace(username))).
+		Where("disabled_at IS NULL").
 		Limit(1).
 		Scan(ctx)
 	if err != nil {
@@ -56,6 +57,7 @@ func persistSession(ctx context.Context, db *sqlite.DB, session models.Session)
 			ID:              session.ID,
 			UserID:          session.UserID,
 			ActiveProjectID: session.ActiveProjectID,
+			KioskDeviceID:   session.KioskDeviceID,
 			ExpiresAt:       session.ExpiresAt,
 		}).Exec(ctx)
 		return err
@@ -92,7 +94,7 @@ func LoadSessionByToken(ctx context.Context, db *sqlite.DB, token string) (model
 	if err != nil {
 		return models.Session{}, err
 	}
-	if session.Expired() {
+	if session.Expired() || session.User.DisabledAt != nil {
 		_ = DeleteSessionByToken(ctx, db, token)
 		return models.Session{}, sql.ErrNoRows
 	}
@@ -1,12 +1,15 @@
 package login
 
 import (
+	"context"
 	"database/sql"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strings"
 
 	"receipter/infrastructure/cache"
+	"receipter/infrastructure/landing"
 	projectinfra "receipter/infrastructure/project"
 	"receipter/infrastructure/rbac"
 	sessioncookie "receipter/infrastructure/session"
@@ -15,7 +18,7 @@ import (
 )
 
 // CreateLoginHandler authenticates the user and issues a session cookie.
-func CreateLoginHandler(db *sqlite.DB, sessionCache *cache.UserSessionCache, userCache *cache.UserCache) http.HandlerFunc {
+func CreateLoginHandler(db *sqlite.DB, sessionCache cache.SessionStore, userCache *cache.UserCache) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := r.ParseForm(); err != nil {
 			http.Redirect(w, r, "/login?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
@@ -70,14 +73,32 @@ func CreateLoginHandler(db *sqlite.DB, sessionCache *cache.UserSessionCache, use
 		userCache.Add(user.Username, user)
 
 		http.SetCookie(w, sessioncookie.SessionCookie(session.ID, 12*60*60))
-		redirectTo := "/tasker/projects"
-		if user.Role == rbac.RoleClient {
-			redirectTo = "/tasker/pallets/sku-view"
+		redirectTo, err := landing.Resolve(r.Context(), db, user.ID, user.Role)
+		if err != nil {
+			slog.Warn("landing page lookup failed; using role default", slog.Int64("user_id", user.ID), slog.Any("err", err))
 		}
 		http.Redirect(w, r, redirectTo, http.StatusSeeOther)
 	}
 }
 
+// StartKioskSession opens a session for a scanner who switched onto a kiosk
+// by PIN. The session is tagged with the device so it stays on the kiosk
+// routes.
+func StartKioskSession(ctx context.Context, db *sqlite.DB, sessionCache cache.SessionStore, userCache *cache.UserCache, user models.User, deviceID int64) (models.Session, error) {
+	activeProjectID, err := projectinfra.ResolveSessionActiveProjectID(ctx, db, nil)
+	if err != nil {
+		return models.Session{}, err
+	}
+	session := newSession(user, activeProjectID)
+	session.KioskDeviceID = &deviceID
+	if err := persistSession(ctx, db, session); err != nil {
+		return models.Session{}, err
+	}
+	sessionCache.AddSession(session)
+	userCache.Add(user.Username, user)
+	return session, nil
+}
+
 func newSession(user models.User, activeProjectID *int64) models.Session {
 	return models.Session{
 		ID:              newSessionToken(),
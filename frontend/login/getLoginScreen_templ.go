@@ -10,7 +10,7 @@ import templruntime "github.com/a-h/templ/runtime"
 
 import sharedhtml "receipter/frontend/shared/html"
 
-func GetLoginScreen(errorMessage string) templ.Component {
+func GetLoginScreen(errorMessage, status string) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
@@ -53,8 +53,26 @@ func GetLoginScreen(errorMessage string) templ.Component {
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
+		} else if status != "" {
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "<div role=\"alert\" class=\"alert alert-success alert-soft\"><span>")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			var templ_7745c5c3_Var3 string
+			templ_7745c5c3_Var3, templ_7745c5c3_Err = templ.JoinStringErrs(status)
+			if templ_7745c5c3_Err != nil {
+				return templ.Error{Err: templ_7745c5c3_Err, FileName: `frontend/login/getLoginScreen.templ`, Line: 33, Col: 22}
+			}
+			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var3))
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "</span></div>")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "<form method=\"post\" action=\"/login\" class=\"space-y-4\"><fieldset class=\"fieldset w-full\"><legend class=\"fieldset-legend text-base font-medium\">Username</legend> <input class=\"input input-bordered input-lg w-full\" name=\"username\" autocomplete=\"username\" placeholder=\"Enter username\"></fieldset><fieldset class=\"fieldset w-full\"><legend class=\"fieldset-legend text-base font-medium\">Password</legend> <input class=\"input input-bordered input-lg w-full\" type=\"password\" name=\"password\" autocomplete=\"current-password\" placeholder=\"Enter password\"></fieldset><button class=\"btn btn-primary btn-lg w-full\" type=\"submit\">Sign In</button></form></div></section></main>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "<form method=\"post\" action=\"/login\" class=\"space-y-4\"><fieldset class=\"fieldset w-full\"><legend class=\"fieldset-legend text-base font-medium\">Username</legend> <input class=\"input input-bordered input-lg w-full\" name=\"username\" autocomplete=\"username\" placeholder=\"Enter username\"></fieldset><fieldset class=\"fieldset w-full\"><legend class=\"fieldset-legend text-base font-medium\">Password</legend> <input class=\"input input-bordered input-lg w-full\" type=\"password\" name=\"password\" autocomplete=\"current-password\" placeholder=\"Enter password\"></fieldset><button class=\"btn btn-primary btn-lg w-full\" type=\"submit\">Sign In</button></form><p class=\"text-center text-sm\"><a class=\"link link-hover text-base-content/60\" href=\"/password/forgot\">Forgot password?</a></p></div></section></main>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -62,7 +80,7 @@ func GetLoginScreen(errorMessage string) templ.Component {
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "</body></html>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, "</body></html>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
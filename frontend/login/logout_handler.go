@@ -8,8 +8,9 @@ import (
 	"receipter/infrastructure/sqlite"
 )
 
-// LogoutHandler removes session state and clears cookie.
-func LogoutHandler(db *sqlite.DB, sessionCache *cache.UserSessionCache) http.HandlerFunc {
+// LogoutHandler removes session state and clears cookie. Kiosk tablets go
+// back to the PIN screen rather than the password login.
+func LogoutHandler(db *sqlite.DB, sessionCache cache.SessionStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		cookie, err := r.Cookie(sessioncookie.CookieName)
 		if err == nil && cookie.Value != "" {
@@ -17,6 +18,10 @@ func LogoutHandler(db *sqlite.DB, sessionCache *cache.UserSessionCache) http.Han
 			_ = DeleteSessionByToken(r.Context(), db, cookie.Value)
 		}
 		http.SetCookie(w, sessioncookie.SessionCookie("", -1))
+		if device, err := r.Cookie(sessioncookie.KioskCookieName); err == nil && device.Value != "" {
+			http.Redirect(w, r, "/kiosk", http.StatusSeeOther)
+			return
+		}
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 	}
 }
@@ -0,0 +1,115 @@
+package login
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"receipter/infrastructure/cache"
+	"receipter/infrastructure/passwordreset"
+)
+
+// ForgotPasswordPageHandler renders the form that asks for a reset link.
+func ForgotPasswordPageHandler(resets *passwordreset.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := ForgotPasswordPage(resets.Enabled(), r.URL.Query().Get("error"), r.URL.Query().Get("status")).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render forgot password page", http.StatusInternalServerError)
+		}
+	}
+}
+
+// RequestPasswordResetHandler emails a reset link when the username or email
+// belongs to a client user. The answer is the same either way.
+func RequestPasswordResetHandler(resets *passwordreset.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/password/forgot?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		if err := resets.Request(r.Context(), r.FormValue("identifier"), requestIP(r)); err != nil {
+			if errors.Is(err, passwordreset.ErrDisabled) {
+				http.Redirect(w, r, "/password/forgot?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+				return
+			}
+			slog.Error("password reset: request failed", slog.Any("err", err))
+			http.Redirect(w, r, "/password/forgot?error="+url.QueryEscape("failed to send reset link; try again"), http.StatusSeeOther)
+			return
+		}
+		status := fmt.Sprintf("If that account has an email address on file, a reset link is on its way. It works for %d minutes.", int(resets.TTL.Minutes()))
+		http.Redirect(w, r, "/password/forgot?status="+url.QueryEscape(status), http.StatusSeeOther)
+	}
+}
+
+// ResetPasswordPageHandler renders the new password form for an emailed link.
+func ResetPasswordPageHandler(resets *passwordreset.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimSpace(r.URL.Query().Get("token"))
+		errorMessage := r.URL.Query().Get("error")
+		reset, err := resets.Lookup(r.Context(), token)
+		if err != nil {
+			if !errors.Is(err, passwordreset.ErrInvalidToken) {
+				slog.Error("password reset: lookup failed", slog.Any("err", err))
+			}
+			token = ""
+			errorMessage = passwordreset.ErrInvalidToken.Error()
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := ResetPasswordPage(token, reset.Username, errorMessage).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render reset password page", http.StatusInternalServerError)
+		}
+	}
+}
+
+// CompletePasswordResetHandler sets the new password from an emailed link
+// and signs the user out everywhere.
+func CompletePasswordResetHandler(resets *passwordreset.Service, sessionCache cache.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/password/forgot?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		token := strings.TrimSpace(r.FormValue("token"))
+		retry := func(msg string) {
+			http.Redirect(w, r, passwordreset.Path+"?token="+url.QueryEscape(token)+"&error="+url.QueryEscape(msg), http.StatusSeeOther)
+		}
+		password := strings.TrimSpace(r.FormValue("password"))
+		if password != strings.TrimSpace(r.FormValue("confirm_password")) {
+			retry("passwords do not match")
+			return
+		}
+		if err := ValidatePasswordPolicy(password); err != nil {
+			retry(err.Error())
+			return
+		}
+		sessionIDs, err := resets.Complete(r.Context(), token, password)
+		if err != nil {
+			if !errors.Is(err, passwordreset.ErrInvalidToken) {
+				slog.Error("password reset: complete failed", slog.Any("err", err))
+				retry("failed to set password; try again")
+				return
+			}
+			retry(err.Error())
+			return
+		}
+		if sessionCache != nil {
+			for _, id := range sessionIDs {
+				sessionCache.DeleteSessionBySessionToken(id)
+			}
+		}
+		http.Redirect(w, r, "/login?status="+url.QueryEscape("Password changed. Sign in with your new password."), http.StatusSeeOther)
+	}
+}
+
+// requestIP is the address a reset was requested from, kept for admins.
+func requestIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,51 @@
+package attribution
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func LoadPageData(ctx context.Context, db *sqlite.DB, palletID int64) (PageData, error) {
+	data := PageData{
+		PalletID: palletID,
+		Lines:    make([]LineView, 0),
+		Users:    make([]UserOption, 0),
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`
+SELECT p.project_id, pj.name, pj.code
+FROM pallets p
+JOIN projects pj ON pj.id = p.project_id
+WHERE p.id = ?`, palletID).Scan(ctx, &data.ProjectID, &data.ProjectName, &data.ProjectCode); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`
+SELECT pr.id, pr.sku, pr.description, pr.qty,
+       COALESCE(pr.batch_number, '') AS batch_number,
+       COALESCE(u.username, '') AS scanned_by,
+       strftime('%d/%m/%Y %H:%M', pr.created_at) AS scanned_at
+FROM pallet_receipts pr
+LEFT JOIN users u ON u.id = pr.scanned_by_user_id
+WHERE pr.pallet_id = ?
+ORDER BY pr.created_at, pr.id`, palletID).Scan(ctx, &data.Lines); err != nil {
+			return err
+		}
+		return tx.NewRaw(`
+SELECT id, username, role
+FROM users
+WHERE role IN ('admin', 'scanner') AND disabled_at IS NULL
+ORDER BY LOWER(username), id`).Scan(ctx, &data.Users)
+	})
+	return data, err
+}
+
+func LoadPalletProjectID(ctx context.Context, db *sqlite.DB, palletID int64) (int64, error) {
+	var projectID int64
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT project_id FROM pallets WHERE id = ?`, palletID).Scan(ctx, &projectID)
+	})
+	return projectID, err
+}
@@ -0,0 +1,123 @@
+package attribution
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/phase"
+	"receipter/infrastructure/receipts"
+	"receipter/infrastructure/sqlite"
+)
+
+func pageURL(palletID int64) string {
+	return fmt.Sprintf("/tasker/pallets/%d/scanned-by", palletID)
+}
+
+func parsePalletID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid pallet id")
+	}
+	return id, nil
+}
+
+// ScannedByPageQueryHandler lists a pallet's lines with who scanned each,
+// for an admin to credit lines scanned under the wrong session to the
+// right user.
+func ScannedByPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		palletID, err := parsePalletID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := LoadPageData(r.Context(), db, palletID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "pallet not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to load pallet", http.StatusInternalServerError)
+			return
+		}
+		data.Status = r.URL.Query().Get("status")
+		data.ErrorMessage = r.URL.Query().Get("error")
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := ScannedByPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render scanned-by page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// ReassignScannedByCommandHandler credits the selected lines to the chosen
+// user, recording the reason.
+func ReassignScannedByCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		palletID, err := parsePalletID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, pageURL(palletID)+"?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+
+		projectID, err := LoadPalletProjectID(r.Context(), db, palletID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "pallet not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to load pallet", http.StatusInternalServerError)
+			return
+		}
+		in := receipts.Reassignment{
+			ProjectID: projectID,
+			PalletID:  palletID,
+			Reason:    r.FormValue("reason"),
+		}
+		in.ToUserID, _ = strconv.ParseInt(r.FormValue("user_id"), 10, 64)
+		for _, raw := range r.PostForm["receipt_id"] {
+			if id, err := strconv.ParseInt(raw, 10, 64); err == nil {
+				in.ReceiptIDs = append(in.ReceiptIDs, id)
+			}
+		}
+
+		changed, err := receipts.ReassignScannedBy(r.Context(), db, auditSvc, session.UserID, in)
+		if err != nil {
+			msg := "failed to reassign lines"
+			switch {
+			case errors.Is(err, receipts.ErrNoLinesSelected), errors.Is(err, receipts.ErrReasonRequired),
+				errors.Is(err, receipts.ErrReasonTooLong), errors.Is(err, receipts.ErrScannerNotFound),
+				errors.Is(err, receipts.ErrLineNotFound), errors.Is(err, phase.ErrClosed):
+				msg = err.Error()
+			default:
+				slog.Error("reassign scanned by failed", slog.Int64("pallet_id", palletID), slog.Any("err", err))
+			}
+			http.Redirect(w, r, pageURL(palletID)+"?error="+url.QueryEscape(msg), http.StatusSeeOther)
+			return
+		}
+		status := "1 line reassigned"
+		if changed != 1 {
+			status = fmt.Sprintf("%d lines reassigned", changed)
+		}
+		http.Redirect(w, r, pageURL(palletID)+"?status="+url.QueryEscape(status), http.StatusSeeOther)
+	}
+}
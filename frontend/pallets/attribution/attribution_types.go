@@ -0,0 +1,28 @@
+package attribution
+
+type LineView struct {
+	ID          int64  `bun:"id"`
+	SKU         string `bun:"sku"`
+	Description string `bun:"description"`
+	Qty         int64  `bun:"qty"`
+	BatchNumber string `bun:"batch_number"`
+	ScannedBy   string `bun:"scanned_by"`
+	ScannedAt   string `bun:"scanned_at"`
+}
+
+type UserOption struct {
+	ID       int64  `bun:"id"`
+	Username string `bun:"username"`
+	Role     string `bun:"role"`
+}
+
+type PageData struct {
+	PalletID     int64
+	ProjectID    int64
+	ProjectName  string
+	ProjectCode  string
+	Lines        []LineView
+	Users        []UserOption
+	Status       string
+	ErrorMessage string
+}
@@ -0,0 +1,142 @@
+package labels
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/cache"
+	"receipter/infrastructure/delivery"
+	"receipter/infrastructure/renderpool"
+	"receipter/infrastructure/sqlite"
+	"receipter/infrastructure/stepup"
+)
+
+// PrintClosedPalletLabelsBatchCommandHandler prints the closed labels of the
+// selected pallets of the active project as one PDF, in pallet order. Closed
+// pallets become labelled, and each pallet gets a print run in the batch.
+func PrintClosedPalletLabelsBatchCommandHandler(db *sqlite.DB, sessionCache cache.SessionStore, auditSvc *audit.Service, deliveries *delivery.Worker, renders *renderpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok || session.ActiveProjectID == nil || *session.ActiveProjectID <= 0 {
+			http.Error(w, "no active project selected", http.StatusForbidden)
+			return
+		}
+		projectID := *session.ActiveProjectID
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form data", http.StatusBadRequest)
+			return
+		}
+		palletIDs, err := parseSelectedPalletIDs(r.Form)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		for _, id := range palletIDs {
+			pallet, err := LoadPalletByID(r.Context(), db, id)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					http.Error(w, fmt.Sprintf("pallet P%08d not found", id), http.StatusNotFound)
+					return
+				}
+				http.Error(w, "failed to load pallet", http.StatusInternalServerError)
+				return
+			}
+			if pallet.ProjectID != projectID {
+				http.Error(w, fmt.Sprintf("pallet P%08d not found", id), http.StatusNotFound)
+				return
+			}
+		}
+
+		confirmed, err := stepup.Require(r.Context(), db, auditSvc, &session, projectID, palletIDs[0], stepup.ActionPrintClosedLabel, r.FormValue("step_up_secret"))
+		if err != nil {
+			if stepup.UserError(err) {
+				http.Redirect(w, r, "/tasker/pallets/progress?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "failed to confirm re-authentication", http.StatusInternalServerError)
+			return
+		}
+		if confirmed {
+			sessionCache.AddSession(session)
+		}
+
+		labels := make([]ClosedPalletLabelData, 0, len(palletIDs))
+		for _, id := range palletIDs {
+			labelData, err := LoadClosedPalletLabelsData(r.Context(), db, id)
+			if err != nil {
+				if errors.Is(err, ErrPalletNotClosed) {
+					http.Error(w, fmt.Sprintf("pallet P%08d must be closed or labelled to print its label", id), http.StatusConflict)
+					return
+				}
+				http.Error(w, "failed to load pallet label", http.StatusInternalServerError)
+				return
+			}
+			labels = append(labels, labelData...)
+		}
+		var pdfBytes []byte
+		err = renders.Do(r.Context(), func() error {
+			var err error
+			pdfBytes, err = renderClosedPalletLabelsPDF(labels)
+			return err
+		})
+		if writeRenderRefused(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to build closed pallet label pdf", http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := MarkPalletsLabelled(r.Context(), db, auditSvc, session.UserID, palletIDs); err != nil {
+			if errors.Is(err, ErrPalletNotClosed) {
+				http.Error(w, "every selected pallet must be closed or labelled to print its label", http.StatusConflict)
+				return
+			}
+			http.Error(w, "failed to set pallet status", http.StatusInternalServerError)
+			return
+		}
+		deliveries.Notify()
+
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=closed-labels-%d-pallets.pdf", len(palletIDs)))
+		_, _ = w.Write(pdfBytes)
+	}
+}
+
+// parseSelectedPalletIDs reads the comma-separated pallet_ids of a bulk
+// action, without repeats and in pallet order.
+func parseSelectedPalletIDs(form url.Values) ([]int64, error) {
+	ids := make([]int64, 0)
+	for _, raw := range form["pallet_ids"] {
+		for _, part := range strings.Split(raw, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			id, err := strconv.ParseInt(part, 10, 64)
+			if err != nil || id <= 0 {
+				return nil, errors.New("invalid pallet ids")
+			}
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("select at least one pallet")
+	}
+	if len(ids) > MaxPalletsPerRequest {
+		return nil, fmt.Errorf("select at most %d pallets", MaxPalletsPerRequest)
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
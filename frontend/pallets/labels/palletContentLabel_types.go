@@ -1,5 +1,10 @@
 package labels
 
+import (
+	"receipter/infrastructure/customfield"
+	"receipter/infrastructure/fieldcrypt"
+)
+
 type ContentLine struct {
 	ID                int64  `bun:"id"`
 	SKU               string `bun:"sku"`
@@ -14,10 +19,13 @@ type ContentLine struct {
 	CaseSize          int64  `bun:"case_size"`
 	UnknownSKU        bool   `bun:"unknown_sku"`
 	Damaged           bool   `bun:"damaged"`
+	DamageReason      string `bun:"damage_reason"`
 	BatchNumber       string `bun:"batch_number"`
 	ExpiryDateUK      string `bun:"expiry_date"`
 	Expired           bool   `bun:"expired"`
 	ScannedBy         string `bun:"scanned_by"`
+	// Captures counts the scans merged into the line, from its audit trail.
+	Captures int64 `bun:"captures"`
 }
 
 type ContentLineDetail struct {
@@ -33,17 +41,23 @@ type ContentLineDetail struct {
 	CaseSize        int64
 	UnknownSKU      bool
 	Damaged         bool
+	DamageReason    string
 	BatchNumber     string
 	ExpiryDateUK    string
 	Expired         bool
 	ScannedBy       string
 	HasPrimaryPhoto bool
 	PhotoIDs        []int64
-	ClientComments  []ContentLineClientComment
+	// PrimaryPhotoInternal and InternalPhotoIDs mark the photos held back
+	// from client users; see photovisibility.
+	PrimaryPhotoInternal bool
+	InternalPhotoIDs     map[int64]bool
+	CustomValues         []customfield.Value
+	ClientComments       []ContentLineClientComment
 }
 
 type ContentLineClientComment struct {
-	Comment     string
+	Comment     fieldcrypt.String
 	Actor       string
 	CreatedAtUK string
 }
@@ -54,3 +68,28 @@ type PalletEvent struct {
 	Action      string
 	Details     string
 }
+
+// ContentLineHistoryEntry is one audited change to a receipt line, newest first.
+type ContentLineHistoryEntry struct {
+	TimestampUK string
+	Actor       string
+	Action      string
+	Changes     []ContentLineFieldChange
+}
+
+// ContentLineCapture is one scan that created a receipt line or was merged
+// into it, oldest first.
+type ContentLineCapture struct {
+	TimestampUK string
+	Actor       string
+	Action      string
+	Qty         int64
+	// RunningQty is the line's quantity after this capture.
+	RunningQty int64
+}
+
+type ContentLineFieldChange struct {
+	Field  string
+	Before string
+	After  string
+}
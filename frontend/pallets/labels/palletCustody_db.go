@@ -0,0 +1,263 @@
+package labels
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/custody"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/palletlabel"
+	"receipter/infrastructure/sqlite"
+)
+
+// custodyActions names the audited pallet actions that change who holds a
+// pallet or what state it is handed over in.
+var custodyActions = map[string]string{
+	"pallet.create":     "Created",
+	"pallet.close":      "Closed",
+	"pallet.reopen":     "Reopened",
+	"pallet.cancel":     "Cancelled",
+	"pallet.verify":     "Verified",
+	"pallet.label":      "Labelled",
+	"pallet.label_void": "Label voided",
+}
+
+// LoadPalletCustody gathers one pallet's chain of custody.
+func LoadPalletCustody(ctx context.Context, db *sqlite.DB, palletID int64, generatedBy string, now time.Time) (custody.Document, error) {
+	doc := custody.Document{GeneratedBy: generatedBy, GeneratedAt: now}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var projectID int64
+		if err := tx.NewRaw(`SELECT project_id FROM pallets WHERE id = ?`, palletID).Scan(ctx, &projectID); err != nil {
+			return err
+		}
+		return loadCustody(ctx, tx, &doc, projectID, []int64{palletID})
+	})
+	return doc, err
+}
+
+// LoadDeliveryCustody gathers the chain of custody of every pallet of a
+// project's delivery. An empty reference is the pallets without one.
+func LoadDeliveryCustody(ctx context.Context, db *sqlite.DB, projectID int64, reference, generatedBy string, now time.Time) (custody.Document, error) {
+	doc := custody.Document{DeliveryReference: reference, GeneratedBy: generatedBy, GeneratedAt: now}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		palletIDs := make([]int64, 0)
+		if err := tx.NewRaw(`
+SELECT p.id
+FROM pallets p
+LEFT JOIN pallet_attributes pa ON pa.pallet_id = p.id
+WHERE p.project_id = ? AND COALESCE(pa.delivery_reference, '') = ?
+ORDER BY p.id`, projectID, reference).Scan(ctx, &palletIDs); err != nil {
+			return err
+		}
+		if len(palletIDs) == 0 {
+			return sql.ErrNoRows
+		}
+		return loadCustody(ctx, tx, &doc, projectID, palletIDs)
+	})
+	return doc, err
+}
+
+func loadCustody(ctx context.Context, tx bun.Tx, doc *custody.Document, projectID int64, palletIDs []int64) error {
+	if err := tx.NewRaw(`SELECT name, client_name FROM projects WHERE id = ?`, projectID).
+		Scan(ctx, &doc.ProjectName, fieldcrypt.Dest(&doc.ClientName)); err != nil {
+		return err
+	}
+	for _, palletID := range palletIDs {
+		pallet, err := loadCustodyPallet(ctx, tx, palletID)
+		if err != nil {
+			return err
+		}
+		doc.Pallets = append(doc.Pallets, pallet)
+	}
+	return nil
+}
+
+func loadCustodyPallet(ctx context.Context, tx bun.Tx, palletID int64) (custody.Pallet, error) {
+	pallet := custody.Pallet{ID: palletID}
+	if err := tx.NewRaw(`
+SELECT p.status, p.created_at, COALESCE(pa.delivery_reference, '')
+FROM pallets p
+LEFT JOIN pallet_attributes pa ON pa.pallet_id = p.id
+WHERE p.id = ?`, palletID).Scan(ctx, &pallet.Status, &pallet.CreatedAt, &pallet.DeliveryReference); err != nil {
+		return pallet, err
+	}
+
+	type lineRow struct {
+		ID          int64     `bun:"id"`
+		SKU         string    `bun:"sku"`
+		Description string    `bun:"description"`
+		BatchNumber string    `bun:"batch_number"`
+		Qty         int64     `bun:"qty"`
+		ScannedBy   string    `bun:"scanned_by"`
+		CreatedAt   time.Time `bun:"created_at"`
+	}
+	lines := make([]lineRow, 0)
+	if err := tx.NewRaw(`
+SELECT pr.id, pr.sku, pr.description, COALESCE(pr.batch_number, '') AS batch_number, pr.qty,
+       COALESCE(u.username, '') AS scanned_by, pr.created_at
+FROM pallet_receipts pr
+LEFT JOIN users u ON u.id = pr.scanned_by_user_id
+WHERE pr.pallet_id = ?
+ORDER BY pr.created_at, pr.id`, palletID).Scan(ctx, &lines); err != nil {
+		return pallet, err
+	}
+	for _, l := range lines {
+		pallet.Lines = append(pallet.Lines, custody.Line{
+			ReceiptID:   l.ID,
+			SKU:         l.SKU,
+			Description: l.Description,
+			BatchNumber: l.BatchNumber,
+			Qty:         l.Qty,
+			ScannedBy:   l.ScannedBy,
+			ScannedAt:   l.CreatedAt,
+		})
+	}
+
+	type auditRow struct {
+		ID         int64     `bun:"id"`
+		Action     string    `bun:"action"`
+		EntityType string    `bun:"entity_type"`
+		EntityID   string    `bun:"entity_id"`
+		BeforeJSON string    `bun:"before_json"`
+		AfterJSON  string    `bun:"after_json"`
+		CreatedAt  time.Time `bun:"created_at"`
+		Actor      string    `bun:"actor"`
+	}
+	rows := make([]auditRow, 0)
+	palletPattern := fmt.Sprintf(`%%"PalletID":%d%%`, palletID)
+	if err := tx.NewRaw(`
+SELECT al.id, al.action, al.entity_type, al.entity_id, al.before_json, al.after_json, al.created_at,
+       COALESCE(u.username, '') AS actor
+FROM audit_logs al
+LEFT JOIN users u ON u.id = al.user_id
+WHERE (al.entity_type = 'pallets' AND al.entity_id = ?)
+   OR (al.entity_type = 'pallets' AND al.action = 'pallet.create' AND json_valid(al.after_json) = 1
+       AND EXISTS (SELECT 1 FROM json_each(al.after_json, '$.pallet_ids') WHERE value = ?))
+   OR (al.entity_type = 'pallet_receipts'
+       AND al.action IN ('receipt.transfer', 'receipt.transfer_out', 'receipt.transfer_in')
+       AND (al.before_json LIKE ? OR al.after_json LIKE ?))
+ORDER BY al.created_at, al.id`, strconv.FormatInt(palletID, 10), palletID, palletPattern, palletPattern).Scan(ctx, &rows); err != nil {
+		return pallet, err
+	}
+	created := false
+	for _, row := range rows {
+		event := custody.Event{At: row.CreatedAt, User: row.Actor}
+		if row.EntityType == "pallets" {
+			label, ok := custodyActions[row.Action]
+			if !ok {
+				continue
+			}
+			created = created || row.Action == "pallet.create"
+			event.Event = label
+			event.Details = custodyPalletDetails(row.Action, row.BeforeJSON, row.AfterJSON)
+		} else {
+			var ok bool
+			event.Event, event.Details, ok = custodyMoveDetails(palletID, row.Action, row.EntityID, row.BeforeJSON, row.AfterJSON)
+			if !ok {
+				continue
+			}
+		}
+		pallet.Events = append(pallet.Events, event)
+	}
+	if !created {
+		pallet.Events = append(pallet.Events, custody.Event{At: pallet.CreatedAt, Event: "Created"})
+	}
+
+	type labelRow struct {
+		Serial    int64     `bun:"serial"`
+		PrintedBy string    `bun:"printed_by"`
+		PrintedAt time.Time `bun:"printed_at"`
+	}
+	labels := make([]labelRow, 0)
+	if err := tx.NewRaw(`
+SELECT li.serial, COALESCE(u.username, '') AS printed_by, li.printed_at
+FROM pallet_label_instances li
+LEFT JOIN users u ON u.id = li.printed_by_user_id
+WHERE li.pallet_id = ?`, palletID).Scan(ctx, &labels); err != nil {
+		return pallet, err
+	}
+	for _, l := range labels {
+		pallet.Events = append(pallet.Events, custody.Event{
+			At:      l.PrintedAt,
+			User:    l.PrintedBy,
+			Event:   "Label printed",
+			Details: palletlabel.Code(palletID, l.Serial),
+		})
+	}
+	sort.SliceStable(pallet.Events, func(i, j int) bool {
+		return pallet.Events[i].At.Before(pallet.Events[j].At)
+	})
+	return pallet, nil
+}
+
+func custodyPalletDetails(action, beforeJSON, afterJSON string) string {
+	switch action {
+	case "pallet.label_void":
+		var payload struct {
+			Labels []string `json:"labels"`
+			Reason string   `json:"reason"`
+		}
+		if json.Unmarshal([]byte(afterJSON), &payload) != nil {
+			return ""
+		}
+		details := strings.Join(payload.Labels, ", ")
+		if payload.Reason != "" {
+			details += " - " + payload.Reason
+		}
+		return details
+	case "pallet.verify":
+		var payload struct {
+			Lines int `json:"lines"`
+			Scans int `json:"scans"`
+		}
+		if json.Unmarshal([]byte(afterJSON), &payload) != nil {
+			return ""
+		}
+		return fmt.Sprintf("%d lines checked with %d scans", payload.Lines, payload.Scans)
+	}
+	before, hasBefore := parsePalletAuditSnapshot(beforeJSON)
+	after, hasAfter := parsePalletAuditSnapshot(afterJSON)
+	if hasBefore && hasAfter && before.Status != "" && after.Status != "" && before.Status != after.Status {
+		return fmt.Sprintf("Status changed from %s to %s", before.Status, after.Status)
+	}
+	return ""
+}
+
+// custodyTransferSnapshot is the part of a transfer's audited line that
+// says where stock moved between.
+type custodyTransferSnapshot struct {
+	PalletID     int64  `json:"PalletID"`
+	SKU          string `json:"SKU"`
+	Qty          int64  `json:"Qty"`
+	FromPalletID int64  `json:"FromPalletID"`
+	ToPalletID   int64  `json:"ToPalletID"`
+}
+
+// custodyMoveDetails describes stock moved on or off palletID by a
+// transfer, or reports false when the entry is about another pallet.
+func custodyMoveDetails(palletID int64, action, entityID, beforeJSON, afterJSON string) (string, string, bool) {
+	var before, after custodyTransferSnapshot
+	_ = json.Unmarshal([]byte(beforeJSON), &before)
+	if json.Unmarshal([]byte(afterJSON), &after) != nil {
+		return "", "", false
+	}
+	switch {
+	case action == "receipt.transfer" && before.PalletID == palletID:
+		return "Moved out", fmt.Sprintf("Line %s, %s qty %d to P%08d", entityID, after.SKU, after.Qty, after.PalletID), true
+	case action == "receipt.transfer" && after.PalletID == palletID:
+		return "Moved in", fmt.Sprintf("Line %s, %s qty %d from P%08d", entityID, after.SKU, after.Qty, after.FromPalletID), true
+	case action == "receipt.transfer_out" && after.PalletID == palletID:
+		return "Moved out", fmt.Sprintf("Line %s, %s qty %d to P%08d", entityID, after.SKU, before.Qty-after.Qty, after.ToPalletID), true
+	case action == "receipt.transfer_in" && after.PalletID == palletID:
+		return "Moved in", fmt.Sprintf("Line %s, %s qty %d from P%08d", entityID, after.SKU, after.Qty, after.FromPalletID), true
+	}
+	return "", "", false
+}
@@ -0,0 +1,75 @@
+package labels
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoadPalletCustody_CollectsEventsLinesAndLabels(t *testing.T) {
+	db := openLabelsTestDB(t)
+	ctx := context.Background()
+
+	if _, err := db.W.ExecContext(ctx, `
+INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin'), (2, 'scanner1', 'hash', 'scanner');
+INSERT INTO pallets (id, project_id, status, created_at) VALUES (1, 1, 'labelled', '2026-03-01 08:00:00'), (2, 1, 'open', '2026-03-01 08:00:00');
+INSERT INTO pallet_attributes (pallet_id, delivery_reference) VALUES (1, 'DEL-1'), (2, 'DEL-1');
+INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, created_at) VALUES
+  (10, 1, 1, 'SKU1', 'Item 1', 2, 5, '2026-03-01 09:00:00'),
+  (11, 1, 2, 'SKU2', 'Item 2', 2, 3, '2026-03-01 09:30:00');
+INSERT INTO audit_logs (user_id, action, entity_type, entity_id, before_json, after_json, created_at) VALUES
+  (1, 'pallet.create', 'pallets', '1', '', '{"pallet_ids":[1,2]}', '2026-03-01 08:00:00'),
+  (2, 'pallet.close', 'pallets', '1', '{"ID":1,"Status":"open"}', '{"ID":1,"Status":"closed"}', '2026-03-01 10:00:00'),
+  (1, 'receipt.transfer', 'pallet_receipts', '12', '{"PalletID":1,"SKU":"SKU3","Qty":2}', '{"PalletID":2,"SKU":"SKU3","Qty":2,"FromPalletID":1}', '2026-03-01 09:45:00');
+INSERT INTO pallet_label_instances (pallet_id, serial, printed_by_user_id, printed_at) VALUES (1, 1, 1, '2026-03-01 10:05:00');
+`); err != nil {
+		t.Fatalf("seed custody data: %v", err)
+	}
+
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	doc, err := LoadPalletCustody(ctx, db, 1, "admin", now)
+	if err != nil {
+		t.Fatalf("load pallet custody: %v", err)
+	}
+	if doc.ProjectName != "Labels Test" || doc.ClientName != "Test Client" || len(doc.Pallets) != 1 {
+		t.Fatalf("document = %+v", doc)
+	}
+	pallet := doc.Pallets[0]
+	if pallet.DeliveryReference != "DEL-1" || len(pallet.Lines) != 1 || pallet.Lines[0].ScannedBy != "scanner1" {
+		t.Fatalf("pallet = %+v", pallet)
+	}
+	want := []string{"Created", "Moved out", "Closed", "Label printed"}
+	if len(pallet.Events) != len(want) {
+		t.Fatalf("events = %+v, want %v", pallet.Events, want)
+	}
+	for i, event := range pallet.Events {
+		if event.Event != want[i] {
+			t.Fatalf("event %d = %q, want %q", i, event.Event, want[i])
+		}
+	}
+	if pallet.Events[2].Details != "Status changed from open to closed" || pallet.Events[2].User != "scanner1" {
+		t.Fatalf("close event = %+v", pallet.Events[2])
+	}
+	if got := doc.FileName(); got != "custody-p00000001.pdf" {
+		t.Fatalf("file name = %q", got)
+	}
+
+	delivery, err := LoadDeliveryCustody(ctx, db, 1, "DEL-1", "admin", now)
+	if err != nil {
+		t.Fatalf("load delivery custody: %v", err)
+	}
+	if len(delivery.Pallets) != 2 || delivery.Pallets[1].ID != 2 {
+		t.Fatalf("delivery pallets = %+v", delivery.Pallets)
+	}
+	// Pallet 2 was created by the same bulk create and received the moved line.
+	second := delivery.Pallets[1].Events
+	if len(second) != 2 || second[0].Event != "Created" || second[0].User != "admin" || second[1].Event != "Moved in" {
+		t.Fatalf("second pallet events = %+v", second)
+	}
+
+	if _, err := LoadDeliveryCustody(ctx, db, 1, "DEL-9", "admin", now); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("unknown delivery err = %v, want sql.ErrNoRows", err)
+	}
+}
@@ -0,0 +1,80 @@
+package labels
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/custody"
+	"receipter/infrastructure/sqlite"
+)
+
+// PalletCustodyPDFHandler renders a pallet's chain-of-custody document.
+func PalletCustodyPDFHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "invalid pallet id", http.StatusBadRequest)
+			return
+		}
+		doc, err := LoadPalletCustody(r.Context(), db, id, custodyGeneratedBy(r), time.Now().UTC())
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "pallet not found", http.StatusNotFound)
+				return
+			}
+			slog.Error("pallet custody: load failed", slog.Int64("pallet_id", id), slog.Any("err", err))
+			http.Error(w, "failed to load pallet custody", http.StatusInternalServerError)
+			return
+		}
+		writeCustodyPDF(w, doc)
+	}
+}
+
+// DeliveryCustodyPDFHandler renders the chain-of-custody document of every
+// pallet of the project's delivery named by the delivery query value.
+func DeliveryCustodyPDFHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Error(w, "invalid project id", http.StatusBadRequest)
+			return
+		}
+		doc, err := LoadDeliveryCustody(r.Context(), db, projectID, r.URL.Query().Get("delivery"), custodyGeneratedBy(r), time.Now().UTC())
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "delivery not found", http.StatusNotFound)
+				return
+			}
+			slog.Error("delivery custody: load failed", slog.Int64("project_id", projectID), slog.Any("err", err))
+			http.Error(w, "failed to load delivery custody", http.StatusInternalServerError)
+			return
+		}
+		writeCustodyPDF(w, doc)
+	}
+}
+
+func custodyGeneratedBy(r *http.Request) string {
+	if session, ok := sessioncontext.GetSessionFromContext(r.Context()); ok {
+		return session.User.Username
+	}
+	return ""
+}
+
+func writeCustodyPDF(w http.ResponseWriter, doc custody.Document) {
+	pdfBytes, err := custody.RenderPDF(doc)
+	if err != nil {
+		slog.Error("custody: render pdf failed", slog.Any("err", err))
+		http.Error(w, "failed to render custody report", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "inline; filename="+doc.FileName())
+	_, _ = w.Write(pdfBytes)
+}
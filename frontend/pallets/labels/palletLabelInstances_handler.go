@@ -0,0 +1,193 @@
+package labels
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/palletlabel"
+	"receipter/infrastructure/sqlite"
+)
+
+// PalletLabelInstancesPageData is the list of a pallet's printed ID labels.
+type PalletLabelInstancesPageData struct {
+	PalletID     int64
+	PalletStatus string
+	Labels       []palletlabel.Instance
+	Status       string
+	ErrorMessage string
+}
+
+// PalletLabelInstancesPageQueryHandler lists the ID labels printed for a
+// pallet with their serials, so a damaged one can be voided and reissued.
+func PalletLabelInstancesPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "invalid pallet id", http.StatusBadRequest)
+			return
+		}
+		pallet, err := LoadPalletByID(r.Context(), db, id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "pallet not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to load pallet", http.StatusInternalServerError)
+			return
+		}
+		instances, err := palletlabel.List(r.Context(), db, pallet.ID)
+		if err != nil {
+			http.Error(w, "failed to load pallet labels", http.StatusInternalServerError)
+			return
+		}
+		data := PalletLabelInstancesPageData{
+			PalletID:     pallet.ID,
+			PalletStatus: pallet.Status,
+			Labels:       instances,
+			Status:       r.URL.Query().Get("status"),
+			ErrorMessage: r.URL.Query().Get("error"),
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := PalletLabelInstancesPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render pallet labels", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// VoidPalletLabelCommandHandler voids one printed label.
+func VoidPalletLabelCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "invalid pallet id", http.StatusBadRequest)
+			return
+		}
+		serial, err := strconv.ParseInt(chi.URLParam(r, "serial"), 10, 64)
+		if err != nil || serial <= 0 {
+			http.Error(w, "invalid label serial", http.StatusBadRequest)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form data", http.StatusBadRequest)
+			return
+		}
+		pageURL := fmt.Sprintf("/tasker/pallets/%d/labels", id)
+		session, _ := sessioncontext.GetSessionFromContext(r.Context())
+		err = palletlabel.Void(r.Context(), db, auditSvc, session.UserID, id, serial, r.FormValue("reason"))
+		switch {
+		case errors.Is(err, palletlabel.ErrNotFound), errors.Is(err, palletlabel.ErrAlreadyVoided), errors.Is(err, palletlabel.ErrReasonTooLong):
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		case err != nil:
+			http.Error(w, "failed to void pallet label", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, pageURL+"?status="+url.QueryEscape(palletlabel.Code(id, serial)+" voided"), http.StatusSeeOther)
+	}
+}
+
+// ReissuePalletLabelCommandHandler voids the pallet's valid labels and
+// prints a replacement.
+func ReissuePalletLabelCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "invalid pallet id", http.StatusBadRequest)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form data", http.StatusBadRequest)
+			return
+		}
+		if _, err := LoadPalletByID(r.Context(), db, id); err != nil {
+			http.Error(w, "pallet not found", http.StatusNotFound)
+			return
+		}
+		reason := r.FormValue("reason")
+		if reason == "" {
+			reason = "reissued"
+		}
+		session, _ := sessioncontext.GetSessionFromContext(r.Context())
+		if _, err := palletlabel.VoidActive(r.Context(), db, auditSvc, session.UserID, id, reason); err != nil {
+			if errors.Is(err, palletlabel.ErrReasonTooLong) {
+				http.Redirect(w, r, fmt.Sprintf("/tasker/pallets/%d/labels?error=%s", id, url.QueryEscape(err.Error())), http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "failed to void pallet labels", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/tasker/pallets/%d/label", id), http.StatusSeeOther)
+	}
+}
+
+type palletLookupResponse struct {
+	PalletID   int64  `json:"palletId"`
+	Label      string `json:"label"`
+	ReceiptURL string `json:"receiptUrl"`
+	Warning    string `json:"warning,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// PalletLookupQueryHandler resolves a scanned pallet label for the scan page
+// and warns when the label was voided.
+func PalletLookupQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := r.URL.Query().Get("code")
+		scan, err := palletlabel.Lookup(r.Context(), db, code)
+		if err != nil {
+			switch {
+			case errors.Is(err, palletlabel.ErrInvalidCode):
+				writeLookupJSON(w, http.StatusBadRequest, palletLookupResponse{Error: "Invalid pallet code"})
+			case errors.Is(err, palletlabel.ErrNotFound):
+				writeLookupJSON(w, http.StatusNotFound, palletLookupResponse{Error: "This label was never printed"})
+			default:
+				writeLookupJSON(w, http.StatusInternalServerError, palletLookupResponse{Error: "Failed to look up pallet"})
+			}
+			return
+		}
+		if _, err := LoadPalletByID(r.Context(), db, scan.PalletID); err != nil {
+			writeLookupJSON(w, http.StatusNotFound, palletLookupResponse{Error: "Pallet not found"})
+			return
+		}
+
+		resp := palletLookupResponse{
+			PalletID:   scan.PalletID,
+			Label:      palletlabel.Code(scan.PalletID, scan.Serial),
+			ReceiptURL: fmt.Sprintf("/tasker/pallets/%d/receipt", scan.PalletID),
+		}
+		if scan.Voided {
+			resp.Warning = fmt.Sprintf("Label %s was voided on %s", resp.Label, scan.Label.VoidedAt.Local().Format("02/01/2006 15:04"))
+			if scan.Label.VoidReason != "" {
+				resp.Warning += " (" + scan.Label.VoidReason + ")"
+			}
+			if scan.Current != nil {
+				resp.Warning += fmt.Sprintf(". The valid label is %s; remove the void one from the pallet.", scan.Current.Code())
+			} else {
+				resp.Warning += ". The pallet has no valid label; print a new one."
+			}
+			session, _ := sessioncontext.GetSessionFromContext(r.Context())
+			slog.Warn("void pallet label scanned", slog.String("label", resp.Label), slog.Int64("user_id", session.UserID))
+		}
+		writeLookupJSON(w, http.StatusOK, resp)
+	}
+}
+
+func writeLookupJSON(w http.ResponseWriter, status int, body palletLookupResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("pallet lookup: write response failed", slog.Any("err", err))
+	}
+}
@@ -2,7 +2,9 @@ package labels
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,16 +12,44 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/mattn/go-sqlite3"
 	"github.com/uptrace/bun"
 
 	"receipter/infrastructure/audit"
+	"receipter/infrastructure/clientwebhook"
+	"receipter/infrastructure/customfield"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/labelbarcode"
+	"receipter/infrastructure/labeltext"
+	"receipter/infrastructure/phase"
+	"receipter/infrastructure/photovisibility"
 	"receipter/infrastructure/sqlite"
 	"receipter/models"
 )
 
 var ErrPalletNotClosed = errors.New("pallet is not closed or labelled")
 
+const (
+	// MaxPalletsPerRequest bounds bulk pallet creation.
+	MaxPalletsPerRequest       = 500
+	maxPalletTypeLength        = 40
+	maxDeliveryReferenceLength = 100
+)
+
+var (
+	ErrPalletCountOutOfRange    = fmt.Errorf("count must be between 1 and %d", MaxPalletsPerRequest)
+	ErrPalletTypeTooLong        = fmt.Errorf("palletType must be %d characters or fewer", maxPalletTypeLength)
+	ErrDeliveryReferenceTooLong = fmt.Errorf("deliveryReference must be %d characters or fewer", maxDeliveryReferenceLength)
+)
+
+// PalletAttributesInput carries optional attributes for pre-created pallets.
+type PalletAttributesInput struct {
+	PalletType        string
+	DeliveryReference string
+}
+
 type ClosedPalletLabelData struct {
 	PalletID     int64
 	ClientName   string
@@ -32,6 +62,11 @@ type ClosedPalletLabelData struct {
 	BoxCount     int64
 	QtyPerCarton int64
 	TotalQty     int64
+	// Language selects the caption language; it defaults to the project's label language.
+	Language string
+	// Symbology is the project's barcode symbology. BarcodeValue is empty
+	// when no scanned barcode fits it.
+	Symbology string
 }
 
 type closedLabelReceiptRow struct {
@@ -60,19 +95,69 @@ type closedLabelGroup struct {
 	Label      ClosedPalletLabelData
 }
 
-func nextPalletID(ctx context.Context, tx bun.Tx) (int64, error) {
-	var id int64
-	row := tx.NewRaw("SELECT COALESCE(MAX(id), 0) + 1 FROM pallets")
-	if err := row.Scan(ctx, &id); err != nil {
-		return 0, err
+const (
+	palletSequence = "pallets"
+	// maxPalletIDAttempts bounds retries when a reserved id is already taken
+	// by a pallet written without the sequence, such as a restored backup.
+	maxPalletIDAttempts = 5
+)
+
+// reservePalletIDs advances the pallet sequence by count and returns the
+// first id of the reserved block. Ids are never handed out twice, even after
+// the pallet holding the highest id is deleted.
+func reservePalletIDs(ctx context.Context, tx bun.Tx, count int) (int64, error) {
+	var last int64
+	err := tx.NewRaw(`UPDATE id_sequences SET last_value = last_value + ? WHERE name = ? RETURNING last_value`, count, palletSequence).Scan(ctx, &last)
+	if err != nil {
+		return 0, fmt.Errorf("reserve pallet ids: %w", err)
+	}
+	return last - int64(count) + 1, nil
+}
+
+// syncPalletSequence moves the sequence past every existing pallet.
+func syncPalletSequence(ctx context.Context, tx bun.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+UPDATE id_sequences
+SET last_value = MAX(last_value, (SELECT COALESCE(MAX(id), 0) FROM pallets))
+WHERE name = ?`, palletSequence)
+	return err
+}
+
+func isPalletIDConflict(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+}
+
+// withNewPalletIDs reserves count consecutive pallet ids and runs fn with the
+// first of them in the same write transaction. When an id turns out to be
+// taken the transaction is rolled back, the sequence resynced and fn run
+// again, so fn must not keep state from a failed attempt.
+func withNewPalletIDs(ctx context.Context, db *sqlite.DB, count int, fn func(ctx context.Context, tx bun.Tx, firstID int64) error) error {
+	for attempt := 1; ; attempt++ {
+		err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+			if attempt > 1 {
+				if err := syncPalletSequence(ctx, tx); err != nil {
+					return err
+				}
+			}
+			firstID, err := reservePalletIDs(ctx, tx, count)
+			if err != nil {
+				return err
+			}
+			return fn(ctx, tx, firstID)
+		})
+		if err == nil || !isPalletIDConflict(err) || attempt == maxPalletIDAttempts {
+			return err
+		}
 	}
-	return id, nil
 }
 
 func insertPallet(ctx context.Context, tx bun.Tx, id, projectID int64) (models.Pallet, error) {
 	pallet := models.Pallet{ID: id, ProjectID: projectID, Status: "created"}
-	_, err := tx.NewInsert().Model(&pallet).Exec(ctx)
-	return pallet, err
+	if _, err := tx.NewInsert().Model(&pallet).Exec(ctx); err != nil {
+		return pallet, err
+	}
+	return pallet, phase.AssignTx(ctx, tx, projectID, id)
 }
 
 func loadPalletByID(ctx context.Context, tx bun.Tx, id int64) (models.Pallet, error) {
@@ -83,11 +168,8 @@ func loadPalletByID(ctx context.Context, tx bun.Tx, id int64) (models.Pallet, er
 
 func CreateNextPallet(ctx context.Context, db *sqlite.DB, projectID int64) (models.Pallet, error) {
 	var pallet models.Pallet
-	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
-		id, err := nextPalletID(ctx, tx)
-		if err != nil {
-			return err
-		}
+	err := withNewPalletIDs(ctx, db, 1, func(ctx context.Context, tx bun.Tx, id int64) error {
+		var err error
 		pallet, err = insertPallet(ctx, tx, id, projectID)
 		return err
 	})
@@ -98,18 +180,73 @@ func CreateNextPallets(ctx context.Context, db *sqlite.DB, projectID int64, coun
 	if count <= 0 {
 		return []models.Pallet{}, nil
 	}
-	pallets := make([]models.Pallet, 0, count)
-	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
-		nextID, err := nextPalletID(ctx, tx)
-		if err != nil {
-			return err
+	var pallets []models.Pallet
+	err := withNewPalletIDs(ctx, db, count, func(ctx context.Context, tx bun.Tx, nextID int64) error {
+		pallets = make([]models.Pallet, 0, count)
+		for i := 0; i < count; i++ {
+			pallet, err := insertPallet(ctx, tx, nextID+int64(i), projectID)
+			if err != nil {
+				return err
+			}
+			pallets = append(pallets, pallet)
 		}
+		return nil
+	})
+	return pallets, err
+}
+
+// CreatePalletsWithAttributes pre-creates count pallets for a project with the
+// given attributes and records one audit entry for the batch.
+func CreatePalletsWithAttributes(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID int64, count int, attrs PalletAttributesInput) ([]models.Pallet, error) {
+	if count < 1 || count > MaxPalletsPerRequest {
+		return nil, ErrPalletCountOutOfRange
+	}
+	attrs.PalletType = strings.TrimSpace(attrs.PalletType)
+	attrs.DeliveryReference = strings.TrimSpace(attrs.DeliveryReference)
+	if utf8.RuneCountInString(attrs.PalletType) > maxPalletTypeLength {
+		return nil, ErrPalletTypeTooLong
+	}
+	if utf8.RuneCountInString(attrs.DeliveryReference) > maxDeliveryReferenceLength {
+		return nil, ErrDeliveryReferenceTooLong
+	}
+
+	var pallets []models.Pallet
+	err := withNewPalletIDs(ctx, db, count, func(ctx context.Context, tx bun.Tx, nextID int64) error {
+		pallets = make([]models.Pallet, 0, count)
+		ids := make([]int64, 0, count)
 		for i := 0; i < count; i++ {
 			pallet, err := insertPallet(ctx, tx, nextID+int64(i), projectID)
 			if err != nil {
 				return err
 			}
+			if attrs.PalletType != "" || attrs.DeliveryReference != "" {
+				attr := models.PalletAttribute{
+					PalletID:          pallet.ID,
+					PalletType:        attrs.PalletType,
+					DeliveryReference: attrs.DeliveryReference,
+				}
+				if _, err := tx.NewInsert().Model(&attr).Exec(ctx); err != nil {
+					return err
+				}
+			}
 			pallets = append(pallets, pallet)
+			ids = append(ids, pallet.ID)
+		}
+
+		if auditSvc != nil && userID > 0 {
+			entityID := strconv.FormatInt(ids[0], 10)
+			if len(ids) > 1 {
+				entityID = fmt.Sprintf("%d-%d", ids[0], ids[len(ids)-1])
+			}
+			after := map[string]any{
+				"project_id":         projectID,
+				"pallet_ids":         ids,
+				"pallet_type":        attrs.PalletType,
+				"delivery_reference": attrs.DeliveryReference,
+			}
+			if err := auditSvc.Write(ctx, tx, userID, "pallet.create", "pallets", entityID, nil, after); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
@@ -149,13 +286,15 @@ func LoadClosedPalletLabelsData(ctx context.Context, db *sqlite.DB, palletID int
 	labels := make([]ClosedPalletLabelData, 0, 1)
 	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
 		var pallet struct {
-			ProjectID  int64      `bun:"project_id"`
-			Status     string     `bun:"status"`
-			ClientName string     `bun:"client_name"`
-			ClosedAt   *time.Time `bun:"closed_at"`
+			ProjectID     int64             `bun:"project_id"`
+			Status        string            `bun:"status"`
+			ClientName    fieldcrypt.String `bun:"client_name"`
+			LabelLanguage string            `bun:"label_language"`
+			Symbology     string            `bun:"label_symbology"`
+			ClosedAt      *time.Time        `bun:"closed_at"`
 		}
 		if err := tx.NewRaw(`
-SELECT p.project_id, p.status, COALESCE(pj.client_name, '') AS client_name, p.closed_at
+SELECT p.project_id, p.status, COALESCE(pj.client_name, '') AS client_name, COALESCE(pj.label_language, '') AS label_language, COALESCE(pj.label_symbology, '') AS label_symbology, p.closed_at
 FROM pallets p
 JOIN projects pj ON pj.id = p.project_id
 WHERE p.id = ?`, palletID).Scan(ctx, &pallet); err != nil {
@@ -165,11 +304,19 @@ WHERE p.id = ?`, palletID).Scan(ctx, &pallet); err != nil {
 			return ErrPalletNotClosed
 		}
 
-		clientName := strings.TrimSpace(pallet.ClientName)
+		clientName := strings.TrimSpace(string(pallet.ClientName))
 		if clientName == "" {
 			clientName = "Unknown Client"
 		}
 		base.ClientName = clientName
+		base.Language = labeltext.Normalize(pallet.LabelLanguage)
+		if base.Language == "" {
+			base.Language = labeltext.DefaultLanguage
+		}
+		base.Symbology = labelbarcode.Normalize(pallet.Symbology)
+		if base.Symbology == "" {
+			base.Symbology = labelbarcode.DefaultSymbology
+		}
 
 		labelDate := time.Now()
 		if pallet.ClosedAt != nil && !pallet.ClosedAt.IsZero() {
@@ -231,12 +378,12 @@ func buildClosedLabelGroups(base ClosedPalletLabelData, rows []closedLabelReceip
 			continue
 		}
 		if _, exists := firstItemBarcodeByProduct[productKey]; !exists {
-			if barcode := strings.TrimSpace(row.ItemBarcode); barcode != "" {
+			if barcode := labelbarcode.FirstValid(base.Symbology, row.ItemBarcode); barcode != "" {
 				firstItemBarcodeByProduct[productKey] = barcode
 			}
 		}
 		if _, exists := firstCartonBarcodeByProduct[productKey]; !exists {
-			if barcode := strings.TrimSpace(row.CartonBarcode); barcode != "" {
+			if barcode := labelbarcode.FirstValid(base.Symbology, row.CartonBarcode); barcode != "" {
 				firstCartonBarcodeByProduct[productKey] = barcode
 			}
 		}
@@ -273,7 +420,7 @@ func buildClosedLabelGroups(base ClosedPalletLabelData, rows []closedLabelReceip
 				label.BarcodeValue = barcode
 			} else if barcode := strings.TrimSpace(firstCartonBarcodeByProduct[productKey]); barcode != "" {
 				label.BarcodeValue = barcode
-			} else if barcode := closedLabelRowBarcode(row); barcode != "" {
+			} else if barcode := closedLabelRowBarcode(base.Symbology, row); barcode != "" {
 				label.BarcodeValue = barcode
 			}
 			group = &closedLabelGroup{
@@ -322,53 +469,93 @@ func closedLabelProductKey(row closedLabelReceiptRow) string {
 	return ""
 }
 
-func closedLabelRowBarcode(row closedLabelReceiptRow) string {
-	barcodeValue := strings.TrimSpace(row.ItemBarcode)
-	if barcodeValue == "" {
-		barcodeValue = strings.TrimSpace(row.CartonBarcode)
-	}
-	return barcodeValue
+// closedLabelRowBarcode prefers the item barcode, falling back to the carton
+// barcode, and skips values the project's symbology cannot print.
+func closedLabelRowBarcode(symbology string, row closedLabelReceiptRow) string {
+	return labelbarcode.FirstValid(symbology, row.ItemBarcode, row.CartonBarcode)
 }
 
+// MarkPalletLabelled records a print of one pallet's closed labels, moving
+// a closed pallet to labelled.
 func MarkPalletLabelled(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, palletID int64) error {
 	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
-		before, err := loadPalletByID(ctx, tx, palletID)
-		if err != nil {
+		if err := markPalletLabelledTx(ctx, tx, auditSvc, userID, palletID); err != nil {
 			return err
 		}
-		if before.Status == "labelled" {
-			return nil
-		}
-		if before.Status != "closed" {
-			return ErrPalletNotClosed
-		}
+		return recordClosedLabelPrintTx(ctx, tx, userID, palletID, "", 1)
+	})
+}
 
-		res, err := tx.NewRaw(`UPDATE pallets SET status = 'labelled' WHERE id = ? AND status = 'closed'`, palletID).Exec(ctx)
-		if err != nil {
-			return err
-		}
-		if n, _ := res.RowsAffected(); n == 0 {
-			after, err := loadPalletByID(ctx, tx, palletID)
-			if err != nil {
+// MarkPalletsLabelled records one batch print of closed labels for several
+// pallets, in the order given: every closed pallet becomes labelled and each
+// pallet gets its own print run under a shared batch id. Nothing is recorded
+// if any pallet is not closed or labelled.
+func MarkPalletsLabelled(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID int64, palletIDs []int64) (string, error) {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	batchID := hex.EncodeToString(buf)
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for i, palletID := range palletIDs {
+			if err := markPalletLabelledTx(ctx, tx, auditSvc, userID, palletID); err != nil {
 				return err
 			}
-			if after.Status == "labelled" {
-				return nil
+			if err := recordClosedLabelPrintTx(ctx, tx, userID, palletID, batchID, i+1); err != nil {
+				return err
 			}
-			return ErrPalletNotClosed
 		}
+		return nil
+	})
+	return batchID, err
+}
+
+func recordClosedLabelPrintTx(ctx context.Context, tx bun.Tx, userID, palletID int64, batchID string, position int) error {
+	var printedBy any
+	if userID > 0 {
+		printedBy = userID
+	}
+	_, err := tx.ExecContext(ctx, `
+INSERT INTO closed_label_prints (pallet_id, batch_id, batch_position, printed_by_user_id)
+VALUES (?, ?, ?, ?)`, palletID, batchID, position, printedBy)
+	return err
+}
+
+func markPalletLabelledTx(ctx context.Context, tx bun.Tx, auditSvc *audit.Service, userID, palletID int64) error {
+	before, err := loadPalletByID(ctx, tx, palletID)
+	if err != nil {
+		return err
+	}
+	if before.Status == "labelled" {
+		return nil
+	}
+	if before.Status != "closed" {
+		return ErrPalletNotClosed
+	}
 
+	res, err := tx.NewRaw(`UPDATE pallets SET status = 'labelled' WHERE id = ? AND status = 'closed'`, palletID).Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
 		after, err := loadPalletByID(ctx, tx, palletID)
 		if err != nil {
 			return err
 		}
-		if auditSvc != nil && userID > 0 {
-			if err := auditSvc.Write(ctx, tx, userID, "pallet.label", "pallets", strconv.FormatInt(palletID, 10), before, after); err != nil {
-				return err
-			}
+		if after.Status == "labelled" {
+			return nil
 		}
-		return nil
-	})
+		return ErrPalletNotClosed
+	}
+
+	after, err := loadPalletByID(ctx, tx, palletID)
+	if err != nil {
+		return err
+	}
+	if auditSvc != nil && userID > 0 {
+		if err := auditSvc.Write(ctx, tx, userID, "pallet.label", "pallets", strconv.FormatInt(palletID, 10), before, after); err != nil {
+			return err
+		}
+	}
+	return clientwebhook.EnqueuePalletEvent(ctx, tx, palletID, clientwebhook.EventPalletLabelled)
 }
 
 func normalizeContentFilter(v string) string {
@@ -435,12 +622,17 @@ SELECT pr.id, pr.sku, pr.description, COALESCE(pr.uom, '') AS uom, COALESCE(pr.c
        END AS has_photos,
        CASE WHEN `+contentClientCommentMatchExists("pr")+` THEN 1 ELSE 0 END AS has_client_comments,
        pr.qty, pr.case_size, pr.unknown_sku, pr.damaged,
+       COALESCE(dr.label, pr.damage_reason) AS damage_reason,
        COALESCE(pr.batch_number, '') AS batch_number,
        COALESCE(strftime('%d/%m/%Y', pr.expiry_date), '') AS expiry_date,
        CASE WHEN pr.expiry_date IS NOT NULL AND date(pr.expiry_date) < date('now') THEN 1 ELSE 0 END AS expired,
-       COALESCE(u.username, '') AS scanned_by
+       COALESCE(u.username, '') AS scanned_by,
+       (SELECT COUNT(1) FROM audit_logs al
+        WHERE al.entity_type = 'pallet_receipts' AND al.entity_id = CAST(pr.id AS TEXT)
+          AND al.action IN ('receipt.create', 'receipt.merge')) AS captures
 FROM pallet_receipts pr
 LEFT JOIN users u ON u.id = pr.scanned_by_user_id
+LEFT JOIN damage_reasons dr ON dr.code = pr.damage_reason
 WHERE pr.pallet_id = ?`+whereExtra+`
 ORDER BY pr.sku ASC, pr.id ASC`, id).Scan(ctx, &lines)
 	})
@@ -474,6 +666,7 @@ func LoadPalletContentLineDetail(ctx context.Context, db *sqlite.DB, palletID, r
 			CaseSize        int64  `bun:"case_size"`
 			UnknownSKU      bool   `bun:"unknown_sku"`
 			Damaged         bool   `bun:"damaged"`
+			DamageReason    string `bun:"damage_reason"`
 			BatchNumber     string `bun:"batch_number"`
 			ExpiryDateUK    string `bun:"expiry_date"`
 			ExpiryDateISO   string `bun:"expiry_date_iso"`
@@ -486,6 +679,7 @@ SELECT pr.id, pr.sku, pr.description, COALESCE(pr.uom, '') AS uom,
        COALESCE(pr.carton_barcode, '') AS carton_barcode,
        COALESCE(pr.item_barcode, '') AS item_barcode,
        COALESCE(pr.comment, '') AS comment, pr.qty, pr.case_size, pr.unknown_sku, pr.damaged,
+       COALESCE(dr.label, pr.damage_reason) AS damage_reason,
        COALESCE(pr.batch_number, '') AS batch_number,
        COALESCE(strftime('%d/%m/%Y', pr.expiry_date), '') AS expiry_date,
        COALESCE(strftime('%Y-%m-%d', pr.expiry_date), '') AS expiry_date_iso,
@@ -494,6 +688,7 @@ SELECT pr.id, pr.sku, pr.description, COALESCE(pr.uom, '') AS uom,
        CASE WHEN pr.stock_photo_blob IS NOT NULL AND length(pr.stock_photo_blob) > 0 THEN 1 ELSE 0 END AS has_primary_photo
 FROM pallet_receipts pr
 LEFT JOIN users u ON u.id = pr.scanned_by_user_id
+LEFT JOIN damage_reasons dr ON dr.code = pr.damage_reason
 WHERE pr.id = ? AND pr.pallet_id = ? AND pr.project_id = ?
 LIMIT 1`, receiptID, palletID, pallet.ProjectID).Scan(ctx, &row); err != nil {
 			return err
@@ -511,6 +706,7 @@ LIMIT 1`, receiptID, palletID, pallet.ProjectID).Scan(ctx, &row); err != nil {
 		detail.CaseSize = row.CaseSize
 		detail.UnknownSKU = row.UnknownSKU
 		detail.Damaged = row.Damaged
+		detail.DamageReason = row.DamageReason
 		detail.BatchNumber = row.BatchNumber
 		detail.ExpiryDateUK = row.ExpiryDateUK
 		detail.Expired = row.Expired
@@ -522,6 +718,15 @@ LIMIT 1`, receiptID, palletID, pallet.ProjectID).Scan(ctx, &row); err != nil {
 			return err
 		}
 		detail.PhotoIDs = photoIDs
+		if detail.PrimaryPhotoInternal, detail.InternalPhotoIDs, err = photovisibility.LoadLine(ctx, tx, receiptID); err != nil {
+			return err
+		}
+
+		customValues, err := customfield.LoadValues(ctx, tx, []int64{receiptID})
+		if err != nil {
+			return err
+		}
+		detail.CustomValues = customValues[receiptID]
 
 		commentRows := make([]ContentLineClientComment, 0)
 		if strings.TrimSpace(row.ExpiryDateISO) == "" {
@@ -769,3 +974,191 @@ func yesNo(v bool) string {
 	}
 	return "No"
 }
+
+// receiptHistorySnapshot is the subset of an audited models.PalletReceipt
+// shown in line history. Fields missing from older audit entries decode as
+// zero values.
+type receiptHistorySnapshot struct {
+	PalletID       int64  `json:"PalletID"`
+	SKU            string `json:"SKU"`
+	Description    string `json:"Description"`
+	UOM            string `json:"UOM"`
+	Comment        string `json:"Comment"`
+	Qty            int64  `json:"Qty"`
+	CaseSize       int64  `json:"CaseSize"`
+	UnknownSKU     bool   `json:"UnknownSKU"`
+	Damaged        bool   `json:"Damaged"`
+	DamagedQty     int64  `json:"DamagedQty"`
+	DamageReason   string `json:"DamageReason"`
+	BatchNumber    string `json:"BatchNumber"`
+	ExpiryDate     string `json:"ExpiryDate"`
+	CartonBarcode  string `json:"CartonBarcode"`
+	ItemBarcode    string `json:"ItemBarcode"`
+	NoOuterBarcode bool   `json:"NoOuterBarcode"`
+	NoInnerBarcode bool   `json:"NoInnerBarcode"`
+	// ScannedBy and Reason are only on scanned-by reassignments.
+	ScannedBy string `json:"scanned_by"`
+	Reason    string `json:"reason"`
+}
+
+// fields lists the snapshot as labelled display values in a stable order.
+func (s receiptHistorySnapshot) fields() [][2]string {
+	return [][2]string{
+		{"Pallet", strconv.FormatInt(s.PalletID, 10)},
+		{"SKU", s.SKU},
+		{"Description", s.Description},
+		{"Unit of measure", s.UOM},
+		{"Qty", strconv.FormatInt(s.Qty, 10)},
+		{"Case size", strconv.FormatInt(s.CaseSize, 10)},
+		{"Unknown SKU", yesNo(s.UnknownSKU)},
+		{"Damaged", yesNo(s.Damaged)},
+		{"Damaged qty", strconv.FormatInt(s.DamagedQty, 10)},
+		{"Damage reason", s.DamageReason},
+		{"Batch", s.BatchNumber},
+		{"Expiry", normalizeAuditExpiry(s.ExpiryDate)},
+		{"Outer barcode", s.CartonBarcode},
+		{"Inner barcode", s.ItemBarcode},
+		{"No outer barcode", yesNo(s.NoOuterBarcode)},
+		{"No inner barcode", yesNo(s.NoInnerBarcode)},
+		{"Comment", s.Comment},
+		{"Scanned by", s.ScannedBy},
+		{"Reason", s.Reason},
+	}
+}
+
+var receiptHistoryActionLabels = map[string]string{
+	"receipt.create":          "Created",
+	"receipt.merge":           "Merged with repeat scan",
+	"receipt.update":          "Edited",
+	"receipt.resolve_unknown": "Unknown SKU resolved",
+	"receipt.transfer":        "Moved to another project",
+	"receipt.transfer_out":    "Part moved to another project",
+	"receipt.transfer_in":     "Moved in from another project",
+	// An admin credited the line to the user who actually scanned it.
+	"receipt.reassign_scanned_by": "Scanned by reassigned",
+	// The scanner confirmed a high-value SKU's details before saving.
+	"receipt.high_value_confirmed": "High-value details confirmed",
+}
+
+// LoadReceiptLineHistory turns the audit entries for one receipt line into
+// field-level before/after changes, newest first.
+func LoadReceiptLineHistory(ctx context.Context, db *sqlite.DB, receiptID int64) ([]ContentLineHistoryEntry, error) {
+	type row struct {
+		ID         int64     `bun:"id"`
+		Action     string    `bun:"action"`
+		BeforeJSON string    `bun:"before_json"`
+		AfterJSON  string    `bun:"after_json"`
+		CreatedAt  time.Time `bun:"created_at"`
+		Actor      string    `bun:"actor"`
+	}
+	rows := make([]row, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT al.id, al.action, al.before_json, al.after_json, al.created_at,
+       COALESCE(u.username, '') AS actor
+FROM audit_logs al
+LEFT JOIN users u ON u.id = al.user_id
+WHERE al.entity_type = 'pallet_receipts' AND al.entity_id = ?
+ORDER BY al.created_at DESC, al.id DESC`, strconv.FormatInt(receiptID, 10)).Scan(ctx, &rows)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]ContentLineHistoryEntry, 0, len(rows))
+	for _, row := range rows {
+		action, ok := receiptHistoryActionLabels[row.Action]
+		if !ok {
+			action = row.Action
+		}
+		entries = append(entries, ContentLineHistoryEntry{
+			TimestampUK: row.CreatedAt.Format("02/01/2006 15:04"),
+			Actor:       eventActor(row.Actor),
+			Action:      action,
+			Changes:     receiptHistoryChanges(row.BeforeJSON, row.AfterJSON),
+		})
+	}
+	return entries, nil
+}
+
+// LoadReceiptLineLineage reconstructs the scans that make up a receipt line
+// from its receipt.create and receipt.merge audit entries, oldest first. Each
+// capture's quantity is what it added to the line; later edits are not
+// captures and show in the line history instead.
+func LoadReceiptLineLineage(ctx context.Context, db *sqlite.DB, receiptID int64) ([]ContentLineCapture, error) {
+	type row struct {
+		Action     string    `bun:"action"`
+		BeforeJSON string    `bun:"before_json"`
+		AfterJSON  string    `bun:"after_json"`
+		CreatedAt  time.Time `bun:"created_at"`
+		Actor      string    `bun:"actor"`
+	}
+	rows := make([]row, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT al.action, al.before_json, al.after_json, al.created_at,
+       COALESCE(u.username, '') AS actor
+FROM audit_logs al
+LEFT JOIN users u ON u.id = al.user_id
+WHERE al.entity_type = 'pallet_receipts' AND al.entity_id = ?
+  AND al.action IN ('receipt.create', 'receipt.merge')
+ORDER BY al.created_at ASC, al.id ASC`, strconv.FormatInt(receiptID, 10)).Scan(ctx, &rows)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	captures := make([]ContentLineCapture, 0, len(rows))
+	for _, row := range rows {
+		var before, after receiptHistorySnapshot
+		if !decodeReceiptHistorySnapshot(row.AfterJSON, &after) {
+			continue
+		}
+		qty := after.Qty
+		if decodeReceiptHistorySnapshot(row.BeforeJSON, &before) {
+			qty -= before.Qty
+		}
+		captures = append(captures, ContentLineCapture{
+			TimestampUK: row.CreatedAt.Format("02/01/2006 15:04"),
+			Actor:       eventActor(row.Actor),
+			Action:      receiptHistoryActionLabels[row.Action],
+			Qty:         qty,
+			RunningQty:  after.Qty,
+		})
+	}
+	return captures, nil
+}
+
+// receiptHistoryChanges diffs two audit snapshots. A create has no before
+// snapshot, so every field it set is listed with an empty before value.
+func receiptHistoryChanges(beforeJSON, afterJSON string) []ContentLineFieldChange {
+	var before, after receiptHistorySnapshot
+	hasBefore := decodeReceiptHistorySnapshot(beforeJSON, &before)
+	if !decodeReceiptHistorySnapshot(afterJSON, &after) {
+		return nil
+	}
+	changes := make([]ContentLineFieldChange, 0)
+	beforeFields := before.fields()
+	for i, field := range after.fields() {
+		old := beforeFields[i][1]
+		if !hasBefore {
+			old = ""
+			if field[1] == "" || field[1] == "0" || field[1] == "No" {
+				continue
+			}
+		}
+		if old == field[1] {
+			continue
+		}
+		changes = append(changes, ContentLineFieldChange{Field: field[0], Before: old, After: field[1]})
+	}
+	return changes
+}
+
+func decodeReceiptHistorySnapshot(raw string, snapshot *receiptHistorySnapshot) bool {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || raw == "null" {
+		return false
+	}
+	return json.Unmarshal([]byte(raw), snapshot) == nil
+}
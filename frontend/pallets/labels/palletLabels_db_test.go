@@ -5,11 +5,17 @@ import (
 	"errors"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/uptrace/bun"
 
+	"receipter/infrastructure/audit"
 	"receipter/infrastructure/sqlite"
+	"receipter/models"
 )
 
 func openLabelsTestDB(t *testing.T) *sqlite.DB {
@@ -348,6 +354,162 @@ func TestCreateNextPallets_BulkAllocatesSequentialIDs(t *testing.T) {
 	}
 }
 
+func TestCreateNextPallet_NeverReusesDeletedID(t *testing.T) {
+	db := openLabelsTestDB(t)
+	ctx := context.Background()
+
+	if _, err := CreateNextPallets(ctx, db, 1, 2); err != nil {
+		t.Fatalf("create pallets: %v", err)
+	}
+	if _, err := db.W.ExecContext(ctx, `DELETE FROM pallets WHERE id = 2`); err != nil {
+		t.Fatalf("delete pallet: %v", err)
+	}
+	pallet, err := CreateNextPallet(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("create pallet: %v", err)
+	}
+	if pallet.ID != 3 {
+		t.Fatalf("expected id 3 after deleting pallet 2, got %d", pallet.ID)
+	}
+}
+
+func TestCreateNextPallets_SkipsIDsTakenOutsideSequence(t *testing.T) {
+	db := openLabelsTestDB(t)
+	ctx := context.Background()
+
+	// As after restoring pallets from a backup without their sequence row.
+	if _, err := db.W.ExecContext(ctx, `INSERT INTO pallets (id, project_id, status) VALUES (2, 1, 'created')`); err != nil {
+		t.Fatalf("seed pallet: %v", err)
+	}
+	pallets, err := CreateNextPallets(ctx, db, 1, 3)
+	if err != nil {
+		t.Fatalf("create pallets: %v", err)
+	}
+	if len(pallets) != 3 || pallets[0].ID != 3 || pallets[2].ID != 5 {
+		t.Fatalf("expected pallets 3-5, got %+v", pallets)
+	}
+}
+
+func TestCreatePallets_ConcurrentCreatorsGetDistinctIDs(t *testing.T) {
+	db := openLabelsTestDB(t)
+	ctx := context.Background()
+
+	var path string
+	if err := db.R.NewRaw(`SELECT file FROM pragma_database_list WHERE name = 'main'`).Scan(ctx, &path); err != nil {
+		t.Fatalf("database path: %v", err)
+	}
+	// A second handle stands in for another server process on the same file.
+	other, err := sqlite.OpenDB(path)
+	if err != nil {
+		t.Fatalf("open second handle: %v", err)
+	}
+	t.Cleanup(func() { _ = other.Close() })
+
+	const workers, rounds = 8, 15
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		ids  []int64
+		errs []error
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			handle := db
+			if w%2 == 1 {
+				handle = other
+			}
+			for i := 0; i < rounds; i++ {
+				var created []models.Pallet
+				var err error
+				switch i % 3 {
+				case 0:
+					var pallet models.Pallet
+					pallet, err = CreateNextPallet(ctx, handle, 1)
+					created = []models.Pallet{pallet}
+				case 1:
+					created, err = CreateNextPallets(ctx, handle, 1, 4)
+				default:
+					created, err = CreatePalletsWithAttributes(ctx, handle, nil, 0, 1, 2, PalletAttributesInput{PalletType: "EUR"})
+				}
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, err)
+				}
+				for _, pallet := range created {
+					ids = append(ids, pallet.ID)
+				}
+				mu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		t.Fatalf("%d creations failed, first: %v", len(errs), errs[0])
+	}
+
+	want := workers * (rounds / 3) * (1 + 4 + 2)
+	if len(ids) != want {
+		t.Fatalf("expected %d pallets, got %d", want, len(ids))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for i, id := range ids {
+		if id != int64(i+1) {
+			t.Fatalf("expected ids 1-%d without gaps or repeats, got %d at position %d", want, id, i)
+		}
+	}
+	var stored int
+	if err := db.R.NewRaw(`SELECT COUNT(*) FROM pallets`).Scan(ctx, &stored); err != nil {
+		t.Fatalf("count pallets: %v", err)
+	}
+	if stored != want {
+		t.Fatalf("expected %d stored pallets, got %d", want, stored)
+	}
+}
+
+func TestCreatePalletsWithAttributes_StoresAttributesPerPallet(t *testing.T) {
+	db := openLabelsTestDB(t)
+
+	pallets, err := CreatePalletsWithAttributes(context.Background(), db, nil, 0, 1, 2, PalletAttributesInput{
+		PalletType:        "  EUR  ",
+		DeliveryReference: "ASN-778",
+	})
+	if err != nil {
+		t.Fatalf("create pallets with attributes: %v", err)
+	}
+	if len(pallets) != 2 || pallets[0].ID != 1 || pallets[1].ID != 2 {
+		t.Fatalf("expected pallets 1 and 2, got %+v", pallets)
+	}
+
+	var rows []struct {
+		PalletID          int64  `bun:"pallet_id"`
+		PalletType        string `bun:"pallet_type"`
+		DeliveryReference string `bun:"delivery_reference"`
+	}
+	err = db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT pallet_id, pallet_type, delivery_reference FROM pallet_attributes ORDER BY pallet_id`).Scan(ctx, &rows)
+	})
+	if err != nil {
+		t.Fatalf("load pallet attributes: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 attribute rows, got %d", len(rows))
+	}
+	for _, row := range rows {
+		if row.PalletType != "EUR" || row.DeliveryReference != "ASN-778" {
+			t.Fatalf("unexpected attributes for pallet %d: %+v", row.PalletID, row)
+		}
+	}
+
+	if _, err := CreatePalletsWithAttributes(context.Background(), db, nil, 0, 1, 0, PalletAttributesInput{}); !errors.Is(err, ErrPalletCountOutOfRange) {
+		t.Fatalf("expected ErrPalletCountOutOfRange for zero count, got %v", err)
+	}
+	if _, err := CreatePalletsWithAttributes(context.Background(), db, nil, 0, 1, 1, PalletAttributesInput{PalletType: strings.Repeat("x", 41)}); !errors.Is(err, ErrPalletTypeTooLong) {
+		t.Fatalf("expected ErrPalletTypeTooLong, got %v", err)
+	}
+}
+
 func TestLoadClosedPalletLabelData_UsesClosedKnownGoods(t *testing.T) {
 	db := openLabelsTestDB(t)
 
@@ -411,6 +573,74 @@ INSERT INTO pallet_receipts (
 	if data.BoxCount != 29 {
 		t.Fatalf("expected box count 29 (ceil(347/12)), got %d", data.BoxCount)
 	}
+	if data.Language != "en" {
+		t.Fatalf("expected default label language en, got %q", data.Language)
+	}
+}
+
+func TestLoadClosedPalletLabelsData_UsesProjectLabelLanguage(t *testing.T) {
+	db := openLabelsTestDB(t)
+
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(ctx, `UPDATE projects SET label_language = 'de' WHERE id = 1`); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO pallets (id, project_id, status, created_at, closed_at) VALUES (8, 1, 'closed', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed label language data: %v", err)
+	}
+
+	labels, err := LoadClosedPalletLabelsData(context.Background(), db, 8)
+	if err != nil {
+		t.Fatalf("LoadClosedPalletLabelsData returned error: %v", err)
+	}
+	if len(labels) != 1 || labels[0].Language != "de" {
+		t.Fatalf("expected one label in project language de, got %+v", labels)
+	}
+}
+
+func TestLoadClosedPalletLabelsData_PicksBarcodeThatFitsProjectSymbology(t *testing.T) {
+	db := openLabelsTestDB(t)
+
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(ctx, `UPDATE projects SET label_symbology = 'ean13' WHERE id = 1`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO users (id, username, password_hash, role, created_at, updated_at) VALUES (1, 'scanner1', 'hash', 'scanner', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO pallets (id, project_id, status, created_at, closed_at) VALUES (9, 1, 'closed', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO pallet_receipts (
+	project_id, pallet_id, sku, description, scanned_by_user_id, qty, case_size, carton_barcode, item_barcode, created_at, updated_at
+) VALUES
+	(1, 9, 'SKU-A', 'Item A', 1, 10, 1, '', 'ITEM-A-INTERNAL', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
+	(1, 9, 'SKU-A', 'Item A', 1, 5, 1, '5012345678900', '', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
+	(1, 9, 'SKU-B', 'Item B', 1, 3, 1, '5012345678901', 'ITEM-B', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed symbology data: %v", err)
+	}
+
+	labels, err := LoadClosedPalletLabelsData(context.Background(), db, 9)
+	if err != nil {
+		t.Fatalf("LoadClosedPalletLabelsData returned error: %v", err)
+	}
+	if len(labels) != 2 {
+		t.Fatalf("expected 2 labels, got %d", len(labels))
+	}
+	if labels[0].Symbology != "ean13" || labels[0].BarcodeValue != "5012345678900" {
+		t.Fatalf("expected SKU-A to use the valid EAN-13 carton barcode, got %q %q", labels[0].Symbology, labels[0].BarcodeValue)
+	}
+	if labels[1].BarcodeValue != "" {
+		t.Fatalf("expected SKU-B to have no printable EAN-13 barcode, got %q", labels[1].BarcodeValue)
+	}
 }
 
 func TestLoadClosedPalletLabelsData_GroupsPerItemBatchExpiry(t *testing.T) {
@@ -569,3 +799,228 @@ func TestMarkPalletLabelled_TransitionsClosed(t *testing.T) {
 		t.Fatalf("expected labelled status, got %s", status)
 	}
 }
+
+func TestMarkPalletsLabelled_RecordsOnePrintRunPerPalletOrAllOrNothing(t *testing.T) {
+	db := openLabelsTestDB(t)
+
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO pallets (id, project_id, status, created_at, closed_at) VALUES
+	(20, 1, 'closed', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
+	(21, 1, 'labelled', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
+	(22, 1, 'open', CURRENT_TIMESTAMP, NULL)`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed pallets: %v", err)
+	}
+
+	if _, err := MarkPalletsLabelled(context.Background(), db, nil, 0, []int64{20, 22}); !errors.Is(err, ErrPalletNotClosed) {
+		t.Fatalf("expected ErrPalletNotClosed for an open pallet, got %v", err)
+	}
+	var status string
+	var prints int
+	err = db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT status FROM pallets WHERE id = 20`).Scan(ctx, &status); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT COUNT(*) FROM closed_label_prints`).Scan(ctx, &prints)
+	})
+	if err != nil {
+		t.Fatalf("read after refused batch: %v", err)
+	}
+	if status != "closed" || prints != 0 {
+		t.Fatalf("expected a refused batch to change nothing, got status=%s prints=%d", status, prints)
+	}
+
+	batchID, err := MarkPalletsLabelled(context.Background(), db, nil, 0, []int64{20, 21})
+	if err != nil {
+		t.Fatalf("MarkPalletsLabelled returned error: %v", err)
+	}
+	var runs []struct {
+		PalletID int64  `bun:"pallet_id"`
+		BatchID  string `bun:"batch_id"`
+		Position int    `bun:"batch_position"`
+		Status   string `bun:"status"`
+	}
+	err = db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT clp.pallet_id, clp.batch_id, clp.batch_position, p.status
+FROM closed_label_prints clp
+JOIN pallets p ON p.id = clp.pallet_id
+ORDER BY clp.id`).Scan(ctx, &runs)
+	})
+	if err != nil {
+		t.Fatalf("read print runs: %v", err)
+	}
+	if len(runs) != 2 || batchID == "" {
+		t.Fatalf("expected two print runs in a batch, got %+v (batch %q)", runs, batchID)
+	}
+	for i, run := range runs {
+		if run.BatchID != batchID || run.Position != i+1 || run.Status != "labelled" {
+			t.Fatalf("unexpected print run %d: %+v", i, run)
+		}
+	}
+}
+
+func TestLoadReceiptLineHistory_FieldLevelChangesNewestFirst(t *testing.T) {
+	db := openLabelsTestDB(t)
+	auditSvc := audit.NewService()
+	expiry := time.Date(2027, 5, 31, 0, 0, 0, 0, time.UTC)
+
+	created := models.PalletReceipt{ID: 10, ProjectID: 1, PalletID: 1, SKU: "SKU-H1", Description: "History item", Qty: 2, CaseSize: 1, BatchNumber: "B1"}
+	merged := created
+	merged.Qty = 5
+	edited := merged
+	edited.Qty = 4
+	edited.ExpiryDate = &expiry
+	edited.Damaged = true
+	edited.DamagedQty = 1
+	// An audit entry for another line must not leak into this line's history.
+	other := models.PalletReceipt{ID: 11, ProjectID: 1, PalletID: 1, SKU: "SKU-OTHER", Qty: 9, CaseSize: 1}
+
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO users (id, username, password_hash, role, created_at, updated_at) VALUES (1, 'scanner1', 'hash', 'scanner', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP), (2, 'admin', 'hash', 'admin', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`); err != nil {
+			return err
+		}
+		if err := auditSvc.Write(ctx, tx, 1, "receipt.create", "pallet_receipts", "10", nil, created); err != nil {
+			return err
+		}
+		if err := auditSvc.Write(ctx, tx, 1, "receipt.merge", "pallet_receipts", "10", created, merged); err != nil {
+			return err
+		}
+		if err := auditSvc.Write(ctx, tx, 2, "receipt.update", "pallet_receipts", "10", merged, edited); err != nil {
+			return err
+		}
+		return auditSvc.Write(ctx, tx, 1, "receipt.create", "pallet_receipts", "11", nil, other)
+	})
+	if err != nil {
+		t.Fatalf("seed audit history: %v", err)
+	}
+
+	history, err := LoadReceiptLineHistory(context.Background(), db, 10)
+	if err != nil {
+		t.Fatalf("load line history: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("expected 3 history entries, got %+v", history)
+	}
+
+	edit := history[0]
+	if edit.Action != "Edited" || edit.Actor != "admin" {
+		t.Fatalf("expected newest entry to be admin edit, got %+v", edit)
+	}
+	wantEdit := []ContentLineFieldChange{
+		{Field: "Qty", Before: "5", After: "4"},
+		{Field: "Damaged", Before: "No", After: "Yes"},
+		{Field: "Damaged qty", Before: "0", After: "1"},
+		{Field: "Expiry", Before: "", After: "31/05/2027"},
+	}
+	if len(edit.Changes) != len(wantEdit) {
+		t.Fatalf("expected edit changes %+v, got %+v", wantEdit, edit.Changes)
+	}
+	for i, change := range wantEdit {
+		if edit.Changes[i] != change {
+			t.Fatalf("expected edit change %d to be %+v, got %+v", i, change, edit.Changes[i])
+		}
+	}
+
+	merge := history[1]
+	if merge.Action != "Merged with repeat scan" || len(merge.Changes) != 1 || merge.Changes[0] != (ContentLineFieldChange{Field: "Qty", Before: "2", After: "5"}) {
+		t.Fatalf("unexpected merge entry: %+v", merge)
+	}
+
+	create := history[2]
+	if create.Action != "Created" || create.Actor != "scanner1" {
+		t.Fatalf("unexpected create entry: %+v", create)
+	}
+	fields := make(map[string]string)
+	for _, change := range create.Changes {
+		if change.Before != "" {
+			t.Fatalf("expected create changes to have no before value, got %+v", change)
+		}
+		fields[change.Field] = change.After
+	}
+	if fields["SKU"] != "SKU-H1" || fields["Qty"] != "2" || fields["Batch"] != "B1" {
+		t.Fatalf("expected create to list initial values, got %+v", create.Changes)
+	}
+	if _, ok := fields["Damaged"]; ok {
+		t.Fatalf("expected unset fields to be omitted from create, got %+v", create.Changes)
+	}
+}
+
+func TestLoadReceiptLineLineage_ListsMergedCapturesOldestFirst(t *testing.T) {
+	db := openLabelsTestDB(t)
+	auditSvc := audit.NewService()
+
+	created := models.PalletReceipt{ID: 10, ProjectID: 1, PalletID: 1, SKU: "SKU-L1", Description: "Lineage item", Qty: 2, CaseSize: 1}
+	merged := created
+	merged.Qty = 5
+	mergedAgain := merged
+	mergedAgain.Qty = 6
+	edited := mergedAgain
+	edited.Qty = 4
+
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role, created_at, updated_at) VALUES (1, 'scanner1', 'hash', 'scanner', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP), (2, 'scanner2', 'hash', 'scanner', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open')`,
+			`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty) VALUES (10, 1, 1, 'SKU-L1', 'Lineage item', 2, 4), (11, 1, 1, 'SKU-L2', 'Single', 1, 1)`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		if err := auditSvc.Write(ctx, tx, 1, "receipt.create", "pallet_receipts", "10", nil, created); err != nil {
+			return err
+		}
+		if err := auditSvc.Write(ctx, tx, 2, "receipt.merge", "pallet_receipts", "10", created, merged); err != nil {
+			return err
+		}
+		if err := auditSvc.Write(ctx, tx, 1, "receipt.merge", "pallet_receipts", "10", merged, mergedAgain); err != nil {
+			return err
+		}
+		if err := auditSvc.Write(ctx, tx, 2, "receipt.update", "pallet_receipts", "10", mergedAgain, edited); err != nil {
+			return err
+		}
+		return auditSvc.Write(ctx, tx, 1, "receipt.create", "pallet_receipts", "11", nil, models.PalletReceipt{ID: 11, SKU: "SKU-L2", Qty: 1})
+	})
+	if err != nil {
+		t.Fatalf("seed audit history: %v", err)
+	}
+
+	lineage, err := LoadReceiptLineLineage(context.Background(), db, 10)
+	if err != nil {
+		t.Fatalf("load lineage: %v", err)
+	}
+	// The edit is not a capture, so the scans add up to 6 while the line
+	// now holds 4.
+	if len(lineage) != 3 {
+		t.Fatalf("expected 3 captures, got %+v", lineage)
+	}
+	want := []struct {
+		actor, action   string
+		qty, runningQty int64
+	}{
+		{"scanner1", "Created", 2, 2},
+		{"scanner2", "Merged with repeat scan", 3, 5},
+		{"scanner1", "Merged with repeat scan", 1, 6},
+	}
+	for i, w := range want {
+		got := lineage[i]
+		if got.Actor != w.actor || got.Action != w.action || got.Qty != w.qty || got.RunningQty != w.runningQty {
+			t.Fatalf("capture %d = %+v, want %+v", i, got, w)
+		}
+	}
+	if !lineageAdjusted(lineage, 4) {
+		t.Fatalf("expected the edit to be flagged")
+	}
+
+	_, lines, err := LoadPalletContent(context.Background(), db, 1, "all")
+	if err != nil {
+		t.Fatalf("load pallet content: %v", err)
+	}
+	if len(lines) != 2 || lines[0].Captures != 3 || lines[1].Captures != 1 {
+		t.Fatalf("unexpected capture counts %+v", lines)
+	}
+}
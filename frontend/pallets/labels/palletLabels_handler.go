@@ -2,8 +2,10 @@ package labels
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -14,9 +16,17 @@ import (
 
 	sessioncontext "receipter/frontend/shared/context"
 	"receipter/infrastructure/audit"
+	"receipter/infrastructure/cache"
+	"receipter/infrastructure/delivery"
+	"receipter/infrastructure/exportjob"
+	"receipter/infrastructure/labeltext"
+	"receipter/infrastructure/palletlabel"
+	"receipter/infrastructure/photovisibility"
 	projectinfra "receipter/infrastructure/project"
 	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/renderpool"
 	"receipter/infrastructure/sqlite"
+	"receipter/infrastructure/stepup"
 	"receipter/models"
 )
 
@@ -38,7 +48,7 @@ func NewPalletCommandHandler(db *sqlite.DB, _ *audit.Service) http.HandlerFunc {
 }
 
 // NewPalletBulkCommandHandler creates multiple pallets and returns their labels in one PDF.
-func NewPalletBulkCommandHandler(db *sqlite.DB, _ *audit.Service) http.HandlerFunc {
+func NewPalletBulkCommandHandler(db *sqlite.DB, _ *audit.Service, renders *renderpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		project, ok := requireActiveProjectForPalletWrites(w, r, db)
 		if !ok {
@@ -59,32 +69,82 @@ func NewPalletBulkCommandHandler(db *sqlite.DB, _ *audit.Service) http.HandlerFu
 			return
 		}
 
-		pallets, err := CreateNextPallets(r.Context(), db, project.ID, count)
-		if err != nil {
-			http.Error(w, "failed to create pallets", http.StatusInternalServerError)
-			return
-		}
-		if len(pallets) == 0 {
-			http.Error(w, "no pallets generated", http.StatusInternalServerError)
-			return
+		if r.FormValue("confirm_over_allowance") == "" {
+			allowance, err := projectinfra.LoadPalletAllowance(r.Context(), db, project.ID)
+			if err != nil {
+				http.Error(w, "failed to load pallet allowance", http.StatusInternalServerError)
+				return
+			}
+			if allowance.WouldExceed(count) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.WriteHeader(http.StatusConflict)
+				_ = PalletAllowanceWarningPage(count, allowance).Render(r.Context(), w)
+				return
+			}
 		}
 
-		labels := make([]PalletLabelData, 0, len(pallets))
-		for _, pallet := range pallets {
-			labels = append(labels, PalletLabelData{
-				PalletID:    pallet.ID,
-				ClientName:  project.ClientName,
-				ProjectName: project.Name,
-				ProjectDate: project.ProjectDate,
-			})
+		// The pallets are only created once a render slot is free, so a
+		// refused print can be retried without creating them twice.
+		var pallets []models.Pallet
+		var palletIDs []int64
+		var pdfBytes []byte
+		failure := ""
+		err = renders.Do(r.Context(), func() error {
+			var err error
+			pallets, err = CreateNextPallets(r.Context(), db, project.ID, count)
+			if err != nil {
+				failure = "failed to create pallets"
+				return err
+			}
+			if len(pallets) == 0 {
+				failure = "no pallets generated"
+				return errors.New(failure)
+			}
+
+			labels := make([]PalletLabelData, 0, len(pallets))
+			for _, pallet := range pallets {
+				labels = append(labels, PalletLabelData{
+					PalletID:    pallet.ID,
+					ClientName:  string(project.ClientName),
+					ProjectName: project.Name,
+					ProjectDate: project.ProjectDate,
+				})
+			}
+			palletIDs = make([]int64, 0, len(pallets))
+			for _, pallet := range pallets {
+				palletIDs = append(palletIDs, pallet.ID)
+			}
+			printedAt := time.Now()
+			session, _ := sessioncontext.GetSessionFromContext(r.Context())
+			serials, err := palletlabel.Issue(r.Context(), db, session.UserID, palletIDs, printedAt)
+			if err != nil {
+				failure = "failed to record pallet labels"
+				return err
+			}
+			for i := range labels {
+				labels[i].Serial = serials[labels[i].PalletID]
+			}
+			pdfBytes, err = renderPalletLabelsPDF(labels, printedAt)
+			if err != nil {
+				failure = "failed to build labels pdf"
+			}
+			return err
+		})
+		if writeRenderRefused(w, err) {
+			return
 		}
-		printedAt := time.Now()
-		pdfBytes, err := renderPalletLabelsPDF(labels, printedAt)
 		if err != nil {
-			http.Error(w, "failed to build labels pdf", http.StatusInternalServerError)
+			if failure == "" {
+				failure = "failed to build labels pdf"
+			}
+			http.Error(w, failure, http.StatusInternalServerError)
 			return
 		}
 
+		if err := projectinfra.RecordPalletLabelPrints(r.Context(), db, palletIDs); err != nil {
+			slog.Error("pallet labels: record prints failed", slog.Any("err", err))
+		}
+
 		first := pallets[0].ID
 		last := pallets[len(pallets)-1].ID
 		fileName := fmt.Sprintf("pallet-labels-%d-%d.pdf", first, last)
@@ -97,8 +157,106 @@ func NewPalletBulkCommandHandler(db *sqlite.DB, _ *audit.Service) http.HandlerFu
 	}
 }
 
-// PalletLabelPageQueryHandler renders pallet label view.
-func PalletLabelPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+const maxCreatePalletsRequestBytes = 16 << 10
+
+type createPalletsRequest struct {
+	ProjectID         int64  `json:"projectId"`
+	Count             *int   `json:"count"`
+	PalletType        string `json:"palletType"`
+	DeliveryReference string `json:"deliveryReference"`
+}
+
+type createdPalletResponse struct {
+	ID                int64  `json:"id"`
+	Code              string `json:"code"`
+	Status            string `json:"status"`
+	PalletType        string `json:"palletType"`
+	DeliveryReference string `json:"deliveryReference"`
+	LabelURL          string `json:"labelUrl"`
+}
+
+// CreatePalletsAPICommandHandler pre-creates pallets for an explicit project so
+// upstream systems can allocate pallet IDs and labels before goods arrive.
+func CreatePalletsAPICommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req createPalletsRequest
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCreatePalletsRequestBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "request body must be a JSON object with projectId, count, palletType and deliveryReference")
+			return
+		}
+		if req.ProjectID <= 0 {
+			writeAPIError(w, http.StatusBadRequest, "projectId is required")
+			return
+		}
+		count := 1
+		if req.Count != nil {
+			count = *req.Count
+		}
+
+		project, err := projectinfra.LoadByID(r.Context(), db, req.ProjectID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				writeAPIError(w, http.StatusNotFound, "project not found")
+				return
+			}
+			writeAPIError(w, http.StatusInternalServerError, "failed to load project")
+			return
+		}
+		if project.Status != projectinfra.StatusActive {
+			writeAPIError(w, http.StatusConflict, "inactive projects are read-only")
+			return
+		}
+
+		session, _ := sessioncontext.GetSessionFromContext(r.Context())
+		attrs := PalletAttributesInput{PalletType: req.PalletType, DeliveryReference: req.DeliveryReference}
+		pallets, err := CreatePalletsWithAttributes(r.Context(), db, auditSvc, session.UserID, project.ID, count, attrs)
+		if err != nil {
+			if errors.Is(err, ErrPalletCountOutOfRange) || errors.Is(err, ErrPalletTypeTooLong) || errors.Is(err, ErrDeliveryReferenceTooLong) {
+				writeAPIError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			writeAPIError(w, http.StatusInternalServerError, "failed to create pallets")
+			return
+		}
+
+		created := make([]createdPalletResponse, 0, len(pallets))
+		for _, pallet := range pallets {
+			created = append(created, createdPalletResponse{
+				ID:                pallet.ID,
+				Code:              fmt.Sprintf("P%08d", pallet.ID),
+				Status:            pallet.Status,
+				PalletType:        strings.TrimSpace(req.PalletType),
+				DeliveryReference: strings.TrimSpace(req.DeliveryReference),
+				LabelURL:          fmt.Sprintf("/tasker/pallets/%d/label", pallet.ID),
+			})
+		}
+		writeAPIJSON(w, http.StatusCreated, map[string]any{
+			"projectId": project.ID,
+			"pallets":   created,
+		})
+	}
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("pallets api: write response failed", slog.Any("err", err))
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeAPIJSON(w, status, map[string]any{
+		"errors": []map[string]string{{"message": message}},
+	})
+}
+
+// PalletLabelPageQueryHandler prints a new pallet ID label, with the next
+// label serial for the pallet.
+func PalletLabelPageQueryHandler(db *sqlite.DB, renders *renderpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		idStr := chi.URLParam(r, "id")
 		id, err := strconv.ParseInt(idStr, 10, 64)
@@ -119,20 +277,42 @@ func PalletLabelPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
 			return
 		}
 
-		printedAt := time.Now()
-		pdfBytes, _, err := renderPalletLabelPDF(pallet.ID, project.ClientName, project.Name, project.ProjectDate, printedAt)
+		var pdfBytes []byte
+		failure := ""
+		err = renders.Do(r.Context(), func() error {
+			printedAt := time.Now()
+			session, _ := sessioncontext.GetSessionFromContext(r.Context())
+			serials, err := palletlabel.Issue(r.Context(), db, session.UserID, []int64{pallet.ID}, printedAt)
+			if err != nil {
+				failure = "failed to record pallet label"
+				return err
+			}
+			pdfBytes, _, err = renderPalletLabelPDF(pallet.ID, serials[pallet.ID], string(project.ClientName), project.Name, project.ProjectDate, printedAt)
+			return err
+		})
+		if writeRenderRefused(w, err) {
+			return
+		}
 		if err != nil {
-			http.Error(w, "failed to build label pdf", http.StatusInternalServerError)
+			if failure == "" {
+				failure = "failed to build label pdf"
+			}
+			http.Error(w, failure, http.StatusInternalServerError)
 			return
 		}
+		if err := projectinfra.RecordPalletLabelPrints(r.Context(), db, []int64{pallet.ID}); err != nil {
+			slog.Error("pallet labels: record print failed", slog.Any("err", err))
+		}
 		w.Header().Set("Content-Type", "application/pdf")
 		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=pallet-%d-label.pdf", pallet.ID))
 		_, _ = w.Write(pdfBytes)
 	}
 }
 
-// ClosedPalletLabelPDFQueryHandler renders a closed/labelled pallet shipping label PDF.
-func ClosedPalletLabelPDFQueryHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+// ClosedPalletLabelPreviewPageQueryHandler renders an on-screen preview of the
+// closed pallet label. Previewing has no side effects; the pallet is only
+// marked labelled once the label is confirmed and printed.
+func ClosedPalletLabelPreviewPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		idStr := chi.URLParam(r, "id")
 		id, err := strconv.ParseInt(idStr, 10, 64)
@@ -141,27 +321,99 @@ func ClosedPalletLabelPDFQueryHandler(db *sqlite.DB, auditSvc *audit.Service) ht
 			return
 		}
 
-		labelData, err := LoadClosedPalletLabelsData(r.Context(), db, id)
+		pallet, err := LoadPalletByID(r.Context(), db, id)
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				http.Error(w, "pallet not found", http.StatusNotFound)
 				return
 			}
-			if errors.Is(err, ErrPalletNotClosed) {
-				http.Error(w, "pallet must be closed or labelled to print this label", http.StatusConflict)
+			http.Error(w, "failed to load pallet", http.StatusInternalServerError)
+			return
+		}
+
+		labelData, ok := loadClosedPalletLabels(w, r, db, id, r.URL.Query().Get("lang"))
+		if !ok {
+			return
+		}
+
+		session, _ := sessioncontext.GetSessionFromContext(r.Context())
+		stepUp, err := stepup.Needed(r.Context(), db, session, pallet.ProjectID, time.Now())
+		if err != nil {
+			http.Error(w, "failed to load project settings", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := ClosedPalletLabelPreviewPage(pallet.ID, pallet.Status, labelData, labeltext.Languages(), stepUp, r.URL.Query().Get("error")).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render label preview", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// PrintClosedPalletLabelCommandHandler renders the closed pallet shipping
+// label PDF and marks the pallet labelled. Projects that require a step-up
+// get the user's password or PIN checked first.
+func PrintClosedPalletLabelCommandHandler(db *sqlite.DB, sessionCache cache.SessionStore, auditSvc *audit.Service, deliveries *delivery.Worker, renders *renderpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idStr := chi.URLParam(r, "id")
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "invalid pallet id", http.StatusBadRequest)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form data", http.StatusBadRequest)
+			return
+		}
+
+		pallet, err := LoadPalletByID(r.Context(), db, id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "pallet not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to load pallet", http.StatusInternalServerError)
+			return
+		}
+		session, _ := sessioncontext.GetSessionFromContext(r.Context())
+		confirmed, err := stepup.Require(r.Context(), db, auditSvc, &session, pallet.ProjectID, id, stepup.ActionPrintClosedLabel, r.FormValue("step_up_secret"))
+		if err != nil {
+			if stepup.UserError(err) {
+				q := url.Values{"error": {err.Error()}}
+				if lang := r.FormValue("label_language"); lang != "" {
+					q.Set("lang", lang)
+				}
+				http.Redirect(w, r, fmt.Sprintf("/tasker/pallets/%d/closed-label?%s", id, q.Encode()), http.StatusSeeOther)
 				return
 			}
-			http.Error(w, "failed to load pallet label", http.StatusInternalServerError)
+			http.Error(w, "failed to confirm re-authentication", http.StatusInternalServerError)
 			return
 		}
+		if confirmed {
+			sessionCache.AddSession(session)
+		}
 
-		pdfBytes, err := renderClosedPalletLabelsPDF(labelData)
+		labelData, ok := loadClosedPalletLabels(w, r, db, id, r.FormValue("label_language"))
+		if !ok {
+			return
+		}
+
+		var pdfBytes []byte
+		err = renders.Do(r.Context(), func() error {
+			var err error
+			pdfBytes, err = renderClosedPalletLabelsPDF(labelData)
+			return err
+		})
+		if writeRenderRefused(w, err) {
+			return
+		}
 		if err != nil {
 			http.Error(w, "failed to build closed pallet label pdf", http.StatusInternalServerError)
 			return
 		}
 
-		session, _ := sessioncontext.GetSessionFromContext(r.Context())
 		if err := MarkPalletLabelled(r.Context(), db, auditSvc, session.UserID, id); err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				http.Error(w, "pallet not found", http.StatusNotFound)
@@ -174,6 +426,7 @@ func ClosedPalletLabelPDFQueryHandler(db *sqlite.DB, auditSvc *audit.Service) ht
 			http.Error(w, "failed to set pallet status", http.StatusInternalServerError)
 			return
 		}
+		deliveries.Notify()
 
 		w.Header().Set("Content-Type", "application/pdf")
 		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=pallet-%d-closed-label.pdf", id))
@@ -181,6 +434,39 @@ func ClosedPalletLabelPDFQueryHandler(db *sqlite.DB, auditSvc *audit.Service) ht
 	}
 }
 
+// loadClosedPalletLabels loads the label groups for a closed pallet and applies
+// an optional per-print language override.
+func loadClosedPalletLabels(w http.ResponseWriter, r *http.Request, db *sqlite.DB, palletID int64, languageOverride string) ([]ClosedPalletLabelData, bool) {
+	language := ""
+	if strings.TrimSpace(languageOverride) != "" {
+		language = labeltext.Normalize(languageOverride)
+		if language == "" {
+			http.Error(w, "label language is not supported", http.StatusBadRequest)
+			return nil, false
+		}
+	}
+
+	labelData, err := LoadClosedPalletLabelsData(r.Context(), db, palletID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "pallet not found", http.StatusNotFound)
+			return nil, false
+		}
+		if errors.Is(err, ErrPalletNotClosed) {
+			http.Error(w, "pallet must be closed or labelled to print this label", http.StatusConflict)
+			return nil, false
+		}
+		http.Error(w, "failed to load pallet label", http.StatusInternalServerError)
+		return nil, false
+	}
+	if language != "" {
+		for i := range labelData {
+			labelData[i].Language = language
+		}
+	}
+	return labelData, true
+}
+
 // PalletContentLabelPageQueryHandler renders a printable label view of pallet contents.
 func PalletContentLabelPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -212,17 +498,25 @@ func PalletContentLabelPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
 			canExport = hasRole(session.UserRoles, rbac.RoleAdmin)
 			canPrintClosedLabel = isClosedLikePalletStatus(pallet.Status) && canPrintClosedLabelForRoles(session.UserRoles)
 		}
+		bundles := make([]exportjob.View, 0)
+		if canExport {
+			bundles, err = exportjob.ListForPallet(r.Context(), db, id, exportjob.KindPalletBundle, 5)
+			if err != nil {
+				http.Error(w, "failed to load export bundles", http.StatusInternalServerError)
+				return
+			}
+		}
 
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		if r.URL.Query().Get("fragment") == "1" {
-			if err := PalletContentLabelFragment(pallet.ID, pallet.ProjectID, pallet.Status, canExport, canPrintClosedLabel, filter, lines, events).Render(r.Context(), w); err != nil {
+			if err := PalletContentLabelFragment(pallet.ID, pallet.ProjectID, pallet.Status, canExport, canPrintClosedLabel, filter, lines, events, bundles).Render(r.Context(), w); err != nil {
 				http.Error(w, "failed to render pallet content label fragment", http.StatusInternalServerError)
 				return
 			}
 			return
 		}
 
-		if err := PalletContentLabelPage(pallet.ID, pallet.ProjectID, pallet.Status, canExport, canPrintClosedLabel, filter, lines, events).Render(r.Context(), w); err != nil {
+		if err := PalletContentLabelPage(pallet.ID, pallet.ProjectID, pallet.Status, canExport, canPrintClosedLabel, filter, lines, events, bundles).Render(r.Context(), w); err != nil {
 			http.Error(w, "failed to render pallet content label", http.StatusInternalServerError)
 			return
 		}
@@ -257,17 +551,94 @@ func PalletContentLineDetailPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
 
 		filter := normalizeContentFilter(r.URL.Query().Get("filter"))
 		canPrintClosedLabel := false
+		canViewHistory := false
+		canSetPhotoVisibility := false
 		if session, ok := sessioncontext.GetSessionFromContext(r.Context()); ok {
 			canPrintClosedLabel = isClosedLikePalletStatus(pallet.Status) && canPrintClosedLabelForRoles(session.UserRoles)
+			// Clients see the line as it is now, not who changed it.
+			canViewHistory = hasRole(session.UserRoles, rbac.RoleAdmin) || hasRole(session.UserRoles, rbac.RoleScanner)
+			canSetPhotoVisibility = canViewHistory
+			if photovisibility.HiddenFrom(session.UserRoles) {
+				line = withoutInternalPhotos(line)
+			}
+		}
+		var history []ContentLineHistoryEntry
+		var lineage []ContentLineCapture
+		if canViewHistory {
+			history, err = LoadReceiptLineHistory(r.Context(), db, receiptID)
+			if err != nil {
+				http.Error(w, "failed to load line history", http.StatusInternalServerError)
+				return
+			}
+			lineage, err = LoadReceiptLineLineage(r.Context(), db, receiptID)
+			if err != nil {
+				http.Error(w, "failed to load line lineage", http.StatusInternalServerError)
+				return
+			}
 		}
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		if err := PalletContentLineDetailPage(pallet.ID, pallet.Status, canPrintClosedLabel, filter, line).Render(r.Context(), w); err != nil {
+		if err := PalletContentLineDetailPage(pallet.ID, pallet.Status, canPrintClosedLabel, filter, line, canViewHistory, canSetPhotoVisibility, history, lineage).Render(r.Context(), w); err != nil {
 			http.Error(w, "failed to render line detail", http.StatusInternalServerError)
 			return
 		}
 	}
 }
 
+// withoutInternalPhotos drops the photos a client may not see from a line.
+func withoutInternalPhotos(line ContentLineDetail) ContentLineDetail {
+	if line.PrimaryPhotoInternal {
+		line.HasPrimaryPhoto = false
+	}
+	visible := make([]int64, 0, len(line.PhotoIDs))
+	for _, photoID := range line.PhotoIDs {
+		if !line.InternalPhotoIDs[photoID] {
+			visible = append(visible, photoID)
+		}
+	}
+	line.PhotoIDs = visible
+	return line
+}
+
+// SetContentLinePhotoVisibilityCommandHandler marks one photo of a receipt
+// line internal or client-visible and returns to the line.
+func SetContentLinePhotoVisibilityCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "invalid pallet id", http.StatusBadRequest)
+			return
+		}
+		receiptID, err := strconv.ParseInt(chi.URLParam(r, "receiptID"), 10, 64)
+		if err != nil || receiptID <= 0 {
+			http.Error(w, "invalid receipt id", http.StatusBadRequest)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form data", http.StatusBadRequest)
+			return
+		}
+		photoID, _ := strconv.ParseInt(strings.TrimSpace(r.FormValue("photo_id")), 10, 64)
+		session, _ := sessioncontext.GetSessionFromContext(r.Context())
+		err = photovisibility.Set(r.Context(), db, auditSvc, session.UserID, id, receiptID, r.FormValue("source"), photoID, r.FormValue("internal") == "1")
+		switch {
+		case errors.Is(err, photovisibility.ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, photovisibility.ErrInvalidSource):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, "failed to update photo", http.StatusInternalServerError)
+			return
+		}
+		redirectTo := fmt.Sprintf("/tasker/pallets/%d/content-line/%d", id, receiptID)
+		if filter := normalizeContentFilter(r.FormValue("filter")); filter != "" {
+			redirectTo += "?filter=" + url.QueryEscape(filter)
+		}
+		http.Redirect(w, r, redirectTo, http.StatusSeeOther)
+	}
+}
+
 // ScanPalletPageQueryHandler renders pallet scan/lookup page.
 func ScanPalletPageQueryHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -319,3 +690,15 @@ func requireActiveProjectForPalletWrites(w http.ResponseWriter, r *http.Request,
 	}
 	return project, true
 }
+
+// writeRenderRefused answers a label print the render pool refused because
+// it is full or shutting down, and reports whether it did. The print is safe
+// to retry once Retry-After has passed.
+func writeRenderRefused(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, renderpool.ErrBusy) && !errors.Is(err, renderpool.ErrStopped) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(renderpool.RetryAfter/time.Second)))
+	http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	return true
+}
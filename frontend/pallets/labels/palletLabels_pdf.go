@@ -3,29 +3,33 @@ package labels
 import (
 	"bytes"
 	"fmt"
-	"image"
-	"image/draw"
-	"image/png"
+	"math"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/boombuler/barcode"
-	"github.com/boombuler/barcode/code128"
 	"github.com/jung-kurt/gofpdf"
+
+	"receipter/infrastructure/labelbarcode"
+	"receipter/infrastructure/labeltext"
+	"receipter/infrastructure/palletlabel"
+	"receipter/infrastructure/pdftext"
 )
 
 type PalletLabelData struct {
-	PalletID    int64
+	PalletID int64
+	// Serial numbers this print among the pallet's labels; see palletlabel.
+	Serial      int64
 	ClientName  string
 	ProjectName string
 	ProjectDate time.Time
 }
 
-func renderPalletLabelPDF(palletID int64, clientName, projectName string, projectDate, printedAt time.Time) ([]byte, string, error) {
+func renderPalletLabelPDF(palletID, serial int64, clientName, projectName string, projectDate, printedAt time.Time) ([]byte, string, error) {
 	pdfBytes, err := renderPalletLabelsPDF([]PalletLabelData{
 		{
 			PalletID:    palletID,
+			Serial:      serial,
 			ClientName:  clientName,
 			ProjectName: projectName,
 			ProjectDate: projectDate,
@@ -34,7 +38,7 @@ func renderPalletLabelPDF(palletID int64, clientName, projectName string, projec
 	if err != nil {
 		return nil, "", err
 	}
-	return pdfBytes, fmt.Sprintf("P%08d", palletID), nil
+	return pdfBytes, palletlabel.Code(palletID, serial), nil
 }
 
 func renderPalletLabelsPDF(labels []PalletLabelData, printedAt time.Time) ([]byte, error) {
@@ -46,8 +50,8 @@ func renderPalletLabelsPDF(labels []PalletLabelData, printedAt time.Time) ([]byt
 	pdf.SetTitle("Pallet Labels", false)
 
 	for _, label := range labels {
-		barcodeValue := fmt.Sprintf("P%08d", label.PalletID)
-		barcodePNG, err := renderCode128PNG(barcodeValue, 1200, 260)
+		barcodeValue := palletlabel.Code(label.PalletID, label.Serial)
+		barcodePNG, err := labelbarcode.RenderPNG(labelbarcode.Code128, barcodeValue, 1200, 260)
 		if err != nil {
 			return nil, err
 		}
@@ -76,7 +80,11 @@ func renderPalletLabelsPDF(labels []PalletLabelData, printedAt time.Time) ([]byt
 		pdf.CellFormat(0, 9, "Client: "+clientName, "", 1, "C", false, 0, "")
 		pdf.CellFormat(0, 9, "Project: "+projectName, "", 1, "C", false, 0, "")
 		pdf.CellFormat(0, 9, "Project Date: "+projectDateText, "", 1, "C", false, 0, "")
-		pdf.CellFormat(0, 9, "Printed: "+printedAt.Format("02/01/2006"), "", 1, "C", false, 0, "")
+		printed := "Printed: " + printedAt.Format("02/01/2006")
+		if label.Serial > 0 {
+			printed += fmt.Sprintf(" | Label #%d", label.Serial)
+		}
+		pdf.CellFormat(0, 9, printed, "", 1, "C", false, 0, "")
 
 		opt := gofpdf.ImageOptions{ImageType: "PNG", ReadDpi: false}
 		imageName := fmt.Sprintf("pallet-barcode-%d", label.PalletID)
@@ -151,17 +159,20 @@ func addClosedPalletLabelPage(pdf *gofpdf.Fpdf, label ClosedPalletLabelData, pag
 		batch = "-"
 	}
 	barcodeValue := strings.TrimSpace(label.BarcodeValue)
+	tr := pdftext.Translator(pdf)
+	phrases := labeltext.For(label.Language)
 
 	totalQty := label.TotalQty
 	if totalQty < 0 {
 		totalQty = 0
 	}
 
-	hasBarcode := barcodeValue != ""
+	symbology := labelbarcode.For(label.Symbology)
+	hasBarcode := labelbarcode.Validate(symbology.Code, barcodeValue) == nil
 	var barcodePNG []byte
 	var err error
 	if hasBarcode {
-		barcodePNG, err = renderCode128PNG(barcodeValue, 1200, 220)
+		barcodePNG, err = labelbarcode.RenderPNG(symbology.Code, barcodeValue, 1200, 220)
 		if err != nil {
 			return err
 		}
@@ -206,7 +217,7 @@ func addClosedPalletLabelPage(pdf *gofpdf.Fpdf, label ClosedPalletLabelData, pag
 	pdf.SetFont("Helvetica", "B", 9)
 	pdf.SetTextColor(80, 80, 80)
 	pdf.SetXY(x0+w0-45, y0+2)
-	pdf.CellFormat(43, 5, fmt.Sprintf("PALLET P%08d", label.PalletID), "", 0, "R", false, 0, "")
+	pdf.CellFormat(43, 5, fmt.Sprintf("%s P%08d", tr(phrases.Pallet), label.PalletID), "", 0, "R", false, 0, "")
 
 	pdf.SetTextColor(0, 0, 0)
 	pdf.SetFont("Helvetica", "B", 34)
@@ -218,25 +229,27 @@ func addClosedPalletLabelPage(pdf *gofpdf.Fpdf, label ClosedPalletLabelData, pag
 	fieldLabelFont := 10.5
 	pdf.SetFont("Helvetica", "B", fieldLabelFont)
 	pdf.SetXY(x0+2.5, yDescription+2)
-	pdf.CellFormat(w0-5, 5, "Description:", "", 0, "L", false, 0, "")
+	pdf.CellFormat(w0-5, 5, tr(phrases.Description), "", 0, "L", false, 0, "")
 	descriptionFont := fitFontSizeForWidth(pdf, "Helvetica", "B", 16, 9.5, description, w0-8)
 	pdf.SetFont("Helvetica", "B", descriptionFont)
 	pdf.SetXY(x0+4, yDescription+7)
 	pdf.CellFormat(w0-8, 8, description, "", 0, "L", false, 0, "")
 
 	pdf.SetFont("Helvetica", "B", fieldLabelFont)
+	skuCaption := tr(phrases.SKU)
+	skuCaptionW := math.Max(16, pdf.GetStringWidth(skuCaption)+2)
 	pdf.SetXY(x0+2.5, yDescription+15)
-	pdf.CellFormat(16, 5, "SKU:", "", 0, "L", false, 0, "")
-	skuFont := fitFontSizeForWidth(pdf, "Helvetica", "B", 15, 10, sku, w0-22)
+	pdf.CellFormat(skuCaptionW, 5, skuCaption, "", 0, "L", false, 0, "")
+	skuFont := fitFontSizeForWidth(pdf, "Helvetica", "B", 15, 10, sku, w0-skuCaptionW-6)
 	pdf.SetFont("Helvetica", "B", skuFont)
-	pdf.SetXY(x0+18, yDescription+15)
-	pdf.CellFormat(w0-21, 5, sku, "", 0, "L", false, 0, "")
+	pdf.SetXY(x0+skuCaptionW+2, yDescription+15)
+	pdf.CellFormat(w0-skuCaptionW-5, 5, sku, "", 0, "L", false, 0, "")
 
 	pdf.SetFont("Helvetica", "B", fieldLabelFont)
 	pdf.SetXY(x0+2.5, yExpiryDate+2)
-	pdf.CellFormat(leftW-5, 5, "Expiry:", "", 0, "L", false, 0, "")
+	pdf.CellFormat(leftW-5, 5, tr(phrases.Expiry), "", 0, "L", false, 0, "")
 	pdf.SetXY(x0+leftW+2.5, yExpiryDate+2)
-	pdf.CellFormat(rightW-5, 5, "Printed Date:", "", 0, "L", false, 0, "")
+	pdf.CellFormat(rightW-5, 5, tr(phrases.PrintedDate), "", 0, "L", false, 0, "")
 
 	expiryFont := fitFontSizeForWidth(pdf, "Helvetica", "B", 30, 16, expiry, leftW-10)
 	pdf.SetFont("Helvetica", "B", expiryFont)
@@ -250,9 +263,9 @@ func addClosedPalletLabelPage(pdf *gofpdf.Fpdf, label ClosedPalletLabelData, pag
 
 	pdf.SetFont("Helvetica", "B", fieldLabelFont)
 	pdf.SetXY(x0+2.5, yBarcodeBatch+2)
-	pdf.CellFormat(leftW-5, 5, "Barcode:", "", 0, "L", false, 0, "")
+	pdf.CellFormat(leftW-5, 5, tr(phrases.Barcode), "", 0, "L", false, 0, "")
 	pdf.SetXY(x0+leftW+2.5, yBarcodeBatch+2)
-	pdf.CellFormat(rightW-5, 5, "Batch No:", "", 0, "L", false, 0, "")
+	pdf.CellFormat(rightW-5, 5, tr(phrases.BatchNumber), "", 0, "L", false, 0, "")
 
 	if hasBarcode {
 		opt := gofpdf.ImageOptions{ImageType: "PNG", ReadDpi: false}
@@ -265,11 +278,21 @@ func addClosedPalletLabelPage(pdf *gofpdf.Fpdf, label ClosedPalletLabelData, pag
 		if barcodeH < 12 {
 			barcodeH = 12
 		}
+		if symbology.Square {
+			barcodeX += (barcodeW - barcodeH) / 2
+			barcodeW = barcodeH
+		}
 		pdf.ImageOptions(imageName, barcodeX, barcodeY, barcodeW, barcodeH, false, opt, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.SetXY(x0+4, yBarcodeBatch+rowBarcodeBatch-8)
+		pdf.CellFormat(leftW-8, 6, barcodeValue, "", 0, "C", false, 0, "")
+	} else {
+		// Printing an unreadable or wrong-format barcode is worse than none;
+		// say so plainly so the warehouse can relabel by hand.
+		pdf.SetFont("Helvetica", "B", 12)
+		pdf.SetXY(x0+5, yBarcodeBatch+9)
+		pdf.CellFormat(leftW-10, rowBarcodeBatch-14, labelbarcode.Placeholder(symbology.Code), "1", 0, "C", false, 0, "")
 	}
-	pdf.SetFont("Helvetica", "", 9)
-	pdf.SetXY(x0+4, yBarcodeBatch+rowBarcodeBatch-8)
-	pdf.CellFormat(leftW-8, 6, barcodeValue, "", 0, "C", false, 0, "")
 
 	batchFont := fitFontSizeForWidth(pdf, "Helvetica", "B", 22, 12, batch, rightW-10)
 	pdf.SetFont("Helvetica", "B", batchFont)
@@ -278,11 +301,11 @@ func addClosedPalletLabelPage(pdf *gofpdf.Fpdf, label ClosedPalletLabelData, pag
 
 	pdf.SetFont("Helvetica", "B", fieldLabelFont)
 	pdf.SetXY(x0+2.5, yTotals+2)
-	pdf.CellFormat(halfLeftW-5, 5, "NO. OF BOXES", "", 0, "L", false, 0, "")
+	pdf.CellFormat(halfLeftW-5, 5, tr(phrases.BoxCount), "", 0, "L", false, 0, "")
 	pdf.SetXY(x0+halfLeftW+2.5, yTotals+2)
-	pdf.CellFormat(halfLeftW-5, 5, "QTY PER CARTON", "", 0, "L", false, 0, "")
+	pdf.CellFormat(halfLeftW-5, 5, tr(phrases.QtyPerCarton), "", 0, "L", false, 0, "")
 	pdf.SetXY(x0+leftW+2.5, yTotals+2)
-	pdf.CellFormat(rightW-5, 5, "TOTAL QTY", "", 0, "L", false, 0, "")
+	pdf.CellFormat(rightW-5, 5, tr(phrases.TotalQty), "", 0, "L", false, 0, "")
 
 	totalQtyText := fmt.Sprintf("%d", totalQty)
 	totalQtyFont := fitFontSizeForWidth(pdf, "Helvetica", "B", 112, 48, totalQtyText, rightW-10)
@@ -304,27 +327,3 @@ func fitFontSizeForWidth(pdf *gofpdf.Fpdf, family, style string, base, min float
 	}
 	return size
 }
-
-func renderCode128PNG(value string, width, height int) ([]byte, error) {
-	code, err := code128.Encode(value)
-	if err != nil {
-		return nil, err
-	}
-	scaled, err := barcode.Scale(code, width, height)
-	if err != nil {
-		return nil, err
-	}
-	normalized := toNRGBA(scaled)
-	var barcodePNG bytes.Buffer
-	if err := png.Encode(&barcodePNG, normalized); err != nil {
-		return nil, err
-	}
-	return barcodePNG.Bytes(), nil
-}
-
-func toNRGBA(src image.Image) *image.NRGBA {
-	bounds := src.Bounds()
-	dst := image.NewNRGBA(bounds)
-	draw.Draw(dst, bounds, src, bounds.Min, draw.Src)
-	return dst
-}
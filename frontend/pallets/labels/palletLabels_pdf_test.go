@@ -11,6 +11,7 @@ func TestRenderPalletLabelPDF_GeneratesPDF(t *testing.T) {
 
 	pdf, code, err := renderPalletLabelPDF(
 		1,
+		2,
 		"Boba Formosa",
 		"Receipt Run Feb 2026",
 		time.Date(2026, 2, 19, 0, 0, 0, 0, time.UTC),
@@ -22,8 +23,8 @@ func TestRenderPalletLabelPDF_GeneratesPDF(t *testing.T) {
 	if len(pdf) == 0 {
 		t.Fatalf("expected non-empty pdf bytes")
 	}
-	if code != "P00000001" {
-		t.Fatalf("expected barcode code P00000001, got %q", code)
+	if code != "P00000001-2" {
+		t.Fatalf("expected barcode code P00000001-2, got %q", code)
 	}
 }
 
@@ -81,6 +82,25 @@ func TestRenderClosedPalletLabelPDF_GeneratesPDF(t *testing.T) {
 	}
 }
 
+func TestRenderClosedPalletLabelPDF_SymbologiesAndPlaceholder(t *testing.T) {
+	t.Parallel()
+
+	for _, label := range []ClosedPalletLabelData{
+		{PalletID: 78, ClientName: "Healthy Sales", Symbology: "qr", BarcodeValue: "018787244258", TotalQty: 1},
+		{PalletID: 79, ClientName: "Healthy Sales", Symbology: "itf14", BarcodeValue: "15012345678907", TotalQty: 1},
+		{PalletID: 80, ClientName: "Healthy Sales", Symbology: "ean13", BarcodeValue: "", TotalQty: 1},
+		{PalletID: 81, ClientName: "Healthy Sales", Symbology: "ean13", BarcodeValue: "not-a-gtin", TotalQty: 1},
+	} {
+		pdf, err := renderClosedPalletLabelPDF(label)
+		if err != nil {
+			t.Fatalf("render %s label %q: %v", label.Symbology, label.BarcodeValue, err)
+		}
+		if pages := countPDFPages(pdf); pages != 1 {
+			t.Fatalf("expected exactly 1 page for %s, got %d", label.Symbology, pages)
+		}
+	}
+}
+
 func TestRenderClosedPalletLabelsPDF_GeneratesCombinedPDF(t *testing.T) {
 	t.Parallel()
 
@@ -121,6 +141,33 @@ func TestRenderClosedPalletLabelsPDF_GeneratesCombinedPDF(t *testing.T) {
 	}
 }
 
+func TestRenderClosedPalletLabelPDF_TranslatedCaptions(t *testing.T) {
+	t.Parallel()
+
+	for _, language := range []string{"fr", "de", "pt", "unsupported"} {
+		pdf, err := renderClosedPalletLabelPDF(ClosedPalletLabelData{
+			PalletID:     78,
+			ClientName:   "Healthy Sales",
+			Description:  "Tea Tree All One Magic Soap 475ml",
+			SKU:          "SKU-1",
+			ExpiryDate:   "11/09/2028",
+			LabelDate:    "30/01/2026",
+			BatchNumber:  "12867EU12",
+			BarcodeValue: "018787244258",
+			BoxCount:     28,
+			QtyPerCarton: 12,
+			TotalQty:     347,
+			Language:     language,
+		})
+		if err != nil {
+			t.Fatalf("renderClosedPalletLabelPDF(%s) returned error: %v", language, err)
+		}
+		if pages := countPDFPages(pdf); pages != 1 {
+			t.Fatalf("expected exactly 1 page for %s, got %d", language, pages)
+		}
+	}
+}
+
 func countPDFPages(pdf []byte) int {
 	pageCount := bytes.Count(pdf, []byte("/Type /Page"))
 	pagesNodeCount := bytes.Count(pdf, []byte("/Type /Pages"))
@@ -0,0 +1,321 @@
+package move
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/coldstorage"
+	"receipter/infrastructure/pallets"
+	"receipter/infrastructure/phase"
+	"receipter/infrastructure/photovisibility"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/receipts"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+var (
+	ErrNothingSelected      = errors.New("select at least one line to move")
+	ErrSamePallet           = errors.New("choose a different pallet to move to")
+	ErrSourceReadOnly       = errors.New("lines cannot be moved off a cancelled pallet or an inactive project")
+	ErrTargetPalletNotFound = errors.New("target pallet not found on this project")
+	ErrTargetReadOnly       = errors.New("target pallet is cancelled")
+	ErrTargetPhaseClosed    = errors.New("target pallet's phase is closed")
+	ErrLineNotFound         = errors.New("receipt line not found on this pallet")
+	ErrLineClaimed          = errors.New("lines on a damage claim cannot be moved")
+)
+
+func LoadPageData(ctx context.Context, db *sqlite.DB, palletID int64) (PageData, error) {
+	data := PageData{
+		PalletID: palletID,
+		Lines:    make([]LineView, 0),
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`
+SELECT p.status, p.project_id, pj.name, pj.code
+FROM pallets p
+JOIN projects pj ON pj.id = p.project_id
+WHERE p.id = ?`, palletID).Scan(ctx, &data.PalletStatus, &data.ProjectID, &data.ProjectName, &data.ProjectCode); err != nil {
+			return err
+		}
+		return tx.NewRaw(`
+SELECT pr.id, pr.sku, pr.description, COALESCE(pr.uom, '') AS uom, pr.qty, pr.case_size,
+       pr.unknown_sku, pr.damaged,
+       COALESCE(pr.batch_number, '') AS batch_number,
+       COALESCE(strftime('%d/%m/%Y', pr.expiry_date), '') AS expiry_date,
+       (SELECT COUNT(1) FROM receipt_photos rp WHERE rp.pallet_receipt_id = pr.id)
+         + CASE WHEN pr.stock_photo_blob IS NOT NULL AND length(pr.stock_photo_blob) > 0 THEN 1 ELSE 0 END AS photos,
+       EXISTS (SELECT 1 FROM damage_claim_lines dcl WHERE dcl.pallet_receipt_id = pr.id) AS claimed
+FROM pallet_receipts pr
+WHERE pr.pallet_id = ?
+ORDER BY pr.sku, pr.id`, palletID).Scan(ctx, &data.Lines)
+	})
+	return data, err
+}
+
+// moveSnapshot is a receipt line as audited by a move, with where it came
+// from and, when it was merged, the target line that took it.
+type moveSnapshot struct {
+	models.PalletReceipt
+	FromPalletID        int64 `json:",omitempty"`
+	FromReceiptID       int64 `json:",omitempty"`
+	MergedIntoReceiptID int64 `json:",omitempty"`
+}
+
+// Move moves whole receipt lines to another pallet of the same project,
+// for stock scanned onto the wrong pallet. A moved line that matches a
+// target line as a new scan would is added onto it, taking its photos,
+// serials and custom field values along; otherwise the line itself moves.
+// Projects that keep every scan separate never merge.
+func Move(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID int64, input Input) (Result, error) {
+	var result Result
+	if userID <= 0 {
+		return result, fmt.Errorf("invalid user id")
+	}
+	if input.TargetPalletID == input.SourcePalletID {
+		return result, ErrSamePallet
+	}
+	if len(input.ReceiptIDs) == 0 && !input.All {
+		return result, ErrNothingSelected
+	}
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var projectID int64
+		var sourceStatus, projectStatus string
+		if err := tx.NewRaw(`
+SELECT p.project_id, p.status, pj.status
+FROM pallets p
+JOIN projects pj ON pj.id = p.project_id
+WHERE p.id = ?`, input.SourcePalletID).Scan(ctx, &projectID, &sourceStatus, &projectStatus); err != nil {
+			return err
+		}
+		if !pallets.CanReceive(projectStatus, sourceStatus, true) {
+			return ErrSourceReadOnly
+		}
+		if err := phase.CheckPalletTx(ctx, tx, input.SourcePalletID); err != nil {
+			return err
+		}
+
+		var targetStatus string
+		if err := tx.NewRaw(`SELECT status FROM pallets WHERE id = ? AND project_id = ?`, input.TargetPalletID, projectID).Scan(ctx, &targetStatus); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrTargetPalletNotFound
+			}
+			return err
+		}
+		if !pallets.CanReceive(projectStatus, targetStatus, true) {
+			return ErrTargetReadOnly
+		}
+		if err := phase.CheckPalletTx(ctx, tx, input.TargetPalletID); errors.Is(err, phase.ErrClosed) {
+			return ErrTargetPhaseClosed
+		} else if err != nil {
+			return err
+		}
+
+		ids := uniqueIDs(input.ReceiptIDs)
+		if input.All {
+			ids = make([]int64, 0)
+			if err := tx.NewRaw(`SELECT id FROM pallet_receipts WHERE pallet_id = ? ORDER BY id`, input.SourcePalletID).Scan(ctx, &ids); err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				return ErrNothingSelected
+			}
+		}
+
+		settings, err := projectsettings.LoadTx(ctx, tx, projectID)
+		if err != nil {
+			return err
+		}
+		merging := settings.String(projectsettings.ReceiptMergeMode) != projectsettings.MergeModeSeparate
+
+		now := time.Now()
+		for _, id := range ids {
+			var line models.PalletReceipt
+			if err := tx.NewSelect().Model(&line).Where("id = ?", id).Where("pallet_id = ?", input.SourcePalletID).Limit(1).Scan(ctx); err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return ErrLineNotFound
+				}
+				return err
+			}
+			var claimed bool
+			if err := tx.NewRaw(`SELECT EXISTS (SELECT 1 FROM damage_claim_lines WHERE pallet_receipt_id = ?)`, id).Scan(ctx, &claimed); err != nil {
+				return err
+			}
+			if claimed {
+				return fmt.Errorf("%w: %s", ErrLineClaimed, line.SKU)
+			}
+
+			merged := false
+			if merging {
+				target, found, err := receipts.FindMatch(ctx, tx, input.TargetPalletID, line)
+				if err != nil {
+					return err
+				}
+				if found {
+					if merged, err = mergeLine(ctx, tx, auditSvc, userID, line, target, now); err != nil {
+						return err
+					}
+				}
+			}
+			if !merged {
+				if err := moveLine(ctx, tx, auditSvc, userID, line, input.TargetPalletID, now); err != nil {
+					return err
+				}
+			} else {
+				result.Merged++
+			}
+			result.Lines++
+			result.Qty += line.Qty
+		}
+
+		var remaining int64
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM pallet_receipts WHERE pallet_id = ?`, input.SourcePalletID).Scan(ctx, &remaining); err != nil {
+			return err
+		}
+		result.SourceEmpty = remaining == 0
+		return pallets.PromoteToOpen(ctx, tx, projectID, input.TargetPalletID)
+	})
+	return result, err
+}
+
+// moveLine reassigns a whole line to the target pallet. Its photos and
+// other records hang off the line and move with it.
+func moveLine(ctx context.Context, tx bun.Tx, auditSvc *audit.Service, userID int64, line models.PalletReceipt, targetPalletID int64, now time.Time) error {
+	before := line
+	line.PalletID = targetPalletID
+	line.UpdatedAt = now
+	if _, err := tx.NewUpdate().Model(&line).WherePK().Exec(ctx); err != nil {
+		return err
+	}
+	if auditSvc == nil {
+		return nil
+	}
+	return auditSvc.Write(ctx, tx, userID, "receipt.move", "pallet_receipts", strconv.FormatInt(line.ID, 10), before, moveSnapshot{
+		PalletReceipt: line,
+		FromPalletID:  before.PalletID,
+	})
+}
+
+// mergeLine adds line onto target and deletes it. The target keeps its own
+// details and takes line's comment only when it has none. A primary photo
+// becomes the target's when it has none, or else one of its gallery
+// photos. A primary photo in cold storage cannot be turned into a gallery
+// photo, so when both lines have one it reports false and merges nothing.
+func mergeLine(ctx context.Context, tx bun.Tx, auditSvc *audit.Service, userID int64, line, target models.PalletReceipt, now time.Time) (bool, error) {
+	lineCold, err := hasColdPrimary(ctx, tx, line.ID)
+	if err != nil {
+		return false, err
+	}
+	targetCold, err := hasColdPrimary(ctx, tx, target.ID)
+	if err != nil {
+		return false, err
+	}
+	linePrimary := len(line.StockPhotoBlob) > 0 || lineCold
+	targetPrimary := len(target.StockPhotoBlob) > 0 || targetCold
+	if linePrimary && targetPrimary && lineCold {
+		return false, nil
+	}
+
+	before := target
+	target.Qty += line.Qty
+	target.DamagedQty += line.DamagedQty
+	if target.Comment == "" {
+		target.Comment = line.Comment
+	}
+	target.UpdatedAt = now
+
+	switch {
+	case linePrimary && !targetPrimary:
+		target.StockPhotoBlob = line.StockPhotoBlob
+		target.StockPhotoMIME = line.StockPhotoMIME
+		target.StockPhotoName = line.StockPhotoName
+		if _, err := tx.ExecContext(ctx, `UPDATE cold_storage_photos SET photo_id = ? WHERE source = ? AND photo_id = ?`, target.ID, coldstorage.SourcePrimary, line.ID); err != nil {
+			return false, err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM internal_photos WHERE source = ? AND photo_id = ?`, photovisibility.SourcePrimary, target.ID); err != nil {
+			return false, err
+		}
+		if _, err := tx.ExecContext(ctx, `
+UPDATE internal_photos SET photo_id = ?, pallet_receipt_id = ?
+WHERE source = ? AND photo_id = ?`, target.ID, target.ID, photovisibility.SourcePrimary, line.ID); err != nil {
+			return false, err
+		}
+	case linePrimary:
+		var photoID int64
+		if err := tx.NewRaw(`
+INSERT INTO receipt_photos (pallet_receipt_id, photo_blob, photo_mime, photo_name, created_at)
+VALUES (?, ?, ?, ?, ?)
+RETURNING id`, target.ID, line.StockPhotoBlob, line.StockPhotoMIME, line.StockPhotoName, line.CreatedAt).Scan(ctx, &photoID); err != nil {
+			return false, err
+		}
+		if _, err := tx.ExecContext(ctx, `
+UPDATE internal_photos SET source = ?, photo_id = ?
+WHERE source = ? AND photo_id = ?`, photovisibility.SourceGallery, photoID, photovisibility.SourcePrimary, line.ID); err != nil {
+			return false, err
+		}
+	}
+	if _, err := tx.NewUpdate().Model(&target).WherePK().Exec(ctx); err != nil {
+		return false, err
+	}
+
+	for _, stmt := range []string{
+		`UPDATE receipt_photos SET pallet_receipt_id = ? WHERE pallet_receipt_id = ?`,
+		`UPDATE internal_photos SET pallet_receipt_id = ? WHERE pallet_receipt_id = ?`,
+		`UPDATE photo_uploads SET pallet_receipt_id = ? WHERE pallet_receipt_id = ?`,
+		`UPDATE receipt_serials SET pallet_receipt_id = ? WHERE pallet_receipt_id = ?`,
+		`INSERT INTO receipt_custom_values (pallet_receipt_id, field_id, value)
+SELECT ?, field_id, value FROM receipt_custom_values WHERE pallet_receipt_id = ?
+ON CONFLICT(pallet_receipt_id, field_id) DO NOTHING`,
+	} {
+		if _, err := tx.ExecContext(ctx, stmt, target.ID, line.ID); err != nil {
+			return false, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM receipt_custom_values WHERE pallet_receipt_id = ?`, line.ID); err != nil {
+		return false, err
+	}
+	if err := receipts.DeleteLine(ctx, tx, line.ID); err != nil {
+		return false, err
+	}
+
+	if auditSvc == nil {
+		return true, nil
+	}
+	if err := auditSvc.Write(ctx, tx, userID, "receipt.move", "pallet_receipts", strconv.FormatInt(line.ID, 10), line, moveSnapshot{
+		PalletReceipt:       target,
+		FromPalletID:        line.PalletID,
+		FromReceiptID:       line.ID,
+		MergedIntoReceiptID: target.ID,
+	}); err != nil {
+		return false, err
+	}
+	return true, auditSvc.Write(ctx, tx, userID, "receipt.merge", "pallet_receipts", strconv.FormatInt(target.ID, 10), before, target)
+}
+
+func hasColdPrimary(ctx context.Context, tx bun.Tx, receiptID int64) (bool, error) {
+	var cold bool
+	err := tx.NewRaw(`SELECT EXISTS (SELECT 1 FROM cold_storage_photos WHERE source = ? AND photo_id = ?)`, coldstorage.SourcePrimary, receiptID).Scan(ctx, &cold)
+	return cold, err
+}
+
+// uniqueIDs returns ids sorted without duplicates.
+func uniqueIDs(ids []int64) []int64 {
+	out := append([]int64(nil), ids...)
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	unique := out[:0]
+	for i, id := range out {
+		if i == 0 || id != out[i-1] {
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
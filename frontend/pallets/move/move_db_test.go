@@ -0,0 +1,170 @@
+package move
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+func openMoveTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "move-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "..", "..", "infrastructure", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin');
+INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+  (1, 'PO 100', 'd', '2026-01-01', 'Acme', 'po-100', 'active'),
+  (2, 'PO 200', 'd', '2026-01-01', 'Acme', 'po-200', 'active');
+INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open'), (2, 1, 'closed'), (3, 1, 'cancelled'), (4, 2, 'open'), (5, 1, 'created');
+INSERT INTO project_custom_fields (id, project_id, key, label) VALUES (1, 1, 'po_line', 'PO line');
+INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, batch_number, stock_photo_blob) VALUES
+  (1, 1, 1, 'SKU-A', 'Alpha', 1, 5, 'B1', X'FFD8'),
+  (2, 1, 1, 'SKU-B', 'Bravo', 1, 3, '', NULL),
+  (3, 1, 1, 'SKU-C', 'Charlie', 1, 1, '', NULL),
+  (10, 1, 2, 'SKU-A', 'Alpha', 1, 2, 'B1', X'FFD9');
+INSERT INTO receipt_photos (pallet_receipt_id, photo_blob) VALUES (1, X'FFD8'), (2, X'FFD8');
+INSERT INTO internal_photos (source, photo_id, pallet_receipt_id) VALUES ('pallet_receipts', 1, 1);
+INSERT INTO receipt_serials (project_id, pallet_receipt_id, serial) VALUES (1, 1, 'SN-1');
+INSERT INTO receipt_custom_values (pallet_receipt_id, field_id, value) VALUES (1, 1, '7');
+`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed data: %v", err)
+	}
+	return db
+}
+
+func TestMove_MergesMatchingLinesAndMovesTheRest(t *testing.T) {
+	db := openMoveTestDB(t)
+	ctx := context.Background()
+
+	result, err := Move(ctx, db, audit.NewService(), 1, Input{SourcePalletID: 1, TargetPalletID: 2, ReceiptIDs: []int64{2, 1, 2}})
+	if err != nil {
+		t.Fatalf("move: %v", err)
+	}
+	if result.Lines != 2 || result.Merged != 1 || result.Qty != 8 || result.SourceEmpty {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	type line struct {
+		ID       int64 `bun:"id"`
+		PalletID int64 `bun:"pallet_id"`
+		Qty      int64 `bun:"qty"`
+		Photos   int64 `bun:"photos"`
+	}
+	lines := make([]line, 0)
+	var serialLine, internalPhotoLine, moves, merges int64
+	var poLine string
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`
+SELECT pr.id, pr.pallet_id, pr.qty,
+       (SELECT COUNT(1) FROM receipt_photos rp WHERE rp.pallet_receipt_id = pr.id) AS photos
+FROM pallet_receipts pr ORDER BY pr.id`).Scan(ctx, &lines); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT pallet_receipt_id FROM receipt_serials WHERE serial = 'SN-1'`).Scan(ctx, &serialLine); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT pallet_receipt_id FROM internal_photos WHERE source = 'receipt_photos'`).Scan(ctx, &internalPhotoLine); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT value FROM receipt_custom_values WHERE pallet_receipt_id = 10 AND field_id = 1`).Scan(ctx, &poLine); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM audit_logs WHERE action = 'receipt.move'`).Scan(ctx, &moves); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT COUNT(1) FROM audit_logs WHERE action = 'receipt.merge' AND entity_id = '10'`).Scan(ctx, &merges)
+	})
+	if err != nil {
+		t.Fatalf("load results: %v", err)
+	}
+	// Line 1 merges into line 10, which keeps its own primary photo and
+	// takes line 1's as a gallery photo next to line 1's gallery photo.
+	// Line 2 moves whole and line 3 stays.
+	if len(lines) != 3 {
+		t.Fatalf("lines = %+v, want 3", lines)
+	}
+	if l := lines[0]; l.ID != 2 || l.PalletID != 2 || l.Qty != 3 || l.Photos != 1 {
+		t.Fatalf("moved line = %+v", l)
+	}
+	if l := lines[1]; l.ID != 3 || l.PalletID != 1 {
+		t.Fatalf("untouched line = %+v", l)
+	}
+	if l := lines[2]; l.ID != 10 || l.Qty != 7 || l.Photos != 2 {
+		t.Fatalf("merged line = %+v", l)
+	}
+	if serialLine != 10 || internalPhotoLine != 10 || poLine != "7" {
+		t.Fatalf("expected serial, internal photo and custom value on line 10, got %d %d %q", serialLine, internalPhotoLine, poLine)
+	}
+	if moves != 2 || merges != 1 {
+		t.Fatalf("audit entries move %d merge %d, want 2 and 1", moves, merges)
+	}
+}
+
+func TestMove_AllMergesTheWholePallet(t *testing.T) {
+	db := openMoveTestDB(t)
+	ctx := context.Background()
+
+	result, err := Move(ctx, db, nil, 1, Input{SourcePalletID: 1, TargetPalletID: 5, All: true})
+	if err != nil {
+		t.Fatalf("move all: %v", err)
+	}
+	if result.Lines != 3 || result.Merged != 0 || result.Qty != 9 || !result.SourceEmpty {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	var status string
+	var primary []byte
+	if err := db.R.NewRaw(`SELECT status FROM pallets WHERE id = 5`).Scan(ctx, &status); err != nil {
+		t.Fatalf("load target status: %v", err)
+	}
+	if err := db.R.NewRaw(`SELECT stock_photo_blob FROM pallet_receipts WHERE id = 1 AND pallet_id = 5`).Scan(ctx, &primary); err != nil {
+		t.Fatalf("load moved line: %v", err)
+	}
+	if status != "open" || len(primary) == 0 {
+		t.Fatalf("expected an open target holding line 1 with its photo, got %q %d bytes", status, len(primary))
+	}
+}
+
+func TestMove_Rejects(t *testing.T) {
+	db := openMoveTestDB(t)
+	ctx := context.Background()
+
+	for name, tc := range map[string]struct {
+		input Input
+		want  error
+	}{
+		"nothing":          {Input{SourcePalletID: 1, TargetPalletID: 2}, ErrNothingSelected},
+		"same pallet":      {Input{SourcePalletID: 1, TargetPalletID: 1, ReceiptIDs: []int64{1}}, ErrSamePallet},
+		"other project":    {Input{SourcePalletID: 1, TargetPalletID: 4, ReceiptIDs: []int64{1}}, ErrTargetPalletNotFound},
+		"cancelled target": {Input{SourcePalletID: 1, TargetPalletID: 3, ReceiptIDs: []int64{1}}, ErrTargetReadOnly},
+		"cancelled source": {Input{SourcePalletID: 3, TargetPalletID: 1, ReceiptIDs: []int64{1}}, ErrSourceReadOnly},
+		"other pallet":     {Input{SourcePalletID: 2, TargetPalletID: 1, ReceiptIDs: []int64{1}}, ErrLineNotFound},
+	} {
+		if _, err := Move(ctx, db, nil, 1, tc.input); !errors.Is(err, tc.want) {
+			t.Fatalf("%s: err = %v, want %v", name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package move
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/palletlabel"
+	"receipter/infrastructure/sqlite"
+)
+
+func pageURL(palletID int64) string {
+	return fmt.Sprintf("/tasker/pallets/%d/move", palletID)
+}
+
+func parsePalletID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid pallet id")
+	}
+	return id, nil
+}
+
+// MovePageQueryHandler lists a pallet's lines for an admin to move to
+// another pallet of the same project.
+func MovePageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		palletID, err := parsePalletID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := LoadPageData(r.Context(), db, palletID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "pallet not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to load pallet", http.StatusInternalServerError)
+			return
+		}
+		data.Status = r.URL.Query().Get("status")
+		data.ErrorMessage = r.URL.Query().Get("error")
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := MovePage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render move page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func MoveCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		palletID, err := parsePalletID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, pageURL(palletID)+"?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+
+		input := Input{
+			SourcePalletID: palletID,
+			All:            r.FormValue("all") != "",
+		}
+		// The target is typed as printed on its label, such as P00000012, or
+		// scanned from it.
+		input.TargetPalletID, _, _ = palletlabel.ParseCode(r.FormValue("target_pallet"))
+		if input.TargetPalletID == 0 {
+			http.Redirect(w, r, pageURL(palletID)+"?error="+url.QueryEscape("enter the pallet to move to"), http.StatusSeeOther)
+			return
+		}
+		if !input.All {
+			for _, raw := range r.PostForm["receipt_id"] {
+				receiptID, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+				if err != nil || receiptID <= 0 {
+					http.Redirect(w, r, pageURL(palletID)+"?error="+url.QueryEscape("invalid receipt line"), http.StatusSeeOther)
+					return
+				}
+				input.ReceiptIDs = append(input.ReceiptIDs, receiptID)
+			}
+		}
+
+		result, err := Move(r.Context(), db, auditSvc, session.UserID, input)
+		if err != nil {
+			http.Redirect(w, r, pageURL(palletID)+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		lines := "1 line"
+		if result.Lines != 1 {
+			lines = fmt.Sprintf("%d lines", result.Lines)
+		}
+		status := fmt.Sprintf("moved qty %d on %s to P%08d", result.Qty, lines, input.TargetPalletID)
+		if result.Merged > 0 {
+			status += fmt.Sprintf(", %d merged into matching lines", result.Merged)
+		}
+		if result.SourceEmpty {
+			status += fmt.Sprintf("; P%08d is now empty", palletID)
+		}
+		http.Redirect(w, r, pageURL(palletID)+"?status="+url.QueryEscape(status), http.StatusSeeOther)
+	}
+}
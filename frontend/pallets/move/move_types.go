@@ -0,0 +1,46 @@
+package move
+
+type LineView struct {
+	ID          int64  `bun:"id"`
+	SKU         string `bun:"sku"`
+	Description string `bun:"description"`
+	UOM         string `bun:"uom"`
+	Qty         int64  `bun:"qty"`
+	CaseSize    int64  `bun:"case_size"`
+	UnknownSKU  bool   `bun:"unknown_sku"`
+	Damaged     bool   `bun:"damaged"`
+	BatchNumber string `bun:"batch_number"`
+	ExpiryDate  string `bun:"expiry_date"`
+	Photos      int64  `bun:"photos"`
+	// Claimed lines are on a damage claim and stay put.
+	Claimed bool `bun:"claimed"`
+}
+
+type PageData struct {
+	PalletID     int64
+	PalletStatus string
+	ProjectID    int64
+	ProjectName  string
+	ProjectCode  string
+	Lines        []LineView
+	Status       string
+	ErrorMessage string
+}
+
+// Input moves the listed lines of SourcePalletID to TargetPalletID on the
+// same project. All moves every line, merging the whole pallet.
+type Input struct {
+	SourcePalletID int64
+	TargetPalletID int64
+	ReceiptIDs     []int64
+	All            bool
+}
+
+type Result struct {
+	Lines int
+	// Merged counts the moved lines added onto a matching target line.
+	Merged int
+	Qty    int64
+	// SourceEmpty is set once no lines are left on the source pallet.
+	SourceEmpty bool
+}
@@ -0,0 +1,133 @@
+package progress
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/sqlite"
+)
+
+const calendarDateLayout = "2006-01-02"
+
+// LoadCalendar loads a month of receiving activity for the project. month
+// may be any day of the month; when day is not zero, the pallets created or
+// closed on it are loaded too. now marks today on the grid.
+func LoadCalendar(ctx context.Context, db *sqlite.DB, projectID int64, month, day, now time.Time) (CalendarPageData, error) {
+	data := CalendarPageData{
+		ProjectID:  projectID,
+		Month:      time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC),
+		DayPallets: make([]CalendarPallet, 0),
+	}
+	if !day.IsZero() {
+		data.Day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	// The grid runs Monday to Sunday from the week of the 1st to the week
+	// of the last day.
+	gridStart := data.Month.AddDate(0, 0, -((int(data.Month.Weekday()) + 6) % 7))
+	monthEnd := data.Month.AddDate(0, 1, -1)
+	gridEnd := monthEnd.AddDate(0, 0, (7-int(monthEnd.Weekday()))%7)
+	from, to := gridStart.Format(calendarDateLayout), gridEnd.Format(calendarDateLayout)
+
+	type dayCount struct {
+		Day        string `bun:"day"`
+		Count      int64  `bun:"count"`
+		Qty        int64  `bun:"qty"`
+		Deliveries int64  `bun:"deliveries"`
+	}
+	created := make([]dayCount, 0)
+	closed := make([]dayCount, 0)
+	lines := make([]dayCount, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT name, client_name FROM projects WHERE id = ?`, projectID).Scan(ctx, &data.ProjectName, fieldcrypt.Dest(&data.ProjectClientName)); err != nil {
+			return err
+		}
+		settings, err := projectsettings.LoadTx(ctx, tx, projectID)
+		if err != nil {
+			return err
+		}
+		data.Capacity = settings.Int(projectsettings.PalletDailyCapacity)
+
+		if err := tx.NewRaw(`
+SELECT date(p.created_at) AS day, COUNT(1) AS count,
+       COUNT(DISTINCT NULLIF(TRIM(pa.delivery_reference), '')) AS deliveries
+FROM pallets p
+LEFT JOIN pallet_attributes pa ON pa.pallet_id = p.id
+WHERE p.project_id = ? AND p.status != 'cancelled'
+  AND date(p.created_at) BETWEEN ? AND ?
+GROUP BY day`, projectID, from, to).Scan(ctx, &created); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`
+SELECT date(closed_at) AS day, COUNT(1) AS count
+FROM pallets
+WHERE project_id = ? AND status IN ('closed', 'labelled') AND closed_at IS NOT NULL
+  AND date(closed_at) BETWEEN ? AND ?
+GROUP BY day`, projectID, from, to).Scan(ctx, &closed); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`
+SELECT date(created_at) AS day, COUNT(1) AS count, COALESCE(SUM(qty), 0) AS qty
+FROM pallet_receipts
+WHERE project_id = ? AND date(created_at) BETWEEN ? AND ?
+GROUP BY day`, projectID, from, to).Scan(ctx, &lines); err != nil {
+			return err
+		}
+
+		if data.Day.IsZero() {
+			return nil
+		}
+		selected := data.Day.Format(calendarDateLayout)
+		return tx.NewRaw(`
+SELECT p.id, p.status, COALESCE(pa.delivery_reference, '') AS delivery_reference,
+       (SELECT COUNT(1) FROM pallet_receipts pr WHERE pr.pallet_id = p.id) AS line_count,
+       strftime('%d/%m/%Y %H:%M', p.created_at) AS created_at,
+       COALESCE(strftime('%d/%m/%Y %H:%M', p.closed_at), '') AS closed_at
+FROM pallets p
+LEFT JOIN pallet_attributes pa ON pa.pallet_id = p.id
+WHERE p.project_id = ? AND p.status != 'cancelled'
+  AND (date(p.created_at) = ? OR (p.status IN ('closed', 'labelled') AND date(p.closed_at) = ?))
+ORDER BY p.id`, projectID, selected, selected).Scan(ctx, &data.DayPallets)
+	})
+	if err != nil {
+		return data, err
+	}
+
+	days := make(map[string]*CalendarDay)
+	today := now.UTC().Format(calendarDateLayout)
+	for date := gridStart; !date.After(gridEnd); date = date.AddDate(0, 0, 7) {
+		week := make([]CalendarDay, 7)
+		for i := range week {
+			d := date.AddDate(0, 0, i)
+			week[i] = CalendarDay{
+				Date:    d,
+				InMonth: d.Month() == data.Month.Month(),
+				IsToday: d.Format(calendarDateLayout) == today,
+			}
+			days[d.Format(calendarDateLayout)] = &week[i]
+		}
+		data.Weeks = append(data.Weeks, week)
+	}
+	for _, c := range created {
+		if d, ok := days[c.Day]; ok {
+			d.Created = c.Count
+			d.Deliveries = c.Deliveries
+		}
+	}
+	for _, c := range closed {
+		if d, ok := days[c.Day]; ok {
+			d.Closed = c.Count
+		}
+	}
+	for _, c := range lines {
+		if d, ok := days[c.Day]; ok {
+			d.Lines = c.Count
+			d.Qty = c.Qty
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,88 @@
+package progress
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+func TestLoadCalendar_AggregatesDaysAndListsSelectedDay(t *testing.T) {
+	db := openProgressTestDB(t)
+	ctx := context.Background()
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin')`,
+			`INSERT INTO project_settings (project_id, key, value) VALUES (1, 'pallet.daily_capacity', '2')`,
+			`INSERT INTO pallets (id, project_id, status, created_at, closed_at) VALUES
+			 (1, 1, 'closed', '2026-03-02 08:00:00', '2026-03-03 10:00:00'),
+			 (2, 1, 'open', '2026-03-02 09:00:00', NULL),
+			 (3, 1, 'cancelled', '2026-03-02 10:00:00', NULL),
+			 (4, 1, 'labelled', '2026-03-03 07:00:00', '2026-03-03 15:00:00'),
+			 (5, 1, 'created', '2026-02-27 07:00:00', NULL)`,
+			`INSERT INTO pallet_attributes (pallet_id, delivery_reference) VALUES (1, 'DEL-1'), (2, 'DEL-1'), (4, 'DEL-2')`,
+			`INSERT INTO pallet_receipts (project_id, pallet_id, sku, description, scanned_by_user_id, qty, created_at) VALUES
+			 (1, 1, 'SKU-A', 'A', 1, 4, '2026-03-02 08:30:00'),
+			 (1, 1, 'SKU-B', 'B', 1, 6, '2026-03-03 09:00:00')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	now := time.Date(2026, 3, 3, 12, 0, 0, 0, time.UTC)
+	data, err := LoadCalendar(ctx, db, 1, time.Date(2026, 3, 17, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC), now)
+	if err != nil {
+		t.Fatalf("load calendar: %v", err)
+	}
+	if data.Capacity != 2 {
+		t.Fatalf("capacity = %d, want 2", data.Capacity)
+	}
+	// March 2026 starts on a Sunday and ends on a Tuesday, so the grid runs
+	// from Mon 23 Feb to Sun 5 Apr.
+	if len(data.Weeks) != 6 || !data.Weeks[0][0].Date.Equal(time.Date(2026, 2, 23, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("grid = %d weeks from %v", len(data.Weeks), data.Weeks[0][0].Date)
+	}
+
+	days := make(map[string]CalendarDay)
+	for _, week := range data.Weeks {
+		for _, day := range week {
+			days[day.Date.Format(calendarDateLayout)] = day
+		}
+	}
+	mar2 := days["2026-03-02"]
+	if mar2.Created != 2 || mar2.Deliveries != 1 || mar2.Lines != 1 || mar2.Qty != 4 || mar2.Closed != 0 {
+		t.Fatalf("2 March = %+v", mar2)
+	}
+	if got := data.CapacityState(mar2); got != CapacityReached {
+		t.Fatalf("2 March capacity = %q, want reached", got)
+	}
+	mar3 := days["2026-03-03"]
+	if mar3.Created != 1 || mar3.Closed != 2 || !mar3.IsToday {
+		t.Fatalf("3 March = %+v", mar3)
+	}
+	if got := data.CapacityState(mar3); got != CapacityOK {
+		t.Fatalf("3 March capacity = %q, want ok", got)
+	}
+	// Days outside the month still show activity but get no indicator.
+	feb27 := days["2026-02-27"]
+	if feb27.InMonth || feb27.Created != 1 || data.CapacityState(feb27) != CapacityNone {
+		t.Fatalf("27 February = %+v", feb27)
+	}
+	if totals := data.MonthTotals(); totals.Created != 3 || totals.Closed != 2 || totals.Lines != 2 {
+		t.Fatalf("month totals = %+v", totals)
+	}
+
+	if len(data.DayPallets) != 2 || data.DayPallets[0].ID != 1 || data.DayPallets[1].ID != 4 {
+		t.Fatalf("3 March pallets = %+v, want 1 (closed) and 4 (created and closed)", data.DayPallets)
+	}
+	if data.DayPallets[1].DeliveryReference != "DEL-2" {
+		t.Fatalf("pallet 4 delivery = %q", data.DayPallets[1].DeliveryReference)
+	}
+}
@@ -0,0 +1,64 @@
+package progress
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/sqlite"
+)
+
+// CalendarPageQueryHandler renders a month of receiving activity for the
+// active project. ?month=YYYY-MM picks the month and ?day=YYYY-MM-DD lists
+// that day's pallets; ?fragment=1 renders only the refreshed body.
+func CalendarPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok || session.ActiveProjectID == nil || *session.ActiveProjectID <= 0 {
+			if ok && hasRole(session.UserRoles, rbac.RoleAdmin) {
+				http.Redirect(w, r, "/tasker/projects", http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "no active project selected", http.StatusForbidden)
+			return
+		}
+
+		now := time.Now().UTC()
+		query := r.URL.Query()
+		month := now
+		var day time.Time
+		if parsed, err := time.Parse(calendarDateLayout, query.Get("day")); err == nil {
+			day, month = parsed, parsed
+		}
+		if parsed, err := time.Parse("2006-01", query.Get("month")); err == nil {
+			month = parsed
+		}
+
+		data, err := LoadCalendar(r.Context(), db, *session.ActiveProjectID, month, day, now)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "project not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to load calendar", http.StatusInternalServerError)
+			return
+		}
+		data.IsAdmin = hasRole(session.UserRoles, rbac.RoleAdmin)
+		data.CanExportOwnLines = hasRole(session.UserRoles, rbac.RoleScanner) && !session.Kiosk()
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if query.Get("fragment") == "1" {
+			if err := PalletCalendarFragment(data).Render(r.Context(), w); err != nil {
+				http.Error(w, "failed to render calendar fragment", http.StatusInternalServerError)
+			}
+			return
+		}
+		if err := PalletCalendar(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render calendar", http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package progress
+
+import "time"
+
+// Capacity states of a calendar day against the project's daily capacity.
+const (
+	CapacityNone    = ""
+	CapacityOK      = "ok"
+	CapacityNear    = "near"
+	CapacityReached = "reached"
+
+	// capacityNearPercent of the daily capacity marks a day as busy.
+	capacityNearPercent = 75
+)
+
+// CalendarDay is one day of receiving activity on the calendar.
+type CalendarDay struct {
+	Date    time.Time
+	InMonth bool
+	IsToday bool
+	// Created and Closed count pallets created and closed that day;
+	// cancelled pallets are left out.
+	Created int64
+	Closed  int64
+	// Lines and Qty are the receipt lines scanned that day.
+	Lines int64
+	Qty   int64
+	// Deliveries counts the distinct delivery references of the pallets
+	// created that day.
+	Deliveries int64
+}
+
+// Active reports whether anything happened on the day.
+func (d CalendarDay) Active() bool {
+	return d.Created > 0 || d.Closed > 0 || d.Lines > 0
+}
+
+// CalendarPallet is a pallet listed for the selected day.
+type CalendarPallet struct {
+	ID                int64  `bun:"id"`
+	Status            string `bun:"status"`
+	DeliveryReference string `bun:"delivery_reference"`
+	LineCount         int64  `bun:"line_count"`
+	CreatedAt         string `bun:"created_at"`
+	ClosedAt          string `bun:"closed_at"`
+}
+
+type CalendarPageData struct {
+	ProjectID         int64
+	ProjectName       string
+	ProjectClientName string
+	IsAdmin           bool
+	// CanExportOwnLines offers a scanner the CSV of the lines they scanned
+	// on the selected day.
+	CanExportOwnLines bool
+	// Month is the first day of the month shown.
+	Month time.Time
+	// Capacity is the project's daily pallet capacity; 0 when unset.
+	Capacity int64
+	// Weeks are the Monday-first rows of the month grid, padded with days
+	// of the neighbouring months.
+	Weeks [][]CalendarDay
+	// Day is the selected day, zero when none is selected; DayPallets are
+	// the pallets created or closed on it.
+	Day        time.Time
+	DayPallets []CalendarPallet
+}
+
+// CapacityState grades the pallets created on day against the capacity.
+func (d CalendarPageData) CapacityState(day CalendarDay) string {
+	if d.Capacity <= 0 || !day.InMonth {
+		return CapacityNone
+	}
+	switch {
+	case day.Created >= d.Capacity:
+		return CapacityReached
+	case day.Created*100 >= d.Capacity*capacityNearPercent:
+		return CapacityNear
+	}
+	return CapacityOK
+}
+
+// MonthTotals sums the days of the month shown.
+func (d CalendarPageData) MonthTotals() CalendarDay {
+	var total CalendarDay
+	for _, week := range d.Weeks {
+		for _, day := range week {
+			if !day.InMonth {
+				continue
+			}
+			total.Created += day.Created
+			total.Closed += day.Closed
+			total.Lines += day.Lines
+			total.Qty += day.Qty
+			total.Deliveries += day.Deliveries
+		}
+	}
+	return total
+}
@@ -2,34 +2,63 @@ package progress
 
 import (
 	"context"
-	"fmt"
 	"strings"
 	"time"
 
 	"github.com/uptrace/bun"
 
 	"receipter/infrastructure/audit"
+	"receipter/infrastructure/booking"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/pallets"
+	"receipter/infrastructure/palletsla"
+	"receipter/infrastructure/phase"
+	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/projectsettings"
 	"receipter/infrastructure/sqlite"
-	"receipter/models"
 )
 
 type Summary struct {
-	ProjectID           int64
-	ProjectName         string
-	ProjectClientName   string
-	ProjectStatus       string
-	IsAdmin             bool
-	CreatedCount        int
-	OpenCount           int
-	ClosedCount         int
-	CancelledCount      int
-	StatusFilter        string
+	ProjectID         int64
+	ProjectName       string
+	ProjectClientName string
+	ProjectStatus     string
+	IsAdmin           bool
+	CreatedCount      int
+	OpenCount         int
+	ClosedCount       int
+	CancelledCount    int
+	UnknownSKUCount   int
+	SLAHours          int64
+	SLAWarningCount   int
+	SLABreachedCount  int
+	Allowance         projectinfra.PalletAllowance
+	StatusFilter      string
+	// PhaseID limits the counts and pallets to one phase of the project; 0
+	// covers every pallet. Phases lists the project's phases for the picker.
+	PhaseID             int64
+	Phases              []phase.Phase
 	CanViewContent      bool
 	CanCreatePallet     bool
 	CanOpenReceipt      bool
 	CanManageLifecycle  bool
 	CanPrintClosedLabel bool
-	Pallets             []PalletRow
+	// VerifyBeforeClose turns the Close buttons into links to the
+	// verification scan.
+	VerifyBeforeClose bool
+	// StepUpRequired asks for the user's password or PIN in the cancel
+	// dialog.
+	StepUpRequired bool
+	ErrorMessage   string
+	Pallets        []PalletRow
+	// Page and PageSize select the slice of Pallets shown; a PageSize of 0
+	// shows every pallet. TotalPallets counts the pallets matching the
+	// status filter across all pages.
+	Page         int
+	PageSize     int
+	TotalPallets int
+	// Deliveries are the project's delivery bookings for today.
+	Deliveries booking.DaySummary
 }
 
 type PalletRow struct {
@@ -39,28 +68,73 @@ type PalletRow struct {
 	CreatedAt  string `bun:"created_at"`
 	ClosedAt   string `bun:"closed_at"`
 	ReopenedAt string `bun:"reopened_at"`
-	CanClose   bool   `bun:"-"`
-	CanReopen  bool   `bun:"-"`
-	CanCancel  bool   `bun:"-"`
+	// ElapsedMinutes is the time the pallet has been (or was) open; nil for
+	// cancelled pallets.
+	ElapsedMinutes *int64 `bun:"elapsed_minutes"`
+	// ClaimedBy is the user currently working the pallet, if any.
+	ClaimedBy string `bun:"claimed_by"`
+	SLAState  string `bun:"-"`
+	CanClose  bool   `bun:"-"`
+	CanReopen bool   `bun:"-"`
+	CanCancel bool   `bun:"-"`
 }
 
 func LoadSummary(ctx context.Context, db *sqlite.DB, projectID int64, statusFilter string) (Summary, error) {
-	s := Summary{ProjectID: projectID, StatusFilter: normalizeStatusFilter(statusFilter)}
+	return LoadSummaryPage(ctx, db, projectID, statusFilter, 0, 1, 0)
+}
+
+// LoadSummaryPage is LoadSummary limited to the pallets of one phase, or all
+// of them for a phaseID of 0, and to one page of pageSize pallets. Pages past
+// the last are clamped to it.
+func LoadSummaryPage(ctx context.Context, db *sqlite.DB, projectID int64, statusFilter string, phaseID int64, page, pageSize int) (Summary, error) {
+	s := Summary{ProjectID: projectID, StatusFilter: normalizeStatusFilter(statusFilter), PhaseID: phaseID, Page: 1}
+	if pageSize > 0 {
+		s.PageSize = pageSize
+	}
 	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
-		if err := tx.NewRaw(`SELECT name, client_name, status FROM projects WHERE id = ?`, projectID).Scan(ctx, &s.ProjectName, &s.ProjectClientName, &s.ProjectStatus); err != nil {
+		if err := tx.NewRaw(`SELECT name, client_name, status FROM projects WHERE id = ?`, projectID).Scan(ctx, &s.ProjectName, fieldcrypt.Dest(&s.ProjectClientName), &s.ProjectStatus); err != nil {
 			return err
 		}
 
-		if err := tx.NewRaw("SELECT COUNT(*) FROM pallets WHERE project_id = ? AND status = 'created'", projectID).Scan(ctx, &s.CreatedCount); err != nil {
+		palletScope, receiptScope, scopeArgs := " WHERE p.project_id = ?", " WHERE pr.project_id = ?", []any{projectID}
+		if phaseID > 0 {
+			palletScope += " AND p.id IN (SELECT pallet_id FROM pallet_phases WHERE phase_id = ?)"
+			receiptScope += " AND pr.pallet_id IN (SELECT pallet_id FROM pallet_phases WHERE phase_id = ?)"
+			scopeArgs = append(scopeArgs, phaseID)
+		}
+		if err := tx.NewRaw("SELECT COUNT(*) FROM pallets p"+palletScope+" AND p.status = 'created'", scopeArgs...).Scan(ctx, &s.CreatedCount); err != nil {
+			return err
+		}
+		if err := tx.NewRaw("SELECT COUNT(*) FROM pallets p"+palletScope+" AND p.status = 'open'", scopeArgs...).Scan(ctx, &s.OpenCount); err != nil {
+			return err
+		}
+		if err := tx.NewRaw("SELECT COUNT(*) FROM pallets p"+palletScope+" AND p.status IN ('closed', 'labelled')", scopeArgs...).Scan(ctx, &s.ClosedCount); err != nil {
 			return err
 		}
-		if err := tx.NewRaw("SELECT COUNT(*) FROM pallets WHERE project_id = ? AND status = 'open'", projectID).Scan(ctx, &s.OpenCount); err != nil {
+		if err := tx.NewRaw("SELECT COUNT(*) FROM pallets p"+palletScope+" AND p.status = 'cancelled'", scopeArgs...).Scan(ctx, &s.CancelledCount); err != nil {
 			return err
 		}
-		if err := tx.NewRaw("SELECT COUNT(*) FROM pallets WHERE project_id = ? AND status IN ('closed', 'labelled')", projectID).Scan(ctx, &s.ClosedCount); err != nil {
+		if err := tx.NewRaw("SELECT COUNT(*) FROM pallet_receipts pr"+receiptScope+" AND pr.unknown_sku = 1", scopeArgs...).Scan(ctx, &s.UnknownSKUCount); err != nil {
 			return err
 		}
-		if err := tx.NewRaw("SELECT COUNT(*) FROM pallets WHERE project_id = ? AND status = 'cancelled'", projectID).Scan(ctx, &s.CancelledCount); err != nil {
+		settings, err := projectsettings.LoadTx(ctx, tx, projectID)
+		if err != nil {
+			return err
+		}
+		s.SLAHours = settings.Int(projectsettings.PalletSLAHours)
+		s.VerifyBeforeClose = settings.Bool(projectsettings.PalletVerifyBeforeClose)
+
+		where := palletScope
+		whereArgs := append([]any{}, scopeArgs...)
+		if s.StatusFilter != "all" {
+			if s.StatusFilter == "closed" {
+				where += " AND p.status IN ('closed', 'labelled')"
+			} else {
+				where += " AND p.status = ?"
+				whereArgs = append(whereArgs, s.StatusFilter)
+			}
+		}
+		if err := tx.NewRaw("SELECT COUNT(*) FROM pallets p"+where, whereArgs...).Scan(ctx, &s.TotalPallets); err != nil {
 			return err
 		}
 
@@ -69,20 +143,22 @@ SELECT p.id, p.status,
        (SELECT COUNT(*) FROM pallet_receipts pr WHERE pr.pallet_id = p.id) AS line_count,
        strftime('%d/%m/%Y %H:%M', p.created_at) AS created_at,
        COALESCE(strftime('%d/%m/%Y %H:%M', p.closed_at), '') AS closed_at,
-       COALESCE(strftime('%d/%m/%Y %H:%M', p.reopened_at), '') AS reopened_at
-FROM pallets p
-WHERE p.project_id = ?`
-		args := make([]any, 0, 2)
-		args = append(args, projectID)
-		if s.StatusFilter != "all" {
-			if s.StatusFilter == "closed" {
-				q += " AND p.status IN ('closed', 'labelled')"
-			} else {
-				q += " AND p.status = ?"
-				args = append(args, s.StatusFilter)
+       COALESCE(strftime('%d/%m/%Y %H:%M', p.reopened_at), '') AS reopened_at,
+       ` + palletsla.ElapsedMinutesSQL + ` AS elapsed_minutes,
+       COALESCE(` + pallets.ClaimedBySQL + `, '') AS claimed_by
+FROM pallets p` + where + " ORDER BY p.id DESC"
+		now := time.Now().UTC()
+		args := append([]any{now, now}, whereArgs...)
+		if s.PageSize > 0 {
+			if page > s.PageCount() {
+				page = s.PageCount()
+			}
+			if page > 1 {
+				s.Page = page
 			}
+			q += " LIMIT ? OFFSET ?"
+			args = append(args, s.PageSize, (s.Page-1)*s.PageSize)
 		}
-		q += " ORDER BY p.id DESC"
 
 		if err := tx.NewRaw(q, args...).Scan(ctx, &s.Pallets); err != nil {
 			return err
@@ -91,79 +167,46 @@ WHERE p.project_id = ?`
 			s.Pallets[i].CanClose = s.Pallets[i].Status == "open"
 			s.Pallets[i].CanReopen = s.Pallets[i].Status == "closed" || s.Pallets[i].Status == "labelled"
 			s.Pallets[i].CanCancel = s.Pallets[i].Status != "cancelled"
+			if s.Pallets[i].ElapsedMinutes != nil {
+				s.Pallets[i].SLAState = palletsla.State(s.SLAHours, *s.Pallets[i].ElapsedMinutes)
+			}
+		}
+		// The SLA counts cover open pallets across the project or phase,
+		// whatever the status filter.
+		if s.SLAHours > 0 {
+			slaArgs := append([]any{s.SLAHours * 60, s.SLAHours * 60, s.SLAHours * 60 * palletsla.WarnPercent, time.Now().UTC()}, scopeArgs...)
+			if err := tx.NewRaw(`
+SELECT COALESCE(SUM(CASE WHEN elapsed >= ? THEN 1 ELSE 0 END), 0),
+       COALESCE(SUM(CASE WHEN elapsed < ? AND elapsed * 100 >= ? THEN 1 ELSE 0 END), 0)
+FROM (SELECT `+palletsla.ElapsedMinutesSQL+` AS elapsed FROM pallets p`+palletScope+` AND p.status IN ('created', 'open'))`,
+				slaArgs...).Scan(ctx, &s.SLABreachedCount, &s.SLAWarningCount); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
+	if err != nil {
+		return s, err
+	}
+	s.Allowance, err = projectinfra.LoadPalletAllowance(ctx, db, projectID)
+	if err != nil {
+		return s, err
+	}
+	s.Phases, err = phase.List(ctx, db, projectID)
 	return s, err
 }
 
 func updatePalletStatus(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID, palletID int64, toStatus string) error {
 	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
-		var projectStatus string
-		if err := tx.NewRaw(`SELECT status FROM projects WHERE id = ?`, projectID).Scan(ctx, &projectStatus); err != nil {
-			return err
-		}
-		if projectStatus != "active" {
-			return fmt.Errorf("inactive projects are read-only")
-		}
-
-		var before models.Pallet
-		if err := tx.NewSelect().Model(&before).Where("id = ?", palletID).Where("project_id = ?", projectID).Limit(1).Scan(ctx); err != nil {
-			return err
-		}
-
-		now := time.Now()
-		switch toStatus {
-		case "closed":
-			res, err := tx.NewRaw(`UPDATE pallets SET status = 'closed', closed_at = ?, reopened_at = NULL WHERE id = ? AND project_id = ? AND status = 'open'`, now, palletID, projectID).Exec(ctx)
-			if err != nil {
-				return err
-			}
-			if n, _ := res.RowsAffected(); n == 0 {
-				return fmt.Errorf("pallet must be open to close")
-			}
-		case "open":
-			res, err := tx.NewRaw(`UPDATE pallets SET status = 'open', reopened_at = ? WHERE id = ? AND project_id = ? AND status IN ('closed', 'labelled')`, now, palletID, projectID).Exec(ctx)
-			if err != nil {
-				return err
-			}
-			if n, _ := res.RowsAffected(); n == 0 {
-				return fmt.Errorf("pallet must be closed or labelled to reopen")
-			}
-		case "cancelled":
-			res, err := tx.NewRaw(`UPDATE pallets SET status = 'cancelled', closed_at = COALESCE(closed_at, ?), reopened_at = NULL WHERE id = ? AND project_id = ? AND status != 'cancelled'`, now, palletID, projectID).Exec(ctx)
-			if err != nil {
-				return err
-			}
-			if n, _ := res.RowsAffected(); n == 0 {
-				return fmt.Errorf("pallet is already cancelled")
-			}
-		default:
-			return fmt.Errorf("invalid pallet status transition: %s", toStatus)
-		}
-
-		var after models.Pallet
-		if err := tx.NewSelect().Model(&after).Where("id = ?", palletID).Where("project_id = ?", projectID).Limit(1).Scan(ctx); err != nil {
-			return err
-		}
-
-		if auditSvc != nil {
-			action := "pallet.close"
-			if toStatus == "open" {
-				action = "pallet.reopen"
-			} else if toStatus == "cancelled" {
-				action = "pallet.cancel"
-			}
-			if err := auditSvc.Write(ctx, tx, userID, action, "pallets", toString(palletID), before, after); err != nil {
-				return err
-			}
-		}
-		return nil
+		return pallets.Transition(ctx, tx, auditSvc, userID, projectID, palletID, toStatus)
 	})
 }
 
-func toString(v int64) string {
-	return fmt.Sprintf("%d", v)
+func (s Summary) PageCount() int {
+	if s.PageSize <= 0 || s.TotalPallets <= s.PageSize {
+		return 1
+	}
+	return (s.TotalPallets + s.PageSize - 1) / s.PageSize
 }
 
 func normalizeStatusFilter(v string) string {
@@ -2,18 +2,22 @@ package progress
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/uptrace/bun"
 
 	"receipter/infrastructure/audit"
+	"receipter/infrastructure/perfbudget"
 	"receipter/infrastructure/sqlite"
 )
 
-func openProgressTestDB(t *testing.T) *sqlite.DB {
+func openProgressTestDB(t testing.TB) *sqlite.DB {
 	t.Helper()
 	dbPath := filepath.Join(t.TempDir(), "progress-test.db")
 	db, err := sqlite.OpenDB(dbPath)
@@ -144,6 +148,14 @@ func TestLoadSummary_StatusFilterAndCounts(t *testing.T) {
 		if _, err := tx.ExecContext(ctx, `INSERT INTO pallets (id, project_id, status, created_at) VALUES (5, 1, 'cancelled', CURRENT_TIMESTAMP)`); err != nil {
 			return err
 		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO users (id, username, password_hash, role, created_at, updated_at) VALUES (1, 'admin', 'hash', 'admin', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO pallet_receipts (project_id, pallet_id, sku, description, scanned_by_user_id, qty, unknown_sku)
+VALUES (1, 3, 'UNKNOWN', 'Unidentifiable item', 1, 2, 1), (1, 3, 'SKU-1', 'Known', 1, 5, 0)`); err != nil {
+			return err
+		}
 		return nil
 	})
 	if err != nil {
@@ -154,7 +166,7 @@ func TestLoadSummary_StatusFilterAndCounts(t *testing.T) {
 	if err != nil {
 		t.Fatalf("load summary: %v", err)
 	}
-	if summary.CreatedCount != 1 || summary.OpenCount != 1 || summary.ClosedCount != 2 {
+	if summary.CreatedCount != 1 || summary.OpenCount != 1 || summary.ClosedCount != 2 || summary.UnknownSKUCount != 1 {
 		t.Fatalf("unexpected counts: %+v", summary)
 	}
 	if summary.StatusFilter != "open" {
@@ -178,6 +190,61 @@ func TestLoadSummary_StatusFilterAndCounts(t *testing.T) {
 	}
 }
 
+func TestLoadSummaryPage_PhaseFilter(t *testing.T) {
+	db := openProgressTestDB(t)
+
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, q := range []string{
+			`INSERT INTO users (id, username, password_hash, role, created_at, updated_at) VALUES (1, 'admin', 'hash', 'admin', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'closed'), (2, 1, 'open'), (3, 1, 'open'), (4, 1, 'created')`,
+			`INSERT INTO project_phases (id, project_id, name, status) VALUES (1, 1, 'Phase 1', 'closed'), (2, 1, 'Phase 2', 'open')`,
+			`INSERT INTO pallet_phases (pallet_id, phase_id) VALUES (1, 1), (2, 1), (3, 2), (4, 2)`,
+			`INSERT INTO pallet_receipts (project_id, pallet_id, sku, description, scanned_by_user_id, qty, unknown_sku) VALUES (1, 1, 'UNKNOWN', 'Unknown', 1, 1, 1), (1, 3, 'UNKNOWN', 'Unknown', 1, 1, 1), (1, 3, 'UNKNOWN', 'Unknown', 1, 1, 1)`,
+		} {
+			if _, err := tx.ExecContext(ctx, q); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed phases: %v", err)
+	}
+
+	summary, err := LoadSummaryPage(context.Background(), db, 1, "all", 1, 1, 0)
+	if err != nil {
+		t.Fatalf("load phase summary: %v", err)
+	}
+	if summary.PhaseID != 1 || len(summary.Phases) != 2 {
+		t.Fatalf("expected phase 1 of 2 phases, got id=%d phases=%+v", summary.PhaseID, summary.Phases)
+	}
+	if summary.CreatedCount != 0 || summary.OpenCount != 1 || summary.ClosedCount != 1 || summary.UnknownSKUCount != 1 || summary.TotalPallets != 2 {
+		t.Fatalf("unexpected phase 1 counts: %+v", summary)
+	}
+	if len(summary.Pallets) != 2 || summary.Pallets[0].ID != 2 || summary.Pallets[1].ID != 1 {
+		t.Fatalf("expected phase 1 pallets only, got %+v", summary.Pallets)
+	}
+
+	summary, err = LoadSummaryPage(context.Background(), db, 1, "open", 2, 1, 0)
+	if err != nil {
+		t.Fatalf("load filtered phase summary: %v", err)
+	}
+	if summary.CreatedCount != 1 || summary.OpenCount != 1 || summary.UnknownSKUCount != 2 {
+		t.Fatalf("unexpected phase 2 counts: %+v", summary)
+	}
+	if len(summary.Pallets) != 1 || summary.Pallets[0].ID != 3 {
+		t.Fatalf("expected open phase 2 pallet only, got %+v", summary.Pallets)
+	}
+
+	summary, err = LoadSummary(context.Background(), db, 1, "all")
+	if err != nil {
+		t.Fatalf("load summary: %v", err)
+	}
+	if summary.TotalPallets != 4 || summary.UnknownSKUCount != 3 {
+		t.Fatalf("expected every pallet without a phase, got total=%d unknown=%d", summary.TotalPallets, summary.UnknownSKUCount)
+	}
+}
+
 func TestUpdatePalletStatus_InvalidTransitions(t *testing.T) {
 	db := openProgressTestDB(t)
 
@@ -284,3 +351,144 @@ func TestNormalizeStatusFilter(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadSummary_GradesOpenTimeAgainstSLA(t *testing.T) {
+	db := openProgressTestDB(t)
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO project_settings (project_id, key, value) VALUES (1, 'pallet.sla_hours', '4')`,
+			`INSERT INTO pallets (id, project_id, status, created_at, closed_at) VALUES
+			 (1, 1, 'open', DATETIME('now', '-5 hours'), NULL),
+			 (2, 1, 'open', DATETIME('now', '-210 minutes'), NULL),
+			 (3, 1, 'closed', DATETIME('now', '-5 hours'), DATETIME('now', '-4 hours')),
+			 (4, 1, 'cancelled', DATETIME('now', '-9 hours'), DATETIME('now', '-8 hours'))`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed pallets: %v", err)
+	}
+
+	summary, err := LoadSummary(context.Background(), db, 1, "all")
+	if err != nil {
+		t.Fatalf("load summary: %v", err)
+	}
+	if summary.SLAHours != 4 || summary.SLABreachedCount != 1 || summary.SLAWarningCount != 1 {
+		t.Fatalf("unexpected SLA counts %+v", summary)
+	}
+	states := make(map[int64]string, len(summary.Pallets))
+	for _, p := range summary.Pallets {
+		states[p.ID] = p.SLAState
+	}
+	if states[1] != "breached" || states[2] != "warning" || states[3] != "ok" || states[4] != "" {
+		t.Fatalf("unexpected SLA states %+v", states)
+	}
+}
+
+func TestLoadSummaryPage_PagesAndClamps(t *testing.T) {
+	db := openProgressTestDB(t)
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for i := 1; i <= 5; i++ {
+			status := "open"
+			if i == 5 {
+				status = "cancelled"
+			}
+			if _, err := tx.ExecContext(ctx, `INSERT INTO pallets (id, project_id, status) VALUES (?, 1, ?)`, i, status); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed pallets: %v", err)
+	}
+
+	summary, err := LoadSummaryPage(context.Background(), db, 1, "all", 0, 2, 2)
+	if err != nil {
+		t.Fatalf("load page: %v", err)
+	}
+	if summary.TotalPallets != 5 || summary.PageCount() != 3 || summary.Page != 2 {
+		t.Fatalf("unexpected paging total=%d pages=%d page=%d", summary.TotalPallets, summary.PageCount(), summary.Page)
+	}
+	if len(summary.Pallets) != 2 || summary.Pallets[0].ID != 3 || summary.Pallets[1].ID != 2 {
+		t.Fatalf("unexpected page 2 pallets %+v", summary.Pallets)
+	}
+
+	summary, err = LoadSummaryPage(context.Background(), db, 1, "open", 0, 9, 2)
+	if err != nil {
+		t.Fatalf("load clamped page: %v", err)
+	}
+	if summary.TotalPallets != 4 || summary.Page != 2 || len(summary.Pallets) != 2 || summary.Pallets[1].ID != 1 {
+		t.Fatalf("expected last open page, got page=%d pallets=%+v", summary.Page, summary.Pallets)
+	}
+
+	summary, err = LoadSummary(context.Background(), db, 1, "all")
+	if err != nil {
+		t.Fatalf("load summary: %v", err)
+	}
+	if len(summary.Pallets) != 5 || summary.PageCount() != 1 {
+		t.Fatalf("expected every pallet unpaged, got %d", len(summary.Pallets))
+	}
+}
+
+// seedVolumeData fills project 1 with a busy project's worth of lines: 200
+// pallets of 25 lines over 500 SKUs.
+func seedVolumeData(t testing.TB, db *sqlite.DB) {
+	t.Helper()
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin')`); err != nil {
+			return err
+		}
+		statuses := []string{"open", "closed", "labelled", "created"}
+		for p := 1; p <= 200; p++ {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO pallets (id, project_id, status) VALUES (?, 1, ?)`, p, statuses[p%len(statuses)]); err != nil {
+				return err
+			}
+			for l := 0; l < 25; l++ {
+				sku := fmt.Sprintf("SKU-%03d", (p*25+l)%500)
+				if _, err := tx.ExecContext(ctx, `
+INSERT INTO pallet_receipts (project_id, pallet_id, sku, description, scanned_by_user_id, qty, damaged, damaged_qty, batch_number, expiry_date)
+VALUES (1, ?, ?, ?, 1, ?, ?, ?, ?, DATE('now', '+1 year'))`,
+					p, sku, "Volume "+sku, 1+l, l%7 == 0, l%7/6, fmt.Sprintf("B%d", l%3)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed volume data: %v", err)
+	}
+}
+
+func benchmarkProgressFragment(b *testing.B, db *sqlite.DB) {
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		summary, err := LoadSummaryPage(ctx, db, 1, "all", 0, 1, 25)
+		if err != nil {
+			b.Fatalf("load summary page: %v", err)
+		}
+		summary.IsAdmin = true
+		summary.CanViewContent = true
+		if err := PalletProgressFragment(summary).Render(ctx, io.Discard); err != nil {
+			b.Fatalf("render fragment: %v", err)
+		}
+	}
+}
+
+func BenchmarkProgressFragment(b *testing.B) {
+	db := openProgressTestDB(b)
+	seedVolumeData(b, db)
+	benchmarkProgressFragment(b, db)
+}
+
+func TestProgressFragment_PerformanceBudget(t *testing.T) {
+	db := openProgressTestDB(t)
+	seedVolumeData(t, db)
+	perfbudget.Check(t, 10*time.Millisecond, func(b *testing.B) { benchmarkProgressFragment(b, db) })
+}
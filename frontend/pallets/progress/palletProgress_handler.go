@@ -1,15 +1,26 @@
 package progress
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
 	sessioncontext "receipter/frontend/shared/context"
 	"receipter/infrastructure/audit"
+	"receipter/infrastructure/booking"
+	"receipter/infrastructure/cache"
+	"receipter/infrastructure/delivery"
+	"receipter/infrastructure/pallets"
+	"receipter/infrastructure/phase"
 	"receipter/infrastructure/rbac"
 	"receipter/infrastructure/sqlite"
+	"receipter/infrastructure/stepup"
+	"receipter/infrastructure/userprefs"
 )
 
 // ProgressPageQueryHandler renders pallet progress dashboard.
@@ -25,7 +36,17 @@ func ProgressPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
 			return
 		}
 
-		summary, err := LoadSummary(r.Context(), db, *session.ActiveProjectID, r.URL.Query().Get("status"))
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		pageSize := userprefs.FromContext(r.Context()).Int(userprefs.ProgressPageSize)
+		phaseID, err := requestedPhaseID(r, db, *session.ActiveProjectID)
+		if errors.Is(err, phase.ErrNotFound) {
+			phaseID, err = 0, nil
+		}
+		if err != nil {
+			http.Error(w, "failed to load phase", http.StatusInternalServerError)
+			return
+		}
+		summary, err := LoadSummaryPage(r.Context(), db, *session.ActiveProjectID, r.URL.Query().Get("status"), phaseID, page, pageSize)
 		if err != nil {
 			http.Error(w, "failed to load pallet progress", http.StatusInternalServerError)
 			return
@@ -37,6 +58,17 @@ func ProgressPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
 		summary.CanOpenReceipt = isAdmin
 		summary.CanManageLifecycle = isAdmin && summary.ProjectStatus == "active"
 		summary.CanPrintClosedLabel = isAdmin || hasRole(session.UserRoles, rbac.RoleScanner)
+		summary.StepUpRequired, err = stepup.Needed(r.Context(), db, session, *session.ActiveProjectID, time.Now())
+		if err != nil {
+			http.Error(w, "failed to load project settings", http.StatusInternalServerError)
+			return
+		}
+		summary.Deliveries, err = booking.ProjectDay(r.Context(), db, *session.ActiveProjectID, time.Now().Format(booking.DateLayout))
+		if err != nil {
+			http.Error(w, "failed to load today's deliveries", http.StatusInternalServerError)
+			return
+		}
+		summary.ErrorMessage = r.URL.Query().Get("error")
 
 		if r.URL.Query().Get("fragment") == "1" {
 			w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -64,7 +96,7 @@ func hasRole(userRoles []string, role string) bool {
 	return false
 }
 
-func ClosePalletCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+func ClosePalletCommandHandler(db *sqlite.DB, auditSvc *audit.Service, deliveries *delivery.Worker) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		palletID, err := parsePalletID(r)
 		if err != nil {
@@ -77,14 +109,23 @@ func ClosePalletCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.Hand
 			return
 		}
 		if err := updatePalletStatus(r.Context(), db, auditSvc, session.UserID, *session.ActiveProjectID, palletID, "closed"); err != nil {
+			if errors.Is(err, pallets.ErrUnverified) {
+				http.Redirect(w, r, fmt.Sprintf("/tasker/pallets/%d/verify?error=%s", palletID, url.QueryEscape(err.Error())), http.StatusSeeOther)
+				return
+			}
+			if errors.Is(err, phase.ErrClosed) {
+				http.Redirect(w, r, "/tasker/pallets/progress?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+				return
+			}
 			http.Error(w, "failed to close pallet", http.StatusInternalServerError)
 			return
 		}
+		deliveries.Notify()
 		http.Redirect(w, r, "/tasker/pallets/progress", http.StatusSeeOther)
 	}
 }
 
-func ReopenPalletCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+func ReopenPalletCommandHandler(db *sqlite.DB, auditSvc *audit.Service, deliveries *delivery.Worker) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		palletID, err := parsePalletID(r)
 		if err != nil {
@@ -97,14 +138,21 @@ func ReopenPalletCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.Han
 			return
 		}
 		if err := updatePalletStatus(r.Context(), db, auditSvc, session.UserID, *session.ActiveProjectID, palletID, "open"); err != nil {
+			if errors.Is(err, phase.ErrClosed) {
+				http.Redirect(w, r, "/tasker/pallets/progress?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+				return
+			}
 			http.Error(w, "failed to reopen pallet", http.StatusInternalServerError)
 			return
 		}
+		deliveries.Notify()
 		http.Redirect(w, r, "/tasker/pallets/progress", http.StatusSeeOther)
 	}
 }
 
-func CancelPalletCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+// CancelPalletCommandHandler cancels a pallet, first asking for the user's
+// password or PIN when the project requires a step-up.
+func CancelPalletCommandHandler(db *sqlite.DB, sessionCache cache.SessionStore, auditSvc *audit.Service, deliveries *delivery.Worker) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		palletID, err := parsePalletID(r)
 		if err != nil {
@@ -116,10 +164,27 @@ func CancelPalletCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.Han
 			http.Error(w, "no active project selected", http.StatusForbidden)
 			return
 		}
+		confirmed, err := stepup.Require(r.Context(), db, auditSvc, &session, *session.ActiveProjectID, palletID, stepup.ActionCancelPallet, r.FormValue("step_up_secret"))
+		if err != nil {
+			if stepup.UserError(err) {
+				http.Redirect(w, r, "/tasker/pallets/progress?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "failed to confirm re-authentication", http.StatusInternalServerError)
+			return
+		}
+		if confirmed {
+			sessionCache.AddSession(session)
+		}
 		if err := updatePalletStatus(r.Context(), db, auditSvc, session.UserID, *session.ActiveProjectID, palletID, "cancelled"); err != nil {
+			if errors.Is(err, phase.ErrClosed) {
+				http.Redirect(w, r, "/tasker/pallets/progress?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+				return
+			}
 			http.Error(w, "failed to cancel pallet", http.StatusInternalServerError)
 			return
 		}
+		deliveries.Notify()
 		http.Redirect(w, r, "/tasker/pallets/progress", http.StatusSeeOther)
 	}
 }
@@ -0,0 +1,53 @@
+package progress
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/pallets"
+	"receipter/infrastructure/sqlite"
+)
+
+// LoadVerifyPage loads a pallet of projectID and the state of its
+// verification scan.
+func LoadVerifyPage(ctx context.Context, db *sqlite.DB, projectID, palletID int64) (VerifyPageData, error) {
+	data := VerifyPageData{PalletID: palletID}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`
+SELECT p.status, pj.name, pj.status
+FROM pallets p
+JOIN projects pj ON pj.id = p.project_id
+WHERE p.id = ? AND p.project_id = ?`, palletID, projectID).Scan(ctx, &data.PalletStatus, &data.ProjectName, &data.ProjectStatus); err != nil {
+			return err
+		}
+		required, err := pallets.VerifyRequired(ctx, tx, projectID)
+		if err != nil {
+			return err
+		}
+		data.Required = required
+		data.Verification, err = pallets.LoadVerification(ctx, tx, palletID)
+		return err
+	})
+	return data, err
+}
+
+// RecordVerifyScan saves a verification scan of a pallet of projectID.
+func RecordVerifyScan(ctx context.Context, db *sqlite.DB, userID, projectID, palletID int64, barcode string) (int, error) {
+	var matched int
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var exists bool
+		if err := tx.NewRaw(`SELECT EXISTS (SELECT 1 FROM pallets WHERE id = ? AND project_id = ?)`, palletID, projectID).Scan(ctx, &exists); err != nil {
+			return err
+		}
+		if !exists {
+			return sql.ErrNoRows
+		}
+		var err error
+		matched, err = pallets.RecordVerificationScan(ctx, tx, palletID, userID, barcode, time.Now())
+		return err
+	})
+	return matched, err
+}
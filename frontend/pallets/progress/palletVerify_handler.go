@@ -0,0 +1,92 @@
+package progress
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/pallets"
+	"receipter/infrastructure/project"
+	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/sqlite"
+)
+
+// VerifyPalletPageQueryHandler renders the verification scan of a pallet:
+// every line with whether it has been re-scanned, and the close button
+// once nothing is outstanding.
+func VerifyPalletPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		palletID, err := parsePalletID(r)
+		if err != nil || palletID <= 0 {
+			http.Error(w, "invalid pallet id", http.StatusBadRequest)
+			return
+		}
+		session, _ := sessioncontext.GetSessionFromContext(r.Context())
+		if session.ActiveProjectID == nil || *session.ActiveProjectID <= 0 {
+			http.Error(w, "no active project selected", http.StatusForbidden)
+			return
+		}
+
+		data, err := LoadVerifyPage(r.Context(), db, *session.ActiveProjectID, palletID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "pallet not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to load pallet verification", http.StatusInternalServerError)
+			return
+		}
+		data.IsAdmin = hasRole(session.UserRoles, rbac.RoleAdmin)
+		data.CanScan = data.ProjectStatus == project.StatusActive && data.PalletStatus == pallets.StatusOpen
+		data.CanClose = data.CanScan && (!data.Required || data.Verification.Complete())
+		data.Status = r.URL.Query().Get("status")
+		data.ErrorMessage = r.URL.Query().Get("error")
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := PalletVerifyPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render pallet verification", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// VerifyPalletScanCommandHandler records one verification scan and returns
+// to the verification page.
+func VerifyPalletScanCommandHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		palletID, err := parsePalletID(r)
+		if err != nil || palletID <= 0 {
+			http.Error(w, "invalid pallet id", http.StatusBadRequest)
+			return
+		}
+		session, _ := sessioncontext.GetSessionFromContext(r.Context())
+		if session.ActiveProjectID == nil || *session.ActiveProjectID <= 0 {
+			http.Error(w, "no active project selected", http.StatusForbidden)
+			return
+		}
+
+		pageURL := fmt.Sprintf("/tasker/pallets/%d/verify", palletID)
+		barcode := strings.TrimSpace(r.FormValue("barcode"))
+		matched, err := RecordVerifyScan(r.Context(), db, session.UserID, *session.ActiveProjectID, palletID, barcode)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				http.Error(w, "pallet not found", http.StatusNotFound)
+			case errors.Is(err, pallets.ErrVerifyBarcode), errors.Is(err, pallets.ErrNotVerifiable):
+				http.Redirect(w, r, pageURL+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			default:
+				http.Error(w, "failed to record verification scan", http.StatusInternalServerError)
+			}
+			return
+		}
+		if matched == 0 {
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape(fmt.Sprintf("%s is not on this pallet", barcode)), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, pageURL+"?status="+url.QueryEscape(fmt.Sprintf("%s verified", barcode)), http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,29 @@
+package progress
+
+import (
+	"strings"
+
+	"receipter/infrastructure/pallets"
+)
+
+// VerifyPageData is the verification scan of one pallet before it is
+// closed.
+type VerifyPageData struct {
+	PalletID      int64
+	PalletStatus  string
+	ProjectName   string
+	ProjectStatus string
+	IsAdmin       bool
+	// Required is set when the project only lets the pallet close once
+	// every line is verified; otherwise the scan is a courtesy check.
+	Required     bool
+	Verification pallets.Verification
+	CanScan      bool
+	CanClose     bool
+	Status       string
+	ErrorMessage string
+}
+
+func joinBarcodes(barcodes []string) string {
+	return strings.Join(barcodes, ", ")
+}
@@ -0,0 +1,151 @@
+package progress
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+const skuTrendDateLayout = "2006-01-02"
+
+// maxSKUTrendSeriesDays bounds the detail page series for long-running
+// projects.
+const maxSKUTrendSeriesDays = 180
+
+type skuTrendKey struct {
+	SKU           string
+	UOM           string
+	BatchNumber   string
+	ExpiryDateISO string
+}
+
+type skuTrendRow struct {
+	SKU           string `bun:"sku"`
+	UOM           string `bun:"uom"`
+	BatchNumber   string `bun:"batch_number"`
+	ExpiryDateISO string `bun:"expiry_date_iso"`
+	Day           string `bun:"day"`
+	Qty           int64  `bun:"qty"`
+}
+
+// loadSKUTrendRows sums what each SKU instance received per day between from
+// and to, for the receipt lines matching where. Each receipt.create and
+// receipt.merge audit entry counts on its own day, so a line scanned over
+// several days spreads across them; lines without a create entry count in
+// full on the day they were made. Lines deleted since are not counted.
+func loadSKUTrendRows(ctx context.Context, tx bun.Tx, where string, whereArgs []any, from, to string) ([]skuTrendRow, error) {
+	q := `
+SELECT pr.sku, COALESCE(pr.uom, '') AS uom, COALESCE(pr.batch_number, '') AS batch_number,
+       COALESCE(strftime('%Y-%m-%d', pr.expiry_date), '') AS expiry_date_iso,
+       date(al.created_at) AS day,
+       SUM(COALESCE(json_extract(NULLIF(al.after_json, ''), '$.Qty'), 0) - COALESCE(json_extract(NULLIF(al.before_json, ''), '$.Qty'), 0)) AS qty
+FROM pallet_receipts pr
+JOIN audit_logs al ON al.entity_type = 'pallet_receipts' AND al.entity_id = CAST(pr.id AS TEXT)
+WHERE ` + where + `
+  AND al.action IN ('receipt.create', 'receipt.merge')
+  AND date(al.created_at) BETWEEN ? AND ?
+GROUP BY 1, 2, 3, 4, 5
+UNION ALL
+SELECT pr.sku, COALESCE(pr.uom, '') AS uom, COALESCE(pr.batch_number, '') AS batch_number,
+       COALESCE(strftime('%Y-%m-%d', pr.expiry_date), '') AS expiry_date_iso,
+       date(pr.created_at) AS day,
+       SUM(pr.qty) AS qty
+FROM pallet_receipts pr
+WHERE ` + where + `
+  AND date(pr.created_at) BETWEEN ? AND ?
+  AND NOT EXISTS (
+    SELECT 1 FROM audit_logs al
+    WHERE al.entity_type = 'pallet_receipts' AND al.entity_id = CAST(pr.id AS TEXT) AND al.action = 'receipt.create'
+  )
+GROUP BY 1, 2, 3, 4, 5`
+	args := make([]any, 0, 2*len(whereArgs)+4)
+	args = append(args, whereArgs...)
+	args = append(args, from, to)
+	args = append(args, whereArgs...)
+	args = append(args, from, to)
+
+	rows := make([]skuTrendRow, 0)
+	if err := tx.NewRaw(q, args...).Scan(ctx, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// buildSKUTrend lays daily quantities out over every day from start to end.
+func buildSKUTrend(start, end time.Time, perDay map[string]int64) SKUTrend {
+	trend := SKUTrend{Points: make([]SKUTrendPoint, 0, int(end.Sub(start).Hours()/24)+1)}
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		date := day.Format(skuTrendDateLayout)
+		trend.Points = append(trend.Points, SKUTrendPoint{Date: date, Qty: perDay[date]})
+	}
+	return trend
+}
+
+func trendDay(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// attachSKUTrends fills in each summary row's sparkline for the SKUTrendDays
+// ending on now's day, counting only the receipt lines the filter and phase
+// show.
+func attachSKUTrends(ctx context.Context, tx bun.Tx, rows []SKUSummaryRow, projectIDs []int64, filter string, phaseID int64, now time.Time) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	end := trendDay(now)
+	start := end.AddDate(0, 0, -(SKUTrendDays - 1))
+	trendRows, err := loadSKUTrendRows(ctx, tx, "pr.project_id IN (?)"+skuFilterWhereClause(filter)+skuPhaseWhereClause(phaseID), []any{bun.In(projectIDs)}, start.Format(skuTrendDateLayout), end.Format(skuTrendDateLayout))
+	if err != nil {
+		return err
+	}
+	perInstance := make(map[skuTrendKey]map[string]int64)
+	for _, row := range trendRows {
+		key := skuTrendKey{SKU: row.SKU, UOM: row.UOM, BatchNumber: row.BatchNumber, ExpiryDateISO: row.ExpiryDateISO}
+		if perInstance[key] == nil {
+			perInstance[key] = make(map[string]int64)
+		}
+		perInstance[key][row.Day] += row.Qty
+	}
+	for i := range rows {
+		key := skuTrendKey{SKU: rows[i].SKU, UOM: rows[i].UOM, BatchNumber: rows[i].BatchNumber, ExpiryDateISO: rows[i].ExpiryDateISO}
+		rows[i].Trend = buildSKUTrend(start, end, perInstance[key])
+	}
+	return nil
+}
+
+// LoadSKUTrend loads an SKU instance's received quantity per day from its
+// first receipt to now's day, at least SKUTrendDays and at most
+// maxSKUTrendSeriesDays long.
+func LoadSKUTrend(ctx context.Context, db *sqlite.DB, projectID int64, sku, uom, batch, expiryISO string, now time.Time) (SKUTrend, error) {
+	matchQuery, matchArgs, err := buildSKUInstanceMatch(projectID, sku, uom, batch, expiryISO)
+	if err != nil {
+		return SKUTrend{}, err
+	}
+	end := trendDay(now)
+	start := end.AddDate(0, 0, -(maxSKUTrendSeriesDays - 1))
+	var trendRows []skuTrendRow
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		trendRows, err = loadSKUTrendRows(ctx, tx, matchQuery, matchArgs, start.Format(skuTrendDateLayout), end.Format(skuTrendDateLayout))
+		return err
+	})
+	if err != nil {
+		return SKUTrend{}, err
+	}
+
+	perDay := make(map[string]int64, len(trendRows))
+	first := end.AddDate(0, 0, -(SKUTrendDays - 1))
+	for _, row := range trendRows {
+		perDay[row.Day] += row.Qty
+		if day, err := time.Parse(skuTrendDateLayout, row.Day); err == nil && day.Before(first) && row.Qty != 0 {
+			first = day
+		}
+	}
+	if first.Before(start) {
+		first = start
+	}
+	return buildSKUTrend(first, end, perDay), nil
+}
@@ -1,18 +1,38 @@
 package progress
 
 import (
+	"archive/zip"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/uptrace/bun"
 
+	"receipter/infrastructure/coldstorage"
+	"receipter/infrastructure/damage"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/notification"
+	"receipter/infrastructure/phase"
+	"receipter/infrastructure/photovisibility"
+	"receipter/infrastructure/replymail"
 	"receipter/infrastructure/sqlite"
 )
 
+const skuDamageReasonFilterPrefix = "damaged:"
+
 func normalizeSKUFilter(v string) string {
-	switch strings.ToLower(strings.TrimSpace(v)) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if strings.HasPrefix(v, skuDamageReasonFilterPrefix) {
+		if code := damage.NormalizeCode(strings.TrimPrefix(v, skuDamageReasonFilterPrefix)); code != "" {
+			return skuDamageReasonFilterPrefix + code
+		}
+		return "damaged"
+	}
+	switch v {
 	case "success":
 		return "success"
 	case "unknown":
@@ -28,7 +48,20 @@ func normalizeSKUFilter(v string) string {
 	}
 }
 
+// skuDamageReasonFilterCode extracts the reason code from a "damaged:<code>" filter.
+func skuDamageReasonFilterCode(filter string) (string, bool) {
+	filter = normalizeSKUFilter(filter)
+	if !strings.HasPrefix(filter, skuDamageReasonFilterPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(filter, skuDamageReasonFilterPrefix), true
+}
+
 func skuFilterWhereClause(filter string) string {
+	if code, ok := skuDamageReasonFilterCode(filter); ok {
+		// NormalizeCode restricts codes to [a-z0-9_], so inlining is safe.
+		return " AND pr.damaged = 1 AND pr.damage_reason = '" + code + "'"
+	}
 	switch normalizeSKUFilter(filter) {
 	case "success":
 		return " AND pr.unknown_sku = 0 AND pr.damaged = 0 AND (pr.expiry_date IS NULL OR date(pr.expiry_date) >= date('now'))"
@@ -45,6 +78,15 @@ func skuFilterWhereClause(filter string) string {
 	}
 }
 
+// skuPhaseWhereClause limits the receipt lines to the pallets of one phase,
+// or returns no clause for a phaseID of 0.
+func skuPhaseWhereClause(phaseID int64) string {
+	if phaseID <= 0 {
+		return ""
+	}
+	return " AND pr.pallet_id IN (SELECT pallet_id FROM pallet_phases WHERE phase_id = " + strconv.FormatInt(phaseID, 10) + ")"
+}
+
 func skuClientCommentMatchExists(receiptAlias string) string {
 	return "EXISTS (" +
 		"SELECT 1 FROM sku_client_comments scc " +
@@ -59,23 +101,40 @@ func skuClientCommentMatchExists(receiptAlias string) string {
 }
 
 func LoadSKUSummary(ctx context.Context, db *sqlite.DB, projectID int64, filter string) (SKUSummaryPageData, error) {
+	return LoadSKUSummaryInPhase(ctx, db, projectID, filter, 0)
+}
+
+// LoadSKUSummaryInPhase is LoadSKUSummary limited to the pallets of one
+// phase; a phaseID of 0 covers the whole project.
+func LoadSKUSummaryInPhase(ctx context.Context, db *sqlite.DB, projectID int64, filter string, phaseID int64) (SKUSummaryPageData, error) {
 	data := SKUSummaryPageData{
 		ProjectID: projectID,
 		Filter:    normalizeSKUFilter(filter),
+		PhaseID:   phaseID,
 		Rows:      make([]SKUSummaryRow, 0),
 	}
 	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
-		if err := tx.NewRaw(`SELECT name, client_name, status FROM projects WHERE id = ?`, projectID).Scan(ctx, &data.ProjectName, &data.ProjectClientName, &data.ProjectStatus); err != nil {
+		if err := tx.NewRaw(`SELECT name, client_name, status FROM projects WHERE id = ?`, projectID).Scan(ctx, &data.ProjectName, fieldcrypt.Dest(&data.ProjectClientName), &data.ProjectStatus); err != nil {
 			return err
 		}
-		rows, err := loadSKUSummaryRowsByProjectIDs(ctx, tx, []int64{projectID}, data.Filter)
+		rows, err := loadSKUSummaryRowsByProjectIDs(ctx, tx, []int64{projectID}, data.Filter, phaseID)
 		if err != nil {
 			return err
 		}
+		if err := attachSKUTrends(ctx, tx, rows, []int64{projectID}, data.Filter, phaseID, time.Now()); err != nil {
+			return err
+		}
 		data.Rows = rows
+		if data.DamageReasons, err = loadDamageReasonOptions(ctx, tx); err != nil {
+			return err
+		}
 		applySummaryTotals(&data)
 		return nil
 	})
+	if err != nil {
+		return data, err
+	}
+	data.Phases, err = phase.List(ctx, db, projectID)
 	return data, err
 }
 
@@ -92,19 +151,34 @@ func LoadSKUSummaryByProjectIDs(ctx context.Context, db *sqlite.DB, projectIDs [
 	}
 
 	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
-		rows, err := loadSKUSummaryRowsByProjectIDs(ctx, tx, filtered, data.Filter)
+		rows, err := loadSKUSummaryRowsByProjectIDs(ctx, tx, filtered, data.Filter, 0)
 		if err != nil {
 			return err
 		}
+		if err := attachSKUTrends(ctx, tx, rows, filtered, data.Filter, 0, time.Now()); err != nil {
+			return err
+		}
 		data.Rows = rows
+		if data.DamageReasons, err = loadDamageReasonOptions(ctx, tx); err != nil {
+			return err
+		}
 		applySummaryTotals(&data)
 		return nil
 	})
 	return data, err
 }
 
-func loadSKUSummaryRowsByProjectIDs(ctx context.Context, tx bun.Tx, projectIDs []int64, filter string) ([]SKUSummaryRow, error) {
-	whereExtra := skuFilterWhereClause(filter)
+func loadDamageReasonOptions(ctx context.Context, tx bun.Tx) ([]DamageReasonOption, error) {
+	options := make([]DamageReasonOption, 0)
+	err := tx.NewRaw(`
+SELECT code, label
+FROM damage_reasons
+ORDER BY sort_order ASC, label ASC, code ASC`).Scan(ctx, &options)
+	return options, err
+}
+
+func loadSKUSummaryRowsByProjectIDs(ctx context.Context, tx bun.Tx, projectIDs []int64, filter string, phaseID int64) ([]SKUSummaryRow, error) {
+	whereExtra := skuFilterWhereClause(filter) + skuPhaseWhereClause(phaseID)
 	q := `
 SELECT
 	pr.sku,
@@ -216,7 +290,6 @@ func LoadSKUDetail(ctx context.Context, db *sqlite.DB, projectID int64, sku, uom
 			ExpiryDateISO: strings.TrimSpace(expiryISO),
 		},
 		Pallets: make([]SKUPalletBreakdownRow, 0),
-		Photos:  make([]SKUPhotoRef, 0),
 	}
 	if data.Instance.SKU == "" {
 		return data, fmt.Errorf("sku is required")
@@ -228,7 +301,7 @@ func LoadSKUDetail(ctx context.Context, db *sqlite.DB, projectID int64, sku, uom
 	}
 
 	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
-		if err := tx.NewRaw(`SELECT name, client_name, status FROM projects WHERE id = ?`, projectID).Scan(ctx, &data.ProjectName, &data.ProjectClientName, &data.ProjectStatus); err != nil {
+		if err := tx.NewRaw(`SELECT name, client_name, status FROM projects WHERE id = ?`, projectID).Scan(ctx, &data.ProjectName, fieldcrypt.Dest(&data.ProjectClientName), &data.ProjectStatus); err != nil {
 			return err
 		}
 
@@ -313,72 +386,6 @@ ORDER BY pr.pallet_id ASC`
 			data.CommentPalletID = palletRows[0].PalletID
 		}
 
-		receiptRows := make([]struct {
-			ReceiptID   int64  `bun:"receipt_id"`
-			PalletID    int64  `bun:"pallet_id"`
-			HasPrimary  int64  `bun:"has_primary"`
-			LineComment string `bun:"line_comment"`
-		}, 0)
-		receiptQuery := `
-SELECT
-	pr.id AS receipt_id,
-	pr.pallet_id,
-	CASE WHEN pr.stock_photo_blob IS NOT NULL AND length(pr.stock_photo_blob) > 0 THEN 1 ELSE 0 END AS has_primary,
-	COALESCE(pr.comment, '') AS line_comment
-FROM pallet_receipts pr
-WHERE ` + matchQuery + `
-ORDER BY pr.pallet_id ASC, pr.id ASC`
-		if err := tx.NewRaw(receiptQuery, matchArgs...).Scan(ctx, &receiptRows); err != nil {
-			return err
-		}
-
-		if len(receiptRows) == 0 {
-			return nil
-		}
-
-		receiptIDs := make([]int64, 0, len(receiptRows))
-		for _, row := range receiptRows {
-			receiptIDs = append(receiptIDs, row.ReceiptID)
-		}
-		photoRows := make([]struct {
-			ID              int64 `bun:"id"`
-			PalletReceiptID int64 `bun:"pallet_receipt_id"`
-		}, 0)
-		if err := tx.NewSelect().
-			TableExpr("receipt_photos").
-			Column("id", "pallet_receipt_id").
-			Where("pallet_receipt_id IN (?)", bun.In(receiptIDs)).
-			OrderExpr("pallet_receipt_id ASC, id ASC").
-			Scan(ctx, &photoRows); err != nil {
-			return err
-		}
-
-		photosByReceipt := make(map[int64][]int64, len(receiptRows))
-		for _, row := range photoRows {
-			photosByReceipt[row.PalletReceiptID] = append(photosByReceipt[row.PalletReceiptID], row.ID)
-		}
-
-		for _, line := range receiptRows {
-			if line.HasPrimary > 0 {
-				data.Photos = append(data.Photos, SKUPhotoRef{
-					PalletID:    line.PalletID,
-					ReceiptID:   line.ReceiptID,
-					PhotoID:     0,
-					IsPrimary:   true,
-					LineComment: strings.TrimSpace(line.LineComment),
-				})
-			}
-			for _, photoID := range photosByReceipt[line.ReceiptID] {
-				data.Photos = append(data.Photos, SKUPhotoRef{
-					PalletID:    line.PalletID,
-					ReceiptID:   line.ReceiptID,
-					PhotoID:     photoID,
-					IsPrimary:   false,
-					LineComment: strings.TrimSpace(line.LineComment),
-				})
-			}
-		}
-
 		commentMatchQuery, commentMatchArgs, err := buildSKUCommentMatchForAlias("scc", projectID, data.Instance.SKU, data.Instance.UOM, data.Instance.BatchNumber, data.Instance.ExpiryDateISO)
 		if err != nil {
 			return err
@@ -389,9 +396,18 @@ SELECT
 	scc.pallet_id,
 	COALESCE(TRIM(scc.comment), '') AS comment,
 	COALESCE(u.username, '') AS actor,
-	COALESCE(strftime('%d/%m/%Y %H:%M', scc.created_at), '') AS created_at_uk
+	COALESCE(strftime('%d/%m/%Y %H:%M', scc.created_at), '') AS created_at_uk,
+	COALESCE(cct.token, '') AS thread_token,
+	COALESCE(cct.reply_key, '') AS reply_key
 FROM sku_client_comments scc
 LEFT JOIN users u ON u.id = scc.created_by_user_id
+LEFT JOIN client_comment_threads cct
+  ON cct.project_id = scc.project_id
+ AND cct.pallet_id = scc.pallet_id
+ AND cct.sku = scc.sku
+ AND cct.uom = scc.uom
+ AND cct.batch_number = scc.batch_number
+ AND cct.expiry_date = COALESCE(date(scc.expiry_date), '')
 WHERE ` + commentMatchQuery + `
 ORDER BY scc.created_at DESC, scc.id DESC`
 		if err := tx.NewRaw(commentQuery, commentMatchArgs...).Scan(ctx, &commentRows); err != nil {
@@ -410,6 +426,164 @@ ORDER BY scc.created_at DESC, scc.id DESC`
 	return data, err
 }
 
+// LoadSKUPhotoGallery loads one page of the instance's photos: each line's
+// primary stock photo followed by its additional photos, in pallet order.
+// Pages past the end fall back to the last page.
+// skuPhotosCTE is every photo of the lines matchQuery selects: each line's
+// primary stock photo and its additional photos. A client view leaves out
+// photos marked internal.
+func skuPhotosCTE(matchQuery string, matchArgs []any, clientView bool) (string, []any) {
+	primaryMatch, galleryMatch := matchQuery, matchQuery
+	if clientView {
+		primaryMatch += " AND " + photovisibility.ClientVisibleSQL(photovisibility.SourcePrimary, "pr.id")
+		galleryMatch += " AND " + photovisibility.ClientVisibleSQL(photovisibility.SourceGallery, "rp.id")
+	}
+	cte := `
+WITH photos AS (
+	SELECT pr.pallet_id, pr.id AS receipt_id, 0 AS photo_id, 1 AS is_primary, pr.damaged,
+	       pr.scanned_by_user_id, pr.created_at AS captured_at, COALESCE(TRIM(pr.comment), '') AS line_comment
+	FROM pallet_receipts pr
+	WHERE ` + primaryMatch + ` AND pr.stock_photo_blob IS NOT NULL AND length(pr.stock_photo_blob) > 0
+	UNION ALL
+	SELECT pr.pallet_id, pr.id AS receipt_id, rp.id AS photo_id, 0 AS is_primary, pr.damaged,
+	       pr.scanned_by_user_id, rp.created_at AS captured_at, COALESCE(TRIM(pr.comment), '') AS line_comment
+	FROM receipt_photos rp
+	JOIN pallet_receipts pr ON pr.id = rp.pallet_receipt_id
+	WHERE ` + galleryMatch + `
+)`
+	return cte, append(append([]any{}, matchArgs...), matchArgs...)
+}
+
+func LoadSKUPhotoGallery(ctx context.Context, db *sqlite.DB, projectID int64, sku, uom, batch, expiryISO string, page int, clientView bool) (SKUPhotoGallery, error) {
+	gallery := SKUPhotoGallery{
+		SKU:         strings.TrimSpace(sku),
+		UOM:         strings.TrimSpace(uom),
+		BatchNumber: strings.TrimSpace(batch),
+		ExpiryISO:   strings.TrimSpace(expiryISO),
+		Page:        page,
+		Photos:      make([]SKUPhotoRef, 0),
+	}
+	matchQuery, matchArgs, err := buildSKUInstanceMatch(projectID, gallery.SKU, gallery.UOM, gallery.BatchNumber, gallery.ExpiryISO)
+	if err != nil {
+		return gallery, err
+	}
+	photosCTE, args := skuPhotosCTE(matchQuery, matchArgs, clientView)
+
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(photosCTE+` SELECT COUNT(1) FROM photos`, args...).Scan(ctx, &gallery.TotalPhotos); err != nil {
+			return err
+		}
+		if gallery.Page < 1 {
+			gallery.Page = 1
+		}
+		if gallery.Page > gallery.PageCount() {
+			gallery.Page = gallery.PageCount()
+		}
+		if gallery.TotalPhotos == 0 {
+			return nil
+		}
+		pageQuery := photosCTE + `
+SELECT ph.pallet_id, ph.receipt_id, ph.photo_id, ph.is_primary, ph.damaged, ph.line_comment,
+       COALESCE(u.username, '') AS scanned_by,
+       COALESCE(strftime('%d/%m/%Y %H:%M', ph.captured_at), '') AS captured_at_uk
+FROM photos ph
+LEFT JOIN users u ON u.id = ph.scanned_by_user_id
+ORDER BY ph.pallet_id ASC, ph.receipt_id ASC, ph.is_primary DESC, ph.photo_id ASC
+LIMIT ? OFFSET ?`
+		pageArgs := append(args, SKUPhotoPageSize, (gallery.Page-1)*SKUPhotoPageSize)
+		return tx.NewRaw(pageQuery, pageArgs...).Scan(ctx, &gallery.Photos)
+	})
+	return gallery, err
+}
+
+// WriteSKUPhotoZIP writes every photo of an SKU instance to w as a ZIP, one
+// folder per pallet, and returns how many photos it wrote. Photos are read
+// one at a time so a large instance is never held in memory. A client view
+// leaves out photos marked internal.
+func WriteSKUPhotoZIP(ctx context.Context, db *sqlite.DB, w io.Writer, projectID int64, sku, uom, batch, expiryISO string, clientView bool) (int64, error) {
+	matchQuery, matchArgs, err := buildSKUInstanceMatch(projectID, strings.TrimSpace(sku), strings.TrimSpace(uom), strings.TrimSpace(batch), strings.TrimSpace(expiryISO))
+	if err != nil {
+		return 0, err
+	}
+	photosCTE, args := skuPhotosCTE(matchQuery, matchArgs, clientView)
+	refs := make([]SKUPhotoRef, 0)
+	if err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(photosCTE+`
+SELECT ph.pallet_id, ph.receipt_id, ph.photo_id, ph.is_primary
+FROM photos ph
+ORDER BY ph.pallet_id ASC, ph.receipt_id ASC, ph.is_primary DESC, ph.photo_id ASC`, args...).Scan(ctx, &refs)
+	}); err != nil {
+		return 0, err
+	}
+
+	zw := zip.NewWriter(w)
+	var written int64
+	for _, ref := range refs {
+		var mimeType string
+		var blob []byte
+		err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+			if ref.IsPrimary {
+				return tx.NewRaw(`SELECT COALESCE(stock_photo_mime, ''), stock_photo_blob FROM pallet_receipts WHERE id = ?`, ref.ReceiptID).Scan(ctx, &mimeType, &blob)
+			}
+			return tx.NewRaw(`SELECT COALESCE(photo_mime, ''), photo_blob FROM receipt_photos WHERE id = ?`, ref.PhotoID).Scan(ctx, &mimeType, &blob)
+		})
+		if err != nil {
+			return written, err
+		}
+		if ref.IsPrimary {
+			blob, err = coldstorage.Fill(ctx, db, coldstorage.SourcePrimary, ref.ReceiptID, blob)
+		} else {
+			blob, err = coldstorage.Fill(ctx, db, coldstorage.SourceGallery, ref.PhotoID, blob)
+		}
+		if err != nil {
+			return written, err
+		}
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: skuPhotoZIPName(ref, mimeType), Method: zip.Store})
+		if err != nil {
+			return written, err
+		}
+		if _, err := f.Write(blob); err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, zw.Close()
+}
+
+func skuPhotoZIPName(ref SKUPhotoRef, mimeType string) string {
+	if ref.IsPrimary {
+		return fmt.Sprintf("%s/line-%d-primary%s", palletCode(ref.PalletID), ref.ReceiptID, photoExtension(mimeType))
+	}
+	return fmt.Sprintf("%s/line-%d-photo-%d%s", palletCode(ref.PalletID), ref.ReceiptID, ref.PhotoID, photoExtension(mimeType))
+}
+
+func photoExtension(mimeType string) string {
+	switch mimeType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	case "image/heic":
+		return ".heic"
+	default:
+		return ".bin"
+	}
+}
+
+// Client comments are written by client users and integrations, so both the
+// size of a single comment and how often one user can post are capped.
+const (
+	MaxClientCommentLength       = 1000
+	clientCommentsPerMinuteLimit = 5
+	clientCommentsPerHourLimit   = 60
+)
+
+var ErrClientCommentRateLimited = errors.New("too many comments, please wait before adding another")
+
 func CreateSKUClientComment(ctx context.Context, db *sqlite.DB, userID, projectID, palletID int64, sku, uom, batch, expiryISO, comment string) error {
 	if userID <= 0 {
 		return fmt.Errorf("invalid user")
@@ -428,6 +602,9 @@ func CreateSKUClientComment(ctx context.Context, db *sqlite.DB, userID, projectI
 	if comment == "" {
 		return fmt.Errorf("comment is required")
 	}
+	if len([]rune(comment)) > MaxClientCommentLength {
+		return fmt.Errorf("comment must be %d characters or fewer", MaxClientCommentLength)
+	}
 
 	expiryValue, hasExpiry, err := parseExpiryISO(expiryISO)
 	if err != nil {
@@ -440,6 +617,23 @@ func CreateSKUClientComment(ctx context.Context, db *sqlite.DB, userID, projectI
 	}
 
 	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var recent struct {
+			LastMinute int64 `bun:"last_minute"`
+			LastHour   int64 `bun:"last_hour"`
+		}
+		if err := tx.NewRaw(`
+SELECT
+	COALESCE(SUM(CASE WHEN created_at >= datetime('now', '-1 minute') THEN 1 ELSE 0 END), 0) AS last_minute,
+	COUNT(1) AS last_hour
+FROM sku_client_comments
+WHERE created_by_user_id = ?
+  AND created_at >= datetime('now', '-1 hour')`, userID).Scan(ctx, &recent); err != nil {
+			return err
+		}
+		if recent.LastMinute >= clientCommentsPerMinuteLimit || recent.LastHour >= clientCommentsPerHourLimit {
+			return ErrClientCommentRateLimited
+		}
+
 		var palletCount int64
 		if err := tx.NewRaw(`SELECT COUNT(1) FROM pallets WHERE id = ? AND project_id = ?`, palletID, projectID).Scan(ctx, &palletCount); err != nil {
 			return err
@@ -473,8 +667,32 @@ INSERT INTO sku_client_comments (
 	created_by_user_id,
 	created_at
 ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`,
-			projectID, palletID, sku, uom, batch, expiryArg, comment, userID)
-		return err
+			projectID, palletID, sku, uom, batch, expiryArg, fieldcrypt.String(comment), userID)
+		if err != nil {
+			return err
+		}
+		// The thread token lets the client answer later comments by email.
+		if _, err := replymail.EnsureThread(ctx, tx, replymail.Thread{
+			ProjectID: projectID,
+			PalletID:  palletID,
+			SKU:       sku,
+			UOM:       uom,
+			Batch:     batch,
+			ExpiryISO: expiryValue,
+		}); err != nil {
+			return err
+		}
+		// Comments are encrypted at rest, so the notification leaves the text
+		// out and links to the pallet instead.
+		return notification.Add(ctx, tx, notification.Notification{
+			Kind:      notification.KindClientComment,
+			ProjectID: projectID,
+			PalletID:  palletID,
+			SKU:       sku,
+			Title:     fmt.Sprintf("Client comment on %s", sku),
+			Body:      fmt.Sprintf("Left on pallet P%08d", palletID),
+			Link:      notification.PalletLink(palletID),
+		})
 	})
 }
 
@@ -488,6 +706,7 @@ type SKUDetailedExportRow struct {
 	CaseSize          int64
 	UnknownSKU        bool
 	Damaged           bool
+	DamageReason      string
 	BatchNumber       string
 	ExpiryDateUK      string
 	ExpiryDateISO     string
@@ -497,17 +716,31 @@ type SKUDetailedExportRow struct {
 	HasClientComments bool
 	HasPhotos         bool
 	ScannedBy         string
+	// BarcodeCheckFailed is set when the line kept a barcode with a wrong
+	// GS1 check digit.
+	BarcodeCheckFailed bool
+	CountryOfOrigin    string
+	HSCode             string
+	// SerialNumbers lists the line's unit serials in scan order, separated
+	// by semicolons.
+	SerialNumbers string
 }
 
 func LoadSKUDetailedExportRows(ctx context.Context, db *sqlite.DB, projectID int64, filter string) ([]SKUDetailedExportRow, error) {
-	return loadSKUDetailedExportRowsByProjectIDs(ctx, db, []int64{projectID}, filter)
+	return loadSKUDetailedExportRowsByProjectIDs(ctx, db, []int64{projectID}, filter, 0)
+}
+
+// LoadSKUDetailedExportRowsInPhase is LoadSKUDetailedExportRows limited to
+// the pallets of one phase; a phaseID of 0 covers the whole project.
+func LoadSKUDetailedExportRowsInPhase(ctx context.Context, db *sqlite.DB, projectID int64, filter string, phaseID int64) ([]SKUDetailedExportRow, error) {
+	return loadSKUDetailedExportRowsByProjectIDs(ctx, db, []int64{projectID}, filter, phaseID)
 }
 
 func LoadSKUDetailedExportRowsByProjectIDs(ctx context.Context, db *sqlite.DB, projectIDs []int64, filter string) ([]SKUDetailedExportRow, error) {
-	return loadSKUDetailedExportRowsByProjectIDs(ctx, db, projectIDs, filter)
+	return loadSKUDetailedExportRowsByProjectIDs(ctx, db, projectIDs, filter, 0)
 }
 
-func loadSKUDetailedExportRowsByProjectIDs(ctx context.Context, db *sqlite.DB, projectIDs []int64, filter string) ([]SKUDetailedExportRow, error) {
+func loadSKUDetailedExportRowsByProjectIDs(ctx context.Context, db *sqlite.DB, projectIDs []int64, filter string, phaseID int64) ([]SKUDetailedExportRow, error) {
 	projectIDs = uniquePositiveIDs(projectIDs)
 	filter = normalizeSKUFilter(filter)
 	rows := make([]SKUDetailedExportRow, 0)
@@ -515,7 +748,7 @@ func loadSKUDetailedExportRowsByProjectIDs(ctx context.Context, db *sqlite.DB, p
 		return rows, nil
 	}
 	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
-		whereExtra := skuFilterWhereClause(filter)
+		whereExtra := skuFilterWhereClause(filter) + skuPhaseWhereClause(phaseID)
 		q := `
 SELECT
 	pr.pallet_id,
@@ -527,6 +760,7 @@ SELECT
 	pr.case_size,
 	pr.unknown_sku,
 	pr.damaged,
+	pr.damage_reason,
 	COALESCE(pr.batch_number, '') AS batch_number,
 	COALESCE(strftime('%d/%m/%Y', pr.expiry_date), '') AS expiry_date_uk,
 	COALESCE(strftime('%Y-%m-%d', pr.expiry_date), '') AS expiry_date_iso,
@@ -542,7 +776,11 @@ SELECT
 		WHEN EXISTS (SELECT 1 FROM receipt_photos rp WHERE rp.pallet_receipt_id = pr.id) THEN 1
 		ELSE 0
 	END AS has_photos,
-	COALESCE(u.username, '') AS scanned_by
+	COALESCE(u.username, '') AS scanned_by,
+	pr.barcode_check_failed,
+	pr.country_of_origin,
+	pr.hs_code,
+	COALESCE((SELECT group_concat(serial, ';') FROM (SELECT rs.serial FROM receipt_serials rs WHERE rs.pallet_receipt_id = pr.id ORDER BY rs.id)), '') AS serial_numbers
 FROM pallet_receipts pr
 LEFT JOIN users u ON u.id = pr.scanned_by_user_id
 WHERE pr.project_id IN (?)` + whereExtra + `
@@ -558,6 +796,7 @@ ORDER BY pr.sku COLLATE NOCASE ASC, COALESCE(date(pr.expiry_date), '') ASC, COAL
 			CaseSize          int64  `bun:"case_size"`
 			UnknownSKU        bool   `bun:"unknown_sku"`
 			Damaged           bool   `bun:"damaged"`
+			DamageReason      string `bun:"damage_reason"`
 			BatchNumber       string `bun:"batch_number"`
 			ExpiryDateUK      string `bun:"expiry_date_uk"`
 			ExpiryDateISO     string `bun:"expiry_date_iso"`
@@ -567,30 +806,39 @@ ORDER BY pr.sku COLLATE NOCASE ASC, COALESCE(date(pr.expiry_date), '') ASC, COAL
 			HasClientComments int64  `bun:"has_client_comments"`
 			HasPhotos         int64  `bun:"has_photos"`
 			ScannedBy         string `bun:"scanned_by"`
+			CheckFailed       bool   `bun:"barcode_check_failed"`
+			CountryOfOrigin   string `bun:"country_of_origin"`
+			HSCode            string `bun:"hs_code"`
+			SerialNumbers     string `bun:"serial_numbers"`
 		}, 0)
 		if err := tx.NewRaw(q, bun.In(projectIDs)).Scan(ctx, &rawRows); err != nil {
 			return err
 		}
 		for _, row := range rawRows {
 			rows = append(rows, SKUDetailedExportRow{
-				PalletID:          row.PalletID,
-				ReceiptID:         row.ReceiptID,
-				SKU:               row.SKU,
-				Description:       row.Description,
-				UOM:               row.UOM,
-				Qty:               row.Qty,
-				CaseSize:          row.CaseSize,
-				UnknownSKU:        row.UnknownSKU,
-				Damaged:           row.Damaged,
-				BatchNumber:       row.BatchNumber,
-				ExpiryDateUK:      row.ExpiryDateUK,
-				ExpiryDateISO:     row.ExpiryDateISO,
-				IsExpired:         row.IsExpired > 0,
-				LineComment:       strings.TrimSpace(row.LineComment),
-				HasLineComment:    row.HasLineComment > 0,
-				HasClientComments: row.HasClientComments > 0,
-				HasPhotos:         row.HasPhotos > 0,
-				ScannedBy:         row.ScannedBy,
+				PalletID:           row.PalletID,
+				ReceiptID:          row.ReceiptID,
+				SKU:                row.SKU,
+				Description:        row.Description,
+				UOM:                row.UOM,
+				Qty:                row.Qty,
+				CaseSize:           row.CaseSize,
+				UnknownSKU:         row.UnknownSKU,
+				Damaged:            row.Damaged,
+				DamageReason:       row.DamageReason,
+				BatchNumber:        row.BatchNumber,
+				ExpiryDateUK:       row.ExpiryDateUK,
+				ExpiryDateISO:      row.ExpiryDateISO,
+				IsExpired:          row.IsExpired > 0,
+				LineComment:        strings.TrimSpace(row.LineComment),
+				HasLineComment:     row.HasLineComment > 0,
+				HasClientComments:  row.HasClientComments > 0,
+				HasPhotos:          row.HasPhotos > 0,
+				ScannedBy:          row.ScannedBy,
+				BarcodeCheckFailed: row.CheckFailed,
+				CountryOfOrigin:    row.CountryOfOrigin,
+				HSCode:             row.HSCode,
+				SerialNumbers:      row.SerialNumbers,
 			})
 		}
 		return nil
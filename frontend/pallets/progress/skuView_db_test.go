@@ -1,15 +1,28 @@
 package progress
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/uptrace/bun"
 
+	"receipter/infrastructure/customfield"
+	"receipter/infrastructure/exportformat"
+	"receipter/infrastructure/perfbudget"
 	"receipter/infrastructure/sqlite"
 )
 
+var updateGolden = flag.Bool("update", false, "rewrite export golden files in testdata")
+
 func seedSKUViewData(t *testing.T, db *sqlite.DB) {
 	t.Helper()
 	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
@@ -136,6 +149,40 @@ func TestLoadSKUSummary_FiltersAndUnknownInclusion(t *testing.T) {
 	}
 }
 
+func TestLoadSKUSummary_DamageReasonFilter(t *testing.T) {
+	db := openProgressTestDB(t)
+	seedSKUViewData(t, db)
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE pallet_receipts SET damage_reason = 'crushed' WHERE id = 101`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("set damage reason: %v", err)
+	}
+
+	crushed, err := LoadSKUSummary(context.Background(), db, 1, "damaged:crushed")
+	if err != nil {
+		t.Fatalf("load crushed summary: %v", err)
+	}
+	if crushed.Filter != "damaged:crushed" {
+		t.Fatalf("expected damaged:crushed filter to be kept, got %q", crushed.Filter)
+	}
+	if len(crushed.Rows) != 1 || crushed.Rows[0].SKU != "SKU-A" || crushed.Rows[0].TotalQty != 1 {
+		t.Fatalf("unexpected crushed filter rows: %+v", crushed.Rows)
+	}
+	if len(crushed.DamageReasons) == 0 {
+		t.Fatalf("expected damage reason filter options")
+	}
+
+	wet, err := LoadSKUSummary(context.Background(), db, 1, "damaged:wet")
+	if err != nil {
+		t.Fatalf("load wet summary: %v", err)
+	}
+	if len(wet.Rows) != 0 {
+		t.Fatalf("expected no wet rows, got %+v", wet.Rows)
+	}
+}
+
 func TestLoadSKUDetail_PhotosAndPalletBreakdown(t *testing.T) {
 	db := openProgressTestDB(t)
 	seedSKUViewData(t, db)
@@ -153,21 +200,23 @@ func TestLoadSKUDetail_PhotosAndPalletBreakdown(t *testing.T) {
 	if len(detail.Pallets) != 2 {
 		t.Fatalf("expected 2 pallet breakdown rows, got %d", len(detail.Pallets))
 	}
-	if len(detail.Photos) != 2 {
-		t.Fatalf("expected 2 photos (primary + receipt photo), got %d", len(detail.Photos))
-	}
 
-	hasPrimary := false
-	hasSecondary := false
-	for _, p := range detail.Photos {
-		if p.IsPrimary {
-			hasPrimary = true
-		} else if p.PhotoID == 700 {
-			hasSecondary = true
-		}
+	gallery, err := LoadSKUPhotoGallery(context.Background(), db, 1, "SKU-A", "unit", "B1", "2099-01-01", 1, false)
+	if err != nil {
+		t.Fatalf("load sku photo gallery: %v", err)
 	}
-	if !hasPrimary || !hasSecondary {
-		t.Fatalf("expected both primary and receipt photo refs in detail: %+v", detail.Photos)
+	if gallery.TotalPhotos != 2 || len(gallery.Photos) != 2 {
+		t.Fatalf("expected 2 photos (primary + receipt photo), got %d", len(gallery.Photos))
+	}
+	primary, secondary := gallery.Photos[0], gallery.Photos[1]
+	if !primary.IsPrimary || primary.ReceiptID != 100 || primary.Damaged {
+		t.Fatalf("expected pallet 1 primary photo first, got %+v", primary)
+	}
+	if secondary.PhotoID != 700 || secondary.ReceiptID != 101 || !secondary.Damaged {
+		t.Fatalf("expected damaged line receipt photo second, got %+v", secondary)
+	}
+	if secondary.ScannedBy != "admin" || secondary.CapturedAtUK == "" {
+		t.Fatalf("expected scanner and capture time metadata, got %+v", secondary)
 	}
 
 	expiredDetail, err := LoadSKUDetail(context.Background(), db, 1, "SKU-OLD", "unit", "E1", "2000-01-01", "all")
@@ -179,6 +228,67 @@ func TestLoadSKUDetail_PhotosAndPalletBreakdown(t *testing.T) {
 	}
 }
 
+func TestLoadSKUPhotoGallery_Paginates(t *testing.T) {
+	db := openProgressTestDB(t)
+	seedSKUViewData(t, db)
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for i := 0; i < SKUPhotoPageSize; i++ {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO receipt_photos (pallet_receipt_id, photo_blob) VALUES (100, X'FFD8FF')`); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed extra photos: %v", err)
+	}
+
+	first, err := LoadSKUPhotoGallery(context.Background(), db, 1, "SKU-A", "unit", "B1", "2099-01-01", 1, false)
+	if err != nil {
+		t.Fatalf("load first page: %v", err)
+	}
+	if first.TotalPhotos != SKUPhotoPageSize+2 || len(first.Photos) != SKUPhotoPageSize || first.PageCount() != 2 {
+		t.Fatalf("unexpected first page: total=%d shown=%d pages=%d", first.TotalPhotos, len(first.Photos), first.PageCount())
+	}
+
+	last, err := LoadSKUPhotoGallery(context.Background(), db, 1, "SKU-A", "unit", "B1", "2099-01-01", 9, false)
+	if err != nil {
+		t.Fatalf("load page past the end: %v", err)
+	}
+	if last.Page != 2 || len(last.Photos) != 2 || last.FirstShown() != SKUPhotoPageSize+1 || last.LastShown() != SKUPhotoPageSize+2 {
+		t.Fatalf("expected clamp to last page, got page=%d shown=%d", last.Page, len(last.Photos))
+	}
+	if last.Photos[1].PhotoID != 700 {
+		t.Fatalf("expected pallet 2 photo last, got %+v", last.Photos[1])
+	}
+}
+
+func TestWriteSKUPhotoZIP_OneFolderPerPallet(t *testing.T) {
+	db := openProgressTestDB(t)
+	seedSKUViewData(t, db)
+
+	var buf bytes.Buffer
+	count, err := WriteSKUPhotoZIP(context.Background(), db, &buf, 1, "SKU-A", "unit", "B1", "2099-01-01", false)
+	if err != nil {
+		t.Fatalf("write photo zip: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 photos, got %d", count)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("read zip: %v", err)
+	}
+	names := make([]string, 0, len(zr.File))
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	want := []string{"P00000001/line-100-primary.bin", "P00000002/line-101-photo-700.jpg"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("zip entries = %v, want %v", names, want)
+	}
+}
+
 func TestCreateSKUClientComment_FilterAndDetail(t *testing.T) {
 	db := openProgressTestDB(t)
 	seedSKUViewData(t, db)
@@ -248,6 +358,39 @@ func TestCreateSKUClientComment_Validation(t *testing.T) {
 	}
 }
 
+func TestCreateSKUClientComment_LengthAndRateLimits(t *testing.T) {
+	db := openProgressTestDB(t)
+	seedSKUViewData(t, db)
+	ctx := context.Background()
+
+	tooLong := strings.Repeat("é", MaxClientCommentLength+1)
+	err := CreateSKUClientComment(ctx, db, 1, 1, 2, "SKU-A", "unit", "B1", "2099-01-01", tooLong)
+	if err == nil || !strings.Contains(err.Error(), "characters or fewer") {
+		t.Fatalf("expected length cap error, got %v", err)
+	}
+	if err := CreateSKUClientComment(ctx, db, 1, 1, 2, "SKU-A", "unit", "B1", "2099-01-01", tooLong[:len(tooLong)-2]); err != nil {
+		t.Fatalf("expected comment at the cap to be accepted, got %v", err)
+	}
+
+	for i := 1; i < clientCommentsPerMinuteLimit; i++ {
+		if err := CreateSKUClientComment(ctx, db, 1, 1, 2, "SKU-A", "unit", "B1", "2099-01-01", fmt.Sprintf("comment %d", i)); err != nil {
+			t.Fatalf("comment %d: %v", i, err)
+		}
+	}
+	err = CreateSKUClientComment(ctx, db, 1, 1, 2, "SKU-A", "unit", "B1", "2099-01-01", "one too many")
+	if !errors.Is(err, ErrClientCommentRateLimited) {
+		t.Fatalf("expected rate limit error, got %v", err)
+	}
+
+	// Comments older than a minute only count towards the hourly limit.
+	if _, err := db.W.ExecContext(ctx, `UPDATE sku_client_comments SET created_at = datetime('now', '-10 minutes')`); err != nil {
+		t.Fatalf("age comments: %v", err)
+	}
+	if err := CreateSKUClientComment(ctx, db, 1, 1, 2, "SKU-A", "unit", "B1", "2099-01-01", "after a pause"); err != nil {
+		t.Fatalf("expected comment after burst window, got %v", err)
+	}
+}
+
 func TestLoadSKUDetailedExportRows(t *testing.T) {
 	db := openProgressTestDB(t)
 	seedSKUViewData(t, db)
@@ -307,6 +450,57 @@ func TestLoadSKUDetailedExportRows(t *testing.T) {
 	}
 }
 
+func TestSKUViewAndDetailedRows_PhaseFilter(t *testing.T) {
+	db := openProgressTestDB(t)
+	seedSKUViewData(t, db)
+	if _, err := db.W.ExecContext(context.Background(), `
+INSERT INTO project_phases (id, project_id, name, status) VALUES (1, 1, 'Phase 1', 'closed'), (2, 1, 'Phase 2', 'open');
+INSERT INTO pallet_phases (pallet_id, phase_id) VALUES (1, 1), (2, 2);`); err != nil {
+		t.Fatalf("seed phases: %v", err)
+	}
+
+	data, err := LoadSKUSummaryInPhase(context.Background(), db, 1, "all", 1)
+	if err != nil {
+		t.Fatalf("load phase summary: %v", err)
+	}
+	if data.PhaseID != 1 || len(data.Phases) != 2 {
+		t.Fatalf("expected phase 1 of 2 phases, got id=%d phases=%+v", data.PhaseID, data.Phases)
+	}
+	if len(data.Rows) != 2 || data.TotalQtySum != 5 {
+		t.Fatalf("expected pallet 1's two SKU rows totalling 5, got %d rows totalling %d", len(data.Rows), data.TotalQtySum)
+	}
+	if row, ok := findSKURow(data.Rows, "SKU-A"); !ok || row.TotalQty != 3 || row.DamagedQty != 0 {
+		t.Fatalf("expected SKU-A without pallet 2's damaged unit, got %+v", row)
+	}
+	if _, ok := findSKURow(data.Rows, "SKU-OLD"); ok {
+		t.Fatalf("expected SKU-OLD of phase 2 to be left out")
+	}
+
+	damaged, err := LoadSKUSummaryInPhase(context.Background(), db, 1, "damaged", 1)
+	if err != nil {
+		t.Fatalf("load damaged phase summary: %v", err)
+	}
+	if len(damaged.Rows) != 0 {
+		t.Fatalf("expected no damaged rows in phase 1, got %+v", damaged.Rows)
+	}
+
+	rows, err := LoadSKUDetailedExportRowsInPhase(context.Background(), db, 1, "all", 2)
+	if err != nil {
+		t.Fatalf("load phase detailed rows: %v", err)
+	}
+	if len(rows) != 2 || rows[0].ReceiptID != 101 || rows[1].ReceiptID != 103 {
+		t.Fatalf("expected phase 2's receipts 101 and 103, got %+v", rows)
+	}
+
+	all, err := LoadSKUDetailedExportRowsInPhase(context.Background(), db, 1, "all", 0)
+	if err != nil {
+		t.Fatalf("load all detailed rows: %v", err)
+	}
+	if len(all) != 4 {
+		t.Fatalf("expected every receipt without a phase, got %d", len(all))
+	}
+}
+
 func TestLoadSKUSummaryByProjectIDs_AggregatesAcrossProjects(t *testing.T) {
 	db := openProgressTestDB(t)
 	seedSKUViewData(t, db)
@@ -354,3 +548,198 @@ INSERT INTO pallet_receipts (
 		t.Fatalf("expected total qty sum 22, got %d", data.TotalQtySum)
 	}
 }
+
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatalf("create testdata: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("write golden %s: %v", name, err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden %s (run go test -update to create it): %v", name, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s no longer matches its published format; add a new format version instead of changing it.\n--- got ---\n%s\n--- want ---\n%s", name, got, want)
+	}
+}
+
+// Every published version of the SKU exports must keep producing exactly its
+// golden file.
+func TestSKUExportFormats_MatchGoldenFiles(t *testing.T) {
+	db := openProgressTestDB(t)
+	seedSKUViewData(t, db)
+	if err := CreateSKUClientComment(context.Background(), db, 1, 1, 2, "SKU-A", "unit", "B1", "2099-01-01", "Needs client approval"); err != nil {
+		t.Fatalf("create sku client comment: %v", err)
+	}
+	if _, err := db.W.ExecContext(context.Background(), `UPDATE pallet_receipts SET barcode_check_failed = 1 WHERE id = 100`); err != nil {
+		t.Fatalf("flag barcode check: %v", err)
+	}
+	if _, err := db.W.ExecContext(context.Background(), `UPDATE pallet_receipts SET country_of_origin = 'CN', hs_code = '392310' WHERE id = 100`); err != nil {
+		t.Fatalf("set customs data: %v", err)
+	}
+	if _, err := db.W.ExecContext(context.Background(), `INSERT INTO receipt_serials (project_id, pallet_receipt_id, serial) VALUES (1, 100, 'SN-003'), (1, 100, 'SN-001'), (1, 100, 'SN-002')`); err != nil {
+		t.Fatalf("seed serials: %v", err)
+	}
+
+	summary, err := LoadSKUSummary(context.Background(), db, 1, "all")
+	if err != nil {
+		t.Fatalf("load sku summary: %v", err)
+	}
+	detailed, err := LoadSKUDetailedExportRows(context.Background(), db, 1, "all")
+	if err != nil {
+		t.Fatalf("load detailed export rows: %v", err)
+	}
+	// Custom field columns start at v2; the retired field keeps its column.
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO project_custom_fields (id, project_id, key, label, field_type, required, sort_order, active) VALUES
+    (1, 1, 'country_of_origin', 'Country of origin', 'text', 1, 10, 1),
+    (2, 1, 'best_before', 'Best before', 'date', 0, 20, 0)`); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO receipt_custom_values (pallet_receipt_id, field_id, value) VALUES
+    (100, 1, 'Viet Nam, North'),
+    (100, 2, '2099-01-01'),
+    (103, 1, 'UK')`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed custom fields: %v", err)
+	}
+	custom, err := customfield.LoadExport(context.Background(), db, 1)
+	if err != nil {
+		t.Fatalf("load custom field export: %v", err)
+	}
+
+	for version := 1; version <= exportformat.SKUSummary.Latest; version++ {
+		name := fmt.Sprintf("sku_summary_v%d.csv", version)
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeSKUSummaryCSV(&buf, summary.Rows, version); err != nil {
+				t.Fatalf("write sku summary: %v", err)
+			}
+			assertGolden(t, name, buf.Bytes())
+		})
+	}
+	for version := 1; version <= exportformat.SKUDetailed.Latest; version++ {
+		name := fmt.Sprintf("sku_detailed_v%d.csv", version)
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			set := customfield.ExportSet{}
+			if exportformat.SKUDetailed.IncludesCustomFields(version) {
+				set = custom
+			}
+			if err := writeSKUDetailedCSV(&buf, detailed, set, version); err != nil {
+				t.Fatalf("write sku detailed: %v", err)
+			}
+			assertGolden(t, name, buf.Bytes())
+		})
+	}
+}
+
+func benchmarkLoadSKUSummary(b *testing.B, db *sqlite.DB) {
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := LoadSKUSummary(ctx, db, 1, "all"); err != nil {
+			b.Fatalf("load sku summary: %v", err)
+		}
+	}
+}
+
+func BenchmarkLoadSKUSummary(b *testing.B) {
+	db := openProgressTestDB(b)
+	seedVolumeData(b, db)
+	benchmarkLoadSKUSummary(b, db)
+}
+
+func TestLoadSKUSummary_PerformanceBudget(t *testing.T) {
+	db := openProgressTestDB(t)
+	seedVolumeData(t, db)
+	perfbudget.Check(t, 120*time.Millisecond, func(b *testing.B) { benchmarkLoadSKUSummary(b, db) })
+}
+
+func TestSKUTrends_CountEachCaptureOnItsOwnDay(t *testing.T) {
+	db := openProgressTestDB(t)
+	seedSKUViewData(t, db)
+	ctx := context.Background()
+
+	// Line 100 was scanned 3 days ago and topped up today; line 101 has no
+	// audit trail and counts on the day it was made; line 104 is an older
+	// pallet of the same SKU-A instance from 30 days ago.
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`UPDATE pallet_receipts SET created_at = datetime('now', '-1 day') WHERE id = 101`,
+			`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, uom, scanned_by_user_id, qty, batch_number, expiry_date, created_at, updated_at)
+			 VALUES (104, 1, 1, 'SKU-A', 'Alpha', 'unit', 1, 2, 'B1', '2099-01-01', datetime('now', '-30 days'), CURRENT_TIMESTAMP)`,
+			`INSERT INTO audit_logs (user_id, action, entity_type, entity_id, before_json, after_json, created_at) VALUES
+			 (1, 'receipt.create', 'pallet_receipts', '100', '', '{"Qty":2}', datetime('now', '-3 days')),
+			 (1, 'receipt.merge', 'pallet_receipts', '100', '{"Qty":2}', '{"Qty":3}', CURRENT_TIMESTAMP),
+			 (1, 'receipt.update', 'pallet_receipts', '100', '{"Qty":3}', '{"Qty":3}', CURRENT_TIMESTAMP),
+			 (1, 'receipt.create', 'pallet_receipts', '104', '', '{"Qty":2}', datetime('now', '-30 days'))`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed trend data: %v", err)
+	}
+
+	day := func(offset int) string {
+		return time.Now().UTC().AddDate(0, 0, offset).Format("2006-01-02")
+	}
+	qtyOn := func(trend SKUTrend, date string) int64 {
+		for _, p := range trend.Points {
+			if p.Date == date {
+				return p.Qty
+			}
+		}
+		t.Fatalf("no point for %s in %+v", date, trend.Points)
+		return 0
+	}
+
+	summary, err := LoadSKUSummary(ctx, db, 1, "all")
+	if err != nil {
+		t.Fatalf("load summary: %v", err)
+	}
+	skuA, ok := findSKURow(summary.Rows, "SKU-A")
+	if !ok {
+		t.Fatalf("expected SKU-A row")
+	}
+	if len(skuA.Trend.Points) != SKUTrendDays || skuA.Trend.Points[SKUTrendDays-1].Date != day(0) {
+		t.Fatalf("expected %d days ending today, got %+v", SKUTrendDays, skuA.Trend.Points)
+	}
+	if qtyOn(skuA.Trend, day(-3)) != 2 || qtyOn(skuA.Trend, day(-1)) != 1 || qtyOn(skuA.Trend, day(0)) != 1 || skuA.Trend.Total() != 4 {
+		t.Fatalf("unexpected SKU-A sparkline: %+v", skuA.Trend.Points)
+	}
+	if skuA.Trend.LastReceived() != day(0) {
+		t.Fatalf("expected SKU-A last received today, got %q", skuA.Trend.LastReceived())
+	}
+
+	damaged, err := LoadSKUSummary(ctx, db, 1, "damaged")
+	if err != nil {
+		t.Fatalf("load damaged summary: %v", err)
+	}
+	if row, ok := findSKURow(damaged.Rows, "SKU-A"); !ok || row.Trend.Total() != 1 || qtyOn(row.Trend, day(-1)) != 1 {
+		t.Fatalf("expected damaged sparkline to count only line 101, got %+v", row.Trend.Points)
+	}
+
+	series, err := LoadSKUTrend(ctx, db, 1, "SKU-A", "unit", "B1", "2099-01-01", time.Now())
+	if err != nil {
+		t.Fatalf("load trend: %v", err)
+	}
+	if len(series.Points) != 31 || series.Points[0].Date != day(-30) || series.Points[0].Qty != 2 || series.Total() != 6 {
+		t.Fatalf("expected series from the first receipt 30 days ago, got %d points %+v", len(series.Points), series.Points)
+	}
+}
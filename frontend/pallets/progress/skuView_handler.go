@@ -3,19 +3,28 @@ package progress
 import (
 	"context"
 	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
-
-	"github.com/uptrace/bun"
+	"time"
 
 	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/customfield"
+	"receipter/infrastructure/exportformat"
+	"receipter/infrastructure/exportrun"
+	"receipter/infrastructure/phase"
+	"receipter/infrastructure/photovisibility"
 	projectinfra "receipter/infrastructure/project"
 	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/replymail"
 	"receipter/infrastructure/sqlite"
+	"receipter/infrastructure/userprefs"
 )
 
 type clientSKUScope struct {
@@ -48,7 +57,11 @@ func SKUViewPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
 			return
 		}
 
-		filter := sanitizeSKUFilterForRole(r.URL.Query().Get("filter"), isAdmin)
+		rawFilter := r.URL.Query().Get("filter")
+		if !r.URL.Query().Has("filter") {
+			rawFilter = userprefs.FromContext(r.Context()).String(userprefs.SKUViewFilter)
+		}
+		filter := sanitizeSKUFilterForRole(rawFilter, isAdmin)
 		var data SKUSummaryPageData
 		var err error
 
@@ -61,7 +74,7 @@ func SKUViewPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
 			if scope.SelectedProject == nil {
 				data, err = LoadSKUSummaryByProjectIDs(r.Context(), db, scope.ProjectIDs, filter)
 			} else {
-				data, err = LoadSKUSummary(r.Context(), db, *scope.SelectedProject, filter)
+				data, err = loadSKUSummaryPage(r, db, *scope.SelectedProject, filter)
 			}
 			if err != nil {
 				http.Error(w, "failed to load sku summary", http.StatusInternalServerError)
@@ -74,7 +87,7 @@ func SKUViewPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
 			data.ProjectStatus = scope.ProjectStatus
 			data.CanOpenDetail = scope.CanOpenDetail
 		} else {
-			data, err = LoadSKUSummary(r.Context(), db, *session.ActiveProjectID, filter)
+			data, err = loadSKUSummaryPage(r, db, *session.ActiveProjectID, filter)
 			if err != nil {
 				http.Error(w, "failed to load sku summary", http.StatusInternalServerError)
 				return
@@ -83,9 +96,15 @@ func SKUViewPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
 			data.CanOpenDetail = true
 		}
 
+		exports, err := sessionExports(r.Context(), db, session.UserID, isAdmin, isClient)
+		if err != nil {
+			http.Error(w, "failed to load export permissions", http.StatusInternalServerError)
+			return
+		}
 		data.IsAdmin = isAdmin
 		data.IsClient = isClient
-		data.CanExport = isAdmin || isClient
+		data.CanExportSummary = exports.SummaryCSV
+		data.CanExportDetail = exports.DetailCSV
 
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		if err := SKUViewPage(data).Render(r.Context(), w); err != nil {
@@ -95,60 +114,59 @@ func SKUViewPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
 	}
 }
 
-func SKUDetailPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+// loadSKUSummaryPage loads one project's SKU summary for the page, limited
+// to the requested phase. A phase_id that is not one of the project's shows
+// every pallet.
+func loadSKUSummaryPage(r *http.Request, db *sqlite.DB, projectID int64, filter string) (SKUSummaryPageData, error) {
+	phaseID, err := requestedPhaseID(r, db, projectID)
+	if errors.Is(err, phase.ErrNotFound) {
+		phaseID, err = 0, nil
+	}
+	if err != nil {
+		return SKUSummaryPageData{}, err
+	}
+	return LoadSKUSummaryInPhase(r.Context(), db, projectID, filter, phaseID)
+}
+
+func SKUDetailPageQueryHandler(db *sqlite.DB, replies *replymail.Receiver) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		access, ok := resolveSKUDetailAccess(w, r, db)
 		if !ok {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
 
-		isAdmin := hasRole(session.UserRoles, rbac.RoleAdmin)
-		isClient := hasRole(session.UserRoles, rbac.RoleClient)
-		if !isClient && (session.ActiveProjectID == nil || *session.ActiveProjectID <= 0) {
-			if isAdmin {
-				http.Redirect(w, r, "/tasker/projects", http.StatusSeeOther)
-				return
-			}
-			http.Error(w, "no active project selected", http.StatusForbidden)
-			return
-		}
-
-		filter := sanitizeSKUFilterForRole(r.URL.Query().Get("filter"), isAdmin)
-		projectScope := strings.TrimSpace(r.URL.Query().Get("project_scope"))
-
-		var projectID int64
-		if isClient {
-			scope, err := resolveClientSKUScope(r.Context(), db, session.UserID, projectScope)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusForbidden)
-				return
-			}
-			if scope.SelectedProject == nil {
-				http.Error(w, "select a specific project to view SKU details", http.StatusBadRequest)
-				return
-			}
-			projectID = *scope.SelectedProject
-			projectScope = scope.ScopeValue
-		} else {
-			projectID = *session.ActiveProjectID
-			projectScope = strconv.FormatInt(projectID, 10)
-		}
-
 		sku := r.URL.Query().Get("sku")
 		uom := r.URL.Query().Get("uom")
 		batch := r.URL.Query().Get("batch")
 		expiry := r.URL.Query().Get("expiry")
 
-		data, err := LoadSKUDetail(r.Context(), db, projectID, sku, uom, batch, expiry, filter)
+		data, err := LoadSKUDetail(r.Context(), db, access.ProjectID, sku, uom, batch, expiry, access.Filter)
 		if err != nil {
 			http.Error(w, "failed to load sku detail", http.StatusBadRequest)
 			return
 		}
-		data.IsAdmin = isAdmin
-		data.IsClient = isClient
-		data.CanAddClientComment = isClient
-		data.ProjectScope = projectScope
+		data.Gallery, err = LoadSKUPhotoGallery(r.Context(), db, access.ProjectID, sku, uom, batch, expiry, photoPageParam(r), access.HideInternalPhotos)
+		if err != nil {
+			http.Error(w, "failed to load sku photos", http.StatusInternalServerError)
+			return
+		}
+		data.Trend, err = LoadSKUTrend(r.Context(), db, access.ProjectID, sku, uom, batch, expiry, time.Now())
+		if err != nil {
+			http.Error(w, "failed to load sku trend", http.StatusInternalServerError)
+			return
+		}
+		data.Gallery.Filter = data.Filter
+		data.Gallery.ProjectScope = access.ProjectScope
+		data.Gallery.CanDownload = access.Exports.PhotoZIP
+		data.IsAdmin = access.IsAdmin
+		data.IsClient = access.IsClient
+		data.CanAddClientComment = access.IsClient
+		if access.IsClient && replies != nil {
+			for i, c := range data.ClientComments {
+				data.ClientComments[i].ReplyAddress = replies.ReplyAddress(c.ThreadToken, c.ReplyKey)
+			}
+		}
+		data.ProjectScope = access.ProjectScope
 		data.Message = strings.TrimSpace(r.URL.Query().Get("status"))
 		data.Error = strings.TrimSpace(r.URL.Query().Get("error"))
 		if raw := strings.TrimSpace(r.URL.Query().Get("comment_pallet_id")); raw != "" {
@@ -165,6 +183,165 @@ func SKUDetailPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
 	}
 }
 
+// SKUPhotoGalleryFragmentQueryHandler renders one page of the SKU detail
+// photo gallery for in-place paging.
+func SKUPhotoGalleryFragmentQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		access, ok := resolveSKUDetailAccess(w, r, db)
+		if !ok {
+			return
+		}
+
+		q := r.URL.Query()
+		gallery, err := LoadSKUPhotoGallery(r.Context(), db, access.ProjectID, q.Get("sku"), q.Get("uom"), q.Get("batch"), q.Get("expiry"), photoPageParam(r), access.HideInternalPhotos)
+		if err != nil {
+			http.Error(w, "failed to load sku photos", http.StatusBadRequest)
+			return
+		}
+		gallery.Filter = access.Filter
+		gallery.ProjectScope = access.ProjectScope
+		gallery.CanDownload = access.Exports.PhotoZIP
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := SKUPhotoGalleryFragment(gallery).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render sku photos", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+type skuTrendResponse struct {
+	SKU         string          `json:"sku"`
+	UOM         string          `json:"uom"`
+	BatchNumber string          `json:"batch"`
+	Expiry      string          `json:"expiry"`
+	Total       int64           `json:"total"`
+	Days        []SKUTrendPoint `json:"days"`
+}
+
+// SKUTrendJSONHandler serves an SKU instance's daily received quantities,
+// the series charted on the detail page, for client-side charts.
+func SKUTrendJSONHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		access, ok := resolveSKUDetailAccess(w, r, db)
+		if !ok {
+			return
+		}
+
+		q := r.URL.Query()
+		sku := strings.TrimSpace(q.Get("sku"))
+		if sku == "" {
+			http.Error(w, "sku is required", http.StatusBadRequest)
+			return
+		}
+		trend, err := LoadSKUTrend(r.Context(), db, access.ProjectID, sku, q.Get("uom"), q.Get("batch"), q.Get("expiry"), time.Now())
+		if err != nil {
+			http.Error(w, "failed to load sku trend", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := json.NewEncoder(w).Encode(skuTrendResponse{
+			SKU:         sku,
+			UOM:         strings.TrimSpace(q.Get("uom")),
+			BatchNumber: strings.TrimSpace(q.Get("batch")),
+			Expiry:      strings.TrimSpace(q.Get("expiry")),
+			Total:       trend.Total(),
+			Days:        trend.Points,
+		}); err != nil {
+			slog.Error("encode sku trend failed", slog.Any("err", err))
+		}
+	}
+}
+
+type skuDetailAccess struct {
+	UserID       int64
+	ProjectID    int64
+	ProjectScope string
+	Filter       string
+	IsAdmin      bool
+	IsClient     bool
+	// HideInternalPhotos leaves photos marked internal out of galleries
+	// and downloads.
+	HideInternalPhotos bool
+	Exports            projectinfra.ClientExports
+}
+
+// resolveSKUDetailAccess picks the project an SKU detail request reads from:
+// the active project for staff, or the requested scope for client users,
+// who must name one of their assigned projects. It writes the error response
+// itself when it returns false.
+func resolveSKUDetailAccess(w http.ResponseWriter, r *http.Request, db *sqlite.DB) (skuDetailAccess, bool) {
+	var access skuDetailAccess
+	session, ok := sessioncontext.GetSessionFromContext(r.Context())
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return access, false
+	}
+
+	access.UserID = session.UserID
+	access.IsAdmin = hasRole(session.UserRoles, rbac.RoleAdmin)
+	access.IsClient = hasRole(session.UserRoles, rbac.RoleClient)
+	access.HideInternalPhotos = photovisibility.HiddenFrom(session.UserRoles)
+	if !access.IsClient && (session.ActiveProjectID == nil || *session.ActiveProjectID <= 0) {
+		if access.IsAdmin {
+			http.Redirect(w, r, "/tasker/projects", http.StatusSeeOther)
+			return access, false
+		}
+		http.Error(w, "no active project selected", http.StatusForbidden)
+		return access, false
+	}
+
+	access.Filter = sanitizeSKUFilterForRole(r.URL.Query().Get("filter"), access.IsAdmin)
+	projectScope := strings.TrimSpace(r.URL.Query().Get("project_scope"))
+
+	if access.IsClient {
+		scope, err := resolveClientSKUScope(r.Context(), db, session.UserID, projectScope)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return access, false
+		}
+		if scope.SelectedProject == nil {
+			http.Error(w, "select a specific project to view SKU details", http.StatusBadRequest)
+			return access, false
+		}
+		access.ProjectID = *scope.SelectedProject
+		access.ProjectScope = scope.ScopeValue
+	} else {
+		access.ProjectID = *session.ActiveProjectID
+		access.ProjectScope = strconv.FormatInt(access.ProjectID, 10)
+	}
+	exports, err := sessionExports(r.Context(), db, session.UserID, access.IsAdmin, access.IsClient)
+	if err != nil {
+		http.Error(w, "failed to load export permissions", http.StatusInternalServerError)
+		return access, false
+	}
+	access.Exports = exports
+	return access, true
+}
+
+// sessionExports returns the SKU view exports a user may download: those an
+// admin has allowed for a client user, every export for other admins, and
+// none for scanners.
+func sessionExports(ctx context.Context, db *sqlite.DB, userID int64, isAdmin, isClient bool) (projectinfra.ClientExports, error) {
+	if isClient {
+		return projectinfra.LoadClientExports(ctx, db, userID)
+	}
+	if isAdmin {
+		return projectinfra.AllClientExports, nil
+	}
+	return projectinfra.ClientExports{}, nil
+}
+
+func photoPageParam(r *http.Request) int {
+	page, err := strconv.Atoi(strings.TrimSpace(r.URL.Query().Get("photo_page")))
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
+
 func CreateSKUClientCommentHandler(db *sqlite.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		session, ok := sessioncontext.GetSessionFromContext(r.Context())
@@ -219,6 +396,11 @@ func CreateSKUClientCommentHandler(db *sqlite.DB) http.HandlerFunc {
 		}
 
 		if err := CreateSKUClientComment(r.Context(), db, session.UserID, projectID, palletID, sku, uom, batch, expiry, comment); err != nil {
+			if errors.Is(err, ErrClientCommentRateLimited) {
+				w.Header().Set("Retry-After", "60")
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+				return
+			}
 			redirectTo := buildSKUDetailRedirectURL(sku, uom, batch, expiry, filter, projectScope, palletID, "", err.Error())
 			http.Redirect(w, r, redirectTo, http.StatusSeeOther)
 			return
@@ -242,16 +424,32 @@ func SKUSummaryCSVHandler(db *sqlite.DB) http.HandlerFunc {
 			http.Error(w, "forbidden", http.StatusForbidden)
 			return
 		}
-		if !isClient && (session.ActiveProjectID == nil || *session.ActiveProjectID <= 0) {
+		exports, err := sessionExports(r.Context(), db, session.UserID, isAdmin, isClient)
+		if err != nil {
+			http.Error(w, "failed to load export permissions", http.StatusInternalServerError)
+			return
+		}
+		if !exports.SummaryCSV {
+			http.Error(w, "you do not have permission to download this export", http.StatusForbidden)
+			return
+		}
+		adminProjectID, hasAdminProject := adminExportProjectID(r, session.ActiveProjectID)
+		if !isClient && !hasAdminProject {
 			http.Error(w, "no active project selected", http.StatusForbidden)
 			return
 		}
+		version, err := exportformat.SKUSummary.ParseVersion(r.URL.Query().Get(exportformat.QueryParam))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		startedAt := time.Now()
 
 		filter := sanitizeSKUFilterForRole(r.URL.Query().Get("filter"), isAdmin)
 		var data SKUSummaryPageData
 		var exportProjectID *int64
+		var phaseID int64
 		var fileSuffix string
-		var err error
 
 		if isClient {
 			scope, err := resolveClientSKUScope(r.Context(), db, session.UserID, r.URL.Query().Get("project_scope"))
@@ -263,14 +461,18 @@ func SKUSummaryCSVHandler(db *sqlite.DB) http.HandlerFunc {
 				data, err = LoadSKUSummaryByProjectIDs(r.Context(), db, scope.ProjectIDs, filter)
 				fileSuffix = "assigned-projects"
 			} else {
-				data, err = LoadSKUSummary(r.Context(), db, *scope.SelectedProject, filter)
 				exportProjectID = scope.SelectedProject
 				fileSuffix = "project-" + strconv.FormatInt(*scope.SelectedProject, 10)
 			}
 		} else {
-			data, err = LoadSKUSummary(r.Context(), db, *session.ActiveProjectID, filter)
-			exportProjectID = session.ActiveProjectID
-			fileSuffix = "project-" + strconv.FormatInt(*session.ActiveProjectID, 10)
+			exportProjectID = &adminProjectID
+			fileSuffix = "project-" + strconv.FormatInt(adminProjectID, 10)
+		}
+		if exportProjectID != nil {
+			if phaseID, ok = requestedExportPhaseID(w, r, db, *exportProjectID); !ok {
+				return
+			}
+			data, err = LoadSKUSummaryInPhase(r.Context(), db, *exportProjectID, filter, phaseID)
 		}
 		if err != nil {
 			http.Error(w, "failed to load sku summary", http.StatusInternalServerError)
@@ -279,44 +481,12 @@ func SKUSummaryCSVHandler(db *sqlite.DB) http.HandlerFunc {
 
 		w.Header().Set("Content-Type", "text/csv")
 		w.Header().Set("Content-Disposition", "attachment; filename=sku-summary-"+fileSuffix+".csv")
-
-		writer := csv.NewWriter(w)
-		defer writer.Flush()
-
-		if err := writer.Write([]string{
-			"sku", "description", "uom", "batch_number", "expiry", "expired",
-			"total_qty", "success_qty", "unknown_qty", "damaged_qty",
-			"has_comment", "has_client_comment", "has_photo",
-		}); err != nil {
+		w.Header().Set(exportformat.ResponseHeader, strconv.Itoa(version))
+		if err := writeSKUSummaryCSV(w, data.Rows, version); err != nil {
 			http.Error(w, "failed to export csv", http.StatusInternalServerError)
 			return
 		}
-		for _, row := range data.Rows {
-			record := []string{
-				row.SKU,
-				row.Description,
-				row.UOM,
-				row.BatchNumber,
-				row.ExpiryDateUK,
-				boolCSV(row.IsExpired),
-				strconv.FormatInt(row.TotalQty, 10),
-				strconv.FormatInt(row.SuccessQty, 10),
-				strconv.FormatInt(row.UnknownQty, 10),
-				strconv.FormatInt(row.DamagedQty, 10),
-				boolCSV(row.HasComments),
-				boolCSV(row.HasClientComments),
-				boolCSV(row.HasPhotos),
-			}
-			if err := writer.Write(record); err != nil {
-				http.Error(w, "failed to export csv", http.StatusInternalServerError)
-				return
-			}
-		}
-		if err := writer.Error(); err != nil {
-			http.Error(w, "failed to export csv", http.StatusInternalServerError)
-			return
-		}
-		if err := recordSKUExportRun(r.Context(), db, session.UserID, exportProjectID, "sku_summary_csv"); err != nil {
+		if err := recordSKUExportRun(r.Context(), db, session.UserID, exportProjectID, "sku_summary_csv", skuExportParams(r, filter, version, phaseID), int64(len(data.Rows)), time.Since(startedAt)); err != nil {
 			slog.Error("record sku summary export failed", slog.Any("err", err))
 		}
 	}
@@ -335,16 +505,33 @@ func SKUDetailedCSVHandler(db *sqlite.DB) http.HandlerFunc {
 			http.Error(w, "forbidden", http.StatusForbidden)
 			return
 		}
-		if !isClient && (session.ActiveProjectID == nil || *session.ActiveProjectID <= 0) {
+		exports, err := sessionExports(r.Context(), db, session.UserID, isAdmin, isClient)
+		if err != nil {
+			http.Error(w, "failed to load export permissions", http.StatusInternalServerError)
+			return
+		}
+		if !exports.DetailCSV {
+			http.Error(w, "you do not have permission to download this export", http.StatusForbidden)
+			return
+		}
+		adminProjectID, hasAdminProject := adminExportProjectID(r, session.ActiveProjectID)
+		if !isClient && !hasAdminProject {
 			http.Error(w, "no active project selected", http.StatusForbidden)
 			return
 		}
+		version, err := exportformat.SKUDetailed.ParseVersion(r.URL.Query().Get(exportformat.QueryParam))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		startedAt := time.Now()
 
 		filter := sanitizeSKUFilterForRole(r.URL.Query().Get("filter"), isAdmin)
 		var rows []SKUDetailedExportRow
 		var exportProjectID *int64
+		var exportProjectIDs []int64
+		var phaseID int64
 		var fileSuffix string
-		var err error
 
 		if isClient {
 			scope, err := resolveClientSKUScope(r.Context(), db, session.UserID, r.URL.Query().Get("project_scope"))
@@ -354,71 +541,195 @@ func SKUDetailedCSVHandler(db *sqlite.DB) http.HandlerFunc {
 			}
 			if scope.SelectedProject == nil {
 				rows, err = LoadSKUDetailedExportRowsByProjectIDs(r.Context(), db, scope.ProjectIDs, filter)
+				exportProjectIDs = scope.ProjectIDs
 				fileSuffix = "assigned-projects"
 			} else {
-				rows, err = LoadSKUDetailedExportRows(r.Context(), db, *scope.SelectedProject, filter)
 				exportProjectID = scope.SelectedProject
+				exportProjectIDs = []int64{*scope.SelectedProject}
 				fileSuffix = "project-" + strconv.FormatInt(*scope.SelectedProject, 10)
 			}
 		} else {
-			rows, err = LoadSKUDetailedExportRows(r.Context(), db, *session.ActiveProjectID, filter)
-			exportProjectID = session.ActiveProjectID
-			fileSuffix = "project-" + strconv.FormatInt(*session.ActiveProjectID, 10)
+			exportProjectID = &adminProjectID
+			exportProjectIDs = []int64{adminProjectID}
+			fileSuffix = "project-" + strconv.FormatInt(adminProjectID, 10)
+		}
+		if exportProjectID != nil {
+			if phaseID, ok = requestedExportPhaseID(w, r, db, *exportProjectID); !ok {
+				return
+			}
+			rows, err = LoadSKUDetailedExportRowsInPhase(r.Context(), db, *exportProjectID, filter, phaseID)
 		}
 		if err != nil {
 			http.Error(w, "failed to load detailed rows", http.StatusInternalServerError)
 			return
 		}
+		var custom customfield.ExportSet
+		if exportformat.SKUDetailed.IncludesCustomFields(version) {
+			if custom, err = customfield.LoadExport(r.Context(), db, exportProjectIDs...); err != nil {
+				http.Error(w, "failed to load custom fields", http.StatusInternalServerError)
+				return
+			}
+		}
 
 		w.Header().Set("Content-Type", "text/csv")
 		w.Header().Set("Content-Disposition", "attachment; filename=sku-detailed-"+fileSuffix+".csv")
+		w.Header().Set(exportformat.ResponseHeader, strconv.Itoa(version))
+		if err := writeSKUDetailedCSV(w, rows, custom, version); err != nil {
+			http.Error(w, "failed to export csv", http.StatusInternalServerError)
+			return
+		}
+		if err := recordSKUExportRun(r.Context(), db, session.UserID, exportProjectID, "sku_detailed_csv", skuExportParams(r, filter, version, phaseID), int64(len(rows)), time.Since(startedAt)); err != nil {
+			slog.Error("record sku detail export failed", slog.Any("err", err))
+		}
+	}
+}
 
-		writer := csv.NewWriter(w)
-		defer writer.Flush()
+// SKUPhotosZIPHandler downloads every photo of one SKU instance as a ZIP.
+func SKUPhotosZIPHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		access, ok := resolveSKUDetailAccess(w, r, db)
+		if !ok {
+			return
+		}
+		if !access.Exports.PhotoZIP {
+			http.Error(w, "you do not have permission to download this export", http.StatusForbidden)
+			return
+		}
+		startedAt := time.Now()
 
-		if err := writer.Write([]string{
-			"pallet_id", "receipt_id", "sku", "description", "uom",
-			"qty", "case_size", "unknown_sku", "damaged",
-			"batch_number", "expiry", "expiry_iso", "expired",
-			"line_comment", "has_line_comment", "has_client_comment", "has_photo", "scanned_by",
-		}); err != nil {
-			http.Error(w, "failed to export csv", http.StatusInternalServerError)
+		q := r.URL.Query()
+		sku := strings.TrimSpace(q.Get("sku"))
+		if sku == "" {
+			http.Error(w, "sku is required", http.StatusBadRequest)
 			return
 		}
-		for _, row := range rows {
-			record := []string{
-				strconv.FormatInt(row.PalletID, 10),
-				strconv.FormatInt(row.ReceiptID, 10),
-				row.SKU,
-				row.Description,
-				row.UOM,
-				strconv.FormatInt(row.Qty, 10),
-				strconv.FormatInt(row.CaseSize, 10),
-				boolCSV(row.UnknownSKU),
-				boolCSV(row.Damaged),
-				row.BatchNumber,
-				row.ExpiryDateUK,
-				row.ExpiryDateISO,
-				boolCSV(row.IsExpired),
-				row.LineComment,
-				boolCSV(row.HasLineComment),
-				boolCSV(row.HasClientComments),
-				boolCSV(row.HasPhotos),
-				row.ScannedBy,
-			}
-			if err := writer.Write(record); err != nil {
-				http.Error(w, "failed to export csv", http.StatusInternalServerError)
-				return
+		fileName := "sku-photos-" + exportFileToken(sku) + "-project-" + strconv.FormatInt(access.ProjectID, 10) + ".zip"
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", "attachment; filename="+fileName)
+		// The ZIP streams straight to the client, so a failure part way
+		// through can only be logged.
+		count, err := WriteSKUPhotoZIP(r.Context(), db, w, access.ProjectID, sku, q.Get("uom"), q.Get("batch"), q.Get("expiry"), access.HideInternalPhotos)
+		if err != nil {
+			slog.Error("write sku photo zip failed", slog.Any("err", err))
+			return
+		}
+		params := url.Values{}
+		for _, key := range []string{"sku", "uom", "batch", "expiry", "project_scope"} {
+			if v := strings.TrimSpace(q.Get(key)); v != "" {
+				params.Set(key, v)
 			}
 		}
-		if err := writer.Error(); err != nil {
-			http.Error(w, "failed to export csv", http.StatusInternalServerError)
-			return
+		projectID := access.ProjectID
+		if err := recordSKUExportRun(r.Context(), db, access.UserID, &projectID, "sku_photos_zip", params, count, time.Since(startedAt)); err != nil {
+			slog.Error("record sku photo export failed", slog.Any("err", err))
 		}
-		if err := recordSKUExportRun(r.Context(), db, session.UserID, exportProjectID, "sku_detailed_csv"); err != nil {
-			slog.Error("record sku detail export failed", slog.Any("err", err))
+	}
+}
+
+// exportFileToken keeps the letters, digits, dashes and underscores of v so
+// it is safe in a download file name.
+func exportFileToken(v string) string {
+	token := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '-'
+		}
+	}, v)
+	return strings.Trim(token, "-")
+}
+
+// WriteProjectSKUSummaryCSV writes a project's unfiltered SKU summary in the
+// latest format, as the admin download does, and returns its row count.
+func WriteProjectSKUSummaryCSV(ctx context.Context, db *sqlite.DB, w io.Writer, projectID int64) (int64, error) {
+	data, err := LoadSKUSummary(ctx, db, projectID, "all")
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(data.Rows)), writeSKUSummaryCSV(w, data.Rows, exportformat.SKUSummary.Latest)
+}
+
+// WriteProjectSKUDetailedCSV writes a project's unfiltered SKU detail in the
+// latest format, custom fields included, and returns its row count.
+func WriteProjectSKUDetailedCSV(ctx context.Context, db *sqlite.DB, w io.Writer, projectID int64) (int64, error) {
+	rows, err := LoadSKUDetailedExportRows(ctx, db, projectID, "all")
+	if err != nil {
+		return 0, err
+	}
+	custom, err := customfield.LoadExport(ctx, db, projectID)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(rows)), writeSKUDetailedCSV(w, rows, custom, exportformat.SKUDetailed.Latest)
+}
+
+func writeSKUSummaryCSV(w io.Writer, rows []SKUSummaryRow, version int) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportformat.SKUSummary.Header(version)); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := exportformat.SKUSummary.Record(version, []string{
+			row.SKU,
+			row.Description,
+			row.UOM,
+			row.BatchNumber,
+			row.ExpiryDateUK,
+			boolCSV(row.IsExpired),
+			strconv.FormatInt(row.TotalQty, 10),
+			strconv.FormatInt(row.SuccessQty, 10),
+			strconv.FormatInt(row.UnknownQty, 10),
+			strconv.FormatInt(row.DamagedQty, 10),
+			boolCSV(row.HasComments),
+			boolCSV(row.HasClientComments),
+			boolCSV(row.HasPhotos),
+		})
+		if err := writer.Write(record); err != nil {
+			return err
 		}
 	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeSKUDetailedCSV(w io.Writer, rows []SKUDetailedExportRow, custom customfield.ExportSet, version int) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(append(exportformat.SKUDetailed.Header(version), custom.Header()...)); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := exportformat.SKUDetailed.Record(version, []string{
+			strconv.FormatInt(row.PalletID, 10),
+			strconv.FormatInt(row.ReceiptID, 10),
+			row.SKU,
+			row.Description,
+			row.UOM,
+			strconv.FormatInt(row.Qty, 10),
+			strconv.FormatInt(row.CaseSize, 10),
+			boolCSV(row.UnknownSKU),
+			boolCSV(row.Damaged),
+			row.DamageReason,
+			row.BatchNumber,
+			row.ExpiryDateUK,
+			row.ExpiryDateISO,
+			boolCSV(row.IsExpired),
+			row.LineComment,
+			boolCSV(row.HasLineComment),
+			boolCSV(row.HasClientComments),
+			boolCSV(row.HasPhotos),
+			row.ScannedBy,
+			boolCSV(row.BarcodeCheckFailed),
+			row.CountryOfOrigin,
+			row.HSCode,
+			row.SerialNumbers,
+		})
+		if err := writer.Write(append(record, custom.Record(row.ReceiptID)...)); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
 }
 
 func sanitizeSKUFilterForRole(raw string, isAdmin bool) string {
@@ -467,19 +778,80 @@ func photoHref(palletID, receiptID, photoID int64, primary bool) string {
 	return "/tasker/api/pallets/" + strconv.FormatInt(palletID, 10) + "/receipts/" + strconv.FormatInt(receiptID, 10) + "/photos/" + strconv.FormatInt(photoID, 10)
 }
 
-func recordSKUExportRun(ctx context.Context, db *sqlite.DB, userID int64, projectID *int64, exportType string) error {
-	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
-		var projectArg any = nil
-		if projectID != nil && *projectID > 0 {
-			projectArg = *projectID
-		}
-		_, err := tx.ExecContext(ctx, `
-INSERT INTO export_runs (user_id, project_id, export_type, created_at)
-VALUES (?, ?, ?, CURRENT_TIMESTAMP)`, userID, projectArg, exportType)
-		return err
+func recordSKUExportRun(ctx context.Context, db *sqlite.DB, userID int64, projectID *int64, exportType string, params url.Values, rowCount int64, duration time.Duration) error {
+	return exportrun.Save(ctx, db, exportrun.Run{
+		UserID:     &userID,
+		ProjectID:  projectID,
+		ExportType: exportType,
+		Params:     params,
+		RowCount:   rowCount,
+		Duration:   duration,
 	})
 }
 
+func skuExportParams(r *http.Request, filter string, version int, phaseID int64) url.Values {
+	params := url.Values{}
+	params.Set("filter", filter)
+	params.Set(exportformat.QueryParam, strconv.Itoa(version))
+	if scope := strings.TrimSpace(r.URL.Query().Get("project_scope")); scope != "" {
+		params.Set("project_scope", scope)
+	}
+	if phaseID > 0 {
+		params.Set("phase_id", strconv.FormatInt(phaseID, 10))
+	}
+	return params
+}
+
+// requestedPhaseID resolves ?phase_id=, which limits a view to one phase of
+// the project, or returns 0 for every pallet. It returns phase.ErrNotFound
+// when the phase is not one of the project's.
+func requestedPhaseID(r *http.Request, db *sqlite.DB, projectID int64) (int64, error) {
+	raw := strings.TrimSpace(r.URL.Query().Get("phase_id"))
+	if raw == "" {
+		return 0, nil
+	}
+	phaseID, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || phaseID <= 0 {
+		return 0, phase.ErrNotFound
+	}
+	if _, err := phase.Load(r.Context(), db, projectID, phaseID); err != nil {
+		return 0, err
+	}
+	return phaseID, nil
+}
+
+// requestedExportPhaseID is requestedPhaseID for the CSV exports, which
+// refuse an unknown phase rather than export every pallet. It writes the
+// error and returns false.
+func requestedExportPhaseID(w http.ResponseWriter, r *http.Request, db *sqlite.DB, projectID int64) (int64, bool) {
+	phaseID, err := requestedPhaseID(r, db, projectID)
+	if errors.Is(err, phase.ErrNotFound) {
+		http.Error(w, "phase not found", http.StatusNotFound)
+		return 0, false
+	}
+	if err != nil {
+		http.Error(w, "failed to load phase", http.StatusInternalServerError)
+		return 0, false
+	}
+	return phaseID, true
+}
+
+// adminExportProjectID prefers an explicit project_id (used when re-running a
+// recorded export) over the session's active project.
+func adminExportProjectID(r *http.Request, activeProjectID *int64) (int64, bool) {
+	if raw := strings.TrimSpace(r.URL.Query().Get("project_id")); raw != "" {
+		projectID, err := strconv.ParseInt(raw, 10, 64)
+		if err == nil && projectID > 0 {
+			return projectID, true
+		}
+		return 0, false
+	}
+	if activeProjectID == nil || *activeProjectID <= 0 {
+		return 0, false
+	}
+	return *activeProjectID, true
+}
+
 func resolveClientSKUScope(ctx context.Context, db *sqlite.DB, userID int64, raw string) (clientSKUScope, error) {
 	scope := clientSKUScope{
 		ProjectIDs:    make([]int64, 0),
@@ -516,7 +888,7 @@ func resolveClientSKUScope(ctx context.Context, db *sqlite.DB, userID int64, raw
 			Status     string
 		}{
 			Name:       p.Name,
-			ClientName: p.ClientName,
+			ClientName: string(p.ClientName),
 			Status:     p.Status,
 		}
 	}
@@ -546,7 +918,7 @@ func resolveClientSKUScope(ctx context.Context, db *sqlite.DB, userID int64, raw
 	scope.ScopeValue = strconv.FormatInt(projectID, 10)
 	scope.SelectedProject = &projectID
 	scope.ProjectName = project.Name
-	scope.ProjectClient = project.ClientName
+	scope.ProjectClient = string(project.ClientName)
 	scope.ProjectStatus = project.Status
 	scope.CanOpenDetail = true
 	return scope, nil
@@ -1,5 +1,10 @@
 package progress
 
+import (
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/phase"
+)
+
 type SKUSummaryPageData struct {
 	ProjectID         int64
 	ProjectName       string
@@ -10,13 +15,25 @@ type SKUSummaryPageData struct {
 	CanOpenDetail     bool
 	IsAdmin           bool
 	IsClient          bool
-	CanExport         bool
+	CanExportSummary  bool
+	CanExportDetail   bool
 	Filter            string
-	TotalQtySum       int64
-	SuccessQtySum     int64
-	UnknownQtySum     int64
-	DamagedQtySum     int64
-	Rows              []SKUSummaryRow
+	// PhaseID limits the rows to one phase of the project; 0 shows every
+	// pallet. Phases lists the project's phases for the picker and is empty
+	// across several projects.
+	PhaseID       int64
+	Phases        []phase.Phase
+	TotalQtySum   int64
+	SuccessQtySum int64
+	UnknownQtySum int64
+	DamagedQtySum int64
+	DamageReasons []DamageReasonOption
+	Rows          []SKUSummaryRow
+}
+
+type DamageReasonOption struct {
+	Code  string
+	Label string
 }
 
 type ProjectScopeOption struct {
@@ -39,6 +56,8 @@ type SKUSummaryRow struct {
 	HasComments       bool
 	HasClientComments bool
 	HasPhotos         bool
+	// Trend is the quantity received per day over the last SKUTrendDays.
+	Trend SKUTrend
 }
 
 type SKUDetailedPageData struct {
@@ -56,8 +75,10 @@ type SKUDetailedPageData struct {
 	Instance            SKUSummaryRow
 	ClientComments      []SKUClientComment
 	Pallets             []SKUPalletBreakdownRow
-	Photos              []SKUPhotoRef
+	Gallery             SKUPhotoGallery
 	CommentPalletID     int64
+	// Trend is the quantity received per day from the first receipt.
+	Trend SKUTrend
 }
 
 type SKUPalletBreakdownRow struct {
@@ -69,17 +90,112 @@ type SKUPalletBreakdownRow struct {
 	CommentsRaw string
 }
 
+// SKUPhotoPageSize is the number of photos on one page of the SKU detail
+// gallery.
+const SKUPhotoPageSize = 12
+
+// SKUPhotoGallery is one page of an SKU instance's photos, with the instance
+// keys needed to link to the neighbouring pages.
+type SKUPhotoGallery struct {
+	SKU          string
+	UOM          string
+	BatchNumber  string
+	ExpiryISO    string
+	Filter       string
+	ProjectScope string
+	Page         int
+	TotalPhotos  int
+	CanDownload  bool
+	Photos       []SKUPhotoRef
+}
+
 type SKUPhotoRef struct {
-	PalletID    int64
-	ReceiptID   int64
-	PhotoID     int64
-	IsPrimary   bool
-	LineComment string
+	PalletID     int64  `bun:"pallet_id"`
+	ReceiptID    int64  `bun:"receipt_id"`
+	PhotoID      int64  `bun:"photo_id"`
+	IsPrimary    bool   `bun:"is_primary"`
+	Damaged      bool   `bun:"damaged"`
+	ScannedBy    string `bun:"scanned_by"`
+	CapturedAtUK string `bun:"captured_at_uk"`
+	LineComment  string `bun:"line_comment"`
+}
+
+// PageCount is the number of gallery pages, at least one.
+func (g SKUPhotoGallery) PageCount() int {
+	if g.TotalPhotos <= 0 {
+		return 1
+	}
+	return (g.TotalPhotos + SKUPhotoPageSize - 1) / SKUPhotoPageSize
+}
+
+// FirstShown is the 1-based position of the first photo on the page.
+func (g SKUPhotoGallery) FirstShown() int {
+	if len(g.Photos) == 0 {
+		return 0
+	}
+	return (g.Page-1)*SKUPhotoPageSize + 1
+}
+
+// LastShown is the 1-based position of the last photo on the page.
+func (g SKUPhotoGallery) LastShown() int {
+	return (g.Page-1)*SKUPhotoPageSize + len(g.Photos)
 }
 
 type SKUClientComment struct {
 	PalletID    int64
-	Comment     string
+	Comment     fieldcrypt.String
 	Actor       string
 	CreatedAtUK string
+	// ThreadToken is quoted in emails so the client can reply to them.
+	ThreadToken string
+	ReplyKey    string
+	// ReplyAddress is where the client can send replies to the thread; it
+	// is blank unless the viewer is a client and inbound email has an
+	// address configured.
+	ReplyAddress string
+}
+
+// SKUTrendDays is the number of days, ending today, that the SKU view's
+// sparklines cover.
+const SKUTrendDays = 14
+
+// SKUTrendPoint is the quantity of an SKU instance received on one day.
+type SKUTrendPoint struct {
+	Date string `json:"date"`
+	Qty  int64  `json:"qty"`
+}
+
+// SKUTrend is an SKU instance's received quantity per day, oldest first, with
+// a point for every day of its range including the days nothing arrived.
+type SKUTrend struct {
+	Points []SKUTrendPoint
+}
+
+// Total is the quantity received over the whole range.
+func (t SKUTrend) Total() int64 {
+	var total int64
+	for _, p := range t.Points {
+		total += p.Qty
+	}
+	return total
+}
+
+// Peak is the largest quantity received on one day.
+func (t SKUTrend) Peak() int64 {
+	var peak int64
+	for _, p := range t.Points {
+		peak = max(peak, p.Qty)
+	}
+	return peak
+}
+
+// LastReceived is the last day in range anything arrived, as YYYY-MM-DD, or
+// empty when nothing did.
+func (t SKUTrend) LastReceived() string {
+	for i := len(t.Points) - 1; i >= 0; i-- {
+		if t.Points[i].Qty > 0 {
+			return t.Points[i].Date
+		}
+	}
+	return ""
 }
@@ -0,0 +1,77 @@
+package receipt
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+// highValueConfirmedField is posted back once the scanner has confirmed a
+// high-value SKU's details.
+const highValueConfirmedField = "high_value_confirmed"
+
+func newHighValueConfirmView(r *http.Request, input ReceiptInput) HighValueConfirmView {
+	view := HighValueConfirmView{
+		PalletID:    input.PalletID,
+		SKU:         input.SKU,
+		Description: input.Description,
+		UOM:         input.UOM,
+		Qty:         input.Qty,
+		CaseSize:    input.CaseSize,
+		DamagedQty:  input.DamagedQty,
+		BatchNumber: input.BatchNumber,
+		Photos:      len(input.Photos) + len(input.DeferredPhotos),
+	}
+	if input.ExpiryDate != nil {
+		view.Expiry = input.ExpiryDate.Format("02/01/2006")
+	}
+	if len(input.StockPhotoBlob) > 0 {
+		view.Photos++
+	}
+	names := make([]string, 0, len(r.PostForm))
+	for name := range r.PostForm {
+		if name == "_csrf" || name == highValueConfirmedField {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range r.PostForm[name] {
+			view.Fields = append(view.Fields, ConfirmField{Name: name, Value: value})
+		}
+	}
+	return view
+}
+
+// showHighValueConfirm records that the confirmation was shown and renders
+// it instead of saving. Script posts get the dialog as JSON so the photos
+// they hold back are still sent once confirmed; plain posts get a page that
+// posts the form again.
+func showHighValueConfirm(w http.ResponseWriter, r *http.Request, db *sqlite.DB, auditSvc *audit.Service, userID int64, input ReceiptInput) {
+	if err := RecordHighValueConfirmShown(r.Context(), db, auditSvc, userID, input); err != nil {
+		http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(input.PalletID, 10)+"/receipt?error="+url.QueryEscape("failed to save receipt"), http.StatusSeeOther)
+		return
+	}
+	view := newHighValueConfirmView(r, input)
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		var buf bytes.Buffer
+		if err := HighValueConfirmDialog(view).Render(r.Context(), &buf); err != nil {
+			http.Error(w, "failed to render confirmation", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"confirm": buf.String()})
+		return
+	}
+	if err := HighValueConfirmPage(view).Render(r.Context(), w); err != nil {
+		http.Error(w, "failed to render confirmation", http.StatusInternalServerError)
+	}
+}
@@ -14,12 +14,35 @@ import (
 	"github.com/uptrace/bun"
 
 	"receipter/infrastructure/audit"
+	"receipter/infrastructure/catalog"
+	"receipter/infrastructure/coldstorage"
+	"receipter/infrastructure/customfield"
+	"receipter/infrastructure/customs"
+	"receipter/infrastructure/damage"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/formtoken"
+	"receipter/infrastructure/notification"
+	"receipter/infrastructure/pallets"
+	"receipter/infrastructure/phase"
+	"receipter/infrastructure/photocapture"
+	"receipter/infrastructure/photoquota"
+	"receipter/infrastructure/photoretention"
+	"receipter/infrastructure/photoupload"
+	"receipter/infrastructure/photovisibility"
+	"receipter/infrastructure/project"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/receipts"
+	"receipter/infrastructure/serials"
 	"receipter/infrastructure/sqlite"
 	"receipter/models"
 )
 
 var ErrPalletNotLabelled = errors.New("pallet is not labelled")
 
+// ErrSerialSplit refuses a partial damaged qty on a serial-tracked line,
+// since the edit form has no way to say which serials were damaged.
+var ErrSerialSplit = errors.New("serial-tracked lines cannot be part damaged: delete the line and rescan the damaged units on their own")
+
 type LabelledPalletUploadData struct {
 	PalletID          int64
 	ProjectID         int64
@@ -99,7 +122,7 @@ SELECT p.project_id,
        COALESCE(strftime('%d/%m/%Y', p.created_at), '') AS pallet_created_date
 FROM pallets p
 JOIN projects pj ON pj.id = p.project_id
-WHERE p.id = ?`+projectFilter, args...).Scan(ctx, &data.ProjectID, &data.PalletStatus, &data.ProjectCode, &data.ClientName, &data.PalletCreatedDate); err != nil {
+WHERE p.id = ?`+projectFilter, args...).Scan(ctx, &data.ProjectID, &data.PalletStatus, &data.ProjectCode, fieldcrypt.Dest(&data.ClientName), &data.PalletCreatedDate); err != nil {
 		return data, err
 	}
 
@@ -340,7 +363,7 @@ func writeReceiptUploadCSV(w io.Writer, pallets []LabelledPalletUploadData) erro
 }
 
 func LoadPageData(ctx context.Context, db *sqlite.DB, palletID int64) (PageData, error) {
-	data := PageData{PalletID: palletID, Lines: make([]ReceiptLineView, 0)}
+	data := PageData{PalletID: palletID, DamageReasons: make([]DamageReasonOption, 0), Lines: make([]ReceiptLineView, 0)}
 	var lines []struct {
 		ID             int64  `bun:"id"`
 		SKU            string `bun:"sku"`
@@ -352,6 +375,8 @@ func LoadPageData(ctx context.Context, db *sqlite.DB, palletID int64) (PageData,
 		UnknownSKU     bool   `bun:"unknown_sku"`
 		Damaged        bool   `bun:"damaged"`
 		DamagedQty     int64  `bun:"damaged_qty"`
+		DamageReason   string `bun:"damage_reason"`
+		DamageLabel    string `bun:"damage_reason_label"`
 		BatchNumber    string `bun:"batch_number"`
 		ExpiryDate     string `bun:"expiry_date"`
 		ExpiryDateISO  string `bun:"expiry_date_iso"`
@@ -360,31 +385,70 @@ func LoadPageData(ctx context.Context, db *sqlite.DB, palletID int64) (PageData,
 		HasPhoto       bool   `bun:"has_photo"`
 		NoOuterBarcode bool   `bun:"no_outer_barcode"`
 		NoInnerBarcode bool   `bun:"no_inner_barcode"`
+		Country        string `bun:"country_of_origin"`
+		HSCode         string `bun:"hs_code"`
 	}
 	photoIDsByReceipt := make(map[int64][]int64)
+	customValuesByReceipt := make(map[int64][]customfield.Value)
+	pendingByReceipt := make(map[int64]int)
+	failedByReceipt := make(map[int64]int)
+	serialsByReceipt := make(map[int64][]string)
 
 	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
 		if err := tx.NewRaw(`
-SELECT p.status, p.project_id, pj.status, pj.name, pj.client_name
+SELECT p.status, p.project_id, pj.status, pj.name, pj.client_name,
+       COALESCE(pa.pallet_type, ''), COALESCE(pa.delivery_reference, ''),
+       COALESCE(ph.name, ''), COALESCE(ph.status = 'closed', 0)
 FROM pallets p
 JOIN projects pj ON pj.id = p.project_id
-WHERE p.id = ?`, palletID).Scan(ctx, &data.PalletStatus, &data.ProjectID, &data.ProjectStatus, &data.ProjectName, &data.ClientName); err != nil {
+LEFT JOIN pallet_attributes pa ON pa.pallet_id = p.id
+LEFT JOIN pallet_phases pp ON pp.pallet_id = p.id
+LEFT JOIN project_phases ph ON ph.id = pp.phase_id
+WHERE p.id = ?`, palletID).Scan(ctx, &data.PalletStatus, &data.ProjectID, &data.ProjectStatus, &data.ProjectName, fieldcrypt.Dest(&data.ClientName), &data.PalletType, &data.DeliveryReference, &data.Phase, &data.PhaseClosed); err != nil {
 			return err
 		}
 		if err := tx.NewRaw(`
 SELECT pr.id, pr.sku, pr.description, COALESCE(pr.uom, '') AS uom, COALESCE(pr.comment, '') AS comment, pr.qty, pr.case_size, pr.unknown_sku, pr.damaged, pr.damaged_qty, COALESCE(pr.batch_number, '') AS batch_number,
+       pr.damage_reason, COALESCE(dr.label, pr.damage_reason) AS damage_reason_label,
        COALESCE(strftime('%d/%m/%Y', pr.expiry_date), '') AS expiry_date,
        COALESCE(strftime('%Y-%m-%d', pr.expiry_date), '') AS expiry_date_iso,
        COALESCE(pr.carton_barcode, '') AS carton_barcode,
        COALESCE(pr.item_barcode, '') AS item_barcode,
        CASE WHEN pr.stock_photo_blob IS NOT NULL AND length(pr.stock_photo_blob) > 0 THEN 1 ELSE 0 END AS has_photo,
-       pr.no_outer_barcode, pr.no_inner_barcode
+       pr.no_outer_barcode, pr.no_inner_barcode, pr.country_of_origin, pr.hs_code
 FROM pallet_receipts pr
+LEFT JOIN damage_reasons dr ON dr.code = pr.damage_reason
 WHERE pr.pallet_id = ?
   AND pr.project_id = ?
 ORDER BY pr.id DESC`, palletID, data.ProjectID).Scan(ctx, &lines); err != nil {
 			return err
 		}
+		if err := tx.NewRaw(`
+SELECT code, label
+FROM damage_reasons
+WHERE active = 1
+ORDER BY sort_order ASC, label ASC, code ASC`).Scan(ctx, &data.DamageReasons); err != nil {
+			return err
+		}
+		fields, err := customfield.ListTx(ctx, tx, data.ProjectID, false)
+		if err != nil {
+			return err
+		}
+		for _, field := range fields {
+			data.CustomFields = append(data.CustomFields, CustomFieldInput{ID: field.ID, Label: field.Label, Type: field.FieldType, Required: field.Required})
+		}
+		if data.VerifyBeforeClose, err = pallets.VerifyRequired(ctx, tx, data.ProjectID); err != nil {
+			return err
+		}
+		settings, err := projectsettings.LoadTx(ctx, tx, data.ProjectID)
+		if err != nil {
+			return err
+		}
+		data.Customs = customs.LoadConfig(settings)
+		data.PhotoCapture = photocapture.LoadConfig(settings)
+		if data.SerialSKUs, err = catalog.SerialTrackedSKUs(ctx, tx, data.ProjectID); err != nil {
+			return err
+		}
 
 		if len(lines) == 0 {
 			return nil
@@ -412,7 +476,31 @@ ORDER BY pr.id DESC`, palletID, data.ProjectID).Scan(ctx, &lines); err != nil {
 			photoIDsByReceipt[row.PalletReceiptID] = append(photoIDsByReceipt[row.PalletReceiptID], row.ID)
 		}
 
-		return nil
+		var uploadRows []struct {
+			PalletReceiptID int64  `bun:"pallet_receipt_id"`
+			Status          string `bun:"status"`
+		}
+		if err := tx.NewSelect().
+			TableExpr("photo_uploads").
+			Column("pallet_receipt_id", "status").
+			Where("pallet_receipt_id IN (?)", bun.In(receiptIDs)).
+			Where("status != ?", photoupload.StatusDone).
+			Scan(ctx, &uploadRows); err != nil {
+			return err
+		}
+		for _, row := range uploadRows {
+			if photoupload.IsPending(row.Status) {
+				pendingByReceipt[row.PalletReceiptID]++
+			} else {
+				failedByReceipt[row.PalletReceiptID]++
+			}
+		}
+
+		if serialsByReceipt, err = serials.ForReceipts(ctx, tx, receiptIDs); err != nil {
+			return err
+		}
+		customValuesByReceipt, err = customfield.LoadValues(ctx, tx, receiptIDs)
+		return err
 	})
 	if err != nil {
 		return data, err
@@ -423,27 +511,35 @@ ORDER BY pr.id DESC`, palletID, data.ProjectID).Scan(ctx, &lines); err != nil {
 		hasAnyPhoto := line.HasPhoto || len(photoIDs) > 0
 
 		data.Lines = append(data.Lines, ReceiptLineView{
-			ID:              line.ID,
-			SKU:             line.SKU,
-			Description:     line.Description,
-			UOM:             line.UOM,
-			Comment:         line.Comment,
-			Qty:             line.Qty,
-			CaseSize:        line.CaseSize,
-			UnknownSKU:      line.UnknownSKU,
-			Damaged:         line.Damaged,
-			DamagedQty:      line.DamagedQty,
-			BatchNumber:     line.BatchNumber,
-			ExpiryDateUK:    line.ExpiryDate,
-			ExpiryDateISO:   line.ExpiryDateISO,
-			CartonBarcode:   line.CartonBarcode,
-			ItemBarcode:     line.ItemBarcode,
-			HasPhoto:        hasAnyPhoto,
-			HasPrimaryPhoto: line.HasPhoto,
-			PhotoIDs:        photoIDs,
-			PhotoCount:      len(photoIDs),
-			NoOuterBarcode:  line.NoOuterBarcode,
-			NoInnerBarcode:  line.NoInnerBarcode,
+			ID:                line.ID,
+			SKU:               line.SKU,
+			Description:       line.Description,
+			UOM:               line.UOM,
+			Comment:           line.Comment,
+			Qty:               line.Qty,
+			CaseSize:          line.CaseSize,
+			UnknownSKU:        line.UnknownSKU,
+			Damaged:           line.Damaged,
+			DamagedQty:        line.DamagedQty,
+			DamageReason:      line.DamageReason,
+			DamageReasonLabel: line.DamageLabel,
+			BatchNumber:       line.BatchNumber,
+			ExpiryDateUK:      line.ExpiryDate,
+			ExpiryDateISO:     line.ExpiryDateISO,
+			CartonBarcode:     line.CartonBarcode,
+			ItemBarcode:       line.ItemBarcode,
+			HasPhoto:          hasAnyPhoto,
+			HasPrimaryPhoto:   line.HasPhoto,
+			PhotoIDs:          photoIDs,
+			PhotoCount:        len(photoIDs),
+			PhotosPending:     pendingByReceipt[line.ID],
+			PhotosFailed:      failedByReceipt[line.ID],
+			NoOuterBarcode:    line.NoOuterBarcode,
+			NoInnerBarcode:    line.NoInnerBarcode,
+			CountryOfOrigin:   line.Country,
+			HSCode:            line.HSCode,
+			CustomValues:      customValuesByReceipt[line.ID],
+			Serials:           serialsByReceipt[line.ID],
 		})
 	}
 	return data, nil
@@ -459,7 +555,8 @@ func SearchStock(ctx context.Context, db *sqlite.DB, projectID int64, q string)
 		return tx.NewSelect().
 			Model(&items).
 			Where("project_id = ?", projectID).
-			Where("(sku LIKE ? OR description LIKE ? OR uom LIKE ?)", "%"+q+"%", "%"+q+"%", "%"+q+"%").
+			Where("active = 1").
+			Where("(sku LIKE ? OR description LIKE ? OR uom LIKE ? OR sku IN (SELECT sib.sku FROM stock_item_barcodes sib WHERE sib.project_id = ? AND sib.barcode = ?))", "%"+q+"%", "%"+q+"%", "%"+q+"%", projectID, q).
 			OrderExpr("sku ASC").
 			Limit(20).
 			Scan(ctx)
@@ -467,6 +564,63 @@ func SearchStock(ctx context.Context, db *sqlite.DB, projectID int64, q string)
 	return items, err
 }
 
+// SearchBatches returns the batch numbers already receipted for sku on the
+// project that contain q, most recently received first, each with the
+// expiry of its latest receipt.
+func SearchBatches(ctx context.Context, db *sqlite.DB, projectID int64, sku, q string) ([]BatchSuggestion, error) {
+	sku = strings.TrimSpace(sku)
+	q = strings.TrimSpace(q)
+	batches := make([]BatchSuggestion, 0)
+	if sku == "" {
+		return batches, nil
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		// SQLite takes the bare expiry column from the row holding MAX(id).
+		return tx.NewRaw(`
+SELECT batch_number, COALESCE(date(expiry_date), '') AS expiry_date, MAX(id) AS latest_id
+FROM pallet_receipts
+WHERE project_id = ? AND sku = ? COLLATE NOCASE
+  AND COALESCE(batch_number, '') != '' AND batch_number LIKE ?
+GROUP BY batch_number
+ORDER BY latest_id DESC
+LIMIT 10`, projectID, sku, "%"+q+"%").Scan(ctx, &batches)
+	})
+	return batches, err
+}
+
+// ClaimPallet claims the pallet for userID, or renews their claim, and
+// returns whoever holds it.
+func ClaimPallet(ctx context.Context, db *sqlite.DB, palletID, userID int64, now time.Time) (pallets.Claim, error) {
+	var claim pallets.Claim
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		claim, err = pallets.TakeClaim(ctx, tx, palletID, userID, now)
+		return err
+	})
+	return claim, err
+}
+
+// LoadReceiptStats loads the stats strip of a pallet for userID. Captures
+// are create and merge entries of receipt lines in the audit log, counting
+// the units each one added.
+func LoadReceiptStats(ctx context.Context, db *sqlite.DB, palletID, userID int64, now time.Time) (ReceiptStats, error) {
+	var stats ReceiptStats
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT COUNT(1) AS lines, COALESCE(SUM(qty), 0) AS units FROM pallet_receipts WHERE pallet_id = ?`, palletID).
+			Scan(ctx, &stats.Lines, &stats.Units); err != nil {
+			return err
+		}
+		return tx.NewRaw(`
+SELECT COALESCE(SUM(CASE WHEN julianday(created_at) >= julianday(?) - 1.0 / 24
+                         THEN COALESCE(json_extract(after_json, '$.Qty'), 0) - COALESCE(CASE WHEN json_valid(before_json) = 1 THEN json_extract(before_json, '$.Qty') END, 0) END), 0),
+       CAST((julianday(?) - julianday(MAX(created_at))) * 86400 AS INTEGER)
+FROM audit_logs
+WHERE user_id = ? AND action IN ('receipt.create', 'receipt.merge') AND json_valid(after_json) = 1`,
+			now, now, userID).Scan(ctx, &stats.MyUnitsLastHour, &stats.SecondsSinceLastCapture)
+	})
+	return stats, err
+}
+
 func LoadPalletContext(ctx context.Context, db *sqlite.DB, palletID int64) (palletStatus string, projectID int64, projectStatus string, err error) {
 	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
 		return tx.NewRaw(`
@@ -479,121 +633,230 @@ WHERE p.id = ?`, palletID).Scan(ctx, &palletStatus, &projectID, &projectStatus)
 }
 
 func SaveReceipt(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID int64, input ReceiptInput) error {
+	_, err := SaveReceiptWithUploads(ctx, db, auditSvc, userID, input)
+	return err
+}
+
+// SaveReceiptWithUploads saves a receipt like SaveReceipt and reserves an
+// upload for each deferred photo on the line the photos belong to.
+func SaveReceiptWithUploads(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID int64, input ReceiptInput) (SavedReceipt, error) {
+	var saved SavedReceipt
 	if userID <= 0 {
-		return fmt.Errorf("invalid user id")
+		return saved, fmt.Errorf("invalid user id")
 	}
-	input.SKU = strings.TrimSpace(input.SKU)
-	input.Description = strings.TrimSpace(input.Description)
-	input.UOM = strings.TrimSpace(input.UOM)
-	input.Comment = strings.TrimSpace(input.Comment)
-	if input.UnknownSKU {
-		if input.SKU == "" {
-			input.SKU = "UNKNOWN"
-		}
-		if input.Description == "" {
-			input.Description = "Unidentifiable item"
-		}
-	} else if input.SKU == "" {
-		return fmt.Errorf("sku is required")
-	}
-	if input.UnknownSKU && len(input.StockPhotoBlob) == 0 && len(input.Photos) == 0 {
-		return fmt.Errorf("unknown sku requires at least one photo")
-	}
-	if input.Qty <= 0 {
-		return fmt.Errorf("qty must be greater than 0")
+	input, err := normalizeReceiptInput(input)
+	if err != nil {
+		return saved, err
 	}
-	if input.CaseSize <= 0 {
-		input.CaseSize = 1
+	err = db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		saved, err = saveReceiptTx(ctx, tx, auditSvc, userID, input)
+		return err
+	})
+	return saved, err
+}
+
+// normalizeReceiptInput tidies the text fields of a receipt and checks its
+// quantities before anything is written.
+func normalizeReceiptInput(input ReceiptInput) (ReceiptInput, error) {
+	draft := receipts.Draft{
+		SKU:          input.SKU,
+		Description:  input.Description,
+		UOM:          input.UOM,
+		Comment:      input.Comment,
+		Qty:          input.Qty,
+		CaseSize:     input.CaseSize,
+		UnknownSKU:   input.UnknownSKU,
+		Damaged:      input.Damaged,
+		DamagedQty:   input.DamagedQty,
+		DamageReason: input.DamageReason,
+		HasPhotos:    len(input.StockPhotoBlob) > 0 || len(input.Photos) > 0 || len(input.DeferredPhotos) > 0,
 	}
-	if input.DamagedQty < 0 {
-		return fmt.Errorf("damaged qty must be 0 or greater")
+	if err := draft.Normalize(); err != nil {
+		return input, err
 	}
-	if input.Damaged && input.DamagedQty <= 0 {
-		return fmt.Errorf("damaged qty is required when damaged is selected")
+	input.SKU, input.Description, input.UOM, input.Comment = draft.SKU, draft.Description, draft.UOM, draft.Comment
+	input.CaseSize, input.DamageReason = draft.CaseSize, draft.DamageReason
+	return input, nil
+}
+
+// saveReceiptTx saves a normalized receipt inside tx, merging it into a
+// matching line of the pallet where there is one.
+func saveReceiptTx(ctx context.Context, tx bun.Tx, auditSvc *audit.Service, userID int64, input ReceiptInput) (SavedReceipt, error) {
+	var saved SavedReceipt
+	if input.FormToken != "" {
+		if err := formtoken.Use(ctx, tx, input.FormToken); err != nil {
+			return saved, err
+		}
 	}
-	if input.DamagedQty > input.Qty {
-		return fmt.Errorf("damaged qty cannot exceed qty")
+	if input.DamageReason != "" {
+		if _, err := damage.ValidateActiveCode(ctx, tx, input.DamageReason); err != nil {
+			return saved, err
+		}
 	}
 
-	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
-		var palletStatus string
-		var projectID int64
-		var projectStatus string
-		if err := tx.NewRaw(`
+	var palletStatus string
+	var projectID int64
+	var projectStatus string
+	if err := tx.NewRaw(`
 SELECT p.status, p.project_id, pj.status
 FROM pallets p
 JOIN projects pj ON pj.id = p.project_id
 WHERE p.id = ?`, input.PalletID).Scan(ctx, &palletStatus, &projectID, &projectStatus); err != nil {
-			return err
+		return saved, err
+	}
+	if err := project.CheckWritable(projectStatus); err != nil {
+		return saved, err
+	}
+	if palletStatus == pallets.StatusCancelled {
+		return saved, fmt.Errorf("cancelled pallets are read-only")
+	}
+	if err := phase.CheckPalletTx(ctx, tx, input.PalletID); err != nil {
+		return saved, err
+	}
+	if !pallets.IsValidStatus(palletStatus) {
+		return saved, fmt.Errorf("invalid pallet status: %s", palletStatus)
+	}
+
+	settings, err := projectsettings.LoadTx(ctx, tx, projectID)
+	if err != nil {
+		return saved, err
+	}
+	if !input.UnknownSKU {
+		if settings.Bool(projectsettings.ReceiptRequireBatch) && strings.TrimSpace(input.BatchNumber) == "" {
+			return saved, fmt.Errorf("%w: this project requires a batch number", projectsettings.ErrRule)
+		}
+		if settings.Bool(projectsettings.ReceiptRequireExpiry) && input.ExpiryDate == nil {
+			return saved, fmt.Errorf("%w: this project requires an expiry date", projectsettings.ErrRule)
+		}
+	}
+	input.CountryOfOrigin, input.HSCode, err = customs.LoadConfig(settings).Resolve(input.CountryOfOrigin, input.HSCode, input.UnknownSKU)
+	if err != nil {
+		return saved, err
+	}
+	capture := photocapture.LoadConfig(settings)
+	if len(input.StockPhotoBlob) > 0 {
+		if err := capture.Check(input.StockPhotoBlob); err != nil {
+			return saved, err
+		}
+	}
+	for _, photo := range input.Photos {
+		if err := capture.Check(photo.Blob); err != nil {
+			return saved, err
 		}
-		if projectStatus != "active" {
-			return fmt.Errorf("inactive projects are read-only")
+	}
+
+	if !input.UnknownSKU {
+		if err := receipts.UpsertCatalog(ctx, tx, projectID, input.SKU, input.Description, input.UOM); err != nil {
+			return saved, err
 		}
-		if palletStatus == "cancelled" {
-			return fmt.Errorf("cancelled pallets are read-only")
+	}
+
+	segments := receipts.Split(input.Qty, input.DamagedQty)
+	if len(segments) == 0 {
+		return saved, fmt.Errorf("qty must be greater than 0")
+	}
+
+	attachToDamagedSegment := input.DamagedQty > 0
+	for i, segment := range segments {
+		lineInput := input
+		lineInput.Qty = segment.Qty
+		lineInput.Damaged = segment.Damaged
+		if segment.Damaged {
+			lineInput.DamagedQty = segment.Qty
+		} else {
+			lineInput.DamagedQty = 0
+			lineInput.DamageReason = ""
 		}
-		if palletStatus != "created" && palletStatus != "open" && palletStatus != "closed" && palletStatus != "labelled" && palletStatus != "cancelled" {
-			return fmt.Errorf("invalid pallet status: %s", palletStatus)
+		attachMedia := (attachToDamagedSegment && segment.Damaged) || (!attachToDamagedSegment && i == 0)
+		if !attachMedia {
+			lineInput.StockPhotoBlob = nil
+			lineInput.StockPhotoMIME = ""
+			lineInput.StockPhotoName = ""
+			lineInput.Photos = nil
 		}
 
-		if !input.UnknownSKU {
-			if err := upsertStockItemCatalog(ctx, tx, projectID, input.SKU, input.Description, input.UOM); err != nil {
-				return err
-			}
+		receiptID, err := upsertReceiptLine(ctx, tx, auditSvc, settings, userID, projectID, input.SKU, input.Description, input.UOM, lineInput)
+		if err != nil {
+			return saved, err
 		}
+		if attachMedia {
+			saved.ReceiptID = receiptID
+		}
+	}
 
-		segments := []struct {
-			qty     int64
-			damaged bool
-		}{}
-		nonDamagedQty := input.Qty - input.DamagedQty
-		if nonDamagedQty > 0 {
-			segments = append(segments, struct {
-				qty     int64
-				damaged bool
-			}{qty: nonDamagedQty, damaged: false})
-		}
-		if input.DamagedQty > 0 {
-			segments = append(segments, struct {
-				qty     int64
-				damaged bool
-			}{qty: input.DamagedQty, damaged: true})
-		}
-		if len(segments) == 0 {
-			return fmt.Errorf("qty must be greater than 0")
-		}
-
-		attachToDamagedSegment := input.DamagedQty > 0
-		for i, segment := range segments {
-			lineInput := input
-			lineInput.Qty = segment.qty
-			lineInput.Damaged = segment.damaged
-			if segment.damaged {
-				lineInput.DamagedQty = segment.qty
-			} else {
-				lineInput.DamagedQty = 0
-			}
-			attachMedia := (attachToDamagedSegment && segment.damaged) || (!attachToDamagedSegment && i == 0)
-			if !attachMedia {
-				lineInput.StockPhotoBlob = nil
-				lineInput.StockPhotoMIME = ""
-				lineInput.StockPhotoName = ""
-				lineInput.Photos = nil
-			}
+	// Serials go with the line the photos went to, so a damaged line
+	// keeps the serials of the units it was scanned with.
+	if len(input.Serials) > 0 {
+		if err := serials.Add(ctx, tx, projectID, saved.ReceiptID, userID, input.Serials); err != nil {
+			return saved, err
+		}
+	}
 
-			if err := upsertReceiptLine(ctx, tx, auditSvc, userID, projectID, input.SKU, input.Description, input.UOM, lineInput); err != nil {
-				return err
-			}
+	if input.HighValueConfirmed && auditSvc != nil {
+		if err := auditSvc.Write(ctx, tx, userID, "receipt.high_value_confirmed", "pallet_receipts", fmt.Sprintf("%d", saved.ReceiptID), nil, highValueAuditDetails(input)); err != nil {
+			return saved, err
 		}
+	}
 
-		if err := promotePalletToOpenIfCreated(ctx, tx, projectID, input.PalletID); err != nil {
-			return err
+	for i := range input.DeferredPhotos {
+		input.DeferredPhotos[i].Internal = input.PhotosInternal
+	}
+	uploads, err := photoupload.Reserve(ctx, tx, saved.ReceiptID, userID, input.DeferredPhotos)
+	if err != nil {
+		return saved, err
+	}
+	saved.Uploads = uploads
+
+	if len(input.StockPhotoBlob) > 0 || len(input.Photos) > 0 || len(input.DeferredPhotos) > 0 {
+		quota := photoquota.LoadConfig(settings)
+		if err := quota.CheckTx(ctx, tx, projectID, saved.ReceiptID, 0, 0); err != nil {
+			return saved, err
+		}
+		if err := quota.AlertTx(ctx, tx, projectID, time.Now().UTC()); err != nil {
+			return saved, err
+		}
+	}
+
+	if err := pallets.PromoteToOpen(ctx, tx, projectID, input.PalletID); err != nil {
+		return saved, err
+	}
+	if palletStatus == pallets.StatusCreated || palletStatus == pallets.StatusOpen {
+		// Saving a line renews the scanner's claim; another user's
+		// claim is only a warning, so it never blocks the save.
+		if _, err := pallets.TakeClaim(ctx, tx, input.PalletID, userID, time.Now().UTC()); err != nil {
+			return saved, err
 		}
+	}
+	return saved, nil
+}
+
+// RecordHighValueConfirmShown notes in the audit log that the scanner was
+// asked to confirm a high-value SKU's details. The confirmation, once
+// accepted, is recorded against the saved line.
+func RecordHighValueConfirmShown(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID int64, input ReceiptInput) error {
+	if auditSvc == nil {
 		return nil
+	}
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return auditSvc.Write(ctx, tx, userID, "receipt.high_value_confirm_shown", "pallets", fmt.Sprintf("%d", input.PalletID), nil, highValueAuditDetails(input))
 	})
 }
 
-func upsertReceiptLine(ctx context.Context, tx bun.Tx, auditSvc *audit.Service, userID, projectID int64, sku, description, uom string, input ReceiptInput) error {
+func highValueAuditDetails(input ReceiptInput) map[string]any {
+	details := map[string]any{
+		"pallet_id":    input.PalletID,
+		"sku":          input.SKU,
+		"qty":          input.Qty,
+		"batch_number": input.BatchNumber,
+	}
+	if input.ExpiryDate != nil {
+		details["expiry_date"] = input.ExpiryDate.Format("2006-01-02")
+	}
+	return details
+}
+
+func upsertReceiptLine(ctx context.Context, tx bun.Tx, auditSvc *audit.Service, settings projectsettings.Settings, userID, projectID int64, sku, description, uom string, input ReceiptInput) (int64, error) {
 	var existing models.PalletReceipt
 	query := tx.NewSelect().
 		Model(&existing).
@@ -604,111 +867,149 @@ func upsertReceiptLine(ctx context.Context, tx bun.Tx, auditSvc *audit.Service,
 		Where("case_size = ?", input.CaseSize).
 		Where("unknown_sku = ?", input.UnknownSKU).
 		Where("damaged = ?", input.Damaged).
-		Where("COALESCE(batch_number, '') = COALESCE(?, '')", input.BatchNumber)
+		Where("damage_reason = ?", input.DamageReason).
+		Where("COALESCE(batch_number, '') = COALESCE(?, '')", input.BatchNumber).
+		Where("country_of_origin = ?", input.CountryOfOrigin).
+		Where("hs_code = ?", input.HSCode)
 	if input.ExpiryDate == nil {
 		query = query.Where("expiry_date IS NULL")
 	} else {
 		query = query.Where("date(expiry_date) = date(?)", input.ExpiryDate.Format("2006-01-02"))
 	}
-	err := query.Limit(1).Scan(ctx)
+	err := sql.ErrNoRows
+	if settings.String(projectsettings.ReceiptMergeMode) != projectsettings.MergeModeSeparate {
+		err = query.Limit(1).Scan(ctx)
+	}
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return err
+		return 0, err
 	}
 
 	if err == nil {
 		before := existing
-		existing.Qty += input.Qty
-		existing.SKU = sku
-		existing.UOM = uom
-		existing.UnknownSKU = input.UnknownSKU
-		if description != "" || existing.Description == "" {
-			existing.Description = description
-		}
-		if input.Comment != "" {
-			existing.Comment = input.Comment
-		}
-		if input.Damaged {
-			existing.Damaged = true
-			existing.DamagedQty = existing.Qty
-		} else {
-			existing.Damaged = false
-			existing.DamagedQty = 0
-		}
-		existing.ScannedByUserID = userID
-		if len(input.StockPhotoBlob) > 0 {
-			existing.StockPhotoBlob = input.StockPhotoBlob
-			existing.StockPhotoMIME = input.StockPhotoMIME
-			existing.StockPhotoName = input.StockPhotoName
-		}
+		existing = receipts.Merge(existing, models.PalletReceipt{
+			SKU:             sku,
+			Description:     description,
+			UOM:             uom,
+			Comment:         input.Comment,
+			ScannedByUserID: userID,
+			Qty:             input.Qty,
+			UnknownSKU:      input.UnknownSKU,
+			Damaged:         input.Damaged,
+			DamageReason:    input.DamageReason,
+			StockPhotoBlob:  input.StockPhotoBlob,
+			StockPhotoMIME:  input.StockPhotoMIME,
+			StockPhotoName:  input.StockPhotoName,
+		})
 		existing.UpdatedAt = time.Now()
 		if _, err := tx.NewUpdate().Model(&existing).WherePK().Exec(ctx); err != nil {
-			return err
+			return 0, err
 		}
 		if auditSvc != nil {
 			if err := auditSvc.Write(ctx, tx, userID, "receipt.merge", "pallet_receipts", fmt.Sprintf("%d", existing.ID), before, existing); err != nil {
-				return err
+				return 0, err
 			}
 		}
-		if err := insertReceiptPhotos(ctx, tx, existing.ID, input.Photos); err != nil {
-			return err
+		if err := insertReceiptPhotos(ctx, tx, userID, existing.ID, input); err != nil {
+			return 0, err
+		}
+		if err := customfield.SaveValues(ctx, tx, auditSvc, userID, projectID, existing.ID, input.CustomValues, true); err != nil {
+			return 0, err
+		}
+		return existing.ID, nil
+	}
+
+	if maxLines := settings.Int(projectsettings.PalletMaxLines); maxLines > 0 {
+		var lines int64
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM pallet_receipts WHERE pallet_id = ?`, input.PalletID).Scan(ctx, &lines); err != nil {
+			return 0, err
+		}
+		if lines >= maxLines {
+			return 0, fmt.Errorf("%w: pallet is full, this project allows %d lines per pallet", projectsettings.ErrRule, maxLines)
 		}
-		return nil
 	}
 
 	damagedQty := int64(0)
+	damageReason := ""
 	if input.Damaged {
 		damagedQty = input.Qty
+		damageReason = input.DamageReason
 	}
 	receipt := models.PalletReceipt{
-		ProjectID:       projectID,
-		PalletID:        input.PalletID,
-		SKU:             sku,
-		Description:     description,
-		UOM:             uom,
-		Comment:         input.Comment,
-		ScannedByUserID: userID,
-		Qty:             input.Qty,
-		CaseSize:        input.CaseSize,
-		UnknownSKU:      input.UnknownSKU,
-		Damaged:         input.Damaged,
-		DamagedQty:      damagedQty,
-		BatchNumber:     input.BatchNumber,
-		ExpiryDate:      input.ExpiryDate,
-		CartonBarcode:   input.CartonBarcode,
-		ItemBarcode:     input.ItemBarcode,
-		StockPhotoBlob:  input.StockPhotoBlob,
-		StockPhotoMIME:  input.StockPhotoMIME,
-		StockPhotoName:  input.StockPhotoName,
-		NoOuterBarcode:  input.NoOuterBarcode,
-		NoInnerBarcode:  input.NoInnerBarcode,
+		ProjectID:          projectID,
+		PalletID:           input.PalletID,
+		SKU:                sku,
+		Description:        description,
+		UOM:                uom,
+		Comment:            input.Comment,
+		ScannedByUserID:    userID,
+		Qty:                input.Qty,
+		CaseSize:           input.CaseSize,
+		UnknownSKU:         input.UnknownSKU,
+		Damaged:            input.Damaged,
+		DamagedQty:         damagedQty,
+		DamageReason:       damageReason,
+		BatchNumber:        input.BatchNumber,
+		ExpiryDate:         input.ExpiryDate,
+		CartonBarcode:      input.CartonBarcode,
+		ItemBarcode:        input.ItemBarcode,
+		StockPhotoBlob:     input.StockPhotoBlob,
+		StockPhotoMIME:     input.StockPhotoMIME,
+		StockPhotoName:     input.StockPhotoName,
+		NoOuterBarcode:     input.NoOuterBarcode,
+		NoInnerBarcode:     input.NoInnerBarcode,
+		BarcodeCheckFailed: input.BarcodeCheckFailed,
+		CountryOfOrigin:    input.CountryOfOrigin,
+		HSCode:             input.HSCode,
 	}
 	if _, err := tx.NewInsert().Model(&receipt).Exec(ctx); err != nil {
-		return err
+		return 0, err
 	}
 	if auditSvc != nil {
 		if err := auditSvc.Write(ctx, tx, userID, "receipt.create", "pallet_receipts", fmt.Sprintf("%d", receipt.ID), nil, receipt); err != nil {
-			return err
+			return 0, err
 		}
 	}
-	if err := insertReceiptPhotos(ctx, tx, receipt.ID, input.Photos); err != nil {
-		return err
+	if err := insertReceiptPhotos(ctx, tx, userID, receipt.ID, input); err != nil {
+		return 0, err
 	}
-	return nil
+	if err := customfield.SaveValues(ctx, tx, auditSvc, userID, projectID, receipt.ID, input.CustomValues, false); err != nil {
+		return 0, err
+	}
+	if input.UnknownSKU {
+		// Merges into an unknown line need no second notification.
+		if err := notification.Add(ctx, tx, notification.Notification{
+			Kind:      notification.KindUnknownSKU,
+			ProjectID: projectID,
+			PalletID:  input.PalletID,
+			SKU:       sku,
+			Title:     fmt.Sprintf("Unknown SKU %s received", sku),
+			Body:      fmt.Sprintf("Qty %d on pallet P%08d", input.Qty, input.PalletID),
+			Link:      notification.ReceiptLineLink(input.PalletID, receipt.ID),
+		}); err != nil {
+			return 0, err
+		}
+	}
+	return receipt.ID, nil
 }
 
 type ReceiptLineUpdateInput struct {
-	PalletID    int64
-	ReceiptID   int64
-	SKU         string
-	Description string
-	UOM         string
-	Comment     string
-	Qty         int64
-	CaseSize    int64
-	Damaged     bool
-	DamagedQty  int64
-	BatchNumber string
-	ExpiryDate  *time.Time
+	PalletID     int64
+	ReceiptID    int64
+	SKU          string
+	Description  string
+	UOM          string
+	Comment      string
+	Qty          int64
+	CaseSize     int64
+	Damaged      bool
+	DamagedQty   int64
+	DamageReason string
+	BatchNumber  string
+	ExpiryDate   *time.Time
+	// CountryOfOrigin and HSCode are only changed when the project captures them.
+	CountryOfOrigin string
+	HSCode          string
+	CustomValues    map[int64]string
 }
 
 func UpdateReceiptLine(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID int64, input ReceiptLineUpdateInput) error {
@@ -724,10 +1025,28 @@ func UpdateReceiptLine(ctx context.Context, db *sqlite.DB, auditSvc *audit.Servi
 	if input.CaseSize <= 0 {
 		return fmt.Errorf("case size must be greater than 0")
 	}
+	if input.DamagedQty < 0 {
+		return fmt.Errorf("damaged qty must be 0 or greater")
+	}
+	if input.DamagedQty > input.Qty {
+		return fmt.Errorf("damaged qty cannot exceed qty")
+	}
+	if input.DamagedQty > 0 {
+		input.Damaged = true
+	}
 	if input.Damaged {
-		input.DamagedQty = input.Qty
+		// Damaged with no quantity marks the whole line, as the edit form
+		// always did before it could split one.
+		if input.DamagedQty == 0 {
+			input.DamagedQty = input.Qty
+		}
+		input.DamageReason = damage.NormalizeCode(input.DamageReason)
+		if input.DamageReason == "" {
+			return damage.ErrReasonRequired
+		}
 	} else {
 		input.DamagedQty = 0
+		input.DamageReason = ""
 	}
 	if strings.TrimSpace(input.SKU) == "" {
 		return fmt.Errorf("sku is required")
@@ -750,6 +1069,9 @@ WHERE p.id = ?`, input.PalletID).Scan(ctx, &palletStatus, &projectID, &projectSt
 		if !CanManageReceiptLines(projectStatus, palletStatus) {
 			return fmt.Errorf("receipt lines are read-only unless project is active and pallet is open")
 		}
+		if err := phase.CheckPalletTx(ctx, tx, input.PalletID); err != nil {
+			return err
+		}
 
 		var existing models.PalletReceipt
 		if err := tx.NewSelect().
@@ -762,24 +1084,78 @@ WHERE p.id = ?`, input.PalletID).Scan(ctx, &palletStatus, &projectID, &projectSt
 			return err
 		}
 
+		// Lines keep their recorded reason even after an admin deactivates it.
+		if input.DamageReason != "" && input.DamageReason != existing.DamageReason {
+			if _, err := damage.ValidateActiveCode(ctx, tx, input.DamageReason); err != nil {
+				return err
+			}
+		}
+
+		settings, err := projectsettings.LoadTx(ctx, tx, projectID)
+		if err != nil {
+			return err
+		}
+		customsConfig := customs.LoadConfig(settings)
+		country, hsCode, err := customsConfig.Resolve(input.CountryOfOrigin, input.HSCode, existing.UnknownSKU)
+		if err != nil {
+			return err
+		}
+		// A field the project stopped capturing keeps its recorded value.
+		if !customsConfig.CaptureCountry() {
+			country = existing.CountryOfOrigin
+		}
+		if !customsConfig.CaptureHSCode() {
+			hsCode = existing.HSCode
+		}
+
 		if !existing.UnknownSKU {
-			if err := upsertStockItemCatalog(ctx, tx, projectID, input.SKU, input.Description, input.UOM); err != nil {
+			if err := receipts.UpsertCatalog(ctx, tx, projectID, input.SKU, input.Description, input.UOM); err != nil {
 				return err
 			}
 		}
 
+		// A partial damaged qty splits the line as a new scan would. The
+		// edited line keeps the part matching its current damage state and
+		// the rest is saved like a scan of it, merging into a matching line.
+		segments := receipts.Split(input.Qty, input.DamagedQty)
+		kept, split := segments[0], receipts.Segment{}
+		if len(segments) == 2 {
+			var serialTracked bool
+			if err := tx.NewRaw(`
+SELECT EXISTS (SELECT 1 FROM receipt_serials WHERE pallet_receipt_id = ?)
+    OR EXISTS (SELECT 1 FROM stock_items WHERE project_id = ? AND sku IN (?, ?) AND serial_tracked = 1)`,
+				existing.ID, projectID, existing.SKU, input.SKU).Scan(ctx, &serialTracked); err != nil {
+				return err
+			}
+			if serialTracked {
+				return ErrSerialSplit
+			}
+			if existing.Damaged {
+				kept, split = segments[1], segments[0]
+			} else {
+				split = segments[1]
+			}
+		}
+
 		before := existing
 		existing.SKU = input.SKU
 		existing.Description = input.Description
 		existing.UOM = input.UOM
 		existing.Comment = input.Comment
 		existing.ScannedByUserID = userID
-		existing.Qty = input.Qty
+		existing.Qty = kept.Qty
 		existing.CaseSize = input.CaseSize
-		existing.Damaged = input.Damaged || input.DamagedQty > 0
-		existing.DamagedQty = input.DamagedQty
+		existing.Damaged = kept.Damaged
+		existing.DamagedQty = 0
+		existing.DamageReason = ""
+		if kept.Damaged {
+			existing.DamagedQty = kept.Qty
+			existing.DamageReason = input.DamageReason
+		}
 		existing.BatchNumber = input.BatchNumber
 		existing.ExpiryDate = input.ExpiryDate
+		existing.CountryOfOrigin = country
+		existing.HSCode = hsCode
 		existing.UpdatedAt = time.Now()
 
 		if _, err := tx.NewUpdate().Model(&existing).WherePK().Exec(ctx); err != nil {
@@ -790,6 +1166,47 @@ WHERE p.id = ?`, input.PalletID).Scan(ctx, &palletStatus, &projectID, &projectSt
 				return err
 			}
 		}
+		if err := customfield.SaveValues(ctx, tx, auditSvc, userID, projectID, existing.ID, input.CustomValues, false); err != nil {
+			return err
+		}
+		if split.Qty == 0 {
+			return nil
+		}
+
+		splitInput := ReceiptInput{
+			PalletID:           input.PalletID,
+			Comment:            existing.Comment,
+			Qty:                split.Qty,
+			CaseSize:           existing.CaseSize,
+			UnknownSKU:         existing.UnknownSKU,
+			Damaged:            split.Damaged,
+			BatchNumber:        existing.BatchNumber,
+			ExpiryDate:         existing.ExpiryDate,
+			CartonBarcode:      existing.CartonBarcode,
+			ItemBarcode:        existing.ItemBarcode,
+			NoOuterBarcode:     existing.NoOuterBarcode,
+			NoInnerBarcode:     existing.NoInnerBarcode,
+			BarcodeCheckFailed: existing.BarcodeCheckFailed,
+			CountryOfOrigin:    existing.CountryOfOrigin,
+			HSCode:             existing.HSCode,
+			CustomValues:       input.CustomValues,
+		}
+		if split.Damaged {
+			splitInput.DamagedQty = split.Qty
+			splitInput.DamageReason = input.DamageReason
+		}
+		splitID, err := upsertReceiptLine(ctx, tx, auditSvc, settings, userID, projectID, existing.SKU, existing.Description, existing.UOM, splitInput)
+		if err != nil {
+			return err
+		}
+		if auditSvc != nil {
+			return auditSvc.Write(ctx, tx, userID, "receipt.split_damaged", "pallet_receipts", fmt.Sprintf("%d", existing.ID), nil, map[string]any{
+				"receipt_id":       existing.ID,
+				"split_receipt_id": splitID,
+				"qty":              input.Qty,
+				"damaged_qty":      input.DamagedQty,
+			})
+		}
 		return nil
 	})
 }
@@ -815,6 +1232,9 @@ WHERE p.id = ?`, palletID).Scan(ctx, &palletStatus, &projectID, &projectStatus);
 		if !CanManageReceiptLines(projectStatus, palletStatus) {
 			return fmt.Errorf("receipt lines are read-only unless project is active and pallet is open")
 		}
+		if err := phase.CheckPalletTx(ctx, tx, palletID); err != nil {
+			return err
+		}
 
 		var existing models.PalletReceipt
 		if err := tx.NewSelect().
@@ -827,7 +1247,7 @@ WHERE p.id = ?`, palletID).Scan(ctx, &palletStatus, &projectID, &projectStatus);
 			return err
 		}
 
-		if _, err := tx.NewDelete().Model(&existing).WherePK().Exec(ctx); err != nil {
+		if err := receipts.DeleteLine(ctx, tx, existing.ID); err != nil {
 			return err
 		}
 		if auditSvc != nil {
@@ -839,64 +1259,17 @@ WHERE p.id = ?`, palletID).Scan(ctx, &palletStatus, &projectID, &projectStatus);
 	})
 }
 
-func upsertStockItemCatalog(ctx context.Context, tx bun.Tx, projectID int64, sku, description, uom string) error {
-	sku = strings.TrimSpace(sku)
-	description = strings.TrimSpace(description)
-	uom = strings.TrimSpace(uom)
-	if sku == "" {
-		return nil
-	}
-
-	var stock models.StockItem
-	err := tx.NewSelect().
-		Model(&stock).
-		Where("project_id = ?", projectID).
-		Where("sku = ?", sku).
-		Limit(1).
-		Scan(ctx)
-	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			return err
-		}
-		stock = models.StockItem{
-			ProjectID:   projectID,
-			SKU:         sku,
-			Description: description,
-			UOM:         uom,
-		}
-		if _, err := tx.NewInsert().Model(&stock).Exec(ctx); err != nil {
-			return err
-		}
-		return nil
-	}
-
-	updates := make([]string, 0, 3)
-	if description != "" && stock.Description != description {
-		stock.Description = description
-		updates = append(updates, "description")
-	}
-	if uom != "" && stock.UOM != uom {
-		stock.UOM = uom
-		updates = append(updates, "uom")
-	}
-	if len(updates) > 0 {
-		stock.UpdatedAt = time.Now()
-		updates = append(updates, "updated_at")
-		if _, err := tx.NewUpdate().Model(&stock).Column(updates...).WherePK().Exec(ctx); err != nil {
+// insertReceiptPhotos stores the additional photos of input on a line and
+// records whether they and a newly saved primary photo are internal.
+func insertReceiptPhotos(ctx context.Context, tx bun.Tx, userID, receiptID int64, input ReceiptInput) error {
+	if len(input.StockPhotoBlob) > 0 {
+		// A merged line's primary photo is replaced, so its flag follows
+		// the new photo either way.
+		if err := photovisibility.MarkTx(ctx, tx, userID, receiptID, photovisibility.SourcePrimary, receiptID, input.PhotosInternal); err != nil {
 			return err
 		}
 	}
-
-	return nil
-}
-
-func promotePalletToOpenIfCreated(ctx context.Context, tx bun.Tx, projectID, palletID int64) error {
-	_, err := tx.NewRaw(`UPDATE pallets SET status = 'open', reopened_at = NULL WHERE id = ? AND project_id = ? AND status = 'created'`, palletID, projectID).Exec(ctx)
-	return err
-}
-
-func insertReceiptPhotos(ctx context.Context, tx bun.Tx, receiptID int64, photos []PhotoInput) error {
-	for _, p := range photos {
+	for _, p := range input.Photos {
 		photo := models.ReceiptPhoto{
 			PalletReceiptID: receiptID,
 			PhotoBlob:       p.Blob,
@@ -906,6 +1279,11 @@ func insertReceiptPhotos(ctx context.Context, tx bun.Tx, receiptID int64, photos
 		if _, err := tx.NewInsert().Model(&photo).Exec(ctx); err != nil {
 			return err
 		}
+		if input.PhotosInternal {
+			if err := photovisibility.MarkTx(ctx, tx, userID, receiptID, photovisibility.SourceGallery, photo.ID, true); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -922,6 +1300,9 @@ WHERE id = ? AND pallet_id = ?`, receiptID, palletID).Scan(ctx, &blob, &mimeValu
 	if err != nil {
 		return nil, "", "", err
 	}
+	if blob, err = coldstorage.Fill(ctx, db, coldstorage.SourcePrimary, receiptID, blob); err != nil {
+		return nil, "", "", err
+	}
 	if mimeValue.Valid {
 		mimeType = mimeValue.String
 	}
@@ -945,6 +1326,9 @@ WHERE rp.id = ? AND rp.pallet_receipt_id = ? AND pr.pallet_id = ?`, photoID, rec
 	if err != nil {
 		return nil, "", "", err
 	}
+	if blob, err = coldstorage.Fill(ctx, db, coldstorage.SourceGallery, photoID, blob); err != nil {
+		return nil, "", "", err
+	}
 	if mimeVal.Valid {
 		mimeType = mimeVal.String
 	}
@@ -962,3 +1346,38 @@ func LoadReceiptPhotoIDs(ctx context.Context, db *sqlite.DB, receiptID int64) ([
 	})
 	return ids, err
 }
+
+// LoadRedactPageData loads a receipt line's stored photos and the stubs of
+// photos already redacted from it.
+func LoadRedactPageData(ctx context.Context, db *sqlite.DB, palletID, receiptID int64) (RedactPageData, error) {
+	data := RedactPageData{PalletID: palletID, ReceiptID: receiptID}
+	var hasPrimary bool
+	photoIDs := make([]int64, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`
+SELECT p.name, pr.sku, pr.description, pr.stock_photo_blob IS NOT NULL
+FROM pallet_receipts pr
+JOIN projects p ON p.id = pr.project_id
+WHERE pr.id = ? AND pr.pallet_id = ?`, receiptID, palletID).Scan(ctx, &data.ProjectName, &data.SKU, &data.Description, &hasPrimary); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT id FROM receipt_photos WHERE pallet_receipt_id = ? ORDER BY id`, receiptID).Scan(ctx, &photoIDs)
+	})
+	if err != nil {
+		return data, err
+	}
+	base := fmt.Sprintf("/tasker/api/pallets/%d/receipts/%d", palletID, receiptID)
+	if hasPrimary {
+		data.Photos = append(data.Photos, RedactPhotoView{Source: photoretention.SourcePrimary, ID: receiptID, Label: "Primary", URL: base + "/photo"})
+	}
+	for i, id := range photoIDs {
+		data.Photos = append(data.Photos, RedactPhotoView{
+			Source: photoretention.SourceGallery,
+			ID:     id,
+			Label:  fmt.Sprintf("Photo %d", i+1),
+			URL:    fmt.Sprintf("%s/photos/%d", base, id),
+		})
+	}
+	data.Stubs, err = photoretention.ListStubs(ctx, db, receiptID, 50)
+	return data, err
+}
@@ -4,6 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/csv"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
@@ -16,10 +20,22 @@ import (
 
 	"github.com/uptrace/bun"
 
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/customfield"
+	"receipter/infrastructure/customs"
+	"receipter/infrastructure/damage"
+	"receipter/infrastructure/heic"
+	"receipter/infrastructure/pallets"
+	"receipter/infrastructure/perfbudget"
+	"receipter/infrastructure/photocapture"
+	"receipter/infrastructure/photoquota"
+	"receipter/infrastructure/photoupload"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/serials"
 	"receipter/infrastructure/sqlite"
 )
 
-func openTestDB(t *testing.T) *sqlite.DB {
+func openTestDB(t testing.TB) *sqlite.DB {
 	t.Helper()
 	dbPath := filepath.Join(t.TempDir(), "receipt-test.db")
 	db, err := sqlite.OpenDB(dbPath)
@@ -51,12 +67,12 @@ VALUES (1, 'Receipt Test', 'Receipt test project', DATE('now'), 'Test Client', '
 	return db
 }
 
-func seedPallet(t *testing.T, db *sqlite.DB, palletID int64) {
+func seedPallet(t testing.TB, db *sqlite.DB, palletID int64) {
 	t.Helper()
 	seedPalletWithStatus(t, db, palletID, "open")
 }
 
-func seedPalletWithStatus(t *testing.T, db *sqlite.DB, palletID int64, status string) {
+func seedPalletWithStatus(t testing.TB, db *sqlite.DB, palletID int64, status string) {
 	t.Helper()
 	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
 		if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO users (id, username, password_hash, role, created_at, updated_at) VALUES (1, 'scanner-test', 'hash', 'scanner', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`); err != nil {
@@ -237,14 +253,15 @@ func TestSaveReceipt_SplitsDamagedAndNonDamagedLines(t *testing.T) {
 
 	expiry, _ := time.Parse("2006-01-02", "2027-08-15")
 	in := ReceiptInput{
-		PalletID:    44,
-		SKU:         "SPLIT-1",
-		Description: "Split damaged",
-		Qty:         3,
-		Damaged:     true,
-		DamagedQty:  2,
-		BatchNumber: "S1",
-		ExpiryDate:  &expiry,
+		PalletID:     44,
+		SKU:          "SPLIT-1",
+		Description:  "Split damaged",
+		Qty:          3,
+		Damaged:      true,
+		DamagedQty:   2,
+		DamageReason: "crushed",
+		BatchNumber:  "S1",
+		ExpiryDate:   &expiry,
 	}
 	if err := SaveReceipt(context.Background(), db, nil, 1, in); err != nil {
 		t.Fatalf("save split receipt: %v", err)
@@ -281,6 +298,173 @@ WHERE pr.pallet_id = ? AND pr.sku = ? AND pr.damaged = 1`, 44, "SPLIT-1").Scan(c
 	}
 }
 
+func TestUpdateReceiptLine_PartialDamagedQtySplitsLine(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 45)
+	ctx := context.Background()
+
+	if err := SaveReceipt(ctx, db, nil, 1, ReceiptInput{PalletID: 45, SKU: "EDIT-SPLIT", Description: "Edit split", Qty: 5}); err != nil {
+		t.Fatalf("save receipt: %v", err)
+	}
+	var goodID int64
+	if err := db.R.NewRaw(`SELECT id FROM pallet_receipts WHERE pallet_id = ?`, 45).Scan(ctx, &goodID); err != nil {
+		t.Fatalf("load line id: %v", err)
+	}
+
+	update := ReceiptLineUpdateInput{PalletID: 45, ReceiptID: goodID, SKU: "EDIT-SPLIT", Description: "Edit split", Qty: 5, CaseSize: 1, Damaged: true, DamagedQty: 6, DamageReason: "crushed"}
+	if err := UpdateReceiptLine(ctx, db, nil, 1, update); err == nil || err.Error() != "damaged qty cannot exceed qty" {
+		t.Fatalf("expected damaged qty above qty to be refused, got %v", err)
+	}
+	update.DamagedQty = 2
+	if err := UpdateReceiptLine(ctx, db, nil, 1, update); err != nil {
+		t.Fatalf("update with partial damage: %v", err)
+	}
+
+	type line struct {
+		ID           int64  `bun:"id"`
+		Qty          int64  `bun:"qty"`
+		Damaged      bool   `bun:"damaged"`
+		DamagedQty   int64  `bun:"damaged_qty"`
+		DamageReason string `bun:"damage_reason"`
+	}
+	loadLines := func() []line {
+		var lines []line
+		if err := db.R.NewRaw(`SELECT id, qty, damaged, damaged_qty, damage_reason FROM pallet_receipts WHERE pallet_id = ? ORDER BY id`, 45).Scan(ctx, &lines); err != nil {
+			t.Fatalf("load lines: %v", err)
+		}
+		return lines
+	}
+	lines := loadLines()
+	if len(lines) != 2 {
+		t.Fatalf("expected the line to be split in two, got %+v", lines)
+	}
+	if lines[0].ID != goodID || lines[0].Qty != 3 || lines[0].Damaged || lines[0].DamagedQty != 0 {
+		t.Fatalf("expected the edited line to keep the good 3, got %+v", lines[0])
+	}
+	if lines[1].Qty != 2 || !lines[1].Damaged || lines[1].DamagedQty != 2 || lines[1].DamageReason != "crushed" {
+		t.Fatalf("expected a damaged line of 2, got %+v", lines[1])
+	}
+
+	// Editing the damaged line down merges the undamaged part back.
+	if err := UpdateReceiptLine(ctx, db, nil, 1, ReceiptLineUpdateInput{PalletID: 45, ReceiptID: lines[1].ID, SKU: "EDIT-SPLIT", Description: "Edit split", Qty: 2, CaseSize: 1, DamagedQty: 1, DamageReason: "crushed"}); err != nil {
+		t.Fatalf("update damaged line: %v", err)
+	}
+	lines = loadLines()
+	if len(lines) != 2 || lines[0].Qty != 4 || lines[0].Damaged || lines[1].Qty != 1 || lines[1].DamagedQty != 1 {
+		t.Fatalf("expected good 4 and damaged 1, got %+v", lines)
+	}
+	if rows, qty := countReceiptRows(t, db, 45); rows != 2 || qty != 5 {
+		t.Fatalf("expected the total to stay 5 over 2 lines, got %d over %d", qty, rows)
+	}
+}
+
+func TestUpdateReceiptLine_RefusesPartialDamageOnSerialLines(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 46)
+	ctx := context.Background()
+
+	if err := SaveReceipt(ctx, db, nil, 1, ReceiptInput{PalletID: 46, SKU: "SER-1", Description: "Serial", Qty: 2}); err != nil {
+		t.Fatalf("save receipt: %v", err)
+	}
+	var receiptID, projectID int64
+	if err := db.R.NewRaw(`SELECT id, project_id FROM pallet_receipts WHERE pallet_id = ?`, 46).Scan(ctx, &receiptID, &projectID); err != nil {
+		t.Fatalf("load line: %v", err)
+	}
+	if err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return serials.Add(ctx, tx, projectID, receiptID, 1, []string{"SN-1", "SN-2"})
+	}); err != nil {
+		t.Fatalf("seed serials: %v", err)
+	}
+
+	update := ReceiptLineUpdateInput{PalletID: 46, ReceiptID: receiptID, SKU: "SER-1", Description: "Serial", Qty: 2, CaseSize: 1, Damaged: true, DamagedQty: 1, DamageReason: "crushed"}
+	if err := UpdateReceiptLine(ctx, db, nil, 1, update); !errors.Is(err, ErrSerialSplit) {
+		t.Fatalf("expected partial damage on a serial line to be refused, got %v", err)
+	}
+	if rows, qty := countReceiptRows(t, db, 46); rows != 1 || qty != 2 {
+		t.Fatalf("expected the line left whole, got %d over %d", qty, rows)
+	}
+
+	// Damaging the whole line keeps its serials together and is allowed.
+	update.DamagedQty = 2
+	if err := UpdateReceiptLine(ctx, db, nil, 1, update); err != nil {
+		t.Fatalf("update with whole line damaged: %v", err)
+	}
+}
+
+func TestSaveReceipt_DamagedRequiresActiveReason(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 46)
+
+	in := ReceiptInput{
+		PalletID:   46,
+		SKU:        "DMG-REASON-1",
+		Qty:        2,
+		Damaged:    true,
+		DamagedQty: 1,
+	}
+	if err := SaveReceipt(context.Background(), db, nil, 1, in); !errors.Is(err, damage.ErrReasonRequired) {
+		t.Fatalf("expected reason required error, got %v", err)
+	}
+
+	in.DamageReason = "not-a-reason"
+	if err := SaveReceipt(context.Background(), db, nil, 1, in); !errors.Is(err, damage.ErrUnknownReason) {
+		t.Fatalf("expected unknown reason error, got %v", err)
+	}
+
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE damage_reasons SET active = 0 WHERE code = 'wet'`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("deactivate reason: %v", err)
+	}
+	in.DamageReason = "wet"
+	if err := SaveReceipt(context.Background(), db, nil, 1, in); !errors.Is(err, damage.ErrUnknownReason) {
+		t.Fatalf("expected inactive reason to be rejected, got %v", err)
+	}
+
+	if rows, _ := countReceiptRows(t, db, 46); rows != 0 {
+		t.Fatalf("expected no rows saved, got %d", rows)
+	}
+}
+
+func TestSaveReceipt_DifferentDamageReasonsDoNotMerge(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 47)
+
+	for _, reason := range []string{"crushed", "Wet", "crushed"} {
+		in := ReceiptInput{
+			PalletID:     47,
+			SKU:          "DMG-REASON-2",
+			Qty:          1,
+			Damaged:      true,
+			DamagedQty:   1,
+			DamageReason: reason,
+		}
+		if err := SaveReceipt(context.Background(), db, nil, 1, in); err != nil {
+			t.Fatalf("save %s receipt: %v", reason, err)
+		}
+	}
+
+	data, err := LoadPageData(context.Background(), db, 47)
+	if err != nil {
+		t.Fatalf("load page data: %v", err)
+	}
+	byReason := map[string]ReceiptLineView{}
+	for _, line := range data.Lines {
+		byReason[line.DamageReason] = line
+	}
+	if len(data.Lines) != 2 {
+		t.Fatalf("expected 2 lines split by reason, got %d", len(data.Lines))
+	}
+	if byReason["crushed"].Qty != 2 || byReason["crushed"].DamageReasonLabel != "Crushed" {
+		t.Fatalf("unexpected crushed line: %+v", byReason["crushed"])
+	}
+	if byReason["wet"].Qty != 1 || byReason["wet"].DamageReasonLabel != "Wet" {
+		t.Fatalf("unexpected wet line: %+v", byReason["wet"])
+	}
+}
+
 func TestSaveReceipt_SplitDamagedAttachesMediaToDamagedLine(t *testing.T) {
 	db := openTestDB(t)
 	seedPallet(t, db, 45)
@@ -293,6 +477,7 @@ func TestSaveReceipt_SplitDamagedAttachesMediaToDamagedLine(t *testing.T) {
 		Qty:            3,
 		Damaged:        true,
 		DamagedQty:     2,
+		DamageReason:   "wet",
 		BatchNumber:    "SP1",
 		ExpiryDate:     &expiry,
 		StockPhotoBlob: []byte{0xFF, 0xD8, 0xFF, 0xD9},
@@ -348,6 +533,40 @@ WHERE pr.pallet_id = ? AND pr.sku = ? AND pr.damaged = 1`, 45, "SPLIT-PHOTO-1").
 	}
 }
 
+func TestSaveReceipt_RefusesPhotosOverProjectMaxDimension(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 46)
+	if _, err := db.W.ExecContext(context.Background(), `INSERT INTO project_settings (project_id, key, value) VALUES (1, 'photos.max_dimension', '32')`); err != nil {
+		t.Fatalf("seed setting: %v", err)
+	}
+	photo := func(width, height int) []byte {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+			t.Fatalf("encode png: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	in := ReceiptInput{
+		PalletID:    46,
+		SKU:         "PHOTO-SIZE-1",
+		Description: "Photo size",
+		Qty:         1,
+		Photos:      []PhotoInput{{Blob: photo(64, 48), MIMEType: "image/png", FileName: "big.png"}},
+	}
+	if err := SaveReceipt(context.Background(), db, nil, 1, in); !errors.Is(err, photocapture.ErrTooLarge) {
+		t.Fatalf("expected oversized photo refused, got %v", err)
+	}
+	if rows, _ := countReceiptRows(t, db, 46); rows != 0 {
+		t.Fatalf("expected no line saved with a refused photo, got %d", rows)
+	}
+
+	in.Photos = []PhotoInput{{Blob: photo(32, 24), MIMEType: "image/png", FileName: "small.png"}}
+	if err := SaveReceipt(context.Background(), db, nil, 1, in); err != nil {
+		t.Fatalf("save photo within the limit: %v", err)
+	}
+}
+
 func TestSaveReceipt_PromotesCreatedPalletToOpenOnFirstLine(t *testing.T) {
 	db := openTestDB(t)
 	seedPalletWithStatus(t, db, 6, "created")
@@ -532,6 +751,144 @@ func TestSaveReceipt_UnknownSKURequiresPhoto(t *testing.T) {
 	}
 }
 
+func TestSaveReceiptWithUploads_DeferredPhotosMarkLinePending(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 56)
+
+	in := ReceiptInput{
+		PalletID:    56,
+		UnknownSKU:  true,
+		Qty:         2,
+		CaseSize:    1,
+		BatchNumber: "U2",
+		DeferredPhotos: []photoupload.Pending{
+			{FileName: "front.jpg", MIMEType: "image/jpeg", Size: 2048},
+			{FileName: "back.jpg", MIMEType: "image/jpeg", Size: 4096},
+		},
+	}
+	saved, err := SaveReceiptWithUploads(context.Background(), db, nil, 1, in)
+	if err != nil {
+		t.Fatalf("save receipt with deferred photos: %v", err)
+	}
+	if saved.ReceiptID <= 0 || len(saved.Uploads) != 2 {
+		t.Fatalf("expected receipt id and 2 uploads, got %+v", saved)
+	}
+	for _, upload := range saved.Uploads {
+		if upload.PalletReceiptID != saved.ReceiptID || upload.Status != photoupload.StatusUploading {
+			t.Fatalf("unexpected reserved upload: %+v", upload)
+		}
+	}
+
+	data, err := LoadPageData(context.Background(), db, 56)
+	if err != nil {
+		t.Fatalf("load page data: %v", err)
+	}
+	if len(data.Lines) != 1 || data.Lines[0].PhotosPending != 2 || data.Lines[0].PhotosFailed != 0 {
+		t.Fatalf("expected one line with 2 photos pending, got %+v", data.Lines)
+	}
+}
+
+func TestSaveReceiptWithUploads_RefusesPhotosPastProjectQuota(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 57)
+	if _, err := db.W.ExecContext(context.Background(), `INSERT INTO project_settings (project_id, key, value) VALUES (1, 'photos.max_per_line', '2'), (1, 'photos.quota_mb', '1')`); err != nil {
+		t.Fatalf("seed settings: %v", err)
+	}
+	pending := func(sizes ...int64) []photoupload.Pending {
+		photos := make([]photoupload.Pending, 0, len(sizes))
+		for _, size := range sizes {
+			photos = append(photos, photoupload.Pending{FileName: "photo.jpg", MIMEType: "image/jpeg", Size: size})
+		}
+		return photos
+	}
+	in := ReceiptInput{PalletID: 57, SKU: "QUOTA-1", Qty: 1, CaseSize: 1}
+
+	in.DeferredPhotos = pending(1024, 1024, 1024)
+	if _, err := SaveReceiptWithUploads(context.Background(), db, nil, 1, in); !errors.Is(err, photoquota.ErrExceeded) {
+		t.Fatalf("expected a third photo on the line refused, got %v", err)
+	}
+	in.DeferredPhotos = pending(850 << 10)
+	if _, err := SaveReceiptWithUploads(context.Background(), db, nil, 1, in); err != nil {
+		t.Fatalf("save within quota: %v", err)
+	}
+	var alerts int64
+	if err := db.R.NewRaw(`SELECT COUNT(*) FROM notifications WHERE kind = 'photo_quota' AND project_id = 1`).Scan(context.Background(), &alerts); err != nil {
+		t.Fatalf("count alerts: %v", err)
+	}
+	if alerts != 1 {
+		t.Fatalf("expected admins notified past 80%% of the quota, got %d", alerts)
+	}
+
+	in.DeferredPhotos = pending(300 << 10)
+	if _, err := SaveReceiptWithUploads(context.Background(), db, nil, 1, in); !errors.Is(err, photoquota.ErrExceeded) {
+		t.Fatalf("expected a photo past the storage quota refused, got %v", err)
+	}
+	in.DeferredPhotos = nil
+	if _, err := SaveReceiptWithUploads(context.Background(), db, nil, 1, in); err != nil {
+		t.Fatalf("expected a line without photos saved over quota, got %v", err)
+	}
+	if rows, qty := countReceiptRows(t, db, 57); rows != 1 || qty != 2 {
+		t.Fatalf("expected only the accepted saves merged, got rows=%d qty=%d", rows, qty)
+	}
+}
+
+func TestDeleteReceiptLine_RemovesPhotosAndStagedUploads(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 57)
+	ctx := context.Background()
+
+	in := ReceiptInput{
+		PalletID:    57,
+		UnknownSKU:  true,
+		Qty:         1,
+		CaseSize:    1,
+		BatchNumber: "D1",
+		Photos: []PhotoInput{
+			{Blob: []byte{0xFF, 0xD8, 0xFF, 0xD9}, MIMEType: "image/jpeg", FileName: "line.jpg"},
+		},
+		DeferredPhotos: []photoupload.Pending{
+			{FileName: "later.jpg", MIMEType: "image/jpeg", Size: 4},
+		},
+	}
+	saved, err := SaveReceiptWithUploads(ctx, db, nil, 1, in)
+	if err != nil {
+		t.Fatalf("save receipt: %v", err)
+	}
+	if _, err := db.W.ExecContext(ctx, `INSERT INTO photo_upload_chunks (upload_id, offset_bytes, data) VALUES (?, 0, x'FFD8')`, saved.Uploads[0].ID); err != nil {
+		t.Fatalf("stage chunk: %v", err)
+	}
+
+	// Cascades only fire with foreign keys on; the delete must not rely on
+	// them. The write pool has a single connection, so the pragma applies.
+	if _, err := db.W.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+		t.Fatalf("disable foreign keys: %v", err)
+	}
+	err = DeleteReceiptLine(ctx, db, nil, 1, 57, saved.ReceiptID)
+	if _, pragmaErr := db.W.ExecContext(ctx, `PRAGMA foreign_keys = ON`); pragmaErr != nil {
+		t.Fatalf("enable foreign keys: %v", pragmaErr)
+	}
+	if err != nil {
+		t.Fatalf("delete receipt line: %v", err)
+	}
+
+	var photos, uploads, chunks int
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM receipt_photos WHERE pallet_receipt_id = ?`, saved.ReceiptID).Scan(ctx, &photos); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM photo_uploads WHERE pallet_receipt_id = ?`, saved.ReceiptID).Scan(ctx, &uploads); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT COUNT(1) FROM photo_upload_chunks`).Scan(ctx, &chunks)
+	})
+	if err != nil {
+		t.Fatalf("count photo rows: %v", err)
+	}
+	if photos != 0 || uploads != 0 || chunks != 0 {
+		t.Fatalf("expected no photo data left, got photos=%d uploads=%d chunks=%d", photos, uploads, chunks)
+	}
+}
+
 func TestSaveReceipt_UnknownSKUPersistsFlagAndDefaults(t *testing.T) {
 	db := openTestDB(t)
 	seedPallet(t, db, 56)
@@ -691,6 +1048,74 @@ func TestSaveReceipt_PersistsAndUpdatesComment(t *testing.T) {
 	}
 }
 
+func TestSaveReceipt_ValidatesAndStoresCustomFieldValues(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 59)
+	ctx := context.Background()
+
+	origin, err := customfield.Create(ctx, db, nil, 0, 1, "", "Country of origin", customfield.TypeText, true, 10)
+	if err != nil {
+		t.Fatalf("create origin field: %v", err)
+	}
+	poLine, err := customfield.Create(ctx, db, nil, 0, 1, "", "PO line", customfield.TypeNumber, false, 20)
+	if err != nil {
+		t.Fatalf("create po line field: %v", err)
+	}
+
+	in := ReceiptInput{PalletID: 59, SKU: "CF-1", Description: "Custom", Qty: 1, CaseSize: 1}
+	if err := SaveReceipt(ctx, db, nil, 1, in); !errors.Is(err, customfield.ErrInvalidValue) {
+		t.Fatalf("expected required custom field error, got %v", err)
+	}
+	in.CustomValues = map[int64]string{origin.ID: "Viet Nam", poLine.ID: "ten"}
+	if err := SaveReceipt(ctx, db, nil, 1, in); !errors.Is(err, customfield.ErrInvalidValue) {
+		t.Fatalf("expected invalid number error, got %v", err)
+	}
+	in.CustomValues = map[int64]string{origin.ID: " Viet Nam ", poLine.ID: "10"}
+	if err := SaveReceipt(ctx, db, nil, 1, in); err != nil {
+		t.Fatalf("save receipt: %v", err)
+	}
+
+	// A repeat scan that leaves the optional field blank keeps the first value.
+	in.CustomValues = map[int64]string{origin.ID: "Thailand"}
+	if err := SaveReceipt(ctx, db, nil, 1, in); err != nil {
+		t.Fatalf("save repeat receipt: %v", err)
+	}
+
+	data, err := LoadPageData(ctx, db, 59)
+	if err != nil {
+		t.Fatalf("load page data: %v", err)
+	}
+	if len(data.CustomFields) != 2 || !data.CustomFields[0].Required {
+		t.Fatalf("expected form custom fields, got %+v", data.CustomFields)
+	}
+	if len(data.Lines) != 1 {
+		t.Fatalf("expected merged single line, got %d", len(data.Lines))
+	}
+	values := data.Lines[0].CustomValues
+	if len(values) != 2 || values[0].Value != "Thailand" || values[1].Value != "10" {
+		t.Fatalf("unexpected custom values: %+v", values)
+	}
+
+	update := ReceiptLineUpdateInput{
+		PalletID:     59,
+		ReceiptID:    data.Lines[0].ID,
+		SKU:          "CF-1",
+		Qty:          2,
+		CaseSize:     1,
+		CustomValues: map[int64]string{origin.ID: "Thailand"},
+	}
+	if err := UpdateReceiptLine(ctx, db, nil, 1, update); err != nil {
+		t.Fatalf("update receipt line: %v", err)
+	}
+	data, err = LoadPageData(ctx, db, 59)
+	if err != nil {
+		t.Fatalf("reload page data: %v", err)
+	}
+	if values := data.Lines[0].CustomValues; len(values) != 1 || values[0].Key != "country_of_origin" {
+		t.Fatalf("expected editing to clear the blank field, got %+v", values)
+	}
+}
+
 func TestWriteItemUploadCSVForPallet_SetsBatchFlagFromBatchAndExpiry(t *testing.T) {
 	db := openTestDB(t)
 	seedPalletWithStatus(t, db, 59, "labelled")
@@ -1251,6 +1676,55 @@ func TestParseOptionalPhotoAcceptsImage(t *testing.T) {
 	}
 }
 
+func TestParseOptionalPhotosConvertsMislabelledHEIC(t *testing.T) {
+	orig := heic.Convert
+	t.Cleanup(func() { heic.Convert = orig })
+	jpeg := []byte("\xff\xd8\xff\xe0 converted")
+	heic.Convert = func(ctx context.Context, data []byte) ([]byte, error) { return jpeg, nil }
+
+	// Safari labels iPhone HEIC photos as image/jpeg.
+	data := []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic....")
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", `form-data; name="stock_photos"; filename="IMG_0042.HEIC"`)
+	header.Set("Content-Type", "image/jpeg")
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		t.Fatalf("create multipart part: %v", err)
+	}
+	if _, err := part.Write(data); err != nil {
+		t.Fatalf("write multipart data: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close multipart writer: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/tasker/api/pallets/1/receipts", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if err := parseReceiptForm(req); err != nil {
+		t.Fatalf("parse form: %v", err)
+	}
+
+	photos, err := parseOptionalPhotos(req)
+	if err != nil {
+		t.Fatalf("expected HEIC accepted, got error: %v", err)
+	}
+	if len(photos) != 1 || !bytes.Equal(photos[0].Blob, jpeg) || photos[0].MIMEType != "image/jpeg" || photos[0].FileName != "IMG_0042.jpg" {
+		t.Fatalf("expected HEIC converted to JPEG, got %+v", photos)
+	}
+
+	// Without a converter the photo is kept under its real type.
+	heic.Convert = func(ctx context.Context, data []byte) ([]byte, error) { return nil, heic.ErrNoConverter }
+	req = newMultipartPhotoRequest(t, "application/octet-stream", data, "IMG_0042.HEIC")
+	blob, mimeType, fileName, err := parseOptionalPhoto(req)
+	if err != nil {
+		t.Fatalf("expected HEIC accepted, got error: %v", err)
+	}
+	if !bytes.Equal(blob, data) || mimeType != heic.MIMEHEIC || fileName != "IMG_0042.HEIC" {
+		t.Fatalf("expected HEIC kept as image/heic, got mime=%q name=%q", mimeType, fileName)
+	}
+}
+
 func newMultipartPhotoRequest(t *testing.T, contentType string, data []byte, filename string) *http.Request {
 	t.Helper()
 	var body bytes.Buffer
@@ -1275,3 +1749,296 @@ func newMultipartPhotoRequest(t *testing.T, contentType string, data []byte, fil
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 	return req
 }
+
+func TestSearchStock_MatchesBarcodeAlias(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 1)
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO stock_items (project_id, sku, description, uom) VALUES (1, 'SKU-ALIAS', 'Aliased item', 'EA')`); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO stock_item_barcodes (project_id, barcode, sku, created_by_user_id) VALUES (1, '5099999999999', 'SKU-ALIAS', 1)`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed alias: %v", err)
+	}
+
+	items, err := SearchStock(context.Background(), db, 1, "5099999999999")
+	if err != nil {
+		t.Fatalf("search stock: %v", err)
+	}
+	if len(items) != 1 || items[0].SKU != "SKU-ALIAS" {
+		t.Fatalf("expected alias barcode to find SKU-ALIAS, got %+v", items)
+	}
+}
+
+func TestSearchBatches_ReturnsRecentBatchesForSKU(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 1)
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, batch_number, expiry_date) VALUES
+ (1, 1, 1, 'ABC', 'Alpha', 1, 1, 'LOT-2024-001', '2027-01-31'),
+ (2, 1, 1, 'ABC', 'Alpha', 1, 1, 'LOT-2024-002', NULL),
+ (3, 1, 1, 'abc', 'Alpha', 1, 1, 'LOT-2024-001', '2027-03-31'),
+ (4, 1, 1, 'ABC', 'Alpha', 1, 1, '', '2027-03-31'),
+ (5, 1, 1, 'XYZ', 'Other', 1, 1, 'LOT-9', '2027-03-31')`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed receipts: %v", err)
+	}
+
+	batches, err := SearchBatches(context.Background(), db, 1, "ABC", "")
+	if err != nil {
+		t.Fatalf("search batches: %v", err)
+	}
+	if len(batches) != 2 {
+		t.Fatalf("expected 2 batches for ABC, got %+v", batches)
+	}
+	if batches[0].BatchNumber != "LOT-2024-001" || batches[0].ExpiryDate != "2027-03-31" {
+		t.Fatalf("expected latest batch with its latest expiry first, got %+v", batches[0])
+	}
+	if batches[1].BatchNumber != "LOT-2024-002" || batches[1].ExpiryDate != "" {
+		t.Fatalf("expected batch without expiry second, got %+v", batches[1])
+	}
+
+	batches, err = SearchBatches(context.Background(), db, 1, "ABC", "002")
+	if err != nil {
+		t.Fatalf("search batches by text: %v", err)
+	}
+	if len(batches) != 1 || batches[0].BatchNumber != "LOT-2024-002" {
+		t.Fatalf("expected typed text to narrow batches, got %+v", batches)
+	}
+
+	batches, err = SearchBatches(context.Background(), db, 1, "", "LOT")
+	if err != nil || len(batches) != 0 {
+		t.Fatalf("expected no batches without a sku, got %+v, %v", batches, err)
+	}
+}
+
+func TestSaveReceipt_AppliesProjectSettings(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 1)
+	ctx := context.Background()
+
+	err := projectsettings.SaveProject(ctx, db, audit.NewService(), 1, 1, map[string]string{
+		projectsettings.ReceiptMergeMode:    projectsettings.MergeModeSeparate,
+		projectsettings.ReceiptRequireBatch: "true",
+		projectsettings.PalletMaxLines:      "2",
+	})
+	if err != nil {
+		t.Fatalf("save settings: %v", err)
+	}
+
+	in := ReceiptInput{PalletID: 1, SKU: "ABC", Description: "Alpha", Qty: 2}
+	if err := SaveReceipt(ctx, db, nil, 1, in); !errors.Is(err, projectsettings.ErrRule) {
+		t.Fatalf("expected missing batch rejected, got %v", err)
+	}
+
+	in.BatchNumber = "B1"
+	for i := 0; i < 2; i++ {
+		if err := SaveReceipt(ctx, db, nil, 1, in); err != nil {
+			t.Fatalf("save receipt %d: %v", i+1, err)
+		}
+	}
+	if rows, qty := countReceiptRows(t, db, 1); rows != 2 || qty != 4 {
+		t.Fatalf("expected separate lines in separate mode, got rows=%d qty=%d", rows, qty)
+	}
+
+	if err := SaveReceipt(ctx, db, nil, 1, in); !errors.Is(err, projectsettings.ErrRule) || !strings.Contains(err.Error(), "2 lines per pallet") {
+		t.Fatalf("expected full pallet rejected, got %v", err)
+	}
+}
+
+func TestSaveReceipt_CapturesCustomsData(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 1)
+	ctx := context.Background()
+
+	err := projectsettings.SaveProject(ctx, db, audit.NewService(), 1, 1, map[string]string{
+		projectsettings.CustomsCountryOfOrigin: projectsettings.CustomsRequired,
+		projectsettings.CustomsHSCode:          projectsettings.CustomsOptional,
+	})
+	if err != nil {
+		t.Fatalf("save settings: %v", err)
+	}
+
+	in := ReceiptInput{PalletID: 1, SKU: "ABC", Description: "Alpha", Qty: 2}
+	if err := SaveReceipt(ctx, db, nil, 1, in); !errors.Is(err, projectsettings.ErrRule) {
+		t.Fatalf("expected missing country of origin rejected, got %v", err)
+	}
+	in.CountryOfOrigin = "XX"
+	if err := SaveReceipt(ctx, db, nil, 1, in); !errors.Is(err, customs.ErrInvalid) {
+		t.Fatalf("expected unknown country rejected, got %v", err)
+	}
+	in.CountryOfOrigin = "china"
+	in.HSCode = "3923.10"
+	if err := SaveReceipt(ctx, db, nil, 1, in); err != nil {
+		t.Fatalf("save receipt: %v", err)
+	}
+	// The same SKU from another origin is declared separately, so it must
+	// not merge into the first line.
+	in.CountryOfOrigin = "VN"
+	if err := SaveReceipt(ctx, db, nil, 1, in); err != nil {
+		t.Fatalf("save second receipt: %v", err)
+	}
+
+	type line struct {
+		Country string `bun:"country_of_origin"`
+		HSCode  string `bun:"hs_code"`
+		Qty     int64  `bun:"qty"`
+	}
+	lines := make([]line, 0)
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT country_of_origin, hs_code, qty FROM pallet_receipts WHERE pallet_id = 1 ORDER BY id`).Scan(ctx, &lines)
+	})
+	if err != nil {
+		t.Fatalf("load lines: %v", err)
+	}
+	if len(lines) != 2 || lines[0] != (line{"CN", "392310", 2}) || lines[1] != (line{"VN", "392310", 2}) {
+		t.Fatalf("unexpected lines %+v", lines)
+	}
+}
+
+func TestLoadReceiptStats_CountsPalletAndMyRecentCaptures(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 1)
+	seedPallet(t, db, 2)
+	ctx := context.Background()
+	auditSvc := audit.NewService()
+
+	stats, err := LoadReceiptStats(ctx, db, 1, 1, time.Now().UTC())
+	if err != nil {
+		t.Fatalf("load empty stats: %v", err)
+	}
+	if stats.Lines != 0 || stats.SinceLastCapture() != "-" {
+		t.Fatalf("empty stats = %+v", stats)
+	}
+
+	// A merge counts only the units it added; lines on other pallets still
+	// count towards the scanner's hourly units.
+	for _, in := range []ReceiptInput{
+		{PalletID: 1, SKU: "SKU-A", Description: "A", Qty: 4},
+		{PalletID: 1, SKU: "SKU-A", Description: "A", Qty: 3},
+		{PalletID: 1, SKU: "SKU-B", Description: "B", Qty: 2},
+		{PalletID: 2, SKU: "SKU-C", Description: "C", Qty: 5},
+	} {
+		if err := SaveReceipt(ctx, db, auditSvc, 1, in); err != nil {
+			t.Fatalf("save receipt: %v", err)
+		}
+	}
+	if _, err := db.W.ExecContext(ctx, `UPDATE audit_logs SET created_at = datetime('now', '-2 hours') WHERE id = (SELECT MIN(id) FROM audit_logs)`); err != nil {
+		t.Fatalf("age first capture: %v", err)
+	}
+
+	stats, err = LoadReceiptStats(ctx, db, 1, 1, time.Now().UTC())
+	if err != nil {
+		t.Fatalf("load stats: %v", err)
+	}
+	if stats.Lines != 2 || stats.Units != 9 || stats.MyUnitsLastHour != 10 {
+		t.Fatalf("stats = %+v, want 2 lines, 9 units, 10 of mine in the last hour", stats)
+	}
+	if stats.SinceLastCapture() != "just now" {
+		t.Fatalf("since last capture = %q", stats.SinceLastCapture())
+	}
+
+	other, err := LoadReceiptStats(ctx, db, 1, 2, time.Now().UTC())
+	if err != nil {
+		t.Fatalf("load other user stats: %v", err)
+	}
+	if other.Units != 9 || other.MyUnitsLastHour != 0 || other.SecondsSinceLastCapture != nil {
+		t.Fatalf("other user stats = %+v", other)
+	}
+}
+
+func TestClaimPallet_WarnsSecondUserUntilLapsedOrClosed(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 1)
+	ctx := context.Background()
+	if _, err := db.W.ExecContext(ctx, `INSERT INTO users (id, username, password_hash, role, created_at, updated_at) VALUES (2, 'scanner-two', 'hash', 'scanner', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`); err != nil {
+		t.Fatalf("seed second user: %v", err)
+	}
+	start := time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	claim, err := ClaimPallet(ctx, db, 1, 1, start)
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	if claim.UserID != 1 || claim.Username != "scanner-test" {
+		t.Fatalf("first claim = %+v", claim)
+	}
+
+	// A second user is told who holds the pallet and how long they have
+	// been idle; the holder renewing keeps it.
+	claim, err = ClaimPallet(ctx, db, 1, 2, start.Add(5*time.Minute))
+	if err != nil {
+		t.Fatalf("second claim: %v", err)
+	}
+	if claim.UserID != 1 || claim.IdleFor(start.Add(5*time.Minute)) != 5*time.Minute {
+		t.Fatalf("second user saw claim = %+v", claim)
+	}
+	if _, err := ClaimPallet(ctx, db, 1, 1, start.Add(10*time.Minute)); err != nil {
+		t.Fatalf("renew claim: %v", err)
+	}
+	claim, err = ClaimPallet(ctx, db, 1, 2, start.Add(20*time.Minute))
+	if err != nil {
+		t.Fatalf("claim after renewal: %v", err)
+	}
+	if claim.UserID != 1 {
+		t.Fatalf("renewed claim lapsed early: %+v", claim)
+	}
+
+	// Once the window passes without activity the pallet is free.
+	claim, err = ClaimPallet(ctx, db, 1, 2, start.Add(26*time.Minute))
+	if err != nil {
+		t.Fatalf("claim after lapse: %v", err)
+	}
+	if claim.UserID != 2 {
+		t.Fatalf("lapsed claim not replaced: %+v", claim)
+	}
+
+	// Closing the pallet releases the claim.
+	if err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return pallets.Transition(ctx, tx, nil, 1, 1, 1, pallets.StatusClosed)
+	}); err != nil {
+		t.Fatalf("close pallet: %v", err)
+	}
+	var held int
+	if err := db.R.NewRaw(`SELECT COUNT(*) FROM pallet_claims WHERE pallet_id = 1`).Scan(ctx, &held); err != nil {
+		t.Fatalf("count claims: %v", err)
+	}
+	if held != 0 {
+		t.Fatalf("claims after close = %d, want 0", held)
+	}
+}
+
+// benchmarkSaveReceipt saves lines over 200 SKUs, so after the first pass
+// every save merges into an existing line the way a scanner's repeat scans do.
+func benchmarkSaveReceipt(b *testing.B, db *sqlite.DB) {
+	ctx := context.Background()
+	auditSvc := audit.NewService()
+	expiry := time.Now().AddDate(1, 0, 0)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sku := fmt.Sprintf("SKU-%03d", i%200)
+		if err := SaveReceipt(ctx, db, auditSvc, 1, ReceiptInput{
+			PalletID: 1, SKU: sku, Description: "Bench " + sku, Qty: 1, BatchNumber: "B1", ExpiryDate: &expiry,
+		}); err != nil {
+			b.Fatalf("save receipt: %v", err)
+		}
+	}
+}
+
+func BenchmarkSaveReceipt(b *testing.B) {
+	db := openTestDB(b)
+	seedPallet(b, db, 1)
+	benchmarkSaveReceipt(b, db)
+}
+
+func TestSaveReceipt_PerformanceBudget(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 1)
+	perfbudget.Check(t, 15*time.Millisecond, func(b *testing.B) { benchmarkSaveReceipt(b, db) })
+}
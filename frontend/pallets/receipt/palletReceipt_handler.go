@@ -1,15 +1,19 @@
 package receipt
 
 import (
+	"bytes"
+	stdcontext "context"
 	"database/sql"
 	"encoding/json"
 	"errors"
-	"html"
+	"fmt"
 	"io"
+	"log/slog"
 	"mime"
 	"net/http"
 	"net/url"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -17,17 +21,38 @@ import (
 	"github.com/go-chi/chi/v5"
 
 	"receipter/frontend/shared/context"
+	sharedhtml "receipter/frontend/shared/html"
 	"receipter/infrastructure/audit"
 	"receipter/infrastructure/cache"
+	"receipter/infrastructure/catalog"
+	"receipter/infrastructure/customfield"
+	"receipter/infrastructure/customs"
+	"receipter/infrastructure/damage"
+	"receipter/infrastructure/formtoken"
+	"receipter/infrastructure/gs1"
+	"receipter/infrastructure/heic"
+	"receipter/infrastructure/helpnotice"
+	"receipter/infrastructure/live"
+	"receipter/infrastructure/pallets"
+	"receipter/infrastructure/phase"
+	"receipter/infrastructure/photocapture"
+	"receipter/infrastructure/photoquota"
+	"receipter/infrastructure/photoupload"
+	"receipter/infrastructure/photovisibility"
+	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/projectsettings"
 	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/receipts"
+	"receipter/infrastructure/serials"
 	"receipter/infrastructure/sqlite"
+	"receipter/infrastructure/userprefs"
 	"receipter/models"
 )
 
 var errInvalidPalletIDs = errors.New("invalid pallet ids")
 
 // ReceiptPageQueryHandler renders the receipt screen for a pallet.
-func ReceiptPageQueryHandler(db *sqlite.DB, _ *cache.UserSessionCache) http.HandlerFunc {
+func ReceiptPageQueryHandler(db *sqlite.DB, _ cache.SessionStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id, err := parsePalletID(r)
 		if err != nil {
@@ -44,12 +69,28 @@ func ReceiptPageQueryHandler(db *sqlite.DB, _ *cache.UserSessionCache) http.Hand
 			http.Error(w, "failed to load receipt page", http.StatusInternalServerError)
 			return
 		}
-		data.IsAdmin = userHasRole(session.UserRoles, rbac.RoleAdmin)
-		data.IsScanner = userHasRole(session.UserRoles, rbac.RoleScanner)
-		data.CanEdit = CanUserReceiptPallet(data.ProjectStatus, data.PalletStatus, session.UserRoles)
-		data.CanManageLines = CanManageReceiptLines(data.ProjectStatus, data.PalletStatus)
-		data.CanFinish = (data.IsAdmin || data.IsScanner) && data.ProjectStatus == "active" && data.PalletStatus == "open"
-		data.CanPrintClosedLabel = isClosedLikeStatus(data.PalletStatus) && (data.IsAdmin || data.IsScanner)
+		applyRoleFlags(&data, session.UserRoles)
+		data.CanExportOwnLines = data.IsScanner && !session.Kiosk()
+		data.Stats, err = LoadReceiptStats(r.Context(), db, id, session.UserID, time.Now().UTC())
+		if err != nil {
+			http.Error(w, "failed to load receipt stats", http.StatusInternalServerError)
+			return
+		}
+		if data.CanEdit && (data.PalletStatus == pallets.StatusCreated || data.PalletStatus == pallets.StatusOpen) {
+			now := time.Now().UTC()
+			claim, err := ClaimPallet(r.Context(), db, id, session.UserID, now)
+			if err != nil {
+				// The claim is advisory; the page still works without it.
+				slog.Error("receipt page: claim pallet failed", slog.Int64("pallet_id", id), slog.Any("err", err))
+			} else if claim.UserID != session.UserID {
+				data.ClaimedBy = claim.Username
+				data.ClaimIdleMinutes = int(claim.IdleFor(now) / time.Minute)
+			}
+		}
+		data.Notices, err = helpnotice.ForReceipt(r.Context(), db, session.UserID, session.User.Role, data.ProjectID)
+		if err != nil {
+			slog.Error("receipt page: load help notices failed", slog.Int64("pallet_id", id), slog.Any("err", err))
+		}
 		if !data.CanEdit {
 			if data.ProjectStatus != "active" {
 				data.Message = "Project is inactive. This pallet is read-only."
@@ -59,9 +100,19 @@ func ReceiptPageQueryHandler(db *sqlite.DB, _ *cache.UserSessionCache) http.Hand
 				data.Message = "Pallet is closed/labelled. Only admins can add or edit receipt lines."
 			}
 		}
-		if msg := strings.TrimSpace(r.URL.Query().Get("error")); msg != "" {
+		if msg := strings.TrimSpace(r.URL.Query().Get("status")); msg != "" {
 			data.Message = msg
 		}
+		if msg := strings.TrimSpace(r.URL.Query().Get("error")); msg != "" {
+			data.Message = msg
+			data.Refused = true
+		}
+		data.FormToken = formtoken.New()
+		prefs := userprefs.FromContext(r.Context())
+		data.ScannerSound = prefs.String(userprefs.ScannerSound) == "on"
+		data.ScannerVolume = prefs.String(userprefs.ScannerVolume)
+		data.Layout, data.Compact = resolveLayout(r)
+		requestViewportHints(w)
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		if err := PalletReceiptPage(data).Render(r.Context(), w); err != nil {
 			http.Error(w, "failed to render receipt page", http.StatusInternalServerError)
@@ -70,6 +121,146 @@ func ReceiptPageQueryHandler(db *sqlite.DB, _ *cache.UserSessionCache) http.Hand
 	}
 }
 
+// liveHeartbeatInterval keeps idle streams open through proxies.
+var liveHeartbeatInterval = 25 * time.Second
+
+// liveStatsInterval refreshes the stats strip so the time since the last
+// capture keeps counting while nothing changes.
+var liveStatsInterval = 30 * time.Second
+
+// ReceiptLiveStreamQueryHandler streams presence, stats and recorded-line
+// updates for a pallet as server-sent events, so operators working the same
+// pallet see each other and each other's captures without reloading.
+func ReceiptLiveStreamQueryHandler(db *sqlite.DB, hub *live.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parsePalletID(r)
+		if err != nil {
+			http.Error(w, "invalid pallet id", http.StatusBadRequest)
+			return
+		}
+		session, _ := context.GetSessionFromContext(r.Context())
+		if _, _, _, err := LoadPalletContext(r.Context(), db, id); err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "pallet not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to load pallet", http.StatusInternalServerError)
+			return
+		}
+
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		sub := hub.Join(id, session.UserID, session.User.Username)
+		defer hub.Leave(sub)
+
+		heartbeat := time.NewTicker(liveHeartbeatInterval)
+		defer heartbeat.Stop()
+		statsTicker := time.NewTicker(liveStatsInterval)
+		defer statsTicker.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+					return
+				}
+			case <-statsTicker.C:
+				if err := writeReceiptStatsEvent(r.Context(), w, db, id, session.UserID); err != nil {
+					return
+				}
+			case kind, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				hub.Ack(sub, kind)
+				var buf bytes.Buffer
+				switch kind {
+				case live.EventPresence:
+					err = ReceiptPresence(hub.Viewers(id, session.UserID)).Render(r.Context(), &buf)
+				case live.EventLines:
+					var data PageData
+					data, err = LoadPageData(r.Context(), db, id)
+					if err == nil {
+						applyRoleFlags(&data, session.UserRoles)
+						err = ReceiptLinesSection(data).Render(r.Context(), &buf)
+					}
+				}
+				if err != nil {
+					slog.Error("receipt live: render failed", slog.Int64("pallet_id", id), slog.Any("err", err))
+					continue
+				}
+				if err := writeServerSentEvent(w, string(kind), buf.String()); err != nil {
+					return
+				}
+				if kind == live.EventLines {
+					if err := writeReceiptStatsEvent(r.Context(), w, db, id, session.UserID); err != nil {
+						return
+					}
+				}
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeReceiptStatsEvent sends the viewer's stats strip. A failed load is
+// logged and skipped; only a failed write ends the stream.
+func writeReceiptStatsEvent(ctx stdcontext.Context, w io.Writer, db *sqlite.DB, palletID, userID int64) error {
+	stats, err := LoadReceiptStats(ctx, db, palletID, userID, time.Now().UTC())
+	if err != nil {
+		slog.Error("receipt live: load stats failed", slog.Int64("pallet_id", palletID), slog.Any("err", err))
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := ReceiptStatsStrip(stats).Render(ctx, &buf); err != nil {
+		slog.Error("receipt live: render stats failed", slog.Int64("pallet_id", palletID), slog.Any("err", err))
+		return nil
+	}
+	return writeServerSentEvent(w, "stats", buf.String())
+}
+
+func writeServerSentEvent(w io.Writer, event, data string) error {
+	var b strings.Builder
+	b.WriteString("event: ")
+	b.WriteString(event)
+	b.WriteString("\n")
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: ")
+		b.WriteString(strings.TrimSuffix(line, "\r"))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// applyRoleFlags sets what the viewer may do on the pallet.
+func applyRoleFlags(data *PageData, userRoles []string) {
+	data.IsAdmin = userHasRole(userRoles, rbac.RoleAdmin)
+	data.IsScanner = userHasRole(userRoles, rbac.RoleScanner)
+	data.CanEdit = CanUserReceiptPallet(data.ProjectStatus, data.PalletStatus, userRoles)
+	data.CanManageLines = CanManageReceiptLines(data.ProjectStatus, data.PalletStatus)
+	data.CanFinish = (data.IsAdmin || data.IsScanner) && data.ProjectStatus == "active" && data.PalletStatus == "open"
+	data.CanPrintClosedLabel = pallets.IsClosedLike(data.PalletStatus) && (data.IsAdmin || data.IsScanner)
+	data.CanImportLines = data.IsAdmin && data.CanEdit
+	if data.PhaseClosed {
+		data.CanEdit = false
+		data.CanManageLines = false
+		data.CanFinish = false
+		data.CanImportLines = false
+	}
+}
+
 func userHasRole(userRoles []string, role string) bool {
 	for _, userRole := range userRoles {
 		if userRole == role {
@@ -220,7 +411,7 @@ func BulkReceiptUploadCSVTemplateHandler(db *sqlite.DB) http.HandlerFunc {
 }
 
 // CreateReceiptCommandHandler stores/merges receipt line against pallet.
-func CreateReceiptCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+func CreateReceiptCommandHandler(db *sqlite.DB, auditSvc *audit.Service, hub *live.Hub) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id, err := parsePalletID(r)
 		if err != nil {
@@ -234,7 +425,7 @@ func CreateReceiptCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.Ha
 		}
 
 		session, _ := context.GetSessionFromContext(r.Context())
-		palletStatus, _, projectStatus, err := LoadPalletContext(r.Context(), db, id)
+		palletStatus, projectID, projectStatus, err := LoadPalletContext(r.Context(), db, id)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				http.Error(w, "pallet not found", http.StatusNotFound)
@@ -280,30 +471,42 @@ func CreateReceiptCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.Ha
 			http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(id, 10)+"/receipt?error="+url.QueryEscape("damaged qty cannot exceed qty"), http.StatusSeeOther)
 			return
 		}
+		damageReason := strings.TrimSpace(r.FormValue("damage_reason"))
+		if damagedQty > 0 && damageReason == "" {
+			http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(id, 10)+"/receipt?error="+url.QueryEscape(damage.ErrReasonRequired.Error()), http.StatusSeeOther)
+			return
+		}
 
-		expiry, err := parseOptionalDate(strings.TrimSpace(r.FormValue("expiry_date")))
+		expiry, err := parseReceiptExpiry(r.Context(), db, projectID, r.FormValue("expiry_date"), r.FormValue("expiry_check_override") != "", time.Now())
 		if err != nil {
-			http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(id, 10)+"/receipt?error="+url.QueryEscape("invalid expiry date"), http.StatusSeeOther)
+			http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(id, 10)+"/receipt?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
 			return
 		}
 
 		input := ReceiptInput{
-			PalletID:       id,
-			SKU:            strings.TrimSpace(r.FormValue("sku")),
-			Description:    strings.TrimSpace(r.FormValue("description")),
-			UOM:            strings.TrimSpace(r.FormValue("uom")),
-			Comment:        strings.TrimSpace(r.FormValue("comment")),
-			Qty:            qty,
-			CaseSize:       caseSize,
-			UnknownSKU:     unknownSKU,
-			Damaged:        damaged,
-			DamagedQty:     damagedQty,
-			BatchNumber:    strings.TrimSpace(r.FormValue("batch_number")),
-			ExpiryDate:     expiry,
-			CartonBarcode:  strings.TrimSpace(r.FormValue("carton_barcode")),
-			ItemBarcode:    strings.TrimSpace(r.FormValue("item_barcode")),
-			NoOuterBarcode: r.FormValue("no_outer_barcode") != "",
-			NoInnerBarcode: r.FormValue("no_inner_barcode") != "",
+			PalletID:        id,
+			SKU:             strings.TrimSpace(r.FormValue("sku")),
+			Description:     strings.TrimSpace(r.FormValue("description")),
+			UOM:             strings.TrimSpace(r.FormValue("uom")),
+			Comment:         strings.TrimSpace(r.FormValue("comment")),
+			Qty:             qty,
+			CaseSize:        caseSize,
+			UnknownSKU:      unknownSKU,
+			Damaged:         damaged,
+			DamagedQty:      damagedQty,
+			DamageReason:    damageReason,
+			BatchNumber:     strings.TrimSpace(r.FormValue("batch_number")),
+			ExpiryDate:      expiry,
+			CartonBarcode:   strings.TrimSpace(r.FormValue("carton_barcode")),
+			ItemBarcode:     strings.TrimSpace(r.FormValue("item_barcode")),
+			NoOuterBarcode:  r.FormValue("no_outer_barcode") != "",
+			NoInnerBarcode:  r.FormValue("no_inner_barcode") != "",
+			CountryOfOrigin: r.FormValue("country_of_origin"),
+			HSCode:          r.FormValue("hs_code"),
+			CustomValues:    customfield.ParseForm(r.Form),
+			FormToken:       r.FormValue(formtoken.FieldName),
+			Serials:         serials.Parse(r.FormValue("serials")),
+			PhotosInternal:  r.FormValue("photos_internal") != "",
 		}
 
 		if blob, mimeType, fileName, err := parseOptionalPhoto(r); err != nil {
@@ -322,7 +525,14 @@ func CreateReceiptCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.Ha
 		}
 		input.Photos = photos
 
-		if input.UnknownSKU && len(input.StockPhotoBlob) == 0 && len(input.Photos) == 0 {
+		deferred, err := parseDeferredPhotos(r.Form)
+		if err != nil {
+			http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(id, 10)+"/receipt?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		input.DeferredPhotos = deferred
+
+		if input.UnknownSKU && len(input.StockPhotoBlob) == 0 && len(input.Photos) == 0 && len(input.DeferredPhotos) == 0 {
 			http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(id, 10)+"/receipt?error="+url.QueryEscape("unknown sku requires at least one photo"), http.StatusSeeOther)
 			return
 		}
@@ -332,16 +542,100 @@ func CreateReceiptCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.Ha
 			return
 		}
 
-		if err := SaveReceipt(r.Context(), db, auditSvc, session.UserID, input); err != nil {
-			http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(id, 10)+"/receipt?error="+url.QueryEscape("failed to save receipt"), http.StatusSeeOther)
+		if failures := barcodeCheckFailures(input); len(failures) > 0 {
+			if r.FormValue("barcode_check_override") == "" {
+				msg := strings.Join(failures, "; ") + ". Re-scan the barcode, or tick \"Keep barcodes that fail the check digit\" to save it anyway."
+				http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(id, 10)+"/receipt?error="+url.QueryEscape(msg), http.StatusSeeOther)
+				return
+			}
+			input.BarcodeCheckFailed = true
+		}
+
+		if !input.UnknownSKU {
+			serialTracked, err := catalog.IsSerialTracked(r.Context(), db, projectID, input.SKU)
+			if err != nil {
+				http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(id, 10)+"/receipt?error="+url.QueryEscape("failed to save receipt"), http.StatusSeeOther)
+				return
+			}
+			if serialTracked && len(input.Serials) == 0 {
+				http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(id, 10)+"/receipt?error="+url.QueryEscape(serials.ErrRequired.Error()), http.StatusSeeOther)
+				return
+			}
+		}
+		if len(input.Serials) > 0 && int64(len(input.Serials)) != input.Qty {
+			http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(id, 10)+"/receipt?error="+url.QueryEscape(fmt.Sprintf("%s: %d scanned for qty %d", serials.ErrCount, len(input.Serials), input.Qty)), http.StatusSeeOther)
+			return
+		}
+
+		if !input.UnknownSKU {
+			highValue, err := catalog.IsHighValue(r.Context(), db, projectID, input.SKU)
+			if err != nil {
+				http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(id, 10)+"/receipt?error="+url.QueryEscape("failed to save receipt"), http.StatusSeeOther)
+				return
+			}
+			if highValue && r.FormValue(highValueConfirmedField) == "" {
+				showHighValueConfirm(w, r, db, auditSvc, session.UserID, input)
+				return
+			}
+			input.HighValueConfirmed = highValue
+		}
+
+		saved, err := SaveReceiptWithUploads(r.Context(), db, auditSvc, session.UserID, input)
+		if errors.Is(err, formtoken.ErrUsed) {
+			// A double-tapped Save: the first submission already saved the line.
+			http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(id, 10)+"/receipt?status="+url.QueryEscape("Receipt already saved; the repeated submit was ignored."), http.StatusSeeOther)
 			return
 		}
-		http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(id, 10)+"/receipt", http.StatusSeeOther)
+		if err != nil {
+			msg := "failed to save receipt"
+			if IsRefusedReceipt(err) {
+				msg = err.Error()
+			}
+			http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(id, 10)+"/receipt?error="+url.QueryEscape(msg), http.StatusSeeOther)
+			return
+		}
+		hub.Publish(id, live.EventLines)
+		redirect := "/tasker/pallets/" + strconv.FormatInt(id, 10) + "/receipt"
+		// The receipt page script posts with fetch when it has photos to send
+		// separately, and needs the reserved upload URLs back.
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			uploads := make([]photoUploadView, 0, len(saved.Uploads))
+			for _, upload := range saved.Uploads {
+				uploads = append(uploads, newPhotoUploadView(id, upload))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"receiptId": saved.ReceiptID,
+				"redirect":  redirect,
+				"uploads":   uploads,
+			})
+			return
+		}
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+	}
+}
+
+// IsRefusedReceipt reports whether an error from SaveReceiptWithUploads is a
+// rule the line broke, whose message can be shown to the user as it is.
+func IsRefusedReceipt(err error) bool {
+	return errors.Is(err, damage.ErrReasonRequired) || errors.Is(err, damage.ErrUnknownReason) || errors.Is(err, customfield.ErrInvalidValue) || errors.Is(err, customs.ErrInvalid) || errors.Is(err, projectsettings.ErrRule) || errors.Is(err, photocapture.ErrTooLarge) || errors.Is(err, photoquota.ErrExceeded) || errors.Is(err, formtoken.ErrInvalid) || errors.Is(err, serials.ErrDuplicate) || errors.Is(err, serials.ErrTooLong) || errors.Is(err, phase.ErrClosed)
+}
+
+// barcodeCheckFailures describes each item or carton barcode on the line
+// whose GS1 check digit is wrong. Barcodes that are not GTINs are not checked.
+func barcodeCheckFailures(input ReceiptInput) []string {
+	failures := make([]string, 0, 2)
+	if err := gs1.Validate(input.ItemBarcode); err != nil {
+		failures = append(failures, "item barcode: "+err.Error())
+	}
+	if err := gs1.Validate(input.CartonBarcode); err != nil {
+		failures = append(failures, "carton barcode: "+err.Error())
 	}
+	return failures
 }
 
 // UpdateReceiptLineCommandHandler updates an existing receipt line for a pallet.
-func UpdateReceiptLineCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+func UpdateReceiptLineCommandHandler(db *sqlite.DB, auditSvc *audit.Service, hub *live.Hub) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		palletID, err := parsePalletID(r)
 		if err != nil {
@@ -360,7 +654,7 @@ func UpdateReceiptLineCommandHandler(db *sqlite.DB, auditSvc *audit.Service) htt
 		}
 
 		session, _ := context.GetSessionFromContext(r.Context())
-		palletStatus, _, projectStatus, err := LoadPalletContext(r.Context(), db, palletID)
+		palletStatus, projectID, projectStatus, err := LoadPalletContext(r.Context(), db, palletID)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				http.Error(w, "pallet not found", http.StatusNotFound)
@@ -384,14 +678,27 @@ func UpdateReceiptLineCommandHandler(db *sqlite.DB, auditSvc *audit.Service) htt
 			http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(palletID, 10)+"/receipt?error="+url.QueryEscape("case size must be greater than 0"), http.StatusSeeOther)
 			return
 		}
-		damaged := r.FormValue("damaged") != ""
-		damagedQty := int64(0)
+		damagedQty, err := strconv.ParseInt(strings.TrimSpace(defaultZero(r.FormValue("damaged_qty"))), 10, 64)
+		if err != nil || damagedQty < 0 {
+			http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(palletID, 10)+"/receipt?error="+url.QueryEscape("damaged qty must be 0 or greater"), http.StatusSeeOther)
+			return
+		}
+		damaged := r.FormValue("damaged") != "" || damagedQty > 0
+		if damagedQty > qty {
+			http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(palletID, 10)+"/receipt?error="+url.QueryEscape("damaged qty cannot exceed qty"), http.StatusSeeOther)
+			return
+		}
+		damageReason := ""
 		if damaged {
-			damagedQty = qty
+			damageReason = strings.TrimSpace(r.FormValue("damage_reason"))
+			if damageReason == "" {
+				http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(palletID, 10)+"/receipt?error="+url.QueryEscape(damage.ErrReasonRequired.Error()), http.StatusSeeOther)
+				return
+			}
 		}
-		expiry, err := parseOptionalDate(strings.TrimSpace(r.FormValue("expiry_date")))
+		expiry, err := parseReceiptExpiry(r.Context(), db, projectID, r.FormValue("expiry_date"), r.FormValue("expiry_check_override") != "", time.Now())
 		if err != nil {
-			http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(palletID, 10)+"/receipt?error="+url.QueryEscape("invalid expiry date"), http.StatusSeeOther)
+			http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(palletID, 10)+"/receipt?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
 			return
 		}
 		sku := strings.TrimSpace(r.FormValue("sku"))
@@ -401,18 +708,22 @@ func UpdateReceiptLineCommandHandler(db *sqlite.DB, auditSvc *audit.Service) htt
 		}
 
 		input := ReceiptLineUpdateInput{
-			PalletID:    palletID,
-			ReceiptID:   receiptID,
-			SKU:         sku,
-			Description: strings.TrimSpace(r.FormValue("description")),
-			UOM:         strings.TrimSpace(r.FormValue("uom")),
-			Comment:     strings.TrimSpace(r.FormValue("comment")),
-			Qty:         qty,
-			CaseSize:    caseSize,
-			Damaged:     damaged,
-			DamagedQty:  damagedQty,
-			BatchNumber: strings.TrimSpace(r.FormValue("batch_number")),
-			ExpiryDate:  expiry,
+			PalletID:        palletID,
+			ReceiptID:       receiptID,
+			SKU:             sku,
+			Description:     strings.TrimSpace(r.FormValue("description")),
+			UOM:             strings.TrimSpace(r.FormValue("uom")),
+			Comment:         strings.TrimSpace(r.FormValue("comment")),
+			Qty:             qty,
+			CaseSize:        caseSize,
+			Damaged:         damaged,
+			DamagedQty:      damagedQty,
+			DamageReason:    damageReason,
+			BatchNumber:     strings.TrimSpace(r.FormValue("batch_number")),
+			ExpiryDate:      expiry,
+			CountryOfOrigin: r.FormValue("country_of_origin"),
+			HSCode:          r.FormValue("hs_code"),
+			CustomValues:    customfield.ParseForm(r.Form),
 		}
 
 		if err := UpdateReceiptLine(r.Context(), db, auditSvc, session.UserID, input); err != nil {
@@ -424,12 +735,13 @@ func UpdateReceiptLineCommandHandler(db *sqlite.DB, auditSvc *audit.Service) htt
 			return
 		}
 
+		hub.Publish(palletID, live.EventLines)
 		http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(palletID, 10)+"/receipt", http.StatusSeeOther)
 	}
 }
 
 // DeleteReceiptLineCommandHandler removes an existing receipt line for a pallet.
-func DeleteReceiptLineCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+func DeleteReceiptLineCommandHandler(db *sqlite.DB, auditSvc *audit.Service, hub *live.Hub) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		palletID, err := parsePalletID(r)
 		if err != nil {
@@ -466,48 +778,17 @@ func DeleteReceiptLineCommandHandler(db *sqlite.DB, auditSvc *audit.Service) htt
 			return
 		}
 
+		hub.Publish(palletID, live.EventLines)
 		http.Redirect(w, r, "/tasker/pallets/"+strconv.FormatInt(palletID, 10)+"/receipt", http.StatusSeeOther)
 	}
 }
 
 func CanUserReceiptPallet(projectStatus, palletStatus string, userRoles []string) bool {
-	if projectStatus != "active" {
-		return false
-	}
-	if palletStatus == "cancelled" {
-		return false
-	}
-	if palletStatus == "created" || palletStatus == "open" {
-		return true
-	}
-	if palletStatus == "closed" {
-		for _, role := range userRoles {
-			if role == rbac.RoleAdmin {
-				return true
-			}
-		}
-		return false
-	}
-	if palletStatus == "labelled" {
-		for _, role := range userRoles {
-			if role == rbac.RoleAdmin {
-				return true
-			}
-		}
-		return false
-	}
-	return false
+	return pallets.CanReceive(projectStatus, palletStatus, slices.Contains(userRoles, rbac.RoleAdmin))
 }
 
 func CanManageReceiptLines(projectStatus, palletStatus string) bool {
-	if projectStatus != "active" {
-		return false
-	}
-	return palletStatus == "created" || palletStatus == "open"
-}
-
-func isClosedLikeStatus(status string) bool {
-	return status == "closed" || status == "labelled"
+	return pallets.CanManageLines(projectStatus, palletStatus)
 }
 
 // SearchStockQueryHandler returns matching stock codes.
@@ -538,7 +819,7 @@ func SearchStockOptionsQueryHandler(db *sqlite.DB) http.HandlerFunc {
 
 		session, ok := context.GetSessionFromContext(r.Context())
 		if !ok || session.ActiveProjectID == nil || *session.ActiveProjectID <= 0 {
-			writeStockSuggestionListHTML(w, q, nil)
+			_ = sharedhtml.SuggestionsList(skuSuggestionList(q, nil)).Render(r.Context(), w)
 			return
 		}
 
@@ -547,53 +828,34 @@ func SearchStockOptionsQueryHandler(db *sqlite.DB) http.HandlerFunc {
 			http.Error(w, "failed to search stock", http.StatusInternalServerError)
 			return
 		}
-		writeStockSuggestionListHTML(w, q, items)
+		if err := sharedhtml.SuggestionsList(skuSuggestionList(q, items)).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render stock suggestions", http.StatusInternalServerError)
+		}
 	}
 }
 
-func writeStockSuggestionListHTML(w io.Writer, q string, items []models.StockItem) {
-	q = strings.TrimSpace(q)
-	listClass := "menu menu-sm mt-2 max-h-56 w-full overflow-y-auto rounded-box border border-base-300 bg-base-100 p-1 shadow-md"
-	if q == "" {
-		listClass += " hidden"
-	}
-
-	var b strings.Builder
-	b.WriteString(`<ul id="sku_suggestions" class="`)
-	b.WriteString(listClass)
-	b.WriteString(`">`)
-
-	if q != "" && len(items) == 0 {
-		b.WriteString(`<li><span class="text-xs text-base-content/60">No matching SKUs</span></li>`)
-	}
+// SearchBatchOptionsQueryHandler returns Datastar morph target markup for
+// batch suggestions of the SKU being receipted.
+func SearchBatchOptionsQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
-	for _, item := range items {
-		sku := strings.TrimSpace(item.SKU)
-		if sku == "" {
-			continue
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok || session.ActiveProjectID == nil || *session.ActiveProjectID <= 0 {
+			_ = sharedhtml.SuggestionsList(batchSuggestionList(nil)).Render(r.Context(), w)
+			return
 		}
-		desc := strings.TrimSpace(item.Description)
-		uom := strings.TrimSpace(item.UOM)
-		label := sku
-		if desc != "" {
-			label = sku + " - " + desc
+
+		query := r.URL.Query()
+		batches, err := SearchBatches(r.Context(), db, *session.ActiveProjectID, query.Get("sku"), query.Get("q"))
+		if err != nil {
+			http.Error(w, "failed to search batches", http.StatusInternalServerError)
+			return
 		}
-		if uom != "" {
-			label += " (" + uom + ")"
+		if err := sharedhtml.SuggestionsList(batchSuggestionList(batches)).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render batch suggestions", http.StatusInternalServerError)
 		}
-		b.WriteString(`<li><button type="button" class="justify-start text-left text-base py-2" data-on:click="(function(){var sku=document.getElementById('sku_input');var desc=document.getElementById('description_input');var uom=document.getElementById('uom_input');var qty=document.getElementById('qty_input');var list=document.getElementById('sku_suggestions');if(sku){sku.value=el.dataset.sku||'';sku.dispatchEvent(new Event('input',{bubbles:true}));}if(desc){desc.value=el.dataset.description||'';}if(uom){uom.value=el.dataset.uom||'';}if(list){list.innerHTML='';list.classList.add('hidden');}if(qty&&!qty.disabled){qty.focus();}})()" data-sku-suggestion="1" data-sku="`)
-		b.WriteString(html.EscapeString(sku))
-		b.WriteString(`" data-description="`)
-		b.WriteString(html.EscapeString(desc))
-		b.WriteString(`" data-uom="`)
-		b.WriteString(html.EscapeString(uom))
-		b.WriteString(`">`)
-		b.WriteString(html.EscapeString(label))
-		b.WriteString(`</button></li>`)
 	}
-
-	b.WriteString(`</ul>`)
-	_, _ = io.WriteString(w, b.String())
 }
 
 func parsePalletID(r *http.Request) (int64, error) {
@@ -637,23 +899,24 @@ func parseReceiptID(r *http.Request) (int64, error) {
 	return strconv.ParseInt(idStr, 10, 64)
 }
 
-func parseDate(v string) (time.Time, error) {
-	if t, err := time.Parse("2006-01-02", v); err == nil {
-		return t, nil
-	}
-	return time.Parse("02/01/2006", v)
-}
-
-func parseOptionalDate(v string) (*time.Time, error) {
-	v = strings.TrimSpace(v)
-	if v == "" {
-		return nil, nil
+// parseReceiptExpiry reads the expiry field under the project's month-only
+// expiry setting. Unless override is set, an expiry outside the usual range
+// is refused with a message telling the scanner how to keep it.
+func parseReceiptExpiry(ctx stdcontext.Context, db *sqlite.DB, projectID int64, raw string, override bool, now time.Time) (*time.Time, error) {
+	settings, err := projectsettings.Load(ctx, db, projectID)
+	if err != nil {
+		return nil, errors.New("failed to load project settings")
 	}
-	t, err := parseDate(v)
+	expiry, err := receipts.ParseExpiry(raw, settings.String(projectsettings.ReceiptMonthExpiry) != projectsettings.MonthExpiryStart)
 	if err != nil {
-		return nil, err
+		return nil, errors.New("invalid expiry date; enter DD/MM/YYYY or MM/YYYY")
+	}
+	if expiry != nil && !override {
+		if err := receipts.CheckExpiryRange(*expiry, now); err != nil {
+			return nil, fmt.Errorf("%s. Check the date, or tick \"Keep an unusual expiry date\" to save it anyway", err.Error())
+		}
 	}
-	return &t, nil
+	return expiry, nil
 }
 
 // ReceiptPhotoQueryHandler streams a stored stock photo for a receipt line.
@@ -670,6 +933,9 @@ func ReceiptPhotoQueryHandler(db *sqlite.DB) http.HandlerFunc {
 			return
 		}
 
+		if !clientMayViewPhoto(w, r, db, palletID, photovisibility.SourcePrimary, receiptID) {
+			return
+		}
 		blob, mimeType, fileName, err := LoadReceiptPhoto(r.Context(), db, palletID, receiptID)
 		if err != nil {
 			if err == sql.ErrNoRows {
@@ -736,15 +1002,33 @@ func parseOptionalPhoto(r *http.Request) (blob []byte, mimeType, fileName string
 		return nil, "", "", errors.New("photo must be 5MB or less")
 	}
 
-	mimeType = strings.TrimSpace(header.Header.Get("Content-Type"))
-	if mimeType == "" {
-		mimeType = http.DetectContentType(data)
-	}
+	data, mimeType, fileName = normalizePhoto(r.Context(), data, header.Header.Get("Content-Type"), header.Filename)
 	if !strings.HasPrefix(mimeType, "image/") {
 		return nil, "", "", errors.New("photo must be an image file")
 	}
+	return data, mimeType, fileName, nil
+}
+
+// normalizePhoto settles the type and name an uploaded photo is stored
+// under. HEIC photos from iPhones are recognised by their bytes, since
+// browsers often send them as image/jpeg or application/octet-stream, and
+// are converted to JPEG so every page can show them.
+func normalizePhoto(ctx stdcontext.Context, data []byte, mimeType, fileName string) ([]byte, string, string) {
+	fileName = strings.TrimSpace(fileName)
+	if fileName != "" {
+		fileName = filepath.Base(fileName)
+	}
+	if sniffed := heic.Sniff(data); sniffed != "" {
+		if fileName == "" {
+			fileName = "stock-photo.heic"
+		}
+		return heic.Normalize(ctx, data, fileName)
+	}
 
-	fileName = strings.TrimSpace(header.Filename)
+	mimeType = strings.TrimSpace(mimeType)
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = http.DetectContentType(data)
+	}
 	if fileName == "" {
 		exts, _ := mime.ExtensionsByType(mimeType)
 		ext := ""
@@ -752,11 +1036,8 @@ func parseOptionalPhoto(r *http.Request) (blob []byte, mimeType, fileName string
 			ext = exts[0]
 		}
 		fileName = "stock-photo" + ext
-	} else {
-		fileName = filepath.Base(fileName)
 	}
-
-	return data, mimeType, fileName, nil
+	return data, mimeType, fileName
 }
 
 func parseReceiptForm(r *http.Request) error {
@@ -794,26 +1075,11 @@ func parseOptionalPhotos(r *http.Request) ([]PhotoInput, error) {
 			return nil, errors.New("each photo must be 5MB or less")
 		}
 
-		mimeType := strings.TrimSpace(fh.Header.Get("Content-Type"))
-		if mimeType == "" {
-			mimeType = http.DetectContentType(data)
-		}
+		data, mimeType, fileName := normalizePhoto(r.Context(), data, fh.Header.Get("Content-Type"), fh.Filename)
 		if !strings.HasPrefix(mimeType, "image/") {
 			return nil, errors.New("photos must be image files")
 		}
 
-		fileName := strings.TrimSpace(fh.Filename)
-		if fileName == "" {
-			exts, _ := mime.ExtensionsByType(mimeType)
-			ext := ""
-			if len(exts) > 0 {
-				ext = exts[0]
-			}
-			fileName = "stock-photo" + ext
-		} else {
-			fileName = filepath.Base(fileName)
-		}
-
 		photos = append(photos, PhotoInput{Blob: data, MIMEType: mimeType, FileName: fileName})
 	}
 	return photos, nil
@@ -838,6 +1104,9 @@ func ReceiptPhotosHandler(db *sqlite.DB) http.HandlerFunc {
 			return
 		}
 
+		if !clientMayViewPhoto(w, r, db, palletID, photovisibility.SourceGallery, photoID) {
+			return
+		}
 		blob, mimeType, fileName, err := LoadReceiptPhotoByID(r.Context(), db, palletID, receiptID, photoID)
 		if err != nil {
 			if err == sql.ErrNoRows {
@@ -861,3 +1130,180 @@ func ReceiptPhotosHandler(db *sqlite.DB) http.HandlerFunc {
 		_, _ = w.Write(blob)
 	}
 }
+
+// clientMayViewPhoto answers 404 to a client user asking for a photo that is
+// internal or on a pallet outside their projects. Staff may view any photo.
+func clientMayViewPhoto(w http.ResponseWriter, r *http.Request, db *sqlite.DB, palletID int64, source string, photoID int64) bool {
+	session, _ := context.GetSessionFromContext(r.Context())
+	if !photovisibility.HiddenFrom(session.UserRoles) {
+		return true
+	}
+	_, projectID, _, err := LoadPalletContext(r.Context(), db, palletID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return false
+		}
+		http.Error(w, "failed to load pallet", http.StatusInternalServerError)
+		return false
+	}
+	allowed, err := projectinfra.ClientHasProjectAccess(r.Context(), db, session.UserID, projectID)
+	if err != nil {
+		http.Error(w, "failed to validate project access", http.StatusInternalServerError)
+		return false
+	}
+	internal, err := photovisibility.IsInternal(r.Context(), db, source, photoID)
+	if err != nil {
+		http.Error(w, "failed to load photo", http.StatusInternalServerError)
+		return false
+	}
+	if !allowed || internal {
+		http.NotFound(w, r)
+		return false
+	}
+	return true
+}
+
+// parseDeferredPhotos reads the photos the client will upload after the
+// receipt is saved, declared as parallel deferred_photo_* fields.
+func parseDeferredPhotos(form url.Values) ([]photoupload.Pending, error) {
+	sizes := form["deferred_photo_size"]
+	names := form["deferred_photo_name"]
+	types := form["deferred_photo_type"]
+	photos := make([]photoupload.Pending, 0, len(sizes))
+	for i, raw := range sizes {
+		size, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid photo size")
+		}
+		photo := photoupload.Pending{Size: size}
+		if i < len(names) {
+			photo.FileName = names[i]
+		}
+		if i < len(types) {
+			photo.MIMEType = types[i]
+		}
+		if err := photo.Validate(); err != nil {
+			return nil, err
+		}
+		photos = append(photos, photo)
+	}
+	return photos, nil
+}
+
+type photoUploadView struct {
+	ID            int64  `json:"id"`
+	URL           string `json:"url"`
+	FileName      string `json:"fileName"`
+	Status        string `json:"status"`
+	ReceivedBytes int64  `json:"receivedBytes"`
+	TotalBytes    int64  `json:"totalBytes"`
+	Error         string `json:"error,omitempty"`
+}
+
+func newPhotoUploadView(palletID int64, upload models.PhotoUpload) photoUploadView {
+	return photoUploadView{
+		ID:            upload.ID,
+		URL:           fmt.Sprintf("/tasker/api/pallets/%d/receipts/%d/photo-uploads/%d", palletID, upload.PalletReceiptID, upload.ID),
+		FileName:      upload.FileName,
+		Status:        upload.Status,
+		ReceivedBytes: upload.ReceivedBytes,
+		TotalBytes:    upload.TotalBytes,
+		Error:         upload.Error,
+	}
+}
+
+func writePhotoUploadJSON(w http.ResponseWriter, status int, palletID int64, upload models.PhotoUpload) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(newPhotoUploadView(palletID, upload))
+}
+
+// loadOwnPhotoUpload resolves the upload in the URL and checks the caller
+// started it; admins may see any upload.
+func loadOwnPhotoUpload(w http.ResponseWriter, r *http.Request, db *sqlite.DB) (palletID int64, upload models.PhotoUpload, ok bool) {
+	palletID, err := parsePalletID(r)
+	if err != nil {
+		http.Error(w, "invalid pallet id", http.StatusBadRequest)
+		return 0, upload, false
+	}
+	receiptID, err := parseReceiptID(r)
+	if err != nil {
+		http.Error(w, "invalid receipt id", http.StatusBadRequest)
+		return 0, upload, false
+	}
+	uploadID, err := strconv.ParseInt(chi.URLParam(r, "uploadID"), 10, 64)
+	if err != nil || uploadID <= 0 {
+		http.Error(w, "invalid upload id", http.StatusBadRequest)
+		return 0, upload, false
+	}
+	upload, err = photoupload.Load(r.Context(), db, palletID, receiptID, uploadID)
+	if err != nil {
+		if errors.Is(err, photoupload.ErrNotFound) {
+			http.NotFound(w, r)
+			return 0, upload, false
+		}
+		http.Error(w, "failed to load photo upload", http.StatusInternalServerError)
+		return 0, upload, false
+	}
+	session, _ := context.GetSessionFromContext(r.Context())
+	if upload.CreatedByUserID != session.UserID && !userHasRole(session.UserRoles, rbac.RoleAdmin) {
+		http.Error(w, "photo upload belongs to another user", http.StatusForbidden)
+		return 0, upload, false
+	}
+	return palletID, upload, true
+}
+
+// PhotoUploadStatusQueryHandler reports how far a deferred photo upload has
+// got so the client can resume after a dropped connection.
+func PhotoUploadStatusQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		palletID, upload, ok := loadOwnPhotoUpload(w, r, db)
+		if !ok {
+			return
+		}
+		writePhotoUploadJSON(w, http.StatusOK, palletID, upload)
+	}
+}
+
+// PhotoUploadChunkCommandHandler appends the request body to a deferred
+// photo upload at ?offset=N. A mismatched offset returns 409 with the current
+// state so the client can continue from receivedBytes.
+func PhotoUploadChunkCommandHandler(db *sqlite.DB, worker *photoupload.Worker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		palletID, upload, ok := loadOwnPhotoUpload(w, r, db)
+		if !ok {
+			return
+		}
+		offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+		if err != nil || offset < 0 {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+		chunk, err := io.ReadAll(http.MaxBytesReader(w, r.Body, photoupload.MaxChunkBytes))
+		if err != nil {
+			http.Error(w, photoupload.ErrChunkTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		updated, err := photoupload.AppendChunk(r.Context(), db, palletID, upload.PalletReceiptID, upload.ID, offset, chunk)
+		switch {
+		case err == nil:
+		case errors.Is(err, photoupload.ErrOffsetMismatch), errors.Is(err, photoupload.ErrNotUploading):
+			writePhotoUploadJSON(w, http.StatusConflict, palletID, updated)
+			return
+		case errors.Is(err, photoupload.ErrEmptyChunk), errors.Is(err, photoupload.ErrChunkTooLarge), errors.Is(err, photoupload.ErrPhotoTooLarge):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		default:
+			slog.Error("append photo upload chunk failed", slog.Int64("upload_id", upload.ID), slog.Any("err", err))
+			http.Error(w, "failed to store chunk", http.StatusInternalServerError)
+			return
+		}
+		if updated.Status == photoupload.StatusQueued {
+			worker.Notify()
+		}
+		writePhotoUploadJSON(w, http.StatusOK, palletID, updated)
+	}
+}
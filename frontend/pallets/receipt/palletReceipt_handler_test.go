@@ -11,14 +11,19 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/uptrace/bun"
 
 	sessioncontext "receipter/frontend/shared/context"
+	sharedhtml "receipter/frontend/shared/html"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/catalog"
+	"receipter/infrastructure/formtoken"
 	"receipter/models"
 )
 
 func TestCreateReceiptCommandHandler_InvalidPalletIDReturnsBadRequest(t *testing.T) {
 	db := openTestDB(t)
-	handler := CreateReceiptCommandHandler(db, nil)
+	handler := CreateReceiptCommandHandler(db, nil, nil)
 
 	req := newReceiptFormRequest("abc", url.Values{
 		"sku":         {"SKU-1"},
@@ -39,7 +44,7 @@ func TestCreateReceiptCommandHandler_InvalidPalletIDReturnsBadRequest(t *testing
 func TestCreateReceiptCommandHandler_InvalidExpiryDateRedirectsError(t *testing.T) {
 	db := openTestDB(t)
 	seedPallet(t, db, 8)
-	handler := CreateReceiptCommandHandler(db, nil)
+	handler := CreateReceiptCommandHandler(db, nil, nil)
 
 	req := newReceiptFormRequestWithSession("8", url.Values{
 		"sku":         {"SKU-DATE"},
@@ -59,10 +64,57 @@ func TestCreateReceiptCommandHandler_InvalidExpiryDateRedirectsError(t *testing.
 	}
 }
 
+func TestCreateReceiptCommandHandler_MonthYearExpiryAndRangeOverride(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 8)
+	handler := CreateReceiptCommandHandler(db, nil, nil)
+
+	req := newReceiptFormRequestWithSession("8", url.Values{
+		"sku":         {"SKU-MONTH"},
+		"description": {"Month expiry"},
+		"qty":         {"1"},
+		"expiry_date": {"02/2028"},
+	})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if location := rr.Header().Get("Location"); rr.Code != http.StatusSeeOther || strings.Contains(location, "error=") {
+		t.Fatalf("expected month-year expiry saved, got %d %s", rr.Code, location)
+	}
+	var expiry string
+	err := db.WithReadTx(stdcontext.Background(), func(ctx stdcontext.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT date(expiry_date) FROM pallet_receipts WHERE sku = 'SKU-MONTH'`).Scan(ctx, &expiry)
+	})
+	if err != nil {
+		t.Fatalf("load expiry: %v", err)
+	}
+	if expiry != "2028-02-29" {
+		t.Fatalf("expected month-year expiry saved as end of month, got %s", expiry)
+	}
+
+	form := url.Values{
+		"sku":         {"SKU-FAR"},
+		"description": {"Far expiry"},
+		"qty":         {"1"},
+		"expiry_date": {"01/01/2099"},
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newReceiptFormRequestWithSession("8", form))
+	if location := rr.Header().Get("Location"); !strings.Contains(location, "error=expiry+date+is+outside+the+usual+range") {
+		t.Fatalf("expected far expiry refused, got %s", location)
+	}
+
+	form.Set("expiry_check_override", "1")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newReceiptFormRequestWithSession("8", form))
+	if location := rr.Header().Get("Location"); rr.Code != http.StatusSeeOther || strings.Contains(location, "error=") {
+		t.Fatalf("expected confirmed far expiry saved, got %d %s", rr.Code, location)
+	}
+}
+
 func TestCreateReceiptCommandHandler_DamagedSelectedWithoutQtyRedirectsError(t *testing.T) {
 	db := openTestDB(t)
 	seedPallet(t, db, 9)
-	handler := CreateReceiptCommandHandler(db, nil)
+	handler := CreateReceiptCommandHandler(db, nil, nil)
 
 	req := newReceiptFormRequestWithSession("9", url.Values{
 		"sku":         {"SKU-DMG"},
@@ -87,7 +139,7 @@ func TestCreateReceiptCommandHandler_DamagedSelectedWithoutQtyRedirectsError(t *
 func TestCreateReceiptCommandHandler_MissingSKURedirectsError(t *testing.T) {
 	db := openTestDB(t)
 	seedPallet(t, db, 10)
-	handler := CreateReceiptCommandHandler(db, nil)
+	handler := CreateReceiptCommandHandler(db, nil, nil)
 
 	req := newReceiptFormRequestWithSession("10", url.Values{
 		"sku":         {""},
@@ -110,7 +162,7 @@ func TestCreateReceiptCommandHandler_MissingSKURedirectsError(t *testing.T) {
 func TestCreateReceiptCommandHandler_InvalidCaseSizeRedirectsError(t *testing.T) {
 	db := openTestDB(t)
 	seedPallet(t, db, 12)
-	handler := CreateReceiptCommandHandler(db, nil)
+	handler := CreateReceiptCommandHandler(db, nil, nil)
 
 	req := newReceiptFormRequestWithSession("12", url.Values{
 		"sku":         {"SKU-CASE"},
@@ -134,7 +186,7 @@ func TestCreateReceiptCommandHandler_InvalidCaseSizeRedirectsError(t *testing.T)
 func TestCreateReceiptCommandHandler_BlankExpiryAccepted(t *testing.T) {
 	db := openTestDB(t)
 	seedPallet(t, db, 13)
-	handler := CreateReceiptCommandHandler(db, nil)
+	handler := CreateReceiptCommandHandler(db, nil, nil)
 
 	req := newReceiptFormRequestWithSession("13", url.Values{
 		"sku":         {"SKU-NO-EXP"},
@@ -159,10 +211,189 @@ func TestCreateReceiptCommandHandler_BlankExpiryAccepted(t *testing.T) {
 	}
 }
 
+func TestCreateReceiptCommandHandler_BarcodeCheckDigitWarnsUntilOverridden(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 14)
+	handler := CreateReceiptCommandHandler(db, nil, nil)
+	form := url.Values{
+		"sku":            {"SKU-GTIN"},
+		"qty":            {"1"},
+		"item_barcode":   {"5012345678901"},
+		"carton_barcode": {"INTERNAL-REF-7"},
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newReceiptFormRequestWithSession("14", form))
+	location := rr.Header().Get("Location")
+	if rr.Code != http.StatusSeeOther || !strings.Contains(location, "EAN-13+5012345678901+should+end+in+0") {
+		t.Fatalf("expected check digit warning, got %d %s", rr.Code, location)
+	}
+	if rows, _ := countReceiptRows(t, db, 14); rows != 0 {
+		t.Fatalf("expected nothing saved before override, got %d rows", rows)
+	}
+
+	form.Set("barcode_check_override", "1")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newReceiptFormRequestWithSession("14", form))
+	if location := rr.Header().Get("Location"); location != "/tasker/pallets/14/receipt" {
+		t.Fatalf("expected overridden save, got %d %s", rr.Code, location)
+	}
+	var flagged bool
+	if err := db.R.NewRaw(`SELECT barcode_check_failed FROM pallet_receipts WHERE pallet_id = 14`).Scan(reqContext(), &flagged); err != nil {
+		t.Fatalf("read flag: %v", err)
+	}
+	if !flagged {
+		t.Fatalf("expected line flagged with failed check digit")
+	}
+}
+
+func TestCreateReceiptCommandHandler_RepeatedFormTokenIgnored(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 14)
+	handler := CreateReceiptCommandHandler(db, nil, nil)
+	form := url.Values{
+		"sku":        {"SKU-TAP"},
+		"qty":        {"3"},
+		"form_token": {formtoken.New()},
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newReceiptFormRequestWithSession("14", form))
+	if location := rr.Header().Get("Location"); location != "/tasker/pallets/14/receipt" {
+		t.Fatalf("expected first submit saved, got %d %s", rr.Code, location)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newReceiptFormRequestWithSession("14", form))
+	if location := rr.Header().Get("Location"); rr.Code != http.StatusSeeOther || !strings.Contains(location, "status=Receipt+already+saved") {
+		t.Fatalf("expected repeat submit flashed as already saved, got %d %s", rr.Code, location)
+	}
+	if rows, qty := countReceiptRows(t, db, 14); rows != 1 || qty != 3 {
+		t.Fatalf("expected quantity saved once, got rows=%d qty=%d", rows, qty)
+	}
+
+	form.Set("form_token", formtoken.New())
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newReceiptFormRequestWithSession("14", form))
+	if _, qty := countReceiptRows(t, db, 14); qty != 6 {
+		t.Fatalf("expected a fresh token to save again, got qty=%d", qty)
+	}
+}
+
+func TestCreateReceiptCommandHandler_HighValueSKUConfirmedBeforeSaving(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 15)
+	var itemID int64
+	if err := db.W.NewRaw(`INSERT INTO stock_items (project_id, sku, description) VALUES (1, 'SKU-GOLD', 'Gold watch') RETURNING id`).Scan(reqContext(), &itemID); err != nil {
+		t.Fatalf("seed stock item: %v", err)
+	}
+	if err := catalog.SetHighValue(reqContext(), db, nil, 1, 1, itemID, true); err != nil {
+		t.Fatalf("flag high value: %v", err)
+	}
+	handler := CreateReceiptCommandHandler(db, audit.NewService(), nil)
+	form := url.Values{
+		"sku":          {"SKU-GOLD"},
+		"description":  {"Gold watch"},
+		"qty":          {"2"},
+		"batch_number": {"LOT-9"},
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newReceiptFormRequestWithSession("15", form))
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK || !strings.Contains(body, "Confirm High-Value Item") || !strings.Contains(body, `name="batch_number" value="LOT-9"`) {
+		t.Fatalf("expected confirmation page replaying the form, got %d", rr.Code)
+	}
+	if rows, _ := countReceiptRows(t, db, 15); rows != 0 {
+		t.Fatalf("expected nothing saved before confirmation, got %d rows", rows)
+	}
+
+	req := newReceiptFormRequestWithSession("15", form)
+	req.Header.Set("Accept", "application/json")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "application/json") || !strings.Contains(rr.Body.String(), `"confirm"`) {
+		t.Fatalf("expected confirmation dialog for script posts, got %q", rr.Body.String())
+	}
+
+	form.Set("high_value_confirmed", "1")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newReceiptFormRequestWithSession("15", form))
+	if location := rr.Header().Get("Location"); location != "/tasker/pallets/15/receipt" {
+		t.Fatalf("expected confirmed save, got %d %s", rr.Code, location)
+	}
+	if rows, qty := countReceiptRows(t, db, 15); rows != 1 || qty != 2 {
+		t.Fatalf("expected confirmed line saved, got rows=%d qty=%d", rows, qty)
+	}
+	var shown, accepted int
+	if err := db.R.NewRaw(`SELECT
+	(SELECT COUNT(1) FROM audit_logs WHERE action = 'receipt.high_value_confirm_shown'),
+	(SELECT COUNT(1) FROM audit_logs WHERE action = 'receipt.high_value_confirmed')`).Scan(reqContext(), &shown, &accepted); err != nil {
+		t.Fatalf("count audit markers: %v", err)
+	}
+	if shown != 2 || accepted != 1 {
+		t.Fatalf("expected confirmation shown twice and accepted once, got shown=%d accepted=%d", shown, accepted)
+	}
+}
+
+func TestCreateReceiptCommandHandler_SerialTrackedSKUTakesOneSerialPerUnit(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 16)
+	seedPallet(t, db, 17)
+	var itemID int64
+	if err := db.W.NewRaw(`INSERT INTO stock_items (project_id, sku, description) VALUES (1, 'SKU-TV', 'Television') RETURNING id`).Scan(reqContext(), &itemID); err != nil {
+		t.Fatalf("seed stock item: %v", err)
+	}
+	if err := catalog.SetSerialTracked(reqContext(), db, nil, 1, 1, itemID, true); err != nil {
+		t.Fatalf("turn on serial tracking: %v", err)
+	}
+	handler := CreateReceiptCommandHandler(db, nil, nil)
+	post := func(palletID string, qty string, serials string) string {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newReceiptFormRequestWithSession(palletID, url.Values{
+			"sku":     {"SKU-TV"},
+			"qty":     {qty},
+			"serials": {serials},
+		}))
+		location, _ := url.QueryUnescape(rr.Header().Get("Location"))
+		return location
+	}
+
+	if location := post("16", "2", ""); !strings.Contains(location, "scan a serial number for each unit") {
+		t.Fatalf("expected serials required, got %s", location)
+	}
+	if location := post("16", "3", "TV-001\nTV-002"); !strings.Contains(location, "qty must match the number of serials scanned") {
+		t.Fatalf("expected count mismatch, got %s", location)
+	}
+	if location := post("16", "2", "TV-001\ntv-001"); !strings.Contains(location, "tv-001 was scanned twice") {
+		t.Fatalf("expected repeated serial refused, got %s", location)
+	}
+	if location := post("16", "2", "TV-001\nTV-002"); location != "/tasker/pallets/16/receipt" {
+		t.Fatalf("expected line saved, got %s", location)
+	}
+	if location := post("17", "1", "tv-002"); !strings.Contains(location, "tv-002 is on pallet P00000016") {
+		t.Fatalf("expected serial already received on another pallet refused, got %s", location)
+	}
+	if rows, qty := countReceiptRows(t, db, 17); rows != 0 || qty != 0 {
+		t.Fatalf("expected refused line not saved, got rows=%d qty=%d", rows, qty)
+	}
+
+	data, err := LoadPageData(reqContext(), db, 16)
+	if err != nil {
+		t.Fatalf("load page data: %v", err)
+	}
+	if len(data.SerialSKUs) != 1 || data.SerialSKUs[0] != "SKU-TV" {
+		t.Fatalf("expected serial SKU listed for the form, got %v", data.SerialSKUs)
+	}
+	if len(data.Lines) != 1 || strings.Join(data.Lines[0].Serials, ",") != "TV-001,TV-002" {
+		t.Fatalf("expected serials on the line, got %+v", data.Lines)
+	}
+}
+
 func TestCreateReceiptCommandHandler_UnknownSKUWithoutPhotoRedirectsError(t *testing.T) {
 	db := openTestDB(t)
 	seedPallet(t, db, 14)
-	handler := CreateReceiptCommandHandler(db, nil)
+	handler := CreateReceiptCommandHandler(db, nil, nil)
 
 	req := newReceiptFormRequestWithSession("14", url.Values{
 		"unknown_sku": {"1"},
@@ -183,7 +414,7 @@ func TestCreateReceiptCommandHandler_UnknownSKUWithoutPhotoRedirectsError(t *tes
 
 func TestCreateReceiptCommandHandler_InvalidMultipartRedirectsError(t *testing.T) {
 	db := openTestDB(t)
-	handler := CreateReceiptCommandHandler(db, nil)
+	handler := CreateReceiptCommandHandler(db, nil, nil)
 
 	req := newReceiptMultipartRequest("11", "multipart/form-data; boundary=bad", "not-a-valid-multipart-body")
 	rr := httptest.NewRecorder()
@@ -198,6 +429,72 @@ func TestCreateReceiptCommandHandler_InvalidMultipartRedirectsError(t *testing.T
 	}
 }
 
+func TestValidateReceiptCommandHandler_ReturnsEveryFieldErrorWithoutSaving(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 18)
+	handler := ValidateReceiptCommandHandler(db)
+	validate := func(form url.Values) string {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newReceiptFormRequestWithSession("18", form))
+		if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") {
+			t.Fatalf("expected html fragment, got %d %s", rr.Code, rr.Header().Get("Content-Type"))
+		}
+		return rr.Body.String()
+	}
+
+	body := validate(url.Values{
+		"qty":          {"4"},
+		"damaged_qty":  {"2"},
+		"item_barcode": {"5012345678901"},
+		"unknown_sku":  {""},
+	})
+	for _, want := range []string{
+		`data-valid="false"`,
+		`<p id="receipt_error_sku" class="receipt-field-error" role="alert">sku is required</p>`,
+		`<p id="receipt_error_qty" class="receipt-field-error" role="alert"></p>`,
+		`id="receipt_error_damage_reason" class="receipt-field-error" role="alert">damage reason is required`,
+		`id="receipt_error_item_barcode" class="receipt-field-error" role="alert">GS1 check digit is wrong: EAN-13 5012345678901 should end in 0.`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected %q in fragment, got %s", want, body)
+		}
+	}
+
+	body = validate(url.Values{"unknown_sku": {"1"}, "qty": {"1"}})
+	if !strings.Contains(body, "unknown sku requires at least one photo") {
+		t.Fatalf("expected unknown sku to need a photo, got %s", body)
+	}
+	body = validate(url.Values{
+		"unknown_sku":         {"1"},
+		"qty":                 {"1"},
+		"deferred_photo_name": {"box.jpg"},
+		"deferred_photo_type": {"image/jpeg"},
+		"deferred_photo_size": {"2048"},
+	})
+	if !strings.Contains(body, `data-valid="true"`) {
+		t.Fatalf("expected declared photo to satisfy unknown sku, got %s", body)
+	}
+
+	body = validate(url.Values{"sku": {"SKU-1"}, "qty": {"3"}})
+	if !strings.Contains(body, `data-valid="true"`) || !strings.Contains(body, `<p id="receipt_error_sku" class="receipt-field-error" role="alert"></p>`) {
+		t.Fatalf("expected a valid form, got %s", body)
+	}
+	if rows, _ := countReceiptRows(t, db, 18); rows != 0 {
+		t.Fatalf("expected validation never to save, got %d rows", rows)
+	}
+}
+
+func TestValidateReceiptCommandHandler_ReadOnlyPalletIsAFormError(t *testing.T) {
+	db := openTestDB(t)
+	seedPalletWithStatus(t, db, 19, "cancelled")
+	rr := httptest.NewRecorder()
+	ValidateReceiptCommandHandler(db).ServeHTTP(rr, newReceiptFormRequestWithSession("19", url.Values{"sku": {"SKU-1"}, "qty": {"1"}}))
+	body := rr.Body.String()
+	if !strings.Contains(body, `data-valid="false"`) || !strings.Contains(body, "cancelled pallets are read-only") {
+		t.Fatalf("expected read-only form error, got %s", body)
+	}
+}
+
 func TestItemUploadCSVTemplateHandler_RejectsNonLabelledPallet(t *testing.T) {
 	db := openTestDB(t)
 	seedPalletWithStatus(t, db, 200, "open")
@@ -513,6 +810,73 @@ func newReceiptFormRequest(palletID string, form url.Values) *http.Request {
 	return withPalletRouteParam(req, palletID)
 }
 
+func TestReceiptPageQueryHandler_CompactLayoutFromHintsAndCookie(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 12)
+	handler := ReceiptPageQueryHandler(db, nil)
+
+	render := func(mutate func(*http.Request)) *httptest.ResponseRecorder {
+		req := newReceiptFormRequestWithSession("12", nil)
+		req.Method = http.MethodGet
+		mutate(req)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rr.Code)
+		}
+		return rr
+	}
+
+	rr := render(func(*http.Request) {})
+	if strings.Contains(rr.Body.String(), "receipt_more_fields_toggle") {
+		t.Fatalf("expected standard layout without viewport hints")
+	}
+	if !strings.Contains(rr.Header().Get("Accept-CH"), "Sec-CH-Viewport-Width") {
+		t.Fatalf("expected viewport client hints to be requested, got %q", rr.Header().Get("Accept-CH"))
+	}
+
+	rr = render(func(req *http.Request) { req.Header.Set("Sec-CH-Viewport-Width", "360") })
+	if !strings.Contains(rr.Body.String(), "receipt_more_fields_toggle") || !strings.Contains(rr.Body.String(), "input-xl") {
+		t.Fatalf("expected compact layout for a narrow viewport")
+	}
+
+	rr = render(func(req *http.Request) {
+		req.Header.Set("Sec-CH-Viewport-Width", "360")
+		req.AddCookie(&http.Cookie{Name: layoutCookieName, Value: LayoutStandard})
+	})
+	if strings.Contains(rr.Body.String(), "receipt_more_fields_toggle") {
+		t.Fatalf("expected device setting to override viewport hints")
+	}
+
+	rr = render(func(req *http.Request) { req.AddCookie(&http.Cookie{Name: layoutCookieName, Value: LayoutCompact}) })
+	if !strings.Contains(rr.Body.String(), "receipt_more_fields_toggle") {
+		t.Fatalf("expected compact layout from device setting")
+	}
+}
+
+func TestReceiptLayoutCommandHandler_SetsDeviceCookie(t *testing.T) {
+	handler := ReceiptLayoutCommandHandler()
+
+	req := newReceiptFormRequest("12", url.Values{"layout": {"compact"}})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/tasker/pallets/12/receipt" {
+		t.Fatalf("expected redirect to receipt page, got %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != layoutCookieName || cookies[0].Value != LayoutCompact || cookies[0].MaxAge <= 0 {
+		t.Fatalf("expected persistent compact cookie, got %+v", cookies)
+	}
+
+	req = newReceiptFormRequest("12", url.Values{"layout": {"auto"}})
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	cookies = rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Fatalf("expected auto to clear the device cookie, got %+v", cookies)
+	}
+}
+
 func newReceiptFormRequestWithSession(palletID string, form url.Values) *http.Request {
 	req := newReceiptFormRequest(palletID, form)
 	session := models.Session{
@@ -544,3 +908,37 @@ func withPalletRouteParam(req *http.Request, palletID string) *http.Request {
 	ctx := stdcontext.WithValue(req.Context(), chi.RouteCtxKey, routeCtx)
 	return req.WithContext(ctx)
 }
+
+func TestSKUSuggestionList_EscapesStockText(t *testing.T) {
+	var b strings.Builder
+	list := skuSuggestionList(" <b> ", []models.StockItem{
+		{SKU: "SKU-1", Description: `Juice "<script>alert(1)</script>"`, UOM: "case"},
+		{SKU: "  "},
+	})
+	if err := sharedhtml.SuggestionsList(list).Render(stdcontext.Background(), &b); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	out := b.String()
+	if strings.Contains(out, "<script>") {
+		t.Fatalf("expected stock text escaped, got %s", out)
+	}
+	if strings.Count(out, `data-suggestion="1"`) != 1 {
+		t.Fatalf("expected one suggestion for the one non-blank sku, got %s", out)
+	}
+	for _, want := range []string{`id="sku_suggestions"`, `data-suggestions-for="sku_input"`, `data-suggestions-focus="qty_input"`, `data-sku="SKU-1"`, `data-uom="case"`, "SKU-1 - Juice"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %s in suggestions, got %s", want, out)
+		}
+	}
+	if strings.Contains(out, " hidden") {
+		t.Fatalf("expected list shown for a query, got %s", out)
+	}
+
+	b.Reset()
+	if err := sharedhtml.SuggestionsList(skuSuggestionList("ZZ", nil)).Render(stdcontext.Background(), &b); err != nil {
+		t.Fatalf("render empty: %v", err)
+	}
+	if !strings.Contains(b.String(), "No matching SKUs") {
+		t.Fatalf("expected no-match message, got %s", b.String())
+	}
+}
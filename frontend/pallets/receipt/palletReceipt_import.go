@@ -0,0 +1,239 @@
+package receipt
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/catalog"
+	"receipter/infrastructure/csvimport"
+	"receipter/infrastructure/sqlite"
+)
+
+// MaxImportRows caps the lines one receipt CSV can hold.
+const MaxImportRows = 1000
+
+// errReceiptImportRefused rolls back an import that a row broke a save rule in.
+var errReceiptImportRefused = errors.New("receipt import refused")
+
+// receiptImportColumns maps the header names a receipt CSV may use to the
+// receipt form field each one fills.
+var receiptImportColumns = map[string]string{
+	"sku":           "sku",
+	"qty":           "qty",
+	"case_size":     "case_size",
+	"batch":         "batch_number",
+	"batch_number":  "batch_number",
+	"expiry":        "expiry_date",
+	"expiry_date":   "expiry_date",
+	"damaged_qty":   "damaged_qty",
+	"damage_reason": "damage_reason",
+	"description":   "description",
+}
+
+// ReceiptImportError is one problem with a receipt CSV. Row is the line of
+// the file it was found on, or 0 when it is about the file as a whole.
+type ReceiptImportError struct {
+	Row     int
+	SKU     string
+	Message string
+}
+
+// ReceiptImport is the outcome of a receipt CSV import. Lines are only saved
+// when no row has an error, so Saved is 0 whenever Errors is not empty.
+type ReceiptImport struct {
+	Rows   int
+	Saved  int
+	Errors []ReceiptImportError
+}
+
+type receiptImportRow struct {
+	line  int
+	input ReceiptInput
+}
+
+// ImportReceiptCSV validates every row of a receipt CSV like the receipt form
+// and, when they all pass, saves them to the pallet in one transaction
+// through the same merge as a scanned line. Any failing row saves nothing,
+// so the corrected file can be imported again without doubling quantities.
+func ImportReceiptCSV(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID int64, userRoles []string, palletID int64, reader io.Reader, opts csvimport.Options) (ReceiptImport, error) {
+	var result ReceiptImport
+	if userID <= 0 {
+		return result, fmt.Errorf("invalid user id")
+	}
+	fail := func(row int, sku, message string) {
+		result.Errors = append(result.Errors, ReceiptImportError{Row: row, SKU: sku, Message: message})
+	}
+
+	r, err := csvimport.NewReader(reader, opts)
+	if err != nil {
+		fail(0, "", err.Error())
+		return result, nil
+	}
+	r.TrimLeadingSpace = true
+	r.FieldsPerRecord = -1
+
+	header, err := r.Read()
+	if err != nil {
+		fail(1, "", "the file has no header row")
+		return result, nil
+	}
+	columns, ok := resolveReceiptImportColumns(header)
+	if !ok {
+		fail(1, "", "invalid CSV header; expected at least sku,qty")
+		return result, nil
+	}
+
+	_, projectID, _, err := LoadPalletContext(ctx, db, palletID)
+	if err != nil {
+		return result, err
+	}
+
+	rows := make([]receiptImportRow, 0)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			fail(parseErr.Line, "", parseErr.Err.Error())
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		if isBlankRecord(record) {
+			continue
+		}
+		line, _ := r.FieldPos(0)
+		result.Rows++
+		if result.Rows > MaxImportRows {
+			fail(0, "", fmt.Sprintf("the file has more than %d lines; split it and import each part", MaxImportRows))
+			return result, nil
+		}
+
+		form := url.Values{}
+		for i, field := range columns {
+			if field != "" && i < len(record) {
+				form.Set(field, strings.TrimSpace(record[i]))
+			}
+		}
+		sku := form.Get("sku")
+
+		errs, err := ValidateReceiptValues(ctx, db, palletID, userRoles, form)
+		if err != nil {
+			return result, err
+		}
+		if errs.Form != "" {
+			result.Errors = []ReceiptImportError{{Message: errs.Form}}
+			return result, nil
+		}
+		if !errs.Valid() {
+			for _, message := range errs.InFormOrder() {
+				fail(line, sku, message.Message)
+			}
+			continue
+		}
+
+		highValue, err := catalog.IsHighValue(ctx, db, projectID, sku)
+		if err != nil {
+			return result, err
+		}
+		if highValue {
+			fail(line, sku, sku+" is a high-value item; receipt it on the receipt page so its details are checked")
+			continue
+		}
+
+		input, err := ReceiptInputFromValues(ctx, db, projectID, palletID, form)
+		if err != nil {
+			return result, err
+		}
+		input, err = normalizeReceiptInput(input)
+		if err != nil {
+			fail(line, sku, err.Error())
+			continue
+		}
+		rows = append(rows, receiptImportRow{line: line, input: input})
+	}
+	if result.Rows == 0 && len(result.Errors) == 0 {
+		fail(0, "", "the file has no lines to import")
+	}
+	if len(result.Errors) > 0 {
+		return result, nil
+	}
+
+	err = db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, row := range rows {
+			// Each row saves behind a savepoint so a refused row is undone on
+			// its own and the rows after it are still checked.
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT receipt_import_row"); err != nil {
+				return err
+			}
+			_, err := saveReceiptTx(ctx, tx, auditSvc, userID, row.input)
+			if err != nil {
+				if !IsRefusedReceipt(err) {
+					return err
+				}
+				fail(row.line, row.input.SKU, err.Error())
+				if _, err := tx.ExecContext(ctx, "ROLLBACK TO receipt_import_row"); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.ExecContext(ctx, "RELEASE receipt_import_row"); err != nil {
+				return err
+			}
+		}
+		if len(result.Errors) > 0 {
+			return errReceiptImportRefused
+		}
+		if auditSvc != nil {
+			after := map[string]any{"lines": len(rows)}
+			if err := auditSvc.Write(ctx, tx, userID, "receipt.import", "pallets", fmt.Sprintf("%d", palletID), nil, after); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errReceiptImportRefused) {
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	result.Saved = len(rows)
+	return result, nil
+}
+
+// resolveReceiptImportColumns finds the receipt field of each header column;
+// columns it does not know are left blank and ignored.
+func resolveReceiptImportColumns(header []string) ([]string, bool) {
+	columns := make([]string, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, raw := range header {
+		key := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(raw)), " ", "_")
+		field, ok := receiptImportColumns[key]
+		if !ok || seen[field] {
+			continue
+		}
+		columns[i] = field
+		seen[field] = true
+	}
+	return columns, seen["sku"] && seen["qty"]
+}
+
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package receipt
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/csvimport"
+	"receipter/infrastructure/live"
+	"receipter/infrastructure/sqlite"
+)
+
+// ImportReceiptLinesCommandHandler imports receipt lines for a pallet from an
+// uploaded CSV. A clean file saves every line and returns to the receipt
+// page; otherwise nothing is saved and the row errors are listed.
+func ImportReceiptLinesCommandHandler(db *sqlite.DB, auditSvc *audit.Service, hub *live.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parsePalletID(r)
+		if err != nil {
+			http.Error(w, "invalid pallet id", http.StatusBadRequest)
+			return
+		}
+		receiptPage := "/tasker/pallets/" + strconv.FormatInt(id, 10) + "/receipt"
+		if err := r.ParseMultipartForm(10 << 20); err != nil {
+			http.Redirect(w, r, receiptPage+"?error="+url.QueryEscape("invalid upload"), http.StatusSeeOther)
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Redirect(w, r, receiptPage+"?error="+url.QueryEscape("file is required"), http.StatusSeeOther)
+			return
+		}
+		defer file.Close()
+		opts, err := csvimport.ParseOptions(r.FormValue("encoding"), r.FormValue("delimiter"))
+		if err != nil {
+			http.Redirect(w, r, receiptPage+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+
+		session, _ := context.GetSessionFromContext(r.Context())
+		result, err := ImportReceiptCSV(r.Context(), db, auditSvc, session.UserID, session.UserRoles, id, file, opts)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "pallet not found", http.StatusNotFound)
+				return
+			}
+			slog.Error("receipt import failed", slog.Int64("pallet_id", id), slog.Any("err", err))
+			http.Redirect(w, r, receiptPage+"?error="+url.QueryEscape("failed to import receipt lines"), http.StatusSeeOther)
+			return
+		}
+		if len(result.Errors) > 0 {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			view := ReceiptImportView{PalletID: id, FileName: header.Filename, Rows: result.Rows, Errors: result.Errors}
+			if err := ReceiptImportErrorsPage(view).Render(r.Context(), w); err != nil {
+				slog.Error("receipt import: render errors failed", slog.Int64("pallet_id", id), slog.Any("err", err))
+			}
+			return
+		}
+
+		hub.Publish(id, live.EventLines)
+		status := fmt.Sprintf("Imported %d lines from %s.", result.Saved, header.Filename)
+		http.Redirect(w, r, receiptPage+"?status="+url.QueryEscape(status), http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,92 @@
+package receipt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"receipter/infrastructure/csvimport"
+	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/sqlite"
+)
+
+func importCSV(t *testing.T, db *sqlite.DB, palletID int64, text string) ReceiptImport {
+	t.Helper()
+	result, err := ImportReceiptCSV(context.Background(), db, nil, 1, []string{rbac.RoleAdmin}, palletID, strings.NewReader(text), csvimport.Options{})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	return result
+}
+
+func TestImportReceiptCSV_SavesEveryRowThroughTheMerge(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 1)
+
+	expiry := time.Now().AddDate(1, 0, 0).Format("02/01/2006")
+	result := importCSV(t, db, 1, fmt.Sprintf(`SKU,Qty,Case Size,Batch,Expiry,Damaged_Qty,Damage_Reason,Description
+ABC,2,6,B1,%[1]s,,,Alpha
+ABC,3,6,B1,%[1]s,,,Alpha
+
+DEF,4,1,,,1,wet,Delta
+`, expiry))
+	if len(result.Errors) != 0 {
+		t.Fatalf("expected a clean import, got %+v", result.Errors)
+	}
+	if result.Rows != 3 || result.Saved != 3 {
+		t.Fatalf("expected 3 rows saved, got %+v", result)
+	}
+	// The two ABC rows merge; DEF splits into a damaged and a good line.
+	rows, qty := countReceiptRows(t, db, 1)
+	if rows != 3 || qty != 9 {
+		t.Fatalf("expected 3 lines totalling 9, got %d lines totalling %d", rows, qty)
+	}
+}
+
+func TestImportReceiptCSV_ReportsEveryRowErrorAndSavesNothing(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 1)
+
+	result := importCSV(t, db, 1, `sku,qty,damaged_qty,damage_reason
+ABC,2,,
+,1,,
+DEF,x,,
+GHI,2,3,wet
+`)
+	want := []ReceiptImportError{
+		{Row: 3, Message: "sku is required"},
+		{Row: 4, SKU: "DEF", Message: "qty must be greater than 0"},
+		{Row: 5, SKU: "GHI", Message: "damaged qty cannot exceed qty"},
+	}
+	if fmt.Sprint(result.Errors) != fmt.Sprint(want) {
+		t.Fatalf("expected %+v, got %+v", want, result.Errors)
+	}
+	if rows, _ := countReceiptRows(t, db, 1); rows != 0 {
+		t.Fatalf("expected no lines saved, got %d", rows)
+	}
+
+	// Rules only checked on save still name their row and undo the rows
+	// saved before it.
+	result = importCSV(t, db, 1, `sku,qty,damaged_qty,damage_reason
+ABC,2,,
+DEF,2,1,not-a-reason
+`)
+	if len(result.Errors) != 1 || result.Errors[0].Row != 3 || result.Saved != 0 {
+		t.Fatalf("expected row 3 refused on save, got %+v", result)
+	}
+	if rows, _ := countReceiptRows(t, db, 1); rows != 0 {
+		t.Fatalf("expected the import rolled back, got %d lines", rows)
+	}
+}
+
+func TestImportReceiptCSV_RequiresSKUAndQtyColumns(t *testing.T) {
+	db := openTestDB(t)
+	seedPallet(t, db, 1)
+
+	result := importCSV(t, db, 1, "sku,description\nABC,Alpha\n")
+	if len(result.Errors) != 1 || result.Errors[0].Row != 1 {
+		t.Fatalf("expected a header error, got %+v", result.Errors)
+	}
+}
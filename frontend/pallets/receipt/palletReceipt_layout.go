@@ -0,0 +1,89 @@
+package receipt
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Receipt layout modes. Auto picks compact from viewport client hints;
+// a device can pin either mode through the layout cookie.
+const (
+	LayoutAuto     = "auto"
+	LayoutStandard = "standard"
+	LayoutCompact  = "compact"
+
+	layoutCookieName = "receipt_layout"
+	// compactViewportMaxWidth is the widest CSS viewport treated as a
+	// handheld scanner screen.
+	compactViewportMaxWidth = 480
+)
+
+func normalizeLayout(v string) string {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case LayoutStandard:
+		return LayoutStandard
+	case LayoutCompact:
+		return LayoutCompact
+	}
+	return LayoutAuto
+}
+
+// resolveLayout returns the device's layout setting and whether the compact
+// form should be rendered for this request.
+func resolveLayout(r *http.Request) (string, bool) {
+	setting := LayoutAuto
+	if c, err := r.Cookie(layoutCookieName); err == nil {
+		setting = normalizeLayout(c.Value)
+	}
+	switch setting {
+	case LayoutCompact:
+		return setting, true
+	case LayoutStandard:
+		return setting, false
+	}
+	for _, header := range []string{"Sec-CH-Viewport-Width", "Viewport-Width"} {
+		if width, err := strconv.Atoi(strings.TrimSpace(r.Header.Get(header))); err == nil && width > 0 {
+			return setting, width <= compactViewportMaxWidth
+		}
+	}
+	return setting, false
+}
+
+// requestViewportHints asks the browser to send viewport width on later
+// requests so auto mode can pick the layout server-side.
+func requestViewportHints(w http.ResponseWriter) {
+	w.Header().Set("Accept-CH", "Sec-CH-Viewport-Width, Viewport-Width")
+	w.Header().Add("Vary", "Sec-CH-Viewport-Width, Viewport-Width, Cookie")
+}
+
+// ReceiptLayoutCommandHandler stores the per-device layout setting and
+// returns to the receipt page.
+func ReceiptLayoutCommandHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parsePalletID(r)
+		if err != nil {
+			http.Error(w, "invalid pallet id", http.StatusBadRequest)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+		layout := normalizeLayout(r.FormValue("layout"))
+		cookie := &http.Cookie{
+			Name:     layoutCookieName,
+			Value:    layout,
+			Path:     "/tasker/pallets",
+			MaxAge:   365 * 24 * 60 * 60,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		}
+		if layout == LayoutAuto {
+			cookie.MaxAge = -1
+		}
+		http.SetCookie(w, cookie)
+		http.Redirect(w, r, fmt.Sprintf("/tasker/pallets/%d/receipt", id), http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,24 @@
+package receipt
+
+import "fmt"
+
+// renderReceiptLiveScript subscribes the page to the pallet's live stream and
+// swaps in the presence banner, stats strip and recorded lines as they change.
+func renderReceiptLiveScript(palletID int64) string {
+	return fmt.Sprintf(`<script>
+(function() {
+  if (!window.EventSource) return;
+  const source = new EventSource("/tasker/pallets/%d/receipt/live");
+  function patch(id) {
+    return function(event) {
+      const el = document.getElementById(id);
+      if (el) el.innerHTML = event.data;
+    };
+  }
+  source.addEventListener("presence", patch("receipt-presence"));
+  source.addEventListener("lines", patch("receipt-lines"));
+  source.addEventListener("stats", patch("receipt-stats"));
+  window.addEventListener("pagehide", function() { source.close(); });
+})();
+</script>`, palletID)
+}
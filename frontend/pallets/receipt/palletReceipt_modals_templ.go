@@ -0,0 +1,74 @@
+// Code generated by templ - DO NOT EDIT.
+
+// templ: version: v0.3.977
+package receipt
+
+//lint:file-ignore SA4006 This context is only used if a nested component is present.
+
+import "github.com/a-h/templ"
+import templruntime "github.com/a-h/templ/runtime"
+
+import (
+	"fmt"
+	"receipter/infrastructure/photocapture"
+)
+
+// scanModalAssets renders the barcode scanner, comment and stock photo
+// dialogs shared by the receipt form, with the scripts that drive them.
+// Photos are scaled and compressed to the project's capture settings.
+func scanModalAssets(capture photocapture.Config) templ.Component {
+	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
+		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
+		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
+			return templ_7745c5c3_CtxErr
+		}
+		templ_7745c5c3_Buffer, templ_7745c5c3_IsBuffer := templruntime.GetBuffer(templ_7745c5c3_W)
+		if !templ_7745c5c3_IsBuffer {
+			defer func() {
+				templ_7745c5c3_BufErr := templruntime.ReleaseBuffer(templ_7745c5c3_Buffer)
+				if templ_7745c5c3_Err == nil {
+					templ_7745c5c3_Err = templ_7745c5c3_BufErr
+				}
+			}()
+		}
+		ctx = templ.InitializeContext(ctx)
+		templ_7745c5c3_Var1 := templ.GetChildren(ctx)
+		if templ_7745c5c3_Var1 == nil {
+			templ_7745c5c3_Var1 = templ.NopComponent
+		}
+		ctx = templ.ClearChildren(ctx)
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<dialog id=\"scan-modal\" class=\"modal\"><div class=\"modal-box max-w-3xl\"><h3 class=\"text-lg font-semibold\">Scan Barcode</h3><div id=\"scan-reader\" class=\"mt-3 h-72 w-full overflow-hidden rounded-lg bg-neutral text-neutral-content\"></div><p id=\"scan-status\" class=\"mt-3 text-sm opacity-70\">Camera idle</p><div class=\"modal-action\"><button class=\"btn btn-lg w-full\" type=\"button\" onclick=\"closeScanModal()\">Close</button></div></div></dialog><script>\n\tlet scanTargetInput = null;\n\tlet quaggaRunning = false;\n\tlet onDetectedHandler = null;\n\n\tfunction setScanStatus(msg) {\n\t  const el = document.getElementById(\"scan-status\");\n\t  if (el) el.textContent = msg;\n\t}\n\n\tfunction loadQuaggaScript() {\n\t  if (window.Quagga) return Promise.resolve();\n\t  return new Promise((resolve, reject) => {\n\t    const s = document.createElement(\"script\");\n\t    s.src = \"https://cdn.jsdelivr.net/npm/@ericblade/quagga2@1.8.4/dist/quagga.min.js\";\n\t    s.onload = resolve;\n\t    s.onerror = reject;\n\t    document.head.appendChild(s);\n\t  });\n\t}\n\n\tasync function openScanModal(targetInputID) {\n\t  scanTargetInput = document.getElementById(targetInputID);\n\t  const modal = document.getElementById(\"scan-modal\");\n\t  if (!modal) return;\n\t  modal.showModal();\n\t  setScanStatus(\"Starting camera...\");\n\t  try {\n\t    await startScanner();\n\t  } catch (err) {\n\t    setScanStatus(\"Camera failed: \" + (err && err.message ? err.message : err));\n\t  }\n\t}\n\n\tfunction closeScanModal() {\n\t  stopScanner();\n\t  const modal = document.getElementById(\"scan-modal\");\n\t  if (modal && modal.open) modal.close();\n\t  setScanStatus(\"Camera idle\");\n\t}\n\n\tfunction closeReceiptLineEditor() {\n\t  const modal = document.getElementById(\"receipt-line-editor-modal\");\n\t  if (modal && modal.open) modal.close();\n\t}\n\n\tfunction updateCommentStatus() {\n\t  const input = document.getElementById(\"comment_input\");\n\t  const status = document.getElementById(\"comment_status\");\n\t  const openBtn = document.getElementById(\"comment_open_btn\");\n\t  if (!input || !status) return;\n\t  const hasComment = input.value.trim() !== \"\";\n\t  status.textContent = hasComment ? \"Comment added\" : \"No comment\";\n\t  status.className = hasComment ? \"text-sm text-success font-medium\" : \"text-sm text-base-content/60\";\n\t  if (openBtn) {\n\t    openBtn.textContent = hasComment ? \"Edit Comment\" : \"Add Comment\";\n\t  }\n\t}\n\n\tfunction openCommentModal() {\n\t  const modal = document.getElementById(\"comment-modal\");\n\t  const input = document.getElementById(\"comment_input\");\n\t  const textarea = document.getElementById(\"comment_modal_text\");\n\t  if (!modal || !input || !textarea) return;\n\t  textarea.value = input.value || \"\";\n\t  modal.showModal();\n\t  textarea.focus();\n\t  textarea.setSelectionRange(textarea.value.length, textarea.value.length);\n\t}\n\n\tfunction closeCommentModal() {\n\t  const modal = document.getElementById(\"comment-modal\");\n\t  if (modal && modal.open) modal.close();\n\t}\n\n\tfunction saveCommentValue() {\n\t  const input = document.getElementById(\"comment_input\");\n\t  const textarea = document.getElementById(\"comment_modal_text\");\n\t  if (!input || !textarea) return;\n\t  input.value = textarea.value.trim();\n\t  updateCommentStatus();\n\t  closeCommentModal();\n\t}\n\n\tfunction clearCommentValue() {\n\t  const input = document.getElementById(\"comment_input\");\n\t  const textarea = document.getElementById(\"comment_modal_text\");\n\t  if (input) input.value = \"\";\n\t  if (textarea) textarea.value = \"\";\n\t  updateCommentStatus();\n\t}\n\n\tasync function startScanner() {\n\t  if (quaggaRunning) return;\n\t  await loadQuaggaScript();\n\t  const target = document.getElementById(\"scan-reader\");\n\t  if (!target) throw new Error(\"scan target missing\");\n\n\t  await new Promise((resolve, reject) => {\n\t    window.Quagga.init({\n\t      inputStream: {\n\t        type: \"LiveStream\",\n\t        target: target,\n\t        constraints: {\n\t          facingMode: { ideal: \"environment\" }\n\t        }\n\t      },\n\t      decoder: {\n\t        readers: [\"code_128_reader\", \"ean_reader\", \"ean_8_reader\", \"upc_reader\", \"upc_e_reader\"]\n\t      },\n\t      locate: true\n\t    }, (err) => {\n\t      if (err) return reject(err);\n\t      return resolve();\n\t    });\n\t  });\n\n\t  if (onDetectedHandler) {\n\t    window.Quagga.offDetected(onDetectedHandler);\n\t  }\n\n\t  onDetectedHandler = function(result) {\n\t    const code = result && result.codeResult && result.codeResult.code;\n\t    if (!code || !scanTargetInput) return;\n\t    scanTargetInput.value = code;\n\t    closeScanModal();\n\t  };\n\t  window.Quagga.onDetected(onDetectedHandler);\n\t  window.Quagga.start();\n\t  quaggaRunning = true;\n\t  setScanStatus(\"Point the camera at a barcode\");\n\t}\n\n\tfunction stopScanner() {\n\t  if (!window.Quagga || !quaggaRunning) return;\n\t  if (onDetectedHandler) {\n\t    window.Quagga.offDetected(onDetectedHandler);\n\t  }\n\t  window.Quagga.stop();\n\t  quaggaRunning = false;\n\t}\n\n\t(function attachReceiptEnhancements() {\n\t  const toggle = document.getElementById(\"damaged_toggle\");\n\t  const damagedFields = document.getElementById(\"damaged_fields\");\n\t  if (toggle && damagedFields) {\n\t    toggle.addEventListener(\"click\", function() {\n\t      damagedFields.classList.toggle(\"hidden\");\n\t    });\n\t  }\n\n\t  const skuInput = document.getElementById(\"sku_input\");\n\t  const descriptionInput = document.getElementById(\"description_input\");\n\t  const uomInput = document.getElementById(\"uom_input\");\n\t  const cartonBarcodeInput = document.getElementById(\"carton_barcode\");\n\t  const itemBarcodeInput = document.getElementById(\"item_barcode\");\n\t  const qtyInput = document.getElementById(\"qty_input\");\n\t  const caseSizeInput = document.getElementById(\"case_size_input\");\n\t  const batchInput = document.getElementById(\"batch_input\");\n\t  const expiryInput = document.getElementById(\"expiry_input\");\n\t  const unknownSkuToggle = document.getElementById(\"unknown_sku_toggle\");\n\t  const unknownSkuInput = document.getElementById(\"unknown_sku_input\");\n\t  const unknownSkuHint = document.getElementById(\"unknown_sku_hint\");\n\t  const lineEditorModal = document.getElementById(\"receipt-line-editor-modal\");\n\t  const lineEditorForm = document.getElementById(\"receipt-line-editor-form\");\n\t  const lineDeleteForm = document.getElementById(\"receipt-line-delete-form\");\n\t  updateCommentStatus();\n\n\t  function setUnknownSkuFlag(enabled) {\n\t    if (!unknownSkuInput) return;\n\t    unknownSkuInput.value = enabled ? \"1\" : \"\";\n\t    if (unknownSkuHint) {\n\t      unknownSkuHint.classList.toggle(\"hidden\", !enabled);\n\t    }\n\t    if (unknownSkuToggle) {\n\t      unknownSkuToggle.classList.toggle(\"btn-warning\", enabled);\n\t      unknownSkuToggle.classList.toggle(\"btn-outline\", !enabled);\n\t      unknownSkuToggle.classList.toggle(\"text-white\", enabled);\n\t    }\n\t  }\n\n\t  if (unknownSkuToggle && unknownSkuInput) {\n\t    unknownSkuToggle.addEventListener(\"click\", function() {\n\t      const next = unknownSkuInput.value !== \"1\";\n\t      setUnknownSkuFlag(next);\n\t      if (next) {\n\t        if (skuInput && !skuInput.value.trim()) {\n\t          skuInput.value = \"UNKNOWN\";\n\t        }\n\t        if (descriptionInput && !descriptionInput.value.trim()) {\n\t          descriptionInput.value = \"Unidentifiable item\";\n\t        }\n\t        if (uomInput && !uomInput.value.trim()) {\n\t          uomInput.value = \"\";\n\t        }\n\t        if (typeof openPhotoModal === \"function\") {\n\t          openPhotoModal();\n\t        }\n\t      }\n\t    });\n\t  }\n\n\t  if (skuInput && unknownSkuInput) {\n\t    skuInput.addEventListener(\"input\", function() {\n\t      if (unknownSkuInput.value !== \"1\") return;\n\t      const current = skuInput.value.trim().toUpperCase();\n\t      if (current !== \"\" && current !== \"UNKNOWN\") {\n\t        setUnknownSkuFlag(false);\n\t      }\n\t    });\n\t  }\n\n\t  function wireEnterFocus(from, to) {\n\t    if (!from || !to) return;\n\t    from.addEventListener(\"keydown\", function(event) {\n\t      if (event.key !== \"Enter\") return;\n\t      event.preventDefault();\n\t      if (to.disabled) return;\n\t      to.focus();\n\t      if (typeof to.select === \"function\" && to.type !== \"date\") {\n\t        to.select();\n\t      }\n\t    });\n\t  }\n\n\t  // Quick-pick chips fill the expiry with today plus a shelf life.\n\t  document.querySelectorAll(\"[data-expiry-offset-months]\").forEach(function(chip) {\n\t    chip.addEventListener(\"click\", function() {\n\t      if (!expiryInput || expiryInput.disabled) return;\n\t      const months = parseInt(chip.getAttribute(\"data-expiry-offset-months\"), 10) || 0;\n\t      const date = new Date();\n\t      date.setMonth(date.getMonth() + months);\n\t      expiryInput.value = String(date.getDate()).padStart(2, \"0\") + \"/\" + String(date.getMonth() + 1).padStart(2, \"0\") + \"/\" + date.getFullYear();\n\t      expiryInput.focus();\n\t    });\n\t  });\n\n\t  wireEnterFocus(cartonBarcodeInput, itemBarcodeInput);\n\t  wireEnterFocus(itemBarcodeInput, qtyInput);\n\t  wireEnterFocus(qtyInput, caseSizeInput);\n\t  wireEnterFocus(caseSizeInput, batchInput);\n\t  wireEnterFocus(batchInput, expiryInput);\n\n\t  const receiptForm = document.querySelector(\"form[action^='/tasker/api/pallets/'][enctype='multipart/form-data']\");\n\t  if (receiptForm && unknownSkuInput) {\n\t    receiptForm.addEventListener(\"submit\", function(event) {\n\t      if (unknownSkuInput.value !== \"1\") return;\n\t      const photosInput = document.getElementById(\"stock_photos\");\n\t      const hasPhoto = photosInput && photosInput.files && photosInput.files.length > 0;\n\t      if (hasPhoto) return;\n\t      event.preventDefault();\n\t      if (unknownSkuHint) unknownSkuHint.classList.remove(\"hidden\");\n\t      if (typeof openPhotoModal === \"function\") {\n\t        openPhotoModal();\n\t      }\n\t    });\n\t  }\n\n\t  function applyLineEditorData(trigger) {\n\t    if (!trigger || !lineEditorForm || !lineDeleteForm || !lineEditorModal) return;\n\t    const palletID = String(trigger.getAttribute(\"data-pallet-id\") || \"\").trim();\n\t    const receiptID = String(trigger.getAttribute(\"data-receipt-id\") || \"\").trim();\n\t    if (!palletID || !receiptID) return;\n\n\t    lineEditorForm.action = \"/tasker/api/pallets/\" + encodeURIComponent(palletID) + \"/receipts/\" + encodeURIComponent(receiptID) + \"/update\";\n\t    lineDeleteForm.action = \"/tasker/api/pallets/\" + encodeURIComponent(palletID) + \"/receipts/\" + encodeURIComponent(receiptID) + \"/delete\";\n\n\t    const sku = document.getElementById(\"line_edit_sku\");\n\t    const description = document.getElementById(\"line_edit_description\");\n\t    const uom = document.getElementById(\"line_edit_uom\");\n\t    const comment = document.getElementById(\"line_edit_comment\");\n\t    const countryOfOrigin = document.getElementById(\"line_edit_country_of_origin\");\n\t    const hsCode = document.getElementById(\"line_edit_hs_code\");\n\t    const qty = document.getElementById(\"line_edit_qty\");\n\t    const caseSize = document.getElementById(\"line_edit_case_size\");\n\t    const batch = document.getElementById(\"line_edit_batch\");\n\t    const expiry = document.getElementById(\"line_edit_expiry\");\n\t    const damaged = document.getElementById(\"line_edit_damaged\");\n\t    const damagedQty = document.getElementById(\"line_edit_damaged_qty\");\n\t    const damageReason = document.getElementById(\"line_edit_damage_reason\");\n\n\t    if (sku) sku.value = String(trigger.getAttribute(\"data-sku\") || \"\");\n\t    if (description) description.value = String(trigger.getAttribute(\"data-description\") || \"\");\n\t    if (uom) uom.value = String(trigger.getAttribute(\"data-uom\") || \"\");\n\t    if (comment) comment.value = String(trigger.getAttribute(\"data-comment\") || \"\");\n\t    if (countryOfOrigin) countryOfOrigin.value = String(trigger.getAttribute(\"data-country-of-origin\") || \"\");\n\t    if (hsCode) hsCode.value = String(trigger.getAttribute(\"data-hs-code\") || \"\");\n\t    if (qty) qty.value = String(trigger.getAttribute(\"data-qty\") || \"\");\n\t    if (caseSize) caseSize.value = String(trigger.getAttribute(\"data-case-size\") || \"\");\n\t    if (batch) batch.value = String(trigger.getAttribute(\"data-batch\") || \"\");\n\t    if (expiry) expiry.value = String(trigger.getAttribute(\"data-expiry\") || \"\");\n\t    if (damaged) damaged.checked = String(trigger.getAttribute(\"data-damaged\") || \"0\") === \"1\";\n\t    if (damagedQty) damagedQty.value = String(trigger.getAttribute(\"data-damaged-qty\") || \"0\");\n\t    if (damageReason) {\n\t      const reasonCode = String(trigger.getAttribute(\"data-damage-reason\") || \"\");\n\t      if (reasonCode && !damageReason.querySelector(\"option[value='\" + CSS.escape(reasonCode) + \"']\")) {\n\t        const retired = document.createElement(\"option\");\n\t        retired.value = reasonCode;\n\t        retired.textContent = reasonCode;\n\t        damageReason.appendChild(retired);\n\t      }\n\t      damageReason.value = reasonCode;\n\t    }\n\t    lineEditorForm.querySelectorAll(\"[data-custom-field-id]\").forEach(function(input) {\n\t      input.value = String(trigger.getAttribute(\"data-custom-\" + input.getAttribute(\"data-custom-field-id\")) || \"\");\n\t    });\n\n\t    lineEditorModal.showModal();\n\t  }\n\n\t  // Delegated so rows pushed by the live stream stay clickable.\n\t  document.addEventListener(\"click\", function(event) {\n\t    const trigger = event.target.closest(\"[data-line-edit-trigger='1']\");\n\t    if (!trigger) {\n\t      return;\n\t    }\n\t    if (event.target.closest(\"a, button, input, select, textarea, form, label\")) {\n\t      return;\n\t    }\n\t    applyLineEditorData(trigger);\n\t  });\n\t})();\n\t</script><dialog id=\"comment-modal\" class=\"modal\"><div class=\"modal-box max-w-lg\"><h3 class=\"text-lg font-semibold\">Receipt Comment</h3><p class=\"mt-1 text-sm text-base-content/60\">Optional note for this line item.</p><textarea id=\"comment_modal_text\" class=\"textarea textarea-bordered w-full mt-3 min-h-32\" placeholder=\"Enter comment\"></textarea><div class=\"modal-action flex-col sm:flex-row gap-2\"><button class=\"btn btn-primary w-full sm:flex-1\" type=\"button\" onclick=\"saveCommentValue()\">Save Comment</button> <button class=\"btn btn-ghost w-full sm:flex-1\" type=\"button\" onclick=\"closeCommentModal()\">Cancel</button></div></div><form method=\"dialog\" class=\"modal-backdrop\"><button type=\"submit\">close</button></form></dialog> <dialog id=\"photo-modal\" class=\"modal\" data-max-dimension=\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var2 string
+		templ_7745c5c3_Var2, templ_7745c5c3_Err = templ.JoinStringErrs(fmt.Sprint(capture.MaxDimension))
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `frontend/pallets/receipt/palletReceipt_modals.templ`, Line: 357, Col: 93}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var2))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "\" data-quality=\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var3 string
+		templ_7745c5c3_Var3, templ_7745c5c3_Err = templ.JoinStringErrs(fmt.Sprint(capture.Quality))
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `frontend/pallets/receipt/palletReceipt_modals.templ`, Line: 357, Col: 138}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var3))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "\"><div class=\"modal-box max-w-3xl\"><h3 class=\"text-lg font-semibold\">Take Stock Photos</h3><div class=\"mt-3 relative\"><video id=\"photo-video\" class=\"w-full rounded-lg bg-neutral\" autoplay playsinline muted></video><canvas id=\"photo-canvas\" class=\"hidden\"></canvas><img id=\"photo-preview\" class=\"hidden w-full rounded-lg\" alt=\"Captured photo\"></div><p id=\"photo-modal-status\" class=\"mt-3 text-sm text-base-content/60\">Camera idle</p><div id=\"photo-modal-thumbs\" class=\"flex gap-2 mt-3 overflow-x-auto pb-1\"></div><div class=\"modal-action flex-col sm:flex-row gap-2\"><button id=\"photo-capture-btn\" class=\"btn btn-primary btn-lg w-full sm:flex-1\" type=\"button\" onclick=\"capturePhoto()\"><svg xmlns=\"http://www.w3.org/2000/svg\" fill=\"none\" viewBox=\"0 0 24 24\" stroke-width=\"2\" stroke=\"currentColor\" class=\"size-5\"><circle cx=\"12\" cy=\"12\" r=\"9\"></circle></svg> Take Photo</button> <button id=\"photo-retake-btn\" class=\"btn btn-outline btn-lg w-full sm:flex-1 hidden\" type=\"button\" onclick=\"retakePhoto()\">Retake</button> <button id=\"photo-add-btn\" class=\"btn btn-success btn-lg w-full sm:flex-1 hidden\" type=\"button\" onclick=\"addPhotoAndContinue()\">Add &amp; Take Another</button> <button id=\"photo-done-btn\" class=\"btn btn-primary btn-lg w-full sm:flex-1 hidden\" type=\"button\" onclick=\"addPhotoAndClose()\">Add &amp; Done</button> <button class=\"btn btn-ghost btn-lg w-full sm:flex-1\" type=\"button\" onclick=\"closePhotoModal()\">Dismiss</button></div></div></dialog><script>\n\tlet photoStream = null;\n\tlet capturedPhotos = [];\n\n\t// photoCaptureConfig reads the project's capture settings: the longest\n\t// side in pixels (0 for no limit) and the JPEG quality.\n\tfunction photoCaptureConfig() {\n\t  const modal = document.getElementById(\"photo-modal\");\n\t  const maxDimension = parseInt(modal && modal.dataset.maxDimension, 10) || 0;\n\t  const quality = parseFloat(modal && modal.dataset.quality) || 0.85;\n\t  return { maxDimension: maxDimension, quality: quality };\n\t}\n\n\t// scaledSize fits width x height within the configured longest side.\n\tfunction scaledSize(width, height) {\n\t  const maxDimension = photoCaptureConfig().maxDimension;\n\t  const longest = Math.max(width, height);\n\t  if (maxDimension <= 0 || longest <= maxDimension) {\n\t    return { width: width, height: height };\n\t  }\n\t  const scale = maxDimension / longest;\n\t  return { width: Math.round(width * scale), height: Math.round(height * scale) };\n\t}\n\n\t// shrinkPhotoFile scales a picked photo down to the configured longest\n\t// side. Photos the browser cannot decode, such as HEIC outside Safari, are\n\t// passed on unchanged for the server to check.\n\tfunction shrinkPhotoFile(file) {\n\t  const config = photoCaptureConfig();\n\t  if (config.maxDimension <= 0 || typeof createImageBitmap !== \"function\") {\n\t    return Promise.resolve(file);\n\t  }\n\t  return createImageBitmap(file).then(function(bitmap) {\n\t    const size = scaledSize(bitmap.width, bitmap.height);\n\t    if (size.width === bitmap.width && size.height === bitmap.height) {\n\t      bitmap.close();\n\t      return file;\n\t    }\n\t    const canvas = document.createElement(\"canvas\");\n\t    canvas.width = size.width;\n\t    canvas.height = size.height;\n\t    canvas.getContext(\"2d\").drawImage(bitmap, 0, 0, size.width, size.height);\n\t    bitmap.close();\n\t    return new Promise(function(resolve) {\n\t      canvas.toBlob(function(blob) {\n\t        if (!blob) {\n\t          resolve(file);\n\t          return;\n\t        }\n\t        const name = (file.name || \"stock_photo\").replace(/\\.[^.]*$/, \"\") + \".jpg\";\n\t        resolve(new File([blob], name, { type: \"image/jpeg\" }));\n\t      }, \"image/jpeg\", config.quality);\n\t    });\n\t  }).catch(function() {\n\t    return file;\n\t  });\n\t}\n\n\tfunction setPhotoStatus(msg) {\n\t  const el = document.getElementById(\"photo-modal-status\");\n\t  if (el) el.textContent = msg;\n\t}\n\n\tfunction renderPhotoThumbs(container) {\n\t  if (!container) container = document.getElementById(\"photo-modal-thumbs\");\n\t  if (!container) return;\n\t  container.innerHTML = \"\";\n\t  capturedPhotos.forEach(function(p, i) {\n\t    const wrap = document.createElement(\"div\");\n\t    wrap.className = \"relative shrink-0\";\n\t    const img = document.createElement(\"img\");\n\t    img.src = p.dataURL;\n\t    img.className = \"w-16 h-16 rounded-lg object-cover border border-base-300\";\n\t    img.alt = \"Photo \" + (i + 1);\n\t    const btn = document.createElement(\"button\");\n\t    btn.type = \"button\";\n\t    btn.className = \"btn btn-circle btn-xs btn-error absolute -top-2 -right-2\";\n\t    btn.innerHTML = \"&times;\";\n\t    btn.onclick = function(e) { e.preventDefault(); removePhoto(i); };\n\t    wrap.appendChild(img);\n\t    wrap.appendChild(btn);\n\t    container.appendChild(wrap);\n\t  });\n\t}\n\n\tfunction renderFormThumbs() {\n\t  const container = document.getElementById(\"photo-thumbs\");\n\t  if (!container) return;\n\t  container.innerHTML = \"\";\n\t  capturedPhotos.forEach(function(p, i) {\n\t    const wrap = document.createElement(\"div\");\n\t    wrap.className = \"relative shrink-0\";\n\t    const img = document.createElement(\"img\");\n\t    img.src = p.dataURL;\n\t    img.className = \"w-20 h-20 rounded-lg object-cover border border-base-300 shadow-sm\";\n\t    img.alt = \"Photo \" + (i + 1);\n\t    const btn = document.createElement(\"button\");\n\t    btn.type = \"button\";\n\t    btn.className = \"btn btn-circle btn-xs btn-error absolute -top-2 -right-2\";\n\t    btn.innerHTML = \"&times;\";\n\t    btn.onclick = function(e) { e.preventDefault(); removePhoto(i); };\n\t    wrap.appendChild(img);\n\t    wrap.appendChild(btn);\n\t    container.appendChild(wrap);\n\t  });\n\t}\n\n\tfunction removePhoto(index) {\n\t  capturedPhotos.splice(index, 1);\n\t  syncPhotosToInput();\n\t  renderPhotoThumbs();\n\t  renderFormThumbs();\n\t  updatePhotoStatus();\n\t}\n\n\tfunction updatePhotoStatus() {\n\t  const status = document.getElementById(\"photo-status\");\n\t  if (!status) return;\n\t  const n = capturedPhotos.length;\n\t  if (n === 0) {\n\t    status.textContent = \"No photos\";\n\t    status.className = \"text-sm text-base-content/60\";\n\t  } else {\n\t    status.textContent = n + \" photo\" + (n > 1 ? \"s\" : \"\") + \" attached\";\n\t    status.className = \"text-sm text-success font-medium\";\n\t  }\n\t}\n\n\tfunction syncPhotosToInput() {\n\t  const dt = new DataTransfer();\n\t  capturedPhotos.forEach(function(p, i) {\n\t    dt.items.add(new File([p.blob], p.name || \"stock_photo_\" + (i + 1) + \".jpg\", { type: p.type || \"image/jpeg\" }));\n\t  });\n\t  const input = document.getElementById(\"stock_photos\");\n\t  if (input) input.files = dt.files;\n\t}\n\n\t// addNativePhotos adds photos picked from the device's own file picker.\n\t// iPhones hand these over as HEIC, often with no type; the server\n\t// recognises and converts them, so the type is passed on as given.\n\t// Photos the browser can read are scaled down to the project's limit.\n\tfunction addNativePhotos(input) {\n\t  const files = Array.from(input.files || []);\n\t  input.value = \"\";\n\t  Promise.all(files.map(shrinkPhotoFile)).then(function(shrunk) {\n\t    shrunk.forEach(function(file) {\n\t      capturedPhotos.push({ blob: file, dataURL: URL.createObjectURL(file), name: file.name, type: file.type || \"application/octet-stream\" });\n\t    });\n\t    syncPhotosToInput();\n\t    renderFormThumbs();\n\t    updatePhotoStatus();\n\t  });\n\t}\n\n\tasync function openPhotoModal() {\n\t  const modal = document.getElementById(\"photo-modal\");\n\t  if (!modal) return;\n\t  modal.showModal();\n\t  resetPhotoUI();\n\t  renderPhotoThumbs();\n\t  setPhotoStatus(\"Starting camera...\");\n\t  try {\n\t    const video = document.getElementById(\"photo-video\");\n\t    photoStream = await navigator.mediaDevices.getUserMedia({\n\t      video: { facingMode: { ideal: \"environment\" }, width: { ideal: 1920 }, height: { ideal: 1080 } },\n\t      audio: false\n\t    });\n\t    video.srcObject = photoStream;\n\t    await video.play();\n\t    setPhotoStatus(capturedPhotos.length > 0 ? capturedPhotos.length + \" photo(s) so far. Position item and tap Take Photo\" : \"Position item and tap Take Photo\");\n\t  } catch (err) {\n\t    setPhotoStatus(\"Camera failed: \" + (err && err.message ? err.message : err));\n\t  }\n\t}\n\n\tfunction capturePhoto() {\n\t  const video = document.getElementById(\"photo-video\");\n\t  const canvas = document.getElementById(\"photo-canvas\");\n\t  const preview = document.getElementById(\"photo-preview\");\n\t  if (!video || !canvas || !preview) return;\n\n\t  const size = scaledSize(video.videoWidth, video.videoHeight);\n\t  canvas.width = size.width;\n\t  canvas.height = size.height;\n\t  const ctx = canvas.getContext(\"2d\");\n\t  ctx.drawImage(video, 0, 0, size.width, size.height);\n\n\t  preview.src = canvas.toDataURL(\"image/jpeg\", photoCaptureConfig().quality);\n\t  video.classList.add(\"hidden\");\n\t  preview.classList.remove(\"hidden\");\n\n\t  document.getElementById(\"photo-capture-btn\").classList.add(\"hidden\");\n\t  document.getElementById(\"photo-retake-btn\").classList.remove(\"hidden\");\n\t  document.getElementById(\"photo-add-btn\").classList.remove(\"hidden\");\n\t  document.getElementById(\"photo-done-btn\").classList.remove(\"hidden\");\n\t  setPhotoStatus(\"Photo captured. Add it or retake.\");\n\t}\n\n\tfunction retakePhoto() {\n\t  const video = document.getElementById(\"photo-video\");\n\t  const preview = document.getElementById(\"photo-preview\");\n\t  video.classList.remove(\"hidden\");\n\t  preview.classList.add(\"hidden\");\n\n\t  document.getElementById(\"photo-capture-btn\").classList.remove(\"hidden\");\n\t  document.getElementById(\"photo-retake-btn\").classList.add(\"hidden\");\n\t  document.getElementById(\"photo-add-btn\").classList.add(\"hidden\");\n\t  document.getElementById(\"photo-done-btn\").classList.add(\"hidden\");\n\t  setPhotoStatus(\"Position item and tap Take Photo\");\n\t}\n\n\tfunction addCurrentPhoto(callback) {\n\t  const canvas = document.getElementById(\"photo-canvas\");\n\t  if (!canvas) return;\n\t  const quality = photoCaptureConfig().quality;\n\t  canvas.toBlob(function(blob) {\n\t    if (!blob) return;\n\t    const dataURL = canvas.toDataURL(\"image/jpeg\", quality);\n\t    capturedPhotos.push({ blob: blob, dataURL: dataURL });\n\t    syncPhotosToInput();\n\t    renderPhotoThumbs();\n\t    renderFormThumbs();\n\t    updatePhotoStatus();\n\t    if (callback) callback();\n\t  }, \"image/jpeg\", quality);\n\t}\n\n\tfunction addPhotoAndContinue() {\n\t  addCurrentPhoto(function() {\n\t    resetPhotoUI();\n\t    renderPhotoThumbs();\n\t    setPhotoStatus(capturedPhotos.length + \" photo(s) taken. Take another or press Dismiss.\");\n\t  });\n\t}\n\n\tfunction addPhotoAndClose() {\n\t  addCurrentPhoto(function() {\n\t    closePhotoModal();\n\t  });\n\t}\n\n\tfunction resetPhotoUI() {\n\t  const video = document.getElementById(\"photo-video\");\n\t  const preview = document.getElementById(\"photo-preview\");\n\t  if (video) video.classList.remove(\"hidden\");\n\t  if (preview) preview.classList.add(\"hidden\");\n\t  document.getElementById(\"photo-capture-btn\").classList.remove(\"hidden\");\n\t  document.getElementById(\"photo-retake-btn\").classList.add(\"hidden\");\n\t  document.getElementById(\"photo-add-btn\").classList.add(\"hidden\");\n\t  document.getElementById(\"photo-done-btn\").classList.add(\"hidden\");\n\t}\n\n\tfunction closePhotoModal() {\n\t  if (photoStream) {\n\t    photoStream.getTracks().forEach(function(t) { t.stop(); });\n\t    photoStream = null;\n\t  }\n\t  const video = document.getElementById(\"photo-video\");\n\t  if (video) video.srcObject = null;\n\t  const modal = document.getElementById(\"photo-modal\");\n\t  if (modal && modal.open) modal.close();\n\t  updatePhotoStatus();\n\t}\n\t</script>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		return nil
+	})
+}
+
+var _ = templruntime.GeneratedTemplate
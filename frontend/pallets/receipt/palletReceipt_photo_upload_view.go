@@ -0,0 +1,208 @@
+package receipt
+
+import (
+	"fmt"
+
+	"receipter/infrastructure/photoupload"
+)
+
+// renderDeferredPhotoUploadScript saves receipts without their photos so the
+// scanner is not held up by slow Wi-Fi. Photos are kept in IndexedDB and sent
+// in resumable chunks; unfinished uploads continue on the next page load.
+func renderDeferredPhotoUploadScript() string {
+	return fmt.Sprintf(`<script>
+(function() {
+  if (!window.fetch || !window.indexedDB || !window.FormData) return;
+  const CHUNK_BYTES = %d;
+  const STORE = "uploads";
+
+  function getCookie(name) {
+    const prefix = name + "=";
+    const parts = document.cookie ? document.cookie.split(";") : [];
+    for (let i = 0; i < parts.length; i++) {
+      const c = parts[i].trim();
+      if (c.indexOf(prefix) === 0) return decodeURIComponent(c.substring(prefix.length));
+    }
+    return "";
+  }
+
+  function openStore() {
+    return new Promise(function(resolve, reject) {
+      const req = indexedDB.open("receipter-photo-uploads", 1);
+      req.onupgradeneeded = function() { req.result.createObjectStore(STORE, { keyPath: "url" }); };
+      req.onsuccess = function() { resolve(req.result); };
+      req.onerror = function() { reject(req.error); };
+    });
+  }
+
+  function storeOp(mode, fn) {
+    return openStore().then(function(db) {
+      return new Promise(function(resolve, reject) {
+        const tx = db.transaction(STORE, mode);
+        const result = fn(tx.objectStore(STORE));
+        tx.oncomplete = function() { db.close(); resolve(result && result.result); };
+        tx.onerror = function() { db.close(); reject(tx.error); };
+      });
+    });
+  }
+
+  function setStatus(text) {
+    let el = document.getElementById("deferred-photo-status");
+    if (!text) {
+      if (el) el.remove();
+      return;
+    }
+    if (!el) {
+      el = document.createElement("div");
+      el.id = "deferred-photo-status";
+      el.setAttribute("role", "status");
+      el.className = "toast toast-end toast-bottom z-50";
+      el.innerHTML = '<div class="alert alert-info alert-soft text-sm"><span></span></div>';
+      document.body.appendChild(el);
+    }
+    el.querySelector("span").textContent = text;
+  }
+
+  function sleep(ms) {
+    return new Promise(function(resolve) { setTimeout(resolve, ms); });
+  }
+
+  async function readState(url) {
+    const res = await fetch(url, { credentials: "same-origin", headers: { "Accept": "application/json" } });
+    if (res.status === 403 || res.status === 404) return null;
+    if (!res.ok) throw new Error("status " + res.status);
+    return res.json();
+  }
+
+  async function uploadOne(entry) {
+    let state = await readState(entry.url);
+    while (state && state.status === "uploading" && state.receivedBytes < state.totalBytes) {
+      const offset = state.receivedBytes;
+      const chunk = entry.blob.slice(offset, Math.min(offset + CHUNK_BYTES, state.totalBytes));
+      const res = await fetch(entry.url + "?offset=" + offset, {
+        method: "PUT",
+        credentials: "same-origin",
+        headers: { "X-CSRF-Token": getCookie("X-CSRF-Token"), "Content-Type": "application/octet-stream" },
+        body: chunk
+      });
+      if (res.status === 403 || res.status === 404) return;
+      if (!res.ok && res.status !== 409) throw new Error("chunk " + res.status);
+      state = await res.json();
+    }
+  }
+
+  let running = false;
+  async function drain() {
+    if (running) return;
+    running = true;
+    try {
+      let failures = 0;
+      for (;;) {
+        const entries = await storeOp("readonly", function(store) { return store.getAll(); });
+        if (!entries || entries.length === 0) break;
+        setStatus("Uploading " + entries.length + " photo" + (entries.length > 1 ? "s" : "") + "...");
+        try {
+          await uploadOne(entries[0]);
+          failures = 0;
+          await storeOp("readwrite", function(store) { return store.delete(entries[0].url); });
+        } catch (err) {
+          failures++;
+          if (failures > 6) {
+            setStatus("Photo upload paused; it will resume when the connection returns.");
+            return;
+          }
+          await sleep(Math.min(30000, 1000 * Math.pow(2, failures)));
+        }
+      }
+      setStatus("");
+    } finally {
+      running = false;
+    }
+  }
+
+  // confirmHighValue shows the server's confirmation for a high-value SKU
+  // and resolves to whether the scanner confirmed it.
+  function confirmHighValue(html) {
+    return new Promise(function(resolve) {
+      const dialog = document.createElement("dialog");
+      dialog.className = "modal";
+      const box = document.createElement("div");
+      box.className = "modal-box max-w-2xl";
+      box.innerHTML = html;
+      dialog.appendChild(box);
+      function finish(confirmed) {
+        dialog.remove();
+        resolve(confirmed);
+      }
+      dialog.addEventListener("click", function(event) {
+        const choice = event.target.closest("[data-high-value-choice]");
+        if (!choice) return;
+        dialog.close();
+        finish(choice.getAttribute("data-high-value-choice") === "confirm");
+      });
+      dialog.addEventListener("cancel", function() { finish(false); });
+      document.body.appendChild(dialog);
+      dialog.showModal();
+    });
+  }
+
+  const form = document.querySelector("form[action^='/tasker/api/pallets/'][enctype='multipart/form-data']");
+  const photosInput = document.getElementById("stock_photos");
+  if (form && photosInput) {
+    form.addEventListener("submit", async function(event) {
+      if (event.defaultPrevented) return;
+      const files = Array.from(photosInput.files || []);
+      if (files.length === 0) return;
+      event.preventDefault();
+      const submit = form.querySelector("button[type='submit']");
+      if (submit) submit.disabled = true;
+
+      const data = new FormData(form);
+      data.delete("stock_photos");
+      files.forEach(function(file) {
+        data.append("deferred_photo_name", file.name);
+        data.append("deferred_photo_type", file.type);
+        data.append("deferred_photo_size", String(file.size));
+      });
+      let saved;
+      try {
+        for (;;) {
+          const res = await fetch(form.action, { method: "POST", body: data, credentials: "same-origin", headers: { "Accept": "application/json" } });
+          if ((res.headers.get("Content-Type") || "").indexOf("application/json") !== 0) {
+            window.location.assign(res.url);
+            return;
+          }
+          saved = await res.json();
+          if (!saved.confirm) break;
+          // High-value SKUs come back for confirmation; the photos stay
+          // here and go with the confirmed post.
+          if (!(await confirmHighValue(saved.confirm))) {
+            if (submit) submit.disabled = false;
+            return;
+          }
+          data.set("high_value_confirmed", "1");
+        }
+      } catch (err) {
+        form.submit();
+        return;
+      }
+      try {
+        await storeOp("readwrite", function(store) {
+          saved.uploads.forEach(function(upload, i) { store.put({ url: upload.url, blob: files[i] }); });
+        });
+      } catch (err) {
+        // Without local storage the photos must go up before leaving the page.
+        setStatus("Uploading photos...");
+        for (let i = 0; i < saved.uploads.length; i++) {
+          try { await uploadOne({ url: saved.uploads[i].url, blob: files[i] }); } catch (uploadErr) {}
+        }
+      }
+      window.location.assign(saved.redirect);
+    });
+  }
+
+  drain();
+  window.addEventListener("online", drain);
+})();
+</script>`, photoupload.MaxChunkBytes)
+}
@@ -0,0 +1,115 @@
+package receipt
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/photoretention"
+	"receipter/infrastructure/sqlite"
+)
+
+func redactPageURL(palletID, receiptID int64) string {
+	return fmt.Sprintf("/tasker/pallets/%d/receipts/%d/photos/redact", palletID, receiptID)
+}
+
+// RedactPhotosPageQueryHandler lists a receipt line's photos for an admin to
+// blur or delete, with the stubs of earlier redactions.
+func RedactPhotosPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		palletID, err := parsePalletID(r)
+		if err != nil {
+			http.Error(w, "invalid pallet id", http.StatusBadRequest)
+			return
+		}
+		receiptID, err := parseReceiptID(r)
+		if err != nil {
+			http.Error(w, "invalid receipt id", http.StatusBadRequest)
+			return
+		}
+		data, err := LoadRedactPageData(r.Context(), db, palletID, receiptID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "receipt line not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to load photos", http.StatusInternalServerError)
+			return
+		}
+		data.Status = r.URL.Query().Get("status")
+		data.ErrorMessage = r.URL.Query().Get("error")
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := RedactPhotosPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render photos", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// RedactPhotoCommandHandler blurs or deletes one photo of the receipt line.
+func RedactPhotoCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		palletID, err := parsePalletID(r)
+		if err != nil {
+			http.Error(w, "invalid pallet id", http.StatusBadRequest)
+			return
+		}
+		receiptID, err := parseReceiptID(r)
+		if err != nil {
+			http.Error(w, "invalid receipt id", http.StatusBadRequest)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+		pageURL := redactPageURL(palletID, receiptID)
+
+		// Only photos currently shown for this line can be redacted from it.
+		data, err := LoadRedactPageData(r.Context(), db, palletID, receiptID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "receipt line not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to load photos", http.StatusInternalServerError)
+			return
+		}
+		photoID, _ := strconv.ParseInt(r.FormValue("photo_id"), 10, 64)
+		ref := photoretention.Ref{Source: strings.TrimSpace(r.FormValue("source")), ID: photoID}
+		var photo *RedactPhotoView
+		for i := range data.Photos {
+			if data.Photos[i].Source == ref.Source && data.Photos[i].ID == ref.ID {
+				photo = &data.Photos[i]
+				break
+			}
+		}
+		if photo == nil {
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape(photoretention.ErrNotFound.Error()), http.StatusSeeOther)
+			return
+		}
+
+		action := strings.TrimSpace(r.FormValue("action"))
+		if err := photoretention.Redact(r.Context(), db, auditSvc, session.UserID, ref, action, r.FormValue("note")); err != nil {
+			msg := "failed to redact photo"
+			if errors.Is(err, photoretention.ErrInvalidAction) || errors.Is(err, photoretention.ErrCannotBlur) || errors.Is(err, photoretention.ErrNotFound) {
+				msg = err.Error()
+			}
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape(msg), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, pageURL+"?status="+url.QueryEscape(photo.Label+" "+action), http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,75 @@
+package receipt
+
+// renderSerialCaptureScript shows the serial number card when the SKU entered
+// is serial-tracked. Each scan adds a serial, repeats within the line are
+// refused, and qty is locked to the number scanned. The server checks the
+// serials against the rest of the project when the line is saved.
+func renderSerialCaptureScript() string {
+	return `<script>
+(function() {
+  const card = document.getElementById("serial_fields");
+  const skuInput = document.getElementById("sku_input");
+  const scanInput = document.getElementById("serial_scan_input");
+  const list = document.getElementById("serial_list");
+  const hidden = document.getElementById("serials_input");
+  const qtyInput = document.getElementById("qty_input");
+  if (!card || !skuInput || !scanInput || !list || !hidden || !qtyInput) return;
+  const tracked = new Set(card.dataset.serialSkus.split("\n").map(function(sku) { return sku.trim().toLowerCase(); }));
+  let serials = [];
+
+  function render() {
+    list.replaceChildren();
+    serials.forEach(function(serial, i) {
+      const chip = document.createElement("span");
+      chip.className = "badge badge-outline badge-lg font-mono gap-1";
+      chip.textContent = serial;
+      const remove = document.createElement("button");
+      remove.type = "button";
+      remove.className = "btn btn-ghost btn-xs btn-circle";
+      remove.textContent = "×";
+      remove.title = "Remove " + serial;
+      remove.addEventListener("click", function() {
+        serials.splice(i, 1);
+        render();
+      });
+      chip.appendChild(remove);
+      list.appendChild(chip);
+    });
+    hidden.value = serials.join("\n");
+    if (!card.classList.contains("hidden")) {
+      qtyInput.value = serials.length > 0 ? String(serials.length) : "";
+    }
+  }
+
+  function sync() {
+    const on = tracked.has(skuInput.value.trim().toLowerCase());
+    if (on === !card.classList.contains("hidden")) return;
+    card.classList.toggle("hidden", !on);
+    qtyInput.readOnly = on;
+    serials = [];
+    render();
+  }
+
+  scanInput.addEventListener("keydown", function(event) {
+    if (event.key !== "Enter") return;
+    event.preventDefault();
+    const serial = scanInput.value.trim();
+    scanInput.value = "";
+    scanInput.setCustomValidity("");
+    if (serial === "") return;
+    const key = serial.toLowerCase();
+    if (serials.some(function(s) { return s.toLowerCase() === key; })) {
+      scanInput.setCustomValidity(serial + " was already scanned on this line");
+      scanInput.reportValidity();
+      return;
+    }
+    serials.push(serial);
+    render();
+  });
+  scanInput.addEventListener("input", function() { scanInput.setCustomValidity(""); });
+  skuInput.addEventListener("input", sync);
+  skuInput.addEventListener("change", sync);
+  sync();
+})();
+</script>`
+}
@@ -0,0 +1,46 @@
+package receipt
+
+import "fmt"
+
+// scannerSoundGain maps the scanner.volume preference to an oscillator gain.
+func scannerSoundGain(volume string) float64 {
+	switch volume {
+	case "low":
+		return 0.05
+	case "high":
+		return 0.35
+	}
+	return 0.15
+}
+
+// renderScannerSoundScript plays a short beep when the page loads after a
+// receipt line was submitted from it, or a low buzz when the submission was
+// refused. A session flag set on submit keeps plain page loads silent.
+func renderScannerSoundScript(volume string, refused bool) string {
+	return fmt.Sprintf(`<script>
+(function() {
+  const AudioCtx = window.AudioContext || window.webkitAudioContext;
+  if (!AudioCtx || !window.sessionStorage) return;
+  const FLAG = "receipter-receipt-submitted";
+  const form = document.getElementById("receipt-form");
+  if (form) {
+    form.addEventListener("submit", function() { sessionStorage.setItem(FLAG, "1"); });
+  }
+  if (sessionStorage.getItem(FLAG) !== "1") return;
+  sessionStorage.removeItem(FLAG);
+  const refused = %t;
+  try {
+    const ctx = new AudioCtx();
+    const osc = ctx.createOscillator();
+    const gain = ctx.createGain();
+    osc.type = refused ? "square" : "sine";
+    osc.frequency.value = refused ? 180 : 1200;
+    gain.gain.value = %.2f;
+    osc.connect(gain);
+    gain.connect(ctx.destination);
+    osc.start();
+    osc.stop(ctx.currentTime + (refused ? 0.4 : 0.12));
+  } catch (e) {}
+})();
+</script>`, refused, scannerSoundGain(volume))
+}
@@ -0,0 +1,80 @@
+package receipt
+
+import (
+	"strings"
+	"time"
+
+	sharedhtml "receipter/frontend/shared/html"
+	"receipter/models"
+)
+
+// skuSuggestionList lists the stock items matching q under the SKU input.
+// Picking one fills the SKU, description and unit of measure and moves on
+// to the quantity.
+func skuSuggestionList(q string, items []models.StockItem) sharedhtml.SuggestionList {
+	list := sharedhtml.SuggestionList{
+		ID:      "sku_suggestions",
+		InputID: "sku_input",
+		Fill: map[string]string{
+			"sku":         "sku_input",
+			"description": "description_input",
+			"uom":         "uom_input",
+		},
+		FocusID: "qty_input",
+		Open:    strings.TrimSpace(q) != "",
+		Empty:   "No matching SKUs",
+		Items:   make([]sharedhtml.Suggestion, 0, len(items)),
+	}
+	for _, item := range items {
+		sku := strings.TrimSpace(item.SKU)
+		if sku == "" {
+			continue
+		}
+		desc := strings.TrimSpace(item.Description)
+		uom := strings.TrimSpace(item.UOM)
+		label := sku
+		if desc != "" {
+			label = sku + " - " + desc
+		}
+		if uom != "" {
+			label += " (" + uom + ")"
+		}
+		list.Items = append(list.Items, sharedhtml.Suggestion{
+			Label: label,
+			Data:  map[string]string{"sku": sku, "description": desc, "uom": uom},
+		})
+	}
+	return list
+}
+
+// batchOptionsAction fetches the batch suggestions for the SKU currently in
+// the form, filtered by what has been typed into the batch input.
+const batchOptionsAction = "@get('/tasker/api/stock/batches/options?sku=' + encodeURIComponent(document.getElementById('sku_input').value) + '&q=' + encodeURIComponent(el.value), {openWhenHidden: true})"
+
+// batchSuggestionList lists the batches already receipted for the SKU under
+// the batch input. Picking one fills the batch and its expiry. The list
+// stays hidden when the SKU has no earlier batches.
+func batchSuggestionList(batches []BatchSuggestion) sharedhtml.SuggestionList {
+	list := sharedhtml.SuggestionList{
+		ID:      "batch_suggestions",
+		InputID: "batch_input",
+		Fill: map[string]string{
+			"batch":  "batch_input",
+			"expiry": "expiry_input",
+		},
+		FocusID: "expiry_input",
+		Open:    len(batches) > 0,
+		Items:   make([]sharedhtml.Suggestion, 0, len(batches)),
+	}
+	for _, batch := range batches {
+		label := batch.BatchNumber
+		if expiry, err := time.Parse("2006-01-02", batch.ExpiryDate); err == nil {
+			label += " (exp " + expiry.Format("02/01/2006") + ")"
+		}
+		list.Items = append(list.Items, sharedhtml.Suggestion{
+			Label: label,
+			Data:  map[string]string{"batch": batch.BatchNumber, "expiry": batch.ExpiryDate},
+		})
+	}
+	return list
+}
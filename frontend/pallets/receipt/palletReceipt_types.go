@@ -1,6 +1,18 @@
 package receipt
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"receipter/infrastructure/customfield"
+	"receipter/infrastructure/customs"
+	"receipter/infrastructure/helpnotice"
+	"receipter/infrastructure/pallets"
+	"receipter/infrastructure/photocapture"
+	"receipter/infrastructure/photoretention"
+	"receipter/infrastructure/photoupload"
+	"receipter/models"
+)
 
 type PhotoInput struct {
 	Blob     []byte
@@ -19,6 +31,7 @@ type ReceiptInput struct {
 	UnknownSKU     bool
 	Damaged        bool
 	DamagedQty     int64
+	DamageReason   string
 	BatchNumber    string
 	ExpiryDate     *time.Time
 	CartonBarcode  string
@@ -27,32 +40,114 @@ type ReceiptInput struct {
 	StockPhotoMIME string
 	StockPhotoName string
 	Photos         []PhotoInput
+	// DeferredPhotos are uploaded separately after the receipt is saved.
+	DeferredPhotos []photoupload.Pending
+	// PhotosInternal holds every photo captured with the line back from
+	// client users; see photovisibility.
+	PhotosInternal bool
 	NoOuterBarcode bool
 	NoInnerBarcode bool
+	// BarcodeCheckFailed records that a barcode failed its GS1 check digit
+	// and the scanner saved it anyway.
+	BarcodeCheckFailed bool
+	// CountryOfOrigin and HSCode are the submitted customs data; see customs.
+	CountryOfOrigin string
+	HSCode          string
+	// CustomValues holds submitted project custom field values by field id.
+	CustomValues map[int64]string
+	// FormToken, when set, is recorded with the receipt so a repeated
+	// submission of the same form is refused.
+	FormToken string
+	// HighValueConfirmed records that the scanner confirmed the details of
+	// a high-value SKU before saving.
+	HighValueConfirmed bool
+	// Serials are the unit serial numbers scanned for a serial-tracked SKU,
+	// one per unit.
+	Serials []string
+}
+
+// HighValueConfirmView shows the details entered for a high-value SKU in
+// large type for the scanner to confirm before the line is saved.
+type HighValueConfirmView struct {
+	PalletID    int64
+	SKU         string
+	Description string
+	UOM         string
+	Qty         int64
+	CaseSize    int64
+	DamagedQty  int64
+	BatchNumber string
+	// Expiry is dd/mm/yyyy, or blank for lines without an expiry.
+	Expiry string
+	Photos int
+	// Fields replays the submitted form, without its files, when the
+	// scanner confirms from the full-page confirmation.
+	Fields []ConfirmField
+}
+
+// ConfirmField is one submitted form value.
+type ConfirmField struct {
+	Name  string
+	Value string
+}
+
+// ReceiptImportView lists the row errors that stopped a receipt CSV import.
+type ReceiptImportView struct {
+	PalletID int64
+	FileName string
+	Rows     int
+	Errors   []ReceiptImportError
+}
+
+// SavedReceipt identifies the line photos were attached to and the uploads
+// reserved for any deferred photos.
+type SavedReceipt struct {
+	ReceiptID int64
+	Uploads   []models.PhotoUpload
 }
 
 type ReceiptLineView struct {
-	ID              int64
-	SKU             string
-	Description     string
-	UOM             string
-	Comment         string
-	Qty             int64
-	CaseSize        int64
-	UnknownSKU      bool
-	Damaged         bool
-	DamagedQty      int64
-	BatchNumber     string
-	ExpiryDateUK    string
-	ExpiryDateISO   string
-	CartonBarcode   string
-	ItemBarcode     string
-	HasPhoto        bool
-	HasPrimaryPhoto bool
-	PhotoIDs        []int64
-	PhotoCount      int
-	NoOuterBarcode  bool
-	NoInnerBarcode  bool
+	ID                int64
+	SKU               string
+	Description       string
+	UOM               string
+	Comment           string
+	Qty               int64
+	CaseSize          int64
+	UnknownSKU        bool
+	Damaged           bool
+	DamagedQty        int64
+	DamageReason      string
+	DamageReasonLabel string
+	BatchNumber       string
+	ExpiryDateUK      string
+	ExpiryDateISO     string
+	CartonBarcode     string
+	ItemBarcode       string
+	HasPhoto          bool
+	HasPrimaryPhoto   bool
+	PhotoIDs          []int64
+	PhotoCount        int
+	PhotosPending     int
+	PhotosFailed      int
+	NoOuterBarcode    bool
+	NoInnerBarcode    bool
+	CountryOfOrigin   string
+	HSCode            string
+	CustomValues      []customfield.Value
+	Serials           []string
+}
+
+type CustomFieldInput struct {
+	ID       int64
+	Label    string
+	Type     string
+	Required bool
+}
+
+type DamageReasonOption struct {
+	Code  string
+	Label string
 }
 
 type PageData struct {
@@ -62,12 +157,141 @@ type PageData struct {
 	ClientName          string
 	ProjectStatus       string
 	PalletStatus        string
+	PalletType          string
+	DeliveryReference   string
 	IsAdmin             bool
 	IsScanner           bool
 	CanEdit             bool
 	CanManageLines      bool
 	CanFinish           bool
 	CanPrintClosedLabel bool
-	Message             string
-	Lines               []ReceiptLineView
+	// CanImportLines shows the CSV import of receipt lines, which is
+	// admin-only.
+	CanImportLines bool
+	// VerifyBeforeClose sends Finish through the verification scan.
+	VerifyBeforeClose bool
+	// Phase names the project phase the pallet belongs to, if any; a
+	// closed phase leaves the pallet read-only for everyone.
+	Phase       string
+	PhaseClosed bool
+	// Layout is the device's layout setting; Compact is what was resolved
+	// for this request.
+	Layout        string
+	Compact       bool
+	Message       string
+	DamageReasons []DamageReasonOption
+	CustomFields  []CustomFieldInput
+	// Customs is which customs fields the project captures on each line.
+	Customs customs.Config
+	Lines   []ReceiptLineView
+	// FormToken makes the receipt form single-use; see formtoken.
+	FormToken string
+	// ScannerSound plays a tone at ScannerVolume after a line is submitted;
+	// Refused picks the error tone.
+	ScannerSound  bool
+	ScannerVolume string
+	Refused       bool
+	// CanExportOwnLines offers a scanner the CSV of the lines they scanned
+	// on this pallet; kiosk sessions are shared, so they never get it.
+	CanExportOwnLines bool
+	// Stats is the pace strip above the receipt form.
+	Stats ReceiptStats
+	// ClaimedBy names another user who is working this pallet, and
+	// ClaimIdleMinutes how long ago they last did; empty when the viewer
+	// holds the claim or nobody does.
+	ClaimedBy        string
+	ClaimIdleMinutes int
+	// Notices are admin-written site instructions for the viewer's role on
+	// this project, shown as banners until dismissed.
+	Notices []helpnotice.Notice
+	// PhotoCapture is how the camera scales and compresses stock photos.
+	PhotoCapture photocapture.Config
+	// SerialSKUs are the project's serial-tracked SKUs; the form asks for a
+	// serial per unit when one of them is entered.
+	SerialSKUs []string
+}
+
+// claimWindowMinutes is quoted in the in-use warning.
+var claimWindowMinutes = int(pallets.ClaimWindow / time.Minute)
+
+// ClaimIdleText says when the claim holder last worked the pallet.
+func (d PageData) ClaimIdleText() string {
+	switch d.ClaimIdleMinutes {
+	case 0:
+		return "active just now"
+	case 1:
+		return "last active 1 minute ago"
+	}
+	return fmt.Sprintf("last active %d minutes ago", d.ClaimIdleMinutes)
+}
+
+// ReceiptStats sums the pallet's lines and the viewer's recent captures.
+// Captures are counted from the audit log, so units merged into an existing
+// line count towards whoever scanned them.
+type ReceiptStats struct {
+	Lines           int64 `bun:"lines"`
+	Units           int64 `bun:"units"`
+	MyUnitsLastHour int64 `bun:"my_units_last_hour"`
+	// SecondsSinceLastCapture is nil until the viewer saves a line.
+	SecondsSinceLastCapture *int64 `bun:"seconds_since_last_capture"`
+}
+
+// SinceLastCapture renders the time since the viewer's last capture.
+func (s ReceiptStats) SinceLastCapture() string {
+	if s.SecondsSinceLastCapture == nil {
+		return "-"
+	}
+	seconds := max(*s.SecondsSinceLastCapture, 0)
+	switch {
+	case seconds < 60:
+		return "just now"
+	case seconds < 3600:
+		return fmt.Sprintf("%dm", seconds/60)
+	case seconds < 86400:
+		return fmt.Sprintf("%dh %dm", seconds/3600, seconds%3600/60)
+	}
+	return "over a day"
+}
+
+// RedactPhotoView is one stored photo of a receipt line on the redaction
+// page. Source and ID identify it to photoretention.
+type RedactPhotoView struct {
+	Source string
+	ID     int64
+	Label  string
+	URL    string
+}
+
+type RedactPageData struct {
+	PalletID     int64
+	ReceiptID    int64
+	ProjectName  string
+	SKU          string
+	Description  string
+	Photos       []RedactPhotoView
+	Stubs        []photoretention.Stub
+	Status       string
+	ErrorMessage string
+}
+
+// BatchSuggestion is a batch number already receipted for a SKU. ExpiryDate
+// is YYYY-MM-DD, or empty when the latest receipt had no expiry.
+type BatchSuggestion struct {
+	BatchNumber string `bun:"batch_number"`
+	ExpiryDate  string `bun:"expiry_date"`
+	LatestID    int64  `bun:"latest_id"`
+}
+
+// expiryQuickPick is a chip under the expiry input that fills in today plus
+// a common shelf life.
+type expiryQuickPick struct {
+	Label  string
+	Months int
+}
+
+var expiryQuickPicks = []expiryQuickPick{
+	{Label: "+6m", Months: 6},
+	{Label: "+1y", Months: 12},
+	{Label: "+2y", Months: 24},
+	{Label: "+3y", Months: 36},
 }
@@ -0,0 +1,299 @@
+package receipt
+
+import (
+	stdcontext "context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/catalog"
+	"receipter/infrastructure/customfield"
+	"receipter/infrastructure/customs"
+	"receipter/infrastructure/damage"
+	"receipter/infrastructure/gs1"
+	"receipter/infrastructure/photoquota"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/serials"
+	"receipter/infrastructure/sqlite"
+)
+
+// receiptFormErrorFields are the receipt form fields that can show an inline
+// error, in the order the form lays them out.
+var receiptFormErrorFields = []string{
+	"sku",
+	"qty",
+	"case_size",
+	"batch_number",
+	"expiry_date",
+	"country_of_origin",
+	"hs_code",
+	"serials",
+	"damaged_qty",
+	"damage_reason",
+	"carton_barcode",
+	"item_barcode",
+	"photos",
+}
+
+// ReceiptFormErrors are the problems found with a receipt form before it is
+// submitted: one message per field, and one for the form as a whole when the
+// pallet cannot take receipts at all.
+type ReceiptFormErrors struct {
+	Fields map[string]string
+	Form   string
+}
+
+func (e ReceiptFormErrors) Valid() bool {
+	return e.Form == "" && len(e.Fields) == 0
+}
+
+// ReceiptFieldMessage is one field's error.
+type ReceiptFieldMessage struct {
+	Field   string
+	Message string
+}
+
+// InFormOrder lists the field errors in the order the form lays them out.
+func (e ReceiptFormErrors) InFormOrder() []ReceiptFieldMessage {
+	messages := make([]ReceiptFieldMessage, 0, len(e.Fields))
+	for _, field := range receiptFormErrorFields {
+		if message, ok := e.Fields[field]; ok {
+			messages = append(messages, ReceiptFieldMessage{Field: field, Message: message})
+		}
+	}
+	return messages
+}
+
+// add keeps the first error found for a field.
+func (e *ReceiptFormErrors) add(field, message string) {
+	if _, ok := e.Fields[field]; !ok {
+		e.Fields[field] = message
+	}
+}
+
+// ValidateReceiptCommandHandler checks a receipt form without saving it and
+// returns Datastar morph target markup with an error slot for every field,
+// so the page can show each problem next to its field and keep what the
+// scanner entered. CreateReceiptCommandHandler still enforces every rule.
+func ValidateReceiptCommandHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parsePalletID(r)
+		if err != nil {
+			http.Error(w, "invalid pallet id", http.StatusBadRequest)
+			return
+		}
+		if err := parseReceiptForm(r); err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+		session, _ := context.GetSessionFromContext(r.Context())
+		errs, err := ValidateReceiptValues(r.Context(), db, id, session.UserRoles, r.Form)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "pallet not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to validate receipt", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := ReceiptFormValidation(errs).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render validation", http.StatusInternalServerError)
+		}
+	}
+}
+
+// ValidateReceiptValues applies the create handler's checks and the project's
+// save-time rules to receipt form values, collecting every failure instead
+// of stopping at the first. Photos are declared as deferred_photo_* fields
+// because the page does not send the files to be checked.
+func ValidateReceiptValues(ctx stdcontext.Context, db *sqlite.DB, palletID int64, userRoles []string, form url.Values) (ReceiptFormErrors, error) {
+	errs := ReceiptFormErrors{Fields: make(map[string]string)}
+	palletStatus, projectID, projectStatus, err := LoadPalletContext(ctx, db, palletID)
+	if err != nil {
+		return errs, err
+	}
+	if !CanUserReceiptPallet(projectStatus, palletStatus, userRoles) {
+		errs.Form = "closed/labelled pallets can only be edited by admins"
+		if projectStatus != "active" {
+			errs.Form = "inactive projects are read-only"
+		} else if palletStatus == "cancelled" {
+			errs.Form = "cancelled pallets are read-only"
+		}
+		return errs, nil
+	}
+
+	qty, err := strconv.ParseInt(strings.TrimSpace(form.Get("qty")), 10, 64)
+	if err != nil || qty <= 0 {
+		errs.add("qty", "qty must be greater than 0")
+		qty = 0
+	}
+	if caseSize, err := strconv.ParseInt(strings.TrimSpace(defaultOne(form.Get("case_size"))), 10, 64); err != nil || caseSize <= 0 {
+		errs.add("case_size", "case size must be greater than 0")
+	}
+
+	damagedQty, err := strconv.ParseInt(strings.TrimSpace(defaultZero(form.Get("damaged_qty"))), 10, 64)
+	if err != nil || damagedQty < 0 {
+		errs.add("damaged_qty", "damaged qty must be 0 or greater")
+		damagedQty = 0
+	}
+	if form.Get("damaged") != "" && damagedQty <= 0 {
+		errs.add("damaged_qty", "damaged qty is required when damaged is selected")
+	}
+	if qty > 0 && damagedQty > qty {
+		errs.add("damaged_qty", "damaged qty cannot exceed qty")
+	}
+	if damagedQty > 0 && strings.TrimSpace(form.Get("damage_reason")) == "" {
+		errs.add("damage_reason", damage.ErrReasonRequired.Error())
+	}
+
+	expiry, err := parseReceiptExpiry(ctx, db, projectID, form.Get("expiry_date"), form.Get("expiry_check_override") != "", time.Now())
+	if err != nil {
+		errs.add("expiry_date", err.Error())
+	}
+
+	sku := strings.TrimSpace(form.Get("sku"))
+	unknownSKU := form.Get("unknown_sku") != ""
+	deferred, err := parseDeferredPhotos(form)
+	if err != nil {
+		errs.add("photos", err.Error())
+	} else if unknownSKU && len(deferred) == 0 {
+		errs.add("photos", "unknown sku requires at least one photo")
+	}
+	if !unknownSKU && sku == "" {
+		errs.add("sku", "sku is required")
+	}
+
+	if form.Get("barcode_check_override") == "" {
+		for _, field := range []string{"carton_barcode", "item_barcode"} {
+			if err := gs1.Validate(form.Get(field)); err != nil {
+				errs.add(field, err.Error()+". Re-scan it, or tick \"Keep barcodes that fail the check digit\" to save it anyway.")
+			}
+		}
+	}
+
+	scanned := serials.Parse(form.Get("serials"))
+	if !unknownSKU && sku != "" {
+		serialTracked, err := catalog.IsSerialTracked(ctx, db, projectID, sku)
+		if err != nil {
+			return errs, err
+		}
+		if serialTracked && len(scanned) == 0 {
+			errs.add("serials", serials.ErrRequired.Error())
+		}
+	}
+	if len(scanned) > 0 {
+		if qty > 0 && int64(len(scanned)) != qty {
+			errs.add("serials", fmt.Sprintf("%s: %d scanned for qty %d", serials.ErrCount, len(scanned), qty))
+		}
+		err := db.WithReadTx(ctx, func(ctx stdcontext.Context, tx bun.Tx) error {
+			return serials.Check(ctx, tx, projectID, scanned)
+		})
+		if errors.Is(err, serials.ErrDuplicate) || errors.Is(err, serials.ErrTooLong) {
+			errs.add("serials", err.Error())
+		} else if err != nil {
+			return errs, err
+		}
+	}
+
+	settings, err := projectsettings.Load(ctx, db, projectID)
+	if err != nil {
+		return errs, err
+	}
+	if len(deferred) > 0 {
+		var declared int64
+		for _, photo := range deferred {
+			declared += photo.Size
+		}
+		err := db.WithReadTx(ctx, func(ctx stdcontext.Context, tx bun.Tx) error {
+			return photoquota.LoadConfig(settings).CheckTx(ctx, tx, projectID, 0, int64(len(deferred)), declared)
+		})
+		if errors.Is(err, photoquota.ErrExceeded) {
+			errs.add("photos", err.Error())
+		} else if err != nil {
+			return errs, err
+		}
+	}
+	if !unknownSKU {
+		if settings.Bool(projectsettings.ReceiptRequireBatch) && strings.TrimSpace(form.Get("batch_number")) == "" {
+			errs.add("batch_number", "this project requires a batch number")
+		}
+		if settings.Bool(projectsettings.ReceiptRequireExpiry) && expiry == nil {
+			errs.add("expiry_date", "this project requires an expiry date")
+		}
+	}
+	customsConfig := customs.LoadConfig(settings)
+	if customsConfig.CaptureCountry() {
+		country, err := customs.NormalizeCountry(form.Get("country_of_origin"))
+		if err != nil {
+			errs.add("country_of_origin", err.Error())
+		} else if !unknownSKU && country == "" && customsConfig.CountryOfOrigin == projectsettings.CustomsRequired {
+			errs.add("country_of_origin", "this project requires a country of origin")
+		}
+	}
+	if customsConfig.CaptureHSCode() {
+		hsCode, err := customs.NormalizeHSCode(form.Get("hs_code"))
+		if err != nil {
+			errs.add("hs_code", err.Error())
+		} else if !unknownSKU && hsCode == "" && customsConfig.HSCode == projectsettings.CustomsRequired {
+			errs.add("hs_code", "this project requires an HS code")
+		}
+	}
+	return errs, nil
+}
+
+// ReceiptInputFromValues builds the receipt line described by receipt form
+// values that ValidateReceiptValues has passed. Photos, the form token and
+// the high-value confirmation are left for the caller.
+func ReceiptInputFromValues(ctx stdcontext.Context, db *sqlite.DB, projectID, palletID int64, form url.Values) (ReceiptInput, error) {
+	qty, err := strconv.ParseInt(strings.TrimSpace(form.Get("qty")), 10, 64)
+	if err != nil {
+		return ReceiptInput{}, err
+	}
+	caseSize, err := strconv.ParseInt(strings.TrimSpace(defaultOne(form.Get("case_size"))), 10, 64)
+	if err != nil {
+		return ReceiptInput{}, err
+	}
+	damagedQty, err := strconv.ParseInt(strings.TrimSpace(defaultZero(form.Get("damaged_qty"))), 10, 64)
+	if err != nil {
+		return ReceiptInput{}, err
+	}
+	expiry, err := parseReceiptExpiry(ctx, db, projectID, form.Get("expiry_date"), form.Get("expiry_check_override") != "", time.Now())
+	if err != nil {
+		return ReceiptInput{}, err
+	}
+	input := ReceiptInput{
+		PalletID:        palletID,
+		SKU:             strings.TrimSpace(form.Get("sku")),
+		Description:     strings.TrimSpace(form.Get("description")),
+		UOM:             strings.TrimSpace(form.Get("uom")),
+		Comment:         strings.TrimSpace(form.Get("comment")),
+		Qty:             qty,
+		CaseSize:        caseSize,
+		UnknownSKU:      form.Get("unknown_sku") != "",
+		Damaged:         form.Get("damaged") != "" || damagedQty > 0,
+		DamagedQty:      damagedQty,
+		DamageReason:    strings.TrimSpace(form.Get("damage_reason")),
+		BatchNumber:     strings.TrimSpace(form.Get("batch_number")),
+		ExpiryDate:      expiry,
+		CartonBarcode:   strings.TrimSpace(form.Get("carton_barcode")),
+		ItemBarcode:     strings.TrimSpace(form.Get("item_barcode")),
+		NoOuterBarcode:  form.Get("no_outer_barcode") != "",
+		NoInnerBarcode:  form.Get("no_inner_barcode") != "",
+		CountryOfOrigin: form.Get("country_of_origin"),
+		HSCode:          form.Get("hs_code"),
+		CustomValues:    customfield.ParseForm(form),
+		Serials:         serials.Parse(form.Get("serials")),
+		PhotosInternal:  form.Get("photos_internal") != "",
+	}
+	input.BarcodeCheckFailed = len(barcodeCheckFailures(input)) > 0
+	return input, nil
+}
@@ -0,0 +1,66 @@
+package receipt
+
+import "fmt"
+
+// renderReceiptValidationScript checks the receipt form with the server
+// before it is submitted. Errors are patched in next to their fields by id
+// and the submit is stopped, so nothing the scanner entered is lost. Photos
+// are declared rather than sent. If the check cannot be made the form
+// submits as usual and the create handler refuses it the old way.
+func renderReceiptValidationScript(palletID int64) string {
+	return fmt.Sprintf(`<script>
+(function() {
+  if (!window.fetch || !window.FormData || !window.DOMParser) return;
+  const form = document.getElementById("receipt-form");
+  if (!form || typeof form.requestSubmit !== "function") return;
+  const url = "/tasker/api/pallets/%d/receipts/validate";
+  let checked = false;
+
+  function patch(html) {
+    const doc = new DOMParser().parseFromString(html, "text/html");
+    Array.from(doc.body.children).forEach(function(el) {
+      const target = el.id ? document.getElementById(el.id) : null;
+      if (target) target.replaceWith(el);
+    });
+  }
+
+  // Registered in the capture phase so it runs before the form's other
+  // submit listeners, which only see the submit once it has passed.
+  form.addEventListener("submit", async function(event) {
+    if (checked) {
+      checked = false;
+      return;
+    }
+    event.preventDefault();
+    event.stopImmediatePropagation();
+    const submitter = event.submitter;
+    const data = new FormData(form);
+    data.delete("form_token");
+    data.delete("stock_photo");
+    data.delete("stock_photos");
+    const photosInput = document.getElementById("stock_photos");
+    Array.from((photosInput && photosInput.files) || []).forEach(function(file) {
+      data.append("deferred_photo_name", file.name);
+      data.append("deferred_photo_type", file.type);
+      data.append("deferred_photo_size", String(file.size));
+    });
+    let valid = true;
+    try {
+      const res = await fetch(url, { method: "POST", body: data, credentials: "same-origin" });
+      if (res.ok && (res.headers.get("Content-Type") || "").indexOf("text/html") === 0) {
+        patch(await res.text());
+        const summary = document.getElementById("receipt_form_errors");
+        valid = !summary || summary.getAttribute("data-valid") === "true";
+      }
+    } catch (err) {}
+    if (!valid) {
+      const first = form.querySelector(".receipt-field-error:not(:empty), #receipt_form_errors [role='alert']");
+      if (first) first.scrollIntoView({ block: "center", behavior: "smooth" });
+      return;
+    }
+    checked = true;
+    form.requestSubmit(submitter);
+  }, true);
+})();
+</script>`, palletID)
+}
@@ -0,0 +1,328 @@
+package transfer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/pallets"
+	"receipter/infrastructure/phase"
+	"receipter/infrastructure/photovisibility"
+	"receipter/infrastructure/project"
+	"receipter/infrastructure/receipts"
+	"receipter/infrastructure/serials"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+var (
+	ErrNothingSelected      = errors.New("enter a quantity for at least one line")
+	ErrSameProject          = errors.New("choose a different project to transfer to")
+	ErrSourceReadOnly       = errors.New("stock cannot be moved off a cancelled pallet or an inactive project")
+	ErrTargetPalletNotFound = errors.New("target pallet not found on that project")
+	ErrTargetReadOnly       = errors.New("target pallet is cancelled or its project is inactive")
+	ErrTargetPhaseClosed    = errors.New("target pallet's phase is closed")
+	ErrLineNotFound         = errors.New("receipt line not found on this pallet")
+	ErrQtyTooLarge          = errors.New("cannot move more than a line holds")
+	ErrLineClaimed          = errors.New("lines on a damage claim cannot be transferred")
+	ErrSerialSplit          = errors.New("lines with serial numbers can only be transferred whole")
+	ErrOtherClient          = errors.New("stock can only be transferred between projects of the same client")
+)
+
+func LoadPageData(ctx context.Context, db *sqlite.DB, palletID int64) (PageData, error) {
+	data := PageData{
+		PalletID: palletID,
+		Lines:    make([]LineView, 0),
+		Projects: make([]ProjectOption, 0),
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`
+SELECT p.status, p.project_id, pj.name, pj.code, pj.client_name
+FROM pallets p
+JOIN projects pj ON pj.id = p.project_id
+WHERE p.id = ?`, palletID).Scan(ctx, &data.PalletStatus, &data.ProjectID, &data.ProjectName, &data.ProjectCode, fieldcrypt.Dest(&data.ClientName)); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`
+SELECT pr.id, pr.sku, pr.description, COALESCE(pr.uom, '') AS uom, pr.qty, pr.case_size,
+       pr.unknown_sku, pr.damaged,
+       COALESCE(pr.batch_number, '') AS batch_number,
+       COALESCE(strftime('%d/%m/%Y', pr.expiry_date), '') AS expiry_date,
+       (SELECT COUNT(1) FROM receipt_photos rp WHERE rp.pallet_receipt_id = pr.id)
+         + CASE WHEN pr.stock_photo_blob IS NOT NULL AND length(pr.stock_photo_blob) > 0 THEN 1 ELSE 0 END AS photos,
+       EXISTS (SELECT 1 FROM damage_claim_lines dcl WHERE dcl.pallet_receipt_id = pr.id) AS claimed
+FROM pallet_receipts pr
+WHERE pr.pallet_id = ?
+ORDER BY pr.sku, pr.id`, palletID).Scan(ctx, &data.Lines); err != nil {
+			return err
+		}
+		// client_name is encrypted at rest, so projects of the same client
+		// are picked out after decrypting rather than in the query.
+		var candidates []struct {
+			ProjectOption
+			ClientName fieldcrypt.String `bun:"client_name"`
+		}
+		if err := tx.NewRaw(`
+SELECT id, name, code, client_name
+FROM projects
+WHERE status = ? AND id <> ?
+ORDER BY name, id`, project.StatusActive, data.ProjectID).Scan(ctx, &candidates); err != nil {
+			return err
+		}
+		for _, candidate := range candidates {
+			if sameClient(string(candidate.ClientName), data.ClientName) {
+				data.Projects = append(data.Projects, candidate.ProjectOption)
+			}
+		}
+		return nil
+	})
+	return data, err
+}
+
+// sameClient reports whether two decrypted client names are the same
+// client, ignoring case and surrounding whitespace.
+func sameClient(a, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
+
+// transferSnapshot is a receipt line as audited by a transfer, with where
+// it moved from or to so each project's log can be traced to the other.
+type transferSnapshot struct {
+	models.PalletReceipt
+	FromProjectID int64 `json:",omitempty"`
+	FromPalletID  int64 `json:",omitempty"`
+	FromReceiptID int64 `json:",omitempty"`
+	ToProjectID   int64 `json:",omitempty"`
+	ToPalletID    int64 `json:",omitempty"`
+	ToReceiptID   int64 `json:",omitempty"`
+}
+
+// Transfer moves stock received on one project's pallet to a pallet of
+// another project of the same client. A whole line moves as it is, photos
+// included; part of a line is split off into a new line with copies of its
+// photos. Custom field values are copied onto the target project's field of
+// the same key; the source project's values stay on the line.
+func Transfer(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID int64, input Input) (Result, error) {
+	var result Result
+	if userID <= 0 {
+		return result, fmt.Errorf("invalid user id")
+	}
+	ids := make([]int64, 0, len(input.Qty))
+	for id, qty := range input.Qty {
+		if qty < 0 {
+			return result, fmt.Errorf("qty cannot be negative")
+		}
+		if qty > 0 {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return result, ErrNothingSelected
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var sourceProjectID int64
+		var sourceStatus, sourceProjectStatus, sourceClient string
+		if err := tx.NewRaw(`
+SELECT p.project_id, p.status, pj.status, pj.client_name
+FROM pallets p
+JOIN projects pj ON pj.id = p.project_id
+WHERE p.id = ?`, input.SourcePalletID).Scan(ctx, &sourceProjectID, &sourceStatus, &sourceProjectStatus, fieldcrypt.Dest(&sourceClient)); err != nil {
+			return err
+		}
+		if !pallets.CanReceive(sourceProjectStatus, sourceStatus, true) {
+			return ErrSourceReadOnly
+		}
+		if err := phase.CheckPalletTx(ctx, tx, input.SourcePalletID); err != nil {
+			return err
+		}
+		if input.TargetProjectID == sourceProjectID {
+			return ErrSameProject
+		}
+
+		var targetStatus, targetProjectStatus, targetClient string
+		if err := tx.NewRaw(`
+SELECT p.status, pj.status, pj.client_name
+FROM pallets p
+JOIN projects pj ON pj.id = p.project_id
+WHERE p.id = ? AND p.project_id = ?`, input.TargetPalletID, input.TargetProjectID).Scan(ctx, &targetStatus, &targetProjectStatus, fieldcrypt.Dest(&targetClient)); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrTargetPalletNotFound
+			}
+			return err
+		}
+		if !sameClient(sourceClient, targetClient) {
+			return ErrOtherClient
+		}
+		if !pallets.CanReceive(targetProjectStatus, targetStatus, true) {
+			return ErrTargetReadOnly
+		}
+		if err := phase.CheckPalletTx(ctx, tx, input.TargetPalletID); errors.Is(err, phase.ErrClosed) {
+			return ErrTargetPhaseClosed
+		} else if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, id := range ids {
+			qty := input.Qty[id]
+			var line models.PalletReceipt
+			if err := tx.NewSelect().Model(&line).Where("id = ?", id).Where("pallet_id = ?", input.SourcePalletID).Limit(1).Scan(ctx); err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return ErrLineNotFound
+				}
+				return err
+			}
+			if qty > line.Qty {
+				return fmt.Errorf("%w: %s has %d", ErrQtyTooLarge, line.SKU, line.Qty)
+			}
+			var claimed bool
+			if err := tx.NewRaw(`SELECT EXISTS (SELECT 1 FROM damage_claim_lines WHERE pallet_receipt_id = ?)`, id).Scan(ctx, &claimed); err != nil {
+				return err
+			}
+			if claimed {
+				return fmt.Errorf("%w: %s", ErrLineClaimed, line.SKU)
+			}
+			var serialCount int64
+			if err := tx.NewRaw(`SELECT COUNT(1) FROM receipt_serials WHERE pallet_receipt_id = ?`, id).Scan(ctx, &serialCount); err != nil {
+				return err
+			}
+			if serialCount > 0 && qty != line.Qty {
+				return fmt.Errorf("%w: %s", ErrSerialSplit, line.SKU)
+			}
+			if !line.UnknownSKU {
+				if err := receipts.UpsertCatalog(ctx, tx, input.TargetProjectID, line.SKU, line.Description, line.UOM); err != nil {
+					return err
+				}
+			}
+
+			var err error
+			if qty == line.Qty {
+				err = moveLine(ctx, tx, auditSvc, userID, line, input.TargetProjectID, input.TargetPalletID, now)
+			} else {
+				err = splitLine(ctx, tx, auditSvc, userID, line, qty, input.TargetProjectID, input.TargetPalletID, now)
+			}
+			if err != nil {
+				return err
+			}
+			result.Lines++
+			result.Qty += qty
+		}
+		return pallets.PromoteToOpen(ctx, tx, input.TargetProjectID, input.TargetPalletID)
+	})
+	return result, err
+}
+
+// moveLine reassigns a whole line. Its photos hang off the line and move
+// with it; its serial numbers move to the target project, which must not
+// have received them already. The one audit entry is before on the source
+// project and after on the target, so it shows in both project logs.
+func moveLine(ctx context.Context, tx bun.Tx, auditSvc *audit.Service, userID int64, line models.PalletReceipt, targetProjectID, targetPalletID int64, now time.Time) error {
+	lineSerials, err := serials.ForReceipts(ctx, tx, []int64{line.ID})
+	if err != nil {
+		return err
+	}
+	if err := serials.Check(ctx, tx, targetProjectID, lineSerials[line.ID]); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE receipt_serials SET project_id = ? WHERE pallet_receipt_id = ?`, targetProjectID, line.ID); err != nil {
+		return err
+	}
+
+	before := line
+	line.ProjectID = targetProjectID
+	line.PalletID = targetPalletID
+	line.UpdatedAt = now
+	if _, err := tx.NewUpdate().Model(&line).WherePK().Exec(ctx); err != nil {
+		return err
+	}
+	if err := copyCustomValues(ctx, tx, before.ID, line.ID, before.ProjectID, targetProjectID); err != nil {
+		return err
+	}
+	if auditSvc == nil {
+		return nil
+	}
+	return auditSvc.Write(ctx, tx, userID, "receipt.transfer", "pallet_receipts", strconv.FormatInt(line.ID, 10), before, transferSnapshot{
+		PalletReceipt: line,
+		FromProjectID: before.ProjectID,
+		FromPalletID:  before.PalletID,
+	})
+}
+
+// splitLine moves qty of a line into a new line on the target pallet. Each
+// side gets its own audit entry, logged against its own project.
+func splitLine(ctx context.Context, tx bun.Tx, auditSvc *audit.Service, userID int64, line models.PalletReceipt, qty, targetProjectID, targetPalletID int64, now time.Time) error {
+	before := line
+	line.Qty -= qty
+	line.DamagedQty = min(line.DamagedQty, line.Qty)
+	line.UpdatedAt = now
+	if _, err := tx.NewUpdate().Model(&line).WherePK().Exec(ctx); err != nil {
+		return err
+	}
+
+	moved := before
+	moved.ID = 0
+	moved.ProjectID = targetProjectID
+	moved.PalletID = targetPalletID
+	moved.Qty = qty
+	moved.DamagedQty = min(before.DamagedQty, qty)
+	moved.UpdatedAt = now
+	if _, err := tx.NewInsert().Model(&moved).Exec(ctx); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO receipt_photos (pallet_receipt_id, photo_blob, photo_mime, photo_name, created_at)
+SELECT ?, photo_blob, photo_mime, photo_name, created_at
+FROM receipt_photos
+WHERE pallet_receipt_id = ?
+ORDER BY id`, moved.ID, line.ID); err != nil {
+		return err
+	}
+	if err := photovisibility.CopyLine(ctx, tx, userID, line.ID, moved.ID); err != nil {
+		return err
+	}
+	if err := copyCustomValues(ctx, tx, line.ID, moved.ID, line.ProjectID, targetProjectID); err != nil {
+		return err
+	}
+	if auditSvc == nil {
+		return nil
+	}
+	if err := auditSvc.Write(ctx, tx, userID, "receipt.transfer_out", "pallet_receipts", strconv.FormatInt(line.ID, 10), before, transferSnapshot{
+		PalletReceipt: line,
+		ToProjectID:   targetProjectID,
+		ToPalletID:    targetPalletID,
+		ToReceiptID:   moved.ID,
+	}); err != nil {
+		return err
+	}
+	return auditSvc.Write(ctx, tx, userID, "receipt.transfer_in", "pallet_receipts", strconv.FormatInt(moved.ID, 10), nil, transferSnapshot{
+		PalletReceipt: moved,
+		FromProjectID: line.ProjectID,
+		FromPalletID:  line.PalletID,
+		FromReceiptID: line.ID,
+	})
+}
+
+// copyCustomValues carries the values of fromID's custom fields over to
+// toID on the target project's fields of the same key.
+func copyCustomValues(ctx context.Context, tx bun.Tx, fromID, toID, sourceProjectID, targetProjectID int64) error {
+	_, err := tx.ExecContext(ctx, `
+INSERT INTO receipt_custom_values (pallet_receipt_id, field_id, value)
+SELECT ?, tf.id, v.value
+FROM receipt_custom_values v
+JOIN project_custom_fields sf ON sf.id = v.field_id AND sf.project_id = ?
+JOIN project_custom_fields tf ON tf.project_id = ? AND tf.key = sf.key
+WHERE v.pallet_receipt_id = ?
+ON CONFLICT(pallet_receipt_id, field_id) DO UPDATE SET value = excluded.value`, toID, sourceProjectID, targetProjectID, fromID)
+	return err
+}
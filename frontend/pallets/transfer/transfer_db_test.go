@@ -0,0 +1,227 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/serials"
+	"receipter/infrastructure/sqlite"
+)
+
+func openTransferTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "transfer-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "..", "..", "infrastructure", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin');
+INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+  (1, 'PO 100', 'd', '2026-01-01', 'Acme', 'po-100', 'active'),
+  (2, 'PO 200', 'd', '2026-01-01', 'Acme', 'po-200', 'active'),
+  (3, 'Old', 'd', '2026-01-01', 'Acme', 'old', 'inactive');
+INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'closed'), (2, 2, 'created'), (3, 3, 'open');
+INSERT INTO project_custom_fields (id, project_id, key, label) VALUES (1, 1, 'po_line', 'PO line'), (2, 2, 'po_line', 'PO line');
+INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, damaged, damaged_qty) VALUES
+  (1, 1, 1, 'SKU-A', 'Alpha', 1, 10, 0, 0),
+  (2, 1, 1, 'SKU-B', 'Bravo', 1, 4, 1, 4),
+  (3, 1, 1, 'SKU-C', 'Charlie', 1, 2, 0, 0);
+INSERT INTO receipt_photos (pallet_receipt_id, photo_blob) VALUES (1, X'FFD8'), (2, X'FFD8');
+INSERT INTO receipt_custom_values (pallet_receipt_id, field_id, value) VALUES (1, 1, '7'), (2, 1, '9');
+`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed data: %v", err)
+	}
+	return db
+}
+
+func TestTransfer_MovesWholeLinesAndSplitsPartialOnes(t *testing.T) {
+	db := openTransferTestDB(t)
+	ctx := context.Background()
+
+	result, err := Transfer(ctx, db, audit.NewService(), 1, Input{
+		SourcePalletID:  1,
+		TargetProjectID: 2,
+		TargetPalletID:  2,
+		Qty:             map[int64]int64{1: 3, 2: 4, 3: 0},
+	})
+	if err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	if result.Lines != 2 || result.Qty != 7 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	type line struct {
+		ID        int64  `bun:"id"`
+		ProjectID int64  `bun:"project_id"`
+		PalletID  int64  `bun:"pallet_id"`
+		Qty       int64  `bun:"qty"`
+		Photos    int64  `bun:"photos"`
+		PoLine    string `bun:"po_line"`
+	}
+	lines := make([]line, 0)
+	var palletStatus string
+	var sourceLog, targetLog int
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`
+SELECT pr.id, pr.project_id, pr.pallet_id, pr.qty,
+       (SELECT COUNT(1) FROM receipt_photos rp WHERE rp.pallet_receipt_id = pr.id) AS photos,
+       COALESCE((SELECT v.value FROM receipt_custom_values v JOIN project_custom_fields f ON f.id = v.field_id
+                 WHERE v.pallet_receipt_id = pr.id AND f.project_id = pr.project_id), '') AS po_line
+FROM pallet_receipts pr ORDER BY pr.id`).Scan(ctx, &lines); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT status FROM pallets WHERE id = 2`).Scan(ctx, &palletStatus); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM audit_logs WHERE (json_valid(before_json) = 1 AND json_extract(before_json, '$.ProjectID') = 1) OR (json_valid(after_json) = 1 AND json_extract(after_json, '$.ProjectID') = 1)`).Scan(ctx, &sourceLog); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT COUNT(1) FROM audit_logs WHERE (json_valid(before_json) = 1 AND json_extract(before_json, '$.ProjectID') = 2) OR (json_valid(after_json) = 1 AND json_extract(after_json, '$.ProjectID') = 2)`).Scan(ctx, &targetLog)
+	})
+	if err != nil {
+		t.Fatalf("load results: %v", err)
+	}
+	// Line 1 is split: 7 stay and 3 move to a new line 4 with a copy of its
+	// photo. Line 2 moves whole, photo and all. Line 3 stays.
+	if len(lines) != 4 {
+		t.Fatalf("lines = %+v, want 4", lines)
+	}
+	if l := lines[0]; l.ProjectID != 1 || l.Qty != 7 || l.Photos != 1 || l.PoLine != "7" {
+		t.Fatalf("split source line = %+v", l)
+	}
+	if l := lines[1]; l.ProjectID != 2 || l.PalletID != 2 || l.Qty != 4 || l.Photos != 1 || l.PoLine != "9" {
+		t.Fatalf("moved line = %+v", l)
+	}
+	if l := lines[2]; l.ProjectID != 1 || l.Qty != 2 {
+		t.Fatalf("untouched line = %+v", l)
+	}
+	if l := lines[3]; l.ProjectID != 2 || l.PalletID != 2 || l.Qty != 3 || l.Photos != 1 || l.PoLine != "7" {
+		t.Fatalf("split off line = %+v", l)
+	}
+	if palletStatus != "open" {
+		t.Fatalf("target pallet status = %q, want open", palletStatus)
+	}
+	// Source: transfer_out and the whole move. Target: transfer_in and the
+	// whole move.
+	if sourceLog != 2 || targetLog != 2 {
+		t.Fatalf("audit entries source %d target %d, want 2 each", sourceLog, targetLog)
+	}
+}
+
+func TestTransfer_Rejects(t *testing.T) {
+	db := openTransferTestDB(t)
+	ctx := context.Background()
+
+	for name, tc := range map[string]struct {
+		input Input
+		want  error
+	}{
+		"nothing":         {Input{SourcePalletID: 1, TargetProjectID: 2, TargetPalletID: 2, Qty: map[int64]int64{1: 0}}, ErrNothingSelected},
+		"same project":    {Input{SourcePalletID: 1, TargetProjectID: 1, TargetPalletID: 1, Qty: map[int64]int64{1: 1}}, ErrSameProject},
+		"wrong pallet":    {Input{SourcePalletID: 1, TargetProjectID: 2, TargetPalletID: 3, Qty: map[int64]int64{1: 1}}, ErrTargetPalletNotFound},
+		"inactive target": {Input{SourcePalletID: 1, TargetProjectID: 3, TargetPalletID: 3, Qty: map[int64]int64{1: 1}}, ErrTargetReadOnly},
+		"too much":        {Input{SourcePalletID: 1, TargetProjectID: 2, TargetPalletID: 2, Qty: map[int64]int64{1: 11}}, ErrQtyTooLarge},
+		"other pallet":    {Input{SourcePalletID: 2, TargetProjectID: 1, TargetPalletID: 1, Qty: map[int64]int64{1: 1}}, ErrLineNotFound},
+	} {
+		if _, err := Transfer(ctx, db, nil, 1, tc.input); !errors.Is(err, tc.want) {
+			t.Fatalf("%s: err = %v, want %v", name, err, tc.want)
+		}
+	}
+}
+
+func TestTransfer_SerialsFollowWholeLinesOnly(t *testing.T) {
+	db := openTransferTestDB(t)
+	ctx := context.Background()
+	if _, err := db.W.ExecContext(ctx, `
+INSERT INTO receipt_serials (project_id, pallet_receipt_id, serial) VALUES (1, 3, 'SN-1'), (1, 3, 'SN-2');
+INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty) VALUES (4, 2, 2, 'SKU-C', 'Charlie', 1, 1);
+INSERT INTO receipt_serials (project_id, pallet_receipt_id, serial) VALUES (2, 4, 'SN-9');
+`); err != nil {
+		t.Fatalf("seed serials: %v", err)
+	}
+
+	input := Input{SourcePalletID: 1, TargetProjectID: 2, TargetPalletID: 2, Qty: map[int64]int64{3: 1}}
+	if _, err := Transfer(ctx, db, nil, 1, input); !errors.Is(err, ErrSerialSplit) {
+		t.Fatalf("partial transfer of a serial line: err = %v, want ErrSerialSplit", err)
+	}
+
+	if _, err := db.W.ExecContext(ctx, `UPDATE receipt_serials SET serial = 'SN-2' WHERE serial = 'SN-9'`); err != nil {
+		t.Fatalf("clash serial: %v", err)
+	}
+	input.Qty[3] = 2
+	if _, err := Transfer(ctx, db, nil, 1, input); !errors.Is(err, serials.ErrDuplicate) {
+		t.Fatalf("transfer of a serial the target already has: err = %v, want ErrDuplicate", err)
+	}
+
+	if _, err := db.W.ExecContext(ctx, `UPDATE receipt_serials SET serial = 'SN-9' WHERE pallet_receipt_id = 4`); err != nil {
+		t.Fatalf("restore serial: %v", err)
+	}
+	if _, err := Transfer(ctx, db, nil, 1, input); err != nil {
+		t.Fatalf("whole transfer: %v", err)
+	}
+	var moved int
+	if err := db.R.NewRaw(`SELECT COUNT(1) FROM receipt_serials WHERE pallet_receipt_id = 3 AND project_id = 2`).Scan(ctx, &moved); err != nil {
+		t.Fatalf("count serials: %v", err)
+	}
+	if moved != 2 {
+		t.Fatalf("expected both serials on the target project, got %d", moved)
+	}
+}
+
+func TestTransfer_StaysWithinOneClient(t *testing.T) {
+	db := openTransferTestDB(t)
+	ctx := context.Background()
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+  (4, 'Globex PO', 'd', '2026-01-01', 'Globex', 'globex-po', 'active');
+INSERT INTO pallets (id, project_id, status) VALUES (4, 4, 'created');
+`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	input := Input{SourcePalletID: 1, TargetProjectID: 4, TargetPalletID: 4, Qty: map[int64]int64{1: 10}}
+	if _, err := Transfer(ctx, db, nil, 1, input); !errors.Is(err, ErrOtherClient) {
+		t.Fatalf("err = %v, want %v", err, ErrOtherClient)
+	}
+	var projectID int64
+	if err := db.R.NewRaw(`SELECT project_id FROM pallet_receipts WHERE id = 1`).Scan(ctx, &projectID); err != nil {
+		t.Fatalf("load line: %v", err)
+	}
+	if projectID != 1 {
+		t.Fatalf("expected line to stay on project 1, got %d", projectID)
+	}
+
+	data, err := LoadPageData(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("load page: %v", err)
+	}
+	if len(data.Projects) != 1 || data.Projects[0].ID != 2 {
+		t.Fatalf("expected only the other active Acme project offered, got %+v", data.Projects)
+	}
+}
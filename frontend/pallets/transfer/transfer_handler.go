@@ -0,0 +1,112 @@
+package transfer
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/palletlabel"
+	"receipter/infrastructure/sqlite"
+)
+
+const qtyFieldPrefix = "qty_"
+
+func pageURL(palletID int64) string {
+	return fmt.Sprintf("/tasker/pallets/%d/transfer", palletID)
+}
+
+func parsePalletID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid pallet id")
+	}
+	return id, nil
+}
+
+// TransferPageQueryHandler lists a pallet's lines for an admin to move to a
+// pallet of another project.
+func TransferPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		palletID, err := parsePalletID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := LoadPageData(r.Context(), db, palletID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "pallet not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to load pallet", http.StatusInternalServerError)
+			return
+		}
+		data.Status = r.URL.Query().Get("status")
+		data.ErrorMessage = r.URL.Query().Get("error")
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := TransferPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render transfer page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func TransferCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		palletID, err := parsePalletID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, pageURL(palletID)+"?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+
+		input := Input{
+			SourcePalletID: palletID,
+			Qty:            make(map[int64]int64),
+		}
+		input.TargetProjectID, _ = strconv.ParseInt(r.FormValue("target_project_id"), 10, 64)
+		// Admins scan the target's label or type its number.
+		input.TargetPalletID, _, _ = palletlabel.ParseCode(r.FormValue("target_pallet"))
+		for key, values := range r.PostForm {
+			receiptID, err := strconv.ParseInt(strings.TrimPrefix(key, qtyFieldPrefix), 10, 64)
+			if !strings.HasPrefix(key, qtyFieldPrefix) || err != nil || len(values) == 0 || strings.TrimSpace(values[0]) == "" {
+				continue
+			}
+			qty, err := strconv.ParseInt(strings.TrimSpace(values[0]), 10, 64)
+			if err != nil {
+				http.Redirect(w, r, pageURL(palletID)+"?error="+url.QueryEscape("quantities must be whole numbers"), http.StatusSeeOther)
+				return
+			}
+			input.Qty[receiptID] = qty
+		}
+
+		result, err := Transfer(r.Context(), db, auditSvc, session.UserID, input)
+		if err != nil {
+			http.Redirect(w, r, pageURL(palletID)+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		lines := "1 line"
+		if result.Lines != 1 {
+			lines = fmt.Sprintf("%d lines", result.Lines)
+		}
+		status := fmt.Sprintf("moved qty %d on %s to P%08d", result.Qty, lines, input.TargetPalletID)
+		http.Redirect(w, r, pageURL(palletID)+"?status="+url.QueryEscape(status), http.StatusSeeOther)
+	}
+}
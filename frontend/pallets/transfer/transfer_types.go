@@ -0,0 +1,51 @@
+package transfer
+
+type LineView struct {
+	ID          int64  `bun:"id"`
+	SKU         string `bun:"sku"`
+	Description string `bun:"description"`
+	UOM         string `bun:"uom"`
+	Qty         int64  `bun:"qty"`
+	CaseSize    int64  `bun:"case_size"`
+	UnknownSKU  bool   `bun:"unknown_sku"`
+	Damaged     bool   `bun:"damaged"`
+	BatchNumber string `bun:"batch_number"`
+	ExpiryDate  string `bun:"expiry_date"`
+	Photos      int64  `bun:"photos"`
+	// Claimed lines are on a damage claim of their project and stay put.
+	Claimed bool `bun:"claimed"`
+}
+
+type ProjectOption struct {
+	ID   int64  `bun:"id"`
+	Name string `bun:"name"`
+	Code string `bun:"code"`
+}
+
+type PageData struct {
+	PalletID     int64
+	PalletStatus string
+	ProjectID    int64
+	ProjectName  string
+	ProjectCode  string
+	ClientName   string
+	Lines        []LineView
+	Projects     []ProjectOption
+	Status       string
+	ErrorMessage string
+}
+
+// Input moves Qty[receiptID] of each listed line from SourcePalletID to
+// TargetPalletID, which must be on TargetProjectID. A quantity equal to the
+// line's moves the whole line.
+type Input struct {
+	SourcePalletID  int64
+	TargetProjectID int64
+	TargetPalletID  int64
+	Qty             map[int64]int64
+}
+
+type Result struct {
+	Lines int
+	Qty   int64
+}
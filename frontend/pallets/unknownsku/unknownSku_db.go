@@ -0,0 +1,231 @@
+package unknownsku
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/phase"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+var (
+	ErrSKURequired         = errors.New("sku is required")
+	ErrDescriptionRequired = errors.New("description is required for a sku that is not in the catalog")
+	ErrLineNotFound        = errors.New("unknown line not found or already resolved")
+	ErrProjectInactive     = errors.New("inactive projects are read-only")
+)
+
+// BarcodeInUseError reports an alias barcode already mapped to another SKU.
+type BarcodeInUseError struct {
+	Barcode string
+	SKU     string
+}
+
+func (e BarcodeInUseError) Error() string {
+	return fmt.Sprintf("barcode %s is already an alias for %s", e.Barcode, e.SKU)
+}
+
+const recentResolvedLimit = 20
+
+func LoadPageData(ctx context.Context, db *sqlite.DB, projectID int64) (PageData, error) {
+	data := PageData{
+		ProjectID: projectID,
+		Lines:     make([]LineView, 0),
+		Resolved:  make([]ResolvedView, 0),
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT name, client_name, status FROM projects WHERE id = ?`, projectID).
+			Scan(ctx, &data.ProjectName, fieldcrypt.Dest(&data.ClientName), &data.ProjectStatus); err != nil {
+			return err
+		}
+
+		if err := tx.NewRaw(`
+SELECT pr.id, pr.pallet_id, p.status AS pallet_status, pr.description, COALESCE(pr.uom, '') AS uom,
+       pr.qty, pr.case_size, pr.damaged,
+       COALESCE(pr.batch_number, '') AS batch_number,
+       COALESCE(strftime('%d/%m/%Y', pr.expiry_date), '') AS expiry_date,
+       COALESCE(pr.item_barcode, '') AS item_barcode,
+       COALESCE(pr.carton_barcode, '') AS carton_barcode,
+       COALESCE(pr.comment, '') AS comment,
+       COALESCE(u.username, '-') AS scanned_by,
+       strftime('%d/%m/%Y %H:%M', pr.created_at) AS created_at,
+       CASE WHEN pr.stock_photo_blob IS NOT NULL AND length(pr.stock_photo_blob) > 0 THEN 1 ELSE 0 END AS has_primary
+FROM pallet_receipts pr
+JOIN pallets p ON p.id = pr.pallet_id
+LEFT JOIN users u ON u.id = pr.scanned_by_user_id
+WHERE pr.project_id = ? AND pr.unknown_sku = 1
+ORDER BY pr.created_at ASC, pr.id ASC`, projectID).Scan(ctx, &data.Lines); err != nil {
+			return err
+		}
+
+		if len(data.Lines) > 0 {
+			ids := make([]int64, 0, len(data.Lines))
+			index := make(map[int64]int, len(data.Lines))
+			for i, line := range data.Lines {
+				ids = append(ids, line.ID)
+				index[line.ID] = i
+			}
+			var photos []struct {
+				ID        int64 `bun:"id"`
+				ReceiptID int64 `bun:"pallet_receipt_id"`
+			}
+			if err := tx.NewRaw(`SELECT id, pallet_receipt_id FROM receipt_photos WHERE pallet_receipt_id IN (?) ORDER BY id`, bun.In(ids)).Scan(ctx, &photos); err != nil {
+				return err
+			}
+			for _, photo := range photos {
+				i := index[photo.ReceiptID]
+				data.Lines[i].PhotoIDs = append(data.Lines[i].PhotoIDs, photo.ID)
+			}
+		}
+
+		return tx.NewRaw(`
+SELECT pr.id, pr.pallet_id, pr.sku, pr.description, pr.qty,
+       COALESCE(u.username, '-') AS resolved_by,
+       strftime('%d/%m/%Y %H:%M', pr.resolved_at) AS resolved_at
+FROM pallet_receipts pr
+LEFT JOIN users u ON u.id = pr.resolved_by_user_id
+WHERE pr.project_id = ? AND pr.resolved_at IS NOT NULL
+ORDER BY pr.resolved_at DESC, pr.id DESC
+LIMIT ?`, projectID, recentResolvedLimit).Scan(ctx, &data.Resolved)
+	})
+	return data, err
+}
+
+// ResolveLine assigns a real SKU to an UNKNOWN line, optionally adding the SKU
+// to the catalog and registering the line's barcode as an alias for it.
+func ResolveLine(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID int64, input ResolveInput) error {
+	if userID <= 0 {
+		return fmt.Errorf("invalid user id")
+	}
+	input.SKU = strings.TrimSpace(input.SKU)
+	input.Description = strings.TrimSpace(input.Description)
+	input.UOM = strings.TrimSpace(input.UOM)
+	input.AliasBarcode = strings.TrimSpace(input.AliasBarcode)
+	if input.SKU == "" || strings.EqualFold(input.SKU, "UNKNOWN") {
+		return ErrSKURequired
+	}
+
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var projectStatus string
+		if err := tx.NewRaw(`SELECT status FROM projects WHERE id = ?`, projectID).Scan(ctx, &projectStatus); err != nil {
+			return err
+		}
+		if projectStatus != "active" {
+			return ErrProjectInactive
+		}
+
+		var line models.PalletReceipt
+		if err := tx.NewSelect().
+			Model(&line).
+			Where("id = ?", input.ReceiptID).
+			Where("project_id = ?", projectID).
+			Where("unknown_sku = 1").
+			Limit(1).
+			Scan(ctx); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrLineNotFound
+			}
+			return err
+		}
+		if err := phase.CheckPalletTx(ctx, tx, line.PalletID); err != nil {
+			return err
+		}
+
+		var stock models.StockItem
+		inCatalog := true
+		if err := tx.NewSelect().Model(&stock).Where("project_id = ?", projectID).Where("sku = ?", input.SKU).Limit(1).Scan(ctx); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			inCatalog = false
+		}
+		if input.Description == "" {
+			input.Description = stock.Description
+		}
+		if input.Description == "" {
+			return ErrDescriptionRequired
+		}
+		if input.UOM == "" {
+			input.UOM = stock.UOM
+		}
+		if input.UOM == "" {
+			input.UOM = line.UOM
+		}
+
+		if input.AddToCatalog && !inCatalog {
+			stock = models.StockItem{
+				ProjectID:   projectID,
+				SKU:         input.SKU,
+				Description: input.Description,
+				UOM:         input.UOM,
+			}
+			if _, err := tx.NewInsert().Model(&stock).Exec(ctx); err != nil {
+				return err
+			}
+			if auditSvc != nil {
+				if err := auditSvc.Write(ctx, tx, userID, "stock.create", "stock_items", fmt.Sprintf("%d", stock.ID), nil, stock); err != nil {
+					return err
+				}
+			}
+		}
+
+		if input.AliasBarcode != "" {
+			if err := addBarcodeAlias(ctx, tx, auditSvc, userID, projectID, input.AliasBarcode, input.SKU); err != nil {
+				return err
+			}
+		}
+
+		before := line
+		now := time.Now()
+		line.SKU = input.SKU
+		line.Description = input.Description
+		line.UOM = input.UOM
+		line.UnknownSKU = false
+		line.ResolvedAt = &now
+		line.ResolvedByUserID = &userID
+		line.UpdatedAt = now
+		if _, err := tx.NewUpdate().Model(&line).WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		if auditSvc != nil {
+			return auditSvc.Write(ctx, tx, userID, "receipt.resolve_unknown", "pallet_receipts", fmt.Sprintf("%d", line.ID), before, line)
+		}
+		return nil
+	})
+}
+
+func addBarcodeAlias(ctx context.Context, tx bun.Tx, auditSvc *audit.Service, userID, projectID int64, barcode, sku string) error {
+	var existing models.StockItemBarcode
+	err := tx.NewSelect().Model(&existing).Where("project_id = ?", projectID).Where("barcode = ?", barcode).Limit(1).Scan(ctx)
+	if err == nil {
+		if existing.SKU != sku {
+			return BarcodeInUseError{Barcode: barcode, SKU: existing.SKU}
+		}
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	alias := models.StockItemBarcode{
+		ProjectID:       projectID,
+		Barcode:         barcode,
+		SKU:             sku,
+		CreatedByUserID: userID,
+	}
+	if _, err := tx.NewInsert().Model(&alias).Exec(ctx); err != nil {
+		return err
+	}
+	if auditSvc != nil {
+		return auditSvc.Write(ctx, tx, userID, "stock_barcode.create", "stock_item_barcodes", fmt.Sprintf("%d", alias.ID), nil, alias)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package unknownsku
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/phase"
+	"receipter/infrastructure/sqlite"
+)
+
+func openUnknownSKUTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "unknown-sku-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "..", "..", "infrastructure", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO projects (id, name, description, project_date, client_name, code, status, created_at, updated_at)
+VALUES (1, 'Unknown Test', 'Unknown test project', DATE('now'), 'Test Client', 'unknown-test', 'active', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);
+INSERT INTO users (id, username, password_hash, role, created_at, updated_at)
+VALUES (1, 'admin', 'hash', 'admin', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);
+INSERT INTO pallets (id, project_id, status, created_at) VALUES (1, 1, 'closed', CURRENT_TIMESTAMP);
+INSERT INTO stock_items (project_id, sku, description, uom) VALUES (1, 'SKU-KNOWN', 'Known widget', 'EA');
+INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, unknown_sku, item_barcode, stock_photo_blob)
+VALUES
+  (1, 1, 1, 'UNKNOWN', 'Unidentifiable item', 1, 3, 1, '5012345678900', X'FFD8'),
+  (2, 1, 1, 'UNKNOWN', 'Unidentifiable item', 1, 2, 1, '5012345678900', X'FFD8'),
+  (3, 1, 1, 'UNKNOWN', 'Unidentifiable item', 1, 1, 1, '', X'FFD8');
+INSERT INTO receipt_photos (pallet_receipt_id, photo_blob) VALUES (1, X'FFD8'), (1, X'FFD8');
+`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed data: %v", err)
+	}
+	return db
+}
+
+func TestLoadPageData_ListsUnresolvedLinesWithPhotos(t *testing.T) {
+	db := openUnknownSKUTestDB(t)
+
+	data, err := LoadPageData(context.Background(), db, 1)
+	if err != nil {
+		t.Fatalf("load page data: %v", err)
+	}
+	if len(data.Lines) != 3 {
+		t.Fatalf("expected 3 unresolved lines, got %d", len(data.Lines))
+	}
+	if !data.Lines[0].HasPrimary || len(data.Lines[0].PhotoIDs) != 2 {
+		t.Fatalf("expected primary photo and 2 extra photos on line 1, got %+v", data.Lines[0])
+	}
+	if data.Lines[0].SuggestedBarcode() != "5012345678900" {
+		t.Fatalf("expected item barcode suggested as alias, got %q", data.Lines[0].SuggestedBarcode())
+	}
+}
+
+func TestResolveLine_UpdatesLineCatalogAndAlias(t *testing.T) {
+	db := openUnknownSKUTestDB(t)
+	ctx := context.Background()
+	auditSvc := audit.NewService()
+
+	err := ResolveLine(ctx, db, auditSvc, 1, 1, ResolveInput{
+		ReceiptID:    1,
+		SKU:          "SKU-NEW",
+		Description:  "New widget",
+		UOM:          "BOX",
+		AddToCatalog: true,
+		AliasBarcode: "5012345678900",
+	})
+	if err != nil {
+		t.Fatalf("resolve line: %v", err)
+	}
+
+	var sku, description string
+	var unknown bool
+	var resolvedBy int64
+	var catalogCount, aliasCount, auditCount int
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT sku, description, unknown_sku, resolved_by_user_id FROM pallet_receipts WHERE id = 1`).Scan(ctx, &sku, &description, &unknown, &resolvedBy); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT COUNT(*) FROM stock_items WHERE project_id = 1 AND sku = 'SKU-NEW' AND description = 'New widget' AND uom = 'BOX'`).Scan(ctx, &catalogCount); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT COUNT(*) FROM stock_item_barcodes WHERE project_id = 1 AND barcode = '5012345678900' AND sku = 'SKU-NEW'`).Scan(ctx, &aliasCount); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT COUNT(*) FROM audit_logs WHERE action IN ('receipt.resolve_unknown', 'stock.create', 'stock_barcode.create')`).Scan(ctx, &auditCount)
+	})
+	if err != nil {
+		t.Fatalf("load resolved state: %v", err)
+	}
+	if sku != "SKU-NEW" || description != "New widget" || unknown || resolvedBy != 1 {
+		t.Fatalf("unexpected resolved line sku=%q description=%q unknown=%v resolvedBy=%d", sku, description, unknown, resolvedBy)
+	}
+	if catalogCount != 1 || aliasCount != 1 || auditCount != 3 {
+		t.Fatalf("expected catalog entry, alias and 3 audit rows, got catalog=%d alias=%d audit=%d", catalogCount, aliasCount, auditCount)
+	}
+
+	if err := ResolveLine(ctx, db, auditSvc, 1, 1, ResolveInput{ReceiptID: 1, SKU: "SKU-NEW"}); !errors.Is(err, ErrLineNotFound) {
+		t.Fatalf("expected already resolved line to be rejected, got %v", err)
+	}
+
+	data, err := LoadPageData(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("load page data: %v", err)
+	}
+	if len(data.Lines) != 2 || len(data.Resolved) != 1 || data.Resolved[0].ResolvedBy != "admin" {
+		t.Fatalf("expected 2 open and 1 resolved line, got %d open %+v", len(data.Lines), data.Resolved)
+	}
+}
+
+func TestResolveLine_UsesCatalogAndRejectsConflicts(t *testing.T) {
+	db := openUnknownSKUTestDB(t)
+	ctx := context.Background()
+
+	if err := ResolveLine(ctx, db, nil, 1, 1, ResolveInput{ReceiptID: 3, SKU: "unknown"}); !errors.Is(err, ErrSKURequired) {
+		t.Fatalf("expected UNKNOWN to be rejected as a sku, got %v", err)
+	}
+	if err := ResolveLine(ctx, db, nil, 1, 1, ResolveInput{ReceiptID: 3, SKU: "SKU-MISSING"}); !errors.Is(err, ErrDescriptionRequired) {
+		t.Fatalf("expected description required for uncatalogued sku, got %v", err)
+	}
+
+	if err := ResolveLine(ctx, db, nil, 1, 1, ResolveInput{ReceiptID: 1, SKU: "SKU-KNOWN", AliasBarcode: "5012345678900"}); err != nil {
+		t.Fatalf("resolve against catalog: %v", err)
+	}
+	var description, uom string
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT description, uom FROM pallet_receipts WHERE id = 1`).Scan(ctx, &description, &uom)
+	})
+	if err != nil {
+		t.Fatalf("load line: %v", err)
+	}
+	if description != "Known widget" || uom != "EA" {
+		t.Fatalf("expected catalog description and uom, got %q %q", description, uom)
+	}
+
+	err = ResolveLine(ctx, db, nil, 1, 1, ResolveInput{ReceiptID: 2, SKU: "SKU-OTHER", Description: "Other", AliasBarcode: "5012345678900"})
+	var inUse BarcodeInUseError
+	if !errors.As(err, &inUse) || inUse.SKU != "SKU-KNOWN" {
+		t.Fatalf("expected barcode alias conflict, got %v", err)
+	}
+	var unknown bool
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT unknown_sku FROM pallet_receipts WHERE id = 2`).Scan(ctx, &unknown)
+	})
+	if err != nil || !unknown {
+		t.Fatalf("expected conflicting resolve to roll back, unknown=%v err=%v", unknown, err)
+	}
+
+	err = db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO project_phases (id, project_id, name, status) VALUES (1, 1, 'Wave 1', 'closed')`); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO pallet_phases (pallet_id, phase_id) VALUES (1, 1)`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("close phase: %v", err)
+	}
+	if err := ResolveLine(ctx, db, nil, 1, 1, ResolveInput{ReceiptID: 3, SKU: "SKU-KNOWN"}); !errors.Is(err, phase.ErrClosed) {
+		t.Fatalf("expected closed phase pallet to be read-only, got %v", err)
+	}
+
+	err = db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE projects SET status = 'inactive' WHERE id = 1`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("deactivate project: %v", err)
+	}
+	if err := ResolveLine(ctx, db, nil, 1, 1, ResolveInput{ReceiptID: 3, SKU: "SKU-KNOWN"}); !errors.Is(err, ErrProjectInactive) {
+		t.Fatalf("expected inactive project to be read-only, got %v", err)
+	}
+}
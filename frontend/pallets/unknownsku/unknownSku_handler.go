@@ -0,0 +1,82 @@
+package unknownsku
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+// UnknownSKUQueuePageQueryHandler lists UNKNOWN lines in the active project awaiting resolution.
+func UnknownSKUQueuePageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if session.ActiveProjectID == nil || *session.ActiveProjectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects", http.StatusSeeOther)
+			return
+		}
+
+		data, err := LoadPageData(r.Context(), db, *session.ActiveProjectID)
+		if err != nil {
+			http.Error(w, "failed to load unknown sku queue", http.StatusInternalServerError)
+			return
+		}
+		data.Status = r.URL.Query().Get("status")
+		data.ErrorMessage = r.URL.Query().Get("error")
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := UnknownSKUQueuePage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render unknown sku queue", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func ResolveUnknownSKUCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if session.ActiveProjectID == nil || *session.ActiveProjectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects", http.StatusSeeOther)
+			return
+		}
+		receiptID, err := strconv.ParseInt(chi.URLParam(r, "receiptID"), 10, 64)
+		if err != nil || receiptID <= 0 {
+			http.Redirect(w, r, "/tasker/pallets/unknown-skus?error="+url.QueryEscape("invalid receipt id"), http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/pallets/unknown-skus?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+
+		input := ResolveInput{
+			ReceiptID:    receiptID,
+			SKU:          r.FormValue("sku"),
+			Description:  r.FormValue("description"),
+			UOM:          r.FormValue("uom"),
+			AddToCatalog: r.FormValue("add_to_catalog") != "",
+		}
+		if r.FormValue("add_alias") != "" {
+			input.AliasBarcode = r.FormValue("alias_barcode")
+		}
+		if err := ResolveLine(r.Context(), db, auditSvc, session.UserID, *session.ActiveProjectID, input); err != nil {
+			http.Redirect(w, r, "/tasker/pallets/unknown-skus?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/tasker/pallets/unknown-skus?status="+url.QueryEscape("line resolved as "+strings.TrimSpace(input.SKU)), http.StatusSeeOther)
+	}
+}
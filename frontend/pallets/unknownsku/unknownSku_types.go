@@ -0,0 +1,59 @@
+package unknownsku
+
+type LineView struct {
+	ID            int64  `bun:"id"`
+	PalletID      int64  `bun:"pallet_id"`
+	PalletStatus  string `bun:"pallet_status"`
+	Description   string `bun:"description"`
+	UOM           string `bun:"uom"`
+	Qty           int64  `bun:"qty"`
+	CaseSize      int64  `bun:"case_size"`
+	Damaged       bool   `bun:"damaged"`
+	BatchNumber   string `bun:"batch_number"`
+	ExpiryDate    string `bun:"expiry_date"`
+	ItemBarcode   string `bun:"item_barcode"`
+	CartonBarcode string `bun:"carton_barcode"`
+	Comment       string `bun:"comment"`
+	ScannedBy     string `bun:"scanned_by"`
+	CreatedAt     string `bun:"created_at"`
+	HasPrimary    bool   `bun:"has_primary"`
+	PhotoIDs      []int64
+}
+
+// SuggestedBarcode is the barcode offered as an alias when resolving.
+func (l LineView) SuggestedBarcode() string {
+	if l.ItemBarcode != "" {
+		return l.ItemBarcode
+	}
+	return l.CartonBarcode
+}
+
+type ResolvedView struct {
+	ID          int64  `bun:"id"`
+	PalletID    int64  `bun:"pallet_id"`
+	SKU         string `bun:"sku"`
+	Description string `bun:"description"`
+	Qty         int64  `bun:"qty"`
+	ResolvedBy  string `bun:"resolved_by"`
+	ResolvedAt  string `bun:"resolved_at"`
+}
+
+type PageData struct {
+	ProjectID     int64
+	ProjectName   string
+	ClientName    string
+	ProjectStatus string
+	Lines         []LineView
+	Resolved      []ResolvedView
+	Status        string
+	ErrorMessage  string
+}
+
+type ResolveInput struct {
+	ReceiptID    int64
+	SKU          string
+	Description  string
+	UOM          string
+	AddToCatalog bool
+	AliasBarcode string
+}
@@ -0,0 +1,108 @@
+package projects
+
+import (
+	"context"
+	"strings"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/sqlite"
+)
+
+// accessLogWhere builds the WHERE clause and arguments for filter.
+func accessLogWhere(projectID int64, filter AccessLogFilter) (string, []any) {
+	clauses := []string{"project_id = ?"}
+	args := []any{projectID}
+	if filter.UserID > 0 {
+		clauses = append(clauses, "user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.Kind != "" {
+		clauses = append(clauses, "kind = ?")
+		args = append(args, filter.Kind)
+	}
+	if filter.From != "" {
+		clauses = append(clauses, "date(created_at) >= ?")
+		args = append(args, filter.From)
+	}
+	if filter.To != "" {
+		clauses = append(clauses, "date(created_at) <= ?")
+		args = append(args, filter.To)
+	}
+	return strings.Join(clauses, " AND "), args
+}
+
+// LoadAccessLogPageData loads the latest client views of a project matching
+// filter, newest first.
+func LoadAccessLogPageData(ctx context.Context, db *sqlite.DB, projectID int64, filter AccessLogFilter) (AccessLogPageData, error) {
+	data := AccessLogPageData{
+		ProjectID: projectID,
+		Filter:    filter,
+		Users:     make([]AccessLogUser, 0),
+		Rows:      make([]AccessLogRow, 0),
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT name, client_name FROM projects WHERE id = ?`, projectID).
+			Scan(ctx, &data.ProjectName, fieldcrypt.Dest(&data.ClientName)); err != nil {
+			return err
+		}
+		settings, err := projectsettings.LoadTx(ctx, tx, projectID)
+		if err != nil {
+			return err
+		}
+		data.RetentionDays = settings.Int(projectsettings.AccessLogRetentionDays)
+
+		if err := tx.NewRaw(`
+SELECT user_id, MAX(username) AS username, COUNT(*) AS views
+FROM client_access_log
+WHERE project_id = ? AND user_id IS NOT NULL
+GROUP BY user_id
+ORDER BY username COLLATE NOCASE`, projectID).Scan(ctx, &data.Users); err != nil {
+			return err
+		}
+
+		where, args := accessLogWhere(projectID, filter)
+		if err := tx.NewRaw(`SELECT COUNT(*) FROM client_access_log WHERE `+where, args...).Scan(ctx, &data.Total); err != nil {
+			return err
+		}
+		rows, err := loadAccessLogRows(ctx, tx, projectID, filter, accessLogLimit)
+		if err != nil {
+			return err
+		}
+		data.Rows = rows
+		return nil
+	})
+	return data, err
+}
+
+// LoadAccessLogRows loads every client view of a project matching filter,
+// newest first.
+func LoadAccessLogRows(ctx context.Context, db *sqlite.DB, projectID int64, filter AccessLogFilter) ([]AccessLogRow, error) {
+	var rows []AccessLogRow
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		rows, err = loadAccessLogRows(ctx, tx, projectID, filter, 0)
+		return err
+	})
+	return rows, err
+}
+
+func loadAccessLogRows(ctx context.Context, tx bun.Tx, projectID int64, filter AccessLogFilter, limit int) ([]AccessLogRow, error) {
+	where, args := accessLogWhere(projectID, filter)
+	query := `
+SELECT id, username, kind, path, query, strftime('%d/%m/%Y %H:%M:%S', created_at) AS viewed_at
+FROM client_access_log
+WHERE ` + where + `
+ORDER BY created_at DESC, id DESC`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows := make([]AccessLogRow, 0)
+	if err := tx.NewRaw(query, args...).Scan(ctx, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
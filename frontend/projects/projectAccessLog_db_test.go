@@ -0,0 +1,71 @@
+package projects
+
+import (
+	"context"
+	"testing"
+
+	"github.com/uptrace/bun"
+)
+
+func TestLoadAccessLogPageData_FiltersViews(t *testing.T) {
+	db := openProjectLogsTestDB(t)
+	ctx := context.Background()
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+			 (1, 'Alpha', 'd', '2026-02-01', 'Acme', 'alpha', 'active'),
+			 (2, 'Beta', 'd', '2026-02-01', 'Acme', 'beta', 'active')`,
+			`INSERT INTO users (id, username, password_hash, role, client_project_id) VALUES
+			 (1, 'client1', 'hash', 'client', 1),
+			 (2, 'client2', 'hash', 'client', 1)`,
+			`INSERT INTO project_settings (project_id, key, value) VALUES (1, 'access_log.retention_days', '90')`,
+			`INSERT INTO client_access_log (project_id, user_id, username, kind, path, query, created_at) VALUES
+			 (1, 1, 'client1', 'page', '/tasker/pallets/sku-view', '', '2026-03-01 09:00:00'),
+			 (1, 1, 'client1', 'export', '/tasker/pallets/sku-view/export-detail.csv', 'q=abc', '2026-03-02 10:00:00'),
+			 (1, 2, 'client2', 'photo', '/tasker/pallets/sku-view/detail/photos', 'sku=A', '2026-03-03 11:00:00'),
+			 (2, 1, 'client1', 'page', '/tasker/pallets/sku-view', '', '2026-03-03 12:00:00')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	data, err := LoadAccessLogPageData(ctx, db, 1, AccessLogFilter{})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if data.RetentionDays != 90 {
+		t.Fatalf("retention days = %d, want 90", data.RetentionDays)
+	}
+	if data.Total != 3 || len(data.Rows) != 3 {
+		t.Fatalf("views = %d (%d rows), want 3", data.Total, len(data.Rows))
+	}
+	if data.Rows[0].Username != "client2" || data.Rows[0].URL() != "/tasker/pallets/sku-view/detail/photos?sku=A" {
+		t.Fatalf("newest view = %+v", data.Rows[0])
+	}
+	if len(data.Users) != 2 || data.Users[0].Username != "client1" || data.Users[0].Views != 2 {
+		t.Fatalf("users = %+v", data.Users)
+	}
+
+	data, err = LoadAccessLogPageData(ctx, db, 1, AccessLogFilter{UserID: 1, Kind: "export"})
+	if err != nil {
+		t.Fatalf("load by user and kind: %v", err)
+	}
+	if data.Total != 1 || data.Rows[0].Path != "/tasker/pallets/sku-view/export-detail.csv" {
+		t.Fatalf("user and kind filter = %+v", data.Rows)
+	}
+
+	rows, err := LoadAccessLogRows(ctx, db, 1, AccessLogFilter{From: "2026-03-02", To: "2026-03-02"})
+	if err != nil {
+		t.Fatalf("load by date: %v", err)
+	}
+	if len(rows) != 1 || rows[0].ViewedAt != "02/03/2026 10:00:00" {
+		t.Fatalf("date filter = %+v", rows)
+	}
+}
@@ -0,0 +1,144 @@
+package projects
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/infrastructure/accesslog"
+	"receipter/infrastructure/exportformat"
+	"receipter/infrastructure/sqlite"
+)
+
+func accessLogURL(projectID int64) string {
+	return fmt.Sprintf("/tasker/projects/%d/access-log", projectID)
+}
+
+// parseAccessLogFilter reads the report filter from the query, reporting
+// the first invalid value.
+func parseAccessLogFilter(query url.Values) (AccessLogFilter, error) {
+	var filter AccessLogFilter
+	if raw := strings.TrimSpace(query.Get("user")); raw != "" {
+		userID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || userID <= 0 {
+			return filter, errors.New("invalid user")
+		}
+		filter.UserID = userID
+	}
+	if kind := strings.TrimSpace(query.Get("kind")); kind != "" {
+		if !slices.Contains(accesslog.Kinds, kind) {
+			return filter, errors.New("invalid access kind")
+		}
+		filter.Kind = kind
+	}
+	for _, day := range []struct {
+		name string
+		dest *string
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		raw := strings.TrimSpace(query.Get(day.name))
+		if raw == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", raw); err != nil {
+			return filter, fmt.Errorf("invalid %s date", day.name)
+		}
+		*day.dest = raw
+	}
+	return filter, nil
+}
+
+func AccessLogPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		filter, filterErr := parseAccessLogFilter(r.URL.Query())
+		if filterErr != nil {
+			filter = AccessLogFilter{}
+		}
+		data, err := LoadAccessLogPageData(r.Context(), db, projectID, filter)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Project not found"), http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "failed to load access log", http.StatusInternalServerError)
+			return
+		}
+		if filterErr != nil {
+			data.ErrorMessage = filterErr.Error()
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := AccessLogPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render access log", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func AccessLogExportCSVHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Error(w, "invalid project id", http.StatusBadRequest)
+			return
+		}
+		version, err := exportformat.ClientAccessLog.ParseVersion(r.URL.Query().Get(exportformat.QueryParam))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter, err := parseAccessLogFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rows, err := LoadAccessLogRows(r.Context(), db, projectID, filter)
+		if err != nil {
+			http.Error(w, "failed to load access log", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=client-access-log-project-%d.csv", projectID))
+		w.Header().Set(exportformat.ResponseHeader, strconv.Itoa(version))
+		if err := writeAccessLogCSV(w, rows, version); err != nil {
+			http.Error(w, "failed to export csv", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func writeAccessLogCSV(w io.Writer, rows []AccessLogRow, version int) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportformat.ClientAccessLog.Header(version)); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := exportformat.ClientAccessLog.Record(version, []string{
+			row.ViewedAt,
+			row.Username,
+			row.Kind,
+			row.Path,
+			row.Query,
+		})
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
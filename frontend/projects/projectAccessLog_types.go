@@ -0,0 +1,76 @@
+package projects
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// accessLogLimit caps the views shown on the report; the CSV export is not
+// capped.
+const accessLogLimit = 500
+
+// AccessLogFilter narrows the access log. From and To are YYYY-MM-DD days,
+// both inclusive.
+type AccessLogFilter struct {
+	UserID int64
+	Kind   string
+	From   string
+	To     string
+}
+
+// Query encodes the filter for links to the export.
+func (f AccessLogFilter) Query() string {
+	values := url.Values{}
+	if f.UserID > 0 {
+		values.Set("user", strconv.FormatInt(f.UserID, 10))
+	}
+	if f.Kind != "" {
+		values.Set("kind", f.Kind)
+	}
+	if f.From != "" {
+		values.Set("from", f.From)
+	}
+	if f.To != "" {
+		values.Set("to", f.To)
+	}
+	return values.Encode()
+}
+
+// AccessLogRow is one client view.
+type AccessLogRow struct {
+	ID       int64  `bun:"id"`
+	Username string `bun:"username"`
+	Kind     string `bun:"kind"`
+	Path     string `bun:"path"`
+	Query    string `bun:"query"`
+	ViewedAt string `bun:"viewed_at"`
+}
+
+// URL is the viewed address with its query.
+func (r AccessLogRow) URL() string {
+	if r.Query == "" {
+		return r.Path
+	}
+	return r.Path + "?" + r.Query
+}
+
+// AccessLogUser is a client who appears in the log, for the user filter.
+type AccessLogUser struct {
+	ID       int64  `bun:"user_id"`
+	Username string `bun:"username"`
+	Views    int    `bun:"views"`
+}
+
+type AccessLogPageData struct {
+	ProjectID   int64
+	ProjectName string
+	ClientName  string
+	Filter      AccessLogFilter
+	Users       []AccessLogUser
+	Rows        []AccessLogRow
+	// Total counts the views matching the filter, which may be more than
+	// the rows shown.
+	Total         int
+	RetentionDays int64
+	ErrorMessage  string
+}
@@ -0,0 +1,50 @@
+package projects
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/sqlite"
+)
+
+// LoadAgingReport buckets the project's on-hand quantity per SKU and batch
+// by whole days from receipt to now.
+func LoadAgingReport(ctx context.Context, db *sqlite.DB, projectID int64, now time.Time) (AgingPageData, error) {
+	data := AgingPageData{ProjectID: projectID, Projects: make([]AgingProjectOption, 0), Rows: make([]AgingRow, 0)}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT name, client_name FROM projects WHERE id = ?`, projectID).
+			Scan(ctx, &data.ProjectName, fieldcrypt.Dest(&data.ClientName)); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT id, name FROM projects ORDER BY name COLLATE NOCASE, id`).Scan(ctx, &data.Projects); err != nil {
+			return err
+		}
+		return tx.NewRaw(`
+SELECT sku, MAX(description) AS description, batch_number,
+       COALESCE(SUM(CASE WHEN age <= 30 THEN qty END), 0) AS qty_0_30,
+       COALESCE(SUM(CASE WHEN age BETWEEN 31 AND 60 THEN qty END), 0) AS qty_31_60,
+       COALESCE(SUM(CASE WHEN age BETWEEN 61 AND 90 THEN qty END), 0) AS qty_61_90,
+       COALESCE(SUM(CASE WHEN age > 90 THEN qty END), 0) AS qty_90_plus,
+       strftime('%d/%m/%Y', MIN(created_at)) AS oldest_receipt,
+       MAX(age) AS oldest_days
+FROM (
+    SELECT pr.sku, pr.description, COALESCE(pr.batch_number, '') AS batch_number, pr.qty, pr.created_at,
+           MAX(CAST(julianday(?) - julianday(pr.created_at) AS INTEGER), 0) AS age
+    FROM pallet_receipts pr
+    JOIN pallets p ON p.id = pr.pallet_id
+    WHERE pr.project_id = ? AND p.status != 'cancelled'
+)
+GROUP BY sku COLLATE NOCASE, batch_number
+ORDER BY oldest_days DESC, sku COLLATE NOCASE, batch_number`, now, projectID).Scan(ctx, &data.Rows)
+	})
+	if err != nil {
+		return data, err
+	}
+	for i := range data.Projects {
+		data.Projects[i].Selected = data.Projects[i].ID == projectID
+	}
+	return data, nil
+}
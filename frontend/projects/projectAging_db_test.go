@@ -0,0 +1,80 @@
+package projects
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+func TestLoadAgingReport_BucketsOnHandQtyBySKUAndBatch(t *testing.T) {
+	db := openProjectLogsTestDB(t)
+	ctx := context.Background()
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+			 (1, 'Inbound', 'd', '2026-01-01', 'Acme', 'inbound', 'active'),
+			 (2, 'Other', 'd', '2026-01-01', 'Beta', 'other', 'active')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'closed'), (2, 1, 'cancelled'), (3, 2, 'closed')`,
+			`INSERT INTO pallet_receipts (project_id, pallet_id, sku, description, scanned_by_user_id, qty, batch_number, created_at) VALUES
+			 (1, 1, 'SKU-A', 'Alpha', 1, 5, 'B1', '2026-05-25 09:00:00'),
+			 (1, 1, 'SKU-A', 'Alpha', 1, 3, 'B1', '2026-04-20 09:00:00'),
+			 (1, 1, 'SKU-A', 'Alpha', 1, 2, 'B1', '2026-03-20 09:00:00'),
+			 (1, 1, 'SKU-A', 'Alpha', 1, 7, 'B2', '2026-01-15 09:00:00'),
+			 (1, 1, 'SKU-B', 'Bravo', 1, 4, NULL, '2026-05-31 09:00:00'),
+			 (1, 2, 'SKU-B', 'Bravo', 1, 9, NULL, '2025-01-01 09:00:00'),
+			 (2, 3, 'SKU-A', 'Alpha', 1, 11, 'B1', '2025-01-01 09:00:00')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	data, err := LoadAgingReport(ctx, db, 1, time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("load aging report: %v", err)
+	}
+	if data.ProjectName != "Inbound" || data.ClientName != "Acme" {
+		t.Fatalf("project = %q (%q)", data.ProjectName, data.ClientName)
+	}
+	if len(data.Projects) != 2 || !data.Projects[0].Selected || data.Projects[1].Selected {
+		t.Fatalf("project options = %+v", data.Projects)
+	}
+	// Oldest first: B2 at 137 days, then B1 at 73 days, then SKU-B; the
+	// cancelled pallet and the other project are left out.
+	if len(data.Rows) != 3 {
+		t.Fatalf("rows = %+v, want 3", data.Rows)
+	}
+	b2, b1, skuB := data.Rows[0], data.Rows[1], data.Rows[2]
+	if b2.BatchNumber != "B2" || b2.Qty90Plus != 7 || b2.OldestDays != 137 || b2.OldestReceipt != "15/01/2026" {
+		t.Fatalf("B2 = %+v", b2)
+	}
+	if b1.BatchNumber != "B1" || b1.Qty0To30 != 5 || b1.Qty31To60 != 3 || b1.Qty61To90 != 2 || b1.Total() != 10 {
+		t.Fatalf("B1 = %+v", b1)
+	}
+	if skuB.SKU != "SKU-B" || skuB.Qty0To30 != 4 || skuB.Total() != 4 || skuB.OldestDays != 1 {
+		t.Fatalf("SKU-B = %+v", skuB)
+	}
+	if totals := data.Totals(); totals.Total() != 21 || totals.Qty90Plus != 7 {
+		t.Fatalf("totals = %+v", totals)
+	}
+
+	var buf bytes.Buffer
+	if err := writeAgingCSV(&buf, data.Rows, 1); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || lines[1] != "SKU-A,Alpha,B2,0,0,0,7,7,15/01/2026,137" {
+		t.Fatalf("csv = %q", buf.String())
+	}
+}
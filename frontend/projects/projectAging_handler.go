@@ -0,0 +1,110 @@
+package projects
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/infrastructure/exportformat"
+	"receipter/infrastructure/sqlite"
+)
+
+func agingPageURL(projectID int64) string {
+	return fmt.Sprintf("/tasker/projects/%d/aging", projectID)
+}
+
+func AgingReportPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		// The project filter submits the chosen project as a query value.
+		if selected, err := strconv.ParseInt(r.URL.Query().Get("project"), 10, 64); err == nil && selected > 0 && selected != projectID {
+			http.Redirect(w, r, agingPageURL(selected), http.StatusSeeOther)
+			return
+		}
+		data, err := LoadAgingReport(r.Context(), db, projectID, time.Now().UTC())
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Project not found"), http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "failed to load aging report", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := AgingReportPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render aging report", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func AgingExportCSVHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Error(w, "invalid project id", http.StatusBadRequest)
+			return
+		}
+		version, err := exportformat.InventoryAging.ParseVersion(r.URL.Query().Get(exportformat.QueryParam))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := LoadAgingReport(r.Context(), db, projectID, time.Now().UTC())
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "project not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to load aging report", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=inventory-aging-project-%d.csv", projectID))
+		w.Header().Set(exportformat.ResponseHeader, strconv.Itoa(version))
+		if err := writeAgingCSV(w, data.Rows, version); err != nil {
+			http.Error(w, "failed to export csv", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func writeAgingCSV(w io.Writer, rows []AgingRow, version int) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportformat.InventoryAging.Header(version)); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := exportformat.InventoryAging.Record(version, []string{
+			row.SKU,
+			row.Description,
+			row.BatchNumber,
+			strconv.FormatInt(row.Qty0To30, 10),
+			strconv.FormatInt(row.Qty31To60, 10),
+			strconv.FormatInt(row.Qty61To90, 10),
+			strconv.FormatInt(row.Qty90Plus, 10),
+			strconv.FormatInt(row.Total(), 10),
+			row.OldestReceipt,
+			strconv.FormatInt(row.OldestDays, 10),
+		})
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
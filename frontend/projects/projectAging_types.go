@@ -0,0 +1,58 @@
+package projects
+
+// AgingBuckets are the day ranges of the aging report, by whole days since
+// the line was received.
+var AgingBuckets = []string{"0–30 days", "31–60 days", "61–90 days", "90+ days"}
+
+// AgingRow is the on-hand quantity of one SKU and batch, split by how long
+// ago it was received.
+type AgingRow struct {
+	SKU         string `bun:"sku"`
+	Description string `bun:"description"`
+	BatchNumber string `bun:"batch_number"`
+	Qty0To30    int64  `bun:"qty_0_30"`
+	Qty31To60   int64  `bun:"qty_31_60"`
+	Qty61To90   int64  `bun:"qty_61_90"`
+	Qty90Plus   int64  `bun:"qty_90_plus"`
+	// OldestReceipt is the date of the earliest receipt still counted, and
+	// OldestDays its age.
+	OldestReceipt string `bun:"oldest_receipt"`
+	OldestDays    int64  `bun:"oldest_days"`
+}
+
+func (r AgingRow) Buckets() []int64 {
+	return []int64{r.Qty0To30, r.Qty31To60, r.Qty61To90, r.Qty90Plus}
+}
+
+func (r AgingRow) Total() int64 {
+	return r.Qty0To30 + r.Qty31To60 + r.Qty61To90 + r.Qty90Plus
+}
+
+type AgingProjectOption struct {
+	ID       int64  `bun:"id"`
+	Name     string `bun:"name"`
+	Selected bool   `bun:"-"`
+}
+
+// AgingPageData is the inventory aging report of one project. Without
+// despatch or adjustment records every received unit on a pallet that was
+// not cancelled is counted as on hand.
+type AgingPageData struct {
+	ProjectID   int64
+	ProjectName string
+	ClientName  string
+	Projects    []AgingProjectOption
+	Rows        []AgingRow
+}
+
+// Totals sums every row's buckets.
+func (d AgingPageData) Totals() AgingRow {
+	var total AgingRow
+	for _, row := range d.Rows {
+		total.Qty0To30 += row.Qty0To30
+		total.Qty31To60 += row.Qty31To60
+		total.Qty61To90 += row.Qty61To90
+		total.Qty90Plus += row.Qty90Plus
+	}
+	return total
+}
@@ -0,0 +1,25 @@
+package projects
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/auditorlink"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/sqlite"
+)
+
+func LoadAuditorLinksPageData(ctx context.Context, db *sqlite.DB, projectID int64, now time.Time) (AuditorLinksPageData, error) {
+	data := AuditorLinksPageData{ProjectID: projectID, Now: now}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT name, client_name FROM projects WHERE id = ?`, projectID).
+			Scan(ctx, &data.ProjectName, fieldcrypt.Dest(&data.ClientName))
+	})
+	if err != nil {
+		return data, err
+	}
+	data.Links, err = auditorlink.List(ctx, db, projectID, now)
+	return data, err
+}
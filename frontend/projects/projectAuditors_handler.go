@@ -0,0 +1,132 @@
+package projects
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/auditorlink"
+	"receipter/infrastructure/sqlite"
+)
+
+func auditorLinksURL(projectID int64) string {
+	return fmt.Sprintf("/tasker/projects/%d/auditors", projectID)
+}
+
+func AuditorLinksPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		data, err := LoadAuditorLinksPageData(r.Context(), db, projectID, time.Now().UTC())
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Project not found"), http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "failed to load auditor links", http.StatusInternalServerError)
+			return
+		}
+		data.Status = r.URL.Query().Get("status")
+		data.ErrorMessage = r.URL.Query().Get("error")
+		renderAuditorLinksPage(w, r, data)
+	}
+}
+
+// IssueAuditorLinkCommandHandler renders the page directly instead of
+// redirecting so the link never appears in a redirect or log.
+func IssueAuditorLinkCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, auditorLinksURL(projectID)+"?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		days, err := strconv.Atoi(strings.TrimSpace(r.FormValue("days")))
+		if err != nil {
+			http.Redirect(w, r, auditorLinksURL(projectID)+"?error="+url.QueryEscape(auditorlink.ErrInvalidPeriod.Error()), http.StatusSeeOther)
+			return
+		}
+		now := time.Now().UTC()
+		plaintext, link, err := auditorlink.Issue(r.Context(), db, auditSvc, session.UserID, projectID, r.FormValue("auditor_name"), days, now)
+		if err != nil {
+			message := "failed to issue auditor link"
+			if errors.Is(err, auditorlink.ErrNameRequired) || errors.Is(err, auditorlink.ErrNameTooLong) || errors.Is(err, auditorlink.ErrInvalidPeriod) || errors.Is(err, auditorlink.ErrUnknownProject) {
+				message = err.Error()
+			}
+			http.Redirect(w, r, auditorLinksURL(projectID)+"?error="+url.QueryEscape(message), http.StatusSeeOther)
+			return
+		}
+
+		data, err := LoadAuditorLinksPageData(r.Context(), db, projectID, now)
+		if err != nil {
+			http.Error(w, "failed to load auditor links", http.StatusInternalServerError)
+			return
+		}
+		data.IssuedURL = auditorBaseURL(r) + "/audit/" + url.PathEscape(plaintext)
+		data.IssuedAuditor = link.AuditorName
+		w.Header().Set("Cache-Control", "no-store")
+		renderAuditorLinksPage(w, r, data)
+	}
+}
+
+func RevokeAuditorLinkCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		linkID, err := strconv.ParseInt(chi.URLParam(r, "linkID"), 10, 64)
+		if err != nil || linkID <= 0 {
+			http.Redirect(w, r, auditorLinksURL(projectID)+"?error="+url.QueryEscape("invalid link id"), http.StatusSeeOther)
+			return
+		}
+		if err := auditorlink.Revoke(r.Context(), db, auditSvc, session.UserID, projectID, linkID); err != nil {
+			http.Redirect(w, r, auditorLinksURL(projectID)+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, auditorLinksURL(projectID)+"?status="+url.QueryEscape("Link revoked"), http.StatusSeeOther)
+	}
+}
+
+func auditorBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func renderAuditorLinksPage(w http.ResponseWriter, r *http.Request, data AuditorLinksPageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := AuditorLinksPage(data).Render(r.Context(), w); err != nil {
+		http.Error(w, "failed to render auditor links", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,21 @@
+package projects
+
+import (
+	"time"
+
+	"receipter/infrastructure/auditorlink"
+)
+
+type AuditorLinksPageData struct {
+	ProjectID   int64
+	ProjectName string
+	ClientName  string
+	Links       []auditorlink.LinkView
+	Now         time.Time
+	Status      string
+	// ErrorMessage is shown above the form.
+	ErrorMessage string
+	// IssuedURL carries a just-issued link; it is shown once.
+	IssuedURL     string
+	IssuedAuditor string
+}
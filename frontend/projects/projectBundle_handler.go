@@ -0,0 +1,42 @@
+package projects
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/infrastructure/projectbundle"
+	"receipter/infrastructure/sqlite"
+)
+
+// ExportBundleQueryHandler downloads the project as a portable bundle for
+// import on another instance with cmd/projectBundle.
+func ExportBundleQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+
+		var buf bytes.Buffer
+		manifest, err := projectbundle.Export(r.Context(), db, projectID, &buf)
+		if err != nil {
+			if errors.Is(err, projectbundle.ErrProjectNotFound) {
+				http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Project not found"), http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "failed to export project bundle", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="project-%s.zip"`, url.PathEscape(manifest.ProjectCode)))
+		_, _ = w.Write(buf.Bytes())
+	}
+}
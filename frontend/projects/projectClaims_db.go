@@ -0,0 +1,311 @@
+package projects
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/claimpack"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/sqlite"
+)
+
+var ErrNoClaimLines = errors.New("there are no unclaimed damaged lines for this scope")
+
+// claimLineColumns selects a damaged line of pallet_receipts pr on pallet p.
+// Older lines may carry a damaged qty without the damaged flag.
+const claimLineColumns = `
+SELECT pr.id AS receipt_id, pr.pallet_id,
+       COALESCE(pa.delivery_reference, '') AS delivery_reference,
+       pr.sku, pr.description,
+       COALESCE(pr.batch_number, '') AS batch_number,
+       COALESCE(strftime('%d/%m/%Y', pr.expiry_date), '') AS expiry,
+       CASE WHEN pr.damaged_qty > 0 THEN pr.damaged_qty ELSE pr.qty END AS damaged_qty,
+       COALESCE(dr.label, pr.damage_reason) AS damage_reason,
+       COALESCE(u.username, '') AS scanned_by,
+       strftime('%d/%m/%Y %H:%M', pr.created_at) AS scanned_at,
+       (SELECT COUNT(*) FROM receipt_photos rp WHERE rp.pallet_receipt_id = pr.id)
+         + CASE WHEN pr.stock_photo_blob IS NOT NULL AND length(pr.stock_photo_blob) > 0 THEN 1 ELSE 0 END AS photo_count
+FROM pallet_receipts pr
+JOIN pallets p ON p.id = pr.pallet_id
+LEFT JOIN pallet_attributes pa ON pa.pallet_id = pr.pallet_id
+LEFT JOIN damage_reasons dr ON dr.code = pr.damage_reason
+LEFT JOIN users u ON u.id = pr.scanned_by_user_id`
+
+// unclaimedWhere limits claimLineColumns to the project's damaged lines on
+// live pallets that are in no claim yet.
+const unclaimedWhere = `
+WHERE pr.project_id = ?
+  AND (pr.damaged = 1 OR pr.damaged_qty > 0)
+  AND p.status <> 'cancelled'
+  AND NOT EXISTS (SELECT 1 FROM damage_claim_lines dcl WHERE dcl.pallet_receipt_id = pr.id)`
+
+const claimSelect = `
+SELECT c.id, c.delivery_reference, c.claim_reference, c.line_count, c.damaged_qty,
+       COALESCE(u.username, '') AS raised_by,
+       strftime('%d/%m/%Y %H:%M', c.created_at) AS raised_at
+FROM damage_claims c
+LEFT JOIN users u ON u.id = c.created_by_user_id`
+
+func LoadClaimsPageData(ctx context.Context, db *sqlite.DB, projectID int64) (ClaimsPageData, error) {
+	data := ClaimsPageData{
+		ProjectID:  projectID,
+		Unclaimed:  make([]ClaimLine, 0),
+		Deliveries: make([]ClaimDelivery, 0),
+		Claims:     make([]DamageClaim, 0),
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT name, client_name FROM projects WHERE id = ?`, projectID).
+			Scan(ctx, &data.ProjectName, fieldcrypt.Dest(&data.ClientName)); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(claimLineColumns+unclaimedWhere+` ORDER BY pr.pallet_id, pr.id`, projectID).Scan(ctx, &data.Unclaimed); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(claimSelect+` WHERE c.project_id = ? ORDER BY c.id DESC`, projectID).Scan(ctx, &data.Claims); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return data, err
+	}
+
+	byRef := make(map[string]int)
+	for _, line := range data.Unclaimed {
+		if line.DeliveryReference == "" {
+			continue
+		}
+		i, ok := byRef[line.DeliveryReference]
+		if !ok {
+			i = len(data.Deliveries)
+			byRef[line.DeliveryReference] = i
+			data.Deliveries = append(data.Deliveries, ClaimDelivery{Reference: line.DeliveryReference})
+		}
+		data.Deliveries[i].Lines++
+		data.Deliveries[i].DamagedQty += line.DamagedQty
+	}
+	return data, nil
+}
+
+// LoadDamageClaim returns a register entry of the project with its lines.
+func LoadDamageClaim(ctx context.Context, db *sqlite.DB, projectID, claimID int64) (DamageClaim, []ClaimLine, error) {
+	var claim DamageClaim
+	lines := make([]ClaimLine, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(claimSelect+` WHERE c.id = ? AND c.project_id = ?`, claimID, projectID).Scan(ctx, &claim); err != nil {
+			return err
+		}
+		return tx.NewRaw(claimLineColumns+`
+JOIN damage_claim_lines dcl ON dcl.pallet_receipt_id = pr.id
+WHERE dcl.claim_id = ?
+ORDER BY pr.pallet_id, pr.id`, claimID).Scan(ctx, &lines)
+	})
+	return claim, lines, err
+}
+
+// CreateDamageClaim adds every unclaimed damaged line of the project to a
+// new claim, or only those of one delivery when deliveryReference is set.
+func CreateDamageClaim(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID int64, deliveryReference, claimReference string) (DamageClaim, error) {
+	deliveryReference = strings.TrimSpace(deliveryReference)
+	claimReference = strings.TrimSpace(claimReference)
+	var claim DamageClaim
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		where := unclaimedWhere
+		args := []any{projectID}
+		if deliveryReference != "" {
+			where += ` AND pa.delivery_reference = ?`
+			args = append(args, deliveryReference)
+		}
+		lines := make([]ClaimLine, 0)
+		if err := tx.NewRaw(claimLineColumns+where+` ORDER BY pr.pallet_id, pr.id`, args...).Scan(ctx, &lines); err != nil {
+			return err
+		}
+		if len(lines) == 0 {
+			return ErrNoClaimLines
+		}
+		var damagedQty int64
+		for _, line := range lines {
+			damagedQty += line.DamagedQty
+		}
+
+		var createdBy *int64
+		if userID > 0 {
+			createdBy = &userID
+		}
+		if err := tx.NewRaw(`
+INSERT INTO damage_claims (project_id, delivery_reference, claim_reference, line_count, damaged_qty, created_by_user_id, created_at)
+VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+RETURNING id`, projectID, deliveryReference, claimReference, len(lines), damagedQty, createdBy).Scan(ctx, &claim.ID); err != nil {
+			return err
+		}
+		for _, line := range lines {
+			if _, err := tx.NewRaw(`INSERT INTO damage_claim_lines (claim_id, pallet_receipt_id) VALUES (?, ?)`, claim.ID, line.ReceiptID).Exec(ctx); err != nil {
+				return err
+			}
+		}
+		claim.DeliveryReference = deliveryReference
+		claim.ClaimReference = claimReference
+		claim.LineCount = len(lines)
+		claim.DamagedQty = damagedQty
+
+		if auditSvc == nil {
+			return nil
+		}
+		return auditSvc.Write(ctx, tx, userID, "damage_claim.create", "damage_claims", strconv.FormatInt(claim.ID, 10), nil, map[string]any{
+			"ProjectID":         projectID,
+			"DeliveryReference": deliveryReference,
+			"ClaimReference":    claimReference,
+			"LineCount":         claim.LineCount,
+			"DamagedQty":        damagedQty,
+		})
+	})
+	return claim, err
+}
+
+// LoadClaimPack gathers a claim's lines, their photos and the audit trail of
+// the claim and its lines for rendering.
+func LoadClaimPack(ctx context.Context, db *sqlite.DB, projectID, claimID int64, now time.Time) (claimpack.Pack, error) {
+	pack := claimpack.Pack{ClaimID: claimID, GeneratedAt: now}
+	claim, lines, err := LoadDamageClaim(ctx, db, projectID, claimID)
+	if err != nil {
+		return pack, err
+	}
+	pack.ClaimReference = claim.ClaimReference
+	pack.DeliveryReference = claim.DeliveryReference
+	pack.RaisedBy = claim.RaisedBy
+	for _, line := range lines {
+		pack.Lines = append(pack.Lines, claimpack.Line{
+			ReceiptID:    line.ReceiptID,
+			PalletID:     line.PalletID,
+			SKU:          line.SKU,
+			Description:  line.Description,
+			BatchNumber:  line.BatchNumber,
+			Expiry:       line.Expiry,
+			DamagedQty:   line.DamagedQty,
+			DamageReason: line.DamageReason,
+			ScannedBy:    line.ScannedBy,
+			ScannedAt:    line.ScannedAt,
+		})
+	}
+
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`
+SELECT p.name, p.client_name, c.created_at
+FROM damage_claims c
+JOIN projects p ON p.id = c.project_id
+WHERE c.id = ?`, claimID).Scan(ctx, &pack.ProjectName, fieldcrypt.Dest(&pack.ClientName), &pack.RaisedAt); err != nil {
+			return err
+		}
+
+		type photoRow struct {
+			ReceiptID int64  `bun:"receipt_id"`
+			PhotoID   int64  `bun:"photo_id"`
+			MIME      string `bun:"mime"`
+			Blob      []byte `bun:"blob"`
+		}
+		photos := make([]photoRow, 0)
+		if err := tx.NewRaw(`
+SELECT pr.id AS receipt_id, 0 AS photo_id, COALESCE(pr.stock_photo_mime, '') AS mime, pr.stock_photo_blob AS blob
+FROM pallet_receipts pr
+JOIN damage_claim_lines dcl ON dcl.pallet_receipt_id = pr.id
+WHERE dcl.claim_id = ? AND pr.stock_photo_blob IS NOT NULL AND length(pr.stock_photo_blob) > 0
+UNION ALL
+SELECT rp.pallet_receipt_id, rp.id, COALESCE(rp.photo_mime, ''), rp.photo_blob
+FROM receipt_photos rp
+JOIN damage_claim_lines dcl ON dcl.pallet_receipt_id = rp.pallet_receipt_id
+WHERE dcl.claim_id = ?
+ORDER BY receipt_id, photo_id`, claimID, claimID).Scan(ctx, &photos); err != nil {
+			return err
+		}
+		for _, p := range photos {
+			pack.Photos = append(pack.Photos, claimpack.Photo{ReceiptID: p.ReceiptID, PhotoID: p.PhotoID, MIME: p.MIME, Blob: p.Blob})
+		}
+
+		type auditRow struct {
+			Action     string    `bun:"action"`
+			EntityType string    `bun:"entity_type"`
+			EntityID   string    `bun:"entity_id"`
+			BeforeJSON string    `bun:"before_json"`
+			AfterJSON  string    `bun:"after_json"`
+			CreatedAt  time.Time `bun:"created_at"`
+			Actor      string    `bun:"actor"`
+		}
+		rows := make([]auditRow, 0)
+		if err := tx.NewRaw(`
+SELECT al.action, al.entity_type, al.entity_id, al.before_json, al.after_json, al.created_at,
+       COALESCE(u.username, '') AS actor
+FROM audit_logs al
+LEFT JOIN users u ON u.id = al.user_id
+WHERE (al.entity_type = 'damage_claims' AND al.entity_id = CAST(? AS TEXT))
+   OR (al.entity_type = 'pallet_receipts' AND al.entity_id IN (
+        SELECT CAST(pallet_receipt_id AS TEXT) FROM damage_claim_lines WHERE claim_id = ?))
+ORDER BY al.created_at, al.id`, claimID, claimID).Scan(ctx, &rows); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			user := row.Actor
+			if user == "" {
+				user = "system"
+			}
+			pack.Audit = append(pack.Audit, claimpack.AuditEntry{
+				At:      row.CreatedAt.Format("02/01/2006 15:04"),
+				User:    user,
+				Action:  row.Action,
+				Entity:  claimAuditEntity(row.EntityType, row.EntityID),
+				Details: claimAuditDetails(row.EntityType, row.BeforeJSON, row.AfterJSON),
+			})
+		}
+		return nil
+	})
+	return pack, err
+}
+
+func claimAuditEntity(entityType, entityID string) string {
+	if entityType == "damage_claims" {
+		id, _ := strconv.ParseInt(entityID, 10, 64)
+		return claimpack.Number(id)
+	}
+	return "Line " + entityID
+}
+
+// claimAuditSnapshot holds the audited fields the claim pack reports.
+type claimAuditSnapshot struct {
+	Qty          *int64
+	DamagedQty   *int64
+	DamageReason string
+	LineCount    *int
+}
+
+func claimAuditDetails(entityType, beforeJSON, afterJSON string) string {
+	var snapshot claimAuditSnapshot
+	if err := json.Unmarshal([]byte(afterJSON), &snapshot); err != nil {
+		if err := json.Unmarshal([]byte(beforeJSON), &snapshot); err != nil {
+			return ""
+		}
+	}
+	if entityType == "damage_claims" {
+		if snapshot.LineCount == nil || snapshot.DamagedQty == nil {
+			return ""
+		}
+		return fmt.Sprintf("%d lines, %d damaged units", *snapshot.LineCount, *snapshot.DamagedQty)
+	}
+	details := make([]string, 0, 3)
+	if snapshot.Qty != nil {
+		details = append(details, fmt.Sprintf("qty %d", *snapshot.Qty))
+	}
+	if snapshot.DamagedQty != nil {
+		details = append(details, fmt.Sprintf("damaged %d", *snapshot.DamagedQty))
+	}
+	if snapshot.DamageReason != "" {
+		details = append(details, "reason "+snapshot.DamageReason)
+	}
+	return strings.Join(details, ", ")
+}
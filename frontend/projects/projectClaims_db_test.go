@@ -0,0 +1,113 @@
+package projects
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/claimpack"
+)
+
+func TestDamageClaims_RegisterLinesOncePerClaimAndBuildPack(t *testing.T) {
+	db := openProjectLogsTestDB(t)
+	ctx := context.Background()
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+			 (1, 'Inbound', 'd', '2026-01-01', 'Acme', 'inbound', 'active')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'closed'), (2, 1, 'open'), (3, 1, 'cancelled')`,
+			`INSERT INTO pallet_attributes (pallet_id, delivery_reference) VALUES (1, 'DEL-1'), (2, 'DEL-2'), (3, 'DEL-1')`,
+			`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, damaged, damaged_qty, damage_reason) VALUES
+			 (1, 1, 1, 'SKU-A', 'Alpha', 1, 4, 1, 4, 'crushed'),
+			 (2, 1, 1, 'SKU-A', 'Alpha', 1, 6, 0, 0, ''),
+			 (3, 1, 2, 'SKU-B', 'Bravo', 1, 2, 1, 2, ''),
+			 (4, 1, 3, 'SKU-C', 'Charlie', 1, 5, 1, 5, '')`,
+			`INSERT INTO receipt_photos (pallet_receipt_id, photo_blob, photo_mime, photo_name) VALUES (1, X'01020304', 'image/webp', 'crushed.webp')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	data, err := LoadClaimsPageData(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("load claims page: %v", err)
+	}
+	// The undamaged line and the cancelled pallet are left out.
+	if len(data.Unclaimed) != 2 || data.UnclaimedQty() != 6 || len(data.Deliveries) != 2 {
+		t.Fatalf("unclaimed = %+v, deliveries = %+v", data.Unclaimed, data.Deliveries)
+	}
+
+	auditSvc := audit.NewService()
+	claim, err := CreateDamageClaim(ctx, db, auditSvc, 1, 1, "DEL-1", "INS-42")
+	if err != nil {
+		t.Fatalf("create claim: %v", err)
+	}
+	if claim.LineCount != 1 || claim.DamagedQty != 4 || claim.Number() != "CLM-000001" {
+		t.Fatalf("claim = %+v", claim)
+	}
+	if _, err := CreateDamageClaim(ctx, db, auditSvc, 1, 1, "DEL-1", ""); !errors.Is(err, ErrNoClaimLines) {
+		t.Fatalf("second claim on DEL-1 err = %v, want ErrNoClaimLines", err)
+	}
+	second, err := CreateDamageClaim(ctx, db, auditSvc, 1, 1, "", "")
+	if err != nil {
+		t.Fatalf("create project claim: %v", err)
+	}
+	if second.LineCount != 1 || second.DamagedQty != 2 {
+		t.Fatalf("project claim took %+v, want only the unclaimed DEL-2 line", second)
+	}
+
+	data, err = LoadClaimsPageData(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("reload claims page: %v", err)
+	}
+	if len(data.Unclaimed) != 0 || len(data.Claims) != 2 || data.Claims[0].ID != second.ID || data.Claims[1].ClaimReference != "INS-42" {
+		t.Fatalf("register = %+v, unclaimed = %+v", data.Claims, data.Unclaimed)
+	}
+
+	pack, err := LoadClaimPack(ctx, db, 1, claim.ID, time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("load claim pack: %v", err)
+	}
+	if pack.ClientName != "Acme" || pack.DeliveryReference != "DEL-1" || len(pack.Lines) != 1 || len(pack.Photos) != 1 {
+		t.Fatalf("pack = %+v", pack)
+	}
+	if pack.Lines[0].DamageReason != "Crushed" {
+		t.Fatalf("damage reason = %q, want the reason label", pack.Lines[0].DamageReason)
+	}
+	if len(pack.Audit) != 1 || pack.Audit[0].Action != "damage_claim.create" || pack.Audit[0].Details != "1 lines, 4 damaged units" {
+		t.Fatalf("audit = %+v", pack.Audit)
+	}
+
+	var buf bytes.Buffer
+	if err := claimpack.WriteZIP(&buf, pack); err != nil {
+		t.Fatalf("write pack: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("read pack: %v", err)
+	}
+	names := make([]string, 0, len(zr.File))
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if len(names) != 2 || names[0] != "clm-000001.pdf" || names[1] != "photos/line-1-photo-1.webp" {
+		t.Fatalf("pack files = %v", names)
+	}
+	if _, _, err := LoadDamageClaim(ctx, db, 2, claim.ID); err == nil {
+		t.Fatalf("expected claim to be scoped to its project")
+	}
+}
@@ -0,0 +1,131 @@
+package projects
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/claimpack"
+	"receipter/infrastructure/sqlite"
+)
+
+func claimsURL(projectID int64) string {
+	return fmt.Sprintf("/tasker/projects/%d/claims", projectID)
+}
+
+func ClaimsPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		data, err := LoadClaimsPageData(r.Context(), db, projectID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Project not found"), http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "failed to load damage claims", http.StatusInternalServerError)
+			return
+		}
+		query := r.URL.Query()
+		data.Status = query.Get("status")
+		data.ErrorMessage = query.Get("error")
+
+		if claimID, _ := strconv.ParseInt(query.Get("claim"), 10, 64); claimID > 0 {
+			claim, lines, err := LoadDamageClaim(r.Context(), db, projectID, claimID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "failed to load damage claim", http.StatusInternalServerError)
+				return
+			}
+			if err == nil {
+				data.Selected = &claim
+				data.SelectedLines = lines
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := ClaimsPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render damage claims", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func CreateDamageClaimCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		pageURL := claimsURL(projectID)
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape("invalid form"), http.StatusSeeOther)
+			return
+		}
+
+		claim, err := CreateDamageClaim(r.Context(), db, auditSvc, session.UserID, projectID, r.FormValue("delivery_reference"), r.FormValue("claim_reference"))
+		if err != nil {
+			msg := "failed to create claim"
+			if errors.Is(err, ErrNoClaimLines) {
+				msg = err.Error()
+			}
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape(msg), http.StatusSeeOther)
+			return
+		}
+		status := fmt.Sprintf("%s raised: %d lines, %d damaged units", claim.Number(), claim.LineCount, claim.DamagedQty)
+		http.Redirect(w, r, fmt.Sprintf("%s?claim=%d&status=%s", pageURL, claim.ID, url.QueryEscape(status)), http.StatusSeeOther)
+	}
+}
+
+// ClaimPackDownloadHandler builds a claim's pack on demand, so it always
+// carries the current photos and audit trail of the claimed lines.
+func ClaimPackDownloadHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Error(w, "invalid project id", http.StatusBadRequest)
+			return
+		}
+		claimID, err := strconv.ParseInt(chi.URLParam(r, "claimID"), 10, 64)
+		if err != nil || claimID <= 0 {
+			http.Error(w, "invalid claim id", http.StatusBadRequest)
+			return
+		}
+		pack, err := LoadClaimPack(r.Context(), db, projectID, claimID, time.Now().UTC())
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "claim not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to load claim", http.StatusInternalServerError)
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := claimpack.WriteZIP(&buf, pack); err != nil {
+			http.Error(w, "failed to build claim pack", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", "attachment; filename="+pack.FileName())
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		_, _ = w.Write(buf.Bytes())
+	}
+}
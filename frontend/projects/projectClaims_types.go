@@ -0,0 +1,85 @@
+package projects
+
+import (
+	"fmt"
+
+	"receipter/infrastructure/claimpack"
+)
+
+// DamageClaim is one entry of a project's claims register.
+type DamageClaim struct {
+	ID                int64  `bun:"id"`
+	DeliveryReference string `bun:"delivery_reference"`
+	ClaimReference    string `bun:"claim_reference"`
+	LineCount         int    `bun:"line_count"`
+	DamagedQty        int64  `bun:"damaged_qty"`
+	RaisedBy          string `bun:"raised_by"`
+	RaisedAt          string `bun:"raised_at"`
+}
+
+// Number is the register number printed on the claim pack.
+func (c DamageClaim) Number() string {
+	return claimpack.Number(c.ID)
+}
+
+// DeliveryLabel names the claim's scope.
+func (c DamageClaim) DeliveryLabel() string {
+	if c.DeliveryReference == "" {
+		return "All deliveries"
+	}
+	return c.DeliveryReference
+}
+
+// ClaimLine is a damaged receipt line, claimed or still open to claim.
+type ClaimLine struct {
+	ReceiptID         int64  `bun:"receipt_id"`
+	PalletID          int64  `bun:"pallet_id"`
+	DeliveryReference string `bun:"delivery_reference"`
+	SKU               string `bun:"sku"`
+	Description       string `bun:"description"`
+	BatchNumber       string `bun:"batch_number"`
+	Expiry            string `bun:"expiry"`
+	DamagedQty        int64  `bun:"damaged_qty"`
+	DamageReason      string `bun:"damage_reason"`
+	ScannedBy         string `bun:"scanned_by"`
+	ScannedAt         string `bun:"scanned_at"`
+	PhotoCount        int    `bun:"photo_count"`
+}
+
+// ClaimDelivery is a delivery reference with damaged lines not yet in a
+// claim.
+type ClaimDelivery struct {
+	Reference  string `bun:"delivery_reference"`
+	Lines      int    `bun:"lines"`
+	DamagedQty int64  `bun:"damaged_qty"`
+}
+
+// Label names the delivery in the scope picker.
+func (d ClaimDelivery) Label() string {
+	return fmt.Sprintf("%s (%d lines, %d units)", d.Reference, d.Lines, d.DamagedQty)
+}
+
+type ClaimsPageData struct {
+	ProjectID   int64
+	ProjectName string
+	ClientName  string
+	// Unclaimed lists damaged lines not in any claim yet, and Deliveries
+	// groups them for the scope picker.
+	Unclaimed  []ClaimLine
+	Deliveries []ClaimDelivery
+	Claims     []DamageClaim
+	// Selected is the register entry whose lines are shown.
+	Selected      *DamageClaim
+	SelectedLines []ClaimLine
+	Status        string
+	ErrorMessage  string
+}
+
+// UnclaimedQty sums the damaged units not yet claimed.
+func (d ClaimsPageData) UnclaimedQty() int64 {
+	var total int64
+	for _, line := range d.Unclaimed {
+		total += line.DamagedQty
+	}
+	return total
+}
@@ -0,0 +1,32 @@
+package projects
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/customfield"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/sqlite"
+)
+
+func LoadCustomFieldsPageData(ctx context.Context, db *sqlite.DB, projectID int64) (CustomFieldsPageData, error) {
+	data := CustomFieldsPageData{
+		ProjectID: projectID,
+		Fields:    make([]CustomFieldView, 0),
+		Types:     customfield.Types,
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT name, client_name, status FROM projects WHERE id = ?`, projectID).
+			Scan(ctx, &data.ProjectName, fieldcrypt.Dest(&data.ClientName), &data.ProjectStatus); err != nil {
+			return err
+		}
+		return tx.NewRaw(`
+SELECT pcf.id, pcf.key, pcf.label, pcf.field_type, pcf.required, pcf.sort_order, pcf.active,
+       (SELECT COUNT(1) FROM receipt_custom_values rcv WHERE rcv.field_id = pcf.id) AS value_count
+FROM project_custom_fields pcf
+WHERE pcf.project_id = ?
+ORDER BY pcf.sort_order ASC, pcf.label ASC, pcf.id ASC`, projectID).Scan(ctx, &data.Fields)
+	})
+	return data, err
+}
@@ -0,0 +1,132 @@
+package projects
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/customfield"
+	"receipter/infrastructure/sqlite"
+)
+
+func CustomFieldsPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+
+		data, err := LoadCustomFieldsPageData(r.Context(), db, projectID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Project not found"), http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "failed to load custom fields", http.StatusInternalServerError)
+			return
+		}
+		data.Status = r.URL.Query().Get("status")
+		data.ErrorMessage = r.URL.Query().Get("error")
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := CustomFieldsPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render custom fields page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func CreateCustomFieldCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		pageURL := customFieldsURL(projectID)
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		sortOrder, err := parseCustomFieldSortOrder(r.FormValue("sort_order"))
+		if err != nil {
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		required := r.FormValue("required") != ""
+		if _, err := customfield.Create(r.Context(), db, auditSvc, session.UserID, projectID, r.FormValue("key"), r.FormValue("label"), r.FormValue("field_type"), required, sortOrder); err != nil {
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, pageURL+"?status="+url.QueryEscape("custom field created"), http.StatusSeeOther)
+	}
+}
+
+func UpdateCustomFieldCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		pageURL := customFieldsURL(projectID)
+		fieldID, err := strconv.ParseInt(chi.URLParam(r, "fieldID"), 10, 64)
+		if err != nil || fieldID <= 0 {
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape("invalid custom field id"), http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		sortOrder, err := parseCustomFieldSortOrder(r.FormValue("sort_order"))
+		if err != nil {
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		required := r.FormValue("required") != ""
+		active := r.FormValue("active") != ""
+		if err := customfield.Update(r.Context(), db, auditSvc, session.UserID, projectID, fieldID, r.FormValue("label"), required, sortOrder, active); err != nil {
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, pageURL+"?status="+url.QueryEscape("custom field updated"), http.StatusSeeOther)
+	}
+}
+
+func customFieldsURL(projectID int64) string {
+	return fmt.Sprintf("/tasker/projects/%d/custom-fields", projectID)
+}
+
+var errInvalidCustomFieldSortOrder = errors.New("sort order must be a whole number")
+
+func parseCustomFieldSortOrder(raw string) (int, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, errInvalidCustomFieldSortOrder
+	}
+	return v, nil
+}
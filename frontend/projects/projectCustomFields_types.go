@@ -0,0 +1,23 @@
+package projects
+
+type CustomFieldView struct {
+	ID         int64
+	Key        string
+	Label      string
+	FieldType  string
+	Required   bool
+	SortOrder  int
+	Active     bool
+	ValueCount int64
+}
+
+type CustomFieldsPageData struct {
+	ProjectID     int64
+	ProjectName   string
+	ClientName    string
+	ProjectStatus string
+	Fields        []CustomFieldView
+	Types         []string
+	Status        string
+	ErrorMessage  string
+}
@@ -0,0 +1,72 @@
+package projects
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/customs"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/sqlite"
+)
+
+// customsLinesFrom selects the project's lines on live pallets with their
+// delivery reference.
+const customsLinesFrom = `
+FROM pallet_receipts pr
+JOIN pallets p ON p.id = pr.pallet_id
+LEFT JOIN pallet_attributes pa ON pa.pallet_id = pr.pallet_id
+WHERE pr.project_id = ? AND p.status <> 'cancelled'`
+
+// LoadCustomsReport summarizes the project's customs data per delivery and
+// totals the declaration of one delivery. With delivery nil the first
+// delivery is shown.
+func LoadCustomsReport(ctx context.Context, db *sqlite.DB, projectID int64, delivery *string) (CustomsPageData, error) {
+	data := CustomsPageData{
+		ProjectID:  projectID,
+		Deliveries: make([]CustomsDelivery, 0),
+		Rows:       make([]CustomsDeclarationRow, 0),
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT name, client_name FROM projects WHERE id = ?`, projectID).
+			Scan(ctx, &data.ProjectName, fieldcrypt.Dest(&data.ClientName)); err != nil {
+			return err
+		}
+		settings, err := projectsettings.LoadTx(ctx, tx, projectID)
+		if err != nil {
+			return err
+		}
+		data.Config = customs.LoadConfig(settings)
+		if err := tx.NewRaw(`
+SELECT COALESCE(pa.delivery_reference, '') AS delivery_reference,
+       COUNT(*) AS lines,
+       COUNT(DISTINCT pr.pallet_id) AS pallets,
+       SUM(pr.qty) AS qty,
+       SUM(CASE WHEN (? AND pr.country_of_origin = '') OR (? AND pr.hs_code = '') THEN 1 ELSE 0 END) AS missing`+customsLinesFrom+`
+GROUP BY COALESCE(pa.delivery_reference, '')
+ORDER BY COALESCE(pa.delivery_reference, '') = '', MIN(pr.created_at)`,
+			data.Config.CaptureCountry(), data.Config.CaptureHSCode(), projectID).Scan(ctx, &data.Deliveries); err != nil {
+			return err
+		}
+		for i := range data.Deliveries {
+			if data.Selected == nil && (delivery == nil || *delivery == data.Deliveries[i].Reference) {
+				data.Deliveries[i].Selected = true
+				data.Selected = &data.Deliveries[i]
+			}
+		}
+		if data.Selected == nil {
+			return nil
+		}
+		return tx.NewRaw(`
+SELECT pr.country_of_origin, pr.hs_code, pr.sku, MAX(pr.description) AS description,
+       COUNT(*) AS lines,
+       COUNT(DISTINCT pr.pallet_id) AS pallets,
+       SUM(pr.qty) AS qty`+customsLinesFrom+`
+  AND COALESCE(pa.delivery_reference, '') = ?
+GROUP BY pr.country_of_origin, pr.hs_code, pr.sku
+ORDER BY pr.country_of_origin = '', pr.country_of_origin, pr.hs_code, pr.sku COLLATE NOCASE`,
+			projectID, data.Selected.Reference).Scan(ctx, &data.Rows)
+	})
+	return data, err
+}
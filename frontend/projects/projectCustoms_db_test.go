@@ -0,0 +1,88 @@
+package projects
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/uptrace/bun"
+)
+
+func TestLoadCustomsReport_TotalsDeliveryByOriginAndHSCode(t *testing.T) {
+	db := openProjectLogsTestDB(t)
+	ctx := context.Background()
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+			 (1, 'Bonded', 'd', '2026-01-01', 'Acme', 'bonded', 'active')`,
+			`INSERT INTO project_settings (project_id, key, value) VALUES (1, 'customs.country_of_origin', 'required'), (1, 'customs.hs_code', 'optional')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'closed'), (2, 1, 'closed'), (3, 1, 'cancelled'), (4, 1, 'open')`,
+			`INSERT INTO pallet_attributes (pallet_id, delivery_reference) VALUES (1, 'DEL-1'), (2, 'DEL-1'), (3, 'DEL-1')`,
+			`INSERT INTO pallet_receipts (project_id, pallet_id, sku, description, scanned_by_user_id, qty, country_of_origin, hs_code, created_at) VALUES
+			 (1, 1, 'SKU-A', 'Alpha', 1, 5, 'CN', '392310', '2026-05-01 09:00:00'),
+			 (1, 2, 'SKU-A', 'Alpha', 1, 3, 'CN', '392310', '2026-05-01 10:00:00'),
+			 (1, 2, 'SKU-A', 'Alpha', 1, 4, 'VN', '392310', '2026-05-01 10:05:00'),
+			 (1, 2, 'SKU-B', 'Bravo', 1, 2, '', '', '2026-05-01 10:10:00'),
+			 (1, 3, 'SKU-A', 'Alpha', 1, 9, 'CN', '392310', '2026-05-01 11:00:00'),
+			 (1, 4, 'SKU-C', 'Charlie', 1, 1, 'GB', '', '2026-05-02 09:00:00')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	data, err := LoadCustomsReport(ctx, db, 1, nil)
+	if err != nil {
+		t.Fatalf("load customs report: %v", err)
+	}
+	// The delivery without a reference is listed last, and the cancelled
+	// pallet is left out. A blank HS code is missing data even though it is
+	// optional.
+	if len(data.Deliveries) != 2 {
+		t.Fatalf("deliveries = %+v, want 2", data.Deliveries)
+	}
+	del1, none := data.Deliveries[0], data.Deliveries[1]
+	if del1.Reference != "DEL-1" || del1.Pallets != 2 || del1.Lines != 4 || del1.Qty != 14 || del1.Missing != 1 || !del1.Selected {
+		t.Fatalf("DEL-1 = %+v", del1)
+	}
+	if none.Label() != "No delivery reference" || none.Lines != 1 || none.Missing != 1 {
+		t.Fatalf("unreferenced delivery = %+v", none)
+	}
+
+	// Lines without an origin sort after the declared ones.
+	if len(data.Rows) != 3 {
+		t.Fatalf("rows = %+v, want 3", data.Rows)
+	}
+	cn, vn, blank := data.Rows[0], data.Rows[1], data.Rows[2]
+	if cn.CountryOfOrigin != "CN" || cn.CountryName() != "China" || cn.Qty != 8 || cn.Pallets != 2 || cn.Lines != 2 {
+		t.Fatalf("CN row = %+v", cn)
+	}
+	if vn.CountryOfOrigin != "VN" || vn.Qty != 4 || blank.SKU != "SKU-B" || blank.CountryName() != "" {
+		t.Fatalf("rows = %+v", data.Rows)
+	}
+
+	empty := ""
+	data, err = LoadCustomsReport(ctx, db, 1, &empty)
+	if err != nil {
+		t.Fatalf("load unreferenced delivery: %v", err)
+	}
+	if data.Selected == nil || data.Selected.Reference != "" || len(data.Rows) != 1 || data.Rows[0].SKU != "SKU-C" {
+		t.Fatalf("unreferenced delivery rows = %+v", data.Rows)
+	}
+
+	var buf bytes.Buffer
+	if err := writeCustomsCSV(&buf, "", data.Rows, 1); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	want := "delivery_reference,country_of_origin,country_name,hs_code,sku,description,lines,pallets,qty\n,GB,United Kingdom,,SKU-C,Charlie,1,1,1\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("csv = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,118 @@
+package projects
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/infrastructure/exportformat"
+	"receipter/infrastructure/sqlite"
+)
+
+func customsPageURL(projectID int64) string {
+	return fmt.Sprintf("/tasker/projects/%d/customs", projectID)
+}
+
+// requestedDelivery reads the delivery query value. An empty value selects
+// lines without a delivery reference, so only a missing one means "first".
+func requestedDelivery(r *http.Request) *string {
+	query := r.URL.Query()
+	if !query.Has("delivery") {
+		return nil
+	}
+	delivery := query.Get("delivery")
+	return &delivery
+}
+
+func CustomsReportPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		data, err := LoadCustomsReport(r.Context(), db, projectID, requestedDelivery(r))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Project not found"), http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "failed to load customs report", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := CustomsReportPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render customs report", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func CustomsExportCSVHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Error(w, "invalid project id", http.StatusBadRequest)
+			return
+		}
+		version, err := exportformat.CustomsDeclaration.ParseVersion(r.URL.Query().Get(exportformat.QueryParam))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := LoadCustomsReport(r.Context(), db, projectID, requestedDelivery(r))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "project not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to load customs report", http.StatusInternalServerError)
+			return
+		}
+		if data.Selected == nil {
+			http.Error(w, "delivery not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=customs-declaration-project-%d.csv", projectID))
+		w.Header().Set(exportformat.ResponseHeader, strconv.Itoa(version))
+		if err := writeCustomsCSV(w, data.Selected.Reference, data.Rows, version); err != nil {
+			http.Error(w, "failed to export csv", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func writeCustomsCSV(w io.Writer, delivery string, rows []CustomsDeclarationRow, version int) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportformat.CustomsDeclaration.Header(version)); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := exportformat.CustomsDeclaration.Record(version, []string{
+			delivery,
+			row.CountryOfOrigin,
+			row.CountryName(),
+			row.HSCode,
+			row.SKU,
+			row.Description,
+			strconv.FormatInt(row.Lines, 10),
+			strconv.FormatInt(row.Pallets, 10),
+			strconv.FormatInt(row.Qty, 10),
+		})
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,56 @@
+package projects
+
+import "receipter/infrastructure/customs"
+
+// CustomsDelivery is one delivery of a project's customs declaration
+// report. Lines on pallets without a delivery reference share the empty
+// reference.
+type CustomsDelivery struct {
+	Reference string `bun:"delivery_reference"`
+	Lines     int64  `bun:"lines"`
+	Pallets   int64  `bun:"pallets"`
+	Qty       int64  `bun:"qty"`
+	// Missing counts lines without a customs field the project captures.
+	Missing  int64 `bun:"missing"`
+	Selected bool  `bun:"-"`
+}
+
+// Label names the delivery in the report.
+func (d CustomsDelivery) Label() string {
+	if d.Reference == "" {
+		return "No delivery reference"
+	}
+	return d.Reference
+}
+
+// CustomsDeclarationRow totals a delivery's received quantity for one SKU
+// under one country of origin and HS code.
+type CustomsDeclarationRow struct {
+	CountryOfOrigin string `bun:"country_of_origin"`
+	HSCode          string `bun:"hs_code"`
+	SKU             string `bun:"sku"`
+	Description     string `bun:"description"`
+	Lines           int64  `bun:"lines"`
+	Pallets         int64  `bun:"pallets"`
+	Qty             int64  `bun:"qty"`
+}
+
+// CountryName is the row's country for display, blank when not captured.
+func (r CustomsDeclarationRow) CountryName() string {
+	if r.CountryOfOrigin == "" {
+		return ""
+	}
+	return customs.CountryName(r.CountryOfOrigin)
+}
+
+type CustomsPageData struct {
+	ProjectID   int64
+	ProjectName string
+	ClientName  string
+	Config      customs.Config
+	Deliveries  []CustomsDelivery
+	// Selected is the delivery whose declaration is shown, nil when the
+	// project has no lines yet.
+	Selected *CustomsDelivery
+	Rows     []CustomsDeclarationRow
+}
@@ -0,0 +1,392 @@
+package projects
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/coldstorage"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/phase"
+	"receipter/infrastructure/photovisibility"
+	"receipter/infrastructure/receipts"
+	"receipter/infrastructure/sqlite"
+)
+
+var (
+	ErrExpiryBatchRequired    = errors.New("batch number is required")
+	ErrExpiryInvalidDate      = errors.New("expiry dates must be YYYY-MM-DD")
+	ErrExpiryTargetRequired   = errors.New("corrected expiry date is required")
+	ErrExpiryNoChange         = errors.New("corrected expiry matches the current expiry")
+	ErrExpiryNoMatchingLines  = errors.New("no receipt lines match this batch")
+	ErrExpiryProjectReadOnly  = errors.New("inactive projects are read-only")
+	ErrExpiryPreviewOutOfDate = errors.New("matching lines changed since the preview; review the preview again")
+)
+
+func LoadExpiryCorrectionPageData(ctx context.Context, db *sqlite.DB, projectID int64) (ExpiryCorrectionPageData, error) {
+	data := ExpiryCorrectionPageData{ProjectID: projectID}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT name, client_name, status FROM projects WHERE id = ?`, projectID).
+			Scan(ctx, &data.ProjectName, fieldcrypt.Dest(&data.ClientName), &data.ProjectStatus)
+	})
+	return data, err
+}
+
+func NormalizeExpiryCorrectionInput(input ExpiryCorrectionInput) (ExpiryCorrectionInput, error) {
+	input.SKU = strings.TrimSpace(input.SKU)
+	input.BatchNumber = strings.TrimSpace(input.BatchNumber)
+	input.FromExpiry = strings.TrimSpace(input.FromExpiry)
+	input.ToExpiry = strings.TrimSpace(input.ToExpiry)
+	if input.BatchNumber == "" {
+		return input, ErrExpiryBatchRequired
+	}
+	if input.ToExpiry == "" {
+		return input, ErrExpiryTargetRequired
+	}
+	for _, v := range []string{input.FromExpiry, input.ToExpiry} {
+		if v == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", v); err != nil {
+			return input, ErrExpiryInvalidDate
+		}
+	}
+	if input.FromExpiry == input.ToExpiry {
+		return input, ErrExpiryNoChange
+	}
+	return input, nil
+}
+
+// PreviewExpiryCorrection lists the lines ApplyExpiryCorrection would change
+// without writing anything.
+func PreviewExpiryCorrection(ctx context.Context, db *sqlite.DB, projectID int64, input ExpiryCorrectionInput) (ExpiryCorrectionPreview, error) {
+	input, err := NormalizeExpiryCorrectionInput(input)
+	if err != nil {
+		return ExpiryCorrectionPreview{}, err
+	}
+	var preview ExpiryCorrectionPreview
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		preview, err = planExpiryCorrection(ctx, tx, projectID, input)
+		return err
+	})
+	return preview, err
+}
+
+// ApplyExpiryCorrection moves every matching line of the batch to the
+// corrected expiry. Lines that then share a merge key with another line on
+// the same pallet are folded into it, the same way a repeat scan merges, so a
+// pallet never ends up with two lines for one SKU instance. Client comments
+// keyed on the old expiry follow the lines. expectedLines is the line count
+// the admin previewed; a different count aborts so nothing unreviewed changes.
+// Lines on pallets of a closed phase are left as they are.
+func ApplyExpiryCorrection(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID int64, input ExpiryCorrectionInput, expectedLines int) (ExpiryCorrectionResult, error) {
+	var result ExpiryCorrectionResult
+	input, err := NormalizeExpiryCorrectionInput(input)
+	if err != nil {
+		return result, err
+	}
+	target, _ := time.Parse("2006-01-02", input.ToExpiry)
+
+	err = db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var projectStatus string
+		if err := tx.NewRaw(`SELECT status FROM projects WHERE id = ?`, projectID).Scan(ctx, &projectStatus); err != nil {
+			return err
+		}
+		if projectStatus != "active" {
+			return ErrExpiryProjectReadOnly
+		}
+
+		plan, err := planExpiryCorrection(ctx, tx, projectID, input)
+		if err != nil {
+			return err
+		}
+		if len(plan.Lines) == 0 {
+			return ErrExpiryNoMatchingLines
+		}
+		if expectedLines > 0 && len(plan.Lines) != expectedLines {
+			return ErrExpiryPreviewOutOfDate
+		}
+
+		now := time.Now().UTC()
+		merged := make(map[string]int64)
+		for _, line := range plan.Lines {
+			if line.MergeIntoID > 0 {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE pallet_receipts SET expiry_date = ?, updated_at = ? WHERE id = ?`, target, now, line.ReceiptID); err != nil {
+				return err
+			}
+			result.UpdatedCount++
+		}
+		for _, line := range plan.Lines {
+			if line.MergeIntoID == 0 {
+				continue
+			}
+			if err := mergeReceiptLine(ctx, tx, line.ReceiptID, line.MergeIntoID, now); err != nil {
+				return err
+			}
+			merged[strconv.FormatInt(line.ReceiptID, 10)] = line.MergeIntoID
+			result.MergedCount++
+		}
+
+		where, args := expiryCorrectionMatch("scc", projectID, input)
+		res, err := tx.ExecContext(ctx, `
+UPDATE sku_client_comments AS scc SET expiry_date = ?
+WHERE `+where+` AND scc.pallet_id IN (?)`, append(append([]any{input.ToExpiry}, args...), bun.In(plan.PalletIDs))...)
+		if err != nil {
+			return err
+		}
+		result.CommentCount, _ = res.RowsAffected()
+		result.PalletIDs = plan.PalletIDs
+
+		before := make([]map[string]any, 0, len(plan.Lines))
+		for _, line := range plan.Lines {
+			before = append(before, map[string]any{
+				"receipt_id":  line.ReceiptID,
+				"pallet_id":   line.PalletID,
+				"sku":         line.SKU,
+				"expiry_date": line.ExpiryDate,
+				"qty":         line.Qty,
+			})
+		}
+		return auditSvc.Write(ctx, tx, userID, "receipt.expiry_correct", "projects", strconv.FormatInt(projectID, 10), map[string]any{
+			"project_id":   projectID,
+			"sku":          input.SKU,
+			"batch_number": input.BatchNumber,
+			"from_expiry":  input.FromExpiry,
+			"lines":        before,
+		}, map[string]any{
+			"project_id":       projectID,
+			"expiry_date":      input.ToExpiry,
+			"updated_count":    result.UpdatedCount,
+			"merged_into":      merged,
+			"comments_updated": result.CommentCount,
+			"pallet_ids":       plan.PalletIDs,
+		})
+	})
+	return result, err
+}
+
+// expiryCorrectionMatch selects rows of the batch that are not yet on the
+// corrected expiry. It works for both pallet_receipts and sku_client_comments,
+// which share the matching columns.
+func expiryCorrectionMatch(alias string, projectID int64, input ExpiryCorrectionInput) (string, []any) {
+	where := []string{
+		alias + ".project_id = ?",
+		"COALESCE(" + alias + ".batch_number, '') = ?",
+		"(" + alias + ".expiry_date IS NULL OR date(" + alias + ".expiry_date) <> date(?))",
+	}
+	args := []any{projectID, input.BatchNumber, input.ToExpiry}
+	if input.SKU != "" {
+		where = append(where, alias+".sku = ?")
+		args = append(args, input.SKU)
+	}
+	if input.FromExpiry != "" {
+		where = append(where, "date("+alias+".expiry_date) = date(?)")
+		args = append(args, input.FromExpiry)
+	}
+	return strings.Join(where, " AND "), args
+}
+
+func planExpiryCorrection(ctx context.Context, tx bun.Tx, projectID int64, input ExpiryCorrectionInput) (ExpiryCorrectionPreview, error) {
+	preview := ExpiryCorrectionPreview{Lines: make([]ExpiryCorrectionLine, 0), PalletIDs: make([]int64, 0)}
+	where, args := expiryCorrectionMatch("pr", projectID, input)
+	if err := tx.NewRaw(`
+SELECT pr.id, pr.pallet_id, p.status AS pallet_status, pr.sku, pr.uom, pr.case_size, pr.unknown_sku,
+       pr.damaged, COALESCE(pr.damage_reason, '') AS damage_reason, COALESCE(pr.batch_number, '') AS batch_number,
+       pr.country_of_origin, pr.hs_code,
+       COALESCE(date(pr.expiry_date), '') AS expiry_date, pr.qty, pr.damaged_qty,
+       CASE WHEN pr.expiry_date IS NOT NULL AND date(pr.expiry_date) < date('now') THEN 1 ELSE 0 END AS was_expired,
+       EXISTS (SELECT 1 FROM cold_storage_photos c WHERE c.source = ? AND c.photo_id = pr.id) AS cold_primary,
+       EXISTS (SELECT 1 FROM damage_claim_lines dcl WHERE dcl.pallet_receipt_id = pr.id) AS claimed
+FROM pallet_receipts pr
+JOIN pallets p ON p.id = pr.pallet_id
+WHERE `+where+` AND p.status <> 'cancelled'
+ORDER BY pr.pallet_id ASC, pr.id ASC`, append([]any{coldstorage.SourcePrimary}, args...)...).Scan(ctx, &preview.Lines); err != nil {
+		return preview, err
+	}
+
+	// Pallets of a closed phase are read-only, so their lines keep the old
+	// expiry and are only counted.
+	locked := make(map[int64]bool)
+	open := preview.Lines[:0]
+	for _, line := range preview.Lines {
+		isLocked, checked := locked[line.PalletID]
+		if !checked {
+			err := phase.CheckPalletTx(ctx, tx, line.PalletID)
+			if err != nil && !errors.Is(err, phase.ErrClosed) {
+				return preview, err
+			}
+			isLocked = err != nil
+			locked[line.PalletID] = isLocked
+		}
+		if isLocked {
+			preview.LockedCount++
+			continue
+		}
+		open = append(open, line)
+	}
+	preview.Lines = open
+	if len(preview.Lines) == 0 {
+		return preview, nil
+	}
+
+	// Lines already on the corrected expiry survive any collision; after them
+	// the first affected line per key survives and later ones fold into it.
+	// A line whose primary photo is in cold storage cannot hand that photo
+	// over, so it is never folded away and keeps its own line. Lines on a
+	// damage claim are neither folded away nor added to, as with a repeat
+	// scan, so the claim keeps exactly the line it was raised on.
+	existing := make([]ExpiryCorrectionLine, 0)
+	existingArgs := []any{projectID, input.BatchNumber, input.ToExpiry}
+	existingSKU := ""
+	if input.SKU != "" {
+		existingSKU = " AND pr.sku = ?"
+		existingArgs = append(existingArgs, input.SKU)
+	}
+	if err := tx.NewRaw(`
+SELECT pr.id, pr.pallet_id, pr.sku, pr.uom, pr.case_size, pr.unknown_sku, pr.damaged,
+       COALESCE(pr.damage_reason, '') AS damage_reason, COALESCE(pr.batch_number, '') AS batch_number,
+       pr.country_of_origin, pr.hs_code,
+       EXISTS (SELECT 1 FROM damage_claim_lines dcl WHERE dcl.pallet_receipt_id = pr.id) AS claimed
+FROM pallet_receipts pr
+WHERE pr.project_id = ? AND COALESCE(pr.batch_number, '') = ? AND date(pr.expiry_date) = date(?)`+existingSKU+`
+ORDER BY pr.id ASC`, existingArgs...).Scan(ctx, &existing); err != nil {
+		return preview, err
+	}
+	survivors := make(map[string]int64, len(existing))
+	for _, line := range existing {
+		if line.Claimed {
+			continue
+		}
+		key := receiptMergeKey(line)
+		if _, ok := survivors[key]; !ok {
+			survivors[key] = line.ReceiptID
+		}
+	}
+
+	today := time.Now().UTC().Format("2006-01-02")
+	pallets := make(map[int64]bool)
+	for i := range preview.Lines {
+		line := &preview.Lines[i]
+		line.WillBeExpired = input.ToExpiry < today
+		key := receiptMergeKey(*line)
+		if survivorID, ok := survivors[key]; ok && !line.ColdPrimary && !line.Claimed {
+			line.MergeIntoID = survivorID
+			preview.MergeCount++
+		} else if !ok && !line.Claimed {
+			survivors[key] = line.ReceiptID
+		}
+		preview.TotalQty += line.Qty
+		if !pallets[line.PalletID] {
+			pallets[line.PalletID] = true
+			preview.PalletIDs = append(preview.PalletIDs, line.PalletID)
+		}
+	}
+	sort.Slice(preview.PalletIDs, func(i, j int) bool { return preview.PalletIDs[i] < preview.PalletIDs[j] })
+
+	commentWhere, commentArgs := expiryCorrectionMatch("scc", projectID, input)
+	if err := tx.NewRaw(`SELECT COUNT(1) FROM sku_client_comments scc WHERE `+commentWhere+` AND scc.pallet_id IN (?)`,
+		append(commentArgs, bun.In(preview.PalletIDs))...).Scan(ctx, &preview.CommentCount); err != nil {
+		return preview, err
+	}
+	return preview, nil
+}
+
+// receiptMergeKey mirrors the columns a repeat scan matches on when merging
+// into an existing line, minus the expiry which is being corrected.
+func receiptMergeKey(line ExpiryCorrectionLine) string {
+	return fmt.Sprintf("%d|%s|%s|%d|%t|%t|%s|%s|%s|%s", line.PalletID, line.SKU, line.UOM, line.CaseSize, line.UnknownSKU, line.Damaged, line.DamageReason, line.BatchNumber, line.CountryOfOrigin, line.HSCode)
+}
+
+// mergeReceiptLine folds fromID into intoID: quantities add up, photos and
+// pending uploads move across with their internal marks, serial numbers move
+// across, and custom values fill any gaps on the surviving line before
+// fromID is deleted. fromID's primary photo becomes intoID's when it has
+// none, or else one of its gallery photos. fromID must not have its primary
+// photo in cold storage; planExpiryCorrection never folds such lines.
+func mergeReceiptLine(ctx context.Context, tx bun.Tx, fromID, intoID int64, now time.Time) error {
+	var photos struct {
+		FromPrimary bool `bun:"from_primary"`
+		IntoPrimary bool `bun:"into_primary"`
+	}
+	if err := tx.NewRaw(`
+SELECT src.stock_photo_blob IS NOT NULL AS from_primary,
+       dst.stock_photo_blob IS NOT NULL
+         OR EXISTS (SELECT 1 FROM cold_storage_photos c WHERE c.source = ? AND c.photo_id = dst.id) AS into_primary
+FROM pallet_receipts src, pallet_receipts dst
+WHERE src.id = ? AND dst.id = ?`, coldstorage.SourcePrimary, fromID, intoID).Scan(ctx, &photos); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+UPDATE pallet_receipts SET
+	qty = pallet_receipts.qty + src.qty,
+	damaged_qty = pallet_receipts.damaged_qty + src.damaged_qty,
+	comment = CASE WHEN pallet_receipts.comment = '' THEN src.comment ELSE pallet_receipts.comment END,
+	updated_at = ?
+FROM pallet_receipts AS src
+WHERE pallet_receipts.id = ? AND src.id = ?`, now, intoID, fromID); err != nil {
+		return err
+	}
+	switch {
+	case photos.FromPrimary && !photos.IntoPrimary:
+		if _, err := tx.ExecContext(ctx, `
+UPDATE pallet_receipts SET
+	stock_photo_blob = src.stock_photo_blob,
+	stock_photo_mime = src.stock_photo_mime,
+	stock_photo_name = src.stock_photo_name
+FROM pallet_receipts AS src
+WHERE pallet_receipts.id = ? AND src.id = ?`, intoID, fromID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM internal_photos WHERE source = ? AND photo_id = ?`, photovisibility.SourcePrimary, intoID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+UPDATE internal_photos SET photo_id = ?, pallet_receipt_id = ?
+WHERE source = ? AND photo_id = ?`, intoID, intoID, photovisibility.SourcePrimary, fromID); err != nil {
+			return err
+		}
+	case photos.FromPrimary:
+		var photoID int64
+		if err := tx.NewRaw(`
+INSERT INTO receipt_photos (pallet_receipt_id, photo_blob, photo_mime, photo_name, created_at)
+SELECT ?, stock_photo_blob, COALESCE(stock_photo_mime, 'image/jpeg'), COALESCE(stock_photo_name, 'photo.jpg'), created_at
+FROM pallet_receipts
+WHERE id = ?
+RETURNING id`, intoID, fromID).Scan(ctx, &photoID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+UPDATE internal_photos SET source = ?, photo_id = ?, pallet_receipt_id = ?
+WHERE source = ? AND photo_id = ?`, photovisibility.SourceGallery, photoID, intoID, photovisibility.SourcePrimary, fromID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE receipt_photos SET pallet_receipt_id = ? WHERE pallet_receipt_id = ?`, intoID, fromID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE internal_photos SET pallet_receipt_id = ? WHERE source = ? AND pallet_receipt_id = ?`,
+		intoID, photovisibility.SourceGallery, fromID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE photo_uploads SET pallet_receipt_id = ? WHERE pallet_receipt_id = ?`, intoID, fromID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE receipt_serials SET pallet_receipt_id = ? WHERE pallet_receipt_id = ?`, intoID, fromID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+INSERT OR IGNORE INTO receipt_custom_values (pallet_receipt_id, field_id, value)
+SELECT ?, field_id, value FROM receipt_custom_values WHERE pallet_receipt_id = ?`, intoID, fromID); err != nil {
+		return err
+	}
+	return receipts.DeleteLine(ctx, tx, fromID)
+}
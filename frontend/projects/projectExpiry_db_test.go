@@ -0,0 +1,427 @@
+package projects
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+)
+
+func TestApplyExpiryCorrection_UpdatesMergesAndAuditsOnce(t *testing.T) {
+	db := openProjectLogsTestDB(t)
+	ctx := context.Background()
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'x', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'Inbound', 'd', '2026-02-01', 'Acme', 'inbound', 'active')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open'), (2, 1, 'labelled'), (3, 1, 'cancelled')`,
+			`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, batch_number, expiry_date) VALUES
+				(1, 1, 1, 'SKU-A', 'Widget', 1, 5, 'B1', '2026-01-01'),
+				(2, 1, 1, 'SKU-A', 'Widget', 1, 3, 'B1', '2027-06-30'),
+				(3, 1, 2, 'SKU-A', 'Widget', 1, 4, 'B1', '2026-01-01'),
+				(4, 1, 3, 'SKU-A', 'Widget', 1, 2, 'B1', '2026-01-01'),
+				(5, 1, 1, 'SKU-A', 'Widget', 1, 7, 'B2', '2026-01-01')`,
+			`INSERT INTO receipt_photos (pallet_receipt_id, photo_blob) VALUES (1, x'ff')`,
+			`INSERT INTO sku_client_comments (project_id, pallet_id, sku, batch_number, expiry_date, comment, created_by_user_id) VALUES
+				(1, 1, 'SKU-A', 'B1', '2026-01-01', 'check seals', 1),
+				(1, 1, 'SKU-A', 'B2', '2026-01-01', 'other batch', 1)`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	input := ExpiryCorrectionInput{BatchNumber: "B1", FromExpiry: "2026-01-01", ToExpiry: "2027-06-30"}
+	preview, err := PreviewExpiryCorrection(ctx, db, 1, input)
+	if err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+	if len(preview.Lines) != 2 || preview.MergeCount != 1 || preview.CommentCount != 1 || len(preview.PalletIDs) != 2 {
+		t.Fatalf("unexpected preview: %+v", preview)
+	}
+	if preview.Lines[0].ReceiptID != 1 || preview.Lines[0].MergeIntoID != 2 || !preview.Lines[0].WasExpired {
+		t.Fatalf("expected line 1 to merge into line 2, got %+v", preview.Lines[0])
+	}
+
+	if _, err := ApplyExpiryCorrection(ctx, db, audit.NewService(), 1, 1, input, 3); !errors.Is(err, ErrExpiryPreviewOutOfDate) {
+		t.Fatalf("expected stale preview rejected, got %v", err)
+	}
+
+	result, err := ApplyExpiryCorrection(ctx, db, audit.NewService(), 1, 1, input, len(preview.Lines))
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if result.UpdatedCount != 1 || result.MergedCount != 1 || result.CommentCount != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	type lineState struct {
+		ID     int64  `bun:"id"`
+		Qty    int64  `bun:"qty"`
+		Expiry string `bun:"expiry"`
+	}
+	var lines []lineState
+	var photoOwner int64
+	var commentExpiries []string
+	var auditCount int
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT id, qty, date(expiry_date) AS expiry FROM pallet_receipts ORDER BY id`).Scan(ctx, &lines); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT pallet_receipt_id FROM receipt_photos`).Scan(ctx, &photoOwner); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT COALESCE(expiry_date, '') FROM sku_client_comments ORDER BY id`).Scan(ctx, &commentExpiries); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT COUNT(1) FROM audit_logs WHERE action = 'receipt.expiry_correct'`).Scan(ctx, &auditCount)
+	})
+	if err != nil {
+		t.Fatalf("read back: %v", err)
+	}
+
+	want := []lineState{
+		{ID: 2, Qty: 8, Expiry: "2027-06-30"},
+		{ID: 3, Qty: 4, Expiry: "2027-06-30"},
+		{ID: 4, Qty: 2, Expiry: "2026-01-01"},
+		{ID: 5, Qty: 7, Expiry: "2026-01-01"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("unexpected lines after correction: %+v", lines)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Fatalf("line %d = %+v, want %+v", i, lines[i], want[i])
+		}
+	}
+	if photoOwner != 2 {
+		t.Fatalf("expected photo moved to surviving line 2, got %d", photoOwner)
+	}
+	if len(commentExpiries) != 2 || commentExpiries[0] != "2027-06-30" || commentExpiries[1] != "2026-01-01" {
+		t.Fatalf("unexpected comment expiries: %v", commentExpiries)
+	}
+	if auditCount != 1 {
+		t.Fatalf("expected one grouped audit entry, got %d", auditCount)
+	}
+
+	if _, err := PreviewExpiryCorrection(ctx, db, 1, input); err != nil {
+		t.Fatalf("preview after apply: %v", err)
+	}
+	if _, err := ApplyExpiryCorrection(ctx, db, audit.NewService(), 1, 1, input, 0); !errors.Is(err, ErrExpiryNoMatchingLines) {
+		t.Fatalf("expected nothing left to correct, got %v", err)
+	}
+}
+
+func TestApplyExpiryCorrection_LeavesClosedPhasePalletsAlone(t *testing.T) {
+	db := openProjectLogsTestDB(t)
+	ctx := context.Background()
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'x', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'Inbound', 'd', '2026-02-01', 'Acme', 'inbound', 'active')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'closed'), (2, 1, 'open')`,
+			`INSERT INTO project_phases (id, project_id, name, status, created_by_user_id) VALUES (1, 1, 'Wave 1', 'closed', 1)`,
+			`INSERT INTO pallet_phases (pallet_id, phase_id) VALUES (1, 1)`,
+			`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, batch_number, expiry_date) VALUES
+				(1, 1, 1, 'SKU-A', 'Widget', 1, 5, 'B1', '2026-01-01'),
+				(2, 1, 2, 'SKU-A', 'Widget', 1, 3, 'B1', '2026-01-01')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	input := ExpiryCorrectionInput{BatchNumber: "B1", FromExpiry: "2026-01-01", ToExpiry: "2027-06-30"}
+	preview, err := PreviewExpiryCorrection(ctx, db, 1, input)
+	if err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+	if len(preview.Lines) != 1 || preview.Lines[0].ReceiptID != 2 || preview.LockedCount != 1 {
+		t.Fatalf("expected only the open phase line previewed, got %+v", preview)
+	}
+	result, err := ApplyExpiryCorrection(ctx, db, audit.NewService(), 1, 1, input, len(preview.Lines))
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if result.UpdatedCount != 1 || len(result.PalletIDs) != 1 || result.PalletIDs[0] != 2 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	var expiries []string
+	if err := db.R.NewRaw(`SELECT date(expiry_date) FROM pallet_receipts ORDER BY id`).Scan(ctx, &expiries); err != nil {
+		t.Fatalf("read back: %v", err)
+	}
+	if len(expiries) != 2 || expiries[0] != "2026-01-01" || expiries[1] != "2027-06-30" {
+		t.Fatalf("expected the closed phase line untouched, got %v", expiries)
+	}
+}
+
+func TestApplyExpiryCorrection_FoldKeepsInternalPhotosInternal(t *testing.T) {
+	db := openProjectLogsTestDB(t)
+	ctx := context.Background()
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'x', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'Inbound', 'd', '2026-02-01', 'Acme', 'inbound', 'active')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open')`,
+			`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, batch_number, expiry_date, stock_photo_blob) VALUES
+				(1, 1, 1, 'SKU-A', 'Widget', 1, 5, 'B1', '2026-01-01', x'ff'),
+				(2, 1, 1, 'SKU-A', 'Widget', 1, 3, 'B1', '2027-06-30', NULL)`,
+			`INSERT INTO receipt_photos (id, pallet_receipt_id, photo_blob) VALUES (10, 1, x'ff'), (11, 1, x'ff')`,
+			`INSERT INTO internal_photos (source, photo_id, pallet_receipt_id) VALUES ('pallet_receipts', 1, 1), ('receipt_photos', 10, 1)`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	input := ExpiryCorrectionInput{BatchNumber: "B1", FromExpiry: "2026-01-01", ToExpiry: "2027-06-30"}
+	result, err := ApplyExpiryCorrection(ctx, db, audit.NewService(), 1, 1, input, 1)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if result.MergedCount != 1 {
+		t.Fatalf("expected line 1 folded into line 2, got %+v", result)
+	}
+
+	type mark struct {
+		Source    string `bun:"source"`
+		PhotoID   int64  `bun:"photo_id"`
+		ReceiptID int64  `bun:"pallet_receipt_id"`
+	}
+	var marks []mark
+	if err := db.R.NewRaw(`SELECT source, photo_id, pallet_receipt_id FROM internal_photos ORDER BY source, photo_id`).Scan(ctx, &marks); err != nil {
+		t.Fatalf("load marks: %v", err)
+	}
+	want := []mark{{"pallet_receipts", 2, 2}, {"receipt_photos", 10, 2}}
+	if len(marks) != len(want) || marks[0] != want[0] || marks[1] != want[1] {
+		t.Fatalf("internal marks = %+v, want %+v", marks, want)
+	}
+}
+
+func TestApplyExpiryCorrection_FoldKeepsSerials(t *testing.T) {
+	db := openProjectLogsTestDB(t)
+	ctx := context.Background()
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'x', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'Inbound', 'd', '2026-02-01', 'Acme', 'inbound', 'active')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open')`,
+			`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, batch_number, expiry_date) VALUES
+				(1, 1, 1, 'SKU-A', 'Widget', 1, 2, 'B1', '2026-01-01'),
+				(2, 1, 1, 'SKU-A', 'Widget', 1, 1, 'B1', '2027-06-30')`,
+			`INSERT INTO receipt_serials (project_id, pallet_receipt_id, serial) VALUES (1, 1, 'SN-1'), (1, 1, 'SN-2'), (1, 2, 'SN-3')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	input := ExpiryCorrectionInput{BatchNumber: "B1", FromExpiry: "2026-01-01", ToExpiry: "2027-06-30"}
+	if _, err := ApplyExpiryCorrection(ctx, db, audit.NewService(), 1, 1, input, 1); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	var onSurvivor int
+	if err := db.R.NewRaw(`SELECT COUNT(1) FROM receipt_serials WHERE pallet_receipt_id = 2`).Scan(ctx, &onSurvivor); err != nil {
+		t.Fatalf("count serials: %v", err)
+	}
+	if onSurvivor != 3 {
+		t.Fatalf("expected all 3 serials on the surviving line, got %d", onSurvivor)
+	}
+}
+
+func TestApplyExpiryCorrection_FoldKeepsBothPrimaryPhotos(t *testing.T) {
+	db := openProjectLogsTestDB(t)
+	ctx := context.Background()
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'x', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'Inbound', 'd', '2026-02-01', 'Acme', 'inbound', 'active')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open')`,
+			`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, batch_number, expiry_date, stock_photo_blob, stock_photo_mime, stock_photo_name) VALUES
+				(1, 1, 1, 'SKU-A', 'Widget', 1, 5, 'B1', '2026-01-01', x'aa', 'image/png', 'folded.png'),
+				(2, 1, 1, 'SKU-A', 'Widget', 1, 3, 'B1', '2027-06-30', x'bb', 'image/jpeg', 'kept.jpg'),
+				(3, 1, 1, 'SKU-A', 'Widget', 1, 2, 'B1', '2026-01-01', NULL, NULL, NULL)`,
+			`INSERT INTO internal_photos (source, photo_id, pallet_receipt_id) VALUES ('pallet_receipts', 1, 1)`,
+			`INSERT INTO cold_storage_photos (project_id, source, photo_id, path, bytes, sha256) VALUES (1, 'pallet_receipts', 3, 'p/3', 1, 'x')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	input := ExpiryCorrectionInput{BatchNumber: "B1", FromExpiry: "2026-01-01", ToExpiry: "2027-06-30"}
+	preview, err := PreviewExpiryCorrection(ctx, db, 1, input)
+	if err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+	if len(preview.Lines) != 2 || preview.Lines[0].MergeIntoID != 2 || preview.Lines[1].MergeIntoID != 0 {
+		t.Fatalf("expected line 1 folded and the cold-storage line 3 kept, got %+v", preview.Lines)
+	}
+	if _, err := ApplyExpiryCorrection(ctx, db, audit.NewService(), 1, 1, input, len(preview.Lines)); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	var primary []byte
+	var gallery struct {
+		ID   int64  `bun:"id"`
+		Blob []byte `bun:"photo_blob"`
+		Mime string `bun:"photo_mime"`
+		Name string `bun:"photo_name"`
+	}
+	var internalSource string
+	var internalID int64
+	var coldLineExpiry string
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT stock_photo_blob FROM pallet_receipts WHERE id = 2`).Scan(ctx, &primary); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT id, photo_blob, photo_mime, photo_name FROM receipt_photos WHERE pallet_receipt_id = 2`).Scan(ctx, &gallery); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT source, photo_id FROM internal_photos`).Scan(ctx, &internalSource, &internalID); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT date(expiry_date) FROM pallet_receipts WHERE id = 3`).Scan(ctx, &coldLineExpiry)
+	})
+	if err != nil {
+		t.Fatalf("read back: %v", err)
+	}
+	if string(primary) != "\xbb" {
+		t.Fatalf("expected the surviving line to keep its primary photo, got %x", primary)
+	}
+	if string(gallery.Blob) != "\xaa" || gallery.Mime != "image/png" || gallery.Name != "folded.png" {
+		t.Fatalf("expected the folded primary photo as a gallery photo, got %+v", gallery)
+	}
+	if internalSource != "receipt_photos" || internalID != gallery.ID {
+		t.Fatalf("expected the internal mark on the new gallery photo, got %s %d", internalSource, internalID)
+	}
+	if coldLineExpiry != "2027-06-30" {
+		t.Fatalf("expected the cold-storage line corrected in place, got %s", coldLineExpiry)
+	}
+}
+
+func TestApplyExpiryCorrection_NeverFoldsClaimedLines(t *testing.T) {
+	db := openProjectLogsTestDB(t)
+	ctx := context.Background()
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'x', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'Inbound', 'd', '2026-02-01', 'Acme', 'inbound', 'active')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open')`,
+			`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, batch_number, expiry_date, damaged, damaged_qty) VALUES
+				(1, 1, 1, 'SKU-A', 'Widget', 1, 5, 'B1', '2027-06-30', 1, 5),
+				(2, 1, 1, 'SKU-A', 'Widget', 1, 3, 'B1', '2026-01-01', 1, 3),
+				(3, 1, 1, 'SKU-A', 'Widget', 1, 2, 'B1', '2026-01-01', 1, 2)`,
+			`INSERT INTO damage_claims (id, project_id, line_count, damaged_qty) VALUES (1, 1, 2, 8)`,
+			`INSERT INTO damage_claim_lines (claim_id, pallet_receipt_id) VALUES (1, 1), (1, 2)`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	input := ExpiryCorrectionInput{BatchNumber: "B1", FromExpiry: "2026-01-01", ToExpiry: "2027-06-30"}
+	result, err := ApplyExpiryCorrection(ctx, db, audit.NewService(), 1, 1, input, 2)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if result.MergedCount != 0 || result.UpdatedCount != 2 {
+		t.Fatalf("expected claimed lines corrected in place, got %+v", result)
+	}
+	var claimLines int
+	if err := db.R.NewRaw(`SELECT COUNT(1) FROM damage_claim_lines dcl JOIN pallet_receipts pr ON pr.id = dcl.pallet_receipt_id`).Scan(ctx, &claimLines); err != nil {
+		t.Fatalf("count claim lines: %v", err)
+	}
+	if claimLines != 2 {
+		t.Fatalf("expected both claim lines kept, got %d", claimLines)
+	}
+}
+
+func TestApplyExpiryCorrection_KeepsLinesOfOtherOriginApart(t *testing.T) {
+	db := openProjectLogsTestDB(t)
+	ctx := context.Background()
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'x', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'Inbound', 'd', '2026-02-01', 'Acme', 'inbound', 'active')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open')`,
+			`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, batch_number, expiry_date, country_of_origin, hs_code) VALUES
+				(1, 1, 1, 'SKU-A', 'Widget', 1, 5, 'B1', '2027-06-30', 'GB', '8471'),
+				(2, 1, 1, 'SKU-A', 'Widget', 1, 3, 'B1', '2026-01-01', 'CN', '8471'),
+				(3, 1, 1, 'SKU-A', 'Widget', 1, 2, 'B1', '2026-01-01', 'GB', '8517'),
+				(4, 1, 1, 'SKU-A', 'Widget', 1, 4, 'B1', '2026-01-01', 'GB', '8471')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	input := ExpiryCorrectionInput{BatchNumber: "B1", FromExpiry: "2026-01-01", ToExpiry: "2027-06-30"}
+	result, err := ApplyExpiryCorrection(ctx, db, audit.NewService(), 1, 1, input, 3)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if result.MergedCount != 1 || result.UpdatedCount != 2 {
+		t.Fatalf("expected only the matching GB/8471 line folded, got %+v", result)
+	}
+	var qty int64
+	if err := db.R.NewRaw(`SELECT qty FROM pallet_receipts WHERE id = 1`).Scan(ctx, &qty); err != nil {
+		t.Fatalf("load survivor: %v", err)
+	}
+	if qty != 9 {
+		t.Fatalf("expected survivor qty 9, got %d", qty)
+	}
+	var remaining int
+	if err := db.R.NewRaw(`SELECT COUNT(1) FROM pallet_receipts WHERE id IN (2, 3)`).Scan(ctx, &remaining); err != nil {
+		t.Fatalf("count lines: %v", err)
+	}
+	if remaining != 2 {
+		t.Fatalf("expected lines of another origin or HS code kept, got %d", remaining)
+	}
+}
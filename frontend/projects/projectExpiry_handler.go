@@ -0,0 +1,116 @@
+package projects
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/live"
+	"receipter/infrastructure/sqlite"
+)
+
+func ExpiryCorrectionPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+
+		data, err := LoadExpiryCorrectionPageData(r.Context(), db, projectID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Project not found"), http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "failed to load expiry correction", http.StatusInternalServerError)
+			return
+		}
+		query := r.URL.Query()
+		data.Status = query.Get("status")
+		data.ErrorMessage = query.Get("error")
+		data.Input = expiryCorrectionInputFrom(query.Get)
+
+		if query.Get("preview") != "" {
+			preview, err := PreviewExpiryCorrection(r.Context(), db, projectID, data.Input)
+			if err != nil {
+				data.ErrorMessage = err.Error()
+			} else if len(preview.Lines) == 0 {
+				data.ErrorMessage = ErrExpiryNoMatchingLines.Error()
+			} else {
+				data.Preview = &preview
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := ExpiryCorrectionPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render expiry correction page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func ApplyExpiryCorrectionCommandHandler(db *sqlite.DB, auditSvc *audit.Service, hub *live.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		pageURL := expiryCorrectionURL(projectID)
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		input := expiryCorrectionInputFrom(r.FormValue)
+		expectedLines, _ := strconv.Atoi(r.FormValue("expected_lines"))
+
+		result, err := ApplyExpiryCorrection(r.Context(), db, auditSvc, session.UserID, projectID, input, expectedLines)
+		if err != nil {
+			values := expiryCorrectionQuery(input)
+			values.Set("error", err.Error())
+			http.Redirect(w, r, pageURL+"?"+values.Encode(), http.StatusSeeOther)
+			return
+		}
+		for _, palletID := range result.PalletIDs {
+			hub.Publish(palletID, live.EventLines)
+		}
+
+		status := fmt.Sprintf("Batch %s set to expiry %s: %d lines updated, %d merged, %d comments moved across %d pallets",
+			input.BatchNumber, input.ToExpiry, result.UpdatedCount, result.MergedCount, result.CommentCount, len(result.PalletIDs))
+		http.Redirect(w, r, pageURL+"?status="+url.QueryEscape(status), http.StatusSeeOther)
+	}
+}
+
+func expiryCorrectionURL(projectID int64) string {
+	return fmt.Sprintf("/tasker/projects/%d/expiry-correction", projectID)
+}
+
+func expiryCorrectionInputFrom(get func(string) string) ExpiryCorrectionInput {
+	return ExpiryCorrectionInput{
+		SKU:         get("sku"),
+		BatchNumber: get("batch_number"),
+		FromExpiry:  get("from_expiry"),
+		ToExpiry:    get("to_expiry"),
+	}
+}
+
+func expiryCorrectionQuery(input ExpiryCorrectionInput) url.Values {
+	values := url.Values{}
+	values.Set("sku", input.SKU)
+	values.Set("batch_number", input.BatchNumber)
+	values.Set("from_expiry", input.FromExpiry)
+	values.Set("to_expiry", input.ToExpiry)
+	return values
+}
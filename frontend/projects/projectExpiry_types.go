@@ -0,0 +1,63 @@
+package projects
+
+// ExpiryCorrectionInput selects the receipt lines of one batch whose expiry
+// was keyed wrong. SKU and FromExpiry are optional narrowing filters.
+type ExpiryCorrectionInput struct {
+	SKU         string
+	BatchNumber string
+	FromExpiry  string
+	ToExpiry    string
+}
+
+// ExpiryCorrectionLine is one receipt line the correction will change.
+// MergeIntoID is set when the corrected line collides with another line on
+// the same pallet and will be folded into it.
+type ExpiryCorrectionLine struct {
+	ReceiptID       int64  `bun:"id"`
+	PalletID        int64  `bun:"pallet_id"`
+	PalletStatus    string `bun:"pallet_status"`
+	SKU             string `bun:"sku"`
+	UOM             string `bun:"uom"`
+	CaseSize        int64  `bun:"case_size"`
+	UnknownSKU      bool   `bun:"unknown_sku"`
+	Damaged         bool   `bun:"damaged"`
+	DamageReason    string `bun:"damage_reason"`
+	BatchNumber     string `bun:"batch_number"`
+	CountryOfOrigin string `bun:"country_of_origin"`
+	HSCode          string `bun:"hs_code"`
+	ExpiryDate      string `bun:"expiry_date"`
+	Qty             int64  `bun:"qty"`
+	DamagedQty      int64  `bun:"damaged_qty"`
+	WasExpired      bool   `bun:"was_expired"`
+	ColdPrimary     bool   `bun:"cold_primary"`
+	Claimed         bool   `bun:"claimed"`
+	WillBeExpired   bool   `bun:"-"`
+	MergeIntoID     int64  `bun:"-"`
+}
+
+type ExpiryCorrectionPreview struct {
+	Lines        []ExpiryCorrectionLine
+	PalletIDs    []int64
+	TotalQty     int64
+	MergeCount   int
+	CommentCount int64
+	LockedCount  int
+}
+
+type ExpiryCorrectionResult struct {
+	UpdatedCount int
+	MergedCount  int
+	CommentCount int64
+	PalletIDs    []int64
+}
+
+type ExpiryCorrectionPageData struct {
+	ProjectID     int64
+	ProjectName   string
+	ClientName    string
+	ProjectStatus string
+	Input         ExpiryCorrectionInput
+	Preview       *ExpiryCorrectionPreview
+	Status        string
+	ErrorMessage  string
+}
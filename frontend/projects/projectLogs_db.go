@@ -7,6 +7,7 @@ import (
 
 	"github.com/uptrace/bun"
 
+	"receipter/infrastructure/fieldcrypt"
 	"receipter/infrastructure/sqlite"
 )
 
@@ -18,7 +19,7 @@ func LoadProjectLogsPageData(ctx context.Context, db *sqlite.DB, projectID int64
 
 	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
 		if err := tx.NewRaw(`SELECT name, client_name, status FROM projects WHERE id = ?`, projectID).
-			Scan(ctx, &data.ProjectName, &data.ClientName, &data.ProjectStatus); err != nil {
+			Scan(ctx, &data.ProjectName, fieldcrypt.Dest(&data.ClientName), &data.ProjectStatus); err != nil {
 			return err
 		}
 
@@ -0,0 +1,24 @@
+package projects
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/phase"
+	"receipter/infrastructure/sqlite"
+)
+
+func LoadPhases(ctx context.Context, db *sqlite.DB, projectID int64) (PhasesPageData, error) {
+	data := PhasesPageData{ProjectID: projectID}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT name, client_name, status FROM projects WHERE id = ?`, projectID).
+			Scan(ctx, &data.ProjectName, fieldcrypt.Dest(&data.ClientName), &data.ProjectStatus)
+	})
+	if err != nil {
+		return data, err
+	}
+	data.Phases, err = phase.List(ctx, db, projectID)
+	return data, err
+}
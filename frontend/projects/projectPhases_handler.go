@@ -0,0 +1,117 @@
+package projects
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/phase"
+	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/sqlite"
+)
+
+func phasesURL(projectID int64) string {
+	return fmt.Sprintf("/tasker/projects/%d/phases", projectID)
+}
+
+func PhasesPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		data, err := LoadPhases(r.Context(), db, projectID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Project not found"), http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "failed to load phases", http.StatusInternalServerError)
+			return
+		}
+		data.Status = r.URL.Query().Get("status")
+		data.ErrorMessage = r.URL.Query().Get("error")
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := PhasesPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render phases", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// StartPhaseCommandHandler starts a new receiving phase on a project.
+func StartPhaseCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		pageURL := phasesURL(projectID)
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape("invalid form"), http.StatusSeeOther)
+			return
+		}
+		name := r.FormValue("name")
+		if _, err := phase.Start(r.Context(), db, auditSvc, session.UserID, projectID, name); err != nil {
+			switch {
+			case errors.Is(err, phase.ErrNameRequired), errors.Is(err, phase.ErrNameTooLong), errors.Is(err, phase.ErrNameTaken), errors.Is(err, projectinfra.ErrReadOnly):
+				http.Redirect(w, r, pageURL+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			case errors.Is(err, sql.ErrNoRows):
+				http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Project not found"), http.StatusSeeOther)
+			default:
+				slog.Error("phases: start failed", slog.Int64("project_id", projectID), slog.Any("err", err))
+				http.Error(w, "failed to start phase", http.StatusInternalServerError)
+			}
+			return
+		}
+		http.Redirect(w, r, pageURL+"?status="+url.QueryEscape("Phase started; new pallets join it"), http.StatusSeeOther)
+	}
+}
+
+// ClosePhaseCommandHandler closes a phase, locking its pallets read-only.
+func ClosePhaseCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		pageURL := phasesURL(projectID)
+		phaseID, err := strconv.ParseInt(chi.URLParam(r, "phaseID"), 10, 64)
+		if err != nil || phaseID <= 0 {
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape("Invalid phase id"), http.StatusSeeOther)
+			return
+		}
+		if err := phase.Close(r.Context(), db, auditSvc, session.UserID, projectID, phaseID); err != nil {
+			if errors.Is(err, phase.ErrNotFound) || errors.Is(err, phase.ErrAlreadyClosed) {
+				http.Redirect(w, r, pageURL+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+				return
+			}
+			slog.Error("phases: close failed", slog.Int64("phase_id", phaseID), slog.Any("err", err))
+			http.Error(w, "failed to close phase", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, pageURL+"?status="+url.QueryEscape("Phase closed; its pallets are read-only"), http.StatusSeeOther)
+	}
+}
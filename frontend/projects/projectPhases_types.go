@@ -0,0 +1,25 @@
+package projects
+
+import "receipter/infrastructure/phase"
+
+// PhasesPageData is a project's receiving phases, oldest first.
+type PhasesPageData struct {
+	ProjectID     int64
+	ProjectName   string
+	ClientName    string
+	ProjectStatus string
+	Phases        []phase.Phase
+	Status        string
+	ErrorMessage  string
+}
+
+// CurrentID is the phase new pallets join: the open phase started last, or
+// 0 when every phase is closed.
+func (d PhasesPageData) CurrentID() int64 {
+	for i := len(d.Phases) - 1; i >= 0; i-- {
+		if !d.Phases[i].IsClosed() {
+			return d.Phases[i].ID
+		}
+	}
+	return 0
+}
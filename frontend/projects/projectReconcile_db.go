@@ -0,0 +1,258 @@
+package projects
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/csvimport"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/sqlite"
+)
+
+var (
+	ErrWMSSnapshotHeader = errors.New("invalid CSV header; expected sku,qty with an optional batch column")
+	ErrWMSSnapshotEmpty  = errors.New("the snapshot has no valid lines")
+)
+
+// reconcileKey identifies a line on both sides of the reconciliation. SKUs
+// and batches match case-insensitively.
+type reconcileKey struct {
+	sku   string
+	batch string
+}
+
+func newReconcileKey(sku, batch string, hasBatch bool) reconcileKey {
+	key := reconcileKey{sku: strings.ToUpper(strings.TrimSpace(sku))}
+	if hasBatch {
+		key.batch = strings.ToUpper(strings.TrimSpace(batch))
+	}
+	return key
+}
+
+func LoadReconcilePageData(ctx context.Context, db *sqlite.DB, projectID int64) (ReconcilePageData, error) {
+	data := ReconcilePageData{ProjectID: projectID, Snapshots: make([]WMSSnapshot, 0)}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT name, client_name FROM projects WHERE id = ?`, projectID).
+			Scan(ctx, &data.ProjectName, fieldcrypt.Dest(&data.ClientName)); err != nil {
+			return err
+		}
+		return tx.NewRaw(`
+SELECT s.id, s.file_name, s.has_batch, s.row_count, s.error_count,
+       COALESCE(u.username, '') AS uploaded_by,
+       strftime('%d/%m/%Y %H:%M', s.created_at) AS uploaded_at
+FROM wms_snapshots s
+LEFT JOIN users u ON u.id = s.uploaded_by_user_id
+WHERE s.project_id = ?
+ORDER BY s.id DESC`, projectID).Scan(ctx, &data.Snapshots)
+	})
+	return data, err
+}
+
+// ImportWMSSnapshot stores a WMS stock CSV for the project. The header needs
+// sku and qty (or quantity) columns; a batch, batch_number or lot column makes
+// the reconciliation match per batch. Repeated SKU (and batch) lines are
+// summed, and rows without a SKU or with a bad quantity are counted as errors.
+// opts gives the file's delimiter and encoding, detected when left zero.
+func ImportWMSSnapshot(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID int64, fileName string, reader io.Reader, opts csvimport.Options) (WMSSnapshot, error) {
+	snapshot := WMSSnapshot{FileName: strings.TrimSpace(fileName)}
+	r, err := csvimport.NewReader(reader, opts)
+	if err != nil {
+		return snapshot, err
+	}
+	r.TrimLeadingSpace = true
+	r.FieldsPerRecord = -1
+
+	header, err := r.Read()
+	if err != nil {
+		return snapshot, ErrWMSSnapshotHeader
+	}
+	skuCol, qtyCol, batchCol := -1, -1, -1
+	for i, raw := range header {
+		switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(raw, "\ufeff"))) {
+		case "sku":
+			if skuCol < 0 {
+				skuCol = i
+			}
+		case "qty", "quantity":
+			if qtyCol < 0 {
+				qtyCol = i
+			}
+		case "batch", "batch_number", "lot":
+			if batchCol < 0 {
+				batchCol = i
+			}
+		}
+	}
+	if skuCol < 0 || qtyCol < 0 {
+		return snapshot, ErrWMSSnapshotHeader
+	}
+	snapshot.HasBatch = batchCol >= 0
+
+	type line struct {
+		sku   string
+		batch string
+		qty   int64
+	}
+	lines := make(map[reconcileKey]*line)
+	order := make([]reconcileKey, 0)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil || skuCol >= len(record) || qtyCol >= len(record) || (snapshot.HasBatch && batchCol >= len(record)) {
+			snapshot.ErrorCount++
+			continue
+		}
+		sku := strings.TrimSpace(record[skuCol])
+		qty, qtyErr := strconv.ParseInt(strings.TrimSpace(record[qtyCol]), 10, 64)
+		if sku == "" || qtyErr != nil || qty < 0 {
+			snapshot.ErrorCount++
+			continue
+		}
+		batch := ""
+		if snapshot.HasBatch {
+			batch = strings.TrimSpace(record[batchCol])
+		}
+		snapshot.RowCount++
+		key := newReconcileKey(sku, batch, snapshot.HasBatch)
+		if existing, ok := lines[key]; ok {
+			existing.qty += qty
+			continue
+		}
+		lines[key] = &line{sku: sku, batch: batch, qty: qty}
+		order = append(order, key)
+	}
+	if len(lines) == 0 {
+		return snapshot, ErrWMSSnapshotEmpty
+	}
+
+	err = db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`
+INSERT INTO wms_snapshots (project_id, file_name, has_batch, row_count, error_count, uploaded_by_user_id)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id`, projectID, snapshot.FileName, snapshot.HasBatch, snapshot.RowCount, snapshot.ErrorCount, userID).Scan(ctx, &snapshot.ID); err != nil {
+			return err
+		}
+		for _, key := range order {
+			l := lines[key]
+			if _, err := tx.ExecContext(ctx, `
+INSERT INTO wms_snapshot_lines (snapshot_id, sku, batch_number, qty) VALUES (?, ?, ?, ?)`,
+				snapshot.ID, l.sku, l.batch, l.qty); err != nil {
+				return err
+			}
+		}
+		if auditSvc == nil {
+			return nil
+		}
+		after := map[string]any{
+			"project_id":  projectID,
+			"file_name":   snapshot.FileName,
+			"has_batch":   snapshot.HasBatch,
+			"row_count":   snapshot.RowCount,
+			"error_count": snapshot.ErrorCount,
+		}
+		return auditSvc.Write(ctx, tx, userID, "wms_snapshot.upload", "wms_snapshots", strconv.FormatInt(snapshot.ID, 10), nil, after)
+	})
+	return snapshot, err
+}
+
+// LoadReconcileReport reconciles a snapshot of the project against the
+// quantities receipted on its pallets now. Lines on cancelled pallets are not
+// counted. It returns sql.ErrNoRows when the snapshot is not the project's.
+func LoadReconcileReport(ctx context.Context, db *sqlite.DB, projectID, snapshotID int64) (ReconcileReport, error) {
+	report := ReconcileReport{Rows: make([]ReconcileRow, 0)}
+	wmsLines := make([]struct {
+		SKU         string `bun:"sku"`
+		BatchNumber string `bun:"batch_number"`
+		Qty         int64  `bun:"qty"`
+	}, 0)
+	received := make([]struct {
+		SKU         string `bun:"sku"`
+		BatchNumber string `bun:"batch_number"`
+		Qty         int64  `bun:"qty"`
+	}, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`
+SELECT s.id, s.file_name, s.has_batch, s.row_count, s.error_count,
+       COALESCE(u.username, '') AS uploaded_by,
+       strftime('%d/%m/%Y %H:%M', s.created_at) AS uploaded_at
+FROM wms_snapshots s
+LEFT JOIN users u ON u.id = s.uploaded_by_user_id
+WHERE s.id = ? AND s.project_id = ?`, snapshotID, projectID).Scan(ctx, &report.Snapshot); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT sku, batch_number, qty FROM wms_snapshot_lines WHERE snapshot_id = ?`, snapshotID).Scan(ctx, &wmsLines); err != nil {
+			return err
+		}
+		return tx.NewRaw(`
+SELECT pr.sku, COALESCE(pr.batch_number, '') AS batch_number, SUM(pr.qty) AS qty
+FROM pallet_receipts pr
+JOIN pallets p ON p.id = pr.pallet_id
+WHERE pr.project_id = ? AND p.status <> 'cancelled'
+GROUP BY pr.sku, COALESCE(pr.batch_number, '')`, projectID).Scan(ctx, &received)
+	})
+	if err != nil {
+		return report, err
+	}
+
+	rows := make(map[reconcileKey]*ReconcileRow)
+	for _, l := range wmsLines {
+		key := newReconcileKey(l.SKU, l.BatchNumber, report.Snapshot.HasBatch)
+		rows[key] = &ReconcileRow{SKU: l.SKU, BatchNumber: l.BatchNumber, WMSQty: l.Qty}
+	}
+	for _, l := range received {
+		key := newReconcileKey(l.SKU, l.BatchNumber, report.Snapshot.HasBatch)
+		row, ok := rows[key]
+		if !ok {
+			row = &ReconcileRow{SKU: strings.TrimSpace(l.SKU)}
+			if report.Snapshot.HasBatch {
+				row.BatchNumber = strings.TrimSpace(l.BatchNumber)
+			}
+			rows[key] = row
+		}
+		row.ReceivedQty += l.Qty
+	}
+	for _, row := range rows {
+		switch {
+		case row.ReceivedQty == row.WMSQty:
+			row.Result = ReconcileMatched
+			report.Matched++
+		case row.ReceivedQty < row.WMSQty:
+			row.Result = ReconcileShort
+			report.Short++
+		default:
+			row.Result = ReconcileOver
+			report.Over++
+		}
+		report.Rows = append(report.Rows, *row)
+	}
+	sort.Slice(report.Rows, func(i, j int) bool {
+		a, b := report.Rows[i], report.Rows[j]
+		if !strings.EqualFold(a.SKU, b.SKU) {
+			return strings.ToUpper(a.SKU) < strings.ToUpper(b.SKU)
+		}
+		return strings.ToUpper(a.BatchNumber) < strings.ToUpper(b.BatchNumber)
+	})
+	return report, nil
+}
+
+func normalizeReconcileResult(v string) string {
+	switch v = strings.ToLower(strings.TrimSpace(v)); v {
+	case ReconcileMatched, ReconcileShort, ReconcileOver:
+		return v
+	}
+	return ""
+}
+
+func reconcileURL(projectID int64) string {
+	return fmt.Sprintf("/tasker/projects/%d/reconcile", projectID)
+}
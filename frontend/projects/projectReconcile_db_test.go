@@ -0,0 +1,133 @@
+package projects
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/csvimport"
+)
+
+func TestReconcile_MatchesShortAndOverPerBatch(t *testing.T) {
+	db := openProjectLogsTestDB(t)
+	ctx := context.Background()
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+			 (1, 'Inbound', 'd', '2026-02-01', 'Acme', 'inbound', 'active'),
+			 (2, 'Other', 'd', '2026-02-01', 'Acme', 'other', 'active')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'closed'), (2, 1, 'cancelled'), (3, 2, 'closed')`,
+			`INSERT INTO pallet_receipts (project_id, pallet_id, sku, description, scanned_by_user_id, qty, batch_number) VALUES
+			 (1, 1, 'SKU-A', 'A', 1, 10, 'B1'),
+			 (1, 1, 'sku-a', 'A', 1, 5, 'B1'),
+			 (1, 1, 'SKU-B', 'B', 1, 4, 'B2'),
+			 (1, 1, 'SKU-C', 'C', 1, 7, NULL),
+			 (1, 2, 'SKU-B', 'B', 1, 50, 'B2'),
+			 (2, 3, 'SKU-D', 'D', 1, 9, NULL)`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	csvData := "SKU,Qty,Batch\nSKU-A,12,b1\nSKU-A,3,B1\nSKU-B,6,B2\nSKU-D,2,\n,4,B9\nSKU-E,x,B1\n"
+	snapshot, err := ImportWMSSnapshot(ctx, db, nil, 1, 1, "wms.csv", strings.NewReader(csvData), csvimport.Options{})
+	if err != nil {
+		t.Fatalf("import snapshot: %v", err)
+	}
+	if !snapshot.HasBatch || snapshot.RowCount != 4 || snapshot.ErrorCount != 2 {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+
+	report, err := LoadReconcileReport(ctx, db, 1, snapshot.ID)
+	if err != nil {
+		t.Fatalf("load report: %v", err)
+	}
+	got := make(map[string]ReconcileRow, len(report.Rows))
+	for _, row := range report.Rows {
+		got[strings.ToUpper(row.SKU)+"/"+row.BatchNumber] = row
+	}
+	// SKU-A: 15 received of 15; SKU-B: 4 of 6 (the cancelled pallet does not
+	// count); SKU-C received without a WMS line; SKU-D in the WMS only.
+	if row := got["SKU-A/b1"]; row.WMSQty != 15 || row.ReceivedQty != 15 || row.Result != ReconcileMatched {
+		t.Fatalf("unexpected SKU-A row %+v in %+v", row, report.Rows)
+	}
+	if row := got["SKU-B/B2"]; row.WMSQty != 6 || row.ReceivedQty != 4 || row.Result != ReconcileShort || row.Difference() != -2 {
+		t.Fatalf("unexpected SKU-B row %+v", row)
+	}
+	if row := got["SKU-C/"]; row.WMSQty != 0 || row.ReceivedQty != 7 || row.Result != ReconcileOver {
+		t.Fatalf("unexpected SKU-C row %+v", row)
+	}
+	if row := got["SKU-D/"]; row.WMSQty != 2 || row.ReceivedQty != 0 || row.Result != ReconcileShort {
+		t.Fatalf("unexpected SKU-D row %+v", row)
+	}
+	if report.Matched != 1 || report.Short != 2 || report.Over != 1 || len(report.Filtered(ReconcileShort)) != 2 {
+		t.Fatalf("unexpected totals matched=%d short=%d over=%d", report.Matched, report.Short, report.Over)
+	}
+
+	var buf bytes.Buffer
+	if err := writeReconcileCSV(&buf, report.Filtered(ReconcileOver), 1); err != nil {
+		t.Fatalf("write csv: %v", err)
+	}
+	if buf.String() != "sku,batch_number,wms_qty,received_qty,difference,result\nSKU-C,,0,7,7,over\n" {
+		t.Fatalf("unexpected csv %q", buf.String())
+	}
+
+	if _, err := LoadReconcileReport(ctx, db, 2, snapshot.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected snapshot hidden from other project, got %v", err)
+	}
+}
+
+func TestReconcile_WithoutBatchColumnMatchesBySKU(t *testing.T) {
+	db := openProjectLogsTestDB(t)
+	ctx := context.Background()
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'Inbound', 'd', '2026-02-01', 'Acme', 'inbound', 'active')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open')`,
+			`INSERT INTO pallet_receipts (project_id, pallet_id, sku, description, scanned_by_user_id, qty, batch_number) VALUES
+			 (1, 1, 'SKU-A', 'A', 1, 10, 'B1'), (1, 1, 'SKU-A', 'A', 1, 5, 'B2')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	if _, err := ImportWMSSnapshot(ctx, db, nil, 1, 1, "bad.csv", strings.NewReader("item,count\nSKU-A,1\n"), csvimport.Options{}); !errors.Is(err, ErrWMSSnapshotHeader) {
+		t.Fatalf("expected header error, got %v", err)
+	}
+	snapshot, err := ImportWMSSnapshot(ctx, db, nil, 1, 1, "wms.csv", strings.NewReader("sku,quantity\nSKU-A,15\n"), csvimport.Options{})
+	if err != nil {
+		t.Fatalf("import snapshot: %v", err)
+	}
+	report, err := LoadReconcileReport(ctx, db, 1, snapshot.ID)
+	if err != nil {
+		t.Fatalf("load report: %v", err)
+	}
+	if len(report.Rows) != 1 || report.Rows[0].ReceivedQty != 15 || report.Rows[0].Result != ReconcileMatched || report.Rows[0].BatchNumber != "" {
+		t.Fatalf("expected one matched SKU row across batches, got %+v", report.Rows)
+	}
+	tabbed, err := ImportWMSSnapshot(ctx, db, nil, 1, 1, "wms.tsv", strings.NewReader("sku\tqty\nSKU-A\t15\n"), csvimport.Options{Delimiter: csvimport.DelimiterTab})
+	if err != nil || tabbed.RowCount != 1 || tabbed.ErrorCount != 0 {
+		t.Fatalf("tab-delimited snapshot = %+v, %v", tabbed, err)
+	}
+}
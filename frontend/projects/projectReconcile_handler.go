@@ -0,0 +1,170 @@
+package projects
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/csvimport"
+	"receipter/infrastructure/exportformat"
+	"receipter/infrastructure/sqlite"
+)
+
+// wmsSnapshotMaxBytes caps an uploaded WMS snapshot.
+const wmsSnapshotMaxBytes = 10 << 20
+
+func ReconcilePageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		data, err := LoadReconcilePageData(r.Context(), db, projectID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Project not found"), http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "failed to load reconciliation", http.StatusInternalServerError)
+			return
+		}
+		query := r.URL.Query()
+		data.Status = query.Get("status")
+		data.ErrorMessage = query.Get("error")
+		data.Result = normalizeReconcileResult(query.Get("result"))
+
+		// Show the requested snapshot, or the latest upload.
+		snapshotID, _ := strconv.ParseInt(query.Get("snapshot"), 10, 64)
+		if snapshotID <= 0 && len(data.Snapshots) > 0 {
+			snapshotID = data.Snapshots[0].ID
+		}
+		if snapshotID > 0 {
+			report, err := LoadReconcileReport(r.Context(), db, projectID, snapshotID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "failed to load reconciliation", http.StatusInternalServerError)
+				return
+			}
+			if err == nil {
+				data.Report = &report
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := ReconcilePage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render reconciliation", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func UploadWMSSnapshotCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		pageURL := reconcileURL(projectID)
+		if err := r.ParseMultipartForm(wmsSnapshotMaxBytes); err != nil {
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape("invalid upload"), http.StatusSeeOther)
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape("file is required"), http.StatusSeeOther)
+			return
+		}
+		defer file.Close()
+		opts, err := csvimport.ParseOptions(r.FormValue("encoding"), r.FormValue("delimiter"))
+		if err != nil {
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+
+		snapshot, err := ImportWMSSnapshot(r.Context(), db, auditSvc, session.UserID, projectID, header.Filename, io.LimitReader(file, wmsSnapshotMaxBytes), opts)
+		if err != nil {
+			msg := "failed to store snapshot"
+			if errors.Is(err, ErrWMSSnapshotHeader) || errors.Is(err, ErrWMSSnapshotEmpty) || errors.Is(err, csvimport.ErrInvalidUTF8) {
+				msg = err.Error()
+			}
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape(msg), http.StatusSeeOther)
+			return
+		}
+		status := fmt.Sprintf("Snapshot uploaded: %d lines read, %d skipped", snapshot.RowCount, snapshot.ErrorCount)
+		http.Redirect(w, r, fmt.Sprintf("%s?snapshot=%d&status=%s", pageURL, snapshot.ID, url.QueryEscape(status)), http.StatusSeeOther)
+	}
+}
+
+func ReconcileExportCSVHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Error(w, "invalid project id", http.StatusBadRequest)
+			return
+		}
+		snapshotID, err := strconv.ParseInt(chi.URLParam(r, "snapshotID"), 10, 64)
+		if err != nil || snapshotID <= 0 {
+			http.Error(w, "invalid snapshot id", http.StatusBadRequest)
+			return
+		}
+		version, err := exportformat.WMSReconciliation.ParseVersion(r.URL.Query().Get(exportformat.QueryParam))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		report, err := LoadReconcileReport(r.Context(), db, projectID, snapshotID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "snapshot not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to load reconciliation", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=reconciliation-project-%d-snapshot-%d.csv", projectID, snapshotID))
+		w.Header().Set(exportformat.ResponseHeader, strconv.Itoa(version))
+		if err := writeReconcileCSV(w, report.Filtered(normalizeReconcileResult(r.URL.Query().Get("result"))), version); err != nil {
+			http.Error(w, "failed to export csv", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func writeReconcileCSV(w io.Writer, rows []ReconcileRow, version int) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportformat.WMSReconciliation.Header(version)); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := exportformat.WMSReconciliation.Record(version, []string{
+			row.SKU,
+			row.BatchNumber,
+			strconv.FormatInt(row.WMSQty, 10),
+			strconv.FormatInt(row.ReceivedQty, 10),
+			strconv.FormatInt(row.Difference(), 10),
+			row.Result,
+		})
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
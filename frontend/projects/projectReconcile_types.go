@@ -0,0 +1,68 @@
+package projects
+
+// Reconciliation results of one SKU (and batch) line.
+const (
+	ReconcileMatched = "matched"
+	ReconcileShort   = "short"
+	ReconcileOver    = "over"
+)
+
+// WMSSnapshot is an uploaded WMS stock export.
+type WMSSnapshot struct {
+	ID         int64  `bun:"id"`
+	FileName   string `bun:"file_name"`
+	HasBatch   bool   `bun:"has_batch"`
+	RowCount   int    `bun:"row_count"`
+	ErrorCount int    `bun:"error_count"`
+	UploadedBy string `bun:"uploaded_by"`
+	UploadedAt string `bun:"uploaded_at"`
+}
+
+// ReconcileRow compares the WMS quantity of a SKU (and batch, when the
+// snapshot has batches) with the quantity receipted on the project.
+type ReconcileRow struct {
+	SKU         string
+	BatchNumber string
+	WMSQty      int64
+	ReceivedQty int64
+	Result      string
+}
+
+// Difference is received minus WMS: negative when short, positive when over.
+func (r ReconcileRow) Difference() int64 {
+	return r.ReceivedQty - r.WMSQty
+}
+
+// ReconcileReport is a snapshot reconciled against the current receipts.
+type ReconcileReport struct {
+	Snapshot WMSSnapshot
+	Rows     []ReconcileRow
+	Matched  int
+	Short    int
+	Over     int
+}
+
+// Filtered returns the rows with result, or every row when result is empty.
+func (r ReconcileReport) Filtered(result string) []ReconcileRow {
+	if result == "" {
+		return r.Rows
+	}
+	rows := make([]ReconcileRow, 0, len(r.Rows))
+	for _, row := range r.Rows {
+		if row.Result == result {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+type ReconcilePageData struct {
+	ProjectID    int64
+	ProjectName  string
+	ClientName   string
+	Snapshots    []WMSSnapshot
+	Report       *ReconcileReport
+	Result       string
+	Status       string
+	ErrorMessage string
+}
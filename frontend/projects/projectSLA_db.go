@@ -0,0 +1,77 @@
+package projects
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/palletsla"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/sqlite"
+)
+
+// slaBreachListLimit caps the recent breaches shown on the report.
+const slaBreachListLimit = 50
+
+func LoadSLAReport(ctx context.Context, db *sqlite.DB, projectID int64, now time.Time) (SLAReportPageData, error) {
+	data := SLAReportPageData{ProjectID: projectID, Scanners: make([]SLAScannerRow, 0), Breaches: make([]SLABreachRow, 0)}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT name, client_name FROM projects WHERE id = ?`, projectID).
+			Scan(ctx, &data.ProjectName, fieldcrypt.Dest(&data.ClientName)); err != nil {
+			return err
+		}
+		settings, err := projectsettings.LoadTx(ctx, tx, projectID)
+		if err != nil {
+			return err
+		}
+		data.SLAHours = settings.Int(projectsettings.PalletSLAHours)
+		limit := data.SLAHours * 60
+
+		if err := tx.NewRaw(`
+SELECT COUNT(1),
+       COALESCE(SUM(CASE WHEN elapsed < ? THEN 1 ELSE 0 END), 0),
+       CAST(COALESCE(AVG(elapsed), 0) AS INTEGER)
+FROM (SELECT `+palletsla.ElapsedMinutesSQL+` AS elapsed
+      FROM pallets p
+      WHERE p.project_id = ? AND p.status IN ('closed', 'labelled') AND p.closed_at IS NOT NULL)`,
+			limit, now, projectID).Scan(ctx, &data.PalletsClosed, &data.ClosedWithinSLA, &data.AvgCloseMinutes); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`
+SELECT COUNT(1), COALESCE(SUM(CASE WHEN ? > 0 AND elapsed >= ? THEN 1 ELSE 0 END), 0)
+FROM (SELECT `+palletsla.ElapsedMinutesSQL+` AS elapsed
+      FROM pallets p
+      WHERE p.project_id = ? AND p.status IN ('created', 'open'))`,
+			limit, limit, now, projectID).Scan(ctx, &data.OpenPallets, &data.OpenBreached); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM pallet_sla_breaches WHERE project_id = ?`, projectID).Scan(ctx, &data.RecordedBreaches); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`
+SELECT u.id AS user_id, u.username,
+       COUNT(1) AS pallets_closed,
+       COALESCE(SUM(CASE WHEN x.elapsed < ? THEN 1 ELSE 0 END), 0) AS within_sla
+FROM (SELECT DISTINCT pr.scanned_by_user_id AS user_id, p.id AS pallet_id, `+palletsla.ElapsedMinutesSQL+` AS elapsed
+      FROM pallets p
+      JOIN pallet_receipts pr ON pr.pallet_id = p.id
+      WHERE p.project_id = ? AND p.status IN ('closed', 'labelled') AND p.closed_at IS NOT NULL) x
+JOIN users u ON u.id = x.user_id
+GROUP BY u.id, u.username
+ORDER BY u.username ASC`, limit, now, projectID).Scan(ctx, &data.Scanners); err != nil {
+			return err
+		}
+		return tx.NewRaw(`
+SELECT b.pallet_id, p.status, b.sla_hours,
+       strftime('%d/%m/%Y %H:%M', b.breached_at) AS breached_at,
+       `+palletsla.ElapsedMinutesSQL+` AS elapsed_minutes
+FROM pallet_sla_breaches b
+JOIN pallets p ON p.id = b.pallet_id
+WHERE b.project_id = ?
+ORDER BY b.breached_at DESC, b.pallet_id DESC
+LIMIT ?`, now, projectID, slaBreachListLimit).Scan(ctx, &data.Breaches)
+	})
+	return data, err
+}
@@ -0,0 +1,63 @@
+package projects
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+func TestLoadSLAReport_ComplianceByProjectAndScanner(t *testing.T) {
+	db := openProjectLogsTestDB(t)
+	ctx := context.Background()
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin'), (2, 'alice', 'hash', 'scanner'), (3, 'bob', 'hash', 'scanner')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'Inbound', 'd', '2026-02-01', 'Acme', 'inbound', 'active')`,
+			`INSERT INTO project_settings (project_id, key, value) VALUES (1, 'pallet.sla_hours', '4')`,
+			`INSERT INTO pallets (id, project_id, status, created_at, closed_at) VALUES
+			 (1, 1, 'closed', '2026-03-10 06:00:00', '2026-03-10 08:00:00'),
+			 (2, 1, 'labelled', '2026-03-10 06:00:00', '2026-03-10 12:00:00'),
+			 (3, 1, 'open', '2026-03-10 05:00:00', NULL),
+			 (4, 1, 'cancelled', '2026-03-10 05:00:00', '2026-03-10 05:30:00')`,
+			`INSERT INTO pallet_receipts (project_id, pallet_id, sku, description, scanned_by_user_id, qty) VALUES
+			 (1, 1, 'A', 'A', 2, 1), (1, 1, 'B', 'B', 2, 1), (1, 1, 'C', 'C', 3, 1),
+			 (1, 2, 'A', 'A', 3, 1)`,
+			`INSERT INTO pallet_sla_breaches (pallet_id, project_id, sla_hours, breached_at) VALUES (2, 1, 4, '2026-03-10 10:00:00')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	data, err := LoadSLAReport(ctx, db, 1, time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("load report: %v", err)
+	}
+	if data.SLAHours != 4 || data.PalletsClosed != 2 || data.ClosedWithinSLA != 1 || data.Compliance() != "50.0%" {
+		t.Fatalf("unexpected project compliance %+v", data)
+	}
+	if data.AvgCloseMinutes != 240 || data.OpenPallets != 1 || data.OpenBreached != 1 || data.RecordedBreaches != 1 {
+		t.Fatalf("unexpected project totals %+v", data)
+	}
+	if len(data.Scanners) != 2 {
+		t.Fatalf("expected two scanners, got %+v", data.Scanners)
+	}
+	alice, bob := data.Scanners[0], data.Scanners[1]
+	if alice.Username != "alice" || alice.PalletsClosed != 1 || alice.Compliance() != "100.0%" {
+		t.Fatalf("unexpected alice row %+v", alice)
+	}
+	if bob.Username != "bob" || bob.PalletsClosed != 2 || bob.WithinSLA != 1 {
+		t.Fatalf("unexpected bob row %+v", bob)
+	}
+	if len(data.Breaches) != 1 || data.Breaches[0].PalletID != 2 || data.Breaches[0].ElapsedMinutes == nil || *data.Breaches[0].ElapsedMinutes != 360 {
+		t.Fatalf("unexpected breaches %+v", data.Breaches)
+	}
+}
@@ -0,0 +1,54 @@
+package projects
+
+import "fmt"
+
+// SLAScannerRow is one scanner's closed pallets on the project. A pallet
+// counts for every scanner who received lines on it.
+type SLAScannerRow struct {
+	UserID        int64  `bun:"user_id"`
+	Username      string `bun:"username"`
+	PalletsClosed int64  `bun:"pallets_closed"`
+	WithinSLA     int64  `bun:"within_sla"`
+}
+
+func (r SLAScannerRow) Compliance() string {
+	return compliancePercent(r.WithinSLA, r.PalletsClosed)
+}
+
+// SLABreachRow is a recorded breach with the pallet's current state.
+type SLABreachRow struct {
+	PalletID       int64  `bun:"pallet_id"`
+	Status         string `bun:"status"`
+	SLAHours       int64  `bun:"sla_hours"`
+	BreachedAt     string `bun:"breached_at"`
+	ElapsedMinutes *int64 `bun:"elapsed_minutes"`
+}
+
+// SLAReportPageData is the receiving SLA compliance report of one project.
+// Compliance is measured against the SLA set now, for closed and labelled
+// pallets.
+type SLAReportPageData struct {
+	ProjectID        int64
+	ProjectName      string
+	ClientName       string
+	SLAHours         int64
+	PalletsClosed    int64
+	ClosedWithinSLA  int64
+	AvgCloseMinutes  int64
+	OpenPallets      int64
+	OpenBreached     int64
+	RecordedBreaches int64
+	Scanners         []SLAScannerRow
+	Breaches         []SLABreachRow
+}
+
+func (d SLAReportPageData) Compliance() string {
+	return compliancePercent(d.ClosedWithinSLA, d.PalletsClosed)
+}
+
+func compliancePercent(within, total int64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(within)*100/float64(total))
+}
@@ -0,0 +1,58 @@
+package projects
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/sqlite"
+)
+
+// LoadSettingsPageData loads the project's settings, or the global defaults
+// when projectID is 0.
+func LoadSettingsPageData(ctx context.Context, db *sqlite.DB, projectID int64) (SettingsPageData, error) {
+	data := SettingsPageData{ProjectID: projectID, Rows: make([]SettingRow, 0, len(projectsettings.Definitions))}
+	if projectID > 0 {
+		if err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+			return tx.NewRaw(`SELECT name, client_name FROM projects WHERE id = ?`, projectID).
+				Scan(ctx, &data.ProjectName, fieldcrypt.Dest(&data.ClientName))
+		}); err != nil {
+			return data, err
+		}
+	}
+
+	global, err := projectsettings.Load(ctx, db, 0)
+	if err != nil {
+		return data, err
+	}
+	var stored map[string]string
+	if projectID > 0 {
+		stored, err = projectsettings.RawProject(ctx, db, projectID)
+	} else {
+		stored, err = projectsettings.RawGlobal(ctx, db)
+	}
+	if err != nil {
+		return data, err
+	}
+
+	for _, def := range projectsettings.Definitions {
+		row := SettingRow{
+			Key:            def.Key,
+			Label:          def.Label,
+			Help:           def.Help,
+			Kind:           def.Kind,
+			Choices:        def.Choices,
+			Value:          stored[def.Key],
+			InheritedValue: def.Default,
+			InheritedFrom:  projectsettings.SourceDefault,
+		}
+		if projectID > 0 {
+			row.InheritedValue = global.String(def.Key)
+			row.InheritedFrom = global.Source(def.Key)
+		}
+		data.Rows = append(data.Rows, row)
+	}
+	return data, nil
+}
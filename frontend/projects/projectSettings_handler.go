@@ -0,0 +1,116 @@
+package projects
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/sqlite"
+)
+
+const globalSettingsURL = "/tasker/projects/settings"
+
+func ProjectSettingsPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		renderSettingsPage(w, r, db, projectID)
+	}
+}
+
+func GlobalSettingsPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderSettingsPage(w, r, db, 0)
+	}
+}
+
+func renderSettingsPage(w http.ResponseWriter, r *http.Request, db *sqlite.DB, projectID int64) {
+	data, err := LoadSettingsPageData(r.Context(), db, projectID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Project not found"), http.StatusSeeOther)
+			return
+		}
+		http.Error(w, "failed to load settings", http.StatusInternalServerError)
+		return
+	}
+	data.Status = r.URL.Query().Get("status")
+	data.ErrorMessage = r.URL.Query().Get("error")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := SettingsPage(data).Render(r.Context(), w); err != nil {
+		http.Error(w, "failed to render settings page", http.StatusInternalServerError)
+		return
+	}
+}
+
+func SaveProjectSettingsCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		pageURL := projectSettingsURL(projectID)
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		if err := projectsettings.SaveProject(r.Context(), db, auditSvc, session.UserID, projectID, settingsFormValues(r)); err != nil {
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, pageURL+"?status="+url.QueryEscape("project settings saved"), http.StatusSeeOther)
+	}
+}
+
+func SaveGlobalSettingsCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, globalSettingsURL+"?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		if err := projectsettings.SaveGlobal(r.Context(), db, auditSvc, session.UserID, settingsFormValues(r)); err != nil {
+			http.Redirect(w, r, globalSettingsURL+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, globalSettingsURL+"?status="+url.QueryEscape("global defaults saved"), http.StatusSeeOther)
+	}
+}
+
+// settingsFormValues picks the known settings out of the form; a setting
+// left out of the form is not changed.
+func settingsFormValues(r *http.Request) map[string]string {
+	values := make(map[string]string)
+	for _, def := range projectsettings.Definitions {
+		if _, ok := r.PostForm[def.Key]; ok {
+			values[def.Key] = r.PostForm.Get(def.Key)
+		}
+	}
+	return values
+}
+
+func projectSettingsURL(projectID int64) string {
+	return fmt.Sprintf("/tasker/projects/%d/settings", projectID)
+}
@@ -0,0 +1,25 @@
+package projects
+
+// SettingRow is one setting on the settings page. Value is what is stored at
+// the page's level, blank when it inherits InheritedValue.
+type SettingRow struct {
+	Key            string
+	Label          string
+	Help           string
+	Kind           string
+	Choices        []string
+	Value          string
+	InheritedValue string
+	InheritedFrom  string
+}
+
+// SettingsPageData backs both the per-project settings page and, with a
+// zero ProjectID, the global defaults page.
+type SettingsPageData struct {
+	ProjectID    int64
+	ProjectName  string
+	ClientName   string
+	Rows         []SettingRow
+	Status       string
+	ErrorMessage string
+}
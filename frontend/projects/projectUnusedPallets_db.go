@@ -0,0 +1,58 @@
+package projects
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/sqlite"
+)
+
+// unusedPalletListLimit caps the pending and cancelled pallets shown.
+const unusedPalletListLimit = 200
+
+func LoadUnusedPallets(ctx context.Context, db *sqlite.DB, projectID int64, now time.Time) (UnusedPalletsPageData, error) {
+	data := UnusedPalletsPageData{ProjectID: projectID, Pending: make([]UnusedPalletRow, 0), Cancelled: make([]CancelledUnusedRow, 0)}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT name, client_name FROM projects WHERE id = ?`, projectID).
+			Scan(ctx, &data.ProjectName, fieldcrypt.Dest(&data.ClientName)); err != nil {
+			return err
+		}
+		settings, err := projectsettings.LoadTx(ctx, tx, projectID)
+		if err != nil {
+			return err
+		}
+		data.CancelDays = settings.Int(projectsettings.PalletUnusedCancelDays)
+
+		if err := tx.NewRaw(`
+SELECT p.id AS pallet_id,
+       strftime('%d/%m/%Y %H:%M', p.created_at) AS created_at,
+       CAST(julianday(?) - julianday(p.created_at) AS INTEGER) AS idle_days,
+       e.pallet_id IS NOT NULL AS exempt
+FROM pallets p
+LEFT JOIN pallet_cleanup_exemptions e ON e.pallet_id = p.id
+WHERE p.project_id = ? AND p.status = 'created'
+  AND NOT EXISTS (SELECT 1 FROM pallet_receipts pr WHERE pr.pallet_id = p.id)
+ORDER BY p.created_at ASC, p.id ASC
+LIMIT ?`, now, projectID, unusedPalletListLimit).Scan(ctx, &data.Pending); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM pallet_cleanups WHERE project_id = ?`, projectID).Scan(ctx, &data.CancelledCount); err != nil {
+			return err
+		}
+		return tx.NewRaw(`
+SELECT c.pallet_id,
+       strftime('%d/%m/%Y %H:%M', p.created_at) AS created_at,
+       strftime('%d/%m/%Y %H:%M', c.cancelled_at) AS cancelled_at,
+       c.idle_days
+FROM pallet_cleanups c
+JOIN pallets p ON p.id = c.pallet_id
+WHERE c.project_id = ?
+ORDER BY c.cancelled_at DESC, c.pallet_id DESC
+LIMIT ?`, projectID, unusedPalletListLimit).Scan(ctx, &data.Cancelled)
+	})
+	return data, err
+}
@@ -0,0 +1,92 @@
+package projects
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/palletcleanup"
+	"receipter/infrastructure/sqlite"
+)
+
+func unusedPalletsURL(projectID int64) string {
+	return fmt.Sprintf("/tasker/projects/%d/unused-pallets", projectID)
+}
+
+func UnusedPalletsPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		data, err := LoadUnusedPallets(r.Context(), db, projectID, time.Now().UTC())
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Project not found"), http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "failed to load unused pallets", http.StatusInternalServerError)
+			return
+		}
+		data.Status = r.URL.Query().Get("status")
+		data.ErrorMessage = r.URL.Query().Get("error")
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := UnusedPalletsPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render unused pallets", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// SetPalletCleanupExemptCommandHandler keeps a created pallet from being
+// cancelled by the unused pallet cleanup, or lets the cleanup cancel it again.
+func SetPalletCleanupExemptCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		pageURL := unusedPalletsURL(projectID)
+		palletID, err := strconv.ParseInt(chi.URLParam(r, "palletID"), 10, 64)
+		if err != nil || palletID <= 0 {
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape("Invalid pallet id"), http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, pageURL+"?error="+url.QueryEscape("invalid form"), http.StatusSeeOther)
+			return
+		}
+		exempt := r.FormValue("exempt") == "1"
+		if err := palletcleanup.SetExempt(r.Context(), db, auditSvc, session.UserID, projectID, palletID, exempt); err != nil {
+			if errors.Is(err, palletcleanup.ErrNotCreated) {
+				http.Redirect(w, r, pageURL+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+				return
+			}
+			slog.Error("unused pallets: set exemption failed", slog.Int64("pallet_id", palletID), slog.Any("err", err))
+			http.Error(w, "failed to update pallet", http.StatusInternalServerError)
+			return
+		}
+		status := fmt.Sprintf("P%08d will be cancelled if it stays unused", palletID)
+		if exempt {
+			status = fmt.Sprintf("P%08d is exempt from cleanup", palletID)
+		}
+		http.Redirect(w, r, pageURL+"?status="+url.QueryEscape(status), http.StatusSeeOther)
+	}
+}
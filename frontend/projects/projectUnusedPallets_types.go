@@ -0,0 +1,43 @@
+package projects
+
+// UnusedPalletRow is a created pallet that has no lines yet.
+type UnusedPalletRow struct {
+	PalletID  int64  `bun:"pallet_id"`
+	CreatedAt string `bun:"created_at"`
+	IdleDays  int64  `bun:"idle_days"`
+	Exempt    bool   `bun:"exempt"`
+}
+
+// CancelledUnusedRow is a pallet the cleanup sweeper cancelled.
+type CancelledUnusedRow struct {
+	PalletID    int64  `bun:"pallet_id"`
+	CreatedAt   string `bun:"created_at"`
+	CancelledAt string `bun:"cancelled_at"`
+	IdleDays    int64  `bun:"idle_days"`
+}
+
+// UnusedPalletsPageData is the unused pallet report of one project: empty
+// created pallets that the cleanup will cancel, and those it already has.
+type UnusedPalletsPageData struct {
+	ProjectID      int64
+	ProjectName    string
+	ClientName     string
+	CancelDays     int64
+	Pending        []UnusedPalletRow
+	CancelledCount int64
+	Cancelled      []CancelledUnusedRow
+	Status         string
+	ErrorMessage   string
+}
+
+// DueIn is how many days are left before the sweeper cancels the pallet, or
+// -1 when it never will.
+func (d UnusedPalletsPageData) DueIn(row UnusedPalletRow) int64 {
+	if d.CancelDays <= 0 || row.Exempt {
+		return -1
+	}
+	if row.IdleDays >= d.CancelDays {
+		return 0
+	}
+	return d.CancelDays - row.IdleDays
+}
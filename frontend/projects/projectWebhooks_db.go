@@ -0,0 +1,27 @@
+package projects
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/clientwebhook"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/sqlite"
+)
+
+func LoadWebhooksPageData(ctx context.Context, db *sqlite.DB, projectID int64) (WebhooksPageData, error) {
+	data := WebhooksPageData{ProjectID: projectID}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT name, client_name FROM projects WHERE id = ?`, projectID).
+			Scan(ctx, &data.ProjectName, fieldcrypt.Dest(&data.ClientName))
+	})
+	if err != nil {
+		return data, err
+	}
+	if data.Webhooks, err = clientwebhook.List(ctx, db, projectID); err != nil {
+		return data, err
+	}
+	data.Deliveries, err = clientwebhook.ListDeliveries(ctx, db, projectID)
+	return data, err
+}
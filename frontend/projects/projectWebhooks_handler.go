@@ -0,0 +1,167 @@
+package projects
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/clientwebhook"
+	"receipter/infrastructure/sqlite"
+)
+
+func WebhooksPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+			return
+		}
+		data, ok := loadWebhooksPage(w, r, db, projectID)
+		if !ok {
+			return
+		}
+		data.Status = r.URL.Query().Get("status")
+		data.ErrorMessage = r.URL.Query().Get("error")
+		renderWebhooksPage(w, r, data)
+	}
+}
+
+// CreateWebhookCommandHandler renders the page directly instead of
+// redirecting so the new secret never appears in a URL or log.
+func CreateWebhookCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, projectID, ok := webhookRequest(w, r)
+		if !ok {
+			return
+		}
+		hook, err := clientwebhook.Create(r.Context(), db, auditSvc, userID, projectID, r.FormValue("url"), r.Form["event"])
+		if err != nil {
+			redirectWebhookError(w, r, projectID, err, "failed to add webhook")
+			return
+		}
+		data, ok := loadWebhooksPage(w, r, db, projectID)
+		if !ok {
+			return
+		}
+		data.RevealedSecret = string(hook.Secret)
+		data.RevealedWebhookID = hook.ID
+		w.Header().Set("Cache-Control", "no-store")
+		renderWebhooksPage(w, r, data)
+	}
+}
+
+func UpdateWebhookCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, projectID, ok := webhookRequest(w, r)
+		if !ok {
+			return
+		}
+		webhookID, _ := strconv.ParseInt(chi.URLParam(r, "webhookID"), 10, 64)
+		active := r.FormValue("active") == "1"
+		if err := clientwebhook.Update(r.Context(), db, auditSvc, userID, projectID, webhookID, r.FormValue("url"), r.Form["event"], active); err != nil {
+			redirectWebhookError(w, r, projectID, err, "failed to update webhook")
+			return
+		}
+		http.Redirect(w, r, webhooksURL(projectID)+"?status="+url.QueryEscape("Webhook updated"), http.StatusSeeOther)
+	}
+}
+
+// RotateWebhookSecretCommandHandler renders the page directly, like
+// CreateWebhookCommandHandler, to show the new secret once.
+func RotateWebhookSecretCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, projectID, ok := webhookRequest(w, r)
+		if !ok {
+			return
+		}
+		webhookID, _ := strconv.ParseInt(chi.URLParam(r, "webhookID"), 10, 64)
+		secret, err := clientwebhook.RotateSecret(r.Context(), db, auditSvc, userID, projectID, webhookID)
+		if err != nil {
+			redirectWebhookError(w, r, projectID, err, "failed to rotate secret")
+			return
+		}
+		data, ok := loadWebhooksPage(w, r, db, projectID)
+		if !ok {
+			return
+		}
+		data.RevealedSecret = secret
+		data.RevealedWebhookID = webhookID
+		w.Header().Set("Cache-Control", "no-store")
+		renderWebhooksPage(w, r, data)
+	}
+}
+
+func DeleteWebhookCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, projectID, ok := webhookRequest(w, r)
+		if !ok {
+			return
+		}
+		webhookID, _ := strconv.ParseInt(chi.URLParam(r, "webhookID"), 10, 64)
+		if err := clientwebhook.Delete(r.Context(), db, auditSvc, userID, projectID, webhookID); err != nil {
+			redirectWebhookError(w, r, projectID, err, "failed to delete webhook")
+			return
+		}
+		http.Redirect(w, r, webhooksURL(projectID)+"?status="+url.QueryEscape("Webhook deleted"), http.StatusSeeOther)
+	}
+}
+
+// webhookRequest resolves the acting user and project for a webhook command
+// and parses its form, redirecting when either is missing.
+func webhookRequest(w http.ResponseWriter, r *http.Request) (userID, projectID int64, ok bool) {
+	session, found := sessioncontext.GetSessionFromContext(r.Context())
+	if !found {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return 0, 0, false
+	}
+	projectID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || projectID <= 0 {
+		http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Invalid project id"), http.StatusSeeOther)
+		return 0, 0, false
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Redirect(w, r, webhooksURL(projectID)+"?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+		return 0, 0, false
+	}
+	return session.UserID, projectID, true
+}
+
+func loadWebhooksPage(w http.ResponseWriter, r *http.Request, db *sqlite.DB, projectID int64) (WebhooksPageData, bool) {
+	data, err := LoadWebhooksPageData(r.Context(), db, projectID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Project not found"), http.StatusSeeOther)
+			return data, false
+		}
+		http.Error(w, "failed to load webhooks", http.StatusInternalServerError)
+		return data, false
+	}
+	return data, true
+}
+
+func redirectWebhookError(w http.ResponseWriter, r *http.Request, projectID int64, err error, fallback string) {
+	message := fallback
+	if errors.Is(err, clientwebhook.ErrInvalidURL) || errors.Is(err, clientwebhook.ErrNoEvents) || errors.Is(err, clientwebhook.ErrNotFound) {
+		message = err.Error()
+	}
+	http.Redirect(w, r, webhooksURL(projectID)+"?error="+url.QueryEscape(message), http.StatusSeeOther)
+}
+
+func webhooksURL(projectID int64) string {
+	return fmt.Sprintf("/tasker/projects/%d/webhooks", projectID)
+}
+
+func renderWebhooksPage(w http.ResponseWriter, r *http.Request, data WebhooksPageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := WebhooksPage(data).Render(r.Context(), w); err != nil {
+		http.Error(w, "failed to render webhooks page", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,19 @@
+package projects
+
+import (
+	"receipter/infrastructure/clientwebhook"
+	"receipter/models"
+)
+
+type WebhooksPageData struct {
+	ProjectID   int64
+	ProjectName string
+	ClientName  string
+	Webhooks    []models.ProjectWebhook
+	Deliveries  []clientwebhook.DeliveryView
+	// RevealedSecret is a just-created or rotated secret; it is shown once.
+	RevealedSecret    string
+	RevealedWebhookID int64
+	Status            string
+	ErrorMessage      string
+}
@@ -1,5 +1,11 @@
 package projects
 
+import (
+	"receipter/infrastructure/labelbarcode"
+	"receipter/infrastructure/labeltext"
+	"receipter/infrastructure/site"
+)
+
 type ProjectRow struct {
 	ID             int64
 	Name           string
@@ -8,16 +14,39 @@ type ProjectRow struct {
 	ClientName     string
 	Code           string
 	Status         string
-	CreatedPallets int
-	OpenPallets    int
-	ClosedPallets  int
-	IsCurrent      bool
+	LabelLanguage  string
+	LabelSymbology string
+	// PalletAllowance is blank when the project has no allowance.
+	PalletAllowance string
+	CreatedPallets  int
+	OpenPallets     int
+	ClosedPallets   int
+	IsCurrent       bool
+	SiteID          *int64
+	// SiteName is blank when the project has no site.
+	SiteName string
 }
 
 type PageData struct {
-	Filter      string
-	IsAdmin     bool
-	Message     string
-	DefaultDate string
-	Rows        []ProjectRow
+	Filter         string
+	IsAdmin        bool
+	Message        string
+	DefaultDate    string
+	LabelLanguages []labeltext.Language
+	Symbologies    []labelbarcode.Symbology
+	Rows           []ProjectRow
+	// Scope is the viewer's sites; HasSites hides the site column until the
+	// first site exists.
+	Scope    site.Scope
+	HasSites bool
+}
+
+func (d PageData) siteSelected(siteID *int64, optionID int64) bool {
+	return siteID != nil && *siteID == optionID
+}
+
+// siteOutOfScope reports a row site the viewer cannot pick, such as an
+// inactive one, so the picker can still show it.
+func (d PageData) siteOutOfScope(siteID *int64) bool {
+	return siteID != nil && !d.Scope.CanAssign(siteID)
 }
@@ -0,0 +1,62 @@
+package settings
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/landing"
+	"receipter/infrastructure/sqlite"
+)
+
+func LoadLandingSettingsPageData(ctx context.Context, db *sqlite.DB) (LandingSettingsPageData, error) {
+	data := LandingSettingsPageData{
+		Roles: make([]RoleLandingRow, 0),
+		Users: make([]UserLandingRow, 0),
+	}
+	rolePages, err := landing.RolePages(ctx, db)
+	if err != nil {
+		return data, err
+	}
+	for _, role := range landing.Roles() {
+		data.Roles = append(data.Roles, RoleLandingRow{
+			Role:        role,
+			Page:        rolePages[role],
+			DefaultPage: landingLabel(landing.DefaultPage(role)),
+			Options:     landingOptions(role),
+		})
+	}
+
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT u.id, u.username, u.role, COALESCE(us.landing_page, '') AS landing_page
+FROM users u
+LEFT JOIN user_settings us ON us.user_id = u.id
+ORDER BY LOWER(u.username) ASC`).Scan(ctx, &data.Users)
+	})
+	if err != nil {
+		return data, err
+	}
+	for i := range data.Users {
+		data.Users[i].Options = landingOptions(data.Users[i].Role)
+	}
+	return data, nil
+}
+
+func landingOptions(role string) []LandingOption {
+	pages := landing.PagesForRole(role)
+	out := make([]LandingOption, 0, len(pages))
+	for _, p := range pages {
+		out = append(out, LandingOption{Key: p.Key, Label: p.Label})
+	}
+	return out
+}
+
+func landingLabel(key string) string {
+	for _, p := range landing.Pages() {
+		if p.Key == key {
+			return p.Label
+		}
+	}
+	return key
+}
@@ -0,0 +1,77 @@
+package settings
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/landing"
+	"receipter/infrastructure/sqlite"
+)
+
+func LandingSettingsPageHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := LoadLandingSettingsPageData(r.Context(), db)
+		if err != nil {
+			http.Error(w, "failed to load landing page settings", http.StatusInternalServerError)
+			return
+		}
+		data.Status = r.URL.Query().Get("status")
+		data.ErrorMessage = r.URL.Query().Get("error")
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := LandingSettingsPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render landing page settings", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func UpdateRoleLandingHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/settings/landing?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		role := strings.TrimSpace(chi.URLParam(r, "role"))
+		if err := landing.SetRolePage(r.Context(), db, auditSvc, session.UserID, role, r.FormValue("landing_page")); err != nil {
+			http.Redirect(w, r, "/tasker/settings/landing?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/tasker/settings/landing?status="+url.QueryEscape(role+" landing page saved"), http.StatusSeeOther)
+	}
+}
+
+func UpdateUserLandingHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := context.GetSessionFromContext(r.Context())
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/settings/landing?error="+url.QueryEscape("invalid form data"), http.StatusSeeOther)
+			return
+		}
+		userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || userID <= 0 {
+			http.Redirect(w, r, "/tasker/settings/landing?error="+url.QueryEscape("invalid user"), http.StatusSeeOther)
+			return
+		}
+		if err := landing.SetUserPage(r.Context(), db, auditSvc, session.UserID, userID, r.FormValue("landing_page")); err != nil {
+			http.Redirect(w, r, "/tasker/settings/landing?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/tasker/settings/landing?status="+url.QueryEscape("user landing page saved"), http.StatusSeeOther)
+	}
+}
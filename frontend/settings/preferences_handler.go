@@ -0,0 +1,129 @@
+package settings
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"receipter/frontend/shared/context"
+	"receipter/frontend/shared/nav"
+	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/sqlite"
+	"receipter/infrastructure/userprefs"
+)
+
+// PreferencesPageHandler shows the signed-in user's display and scanner
+// preferences.
+func PreferencesPageHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := context.GetSessionFromContext(r.Context())
+		prefs, err := userprefs.Load(r.Context(), db, session.UserID)
+		if err != nil {
+			http.Error(w, "failed to load preferences", http.StatusInternalServerError)
+			return
+		}
+		data := PreferencesPageData{
+			IsAdmin:      hasRole(session.UserRoles, rbac.RoleAdmin),
+			IsClient:     hasRole(session.UserRoles, rbac.RoleClient),
+			Status:       r.URL.Query().Get("status"),
+			ErrorMessage: r.URL.Query().Get("error"),
+		}
+		for _, def := range userprefs.Definitions {
+			data.Rows = append(data.Rows, PreferenceRow{
+				Key:     def.Key,
+				Label:   def.Label,
+				Help:    def.Help,
+				Value:   prefs.String(def.Key),
+				Choices: def.Choices,
+			})
+		}
+		for _, table := range userprefs.ColumnTables {
+			hidden := prefs.HiddenColumns(table.Key)
+			if len(hidden) == 0 {
+				continue
+			}
+			row := ColumnPreferenceRow{Key: table.Key, Label: table.Label}
+			for _, column := range table.Columns {
+				if !prefs.ColumnVisible(table.Key, column.ID) {
+					row.Hidden = append(row.Hidden, column.Label)
+				}
+			}
+			data.Columns = append(data.Columns, row)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := PreferencesPage(data).Render(r.Context(), w); err != nil {
+			http.Error(w, "failed to render preferences page", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// UpdatePreferencesHandler saves every preference posted from the page.
+func UpdatePreferencesHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := context.GetSessionFromContext(r.Context())
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/settings/preferences?error=invalid+form", http.StatusSeeOther)
+			return
+		}
+		values := make(map[string]string)
+		for _, def := range userprefs.Definitions {
+			if r.PostForm.Has(def.Key) {
+				values[def.Key] = r.PostForm.Get(def.Key)
+			}
+		}
+		if err := userprefs.Save(r.Context(), db, session.UserID, values); err != nil {
+			msg := "failed to save preferences"
+			if errors.Is(err, userprefs.ErrInvalid) {
+				msg = err.Error()
+			}
+			http.Redirect(w, r, "/tasker/settings/preferences?error="+url.QueryEscape(msg), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/tasker/settings/preferences?status=saved", http.StatusSeeOther)
+	}
+}
+
+// SaveColumnsHandler saves which optional columns of a data table the user
+// shows, or resets the table to show them all, and returns to the table.
+func SaveColumnsHandler(db *sqlite.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, _ := context.GetSessionFromContext(r.Context())
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, "/tasker/settings/preferences?error=invalid+form", http.StatusSeeOther)
+			return
+		}
+		returnTo := nav.ReturnPath(r.PostForm.Get("return_to"), "/tasker/settings/preferences?status=saved")
+		table, ok := userprefs.LookupColumnTable(r.PostForm.Get("table"))
+		if !ok {
+			http.Redirect(w, r, "/tasker/settings/preferences?error="+url.QueryEscape("unknown table"), http.StatusSeeOther)
+			return
+		}
+		var hidden []string
+		if r.PostForm.Get("reset") == "" {
+			shown := make(map[string]bool)
+			for _, id := range r.PostForm["show"] {
+				shown[id] = true
+			}
+			for _, column := range table.Columns {
+				if !shown[column.ID] {
+					hidden = append(hidden, column.ID)
+				}
+			}
+		}
+		if err := userprefs.SaveColumns(r.Context(), db, session.UserID, table.Key, hidden); err != nil {
+			http.Redirect(w, r, "/tasker/settings/preferences?error="+url.QueryEscape("failed to save columns"), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, returnTo, http.StatusSeeOther)
+	}
+}
+
+func hasRole(userRoles []string, role string) bool {
+	for _, userRole := range userRoles {
+		if userRole == role {
+			return true
+		}
+	}
+	return false
+}
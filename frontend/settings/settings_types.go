@@ -3,3 +3,54 @@ package settings
 type NotificationSettings struct {
 	EmailEnabled bool
 }
+
+type LandingOption struct {
+	Key   string
+	Label string
+}
+
+type RoleLandingRow struct {
+	Role        string
+	Page        string
+	DefaultPage string
+	Options     []LandingOption
+}
+
+type UserLandingRow struct {
+	UserID   int64  `bun:"id"`
+	Username string `bun:"username"`
+	Role     string `bun:"role"`
+	Page     string `bun:"landing_page"`
+	Options  []LandingOption
+}
+
+type LandingSettingsPageData struct {
+	Roles        []RoleLandingRow
+	Users        []UserLandingRow
+	Status       string
+	ErrorMessage string
+}
+
+type PreferenceRow struct {
+	Key     string
+	Label   string
+	Help    string
+	Value   string
+	Choices []string
+}
+
+// ColumnPreferenceRow is a data table on which the user hid columns.
+type ColumnPreferenceRow struct {
+	Key    string
+	Label  string
+	Hidden []string
+}
+
+type PreferencesPageData struct {
+	Rows         []PreferenceRow
+	Columns      []ColumnPreferenceRow
+	IsAdmin      bool
+	IsClient     bool
+	Status       string
+	ErrorMessage string
+}
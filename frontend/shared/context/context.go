@@ -24,3 +24,42 @@ func ActiveProjectIDFromContext(ctx context.Context) (int64, bool) {
 	}
 	return *s.ActiveProjectID, true
 }
+
+type schemaWarningKey struct{}
+
+// NewContextWithSchemaWarning marks the request so admin pages show the
+// pending/failed migrations banner.
+func NewContextWithSchemaWarning(ctx context.Context, warning string) context.Context {
+	return context.WithValue(ctx, schemaWarningKey{}, warning)
+}
+
+func SchemaWarningFromContext(ctx context.Context) string {
+	warning, _ := ctx.Value(schemaWarningKey{}).(string)
+	return warning
+}
+
+type maintenanceKey struct{}
+
+// NewContextWithMaintenance marks the request so pages show the read-only
+// maintenance banner.
+func NewContextWithMaintenance(ctx context.Context, banner string) context.Context {
+	return context.WithValue(ctx, maintenanceKey{}, banner)
+}
+
+func MaintenanceFromContext(ctx context.Context) string {
+	banner, _ := ctx.Value(maintenanceKey{}).(string)
+	return banner
+}
+
+type apiTokenKey struct{}
+
+// NewContextWithAPIToken records the API token a request authenticated with,
+// so changes it makes can be attributed to the integration.
+func NewContextWithAPIToken(ctx context.Context, token models.APIToken) context.Context {
+	return context.WithValue(ctx, apiTokenKey{}, token)
+}
+
+func APITokenFromContext(ctx context.Context) (models.APIToken, bool) {
+	token, ok := ctx.Value(apiTokenKey{}).(models.APIToken)
+	return token, ok
+}
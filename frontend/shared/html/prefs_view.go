@@ -0,0 +1,24 @@
+package html
+
+import (
+	"context"
+
+	"github.com/a-h/templ"
+
+	"receipter/infrastructure/userprefs"
+)
+
+// HTMLAttrs are the <html> attributes that apply the signed-in user's theme
+// and density preferences; pages without a user get the light defaults.
+func HTMLAttrs(ctx context.Context) templ.Attributes {
+	prefs := userprefs.FromContext(ctx)
+	return templ.Attributes{
+		"data-theme":   prefs.String(userprefs.Theme),
+		"data-density": prefs.String(userprefs.Density),
+	}
+}
+
+// ShowColumn reports whether the signed-in user shows a data table's column.
+func ShowColumn(ctx context.Context, tableKey, columnID string) bool {
+	return userprefs.FromContext(ctx).ColumnVisible(tableKey, columnID)
+}
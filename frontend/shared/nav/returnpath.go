@@ -0,0 +1,13 @@
+package nav
+
+import "strings"
+
+// ReturnPath keeps a form's return_to redirect on this app's pages. It
+// returns fallback for anything that is not a local /tasker/ path.
+func ReturnPath(raw, fallback string) string {
+	raw = strings.TrimSpace(raw)
+	if !strings.HasPrefix(raw, "/tasker/") || strings.HasPrefix(raw, "//") || strings.Contains(raw, "\\") {
+		return fallback
+	}
+	return raw
+}
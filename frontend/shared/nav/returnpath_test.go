@@ -0,0 +1,24 @@
+package nav
+
+import "testing"
+
+func TestReturnPath(t *testing.T) {
+	const fallback = "/tasker/help"
+	cases := []struct {
+		raw  string
+		want string
+	}{
+		{"/tasker/pallets/progress?status=open", "/tasker/pallets/progress?status=open"},
+		{"  /tasker/projects  ", "/tasker/projects"},
+		{"", fallback},
+		{"/login", fallback},
+		{"https://evil.example/tasker/", fallback},
+		{"//evil.example/tasker/", fallback},
+		{"/tasker/\\evil.example", fallback},
+	}
+	for _, tc := range cases {
+		if got := ReturnPath(tc.raw, fallback); got != tc.want {
+			t.Fatalf("ReturnPath(%q) = %q, want %q", tc.raw, got, tc.want)
+		}
+	}
+}
@@ -3,7 +3,6 @@ package stock
 import (
 	"context"
 	"database/sql"
-	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
@@ -12,6 +11,8 @@ import (
 	"github.com/uptrace/bun"
 
 	"receipter/infrastructure/audit"
+	"receipter/infrastructure/catalog"
+	"receipter/infrastructure/csvimport"
 	"receipter/infrastructure/sqlite"
 	"receipter/models"
 )
@@ -27,15 +28,19 @@ type StockRecord struct {
 	SKU         string `bun:"sku"`
 	Description string `bun:"description"`
 	UOM         string `bun:"uom"`
+	Active      bool   `bun:"active"`
+	HighValue   bool   `bun:"high_value"`
 	CreatedAt   string `bun:"created_at"`
 	UpdatedAt   string `bun:"updated_at"`
+	// SerialTracked items take a serial number per unit when receipted.
+	SerialTracked bool `bun:"serial_tracked"`
 }
 
 func ListStockRecords(ctx context.Context, db *sqlite.DB, projectID int64) ([]StockRecord, error) {
 	rows := make([]StockRecord, 0)
 	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
 		return tx.NewRaw(`
-SELECT id, sku, description, COALESCE(uom, '') AS uom,
+SELECT id, sku, description, COALESCE(uom, '') AS uom, active, high_value, serial_tracked,
        strftime('%d/%m/%Y %H:%M', created_at) AS created_at,
        strftime('%d/%m/%Y %H:%M', updated_at) AS updated_at
 FROM stock_items
@@ -45,9 +50,14 @@ ORDER BY sku COLLATE NOCASE ASC`, projectID).Scan(ctx, &rows)
 	return rows, err
 }
 
-func ImportCSV(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID int64, reader io.Reader) (ImportSummary, error) {
+// ImportCSV upserts stock items from a CSV in any delimiter and encoding
+// csvimport reads; opts left zero detects both.
+func ImportCSV(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID int64, reader io.Reader, opts csvimport.Options) (ImportSummary, error) {
 	summary := ImportSummary{}
-	r := csv.NewReader(reader)
+	r, err := csvimport.NewReader(reader, opts)
+	if err != nil {
+		return summary, err
+	}
 	r.TrimLeadingSpace = true
 
 	header, err := r.Read()
@@ -74,13 +84,12 @@ func ImportCSV(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, user
 				summary.Errors++
 				continue
 			}
-			sku := strings.TrimSpace(record[skuCol])
-			desc := strings.TrimSpace(record[descCol])
-			uom := strings.TrimSpace(record[uomCol])
-			if sku == "" || desc == "" {
+			item := catalog.Item{SKU: record[skuCol], Description: record[descCol], UOM: record[uomCol]}
+			if err := item.Normalize(); err != nil {
 				summary.Errors++
 				continue
 			}
+			sku, desc, uom := item.SKU, item.Description, item.UOM
 
 			var exists int
 			if err := tx.NewRaw("SELECT COUNT(1) FROM stock_items WHERE project_id = ? AND sku = ?", projectID, sku).Scan(ctx, &exists); err != nil {
@@ -98,6 +107,8 @@ VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 ON CONFLICT(project_id, sku) DO UPDATE SET
   description = excluded.description,
   uom = excluded.uom,
+  active = 1,
+  deactivated_at = NULL,
   updated_at = CURRENT_TIMESTAMP`, projectID, sku, desc, uom); err != nil {
 				summary.Errors++
 			}
@@ -2,6 +2,7 @@ package stock
 
 import (
 	"context"
+	"errors"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/uptrace/bun"
 
+	"receipter/infrastructure/csvimport"
 	"receipter/infrastructure/sqlite"
 )
 
@@ -50,7 +52,7 @@ VALUES (1, 'Stock Test', 'Stock import test project', DATE('now'), 'Test Client'
 func TestImportCSV_InvalidHeader(t *testing.T) {
 	db := openStockTestDB(t)
 
-	_, err := ImportCSV(context.Background(), db, nil, 1, 1, strings.NewReader("code,description\nA,Alpha\n"))
+	_, err := ImportCSV(context.Background(), db, nil, 1, 1, strings.NewReader("code,description\nA,Alpha\n"), csvimport.Options{})
 	if err == nil {
 		t.Fatalf("expected invalid header error")
 	}
@@ -59,11 +61,43 @@ func TestImportCSV_InvalidHeader(t *testing.T) {
 	}
 }
 
+func TestImportCSV_ReadsSemicolonWindows1252Catalog(t *testing.T) {
+	db := openStockTestDB(t)
+
+	// As saved by Excel on a French Windows machine: "Café crème – 1€".
+	csvData := "sku;description;uom\r\nA;Caf\xe9 cr\xe8me \x96 1\x80;unit\r\nB;\"Th\xe9; vert\";case\r\n"
+	summary, err := ImportCSV(context.Background(), db, nil, 1, 1, strings.NewReader(csvData), csvimport.Options{})
+	if err != nil {
+		t.Fatalf("import csv: %v", err)
+	}
+	if summary.Inserted != 2 || summary.Errors != 0 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	var descA, descB string
+	err = db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT description FROM stock_items WHERE sku = 'A'`).Scan(ctx, &descA); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT description FROM stock_items WHERE sku = 'B'`).Scan(ctx, &descB)
+	})
+	if err != nil {
+		t.Fatalf("verify imported items: %v", err)
+	}
+	if descA != "Café crème – 1€" || descB != "Thé; vert" {
+		t.Fatalf("descriptions = %q, %q", descA, descB)
+	}
+
+	if _, err := ImportCSV(context.Background(), db, nil, 1, 1, strings.NewReader(csvData), csvimport.Options{Encoding: csvimport.EncodingUTF8}); !errors.Is(err, csvimport.ErrInvalidUTF8) {
+		t.Fatalf("declared utf-8 err = %v, want ErrInvalidUTF8", err)
+	}
+}
+
 func TestImportCSV_AllowsExtraColumnsAndHeaderOrder(t *testing.T) {
 	db := openStockTestDB(t)
 
 	csvData := "notes,uom, description , \ufeffSKU,ignored\nn1,unit,Alpha,A,x\nn2,packs of 1000,Beta,B,y\n"
-	summary, err := ImportCSV(context.Background(), db, nil, 1, 1, strings.NewReader(csvData))
+	summary, err := ImportCSV(context.Background(), db, nil, 1, 1, strings.NewReader(csvData), csvimport.Options{})
 	if err != nil {
 		t.Fatalf("import csv: %v", err)
 	}
@@ -100,7 +134,7 @@ func TestImportCSV_AllowsExtraColumnsAndHeaderOrder(t *testing.T) {
 func TestImportCSV_HappyPathAndUpdatePath(t *testing.T) {
 	db := openStockTestDB(t)
 
-	summary, err := ImportCSV(context.Background(), db, nil, 1, 1, strings.NewReader("sku,description,uom\nA,Alpha,unit\nB,Beta,packs of 1000\n"))
+	summary, err := ImportCSV(context.Background(), db, nil, 1, 1, strings.NewReader("sku,description,uom\nA,Alpha,unit\nB,Beta,packs of 1000\n"), csvimport.Options{})
 	if err != nil {
 		t.Fatalf("import csv 1: %v", err)
 	}
@@ -108,7 +142,7 @@ func TestImportCSV_HappyPathAndUpdatePath(t *testing.T) {
 		t.Fatalf("unexpected summary1: %+v", summary)
 	}
 
-	summary, err = ImportCSV(context.Background(), db, nil, 1, 1, strings.NewReader("sku,description,uom\nA,Alpha2,case\nC,Gamma,\n,Missing,unit\n"))
+	summary, err = ImportCSV(context.Background(), db, nil, 1, 1, strings.NewReader("sku,description,uom\nA,Alpha2,case\nC,Gamma,\n,Missing,unit\n"), csvimport.Options{})
 	if err != nil {
 		t.Fatalf("import csv 2: %v", err)
 	}
@@ -147,7 +181,7 @@ func TestImportCSV_HappyPathAndUpdatePath(t *testing.T) {
 
 func TestListStockRecords_ReturnsSortedRows(t *testing.T) {
 	db := openStockTestDB(t)
-	_, err := ImportCSV(context.Background(), db, nil, 1, 1, strings.NewReader("sku,description,uom\nz-last,Zeta,unit\nA-first,Alpha,\n"))
+	_, err := ImportCSV(context.Background(), db, nil, 1, 1, strings.NewReader("sku,description,uom\nz-last,Zeta,unit\nA-first,Alpha,\n"), csvimport.Options{})
 	if err != nil {
 		t.Fatalf("import csv: %v", err)
 	}
@@ -166,7 +200,7 @@ func TestListStockRecords_ReturnsSortedRows(t *testing.T) {
 
 func TestDeleteStockItems_DeletesMissingAndInUse(t *testing.T) {
 	db := openStockTestDB(t)
-	_, err := ImportCSV(context.Background(), db, nil, 1, 1, strings.NewReader("sku,description,uom\nKEEP,Keep,unit\nDEL,Delete,case\n"))
+	_, err := ImportCSV(context.Background(), db, nil, 1, 1, strings.NewReader("sku,description,uom\nKEEP,Keep,unit\nDEL,Delete,case\n"), csvimport.Options{})
 	if err != nil {
 		t.Fatalf("import csv: %v", err)
 	}
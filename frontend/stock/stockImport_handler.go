@@ -1,6 +1,9 @@
 package stock
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -11,6 +14,8 @@ import (
 
 	sessioncontext "receipter/frontend/shared/context"
 	"receipter/infrastructure/audit"
+	"receipter/infrastructure/catalog"
+	"receipter/infrastructure/csvimport"
 	projectinfra "receipter/infrastructure/project"
 	"receipter/infrastructure/sqlite"
 )
@@ -56,14 +61,21 @@ func StockImportPageQueryHandler(db *sqlite.DB) http.HandlerFunc {
 			return
 		}
 
+		merges, err := catalog.ListMerges(r.Context(), db, projectID, mergeListLimit)
+		if err != nil {
+			http.Error(w, "failed to load stock merges", http.StatusInternalServerError)
+			return
+		}
+
 		data := PageData{
 			ProjectID:     project.ID,
 			ProjectName:   project.Name,
-			ClientName:    project.ClientName,
+			ClientName:    string(project.ClientName),
 			ProjectStatus: project.Status,
 			Message:       message,
 			Projects:      options,
 			Records:       rows,
+			Merges:        merges,
 		}
 
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -106,8 +118,13 @@ func StockImportCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.Hand
 			return
 		}
 		defer file.Close()
+		opts, err := csvimport.ParseOptions(r.FormValue("encoding"), r.FormValue("delimiter"))
+		if err != nil {
+			http.Redirect(w, r, stockImportRedirect("Error: "+err.Error(), projectID), http.StatusSeeOther)
+			return
+		}
 
-		summary, err := ImportCSV(r.Context(), db, auditSvc, session.UserID, projectID, file)
+		summary, err := ImportCSV(r.Context(), db, auditSvc, session.UserID, projectID, file, opts)
 		if err != nil {
 			http.Redirect(w, r, stockImportRedirect("Error: "+err.Error(), projectID), http.StatusSeeOther)
 			return
@@ -162,6 +179,69 @@ func StockDeleteItemCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.
 	}
 }
 
+// StockHighValueCommandHandler flags or clears a stock item as high value.
+func StockHighValueCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return stockFlagCommandHandler(db, auditSvc, "high_value", catalog.SetHighValue,
+		"Stock record flagged as high value", "Stock record no longer needs confirmation")
+}
+
+// StockSerialTrackedCommandHandler turns serial capture on or off for a
+// stock item.
+func StockSerialTrackedCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return stockFlagCommandHandler(db, auditSvc, "serial_tracked", catalog.SetSerialTracked,
+		"Stock record now takes a serial number per unit", "Stock record no longer takes serial numbers")
+}
+
+type stockFlagSetter func(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID, itemID int64, value bool) error
+
+// stockFlagCommandHandler sets a stock item flag from the form value field,
+// "1" for on, and reports onStatus or offStatus.
+func stockFlagCommandHandler(db *sqlite.DB, auditSvc *audit.Service, field string, set stockFlagSetter, onStatus, offStatus string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, _, err := requestedProjectID(r)
+		if err != nil {
+			http.Redirect(w, r, stockImportRedirect("Invalid project id", 0), http.StatusSeeOther)
+			return
+		}
+		if projectID <= 0 {
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Select a project first"), http.StatusSeeOther)
+			return
+		}
+		isActive, err := projectinfra.IsActiveByID(r.Context(), db, projectID)
+		if err != nil {
+			http.Redirect(w, r, stockImportRedirect("Failed to load project", projectID), http.StatusSeeOther)
+			return
+		}
+		if !isActive {
+			http.Redirect(w, r, stockImportRedirect("Inactive projects are read-only", projectID), http.StatusSeeOther)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
+			http.Redirect(w, r, stockImportRedirect("Invalid stock item id", projectID), http.StatusSeeOther)
+			return
+		}
+		value := r.FormValue(field) == "1"
+
+		session, _ := sessioncontext.GetSessionFromContext(r.Context())
+		if err := set(r.Context(), db, auditSvc, session.UserID, projectID, id, value); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Redirect(w, r, stockImportRedirect("Stock record not found", projectID), http.StatusSeeOther)
+				return
+			}
+			http.Redirect(w, r, stockImportRedirect("Failed to update stock record", projectID), http.StatusSeeOther)
+			return
+		}
+
+		status := offStatus
+		if value {
+			status = onStatus
+		}
+		http.Redirect(w, r, stockImportRedirect(status, projectID), http.StatusSeeOther)
+	}
+}
+
 func StockDeleteItemsCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		projectID, _, err := requestedProjectID(r)
@@ -1,5 +1,7 @@
 package stock
 
+import "receipter/infrastructure/catalog"
+
 type ProjectOption struct {
 	ID       int64
 	Label    string
@@ -14,4 +16,5 @@ type PageData struct {
 	Message       string
 	Projects      []ProjectOption
 	Records       []StockRecord
+	Merges        []catalog.MergeRecord
 }
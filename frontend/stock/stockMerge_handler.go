@@ -0,0 +1,109 @@
+package stock
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/catalog"
+	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/sqlite"
+)
+
+// mergeListLimit caps the past merges listed on the stock page.
+const mergeListLimit = 20
+
+// StockMergeCommandHandler merges a duplicate stock item into another.
+func StockMergeCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, ok := activeStockProjectID(w, r, db)
+		if !ok {
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Redirect(w, r, stockImportRedirect("Invalid stock merge form", projectID), http.StatusSeeOther)
+			return
+		}
+		sourceID, _ := strconv.ParseInt(strings.TrimSpace(r.FormValue("source_id")), 10, 64)
+		targetID, _ := strconv.ParseInt(strings.TrimSpace(r.FormValue("target_id")), 10, 64)
+		if sourceID <= 0 || targetID <= 0 {
+			http.Redirect(w, r, stockImportRedirect("Choose the duplicate and the stock record to keep", projectID), http.StatusSeeOther)
+			return
+		}
+
+		session, _ := sessioncontext.GetSessionFromContext(r.Context())
+		result, err := catalog.Merge(r.Context(), db, auditSvc, session.UserID, projectID, sourceID, targetID)
+		if err != nil {
+			status := "Failed to merge stock records"
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				status = "Stock record not found"
+			case errors.Is(err, catalog.ErrMergeSameItem), errors.Is(err, catalog.ErrMergeLocked):
+				status = "Error: " + err.Error()
+			}
+			http.Redirect(w, r, stockImportRedirect(status, projectID), http.StatusSeeOther)
+			return
+		}
+		status := fmt.Sprintf("Merged stock records: %d receipt lines (%d combined with matching lines), %d barcodes and %d comments moved", result.Receipts, result.Combined, result.Barcodes, result.Comments)
+		http.Redirect(w, r, stockImportRedirect(status, projectID), http.StatusSeeOther)
+	}
+}
+
+// StockMergeUndoCommandHandler undoes a stock item merge.
+func StockMergeUndoCommandHandler(db *sqlite.DB, auditSvc *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projectID, ok := activeStockProjectID(w, r, db)
+		if !ok {
+			return
+		}
+		mergeID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || mergeID <= 0 {
+			http.Redirect(w, r, stockImportRedirect("Invalid merge id", projectID), http.StatusSeeOther)
+			return
+		}
+
+		session, _ := sessioncontext.GetSessionFromContext(r.Context())
+		restored, err := catalog.UndoMerge(r.Context(), db, auditSvc, session.UserID, projectID, mergeID)
+		if err != nil {
+			status := "Failed to undo stock merge"
+			if errors.Is(err, catalog.ErrMergeNotFound) || errors.Is(err, catalog.ErrMergeUndone) || errors.Is(err, catalog.ErrMergeSKUInUse) || errors.Is(err, catalog.ErrMergeLocked) {
+				status = "Error: " + err.Error()
+			}
+			http.Redirect(w, r, stockImportRedirect(status, projectID), http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, stockImportRedirect(fmt.Sprintf("Merge undone: %d receipt lines restored", restored), projectID), http.StatusSeeOther)
+	}
+}
+
+// activeStockProjectID resolves the requested project and redirects unless
+// it is active.
+func activeStockProjectID(w http.ResponseWriter, r *http.Request, db *sqlite.DB) (int64, bool) {
+	projectID, _, err := requestedProjectID(r)
+	if err != nil {
+		http.Redirect(w, r, stockImportRedirect("Invalid project id", 0), http.StatusSeeOther)
+		return 0, false
+	}
+	if projectID <= 0 {
+		http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape("Select a project first"), http.StatusSeeOther)
+		return 0, false
+	}
+	isActive, err := projectinfra.IsActiveByID(r.Context(), db, projectID)
+	if err != nil {
+		http.Redirect(w, r, stockImportRedirect("Failed to load project", projectID), http.StatusSeeOther)
+		return 0, false
+	}
+	if !isActive {
+		http.Redirect(w, r, stockImportRedirect("Inactive projects are read-only", projectID), http.StatusSeeOther)
+		return 0, false
+	}
+	return projectID, true
+}
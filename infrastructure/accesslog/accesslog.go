@@ -0,0 +1,279 @@
+// Package accesslog records what client users looked at, per project, so a
+// dispute over whether a client saw some data can be settled from the log.
+// Views are buffered in memory and written in batches to keep the single
+// SQLite writer free for receipting; entries past a project's
+// access_log.retention_days setting are swept hourly.
+package accesslog
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/sqlite"
+)
+
+// Kinds of access.
+const (
+	KindPage   = "page"
+	KindExport = "export"
+	KindPhoto  = "photo"
+)
+
+// Kinds lists the access kinds in display order.
+var Kinds = []string{KindPage, KindExport, KindPhoto}
+
+const (
+	flushInterval = 5 * time.Second
+	sweepInterval = time.Hour
+	// flushBatch wakes the recorder early once this many views are waiting;
+	// maxPending drops views beyond it rather than grow without bound while
+	// the database is unavailable.
+	flushBatch = 200
+	maxPending = 10000
+	// maxFieldLen caps the stored path and query.
+	maxFieldLen = 500
+)
+
+// Entry is one client view.
+type Entry struct {
+	ProjectID int64
+	UserID    int64
+	Username  string
+	Kind      string
+	Path      string
+	Query     string
+	At        time.Time
+}
+
+// Classify sorts a request into the kind of access it records, or reports
+// false for requests that show the client no project data.
+func Classify(method, path string) (string, bool) {
+	if method != http.MethodGet {
+		return "", false
+	}
+	if !strings.HasPrefix(path, "/tasker/pallets/") && !strings.HasPrefix(path, "/tasker/api/pallets/") {
+		return "", false
+	}
+	switch {
+	case strings.HasSuffix(path, ".csv") || strings.HasSuffix(path, "/download") || strings.HasSuffix(path, "/bundle"):
+		return KindExport, true
+	case strings.Contains(path, "/photo"):
+		return KindPhoto, true
+	case strings.HasPrefix(path, "/tasker/api/"):
+		return "", false
+	}
+	return KindPage, true
+}
+
+// Recorder buffers client views and writes them in the background.
+type Recorder struct {
+	db *sqlite.DB
+
+	// Paused, when set before Start, keeps views queued rather than written
+	// while it returns true, such as during maintenance.
+	Paused func() bool
+
+	mu      sync.Mutex
+	pending []Entry
+	dropped int64
+
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	started atomic.Bool
+}
+
+func NewRecorder(db *sqlite.DB) *Recorder {
+	return &Recorder{
+		db:   db,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// Record queues a view. Safe on a nil recorder.
+func (r *Recorder) Record(e Entry) {
+	if r == nil || e.ProjectID <= 0 {
+		return
+	}
+	if e.At.IsZero() {
+		e.At = time.Now().UTC()
+	}
+	e.Path = truncate(e.Path)
+	e.Query = truncate(e.Query)
+
+	r.mu.Lock()
+	if len(r.pending) >= maxPending {
+		r.dropped++
+		r.mu.Unlock()
+		return
+	}
+	r.pending = append(r.pending, e)
+	full := len(r.pending) >= flushBatch
+	r.mu.Unlock()
+	if full {
+		select {
+		case r.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush writes every queued view.
+func (r *Recorder) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	batch := r.pending
+	r.pending = nil
+	dropped := r.dropped
+	r.dropped = 0
+	r.mu.Unlock()
+	if dropped > 0 {
+		slog.Warn("access log: views dropped while the queue was full", slog.Int64("count", dropped))
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	err := r.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, e := range batch {
+			var userID *int64
+			if e.UserID > 0 {
+				userID = &e.UserID
+			}
+			if _, err := tx.NewRaw(`
+INSERT INTO client_access_log (project_id, user_id, username, kind, path, query, created_at)
+SELECT ?, ?, ?, ?, ?, ?, ?
+WHERE EXISTS (SELECT 1 FROM projects WHERE id = ?)`,
+				e.ProjectID, userID, e.Username, e.Kind, e.Path, e.Query, e.At, e.ProjectID).Exec(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// Put the batch back so a passing failure does not lose it.
+		r.mu.Lock()
+		r.pending = append(batch, r.pending...)
+		if len(r.pending) > maxPending {
+			r.dropped += int64(len(r.pending) - maxPending)
+			r.pending = r.pending[len(r.pending)-maxPending:]
+		}
+		r.mu.Unlock()
+	}
+	return err
+}
+
+// SweepExpired deletes views older than their project's retention period at
+// now and returns how many were removed.
+func SweepExpired(ctx context.Context, db *sqlite.DB, now time.Time) (int, error) {
+	removed := 0
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		projectIDs := make([]int64, 0)
+		if err := tx.NewRaw(`SELECT DISTINCT project_id FROM client_access_log ORDER BY project_id`).Scan(ctx, &projectIDs); err != nil {
+			return err
+		}
+		for _, projectID := range projectIDs {
+			settings, err := projectsettings.LoadTx(ctx, tx, projectID)
+			if err != nil {
+				return err
+			}
+			days := settings.Int(projectsettings.AccessLogRetentionDays)
+			if days <= 0 {
+				continue
+			}
+			res, err := tx.NewRaw(`DELETE FROM client_access_log WHERE project_id = ? AND julianday(created_at) <= julianday(?) - ?`, projectID, now, days).Exec(ctx)
+			if err != nil {
+				return err
+			}
+			n, _ := res.RowsAffected()
+			removed += int(n)
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// Start flushes queued views every few seconds and sweeps expired ones every
+// hour until Stop.
+func (r *Recorder) Start() {
+	r.started.Store(true)
+	go func() {
+		defer close(r.done)
+		ctx := context.Background()
+		flush := time.NewTicker(flushInterval)
+		defer flush.Stop()
+		sweep := time.NewTicker(sweepInterval)
+		defer sweep.Stop()
+		paused := func() bool { return r.Paused != nil && r.Paused() }
+		if !paused() {
+			r.sweep(ctx)
+		}
+		for {
+			select {
+			case <-r.stop:
+				if paused() {
+					r.mu.Lock()
+					slog.Warn("access log: queued views not written during maintenance", slog.Int("count", len(r.pending)))
+					r.mu.Unlock()
+					return
+				}
+				if err := r.Flush(ctx); err != nil {
+					slog.Error("access log: final flush failed", slog.Any("err", err))
+				}
+				return
+			case <-r.wake:
+			case <-flush.C:
+			case <-sweep.C:
+				if !paused() {
+					r.sweep(ctx)
+				}
+				continue
+			}
+			if paused() {
+				continue
+			}
+			if err := r.Flush(ctx); err != nil {
+				slog.Error("access log: flush failed", slog.Any("err", err))
+			}
+		}
+	}()
+}
+
+func (r *Recorder) sweep(ctx context.Context) {
+	removed, err := SweepExpired(ctx, r.db, time.Now().UTC())
+	if err != nil {
+		slog.Error("access log: sweep failed", slog.Any("err", err))
+	} else if removed > 0 {
+		slog.Info("access log: expired views deleted", slog.Int("count", removed))
+	}
+}
+
+// Stop ends a started recorder, writing what is still queued.
+func (r *Recorder) Stop() {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+	if !r.started.Load() {
+		return
+	}
+	select {
+	case <-r.done:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+func truncate(s string) string {
+	if len(s) <= maxFieldLen {
+		return s
+	}
+	return s[:maxFieldLen]
+}
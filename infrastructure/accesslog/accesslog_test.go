@@ -0,0 +1,146 @@
+package accesslog
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func openAccessLogTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "accesslog-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+			 (1, 'Kept 30 Days', 'd', '2026-02-01', 'Acme', 'kept', 'active'),
+			 (2, 'Kept Forever', 'd', '2026-02-01', 'Acme', 'forever', 'active')`,
+			`INSERT INTO users (id, username, password_hash, role, client_project_id) VALUES (1, 'client1', 'hash', 'client', 1)`,
+			`INSERT INTO project_settings (project_id, key, value) VALUES
+			 (1, 'access_log.retention_days', '30'),
+			 (2, 'access_log.retention_days', '0')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return db
+}
+
+func countViews(t *testing.T, db *sqlite.DB, projectID int64) int {
+	t.Helper()
+	var n int
+	err := db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT COUNT(*) FROM client_access_log WHERE project_id = ?`, projectID).Scan(ctx, &n)
+	})
+	if err != nil {
+		t.Fatalf("count views: %v", err)
+	}
+	return n
+}
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		method, path string
+		kind         string
+		ok           bool
+	}{
+		{"GET", "/tasker/pallets/sku-view", KindPage, true},
+		{"GET", "/tasker/pallets/sku-view/detail", KindPage, true},
+		{"GET", "/tasker/pallets/12/content-label", KindPage, true},
+		{"GET", "/tasker/pallets/sku-view/export-detail.csv", KindExport, true},
+		{"GET", "/tasker/pallets/sku-view/detail/photos", KindPhoto, true},
+		{"GET", "/tasker/api/pallets/1/receipts/2/photo", KindPhoto, true},
+		{"GET", "/tasker/api/pallets/1/receipts/2/live", "", false},
+		{"POST", "/tasker/pallets/sku-view/detail/comment", "", false},
+		{"GET", "/tasker/settings/preferences", "", false},
+		{"GET", "/tasker/help", "", false},
+	}
+	for _, tc := range cases {
+		kind, ok := Classify(tc.method, tc.path)
+		if kind != tc.kind || ok != tc.ok {
+			t.Errorf("Classify(%s %s) = %q, %v; want %q, %v", tc.method, tc.path, kind, ok, tc.kind, tc.ok)
+		}
+	}
+}
+
+func TestRecorder_FlushWritesQueuedViews(t *testing.T) {
+	db := openAccessLogTestDB(t)
+	recorder := NewRecorder(db)
+
+	recorder.Record(Entry{ProjectID: 1, UserID: 1, Username: "client1", Kind: KindPage, Path: "/tasker/pallets/sku-view", Query: "q=abc"})
+	recorder.Record(Entry{ProjectID: 2, UserID: 1, Username: "client1", Kind: KindExport, Path: "/tasker/pallets/sku-view/export-summary.csv"})
+	// A project deleted before the flush is skipped rather than failing the batch.
+	recorder.Record(Entry{ProjectID: 99, UserID: 1, Username: "client1", Kind: KindPage, Path: "/tasker/pallets/sku-view"})
+	if got := countViews(t, db, 1); got != 0 {
+		t.Fatalf("views before flush = %d, want 0", got)
+	}
+
+	if err := recorder.Flush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if got := countViews(t, db, 1); got != 1 {
+		t.Fatalf("project 1 views = %d, want 1", got)
+	}
+	if got := countViews(t, db, 2); got != 1 {
+		t.Fatalf("project 2 views = %d, want 1", got)
+	}
+	if err := recorder.Flush(context.Background()); err != nil {
+		t.Fatalf("second flush: %v", err)
+	}
+	if got := countViews(t, db, 1); got != 1 {
+		t.Fatalf("project 1 views after second flush = %d, want 1", got)
+	}
+}
+
+func TestSweepExpired_FollowsProjectRetention(t *testing.T) {
+	db := openAccessLogTestDB(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	recorder := NewRecorder(db)
+	for _, projectID := range []int64{1, 2} {
+		recorder.Record(Entry{ProjectID: projectID, UserID: 1, Username: "client1", Kind: KindPage, Path: "/tasker/pallets/sku-view", At: now.AddDate(0, 0, -45)})
+		recorder.Record(Entry{ProjectID: projectID, UserID: 1, Username: "client1", Kind: KindPage, Path: "/tasker/pallets/sku-view", At: now.AddDate(0, 0, -5)})
+	}
+	if err := recorder.Flush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	removed, err := SweepExpired(context.Background(), db, now)
+	if err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("removed = %d, want 1", removed)
+	}
+	if got := countViews(t, db, 1); got != 1 {
+		t.Fatalf("project 1 views = %d, want 1 recent view", got)
+	}
+	if got := countViews(t, db, 2); got != 2 {
+		t.Fatalf("project 2 views = %d, want both kept", got)
+	}
+}
@@ -0,0 +1,474 @@
+// Package anonymize rewrites a copy of a production database so it can be
+// handed to developers. Client names, usernames, auditor names, comments,
+// references and barcodes are replaced with fakes derived from the original
+// value, so rows that shared a value still share one and joins keep working.
+// Photos, export files, sessions, webhook payloads and audit snapshots are
+// dropped, and webhooks and scheduled sheet exports are switched off.
+package anonymize
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/argon"
+	"receipter/infrastructure/auditorlink"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/gs1"
+	"receipter/infrastructure/sqlite"
+)
+
+// DefaultPassword is set on every user of an anonymized copy.
+const DefaultPassword = "Receipter123!Dev"
+
+// Options controls a run.
+type Options struct {
+	// Salt keys the fakes. Runs with the same salt produce the same fakes;
+	// an empty salt is replaced with a random one so fakes cannot be matched
+	// against a dictionary of known barcodes or names.
+	Salt string
+	// Password is set on every user; DefaultPassword when empty.
+	Password string
+}
+
+// Result counts rows rewritten or removed per step.
+type Result map[string]int64
+
+// Snapshot writes a consistent copy of db to path, which must not exist yet.
+func Snapshot(ctx context.Context, db *sqlite.DB, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	_, err := db.WriteSQL.ExecContext(ctx, `VACUUM INTO ?`, path)
+	return err
+}
+
+// Run anonymizes db in place and vacuums it so none of the original values
+// survive in free pages. Only ever point it at a copy made with Snapshot.
+func Run(ctx context.Context, db *sqlite.DB, opts Options) (Result, error) {
+	if opts.Salt == "" {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		opts.Salt = hex.EncodeToString(buf)
+	}
+	if opts.Password == "" {
+		opts.Password = DefaultPassword
+	}
+	passwordHash, err := argon.CreateHash(opts.Password, argon.DefaultParams)
+	if err != nil {
+		return nil, err
+	}
+
+	f := newFaker(opts.Salt)
+	result := Result{}
+	steps := []struct {
+		name string
+		fn   func(ctx context.Context, tx bun.Tx) (int64, error)
+	}{
+		{"auditors", f.rewriteAuditors},
+		{"users", func(ctx context.Context, tx bun.Tx) (int64, error) { return rewriteUsers(ctx, tx, passwordHash) }},
+		{"projects", f.rewriteProjects},
+		{"comments", f.rewriteComments},
+		{"references", f.rewriteReferences},
+		{"barcodes", f.rewriteBarcodes},
+		{"webhooks", f.rewriteWebhooks},
+		{"photos", stripPhotos},
+		{"leftovers", dropLeftovers},
+	}
+	for _, step := range steps {
+		var n int64
+		err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+			var err error
+			n, err = step.fn(ctx, tx)
+			return err
+		})
+		if err != nil {
+			return result, fmt.Errorf("anonymize %s: %w", step.name, err)
+		}
+		result[step.name] = n
+	}
+
+	// Deleted and overwritten values stay readable in free pages until the
+	// file is rebuilt.
+	if _, err := db.WriteSQL.ExecContext(ctx, `VACUUM`); err != nil {
+		return result, fmt.Errorf("vacuum: %w", err)
+	}
+	return result, nil
+}
+
+// rewriteUsers renames every user to role-id, e.g. scanner-12, and gives
+// them all the same password so any account can be signed into.
+func rewriteUsers(ctx context.Context, tx bun.Tx, passwordHash string) (int64, error) {
+	res, err := tx.ExecContext(ctx, `
+UPDATE users
+SET username = role || '-' || id,
+    password_hash = ?,
+    kiosk_pin_hash = '',
+    kiosk_pin_failures = 0,
+    kiosk_pin_locked_until = NULL`, passwordHash)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	// The access log keeps the username at the time of the request. Auditor
+	// rows have no user and were already renamed by rewriteAuditors.
+	if _, err := tx.ExecContext(ctx, `
+UPDATE client_access_log
+SET username = CASE
+      WHEN user_id IS NULL AND username LIKE ? THEN username
+      ELSE COALESCE((SELECT u.username FROM users u WHERE u.id = client_access_log.user_id), 'deleted-user')
+    END,
+    query = ''`, auditorlink.AccessLogName("")+"%"); err != nil {
+		return 0, err
+	}
+	// Reply addresses are unique, so each user gets one on a reserved domain.
+	if _, err := tx.ExecContext(ctx, `
+UPDATE client_reply_addresses
+SET email = 'user-' || user_id || '@example.invalid'`); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// rewriteAuditors renames the people auditor links were issued to, along
+// with the access log rows their links wrote under that name.
+func (f *faker) rewriteAuditors(ctx context.Context, tx bun.Tx) (int64, error) {
+	names := make([]string, 0)
+	if err := tx.NewRaw(`SELECT DISTINCT auditor_name FROM auditor_links ORDER BY 1`).Scan(ctx, &names); err != nil {
+		return 0, err
+	}
+	for _, name := range names {
+		fake := "Auditor " + strings.ToUpper(f.token("auditor", name)[:6])
+		if _, err := tx.ExecContext(ctx, `UPDATE auditor_links SET auditor_name = ? WHERE auditor_name = ?`, fake, name); err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE client_access_log SET username = ? WHERE user_id IS NULL AND username = ?`,
+			auditorlink.AccessLogName(fake), auditorlink.AccessLogName(name)); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(names)), nil
+}
+
+func (f *faker) rewriteProjects(ctx context.Context, tx bun.Tx) (int64, error) {
+	rows := make([]struct {
+		ID         int64  `bun:"id"`
+		ClientName string `bun:"client_name"`
+	}, 0)
+	if err := tx.NewRaw(`SELECT id, client_name FROM projects ORDER BY id`).Scan(ctx, &rows); err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		plain, err := fieldcrypt.Decrypt(row.ClientName)
+		if err != nil {
+			return 0, fmt.Errorf("project %d client name: %w", row.ID, err)
+		}
+		client := "Client " + strings.ToUpper(f.token("client", plain)[:6])
+		// Project names and codes usually carry the client's name too.
+		if _, err := tx.ExecContext(ctx, `UPDATE projects SET name = ?, description = '', code = ?, client_name = ? WHERE id = ?`,
+			fmt.Sprintf("Project %d", row.ID), fmt.Sprintf("project-%d", row.ID), fieldcrypt.String(client), row.ID); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(rows)), nil
+}
+
+// commentColumns hold free text typed by users or clients.
+var commentColumns = []column{
+	{table: "pallet_receipts", name: "comment"},
+	{table: "sku_client_comments", name: "comment"},
+	{table: "client_access_requests", name: "note"},
+	{table: "photo_redactions", name: "note"},
+}
+
+func (f *faker) rewriteComments(ctx context.Context, tx bun.Tx) (int64, error) {
+	var total int64
+	for _, c := range commentColumns {
+		n, err := f.rewriteColumn(ctx, tx, c, func(v string) string {
+			return "Comment " + f.token("comment", v)[:8]
+		})
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// referenceColumns hold delivery and claim references, which are the
+// client's or carrier's numbers, and the carriers named on bookings.
+// Delivery references are shared between pallets, claims and bookings, so
+// they use one prefix and bookings still find their pallets.
+var referenceColumns = []struct {
+	column column
+	prefix string
+}{
+	{column{table: "pallet_attributes", name: "delivery_reference", key: "pallet_id"}, "DEL-"},
+	{column{table: "damage_claims", name: "delivery_reference"}, "DEL-"},
+	{column{table: "delivery_bookings", name: "delivery_reference"}, "DEL-"},
+	{column{table: "delivery_bookings", name: "carrier"}, "Carrier "},
+	{column{table: "damage_claims", name: "claim_reference"}, "CLM-"},
+	{column{table: "wms_snapshots", name: "file_name"}, "snapshot-"},
+}
+
+func (f *faker) rewriteReferences(ctx context.Context, tx bun.Tx) (int64, error) {
+	var total int64
+	for _, r := range referenceColumns {
+		prefix := r.prefix
+		n, err := f.rewriteColumn(ctx, tx, r.column, func(v string) string {
+			return prefix + strings.ToUpper(f.token(prefix, v)[:8])
+		})
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// column names a text column to rewrite. key is the row's primary key
+// column, "id" when empty.
+type column struct {
+	table string
+	name  string
+	key   string
+}
+
+// encrypted reports whether the column is stored through fieldcrypt.
+func (c column) encrypted() bool {
+	for _, e := range fieldcrypt.Columns {
+		if e.Table == c.table && e.Name == c.name {
+			return true
+		}
+	}
+	return false
+}
+
+// rewriteColumn replaces every non-empty value of a text column, decrypting
+// and re-encrypting columns stored through fieldcrypt.
+func (f *faker) rewriteColumn(ctx context.Context, tx bun.Tx, c column, fake func(string) string) (int64, error) {
+	key := c.key
+	if key == "" {
+		key = "id"
+	}
+	rows := make([]struct {
+		ID    int64  `bun:"id"`
+		Value string `bun:"value"`
+	}, 0)
+	if err := tx.NewRaw(`SELECT ? AS id, ? AS value FROM ? WHERE COALESCE(?, '') != '' ORDER BY 1`,
+		bun.Ident(key), bun.Ident(c.name), bun.Ident(c.table), bun.Ident(c.name)).Scan(ctx, &rows); err != nil {
+		return 0, fmt.Errorf("%s.%s: %w", c.table, c.name, err)
+	}
+	for _, row := range rows {
+		value := row.Value
+		if c.encrypted() {
+			plain, err := fieldcrypt.Decrypt(value)
+			if err != nil {
+				return 0, fmt.Errorf("%s.%s row %d: %w", c.table, c.name, row.ID, err)
+			}
+			value = plain
+		}
+		stored := fake(value)
+		if c.encrypted() {
+			sealed, err := fieldcrypt.Encrypt(stored)
+			if err != nil {
+				return 0, err
+			}
+			stored = sealed
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE ? SET ? = ? WHERE ? = ?`,
+			bun.Ident(c.table), bun.Ident(c.name), stored, bun.Ident(key), row.ID); err != nil {
+			return 0, fmt.Errorf("%s.%s row %d: %w", c.table, c.name, row.ID, err)
+		}
+	}
+	return int64(len(rows)), nil
+}
+
+// barcodeColumns all hold values scanned off stock, including unit serial
+// numbers. A barcode mapped to a SKU and scanned onto a receipt gets the same
+// fake in both places.
+var barcodeColumns = []column{
+	{table: "stock_item_barcodes", name: "barcode"},
+	{table: "pallet_receipts", name: "carton_barcode"},
+	{table: "pallet_receipts", name: "item_barcode"},
+	{table: "receipt_serials", name: "serial"},
+}
+
+func (f *faker) rewriteBarcodes(ctx context.Context, tx bun.Tx) (int64, error) {
+	var total int64
+	for _, c := range barcodeColumns {
+		n, err := f.rewriteColumn(ctx, tx, c, f.barcode)
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// rewriteWebhooks points webhooks at a reserved domain and turns them off so
+// a copy started by a developer never calls a client's endpoint.
+func (f *faker) rewriteWebhooks(ctx context.Context, tx bun.Tx) (int64, error) {
+	ids := make([]int64, 0)
+	if err := tx.NewRaw(`SELECT id FROM project_webhooks ORDER BY id`).Scan(ctx, &ids); err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		secret := f.token("webhook", fmt.Sprint(id))
+		if _, err := tx.ExecContext(ctx, `UPDATE project_webhooks SET url = ?, secret = ?, active = 0 WHERE id = ?`,
+			fmt.Sprintf("https://example.invalid/webhooks/%d", id), fieldcrypt.String(secret), id); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(ids)), nil
+}
+
+func stripPhotos(ctx context.Context, tx bun.Tx) (int64, error) {
+	var total int64
+	for _, stmt := range []string{
+		`DELETE FROM receipt_photos`,
+		`DELETE FROM photo_upload_chunks`,
+		`DELETE FROM photo_uploads`,
+		`UPDATE pallet_receipts SET stock_photo_blob = NULL, stock_photo_mime = NULL, stock_photo_name = NULL WHERE stock_photo_blob IS NOT NULL`,
+	} {
+		res, err := tx.ExecContext(ctx, stmt)
+		if err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// dropLeftovers removes rows that carry copies of client data or live
+// credentials and that nothing else references.
+func dropLeftovers(ctx context.Context, tx bun.Tx) (int64, error) {
+	var total int64
+	for _, stmt := range []string{
+		`DELETE FROM sessions`,
+		`DELETE FROM password_resets`,
+		`DELETE FROM pallet_verification_scans`,
+		`DELETE FROM export_jobs`,
+		`DELETE FROM deliveries`,
+		`DELETE FROM delivery_endpoints`,
+		`DELETE FROM inbound_emails`,
+		// Like webhooks, scheduled sheet exports must never write to a
+		// client's real spreadsheet from a copy.
+		`UPDATE export_schedules SET spreadsheet_id = '', active = 0`,
+		`UPDATE export_runs SET destination = '' WHERE destination != ''`,
+		`UPDATE audit_logs SET before_json = NULL, after_json = NULL WHERE before_json IS NOT NULL OR after_json IS NOT NULL`,
+	} {
+		res, err := tx.ExecContext(ctx, stmt)
+		if err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// faker derives fakes from original values with an HMAC so equal inputs map
+// to equal outputs within a run.
+type faker struct {
+	salt []byte
+	// barcodes remembers fakes handed out so two barcodes never collide on
+	// the same fake, which would break the per-project unique index.
+	barcodes map[string]string
+	used     map[string]string
+}
+
+func newFaker(salt string) *faker {
+	return &faker{
+		salt:     []byte(salt),
+		barcodes: make(map[string]string),
+		used:     make(map[string]string),
+	}
+}
+
+func (f *faker) sum(kind, value string, counter uint32) []byte {
+	mac := hmac.New(sha256.New, f.salt)
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	var c [4]byte
+	binary.BigEndian.PutUint32(c[:], counter)
+	mac.Write(c[:])
+	return mac.Sum(nil)
+}
+
+func (f *faker) token(kind, value string) string {
+	return hex.EncodeToString(f.sum(kind, value, 0))
+}
+
+// barcode fakes a scanned value with the same shape: digits stay digits,
+// letters stay letters of the same case and everything else is kept. GTINs
+// get a check digit that is right exactly when the original's was, so
+// receipts flagged for a bad check digit stay flagged.
+func (f *faker) barcode(value string) string {
+	if fake, ok := f.barcodes[value]; ok {
+		return fake
+	}
+	for attempt := uint32(0); ; attempt++ {
+		fake := f.shape(value, attempt)
+		if owner, taken := f.used[fake]; taken && owner != value {
+			continue
+		}
+		f.barcodes[value] = fake
+		f.used[fake] = value
+		return fake
+	}
+}
+
+func (f *faker) shape(value string, attempt uint32) string {
+	out := []byte(value)
+	var stream []byte
+	block := uint32(0)
+	next := func() byte {
+		if len(stream) == 0 {
+			stream = f.sum("barcode", value, attempt<<16|block)
+			block++
+		}
+		b := stream[0]
+		stream = stream[1:]
+		return b
+	}
+	for i := 0; i < len(out); i++ {
+		switch c := out[i]; {
+		case c >= '0' && c <= '9':
+			out[i] = '0' + next()%10
+		case c >= 'A' && c <= 'Z':
+			out[i] = 'A' + next()%26
+		case c >= 'a' && c <= 'z':
+			out[i] = 'a' + next()%26
+		}
+	}
+	if gs1.Name(value) != "" && value == strings.TrimSpace(value) {
+		check := gs1.CheckDigit(string(out[:len(out)-1]))
+		if gs1.Validate(value) != nil {
+			check = '0' + (check-'0'+1)%10
+		}
+		out[len(out)-1] = check
+	}
+	return string(out)
+}
@@ -0,0 +1,259 @@
+package anonymize
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/argon"
+	"receipter/infrastructure/auditorlink"
+	"receipter/infrastructure/gs1"
+	"receipter/infrastructure/sqlite"
+)
+
+func openAnonymizeTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "anonymize-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	return db
+}
+
+func seedAnonymizeData(t *testing.T, db *sqlite.DB) {
+	t.Helper()
+	if err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role, kiosk_pin_hash) VALUES (1, 'jane.admin', 'hash', 'admin', 'pin'), (2, 'bob.scanner', 'hash', 'scanner', '')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+				(1, 'Boba Formosa Feb', 'Boba Formosa inbound', DATE('now'), 'Boba Formosa', 'boba-feb', 'active'),
+				(2, 'Boba Formosa Mar', 'Boba Formosa inbound', DATE('now'), 'Boba Formosa', 'boba-mar', 'active')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'closed'), (2, 2, 'open')`,
+			`INSERT INTO pallet_attributes (pallet_id, delivery_reference) VALUES (1, 'PO-88123')`,
+			`INSERT INTO stock_item_barcodes (project_id, barcode, sku, created_by_user_id) VALUES (1, '4006381333931', 'SKU-A', 1)`,
+			`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, comment, scanned_by_user_id, qty, carton_barcode, item_barcode, stock_photo_blob, stock_photo_mime, barcode_check_failed) VALUES
+				(1, 1, 1, 'SKU-A', 'A', 'Box crushed by Jane', 2, 4, '4006381333931', 'REF-abc/12', X'FFD8', 'image/jpeg', 0),
+				(2, 2, 2, 'SKU-B', 'B', '', 2, 6, '4006381333932', NULL, NULL, NULL, 1)`,
+			`INSERT INTO receipt_photos (pallet_receipt_id, photo_blob) VALUES (1, X'FFD8')`,
+			`INSERT INTO receipt_serials (project_id, pallet_receipt_id, serial, scanned_by_user_id) VALUES (1, 1, 'SN-BF-000123', 2)`,
+			`INSERT INTO damage_claims (project_id, delivery_reference, claim_reference) VALUES (1, 'PO-88123', 'CLAIM-7')`,
+			`INSERT INTO delivery_slots (id, slot_date, start_time, end_time) VALUES (1, DATE('now'), '08:00', '09:00')`,
+			`INSERT INTO delivery_bookings (slot_id, project_id, carrier, delivery_reference) VALUES (1, 1, 'Boba Freight Ltd', 'PO-88123')`,
+			`INSERT INTO client_access_log (project_id, user_id, username, kind, path, query) VALUES (1, 2, 'bob.scanner', 'page', '/tasker/x', 'q=boba')`,
+			`INSERT INTO client_reply_addresses (user_id, email) VALUES (2, 'bob@bobaformosa.example')`,
+			`INSERT INTO inbound_emails (sender, subject, status, user_id) VALUES ('bob@bobaformosa.example', 'Re: SKU-A crushed at Boba Formosa', 'accepted', 2)`,
+			`INSERT INTO password_resets (user_id, token_hash, email, requested_ip, expires_at) VALUES (2, 'hash', 'bob@bobaformosa.example', '203.0.113.9', DATETIME('now', '+1 hour'))`,
+			`INSERT INTO export_schedules (name, project_id, export_type, spreadsheet_id, sheet_tab, interval_hours) VALUES ('Daily receipts', 1, 'receipts_csv', '1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms', 'Receipts', 24)`,
+			`INSERT INTO export_runs (project_id, export_type, params, row_count, duration_ms, destination) VALUES (1, 'receipts_csv', '', 3, 10, 'Google Sheets 1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms, tab "Receipts" (replace)')`,
+			`INSERT INTO sessions (id, user_id, expires_at) VALUES ('secret-session', 1, DATETIME('now', '+1 day'))`,
+			`INSERT INTO audit_logs (user_id, action, entity_type, entity_id, after_json) VALUES (1, 'project.create', 'projects', '1', '{"client_name":"Boba Formosa"}')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("seed data: %v", err)
+	}
+}
+
+func TestRunRewritesClientDataAndKeepsJoins(t *testing.T) {
+	src := openAnonymizeTestDB(t)
+	seedAnonymizeData(t, src)
+	ctx := context.Background()
+
+	copyPath := filepath.Join(t.TempDir(), "anon.db")
+	if err := Snapshot(ctx, src, copyPath); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if err := Snapshot(ctx, src, copyPath); err == nil {
+		t.Fatalf("expected snapshot to refuse an existing file")
+	}
+	db, err := sqlite.OpenDB(copyPath)
+	if err != nil {
+		t.Fatalf("open copy: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err := Run(ctx, db, Options{Salt: "test-salt", Password: "Dev123!Password"}); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	var users []struct {
+		Username     string `bun:"username"`
+		PasswordHash string `bun:"password_hash"`
+		KioskPINHash string `bun:"kiosk_pin_hash"`
+	}
+	if err := db.R.NewRaw(`SELECT username, password_hash, kiosk_pin_hash FROM users ORDER BY id`).Scan(ctx, &users); err != nil {
+		t.Fatalf("load users: %v", err)
+	}
+	if len(users) != 2 || users[0].Username != "admin-1" || users[1].Username != "scanner-2" || users[0].KioskPINHash != "" {
+		t.Fatalf("unexpected users after anonymize: %+v", users)
+	}
+	if ok, err := argon.ComparePasswordAndHash("Dev123!Password", users[1].PasswordHash); err != nil || !ok {
+		t.Fatalf("expected users to sign in with the dev password, ok=%v err=%v", ok, err)
+	}
+
+	var clients []string
+	if err := db.R.NewRaw(`SELECT client_name FROM projects ORDER BY id`).Scan(ctx, &clients); err != nil {
+		t.Fatalf("load clients: %v", err)
+	}
+	if len(clients) != 2 || clients[0] != clients[1] || strings.Contains(clients[0], "Boba") {
+		t.Fatalf("expected one shared fake client name, got %v", clients)
+	}
+
+	var barcodes struct {
+		Mapped  string `bun:"mapped"`
+		Carton  string `bun:"carton"`
+		Item    string `bun:"item"`
+		Flagged string `bun:"flagged"`
+	}
+	if err := db.R.NewRaw(`
+SELECT
+  (SELECT barcode FROM stock_item_barcodes) AS mapped,
+  (SELECT carton_barcode FROM pallet_receipts WHERE id = 1) AS carton,
+  (SELECT item_barcode FROM pallet_receipts WHERE id = 1) AS item,
+  (SELECT carton_barcode FROM pallet_receipts WHERE id = 2) AS flagged`).Scan(ctx, &barcodes); err != nil {
+		t.Fatalf("load barcodes: %v", err)
+	}
+	if barcodes.Mapped != barcodes.Carton || barcodes.Carton == "4006381333931" {
+		t.Fatalf("expected mapped and scanned barcode to share one fake, got %+v", barcodes)
+	}
+	if gs1.Validate(barcodes.Carton) != nil || gs1.Validate(barcodes.Flagged) == nil {
+		t.Fatalf("expected fakes to keep check digit validity, got %+v", barcodes)
+	}
+	if len(barcodes.Item) != len("REF-abc/12") || barcodes.Item[3:4] != "-" || barcodes.Item == "REF-abc/12" {
+		t.Fatalf("expected non-GTIN fake with the same shape, got %q", barcodes.Item)
+	}
+
+	var serial string
+	if err := db.R.NewRaw(`SELECT serial FROM receipt_serials`).Scan(ctx, &serial); err != nil {
+		t.Fatalf("load serial: %v", err)
+	}
+	if serial == "SN-BF-000123" || len(serial) != len("SN-BF-000123") || serial[2:3] != "-" {
+		t.Fatalf("expected fake serial with the same shape, got %q", serial)
+	}
+
+	var refs []string
+	if err := db.R.NewRaw(`SELECT delivery_reference FROM pallet_attributes UNION ALL SELECT delivery_reference FROM damage_claims`).Scan(ctx, &refs); err != nil {
+		t.Fatalf("load references: %v", err)
+	}
+	if len(refs) != 2 || refs[0] != refs[1] || refs[0] == "PO-88123" {
+		t.Fatalf("expected shared fake delivery reference, got %v", refs)
+	}
+	var booking struct {
+		Reference string `bun:"delivery_reference"`
+		Carrier   string `bun:"carrier"`
+	}
+	if err := db.R.NewRaw(`SELECT delivery_reference, carrier FROM delivery_bookings`).Scan(ctx, &booking); err != nil {
+		t.Fatalf("load booking: %v", err)
+	}
+	if booking.Reference != refs[0] || booking.Carrier == "" || strings.Contains(booking.Carrier, "Boba") {
+		t.Fatalf("expected booking to share the pallet's fake reference and get a fake carrier, got %+v", booking)
+	}
+
+	var leftovers struct {
+		Photos   int    `bun:"photos"`
+		Blobs    int    `bun:"blobs"`
+		Sessions int    `bun:"sessions"`
+		Inbound  int    `bun:"inbound"`
+		Resets   int    `bun:"resets"`
+		Reply    string `bun:"reply"`
+		Audit    int    `bun:"audit"`
+		Comment  string `bun:"comment"`
+		LogName  string `bun:"log_name"`
+	}
+	if err := db.R.NewRaw(`
+SELECT
+  (SELECT COUNT(*) FROM receipt_photos) AS photos,
+  (SELECT COUNT(*) FROM pallet_receipts WHERE stock_photo_blob IS NOT NULL) AS blobs,
+  (SELECT COUNT(*) FROM sessions) AS sessions,
+  (SELECT COUNT(*) FROM inbound_emails) AS inbound,
+  (SELECT COUNT(*) FROM password_resets) AS resets,
+  (SELECT email FROM client_reply_addresses) AS reply,
+  (SELECT COUNT(*) FROM audit_logs WHERE after_json IS NOT NULL) AS audit,
+  (SELECT comment FROM pallet_receipts WHERE id = 1) AS comment,
+  (SELECT username FROM client_access_log) AS log_name`).Scan(ctx, &leftovers); err != nil {
+		t.Fatalf("load leftovers: %v", err)
+	}
+	if leftovers.Photos != 0 || leftovers.Blobs != 0 || leftovers.Sessions != 0 || leftovers.Audit != 0 || leftovers.Inbound != 0 || leftovers.Resets != 0 {
+		t.Fatalf("expected photos, sessions, password resets, inbound emails and audit snapshots dropped, got %+v", leftovers)
+	}
+	var schedule struct {
+		SpreadsheetID string `bun:"spreadsheet_id"`
+		Active        bool   `bun:"active"`
+		Destination   string `bun:"destination"`
+	}
+	if err := db.R.NewRaw(`
+SELECT s.spreadsheet_id, s.active, (SELECT destination FROM export_runs) AS destination
+FROM export_schedules s`).Scan(ctx, &schedule); err != nil {
+		t.Fatalf("load export schedule: %v", err)
+	}
+	if schedule.SpreadsheetID != "" || schedule.Active || schedule.Destination != "" {
+		t.Fatalf("expected export schedule switched off without its spreadsheet, got %+v", schedule)
+	}
+	if leftovers.Reply != "user-2@example.invalid" {
+		t.Fatalf("expected fake reply address, got %q", leftovers.Reply)
+	}
+	if strings.Contains(leftovers.Comment, "Jane") || leftovers.Comment == "" || leftovers.LogName != "scanner-2" {
+		t.Fatalf("expected rewritten comment and access log username, got %+v", leftovers)
+	}
+
+	var srcClient string
+	if err := src.R.NewRaw(`SELECT client_name FROM projects WHERE id = 1`).Scan(ctx, &srcClient); err != nil {
+		t.Fatalf("load source client: %v", err)
+	}
+	if srcClient != "Boba Formosa" {
+		t.Fatalf("expected source database untouched, got %q", srcClient)
+	}
+}
+
+func TestRunRewritesAuditorNamesInLinksAndAccessLog(t *testing.T) {
+	db := openAnonymizeTestDB(t)
+	seedAnonymizeData(t, db)
+	ctx := context.Background()
+	if _, err := db.W.ExecContext(ctx, `
+INSERT INTO auditor_links (id, project_id, auditor_name, token_hash, token_prefix, expires_at, created_by_user_id)
+VALUES (1, 1, 'Mei Lin (Boba Formosa QA)', 'hash', 'audit_ab', DATETIME('now', '+7 days'), 1)`); err != nil {
+		t.Fatalf("seed auditor link: %v", err)
+	}
+	if _, err := db.W.ExecContext(ctx, `INSERT INTO client_access_log (project_id, user_id, username, kind, path, query) VALUES (1, NULL, ?, 'page', '/audit/x', '')`,
+		auditorlink.AccessLogName("Mei Lin (Boba Formosa QA)")); err != nil {
+		t.Fatalf("seed auditor access: %v", err)
+	}
+
+	if _, err := Run(ctx, db, Options{Salt: "test-salt"}); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	var auditor string
+	if err := db.R.NewRaw(`SELECT auditor_name FROM auditor_links WHERE id = 1`).Scan(ctx, &auditor); err != nil {
+		t.Fatalf("load auditor: %v", err)
+	}
+	if auditor == "" || strings.Contains(auditor, "Mei") || strings.Contains(auditor, "Boba") {
+		t.Fatalf("expected fake auditor name, got %q", auditor)
+	}
+	var logNames []string
+	if err := db.R.NewRaw(`SELECT username FROM client_access_log WHERE user_id IS NULL`).Scan(ctx, &logNames); err != nil {
+		t.Fatalf("load access log: %v", err)
+	}
+	if len(logNames) != 1 || logNames[0] != auditorlink.AccessLogName(auditor) {
+		t.Fatalf("expected access log under the fake auditor name %q, got %v", auditor, logNames)
+	}
+}
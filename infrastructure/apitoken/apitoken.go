@@ -0,0 +1,173 @@
+package apitoken
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+const tokenPrefix = "rcpt_"
+
+var (
+	ErrNameRequired = errors.New("token name is required")
+	ErrUnknownUser  = errors.New("token user not found")
+	ErrInvalidToken = errors.New("invalid or revoked api token")
+	ErrNotFound     = errors.New("api token not found")
+)
+
+// TokenView is an issued token joined with its user for admin listings.
+type TokenView struct {
+	ID          int64      `bun:"id"`
+	Name        string     `bun:"name"`
+	TokenPrefix string     `bun:"token_prefix"`
+	UserID      int64      `bun:"user_id"`
+	Username    string     `bun:"username"`
+	Role        string     `bun:"role"`
+	CreatedAt   time.Time  `bun:"created_at"`
+	LastUsedAt  *time.Time `bun:"last_used_at"`
+	RevokedAt   *time.Time `bun:"revoked_at"`
+}
+
+func hashToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken() string {
+	buf := make([]byte, 24)
+	_, _ = rand.Read(buf)
+	return tokenPrefix + hex.EncodeToString(buf)
+}
+
+// FromRequest extracts a bearer token from the Authorization header.
+func FromRequest(r *http.Request) (string, bool) {
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[7:])
+	return token, token != ""
+}
+
+// Issue creates a token for userID and returns the plaintext, which is not
+// recoverable afterwards.
+func Issue(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID, userID int64, name string) (string, models.APIToken, error) {
+	var token models.APIToken
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", token, ErrNameRequired
+	}
+	plaintext := newToken()
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var count int
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM users WHERE id = ?`, userID).Scan(ctx, &count); err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrUnknownUser
+		}
+		token = models.APIToken{
+			UserID:          userID,
+			Name:            name,
+			TokenHash:       hashToken(plaintext),
+			TokenPrefix:     plaintext[:len(tokenPrefix)+6],
+			CreatedByUserID: actorUserID,
+		}
+		if _, err := tx.NewInsert().Model(&token).Exec(ctx); err != nil {
+			return err
+		}
+		if auditSvc != nil && actorUserID > 0 {
+			return auditSvc.Write(ctx, tx, actorUserID, "api_token.issue", "api_tokens", strconv.FormatInt(token.ID, 10), nil, map[string]any{
+				"name":    token.Name,
+				"user_id": token.UserID,
+				"prefix":  token.TokenPrefix,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return "", models.APIToken{}, err
+	}
+	return plaintext, token, nil
+}
+
+// Authenticate resolves an active token to its user and records its use.
+func Authenticate(ctx context.Context, db *sqlite.DB, plaintext string) (models.User, models.APIToken, error) {
+	var user models.User
+	var token models.APIToken
+	plaintext = strings.TrimSpace(plaintext)
+	if !strings.HasPrefix(plaintext, tokenPrefix) {
+		return user, token, ErrInvalidToken
+	}
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewSelect().Model(&token).Where("token_hash = ?", hashToken(plaintext)).Where("revoked_at IS NULL").Limit(1).Scan(ctx); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrInvalidToken
+			}
+			return err
+		}
+		if err := tx.NewSelect().Model(&user).Where("id = ?", token.UserID).Where("disabled_at IS NULL").Limit(1).Scan(ctx); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrInvalidToken
+			}
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+UPDATE api_tokens
+SET last_used_at = CURRENT_TIMESTAMP
+WHERE id = ? AND (last_used_at IS NULL OR last_used_at < datetime('now', '-1 minute'))`, token.ID)
+		return err
+	})
+	return user, token, err
+}
+
+func Revoke(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID, tokenID int64) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var token models.APIToken
+		if err := tx.NewSelect().Model(&token).Where("id = ?", tokenID).Limit(1).Scan(ctx); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		if token.RevokedAt != nil {
+			return nil
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE api_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE id = ?`, tokenID); err != nil {
+			return err
+		}
+		if auditSvc != nil && actorUserID > 0 {
+			return auditSvc.Write(ctx, tx, actorUserID, "api_token.revoke", "api_tokens", strconv.FormatInt(tokenID, 10), map[string]any{
+				"name":    token.Name,
+				"user_id": token.UserID,
+				"prefix":  token.TokenPrefix,
+			}, nil)
+		}
+		return nil
+	})
+}
+
+func List(ctx context.Context, db *sqlite.DB) ([]TokenView, error) {
+	tokens := make([]TokenView, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT at.id, at.name, at.token_prefix, at.user_id, u.username, u.role, at.created_at, at.last_used_at, at.revoked_at
+FROM api_tokens at
+JOIN users u ON u.id = at.user_id
+ORDER BY at.revoked_at IS NOT NULL ASC, at.id DESC`).Scan(ctx, &tokens)
+	})
+	return tokens, err
+}
@@ -0,0 +1,132 @@
+package apitoken
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+func openAPITokenTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "apitoken-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO projects (id, name, description, project_date, client_name, code, status, created_at, updated_at)
+VALUES (1, 'Project One', 'one', DATE('now'), 'Client A', 'project-one', 'active', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO users (id, username, password_hash, role, client_project_id, created_at, updated_at)
+VALUES
+  (1, 'admin', 'hash', 'admin', NULL, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
+  (2, 'client-user', 'hash', 'client', 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed test data: %v", err)
+	}
+	return db
+}
+
+func TestFromRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/graphql", nil)
+	if _, ok := FromRequest(r); ok {
+		t.Fatalf("expected no token without header")
+	}
+	r.Header.Set("Authorization", "Basic abc")
+	if _, ok := FromRequest(r); ok {
+		t.Fatalf("expected basic auth to be ignored")
+	}
+	r.Header.Set("Authorization", "bearer  rcpt_abc ")
+	if token, ok := FromRequest(r); !ok || token != "rcpt_abc" {
+		t.Fatalf("expected bearer token, got %q ok=%v", token, ok)
+	}
+}
+
+func TestIssueAuthenticateRevoke(t *testing.T) {
+	db := openAPITokenTestDB(t)
+	ctx := context.Background()
+	auditSvc := audit.NewService()
+
+	if _, _, err := Issue(ctx, db, auditSvc, 1, 2, "  "); !errors.Is(err, ErrNameRequired) {
+		t.Fatalf("expected ErrNameRequired, got %v", err)
+	}
+	if _, _, err := Issue(ctx, db, auditSvc, 1, 99, "BI"); !errors.Is(err, ErrUnknownUser) {
+		t.Fatalf("expected ErrUnknownUser, got %v", err)
+	}
+
+	plaintext, token, err := Issue(ctx, db, auditSvc, 1, 2, "Client BI")
+	if err != nil {
+		t.Fatalf("issue token: %v", err)
+	}
+	if !strings.HasPrefix(plaintext, tokenPrefix) || !strings.HasPrefix(plaintext, token.TokenPrefix) {
+		t.Fatalf("unexpected token %q with prefix %q", plaintext, token.TokenPrefix)
+	}
+	if token.TokenHash == plaintext || strings.Contains(token.TokenHash, plaintext) {
+		t.Fatalf("expected token to be stored hashed")
+	}
+
+	user, _, err := Authenticate(ctx, db, plaintext)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if user.ID != 2 || user.Role != "client" {
+		t.Fatalf("expected client user, got %+v", user)
+	}
+	if _, _, err := Authenticate(ctx, db, plaintext+"x"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken for wrong token, got %v", err)
+	}
+
+	tokens, err := List(ctx, db)
+	if err != nil {
+		t.Fatalf("list tokens: %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].LastUsedAt == nil || tokens[0].Username != "client-user" {
+		t.Fatalf("expected one used token, got %+v", tokens)
+	}
+
+	if err := Revoke(ctx, db, auditSvc, 1, token.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, _, err := Authenticate(ctx, db, plaintext); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected revoked token to be rejected, got %v", err)
+	}
+	if err := Revoke(ctx, db, auditSvc, 1, 999); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	var auditCount int
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT COUNT(1) FROM audit_logs WHERE entity_type = 'api_tokens'`).Scan(ctx, &auditCount)
+	})
+	if err != nil {
+		t.Fatalf("count audit logs: %v", err)
+	}
+	if auditCount != 2 {
+		t.Fatalf("expected issue and revoke audit entries, got %d", auditCount)
+	}
+}
@@ -0,0 +1,216 @@
+// Package auditorlink issues time-boxed links that give an external auditor
+// read-only access to one project without a user account. Like embed
+// widget tokens the token is part of the URL and only its hash is stored; a
+// link stops working when it expires or the moment it is revoked.
+package auditorlink
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+const tokenPrefix = "audit_"
+
+// MaxValidDays is the longest a link can be issued for.
+const MaxValidDays = 30
+
+const maxNameLength = 120
+
+var (
+	ErrNameRequired   = errors.New("auditor name is required")
+	ErrNameTooLong    = errors.New("auditor name must be 120 characters or fewer")
+	ErrInvalidPeriod  = errors.New("links must be valid for between 1 and 30 days")
+	ErrUnknownProject = errors.New("project not found")
+	ErrInvalidToken   = errors.New("invalid, expired or revoked auditor link")
+	ErrNotFound       = errors.New("auditor link not found")
+)
+
+// LinkView is an issued link as listed on the project's auditor page.
+type LinkView struct {
+	ID          int64      `bun:"id"`
+	AuditorName string     `bun:"auditor_name"`
+	TokenPrefix string     `bun:"token_prefix"`
+	CreatedBy   string     `bun:"created_by"`
+	CreatedAt   time.Time  `bun:"created_at"`
+	ExpiresAt   time.Time  `bun:"expires_at"`
+	LastUsedAt  *time.Time `bun:"last_used_at"`
+	RevokedAt   *time.Time `bun:"revoked_at"`
+	// Views counts the pages the link opened that are still in the access
+	// log.
+	Views int64 `bun:"views"`
+}
+
+// Active reports whether the link still grants access at now.
+func (l LinkView) Active(now time.Time) bool {
+	return l.RevokedAt == nil && now.Before(l.ExpiresAt)
+}
+
+// AccessLogName is how an auditor's views are named in the project's access
+// log, keeping them apart from client users.
+func AccessLogName(auditorName string) string {
+	return "auditor: " + auditorName
+}
+
+func hashToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken() string {
+	buf := make([]byte, 24)
+	_, _ = rand.Read(buf)
+	return tokenPrefix + hex.EncodeToString(buf)
+}
+
+// Issue creates a link to projectID valid for validDays from now and returns
+// the plaintext, which is not recoverable afterwards.
+func Issue(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID, projectID int64, auditorName string, validDays int, now time.Time) (string, models.AuditorLink, error) {
+	var link models.AuditorLink
+	auditorName = strings.TrimSpace(auditorName)
+	switch {
+	case auditorName == "":
+		return "", link, ErrNameRequired
+	case len([]rune(auditorName)) > maxNameLength:
+		return "", link, ErrNameTooLong
+	case validDays < 1 || validDays > MaxValidDays:
+		return "", link, ErrInvalidPeriod
+	}
+	plaintext := newToken()
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var count int
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM projects WHERE id = ?`, projectID).Scan(ctx, &count); err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrUnknownProject
+		}
+		link = models.AuditorLink{
+			ProjectID:       projectID,
+			AuditorName:     auditorName,
+			TokenHash:       hashToken(plaintext),
+			TokenPrefix:     plaintext[:len(tokenPrefix)+6],
+			ExpiresAt:       now.UTC().Add(time.Duration(validDays) * 24 * time.Hour),
+			CreatedByUserID: actorUserID,
+			CreatedAt:       now.UTC(),
+		}
+		if _, err := tx.NewInsert().Model(&link).Exec(ctx); err != nil {
+			return err
+		}
+		if auditSvc != nil && actorUserID > 0 {
+			return auditSvc.Write(ctx, tx, actorUserID, "auditor_link.issue", "auditor_links", strconv.FormatInt(link.ID, 10), nil, map[string]any{
+				"project_id": projectID,
+				"auditor":    link.AuditorName,
+				"prefix":     link.TokenPrefix,
+				"expires_at": link.ExpiresAt,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return "", models.AuditorLink{}, err
+	}
+	return plaintext, link, nil
+}
+
+// Authenticate resolves a link that is neither revoked nor expired at now
+// and records its use.
+func Authenticate(ctx context.Context, db *sqlite.DB, plaintext string, now time.Time) (models.AuditorLink, error) {
+	var link models.AuditorLink
+	plaintext = strings.TrimSpace(plaintext)
+	if !strings.HasPrefix(plaintext, tokenPrefix) {
+		return link, ErrInvalidToken
+	}
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewSelect().Model(&link).Where("token_hash = ?", hashToken(plaintext)).Where("revoked_at IS NULL").Limit(1).Scan(ctx); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrInvalidToken
+			}
+			return err
+		}
+		if !now.Before(link.ExpiresAt) {
+			return ErrInvalidToken
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE auditor_links SET last_used_at = ? WHERE id = ?`, now.UTC(), link.ID)
+		return err
+	})
+	if err != nil {
+		return models.AuditorLink{}, err
+	}
+	return link, nil
+}
+
+// Revoke ends a link of projectID straight away. Revoking a revoked or
+// expired link is a no-op.
+func Revoke(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID, projectID, linkID int64) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var link models.AuditorLink
+		if err := tx.NewSelect().Model(&link).Where("id = ?", linkID).Where("project_id = ?", projectID).Limit(1).Scan(ctx); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		if link.RevokedAt != nil {
+			return nil
+		}
+		var revokedBy *int64
+		if actorUserID > 0 {
+			revokedBy = &actorUserID
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE auditor_links SET revoked_at = ?, revoked_by_user_id = ? WHERE id = ?`, time.Now().UTC(), revokedBy, linkID); err != nil {
+			return err
+		}
+		if auditSvc != nil && actorUserID > 0 {
+			return auditSvc.Write(ctx, tx, actorUserID, "auditor_link.revoke", "auditor_links", strconv.FormatInt(linkID, 10), map[string]any{
+				"project_id": projectID,
+				"auditor":    link.AuditorName,
+				"prefix":     link.TokenPrefix,
+			}, nil)
+		}
+		return nil
+	})
+}
+
+// List returns projectID's links, live ones first.
+func List(ctx context.Context, db *sqlite.DB, projectID int64, now time.Time) ([]LinkView, error) {
+	links := make([]LinkView, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT l.id, l.auditor_name, l.token_prefix, COALESCE(u.username, '') AS created_by,
+       l.created_at, l.expires_at, l.last_used_at, l.revoked_at,
+       (SELECT COUNT(1) FROM client_access_log cal
+        WHERE cal.project_id = l.project_id AND cal.user_id IS NULL
+          AND cal.username = ? || l.auditor_name
+          AND julianday(cal.created_at) BETWEEN julianday(l.created_at) AND julianday(COALESCE(l.revoked_at, l.expires_at))) AS views
+FROM auditor_links l
+LEFT JOIN users u ON u.id = l.created_by_user_id
+WHERE l.project_id = ?
+ORDER BY l.id DESC`, AccessLogName(""), projectID).Scan(ctx, &links)
+	})
+	if err != nil {
+		return nil, err
+	}
+	active := make([]LinkView, 0, len(links))
+	inactive := make([]LinkView, 0, len(links))
+	for _, link := range links {
+		if link.Active(now) {
+			active = append(active, link)
+		} else {
+			inactive = append(inactive, link)
+		}
+	}
+	return append(active, inactive...), nil
+}
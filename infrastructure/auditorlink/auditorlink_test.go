@@ -0,0 +1,100 @@
+package auditorlink
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+func openAuditorLinkTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "auditorlink-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	if _, err := db.W.ExecContext(context.Background(), `
+INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin');
+INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+  (1, 'Alpha', 'a', DATE('now'), 'Client A', 'alpha', 'active'),
+  (2, 'Beta', 'b', DATE('now'), 'Client A', 'beta', 'active');
+`); err != nil {
+		t.Fatalf("seed data: %v", err)
+	}
+	return db
+}
+
+func TestAuthenticate_HonoursExpiryAndRevocation(t *testing.T) {
+	db := openAuditorLinkTestDB(t)
+	ctx := context.Background()
+	issuedAt := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	plaintext, link, err := Issue(ctx, db, audit.NewService(), 1, 1, "  Jo Auditor ", 2, issuedAt)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if link.AuditorName != "Jo Auditor" || !link.ExpiresAt.Equal(issuedAt.Add(48*time.Hour)) {
+		t.Fatalf("issued link = %+v", link)
+	}
+
+	got, err := Authenticate(ctx, db, plaintext, issuedAt.Add(47*time.Hour))
+	if err != nil || got.ID != link.ID || got.ProjectID != 1 {
+		t.Fatalf("authenticate before expiry = %+v, %v", got, err)
+	}
+	if _, err := Authenticate(ctx, db, plaintext, issuedAt.Add(48*time.Hour)); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("authenticate at expiry err = %v, want ErrInvalidToken", err)
+	}
+
+	if err := Revoke(ctx, db, audit.NewService(), 1, 2, link.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("revoke from another project err = %v, want ErrNotFound", err)
+	}
+	if err := Revoke(ctx, db, audit.NewService(), 1, 1, link.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err := Authenticate(ctx, db, plaintext, issuedAt.Add(time.Hour)); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("authenticate revoked err = %v, want ErrInvalidToken", err)
+	}
+
+	links, err := List(ctx, db, 1, issuedAt.Add(time.Hour))
+	if err != nil || len(links) != 1 || links[0].Active(issuedAt.Add(time.Hour)) {
+		t.Fatalf("list = %+v, %v", links, err)
+	}
+}
+
+func TestIssue_Refusals(t *testing.T) {
+	db := openAuditorLinkTestDB(t)
+	now := time.Now().UTC()
+	cases := []struct {
+		name      string
+		projectID int64
+		auditor   string
+		days      int
+		want      error
+	}{
+		{"no name", 1, " ", 7, ErrNameRequired},
+		{"no period", 1, "Jo", 0, ErrInvalidPeriod},
+		{"too long", 1, "Jo", MaxValidDays + 1, ErrInvalidPeriod},
+		{"unknown project", 9, "Jo", 7, ErrUnknownProject},
+	}
+	for _, tc := range cases {
+		if _, _, err := Issue(context.Background(), db, nil, 1, tc.projectID, tc.auditor, tc.days, now); !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
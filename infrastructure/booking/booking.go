@@ -0,0 +1,428 @@
+// Package booking schedules carrier arrivals. Admins open delivery slots per
+// day, each taking a limited number of bookings. Carriers book through the
+// API and admins from the bookings page; the gatehouse checks bookings in as
+// trucks arrive. A booking's delivery reference links it to the pallets
+// pre-created for the same delivery, so the dashboard can show what is
+// expected today next to what has turned up.
+package booking
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+// Booking statuses.
+const (
+	StatusBooked    = "booked"
+	StatusArrived   = "arrived"
+	StatusCancelled = "cancelled"
+)
+
+// Booking sources.
+const (
+	SourceWeb = "web"
+	SourceAPI = "api"
+)
+
+const (
+	DateLayout = "2006-01-02"
+	TimeLayout = "15:04"
+
+	// MaxCapacity caps the bookings one slot can take.
+	MaxCapacity = 50
+	// MaxCarrierLength caps the carrier name.
+	MaxCarrierLength = 120
+)
+
+var (
+	ErrInvalidDate     = errors.New("date must be YYYY-MM-DD")
+	ErrInvalidTime     = errors.New("times must be HH:MM")
+	ErrInvalidRange    = errors.New("slot must end after it starts")
+	ErrInvalidCapacity = errors.New("capacity must be between 1 and 50")
+	ErrSlotExists      = errors.New("a slot already starts at that time")
+	ErrSlotNotFound    = errors.New("slot not found")
+	ErrSlotBooked      = errors.New("slot has bookings; cancel them first")
+	ErrSlotFull        = errors.New("slot is fully booked")
+	ErrSlotPast        = errors.New("slot is in the past")
+	ErrCarrierRequired = errors.New("carrier is required")
+	ErrInvalidPallets  = errors.New("expected pallets cannot be negative")
+	ErrProjectInactive = errors.New("project is not active")
+	ErrProjectNotFound = errors.New("project not found")
+	ErrNotFound        = errors.New("booking not found")
+	ErrNotBooked       = errors.New("booking is already arrived or cancelled")
+)
+
+// Slot is a delivery window on one day with the bookings made against it.
+type Slot struct {
+	ID        int64  `bun:"id" json:"id"`
+	Date      string `bun:"slot_date" json:"date"`
+	StartTime string `bun:"start_time" json:"startTime"`
+	EndTime   string `bun:"end_time" json:"endTime"`
+	Capacity  int64  `bun:"capacity" json:"capacity"`
+	// Booked counts the bookings that were not cancelled.
+	Booked   int64     `bun:"booked" json:"booked"`
+	Bookings []Booking `bun:"-" json:"-"`
+}
+
+// Remaining is how many more bookings the slot takes.
+func (s Slot) Remaining() int64 {
+	return max(s.Capacity-s.Booked, 0)
+}
+
+// Booking is one expected delivery.
+type Booking struct {
+	ID                int64     `bun:"id" json:"id"`
+	SlotID            int64     `bun:"slot_id" json:"slotId"`
+	Date              string    `bun:"slot_date" json:"date"`
+	StartTime         string    `bun:"start_time" json:"startTime"`
+	EndTime           string    `bun:"end_time" json:"endTime"`
+	ProjectID         int64     `bun:"project_id" json:"projectId"`
+	ProjectName       string    `bun:"project_name" json:"projectName"`
+	Carrier           string    `bun:"carrier" json:"carrier"`
+	DeliveryReference string    `bun:"delivery_reference" json:"deliveryReference"`
+	ExpectedPallets   int64     `bun:"expected_pallets" json:"expectedPallets"`
+	Status            string    `bun:"status" json:"status"`
+	Source            string    `bun:"source" json:"source"`
+	BookedBy          string    `bun:"booked_by" json:"-"`
+	ArrivedAt         time.Time `bun:"arrived_at" json:"arrivedAt,omitzero"`
+	CheckedInBy       string    `bun:"checked_in_by" json:"-"`
+	// PalletIDs are the project's pallets, cancelled ones left out, whose
+	// delivery reference matches the booking's.
+	PalletIDs    []int64 `bun:"-" json:"palletIds"`
+	PalletIDsCSV string  `bun:"pallet_ids" json:"-"`
+}
+
+// Request is a new booking.
+type Request struct {
+	SlotID            int64  `json:"slotId"`
+	ProjectID         int64  `json:"projectId"`
+	Carrier           string `json:"carrier"`
+	DeliveryReference string `json:"deliveryReference"`
+	ExpectedPallets   int64  `json:"expectedPallets"`
+}
+
+// DaySummary is one project's deliveries for a day.
+type DaySummary struct {
+	Date     string
+	Expected int
+	Arrived  int
+	Bookings []Booking
+}
+
+// ParseDate validates a YYYY-MM-DD date.
+func ParseDate(raw string) (string, error) {
+	d, err := time.Parse(DateLayout, strings.TrimSpace(raw))
+	if err != nil {
+		return "", ErrInvalidDate
+	}
+	return d.Format(DateLayout), nil
+}
+
+func parseTime(raw string) (string, error) {
+	t, err := time.Parse(TimeLayout, strings.TrimSpace(raw))
+	if err != nil {
+		return "", ErrInvalidTime
+	}
+	return t.Format(TimeLayout), nil
+}
+
+// CreateSlot opens a delivery window on date from start to end.
+func CreateSlot(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID int64, date, start, end string, capacity int64) (Slot, error) {
+	var slot Slot
+	var err error
+	if slot.Date, err = ParseDate(date); err != nil {
+		return slot, err
+	}
+	if slot.StartTime, err = parseTime(start); err != nil {
+		return slot, err
+	}
+	if slot.EndTime, err = parseTime(end); err != nil {
+		return slot, err
+	}
+	if slot.EndTime <= slot.StartTime {
+		return slot, ErrInvalidRange
+	}
+	if capacity < 1 || capacity > MaxCapacity {
+		return slot, ErrInvalidCapacity
+	}
+	slot.Capacity = capacity
+
+	err = db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var exists int
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM delivery_slots WHERE slot_date = ? AND start_time = ?`, slot.Date, slot.StartTime).Scan(ctx, &exists); err != nil {
+			return err
+		}
+		if exists > 0 {
+			return ErrSlotExists
+		}
+		if err := tx.NewRaw(`
+INSERT INTO delivery_slots (slot_date, start_time, end_time, capacity, created_by_user_id)
+VALUES (?, ?, ?, ?, ?)
+RETURNING id`, slot.Date, slot.StartTime, slot.EndTime, slot.Capacity, userID).Scan(ctx, &slot.ID); err != nil {
+			return err
+		}
+		return auditSvc.Write(ctx, tx, userID, "delivery_slot.create", "delivery_slots", strconv.FormatInt(slot.ID, 10), nil, slot)
+	})
+	return slot, err
+}
+
+// DeleteSlot removes a slot nobody is booked on. Cancelled bookings go with
+// it.
+func DeleteSlot(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, slotID int64) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		slot, err := loadSlot(ctx, tx, slotID)
+		if err != nil {
+			return err
+		}
+		if slot.Booked > 0 {
+			return ErrSlotBooked
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM delivery_slots WHERE id = ?`, slotID); err != nil {
+			return err
+		}
+		return auditSvc.Write(ctx, tx, userID, "delivery_slot.delete", "delivery_slots", strconv.FormatInt(slotID, 10), slot, nil)
+	})
+}
+
+func loadSlot(ctx context.Context, tx bun.Tx, slotID int64) (Slot, error) {
+	var slot Slot
+	err := tx.NewRaw(`
+SELECT s.id, s.slot_date, s.start_time, s.end_time, s.capacity,
+       (SELECT COUNT(1) FROM delivery_bookings b WHERE b.slot_id = s.id AND b.status != 'cancelled') AS booked
+FROM delivery_slots s
+WHERE s.id = ?`, slotID).Scan(ctx, &slot)
+	if errors.Is(err, sql.ErrNoRows) {
+		return slot, ErrSlotNotFound
+	}
+	return slot, err
+}
+
+// ListSlots returns the slots of a day in start order. withBookings also
+// loads each slot's bookings, cancelled ones included.
+func ListSlots(ctx context.Context, db *sqlite.DB, date string, withBookings bool) ([]Slot, error) {
+	slots := make([]Slot, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`
+SELECT s.id, s.slot_date, s.start_time, s.end_time, s.capacity,
+       (SELECT COUNT(1) FROM delivery_bookings b WHERE b.slot_id = s.id AND b.status != 'cancelled') AS booked
+FROM delivery_slots s
+WHERE s.slot_date = ?
+ORDER BY s.start_time, s.id`, date).Scan(ctx, &slots); err != nil {
+			return err
+		}
+		if !withBookings || len(slots) == 0 {
+			return nil
+		}
+		bookings, err := listBookings(ctx, tx, `s.slot_date = ?`, date)
+		if err != nil {
+			return err
+		}
+		bySlot := make(map[int64]int, len(slots))
+		for i := range slots {
+			bySlot[slots[i].ID] = i
+		}
+		for _, b := range bookings {
+			if i, ok := bySlot[b.SlotID]; ok {
+				slots[i].Bookings = append(slots[i].Bookings, b)
+			}
+		}
+		return nil
+	})
+	return slots, err
+}
+
+// ListDay returns the bookings of a day that were not cancelled, for the
+// gatehouse.
+func ListDay(ctx context.Context, db *sqlite.DB, date string) ([]Booking, error) {
+	var bookings []Booking
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		bookings, err = listBookings(ctx, tx, `s.slot_date = ? AND b.status != 'cancelled'`, date)
+		return err
+	})
+	return bookings, err
+}
+
+// ProjectDay summarises a project's deliveries for a day, for the dashboard.
+func ProjectDay(ctx context.Context, db *sqlite.DB, projectID int64, date string) (DaySummary, error) {
+	summary := DaySummary{Date: date}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		summary.Bookings, err = listBookings(ctx, tx, `s.slot_date = ? AND b.project_id = ? AND b.status != 'cancelled'`, date, projectID)
+		return err
+	})
+	for _, b := range summary.Bookings {
+		summary.Expected++
+		if b.Status == StatusArrived {
+			summary.Arrived++
+		}
+	}
+	return summary, err
+}
+
+// Load returns one booking.
+func Load(ctx context.Context, db *sqlite.DB, bookingID int64) (Booking, error) {
+	var booking Booking
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		booking, err = loadBooking(ctx, tx, bookingID)
+		return err
+	})
+	return booking, err
+}
+
+func loadBooking(ctx context.Context, tx bun.Tx, bookingID int64) (Booking, error) {
+	bookings, err := listBookings(ctx, tx, `b.id = ?`, bookingID)
+	if err != nil {
+		return Booking{}, err
+	}
+	if len(bookings) == 0 {
+		return Booking{}, ErrNotFound
+	}
+	return bookings[0], nil
+}
+
+func listBookings(ctx context.Context, tx bun.Tx, where string, args ...any) ([]Booking, error) {
+	bookings := make([]Booking, 0)
+	if err := tx.NewRaw(`
+SELECT b.id, b.slot_id, s.slot_date, s.start_time, s.end_time,
+       b.project_id, p.name AS project_name,
+       b.carrier, b.delivery_reference, b.expected_pallets, b.status, b.source,
+       COALESCE(bu.username, '') AS booked_by,
+       b.arrived_at,
+       COALESCE(cu.username, '') AS checked_in_by,
+       CASE WHEN TRIM(b.delivery_reference) = '' THEN '' ELSE COALESCE((
+           SELECT GROUP_CONCAT(pl.id)
+           FROM pallets pl
+           JOIN pallet_attributes pa ON pa.pallet_id = pl.id
+           WHERE pl.project_id = b.project_id
+             AND pl.status != 'cancelled'
+             AND pa.delivery_reference = b.delivery_reference
+       ), '') END AS pallet_ids
+FROM delivery_bookings b
+JOIN delivery_slots s ON s.id = b.slot_id
+JOIN projects p ON p.id = b.project_id
+LEFT JOIN users bu ON bu.id = b.booked_by_user_id
+LEFT JOIN users cu ON cu.id = b.checked_in_by_user_id
+WHERE `+where+`
+ORDER BY s.slot_date, s.start_time, b.id`, args...).Scan(ctx, &bookings); err != nil {
+		return nil, err
+	}
+	for i := range bookings {
+		bookings[i].PalletIDs = splitIDs(bookings[i].PalletIDsCSV)
+	}
+	return bookings, nil
+}
+
+func splitIDs(raw string) []int64 {
+	ids := make([]int64, 0)
+	for _, part := range strings.Split(raw, ",") {
+		if id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64); err == nil && id > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Book reserves a place on a slot for a delivery. Slots of days before now
+// and full slots are refused.
+func Book(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID int64, source string, req Request, now time.Time) (Booking, error) {
+	req.Carrier = strings.TrimSpace(req.Carrier)
+	req.DeliveryReference = strings.TrimSpace(req.DeliveryReference)
+	if req.Carrier == "" {
+		return Booking{}, ErrCarrierRequired
+	}
+	if len([]rune(req.Carrier)) > MaxCarrierLength {
+		req.Carrier = string([]rune(req.Carrier)[:MaxCarrierLength])
+	}
+	if req.ExpectedPallets < 0 {
+		return Booking{}, ErrInvalidPallets
+	}
+	if source != SourceAPI {
+		source = SourceWeb
+	}
+
+	var booking Booking
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		slot, err := loadSlot(ctx, tx, req.SlotID)
+		if err != nil {
+			return err
+		}
+		if slot.Date < now.Format(DateLayout) {
+			return ErrSlotPast
+		}
+		if slot.Remaining() <= 0 {
+			return ErrSlotFull
+		}
+		var projectStatus string
+		if err := tx.NewRaw(`SELECT status FROM projects WHERE id = ?`, req.ProjectID).Scan(ctx, &projectStatus); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrProjectNotFound
+			}
+			return err
+		}
+		if projectStatus != "active" {
+			return ErrProjectInactive
+		}
+
+		var id int64
+		if err := tx.NewRaw(`
+INSERT INTO delivery_bookings (slot_id, project_id, carrier, delivery_reference, expected_pallets, source, booked_by_user_id)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+RETURNING id`, req.SlotID, req.ProjectID, req.Carrier, req.DeliveryReference, req.ExpectedPallets, source, userID).Scan(ctx, &id); err != nil {
+			return err
+		}
+		if booking, err = loadBooking(ctx, tx, id); err != nil {
+			return err
+		}
+		return auditSvc.Write(ctx, tx, userID, "delivery_booking.create", "delivery_bookings", strconv.FormatInt(id, 10), nil, req)
+	})
+	return booking, err
+}
+
+// Cancel releases a booking's place on its slot.
+func Cancel(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, bookingID int64) error {
+	return setStatus(ctx, db, auditSvc, userID, bookingID, StatusCancelled, time.Time{})
+}
+
+// CheckIn marks a booked delivery as arrived at now.
+func CheckIn(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, bookingID int64, now time.Time) error {
+	return setStatus(ctx, db, auditSvc, userID, bookingID, StatusArrived, now)
+}
+
+func setStatus(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, bookingID int64, status string, arrivedAt time.Time) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		before, err := loadBooking(ctx, tx, bookingID)
+		if err != nil {
+			return err
+		}
+		if before.Status != StatusBooked {
+			return ErrNotBooked
+		}
+		if status == StatusArrived {
+			_, err = tx.ExecContext(ctx, `
+UPDATE delivery_bookings SET status = ?, arrived_at = ?, checked_in_by_user_id = ? WHERE id = ?`, status, arrivedAt, userID, bookingID)
+		} else {
+			_, err = tx.ExecContext(ctx, `UPDATE delivery_bookings SET status = ? WHERE id = ?`, status, bookingID)
+		}
+		if err != nil {
+			return err
+		}
+		action := "delivery_booking.cancel"
+		if status == StatusArrived {
+			action = "delivery_booking.check_in"
+		}
+		return auditSvc.Write(ctx, tx, userID, action, "delivery_bookings", strconv.FormatInt(bookingID, 10),
+			map[string]any{"status": before.Status},
+			map[string]any{"status": status})
+	})
+}
@@ -0,0 +1,131 @@
+package booking
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+func openBookingTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "booking-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	return db
+}
+
+func TestBookingSlotCapacityCheckInAndPalletLinks(t *testing.T) {
+	db := openBookingTestDB(t)
+	ctx := context.Background()
+	auditSvc := audit.NewService()
+
+	for _, stmt := range []string{
+		`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin')`,
+		`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'P', 'd', '2026-01-01', 'C', 'p', 'active')`,
+		`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (2, 'Old', 'd', '2026-01-01', 'C', 'old', 'inactive')`,
+		`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'created'), (2, 1, 'cancelled'), (3, 1, 'open')`,
+		`INSERT INTO pallet_attributes (pallet_id, delivery_reference) VALUES (1, 'ASN-1'), (2, 'ASN-1'), (3, 'ASN-2')`,
+	} {
+		if _, err := db.W.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed %q: %v", stmt, err)
+		}
+	}
+
+	now := time.Date(2026, 5, 4, 7, 30, 0, 0, time.UTC)
+	if _, err := CreateSlot(ctx, db, auditSvc, 1, "2026-05-04", "10:00", "09:00", 1); !errors.Is(err, ErrInvalidRange) {
+		t.Fatalf("backwards slot err = %v", err)
+	}
+	slot, err := CreateSlot(ctx, db, auditSvc, 1, "2026-05-04", "08:00", "09:00", 1)
+	if err != nil {
+		t.Fatalf("create slot: %v", err)
+	}
+	if _, err := CreateSlot(ctx, db, auditSvc, 1, "2026-05-04", "08:00", "10:00", 2); !errors.Is(err, ErrSlotExists) {
+		t.Fatalf("duplicate slot err = %v", err)
+	}
+	past, err := CreateSlot(ctx, db, auditSvc, 1, "2026-05-03", "08:00", "09:00", 1)
+	if err != nil {
+		t.Fatalf("create past slot: %v", err)
+	}
+
+	if _, err := Book(ctx, db, auditSvc, 1, SourceWeb, Request{SlotID: past.ID, ProjectID: 1, Carrier: "DHL"}, now); !errors.Is(err, ErrSlotPast) {
+		t.Fatalf("past slot err = %v", err)
+	}
+	if _, err := Book(ctx, db, auditSvc, 1, SourceWeb, Request{SlotID: slot.ID, ProjectID: 2, Carrier: "DHL"}, now); !errors.Is(err, ErrProjectInactive) {
+		t.Fatalf("inactive project err = %v", err)
+	}
+	booked, err := Book(ctx, db, auditSvc, 1, SourceAPI, Request{SlotID: slot.ID, ProjectID: 1, Carrier: " DHL ", DeliveryReference: "ASN-1", ExpectedPallets: 2}, now)
+	if err != nil {
+		t.Fatalf("book: %v", err)
+	}
+	if booked.Carrier != "DHL" || booked.Source != SourceAPI || len(booked.PalletIDs) != 1 || booked.PalletIDs[0] != 1 {
+		t.Fatalf("booking = %+v", booked)
+	}
+	if _, err := Book(ctx, db, auditSvc, 1, SourceWeb, Request{SlotID: slot.ID, ProjectID: 1, Carrier: "UPS"}, now); !errors.Is(err, ErrSlotFull) {
+		t.Fatalf("full slot err = %v", err)
+	}
+	if err := DeleteSlot(ctx, db, auditSvc, 1, slot.ID); !errors.Is(err, ErrSlotBooked) {
+		t.Fatalf("delete booked slot err = %v", err)
+	}
+
+	day, err := ProjectDay(ctx, db, 1, "2026-05-04")
+	if err != nil {
+		t.Fatalf("project day: %v", err)
+	}
+	if day.Expected != 1 || day.Arrived != 0 {
+		t.Fatalf("before check-in = %+v", day)
+	}
+	if err := CheckIn(ctx, db, auditSvc, 1, booked.ID, now); err != nil {
+		t.Fatalf("check in: %v", err)
+	}
+	if err := CheckIn(ctx, db, auditSvc, 1, booked.ID, now); !errors.Is(err, ErrNotBooked) {
+		t.Fatalf("second check in err = %v", err)
+	}
+	day, err = ProjectDay(ctx, db, 1, "2026-05-04")
+	if err != nil {
+		t.Fatalf("project day: %v", err)
+	}
+	if day.Expected != 1 || day.Arrived != 1 || !day.Bookings[0].ArrivedAt.Equal(now) || day.Bookings[0].CheckedInBy != "admin" {
+		t.Fatalf("after check-in = %+v", day)
+	}
+
+	// Cancelling frees the place again.
+	second, err := CreateSlot(ctx, db, auditSvc, 1, "2026-05-04", "09:00", "10:00", 1)
+	if err != nil {
+		t.Fatalf("create second slot: %v", err)
+	}
+	other, err := Book(ctx, db, auditSvc, 1, SourceWeb, Request{SlotID: second.ID, ProjectID: 1, Carrier: "UPS"}, now)
+	if err != nil {
+		t.Fatalf("book second: %v", err)
+	}
+	if err := Cancel(ctx, db, auditSvc, 1, other.ID); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	slots, err := ListSlots(ctx, db, "2026-05-04", true)
+	if err != nil {
+		t.Fatalf("list slots: %v", err)
+	}
+	if len(slots) != 2 || slots[1].Remaining() != 1 || len(slots[1].Bookings) != 1 || slots[1].Bookings[0].Status != StatusCancelled {
+		t.Fatalf("slots = %+v", slots)
+	}
+	if err := DeleteSlot(ctx, db, auditSvc, 1, second.ID); err != nil {
+		t.Fatalf("delete slot with only cancelled bookings: %v", err)
+	}
+}
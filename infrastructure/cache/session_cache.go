@@ -6,7 +6,17 @@ import (
 	"receipter/models"
 )
 
-// UserSessionCache stores sessions by token.
+// SessionStore keeps logged-in sessions by token. The middleware and the
+// handlers that change a session go through it, so the store can be swapped
+// without touching them.
+type SessionStore interface {
+	AddSession(s models.Session)
+	FindSessionBySessionToken(token string) (models.Session, bool)
+	DeleteSessionBySessionToken(token string)
+}
+
+// UserSessionCache stores sessions by token in memory. It is lost on
+// restart and is not seen by other instances.
 type UserSessionCache struct {
 	mu       sync.RWMutex
 	sessions map[string]models.Session
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+// Session store kinds accepted by NewSessionStore.
+const (
+	SessionStoreMemory = "memory"
+	SessionStoreSQLite = "sqlite"
+)
+
+// NewSessionStore returns the session store named by kind; an empty kind is
+// the in-memory cache.
+func NewSessionStore(kind string, db *sqlite.DB) (SessionStore, error) {
+	switch kind {
+	case "", SessionStoreMemory:
+		return NewUserSessionCache(), nil
+	case SessionStoreSQLite:
+		return NewSQLiteSessionStore(db), nil
+	default:
+		return nil, errors.New("unknown session store " + kind + "; use memory or sqlite")
+	}
+}
+
+// SQLiteSessionStore reads every session from the sessions table instead of
+// holding it in memory, so sessions survive a restart and every instance
+// sharing the database sees the same logins, logouts and project switches.
+// Expired sessions and sessions of disabled users are not found, and are
+// deleted when looked up.
+type SQLiteSessionStore struct {
+	db *sqlite.DB
+}
+
+func NewSQLiteSessionStore(db *sqlite.DB) *SQLiteSessionStore {
+	return &SQLiteSessionStore{db: db}
+}
+
+// AddSession writes back what a handler changed on the session. Logins
+// insert the row before adding the session, and a session deleted meanwhile,
+// for example by disabling its user, is not brought back.
+func (c *SQLiteSessionStore) AddSession(s models.Session) {
+	ctx := context.Background()
+	err := c.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+UPDATE sessions
+SET active_project_id = ?, active_site_id = ?, expires_at = ?, step_up_at = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?`, s.ActiveProjectID, s.ActiveSiteID, s.ExpiresAt, s.StepUpAt, s.ID)
+		return err
+	})
+	if err != nil {
+		slog.Error("save session failed", slog.String("session_id", s.ID), slog.Any("err", err))
+	}
+}
+
+func (c *SQLiteSessionStore) FindSessionBySessionToken(token string) (models.Session, bool) {
+	ctx := context.Background()
+	var s models.Session
+	err := c.db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewSelect().Model(&s).Relation("User").Where("s.id = ?", token).Limit(1).Scan(ctx)
+	})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.Error("load session failed", slog.String("session_id", token), slog.Any("err", err))
+		}
+		return models.Session{}, false
+	}
+	if s.ExpiresAt.Before(time.Now()) || s.User.DisabledAt != nil {
+		c.DeleteSessionBySessionToken(token)
+		return models.Session{}, false
+	}
+	s.UserRoles = []string{s.User.Role}
+	return s, true
+}
+
+func (c *SQLiteSessionStore) DeleteSessionBySessionToken(token string) {
+	ctx := context.Background()
+	err := c.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE id = ?`, token)
+		return err
+	})
+	if err != nil {
+		slog.Error("delete session failed", slog.String("session_id", token), slog.Any("err", err))
+	}
+}
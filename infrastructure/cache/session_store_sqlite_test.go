@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+func openSessionTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	db, err := sqlite.OpenDB(filepath.Join(t.TempDir(), "session-test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	if err := sqlite.ApplyMigrations(context.Background(), db, filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	_, err = db.W.ExecContext(context.Background(), `
+INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin'), (2, 'scanner', 'hash', 'scanner');
+INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'Inbound', 'd', '2026-01-01', 'Acme', 'inbound', 'active');
+`)
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return db
+}
+
+func insertSession(t *testing.T, db *sqlite.DB, token string, userID int64, expiresAt time.Time) {
+	t.Helper()
+	s := models.Session{ID: token, UserID: userID, ExpiresAt: expiresAt}
+	if _, err := db.W.NewInsert().Model(&s).Exec(context.Background()); err != nil {
+		t.Fatalf("insert session: %v", err)
+	}
+}
+
+func countSessions(t *testing.T, db *sqlite.DB) int {
+	t.Helper()
+	var n int
+	if err := db.R.NewRaw(`SELECT COUNT(*) FROM sessions`).Scan(context.Background(), &n); err != nil {
+		t.Fatalf("count sessions: %v", err)
+	}
+	return n
+}
+
+func TestSQLiteSessionStoreFindsLiveSessions(t *testing.T) {
+	db := openSessionTestDB(t)
+	store := NewSQLiteSessionStore(db)
+	insertSession(t, db, "live", 2, time.Now().Add(time.Hour))
+
+	s, ok := store.FindSessionBySessionToken("live")
+	if !ok {
+		t.Fatalf("expected live session to be found")
+	}
+	if s.UserID != 2 || s.User.Username != "scanner" || len(s.UserRoles) != 1 || s.UserRoles[0] != "scanner" {
+		t.Fatalf("unexpected session %+v", s)
+	}
+	if _, ok := store.FindSessionBySessionToken("missing"); ok {
+		t.Fatalf("expected unknown token not to be found")
+	}
+}
+
+func TestSQLiteSessionStoreDropsExpiredSessions(t *testing.T) {
+	db := openSessionTestDB(t)
+	store := NewSQLiteSessionStore(db)
+	insertSession(t, db, "expired", 2, time.Now().Add(-time.Minute))
+	insertSession(t, db, "live", 1, time.Now().Add(time.Hour))
+
+	if _, ok := store.FindSessionBySessionToken("expired"); ok {
+		t.Fatalf("expected expired session not to be found")
+	}
+	if n := countSessions(t, db); n != 1 {
+		t.Fatalf("expected the expired session row deleted, %d rows left", n)
+	}
+}
+
+func TestSQLiteSessionStoreDeletesSessionsOfDisabledUsers(t *testing.T) {
+	db := openSessionTestDB(t)
+	store := NewSQLiteSessionStore(db)
+	insertSession(t, db, "disabled", 2, time.Now().Add(time.Hour))
+	if _, err := db.W.ExecContext(context.Background(), `UPDATE users SET disabled_at = CURRENT_TIMESTAMP WHERE id = 2`); err != nil {
+		t.Fatalf("disable user: %v", err)
+	}
+
+	if _, ok := store.FindSessionBySessionToken("disabled"); ok {
+		t.Fatalf("expected disabled user's session not to be found")
+	}
+	if n := countSessions(t, db); n != 0 {
+		t.Fatalf("expected the disabled user's session deleted, %d rows left", n)
+	}
+}
+
+func TestSQLiteSessionStoreAddSessionOnlyUpdates(t *testing.T) {
+	db := openSessionTestDB(t)
+	store := NewSQLiteSessionStore(db)
+	insertSession(t, db, "live", 1, time.Now().Add(time.Hour))
+
+	s, ok := store.FindSessionBySessionToken("live")
+	if !ok {
+		t.Fatalf("expected live session to be found")
+	}
+	projectID := int64(1)
+	s.ActiveProjectID = &projectID
+	store.AddSession(s)
+
+	got, ok := store.FindSessionBySessionToken("live")
+	if !ok || got.ActiveProjectID == nil || *got.ActiveProjectID != 1 {
+		t.Fatalf("expected active project saved, got %+v", got)
+	}
+
+	// A session deleted meanwhile, for example by a logout, stays deleted.
+	store.DeleteSessionBySessionToken("live")
+	store.AddSession(got)
+	store.AddSession(models.Session{ID: "never-inserted", UserID: 1, ExpiresAt: time.Now().Add(time.Hour)})
+	if n := countSessions(t, db); n != 0 {
+		t.Fatalf("expected AddSession never to insert, %d rows", n)
+	}
+}
+
+func TestNewSessionStore(t *testing.T) {
+	cases := []struct {
+		kind    string
+		want    string
+		wantErr bool
+	}{
+		{"", "memory", false},
+		{SessionStoreMemory, "memory", false},
+		{SessionStoreSQLite, "sqlite", false},
+		{"redis", "", true},
+	}
+	for _, tc := range cases {
+		store, err := NewSessionStore(tc.kind, nil)
+		if tc.wantErr {
+			if err == nil {
+				t.Fatalf("NewSessionStore(%q): expected an error", tc.kind)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("NewSessionStore(%q): %v", tc.kind, err)
+		}
+		var got string
+		switch store.(type) {
+		case *UserSessionCache:
+			got = "memory"
+		case *SQLiteSessionStore:
+			got = "sqlite"
+		}
+		if got != tc.want {
+			t.Fatalf("NewSessionStore(%q) = %T, want %s store", tc.kind, store, tc.want)
+		}
+	}
+}
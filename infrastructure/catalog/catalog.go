@@ -0,0 +1,322 @@
+// Package catalog maintains a project's stock item master file. The CSV
+// import and the catalog sync API share its validation, so an item accepted
+// by one is accepted by the other. Sync applies upserts and deactivations
+// item by item: an invalid item is reported and skipped, and the rest of the
+// request still applies, as with a CSV import.
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+// MaxBatchSize caps the items (upserts plus deactivations) in one request.
+const MaxBatchSize = 1000
+
+const (
+	ResultInserted    = "inserted"
+	ResultUpdated     = "updated"
+	ResultUnchanged   = "unchanged"
+	ResultDeactivated = "deactivated"
+	ResultNotFound    = "not_found"
+	ResultInvalid     = "invalid"
+)
+
+var (
+	ErrSKURequired         = errors.New("sku is required")
+	ErrDescriptionRequired = errors.New("description is required")
+	ErrEmptyBatch          = errors.New("no items to sync")
+	ErrBatchTooLarge       = errors.New("too many items; send at most 1000 per request")
+)
+
+// Item is one row of the master file.
+type Item struct {
+	SKU         string `json:"sku"`
+	Description string `json:"description"`
+	UOM         string `json:"uom"`
+}
+
+// Normalize trims the item and checks it has what the CSV import requires.
+func (it *Item) Normalize() error {
+	it.SKU = strings.TrimSpace(it.SKU)
+	it.Description = strings.TrimSpace(it.Description)
+	it.UOM = strings.TrimSpace(it.UOM)
+	if it.SKU == "" {
+		return ErrSKURequired
+	}
+	if it.Description == "" {
+		return ErrDescriptionRequired
+	}
+	return nil
+}
+
+// Record is a stock item as the API reports it.
+type Record struct {
+	ID            int64  `bun:"id" json:"id"`
+	SKU           string `bun:"sku" json:"sku"`
+	Description   string `bun:"description" json:"description"`
+	UOM           string `bun:"uom" json:"uom"`
+	Active        bool   `bun:"active" json:"active"`
+	HighValue     bool   `bun:"high_value" json:"highValue"`
+	SerialTracked bool   `bun:"serial_tracked" json:"serialTracked"`
+	UpdatedAt     string `bun:"updated_at" json:"updatedAt"`
+}
+
+// Actor is who a change is attributed to in the audit log. TokenID is set
+// when the change came through an API token.
+type Actor struct {
+	UserID    int64
+	TokenID   int64
+	TokenName string
+}
+
+// Change is the outcome for one SKU in a sync request.
+type Change struct {
+	SKU    string `json:"sku"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Summary counts a sync request's outcomes and lists them per SKU, in
+// request order.
+type Summary struct {
+	Inserted    int      `json:"inserted"`
+	Updated     int      `json:"updated"`
+	Unchanged   int      `json:"unchanged"`
+	Deactivated int      `json:"deactivated"`
+	NotFound    int      `json:"notFound"`
+	Errors      int      `json:"errors"`
+	Changes     []Change `json:"changes"`
+}
+
+func (s *Summary) add(sku, result string, err error) {
+	change := Change{SKU: sku, Result: result}
+	switch result {
+	case ResultInserted:
+		s.Inserted++
+	case ResultUpdated:
+		s.Updated++
+	case ResultUnchanged:
+		s.Unchanged++
+	case ResultDeactivated:
+		s.Deactivated++
+	case ResultNotFound:
+		s.NotFound++
+	case ResultInvalid:
+		s.Errors++
+		change.Error = err.Error()
+	}
+	s.Changes = append(s.Changes, change)
+}
+
+// List returns a project's stock items, active and inactive.
+func List(ctx context.Context, db *sqlite.DB, projectID int64) ([]Record, error) {
+	records := make([]Record, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT id, sku, description, COALESCE(uom, '') AS uom, active, high_value, serial_tracked,
+       strftime('%Y-%m-%dT%H:%M:%SZ', updated_at) AS updated_at
+FROM stock_items
+WHERE project_id = ?
+ORDER BY sku COLLATE NOCASE ASC`, projectID).Scan(ctx, &records)
+	})
+	return records, err
+}
+
+// IsHighValue reports whether the project's catalog flags the SKU as high
+// value, which makes the receipt page ask for confirmation before saving.
+func IsHighValue(ctx context.Context, db *sqlite.DB, projectID int64, sku string) (bool, error) {
+	highValue := false
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT COUNT(1) > 0 FROM stock_items WHERE project_id = ? AND sku = ? AND high_value = 1`, projectID, strings.TrimSpace(sku)).Scan(ctx, &highValue)
+	})
+	return highValue, err
+}
+
+// SetHighValue flags or clears a stock item as high value.
+func SetHighValue(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID, itemID int64, highValue bool) error {
+	return setFlag(ctx, db, auditSvc, userID, projectID, itemID, "high_value", highValue)
+}
+
+// IsSerialTracked reports whether the project's catalog flags the SKU as
+// serial-tracked, which makes the receipt page take a serial number for each
+// unit.
+func IsSerialTracked(ctx context.Context, db *sqlite.DB, projectID int64, sku string) (bool, error) {
+	tracked := false
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT COUNT(1) > 0 FROM stock_items WHERE project_id = ? AND sku = ? AND serial_tracked = 1`, projectID, strings.TrimSpace(sku)).Scan(ctx, &tracked)
+	})
+	return tracked, err
+}
+
+// SerialTrackedSKUs lists the project's active serial-tracked SKUs.
+func SerialTrackedSKUs(ctx context.Context, tx bun.IDB, projectID int64) ([]string, error) {
+	skus := make([]string, 0)
+	err := tx.NewRaw(`SELECT sku FROM stock_items WHERE project_id = ? AND serial_tracked = 1 AND active = 1 ORDER BY sku`, projectID).Scan(ctx, &skus)
+	return skus, err
+}
+
+// SetSerialTracked turns serial capture on or off for a stock item.
+func SetSerialTracked(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID, itemID int64, tracked bool) error {
+	return setFlag(ctx, db, auditSvc, userID, projectID, itemID, "serial_tracked", tracked)
+}
+
+// setFlag sets one of the stock item flag columns and audits the change as
+// stock.<column>.
+func setFlag(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID, itemID int64, column string, value bool) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var before bool
+		if err := tx.NewRaw(`SELECT `+column+` FROM stock_items WHERE id = ? AND project_id = ?`, itemID, projectID).Scan(ctx, &before); err != nil {
+			return err
+		}
+		if before == value {
+			return nil
+		}
+		if _, err := tx.ExecContext(ctx, `
+UPDATE stock_items SET `+column+` = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?`, value, itemID); err != nil {
+			return err
+		}
+		if auditSvc == nil {
+			return nil
+		}
+		return auditSvc.Write(ctx, tx, userID, "stock."+column, "stock_items", strconv.FormatInt(itemID, 10),
+			map[string]any{column: before}, map[string]any{column: value})
+	})
+}
+
+// Sync upserts items and deactivates the listed SKUs in one transaction.
+// Upserting an inactive SKU reactivates it.
+func Sync(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actor Actor, projectID int64, upserts []Item, deactivate []string) (Summary, error) {
+	summary := Summary{Changes: make([]Change, 0, len(upserts)+len(deactivate))}
+	if len(upserts)+len(deactivate) == 0 {
+		return summary, ErrEmptyBatch
+	}
+	if len(upserts)+len(deactivate) > MaxBatchSize {
+		return summary, ErrBatchTooLarge
+	}
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, item := range upserts {
+			if err := item.Normalize(); err != nil {
+				summary.add(item.SKU, ResultInvalid, err)
+				continue
+			}
+			result, err := upsert(ctx, tx, auditSvc, actor, projectID, item)
+			if err != nil {
+				return err
+			}
+			summary.add(item.SKU, result, nil)
+		}
+		for _, sku := range deactivate {
+			sku = strings.TrimSpace(sku)
+			if sku == "" {
+				summary.add(sku, ResultInvalid, ErrSKURequired)
+				continue
+			}
+			result, err := deactivateSKU(ctx, tx, auditSvc, actor, projectID, sku)
+			if err != nil {
+				return err
+			}
+			summary.add(sku, result, nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return Summary{}, err
+	}
+	return summary, nil
+}
+
+type auditedItem struct {
+	Item
+	Active       bool   `json:"active"`
+	APITokenID   int64  `json:"apiTokenId,omitempty"`
+	APITokenName string `json:"apiTokenName,omitempty"`
+}
+
+func (a Actor) audited(item Item, active bool) auditedItem {
+	return auditedItem{Item: item, Active: active, APITokenID: a.TokenID, APITokenName: a.TokenName}
+}
+
+func load(ctx context.Context, tx bun.Tx, projectID int64, sku string) (Record, bool, error) {
+	var r Record
+	err := tx.NewRaw(`
+SELECT id, sku, description, COALESCE(uom, '') AS uom, active, high_value, serial_tracked, CAST(updated_at AS TEXT) AS updated_at
+FROM stock_items
+WHERE project_id = ? AND sku = ?`, projectID, sku).Scan(ctx, &r)
+	if errors.Is(err, sql.ErrNoRows) {
+		return r, false, nil
+	}
+	return r, err == nil, err
+}
+
+func upsert(ctx context.Context, tx bun.Tx, auditSvc *audit.Service, actor Actor, projectID int64, item Item) (string, error) {
+	existing, found, err := load(ctx, tx, projectID, item.SKU)
+	if err != nil {
+		return "", err
+	}
+	if found && existing.Active && existing.Description == item.Description && existing.UOM == item.UOM {
+		return ResultUnchanged, nil
+	}
+
+	var id int64
+	if err := tx.NewRaw(`
+INSERT INTO stock_items (project_id, sku, description, uom, active, created_at, updated_at)
+VALUES (?, ?, ?, ?, 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+ON CONFLICT(project_id, sku) DO UPDATE SET
+  description = excluded.description,
+  uom = excluded.uom,
+  active = 1,
+  deactivated_at = NULL,
+  updated_at = CURRENT_TIMESTAMP
+RETURNING id`, projectID, item.SKU, item.Description, item.UOM).Scan(ctx, &id); err != nil {
+		return "", err
+	}
+
+	result, action := ResultInserted, "stock.create"
+	var before any
+	if found {
+		result, action = ResultUpdated, "stock.update"
+		before = actor.audited(Item{SKU: existing.SKU, Description: existing.Description, UOM: existing.UOM}, existing.Active)
+	}
+	if auditSvc != nil {
+		if err := auditSvc.Write(ctx, tx, actor.UserID, action, "stock_items", strconv.FormatInt(id, 10), before, actor.audited(item, true)); err != nil {
+			return "", err
+		}
+	}
+	return result, nil
+}
+
+func deactivateSKU(ctx context.Context, tx bun.Tx, auditSvc *audit.Service, actor Actor, projectID int64, sku string) (string, error) {
+	existing, found, err := load(ctx, tx, projectID, sku)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return ResultNotFound, nil
+	}
+	if !existing.Active {
+		return ResultUnchanged, nil
+	}
+	if _, err := tx.ExecContext(ctx, `
+UPDATE stock_items SET active = 0, deactivated_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?`, existing.ID); err != nil {
+		return "", err
+	}
+	if auditSvc != nil {
+		item := Item{SKU: existing.SKU, Description: existing.Description, UOM: existing.UOM}
+		if err := auditSvc.Write(ctx, tx, actor.UserID, "stock.deactivate", "stock_items", strconv.FormatInt(existing.ID, 10),
+			actor.audited(item, true), actor.audited(item, false)); err != nil {
+			return "", err
+		}
+	}
+	return ResultDeactivated, nil
+}
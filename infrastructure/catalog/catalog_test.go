@@ -0,0 +1,84 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func openCatalogTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "catalog-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin1', 'x', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+				(1, 'Chilled', 'Chilled', DATE('now'), 'Client', 'chilled', 'active')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return db
+}
+
+func TestSyncReactivatesAndReportsUnchanged(t *testing.T) {
+	db := openCatalogTestDB(t)
+	ctx := context.Background()
+	actor := Actor{UserID: 1, TokenID: 7, TokenName: "ERP"}
+
+	if _, err := Sync(ctx, db, nil, actor, 1, []Item{{SKU: " A1 ", Description: "Widget", UOM: "EA"}}, []string{"A1"}); err != nil {
+		t.Fatalf("first sync: %v", err)
+	}
+	records, err := List(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(records) != 1 || records[0].SKU != "A1" || records[0].Active {
+		t.Fatalf("expected A1 to be inserted then deactivated, got %+v", records)
+	}
+
+	summary, err := Sync(ctx, db, nil, actor, 1, []Item{{SKU: "A1", Description: "Widget", UOM: "EA"}}, []string{"A1-missing"})
+	if err != nil {
+		t.Fatalf("second sync: %v", err)
+	}
+	if summary.Updated != 1 || summary.NotFound != 1 {
+		t.Fatalf("expected reactivation as an update, got %+v", summary)
+	}
+	summary, err = Sync(ctx, db, nil, actor, 1, []Item{{SKU: "A1", Description: "Widget", UOM: "EA"}}, nil)
+	if err != nil {
+		t.Fatalf("third sync: %v", err)
+	}
+	if summary.Unchanged != 1 || summary.Changes[0].Result != ResultUnchanged {
+		t.Fatalf("expected an unchanged item, got %+v", summary)
+	}
+
+	if _, err := Sync(ctx, db, nil, actor, 1, nil, nil); !errors.Is(err, ErrEmptyBatch) {
+		t.Fatalf("expected ErrEmptyBatch, got %v", err)
+	}
+}
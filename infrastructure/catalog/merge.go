@@ -0,0 +1,648 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/coldstorage"
+	"receipter/infrastructure/phase"
+	"receipter/infrastructure/photovisibility"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/receipts"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+var (
+	ErrMergeSameItem = errors.New("choose two different stock items to merge")
+	ErrMergeNotFound = errors.New("stock item merge not found")
+	ErrMergeUndone   = errors.New("this merge has already been undone")
+	ErrMergeSKUInUse = errors.New("the merged SKU is in the catalog again; delete or merge it before undoing")
+	ErrMergeLocked   = errors.New("some of these receipt lines are on pallets of a closed phase, which are read-only")
+)
+
+// mergeTables are the tables whose rows name a SKU and follow it into the
+// target of a merge. Receipt lines carry the SKU itself, so the SKU views,
+// exports and totals pick the merge up without anything to rebuild. Receipt
+// lines are handled by mergeReceipts, which can also combine them.
+var mergeTables = []string{"pallet_receipts", "stock_item_barcodes", "sku_client_comments", "client_comment_threads"}
+
+// MergeResult counts the rows a merge re-pointed at the target SKU.
+// Receipts includes the Combined lines added onto a matching target line.
+type MergeResult struct {
+	MergeID  int64
+	Receipts int
+	Combined int
+	Barcodes int
+	Comments int
+}
+
+// MergeRecord is a past merge as listed for undo.
+type MergeRecord struct {
+	ID           int64  `bun:"id"`
+	SourceSKU    string `bun:"source_sku"`
+	TargetSKU    string `bun:"target_sku"`
+	MergedBy     string `bun:"merged_by"`
+	MergedAt     string `bun:"merged_at"`
+	UndoneAt     string `bun:"undone_at"`
+	ReceiptLines int64  `bun:"receipt_lines"`
+}
+
+type mergeItem struct {
+	ID            int64  `bun:"id" json:"id"`
+	SKU           string `bun:"sku" json:"sku"`
+	Description   string `bun:"description" json:"description"`
+	UOM           string `bun:"uom" json:"uom"`
+	Active        bool   `bun:"active" json:"active"`
+	HighValue     bool   `bun:"high_value" json:"highValue"`
+	SerialTracked bool   `bun:"serial_tracked" json:"serialTracked"`
+	CreatedAt     string `bun:"created_at" json:"createdAt"`
+}
+
+func loadMergeItem(ctx context.Context, tx bun.Tx, projectID, itemID int64) (mergeItem, error) {
+	var item mergeItem
+	err := tx.NewRaw(`
+SELECT id, sku, description, COALESCE(uom, '') AS uom, active, high_value, serial_tracked, CAST(created_at AS TEXT) AS created_at
+FROM stock_items
+WHERE id = ? AND project_id = ?`, itemID, projectID).Scan(ctx, &item)
+	return item, err
+}
+
+// Merge folds the source stock item into the target: receipt lines, barcode
+// aliases and SKU comments naming the source SKU are moved to the target's,
+// the target takes on the source's high value and serial flags, and the
+// source item is deleted. A receipt line that now matches a target line on
+// its pallet is combined with it, as in a pallet move. A comment thread whose target twin already exists
+// stays where it is. Everything changed is recorded so UndoMerge can put it
+// back. A source SKU with lines on pallets of a closed phase is refused with
+// ErrMergeLocked.
+func Merge(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID, sourceID, targetID int64) (MergeResult, error) {
+	var result MergeResult
+	if projectID <= 0 {
+		return result, fmt.Errorf("invalid project id")
+	}
+	if sourceID == targetID {
+		return result, ErrMergeSameItem
+	}
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		source, err := loadMergeItem(ctx, tx, projectID, sourceID)
+		if err != nil {
+			return err
+		}
+		target, err := loadMergeItem(ctx, tx, projectID, targetID)
+		if err != nil {
+			return err
+		}
+		palletIDs := make([]int64, 0)
+		if err := tx.NewRaw(`SELECT DISTINCT pallet_id FROM pallet_receipts WHERE project_id = ? AND sku = ?`, projectID, source.SKU).Scan(ctx, &palletIDs); err != nil {
+			return err
+		}
+		if err := checkPallets(ctx, tx, palletIDs); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`
+INSERT INTO stock_item_merges (
+  project_id, source_item_id, source_sku, source_description, source_uom, source_active,
+  source_high_value, source_serial_tracked, source_created_at,
+  target_item_id, target_sku, target_high_value, target_serial_tracked, merged_by_user_id
+)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id`, projectID, source.ID, source.SKU, source.Description, source.UOM, source.Active,
+			source.HighValue, source.SerialTracked, source.CreatedAt,
+			target.ID, target.SKU, target.HighValue, target.SerialTracked, userID).Scan(ctx, &result.MergeID); err != nil {
+			return err
+		}
+
+		counts := make(map[string]int, len(mergeTables))
+		for _, table := range mergeTables {
+			if table == "pallet_receipts" {
+				moved, combined, err := mergeReceipts(ctx, tx, auditSvc, userID, result.MergeID, projectID, source.SKU, target.SKU)
+				if err != nil {
+					return err
+				}
+				counts[table] = moved + combined
+				result.Combined = combined
+				continue
+			}
+			ids := make([]int64, 0)
+			query := `SELECT id FROM ` + table + ` WHERE project_id = ? AND sku = ?`
+			args := []any{projectID, source.SKU}
+			if table == "client_comment_threads" {
+				query += ` AND NOT EXISTS (
+  SELECT 1 FROM client_comment_threads o
+  WHERE o.project_id = client_comment_threads.project_id AND o.pallet_id = client_comment_threads.pallet_id
+    AND o.sku = ? AND o.uom = client_comment_threads.uom
+    AND o.batch_number = client_comment_threads.batch_number AND o.expiry_date = client_comment_threads.expiry_date)`
+				args = append(args, target.SKU)
+			}
+			if err := tx.NewRaw(query, args...).Scan(ctx, &ids); err != nil {
+				return err
+			}
+			counts[table] = len(ids)
+			if len(ids) == 0 {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `
+INSERT INTO stock_item_merge_rows (merge_id, source_table, row_id)
+SELECT ?, ?, id FROM `+table+` WHERE id IN (?)`, result.MergeID, table, bun.In(ids)); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET sku = ? WHERE id IN (?)`, target.SKU, bun.In(ids)); err != nil {
+				return err
+			}
+		}
+		result.Receipts = counts["pallet_receipts"]
+		result.Barcodes = counts["stock_item_barcodes"]
+		result.Comments = counts["sku_client_comments"] + counts["client_comment_threads"]
+
+		if _, err := tx.ExecContext(ctx, `
+UPDATE stock_items SET high_value = ?, serial_tracked = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?`, target.HighValue || source.HighValue, target.SerialTracked || source.SerialTracked, target.ID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM stock_items WHERE id = ?`, source.ID); err != nil {
+			return err
+		}
+
+		if auditSvc == nil {
+			return nil
+		}
+		return auditSvc.Write(ctx, tx, userID, "stock.merge", "stock_items", strconv.FormatInt(target.ID, 10),
+			map[string]any{"source": source, "target": target},
+			map[string]any{"mergeId": result.MergeID, "receiptLines": result.Receipts, "combinedLines": result.Combined, "barcodes": result.Barcodes, "comments": result.Comments})
+	})
+	return result, err
+}
+
+// mergeLineSnapshot is a receipt line as audited by a merge and, when it was
+// combined, the target line that took it.
+type mergeLineSnapshot struct {
+	models.PalletReceipt
+	MergeID             int64
+	MergedIntoReceiptID int64 `json:",omitempty"`
+}
+
+// combinedLine is a receipt line a merge added onto another, kept whole with
+// what moved across so UndoMerge can split it back out.
+type combinedLine struct {
+	Line models.PalletReceipt
+	// CustomValues are the line's values by field id; TakenFields are the
+	// ones the surviving line did not have and took from it.
+	CustomValues map[int64]string
+	TakenFields  []int64
+	CommentTaken bool
+	// GalleryPhotoID is the surviving line's gallery photo made from the
+	// line's primary photo.
+	GalleryPhotoID int64
+	// Rows holds the ids, by table, of the line's photos, uploads and
+	// serials that moved to the surviving line.
+	Rows map[string][]int64
+}
+
+// combinedRowTables hang off a receipt line and move with it when it is
+// combined.
+var combinedRowTables = []string{"receipt_photos", "photo_uploads", "receipt_serials"}
+
+// mergeReceipts moves the source SKU's receipt lines to the target SKU. A
+// line that matches a target line on its pallet as a new scan would is
+// added onto it, unless the project keeps every scan separate; the others
+// are re-pointed. Each line gets its own audit entry.
+func mergeReceipts(ctx context.Context, tx bun.Tx, auditSvc *audit.Service, userID, mergeID, projectID int64, sourceSKU, targetSKU string) (int, int, error) {
+	settings, err := projectsettings.LoadTx(ctx, tx, projectID)
+	if err != nil {
+		return 0, 0, err
+	}
+	combining := settings.String(projectsettings.ReceiptMergeMode) != projectsettings.MergeModeSeparate
+
+	lines := make([]models.PalletReceipt, 0)
+	if err := tx.NewSelect().Model(&lines).Where("project_id = ?", projectID).Where("sku = ?", sourceSKU).OrderExpr("id ASC").Scan(ctx); err != nil {
+		return 0, 0, err
+	}
+	now := time.Now()
+	moved, combined := 0, 0
+	for _, line := range lines {
+		before := line
+		line.SKU = targetSKU
+		line.UpdatedAt = now
+		after := mergeLineSnapshot{PalletReceipt: line, MergeID: mergeID}
+
+		into, found := models.PalletReceipt{}, false
+		if combining {
+			if into, found, err = combineTarget(ctx, tx, line); err != nil {
+				return 0, 0, err
+			}
+		}
+		if found {
+			if err := combineLine(ctx, tx, mergeID, before, &into, now); err != nil {
+				return 0, 0, err
+			}
+			after = mergeLineSnapshot{PalletReceipt: into, MergeID: mergeID, MergedIntoReceiptID: into.ID}
+			combined++
+		} else {
+			if _, err := tx.NewUpdate().Model(&line).Column("sku", "updated_at").WherePK().Exec(ctx); err != nil {
+				return 0, 0, err
+			}
+			if _, err := tx.ExecContext(ctx, `
+INSERT INTO stock_item_merge_rows (merge_id, source_table, row_id) VALUES (?, 'pallet_receipts', ?)`, mergeID, line.ID); err != nil {
+				return 0, 0, err
+			}
+			moved++
+		}
+		if auditSvc == nil {
+			continue
+		}
+		if err := auditSvc.Write(ctx, tx, userID, "stock.merge_line", "pallet_receipts", strconv.FormatInt(line.ID, 10), before, after); err != nil {
+			return 0, 0, err
+		}
+	}
+	return moved, combined, nil
+}
+
+// combineTarget finds the line line would be added onto, line already
+// carrying the target SKU. Lines on a damage claim and lines whose primary
+// photo is in cold storage are never combined.
+func combineTarget(ctx context.Context, tx bun.Tx, line models.PalletReceipt) (models.PalletReceipt, bool, error) {
+	var held bool
+	if err := tx.NewRaw(`
+SELECT EXISTS (SELECT 1 FROM damage_claim_lines WHERE pallet_receipt_id = ?)
+    OR EXISTS (SELECT 1 FROM cold_storage_photos WHERE source = ? AND photo_id = ?)`,
+		line.ID, coldstorage.SourcePrimary, line.ID).Scan(ctx, &held); err != nil {
+		return models.PalletReceipt{}, false, err
+	}
+	if held {
+		return models.PalletReceipt{}, false, nil
+	}
+	return receipts.FindMatch(ctx, tx, line.PalletID, line)
+}
+
+// combineLine adds line onto into and deletes it, recording what moved. The
+// surviving line keeps its own details and takes line's comment only when
+// it has none; line's primary photo becomes one of its gallery photos.
+func combineLine(ctx context.Context, tx bun.Tx, mergeID int64, line models.PalletReceipt, into *models.PalletReceipt, now time.Time) error {
+	snap := combinedLine{Line: line, CustomValues: make(map[int64]string), TakenFields: make([]int64, 0), Rows: make(map[string][]int64)}
+	for _, table := range combinedRowTables {
+		ids := make([]int64, 0)
+		if err := tx.NewRaw(`SELECT id FROM `+table+` WHERE pallet_receipt_id = ? ORDER BY id`, line.ID).Scan(ctx, &ids); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		snap.Rows[table] = ids
+		if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET pallet_receipt_id = ? WHERE id IN (?)`, into.ID, bun.In(ids)); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE internal_photos SET pallet_receipt_id = ? WHERE source = ? AND pallet_receipt_id = ?`,
+		into.ID, photovisibility.SourceGallery, line.ID); err != nil {
+		return err
+	}
+	if len(line.StockPhotoBlob) > 0 {
+		if err := tx.NewRaw(`
+INSERT INTO receipt_photos (pallet_receipt_id, photo_blob, photo_mime, photo_name, created_at)
+VALUES (?, ?, ?, ?, ?)
+RETURNING id`, into.ID, line.StockPhotoBlob, line.StockPhotoMIME, line.StockPhotoName, line.CreatedAt).Scan(ctx, &snap.GalleryPhotoID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+UPDATE internal_photos SET source = ?, photo_id = ?, pallet_receipt_id = ?
+WHERE source = ? AND photo_id = ?`, photovisibility.SourceGallery, snap.GalleryPhotoID, into.ID, photovisibility.SourcePrimary, line.ID); err != nil {
+			return err
+		}
+	}
+
+	values := make([]struct {
+		FieldID int64  `bun:"field_id"`
+		Value   string `bun:"value"`
+		Taken   bool   `bun:"taken"`
+	}, 0)
+	if err := tx.NewRaw(`
+SELECT field_id, value,
+       NOT EXISTS (SELECT 1 FROM receipt_custom_values t WHERE t.pallet_receipt_id = ? AND t.field_id = v.field_id) AS taken
+FROM receipt_custom_values v
+WHERE v.pallet_receipt_id = ?
+ORDER BY field_id`, into.ID, line.ID).Scan(ctx, &values); err != nil {
+		return err
+	}
+	for _, v := range values {
+		snap.CustomValues[v.FieldID] = v.Value
+		if v.Taken {
+			snap.TakenFields = append(snap.TakenFields, v.FieldID)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO receipt_custom_values (pallet_receipt_id, field_id, value)
+SELECT ?, field_id, value FROM receipt_custom_values WHERE pallet_receipt_id = ?
+ON CONFLICT(pallet_receipt_id, field_id) DO NOTHING`, into.ID, line.ID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM receipt_custom_values WHERE pallet_receipt_id = ?`, line.ID); err != nil {
+		return err
+	}
+
+	into.Qty += line.Qty
+	into.DamagedQty += line.DamagedQty
+	if into.Comment == "" && line.Comment != "" {
+		into.Comment = line.Comment
+		snap.CommentTaken = true
+	}
+	into.UpdatedAt = now
+	if _, err := tx.NewUpdate().Model(into).Column("qty", "damaged_qty", "comment", "updated_at").WherePK().Exec(ctx); err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO stock_item_merge_lines (merge_id, receipt_id, into_receipt_id, snapshot) VALUES (?, ?, ?, ?)`,
+		mergeID, line.ID, into.ID, string(encoded)); err != nil {
+		return err
+	}
+	return receipts.DeleteLine(ctx, tx, line.ID)
+}
+
+// UndoMerge restores the source item of a merge with its original id and
+// moves the rows the merge re-pointed back to its SKU. Combined receipt
+// lines are split back out of the line that took them. Rows edited or
+// deleted since are left as they are now. Undo is refused with
+// ErrMergeLocked once any re-pointed line's pallet is in a closed phase.
+func UndoMerge(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID, mergeID int64) (int, error) {
+	restored := 0
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var m struct {
+			SourceItemID        int64          `bun:"source_item_id"`
+			SourceSKU           string         `bun:"source_sku"`
+			SourceDescription   string         `bun:"source_description"`
+			SourceUOM           string         `bun:"source_uom"`
+			SourceActive        bool           `bun:"source_active"`
+			SourceHighValue     bool           `bun:"source_high_value"`
+			SourceSerialTracked bool           `bun:"source_serial_tracked"`
+			SourceCreatedAt     string         `bun:"source_created_at"`
+			TargetItemID        int64          `bun:"target_item_id"`
+			TargetSKU           string         `bun:"target_sku"`
+			TargetHighValue     bool           `bun:"target_high_value"`
+			TargetSerialTracked bool           `bun:"target_serial_tracked"`
+			UndoneAt            sql.NullString `bun:"undone_at"`
+		}
+		if err := tx.NewRaw(`
+SELECT source_item_id, source_sku, source_description, source_uom, source_active, source_high_value,
+       source_serial_tracked, CAST(source_created_at AS TEXT) AS source_created_at,
+       target_item_id, target_sku, target_high_value, target_serial_tracked, undone_at
+FROM stock_item_merges
+WHERE id = ? AND project_id = ?`, mergeID, projectID).Scan(ctx, &m); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrMergeNotFound
+			}
+			return err
+		}
+		if m.UndoneAt.Valid {
+			return ErrMergeUndone
+		}
+		var taken bool
+		if err := tx.NewRaw(`SELECT EXISTS (SELECT 1 FROM stock_items WHERE project_id = ? AND sku = ?)`, projectID, m.SourceSKU).Scan(ctx, &taken); err != nil {
+			return err
+		}
+		if taken {
+			return ErrMergeSKUInUse
+		}
+		palletIDs := make([]int64, 0)
+		if err := tx.NewRaw(`
+SELECT pr.pallet_id FROM pallet_receipts pr
+JOIN stock_item_merge_rows r ON r.row_id = pr.id AND r.merge_id = ? AND r.source_table = 'pallet_receipts'
+WHERE pr.sku = ?
+UNION
+SELECT pr.pallet_id FROM pallet_receipts pr
+JOIN stock_item_merge_lines l ON l.into_receipt_id = pr.id AND l.merge_id = ?`, mergeID, m.TargetSKU, mergeID).Scan(ctx, &palletIDs); err != nil {
+			return err
+		}
+		if err := checkPallets(ctx, tx, palletIDs); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO stock_items (id, project_id, sku, description, uom, active, deactivated_at, high_value, serial_tracked, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, CASE WHEN ? THEN NULL ELSE CURRENT_TIMESTAMP END, ?, ?, ?, CURRENT_TIMESTAMP)`,
+			m.SourceItemID, projectID, m.SourceSKU, m.SourceDescription, m.SourceUOM, m.SourceActive, m.SourceActive,
+			m.SourceHighValue, m.SourceSerialTracked, m.SourceCreatedAt); err != nil {
+			return err
+		}
+		split, err := splitLines(ctx, tx, auditSvc, userID, mergeID)
+		if err != nil {
+			return err
+		}
+		for _, table := range mergeTables {
+			if table == "pallet_receipts" {
+				moved, err := unmergeReceipts(ctx, tx, auditSvc, userID, mergeID, m.SourceSKU, m.TargetSKU)
+				if err != nil {
+					return err
+				}
+				restored = split + moved
+				continue
+			}
+			// OR IGNORE keeps a comment thread opened on the source SKU
+			// since the merge; the re-pointed one stays on the target.
+			if _, err := tx.ExecContext(ctx, `
+UPDATE OR IGNORE `+table+` SET sku = ?
+WHERE sku = ? AND id IN (SELECT row_id FROM stock_item_merge_rows WHERE merge_id = ? AND source_table = ?)`,
+				m.SourceSKU, m.TargetSKU, mergeID, table); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `
+UPDATE stock_items SET high_value = ?, serial_tracked = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?`, m.TargetHighValue, m.TargetSerialTracked, m.TargetItemID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+UPDATE stock_item_merges SET undone_by_user_id = ?, undone_at = CURRENT_TIMESTAMP
+WHERE id = ?`, userID, mergeID); err != nil {
+			return err
+		}
+
+		if auditSvc == nil {
+			return nil
+		}
+		return auditSvc.Write(ctx, tx, userID, "stock.merge_undo", "stock_items", strconv.FormatInt(m.SourceItemID, 10),
+			map[string]any{"mergeId": mergeID, "sku": m.TargetSKU},
+			map[string]any{"sku": m.SourceSKU, "receiptLines": restored})
+	})
+	return restored, err
+}
+
+// unmergeReceipts moves the receipt lines a merge re-pointed, and that
+// still carry the target SKU, back to the source SKU, auditing each.
+func unmergeReceipts(ctx context.Context, tx bun.Tx, auditSvc *audit.Service, userID, mergeID int64, sourceSKU, targetSKU string) (int, error) {
+	lines := make([]models.PalletReceipt, 0)
+	if err := tx.NewSelect().Model(&lines).
+		Where("sku = ?", targetSKU).
+		Where("id IN (SELECT row_id FROM stock_item_merge_rows WHERE merge_id = ? AND source_table = 'pallet_receipts')", mergeID).
+		OrderExpr("id ASC").Scan(ctx); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	for _, line := range lines {
+		before := line
+		line.SKU = sourceSKU
+		line.UpdatedAt = now
+		if _, err := tx.NewUpdate().Model(&line).Column("sku", "updated_at").WherePK().Exec(ctx); err != nil {
+			return 0, err
+		}
+		if auditSvc == nil {
+			continue
+		}
+		if err := auditSvc.Write(ctx, tx, userID, "stock.merge_undo_line", "pallet_receipts", strconv.FormatInt(line.ID, 10),
+			mergeLineSnapshot{PalletReceipt: before, MergeID: mergeID}, line); err != nil {
+			return 0, err
+		}
+	}
+	return len(lines), nil
+}
+
+// splitLines restores the lines a merge combined, newest first, taking
+// their quantities and what moved with them back off the surviving line.
+// A surviving line deleted since, or holding less than the combined line
+// added, is left as it is now.
+func splitLines(ctx context.Context, tx bun.Tx, auditSvc *audit.Service, userID, mergeID int64) (int, error) {
+	rows := make([]struct {
+		IntoReceiptID int64  `bun:"into_receipt_id"`
+		Snapshot      string `bun:"snapshot"`
+	}, 0)
+	if err := tx.NewRaw(`
+SELECT into_receipt_id, snapshot FROM stock_item_merge_lines
+WHERE merge_id = ?
+ORDER BY receipt_id DESC`, mergeID).Scan(ctx, &rows); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	split := 0
+	for _, row := range rows {
+		var snap combinedLine
+		if err := json.Unmarshal([]byte(row.Snapshot), &snap); err != nil {
+			return split, err
+		}
+		var into models.PalletReceipt
+		if err := tx.NewSelect().Model(&into).Where("id = ?", row.IntoReceiptID).Limit(1).Scan(ctx); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			return split, err
+		}
+		line := snap.Line
+		if into.Qty < line.Qty || into.DamagedQty < line.DamagedQty {
+			continue
+		}
+
+		before := into
+		into.Qty -= line.Qty
+		into.DamagedQty -= line.DamagedQty
+		if snap.CommentTaken && into.Comment == line.Comment {
+			into.Comment = ""
+		}
+		into.UpdatedAt = now
+		if _, err := tx.NewUpdate().Model(&into).Column("qty", "damaged_qty", "comment", "updated_at").WherePK().Exec(ctx); err != nil {
+			return split, err
+		}
+		line.UpdatedAt = now
+		if _, err := tx.NewInsert().Model(&line).Exec(ctx); err != nil {
+			return split, err
+		}
+
+		for _, table := range combinedRowTables {
+			ids := snap.Rows[table]
+			if len(ids) == 0 {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET pallet_receipt_id = ? WHERE pallet_receipt_id = ? AND id IN (?)`,
+				line.ID, into.ID, bun.In(ids)); err != nil {
+				return split, err
+			}
+		}
+		if ids := snap.Rows["receipt_photos"]; len(ids) > 0 {
+			if _, err := tx.ExecContext(ctx, `UPDATE internal_photos SET pallet_receipt_id = ? WHERE source = ? AND photo_id IN (?)`,
+				line.ID, photovisibility.SourceGallery, bun.In(ids)); err != nil {
+				return split, err
+			}
+		}
+		if snap.GalleryPhotoID > 0 {
+			if _, err := tx.ExecContext(ctx, `
+UPDATE internal_photos SET source = ?, photo_id = ?, pallet_receipt_id = ?
+WHERE source = ? AND photo_id = ?`, photovisibility.SourcePrimary, line.ID, line.ID, photovisibility.SourceGallery, snap.GalleryPhotoID); err != nil {
+				return split, err
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM receipt_photos WHERE id = ?`, snap.GalleryPhotoID); err != nil {
+				return split, err
+			}
+		}
+		for fieldID, value := range snap.CustomValues {
+			if _, err := tx.ExecContext(ctx, `
+INSERT INTO receipt_custom_values (pallet_receipt_id, field_id, value) VALUES (?, ?, ?)
+ON CONFLICT(pallet_receipt_id, field_id) DO NOTHING`, line.ID, fieldID, value); err != nil {
+				return split, err
+			}
+		}
+		if len(snap.TakenFields) > 0 {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM receipt_custom_values WHERE pallet_receipt_id = ? AND field_id IN (?)`,
+				into.ID, bun.In(snap.TakenFields)); err != nil {
+				return split, err
+			}
+		}
+		split++
+
+		if auditSvc == nil {
+			continue
+		}
+		if err := auditSvc.Write(ctx, tx, userID, "stock.merge_undo_line", "pallet_receipts", strconv.FormatInt(line.ID, 10),
+			mergeLineSnapshot{PalletReceipt: before, MergeID: mergeID, MergedIntoReceiptID: into.ID}, line); err != nil {
+			return split, err
+		}
+	}
+	return split, nil
+}
+
+// checkPallets returns ErrMergeLocked when any of the pallets is in a
+// closed phase.
+func checkPallets(ctx context.Context, tx bun.Tx, palletIDs []int64) error {
+	for _, palletID := range palletIDs {
+		if err := phase.CheckPalletTx(ctx, tx, palletID); err != nil {
+			if errors.Is(err, phase.ErrClosed) {
+				return ErrMergeLocked
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// ListMerges returns a project's most recent stock item merges, newest
+// first.
+func ListMerges(ctx context.Context, db *sqlite.DB, projectID int64, limit int) ([]MergeRecord, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be greater than 0")
+	}
+	records := make([]MergeRecord, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT m.id, m.source_sku, m.target_sku,
+       COALESCE(u.username, '') AS merged_by,
+       strftime('%d/%m/%Y %H:%M', m.merged_at) AS merged_at,
+       COALESCE(strftime('%d/%m/%Y %H:%M', m.undone_at), '') AS undone_at,
+       (SELECT COUNT(1) FROM stock_item_merge_rows r WHERE r.merge_id = m.id AND r.source_table = 'pallet_receipts')
+         + (SELECT COUNT(1) FROM stock_item_merge_lines l WHERE l.merge_id = m.id) AS receipt_lines
+FROM stock_item_merges m
+LEFT JOIN users u ON u.id = m.merged_by_user_id
+WHERE m.project_id = ?
+ORDER BY m.id DESC
+LIMIT ?`, projectID, limit).Scan(ctx, &records)
+	})
+	return records, err
+}
@@ -0,0 +1,217 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"receipter/infrastructure/audit"
+)
+
+func TestMergeCombinesMatchingLinesAndUndoSplitsThem(t *testing.T) {
+	db := openCatalogTestDB(t)
+	ctx := context.Background()
+
+	for _, stmt := range []string{
+		`INSERT INTO stock_items (id, project_id, sku, description, uom, high_value) VALUES (10, 1, 'SKU-A', 'Widget', 'EA', 0), (11, 1, 'SKU-A ', 'Widget dup', 'EA', 1)`,
+		`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open'), (2, 1, 'open')`,
+		`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, comment, scanned_by_user_id, qty, stock_photo_blob, stock_photo_mime) VALUES
+			(1, 1, 1, 'SKU-A', 'Widget', '', 1, 2, NULL, NULL),
+			(2, 1, 1, 'SKU-A ', 'Widget dup', 'crushed', 1, 3, X'FFD8', 'image/jpeg'),
+			(3, 1, 2, 'SKU-A ', 'Widget dup', '', 1, 4, NULL, NULL)`,
+		`INSERT INTO receipt_photos (id, pallet_receipt_id, photo_blob) VALUES (1, 2, X'FFD9')`,
+		`INSERT INTO receipt_serials (project_id, pallet_receipt_id, serial) VALUES (1, 2, 'SN-1')`,
+		`INSERT INTO project_custom_fields (id, project_id, key, label) VALUES (1, 1, 'lot', 'Lot')`,
+		`INSERT INTO receipt_custom_values (pallet_receipt_id, field_id, value) VALUES (2, 1, 'L7')`,
+		`INSERT INTO stock_item_barcodes (project_id, barcode, sku, created_by_user_id) VALUES (1, '5011111111111', 'SKU-A ', 1)`,
+	} {
+		if _, err := db.W.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	if _, err := Merge(ctx, db, nil, 1, 1, 10, 10); !errors.Is(err, ErrMergeSameItem) {
+		t.Fatalf("expected ErrMergeSameItem, got %v", err)
+	}
+	result, err := Merge(ctx, db, audit.NewService(), 1, 1, 11, 10)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if result.Receipts != 2 || result.Combined != 1 || result.Barcodes != 1 || result.MergeID == 0 {
+		t.Fatalf("unexpected merge result %+v", result)
+	}
+
+	type lineState struct {
+		ID      int64  `bun:"id"`
+		SKU     string `bun:"sku"`
+		Qty     int64  `bun:"qty"`
+		Comment string `bun:"comment"`
+		Photos  int    `bun:"photos"`
+		Serials int    `bun:"serials"`
+		Values  int    `bun:"custom_values"`
+		Primary bool   `bun:"primary_photo"`
+	}
+	var lines []lineState
+	var items int64
+	var barcodeSKU string
+	var highValue bool
+	load := func() {
+		t.Helper()
+		lines = nil
+		if err := db.R.NewRaw(`
+SELECT pr.id, pr.sku, pr.qty, pr.comment,
+       (SELECT COUNT(1) FROM receipt_photos rp WHERE rp.pallet_receipt_id = pr.id) AS photos,
+       (SELECT COUNT(1) FROM receipt_serials rs WHERE rs.pallet_receipt_id = pr.id) AS serials,
+       (SELECT COUNT(1) FROM receipt_custom_values rcv WHERE rcv.pallet_receipt_id = pr.id) AS custom_values,
+       pr.stock_photo_blob IS NOT NULL AS primary_photo
+FROM pallet_receipts pr
+ORDER BY pr.id`).Scan(ctx, &lines); err != nil {
+			t.Fatalf("load lines: %v", err)
+		}
+		if err := db.R.NewRaw(`SELECT COUNT(1) FROM stock_items WHERE project_id = 1`).Scan(ctx, &items); err != nil {
+			t.Fatalf("load items: %v", err)
+		}
+		if err := db.R.NewRaw(`SELECT sku FROM stock_item_barcodes WHERE barcode = '5011111111111'`).Scan(ctx, &barcodeSKU); err != nil {
+			t.Fatalf("load barcode: %v", err)
+		}
+		if err := db.R.NewRaw(`SELECT high_value FROM stock_items WHERE id = 10`).Scan(ctx, &highValue); err != nil {
+			t.Fatalf("load target: %v", err)
+		}
+	}
+	load()
+	wantMerged := []lineState{
+		{ID: 1, SKU: "SKU-A", Qty: 5, Comment: "crushed", Photos: 2, Serials: 1, Values: 1},
+		{ID: 3, SKU: "SKU-A", Qty: 4},
+	}
+	if len(lines) != len(wantMerged) || lines[0] != wantMerged[0] || lines[1] != wantMerged[1] {
+		t.Fatalf("after merge lines = %+v, want %+v", lines, wantMerged)
+	}
+	if items != 1 || barcodeSKU != "SKU-A" || !highValue {
+		t.Fatalf("after merge: items=%d barcode=%q high=%v", items, barcodeSKU, highValue)
+	}
+
+	merges, err := ListMerges(ctx, db, 1, 10)
+	if err != nil {
+		t.Fatalf("list merges: %v", err)
+	}
+	if len(merges) != 1 || merges[0].SourceSKU != "SKU-A " || merges[0].ReceiptLines != 2 || merges[0].UndoneAt != "" {
+		t.Fatalf("unexpected merges %+v", merges)
+	}
+
+	restored, err := UndoMerge(ctx, db, audit.NewService(), 1, 1, result.MergeID)
+	if err != nil {
+		t.Fatalf("undo: %v", err)
+	}
+	if restored != 2 {
+		t.Fatalf("restored = %d, want 2", restored)
+	}
+	load()
+	wantUndone := []lineState{
+		{ID: 1, SKU: "SKU-A", Qty: 2},
+		{ID: 2, SKU: "SKU-A ", Qty: 3, Comment: "crushed", Photos: 1, Serials: 1, Values: 1, Primary: true},
+		{ID: 3, SKU: "SKU-A ", Qty: 4},
+	}
+	if len(lines) != len(wantUndone) {
+		t.Fatalf("after undo lines = %+v, want %+v", lines, wantUndone)
+	}
+	for i := range wantUndone {
+		if lines[i] != wantUndone[i] {
+			t.Fatalf("after undo line %d = %+v, want %+v", i, lines[i], wantUndone[i])
+		}
+	}
+	if items != 2 || barcodeSKU != "SKU-A " || highValue {
+		t.Fatalf("after undo: items=%d barcode=%q high=%v", items, barcodeSKU, highValue)
+	}
+	var dupHighValue bool
+	if err := db.R.NewRaw(`SELECT high_value FROM stock_items WHERE id = 11 AND sku = 'SKU-A '`).Scan(ctx, &dupHighValue); err != nil || !dupHighValue {
+		t.Fatalf("expected the duplicate restored with its id and flag, got %v %v", dupHighValue, err)
+	}
+	if _, err := UndoMerge(ctx, db, nil, 1, 1, result.MergeID); !errors.Is(err, ErrMergeUndone) {
+		t.Fatalf("expected ErrMergeUndone, got %v", err)
+	}
+
+	var audits []string
+	if err := db.R.NewRaw(`SELECT action FROM audit_logs WHERE action LIKE 'stock.merge%' ORDER BY id`).Scan(ctx, &audits); err != nil {
+		t.Fatalf("load audit: %v", err)
+	}
+	want := []string{"stock.merge_line", "stock.merge_line", "stock.merge", "stock.merge_undo_line", "stock.merge_undo_line", "stock.merge_undo"}
+	if len(audits) != len(want) {
+		t.Fatalf("audit actions = %v, want %v", audits, want)
+	}
+	for i := range want {
+		if audits[i] != want[i] {
+			t.Fatalf("audit actions = %v, want %v", audits, want)
+		}
+	}
+}
+
+func TestMergeKeepsLinesSeparateWhenProjectDoesNotMerge(t *testing.T) {
+	db := openCatalogTestDB(t)
+	ctx := context.Background()
+
+	for _, stmt := range []string{
+		`INSERT INTO project_settings (project_id, key, value) VALUES (1, 'receipt.merge_mode', 'separate')`,
+		`INSERT INTO stock_items (id, project_id, sku, description, uom) VALUES (10, 1, 'SKU-A', 'Widget', 'EA'), (11, 1, 'SKU-A ', 'Widget dup', 'EA')`,
+		`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open')`,
+		`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty) VALUES
+			(1, 1, 1, 'SKU-A', 'Widget', 1, 2), (2, 1, 1, 'SKU-A ', 'Widget dup', 1, 3)`,
+	} {
+		if _, err := db.W.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	result, err := Merge(ctx, db, nil, 1, 1, 11, 10)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if result.Receipts != 1 || result.Combined != 0 {
+		t.Fatalf("unexpected merge result %+v", result)
+	}
+	var lines int
+	if err := db.R.NewRaw(`SELECT COUNT(1) FROM pallet_receipts WHERE sku = 'SKU-A'`).Scan(ctx, &lines); err != nil || lines != 2 {
+		t.Fatalf("expected both lines kept on the target SKU, got %d %v", lines, err)
+	}
+}
+
+func TestMergeRefusesLinesOnClosedPhasePallets(t *testing.T) {
+	db := openCatalogTestDB(t)
+	ctx := context.Background()
+
+	for _, stmt := range []string{
+		`INSERT INTO stock_items (id, project_id, sku, description, uom) VALUES (10, 1, 'SKU-A', 'Widget', 'EA'), (11, 1, 'SKU-A ', 'Widget dup', 'EA')`,
+		`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'closed'), (2, 1, 'open')`,
+		`INSERT INTO project_phases (id, project_id, name, status, created_by_user_id) VALUES (1, 1, 'Wave 1', 'open', 1)`,
+		`INSERT INTO pallet_phases (pallet_id, phase_id) VALUES (1, 1)`,
+		`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty) VALUES
+			(1, 1, 1, 'SKU-A ', 'Widget dup', 1, 2), (2, 1, 2, 'SKU-A ', 'Widget dup', 1, 3)`,
+	} {
+		if _, err := db.W.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	result, err := Merge(ctx, db, nil, 1, 1, 11, 10)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if _, err := db.W.ExecContext(ctx, `UPDATE project_phases SET status = 'closed' WHERE id = 1`); err != nil {
+		t.Fatalf("close phase: %v", err)
+	}
+	if _, err := UndoMerge(ctx, db, nil, 1, 1, result.MergeID); !errors.Is(err, ErrMergeLocked) {
+		t.Fatalf("expected undo refused once the phase closed, got %v", err)
+	}
+
+	if _, err := db.W.ExecContext(ctx, `
+INSERT INTO stock_items (id, project_id, sku, description, uom) VALUES (12, 1, 'SKU-B', 'Gadget', 'EA'), (13, 1, 'SKU-B ', 'Gadget dup', 'EA');
+INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty) VALUES (3, 1, 1, 'SKU-B ', 'Gadget dup', 1, 1);`); err != nil {
+		t.Fatalf("seed second duplicate: %v", err)
+	}
+	if _, err := Merge(ctx, db, nil, 1, 1, 13, 12); !errors.Is(err, ErrMergeLocked) {
+		t.Fatalf("expected merge refused, got %v", err)
+	}
+	var items int
+	if err := db.R.NewRaw(`SELECT COUNT(1) FROM stock_items WHERE id = 13`).Scan(ctx, &items); err != nil || items != 1 {
+		t.Fatalf("expected the duplicate kept, got %d %v", items, err)
+	}
+}
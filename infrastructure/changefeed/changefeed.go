@@ -0,0 +1,221 @@
+// Package changefeed reads the audit log as an ordered stream of changes to
+// projects, pallets, receipt lines and stock items, for pipelines that
+// replicate them elsewhere. A consumer keeps the cursor of the last page and
+// asks for what came after it.
+//
+// Audit entries are written inside the transaction that makes the change and
+// SQLite runs one writer at a time, so ids become visible in order: once a
+// consumer has read past an id, no lower id can appear later.
+package changefeed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+
+	// scanWindow bounds how many audit entries one page looks through, so a
+	// narrow filter over a long log returns promptly; the cursor still moves
+	// past the entries it skipped.
+	scanWindow = 5000
+)
+
+// EntityTypes are the audited tables the feed carries. Other audit entries,
+// such as user and token administration, stay out of it.
+var EntityTypes = []string{"projects", "pallets", "pallet_receipts", "stock_items"}
+
+var (
+	ErrInvalidLimit      = errors.New("limit must be between 1 and 1000")
+	ErrUnknownEntityType = errors.New("entity must be one of projects, pallets, pallet_receipts, stock_items")
+)
+
+// Query selects a page of the feed.
+type Query struct {
+	// After is the cursor: only events with a greater id are returned.
+	After int64
+	Limit int
+	// EntityTypes narrows the feed; empty means all of EntityTypes.
+	EntityTypes []string
+	// ProjectIDs narrows the feed to events of these projects. Restricted
+	// says the list is a hard limit, as for a client user, so an empty list
+	// matches nothing rather than everything.
+	ProjectIDs []int64
+	Restricted bool
+}
+
+// Event is one audited change. ProjectID is nil for the few changes that
+// cannot be tied to a project, such as a stock item deleted without a
+// project in its audit snapshot.
+type Event struct {
+	ID         int64           `json:"id"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entityType"`
+	EntityID   string          `json:"entityId"`
+	ProjectID  *int64          `json:"projectId"`
+	Actor      string          `json:"actor"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+}
+
+// Page is one read of the feed. NextCursor is what to pass as After next
+// time; it can move forward even when Events is empty. HasMore says the next
+// page can be read straight away.
+type Page struct {
+	Events     []Event `json:"events"`
+	NextCursor int64   `json:"nextCursor"`
+	HasMore    bool    `json:"hasMore"`
+}
+
+// ParseEntityTypes reads a comma-separated entity filter.
+func ParseEntityTypes(raw string) ([]string, error) {
+	types := make([]string, 0)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !slices.Contains(EntityTypes, part) {
+			return nil, ErrUnknownEntityType
+		}
+		if !slices.Contains(types, part) {
+			types = append(types, part)
+		}
+	}
+	return types, nil
+}
+
+// projectExpr attributes an audit entry to a project: a project's own id,
+// then the project named in the change's snapshots, then the row it changed
+// if that still exists.
+const projectExpr = `COALESCE(
+	CASE WHEN al.entity_type = 'projects' THEN CAST(al.entity_id AS INTEGER) END,
+	CASE WHEN json_valid(al.after_json) THEN COALESCE(json_extract(al.after_json, '$.ProjectID'), json_extract(al.after_json, '$.project_id')) END,
+	CASE WHEN json_valid(al.before_json) THEN COALESCE(json_extract(al.before_json, '$.ProjectID'), json_extract(al.before_json, '$.project_id')) END,
+	CASE al.entity_type
+		WHEN 'pallets' THEN (SELECT p.project_id FROM pallets p WHERE p.id = CAST(al.entity_id AS INTEGER))
+		WHEN 'pallet_receipts' THEN (SELECT pr.project_id FROM pallet_receipts pr WHERE pr.id = CAST(al.entity_id AS INTEGER))
+		WHEN 'stock_items' THEN (SELECT si.project_id FROM stock_items si WHERE si.id = CAST(al.entity_id AS INTEGER))
+	END)`
+
+// snapshotExpr returns a snapshot column as JSON, without the receipt photo
+// blob that would otherwise dominate every receipt change.
+func snapshotExpr(column string) string {
+	return `CASE WHEN json_valid(al.` + column + `) THEN json_remove(al.` + column + `, '$.StockPhotoBlob') END`
+}
+
+type eventRow struct {
+	ID         int64     `bun:"id"`
+	CreatedAt  time.Time `bun:"created_at"`
+	Action     string    `bun:"action"`
+	EntityType string    `bun:"entity_type"`
+	EntityID   string    `bun:"entity_id"`
+	ProjectID  *int64    `bun:"project_id"`
+	Actor      string    `bun:"actor"`
+	BeforeJSON *string   `bun:"before_json"`
+	AfterJSON  *string   `bun:"after_json"`
+}
+
+// Read returns the events after q.After that match q, oldest first.
+func Read(ctx context.Context, db *sqlite.DB, q Query) (Page, error) {
+	page := Page{Events: make([]Event, 0), NextCursor: max(q.After, 0)}
+	if q.Limit == 0 {
+		q.Limit = DefaultLimit
+	}
+	if q.Limit < 1 || q.Limit > MaxLimit {
+		return page, ErrInvalidLimit
+	}
+	entityTypes := q.EntityTypes
+	if len(entityTypes) == 0 {
+		entityTypes = EntityTypes
+	}
+	for _, entityType := range entityTypes {
+		if !slices.Contains(EntityTypes, entityType) {
+			return page, ErrUnknownEntityType
+		}
+	}
+	if q.Restricted && len(q.ProjectIDs) == 0 {
+		return page, nil
+	}
+
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var window struct {
+			Scanned int64  `bun:"scanned"`
+			LastID  *int64 `bun:"last_id"`
+		}
+		if err := tx.NewRaw(`
+SELECT COUNT(1) AS scanned, MAX(id) AS last_id
+FROM (SELECT id FROM audit_logs WHERE id > ? ORDER BY id LIMIT ?)`, page.NextCursor, scanWindow).Scan(ctx, &window); err != nil {
+			return err
+		}
+		if window.LastID == nil {
+			return nil
+		}
+
+		where := `al.id > ? AND al.id <= ? AND al.entity_type IN (?)`
+		args := []any{page.NextCursor, *window.LastID, bun.In(entityTypes)}
+		if len(q.ProjectIDs) > 0 {
+			where += ` AND ` + projectExpr + ` IN (?)`
+			args = append(args, bun.In(q.ProjectIDs))
+		}
+		args = append(args, q.Limit)
+		rows := make([]eventRow, 0)
+		if err := tx.NewRaw(`
+SELECT al.id, al.created_at, al.action, al.entity_type, al.entity_id,
+       `+projectExpr+` AS project_id,
+       COALESCE(u.username, '') AS actor,
+       `+snapshotExpr("before_json")+` AS before_json,
+       `+snapshotExpr("after_json")+` AS after_json
+FROM audit_logs al
+LEFT JOIN users u ON u.id = al.user_id
+WHERE `+where+`
+ORDER BY al.id ASC
+LIMIT ?`, args...).Scan(ctx, &rows); err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			page.Events = append(page.Events, Event{
+				ID:         row.ID,
+				CreatedAt:  row.CreatedAt.UTC(),
+				Action:     row.Action,
+				EntityType: row.EntityType,
+				EntityID:   row.EntityID,
+				ProjectID:  row.ProjectID,
+				Actor:      row.Actor,
+				Before:     rawSnapshot(row.BeforeJSON),
+				After:      rawSnapshot(row.AfterJSON),
+			})
+		}
+		if len(rows) == q.Limit {
+			page.NextCursor = rows[len(rows)-1].ID
+			page.HasMore = true
+			return nil
+		}
+		page.NextCursor = *window.LastID
+		page.HasMore = window.Scanned == scanWindow
+		return nil
+	})
+	if err != nil {
+		return Page{Events: make([]Event, 0), NextCursor: max(q.After, 0)}, err
+	}
+	return page, nil
+}
+
+func rawSnapshot(v *string) json.RawMessage {
+	if v == nil || strings.TrimSpace(*v) == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(*v)
+}
@@ -0,0 +1,178 @@
+package changefeed
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func openChangefeedTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "changefeed-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	return db
+}
+
+func execAll(t *testing.T, db *sqlite.DB, stmts ...string) {
+	t.Helper()
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+}
+
+func seedChangefeed(t *testing.T, db *sqlite.DB) {
+	t.Helper()
+	execAll(t, db,
+		`INSERT INTO users (id, username, password_hash, role) VALUES (501, 'feed-admin', 'x', 'admin')`,
+		`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+			(501, 'Feed A', 'A', DATE('now'), 'Client', 'feed-a', 'active'),
+			(502, 'Feed B', 'B', DATE('now'), 'Client', 'feed-b', 'active')`,
+		`INSERT INTO pallets (id, project_id, status) VALUES (9501, 501, 'open'), (9502, 502, 'open')`,
+		`INSERT INTO audit_logs (id, user_id, action, entity_type, entity_id, before_json, after_json) VALUES
+			(10001, 501, 'project.create', 'projects', '501', '', '{"ID":501}'),
+			(10002, 501, 'pallet.create', 'pallets', '9501', '', '{"ID":9501}'),
+			(10003, 501, 'receipt.create', 'pallet_receipts', '77', '', '{"ID":77,"ProjectID":502,"Qty":3,"StockPhotoBlob":"aGVsbG8="}'),
+			(10004, 501, 'user.create', 'users', '9', '', '{"ID":9}'),
+			(10005, 501, 'stock.delete', 'stock_items', '40', '{"project_id":501,"sku":"A"}', ''),
+			(10006, 501, 'pallet.close', 'pallets', '9502', '{"Status":"open"}', '{"Status":"closed"}')`,
+	)
+}
+
+func eventIDs(page Page) []int64 {
+	ids := make([]int64, 0, len(page.Events))
+	for _, event := range page.Events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func TestRead_PagesInIDOrderWithCursor(t *testing.T) {
+	db := openChangefeedTestDB(t)
+	seedChangefeed(t, db)
+	ctx := context.Background()
+
+	after := int64(10000)
+	seen := make([]int64, 0)
+	for range 5 {
+		page, err := Read(ctx, db, Query{After: after, Limit: 2})
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		seen = append(seen, eventIDs(page)...)
+		after = page.NextCursor
+		if !page.HasMore {
+			break
+		}
+	}
+	want := []int64{10001, 10002, 10003, 10005, 10006}
+	if len(seen) != len(want) {
+		t.Fatalf("expected events %v, got %v", want, seen)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Fatalf("expected events %v, got %v", want, seen)
+		}
+	}
+	if after != 10006 {
+		t.Fatalf("expected cursor at the last event, got %d", after)
+	}
+
+	page, err := Read(ctx, db, Query{After: after})
+	if err != nil {
+		t.Fatalf("read past end: %v", err)
+	}
+	if len(page.Events) != 0 || page.HasMore || page.NextCursor != after {
+		t.Fatalf("expected an empty page holding the cursor, got %+v", page)
+	}
+}
+
+func TestRead_FiltersByEntityAndProject(t *testing.T) {
+	db := openChangefeedTestDB(t)
+	seedChangefeed(t, db)
+	ctx := context.Background()
+
+	page, err := Read(ctx, db, Query{After: 10000, ProjectIDs: []int64{501}})
+	if err != nil {
+		t.Fatalf("read project 501: %v", err)
+	}
+	if ids := eventIDs(page); len(ids) != 3 || ids[0] != 10001 || ids[1] != 10002 || ids[2] != 10005 {
+		t.Fatalf("expected project 501 events 10001, 10002, 10005, got %v", ids)
+	}
+	if page.NextCursor != 10006 {
+		t.Fatalf("expected the cursor past skipped events, got %d", page.NextCursor)
+	}
+
+	page, err = Read(ctx, db, Query{After: 10000, EntityTypes: []string{"pallets"}, ProjectIDs: []int64{502}})
+	if err != nil {
+		t.Fatalf("read pallets of 502: %v", err)
+	}
+	if ids := eventIDs(page); len(ids) != 1 || ids[0] != 10006 || *page.Events[0].ProjectID != 502 {
+		t.Fatalf("expected pallet close of project 502, got %+v", page.Events)
+	}
+
+	page, err = Read(ctx, db, Query{After: 10000, Restricted: true})
+	if err != nil {
+		t.Fatalf("read restricted: %v", err)
+	}
+	if len(page.Events) != 0 {
+		t.Fatalf("expected no events without assigned projects, got %v", eventIDs(page))
+	}
+
+	if _, err := Read(ctx, db, Query{EntityTypes: []string{"users"}}); !errors.Is(err, ErrUnknownEntityType) {
+		t.Fatalf("expected unknown entity error, got %v", err)
+	}
+	if _, err := ParseEntityTypes("pallets, users"); !errors.Is(err, ErrUnknownEntityType) {
+		t.Fatalf("expected unknown entity error from parse, got %v", err)
+	}
+}
+
+func TestRead_StripsPhotoBlobFromSnapshots(t *testing.T) {
+	db := openChangefeedTestDB(t)
+	seedChangefeed(t, db)
+
+	page, err := Read(context.Background(), db, Query{After: 10002, Limit: 1})
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(page.Events) != 1 {
+		t.Fatalf("expected one event, got %d", len(page.Events))
+	}
+	event := page.Events[0]
+	if event.Actor != "feed-admin" || event.EntityType != "pallet_receipts" || *event.ProjectID != 502 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if strings.Contains(string(event.After), "StockPhotoBlob") || !strings.Contains(string(event.After), `"Qty":3`) {
+		t.Fatalf("expected after snapshot without the photo blob, got %s", event.After)
+	}
+	if string(event.Before) != "null" {
+		t.Fatalf("expected null before snapshot, got %s", event.Before)
+	}
+}
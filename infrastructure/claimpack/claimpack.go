@@ -0,0 +1,350 @@
+// Package claimpack renders the pack a claims team sends to the insurer for
+// damaged goods: a PDF with a cover sheet, the line-level damage table, the
+// photos and an excerpt of the audit trail, zipped with the original photo
+// files.
+package claimpack
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"receipter/infrastructure/pdftext"
+)
+
+// Pack is everything printed in one claim pack.
+type Pack struct {
+	ClaimID           int64
+	ClaimReference    string
+	ProjectName       string
+	ClientName        string
+	DeliveryReference string
+	RaisedBy          string
+	RaisedAt          time.Time
+	GeneratedAt       time.Time
+	Lines             []Line
+	Photos            []Photo
+	Audit             []AuditEntry
+}
+
+// Line is one damaged receipt line in the claim.
+type Line struct {
+	ReceiptID    int64
+	PalletID     int64
+	SKU          string
+	Description  string
+	BatchNumber  string
+	Expiry       string
+	DamagedQty   int64
+	DamageReason string
+	ScannedBy    string
+	ScannedAt    string
+}
+
+// Photo is a photo of a claimed line. PhotoID is zero for the line's
+// primary stock photo.
+type Photo struct {
+	ReceiptID int64
+	PhotoID   int64
+	MIME      string
+	Blob      []byte
+}
+
+// AuditEntry is one audit log row about the claim or its lines.
+type AuditEntry struct {
+	At      string
+	User    string
+	Action  string
+	Entity  string
+	Details string
+}
+
+// Number is a claim's register number, printed on every page of its pack.
+func Number(claimID int64) string {
+	return fmt.Sprintf("CLM-%06d", claimID)
+}
+
+func (p Pack) Number() string {
+	return Number(p.ClaimID)
+}
+
+// DamagedQty sums the damaged units across the claimed lines.
+func (p Pack) DamagedQty() int64 {
+	var total int64
+	for _, line := range p.Lines {
+		total += line.DamagedQty
+	}
+	return total
+}
+
+// FileName is the name the ZIP is downloaded as.
+func (p Pack) FileName() string {
+	return strings.ToLower(p.Number()) + "-pack.zip"
+}
+
+// PhotoName is the path of a photo inside the ZIP.
+func (ph Photo) PhotoName() string {
+	if ph.PhotoID == 0 {
+		return fmt.Sprintf("photos/line-%d-primary%s", ph.ReceiptID, photoExtension(ph.MIME))
+	}
+	return fmt.Sprintf("photos/line-%d-photo-%d%s", ph.ReceiptID, ph.PhotoID, photoExtension(ph.MIME))
+}
+
+// WriteZIP writes the pack as a ZIP holding the claim PDF and every photo under
+// photos/, including formats the PDF cannot embed.
+func WriteZIP(w io.Writer, p Pack) error {
+	pdfBytes, err := RenderPDF(p)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(w)
+	f, err := zw.Create(strings.ToLower(p.Number()) + ".pdf")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(pdfBytes); err != nil {
+		return err
+	}
+	for _, ph := range p.Photos {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: ph.PhotoName(), Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(ph.Blob); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// RenderPDF renders the combined claim document.
+func RenderPDF(p Pack) ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle("Damage Claim "+p.Number(), false)
+	pdf.SetMargins(12, 12, 12)
+	pdf.SetAutoPageBreak(true, 14)
+	tr := pdftext.Translator(pdf)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-10)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.CellFormat(0, 4, fmt.Sprintf("%s - page %d", p.Number(), pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+
+	writeCover(pdf, tr, p)
+	writeLines(pdf, tr, p)
+	writePhotos(pdf, p)
+	writeAudit(pdf, tr, p)
+
+	var out bytes.Buffer
+	if err := pdf.Output(&out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func writeCover(pdf *gofpdf.Fpdf, tr func(string) string, p Pack) {
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "B", 22)
+	pdf.CellFormat(0, 12, "Damaged Goods Claim", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(0, 9, p.Number(), "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	delivery := p.DeliveryReference
+	if delivery == "" {
+		delivery = "All deliveries"
+	}
+	rows := [][2]string{
+		{"Client", pdftext.OrDash(p.ClientName)},
+		{"Project", pdftext.OrDash(p.ProjectName)},
+		{"Delivery", delivery},
+		{"Claim reference", pdftext.OrDash(p.ClaimReference)},
+		{"Raised by", pdftext.OrDash(p.RaisedBy)},
+		{"Raised at", pdftext.FormatTime(p.RaisedAt)},
+		{"Generated at", pdftext.FormatTime(p.GeneratedAt)},
+		{"Lines", strconv.Itoa(len(p.Lines))},
+		{"Damaged units", strconv.FormatInt(p.DamagedQty(), 10)},
+		{"Photos", strconv.Itoa(len(p.Photos))},
+	}
+	for _, row := range rows {
+		pdf.SetFont("Helvetica", "B", 11)
+		pdf.CellFormat(45, 8, row[0], "1", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 11)
+		pdf.CellFormat(0, 8, tr(row[1]), "1", 1, "L", false, 0, "")
+	}
+	pdf.Ln(6)
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.MultiCell(0, 5, "Quantities are the damaged units recorded at goods-in. Photos that cannot be embedded in this document are included as files in the accompanying archive.", "", "L", false)
+}
+
+var lineColumns = []struct {
+	title string
+	width float64
+}{
+	{"Line", 14}, {"Pallet", 20}, {"SKU", 28}, {"Description", 44}, {"Batch", 20}, {"Expiry", 18}, {"Qty", 12}, {"Reason", 30},
+}
+
+func writeLines(pdf *gofpdf.Fpdf, tr func(string) string, p Pack) {
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.CellFormat(0, 9, "Damaged Lines", "", 1, "L", false, 0, "")
+	header := func() {
+		pdf.SetFont("Helvetica", "B", 8)
+		for _, col := range lineColumns {
+			pdf.CellFormat(col.width, 6, col.title, "1", 0, "L", false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	header()
+	pdf.SetFont("Helvetica", "", 8)
+	_, pageH := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	for _, line := range p.Lines {
+		if pdf.GetY()+6 > pageH-bottom-4 {
+			pdf.AddPage()
+			header()
+			pdf.SetFont("Helvetica", "", 8)
+		}
+		cells := []string{
+			strconv.FormatInt(line.ReceiptID, 10),
+			fmt.Sprintf("P%08d", line.PalletID),
+			line.SKU,
+			line.Description,
+			line.BatchNumber,
+			line.Expiry,
+			strconv.FormatInt(line.DamagedQty, 10),
+			line.DamageReason,
+		}
+		for i, col := range lineColumns {
+			pdf.CellFormat(col.width, 6, pdftext.Fit(pdf, tr(cells[i]), col.width-2), "1", 0, "L", false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	pdf.SetFont("Helvetica", "B", 8)
+	pdf.CellFormat(lineColumns[0].width+lineColumns[1].width+lineColumns[2].width+lineColumns[3].width+lineColumns[4].width+lineColumns[5].width, 6, "Total", "1", 0, "R", false, 0, "")
+	pdf.CellFormat(lineColumns[6].width, 6, strconv.FormatInt(p.DamagedQty(), 10), "1", 0, "L", false, 0, "")
+	pdf.CellFormat(lineColumns[7].width, 6, "", "1", 1, "L", false, 0, "")
+}
+
+// Photos are laid out two to a row, each scaled into a photoBoxW by photoBoxH
+// box.
+const (
+	photoBoxW = 88.0
+	photoBoxH = 70.0
+)
+
+func writePhotos(pdf *gofpdf.Fpdf, p Pack) {
+	if len(p.Photos) == 0 {
+		return
+	}
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.CellFormat(0, 9, "Photos", "", 1, "L", false, 0, "")
+	left, _, _, _ := pdf.GetMargins()
+	_, pageH := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+
+	col := 0
+	rowY := pdf.GetY()
+	for _, ph := range p.Photos {
+		imageType, ok := pdfImageType(ph.MIME)
+		if !ok {
+			continue
+		}
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(ph.Blob))
+		if err != nil || cfg.Width == 0 || cfg.Height == 0 {
+			continue
+		}
+		if col == 0 && rowY+photoBoxH+6 > pageH-bottom {
+			pdf.AddPage()
+			rowY = pdf.GetY()
+		}
+		scale := min(photoBoxW/float64(cfg.Width), photoBoxH/float64(cfg.Height))
+		w, h := float64(cfg.Width)*scale, float64(cfg.Height)*scale
+		x := left + float64(col)*(photoBoxW+6)
+
+		opt := gofpdf.ImageOptions{ImageType: imageType}
+		name := ph.PhotoName()
+		pdf.RegisterImageOptionsReader(name, opt, bytes.NewReader(ph.Blob))
+		if pdf.Err() {
+			// An image gofpdf cannot read is still in the archive.
+			pdf.ClearError()
+			continue
+		}
+		pdf.ImageOptions(name, x, rowY, w, h, false, opt, 0, "")
+		pdf.SetXY(x, rowY+photoBoxH)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.CellFormat(photoBoxW, 5, strings.TrimPrefix(name, "photos/"), "", 0, "L", false, 0, "")
+
+		col++
+		if col == 2 {
+			col = 0
+			rowY += photoBoxH + 8
+		}
+	}
+}
+
+func writeAudit(pdf *gofpdf.Fpdf, tr func(string) string, p Pack) {
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.CellFormat(0, 9, "Audit Trail", "", 1, "L", false, 0, "")
+	if len(p.Audit) == 0 {
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(0, 6, "No audit entries recorded.", "", 1, "L", false, 0, "")
+		return
+	}
+	widths := []float64{30, 24, 34, 30, 68}
+	titles := []string{"When", "User", "Action", "Record", "Details"}
+	pdf.SetFont("Helvetica", "B", 8)
+	for i, title := range titles {
+		pdf.CellFormat(widths[i], 6, title, "1", 0, "L", false, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont("Helvetica", "", 8)
+	for _, e := range p.Audit {
+		cells := []string{e.At, e.User, e.Action, e.Entity, e.Details}
+		for i := range cells {
+			pdf.CellFormat(widths[i], 6, pdftext.Fit(pdf, tr(cells[i]), widths[i]-2), "1", 0, "L", false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+}
+
+func pdfImageType(mimeType string) (string, bool) {
+	switch mimeType {
+	case "image/jpeg":
+		return "JPG", true
+	case "image/png":
+		return "PNG", true
+	case "image/gif":
+		return "GIF", true
+	}
+	return "", false
+}
+
+func photoExtension(mimeType string) string {
+	switch mimeType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	case "image/heic":
+		return ".heic"
+	default:
+		return ".bin"
+	}
+}
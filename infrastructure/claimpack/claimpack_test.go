@@ -0,0 +1,53 @@
+package claimpack
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderPDF_EmbedsPhotosAndSkipsUnreadableOnes(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	img.Set(1, 1, color.RGBA{R: 255, A: 255})
+	var photo bytes.Buffer
+	if err := png.Encode(&photo, img); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+
+	lines := make([]Line, 0, 80)
+	for i := range 80 {
+		lines = append(lines, Line{ReceiptID: int64(i + 1), PalletID: 7, SKU: "SKU-1", Description: "Crème brûlée, a description far too long for its column", DamagedQty: 2})
+	}
+	pack := Pack{
+		ClaimID:     12,
+		ClientName:  "Société Générale",
+		ProjectName: "Inbound",
+		RaisedAt:    time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC),
+		Lines:       lines,
+		Photos: []Photo{
+			{ReceiptID: 1, PhotoID: 0, MIME: "image/png", Blob: photo.Bytes()},
+			{ReceiptID: 1, PhotoID: 3, MIME: "image/jpeg", Blob: []byte("not a jpeg")},
+			{ReceiptID: 2, PhotoID: 4, MIME: "image/heic", Blob: []byte("heic")},
+		},
+		Audit: []AuditEntry{{At: "01/06/2026 09:00", User: "admin", Action: "damage_claim.create", Entity: "CLM-000012"}},
+	}
+	if pack.DamagedQty() != 160 || pack.FileName() != "clm-000012-pack.zip" {
+		t.Fatalf("qty = %d, file = %q", pack.DamagedQty(), pack.FileName())
+	}
+
+	out, err := RenderPDF(pack)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if !bytes.HasPrefix(out, []byte("%PDF-")) {
+		t.Fatalf("expected a PDF")
+	}
+	// Cover, two pages of lines, photos and audit trail.
+	if pages := strings.Count(string(out), "/Type /Page\n"); pages != 5 {
+		t.Fatalf("pages = %d, want 5", pages)
+	}
+}
@@ -0,0 +1,311 @@
+// Package clientwebhook manages per-project webhooks that tell a client's own
+// systems about pallet status changes. Deliveries go through the delivery
+// queue, signed with the webhook's secret, and carry a client-facing payload
+// without user names, internal IDs other than the pallet, or audit data.
+package clientwebhook
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/delivery"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+const (
+	EventPalletClosed    = "pallet.closed"
+	EventPalletReopened  = "pallet.reopened"
+	EventPalletLabelled  = "pallet.labelled"
+	EventPalletCancelled = "pallet.cancelled"
+
+	secretPrefix = "whsec_"
+
+	// deliveryLogLimit caps the per-project delivery log.
+	deliveryLogLimit = 100
+)
+
+// Events lists every event a webhook can subscribe to, in display order.
+var Events = []string{EventPalletClosed, EventPalletReopened, EventPalletLabelled, EventPalletCancelled}
+
+var (
+	ErrInvalidURL = errors.New("webhook URL must be an absolute http or https URL")
+	ErrNoEvents   = errors.New("select at least one event")
+	ErrNotFound   = errors.New("webhook not found")
+)
+
+// DeliveryView is one row of a project's webhook delivery log.
+type DeliveryView struct {
+	ID          int64  `bun:"id"`
+	Endpoint    string `bun:"endpoint"`
+	Event       string `bun:"event"`
+	Status      string `bun:"status"`
+	Attempts    int    `bun:"attempts"`
+	MaxAttempts int    `bun:"max_attempts"`
+	LastError   string `bun:"last_error"`
+	CreatedAt   string `bun:"created_at"`
+	DeliveredAt string `bun:"delivered_at"`
+}
+
+// Payload is the JSON body sent to client webhooks.
+type Payload struct {
+	Event      string         `json:"event"`
+	OccurredAt time.Time      `json:"occurred_at"`
+	Project    PayloadProject `json:"project"`
+	Pallet     PayloadPallet  `json:"pallet"`
+}
+
+type PayloadProject struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+type PayloadPallet struct {
+	ID        int64      `json:"id"`
+	Number    string     `json:"number"`
+	Status    string     `json:"status"`
+	ClosedAt  *time.Time `json:"closed_at,omitempty"`
+	LineCount int64      `json:"line_count"`
+	TotalQty  int64      `json:"total_qty"`
+}
+
+// Subscribed reports whether the webhook's event list includes event.
+func Subscribed(hook models.ProjectWebhook, event string) bool {
+	for _, e := range strings.Split(hook.Events, ",") {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeEvents keeps the known events from selected, in Events order, as
+// the comma-separated list stored on the webhook.
+func NormalizeEvents(selected []string) (string, error) {
+	chosen := make(map[string]bool, len(selected))
+	for _, e := range selected {
+		chosen[strings.TrimSpace(e)] = true
+	}
+	out := make([]string, 0, len(Events))
+	for _, e := range Events {
+		if chosen[e] {
+			out = append(out, e)
+		}
+	}
+	if len(out) == 0 {
+		return "", ErrNoEvents
+	}
+	return strings.Join(out, ","), nil
+}
+
+func normalizeURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", ErrInvalidURL
+	}
+	return raw, nil
+}
+
+func newSecret() string {
+	buf := make([]byte, 24)
+	_, _ = rand.Read(buf)
+	return secretPrefix + hex.EncodeToString(buf)
+}
+
+func List(ctx context.Context, db *sqlite.DB, projectID int64) ([]models.ProjectWebhook, error) {
+	hooks := make([]models.ProjectWebhook, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewSelect().Model(&hooks).Where("project_id = ?", projectID).Order("id ASC").Scan(ctx)
+	})
+	return hooks, err
+}
+
+// Create adds a webhook and returns it with its generated secret.
+func Create(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID, projectID int64, rawURL string, events []string) (models.ProjectWebhook, error) {
+	var hook models.ProjectWebhook
+	endpoint, err := normalizeURL(rawURL)
+	if err != nil {
+		return hook, err
+	}
+	eventList, err := NormalizeEvents(events)
+	if err != nil {
+		return hook, err
+	}
+	err = db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		now := time.Now()
+		hook = models.ProjectWebhook{
+			ProjectID:       projectID,
+			URL:             endpoint,
+			Secret:          fieldcrypt.String(newSecret()),
+			Events:          eventList,
+			Active:          true,
+			CreatedByUserID: actorUserID,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		}
+		if _, err := tx.NewInsert().Model(&hook).Exec(ctx); err != nil {
+			return err
+		}
+		return auditSvc.Write(ctx, tx, actorUserID, "project_webhook.create", "project_webhooks", strconv.FormatInt(hook.ID, 10), nil, auditState(hook))
+	})
+	return hook, err
+}
+
+// Update changes a webhook's URL, events and active flag; the secret is kept.
+func Update(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID, projectID, webhookID int64, rawURL string, events []string, active bool) error {
+	endpoint, err := normalizeURL(rawURL)
+	if err != nil {
+		return err
+	}
+	eventList, err := NormalizeEvents(events)
+	if err != nil {
+		return err
+	}
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		before, err := loadForProject(ctx, tx, projectID, webhookID)
+		if err != nil {
+			return err
+		}
+		after := before
+		after.URL, after.Events, after.Active, after.UpdatedAt = endpoint, eventList, active, time.Now()
+		if _, err := tx.NewUpdate().Model(&after).Column("url", "events", "active", "updated_at").WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		return auditSvc.Write(ctx, tx, actorUserID, "project_webhook.update", "project_webhooks", strconv.FormatInt(webhookID, 10), auditState(before), auditState(after))
+	})
+}
+
+// RotateSecret replaces the webhook's secret and returns the new one.
+// Deliveries already queued keep the signature made with the old secret.
+func RotateSecret(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID, projectID, webhookID int64) (string, error) {
+	secret := newSecret()
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		hook, err := loadForProject(ctx, tx, projectID, webhookID)
+		if err != nil {
+			return err
+		}
+		hook.Secret, hook.UpdatedAt = fieldcrypt.String(secret), time.Now()
+		if _, err := tx.NewUpdate().Model(&hook).Column("secret", "updated_at").WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		return auditSvc.Write(ctx, tx, actorUserID, "project_webhook.rotate_secret", "project_webhooks", strconv.FormatInt(webhookID, 10), nil, map[string]any{"project_id": projectID})
+	})
+	if err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// Delete removes a webhook. Its past deliveries stay in the project's log.
+func Delete(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID, projectID, webhookID int64) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		before, err := loadForProject(ctx, tx, projectID, webhookID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.NewDelete().Model((*models.ProjectWebhook)(nil)).Where("id = ?", webhookID).Exec(ctx); err != nil {
+			return err
+		}
+		return auditSvc.Write(ctx, tx, actorUserID, "project_webhook.delete", "project_webhooks", strconv.FormatInt(webhookID, 10), auditState(before), nil)
+	})
+}
+
+// ListDeliveries returns the project's most recent webhook deliveries.
+func ListDeliveries(ctx context.Context, db *sqlite.DB, projectID int64) ([]DeliveryView, error) {
+	rows := make([]DeliveryView, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT id, endpoint, event, status, attempts, max_attempts, last_error,
+       CAST(created_at AS TEXT) AS created_at,
+       COALESCE(CAST(delivered_at AS TEXT), '') AS delivered_at
+FROM deliveries
+WHERE project_id = ?
+ORDER BY id DESC
+LIMIT ?`, projectID, deliveryLogLimit).Scan(ctx, &rows)
+	})
+	return rows, err
+}
+
+// EnqueuePalletEvent queues event for every active webhook on the pallet's
+// project that subscribes to it, inside the transaction that changed the
+// pallet. Callers Notify the delivery worker after committing.
+func EnqueuePalletEvent(ctx context.Context, tx bun.Tx, palletID int64, event string) error {
+	var pallet models.Pallet
+	if err := tx.NewSelect().Model(&pallet).Where("id = ?", palletID).Limit(1).Scan(ctx); err != nil {
+		return err
+	}
+	hooks := make([]models.ProjectWebhook, 0)
+	if err := tx.NewSelect().Model(&hooks).Where("project_id = ?", pallet.ProjectID).Where("active = 1").Order("id ASC").Scan(ctx); err != nil {
+		return err
+	}
+	subscribed := hooks[:0]
+	for _, hook := range hooks {
+		if Subscribed(hook, event) {
+			subscribed = append(subscribed, hook)
+		}
+	}
+	if len(subscribed) == 0 {
+		return nil
+	}
+
+	payload := Payload{
+		Event:      event,
+		OccurredAt: time.Now().UTC(),
+		Pallet: PayloadPallet{
+			ID:       pallet.ID,
+			Number:   fmt.Sprintf("P%08d", pallet.ID),
+			Status:   pallet.Status,
+			ClosedAt: pallet.ClosedAt,
+		},
+	}
+	if err := tx.NewRaw(`SELECT code, name FROM projects WHERE id = ?`, pallet.ProjectID).Scan(ctx, &payload.Project.Code, &payload.Project.Name); err != nil {
+		return err
+	}
+	if err := tx.NewRaw(`SELECT COUNT(1), COALESCE(SUM(qty), 0) FROM pallet_receipts WHERE pallet_id = ?`, pallet.ID).Scan(ctx, &payload.Pallet.LineCount, &payload.Pallet.TotalQty); err != nil {
+		return err
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	for _, hook := range subscribed {
+		target := delivery.ProjectWebhook{ProjectID: hook.ProjectID, WebhookID: hook.ID, Secret: string(hook.Secret)}
+		if _, err := delivery.EnqueueProjectWebhook(ctx, tx, target, hook.URL, event, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadForProject(ctx context.Context, tx bun.Tx, projectID, webhookID int64) (models.ProjectWebhook, error) {
+	var hook models.ProjectWebhook
+	err := tx.NewSelect().Model(&hook).Where("id = ?", webhookID).Where("project_id = ?", projectID).Limit(1).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return hook, ErrNotFound
+	}
+	return hook, err
+}
+
+// auditState leaves the secret out of audit logs.
+func auditState(hook models.ProjectWebhook) map[string]any {
+	return map[string]any{
+		"project_id": hook.ProjectID,
+		"url":        hook.URL,
+		"events":     hook.Events,
+		"active":     hook.Active,
+	}
+}
@@ -0,0 +1,141 @@
+package clientwebhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/delivery"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+func openClientWebhookTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "clientwebhook-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+				(1, 'Alpha', 'a', DATE('now'), 'Client A', 'alpha', 'active'),
+				(2, 'Beta', 'b', DATE('now'), 'Client B', 'beta', 'active')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'closed'), (2, 2, 'closed')`,
+			`INSERT INTO pallet_receipts (project_id, pallet_id, sku, description, scanned_by_user_id, qty) VALUES (1, 1, 'SKU-A', 'A', 1, 4), (1, 1, 'SKU-B', 'B', 1, 6)`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed test data: %v", err)
+	}
+	return db
+}
+
+func TestCreateValidatesURLAndEvents(t *testing.T) {
+	db := openClientWebhookTestDB(t)
+	ctx := context.Background()
+	auditSvc := audit.NewService()
+
+	if _, err := Create(ctx, db, auditSvc, 1, 1, "ftp://client.example.test", Events); !errors.Is(err, ErrInvalidURL) {
+		t.Fatalf("expected invalid url, got %v", err)
+	}
+	if _, err := Create(ctx, db, auditSvc, 1, 1, "https://client.example.test", []string{"pallet.deleted"}); !errors.Is(err, ErrNoEvents) {
+		t.Fatalf("expected no events, got %v", err)
+	}
+	hook, err := Create(ctx, db, auditSvc, 1, 1, "https://client.example.test", []string{EventPalletCancelled, EventPalletClosed})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if hook.Events != "pallet.closed,pallet.cancelled" || !strings.HasPrefix(string(hook.Secret), secretPrefix) {
+		t.Fatalf("unexpected webhook: %+v", hook)
+	}
+	if err := Update(ctx, db, auditSvc, 1, 2, hook.ID, "https://client.example.test", Events, true); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected webhook scoped to its project, got %v", err)
+	}
+}
+
+func TestEnqueuePalletEvent_OnlySubscribedActiveProjectHooks(t *testing.T) {
+	db := openClientWebhookTestDB(t)
+	ctx := context.Background()
+	auditSvc := audit.NewService()
+
+	closedHook, err := Create(ctx, db, auditSvc, 1, 1, "https://alpha.example.test/closed", []string{EventPalletClosed})
+	if err != nil {
+		t.Fatalf("create closed hook: %v", err)
+	}
+	if _, err := Create(ctx, db, auditSvc, 1, 1, "https://alpha.example.test/cancelled", []string{EventPalletCancelled}); err != nil {
+		t.Fatalf("create cancelled hook: %v", err)
+	}
+	paused, err := Create(ctx, db, auditSvc, 1, 1, "https://alpha.example.test/paused", Events)
+	if err != nil {
+		t.Fatalf("create paused hook: %v", err)
+	}
+	if err := Update(ctx, db, auditSvc, 1, 1, paused.ID, paused.URL, Events, false); err != nil {
+		t.Fatalf("pause hook: %v", err)
+	}
+	if _, err := Create(ctx, db, auditSvc, 1, 2, "https://beta.example.test", Events); err != nil {
+		t.Fatalf("create beta hook: %v", err)
+	}
+
+	if err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return EnqueuePalletEvent(ctx, tx, 1, EventPalletClosed)
+	}); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	deliveries, err := ListDeliveries(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("list deliveries: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Endpoint != closedHook.URL || deliveries[0].Event != EventPalletClosed {
+		t.Fatalf("expected one delivery to the closed hook, got %+v", deliveries)
+	}
+
+	var d models.Delivery
+	if err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewSelect().Model(&d).Where("id = ?", deliveries[0].ID).Scan(ctx)
+	}); err != nil {
+		t.Fatalf("load delivery: %v", err)
+	}
+	if d.Signature != delivery.Sign(string(closedHook.Secret), []byte(d.Payload)) {
+		t.Fatalf("expected payload signed with the webhook secret")
+	}
+	var payload map[string]any
+	if err := json.Unmarshal([]byte(d.Payload), &payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	pallet := payload["pallet"].(map[string]any)
+	if pallet["number"] != "P00000001" || pallet["total_qty"] != float64(10) || pallet["line_count"] != float64(2) {
+		t.Fatalf("unexpected pallet payload: %v", pallet)
+	}
+	for _, internal := range []string{"client_name", "user_id", "scanned_by", "project_id"} {
+		if strings.Contains(d.Payload, internal) {
+			t.Fatalf("payload leaks internal field %s: %s", internal, d.Payload)
+		}
+	}
+}
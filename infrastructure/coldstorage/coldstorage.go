@@ -0,0 +1,447 @@
+// Package coldstorage moves the photos of inactive projects out of the
+// database into files, so closed projects with thousands of photos stop
+// dominating the database file. Archived photo rows keep their name and type
+// but their blob is emptied, and cold_storage_photos records which file holds
+// each one. Photo handlers fall back to the file through Fill, and
+// rehydrating a project, which happens when it is reactivated, moves the
+// photos back into the database.
+package coldstorage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/sqlite"
+)
+
+// Photo sources, named after the table holding the blob.
+const (
+	SourceGallery = "receipt_photos"
+	SourcePrimary = "pallet_receipts"
+)
+
+// Run actions.
+const (
+	ActionArchive   = "archive"
+	ActionRehydrate = "rehydrate"
+)
+
+var (
+	ErrDisabled        = errors.New("cold storage is not configured")
+	ErrProjectNotFound = errors.New("project not found")
+	ErrProjectActive   = errors.New("only inactive projects can be moved to cold storage")
+	ErrChecksum        = errors.New("archived photo does not match its checksum")
+)
+
+// Store archives and rehydrates project photos.
+type Store struct {
+	db    *sqlite.DB
+	audit *audit.Service
+
+	// Dir is where archived photos are written; archiving is off while it
+	// is empty. Rehydrating uses the path recorded for each photo, so it
+	// still works after Dir changes.
+	Dir string
+	// MinBytes and IdleDays choose the projects the sweeper archives: those
+	// inactive for at least IdleDays whose photos take at least MinBytes.
+	MinBytes int64
+	IdleDays int
+}
+
+func NewStore(db *sqlite.DB, auditSvc *audit.Service) *Store {
+	return &Store{
+		db:       db,
+		audit:    auditSvc,
+		MinBytes: 500 << 20,
+		IdleDays: 30,
+	}
+}
+
+// Enabled reports whether projects can be archived.
+func (s *Store) Enabled() bool {
+	return s.Dir != ""
+}
+
+// Result is what an archive or rehydrate run moved.
+type Result struct {
+	Photos int
+	Bytes  int64
+	// DBBytesFreed is how much the database file shrank after archiving.
+	DBBytesFreed int64
+}
+
+type photoRef struct {
+	Source string `bun:"source"`
+	ID     int64  `bun:"id"`
+}
+
+type archivedPhoto struct {
+	Source  string `bun:"source"`
+	PhotoID int64  `bun:"photo_id"`
+	Path    string `bun:"path"`
+	SHA256  string `bun:"sha256"`
+}
+
+// Archive writes every photo of an inactive project to Dir, empties the
+// blobs and compacts the database. userID 0 is the sweeper; only runs by a
+// user are audited. Photos are moved one at a time so the writer is never
+// locked for the whole project, and a photo's blob is only emptied once its
+// file is safely on disk.
+func (s *Store) Archive(ctx context.Context, userID, projectID int64) (Result, error) {
+	var result Result
+	if !s.Enabled() {
+		return result, ErrDisabled
+	}
+	var refs []photoRef
+	err := s.db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := requireInactiveProject(ctx, tx, projectID); err != nil {
+			return err
+		}
+		return tx.NewRaw(`
+SELECT 'receipt_photos' AS source, rp.id
+FROM receipt_photos rp
+JOIN pallet_receipts pr ON pr.id = rp.pallet_receipt_id
+WHERE pr.project_id = ? AND LENGTH(rp.photo_blob) > 0
+UNION ALL
+SELECT 'pallet_receipts' AS source, id
+FROM pallet_receipts
+WHERE project_id = ? AND LENGTH(stock_photo_blob) > 0
+ORDER BY source, id`, projectID, projectID).Scan(ctx, &refs)
+	})
+	if err != nil {
+		return result, err
+	}
+
+	dir := filepath.Join(s.Dir, fmt.Sprintf("project-%d", projectID))
+	if len(refs) > 0 {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return result, err
+		}
+	}
+	for _, ref := range refs {
+		var blob []byte
+		err := s.db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+			return tx.NewRaw(blobSelectSQL(ref.Source), ref.ID).Scan(ctx, &blob)
+		})
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && len(blob) == 0) {
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%s-%d", ref.Source, ref.ID))
+		if err := writeFile(path, blob); err != nil {
+			return result, err
+		}
+		sum := sha256.Sum256(blob)
+		moved := false
+		err = s.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+			// A project reactivated mid-run keeps the photos not yet moved.
+			if err := requireInactiveProject(ctx, tx, projectID); err != nil {
+				return err
+			}
+			// The length guard skips a photo replaced since it was read.
+			res, err := tx.ExecContext(ctx, blobEmptySQL(ref.Source), ref.ID, len(blob))
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				return nil
+			}
+			moved = true
+			_, err = tx.ExecContext(ctx, `
+INSERT INTO cold_storage_photos (project_id, source, photo_id, path, bytes, sha256)
+VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT(source, photo_id) DO UPDATE SET
+  project_id = excluded.project_id,
+  path = excluded.path,
+  bytes = excluded.bytes,
+  sha256 = excluded.sha256,
+  archived_at = CURRENT_TIMESTAMP`, projectID, ref.Source, ref.ID, path, len(blob), hex.EncodeToString(sum[:]))
+			return err
+		})
+		if !moved || err != nil {
+			_ = os.Remove(path)
+		}
+		if errors.Is(err, ErrProjectActive) {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+		if moved {
+			result.Photos++
+			result.Bytes += int64(len(blob))
+		}
+	}
+	if result.Photos == 0 {
+		return result, nil
+	}
+
+	freed, err := vacuum(ctx, s.db)
+	if err != nil {
+		return result, err
+	}
+	result.DBBytesFreed = freed
+	return result, s.recordRun(ctx, userID, projectID, ActionArchive, result)
+}
+
+// Rehydrate moves every archived photo of a project back into the database
+// and deletes its file. Photos deleted while archived, for example by photo
+// retention, only have their file removed.
+func (s *Store) Rehydrate(ctx context.Context, userID, projectID int64) (Result, error) {
+	var result Result
+	var photos []archivedPhoto
+	err := s.db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var exists bool
+		if err := tx.NewRaw(`SELECT COUNT(1) > 0 FROM projects WHERE id = ?`, projectID).Scan(ctx, &exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrProjectNotFound
+		}
+		return tx.NewRaw(`
+SELECT source, photo_id, path, sha256
+FROM cold_storage_photos
+WHERE project_id = ?
+ORDER BY source, photo_id`, projectID).Scan(ctx, &photos)
+	})
+	if err != nil || len(photos) == 0 {
+		return result, err
+	}
+
+	for _, photo := range photos {
+		blob, err := readFile(photo)
+		if err != nil {
+			return result, err
+		}
+		restored := false
+		err = s.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+			res, err := tx.ExecContext(ctx, blobRestoreSQL(photo.Source), blob, photo.PhotoID)
+			if err != nil {
+				return err
+			}
+			n, _ := res.RowsAffected()
+			restored = n > 0
+			_, err = tx.ExecContext(ctx, `DELETE FROM cold_storage_photos WHERE source = ? AND photo_id = ?`, photo.Source, photo.PhotoID)
+			return err
+		})
+		if err != nil {
+			return result, err
+		}
+		_ = os.Remove(photo.Path)
+		if restored {
+			result.Photos++
+			result.Bytes += int64(len(blob))
+		}
+	}
+	// Leaves the directory alone if anything else was put in it.
+	_ = os.Remove(filepath.Dir(photos[0].Path))
+	return result, s.recordRun(ctx, userID, projectID, ActionRehydrate, result)
+}
+
+// Load returns an archived photo's bytes, or sql.ErrNoRows when the photo is
+// not archived. Photo handlers call it when a stored blob is empty.
+func Load(ctx context.Context, db *sqlite.DB, source string, photoID int64) ([]byte, error) {
+	var photo archivedPhoto
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT source, photo_id, path, sha256
+FROM cold_storage_photos
+WHERE source = ? AND photo_id = ?`, source, photoID).Scan(ctx, &photo)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return readFile(photo)
+}
+
+// Fill returns blob unchanged unless it is empty, in which case it loads the
+// archived photo. A photo that is empty without being archived stays empty.
+func Fill(ctx context.Context, db *sqlite.DB, source string, photoID int64, blob []byte) ([]byte, error) {
+	if len(blob) > 0 {
+		return blob, nil
+	}
+	archived, err := Load(ctx, db, source, photoID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return blob, nil
+	}
+	return archived, err
+}
+
+func (s *Store) recordRun(ctx context.Context, userID, projectID int64, action string, result Result) error {
+	return s.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var runUserID *int64
+		if userID > 0 {
+			runUserID = &userID
+		}
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO cold_storage_runs (project_id, action, photos, bytes, db_bytes_freed, user_id)
+VALUES (?, ?, ?, ?, ?, ?)`, projectID, action, result.Photos, result.Bytes, result.DBBytesFreed, runUserID); err != nil {
+			return err
+		}
+		if s.audit == nil || userID <= 0 {
+			return nil
+		}
+		return s.audit.Write(ctx, tx, userID, "project.photos_"+action, "projects", strconv.FormatInt(projectID, 10), nil, map[string]any{
+			"project_id":     projectID,
+			"photos":         result.Photos,
+			"bytes":          result.Bytes,
+			"db_bytes_freed": result.DBBytesFreed,
+		})
+	})
+}
+
+func requireInactiveProject(ctx context.Context, tx bun.Tx, projectID int64) error {
+	var status string
+	err := tx.NewRaw(`SELECT status FROM projects WHERE id = ?`, projectID).Scan(ctx, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrProjectNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if status == projectinfra.StatusActive {
+		return ErrProjectActive
+	}
+	return nil
+}
+
+// writeFile writes data through a temporary file so a crash never leaves a
+// truncated photo at path.
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readFile(photo archivedPhoto) ([]byte, error) {
+	blob, err := os.ReadFile(photo.Path)
+	if err != nil {
+		return nil, fmt.Errorf("read archived photo %s %d: %w", photo.Source, photo.PhotoID, err)
+	}
+	sum := sha256.Sum256(blob)
+	if hex.EncodeToString(sum[:]) != photo.SHA256 {
+		return nil, fmt.Errorf("%w: %s", ErrChecksum, photo.Path)
+	}
+	return blob, nil
+}
+
+// vacuum compacts the database and returns how many bytes the file shrank
+// by. VACUUM cannot run inside a transaction, so it goes straight to the
+// single writer connection.
+func vacuum(ctx context.Context, db *sqlite.DB) (int64, error) {
+	var before, after int64
+	sizeQuery := `SELECT pc.page_count * ps.page_size FROM pragma_page_count() pc, pragma_page_size() ps`
+	if err := db.WriteSQL.QueryRowContext(ctx, sizeQuery).Scan(&before); err != nil {
+		return 0, err
+	}
+	if _, err := db.WriteSQL.ExecContext(ctx, `VACUUM`); err != nil {
+		return 0, err
+	}
+	if err := db.WriteSQL.QueryRowContext(ctx, sizeQuery).Scan(&after); err != nil {
+		return 0, err
+	}
+	return max(before-after, 0), nil
+}
+
+func blobSelectSQL(source string) string {
+	if source == SourcePrimary {
+		return `SELECT stock_photo_blob FROM pallet_receipts WHERE id = ? AND stock_photo_blob IS NOT NULL`
+	}
+	return `SELECT photo_blob FROM receipt_photos WHERE id = ?`
+}
+
+// blobEmptySQL keeps the stock photo column non-NULL, so the line still
+// reports having a stock photo while it is archived.
+func blobEmptySQL(source string) string {
+	if source == SourcePrimary {
+		return `UPDATE pallet_receipts SET stock_photo_blob = x'' WHERE id = ? AND LENGTH(stock_photo_blob) = ?`
+	}
+	return `UPDATE receipt_photos SET photo_blob = x'' WHERE id = ? AND LENGTH(photo_blob) = ?`
+}
+
+func blobRestoreSQL(source string) string {
+	if source == SourcePrimary {
+		return `UPDATE pallet_receipts SET stock_photo_blob = ? WHERE id = ? AND LENGTH(stock_photo_blob) = 0`
+	}
+	return `UPDATE receipt_photos SET photo_blob = ? WHERE id = ? AND LENGTH(photo_blob) = 0`
+}
+
+// Archived is what a project holds in cold storage.
+type Archived struct {
+	ProjectID int64 `bun:"project_id"`
+	Photos    int64 `bun:"photos"`
+	Bytes     int64 `bun:"bytes"`
+}
+
+// Run is a recorded archive or rehydrate run.
+type Run struct {
+	ID           int64  `bun:"id"`
+	ProjectName  string `bun:"project_name"`
+	Action       string `bun:"action"`
+	Photos       int64  `bun:"photos"`
+	Bytes        int64  `bun:"bytes"`
+	DBBytesFreed int64  `bun:"db_bytes_freed"`
+	Username     string `bun:"username"`
+	CreatedAt    string `bun:"created_at"`
+}
+
+// ListArchived returns the photos each project has in cold storage, keyed by
+// project.
+func ListArchived(ctx context.Context, db *sqlite.DB) (map[int64]Archived, error) {
+	rows := make([]Archived, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT project_id, COUNT(1) AS photos, COALESCE(SUM(bytes), 0) AS bytes
+FROM cold_storage_photos
+GROUP BY project_id`).Scan(ctx, &rows)
+	})
+	archived := make(map[int64]Archived, len(rows))
+	for _, row := range rows {
+		archived[row.ProjectID] = row
+	}
+	return archived, err
+}
+
+// ListRuns returns the latest archive and rehydrate runs, newest first.
+func ListRuns(ctx context.Context, db *sqlite.DB, limit int) ([]Run, error) {
+	runs := make([]Run, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT r.id, COALESCE(p.name, '') AS project_name, r.action, r.photos, r.bytes, r.db_bytes_freed,
+       COALESCE(u.username, '') AS username,
+       strftime('%d/%m/%Y %H:%M', r.created_at) AS created_at
+FROM cold_storage_runs r
+LEFT JOIN projects p ON p.id = r.project_id
+LEFT JOIN users u ON u.id = r.user_id
+ORDER BY r.id DESC
+LIMIT ?`, limit).Scan(ctx, &runs)
+	})
+	return runs, err
+}
@@ -0,0 +1,140 @@
+package coldstorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+func openColdStorageTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "coldstorage-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	return db
+}
+
+func TestArchiveAndRehydrateProjectPhotos(t *testing.T) {
+	db := openColdStorageTestDB(t)
+	ctx := context.Background()
+
+	gallery := bytes.Repeat([]byte{0xff, 0xd8, 0x01}, 400)
+	primary := bytes.Repeat([]byte{0x89, 0x50}, 300)
+	for _, stmt := range []string{
+		`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin')`,
+		`INSERT INTO projects (id, name, description, project_date, client_name, code, status, deactivated_at) VALUES (1, 'Closed', 'd', '2026-01-01', 'C', 'closed', 'inactive', '2026-01-10 09:00:00')`,
+		`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (2, 'Live', 'd', '2026-01-01', 'C', 'live', 'active')`,
+		`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'closed')`,
+		`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty) VALUES (1, 1, 1, 'SKU-1', 'Closed line', 1, 1)`,
+	} {
+		if _, err := db.W.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed %q: %v", stmt, err)
+		}
+	}
+	if _, err := db.W.ExecContext(ctx, `INSERT INTO receipt_photos (id, pallet_receipt_id, photo_blob, photo_mime, photo_name) VALUES (1, 1, ?, 'image/jpeg', 'a.jpg')`, gallery); err != nil {
+		t.Fatalf("seed photo: %v", err)
+	}
+	if _, err := db.W.ExecContext(ctx, `UPDATE pallet_receipts SET stock_photo_blob = ?, stock_photo_mime = 'image/png', stock_photo_name = 'b.png' WHERE id = 1`, primary); err != nil {
+		t.Fatalf("seed stock photo: %v", err)
+	}
+
+	store := NewStore(db, audit.NewService())
+	if _, err := store.Archive(ctx, 1, 1); !errors.Is(err, ErrDisabled) {
+		t.Fatalf("archive without a directory = %v, want ErrDisabled", err)
+	}
+	store.Dir = t.TempDir()
+	if _, err := store.Archive(ctx, 1, 2); !errors.Is(err, ErrProjectActive) {
+		t.Fatalf("archive of an active project = %v, want ErrProjectActive", err)
+	}
+
+	// The project has 1.4 KB of photos and has been inactive since January.
+	store.MinBytes = 1024
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	if ids, err := store.Candidates(ctx, now); err != nil || len(ids) != 1 || ids[0] != 1 {
+		t.Fatalf("candidates = %v, %v", ids, err)
+	}
+	if ids, err := store.Candidates(ctx, time.Date(2026, 1, 20, 9, 0, 0, 0, time.UTC)); err != nil || len(ids) != 0 {
+		t.Fatalf("candidates before the idle period = %v, %v", ids, err)
+	}
+
+	result, err := store.Archive(ctx, 1, 1)
+	if err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	if result.Photos != 2 || result.Bytes != int64(len(gallery)+len(primary)) {
+		t.Fatalf("archive result = %+v", result)
+	}
+	var galleryLen, primaryLen int
+	var hasPrimary bool
+	if err := db.R.NewRaw(`SELECT (SELECT LENGTH(photo_blob) FROM receipt_photos WHERE id = 1), LENGTH(stock_photo_blob), stock_photo_blob IS NOT NULL FROM pallet_receipts WHERE id = 1`).Scan(ctx, &galleryLen, &primaryLen, &hasPrimary); err != nil {
+		t.Fatalf("load blobs: %v", err)
+	}
+	if galleryLen != 0 || primaryLen != 0 || !hasPrimary {
+		t.Fatalf("archived blobs: gallery=%d primary=%d hasPrimary=%v", galleryLen, primaryLen, hasPrimary)
+	}
+	if ids, err := store.Candidates(ctx, now); err != nil || len(ids) != 0 {
+		t.Fatalf("candidates after archiving = %v, %v", ids, err)
+	}
+
+	// Archived photos are still served from their files.
+	if blob, err := Fill(ctx, db, SourceGallery, 1, nil); err != nil || !bytes.Equal(blob, gallery) {
+		t.Fatalf("fill gallery photo: %d bytes, %v", len(blob), err)
+	}
+	if blob, err := Fill(ctx, db, SourcePrimary, 1, nil); err != nil || !bytes.Equal(blob, primary) {
+		t.Fatalf("fill stock photo: %d bytes, %v", len(blob), err)
+	}
+	if blob, err := Fill(ctx, db, SourceGallery, 404, nil); err != nil || len(blob) != 0 {
+		t.Fatalf("fill unarchived photo: %d bytes, %v", len(blob), err)
+	}
+	archived, err := ListArchived(ctx, db)
+	if err != nil || archived[1].Photos != 2 {
+		t.Fatalf("archived = %+v, %v", archived, err)
+	}
+
+	restored, err := store.Rehydrate(ctx, 1, 1)
+	if err != nil {
+		t.Fatalf("rehydrate: %v", err)
+	}
+	if restored.Photos != 2 {
+		t.Fatalf("rehydrate result = %+v", restored)
+	}
+	var galleryBlob, primaryBlob []byte
+	if err := db.R.QueryRowContext(ctx, `SELECT (SELECT photo_blob FROM receipt_photos WHERE id = 1), stock_photo_blob FROM pallet_receipts WHERE id = 1`).Scan(&galleryBlob, &primaryBlob); err != nil {
+		t.Fatalf("load restored blobs: %v", err)
+	}
+	if !bytes.Equal(galleryBlob, gallery) || !bytes.Equal(primaryBlob, primary) {
+		t.Fatalf("restored blobs differ: gallery=%d primary=%d bytes", len(galleryBlob), len(primaryBlob))
+	}
+	if _, err := os.Stat(filepath.Join(store.Dir, "project-1")); !os.IsNotExist(err) {
+		t.Fatalf("archive directory left behind: %v", err)
+	}
+
+	runs, err := ListRuns(ctx, db, 10)
+	if err != nil || len(runs) != 2 || runs[0].Action != ActionRehydrate || runs[1].Action != ActionArchive || runs[1].Username != "admin" {
+		t.Fatalf("runs = %+v, %v", runs, err)
+	}
+	var audits int
+	if err := db.R.NewRaw(`SELECT COUNT(1) FROM audit_logs WHERE action IN ('project.photos_archive', 'project.photos_rehydrate')`).Scan(ctx, &audits); err != nil || audits != 2 {
+		t.Fatalf("audit entries = %d, %v", audits, err)
+	}
+}
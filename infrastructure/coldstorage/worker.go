@@ -0,0 +1,123 @@
+package coldstorage
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	projectinfra "receipter/infrastructure/project"
+)
+
+const sweepInterval = time.Hour
+
+// Candidates returns the inactive projects due for archiving at now: idle for
+// at least IdleDays with at least MinBytes of photos still in the database.
+func (s *Store) Candidates(ctx context.Context, now time.Time) ([]int64, error) {
+	ids := make([]int64, 0)
+	cutoff := now.AddDate(0, 0, -s.IdleDays).UTC().Format("2006-01-02 15:04:05")
+	err := s.db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT p.id
+FROM projects p
+WHERE p.status = ?
+  AND (p.deactivated_at IS NULL OR julianday(p.deactivated_at) <= julianday(?))
+  AND COALESCE((
+      SELECT SUM(LENGTH(rp.photo_blob))
+      FROM receipt_photos rp
+      JOIN pallet_receipts pr ON pr.id = rp.pallet_receipt_id
+      WHERE pr.project_id = p.id
+  ), 0) + COALESCE((
+      SELECT SUM(LENGTH(stock_photo_blob))
+      FROM pallet_receipts
+      WHERE project_id = p.id
+  ), 0) >= ?
+ORDER BY p.id`, projectinfra.StatusInactive, cutoff, max(s.MinBytes, 1)).Scan(ctx, &ids)
+	})
+	return ids, err
+}
+
+// Sweep archives every candidate project and returns how many photos moved.
+func (s *Store) Sweep(ctx context.Context, now time.Time) (int, error) {
+	if !s.Enabled() {
+		return 0, nil
+	}
+	ids, err := s.Candidates(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	moved := 0
+	for _, id := range ids {
+		result, err := s.Archive(ctx, 0, id)
+		moved += result.Photos
+		if err != nil {
+			return moved, err
+		}
+	}
+	return moved, nil
+}
+
+// Sweeper archives photo-heavy inactive projects every hour while the store
+// is enabled.
+type Sweeper struct {
+	store *Store
+
+	// Paused, when set before Start, holds archiving while it returns true.
+	Paused func() bool
+
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	started atomic.Bool
+}
+
+func NewSweeper(store *Store) *Sweeper {
+	return &Sweeper{
+		store: store,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// Start archives candidate projects until Stop.
+func (s *Sweeper) Start() {
+	s.started.Store(true)
+	go func() {
+		defer close(s.done)
+		ctx := context.Background()
+		ticker := time.NewTicker(sweepInterval)
+		defer ticker.Stop()
+		for {
+			if s.Paused == nil || !s.Paused() {
+				moved, err := s.store.Sweep(ctx, time.Now().UTC())
+				if err != nil {
+					slog.Error("cold storage: sweep failed", slog.Any("err", err))
+				} else if moved > 0 {
+					slog.Info("cold storage: photos archived", slog.Int("count", moved))
+				}
+			}
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends a started sweeper and waits for a running sweep to finish.
+func (s *Sweeper) Stop() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	if !s.started.Load() {
+		return
+	}
+	select {
+	case <-s.done:
+	case <-time.After(5 * time.Second):
+	}
+}
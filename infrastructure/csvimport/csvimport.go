@@ -0,0 +1,195 @@
+// Package csvimport opens uploaded CSV files whatever the spreadsheet that
+// wrote them: client catalogs arrive comma-, semicolon-, tab- or
+// pipe-delimited, in UTF-8 or a legacy Windows code page. Every importer
+// reads its upload through NewReader so they all accept the same files.
+package csvimport
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Encodings an upload can be declared in.
+const (
+	EncodingAuto        = "auto"
+	EncodingUTF8        = "utf-8"
+	EncodingWindows1252 = "windows-1252"
+	EncodingISO88591    = "iso-8859-1"
+)
+
+// Delimiters an upload can be declared with. DelimiterAuto picks whichever
+// of the others splits the header line most.
+const (
+	DelimiterAuto      = "auto"
+	DelimiterComma     = "comma"
+	DelimiterSemicolon = "semicolon"
+	DelimiterTab       = "tab"
+	DelimiterPipe      = "pipe"
+)
+
+var (
+	ErrUnknownEncoding  = errors.New("unsupported character encoding")
+	ErrUnknownDelimiter = errors.New("unsupported delimiter")
+	ErrInvalidUTF8      = errors.New("file is not valid UTF-8; choose the encoding it was saved in")
+)
+
+// Option is a choice offered on an upload form.
+type Option struct {
+	Value string
+	Label string
+}
+
+// EncodingOptions and DelimiterOptions list the upload form choices, the
+// automatic one first.
+var (
+	EncodingOptions = []Option{
+		{EncodingAuto, "Auto-detect"},
+		{EncodingUTF8, "UTF-8"},
+		{EncodingWindows1252, "Windows-1252 (Excel)"},
+		{EncodingISO88591, "ISO-8859-1 (Latin-1)"},
+	}
+	DelimiterOptions = []Option{
+		{DelimiterAuto, "Auto-detect"},
+		{DelimiterComma, "Comma ,"},
+		{DelimiterSemicolon, "Semicolon ;"},
+		{DelimiterTab, "Tab"},
+		{DelimiterPipe, "Pipe |"},
+	}
+)
+
+var delimiters = map[string]rune{
+	DelimiterComma:     ',',
+	DelimiterSemicolon: ';',
+	DelimiterTab:       '\t',
+	DelimiterPipe:      '|',
+}
+
+// Options says how an upload was written. The zero value detects both.
+type Options struct {
+	Encoding  string
+	Delimiter string
+}
+
+// ParseOptions reads the encoding and delimiter form values, treating
+// blanks as auto-detect.
+func ParseOptions(encoding, delimiter string) (Options, error) {
+	opts := Options{
+		Encoding:  strings.ToLower(strings.TrimSpace(encoding)),
+		Delimiter: strings.ToLower(strings.TrimSpace(delimiter)),
+	}
+	switch opts.Encoding {
+	case "":
+		opts.Encoding = EncodingAuto
+	case EncodingAuto, EncodingUTF8, EncodingWindows1252, EncodingISO88591:
+	default:
+		return opts, ErrUnknownEncoding
+	}
+	if opts.Delimiter == "" {
+		opts.Delimiter = DelimiterAuto
+	}
+	if _, ok := delimiters[opts.Delimiter]; !ok && opts.Delimiter != DelimiterAuto {
+		return opts, ErrUnknownDelimiter
+	}
+	return opts, nil
+}
+
+// NewReader decodes r to UTF-8, drops a byte order mark and returns a CSV
+// reader splitting on the chosen or detected delimiter. The whole upload is
+// read up front, so callers limit r.
+func NewReader(r io.Reader, opts Options) (*csv.Reader, error) {
+	opts, err := ParseOptions(opts.Encoding, opts.Delimiter)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text, err := Decode(raw, opts.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	text = strings.TrimPrefix(text, "\uFEFF")
+
+	reader := csv.NewReader(strings.NewReader(text))
+	if comma, ok := delimiters[opts.Delimiter]; ok {
+		reader.Comma = comma
+	} else {
+		reader.Comma = DetectDelimiter(text)
+	}
+	return reader, nil
+}
+
+// Decode converts raw from encoding to UTF-8. Auto-detect keeps valid UTF-8
+// as it is and otherwise reads Windows-1252, which is what Excel saves
+// "CSV" as on Western European Windows.
+func Decode(raw []byte, encoding string) (string, error) {
+	switch encoding {
+	case EncodingUTF8:
+		if !utf8.Valid(raw) {
+			return "", ErrInvalidUTF8
+		}
+		return string(raw), nil
+	case EncodingAuto, "":
+		if utf8.Valid(raw) {
+			return string(raw), nil
+		}
+		return decodeSingleByte(raw, true), nil
+	case EncodingWindows1252:
+		return decodeSingleByte(raw, true), nil
+	case EncodingISO88591:
+		return decodeSingleByte(raw, false), nil
+	}
+	return "", ErrUnknownEncoding
+}
+
+// windows1252 maps the bytes 0x80-0x9F where Windows-1252 differs from
+// ISO-8859-1; the five bytes it leaves undefined map to themselves.
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+}
+
+func decodeSingleByte(raw []byte, cp1252 bool) string {
+	var b strings.Builder
+	b.Grow(len(raw) + len(raw)/8)
+	for _, c := range raw {
+		if cp1252 && c >= 0x80 && c <= 0x9F {
+			b.WriteRune(windows1252[c-0x80])
+			continue
+		}
+		// ISO-8859-1 is the first 256 code points of Unicode.
+		b.WriteRune(rune(c))
+	}
+	return b.String()
+}
+
+// DetectDelimiter picks the delimiter that occurs most often outside quotes
+// on the first line of text, preferring comma on a tie or when none occur.
+func DetectDelimiter(text string) rune {
+	line := text
+	if i := strings.IndexAny(text, "\r\n"); i >= 0 {
+		line = text[:i]
+	}
+	counts := make(map[rune]int, len(delimiters))
+	quoted := false
+	for _, r := range line {
+		if r == '"' {
+			quoted = !quoted
+			continue
+		}
+		if !quoted {
+			counts[r]++
+		}
+	}
+	best, bestCount := ',', counts[',']
+	for _, r := range []rune{';', '\t', '|'} {
+		if counts[r] > bestCount {
+			best, bestCount = r, counts[r]
+		}
+	}
+	return best
+}
@@ -0,0 +1,117 @@
+package csvimport
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// encode is the inverse of Decode for the test fixtures.
+func encode(t *testing.T, text, encoding string) []byte {
+	t.Helper()
+	if encoding == EncodingUTF8 {
+		return []byte(text)
+	}
+	var out bytes.Buffer
+	for _, r := range text {
+		switch {
+		case r < 0x80 || (r >= 0xA0 && r <= 0xFF):
+			out.WriteByte(byte(r))
+		case encoding == EncodingWindows1252 && cp1252Byte(r) != 0:
+			out.WriteByte(cp1252Byte(r))
+		default:
+			t.Fatalf("%q not in %s", r, encoding)
+		}
+	}
+	return out.Bytes()
+}
+
+func cp1252Byte(r rune) byte {
+	for i, mapped := range windows1252 {
+		if mapped == r {
+			return byte(0x80 + i)
+		}
+	}
+	return 0
+}
+
+func TestNewReader_EveryDelimiterAndEncoding(t *testing.T) {
+	descriptions := map[string]string{
+		EncodingUTF8:        "Crème brûlée – 5€ ✓",
+		EncodingWindows1252: "Crème brûlée – 5€",
+		EncodingISO88591:    "Crème brûlée ½",
+	}
+	for _, delimiter := range []string{DelimiterComma, DelimiterSemicolon, DelimiterTab, DelimiterPipe} {
+		for _, encoding := range []string{EncodingUTF8, EncodingWindows1252, EncodingISO88591} {
+			comma := string(delimiters[delimiter])
+			description := descriptions[encoding]
+			text := "sku" + comma + "description" + comma + "qty\r\n" +
+				"A1" + comma + description + comma + "3\r\n" +
+				"B2" + comma + `"Ham` + comma + ` cheese"` + comma + "4\r\n"
+			raw := encode(t, text, encoding)
+
+			for _, declared := range []Options{
+				{Encoding: encoding, Delimiter: delimiter},
+				{Encoding: EncodingAuto, Delimiter: DelimiterAuto},
+			} {
+				if declared.Encoding == EncodingAuto && encoding == EncodingISO88591 {
+					// Auto-detect reads single-byte files as Windows-1252,
+					// which agrees with Latin-1 on every printable byte.
+					declared.Encoding = ""
+				}
+				name := delimiter + "/" + encoding + "/declared " + declared.Delimiter + "," + declared.Encoding
+				t.Run(name, func(t *testing.T) {
+					reader, err := NewReader(bytes.NewReader(raw), declared)
+					if err != nil {
+						t.Fatalf("new reader: %v", err)
+					}
+					records, err := reader.ReadAll()
+					if err != nil {
+						t.Fatalf("read: %v", err)
+					}
+					if len(records) != 3 || len(records[1]) != 3 {
+						t.Fatalf("records = %q", records)
+					}
+					if records[1][1] != description {
+						t.Fatalf("description = %q, want %q", records[1][1], description)
+					}
+					if records[2][1] != "Ham"+comma+" cheese" || records[2][2] != "4" {
+						t.Fatalf("quoted row = %q", records[2])
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestNewReader_StripsByteOrderMark(t *testing.T) {
+	reader, err := NewReader(strings.NewReader("\uFEFFsku;qty\nA1;2\n"), Options{})
+	if err != nil {
+		t.Fatalf("new reader: %v", err)
+	}
+	header, err := reader.Read()
+	if err != nil || len(header) != 2 || header[0] != "sku" {
+		t.Fatalf("header = %q, %v", header, err)
+	}
+}
+
+func TestNewReader_RejectsInvalidUTF8WhenDeclared(t *testing.T) {
+	_, err := NewReader(bytes.NewReader([]byte("sku,description\nA1,Caf\xe9\n")), Options{Encoding: EncodingUTF8})
+	if !errors.Is(err, ErrInvalidUTF8) {
+		t.Fatalf("err = %v, want ErrInvalidUTF8", err)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	opts, err := ParseOptions(" Windows-1252 ", "")
+	if err != nil || opts.Encoding != EncodingWindows1252 || opts.Delimiter != DelimiterAuto {
+		t.Fatalf("opts = %+v, %v", opts, err)
+	}
+	if _, err := ParseOptions("utf-16", ""); !errors.Is(err, ErrUnknownEncoding) {
+		t.Fatalf("utf-16 err = %v", err)
+	}
+	if _, err := ParseOptions("", "colon"); !errors.Is(err, ErrUnknownDelimiter) {
+		t.Fatalf("colon err = %v", err)
+	}
+}
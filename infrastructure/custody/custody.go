@@ -0,0 +1,279 @@
+// Package custody renders the chain-of-custody document some clients ask
+// for with their stock: for each pallet, who created it, scanned each line,
+// closed, labelled and moved it and when, followed by a signature block for
+// the hand-over. One document covers a single pallet or every pallet of a
+// delivery.
+package custody
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"receipter/infrastructure/pdftext"
+)
+
+// Document is everything printed in one custody report.
+type Document struct {
+	ProjectName string
+	ClientName  string
+	// DeliveryReference is set when the document covers a delivery rather
+	// than one pallet.
+	DeliveryReference string
+	GeneratedBy       string
+	GeneratedAt       time.Time
+	Pallets           []Pallet
+}
+
+// Pallet is one pallet's custody record.
+type Pallet struct {
+	ID                int64
+	Status            string
+	DeliveryReference string
+	CreatedAt         time.Time
+	Events            []Event
+	Lines             []Line
+}
+
+// Event is one step in a pallet's custody, oldest first.
+type Event struct {
+	At      time.Time
+	User    string
+	Event   string
+	Details string
+}
+
+// Line is one receipt line and who scanned it.
+type Line struct {
+	ReceiptID   int64
+	SKU         string
+	Description string
+	BatchNumber string
+	Qty         int64
+	ScannedBy   string
+	ScannedAt   time.Time
+}
+
+// Units sums the pallet's received quantity.
+func (p Pallet) Units() int64 {
+	var total int64
+	for _, line := range p.Lines {
+		total += line.Qty
+	}
+	return total
+}
+
+// Code is the pallet number as printed on its label.
+func (p Pallet) Code() string {
+	return fmt.Sprintf("P%08d", p.ID)
+}
+
+// Subject names what the document covers, printed on every page.
+func (d Document) Subject() string {
+	if len(d.Pallets) == 1 && d.DeliveryReference == "" {
+		return d.Pallets[0].Code()
+	}
+	if d.DeliveryReference == "" {
+		return "Delivery without reference"
+	}
+	return "Delivery " + d.DeliveryReference
+}
+
+// FileName is the name the PDF is downloaded as.
+func (d Document) FileName() string {
+	if len(d.Pallets) == 1 && d.DeliveryReference == "" {
+		return "custody-" + strings.ToLower(d.Pallets[0].Code()) + ".pdf"
+	}
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return '-'
+	}, d.DeliveryReference)
+	if name == "" {
+		name = "no-reference"
+	}
+	return "custody-delivery-" + name + ".pdf"
+}
+
+// RenderPDF renders the document. A delivery gets a cover page listing its
+// pallets; each pallet starts on a new page.
+func RenderPDF(d Document) ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle("Chain of Custody "+d.Subject(), false)
+	pdf.SetMargins(12, 12, 12)
+	pdf.SetAutoPageBreak(true, 14)
+	tr := pdftext.Translator(pdf)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-10)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.CellFormat(0, 4, tr(fmt.Sprintf("Chain of custody - %s - generated %s - page %d", d.Subject(), pdftext.FormatTime(d.GeneratedAt), pdf.PageNo())), "", 0, "C", false, 0, "")
+	})
+
+	if len(d.Pallets) != 1 || d.DeliveryReference != "" {
+		writeCover(pdf, tr, d)
+	}
+	for _, p := range d.Pallets {
+		writePallet(pdf, tr, d, p)
+	}
+	if len(d.Pallets) == 0 {
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(0, 6, "No pallets recorded.", "", 1, "L", false, 0, "")
+	}
+
+	var out bytes.Buffer
+	if err := pdf.Output(&out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func writeCover(pdf *gofpdf.Fpdf, tr func(string) string, d Document) {
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "B", 22)
+	pdf.CellFormat(0, 12, "Chain of Custody", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(0, 9, tr(d.Subject()), "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+	writeSummary(pdf, tr, [][2]string{
+		{"Client", pdftext.OrDash(d.ClientName)},
+		{"Project", pdftext.OrDash(d.ProjectName)},
+		{"Pallets", strconv.Itoa(len(d.Pallets))},
+		{"Generated by", pdftext.OrDash(d.GeneratedBy)},
+		{"Generated at", pdftext.FormatTime(d.GeneratedAt)},
+	})
+	if len(d.Pallets) == 0 {
+		return
+	}
+	pdf.Ln(6)
+	writeTable(pdf, tr, []column{{"Pallet", 30}, {"Status", 30}, {"Created", 36}, {"Lines", 20}, {"Units", 20}}, len(d.Pallets), func(i int) []string {
+		p := d.Pallets[i]
+		return []string{p.Code(), p.Status, pdftext.FormatTime(p.CreatedAt), strconv.Itoa(len(p.Lines)), strconv.FormatInt(p.Units(), 10)}
+	})
+}
+
+func writePallet(pdf *gofpdf.Fpdf, tr func(string) string, d Document, p Pallet) {
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(0, 10, "Chain of Custody - "+p.Code(), "", 1, "L", false, 0, "")
+	pdf.Ln(2)
+	writeSummary(pdf, tr, [][2]string{
+		{"Client", pdftext.OrDash(d.ClientName)},
+		{"Project", pdftext.OrDash(d.ProjectName)},
+		{"Delivery", pdftext.OrDash(p.DeliveryReference)},
+		{"Status", pdftext.OrDash(p.Status)},
+		{"Created", pdftext.FormatTime(p.CreatedAt)},
+		{"Lines / units", fmt.Sprintf("%d / %d", len(p.Lines), p.Units())},
+	})
+
+	writeHeading(pdf, "Custody Events")
+	if len(p.Events) == 0 {
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(0, 6, "No events recorded.", "", 1, "L", false, 0, "")
+	} else {
+		writeTable(pdf, tr, []column{{"When", 30}, {"By", 30}, {"Event", 36}, {"Details", 90}}, len(p.Events), func(i int) []string {
+			e := p.Events[i]
+			return []string{pdftext.FormatTime(e.At), orSystem(e.User), e.Event, e.Details}
+		})
+	}
+
+	writeHeading(pdf, "Lines Scanned")
+	if len(p.Lines) == 0 {
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(0, 6, "No lines recorded.", "", 1, "L", false, 0, "")
+	} else {
+		writeTable(pdf, tr, []column{{"Line", 14}, {"SKU", 30}, {"Description", 54}, {"Batch", 22}, {"Qty", 12}, {"Scanned by", 26}, {"Scanned at", 28}}, len(p.Lines), func(i int) []string {
+			l := p.Lines[i]
+			return []string{strconv.FormatInt(l.ReceiptID, 10), l.SKU, l.Description, l.BatchNumber, strconv.FormatInt(l.Qty, 10), orSystem(l.ScannedBy), pdftext.FormatTime(l.ScannedAt)}
+		})
+	}
+
+	writeSignatures(pdf)
+}
+
+// writeSignatures leaves space for the people handing over and taking the
+// pallet to sign, keeping the block on one page.
+func writeSignatures(pdf *gofpdf.Fpdf) {
+	const blockH = 48.0
+	_, pageH := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	if pdf.GetY()+blockH > pageH-bottom {
+		pdf.AddPage()
+	}
+	writeHeading(pdf, "Signatures")
+	left, _, right, _ := pdf.GetMargins()
+	pageW, _ := pdf.GetPageSize()
+	colW := (pageW - left - right - 6) / 2
+	y := pdf.GetY()
+	for i, title := range []string{"Released by", "Received by"} {
+		x := left + float64(i)*(colW+6)
+		pdf.SetXY(x, y)
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(colW, 7, title, "LTR", 2, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		for _, field := range []string{"Name", "Signature", "Date / time"} {
+			pdf.CellFormat(colW, 10, field+":", "LR", 2, "L", false, 0, "")
+		}
+		pdf.CellFormat(colW, 2, "", "LBR", 2, "L", false, 0, "")
+	}
+}
+
+func writeHeading(pdf *gofpdf.Fpdf, title string) {
+	pdf.Ln(6)
+	pdf.SetFont("Helvetica", "B", 13)
+	pdf.CellFormat(0, 8, title, "", 1, "L", false, 0, "")
+}
+
+func writeSummary(pdf *gofpdf.Fpdf, tr func(string) string, rows [][2]string) {
+	for _, row := range rows {
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(40, 7, row[0], "1", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(0, 7, pdftext.Fit(pdf, tr(row[1]), 144), "1", 1, "L", false, 0, "")
+	}
+}
+
+type column struct {
+	title string
+	width float64
+}
+
+// writeTable prints n rows, repeating the header on each new page.
+func writeTable(pdf *gofpdf.Fpdf, tr func(string) string, cols []column, n int, row func(int) []string) {
+	header := func() {
+		pdf.SetFont("Helvetica", "B", 8)
+		for _, col := range cols {
+			pdf.CellFormat(col.width, 6, col.title, "1", 0, "L", false, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont("Helvetica", "", 8)
+	}
+	header()
+	_, pageH := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	for i := 0; i < n; i++ {
+		if pdf.GetY()+6 > pageH-bottom-4 {
+			pdf.AddPage()
+			header()
+		}
+		cells := row(i)
+		for j, col := range cols {
+			pdf.CellFormat(col.width, 6, pdftext.Fit(pdf, tr(cells[j]), col.width-2), "1", 0, "L", false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+}
+
+func orSystem(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "system"
+	}
+	return s
+}
@@ -0,0 +1,58 @@
+package custody
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderPDF_PalletAndDelivery(t *testing.T) {
+	at := time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC)
+	pallet := Pallet{
+		ID:        42,
+		Status:    "labelled",
+		CreatedAt: at,
+		Events: []Event{
+			{At: at, User: "admin", Event: "Created"},
+			{At: at.Add(time.Hour), User: "Zoë", Event: "Closed", Details: "Status changed from open to closed"},
+			{At: at.Add(2 * time.Hour), Event: "Label printed", Details: "P00000042-1"},
+		},
+		Lines: []Line{
+			{ReceiptID: 1, SKU: "SKU-1", Description: "Crème brûlée, a description far too long for its column", Qty: 4, ScannedBy: "Zoë", ScannedAt: at},
+			{ReceiptID: 2, SKU: "SKU-2", Qty: 6, ScannedBy: "scanner1", ScannedAt: at},
+		},
+	}
+	single := Document{ProjectName: "Inbound", ClientName: "Société Générale", GeneratedAt: at, Pallets: []Pallet{pallet}}
+	if single.Subject() != "P00000042" || single.FileName() != "custody-p00000042.pdf" || pallet.Units() != 10 {
+		t.Fatalf("subject = %q, file = %q, units = %d", single.Subject(), single.FileName(), pallet.Units())
+	}
+	out, err := RenderPDF(single)
+	if err != nil {
+		t.Fatalf("render pallet: %v", err)
+	}
+	if !bytes.HasPrefix(out, []byte("%PDF-")) {
+		t.Fatalf("expected a PDF")
+	}
+	if pages := strings.Count(string(out), "/Type /Page\n"); pages != 1 {
+		t.Fatalf("pallet pages = %d, want 1", pages)
+	}
+
+	lines := make([]Line, 0, 60)
+	for i := range 60 {
+		lines = append(lines, Line{ReceiptID: int64(i + 1), SKU: "SKU", Qty: 1, ScannedAt: at})
+	}
+	busy := Pallet{ID: 43, Status: "closed", CreatedAt: at, Lines: lines}
+	delivery := Document{ProjectName: "Inbound", DeliveryReference: "ASN 7/2026", GeneratedAt: at, Pallets: []Pallet{pallet, busy}}
+	if delivery.Subject() != "Delivery ASN 7/2026" || delivery.FileName() != "custody-delivery-asn-7-2026.pdf" {
+		t.Fatalf("subject = %q, file = %q", delivery.Subject(), delivery.FileName())
+	}
+	out, err = RenderPDF(delivery)
+	if err != nil {
+		t.Fatalf("render delivery: %v", err)
+	}
+	// Cover, the first pallet, then the busy pallet's lines over two pages.
+	if pages := strings.Count(string(out), "/Type /Page\n"); pages != 4 {
+		t.Fatalf("delivery pages = %d, want 4", pages)
+	}
+}
@@ -0,0 +1,403 @@
+// Package customfield manages the extra fields admins define per project and
+// the values scanners capture for them on receipt lines.
+package customfield
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+const (
+	TypeText   = "text"
+	TypeNumber = "number"
+	TypeDate   = "date"
+
+	// FormPrefix names receipt form inputs, e.g. custom_field_12.
+	FormPrefix = "custom_field_"
+	// ExportPrefix names export columns, e.g. custom_country_of_origin.
+	ExportPrefix = "custom_"
+
+	maxValueLength = 500
+)
+
+// Types lists the supported field types in display order.
+var Types = []string{TypeText, TypeNumber, TypeDate}
+
+var (
+	ErrLabelRequired = errors.New("custom field label is required")
+	ErrKeyRequired   = errors.New("custom field key is required")
+	ErrKeyExists     = errors.New("custom field key already exists for this project")
+	ErrUnknownType   = errors.New("custom field type must be text, number or date")
+	ErrNotFound      = errors.New("custom field not found")
+
+	// ErrInvalidValue is wrapped by every value validation error so handlers
+	// can show the message to the user.
+	ErrInvalidValue = errors.New("invalid custom field value")
+)
+
+var keyRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// NormalizeKey converts free text into a stable field key, e.g. "Country of Origin" -> "country_of_origin".
+func NormalizeKey(raw string) string {
+	v := strings.ToLower(strings.TrimSpace(raw))
+	v = keyRegex.ReplaceAllString(v, "_")
+	v = strings.Trim(v, "_")
+	if len(v) > 64 {
+		v = v[:64]
+	}
+	return v
+}
+
+// FormName returns the receipt form input name for a field.
+func FormName(fieldID int64) string {
+	return FormPrefix + strconv.FormatInt(fieldID, 10)
+}
+
+// ExportColumn returns the export column name for a field key.
+func ExportColumn(key string) string {
+	return ExportPrefix + key
+}
+
+// ParseForm collects submitted custom field inputs keyed by field id.
+func ParseForm(form map[string][]string) map[int64]string {
+	values := make(map[int64]string)
+	for name, raw := range form {
+		if !strings.HasPrefix(name, FormPrefix) || len(raw) == 0 {
+			continue
+		}
+		fieldID, err := strconv.ParseInt(strings.TrimPrefix(name, FormPrefix), 10, 64)
+		if err != nil || fieldID <= 0 {
+			continue
+		}
+		values[fieldID] = raw[0]
+	}
+	return values
+}
+
+// List returns a project's fields ordered for display. Inactive fields are only included when requested.
+func List(ctx context.Context, db *sqlite.DB, projectID int64, includeInactive bool) ([]models.ProjectCustomField, error) {
+	var fields []models.ProjectCustomField
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		fields, err = ListTx(ctx, tx, projectID, includeInactive)
+		return err
+	})
+	return fields, err
+}
+
+// ListTx is List inside the caller transaction.
+func ListTx(ctx context.Context, tx bun.Tx, projectID int64, includeInactive bool) ([]models.ProjectCustomField, error) {
+	fields := make([]models.ProjectCustomField, 0)
+	q := tx.NewSelect().Model(&fields).Where("project_id = ?", projectID).OrderExpr("sort_order ASC, label ASC, id ASC")
+	if !includeInactive {
+		q = q.Where("active = 1")
+	}
+	err := q.Scan(ctx)
+	return fields, err
+}
+
+func validType(fieldType string) bool {
+	for _, t := range Types {
+		if t == fieldType {
+			return true
+		}
+	}
+	return false
+}
+
+func Create(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID int64, key, label, fieldType string, required bool, sortOrder int) (models.ProjectCustomField, error) {
+	var field models.ProjectCustomField
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return field, ErrLabelRequired
+	}
+	key = NormalizeKey(key)
+	if key == "" {
+		key = NormalizeKey(label)
+	}
+	if key == "" {
+		return field, ErrKeyRequired
+	}
+	fieldType = strings.TrimSpace(fieldType)
+	if fieldType == "" {
+		fieldType = TypeText
+	}
+	if !validType(fieldType) {
+		return field, ErrUnknownType
+	}
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var count int
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM project_custom_fields WHERE project_id = ? AND key = ?`, projectID, key).Scan(ctx, &count); err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrKeyExists
+		}
+		field = models.ProjectCustomField{
+			ProjectID: projectID,
+			Key:       key,
+			Label:     label,
+			FieldType: fieldType,
+			Required:  required,
+			SortOrder: sortOrder,
+			Active:    true,
+		}
+		if _, err := tx.NewInsert().Model(&field).Exec(ctx); err != nil {
+			return err
+		}
+		if auditSvc != nil && userID > 0 {
+			return auditSvc.Write(ctx, tx, userID, "project.custom_field_create", "project_custom_fields", strconv.FormatInt(field.ID, 10), nil, auditPayload(field))
+		}
+		return nil
+	})
+	return field, err
+}
+
+// Update changes a field's label, flags and order. Key and type are fixed
+// once created because captured values and export columns depend on them.
+func Update(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID, fieldID int64, label string, required bool, sortOrder int, active bool) error {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return ErrLabelRequired
+	}
+
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var existing models.ProjectCustomField
+		if err := tx.NewSelect().Model(&existing).Where("id = ?", fieldID).Where("project_id = ?", projectID).Limit(1).Scan(ctx); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		before := existing
+		existing.Label = label
+		existing.Required = required
+		existing.SortOrder = sortOrder
+		existing.Active = active
+		existing.UpdatedAt = time.Now()
+		if _, err := tx.NewUpdate().Model(&existing).WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		if auditSvc != nil && userID > 0 {
+			return auditSvc.Write(ctx, tx, userID, "project.custom_field_update", "project_custom_fields", strconv.FormatInt(existing.ID, 10), auditPayload(before), auditPayload(existing))
+		}
+		return nil
+	})
+}
+
+// auditPayload carries project_id so the change shows in the project log.
+func auditPayload(field models.ProjectCustomField) map[string]any {
+	return map[string]any{
+		"project_id": field.ProjectID,
+		"key":        field.Key,
+		"label":      field.Label,
+		"field_type": field.FieldType,
+		"required":   field.Required,
+		"sort_order": field.SortOrder,
+		"active":     field.Active,
+	}
+}
+
+// NormalizeValue checks a submitted value against its field type and returns
+// the stored form: trimmed text, the number as typed, or an ISO date.
+func NormalizeValue(field models.ProjectCustomField, raw string) (string, error) {
+	v := strings.TrimSpace(raw)
+	if v == "" {
+		if field.Required {
+			return "", fmt.Errorf("%w: %s is required", ErrInvalidValue, field.Label)
+		}
+		return "", nil
+	}
+	switch field.FieldType {
+	case TypeNumber:
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return "", fmt.Errorf("%w: %s must be a number", ErrInvalidValue, field.Label)
+		}
+	case TypeDate:
+		d, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			if d, err = time.Parse("02/01/2006", v); err != nil {
+				return "", fmt.Errorf("%w: %s must be a date", ErrInvalidValue, field.Label)
+			}
+		}
+		v = d.Format("2006-01-02")
+	default:
+		if len(v) > maxValueLength {
+			return "", fmt.Errorf("%w: %s must be %d characters or fewer", ErrInvalidValue, field.Label, maxValueLength)
+		}
+	}
+	return v, nil
+}
+
+// SaveValues validates submitted values against the project's active fields
+// and stores them on a receipt line inside the caller transaction. A blank
+// value clears the field unless keepBlank is set, which repeat scans use so
+// merging a line does not wipe values captured on the first scan.
+func SaveValues(ctx context.Context, tx bun.Tx, auditSvc *audit.Service, userID, projectID, receiptID int64, submitted map[int64]string, keepBlank bool) error {
+	fields, err := ListTx(ctx, tx, projectID, false)
+	if err != nil || len(fields) == 0 {
+		return err
+	}
+	existing, err := LoadValues(ctx, tx, []int64{receiptID})
+	if err != nil {
+		return err
+	}
+	current := make(map[int64]string)
+	for _, value := range existing[receiptID] {
+		current[value.FieldID] = value.Value
+	}
+
+	before := make(map[string]string)
+	after := make(map[string]string)
+	for _, field := range fields {
+		raw := submitted[field.ID]
+		if strings.TrimSpace(raw) == "" && current[field.ID] != "" && keepBlank {
+			continue
+		}
+		value, err := NormalizeValue(field, raw)
+		if err != nil {
+			return err
+		}
+		if value == current[field.ID] {
+			continue
+		}
+		before[field.Key] = current[field.ID]
+		after[field.Key] = value
+		if value == "" {
+			if _, err := tx.NewDelete().TableExpr("receipt_custom_values").Where("pallet_receipt_id = ?", receiptID).Where("field_id = ?", field.ID).Exec(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO receipt_custom_values (pallet_receipt_id, field_id, value) VALUES (?, ?, ?)
+ON CONFLICT (pallet_receipt_id, field_id) DO UPDATE SET value = excluded.value`, receiptID, field.ID, value); err != nil {
+			return err
+		}
+	}
+	if len(after) == 0 || auditSvc == nil || userID <= 0 {
+		return nil
+	}
+	return auditSvc.Write(ctx, tx, userID, "receipt.custom_fields", "pallet_receipts", strconv.FormatInt(receiptID, 10),
+		map[string]any{"project_id": projectID, "values": before},
+		map[string]any{"project_id": projectID, "values": after})
+}
+
+// Value is a captured custom field value with the field it belongs to.
+type Value struct {
+	ReceiptID int64  `bun:"pallet_receipt_id"`
+	FieldID   int64  `bun:"field_id"`
+	Key       string `bun:"key"`
+	Label     string `bun:"label"`
+	FieldType string `bun:"field_type"`
+	Value     string `bun:"value"`
+}
+
+// Display formats the value for screens; dates use the UK format shown elsewhere.
+func (v Value) Display() string {
+	if v.FieldType == TypeDate {
+		if d, err := time.Parse("2006-01-02", v.Value); err == nil {
+			return d.Format("02/01/2006")
+		}
+	}
+	return v.Value
+}
+
+// LoadValues returns the captured values for each receipt in field display order.
+func LoadValues(ctx context.Context, tx bun.IDB, receiptIDs []int64) (map[int64][]Value, error) {
+	byReceipt := make(map[int64][]Value)
+	if len(receiptIDs) == 0 {
+		return byReceipt, nil
+	}
+	var rows []Value
+	if err := tx.NewRaw(`
+SELECT rcv.pallet_receipt_id, rcv.field_id, pcf.key, pcf.label, pcf.field_type, rcv.value
+FROM receipt_custom_values rcv
+JOIN project_custom_fields pcf ON pcf.id = rcv.field_id
+WHERE rcv.pallet_receipt_id IN (?)
+ORDER BY rcv.pallet_receipt_id ASC, pcf.sort_order ASC, pcf.label ASC, pcf.id ASC`, bun.In(receiptIDs)).Scan(ctx, &rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		byReceipt[row.ReceiptID] = append(byReceipt[row.ReceiptID], row)
+	}
+	return byReceipt, nil
+}
+
+// ExportSet holds the custom field columns and captured values appended to
+// exports. Columns cover every field the projects have defined, including
+// retired ones, so values captured before deactivation still export.
+type ExportSet struct {
+	keys   []string
+	values map[int64]map[string]string
+}
+
+// LoadExport loads the export columns and values for the given projects.
+// Fields sharing a key across projects share a column.
+func LoadExport(ctx context.Context, db *sqlite.DB, projectIDs ...int64) (ExportSet, error) {
+	set := ExportSet{values: make(map[int64]map[string]string)}
+	if len(projectIDs) == 0 {
+		return set, nil
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var fields []models.ProjectCustomField
+		if err := tx.NewSelect().Model(&fields).Where("project_id IN (?)", bun.In(projectIDs)).OrderExpr("sort_order ASC, label ASC, id ASC").Scan(ctx); err != nil {
+			return err
+		}
+		seen := make(map[string]bool)
+		for _, field := range fields {
+			if !seen[field.Key] {
+				seen[field.Key] = true
+				set.keys = append(set.keys, field.Key)
+			}
+		}
+
+		var rows []Value
+		if err := tx.NewRaw(`
+SELECT rcv.pallet_receipt_id, rcv.field_id, pcf.key, pcf.field_type, rcv.value
+FROM receipt_custom_values rcv
+JOIN project_custom_fields pcf ON pcf.id = rcv.field_id
+WHERE pcf.project_id IN (?)`, bun.In(projectIDs)).Scan(ctx, &rows); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if set.values[row.ReceiptID] == nil {
+				set.values[row.ReceiptID] = make(map[string]string)
+			}
+			set.values[row.ReceiptID][row.Key] = row.Display()
+		}
+		return nil
+	})
+	return set, err
+}
+
+// Header returns the export column names, e.g. custom_country_of_origin.
+func (s ExportSet) Header() []string {
+	header := make([]string, 0, len(s.keys))
+	for _, key := range s.keys {
+		header = append(header, ExportColumn(key))
+	}
+	return header
+}
+
+// Record returns a receipt's values in Header order.
+func (s ExportSet) Record(receiptID int64) []string {
+	record := make([]string, 0, len(s.keys))
+	for _, key := range s.keys {
+		record = append(record, s.values[receiptID][key])
+	}
+	return record
+}
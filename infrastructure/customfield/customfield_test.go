@@ -0,0 +1,158 @@
+package customfield
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+func openCustomFieldTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "customfield-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	return db
+}
+
+func TestNormalizeValue(t *testing.T) {
+	cases := []struct {
+		field   models.ProjectCustomField
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{models.ProjectCustomField{Label: "Origin", FieldType: TypeText}, "  Viet Nam ", "Viet Nam", false},
+		{models.ProjectCustomField{Label: "Origin", FieldType: TypeText}, " ", "", false},
+		{models.ProjectCustomField{Label: "Origin", FieldType: TypeText, Required: true}, " ", "", true},
+		{models.ProjectCustomField{Label: "PO line", FieldType: TypeNumber}, "12.5", "12.5", false},
+		{models.ProjectCustomField{Label: "PO line", FieldType: TypeNumber}, "twelve", "", true},
+		{models.ProjectCustomField{Label: "Packed", FieldType: TypeDate}, "2026-03-01", "2026-03-01", false},
+		{models.ProjectCustomField{Label: "Packed", FieldType: TypeDate}, "01/03/2026", "2026-03-01", false},
+		{models.ProjectCustomField{Label: "Packed", FieldType: TypeDate}, "March", "", true},
+	}
+	for _, tc := range cases {
+		got, err := NormalizeValue(tc.field, tc.raw)
+		if tc.wantErr {
+			if !errors.Is(err, ErrInvalidValue) {
+				t.Fatalf("NormalizeValue(%s, %q): expected ErrInvalidValue, got %q %v", tc.field.FieldType, tc.raw, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Fatalf("NormalizeValue(%s, %q) = %q %v; want %q", tc.field.FieldType, tc.raw, got, err, tc.want)
+		}
+	}
+}
+
+func TestParseForm(t *testing.T) {
+	got := ParseForm(map[string][]string{
+		"custom_field_3":   {"UK"},
+		"custom_field_x":   {"ignored"},
+		"custom_field_0":   {"ignored"},
+		"sku":              {"ignored"},
+		"custom_field_12":  {"40", "41"},
+		"custom_field_13":  {},
+		"custom_fields_14": {"ignored"},
+	})
+	want := map[int64]string{3: "UK", 12: "40"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ParseForm = %v; want %v", got, want)
+	}
+}
+
+func TestCreateUpdateAndExport(t *testing.T) {
+	db := openCustomFieldTestDB(t)
+	ctx := context.Background()
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO projects (id, name, description, project_date, client_name, code, status, created_at, updated_at)
+VALUES (1, 'Project One', 'custom fields', DATE('now'), 'Client A', 'project-one', 'active', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO users (id, username, password_hash, role, created_at, updated_at) VALUES (1, 'scanner1', 'hash', 'scanner', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO pallets (id, project_id, status, created_at) VALUES (1, 1, 'open', CURRENT_TIMESTAMP)`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed project: %v", err)
+	}
+
+	origin, err := Create(ctx, db, nil, 0, 1, "", "Country of Origin", "", true, 10)
+	if err != nil {
+		t.Fatalf("create field: %v", err)
+	}
+	if origin.Key != "country_of_origin" || origin.FieldType != TypeText || !origin.Active {
+		t.Fatalf("unexpected created field: %+v", origin)
+	}
+	if _, err := Create(ctx, db, nil, 0, 1, "Country of origin", "Origin", TypeText, false, 20); !errors.Is(err, ErrKeyExists) {
+		t.Fatalf("expected duplicate key error, got %v", err)
+	}
+	if _, err := Create(ctx, db, nil, 0, 1, "", "Weight", "decimal", false, 20); !errors.Is(err, ErrUnknownType) {
+		t.Fatalf("expected unknown type error, got %v", err)
+	}
+	packed, err := Create(ctx, db, nil, 0, 1, "packed", "Packed on", TypeDate, false, 5)
+	if err != nil {
+		t.Fatalf("create date field: %v", err)
+	}
+
+	err = db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty) VALUES (10, 1, 1, 'SKU1', 'Item', 1, 1)`); err != nil {
+			return err
+		}
+		return SaveValues(ctx, tx, nil, 0, 1, 10, map[int64]string{origin.ID: "UK", packed.ID: "01/03/2026"}, false)
+	})
+	if err != nil {
+		t.Fatalf("save values: %v", err)
+	}
+
+	if err := Update(ctx, db, nil, 0, 1, packed.ID, "Packed", false, 5, false); err != nil {
+		t.Fatalf("deactivate field: %v", err)
+	}
+	if err := Update(ctx, db, nil, 0, 2, packed.ID, "Packed", false, 5, false); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected other project update to be rejected, got %v", err)
+	}
+	active, err := List(ctx, db, 1, false)
+	if err != nil {
+		t.Fatalf("list active fields: %v", err)
+	}
+	if len(active) != 1 || active[0].ID != origin.ID {
+		t.Fatalf("expected only the active field, got %+v", active)
+	}
+
+	// Retired fields keep their export column and captured values.
+	set, err := LoadExport(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("load export: %v", err)
+	}
+	if got := set.Header(); !reflect.DeepEqual(got, []string{"custom_packed", "custom_country_of_origin"}) {
+		t.Fatalf("unexpected export header: %v", got)
+	}
+	if got := set.Record(10); !reflect.DeepEqual(got, []string{"01/03/2026", "UK"}) {
+		t.Fatalf("unexpected export record: %v", got)
+	}
+	if got := set.Record(99); !reflect.DeepEqual(got, []string{"", ""}) {
+		t.Fatalf("expected blank record for receipt without values, got %v", got)
+	}
+}
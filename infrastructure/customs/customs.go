@@ -0,0 +1,140 @@
+// Package customs validates the customs data captured on receipt lines for
+// bonded warehouse clients: the ISO 3166-1 country of origin and the HS
+// commodity code. Whether each is asked for, and whether it is required, is
+// set per project with the customs.* settings.
+package customs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"receipter/infrastructure/projectsettings"
+)
+
+var (
+	// ErrInvalid is wrapped by every validation error so handlers can show
+	// the message to the user.
+	ErrInvalid = errors.New("invalid customs data")
+
+	ErrUnknownCountry = fmt.Errorf("%w: country of origin must be an ISO 3166 country code, such as CN or GB", ErrInvalid)
+	ErrInvalidHSCode  = fmt.Errorf("%w: HS code must be 6, 8 or 10 digits", ErrInvalid)
+)
+
+// Country is one ISO 3166-1 country.
+type Country struct {
+	Code string
+	Name string
+}
+
+// Countries lists every country ordered by name.
+func Countries() []Country {
+	list := make([]Country, 0, len(countries))
+	for code, name := range countries {
+		list = append(list, Country{Code: code, Name: name})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// CountryName returns the name of an ISO code, or the code itself when it is
+// not one.
+func CountryName(code string) string {
+	if name, ok := countries[code]; ok {
+		return name
+	}
+	return code
+}
+
+// NormalizeCountry resolves raw to its alpha-2 code. It accepts the code in
+// any case, or the country's English name. Empty input stays empty.
+func NormalizeCountry(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	code := strings.ToUpper(raw)
+	if _, ok := countries[code]; ok {
+		return code, nil
+	}
+	for code, name := range countries {
+		if strings.EqualFold(name, raw) {
+			return code, nil
+		}
+	}
+	return "", ErrUnknownCountry
+}
+
+// NormalizeHSCode strips the dots and spaces HS codes are often written with
+// and checks what is left is a 6 digit subheading or an 8 or 10 digit
+// national tariff code. Empty input stays empty.
+func NormalizeHSCode(raw string) (string, error) {
+	code := strings.NewReplacer(".", "", " ", "").Replace(strings.TrimSpace(raw))
+	if code == "" {
+		return "", nil
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return "", ErrInvalidHSCode
+		}
+	}
+	switch len(code) {
+	case 6, 8, 10:
+		return code, nil
+	}
+	return "", ErrInvalidHSCode
+}
+
+// Config is which customs fields a project captures.
+type Config struct {
+	CountryOfOrigin string
+	HSCode          string
+}
+
+// LoadConfig reads the customs settings from resolved project settings.
+func LoadConfig(settings projectsettings.Settings) Config {
+	return Config{
+		CountryOfOrigin: settings.String(projectsettings.CustomsCountryOfOrigin),
+		HSCode:          settings.String(projectsettings.CustomsHSCode),
+	}
+}
+
+// Enabled reports whether the project captures any customs field.
+func (c Config) Enabled() bool {
+	return c.CaptureCountry() || c.CaptureHSCode()
+}
+
+func (c Config) CaptureCountry() bool {
+	return c.CountryOfOrigin == projectsettings.CustomsOptional || c.CountryOfOrigin == projectsettings.CustomsRequired
+}
+
+func (c Config) CaptureHSCode() bool {
+	return c.HSCode == projectsettings.CustomsOptional || c.HSCode == projectsettings.CustomsRequired
+}
+
+// Resolve normalizes the submitted values for a line. Fields the project does
+// not capture are dropped. Required fields are enforced on known SKUs only,
+// like the batch and expiry rules.
+func (c Config) Resolve(country, hsCode string, unknownSKU bool) (string, string, error) {
+	var err error
+	if !c.CaptureCountry() {
+		country = ""
+	} else if country, err = NormalizeCountry(country); err != nil {
+		return "", "", err
+	}
+	if !c.CaptureHSCode() {
+		hsCode = ""
+	} else if hsCode, err = NormalizeHSCode(hsCode); err != nil {
+		return "", "", err
+	}
+	if !unknownSKU {
+		if c.CountryOfOrigin == projectsettings.CustomsRequired && country == "" {
+			return "", "", fmt.Errorf("%w: this project requires a country of origin", projectsettings.ErrRule)
+		}
+		if c.HSCode == projectsettings.CustomsRequired && hsCode == "" {
+			return "", "", fmt.Errorf("%w: this project requires an HS code", projectsettings.ErrRule)
+		}
+	}
+	return country, hsCode, nil
+}
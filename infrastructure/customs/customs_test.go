@@ -0,0 +1,63 @@
+package customs
+
+import (
+	"errors"
+	"testing"
+
+	"receipter/infrastructure/projectsettings"
+)
+
+func TestNormalizeCountry(t *testing.T) {
+	for raw, want := range map[string]string{
+		"":               "",
+		"gb":             "GB",
+		" CN ":           "CN",
+		"united kingdom": "GB",
+		"Viet Nam":       "VN",
+	} {
+		if got, err := NormalizeCountry(raw); err != nil || got != want {
+			t.Fatalf("NormalizeCountry(%q) = %q, %v; want %q", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"UK", "XX", "Narnia"} {
+		if _, err := NormalizeCountry(raw); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("NormalizeCountry(%q) error = %v, want ErrInvalid", raw, err)
+		}
+	}
+}
+
+func TestNormalizeHSCode(t *testing.T) {
+	for raw, want := range map[string]string{
+		"":              "",
+		"392310":        "392310",
+		"8471.30.00":    "84713000",
+		"8471 30 00 00": "8471300000",
+	} {
+		if got, err := NormalizeHSCode(raw); err != nil || got != want {
+			t.Fatalf("NormalizeHSCode(%q) = %q, %v; want %q", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"3923", "3923101", "39231A"} {
+		if _, err := NormalizeHSCode(raw); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("NormalizeHSCode(%q) error = %v, want ErrInvalid", raw, err)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	cfg := Config{CountryOfOrigin: projectsettings.CustomsRequired, HSCode: projectsettings.CustomsOff}
+
+	country, hs, err := cfg.Resolve("de", "392310", false)
+	if err != nil || country != "DE" || hs != "" {
+		t.Fatalf("Resolve = %q, %q, %v; want DE with the HS code dropped", country, hs, err)
+	}
+	if _, _, err := cfg.Resolve("", "", false); !errors.Is(err, projectsettings.ErrRule) {
+		t.Fatalf("expected a missing required country rejected, got %v", err)
+	}
+	if _, _, err := cfg.Resolve("", "", true); err != nil {
+		t.Fatalf("unknown SKUs may skip required fields, got %v", err)
+	}
+	if _, _, err := (Config{}).Resolve("XX", "1", false); err != nil {
+		t.Fatalf("fields a project does not capture are not validated, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package damage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+var (
+	ErrReasonRequired = errors.New("damage reason is required when damaged qty is greater than 0")
+	ErrUnknownReason  = errors.New("damage reason is not recognised")
+	ErrCodeRequired   = errors.New("damage reason code is required")
+	ErrLabelRequired  = errors.New("damage reason label is required")
+	ErrCodeExists     = errors.New("damage reason code already exists")
+)
+
+var codeRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// NormalizeCode converts free text into a stable reason code, e.g. "Seal Broken" -> "seal_broken".
+func NormalizeCode(raw string) string {
+	v := strings.ToLower(strings.TrimSpace(raw))
+	v = codeRegex.ReplaceAllString(v, "_")
+	v = strings.Trim(v, "_")
+	if len(v) > 64 {
+		v = v[:64]
+	}
+	return v
+}
+
+// List returns reasons ordered for display. Inactive reasons are only included when requested.
+func List(ctx context.Context, db *sqlite.DB, includeInactive bool) ([]models.DamageReason, error) {
+	reasons := make([]models.DamageReason, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		q := tx.NewSelect().Model(&reasons).OrderExpr("sort_order ASC, label ASC, code ASC")
+		if !includeInactive {
+			q = q.Where("active = 1")
+		}
+		return q.Scan(ctx)
+	})
+	return reasons, err
+}
+
+// ValidateActiveCode checks a submitted reason against the active taxonomy inside the caller transaction.
+func ValidateActiveCode(ctx context.Context, tx bun.Tx, code string) (string, error) {
+	code = NormalizeCode(code)
+	if code == "" {
+		return "", ErrReasonRequired
+	}
+	var count int
+	if err := tx.NewRaw(`SELECT COUNT(1) FROM damage_reasons WHERE code = ? AND active = 1`, code).Scan(ctx, &count); err != nil {
+		return "", err
+	}
+	if count == 0 {
+		return "", ErrUnknownReason
+	}
+	return code, nil
+}
+
+func Create(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID int64, code, label string, sortOrder int) (models.DamageReason, error) {
+	var reason models.DamageReason
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return reason, ErrLabelRequired
+	}
+	code = NormalizeCode(code)
+	if code == "" {
+		code = NormalizeCode(label)
+	}
+	if code == "" {
+		return reason, ErrCodeRequired
+	}
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var count int
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM damage_reasons WHERE code = ?`, code).Scan(ctx, &count); err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrCodeExists
+		}
+		reason = models.DamageReason{
+			Code:      code,
+			Label:     label,
+			SortOrder: sortOrder,
+			Active:    true,
+		}
+		if _, err := tx.NewInsert().Model(&reason).Exec(ctx); err != nil {
+			return err
+		}
+		if auditSvc != nil && userID > 0 {
+			return auditSvc.Write(ctx, tx, userID, "damage_reason.create", "damage_reasons", code, nil, reason)
+		}
+		return nil
+	})
+	return reason, err
+}
+
+func Update(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID int64, code, label string, sortOrder int, active bool) error {
+	code = NormalizeCode(code)
+	if code == "" {
+		return ErrCodeRequired
+	}
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return ErrLabelRequired
+	}
+
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var existing models.DamageReason
+		if err := tx.NewSelect().Model(&existing).Where("code = ?", code).Limit(1).Scan(ctx); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("damage reason %q not found", code)
+			}
+			return err
+		}
+		before := existing
+		existing.Label = label
+		existing.SortOrder = sortOrder
+		existing.Active = active
+		existing.UpdatedAt = time.Now()
+		if _, err := tx.NewUpdate().Model(&existing).WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		if auditSvc != nil && userID > 0 {
+			return auditSvc.Write(ctx, tx, userID, "damage_reason.update", "damage_reasons", code, before, existing)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,105 @@
+package damage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func openDamageTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "damage-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	return db
+}
+
+func TestNormalizeCode(t *testing.T) {
+	cases := map[string]string{
+		"Seal Broken":  "seal_broken",
+		"  WET  ":      "wet",
+		"Temp--Excur!": "temp_excur",
+		"__crushed__":  "crushed",
+		"":             "",
+	}
+	for in, want := range cases {
+		if got := NormalizeCode(in); got != want {
+			t.Fatalf("NormalizeCode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCreateUpdateAndValidate(t *testing.T) {
+	db := openDamageTestDB(t)
+	ctx := context.Background()
+
+	seeded, err := List(ctx, db, false)
+	if err != nil {
+		t.Fatalf("list seeded reasons: %v", err)
+	}
+	if len(seeded) == 0 || seeded[0].Code != "crushed" {
+		t.Fatalf("expected seeded reasons ordered by sort order, got %+v", seeded)
+	}
+
+	created, err := Create(ctx, db, nil, 0, "", "Pest Damage", 50)
+	if err != nil {
+		t.Fatalf("create reason: %v", err)
+	}
+	if created.Code != "pest_damage" || !created.Active {
+		t.Fatalf("unexpected created reason: %+v", created)
+	}
+	if _, err := Create(ctx, db, nil, 0, "pest damage", "Pests", 60); !errors.Is(err, ErrCodeExists) {
+		t.Fatalf("expected duplicate code error, got %v", err)
+	}
+	if _, err := Create(ctx, db, nil, 0, "x", " ", 60); !errors.Is(err, ErrLabelRequired) {
+		t.Fatalf("expected label required error, got %v", err)
+	}
+
+	if err := Update(ctx, db, nil, 0, "pest_damage", "Pest damage", 55, false); err != nil {
+		t.Fatalf("deactivate reason: %v", err)
+	}
+	active, err := List(ctx, db, false)
+	if err != nil {
+		t.Fatalf("list active reasons: %v", err)
+	}
+	for _, reason := range active {
+		if reason.Code == "pest_damage" {
+			t.Fatalf("inactive reason should not be listed: %+v", reason)
+		}
+	}
+
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := ValidateActiveCode(ctx, tx, "pest_damage"); !errors.Is(err, ErrUnknownReason) {
+			t.Fatalf("expected inactive reason to be rejected, got %v", err)
+		}
+		if _, err := ValidateActiveCode(ctx, tx, ""); !errors.Is(err, ErrReasonRequired) {
+			t.Fatalf("expected reason required error, got %v", err)
+		}
+		code, err := ValidateActiveCode(ctx, tx, "Seal Broken")
+		if err != nil || code != "seal_broken" {
+			t.Fatalf("expected seal_broken to validate, got %q %v", code, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("validate reasons: %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+// Package delivery queues outbound webhook and email sends. A background
+// Worker sends due deliveries, backs off exponentially on failure, pauses
+// endpoints that keep failing, and dead-letters deliveries that run out of
+// attempts so an admin can inspect and retry them.
+package delivery
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+const (
+	KindWebhook = "webhook"
+	KindEmail   = "email"
+
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+
+	// maxErrorLength keeps a chatty error page from bloating the table.
+	maxErrorLength = 1000
+)
+
+var (
+	ErrNotFound    = errors.New("delivery not found")
+	ErrDelivered   = errors.New("delivery has already been delivered")
+	ErrInvalidKind = errors.New("delivery kind must be webhook or email")
+	ErrNoEndpoint  = errors.New("delivery endpoint is required")
+	ErrNoSender    = errors.New("no sender configured for this delivery kind")
+)
+
+// Policy controls retries, the per-endpoint circuit breaker and how long
+// finished deliveries are kept.
+type Policy struct {
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// BreakerThreshold consecutive failures open an endpoint's circuit for
+	// BreakerCooldown; the first send after the cooldown decides whether it
+	// closes again.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// Retention is how long delivered and dead deliveries are kept.
+	Retention time.Duration
+}
+
+var DefaultPolicy = Policy{
+	MaxAttempts:      8,
+	BaseBackoff:      30 * time.Second,
+	MaxBackoff:       6 * time.Hour,
+	BreakerThreshold: 5,
+	BreakerCooldown:  10 * time.Minute,
+	Retention:        30 * 24 * time.Hour,
+}
+
+// Backoff returns the wait before the next attempt once attempts sends have
+// failed: BaseBackoff doubled per failure, capped at MaxBackoff.
+func (p Policy) Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return 0
+	}
+	wait := p.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	if wait > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return wait
+}
+
+// ProjectWebhook ties a webhook delivery to the client project webhook that
+// raised it. Secret signs the payload when it is queued.
+type ProjectWebhook struct {
+	ProjectID int64
+	WebhookID int64
+	Secret    string
+}
+
+// Enqueue records a delivery inside the caller's transaction so it is only
+// sent if the change that raised it commits. Call Worker.Notify afterwards.
+func Enqueue(ctx context.Context, tx bun.Tx, kind, endpoint, event string, payload []byte) (int64, error) {
+	return insertDelivery(ctx, tx, kind, endpoint, event, payload, nil)
+}
+
+// EnqueueProjectWebhook queues a signed webhook delivery for a client
+// project webhook, so it shows in that project's delivery log.
+func EnqueueProjectWebhook(ctx context.Context, tx bun.Tx, hook ProjectWebhook, endpoint, event string, payload []byte) (int64, error) {
+	return insertDelivery(ctx, tx, KindWebhook, endpoint, event, payload, &hook)
+}
+
+// Sign returns the hex HMAC-SHA256 of payload under secret, as sent in the
+// X-Receipter-Signature header.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func insertDelivery(ctx context.Context, tx bun.Tx, kind, endpoint, event string, payload []byte, hook *ProjectWebhook) (int64, error) {
+	if kind != KindWebhook && kind != KindEmail {
+		return 0, ErrInvalidKind
+	}
+	if endpoint == "" {
+		return 0, ErrNoEndpoint
+	}
+	now := time.Now().UTC()
+	d := models.Delivery{
+		Kind:          kind,
+		Endpoint:      endpoint,
+		Event:         event,
+		Payload:       string(payload),
+		Status:        StatusPending,
+		MaxAttempts:   DefaultPolicy.MaxAttempts,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if hook != nil {
+		d.ProjectID = &hook.ProjectID
+		d.WebhookID = &hook.WebhookID
+		d.Signature = Sign(hook.Secret, payload)
+	}
+	if _, err := tx.NewInsert().Model(&d).Exec(ctx); err != nil {
+		return 0, err
+	}
+	return d.ID, nil
+}
+
+// Retry sends a pending or dead delivery again as soon as the worker wakes,
+// with a fresh attempt budget. The endpoint's circuit is half-opened so the
+// retry is not held back; one more failure opens it again.
+func Retry(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, id int64) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var before models.Delivery
+		if err := tx.NewSelect().Model(&before).Where("id = ?", id).Scan(ctx); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		if before.Status == StatusDelivered {
+			return ErrDelivered
+		}
+		now := time.Now().UTC()
+		if _, err := tx.ExecContext(ctx, `
+UPDATE deliveries
+SET status = ?, attempts = 0, next_attempt_at = ?, updated_at = ?
+WHERE id = ?`, StatusPending, now, now, id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE delivery_endpoints SET open_until = NULL, updated_at = ? WHERE endpoint = ?`, now, before.Endpoint); err != nil {
+			return err
+		}
+		return auditSvc.Write(ctx, tx, userID, "delivery.retry", "deliveries", strconv.FormatInt(id, 10),
+			map[string]any{"status": before.Status, "attempts": before.Attempts, "last_error": before.LastError},
+			map[string]any{"status": StatusPending, "attempts": 0})
+	})
+}
+
+// Prune deletes delivered and dead deliveries last touched before cutoff and
+// returns how many were removed.
+func Prune(ctx context.Context, db *sqlite.DB, cutoff time.Time) (int64, error) {
+	var removed int64
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM deliveries WHERE status IN (?, ?) AND updated_at < ?`, StatusDelivered, StatusDead, cutoff.UTC())
+		if err != nil {
+			return err
+		}
+		removed, err = res.RowsAffected()
+		return err
+	})
+	return removed, err
+}
+
+func truncateError(err error) string {
+	msg := err.Error()
+	if len(msg) > maxErrorLength {
+		return msg[:maxErrorLength]
+	}
+	return msg
+}
@@ -0,0 +1,392 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+func openDeliveryTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "delivery-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO users (id, username, password_hash, role, created_at, updated_at) VALUES (1, 'admin', 'hash', 'admin', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed admin: %v", err)
+	}
+	return db
+}
+
+type fakeSender struct {
+	err   error
+	calls int
+}
+
+func (s *fakeSender) Send(context.Context, models.Delivery) error {
+	s.calls++
+	return s.err
+}
+
+func enqueue(t *testing.T, db *sqlite.DB, kind, endpoint string) int64 {
+	t.Helper()
+	var id int64
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		id, err = Enqueue(ctx, tx, kind, endpoint, "pallet.closed", []byte(`{"pallet_id":1}`))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	return id
+}
+
+func loadDelivery(t *testing.T, db *sqlite.DB, id int64) models.Delivery {
+	t.Helper()
+	var d models.Delivery
+	err := db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewSelect().Model(&d).Where("id = ?", id).Scan(ctx)
+	})
+	if err != nil {
+		t.Fatalf("load delivery: %v", err)
+	}
+	return d
+}
+
+// newTestWorker returns a worker whose clock advances only when the test
+// moves it. It starts slightly ahead so deliveries queued by the test are due.
+func newTestWorker(db *sqlite.DB, senders map[string]Sender) (*Worker, *time.Time) {
+	w := NewWorker(db, senders)
+	clock := time.Now().UTC().Add(time.Minute)
+	w.now = func() time.Time { return clock }
+	return w, &clock
+}
+
+func TestPolicyBackoffDoublesAndCaps(t *testing.T) {
+	p := Policy{BaseBackoff: 30 * time.Second, MaxBackoff: 5 * time.Minute}
+	cases := map[int]time.Duration{
+		0: 0,
+		1: 30 * time.Second,
+		2: time.Minute,
+		4: 4 * time.Minute,
+		5: 5 * time.Minute,
+		9: 5 * time.Minute,
+	}
+	for attempts, want := range cases {
+		if got := p.Backoff(attempts); got != want {
+			t.Fatalf("Backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
+
+func TestProcessDueDeliversAndClearsError(t *testing.T) {
+	db := openDeliveryTestDB(t)
+	sender := &fakeSender{}
+	w, _ := newTestWorker(db, map[string]Sender{KindWebhook: sender})
+	id := enqueue(t, db, KindWebhook, "https://example.test/hook")
+
+	n, err := w.ProcessDue(context.Background())
+	if err != nil {
+		t.Fatalf("process due: %v", err)
+	}
+	if n != 1 || sender.calls != 1 {
+		t.Fatalf("expected one attempt, got processed=%d calls=%d", n, sender.calls)
+	}
+	d := loadDelivery(t, db, id)
+	if d.Status != StatusDelivered || d.Attempts != 1 || d.DeliveredAt == nil {
+		t.Fatalf("expected delivered after one attempt, got %+v", d)
+	}
+}
+
+func TestProcessDueBacksOffThenDeadLetters(t *testing.T) {
+	db := openDeliveryTestDB(t)
+	sender := &fakeSender{err: errors.New("connection refused")}
+	w, clock := newTestWorker(db, map[string]Sender{KindWebhook: sender})
+	w.policy.BreakerThreshold = 100
+	id := enqueue(t, db, KindWebhook, "https://example.test/hook")
+
+	if _, err := w.ProcessDue(context.Background()); err != nil {
+		t.Fatalf("process due: %v", err)
+	}
+	d := loadDelivery(t, db, id)
+	if d.Status != StatusPending || d.Attempts != 1 || d.LastError != "connection refused" {
+		t.Fatalf("expected pending retry after first failure, got %+v", d)
+	}
+	if wait := d.NextAttemptAt.Sub(*clock); wait < w.policy.BaseBackoff-time.Millisecond || wait > w.policy.BaseBackoff {
+		t.Fatalf("expected next attempt after base backoff, got %s", d.NextAttemptAt)
+	}
+
+	// Not due yet: nothing is sent.
+	if n, err := w.ProcessDue(context.Background()); err != nil || n != 0 {
+		t.Fatalf("expected nothing due, got n=%d err=%v", n, err)
+	}
+
+	for i := 1; i < d.MaxAttempts; i++ {
+		*clock = clock.Add(w.policy.MaxBackoff)
+		if _, err := w.ProcessDue(context.Background()); err != nil {
+			t.Fatalf("process due: %v", err)
+		}
+	}
+	d = loadDelivery(t, db, id)
+	if d.Status != StatusDead || d.Attempts != d.MaxAttempts {
+		t.Fatalf("expected dead-lettered after %d attempts, got %+v", d.MaxAttempts, d)
+	}
+	if sender.calls != d.MaxAttempts {
+		t.Fatalf("expected %d sends, got %d", d.MaxAttempts, sender.calls)
+	}
+}
+
+func TestProcessDueOpensCircuitPerEndpoint(t *testing.T) {
+	db := openDeliveryTestDB(t)
+	sender := &fakeSender{err: errors.New("503")}
+	w, clock := newTestWorker(db, map[string]Sender{KindWebhook: sender})
+	w.policy.BreakerThreshold = 2
+	w.policy.BaseBackoff = 0
+
+	bad := "https://bad.test/hook"
+	enqueue(t, db, KindWebhook, bad)
+	enqueue(t, db, KindWebhook, bad)
+	held := enqueue(t, db, KindWebhook, bad)
+
+	if _, err := w.ProcessDue(context.Background()); err != nil {
+		t.Fatalf("process due: %v", err)
+	}
+	if sender.calls != 2 {
+		t.Fatalf("expected the circuit to open after 2 failures, got %d sends", sender.calls)
+	}
+	if d := loadDelivery(t, db, held); d.Attempts != 0 || d.Status != StatusPending {
+		t.Fatalf("expected held delivery untouched while circuit is open, got %+v", d)
+	}
+
+	// Other endpoints are unaffected.
+	sender.err = nil
+	good := enqueue(t, db, KindWebhook, "https://good.test/hook")
+	if _, err := w.ProcessDue(context.Background()); err != nil {
+		t.Fatalf("process due: %v", err)
+	}
+	if d := loadDelivery(t, db, good); d.Status != StatusDelivered {
+		t.Fatalf("expected other endpoint delivered, got %+v", d)
+	}
+	if d := loadDelivery(t, db, held); d.Attempts != 0 {
+		t.Fatalf("expected held delivery still waiting, got %+v", d)
+	}
+
+	// After the cooldown the endpoint is tried again and a success closes it.
+	*clock = clock.Add(w.policy.BreakerCooldown + time.Second)
+	if _, err := w.ProcessDue(context.Background()); err != nil {
+		t.Fatalf("process due: %v", err)
+	}
+	if d := loadDelivery(t, db, held); d.Status != StatusDelivered {
+		t.Fatalf("expected held delivery sent after cooldown, got %+v", d)
+	}
+	var failures int
+	err := db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT consecutive_failures FROM delivery_endpoints WHERE endpoint = ?`, bad).Scan(ctx, &failures)
+	})
+	if err != nil || failures != 0 {
+		t.Fatalf("expected breaker reset after success, failures=%d err=%v", failures, err)
+	}
+}
+
+func TestProcessDueWithoutSenderDeadLettersWithoutTrippingBreaker(t *testing.T) {
+	db := openDeliveryTestDB(t)
+	w, clock := newTestWorker(db, map[string]Sender{})
+	id := enqueue(t, db, KindEmail, "ops@example.test")
+
+	for i := 0; i < DefaultPolicy.MaxAttempts; i++ {
+		if _, err := w.ProcessDue(context.Background()); err != nil {
+			t.Fatalf("process due: %v", err)
+		}
+		*clock = clock.Add(w.policy.MaxBackoff)
+	}
+	d := loadDelivery(t, db, id)
+	if d.Status != StatusDead || d.LastError != ErrNoSender.Error() {
+		t.Fatalf("expected dead-lettered with no sender error, got %+v", d)
+	}
+	var endpoints int
+	_ = db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT COUNT(1) FROM delivery_endpoints`).Scan(ctx, &endpoints)
+	})
+	if endpoints != 0 {
+		t.Fatalf("expected no breaker state for unsent deliveries, got %d", endpoints)
+	}
+}
+
+func TestRetryRequeuesDeadDeliveryAndAudits(t *testing.T) {
+	db := openDeliveryTestDB(t)
+	id := enqueue(t, db, KindWebhook, "https://example.test/hook")
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(ctx, `UPDATE deliveries SET status = 'dead', attempts = 8, last_error = 'timeout' WHERE id = ?`, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO delivery_endpoints (endpoint, consecutive_failures, open_until) VALUES (?, 9, ?)`, "https://example.test/hook", time.Now().UTC().Add(time.Hour))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed dead delivery: %v", err)
+	}
+
+	if err := Retry(context.Background(), db, audit.NewService(), 1, id); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	d := loadDelivery(t, db, id)
+	if d.Status != StatusPending || d.Attempts != 0 || d.LastError != "timeout" {
+		t.Fatalf("expected requeued delivery keeping its last error, got %+v", d)
+	}
+
+	sender := &fakeSender{}
+	w := NewWorker(db, map[string]Sender{KindWebhook: sender})
+	if _, err := w.ProcessDue(context.Background()); err != nil {
+		t.Fatalf("process due: %v", err)
+	}
+	if sender.calls != 1 {
+		t.Fatalf("expected retry to bypass the open circuit, got %d sends", sender.calls)
+	}
+
+	var audits int
+	_ = db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT COUNT(1) FROM audit_logs WHERE action = 'delivery.retry'`).Scan(ctx, &audits)
+	})
+	if audits != 1 {
+		t.Fatalf("expected one retry audit entry, got %d", audits)
+	}
+
+	if err := Retry(context.Background(), db, audit.NewService(), 1, id); !errors.Is(err, ErrDelivered) {
+		t.Fatalf("expected ErrDelivered, got %v", err)
+	}
+	if err := Retry(context.Background(), db, audit.NewService(), 1, 999); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestPruneRemovesOnlyFinishedDeliveriesPastRetention(t *testing.T) {
+	db := openDeliveryTestDB(t)
+	oldDelivered := enqueue(t, db, KindWebhook, "https://example.test/a")
+	oldDead := enqueue(t, db, KindWebhook, "https://example.test/b")
+	oldPending := enqueue(t, db, KindWebhook, "https://example.test/c")
+	recentDead := enqueue(t, db, KindWebhook, "https://example.test/d")
+	old := time.Now().UTC().Add(-40 * 24 * time.Hour)
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(ctx, `UPDATE deliveries SET status = 'delivered', updated_at = ? WHERE id = ?`, old, oldDelivered); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE deliveries SET status = 'dead', updated_at = ? WHERE id = ?`, old, oldDead); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE deliveries SET updated_at = ? WHERE id = ?`, old, oldPending); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE deliveries SET status = 'dead' WHERE id = ?`, recentDead)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("age deliveries: %v", err)
+	}
+
+	removed, err := Prune(context.Background(), db, time.Now().UTC().Add(-DefaultPolicy.Retention))
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if removed != 2 {
+		t.Fatalf("expected 2 deliveries pruned, got %d", removed)
+	}
+	loadDelivery(t, db, oldPending)
+	loadDelivery(t, db, recentDead)
+}
+
+func TestWebhookSenderTreatsNon2xxAsFailure(t *testing.T) {
+	var gotEvent, gotType string
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotEvent = r.Header.Get("X-Receipter-Event")
+		gotType = r.Header.Get("Content-Type")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("try later"))
+	}))
+	defer srv.Close()
+
+	sender := NewWebhookSender(srv.Client())
+	d := models.Delivery{ID: 7, Endpoint: srv.URL, Event: "pallet.closed", Payload: `{}`}
+	if err := sender.Send(context.Background(), d); err != nil {
+		t.Fatalf("expected success on 204, got %v", err)
+	}
+	if gotEvent != "pallet.closed" || gotType != "application/json" {
+		t.Fatalf("unexpected headers event=%q content-type=%q", gotEvent, gotType)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := sender.Send(context.Background(), d); err == nil {
+		t.Fatalf("expected error on 503")
+	}
+}
+
+func TestEnqueueProjectWebhookSignsPayload(t *testing.T) {
+	db := openDeliveryTestDB(t)
+	payload := []byte(`{"event":"pallet.closed"}`)
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'P', 'd', DATE('now'), 'C', 'p', 'active')`,
+			`INSERT INTO project_webhooks (id, project_id, url, secret, events, created_by_user_id) VALUES (1, 1, 'https://client.example.test/hook', 'whsec_test', 'pallet.closed', 1)`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		_, err := EnqueueProjectWebhook(ctx, tx, ProjectWebhook{ProjectID: 1, WebhookID: 1, Secret: "whsec_test"}, "https://client.example.test/hook", "pallet.closed", payload)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	var d models.Delivery
+	if err := db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewSelect().Model(&d).Limit(1).Scan(ctx)
+	}); err != nil {
+		t.Fatalf("load delivery: %v", err)
+	}
+	if d.ProjectID == nil || *d.ProjectID != 1 || d.Signature != Sign("whsec_test", payload) {
+		t.Fatalf("unexpected project delivery: %+v", d)
+	}
+
+	var gotSignature string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSignature = r.Header.Get("X-Receipter-Signature")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	d.Endpoint = srv.URL
+	if err := NewWebhookSender(srv.Client()).Send(context.Background(), d); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if gotSignature != "sha256="+d.Signature {
+		t.Fatalf("expected signature header, got %q", gotSignature)
+	}
+}
@@ -0,0 +1,58 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"receipter/models"
+)
+
+const webhookTimeout = 15 * time.Second
+
+// WebhookSender POSTs the delivery payload as JSON to its endpoint, signed
+// with X-Receipter-Signature when the delivery carries a signature. Any
+// non-2xx response is a failed attempt.
+type WebhookSender struct {
+	client *http.Client
+}
+
+// NewWebhookSender returns a sender using client, or a client with a short
+// timeout when client is nil.
+func NewWebhookSender(client *http.Client) *WebhookSender {
+	if client == nil {
+		client = &http.Client{Timeout: webhookTimeout}
+	}
+	return &WebhookSender{client: client}
+}
+
+func (s *WebhookSender) Send(ctx context.Context, d models.Delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Endpoint, bytes.NewBufferString(d.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Receipter-Webhook")
+	req.Header.Set("X-Receipter-Event", d.Event)
+	req.Header.Set("X-Receipter-Delivery", strconv.FormatInt(d.ID, 10))
+	if d.Signature != "" {
+		req.Header.Set("X-Receipter-Signature", "sha256="+d.Signature)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,210 @@
+package delivery
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+const (
+	workerPollInterval = 30 * time.Second
+	// claimLease pushes a claimed delivery's next attempt out while it is
+	// being sent, so a crash mid-send only delays it rather than losing it.
+	claimLease = 10 * time.Minute
+)
+
+// Sender sends one delivery. A returned error counts as a failed attempt.
+type Sender interface {
+	Send(ctx context.Context, d models.Delivery) error
+}
+
+// Worker sends due deliveries in the background.
+type Worker struct {
+	db      *sqlite.DB
+	senders map[string]Sender
+	policy  Policy
+	now     func() time.Time
+
+	// Paused, when set before Start, holds sends and pruning while it
+	// returns true. The server wires it to maintenance mode.
+	Paused func() bool
+
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	started atomic.Bool
+}
+
+// NewWorker returns a worker that sends each kind through senders. Kinds
+// without a sender fail every attempt and end up dead-lettered.
+func NewWorker(db *sqlite.DB, senders map[string]Sender) *Worker {
+	return &Worker{
+		db:      db,
+		senders: senders,
+		policy:  DefaultPolicy,
+		now:     func() time.Time { return time.Now().UTC() },
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Notify wakes the worker after a delivery has been queued or retried. Safe
+// on a nil worker.
+func (w *Worker) Notify() {
+	if w == nil {
+		return
+	}
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the worker until Stop.
+func (w *Worker) Start() {
+	w.started.Store(true)
+	go func() {
+		defer close(w.done)
+		ctx := context.Background()
+		ticker := time.NewTicker(workerPollInterval)
+		defer ticker.Stop()
+		for {
+			if w.Paused == nil || !w.Paused() {
+				if _, err := w.ProcessDue(ctx); err != nil {
+					slog.Error("deliveries: processing failed", slog.Any("err", err))
+				}
+				if _, err := Prune(ctx, w.db, w.now().Add(-w.policy.Retention)); err != nil {
+					slog.Error("deliveries: prune failed", slog.Any("err", err))
+				}
+			}
+			select {
+			case <-w.stop:
+				return
+			case <-w.wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends a started worker and waits for the current send to finish.
+func (w *Worker) Stop() {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+	if !w.started.Load() {
+		return
+	}
+	select {
+	case <-w.done:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+// ProcessDue sends deliveries whose next attempt is due, skipping endpoints
+// with an open circuit, until none remain. It returns how many it attempted.
+func (w *Worker) ProcessDue(ctx context.Context) (int, error) {
+	attempted := 0
+	for {
+		d, ok, err := w.claimNext(ctx)
+		if err != nil {
+			return attempted, err
+		}
+		if !ok {
+			return attempted, nil
+		}
+		sendErr := ErrNoSender
+		if sender, found := w.senders[d.Kind]; found && sender != nil {
+			sendErr = sender.Send(ctx, d)
+		}
+		if err := w.record(ctx, d, sendErr); err != nil {
+			return attempted, err
+		}
+		attempted++
+	}
+}
+
+func (w *Worker) claimNext(ctx context.Context) (models.Delivery, bool, error) {
+	var d models.Delivery
+	now := w.now()
+	err := w.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewSelect().
+			Model(&d).
+			Where("d.status = ?", StatusPending).
+			Where("d.next_attempt_at <= ?", now).
+			Where("NOT EXISTS (SELECT 1 FROM delivery_endpoints e WHERE e.endpoint = d.endpoint AND e.open_until > ?)", now).
+			OrderExpr("d.next_attempt_at ASC, d.id ASC").
+			Limit(1).
+			Scan(ctx); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE deliveries SET next_attempt_at = ?, updated_at = ? WHERE id = ?`, now.Add(claimLease), now, d.ID)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return d, false, nil
+	}
+	return d, err == nil, err
+}
+
+// record stores the outcome of one attempt and updates the endpoint's
+// circuit breaker.
+func (w *Worker) record(ctx context.Context, d models.Delivery, sendErr error) error {
+	now := w.now()
+	attempts := d.Attempts + 1
+	return w.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if sendErr == nil {
+			if _, err := tx.ExecContext(ctx, `
+UPDATE deliveries
+SET status = ?, attempts = ?, last_error = '', delivered_at = ?, updated_at = ?
+WHERE id = ?`, StatusDelivered, attempts, now, now, d.ID); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, `
+INSERT INTO delivery_endpoints (endpoint, consecutive_failures, open_until, updated_at)
+VALUES (?, 0, NULL, ?)
+ON CONFLICT(endpoint) DO UPDATE SET consecutive_failures = 0, open_until = NULL, updated_at = excluded.updated_at`, d.Endpoint, now)
+			return err
+		}
+
+		status, next := StatusPending, now.Add(w.policy.Backoff(attempts))
+		if attempts >= d.MaxAttempts {
+			status, next = StatusDead, now
+		}
+		if _, err := tx.ExecContext(ctx, `
+UPDATE deliveries
+SET status = ?, attempts = ?, last_error = ?, next_attempt_at = ?, updated_at = ?
+WHERE id = ?`, status, attempts, truncateError(sendErr), next, now, d.ID); err != nil {
+			return err
+		}
+		if errors.Is(sendErr, ErrNoSender) {
+			// Nothing was sent, so the endpoint itself has not failed.
+			return nil
+		}
+		var failures int
+		if err := tx.NewRaw(`
+INSERT INTO delivery_endpoints (endpoint, consecutive_failures, updated_at)
+VALUES (?, 1, ?)
+ON CONFLICT(endpoint) DO UPDATE SET consecutive_failures = consecutive_failures + 1, updated_at = excluded.updated_at
+RETURNING consecutive_failures`, d.Endpoint, now).Scan(ctx, &failures); err != nil {
+			return err
+		}
+		if failures < w.policy.BreakerThreshold {
+			return nil
+		}
+		slog.Warn("deliveries: endpoint circuit opened", slog.String("endpoint", d.Endpoint), slog.Int("consecutive_failures", failures))
+		_, err := tx.ExecContext(ctx, `UPDATE delivery_endpoints SET open_until = ? WHERE endpoint = ?`, now.Add(w.policy.BreakerCooldown), d.Endpoint)
+		return err
+	})
+}
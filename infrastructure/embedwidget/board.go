@@ -0,0 +1,91 @@
+package embedwidget
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+// BoardPollInterval is how often the warehouse display board refreshes.
+// Board responses are revalidated on every poll rather than cached.
+const BoardPollInterval = 10 * time.Second
+
+// BoardProject is one project's row on the display board.
+type BoardProject struct {
+	ProjectID       int64  `bun:"project_id" json:"project_id"`
+	Name            string `bun:"name" json:"name"`
+	Status          string `bun:"status" json:"status"`
+	PalletsCreated  int64  `bun:"pallets_created" json:"pallets_created"`
+	PalletsOpen     int64  `bun:"pallets_open" json:"pallets_open"`
+	PalletsClosed   int64  `bun:"pallets_closed" json:"pallets_closed"`
+	PalletsLabelled int64  `bun:"pallets_labelled" json:"pallets_labelled"`
+	UnitsToday      int64  `bun:"units_today" json:"units_today"`
+}
+
+// BoardPallet is an open pallet listed on the display board.
+type BoardPallet struct {
+	ID             int64  `bun:"id" json:"id"`
+	ProjectID      int64  `bun:"project_id" json:"project_id"`
+	ProjectName    string `bun:"project_name" json:"project_name"`
+	Lines          int64  `bun:"lines" json:"lines"`
+	Units          int64  `bun:"units" json:"units"`
+	LastReceivedAt string `bun:"last_received_at" json:"last_received_at,omitempty"`
+}
+
+// Board is the display board payload. Units today count lines first
+// receipted since midnight UTC, as the daily KPI snapshots do.
+type Board struct {
+	Name        string         `json:"name"`
+	Projects    []BoardProject `json:"projects"`
+	OpenPallets []BoardPallet  `json:"open_pallets"`
+	UnitsToday  int64          `json:"units_today"`
+	GeneratedAt time.Time      `json:"generated_at"`
+}
+
+// LoadBoard loads the display board for projectIDs. Cancelled pallets are
+// left out, as on the summary widget.
+func LoadBoard(ctx context.Context, db *sqlite.DB, name string, projectIDs []int64, now time.Time) (Board, error) {
+	board := Board{Name: name, Projects: make([]BoardProject, 0, len(projectIDs)), OpenPallets: make([]BoardPallet, 0), GeneratedAt: now.UTC()}
+	if len(projectIDs) == 0 {
+		return board, nil
+	}
+	today := now.UTC().Truncate(24 * time.Hour)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`
+SELECT pj.id AS project_id, pj.name, pj.status,
+       (SELECT COUNT(1) FROM pallets p WHERE p.project_id = pj.id AND p.status = 'created') AS pallets_created,
+       (SELECT COUNT(1) FROM pallets p WHERE p.project_id = pj.id AND p.status = 'open') AS pallets_open,
+       (SELECT COUNT(1) FROM pallets p WHERE p.project_id = pj.id AND p.status = 'closed') AS pallets_closed,
+       (SELECT COUNT(1) FROM pallets p WHERE p.project_id = pj.id AND p.status = 'labelled') AS pallets_labelled,
+       (SELECT COALESCE(SUM(pr.qty), 0)
+        FROM pallet_receipts pr
+        JOIN pallets p ON p.id = pr.pallet_id AND p.status <> 'cancelled'
+        WHERE pr.project_id = pj.id AND julianday(pr.created_at) >= julianday(?)) AS units_today
+FROM projects pj
+WHERE pj.id IN (?)
+ORDER BY pj.name ASC, pj.id ASC`, today, bun.In(projectIDs)).Scan(ctx, &board.Projects); err != nil {
+			return err
+		}
+		return tx.NewRaw(`
+SELECT p.id, p.project_id, pj.name AS project_name,
+       COUNT(pr.id) AS lines,
+       COALESCE(SUM(pr.qty), 0) AS units,
+       COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', MAX(pr.created_at)), '') AS last_received_at
+FROM pallets p
+JOIN projects pj ON pj.id = p.project_id
+LEFT JOIN pallet_receipts pr ON pr.pallet_id = p.id
+WHERE p.project_id IN (?) AND p.status = 'open'
+GROUP BY p.id
+ORDER BY p.id ASC`, bun.In(projectIDs)).Scan(ctx, &board.OpenPallets)
+	})
+	if err != nil {
+		return board, err
+	}
+	for _, p := range board.Projects {
+		board.UnitsToday += p.UnitsToday
+	}
+	return board, nil
+}
@@ -0,0 +1,264 @@
+// Package embedwidget issues revocable tokens for the read-only receiving
+// summary that clients embed on their own intranet. The token is part of the
+// widget URL, since an iframe cannot send an Authorization header.
+package embedwidget
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+const tokenPrefix = "embed_"
+
+// CacheMaxAge is how long browsers and proxies may reuse a widget response,
+// and so the longest a revoked token can keep showing cached totals.
+const CacheMaxAge = 60 * time.Second
+
+var (
+	ErrNameRequired     = errors.New("widget name is required")
+	ErrProjectsRequired = errors.New("select at least one project for the widget")
+	ErrUnknownProject   = errors.New("widget project not found")
+	ErrInvalidToken     = errors.New("invalid or revoked widget token")
+	ErrNotFound         = errors.New("widget token not found")
+)
+
+// TokenView is an issued widget token with the names of its projects.
+type TokenView struct {
+	ID           int64      `bun:"id"`
+	Name         string     `bun:"name"`
+	TokenPrefix  string     `bun:"token_prefix"`
+	ProjectNames string     `bun:"project_names"`
+	CreatedAt    time.Time  `bun:"created_at"`
+	LastUsedAt   *time.Time `bun:"last_used_at"`
+	RevokedAt    *time.Time `bun:"revoked_at"`
+}
+
+// ProjectSummary is one project's receiving totals as shown on the widget.
+type ProjectSummary struct {
+	ProjectID      int64             `bun:"project_id" json:"project_id"`
+	Name           string            `bun:"name" json:"name"`
+	ClientName     fieldcrypt.String `bun:"client_name" json:"client_name"`
+	Status         string            `bun:"status" json:"status"`
+	PalletsOpen    int64             `bun:"pallets_open" json:"pallets_open"`
+	PalletsClosed  int64             `bun:"pallets_closed" json:"pallets_closed"`
+	ReceiptLines   int64             `bun:"receipt_lines" json:"receipt_lines"`
+	UnitsReceived  int64             `bun:"units_received" json:"units_received"`
+	DamagedUnits   int64             `bun:"damaged_units" json:"damaged_units"`
+	LastReceivedAt string            `bun:"last_received_at" json:"last_received_at,omitempty"`
+}
+
+// Totals adds up the project rows of a Summary.
+type Totals struct {
+	PalletsOpen    int64  `json:"pallets_open"`
+	PalletsClosed  int64  `json:"pallets_closed"`
+	ReceiptLines   int64  `json:"receipt_lines"`
+	UnitsReceived  int64  `json:"units_received"`
+	DamagedUnits   int64  `json:"damaged_units"`
+	LastReceivedAt string `json:"last_received_at,omitempty"`
+}
+
+// Summary is the widget payload: per-project rows plus their totals.
+type Summary struct {
+	Name        string           `json:"name"`
+	Projects    []ProjectSummary `json:"projects"`
+	Totals      Totals           `json:"totals"`
+	GeneratedAt time.Time        `json:"generated_at"`
+}
+
+func hashToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken() string {
+	buf := make([]byte, 24)
+	_, _ = rand.Read(buf)
+	return tokenPrefix + hex.EncodeToString(buf)
+}
+
+// Issue creates a widget token scoped to projectIDs and returns the
+// plaintext, which is not recoverable afterwards.
+func Issue(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID int64, name string, projectIDs []int64) (string, models.EmbedToken, error) {
+	var token models.EmbedToken
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", token, ErrNameRequired
+	}
+	projectIDs = uniqueIDs(projectIDs)
+	if len(projectIDs) == 0 {
+		return "", token, ErrProjectsRequired
+	}
+	plaintext := newToken()
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var count int
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM projects WHERE id IN (?)`, bun.In(projectIDs)).Scan(ctx, &count); err != nil {
+			return err
+		}
+		if count != len(projectIDs) {
+			return ErrUnknownProject
+		}
+		token = models.EmbedToken{
+			Name:            name,
+			TokenHash:       hashToken(plaintext),
+			TokenPrefix:     plaintext[:len(tokenPrefix)+6],
+			CreatedByUserID: actorUserID,
+		}
+		if _, err := tx.NewInsert().Model(&token).Exec(ctx); err != nil {
+			return err
+		}
+		for _, projectID := range projectIDs {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO embed_token_projects (embed_token_id, project_id) VALUES (?, ?)`, token.ID, projectID); err != nil {
+				return err
+			}
+		}
+		if auditSvc != nil && actorUserID > 0 {
+			return auditSvc.Write(ctx, tx, actorUserID, "embed_token.issue", "embed_tokens", strconv.FormatInt(token.ID, 10), nil, map[string]any{
+				"name":        token.Name,
+				"prefix":      token.TokenPrefix,
+				"project_ids": projectIDs,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return "", models.EmbedToken{}, err
+	}
+	return plaintext, token, nil
+}
+
+// Authenticate resolves an active token to its projects and records its use.
+func Authenticate(ctx context.Context, db *sqlite.DB, plaintext string) (models.EmbedToken, []int64, error) {
+	var token models.EmbedToken
+	projectIDs := make([]int64, 0)
+	plaintext = strings.TrimSpace(plaintext)
+	if !strings.HasPrefix(plaintext, tokenPrefix) {
+		return token, nil, ErrInvalidToken
+	}
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewSelect().Model(&token).Where("token_hash = ?", hashToken(plaintext)).Where("revoked_at IS NULL").Limit(1).Scan(ctx); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrInvalidToken
+			}
+			return err
+		}
+		if err := tx.NewRaw(`SELECT project_id FROM embed_token_projects WHERE embed_token_id = ? ORDER BY project_id`, token.ID).Scan(ctx, &projectIDs); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+UPDATE embed_tokens
+SET last_used_at = CURRENT_TIMESTAMP
+WHERE id = ? AND (last_used_at IS NULL OR last_used_at < datetime('now', '-1 minute'))`, token.ID)
+		return err
+	})
+	return token, projectIDs, err
+}
+
+func Revoke(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID, tokenID int64) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var token models.EmbedToken
+		if err := tx.NewSelect().Model(&token).Where("id = ?", tokenID).Limit(1).Scan(ctx); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		if token.RevokedAt != nil {
+			return nil
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE embed_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE id = ?`, tokenID); err != nil {
+			return err
+		}
+		if auditSvc != nil && actorUserID > 0 {
+			return auditSvc.Write(ctx, tx, actorUserID, "embed_token.revoke", "embed_tokens", strconv.FormatInt(tokenID, 10), map[string]any{
+				"name":   token.Name,
+				"prefix": token.TokenPrefix,
+			}, nil)
+		}
+		return nil
+	})
+}
+
+func List(ctx context.Context, db *sqlite.DB) ([]TokenView, error) {
+	tokens := make([]TokenView, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT et.id, et.name, et.token_prefix,
+       COALESCE((SELECT GROUP_CONCAT(p.name, ', ')
+                 FROM embed_token_projects etp
+                 JOIN projects p ON p.id = etp.project_id
+                 WHERE etp.embed_token_id = et.id), '') AS project_names,
+       et.created_at, et.last_used_at, et.revoked_at
+FROM embed_tokens et
+ORDER BY et.revoked_at IS NOT NULL ASC, et.id DESC`).Scan(ctx, &tokens)
+	})
+	return tokens, err
+}
+
+// LoadSummary totals receiving for projectIDs. Cancelled pallets and their
+// lines are left out, matching the client SKU views.
+func LoadSummary(ctx context.Context, db *sqlite.DB, name string, projectIDs []int64) (Summary, error) {
+	summary := Summary{Name: name, Projects: make([]ProjectSummary, 0, len(projectIDs)), GeneratedAt: time.Now().UTC()}
+	if len(projectIDs) == 0 {
+		return summary, nil
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT pj.id AS project_id, pj.name, pj.client_name, pj.status,
+       (SELECT COUNT(1) FROM pallets p WHERE p.project_id = pj.id AND p.status IN ('created', 'open')) AS pallets_open,
+       (SELECT COUNT(1) FROM pallets p WHERE p.project_id = pj.id AND p.status IN ('closed', 'labelled')) AS pallets_closed,
+       COUNT(pr.id) AS receipt_lines,
+       COALESCE(SUM(pr.qty), 0) AS units_received,
+       COALESCE(SUM(pr.damaged_qty), 0) AS damaged_units,
+       COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', MAX(pr.created_at)), '') AS last_received_at
+FROM projects pj
+LEFT JOIN pallets p ON p.project_id = pj.id AND p.status <> 'cancelled'
+LEFT JOIN pallet_receipts pr ON pr.pallet_id = p.id
+WHERE pj.id IN (?)
+GROUP BY pj.id
+ORDER BY pj.name ASC, pj.id ASC`, bun.In(projectIDs)).Scan(ctx, &summary.Projects)
+	})
+	if err != nil {
+		return summary, err
+	}
+	for _, p := range summary.Projects {
+		summary.Totals.PalletsOpen += p.PalletsOpen
+		summary.Totals.PalletsClosed += p.PalletsClosed
+		summary.Totals.ReceiptLines += p.ReceiptLines
+		summary.Totals.UnitsReceived += p.UnitsReceived
+		summary.Totals.DamagedUnits += p.DamagedUnits
+		if p.LastReceivedAt > summary.Totals.LastReceivedAt {
+			summary.Totals.LastReceivedAt = p.LastReceivedAt
+		}
+	}
+	return summary, nil
+}
+
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]struct{}, len(ids))
+	out := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id <= 0 {
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		out = append(out, id)
+	}
+	return out
+}
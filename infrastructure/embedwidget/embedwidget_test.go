@@ -0,0 +1,142 @@
+package embedwidget
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+func openEmbedWidgetTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "embedwidget-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+				(1, 'Alpha', 'a', DATE('now'), 'Client A', 'alpha', 'active'),
+				(2, 'Beta', 'b', DATE('now'), 'Client A', 'beta', 'inactive'),
+				(3, 'Gamma', 'c', DATE('now'), 'Client B', 'gamma', 'active')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open'), (2, 1, 'closed'), (3, 1, 'cancelled'), (4, 2, 'labelled'), (5, 3, 'open')`,
+			`INSERT INTO pallet_receipts (project_id, pallet_id, sku, description, scanned_by_user_id, qty, damaged, damaged_qty) VALUES
+				(1, 1, 'SKU-A', 'A', 1, 10, 1, 2),
+				(1, 2, 'SKU-B', 'B', 1, 5, 0, 0),
+				(1, 3, 'SKU-C', 'C', 1, 99, 0, 0),
+				(2, 4, 'SKU-A', 'A', 1, 7, 0, 0),
+				(3, 5, 'SKU-Z', 'Z', 1, 1000, 0, 0)`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed test data: %v", err)
+	}
+	return db
+}
+
+func TestIssueAuthenticateAndRevoke(t *testing.T) {
+	db := openEmbedWidgetTestDB(t)
+	ctx := context.Background()
+	auditSvc := audit.NewService()
+
+	if _, _, err := Issue(ctx, db, auditSvc, 1, "Acme", nil); !errors.Is(err, ErrProjectsRequired) {
+		t.Fatalf("expected projects required, got %v", err)
+	}
+	if _, _, err := Issue(ctx, db, auditSvc, 1, "Acme", []int64{1, 42}); !errors.Is(err, ErrUnknownProject) {
+		t.Fatalf("expected unknown project, got %v", err)
+	}
+
+	plaintext, token, err := Issue(ctx, db, auditSvc, 1, "Acme", []int64{2, 1, 1})
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	got, projectIDs, err := Authenticate(ctx, db, plaintext)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if got.ID != token.ID || len(projectIDs) != 2 || projectIDs[0] != 1 || projectIDs[1] != 2 {
+		t.Fatalf("unexpected token scope: id=%d projects=%v", got.ID, projectIDs)
+	}
+
+	if err := Revoke(ctx, db, auditSvc, 1, token.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, _, err := Authenticate(ctx, db, plaintext); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected revoked token rejected, got %v", err)
+	}
+}
+
+func TestLoadSummary_TotalsScopedProjectsWithoutCancelledPallets(t *testing.T) {
+	db := openEmbedWidgetTestDB(t)
+
+	summary, err := LoadSummary(context.Background(), db, "Acme", []int64{1, 2})
+	if err != nil {
+		t.Fatalf("load summary: %v", err)
+	}
+	if len(summary.Projects) != 2 || summary.Projects[0].Name != "Alpha" || string(summary.Projects[0].ClientName) != "Client A" {
+		t.Fatalf("unexpected projects: %+v", summary.Projects)
+	}
+	alpha := summary.Projects[0]
+	if alpha.UnitsReceived != 15 || alpha.DamagedUnits != 2 || alpha.ReceiptLines != 2 || alpha.PalletsOpen != 1 || alpha.PalletsClosed != 1 {
+		t.Fatalf("unexpected alpha totals: %+v", alpha)
+	}
+	if summary.Totals.UnitsReceived != 22 || summary.Totals.PalletsClosed != 2 || summary.Totals.LastReceivedAt == "" {
+		t.Fatalf("unexpected totals: %+v", summary.Totals)
+	}
+}
+
+func TestLoadBoard_CountsByStatusUnitsTodayAndOpenPallets(t *testing.T) {
+	db := openEmbedWidgetTestDB(t)
+	ctx := context.Background()
+
+	board, err := LoadBoard(ctx, db, "Floor", []int64{1, 2}, time.Now())
+	if err != nil {
+		t.Fatalf("load board: %v", err)
+	}
+	if len(board.Projects) != 2 || board.Projects[0].Name != "Alpha" {
+		t.Fatalf("unexpected projects: %+v", board.Projects)
+	}
+	alpha := board.Projects[0]
+	if alpha.PalletsOpen != 1 || alpha.PalletsClosed != 1 || alpha.PalletsLabelled != 0 || alpha.UnitsToday != 15 {
+		t.Fatalf("unexpected alpha counts: %+v", alpha)
+	}
+	if board.Projects[1].PalletsLabelled != 1 || board.UnitsToday != 22 {
+		t.Fatalf("unexpected board totals: %+v", board)
+	}
+	if len(board.OpenPallets) != 1 || board.OpenPallets[0].ID != 1 || board.OpenPallets[0].Units != 10 || board.OpenPallets[0].LastReceivedAt == "" {
+		t.Fatalf("unexpected open pallets: %+v", board.OpenPallets)
+	}
+
+	tomorrow, err := LoadBoard(ctx, db, "Floor", []int64{1, 2}, time.Now().Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("load board tomorrow: %v", err)
+	}
+	if tomorrow.UnitsToday != 0 || len(tomorrow.OpenPallets) != 1 {
+		t.Fatalf("expected no units received tomorrow, got %+v", tomorrow)
+	}
+}
@@ -0,0 +1,193 @@
+// Package exportformat defines the column layout of each file export and
+// versions it, so downstream systems can pin a layout with ?format_version=
+// while the default moves to the latest version.
+//
+// Changing an export's columns means adding a version here, never editing an
+// existing one: add new columns with Since set to the new version, retire old
+// ones by setting Until, and bump Latest. The golden files under each export's
+// testdata directory are the contract for every published version.
+//
+// From CustomFieldsSince, exports of receipt lines append one custom_<key>
+// column per project custom field after the fixed columns. Those columns
+// follow the project's configuration rather than the version.
+package exportformat
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	// QueryParam selects the format version of an export request.
+	QueryParam = "format_version"
+	// ResponseHeader reports the format version an export was written in.
+	ResponseHeader = "X-Export-Format-Version"
+)
+
+var ErrUnsupportedVersion = errors.New("unsupported export format version")
+
+type Column struct {
+	Name string
+	// Since is the first version containing the column.
+	Since int
+	// Until is the last version containing the column; zero means current.
+	Until int
+}
+
+// Format is the versioned column layout of one export. Columns lists every
+// column that has ever been published, in output order.
+type Format struct {
+	Name    string
+	Latest  int
+	Columns []Column
+	// CustomFieldsSince is the first version with custom field columns; zero means none.
+	CustomFieldsSince int
+}
+
+func (c Column) in(version int) bool {
+	return version >= c.Since && (c.Until == 0 || version <= c.Until)
+}
+
+// ParseVersion resolves a requested version, defaulting to Latest when raw is empty.
+func (f Format) ParseVersion(raw string) (int, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return f.Latest, nil
+	}
+	version, err := strconv.Atoi(raw)
+	if err != nil || version < 1 || version > f.Latest {
+		return 0, ErrUnsupportedVersion
+	}
+	return version, nil
+}
+
+// Header returns the column names written for version.
+func (f Format) Header(version int) []string {
+	header := make([]string, 0, len(f.Columns))
+	for _, column := range f.Columns {
+		if column.in(version) {
+			header = append(header, column.Name)
+		}
+	}
+	return header
+}
+
+// Record picks the values for version from values, which holds one entry per
+// column in Columns order.
+func (f Format) Record(version int, values []string) []string {
+	record := make([]string, 0, len(values))
+	for i, column := range f.Columns {
+		if i < len(values) && column.in(version) {
+			record = append(record, values[i])
+		}
+	}
+	return record
+}
+
+// IncludesCustomFields reports whether version appends custom field columns.
+func (f Format) IncludesCustomFields(version int) bool {
+	return f.CustomFieldsSince > 0 && version >= f.CustomFieldsSince
+}
+
+func columns(since int, names ...string) []Column {
+	cols := make([]Column, 0, len(names))
+	for _, name := range names {
+		cols = append(cols, Column{Name: name, Since: since})
+	}
+	return cols
+}
+
+func concat(groups ...[]Column) []Column {
+	var cols []Column
+	for _, group := range groups {
+		cols = append(cols, group...)
+	}
+	return cols
+}
+
+var (
+	Receipts = Format{
+		Name:   "receipts_csv",
+		Latest: 4,
+		Columns: concat(columns(1,
+			"pallet_id", "sku", "description", "uom", "qty", "case_size",
+			"item_barcode", "carton_barcode", "expiry", "batch_number",
+		), columns(3, "barcode_check_failed"), columns(4, "country_of_origin", "hs_code")),
+		CustomFieldsSince: 2,
+	}
+
+	PalletStatus = Format{
+		Name:    "pallet_status_csv",
+		Latest:  1,
+		Columns: columns(1, "pallet_id", "status", "line_count", "created_at", "closed_at", "reopened_at"),
+	}
+
+	SKUSummary = Format{
+		Name:   "sku_summary_csv",
+		Latest: 1,
+		Columns: columns(1,
+			"sku", "description", "uom", "batch_number", "expiry", "expired",
+			"total_qty", "success_qty", "unknown_qty", "damaged_qty",
+			"has_comment", "has_client_comment", "has_photo",
+		),
+	}
+
+	SKUDetailed = Format{
+		Name:   "sku_detailed_csv",
+		Latest: 5,
+		Columns: concat(columns(1,
+			"pallet_id", "receipt_id", "sku", "description", "uom",
+			"qty", "case_size", "unknown_sku", "damaged", "damage_reason",
+			"batch_number", "expiry", "expiry_iso", "expired",
+			"line_comment", "has_line_comment", "has_client_comment", "has_photo", "scanned_by",
+		), columns(3, "barcode_check_failed"), columns(4, "country_of_origin", "hs_code"), columns(5, "serial_numbers")),
+		CustomFieldsSince: 2,
+	}
+
+	InventoryAging = Format{
+		Name:   "inventory_aging_csv",
+		Latest: 1,
+		Columns: columns(1,
+			"sku", "description", "batch_number",
+			"qty_0_30", "qty_31_60", "qty_61_90", "qty_90_plus", "total_qty",
+			"oldest_receipt", "oldest_days",
+		),
+	}
+
+	// MyCaptures is a scanner's export of the lines they scanned
+	// themselves. Every row carries the exporting user so a copy can be
+	// traced back to them.
+	MyCaptures = Format{
+		Name:   "my_captures_csv",
+		Latest: 1,
+		Columns: columns(1,
+			"pallet_id", "receipt_id", "scanned_at", "sku", "description", "uom",
+			"qty", "case_size", "unknown_sku", "damaged", "damaged_qty",
+			"batch_number", "expiry", "exported_by", "exported_at",
+		),
+	}
+
+	// CustomsDeclaration totals one delivery's received quantity per
+	// country of origin, HS code and SKU.
+	CustomsDeclaration = Format{
+		Name:   "customs_declaration_csv",
+		Latest: 1,
+		Columns: columns(1,
+			"delivery_reference", "country_of_origin", "country_name", "hs_code",
+			"sku", "description", "lines", "pallets", "qty",
+		),
+	}
+
+	WMSReconciliation = Format{
+		Name:    "wms_reconciliation_csv",
+		Latest:  1,
+		Columns: columns(1, "sku", "batch_number", "wms_qty", "received_qty", "difference", "result"),
+	}
+
+	ClientAccessLog = Format{
+		Name:    "client_access_log_csv",
+		Latest:  1,
+		Columns: columns(1, "viewed_at", "username", "kind", "path", "query"),
+	}
+)
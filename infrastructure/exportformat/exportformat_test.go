@@ -0,0 +1,79 @@
+package exportformat
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFormat_HeaderAndRecordFollowColumnVersions(t *testing.T) {
+	f := Format{
+		Name:   "example_csv",
+		Latest: 3,
+		Columns: []Column{
+			{Name: "id", Since: 1},
+			{Name: "legacy", Since: 1, Until: 2},
+			{Name: "added", Since: 2},
+		},
+	}
+	values := []string{"7", "old", "new"}
+
+	cases := []struct {
+		version    int
+		wantHeader []string
+		wantRecord []string
+	}{
+		{1, []string{"id", "legacy"}, []string{"7", "old"}},
+		{2, []string{"id", "legacy", "added"}, []string{"7", "old", "new"}},
+		{3, []string{"id", "added"}, []string{"7", "new"}},
+	}
+	for _, tc := range cases {
+		if got := f.Header(tc.version); !reflect.DeepEqual(got, tc.wantHeader) {
+			t.Fatalf("Header(%d) = %v; want %v", tc.version, got, tc.wantHeader)
+		}
+		if got := f.Record(tc.version, values); !reflect.DeepEqual(got, tc.wantRecord) {
+			t.Fatalf("Record(%d) = %v; want %v", tc.version, got, tc.wantRecord)
+		}
+	}
+}
+
+func TestFormat_ParseVersion(t *testing.T) {
+	f := Format{Name: "example_csv", Latest: 2}
+	if v, err := f.ParseVersion(""); err != nil || v != 2 {
+		t.Fatalf("expected default to latest version 2, got %d err=%v", v, err)
+	}
+	if v, err := f.ParseVersion(" 1 "); err != nil || v != 1 {
+		t.Fatalf("expected pinned version 1, got %d err=%v", v, err)
+	}
+	for _, raw := range []string{"0", "3", "v1", "-1"} {
+		if _, err := f.ParseVersion(raw); !errors.Is(err, ErrUnsupportedVersion) {
+			t.Fatalf("ParseVersion(%q): expected ErrUnsupportedVersion, got %v", raw, err)
+		}
+	}
+}
+
+func TestFormat_IncludesCustomFields(t *testing.T) {
+	f := Format{Name: "example_csv", Latest: 3, CustomFieldsSince: 2}
+	for version, want := range map[int]bool{1: false, 2: true, 3: true} {
+		if got := f.IncludesCustomFields(version); got != want {
+			t.Fatalf("IncludesCustomFields(%d) = %v; want %v", version, got, want)
+		}
+	}
+	if (Format{Name: "plain_csv", Latest: 2}).IncludesCustomFields(2) {
+		t.Fatalf("expected formats without CustomFieldsSince to never include custom fields")
+	}
+}
+
+func TestPublishedFormats_HeadersAreUnique(t *testing.T) {
+	for _, f := range []Format{Receipts, PalletStatus, SKUSummary, SKUDetailed, MyCaptures, InventoryAging, ClientAccessLog} {
+		for version := 1; version <= f.Latest; version++ {
+			seen := make(map[string]bool)
+			for _, name := range f.Header(version) {
+				if seen[name] {
+					t.Fatalf("%s v%d repeats column %q", f.Name, version, name)
+				}
+				seen[name] = true
+			}
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Package exportjob queues exports that are too heavy to stream from a
+// request and builds them in the background. Finished files are downloaded
+// from the job row and every completed job is recorded in the export history.
+package exportjob
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+
+	// KindPalletBundle is a ZIP of one pallet's lines, event history and
+	// photos.
+	KindPalletBundle = "pallet_bundle"
+	// KindProjectBundle is the handover ZIP of a whole project: its pallet
+	// and SKU CSVs and every receipt photo.
+	KindProjectBundle = "project_bundle"
+)
+
+var (
+	ErrNotFound = errors.New("export job not found")
+	ErrNotReady = errors.New("export job has not finished")
+)
+
+// Result is the file a Builder produced. Builders of large files write them
+// to a temporary file and set Path instead of Data; the worker stores the file
+// in chunks and removes it.
+type Result struct {
+	FileName string
+	Data     []byte
+	Path     string
+	RowCount int64
+}
+
+// chunkSize is how much of a Path result is stored or read per row.
+const chunkSize = 1 << 20
+
+// Builder produces the file for one job.
+type Builder func(ctx context.Context, db *sqlite.DB, job models.ExportJob) (Result, error)
+
+// View is a job as listed on the page that queued it, without the file.
+type View struct {
+	ID         int64      `bun:"id"`
+	Kind       string     `bun:"kind"`
+	Status     string     `bun:"status"`
+	Error      string     `bun:"error"`
+	FileName   string     `bun:"file_name"`
+	FileSize   int64      `bun:"file_size"`
+	RowCount   int64      `bun:"row_count"`
+	Requester  string     `bun:"requester"`
+	CreatedAt  time.Time  `bun:"created_at"`
+	FinishedAt *time.Time `bun:"finished_at"`
+}
+
+// Pending reports whether the job is still waiting or being built.
+func (v View) Pending() bool {
+	return v.Status == StatusQueued || v.Status == StatusRunning
+}
+
+// SizeLabel formats the file size for display.
+func (v View) SizeLabel() string {
+	switch {
+	case v.FileSize >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(v.FileSize)/(1<<20))
+	case v.FileSize >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(v.FileSize)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", v.FileSize)
+	}
+}
+
+// EnqueuePalletBundle queues a bundle export for one pallet. Callers Notify
+// the worker afterwards.
+func EnqueuePalletBundle(ctx context.Context, db *sqlite.DB, userID, projectID, palletID int64) (models.ExportJob, error) {
+	return enqueue(ctx, db, userID, models.ExportJob{
+		Kind:      KindPalletBundle,
+		ProjectID: projectID,
+		PalletID:  &palletID,
+	})
+}
+
+// EnqueueProjectBundle queues a handover bundle for a whole project. Callers
+// Notify the worker afterwards.
+func EnqueueProjectBundle(ctx context.Context, db *sqlite.DB, userID, projectID int64) (models.ExportJob, error) {
+	return enqueue(ctx, db, userID, models.ExportJob{
+		Kind:      KindProjectBundle,
+		ProjectID: projectID,
+	})
+}
+
+func enqueue(ctx context.Context, db *sqlite.DB, userID int64, job models.ExportJob) (models.ExportJob, error) {
+	job.Status = StatusQueued
+	if userID > 0 {
+		job.RequestedByUserID = &userID
+	}
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewInsert().Model(&job).ExcludeColumn("file_blob", "finished_at").Exec(ctx)
+		return err
+	})
+	return job, err
+}
+
+// Load returns a job including its file.
+func Load(ctx context.Context, db *sqlite.DB, id int64) (models.ExportJob, error) {
+	var job models.ExportJob
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewSelect().Model(&job).Where("id = ?", id).Limit(1).Scan(ctx)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return job, ErrNotFound
+	}
+	return job, err
+}
+
+// LoadFileInfo returns a finished job's file name and size.
+func LoadFileInfo(ctx context.Context, db *sqlite.DB, id int64) (string, int64, error) {
+	var job models.ExportJob
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewSelect().Model(&job).ExcludeColumn("file_blob").Where("id = ?", id).Limit(1).Scan(ctx)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", 0, ErrNotFound
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if job.Status != StatusDone || job.FileSize == 0 {
+		return "", 0, ErrNotReady
+	}
+	return job.FileName, job.FileSize, nil
+}
+
+// CopyFile writes a finished job's file to w. Chunked files are read one
+// chunk at a time.
+func CopyFile(ctx context.Context, db *sqlite.DB, id int64, w io.Writer) (int64, error) {
+	var blob []byte
+	var chunks int
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT COALESCE(file_blob, X'') FROM export_jobs WHERE id = ?`, id).Scan(ctx, &blob); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT COUNT(1) FROM export_job_chunks WHERE job_id = ?`, id).Scan(ctx, &chunks)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if chunks == 0 {
+		n, err := w.Write(blob)
+		return int64(n), err
+	}
+
+	var written int64
+	for seq := 0; seq < chunks; seq++ {
+		var data []byte
+		if err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+			return tx.NewRaw(`SELECT data FROM export_job_chunks WHERE job_id = ? AND seq = ?`, id, seq).Scan(ctx, &data)
+		}); err != nil {
+			return written, err
+		}
+		n, err := w.Write(data)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ListForPallet returns the pallet's most recent jobs of kind, newest first.
+func ListForPallet(ctx context.Context, db *sqlite.DB, palletID int64, kind string, limit int) ([]View, error) {
+	views := make([]View, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT ej.id, ej.kind, ej.status, ej.error, ej.file_name, ej.file_size, ej.row_count,
+       COALESCE(u.username, '') AS requester, ej.created_at, ej.finished_at
+FROM export_jobs ej
+LEFT JOIN users u ON u.id = ej.requested_by_user_id
+WHERE ej.pallet_id = ? AND ej.kind = ?
+ORDER BY ej.id DESC
+LIMIT ?`, palletID, kind, limit).Scan(ctx, &views)
+	})
+	return views, err
+}
+
+// ListForProject returns the project's most recent jobs of kind, newest
+// first.
+func ListForProject(ctx context.Context, db *sqlite.DB, projectID int64, kind string, limit int) ([]View, error) {
+	views := make([]View, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT ej.id, ej.kind, ej.status, ej.error, ej.file_name, ej.file_size, ej.row_count,
+       COALESCE(u.username, '') AS requester, ej.created_at, ej.finished_at
+FROM export_jobs ej
+LEFT JOIN users u ON u.id = ej.requested_by_user_id
+WHERE ej.project_id = ? AND ej.kind = ?
+ORDER BY ej.id DESC
+LIMIT ?`, projectID, kind, limit).Scan(ctx, &views)
+	})
+	return views, err
+}
+
+func truncateError(err error) string {
+	msg := strings.TrimSpace(err.Error())
+	if len(msg) > 500 {
+		msg = msg[:500]
+	}
+	return msg
+}
@@ -0,0 +1,174 @@
+package exportjob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+func openExportJobTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "exportjob-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'Inbound', 'd', '2026-02-01', 'Acme', 'inbound', 'active')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open'), (2, 1, 'open')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return db
+}
+
+func TestWorkerBuildsQueuedJobsAndRecordsFailures(t *testing.T) {
+	db := openExportJobTestDB(t)
+	ctx := context.Background()
+
+	ok, err := EnqueuePalletBundle(ctx, db, 1, 1, 1)
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	bad, err := EnqueuePalletBundle(ctx, db, 1, 1, 2)
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if _, _, err := LoadFileInfo(ctx, db, ok.ID); !errors.Is(err, ErrNotReady) {
+		t.Fatalf("expected queued job not ready, got %v", err)
+	}
+
+	worker := NewWorker(db, map[string]Builder{
+		KindPalletBundle: func(ctx context.Context, db *sqlite.DB, job models.ExportJob) (Result, error) {
+			if *job.PalletID == 2 {
+				return Result{}, errors.New("pallet has gone")
+			}
+			return Result{FileName: "pallet-1.zip", Data: []byte("zip"), RowCount: 4}, nil
+		},
+	})
+	processed, err := worker.ProcessPending(ctx)
+	if err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	if processed != 2 {
+		t.Fatalf("expected 2 jobs processed, got %d", processed)
+	}
+
+	name, size, err := LoadFileInfo(ctx, db, ok.ID)
+	if err != nil {
+		t.Fatalf("load file: %v", err)
+	}
+	var data bytes.Buffer
+	if _, err := CopyFile(ctx, db, ok.ID, &data); err != nil {
+		t.Fatalf("copy file: %v", err)
+	}
+	if name != "pallet-1.zip" || size != 3 || data.String() != "zip" {
+		t.Fatalf("unexpected file %q %d %q", name, size, data.String())
+	}
+	failed, err := Load(ctx, db, bad.ID)
+	if err != nil {
+		t.Fatalf("load failed job: %v", err)
+	}
+	if failed.Status != StatusFailed || failed.Error != "pallet has gone" || failed.FinishedAt == nil {
+		t.Fatalf("unexpected failed job: %+v", failed)
+	}
+
+	views, err := ListForPallet(ctx, db, 1, KindPalletBundle, 5)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(views) != 1 || views[0].Status != StatusDone || views[0].Requester != "admin" || views[0].RowCount != 4 || views[0].FileSize != 3 {
+		t.Fatalf("unexpected views: %+v", views)
+	}
+
+	var runs int
+	if err := db.R.NewRaw(`SELECT COUNT(1) FROM export_runs WHERE export_type = ? AND row_count = 4`, KindPalletBundle).Scan(ctx, &runs); err != nil {
+		t.Fatalf("count export runs: %v", err)
+	}
+	if runs != 1 {
+		t.Fatalf("expected one export run for the finished job, got %d", runs)
+	}
+	var link string
+	if err := db.R.NewRaw(`SELECT link FROM notifications WHERE kind = 'export_failed' AND body = 'pallet has gone'`).Scan(ctx, &link); err != nil {
+		t.Fatalf("load failure notification: %v", err)
+	}
+	if link != "/tasker/pallets/2/content-label" {
+		t.Fatalf("unexpected failure notification link %q", link)
+	}
+	if _, err := Load(ctx, db, 999); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected missing job not found, got %v", err)
+	}
+}
+
+func TestWorkerStoresPathResultsInChunks(t *testing.T) {
+	db := openExportJobTestDB(t)
+	ctx := context.Background()
+
+	job, err := EnqueueProjectBundle(ctx, db, 1, 1)
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	content := bytes.Repeat([]byte("0123456789abcdef"), chunkSize/16*2+5)
+	path := filepath.Join(t.TempDir(), "bundle.zip")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatalf("write temp file: %v", err)
+	}
+	worker := NewWorker(db, map[string]Builder{
+		KindProjectBundle: func(ctx context.Context, db *sqlite.DB, job models.ExportJob) (Result, error) {
+			return Result{FileName: "project-1.zip", Path: path, RowCount: 1}, nil
+		},
+	})
+	if _, err := worker.ProcessPending(ctx); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected temp file removed, got %v", err)
+	}
+	var chunks int
+	if err := db.R.NewRaw(`SELECT COUNT(1) FROM export_job_chunks WHERE job_id = ?`, job.ID).Scan(ctx, &chunks); err != nil {
+		t.Fatalf("count chunks: %v", err)
+	}
+	if chunks != 3 {
+		t.Fatalf("expected 3 chunks, got %d", chunks)
+	}
+	_, size, err := LoadFileInfo(ctx, db, job.ID)
+	if err != nil {
+		t.Fatalf("load file info: %v", err)
+	}
+	var data bytes.Buffer
+	if _, err := CopyFile(ctx, db, job.ID, &data); err != nil {
+		t.Fatalf("copy file: %v", err)
+	}
+	if size != int64(len(content)) || !bytes.Equal(data.Bytes(), content) {
+		t.Fatalf("expected chunked file to round-trip, got size %d and %d bytes", size, data.Len())
+	}
+}
@@ -0,0 +1,268 @@
+package exportjob
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/exportrun"
+	"receipter/infrastructure/notification"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+const (
+	workerPollInterval = 30 * time.Second
+	// Retention is how long finished jobs and their files are kept.
+	Retention = 7 * 24 * time.Hour
+)
+
+// Worker builds queued export jobs in the background.
+type Worker struct {
+	db       *sqlite.DB
+	builders map[string]Builder
+
+	// Paused, when set before Start, leaves queued jobs unbuilt while it
+	// returns true.
+	Paused func() bool
+
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	started atomic.Bool
+}
+
+// NewWorker returns a worker that builds each kind with builders. Kinds
+// without a builder fail.
+func NewWorker(db *sqlite.DB, builders map[string]Builder) *Worker {
+	return &Worker{
+		db:       db,
+		builders: builders,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Notify wakes the worker after a job has been queued. Safe on a nil worker.
+func (w *Worker) Notify() {
+	if w == nil {
+		return
+	}
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the worker until Stop. Jobs left running by a previous run are
+// queued again first.
+func (w *Worker) Start() {
+	w.started.Store(true)
+	go func() {
+		defer close(w.done)
+		ctx := context.Background()
+		if err := w.requeueInterrupted(ctx); err != nil {
+			slog.Error("export jobs: requeue interrupted failed", slog.Any("err", err))
+		}
+		ticker := time.NewTicker(workerPollInterval)
+		defer ticker.Stop()
+		for {
+			if w.Paused == nil || !w.Paused() {
+				if _, err := w.ProcessPending(ctx); err != nil {
+					slog.Error("export jobs: processing failed", slog.Any("err", err))
+				}
+				if err := w.prune(ctx, time.Now().UTC().Add(-Retention)); err != nil {
+					slog.Error("export jobs: prune failed", slog.Any("err", err))
+				}
+			}
+			select {
+			case <-w.stop:
+				return
+			case <-w.wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends a started worker and waits for the current job to finish.
+func (w *Worker) Stop() {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+	if !w.started.Load() {
+		return
+	}
+	select {
+	case <-w.done:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+// ProcessPending builds queued jobs until none remain and returns how many it
+// handled.
+func (w *Worker) ProcessPending(ctx context.Context) (int, error) {
+	processed := 0
+	for {
+		job, ok, err := w.claimNext(ctx)
+		if err != nil {
+			return processed, err
+		}
+		if !ok {
+			return processed, nil
+		}
+		if err := w.build(ctx, job); err != nil {
+			return processed, err
+		}
+		processed++
+	}
+}
+
+func (w *Worker) claimNext(ctx context.Context) (models.ExportJob, bool, error) {
+	var job models.ExportJob
+	err := w.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewSelect().
+			Model(&job).
+			ExcludeColumn("file_blob").
+			Where("status = ?", StatusQueued).
+			OrderExpr("id ASC").
+			Limit(1).
+			Scan(ctx); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE export_jobs SET status = ? WHERE id = ?`, StatusRunning, job.ID)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return job, false, nil
+	}
+	return job, err == nil, err
+}
+
+// build runs the job's builder and stores the file, or the error as a failed
+// job. Only storage errors are returned.
+func (w *Worker) build(ctx context.Context, job models.ExportJob) error {
+	startedAt := time.Now()
+	var result Result
+	buildErr := fmt.Errorf("no builder for export kind %q", job.Kind)
+	if builder, found := w.builders[job.Kind]; found && builder != nil {
+		result, buildErr = builder(ctx, w.db, job)
+	}
+	now := time.Now().UTC()
+	if buildErr != nil {
+		return w.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+			if _, err := tx.ExecContext(ctx, `UPDATE export_jobs SET status = ?, error = ?, finished_at = ? WHERE id = ?`, StatusFailed, truncateError(buildErr), now, job.ID); err != nil {
+				return err
+			}
+			failed := notification.Notification{
+				Kind:      notification.KindExportFailed,
+				ProjectID: job.ProjectID,
+				Title:     fmt.Sprintf("%s export failed", job.Kind),
+				Body:      truncateError(buildErr),
+				Link:      "/tasker/exports",
+			}
+			if job.PalletID != nil {
+				failed.PalletID = *job.PalletID
+				failed.Link = notification.PalletLink(*job.PalletID)
+			}
+			return notification.Add(ctx, tx, failed)
+		})
+	}
+	if result.Path != "" {
+		defer os.Remove(result.Path)
+	}
+	err := w.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		data, size := result.Data, int64(len(result.Data))
+		if result.Path != "" {
+			var err error
+			if size, err = storeChunks(ctx, tx, job.ID, result.Path); err != nil {
+				return err
+			}
+			data = nil
+		}
+		_, err := tx.ExecContext(ctx, `
+UPDATE export_jobs
+SET status = ?, error = '', file_name = ?, file_blob = ?, file_size = ?, row_count = ?, finished_at = ?
+WHERE id = ?`, StatusDone, result.FileName, data, size, result.RowCount, now, job.ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	params := url.Values{}
+	params.Set("job_id", strconv.FormatInt(job.ID, 10))
+	if job.PalletID != nil {
+		params.Set("pallet_id", strconv.FormatInt(*job.PalletID, 10))
+	}
+	projectID := job.ProjectID
+	if err := exportrun.Save(ctx, w.db, exportrun.Run{
+		UserID:     job.RequestedByUserID,
+		ProjectID:  &projectID,
+		ExportType: job.Kind,
+		Params:     params,
+		RowCount:   result.RowCount,
+		Duration:   time.Since(startedAt),
+	}); err != nil {
+		slog.Error("export jobs: record export run failed", slog.Int64("job_id", job.ID), slog.Any("err", err))
+	}
+	return nil
+}
+
+// storeChunks copies the file at path into export_job_chunks and returns its
+// size.
+func storeChunks(ctx context.Context, tx bun.Tx, jobID int64, path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM export_job_chunks WHERE job_id = ?`, jobID); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, chunkSize)
+	var size int64
+	for seq := 0; ; seq++ {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO export_job_chunks (job_id, seq, data) VALUES (?, ?, ?)`, jobID, seq, buf[:n]); err != nil {
+				return size, err
+			}
+			size += int64(n)
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return size, nil
+		}
+		if err != nil {
+			return size, err
+		}
+	}
+}
+
+func (w *Worker) requeueInterrupted(ctx context.Context) error {
+	return w.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE export_jobs SET status = ? WHERE status = ?`, StatusQueued, StatusRunning)
+		return err
+	})
+}
+
+func (w *Worker) prune(ctx context.Context, before time.Time) error {
+	return w.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM export_jobs WHERE status IN (?, ?) AND finished_at < ?`, StatusDone, StatusFailed, before)
+		return err
+	})
+}
@@ -0,0 +1,139 @@
+package exportrun
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+var ErrRunNotFound = errors.New("export run not found")
+
+// Run describes a completed export. Params holds the effective query
+// parameters so the same export can be produced again later.
+type Run struct {
+	UserID     *int64
+	ProjectID  *int64
+	ExportType string
+	Params     url.Values
+	RowCount   int64
+	Duration   time.Duration
+	FileRef    string
+	// Destination says where a delivered export was sent, such as a Google
+	// Sheets tab; empty for downloads.
+	Destination string
+}
+
+type Record struct {
+	ID          int64  `bun:"id"`
+	UserID      *int64 `bun:"user_id"`
+	Username    string `bun:"username"`
+	ProjectID   *int64 `bun:"project_id"`
+	ProjectName string `bun:"project_name"`
+	ExportType  string `bun:"export_type"`
+	Params      string `bun:"params"`
+	RowCount    int64  `bun:"row_count"`
+	DurationMS  int64  `bun:"duration_ms"`
+	FileRef     string `bun:"file_ref"`
+	Destination string `bun:"destination"`
+	CreatedAt   string `bun:"created_at"`
+}
+
+func Save(ctx context.Context, db *sqlite.DB, run Run) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var uid any = nil
+		var pid any = nil
+		if run.UserID != nil && *run.UserID > 0 {
+			uid = *run.UserID
+		}
+		if run.ProjectID != nil && *run.ProjectID > 0 {
+			pid = *run.ProjectID
+		}
+		params := ""
+		if run.Params != nil {
+			params = run.Params.Encode()
+		}
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO export_runs (user_id, project_id, export_type, params, row_count, duration_ms, file_ref, destination, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`,
+			uid, pid, run.ExportType, params, run.RowCount, run.Duration.Milliseconds(), strings.TrimSpace(run.FileRef), strings.TrimSpace(run.Destination))
+		return err
+	})
+}
+
+const recordSelect = `
+SELECT er.id, er.user_id, COALESCE(u.username, '') AS username,
+       er.project_id, COALESCE(p.name, '') AS project_name,
+       er.export_type, er.params, er.row_count, er.duration_ms, er.file_ref, er.destination,
+       strftime('%d/%m/%Y %H:%M:%S', er.created_at) AS created_at
+FROM export_runs er
+LEFT JOIN users u ON u.id = er.user_id
+LEFT JOIN projects p ON p.id = er.project_id`
+
+func List(ctx context.Context, db *sqlite.DB, limit int) ([]Record, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	records := make([]Record, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(recordSelect+`
+ORDER BY er.id DESC
+LIMIT ?`, limit).Scan(ctx, &records)
+	})
+	return records, err
+}
+
+func Load(ctx context.Context, db *sqlite.DB, id int64) (Record, error) {
+	var record Record
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(recordSelect+`
+WHERE er.id = ?`, id).Scan(ctx, &record)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return record, ErrRunNotFound
+	}
+	return record, err
+}
+
+// RerunURL rebuilds the export URL for a recorded run. Runs recorded without a
+// project (for example a client export across all assigned projects) cannot be
+// replayed by an admin and report false.
+func RerunURL(record Record) (string, bool) {
+	if record.ProjectID == nil || *record.ProjectID <= 0 {
+		return "", false
+	}
+	params, err := url.ParseQuery(record.Params)
+	if err != nil {
+		params = url.Values{}
+	}
+	params.Del("project_scope")
+	params.Set("project_id", strconv.FormatInt(*record.ProjectID, 10))
+
+	var path string
+	switch {
+	case record.ExportType == "receipts_csv":
+		path = "/tasker/exports/receipts.csv"
+	case record.ExportType == "pallet_status_csv":
+		path = "/tasker/exports/pallet-status.csv"
+	case strings.HasPrefix(record.ExportType, "pallet_csv:"):
+		palletID, err := strconv.ParseInt(strings.TrimPrefix(record.ExportType, "pallet_csv:"), 10, 64)
+		if err != nil || palletID <= 0 {
+			return "", false
+		}
+		path = "/tasker/exports/pallet/" + strconv.FormatInt(palletID, 10) + ".csv"
+	case record.ExportType == "sku_summary_csv":
+		path = "/tasker/pallets/sku-view/export-summary.csv"
+	case record.ExportType == "sku_detailed_csv":
+		path = "/tasker/pallets/sku-view/export-detail.csv"
+	default:
+		return "", false
+	}
+	return path + "?" + params.Encode(), true
+}
@@ -0,0 +1,109 @@
+package exportrun
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func openExportRunTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "export-run-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO projects (id, name, description, project_date, client_name, code, status, created_at, updated_at)
+VALUES (1, 'Export Project', 'exports', DATE('now'), 'Client A', 'export-project', 'active', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO users (id, username, password_hash, role, created_at, updated_at) VALUES (1, 'admin', 'hash', 'admin', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed export run fixtures: %v", err)
+	}
+	return db
+}
+
+func TestSaveListAndLoad(t *testing.T) {
+	db := openExportRunTestDB(t)
+	ctx := context.Background()
+
+	userID, projectID := int64(1), int64(1)
+	params := url.Values{}
+	params.Set("filter", "damaged")
+	if err := Save(ctx, db, Run{
+		UserID:     &userID,
+		ProjectID:  &projectID,
+		ExportType: "sku_summary_csv",
+		Params:     params,
+		RowCount:   12,
+		Duration:   1500 * time.Millisecond,
+	}); err != nil {
+		t.Fatalf("save run: %v", err)
+	}
+	if err := Save(ctx, db, Run{UserID: &userID, ExportType: "sku_detailed_csv"}); err != nil {
+		t.Fatalf("save unscoped run: %v", err)
+	}
+
+	records, err := List(ctx, db, 10)
+	if err != nil {
+		t.Fatalf("list runs: %v", err)
+	}
+	if len(records) != 2 || records[0].ExportType != "sku_detailed_csv" {
+		t.Fatalf("expected newest run first, got %+v", records)
+	}
+
+	record, err := Load(ctx, db, records[1].ID)
+	if err != nil {
+		t.Fatalf("load run: %v", err)
+	}
+	if record.Username != "admin" || record.ProjectName != "Export Project" || record.RowCount != 12 || record.DurationMS != 1500 || record.Params != "filter=damaged" {
+		t.Fatalf("unexpected run record: %+v", record)
+	}
+
+	if _, err := Load(ctx, db, 999); err != ErrRunNotFound {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestRerunURL(t *testing.T) {
+	projectID := int64(7)
+	cases := []struct {
+		record Record
+		want   string
+		ok     bool
+	}{
+		{Record{ExportType: "receipts_csv", ProjectID: &projectID}, "/tasker/exports/receipts.csv?project_id=7", true},
+		{Record{ExportType: "pallet_csv:42", ProjectID: &projectID}, "/tasker/exports/pallet/42.csv?project_id=7", true},
+		{Record{ExportType: "sku_detailed_csv", ProjectID: &projectID, Params: "filter=damaged%3Acrushed&project_scope=7"}, "/tasker/pallets/sku-view/export-detail.csv?filter=damaged%3Acrushed&project_id=7", true},
+		{Record{ExportType: "sku_summary_csv", Params: "filter=all&project_scope=all"}, "", false},
+		{Record{ExportType: "unknown", ProjectID: &projectID}, "", false},
+	}
+	for _, tc := range cases {
+		got, ok := RerunURL(tc.record)
+		if got != tc.want || ok != tc.ok {
+			t.Fatalf("RerunURL(%s) = %q, %v; want %q, %v", tc.record.ExportType, got, ok, tc.want, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+// Package exportschedule runs saved export presets on a schedule and
+// delivers them to a Google Sheets tab. Replace mode rewrites the tab each
+// run; append mode adds the run's rows below the existing ones, with the
+// run time in the first column, and for receipts only sends lines captured
+// since the last successful run. Every delivered run is recorded in the
+// export history with its destination.
+package exportschedule
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+const (
+	TypeReceipts     = "receipts_csv"
+	TypePalletStatus = "pallet_status_csv"
+
+	ModeReplace = "replace"
+	ModeAppend  = "append"
+
+	TargetGoogleSheets = "google_sheets"
+
+	maxNameLen = 80
+)
+
+// Intervals are the run frequencies offered, in hours.
+var Intervals = []int{1, 6, 12, 24, 168}
+
+var (
+	ErrNameRequired        = errors.New("schedule name is required")
+	ErrNameTooLong         = errors.New("schedule name must be 80 characters or less")
+	ErrInvalidType         = errors.New("export type must be receipts or pallet status")
+	ErrInvalidMode         = errors.New("write mode must be append or replace")
+	ErrInvalidInterval     = errors.New("choose how often the export runs")
+	ErrSpreadsheetRequired = errors.New("spreadsheet ID or URL is required")
+	ErrTabRequired         = errors.New("sheet tab name is required")
+	ErrNotFound            = errors.New("export schedule not found")
+	ErrSheetsNotConfigured = errors.New("google sheets is not configured; set GOOGLE_SHEETS_CREDENTIALS_FILE")
+)
+
+// Schedule is one saved export preset.
+type Schedule struct {
+	ID            int64      `bun:"id"`
+	Name          string     `bun:"name"`
+	ProjectID     int64      `bun:"project_id"`
+	ProjectName   string     `bun:"project_name"`
+	ExportType    string     `bun:"export_type"`
+	Target        string     `bun:"target"`
+	SpreadsheetID string     `bun:"spreadsheet_id"`
+	SheetTab      string     `bun:"sheet_tab"`
+	WriteMode     string     `bun:"write_mode"`
+	IntervalHours int        `bun:"interval_hours"`
+	Active        bool       `bun:"active"`
+	NextRunAt     time.Time  `bun:"next_run_at"`
+	LastRunAt     *time.Time `bun:"last_run_at"`
+	LastSuccessAt *time.Time `bun:"last_success_at"`
+	LastError     string     `bun:"last_error"`
+}
+
+// Destination describes where the schedule delivers, as recorded in the
+// export history.
+func (s Schedule) Destination() string {
+	return fmt.Sprintf("Google Sheets %s, tab %q (%s)", s.SpreadsheetID, s.SheetTab, s.WriteMode)
+}
+
+// SpreadsheetURL links to the target spreadsheet.
+func (s Schedule) SpreadsheetURL() string {
+	return "https://docs.google.com/spreadsheets/d/" + url.PathEscape(s.SpreadsheetID) + "/edit"
+}
+
+// TypeLabel names the export for display.
+func TypeLabel(exportType string) string {
+	switch exportType {
+	case TypeReceipts:
+		return "Receipts"
+	case TypePalletStatus:
+		return "Pallet status"
+	}
+	return exportType
+}
+
+// IntervalLabel describes a run frequency.
+func IntervalLabel(hours int) string {
+	switch {
+	case hours == 1:
+		return "Hourly"
+	case hours == 24:
+		return "Daily"
+	case hours == 168:
+		return "Weekly"
+	}
+	return fmt.Sprintf("Every %d hours", hours)
+}
+
+// Input is what an admin submits for a schedule.
+type Input struct {
+	Name          string
+	ProjectID     int64
+	ExportType    string
+	SpreadsheetID string
+	SheetTab      string
+	WriteMode     string
+	IntervalHours int
+}
+
+var spreadsheetURLPattern = regexp.MustCompile(`/spreadsheets/d/([a-zA-Z0-9_-]+)`)
+
+// ParseSpreadsheetID accepts a spreadsheet ID or a link to the spreadsheet.
+func ParseSpreadsheetID(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if m := spreadsheetURLPattern.FindStringSubmatch(raw); m != nil {
+		return m[1]
+	}
+	return raw
+}
+
+func (in *Input) normalize() error {
+	in.Name = strings.TrimSpace(in.Name)
+	in.SpreadsheetID = ParseSpreadsheetID(in.SpreadsheetID)
+	in.SheetTab = strings.TrimSpace(in.SheetTab)
+	if in.Name == "" {
+		return ErrNameRequired
+	}
+	if len(in.Name) > maxNameLen {
+		return ErrNameTooLong
+	}
+	if in.ExportType != TypeReceipts && in.ExportType != TypePalletStatus {
+		return ErrInvalidType
+	}
+	if in.WriteMode != ModeReplace && in.WriteMode != ModeAppend {
+		return ErrInvalidMode
+	}
+	validInterval := false
+	for _, hours := range Intervals {
+		if in.IntervalHours == hours {
+			validInterval = true
+		}
+	}
+	if !validInterval {
+		return ErrInvalidInterval
+	}
+	if in.SpreadsheetID == "" {
+		return ErrSpreadsheetRequired
+	}
+	if in.SheetTab == "" {
+		return ErrTabRequired
+	}
+	return nil
+}
+
+const selectSchedules = `
+SELECT es.id, es.name, es.project_id, COALESCE(p.name, '') AS project_name, es.export_type, es.target,
+       es.spreadsheet_id, es.sheet_tab, es.write_mode, es.interval_hours, es.active,
+       es.next_run_at, es.last_run_at, es.last_success_at, es.last_error
+FROM export_schedules es
+LEFT JOIN projects p ON p.id = es.project_id`
+
+// List returns every schedule.
+func List(ctx context.Context, db *sqlite.DB) ([]Schedule, error) {
+	schedules := make([]Schedule, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(selectSchedules+`
+ORDER BY es.active DESC, es.name, es.id`).Scan(ctx, &schedules)
+	})
+	return schedules, err
+}
+
+// Create saves a schedule. Its first run is due straight away.
+func Create(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID int64, in Input) (int64, error) {
+	if err := in.normalize(); err != nil {
+		return 0, err
+	}
+	var id int64
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		now := time.Now().UTC()
+		if err := tx.NewRaw(`
+INSERT INTO export_schedules (name, project_id, export_type, target, spreadsheet_id, sheet_tab, write_mode, interval_hours,
+                              active, next_run_at, created_by_user_id, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?)
+RETURNING id`, in.Name, in.ProjectID, in.ExportType, TargetGoogleSheets, in.SpreadsheetID, in.SheetTab, in.WriteMode, in.IntervalHours,
+			now, userID, now, now).Scan(ctx, &id); err != nil {
+			return err
+		}
+		if auditSvc == nil {
+			return nil
+		}
+		return auditSvc.Write(ctx, tx, userID, "export_schedule.create", "export_schedules", strconv.FormatInt(id, 10), nil, in)
+	})
+	return id, err
+}
+
+// SetActive pauses or resumes a schedule.
+func SetActive(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, id int64, active bool) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		before, err := load(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE export_schedules SET active = ?, updated_at = ? WHERE id = ?`, active, time.Now().UTC(), id); err != nil {
+			return err
+		}
+		if auditSvc == nil {
+			return nil
+		}
+		return auditSvc.Write(ctx, tx, userID, "export_schedule.set_active", "export_schedules", strconv.FormatInt(id, 10),
+			map[string]any{"active": before.Active}, map[string]any{"active": active})
+	})
+}
+
+// RunNow makes a schedule due, so the runner picks it up when next woken.
+func RunNow(ctx context.Context, db *sqlite.DB, id int64) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := load(ctx, tx, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE export_schedules SET next_run_at = ?, updated_at = ? WHERE id = ?`, time.Now().UTC(), time.Now().UTC(), id)
+		return err
+	})
+}
+
+// Delete removes a schedule. Its runs stay in the export history.
+func Delete(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, id int64) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		before, err := load(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM export_schedules WHERE id = ?`, id); err != nil {
+			return err
+		}
+		if auditSvc == nil {
+			return nil
+		}
+		return auditSvc.Write(ctx, tx, userID, "export_schedule.delete", "export_schedules", strconv.FormatInt(id, 10), before, nil)
+	})
+}
+
+func load(ctx context.Context, tx bun.Tx, id int64) (Schedule, error) {
+	var s Schedule
+	if err := tx.NewRaw(selectSchedules+` WHERE es.id = ?`, id).Scan(ctx, &s); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return s, ErrNotFound
+		}
+		return s, err
+	}
+	return s, nil
+}
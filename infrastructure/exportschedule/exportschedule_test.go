@@ -0,0 +1,176 @@
+package exportschedule
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/exportrun"
+	"receipter/infrastructure/sqlite"
+)
+
+func openExportScheduleTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "exportschedule-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin1', 'x', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+				(1, 'Chilled', 'Chilled', DATE('now'), 'Client', 'chilled', 'active')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return db
+}
+
+type sheetCall struct {
+	mode   string
+	tab    string
+	header []string
+	rows   [][]string
+}
+
+type fakeSheets struct {
+	calls []sheetCall
+	err   error
+}
+
+func (f *fakeSheets) Replace(ctx context.Context, spreadsheetID, tab string, rows [][]string) error {
+	f.calls = append(f.calls, sheetCall{mode: ModeReplace, tab: tab, rows: rows})
+	return f.err
+}
+
+func (f *fakeSheets) Append(ctx context.Context, spreadsheetID, tab string, header []string, rows [][]string) error {
+	f.calls = append(f.calls, sheetCall{mode: ModeAppend, tab: tab, header: header, rows: rows})
+	return f.err
+}
+
+func TestParseSpreadsheetID(t *testing.T) {
+	cases := map[string]string{
+		"1AbC_d-9":  "1AbC_d-9",
+		" 1AbC_d-9": "1AbC_d-9",
+		"https://docs.google.com/spreadsheets/d/1AbC_d-9/edit#gid=0": "1AbC_d-9",
+	}
+	for raw, want := range cases {
+		if got := ParseSpreadsheetID(raw); got != want {
+			t.Fatalf("ParseSpreadsheetID(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestCreateValidates(t *testing.T) {
+	db := openExportScheduleTestDB(t)
+	in := Input{Name: "Daily", ProjectID: 1, ExportType: TypeReceipts, SpreadsheetID: "sheet", SheetTab: "Tab", WriteMode: ModeReplace, IntervalHours: 5}
+	if _, err := Create(context.Background(), db, nil, 1, in); !errors.Is(err, ErrInvalidInterval) {
+		t.Fatalf("expected ErrInvalidInterval, got %v", err)
+	}
+	in.IntervalHours = 24
+	in.SheetTab = " "
+	if _, err := Create(context.Background(), db, nil, 1, in); !errors.Is(err, ErrTabRequired) {
+		t.Fatalf("expected ErrTabRequired, got %v", err)
+	}
+}
+
+func TestRunDueDeliversAndRecordsDestination(t *testing.T) {
+	db := openExportScheduleTestDB(t)
+	ctx := context.Background()
+	id, err := Create(ctx, db, nil, 1, Input{
+		Name: "Receipts feed", ProjectID: 1, ExportType: TypeReceipts,
+		SpreadsheetID: "https://docs.google.com/spreadsheets/d/abc123/edit", SheetTab: "Feed",
+		WriteMode: ModeAppend, IntervalHours: 24,
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	var sinces []*time.Time
+	build := func(ctx context.Context, db *sqlite.DB, s Schedule, since *time.Time) (Table, error) {
+		sinces = append(sinces, since)
+		return Table{Header: []string{"SKU", "Qty"}, Rows: [][]string{{"A1", "5"}}, FormatVersion: 3}, nil
+	}
+	runner := NewRunner(db, build)
+
+	// Without credentials the run fails and the error is kept on the schedule.
+	now := time.Now().UTC()
+	if ran, err := runner.RunDue(ctx, now); err != nil || ran != 1 {
+		t.Fatalf("RunDue unconfigured = %d, %v", ran, err)
+	}
+	schedules, err := List(ctx, db)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if schedules[0].LastError != ErrSheetsNotConfigured.Error() || schedules[0].LastSuccessAt != nil {
+		t.Fatalf("expected not-configured failure, got %+v", schedules[0])
+	}
+
+	sheets := &fakeSheets{}
+	runner.Sheets = sheets
+	if ran, _ := runner.RunDue(ctx, now); ran != 0 {
+		t.Fatalf("schedule ran again before it was due")
+	}
+	if err := RunNow(ctx, db, id); err != nil {
+		t.Fatalf("run now: %v", err)
+	}
+	if ran, err := runner.RunDue(ctx, now.Add(time.Minute)); err != nil || ran != 1 {
+		t.Fatalf("RunDue = %d, %v", ran, err)
+	}
+	if len(sheets.calls) != 1 || sheets.calls[0].mode != ModeAppend || sheets.calls[0].tab != "Feed" {
+		t.Fatalf("unexpected sheet calls %+v", sheets.calls)
+	}
+	call := sheets.calls[0]
+	if call.header[0] != "Exported At" || len(call.rows) != 1 || call.rows[0][1] != "A1" {
+		t.Fatalf("append rows not stamped: %+v", call)
+	}
+	if sinces[len(sinces)-1] != nil {
+		t.Fatalf("first delivery should export everything")
+	}
+
+	// The next append only asks for lines since the last success.
+	if ran, _ := runner.RunDue(ctx, now.Add(25*time.Hour)); ran != 1 {
+		t.Fatalf("expected the schedule to be due a day later")
+	}
+	if sinces[len(sinces)-1] == nil {
+		t.Fatalf("append run should be limited to new lines")
+	}
+
+	records, err := exportrun.List(ctx, db, 10)
+	if err != nil {
+		t.Fatalf("export runs: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 recorded runs, got %d", len(records))
+	}
+	if !strings.Contains(records[0].Destination, "abc123") || !strings.Contains(records[0].Destination, `"Feed"`) {
+		t.Fatalf("destination not recorded: %q", records[0].Destination)
+	}
+	if records[0].RowCount != 1 || !strings.Contains(records[0].Params, "schedule_id=") {
+		t.Fatalf("unexpected run record %+v", records[0])
+	}
+}
@@ -0,0 +1,268 @@
+package exportschedule
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/exportformat"
+	"receipter/infrastructure/exportrun"
+	"receipter/infrastructure/notification"
+	"receipter/infrastructure/sqlite"
+)
+
+const (
+	runnerPollInterval = 5 * time.Minute
+	// leaseDuration keeps a claimed schedule from being picked up again while
+	// it runs; a crashed run is retried once the lease lapses.
+	leaseDuration = 15 * time.Minute
+	maxErrorLen   = 500
+)
+
+// Table is one run's data: a header and its rows, already formatted.
+type Table struct {
+	Header        []string
+	Rows          [][]string
+	FormatVersion int
+}
+
+// Builder produces a schedule's data. since is set for append-mode receipt
+// exports and limits the rows to lines captured after it.
+type Builder func(ctx context.Context, db *sqlite.DB, s Schedule, since *time.Time) (Table, error)
+
+// SheetWriter delivers rows to a spreadsheet tab; *gsheets.Client is the
+// production implementation.
+type SheetWriter interface {
+	Replace(ctx context.Context, spreadsheetID, tab string, rows [][]string) error
+	Append(ctx context.Context, spreadsheetID, tab string, header []string, rows [][]string) error
+}
+
+// Runner runs due schedules in the background.
+type Runner struct {
+	db    *sqlite.DB
+	build Builder
+	// Sheets is nil when Google Sheets is not configured; due schedules then
+	// fail with ErrSheetsNotConfigured.
+	Sheets SheetWriter
+
+	// Paused, when set before Start, holds due schedules while it returns
+	// true; they run on the first poll after it clears.
+	Paused func() bool
+
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	started atomic.Bool
+}
+
+// NewRunner returns a runner that builds each schedule's data with build.
+func NewRunner(db *sqlite.DB, build Builder) *Runner {
+	return &Runner{
+		db:    db,
+		build: build,
+		wake:  make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// Notify wakes the runner, for example after Run now. Safe on a nil runner.
+func (r *Runner) Notify() {
+	if r == nil {
+		return
+	}
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the runner until Stop.
+func (r *Runner) Start() {
+	r.started.Store(true)
+	go func() {
+		defer close(r.done)
+		ctx := context.Background()
+		ticker := time.NewTicker(runnerPollInterval)
+		defer ticker.Stop()
+		for {
+			if r.Paused == nil || !r.Paused() {
+				if _, err := r.RunDue(ctx, time.Now().UTC()); err != nil {
+					slog.Error("export schedules: run failed", slog.Any("err", err))
+				}
+			}
+			select {
+			case <-r.stop:
+				return
+			case <-r.wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends a started runner and waits for the current delivery to finish.
+func (r *Runner) Stop() {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+	if !r.started.Load() {
+		return
+	}
+	select {
+	case <-r.done:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+// RunDue delivers every active schedule due at now and returns how many it
+// ran. Delivery failures are recorded on the schedule; only storage errors
+// are returned.
+func (r *Runner) RunDue(ctx context.Context, now time.Time) (int, error) {
+	ran := 0
+	for {
+		s, ok, err := r.claimNext(ctx, now)
+		if err != nil {
+			return ran, err
+		}
+		if !ok {
+			return ran, nil
+		}
+		if err := r.run(ctx, s, now); err != nil {
+			return ran, err
+		}
+		ran++
+	}
+}
+
+func (r *Runner) claimNext(ctx context.Context, now time.Time) (Schedule, bool, error) {
+	var s Schedule
+	err := r.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(selectSchedules+`
+WHERE es.active = 1 AND julianday(es.next_run_at) <= julianday(?)
+ORDER BY es.next_run_at, es.id
+LIMIT 1`, now).Scan(ctx, &s); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE export_schedules SET next_run_at = ? WHERE id = ?`, now.Add(leaseDuration), s.ID)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, false, nil
+	}
+	return s, err == nil, err
+}
+
+// run builds and delivers one schedule, then records the outcome and when it
+// is next due.
+func (r *Runner) run(ctx context.Context, s Schedule, now time.Time) error {
+	startedAt := time.Now()
+	table, deliverErr := r.deliver(ctx, s, now)
+	next := now.Add(time.Duration(s.IntervalHours) * time.Hour)
+
+	err := r.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if deliverErr != nil {
+			if _, err := tx.ExecContext(ctx, `
+UPDATE export_schedules SET last_run_at = ?, last_error = ?, next_run_at = ? WHERE id = ?`,
+				now, truncateError(deliverErr), next, s.ID); err != nil {
+				return err
+			}
+			// Admins hear about the first failure of a streak, not every
+			// retry of a schedule that stays broken.
+			if s.LastError != "" {
+				return nil
+			}
+			return notification.Add(ctx, tx, notification.Notification{
+				Kind:      notification.KindExportFailed,
+				ProjectID: s.ProjectID,
+				Title:     fmt.Sprintf("Scheduled export %q failed", s.Name),
+				Body:      truncateError(deliverErr),
+				Link:      "/tasker/exports/schedules",
+			})
+		}
+		_, err := tx.ExecContext(ctx, `
+UPDATE export_schedules SET last_run_at = ?, last_success_at = ?, last_error = '', next_run_at = ? WHERE id = ?`,
+			now, now, next, s.ID)
+		return err
+	})
+	if err != nil || deliverErr != nil {
+		if deliverErr != nil {
+			slog.Warn("export schedules: delivery failed", slog.Int64("schedule_id", s.ID), slog.Any("err", deliverErr))
+		}
+		return err
+	}
+
+	params := url.Values{}
+	params.Set(exportformat.QueryParam, strconv.Itoa(table.FormatVersion))
+	params.Set("schedule_id", strconv.FormatInt(s.ID, 10))
+	projectID := s.ProjectID
+	if err := exportrun.Save(ctx, r.db, exportrun.Run{
+		ProjectID:   &projectID,
+		ExportType:  s.ExportType,
+		Params:      params,
+		RowCount:    int64(len(table.Rows)),
+		Duration:    time.Since(startedAt),
+		Destination: s.Destination(),
+	}); err != nil {
+		slog.Error("export schedules: record export run failed", slog.Int64("schedule_id", s.ID), slog.Any("err", err))
+	}
+	return nil
+}
+
+func (r *Runner) deliver(ctx context.Context, s Schedule, now time.Time) (Table, error) {
+	if r.Sheets == nil {
+		return Table{}, ErrSheetsNotConfigured
+	}
+	if r.build == nil {
+		return Table{}, fmt.Errorf("no builder for export type %q", s.ExportType)
+	}
+	var since *time.Time
+	if s.WriteMode == ModeAppend && s.ExportType == TypeReceipts {
+		since = s.LastSuccessAt
+	}
+	table, err := r.build(ctx, r.db, s, since)
+	if err != nil {
+		return table, err
+	}
+	if s.WriteMode == ModeReplace {
+		return table, r.Sheets.Replace(ctx, s.SpreadsheetID, s.SheetTab, append([][]string{table.Header}, table.Rows...))
+	}
+	// Appended rows carry the run time so each batch can be told apart.
+	stamp := now.Format("2006-01-02 15:04:05")
+	header := append([]string{"Exported At"}, table.Header...)
+	rows := make([][]string, 0, len(table.Rows))
+	for _, row := range table.Rows {
+		rows = append(rows, append([]string{stamp}, row...))
+	}
+	return table, r.Sheets.Append(ctx, s.SpreadsheetID, s.SheetTab, header, rows)
+}
+
+func truncateError(err error) string {
+	msg := err.Error()
+	if len(msg) > maxErrorLen {
+		msg = msg[:maxErrorLen]
+	}
+	return msg
+}
+
+// Account is the service account spreadsheets must be shared with, or empty
+// when Google Sheets is not configured.
+func (r *Runner) Account() string {
+	if r == nil || r.Sheets == nil {
+		return ""
+	}
+	if a, ok := r.Sheets.(interface{ Email() string }); ok {
+		return a.Email()
+	}
+	return ""
+}
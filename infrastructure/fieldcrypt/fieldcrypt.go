@@ -0,0 +1,255 @@
+// Package fieldcrypt encrypts selected client-identifiable text columns at
+// rest with AES-256-GCM.
+//
+// Encrypted values are stored as "enc:v1:<key id>:<base64 nonce+ciphertext>"
+// so rows written before a key was configured, or under a retired key, can be
+// told apart and re-keyed. Values without the prefix are legacy plaintext and
+// are read back unchanged.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+const prefix = "enc:v1:"
+
+// Environment variables read by LoadFromEnv. Keys are "<id>:<base64 32 bytes>";
+// KEY_FILE holds the same value and is meant for secrets rendered to disk by a
+// KMS agent. PREVIOUS_KEYS is a comma separated list kept for decryption while
+// rows are re-keyed.
+const (
+	EnvKey          = "FIELD_ENCRYPTION_KEY"
+	EnvKeyFile      = "FIELD_ENCRYPTION_KEY_FILE"
+	EnvPreviousKeys = "FIELD_ENCRYPTION_PREVIOUS_KEYS"
+)
+
+var (
+	ErrInvalidKey = errors.New("field encryption key must be <id>:<base64 32-byte key>")
+	ErrNoKey      = errors.New("field encryption key is not configured")
+	ErrUnknownKey = errors.New("field encryption key id is not configured")
+	ErrCorrupt    = errors.New("encrypted field value is corrupt")
+)
+
+// Keyring holds the key new values are encrypted with plus any retired keys
+// still needed to read older rows.
+type Keyring struct {
+	currentID string
+	aeads     map[string]cipher.AEAD
+}
+
+// NewKeyring builds a keyring from raw 32-byte keys. currentID must be one of
+// the keys; the rest are only used for decryption.
+func NewKeyring(currentID string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[currentID]; !ok {
+		return nil, ErrUnknownKey
+	}
+	k := &Keyring{currentID: currentID, aeads: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") || len(key) != 32 {
+			return nil, ErrInvalidKey
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads[id] = aead
+	}
+	return k, nil
+}
+
+// ParseKeyring builds a keyring from the "<id>:<base64>" config format.
+// previous may be empty or a comma separated list.
+func ParseKeyring(current, previous string) (*Keyring, error) {
+	currentID, key, err := parseKey(current)
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string][]byte{currentID: key}
+	for _, entry := range strings.Split(previous, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		id, key, err := parseKey(entry)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := keys[id]; !exists {
+			keys[id] = key
+		}
+	}
+	return NewKeyring(currentID, keys)
+}
+
+// LoadFromEnv reads the keyring from the FIELD_ENCRYPTION_* variables. It
+// returns nil without error when no key is configured.
+func LoadFromEnv() (*Keyring, error) {
+	current := strings.TrimSpace(os.Getenv(EnvKey))
+	if path := strings.TrimSpace(os.Getenv(EnvKeyFile)); current == "" && path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", EnvKeyFile, err)
+		}
+		current = strings.TrimSpace(string(raw))
+	}
+	if current == "" {
+		return nil, nil
+	}
+	return ParseKeyring(current, os.Getenv(EnvPreviousKeys))
+}
+
+func parseKey(entry string) (string, []byte, error) {
+	id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+	if !ok || strings.TrimSpace(id) == "" {
+		return "", nil, ErrInvalidKey
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != 32 {
+		return "", nil, ErrInvalidKey
+	}
+	return strings.TrimSpace(id), key, nil
+}
+
+// CurrentKeyID is the id new values are encrypted under.
+func (k *Keyring) CurrentKeyID() string {
+	return k.currentID
+}
+
+// Encrypt seals plain under the current key. Empty strings stay empty so
+// COALESCE and emptiness checks in queries keep working.
+func (k *Keyring) Encrypt(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	aead := k.aeads[k.currentID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return prefix + k.currentID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a stored value. Legacy plaintext is returned unchanged.
+func (k *Keyring) Decrypt(stored string) (string, error) {
+	id, encoded, ok := split(stored)
+	if !ok {
+		return stored, nil
+	}
+	aead, known := k.aeads[id]
+	if !known {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) < aead.NonceSize() {
+		return "", ErrCorrupt
+	}
+	plain, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], nil)
+	if err != nil {
+		return "", ErrCorrupt
+	}
+	return string(plain), nil
+}
+
+// KeyID returns the key a stored value was encrypted under, or "" for
+// plaintext.
+func KeyID(stored string) string {
+	id, _, _ := split(stored)
+	return id
+}
+
+func split(stored string) (string, string, bool) {
+	if !strings.HasPrefix(stored, prefix) {
+		return "", "", false
+	}
+	id, encoded, ok := strings.Cut(stored[len(prefix):], ":")
+	if !ok || id == "" {
+		return "", "", false
+	}
+	return id, encoded, true
+}
+
+var active atomic.Pointer[Keyring]
+
+// Configure sets the process-wide keyring used by String and the package
+// level helpers. A nil keyring turns encryption off for new writes; values
+// already encrypted then fail to read with ErrNoKey.
+func Configure(k *Keyring) {
+	active.Store(k)
+}
+
+// Active returns the configured keyring, or nil.
+func Active() *Keyring {
+	return active.Load()
+}
+
+// Encrypt seals plain with the configured keyring, or returns it unchanged
+// when none is configured.
+func Encrypt(plain string) (string, error) {
+	k := active.Load()
+	if k == nil {
+		return plain, nil
+	}
+	return k.Encrypt(plain)
+}
+
+// Decrypt opens a stored value with the configured keyring.
+func Decrypt(stored string) (string, error) {
+	k := active.Load()
+	if k == nil {
+		if _, _, ok := split(stored); ok {
+			return "", ErrNoKey
+		}
+		return stored, nil
+	}
+	return k.Decrypt(stored)
+}
+
+// String is a text column encrypted at rest. Use it as the field type of a
+// model or scan destination so reads and writes go through the keyring
+// without the query code knowing about it.
+type String string
+
+// Value implements driver.Valuer.
+func (s String) Value() (driver.Value, error) {
+	return Encrypt(string(s))
+}
+
+// Scan implements sql.Scanner.
+func (s *String) Scan(src any) error {
+	var stored string
+	switch v := src.(type) {
+	case nil:
+		stored = ""
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("fieldcrypt: cannot scan %T", src)
+	}
+	plain, err := Decrypt(stored)
+	if err != nil {
+		return err
+	}
+	*s = String(plain)
+	return nil
+}
+
+// Dest adapts a plain string field as a scan destination for an encrypted
+// column, for positional Scan calls.
+func Dest(s *string) *String {
+	return (*String)(s)
+}
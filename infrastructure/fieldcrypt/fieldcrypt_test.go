@@ -0,0 +1,191 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func testKey(id string, fill byte) string {
+	return id + ":" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{fill}, 32))
+}
+
+func mustKeyring(t *testing.T, current, previous string) *Keyring {
+	t.Helper()
+	k, err := ParseKeyring(current, previous)
+	if err != nil {
+		t.Fatalf("parse keyring: %v", err)
+	}
+	return k
+}
+
+func configure(t *testing.T, k *Keyring) {
+	t.Helper()
+	prev := Active()
+	Configure(k)
+	t.Cleanup(func() { Configure(prev) })
+}
+
+func TestEncryptRoundTripAndLegacyPlaintext(t *testing.T) {
+	k := mustKeyring(t, testKey("k1", 1), "")
+
+	sealed, err := k.Encrypt("Acme Foods")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if !strings.HasPrefix(sealed, "enc:v1:k1:") || strings.Contains(sealed, "Acme") {
+		t.Fatalf("unexpected sealed value %q", sealed)
+	}
+	again, _ := k.Encrypt("Acme Foods")
+	if again == sealed {
+		t.Fatalf("expected a fresh nonce per encryption")
+	}
+	plain, err := k.Decrypt(sealed)
+	if err != nil || plain != "Acme Foods" {
+		t.Fatalf("decrypt = %q, %v", plain, err)
+	}
+	if plain, err := k.Decrypt("Legacy Client"); err != nil || plain != "Legacy Client" {
+		t.Fatalf("legacy plaintext = %q, %v", plain, err)
+	}
+	if _, err := k.Decrypt(sealed[:len(sealed)-4] + "AAAA"); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected tampered value rejected, got %v", err)
+	}
+}
+
+func TestParseKeyringRejectsBadKeys(t *testing.T) {
+	for _, raw := range []string{"", "k1", "k1:not-base64", "k1:" + base64.StdEncoding.EncodeToString([]byte("short")), ":" + base64.StdEncoding.EncodeToString(make([]byte, 32))} {
+		if _, err := ParseKeyring(raw, ""); !errors.Is(err, ErrInvalidKey) {
+			t.Fatalf("ParseKeyring(%q) err = %v", raw, err)
+		}
+	}
+}
+
+func TestDecryptWithRetiredKeyAndWithoutKeyring(t *testing.T) {
+	old := mustKeyring(t, testKey("k1", 1), "")
+	sealed, _ := old.Encrypt("Acme")
+
+	rotated := mustKeyring(t, testKey("k2", 2), testKey("k1", 1))
+	if plain, err := rotated.Decrypt(sealed); err != nil || plain != "Acme" {
+		t.Fatalf("decrypt with previous key = %q, %v", plain, err)
+	}
+	if _, err := mustKeyring(t, testKey("k2", 2), "").Decrypt(sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected unknown key, got %v", err)
+	}
+
+	configure(t, nil)
+	var s String
+	if err := s.Scan(sealed); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("expected ErrNoKey without keyring, got %v", err)
+	}
+}
+
+func openTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	db, err := sqlite.OpenDB(filepath.Join(t.TempDir(), "fieldcrypt-test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	return db
+}
+
+func rawClientName(t *testing.T, db *sqlite.DB, id int64) string {
+	t.Helper()
+	var v string
+	err := db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT client_name FROM projects WHERE id = ?`, id).Scan(ctx, &v)
+	})
+	if err != nil {
+		t.Fatalf("read client_name: %v", err)
+	}
+	return v
+}
+
+func TestStringColumnAndRekey(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	configure(t, nil)
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO projects (id, name, description, project_date, client_name, code, status)
+VALUES (1, 'Legacy', 'd', '2026-01-01', ?, 'legacy', 'active')`, String("Legacy Client"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed plaintext project: %v", err)
+	}
+	if got := rawClientName(t, db, 1); got != "Legacy Client" {
+		t.Fatalf("expected plaintext without keyring, got %q", got)
+	}
+
+	configure(t, mustKeyring(t, testKey("k1", 1), ""))
+	err = db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO projects (id, name, description, project_date, client_name, code, status)
+VALUES (2, 'New', 'd', '2026-01-02', ?, 'new', 'active')`, String("Acme"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed encrypted project: %v", err)
+	}
+	if got := rawClientName(t, db, 2); KeyID(got) != "k1" {
+		t.Fatalf("expected client_name stored under k1, got %q", got)
+	}
+
+	var names []String
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT client_name FROM projects ORDER BY id`).Scan(ctx, &names)
+	})
+	if err != nil {
+		t.Fatalf("scan names: %v", err)
+	}
+	if len(names) != 2 || names[0] != "Legacy Client" || names[1] != "Acme" {
+		t.Fatalf("unexpected decrypted names %v", names)
+	}
+
+	rotated := mustKeyring(t, testKey("k2", 2), testKey("k1", 1))
+	configure(t, rotated)
+	result, err := Rekey(ctx, db, rotated)
+	if err != nil {
+		t.Fatalf("rekey: %v", err)
+	}
+	if result["projects.client_name"] != 2 {
+		t.Fatalf("expected both projects rewritten, got %v", result)
+	}
+	for _, id := range []int64{1, 2} {
+		if got := rawClientName(t, db, id); KeyID(got) != "k2" {
+			t.Fatalf("project %d not re-keyed: %q", id, got)
+		}
+	}
+	result, err = Rekey(ctx, db, rotated)
+	if err != nil || result["projects.client_name"] != 0 {
+		t.Fatalf("expected re-run to be a no-op, got %v, %v", result, err)
+	}
+
+	var name String
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT client_name FROM projects WHERE id = 1`).Scan(ctx, &name)
+	})
+	if err != nil || name != "Legacy Client" {
+		t.Fatalf("read after rekey = %q, %v", name, err)
+	}
+}
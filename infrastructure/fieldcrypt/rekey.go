@@ -0,0 +1,90 @@
+package fieldcrypt
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+// Column names an encrypted text column.
+type Column struct {
+	Table string
+	Name  string
+}
+
+// Columns lists every column stored through String.
+var Columns = []Column{
+	{Table: "projects", Name: "client_name"},
+	{Table: "sku_client_comments", Name: "comment"},
+	{Table: "project_webhooks", Name: "secret"},
+}
+
+// rekeyBatch keeps each write transaction short so the app can keep serving
+// while a large table is re-keyed.
+const rekeyBatch = 500
+
+// RekeyResult counts rows rewritten per column, keyed "table.column".
+type RekeyResult map[string]int
+
+// Rekey rewrites every encrypted column under the keyring's current key:
+// plaintext rows are encrypted and rows under a previous key are re-sealed.
+// Rows already on the current key are left alone, so it is safe to re-run.
+func Rekey(ctx context.Context, db *sqlite.DB, k *Keyring) (RekeyResult, error) {
+	if k == nil {
+		return nil, ErrNoKey
+	}
+	result := RekeyResult{}
+	for _, c := range Columns {
+		n, err := rekeyColumn(ctx, db, k, c)
+		if err != nil {
+			return result, fmt.Errorf("rekey %s.%s: %w", c.Table, c.Name, err)
+		}
+		result[c.Table+"."+c.Name] = n
+	}
+	return result, nil
+}
+
+func rekeyColumn(ctx context.Context, db *sqlite.DB, k *Keyring, c Column) (int, error) {
+	rewritten := 0
+	var afterID int64
+	for {
+		rows := make([]struct {
+			ID    int64  `bun:"id"`
+			Value string `bun:"value"`
+		}, 0, rekeyBatch)
+		err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+			if err := tx.NewRaw(`SELECT id, COALESCE(?, '') AS value FROM ? WHERE id > ? ORDER BY id LIMIT ?`,
+				bun.Ident(c.Name), bun.Ident(c.Table), afterID, rekeyBatch).Scan(ctx, &rows); err != nil {
+				return err
+			}
+			for _, row := range rows {
+				if row.Value == "" || KeyID(row.Value) == k.CurrentKeyID() {
+					continue
+				}
+				plain, err := k.Decrypt(row.Value)
+				if err != nil {
+					return fmt.Errorf("row %d: %w", row.ID, err)
+				}
+				sealed, err := k.Encrypt(plain)
+				if err != nil {
+					return err
+				}
+				if _, err := tx.ExecContext(ctx, `UPDATE ? SET ? = ? WHERE id = ?`, bun.Ident(c.Table), bun.Ident(c.Name), sealed, row.ID); err != nil {
+					return err
+				}
+				rewritten++
+			}
+			return nil
+		})
+		if err != nil {
+			return rewritten, err
+		}
+		if len(rows) < rekeyBatch {
+			return rewritten, nil
+		}
+		afterID = rows[len(rows)-1].ID
+	}
+}
@@ -0,0 +1,485 @@
+// Package floormap keeps each site's floor map: a grid of cells, rows by
+// columns, with named zones over parts of it, and the cell each pallet is
+// stored in. Cells are labelled like a spreadsheet, column letters then row
+// number, so "C12" is the third column of the twelfth row.
+package floormap
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+// MaxSize bounds both dimensions of a map.
+const MaxSize = 99
+
+// Statuses in the order a cell holding several takes its colour from: a cell
+// with any pallet still being received shows as open.
+var Statuses = []string{"open", "closed", "labelled", "created", "cancelled"}
+
+var (
+	ErrInvalidSize      = errors.New("rows and columns must be between 1 and 99")
+	ErrNotConfigured    = errors.New("the site has no floor map yet")
+	ErrInvalidCell      = errors.New("cell must be column letters then row number, e.g. C12")
+	ErrCellOutside      = errors.New("cell is outside the floor map")
+	ErrCellsOccupied    = errors.New("pallets are stored in cells outside the new size; move them first")
+	ErrZonesOutside     = errors.New("zones extend past the new size; delete them first")
+	ErrZoneCodeRequired = errors.New("zone code is required")
+	ErrZoneNameRequired = errors.New("zone name is required")
+	ErrZoneCodeExists   = errors.New("zone code already exists on this site")
+	ErrZoneNotFound     = errors.New("zone not found")
+	ErrPalletNotFound   = errors.New("pallet not found")
+	ErrPalletOtherSite  = errors.New("pallet belongs to a project at another site")
+	ErrPalletCancelled  = errors.New("cancelled pallets cannot be placed")
+	ErrPalletNotPlaced  = errors.New("pallet is not on this floor map")
+)
+
+var (
+	cellPattern     = regexp.MustCompile(`^([A-Za-z]{1,2})0*([1-9][0-9]*)$`)
+	zoneCodePattern = regexp.MustCompile(`[^A-Z0-9]+`)
+)
+
+// ColumnLetters names a 1-based column: A to Z, then AA onwards.
+func ColumnLetters(col int) string {
+	letters := ""
+	for col > 0 {
+		col--
+		letters = string(rune('A'+col%26)) + letters
+		col /= 26
+	}
+	return letters
+}
+
+// CellLabel names a cell, e.g. CellLabel(12, 3) is "C12".
+func CellLabel(row, col int) string {
+	return ColumnLetters(col) + strconv.Itoa(row)
+}
+
+// ParseCell reads a cell label into its row and column.
+func ParseCell(raw string) (row, col int, err error) {
+	m := cellPattern.FindStringSubmatch(strings.TrimSpace(raw))
+	if m == nil {
+		return 0, 0, ErrInvalidCell
+	}
+	for _, r := range strings.ToUpper(m[1]) {
+		col = col*26 + int(r-'A'+1)
+	}
+	row, err = strconv.Atoi(m[2])
+	if err != nil {
+		return 0, 0, ErrInvalidCell
+	}
+	return row, col, nil
+}
+
+type Zone struct {
+	ID       int64  `bun:"id"`
+	Code     string `bun:"code"`
+	Name     string `bun:"name"`
+	FirstRow int    `bun:"first_row"`
+	LastRow  int    `bun:"last_row"`
+	FirstCol int    `bun:"first_col"`
+	LastCol  int    `bun:"last_col"`
+}
+
+// Contains reports whether the cell lies in the zone.
+func (z Zone) Contains(row, col int) bool {
+	return row >= z.FirstRow && row <= z.LastRow && col >= z.FirstCol && col <= z.LastCol
+}
+
+// Range is the zone's cells as "A1:C4".
+func (z Zone) Range() string {
+	return CellLabel(z.FirstRow, z.FirstCol) + ":" + CellLabel(z.LastRow, z.LastCol)
+}
+
+// Map is a site's grid. Rows and Cols are 0 until the map is configured.
+type Map struct {
+	SiteID int64
+	Rows   int
+	Cols   int
+	Zones  []Zone
+}
+
+func (m Map) Configured() bool {
+	return m.Rows > 0 && m.Cols > 0
+}
+
+// Contains reports whether the cell is on the map.
+func (m Map) Contains(row, col int) bool {
+	return row >= 1 && row <= m.Rows && col >= 1 && col <= m.Cols
+}
+
+// ZoneAt returns the first zone, by code, that the cell lies in.
+func (m Map) ZoneAt(row, col int) (Zone, bool) {
+	for _, z := range m.Zones {
+		if z.Contains(row, col) {
+			return z, true
+		}
+	}
+	return Zone{}, false
+}
+
+// Load returns a site's map; an unconfigured site gives a zero-sized map.
+func Load(ctx context.Context, db *sqlite.DB, siteID int64) (Map, error) {
+	var m Map
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		m, err = loadMap(ctx, tx, siteID)
+		return err
+	})
+	return m, err
+}
+
+func loadMap(ctx context.Context, tx bun.Tx, siteID int64) (Map, error) {
+	m := Map{SiteID: siteID, Zones: make([]Zone, 0)}
+	var size struct {
+		Rows int `bun:"rows"`
+		Cols int `bun:"cols"`
+	}
+	err := tx.NewRaw(`SELECT rows, cols FROM floor_maps WHERE site_id = ?`, siteID).Scan(ctx, &size)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return m, err
+	}
+	m.Rows, m.Cols = size.Rows, size.Cols
+	if err := tx.NewRaw(`
+SELECT id, code, name, first_row, last_row, first_col, last_col
+FROM floor_map_zones
+WHERE site_id = ?
+ORDER BY code ASC, id ASC`, siteID).Scan(ctx, &m.Zones); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+// Configure sets a site's grid size. A map cannot shrink past a zone or a
+// stored pallet.
+func Configure(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, siteID int64, rows, cols int) error {
+	if rows < 1 || rows > MaxSize || cols < 1 || cols > MaxSize {
+		return ErrInvalidSize
+	}
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		before, err := loadMap(ctx, tx, siteID)
+		if err != nil {
+			return err
+		}
+		var outside int
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM pallet_locations WHERE site_id = ? AND (row_no > ? OR col_no > ?)`, siteID, rows, cols).Scan(ctx, &outside); err != nil {
+			return err
+		}
+		if outside > 0 {
+			return ErrCellsOccupied
+		}
+		for _, z := range before.Zones {
+			if z.LastRow > rows || z.LastCol > cols {
+				return ErrZonesOutside
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO floor_maps (site_id, rows, cols, updated_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(site_id) DO UPDATE SET rows = excluded.rows, cols = excluded.cols, updated_at = excluded.updated_at`, siteID, rows, cols); err != nil {
+			return err
+		}
+		if auditSvc != nil && userID > 0 {
+			return auditSvc.Write(ctx, tx, userID, "site.floor_map", "sites", strconv.FormatInt(siteID, 10),
+				map[string]any{"rows": before.Rows, "cols": before.Cols}, map[string]any{"rows": rows, "cols": cols})
+		}
+		return nil
+	})
+}
+
+// NormalizeZoneCode upper-cases a zone code and drops everything but letters
+// and digits, e.g. "bulk 1" -> "BULK1".
+func NormalizeZoneCode(raw string) string {
+	v := zoneCodePattern.ReplaceAllString(strings.ToUpper(strings.TrimSpace(raw)), "")
+	if len(v) > 16 {
+		v = v[:16]
+	}
+	return v
+}
+
+// AddZone names the rectangle between two corner cells, given in either
+// order.
+func AddZone(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, siteID int64, code, name, fromCell, toCell string) (Zone, error) {
+	z := Zone{Code: NormalizeZoneCode(code), Name: strings.TrimSpace(name)}
+	if z.Code == "" {
+		return z, ErrZoneCodeRequired
+	}
+	if z.Name == "" {
+		return z, ErrZoneNameRequired
+	}
+	fromRow, fromCol, err := ParseCell(fromCell)
+	if err != nil {
+		return z, err
+	}
+	toRow, toCol, err := ParseCell(toCell)
+	if err != nil {
+		return z, err
+	}
+	z.FirstRow, z.LastRow = min(fromRow, toRow), max(fromRow, toRow)
+	z.FirstCol, z.LastCol = min(fromCol, toCol), max(fromCol, toCol)
+
+	err = db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		m, err := loadMap(ctx, tx, siteID)
+		if err != nil {
+			return err
+		}
+		if !m.Configured() {
+			return ErrNotConfigured
+		}
+		if !m.Contains(z.FirstRow, z.FirstCol) || !m.Contains(z.LastRow, z.LastCol) {
+			return ErrCellOutside
+		}
+		for _, existing := range m.Zones {
+			if existing.Code == z.Code {
+				return ErrZoneCodeExists
+			}
+		}
+		res, err := tx.ExecContext(ctx, `
+INSERT INTO floor_map_zones (site_id, code, name, first_row, last_row, first_col, last_col, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`, siteID, z.Code, z.Name, z.FirstRow, z.LastRow, z.FirstCol, z.LastCol)
+		if err != nil {
+			return err
+		}
+		if z.ID, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		if auditSvc != nil && userID > 0 {
+			return auditSvc.Write(ctx, tx, userID, "site.zone_create", "sites", strconv.FormatInt(siteID, 10), nil,
+				map[string]any{"zone_id": z.ID, "code": z.Code, "name": z.Name, "range": z.Range()})
+		}
+		return nil
+	})
+	return z, err
+}
+
+// DeleteZone removes a zone. Pallets in its cells stay where they are.
+func DeleteZone(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, siteID, zoneID int64) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var z Zone
+		if err := tx.NewRaw(`
+SELECT id, code, name, first_row, last_row, first_col, last_col
+FROM floor_map_zones
+WHERE id = ? AND site_id = ?`, zoneID, siteID).Scan(ctx, &z); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrZoneNotFound
+			}
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM floor_map_zones WHERE id = ?`, zoneID); err != nil {
+			return err
+		}
+		if auditSvc != nil && userID > 0 {
+			return auditSvc.Write(ctx, tx, userID, "site.zone_delete", "sites", strconv.FormatInt(siteID, 10),
+				map[string]any{"zone_id": z.ID, "code": z.Code, "name": z.Name, "range": z.Range()}, nil)
+		}
+		return nil
+	})
+}
+
+// Place stores a pallet in a cell, moving it if it was stored elsewhere. The
+// pallet's project must be at the map's site.
+func Place(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, siteID, palletID int64, row, col int) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		m, err := loadMap(ctx, tx, siteID)
+		if err != nil {
+			return err
+		}
+		if !m.Configured() {
+			return ErrNotConfigured
+		}
+		if !m.Contains(row, col) {
+			return ErrCellOutside
+		}
+		var pallet struct {
+			ProjectID int64  `bun:"project_id"`
+			Status    string `bun:"status"`
+			SiteID    *int64 `bun:"site_id"`
+		}
+		if err := tx.NewRaw(`
+SELECT p.project_id, p.status, pr.site_id
+FROM pallets p
+JOIN projects pr ON pr.id = p.project_id
+WHERE p.id = ?`, palletID).Scan(ctx, &pallet); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrPalletNotFound
+			}
+			return err
+		}
+		if pallet.SiteID == nil || *pallet.SiteID != siteID {
+			return ErrPalletOtherSite
+		}
+		if pallet.Status == "cancelled" {
+			return ErrPalletCancelled
+		}
+
+		before, err := currentCell(ctx, tx, palletID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO pallet_locations (pallet_id, site_id, row_no, col_no, placed_by_user_id, placed_at)
+VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT(pallet_id) DO UPDATE SET
+    site_id = excluded.site_id, row_no = excluded.row_no, col_no = excluded.col_no,
+    placed_by_user_id = excluded.placed_by_user_id, placed_at = excluded.placed_at`,
+			palletID, siteID, row, col, nullableUserID(userID), time.Now().UTC()); err != nil {
+			return err
+		}
+		if auditSvc != nil && userID > 0 {
+			return auditSvc.Write(ctx, tx, userID, "pallet.locate", "pallets", strconv.FormatInt(palletID, 10),
+				locationAudit(pallet.ProjectID, before),
+				locationAudit(pallet.ProjectID, map[string]any{"site_id": siteID, "cell": CellLabel(row, col)}))
+		}
+		return nil
+	})
+}
+
+// Remove takes a pallet off a site's map, for when it leaves the floor.
+func Remove(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, siteID, palletID int64) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		before, err := currentCell(ctx, tx, palletID)
+		if err != nil {
+			return err
+		}
+		if before == nil || before["site_id"] != siteID {
+			return ErrPalletNotPlaced
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM pallet_locations WHERE pallet_id = ?`, palletID); err != nil {
+			return err
+		}
+		if auditSvc != nil && userID > 0 {
+			var projectID int64
+			if err := tx.NewRaw(`SELECT project_id FROM pallets WHERE id = ?`, palletID).Scan(ctx, &projectID); err != nil {
+				return err
+			}
+			return auditSvc.Write(ctx, tx, userID, "pallet.unlocate", "pallets", strconv.FormatInt(palletID, 10),
+				locationAudit(projectID, before), locationAudit(projectID, nil))
+		}
+		return nil
+	})
+}
+
+func currentCell(ctx context.Context, tx bun.Tx, palletID int64) (map[string]any, error) {
+	var loc struct {
+		SiteID int64 `bun:"site_id"`
+		Row    int   `bun:"row_no"`
+		Col    int   `bun:"col_no"`
+	}
+	if err := tx.NewRaw(`SELECT site_id, row_no, col_no FROM pallet_locations WHERE pallet_id = ?`, palletID).Scan(ctx, &loc); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return map[string]any{"site_id": loc.SiteID, "cell": CellLabel(loc.Row, loc.Col)}, nil
+}
+
+// locationAudit records a pallet's cell, or none, with its project so the
+// entry is attributed to the project like other pallet changes.
+func locationAudit(projectID int64, location map[string]any) map[string]any {
+	return map[string]any{"project_id": projectID, "location": location}
+}
+
+// CellSummary counts the pallets stored in one cell by status.
+type CellSummary struct {
+	Row    int
+	Col    int
+	Counts map[string]int
+	Total  int
+}
+
+// Status is the status the cell is coloured by, "" for an empty cell.
+func (c CellSummary) Status() string {
+	for _, status := range Statuses {
+		if c.Counts[status] > 0 {
+			return status
+		}
+	}
+	return ""
+}
+
+// Cell identifies a cell of a map.
+type Cell struct {
+	Row int
+	Col int
+}
+
+// Summaries counts the pallets in each occupied cell of a site's map.
+func Summaries(ctx context.Context, db *sqlite.DB, siteID int64) (map[Cell]CellSummary, error) {
+	var rows []struct {
+		Row    int    `bun:"row_no"`
+		Col    int    `bun:"col_no"`
+		Status string `bun:"status"`
+		Count  int    `bun:"count"`
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT pl.row_no, pl.col_no, p.status, COUNT(1) AS count
+FROM pallet_locations pl
+JOIN pallets p ON p.id = pl.pallet_id
+WHERE pl.site_id = ?
+GROUP BY pl.row_no, pl.col_no, p.status`, siteID).Scan(ctx, &rows)
+	})
+	if err != nil {
+		return nil, err
+	}
+	cells := make(map[Cell]CellSummary)
+	for _, r := range rows {
+		key := Cell{Row: r.Row, Col: r.Col}
+		summary, ok := cells[key]
+		if !ok {
+			summary = CellSummary{Row: r.Row, Col: r.Col, Counts: make(map[string]int)}
+		}
+		summary.Counts[r.Status] += r.Count
+		summary.Total += r.Count
+		cells[key] = summary
+	}
+	return cells, nil
+}
+
+// StoredPallet is a pallet stored in a cell.
+type StoredPallet struct {
+	PalletID    int64     `bun:"pallet_id"`
+	Status      string    `bun:"status"`
+	ProjectID   int64     `bun:"project_id"`
+	ProjectCode string    `bun:"project_code"`
+	ProjectName string    `bun:"project_name"`
+	LineCount   int64     `bun:"line_count"`
+	UnitCount   int64     `bun:"unit_count"`
+	PlacedBy    string    `bun:"placed_by"`
+	PlacedAt    time.Time `bun:"placed_at"`
+}
+
+// CellPallets lists the pallets stored in a cell, most recently placed first.
+func CellPallets(ctx context.Context, db *sqlite.DB, siteID int64, row, col int) ([]StoredPallet, error) {
+	pallets := make([]StoredPallet, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT pl.pallet_id, p.status, p.project_id, pr.code AS project_code, pr.name AS project_name,
+       (SELECT COUNT(1) FROM pallet_receipts r WHERE r.pallet_id = p.id) AS line_count,
+       (SELECT COALESCE(SUM(r.qty), 0) FROM pallet_receipts r WHERE r.pallet_id = p.id) AS unit_count,
+       COALESCE(u.username, '') AS placed_by, pl.placed_at
+FROM pallet_locations pl
+JOIN pallets p ON p.id = pl.pallet_id
+JOIN projects pr ON pr.id = p.project_id
+LEFT JOIN users u ON u.id = pl.placed_by_user_id
+WHERE pl.site_id = ? AND pl.row_no = ? AND pl.col_no = ?
+ORDER BY pl.placed_at DESC, pl.pallet_id DESC`, siteID, row, col).Scan(ctx, &pallets)
+	})
+	return pallets, err
+}
+
+func nullableUserID(userID int64) any {
+	if userID <= 0 {
+		return nil
+	}
+	return userID
+}
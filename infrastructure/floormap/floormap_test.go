@@ -0,0 +1,206 @@
+package floormap
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func openFloorMapTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "floormap-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	return db
+}
+
+func execAll(t *testing.T, db *sqlite.DB, stmts ...string) {
+	t.Helper()
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+}
+
+func seedFloorMapSites(t *testing.T, db *sqlite.DB) {
+	t.Helper()
+	execAll(t, db,
+		`INSERT INTO sites (id, code, name) VALUES (1, 'leeds', 'Leeds'), (2, 'york', 'York')`,
+		`INSERT INTO projects (id, name, description, project_date, client_name, code, status, site_id) VALUES
+			(601, 'Leeds Inbound', 'L', DATE('now'), 'Client', 'leeds-inbound', 'active', 1),
+			(602, 'York Inbound', 'Y', DATE('now'), 'Client', 'york-inbound', 'active', 2)`,
+		`INSERT INTO pallets (id, project_id, status) VALUES
+			(9601, 601, 'open'), (9602, 601, 'labelled'), (9603, 602, 'open'), (9604, 601, 'cancelled')`,
+	)
+}
+
+func TestCellLabels(t *testing.T) {
+	cases := []struct {
+		row, col int
+		label    string
+	}{
+		{1, 1, "A1"},
+		{12, 3, "C12"},
+		{7, 26, "Z7"},
+		{2, 27, "AA2"},
+		{99, 52, "AZ99"},
+	}
+	for _, tc := range cases {
+		if got := CellLabel(tc.row, tc.col); got != tc.label {
+			t.Fatalf("CellLabel(%d, %d) = %q, want %q", tc.row, tc.col, got, tc.label)
+		}
+		row, col, err := ParseCell(tc.label)
+		if err != nil || row != tc.row || col != tc.col {
+			t.Fatalf("ParseCell(%q) = %d, %d, %v", tc.label, row, col, err)
+		}
+	}
+	if row, col, err := ParseCell(" c012 "); err != nil || row != 12 || col != 3 {
+		t.Fatalf("expected lower case with leading zeros to parse, got %d, %d, %v", row, col, err)
+	}
+	for _, raw := range []string{"", "12", "C", "C0", "ABC1", "C-12"} {
+		if _, _, err := ParseCell(raw); !errors.Is(err, ErrInvalidCell) {
+			t.Fatalf("expected ParseCell(%q) to fail, got %v", raw, err)
+		}
+	}
+}
+
+func TestPlaceMovesPalletsAndSummarisesCells(t *testing.T) {
+	db := openFloorMapTestDB(t)
+	seedFloorMapSites(t, db)
+	ctx := context.Background()
+
+	if err := Place(ctx, db, nil, 0, 1, 9601, 1, 1); !errors.Is(err, ErrNotConfigured) {
+		t.Fatalf("expected not configured, got %v", err)
+	}
+	if err := Configure(ctx, db, nil, 0, 1, 4, 5); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+	if err := Place(ctx, db, nil, 0, 1, 9601, 5, 1); !errors.Is(err, ErrCellOutside) {
+		t.Fatalf("expected cell outside, got %v", err)
+	}
+	if err := Place(ctx, db, nil, 0, 1, 9603, 1, 1); !errors.Is(err, ErrPalletOtherSite) {
+		t.Fatalf("expected other site, got %v", err)
+	}
+	if err := Place(ctx, db, nil, 0, 1, 9604, 1, 1); !errors.Is(err, ErrPalletCancelled) {
+		t.Fatalf("expected cancelled refusal, got %v", err)
+	}
+	if err := Place(ctx, db, nil, 0, 1, 9999, 1, 1); !errors.Is(err, ErrPalletNotFound) {
+		t.Fatalf("expected pallet not found, got %v", err)
+	}
+
+	for _, palletID := range []int64{9601, 9602} {
+		if err := Place(ctx, db, nil, 0, 1, palletID, 2, 3); err != nil {
+			t.Fatalf("place %d: %v", palletID, err)
+		}
+	}
+	cells, err := Summaries(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("summaries: %v", err)
+	}
+	c := cells[Cell{Row: 2, Col: 3}]
+	if c.Total != 2 || c.Status() != "open" {
+		t.Fatalf("expected C2 with two pallets shown as open, got %+v", c)
+	}
+
+	if err := Place(ctx, db, nil, 0, 1, 9601, 4, 5); err != nil {
+		t.Fatalf("move: %v", err)
+	}
+	cells, err = Summaries(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("summaries after move: %v", err)
+	}
+	if c := cells[Cell{Row: 2, Col: 3}]; c.Total != 1 || c.Status() != "labelled" {
+		t.Fatalf("expected C2 left with the labelled pallet, got %+v", c)
+	}
+	pallets, err := CellPallets(ctx, db, 1, 4, 5)
+	if err != nil {
+		t.Fatalf("cell pallets: %v", err)
+	}
+	if len(pallets) != 1 || pallets[0].PalletID != 9601 || pallets[0].ProjectCode != "leeds-inbound" {
+		t.Fatalf("expected pallet 9601 in E4, got %+v", pallets)
+	}
+
+	if err := Configure(ctx, db, nil, 0, 1, 3, 5); !errors.Is(err, ErrCellsOccupied) {
+		t.Fatalf("expected shrink past a stored pallet to fail, got %v", err)
+	}
+	if err := Remove(ctx, db, nil, 0, 2, 9601); !errors.Is(err, ErrPalletNotPlaced) {
+		t.Fatalf("expected removal from another site's map to fail, got %v", err)
+	}
+	if err := Remove(ctx, db, nil, 0, 1, 9601); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := Configure(ctx, db, nil, 0, 1, 3, 5); err != nil {
+		t.Fatalf("expected shrink once the row is empty, got %v", err)
+	}
+}
+
+func TestZonesStayInsideTheMap(t *testing.T) {
+	db := openFloorMapTestDB(t)
+	seedFloorMapSites(t, db)
+	ctx := context.Background()
+	if err := Configure(ctx, db, nil, 0, 1, 10, 10); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+
+	z, err := AddZone(ctx, db, nil, 0, 1, "bulk 1", "Bulk storage", "D6", "B2")
+	if err != nil {
+		t.Fatalf("add zone: %v", err)
+	}
+	if z.Code != "BULK1" || z.Range() != "B2:D6" {
+		t.Fatalf("expected BULK1 over B2:D6, got %s over %s", z.Code, z.Range())
+	}
+	if _, err := AddZone(ctx, db, nil, 0, 1, "BULK1", "Again", "A1", "A1"); !errors.Is(err, ErrZoneCodeExists) {
+		t.Fatalf("expected duplicate code error, got %v", err)
+	}
+	if _, err := AddZone(ctx, db, nil, 0, 1, "Q", "Quarantine", "J10", "K10"); !errors.Is(err, ErrCellOutside) {
+		t.Fatalf("expected zone outside the map to fail, got %v", err)
+	}
+
+	m, err := Load(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if zone, ok := m.ZoneAt(4, 3); !ok || zone.Code != "BULK1" {
+		t.Fatalf("expected C4 in BULK1, got %+v %v", zone, ok)
+	}
+	if _, ok := m.ZoneAt(7, 3); ok {
+		t.Fatalf("expected C7 outside every zone")
+	}
+	if err := Configure(ctx, db, nil, 0, 1, 5, 10); !errors.Is(err, ErrZonesOutside) {
+		t.Fatalf("expected shrink past a zone to fail, got %v", err)
+	}
+	if err := DeleteZone(ctx, db, nil, 0, 2, z.ID); !errors.Is(err, ErrZoneNotFound) {
+		t.Fatalf("expected another site's zone to be unknown, got %v", err)
+	}
+	if err := DeleteZone(ctx, db, nil, 0, 1, z.ID); err != nil {
+		t.Fatalf("delete zone: %v", err)
+	}
+	if err := Configure(ctx, db, nil, 0, 1, 5, 10); err != nil {
+		t.Fatalf("expected shrink once the zone is gone, got %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+// Package formtoken guards forms against being submitted twice. A form is
+// rendered with a fresh random token; the first submission records it in the
+// same transaction as the change it makes, and any later submission carrying
+// the same token is refused with ErrUsed.
+package formtoken
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/uptrace/bun"
+)
+
+// FieldName is the hidden form input that carries the token.
+const FieldName = "form_token"
+
+// retention is how long used tokens are remembered, as a SQLite datetime
+// modifier. A form left open longer than this can be submitted once more.
+const retention = "-1 day"
+
+var (
+	ErrUsed    = errors.New("this form was already submitted")
+	ErrInvalid = errors.New("invalid form token")
+)
+
+// New returns a token for one rendering of a form.
+func New() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Use records token as submitted inside tx. It returns ErrUsed when the
+// token was already recorded, so the caller's transaction should roll back.
+func Use(ctx context.Context, tx bun.Tx, token string) error {
+	token = strings.TrimSpace(token)
+	if len(token) != 32 {
+		return ErrInvalid
+	}
+	if _, err := hex.DecodeString(token); err != nil {
+		return ErrInvalid
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM form_tokens WHERE used_at < datetime('now', ?)`, retention); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `INSERT INTO form_tokens (token) VALUES (?) ON CONFLICT(token) DO NOTHING`, token)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrUsed
+	}
+	return nil
+}
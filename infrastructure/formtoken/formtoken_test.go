@@ -0,0 +1,77 @@
+package formtoken
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func openFormTokenTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	db, err := sqlite.OpenDB(filepath.Join(t.TempDir(), "formtoken-test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	if err := sqlite.ApplyMigrations(context.Background(), db, filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	return db
+}
+
+func TestUse_SecondUseRejectedAndRollbackForgetsToken(t *testing.T) {
+	db := openFormTokenTestDB(t)
+	ctx := context.Background()
+	use := func(token string) error {
+		return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+			return Use(ctx, tx, token)
+		})
+	}
+
+	if err := use("not-a-token"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected malformed token rejected, got %v", err)
+	}
+
+	rolledBack := New()
+	boom := errors.New("save failed")
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := Use(ctx, tx, rolledBack); err != nil {
+			return err
+		}
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected save failure, got %v", err)
+	}
+	if err := use(rolledBack); err != nil {
+		t.Fatalf("expected token from a failed save to stay usable, got %v", err)
+	}
+	if err := use(rolledBack); !errors.Is(err, ErrUsed) {
+		t.Fatalf("expected second use rejected, got %v", err)
+	}
+
+	if _, err := db.W.ExecContext(ctx, `UPDATE form_tokens SET used_at = datetime('now', '-2 days')`); err != nil {
+		t.Fatalf("age token: %v", err)
+	}
+	if err := use(New()); err != nil {
+		t.Fatalf("use fresh token: %v", err)
+	}
+	var remaining int
+	if err := db.R.QueryRowContext(ctx, `SELECT COUNT(1) FROM form_tokens`).Scan(&remaining); err != nil {
+		t.Fatalf("count tokens: %v", err)
+	}
+	if remaining != 1 {
+		t.Fatalf("expected expired tokens purged, got %d", remaining)
+	}
+}
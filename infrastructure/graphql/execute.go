@@ -0,0 +1,438 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	defaultMaxDepth = 8
+	defaultMaxCost  = 10000
+	defaultListSize = 100
+)
+
+// ResolveFunc returns the value for a field. Object fields return a
+// map[string]any (or a slice of them for list fields); scalar fields return
+// JSON-encodable values.
+type ResolveFunc func(ctx context.Context, source any, args Args) (any, error)
+
+// Object is an output type with named fields.
+type Object struct {
+	Name   string
+	Fields map[string]*Field
+}
+
+// Field describes one field of an object type.
+type Field struct {
+	// Type is set for object-valued fields and nil for scalars.
+	Type *Object
+	List bool
+	// Cost is the static cost of resolving the field once; zero means 1.
+	Cost int
+	// Visible hides the field (resolving it as null) when it returns false,
+	// used for role-based masking.
+	Visible func(ctx context.Context) bool
+	// Resolve defaults to reading the field name from a map[string]any source.
+	Resolve ResolveFunc
+}
+
+// Schema is the root query type plus execution limits.
+type Schema struct {
+	Query *Object
+	// MaxDepth limits selection nesting; zero uses the default.
+	MaxDepth int
+	// MaxCost limits the estimated query cost; zero uses the default.
+	MaxCost int
+	// ListSize is the assumed page size for list fields without a "first"
+	// argument when estimating cost; zero uses the default.
+	ListSize int
+}
+
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+type Error struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+type Response struct {
+	Data   *OrderedMap `json:"data,omitempty"`
+	Errors []Error     `json:"errors,omitempty"`
+	Cost   int         `json:"-"`
+}
+
+// OrderedMap keeps response keys in selection order, as the spec requires.
+type OrderedMap struct {
+	keys   []string
+	values map[string]any
+}
+
+func newOrderedMap() *OrderedMap {
+	return &OrderedMap{values: make(map[string]any)}
+}
+
+func (m *OrderedMap) Set(key string, value any) {
+	if _, exists := m.values[key]; !exists {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+func (m *OrderedMap) Get(key string) (any, bool) {
+	v, ok := m.values[key]
+	return v, ok
+}
+
+func (m *OrderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Args holds coerced argument values for a field.
+type Args map[string]any
+
+func (a Args) Int(name string, def int64) (int64, error) {
+	v, ok := a[name]
+	if !ok || v == nil {
+		return def, nil
+	}
+	switch n := v.(type) {
+	case int64:
+		return n, nil
+	case float64:
+		if n != float64(int64(n)) {
+			return 0, fmt.Errorf("argument %q must be an integer", name)
+		}
+		return int64(n), nil
+	case json.Number:
+		i, err := n.Int64()
+		if err != nil {
+			return 0, fmt.Errorf("argument %q must be an integer", name)
+		}
+		return i, nil
+	}
+	return 0, fmt.Errorf("argument %q must be an integer", name)
+}
+
+func (a Args) String(name string) (string, error) {
+	v, ok := a[name]
+	if !ok || v == nil {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("argument %q must be a string", name)
+	}
+	return strings.TrimSpace(s), nil
+}
+
+func (a Args) Bool(name string) (*bool, error) {
+	v, ok := a[name]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("argument %q must be a boolean", name)
+	}
+	return &b, nil
+}
+
+func (a Args) Has(name string) bool {
+	v, ok := a[name]
+	return ok && v != nil
+}
+
+// Execute parses, validates, costs and runs a query against the schema.
+func (s *Schema) Execute(ctx context.Context, req Request) Response {
+	doc, err := Parse(req.Query)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+	op, err := selectOperation(doc, req.OperationName)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+	ex := &executor{schema: s, vars: operationVariables(op, req.Variables)}
+	cost, err := ex.validate(op.Selections, s.Query, 1)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+	if cost > s.maxCost() {
+		return Response{Cost: cost, Errors: []Error{{Message: fmt.Sprintf("query cost %d exceeds the limit of %d; request fewer fields or smaller pages", cost, s.maxCost())}}}
+	}
+
+	data := ex.executeSelections(ctx, op.Selections, s.Query, nil, nil)
+	return Response{Data: data, Errors: ex.errors, Cost: cost}
+}
+
+func selectOperation(doc *Document, name string) (*Operation, error) {
+	if name == "" {
+		if len(doc.Operations) != 1 {
+			return nil, fmt.Errorf("operationName is required when the document contains multiple operations")
+		}
+		return doc.Operations[0], nil
+	}
+	for _, op := range doc.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("operation %q not found", name)
+}
+
+func operationVariables(op *Operation, provided map[string]any) map[string]any {
+	vars := make(map[string]any, len(op.Variables))
+	for _, def := range op.Variables {
+		if v, ok := provided[def.Name]; ok {
+			vars[def.Name] = v
+			continue
+		}
+		if def.HasDefault {
+			vars[def.Name] = def.Default
+		}
+	}
+	return vars
+}
+
+type executor struct {
+	schema *Schema
+	vars   map[string]any
+	errors []Error
+}
+
+func (s *Schema) maxDepth() int {
+	if s.MaxDepth > 0 {
+		return s.MaxDepth
+	}
+	return defaultMaxDepth
+}
+
+func (s *Schema) maxCost() int {
+	if s.MaxCost > 0 {
+		return s.MaxCost
+	}
+	return defaultMaxCost
+}
+
+func (s *Schema) listSize() int {
+	if s.ListSize > 0 {
+		return s.ListSize
+	}
+	return defaultListSize
+}
+
+// validate checks the selections against the schema and returns the
+// estimated cost: each field costs its static cost, and the children of list
+// fields are multiplied by the requested page size.
+func (ex *executor) validate(selections []*Selection, obj *Object, depth int) (int, error) {
+	if depth > ex.schema.maxDepth() {
+		return 0, fmt.Errorf("query depth exceeds the limit of %d", ex.schema.maxDepth())
+	}
+	total := 0
+	for _, sel := range selections {
+		if sel.Name == "__typename" {
+			continue
+		}
+		field, ok := obj.Fields[sel.Name]
+		if !ok {
+			return 0, fmt.Errorf("cannot query field %q on type %q", sel.Name, obj.Name)
+		}
+		if _, err := ex.includeSelection(sel); err != nil {
+			return 0, err
+		}
+		args, err := ex.coerceArgs(sel.Arguments)
+		if err != nil {
+			return 0, fmt.Errorf("field %q: %w", sel.ResponseKey(), err)
+		}
+		cost := field.Cost
+		if cost <= 0 {
+			cost = 1
+		}
+		total += cost
+		if field.Type == nil {
+			if len(sel.Selections) > 0 {
+				return 0, fmt.Errorf("field %q is a scalar and cannot have a selection set", sel.Name)
+			}
+			continue
+		}
+		if len(sel.Selections) == 0 {
+			return 0, fmt.Errorf("field %q of type %q must have a selection set", sel.Name, field.Type.Name)
+		}
+		childCost, err := ex.validate(sel.Selections, field.Type, depth+1)
+		if err != nil {
+			return 0, err
+		}
+		multiplier := 1
+		if field.List {
+			multiplier = ex.schema.listSize()
+			if first, err := args.Int("first", 0); err == nil && first > 0 {
+				multiplier = int(first)
+			}
+		}
+		total += childCost * multiplier
+	}
+	return total, nil
+}
+
+func (ex *executor) includeSelection(sel *Selection) (bool, error) {
+	include := true
+	for _, d := range sel.Directives {
+		args, err := ex.coerceArgs(d.Arguments)
+		if err != nil {
+			return false, err
+		}
+		cond, ok := args["if"].(bool)
+		if !ok {
+			return false, fmt.Errorf("directive @%s requires a boolean \"if\" argument", d.Name)
+		}
+		switch d.Name {
+		case "skip":
+			if cond {
+				include = false
+			}
+		case "include":
+			if !cond {
+				include = false
+			}
+		default:
+			return false, fmt.Errorf("directive @%s is not supported", d.Name)
+		}
+	}
+	return include, nil
+}
+
+func (ex *executor) coerceArgs(raw map[string]any) (Args, error) {
+	args := make(Args, len(raw))
+	for name, value := range raw {
+		v, err := ex.resolveValue(value)
+		if err != nil {
+			return nil, err
+		}
+		args[name] = v
+	}
+	return args, nil
+}
+
+func (ex *executor) resolveValue(value any) (any, error) {
+	switch v := value.(type) {
+	case Variable:
+		resolved, ok := ex.vars[v.Name]
+		if !ok {
+			return nil, nil
+		}
+		return resolved, nil
+	case []any:
+		out := make([]any, 0, len(v))
+		for _, item := range v {
+			r, err := ex.resolveValue(item)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, r)
+		}
+		return out, nil
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			r, err := ex.resolveValue(item)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = r
+		}
+		return out, nil
+	}
+	return value, nil
+}
+
+func (ex *executor) executeSelections(ctx context.Context, selections []*Selection, obj *Object, source any, path []any) *OrderedMap {
+	out := newOrderedMap()
+	for _, sel := range selections {
+		include, _ := ex.includeSelection(sel)
+		if !include {
+			continue
+		}
+		key := sel.ResponseKey()
+		if sel.Name == "__typename" {
+			out.Set(key, obj.Name)
+			continue
+		}
+		field := obj.Fields[sel.Name]
+		fieldPath := appendPath(path, key)
+		if field.Visible != nil && !field.Visible(ctx) {
+			out.Set(key, nil)
+			continue
+		}
+		args, _ := ex.coerceArgs(sel.Arguments)
+		value, err := ex.resolve(ctx, field, sel.Name, source, args)
+		if err != nil {
+			ex.errors = append(ex.errors, Error{Message: err.Error(), Path: fieldPath})
+			out.Set(key, nil)
+			continue
+		}
+		out.Set(key, ex.completeValue(ctx, field, sel, value, fieldPath))
+	}
+	return out
+}
+
+func (ex *executor) resolve(ctx context.Context, field *Field, name string, source any, args Args) (any, error) {
+	if field.Resolve != nil {
+		return field.Resolve(ctx, source, args)
+	}
+	if m, ok := source.(map[string]any); ok {
+		return m[name], nil
+	}
+	return nil, nil
+}
+
+func (ex *executor) completeValue(ctx context.Context, field *Field, sel *Selection, value any, path []any) any {
+	if value == nil || field.Type == nil {
+		return value
+	}
+	if !field.List {
+		return ex.executeSelections(ctx, sel.Selections, field.Type, value, path)
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice {
+		ex.errors = append(ex.errors, Error{Message: fmt.Sprintf("field %q expected a list", sel.Name), Path: path})
+		return nil
+	}
+	items := make([]any, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		items = append(items, ex.executeSelections(ctx, sel.Selections, field.Type, rv.Index(i).Interface(), appendPath(path, i)))
+	}
+	return items
+}
+
+func appendPath(path []any, elem any) []any {
+	out := make([]any, len(path), len(path)+1)
+	copy(out, path)
+	return append(out, elem)
+}
@@ -0,0 +1,116 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type roleKey struct{}
+
+func testSchema() *Schema {
+	item := &Object{Name: "Item", Fields: map[string]*Field{
+		"id":     {},
+		"name":   {},
+		"secret": {Visible: func(ctx context.Context) bool { return ctx.Value(roleKey{}) == "admin" }},
+	}}
+	item.Fields["children"] = &Field{Type: item, List: true, Resolve: func(ctx context.Context, source any, args Args) (any, error) {
+		return []map[string]any{{"id": int64(99), "name": "child", "secret": "s"}}, nil
+	}}
+	query := &Object{Name: "Query", Fields: map[string]*Field{
+		"items": {Type: item, List: true, Resolve: func(ctx context.Context, source any, args Args) (any, error) {
+			first, err := args.Int("first", 2)
+			if err != nil {
+				return nil, err
+			}
+			items := make([]map[string]any, 0)
+			for i := int64(1); i <= first; i++ {
+				items = append(items, map[string]any{"id": i, "name": "item", "secret": "s"})
+			}
+			return items, nil
+		}},
+		"broken": {Resolve: func(ctx context.Context, source any, args Args) (any, error) {
+			return nil, errors.New("boom")
+		}},
+	}}
+	return &Schema{Query: query, MaxDepth: 3, MaxCost: 50, ListSize: 10}
+}
+
+func mustJSON(t *testing.T, resp Response) string {
+	t.Helper()
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("marshal response: %v", err)
+	}
+	return string(raw)
+}
+
+func TestParseRejectsUnsupportedOperations(t *testing.T) {
+	for _, src := range []string{
+		`mutation { items { id } }`,
+		`subscription { items { id } }`,
+		`{ items { ...F } } fragment F on Item { id }`,
+		`{ items { id }`,
+	} {
+		if _, err := Parse(src); err == nil {
+			t.Fatalf("expected parse error for %q", src)
+		}
+	}
+}
+
+func TestExecuteAliasesVariablesAndOrder(t *testing.T) {
+	resp := testSchema().Execute(context.Background(), Request{
+		Query:     `query Q($n: Int = 1) { first: items(first: $n) { name id __typename } }`,
+		Variables: map[string]any{"n": json.Number("2")},
+	})
+	got := mustJSON(t, resp)
+	want := `{"data":{"first":[{"name":"item","id":1,"__typename":"Item"},{"name":"item","id":2,"__typename":"Item"}]}}`
+	if got != want {
+		t.Fatalf("unexpected response\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestExecuteSkipAndInclude(t *testing.T) {
+	resp := testSchema().Execute(context.Background(), Request{
+		Query: `{ items(first: 1) { id @skip(if: true) name @include(if: true) } }`,
+	})
+	if got := mustJSON(t, resp); got != `{"data":{"items":[{"name":"item"}]}}` {
+		t.Fatalf("unexpected response: %s", got)
+	}
+}
+
+func TestExecuteValidationErrors(t *testing.T) {
+	cases := map[string]string{
+		`{ nope }`:               `cannot query field "nope"`,
+		`{ items }`:              `must have a selection set`,
+		`{ items { id { x } } }`: `is a scalar`,
+		`{ items { children { children { children { id } } } } }`: `depth exceeds`,
+		`{ items(first: 30) { id name } }`:                        `query cost`,
+	}
+	for query, wantErr := range cases {
+		resp := testSchema().Execute(context.Background(), Request{Query: query})
+		if resp.Data != nil || len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, wantErr) {
+			t.Fatalf("query %q: expected error containing %q, got %s", query, wantErr, mustJSON(t, resp))
+		}
+	}
+}
+
+func TestExecuteMasksInvisibleFields(t *testing.T) {
+	query := Request{Query: `{ items(first: 1) { id secret } }`}
+	if got := mustJSON(t, testSchema().Execute(context.Background(), query)); got != `{"data":{"items":[{"id":1,"secret":null}]}}` {
+		t.Fatalf("expected secret masked, got %s", got)
+	}
+	adminCtx := context.WithValue(context.Background(), roleKey{}, "admin")
+	if got := mustJSON(t, testSchema().Execute(adminCtx, query)); got != `{"data":{"items":[{"id":1,"secret":"s"}]}}` {
+		t.Fatalf("expected secret visible to admin, got %s", got)
+	}
+}
+
+func TestExecuteResolverErrorsIncludePath(t *testing.T) {
+	resp := testSchema().Execute(context.Background(), Request{Query: `{ b: broken items(first: 1) { id } }`})
+	if got := mustJSON(t, resp); got != `{"data":{"b":null,"items":[{"id":1}]},"errors":[{"message":"boom","path":["b"]}]}` {
+		t.Fatalf("unexpected response: %s", got)
+	}
+}
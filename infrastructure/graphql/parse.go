@@ -0,0 +1,584 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// This package implements the read-only subset of GraphQL the reporting API
+// needs: query operations, aliases, arguments, variables and @skip/@include.
+// Fragments, mutations and subscriptions are rejected with a clear error.
+
+type Document struct {
+	Operations []*Operation
+}
+
+type Operation struct {
+	Type       string
+	Name       string
+	Variables  []VariableDefinition
+	Selections []*Selection
+}
+
+type VariableDefinition struct {
+	Name       string
+	Default    any
+	HasDefault bool
+}
+
+type Selection struct {
+	Alias      string
+	Name       string
+	Arguments  map[string]any
+	Directives []Directive
+	Selections []*Selection
+}
+
+type Directive struct {
+	Name      string
+	Arguments map[string]any
+}
+
+// Variable is a reference to an operation variable inside an argument value.
+type Variable struct {
+	Name string
+}
+
+// ResponseKey returns the alias when present, otherwise the field name.
+func (s *Selection) ResponseKey() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	return s.Name
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+type parser struct {
+	src    string
+	pos    int
+	tok    token
+	lexErr error
+}
+
+// Parse parses a query document.
+func Parse(src string) (*Document, error) {
+	p := &parser{src: src}
+	p.next()
+	doc := &Document{}
+	for p.tok.kind != tokenEOF {
+		if p.lexErr != nil {
+			return nil, p.lexErr
+		}
+		op, err := p.parseDefinition()
+		if err != nil {
+			return nil, err
+		}
+		doc.Operations = append(doc.Operations, op)
+	}
+	if p.lexErr != nil {
+		return nil, p.lexErr
+	}
+	if len(doc.Operations) == 0 {
+		return nil, fmt.Errorf("document contains no operations")
+	}
+	return doc, nil
+}
+
+func (p *parser) parseDefinition() (*Operation, error) {
+	op := &Operation{Type: "query"}
+	if p.isPunct("{") {
+		selections, err := p.parseSelectionSet()
+		if err != nil {
+			return nil, err
+		}
+		op.Selections = selections
+		return op, nil
+	}
+	if p.tok.kind != tokenName {
+		return nil, p.errorf("expected operation definition")
+	}
+	switch p.tok.value {
+	case "query":
+	case "mutation", "subscription":
+		return nil, p.errorf("%s operations are not supported; this endpoint is read-only", p.tok.value)
+	case "fragment":
+		return nil, p.errorf("fragments are not supported")
+	default:
+		return nil, p.errorf("unexpected %q", p.tok.value)
+	}
+	p.next()
+	if p.tok.kind == tokenName {
+		op.Name = p.tok.value
+		p.next()
+	}
+	if p.isPunct("(") {
+		defs, err := p.parseVariableDefinitions()
+		if err != nil {
+			return nil, err
+		}
+		op.Variables = defs
+	}
+	if p.isPunct("@") {
+		return nil, p.errorf("operation directives are not supported")
+	}
+	selections, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.Selections = selections
+	return op, nil
+}
+
+func (p *parser) parseVariableDefinitions() ([]VariableDefinition, error) {
+	if err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	defs := make([]VariableDefinition, 0)
+	for !p.isPunct(")") {
+		if err := p.expectPunct("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(":"); err != nil {
+			return nil, err
+		}
+		if err := p.skipType(); err != nil {
+			return nil, err
+		}
+		def := VariableDefinition{Name: name}
+		if p.isPunct("=") {
+			p.next()
+			value, err := p.parseValue(true)
+			if err != nil {
+				return nil, err
+			}
+			def.Default = value
+			def.HasDefault = true
+		}
+		defs = append(defs, def)
+	}
+	p.next()
+	return defs, nil
+}
+
+// skipType consumes a type reference; variable types are not enforced beyond
+// the argument coercion done by resolvers.
+func (p *parser) skipType() error {
+	if p.isPunct("[") {
+		p.next()
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if err := p.expectPunct("]"); err != nil {
+			return err
+		}
+	} else if _, err := p.expectName(); err != nil {
+		return err
+	}
+	if p.isPunct("!") {
+		p.next()
+	}
+	return nil
+}
+
+func (p *parser) parseSelectionSet() ([]*Selection, error) {
+	if err := p.expectPunct("{"); err != nil {
+		return nil, err
+	}
+	selections := make([]*Selection, 0)
+	for !p.isPunct("}") {
+		if p.tok.kind == tokenEOF {
+			return nil, p.errorf("unterminated selection set")
+		}
+		if p.isPunct("...") {
+			return nil, p.errorf("fragments are not supported")
+		}
+		sel, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, sel)
+	}
+	p.next()
+	if len(selections) == 0 {
+		return nil, p.errorf("selection set must not be empty")
+	}
+	return selections, nil
+}
+
+func (p *parser) parseField() (*Selection, error) {
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	sel := &Selection{Name: name}
+	if p.isPunct(":") {
+		p.next()
+		sel.Alias = name
+		if sel.Name, err = p.expectName(); err != nil {
+			return nil, err
+		}
+	}
+	if p.isPunct("(") {
+		if sel.Arguments, err = p.parseArguments(); err != nil {
+			return nil, err
+		}
+	}
+	for p.isPunct("@") {
+		p.next()
+		directive := Directive{}
+		if directive.Name, err = p.expectName(); err != nil {
+			return nil, err
+		}
+		if p.isPunct("(") {
+			if directive.Arguments, err = p.parseArguments(); err != nil {
+				return nil, err
+			}
+		}
+		sel.Directives = append(sel.Directives, directive)
+	}
+	if p.isPunct("{") {
+		if sel.Selections, err = p.parseSelectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return sel, nil
+}
+
+func (p *parser) parseArguments() (map[string]any, error) {
+	if err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	args := make(map[string]any)
+	for !p.isPunct(")") {
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseValue(false)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := args[name]; exists {
+			return nil, p.errorf("duplicate argument %q", name)
+		}
+		args[name] = value
+	}
+	p.next()
+	return args, nil
+}
+
+func (p *parser) parseValue(constant bool) (any, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokenPunct:
+		switch tok.value {
+		case "$":
+			if constant {
+				return nil, p.errorf("variables are not allowed here")
+			}
+			p.next()
+			name, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			return Variable{Name: name}, nil
+		case "[":
+			p.next()
+			list := make([]any, 0)
+			for !p.isPunct("]") {
+				if p.tok.kind == tokenEOF {
+					return nil, p.errorf("unterminated list")
+				}
+				v, err := p.parseValue(constant)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			p.next()
+			return list, nil
+		case "{":
+			p.next()
+			obj := make(map[string]any)
+			for !p.isPunct("}") {
+				name, err := p.expectName()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expectPunct(":"); err != nil {
+					return nil, err
+				}
+				v, err := p.parseValue(constant)
+				if err != nil {
+					return nil, err
+				}
+				obj[name] = v
+			}
+			p.next()
+			return obj, nil
+		}
+	case tokenInt:
+		p.next()
+		v, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %q", tok.value)
+		}
+		return v, nil
+	case tokenFloat:
+		p.next()
+		v, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float %q", tok.value)
+		}
+		return v, nil
+	case tokenString:
+		p.next()
+		return tok.value, nil
+	case tokenName:
+		p.next()
+		switch tok.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		default:
+			// Enum values are passed to resolvers as plain strings.
+			return tok.value, nil
+		}
+	}
+	return nil, p.errorf("unexpected %q", tok.value)
+}
+
+func (p *parser) isPunct(v string) bool {
+	return p.tok.kind == tokenPunct && p.tok.value == v
+}
+
+func (p *parser) expectPunct(v string) error {
+	if !p.isPunct(v) {
+		return p.errorf("expected %q", v)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) expectName() (string, error) {
+	if p.tok.kind != tokenName {
+		return "", p.errorf("expected name")
+	}
+	name := p.tok.value
+	p.next()
+	return name, nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	if p.lexErr != nil {
+		return p.lexErr
+	}
+	found := p.tok.value
+	if p.tok.kind == tokenEOF {
+		found = "end of document"
+	}
+	return fmt.Errorf("syntax error at %s (near %q): %s", p.location(p.tok.pos), found, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) location(pos int) string {
+	line, col := 1, 1
+	for i, r := range p.src {
+		if i >= pos {
+			break
+		}
+		if r == '\n' {
+			line++
+			col = 1
+			continue
+		}
+		col++
+	}
+	return fmt.Sprintf("%d:%d", line, col)
+}
+
+func (p *parser) next() {
+	if p.lexErr != nil {
+		p.tok = token{kind: tokenEOF, pos: p.pos}
+		return
+	}
+	tok, err := p.lex()
+	if err != nil {
+		p.lexErr = err
+		p.tok = token{kind: tokenEOF, pos: p.pos}
+		return
+	}
+	p.tok = tok
+}
+
+func (p *parser) lex() (token, error) {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case strings.HasPrefix(p.src[p.pos:], "\uFEFF"):
+			p.pos += len("\uFEFF")
+		default:
+			return p.lexToken()
+		}
+	}
+	return token{kind: tokenEOF, pos: p.pos}, nil
+}
+
+func (p *parser) lexToken() (token, error) {
+	start := p.pos
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		return token{kind: tokenPunct, value: "...", pos: start}, nil
+	case strings.ContainsRune("!$():=@[]{}|&", rune(c)):
+		p.pos++
+		return token{kind: tokenPunct, value: string(c), pos: start}, nil
+	case c == '_' || isLetter(c):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		return token{kind: tokenName, value: p.src[start:p.pos], pos: start}, nil
+	case c == '-' || isDigit(c):
+		return p.lexNumber()
+	case c == '"':
+		return p.lexString()
+	}
+	r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+	return token{}, fmt.Errorf("syntax error at %s: unexpected character %q", p.location(start), r)
+}
+
+func (p *parser) lexNumber() (token, error) {
+	start := p.pos
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	digits := p.pos
+	for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+		p.pos++
+	}
+	if p.pos == digits {
+		return token{}, fmt.Errorf("syntax error at %s: invalid number", p.location(start))
+	}
+	kind := tokenInt
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		kind = tokenFloat
+		p.pos++
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.pos++
+		}
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		kind = tokenFloat
+		p.pos++
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.pos++
+		}
+	}
+	return token{kind: kind, value: p.src[start:p.pos], pos: start}, nil
+}
+
+func (p *parser) lexString() (token, error) {
+	start := p.pos
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		end := strings.Index(p.src[p.pos+3:], `"""`)
+		if end < 0 {
+			return token{}, fmt.Errorf("syntax error at %s: unterminated block string", p.location(start))
+		}
+		value := p.src[p.pos+3 : p.pos+3+end]
+		p.pos += 3 + end + 3
+		return token{kind: tokenString, value: strings.TrimSpace(value), pos: start}, nil
+	}
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			return token{kind: tokenString, value: b.String(), pos: start}, nil
+		case '\n', '\r':
+			return token{}, fmt.Errorf("syntax error at %s: unterminated string", p.location(start))
+		case '\\':
+			if p.pos+1 >= len(p.src) {
+				return token{}, fmt.Errorf("syntax error at %s: unterminated string", p.location(start))
+			}
+			esc := p.src[p.pos+1]
+			p.pos += 2
+			switch esc {
+			case '"', '\\', '/':
+				b.WriteByte(esc)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if p.pos+4 > len(p.src) {
+					return token{}, fmt.Errorf("syntax error at %s: invalid unicode escape", p.location(start))
+				}
+				code, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+				if err != nil {
+					return token{}, fmt.Errorf("syntax error at %s: invalid unicode escape", p.location(start))
+				}
+				b.WriteRune(rune(code))
+				p.pos += 4
+			default:
+				return token{}, fmt.Errorf("syntax error at %s: invalid escape \\%c", p.location(start), esc)
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return token{}, fmt.Errorf("syntax error at %s: unterminated string", p.location(start))
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,63 @@
+// Package gs1 checks the mod-10 check digit of GS1 item numbers (GTINs) as
+// printed in EAN-8, UPC-A, EAN-13 and ITF-14 barcodes.
+package gs1
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrCheckDigit = errors.New("GS1 check digit is wrong")
+
+// Name returns the barcode family for a GTIN of the value's length, or ""
+// when the value is not all digits or not a GTIN length. Values without a
+// name are not GTINs and carry no check digit.
+func Name(value string) string {
+	value = strings.TrimSpace(value)
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return ""
+		}
+	}
+	switch len(value) {
+	case 8:
+		return "EAN-8"
+	case 12:
+		return "UPC-A"
+	case 13:
+		return "EAN-13"
+	case 14:
+		return "ITF-14"
+	}
+	return ""
+}
+
+// CheckDigit computes the GS1 mod-10 check digit for the digits preceding
+// it: weights alternate 3 and 1 starting from the rightmost digit.
+func CheckDigit(digits string) byte {
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if (len(digits)-1-i)%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// Validate checks the check digit of a GTIN. Values that are not GTINs, such
+// as internal Code 128 references, pass.
+func Validate(value string) error {
+	value = strings.TrimSpace(value)
+	name := Name(value)
+	if name == "" {
+		return nil
+	}
+	want := CheckDigit(value[:len(value)-1])
+	if value[len(value)-1] != want {
+		return fmt.Errorf("%w: %s %s should end in %c", ErrCheckDigit, name, value, want)
+	}
+	return nil
+}
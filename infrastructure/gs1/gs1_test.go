@@ -0,0 +1,42 @@
+package gs1
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		value string
+		ok    bool
+	}{
+		{"96385074", true},
+		{"96385075", false},
+		{"036000291452", true},
+		{"036000291453", false},
+		{"5012345678900", true},
+		{"5012345678901", false},
+		{"15012345678907", true},
+		{"15012345678900", false},
+		{" 5012345678900 ", true},
+		{"ABC-123", true},
+		{"12345", true},
+		{"", true},
+	}
+	for _, tc := range cases {
+		err := Validate(tc.value)
+		if tc.ok && err != nil {
+			t.Fatalf("Validate(%q) = %v, want nil", tc.value, err)
+		}
+		if !tc.ok && !errors.Is(err, ErrCheckDigit) {
+			t.Fatalf("Validate(%q) = %v, want ErrCheckDigit", tc.value, err)
+		}
+	}
+}
+
+func TestValidate_ErrorNamesExpectedDigit(t *testing.T) {
+	err := Validate("5012345678901")
+	if err == nil || err.Error() != "GS1 check digit is wrong: EAN-13 5012345678901 should end in 0" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
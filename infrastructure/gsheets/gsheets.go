@@ -0,0 +1,312 @@
+// Package gsheets writes rows to a Google Sheets tab as a service account.
+// The spreadsheet must be shared with the service account's email address,
+// and the tab must already exist.
+package gsheets
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// EnvCredentialsFile names the service account key file (the JSON
+	// downloaded from the Google Cloud console).
+	EnvCredentialsFile = "GOOGLE_SHEETS_CREDENTIALS_FILE"
+
+	defaultTokenURL = "https://oauth2.googleapis.com/token"
+	defaultBaseURL  = "https://sheets.googleapis.com"
+	scope           = "https://www.googleapis.com/auth/spreadsheets"
+	requestTimeout  = 30 * time.Second
+)
+
+var ErrInvalidCredentials = errors.New("google sheets credentials must be a service account key with client_email and private_key")
+
+// Credentials is the part of a service account key the client needs.
+type Credentials struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// ParseCredentials reads a service account key.
+func ParseCredentials(data []byte) (Credentials, error) {
+	var c Credentials
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, ErrInvalidCredentials
+	}
+	if strings.TrimSpace(c.ClientEmail) == "" || strings.TrimSpace(c.PrivateKey) == "" {
+		return c, ErrInvalidCredentials
+	}
+	if _, err := parsePrivateKey(c.PrivateKey); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// LoadFromEnv returns a client for the key file named by
+// GOOGLE_SHEETS_CREDENTIALS_FILE, or nil when it is not set.
+func LoadFromEnv() (*Client, error) {
+	path := strings.TrimSpace(os.Getenv(EnvCredentialsFile))
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := ParseCredentials(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(creds, nil)
+}
+
+// Client calls the Sheets API. It fetches and caches its own access token.
+type Client struct {
+	creds Credentials
+	key   *rsa.PrivateKey
+	http  *http.Client
+	// BaseURL and TokenURL point at Google; tests replace them.
+	BaseURL  string
+	TokenURL string
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewClient returns a client for creds, using httpClient or one with a
+// short timeout when nil.
+func NewClient(creds Credentials, httpClient *http.Client) (*Client, error) {
+	key, err := parsePrivateKey(creds.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: requestTimeout}
+	}
+	tokenURL := creds.TokenURI
+	if tokenURL == "" {
+		tokenURL = defaultTokenURL
+	}
+	return &Client{creds: creds, key: key, http: httpClient, BaseURL: defaultBaseURL, TokenURL: tokenURL}, nil
+}
+
+// Email is the service account address spreadsheets must be shared with.
+func (c *Client) Email() string {
+	return c.creds.ClientEmail
+}
+
+// Replace clears the tab and writes rows from A1.
+func (c *Client) Replace(ctx context.Context, spreadsheetID, tab string, rows [][]string) error {
+	r := tabRange(tab)
+	if err := c.call(ctx, http.MethodPost, c.valuesURL(spreadsheetID, r+":clear", nil), struct{}{}, nil); err != nil {
+		return err
+	}
+	q := url.Values{"valueInputOption": {"RAW"}}
+	return c.call(ctx, http.MethodPut, c.valuesURL(spreadsheetID, r, q), valueRange{Range: r, MajorDimension: "ROWS", Values: rows}, nil)
+}
+
+// Append adds rows below the tab's existing data. The header is written
+// first when the tab is empty.
+func (c *Client) Append(ctx context.Context, spreadsheetID, tab string, header []string, rows [][]string) error {
+	r := tabRange(tab)
+	var existing valueRange
+	if err := c.call(ctx, http.MethodGet, c.valuesURL(spreadsheetID, r+"!A1:A1", nil), nil, &existing); err != nil {
+		return err
+	}
+	if len(existing.Values) == 0 {
+		rows = append([][]string{header}, rows...)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	q := url.Values{"valueInputOption": {"RAW"}, "insertDataOption": {"INSERT_ROWS"}}
+	return c.call(ctx, http.MethodPost, c.valuesURL(spreadsheetID, r+"!A1:append", q), valueRange{Range: r + "!A1", MajorDimension: "ROWS", Values: rows}, nil)
+}
+
+type valueRange struct {
+	Range          string     `json:"range,omitempty"`
+	MajorDimension string     `json:"majorDimension,omitempty"`
+	Values         [][]string `json:"values,omitempty"`
+}
+
+// tabRange quotes a tab name for A1 notation.
+func tabRange(tab string) string {
+	return "'" + strings.ReplaceAll(tab, "'", "''") + "'"
+}
+
+func (c *Client) valuesURL(spreadsheetID, rangeAndVerb string, q url.Values) string {
+	u := strings.TrimRight(c.BaseURL, "/") + "/v4/spreadsheets/" + url.PathEscape(spreadsheetID) + "/values/" + url.PathEscape(rangeAndVerb)
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	return u
+}
+
+func (c *Client) call(ctx context.Context, method, u string, body, out any) error {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return apiError(resp)
+	}
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// apiError reads Google's error message, such as a tab that does not exist
+// or a spreadsheet not shared with the service account.
+func apiError(resp *http.Response) error {
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+		Description string `json:"error_description"`
+	}
+	msg := strings.TrimSpace(string(raw))
+	if json.Unmarshal(raw, &body) == nil {
+		if body.Error.Message != "" {
+			msg = body.Error.Message
+		} else if body.Description != "" {
+			msg = body.Description
+		}
+	}
+	return fmt.Errorf("google sheets returned %s: %s", resp.Status, msg)
+}
+
+// accessToken exchanges a signed JWT for an access token, reusing it until
+// shortly before it expires.
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if c.token != "" && now.Before(c.tokenExpiry) {
+		return c.token, nil
+	}
+	assertion, err := c.signJWT(now)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", apiError(resp)
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", err
+	}
+	if tok.AccessToken == "" {
+		return "", errors.New("google sheets token response had no access token")
+	}
+	c.token = tok.AccessToken
+	c.tokenExpiry = now.Add(time.Duration(tok.ExpiresIn)*time.Second - time.Minute)
+	return c.token, nil
+}
+
+func (c *Client) signJWT(now time.Time) (string, error) {
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	if c.creds.PrivateKeyID != "" {
+		header["kid"] = c.creds.PrivateKeyID
+	}
+	claims := map[string]any{
+		"iss":   c.creds.ClientEmail,
+		"scope": scope,
+		"aud":   c.TokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	p, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signing := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(p)
+	sum := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, c.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signing + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func parsePrivateKey(raw string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(raw))
+	if block == nil {
+		return nil, ErrInvalidCredentials
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+			return rsaKey, nil
+		}
+		return nil, ErrInvalidCredentials
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return key, nil
+}
@@ -0,0 +1,129 @@
+package gsheets
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func testCredentials(t *testing.T, tokenURL string) Credentials {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	return Credentials{
+		ClientEmail: "exports@example.iam.gserviceaccount.com",
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		TokenURI:    tokenURL,
+	}
+}
+
+func TestParseCredentialsRejectsIncompleteKeys(t *testing.T) {
+	if _, err := ParseCredentials([]byte(`{"client_email":"a@b"}`)); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+	if _, err := ParseCredentials([]byte(`{"client_email":"a@b","private_key":"not a key"}`)); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials for a bad key, got %v", err)
+	}
+}
+
+func TestReplaceAndAppend(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	tokenRequests := 0
+	tabHasData := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/token" {
+			tokenRequests++
+			_ = r.ParseForm()
+			if r.Form.Get("assertion") == "" {
+				http.Error(w, "missing assertion", http.StatusBadRequest)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "tok", "expires_in": 3600})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			http.Error(w, `{"error":{"message":"unauthenticated"}}`, http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath()+" "+string(body))
+		if strings.HasSuffix(r.URL.Path, "!A1:A1") {
+			if tabHasData {
+				_, _ = w.Write([]byte(`{"values":[["Exported At"]]}`))
+			} else {
+				_, _ = w.Write([]byte(`{}`))
+			}
+			return
+		}
+		if strings.Contains(r.URL.Path, "Missing") {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":{"message":"Unable to parse range: 'Missing'"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(testCredentials(t, srv.URL+"/token"), srv.Client())
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	client.BaseURL = srv.URL
+	ctx := context.Background()
+
+	if err := client.Replace(ctx, "sheet1", "Receipts", [][]string{{"SKU"}, {"A1"}}); err != nil {
+		t.Fatalf("replace: %v", err)
+	}
+	if err := client.Append(ctx, "sheet1", "Feed", []string{"SKU"}, [][]string{{"A1"}}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	tabHasData = true
+	if err := client.Append(ctx, "sheet1", "Feed", []string{"SKU"}, [][]string{{"B2"}}); err != nil {
+		t.Fatalf("second append: %v", err)
+	}
+
+	err = client.Replace(ctx, "sheet1", "Missing", [][]string{{"SKU"}})
+	if err == nil || !strings.Contains(err.Error(), "Unable to parse range") {
+		t.Fatalf("expected google's error message, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if tokenRequests != 1 {
+		t.Fatalf("expected the access token to be reused, got %d token requests", tokenRequests)
+	}
+	if len(requests) != 7 {
+		t.Fatalf("expected 7 api requests, got %d: %v", len(requests), requests)
+	}
+	if !strings.HasPrefix(requests[0], "POST /v4/spreadsheets/sheet1/values/%27Receipts%27:clear") {
+		t.Fatalf("replace should clear first: %s", requests[0])
+	}
+	if !strings.HasPrefix(requests[1], "PUT ") || !strings.Contains(requests[1], `"values":[["SKU"],["A1"]]`) {
+		t.Fatalf("replace should write rows: %s", requests[1])
+	}
+	if !strings.Contains(requests[3], `"values":[["SKU"],["A1"]]`) {
+		t.Fatalf("first append should include the header: %s", requests[3])
+	}
+	if !strings.Contains(requests[5], `"values":[["B2"]]`) {
+		t.Fatalf("later appends should skip the header: %s", requests[5])
+	}
+}
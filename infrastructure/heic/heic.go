@@ -0,0 +1,172 @@
+// Package heic recognises the HEIC/HEIF photos iPhones take and converts
+// them to JPEG, which every browser can show. Browsers often send these
+// photos as image/jpeg or application/octet-stream, and Go's content
+// sniffing does not know the format, so the bytes are checked directly.
+//
+// Decoding HEVC is left to an external tool: heif-convert from libheif, or
+// ImageMagick. Without one the photo is kept as HEIC under its real type,
+// which Safari still displays.
+package heic
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	MIMEHEIC = "image/heic"
+	MIMEHEIF = "image/heif"
+
+	// jpegQuality matches what the receipt page's camera capture produces.
+	jpegQuality = "85"
+	// convertTimeout bounds one conversion so a stuck tool cannot hold an
+	// upload forever.
+	convertTimeout = 30 * time.Second
+)
+
+// ErrNoConverter is returned when no conversion tool is installed.
+var ErrNoConverter = errors.New("no HEIC converter installed")
+
+// Convert turns HEIC bytes into JPEG bytes. It is a variable so tests and
+// deployments with their own decoder can replace it.
+var Convert = convertWithTool
+
+// heicBrands are ISO base media brands of HEVC-coded HEIF images.
+var heicBrands = map[string]bool{
+	"heic": true, "heix": true, "hevc": true, "hevx": true,
+	"heim": true, "heis": true, "hevm": true, "hevs": true,
+}
+
+// Sniff returns image/heic or image/heif when data is a HEIF image, and ""
+// otherwise. AVIF, which shares the container, is not matched.
+func Sniff(data []byte) string {
+	if len(data) < 16 || string(data[4:8]) != "ftyp" {
+		return ""
+	}
+	size := int(data[0])<<24 | int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+	if size < 16 || size > len(data) {
+		size = min(len(data), 64)
+	}
+	// The major brand, then the compatible brands after the minor version.
+	brands := []string{string(data[8:12])}
+	for i := 16; i+4 <= size; i += 4 {
+		brands = append(brands, string(data[i:i+4]))
+	}
+	heif := false
+	for _, brand := range brands {
+		switch {
+		case heicBrands[brand]:
+			return MIMEHEIC
+		case brand == "avif" || brand == "avis":
+			return ""
+		case brand == "mif1" || brand == "msf1":
+			heif = true
+		}
+	}
+	if heif {
+		return MIMEHEIF
+	}
+	return ""
+}
+
+// IsMIME reports whether mimeType names a HEIC or HEIF image.
+func IsMIME(mimeType string) bool {
+	switch strings.ToLower(strings.TrimSpace(mimeType)) {
+	case MIMEHEIC, MIMEHEIF, "image/heic-sequence", "image/heif-sequence":
+		return true
+	}
+	return false
+}
+
+// DetectContentType is http.DetectContentType that also knows HEIC and
+// HEIF.
+func DetectContentType(data []byte) string {
+	if mimeType := Sniff(data); mimeType != "" {
+		return mimeType
+	}
+	return http.DetectContentType(data)
+}
+
+// Normalize converts a HEIC/HEIF photo to JPEG and renames it to match,
+// returning the type to store it under. When conversion is not possible the
+// photo is kept as it is, typed as HEIC. Other photos are returned
+// unchanged with their sniffed type.
+func Normalize(ctx context.Context, data []byte, fileName string) (out []byte, mimeType, name string) {
+	mimeType = Sniff(data)
+	if mimeType == "" {
+		return data, http.DetectContentType(data), fileName
+	}
+	jpeg, err := Convert(ctx, data)
+	if err != nil {
+		if !errors.Is(err, ErrNoConverter) {
+			slog.Warn("heic conversion failed", "file", fileName, "error", err)
+		}
+		return data, mimeType, fileName
+	}
+	name = strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	if name == "" {
+		name = "photo"
+	}
+	return jpeg, "image/jpeg", name + ".jpg"
+}
+
+// convertWithTool runs the first conversion tool found on PATH.
+func convertWithTool(ctx context.Context, data []byte) ([]byte, error) {
+	tool, args := findTool()
+	if tool == "" {
+		return nil, ErrNoConverter
+	}
+	dir, err := os.MkdirTemp("", "receipter-heic-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	in := filepath.Join(dir, "in.heic")
+	out := filepath.Join(dir, "out.jpg")
+	if err := os.WriteFile(in, data, 0o600); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, convertTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, tool, args(in, out)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", tool, err, strings.TrimSpace(stderr.String()))
+	}
+	jpeg, err := os.ReadFile(out)
+	if err != nil {
+		return nil, err
+	}
+	if http.DetectContentType(jpeg) != "image/jpeg" {
+		return nil, fmt.Errorf("%s did not produce a JPEG", tool)
+	}
+	return jpeg, nil
+}
+
+// findTool returns the conversion tool on PATH and how to call it.
+func findTool() (string, func(in, out string) []string) {
+	imagemagick := func(in, out string) []string {
+		return []string{in, "-auto-orient", "-quality", jpegQuality, out}
+	}
+	for _, tool := range []string{"heif-convert", "magick", "convert"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			continue
+		}
+		if tool == "heif-convert" {
+			return tool, func(in, out string) []string { return []string{"-q", jpegQuality, in, out} }
+		}
+		return tool, imagemagick
+	}
+	return "", nil
+}
@@ -0,0 +1,68 @@
+package heic
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// ftyp builds the leading box of an ISO base media file with the given
+// major brand and compatible brands.
+func ftyp(major string, compatible ...string) []byte {
+	size := 16 + 4*len(compatible)
+	box := []byte{0, 0, 0, byte(size)}
+	box = append(box, "ftyp"+major+"\x00\x00\x00\x00"...)
+	for _, brand := range compatible {
+		box = append(box, brand...)
+	}
+	return append(box, "....mdat"...)
+}
+
+func TestSniff(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"iphone heic", ftyp("heic", "mif1", "heic"), MIMEHEIC},
+		{"heic as compatible brand", ftyp("mif1", "miaf", "heic"), MIMEHEIC},
+		{"plain heif", ftyp("mif1", "mif1"), MIMEHEIF},
+		{"avif", ftyp("avif", "mif1", "miaf"), ""},
+		{"mp4", ftyp("isom", "iso2", "mp41"), ""},
+		{"jpeg", []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00\x01\x01\x00\x00\x01"), ""},
+		{"short", []byte("ftyp"), ""},
+	}
+	for _, tc := range cases {
+		if got := Sniff(tc.data); got != tc.want {
+			t.Errorf("%s: Sniff = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+	if got := DetectContentType(ftyp("heic")); got != MIMEHEIC {
+		t.Errorf("DetectContentType = %q, want %q", got, MIMEHEIC)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	orig := Convert
+	t.Cleanup(func() { Convert = orig })
+	photo := ftyp("heic", "mif1", "heic")
+	jpeg := []byte("\xff\xd8\xff\xe0 converted")
+
+	Convert = func(ctx context.Context, data []byte) ([]byte, error) { return jpeg, nil }
+	out, mimeType, name := Normalize(context.Background(), photo, "IMG_0042.HEIC")
+	if string(out) != string(jpeg) || mimeType != "image/jpeg" || name != "IMG_0042.jpg" {
+		t.Fatalf("expected converted JPEG, got mime=%q name=%q", mimeType, name)
+	}
+
+	Convert = func(ctx context.Context, data []byte) ([]byte, error) { return nil, ErrNoConverter }
+	out, mimeType, name = Normalize(context.Background(), photo, "IMG_0042.HEIC")
+	if string(out) != string(photo) || mimeType != MIMEHEIC || name != "IMG_0042.HEIC" {
+		t.Fatalf("expected HEIC kept without a converter, got mime=%q name=%q", mimeType, name)
+	}
+
+	Convert = func(ctx context.Context, data []byte) ([]byte, error) { return nil, errors.New("unexpected call") }
+	png := []byte("\x89PNG\r\n\x1a\n")
+	if _, mimeType, name = Normalize(context.Background(), png, "box.png"); mimeType != "image/png" || name != "box.png" {
+		t.Fatalf("expected PNG untouched, got mime=%q name=%q", mimeType, name)
+	}
+}
@@ -0,0 +1,224 @@
+// Package helpnotice holds site-specific help written by admins, such as
+// "always photograph seal numbers on chilled loads". A notice targets one
+// role and either one project or every project. It shows on that role's
+// help page and, when flagged, as a dismissible banner on the receipt page.
+package helpnotice
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/sqlite"
+)
+
+const (
+	maxTitleLen = 120
+	maxBodyLen  = 4000
+)
+
+var (
+	ErrTitleRequired = errors.New("notice title is required")
+	ErrTitleTooLong  = errors.New("notice title must be 120 characters or less")
+	ErrBodyTooLong   = errors.New("notice text must be 4000 characters or less")
+	ErrInvalidRole   = errors.New("notice role must be admin, scanner or client")
+	ErrNotFound      = errors.New("notice not found")
+)
+
+// Roles are the roles a notice can target, in display order.
+var Roles = []string{rbac.RoleScanner, rbac.RoleAdmin, rbac.RoleClient}
+
+// Notice is one help notice. ProjectID is nil for a notice shown on every
+// project.
+type Notice struct {
+	ID            int64     `bun:"id" json:"id"`
+	ProjectID     *int64    `bun:"project_id" json:"projectId"`
+	ProjectName   string    `bun:"project_name" json:"-"`
+	Role          string    `bun:"role" json:"role"`
+	Title         string    `bun:"title" json:"title"`
+	Body          string    `bun:"body" json:"body"`
+	ShowOnReceipt bool      `bun:"show_on_receipt" json:"showOnReceipt"`
+	Active        bool      `bun:"active" json:"active"`
+	UpdatedBy     string    `bun:"updated_by" json:"-"`
+	UpdatedAt     time.Time `bun:"updated_at" json:"-"`
+}
+
+// HTML is the notice body rendered for display; see Render.
+func (n Notice) HTML() string {
+	return Render(n.Body)
+}
+
+// Input is what an admin submits for a notice.
+type Input struct {
+	ProjectID     *int64
+	Role          string
+	Title         string
+	Body          string
+	ShowOnReceipt bool
+	Active        bool
+}
+
+func (in *Input) normalize() error {
+	in.Title = strings.TrimSpace(in.Title)
+	in.Body = strings.TrimSpace(strings.ReplaceAll(in.Body, "\r\n", "\n"))
+	in.Role = strings.TrimSpace(in.Role)
+	if in.Title == "" {
+		return ErrTitleRequired
+	}
+	if len(in.Title) > maxTitleLen {
+		return ErrTitleTooLong
+	}
+	if len(in.Body) > maxBodyLen {
+		return ErrBodyTooLong
+	}
+	for _, role := range Roles {
+		if in.Role == role {
+			return nil
+		}
+	}
+	return ErrInvalidRole
+}
+
+const selectNotices = `
+SELECT hn.id, hn.project_id, COALESCE(p.name, '') AS project_name, hn.role, hn.title, hn.body,
+       hn.show_on_receipt, hn.active, COALESCE(u.username, '') AS updated_by, hn.updated_at
+FROM help_notices hn
+LEFT JOIN projects p ON p.id = hn.project_id
+LEFT JOIN users u ON u.id = hn.updated_by_user_id`
+
+// List returns every notice for the admin page, grouped by role.
+func List(ctx context.Context, db *sqlite.DB) ([]Notice, error) {
+	notices := make([]Notice, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(selectNotices+`
+ORDER BY CASE hn.role WHEN 'scanner' THEN 0 WHEN 'admin' THEN 1 ELSE 2 END,
+         hn.project_id IS NOT NULL, p.name, hn.id`).Scan(ctx, &notices)
+	})
+	return notices, err
+}
+
+// ForHelpPage returns the active notices a role sees on its help page:
+// notices for every project, then those for the given projects.
+func ForHelpPage(ctx context.Context, db *sqlite.DB, role string, projectIDs []int64) ([]Notice, error) {
+	notices := make([]Notice, 0)
+	if len(projectIDs) == 0 {
+		projectIDs = []int64{0}
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(selectNotices+`
+WHERE hn.active = 1 AND hn.role = ? AND (hn.project_id IS NULL OR hn.project_id IN (?))
+ORDER BY hn.project_id IS NOT NULL, p.name, hn.id`, role, bun.In(projectIDs)).Scan(ctx, &notices)
+	})
+	return notices, err
+}
+
+// ForReceipt returns the receipt-page banners a user has not dismissed since
+// they were last edited.
+func ForReceipt(ctx context.Context, db *sqlite.DB, userID int64, role string, projectID int64) ([]Notice, error) {
+	notices := make([]Notice, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(selectNotices+`
+LEFT JOIN help_notice_dismissals d ON d.notice_id = hn.id AND d.user_id = ?
+WHERE hn.active = 1 AND hn.show_on_receipt = 1 AND hn.role = ?
+  AND (hn.project_id IS NULL OR hn.project_id = ?)
+  AND (d.revision IS NULL OR d.revision < hn.revision)
+ORDER BY hn.project_id IS NOT NULL, hn.id`, userID, role, projectID).Scan(ctx, &notices)
+	})
+	return notices, err
+}
+
+// Create adds a notice.
+func Create(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID int64, in Input) (int64, error) {
+	if err := in.normalize(); err != nil {
+		return 0, err
+	}
+	var id int64
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		now := time.Now().UTC()
+		if err := tx.NewRaw(`
+INSERT INTO help_notices (project_id, role, title, body, show_on_receipt, active, updated_by_user_id, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id`, in.ProjectID, in.Role, in.Title, in.Body, in.ShowOnReceipt, in.Active, userID, now, now).Scan(ctx, &id); err != nil {
+			return err
+		}
+		if auditSvc == nil {
+			return nil
+		}
+		return auditSvc.Write(ctx, tx, userID, "help_notice.create", "help_notices", strconv.FormatInt(id, 10), nil, in)
+	})
+	return id, err
+}
+
+// Update replaces a notice. Users who dismissed its banner see it again.
+func Update(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, id int64, in Input) error {
+	if err := in.normalize(); err != nil {
+		return err
+	}
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		before, err := load(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+UPDATE help_notices
+SET project_id = ?, role = ?, title = ?, body = ?, show_on_receipt = ?, active = ?, revision = revision + 1, updated_by_user_id = ?, updated_at = ?
+WHERE id = ?`, in.ProjectID, in.Role, in.Title, in.Body, in.ShowOnReceipt, in.Active, userID, time.Now().UTC(), id); err != nil {
+			return err
+		}
+		if auditSvc == nil {
+			return nil
+		}
+		return auditSvc.Write(ctx, tx, userID, "help_notice.update", "help_notices", strconv.FormatInt(id, 10), before, in)
+	})
+}
+
+// Delete removes a notice.
+func Delete(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, id int64) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		before, err := load(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM help_notices WHERE id = ?`, id); err != nil {
+			return err
+		}
+		if auditSvc == nil {
+			return nil
+		}
+		return auditSvc.Write(ctx, tx, userID, "help_notice.delete", "help_notices", strconv.FormatInt(id, 10), before, nil)
+	})
+}
+
+// Dismiss hides a notice's receipt banner from the user until it is edited.
+// The dismissal records the notice's revision, so an edit made in the same
+// instant still shows again.
+func Dismiss(ctx context.Context, db *sqlite.DB, userID, id int64) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := load(ctx, tx, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO help_notice_dismissals (notice_id, user_id, revision, dismissed_at)
+SELECT id, ?, revision, ? FROM help_notices WHERE id = ?
+ON CONFLICT (notice_id, user_id) DO UPDATE SET revision = excluded.revision, dismissed_at = excluded.dismissed_at`, userID, time.Now().UTC(), id)
+		return err
+	})
+}
+
+func load(ctx context.Context, tx bun.Tx, id int64) (Notice, error) {
+	var n Notice
+	if err := tx.NewRaw(selectNotices+` WHERE hn.id = ?`, id).Scan(ctx, &n); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return n, ErrNotFound
+		}
+		return n, err
+	}
+	return n, nil
+}
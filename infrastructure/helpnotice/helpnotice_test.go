@@ -0,0 +1,130 @@
+package helpnotice
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func openHelpNoticeTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "helpnotice-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin1', 'x', 'admin'), (2, 'scanner1', 'x', 'scanner')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+				(1, 'Chilled', 'Chilled', DATE('now'), 'Client', 'chilled', 'active'),
+				(2, 'Ambient', 'Ambient', DATE('now'), 'Client', 'ambient', 'active')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return db
+}
+
+func TestRenderEscapesAndFormats(t *testing.T) {
+	got := Render("Always photograph **seal numbers**.\nSee https://example.com/sop?a=1&b=2\n\n- one _two_\n- <script>x</script>\n\n1. first\n2. second")
+	for _, want := range []string{
+		"<p>Always photograph <strong>seal numbers</strong>.<br/>",
+		`<a class="link" href="https://example.com/sop?a=1&amp;b=2" target="_blank" rel="noopener">`,
+		`<ul class="list-disc pl-6 space-y-1"><li>one <em>two</em></li><li>&lt;script&gt;x&lt;/script&gt;</li></ul>`,
+		`<ol class="list-decimal pl-6 space-y-1"><li>first</li><li>second</li></ol>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("Render missing %q in %s", want, got)
+		}
+	}
+	if strings.Contains(Render(`"><img src=x onerror=alert(1)>`), "<img") {
+		t.Fatalf("Render let markup through")
+	}
+}
+
+func TestNoticesForHelpPageAndReceipt(t *testing.T) {
+	db := openHelpNoticeTestDB(t)
+	ctx := context.Background()
+	chilled := int64(1)
+
+	if _, err := Create(ctx, db, nil, 1, Input{Role: "scanner", Title: " "}); !errors.Is(err, ErrTitleRequired) {
+		t.Fatalf("blank title err = %v", err)
+	}
+	if _, err := Create(ctx, db, nil, 1, Input{Role: "kiosk", Title: "x"}); !errors.Is(err, ErrInvalidRole) {
+		t.Fatalf("bad role err = %v", err)
+	}
+	sealID, err := Create(ctx, db, nil, 1, Input{ProjectID: &chilled, Role: "scanner", Title: "Seals", Body: "Photograph seal numbers", ShowOnReceipt: true, Active: true})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := Create(ctx, db, nil, 1, Input{Role: "scanner", Title: "Gloves", Body: "Wear gloves", Active: true}); err != nil {
+		t.Fatalf("create global: %v", err)
+	}
+	if _, err := Create(ctx, db, nil, 1, Input{Role: "admin", Title: "Admins only", ShowOnReceipt: true, Active: true}); err != nil {
+		t.Fatalf("create admin: %v", err)
+	}
+
+	help, err := ForHelpPage(ctx, db, "scanner", []int64{1})
+	if err != nil || len(help) != 2 || help[0].Title != "Gloves" || help[1].ProjectName != "Chilled" {
+		t.Fatalf("scanner help on chilled = %+v, %v", help, err)
+	}
+	if help, _ = ForHelpPage(ctx, db, "scanner", nil); len(help) != 1 {
+		t.Fatalf("scanner help without project = %+v", help)
+	}
+
+	banners, err := ForReceipt(ctx, db, 2, "scanner", 1)
+	if err != nil || len(banners) != 1 || banners[0].ID != sealID {
+		t.Fatalf("chilled banners = %+v, %v", banners, err)
+	}
+	if banners, _ = ForReceipt(ctx, db, 2, "scanner", 2); len(banners) != 0 {
+		t.Fatalf("ambient banners = %+v", banners)
+	}
+
+	if err := Dismiss(ctx, db, 2, sealID); err != nil {
+		t.Fatalf("dismiss: %v", err)
+	}
+	if banners, _ = ForReceipt(ctx, db, 2, "scanner", 1); len(banners) != 0 {
+		t.Fatalf("banners after dismiss = %+v", banners)
+	}
+	if err := Update(ctx, db, nil, 1, sealID, Input{ProjectID: &chilled, Role: "scanner", Title: "Seals", Body: "Photograph seal numbers and temperatures", ShowOnReceipt: true, Active: true}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	// An edit in the same instant as the dismissal must still show again.
+	if _, err := db.W.ExecContext(ctx, `UPDATE help_notice_dismissals SET dismissed_at = (SELECT updated_at FROM help_notices WHERE id = ?)`, sealID); err != nil {
+		t.Fatalf("align dismissal time: %v", err)
+	}
+	if banners, _ = ForReceipt(ctx, db, 2, "scanner", 1); len(banners) != 1 {
+		t.Fatalf("edited notice should show again, got %+v", banners)
+	}
+
+	if err := Delete(ctx, db, nil, 1, sealID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := Dismiss(ctx, db, 2, sealID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("dismiss deleted err = %v", err)
+	}
+}
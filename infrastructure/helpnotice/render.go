@@ -0,0 +1,74 @@
+package helpnotice
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	boldPattern   = regexp.MustCompile(`\*\*([^*\n]+)\*\*`)
+	italicPattern = regexp.MustCompile(`(^|[\s(])_([^_\n]+)_`)
+	linkPattern   = regexp.MustCompile(`https?://[^\s<]+[^\s<.,;:!?)]`)
+	bulletPattern = regexp.MustCompile(`^[-*] +`)
+	numberPattern = regexp.MustCompile(`^[0-9]+[.)] +`)
+)
+
+// Render turns a notice body into HTML. The text is escaped first, so only
+// this small formatting set reaches the page: blank lines separate
+// paragraphs, lines starting "- " or "1. " make lists, **bold**, _italic_,
+// and web addresses become links.
+func Render(body string) string {
+	var b strings.Builder
+	for _, block := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n\n") {
+		lines := make([]string, 0)
+		for _, line := range strings.Split(block, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		switch {
+		case allMatch(lines, bulletPattern):
+			writeList(&b, "ul", "list-disc pl-6 space-y-1", lines, bulletPattern)
+		case allMatch(lines, numberPattern):
+			writeList(&b, "ol", "list-decimal pl-6 space-y-1", lines, numberPattern)
+		default:
+			b.WriteString("<p>")
+			for i, line := range lines {
+				if i > 0 {
+					b.WriteString("<br/>")
+				}
+				b.WriteString(inline(line))
+			}
+			b.WriteString("</p>")
+		}
+	}
+	return b.String()
+}
+
+func allMatch(lines []string, pattern *regexp.Regexp) bool {
+	for _, line := range lines {
+		if !pattern.MatchString(line) {
+			return false
+		}
+	}
+	return true
+}
+
+func writeList(b *strings.Builder, tag, class string, lines []string, marker *regexp.Regexp) {
+	b.WriteString("<" + tag + ` class="` + class + `">`)
+	for _, line := range lines {
+		b.WriteString("<li>" + inline(marker.ReplaceAllString(line, "")) + "</li>")
+	}
+	b.WriteString("</" + tag + ">")
+}
+
+func inline(text string) string {
+	text = html.EscapeString(text)
+	text = linkPattern.ReplaceAllString(text, `<a class="link" href="$0" target="_blank" rel="noopener">$0</a>`)
+	text = boldPattern.ReplaceAllString(text, "<strong>$1</strong>")
+	return italicPattern.ReplaceAllString(text, "$1<em>$2</em>")
+}
@@ -0,0 +1,44 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/accesslog"
+	"receipter/infrastructure/rbac"
+)
+
+// AccessLogMiddleware records the project pages, exports and photos a client
+// user views. Only successful responses are logged, so refused or failed
+// requests do not read as views. It must run after AuthenticateMiddleware.
+func (s *Server) AccessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, ok := sessioncontext.GetSessionFromContext(r.Context())
+		if !ok || s.AccessLog == nil || session.User.Role != rbac.RoleClient || session.ActiveProjectID == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		kind, ok := accesslog.Classify(r.Method, r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		if status := ww.Status(); status >= http.StatusBadRequest {
+			return
+		}
+		s.AccessLog.Record(accesslog.Entry{
+			ProjectID: *session.ActiveProjectID,
+			UserID:    session.UserID,
+			Username:  session.User.Username,
+			Kind:      kind,
+			Path:      r.URL.Path,
+			Query:     r.URL.RawQuery,
+			At:        time.Now().UTC(),
+		})
+	})
+}
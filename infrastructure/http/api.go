@@ -0,0 +1,137 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	attributionapi "receipter/frontend/api/attribution"
+	bookingapi "receipter/frontend/api/booking"
+	catalogapi "receipter/frontend/api/catalog"
+	changefeedapi "receipter/frontend/api/changefeed"
+	graphqlapi "receipter/frontend/api/graphql"
+	kpiapi "receipter/frontend/api/kpi"
+	palletsapi "receipter/frontend/api/pallets"
+	palletlabels "receipter/frontend/pallets/labels"
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/apitoken"
+	"receipter/infrastructure/rbac"
+	"receipter/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RegisterAPIRoutes registers token-authenticated machine endpoints under /api.
+func (s *Server) RegisterAPIRoutes(r chi.Router) chi.Router {
+	s.Rbac.Add(rbac.RoleAdmin, "API_GRAPHQL", http.MethodPost, "/api/graphql")
+	s.Rbac.Add(rbac.RoleClient, "API_GRAPHQL", http.MethodPost, "/api/graphql")
+	r.Post("/graphql", graphqlapi.GraphQLQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "API_GRAPHQL", http.MethodGet, "/api/graphql")
+	s.Rbac.Add(rbac.RoleClient, "API_GRAPHQL", http.MethodGet, "/api/graphql")
+	r.Get("/graphql", graphqlapi.GraphQLQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "API_PALLETS_CREATE", http.MethodPost, "/api/pallets")
+	r.Post("/pallets", palletlabels.CreatePalletsAPICommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "API_V1_PALLETS_VIEW", http.MethodGet, "/api/v1/pallets")
+	s.Rbac.Add(rbac.RoleScanner, "API_V1_PALLETS_VIEW", http.MethodGet, "/api/v1/pallets")
+	s.Rbac.Add(rbac.RoleClient, "API_V1_PALLETS_VIEW", http.MethodGet, "/api/v1/pallets")
+	r.Get("/v1/pallets", palletsapi.PalletsQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "API_V1_PALLETS_CREATE", http.MethodPost, "/api/v1/pallets")
+	r.Post("/v1/pallets", palletlabels.CreatePalletsAPICommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "API_V1_PALLET_VIEW", http.MethodGet, "/api/v1/pallets/*")
+	s.Rbac.Add(rbac.RoleScanner, "API_V1_PALLET_VIEW", http.MethodGet, "/api/v1/pallets/*")
+	s.Rbac.Add(rbac.RoleClient, "API_V1_PALLET_VIEW", http.MethodGet, "/api/v1/pallets/*")
+	r.Get("/v1/pallets/{id}", palletsapi.PalletQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "API_V1_PALLET_RECEIPTS_VIEW", http.MethodGet, "/api/v1/pallets/*/receipts")
+	s.Rbac.Add(rbac.RoleScanner, "API_V1_PALLET_RECEIPTS_VIEW", http.MethodGet, "/api/v1/pallets/*/receipts")
+	s.Rbac.Add(rbac.RoleClient, "API_V1_PALLET_RECEIPTS_VIEW", http.MethodGet, "/api/v1/pallets/*/receipts")
+	r.Get("/v1/pallets/{id}/receipts", palletsapi.ReceiptsQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "API_V1_PALLET_RECEIPTS_CREATE", http.MethodPost, "/api/v1/pallets/*/receipts")
+	s.Rbac.Add(rbac.RoleScanner, "API_V1_PALLET_RECEIPTS_CREATE", http.MethodPost, "/api/v1/pallets/*/receipts")
+	r.Post("/v1/pallets/{id}/receipts", palletsapi.CreateReceiptCommandHandler(s.DB, s.Audit, s.Live))
+	s.Rbac.Add(rbac.RoleAdmin, "API_RECEIPTS_SCANNED_BY_REASSIGN", http.MethodPost, "/api/projects/*/receipts/scanned-by")
+	r.Post("/projects/{id}/receipts/scanned-by", attributionapi.ReassignScannedByCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "API_PROJECT_KPIS", http.MethodGet, "/api/projects/*/kpis")
+	s.Rbac.Add(rbac.RoleClient, "API_PROJECT_KPIS", http.MethodGet, "/api/projects/*/kpis")
+	r.Get("/projects/{id}/kpis", kpiapi.ProjectKPIQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "API_STOCK_ITEMS_VIEW", http.MethodGet, "/api/projects/*/stock-items")
+	s.Rbac.Add(rbac.RoleClient, "API_STOCK_ITEMS_VIEW", http.MethodGet, "/api/projects/*/stock-items")
+	r.Get("/projects/{id}/stock-items", catalogapi.StockItemsQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "API_STOCK_ITEMS_UPSERT", http.MethodPut, "/api/projects/*/stock-items")
+	s.Rbac.Add(rbac.RoleClient, "API_STOCK_ITEMS_UPSERT", http.MethodPut, "/api/projects/*/stock-items")
+	r.Put("/projects/{id}/stock-items", catalogapi.UpsertStockItemCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "API_STOCK_ITEMS_DEACTIVATE", http.MethodPost, "/api/projects/*/stock-items/deactivate")
+	s.Rbac.Add(rbac.RoleClient, "API_STOCK_ITEMS_DEACTIVATE", http.MethodPost, "/api/projects/*/stock-items/deactivate")
+	r.Post("/projects/{id}/stock-items/deactivate", catalogapi.DeactivateStockItemCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "API_STOCK_ITEMS_BATCH", http.MethodPost, "/api/projects/*/stock-items/batch")
+	s.Rbac.Add(rbac.RoleClient, "API_STOCK_ITEMS_BATCH", http.MethodPost, "/api/projects/*/stock-items/batch")
+	r.Post("/projects/{id}/stock-items/batch", catalogapi.SyncStockItemsCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "API_DELIVERY_SLOTS_VIEW", http.MethodGet, "/api/delivery-slots")
+	s.Rbac.Add(rbac.RoleClient, "API_DELIVERY_SLOTS_VIEW", http.MethodGet, "/api/delivery-slots")
+	r.Get("/delivery-slots", bookingapi.SlotsQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "API_DELIVERY_BOOKINGS_CREATE", http.MethodPost, "/api/delivery-bookings")
+	s.Rbac.Add(rbac.RoleClient, "API_DELIVERY_BOOKINGS_CREATE", http.MethodPost, "/api/delivery-bookings")
+	r.Post("/delivery-bookings", bookingapi.BookCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "API_CHANGES_VIEW", http.MethodGet, "/api/changes")
+	s.Rbac.Add(rbac.RoleClient, "API_CHANGES_VIEW", http.MethodGet, "/api/changes")
+	r.Get("/changes", changefeedapi.ChangesQueryHandler(s.DB))
+	return r
+}
+
+// APITokenMiddleware authenticates bearer tokens and exposes the token's user
+// to handlers as a session without an ID, so session-aware code paths keep working.
+func (s *Server) APITokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plaintext, ok := apitoken.FromRequest(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="receipter"`)
+			writeAPIError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+		user, token, err := apitoken.Authenticate(r.Context(), s.DB, plaintext)
+		if err != nil {
+			if !errors.Is(err, apitoken.ErrInvalidToken) {
+				slog.Error("api token authentication failed", slog.Any("err", err))
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="receipter", error="invalid_token"`)
+			writeAPIError(w, http.StatusUnauthorized, "invalid or revoked api token")
+			return
+		}
+
+		session := models.Session{
+			UserID:    user.ID,
+			User:      user,
+			UserRoles: []string{user.Role},
+		}
+		if user.Role == rbac.RoleAdmin {
+			session.ScreenPermissions = s.RbacCache.GetAllRouteNames()
+		} else {
+			if !s.RbacValidation(session.UserRoles, r.URL.Path, r.Method) {
+				writeAPIError(w, http.StatusForbidden, "token role is not permitted to use this endpoint")
+				return
+			}
+			session.ScreenPermissions = s.buildRbacNamedRoutesMap(session.UserRoles)
+		}
+
+		ctx := sessioncontext.NewContextWithSession(r.Context(), session)
+		ctx = sessioncontext.NewContextWithAPIToken(ctx, token)
+		// Each token has its own rate limit bucket, so one noisy integration
+		// does not use up its user's other tokens.
+		ctx = withRateLimitKey(ctx, "token:"+strconv.FormatInt(token.ID, 10))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func isAPIPath(path string) bool {
+	return path == "/api" || strings.HasPrefix(path, "/api/")
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"errors": []map[string]string{{"message": message}},
+	})
+}
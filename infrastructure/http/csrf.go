@@ -13,6 +13,16 @@ const csrfCookieName = "X-CSRF-Token"
 
 func (s *Server) CSRFMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// API requests authenticate with bearer tokens rather than cookies,
+		// so they are not exposed to cross-site request forgery. Embed
+		// widgets are read-only and publicly cached, so they must not set
+		// the CSRF cookie either. Inbound email is posted by the mail
+		// provider and authenticated by the secret in its URL.
+		if isAPIPath(r.URL.Path) || isEmbedPath(r.URL.Path) || isInboundPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		token := ensureCSRFToken(w, r)
 		if isSafeMethod(r.Method) {
 			next.ServeHTTP(w, r)
@@ -39,6 +49,14 @@ func (s *Server) CSRFMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+func isEmbedPath(path string) bool {
+	return strings.HasPrefix(path, "/embed/")
+}
+
+func isInboundPath(path string) bool {
+	return strings.HasPrefix(path, "/inbound/")
+}
+
 func isSafeMethod(method string) bool {
 	switch method {
 	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
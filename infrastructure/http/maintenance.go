@@ -0,0 +1,55 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+
+	sessioncontext "receipter/frontend/shared/context"
+	sharedhtml "receipter/frontend/shared/html"
+)
+
+const maintenanceTogglePath = "/tasker/admin/system/maintenance"
+
+// MaintenanceMiddleware keeps the app read-only while maintenance mode is on.
+// Pages and exports keep working and carry a banner; writes are refused with
+// a 503, as JSON for API clients and as a page for browsers. The admin toggle
+// stays open so maintenance can be lifted from the UI.
+func (s *Server) MaintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := s.Maintenance.Status()
+		if !state.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r = r.WithContext(sessioncontext.NewContextWithMaintenance(r.Context(), state.Banner()))
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path == maintenanceTogglePath {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Retry-After", "300")
+		if isAPIPath(r.URL.Path) {
+			writeAPIError(w, http.StatusServiceUnavailable, state.Banner())
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = sharedhtml.MaintenancePage(state.Banner(), maintenanceBackHref(r)).Render(r.Context(), w)
+	})
+}
+
+// maintenanceBackHref sends the user back to the page they submitted from,
+// when it was one of ours.
+func maintenanceBackHref(r *http.Request) string {
+	referer, err := url.Parse(r.Referer())
+	if err != nil || referer.Host != r.Host || referer.Path == "" {
+		return "/"
+	}
+	return referer.RequestURI()
+}
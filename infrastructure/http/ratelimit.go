@@ -0,0 +1,85 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/ratelimit"
+)
+
+type rateLimitKeyContextKey struct{}
+
+// withRateLimitKey names the caller whose bucket requests are counted
+// against, for callers that are not identified by their user alone.
+func withRateLimitKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, rateLimitKeyContextKey{}, key)
+}
+
+func rateLimitKey(r *http.Request) (string, bool) {
+	if key, ok := r.Context().Value(rateLimitKeyContextKey{}).(string); ok && key != "" {
+		return key, true
+	}
+	if session, ok := sessioncontext.GetSessionFromContext(r.Context()); ok && session.UserID > 0 {
+		return "user:" + strconv.FormatInt(session.UserID, 10), true
+	}
+	return "", false
+}
+
+// rateLimitClass sorts a request into the route class whose limit applies.
+func rateLimitClass(r *http.Request) string {
+	path := r.URL.Path
+	switch {
+	case strings.HasSuffix(path, ".csv") || strings.HasSuffix(path, "/download") || strings.HasSuffix(path, "/bundle"):
+		return ratelimit.ClassExport
+	case r.Method == http.MethodGet && strings.Contains(path, "/photo") && !strings.HasSuffix(path, "/redact"):
+		return ratelimit.ClassPhoto
+	case isAPIPath(path):
+		return ratelimit.ClassAPI
+	}
+	return ratelimit.ClassDefault
+}
+
+// RateLimitMiddleware counts each authenticated request against its caller's
+// bucket for the route class, answering 429 once the bucket is empty. It
+// must run after the session or API token is resolved.
+func (s *Server) RateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := rateLimitKey(r)
+		if !ok || s.RateLimit == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		decision := s.RateLimit.Allow(rateLimitClass(r), key, time.Now())
+		if decision.Unlimited {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(decision.Limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+		if decision.Allowed {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		retryAfter := ceilSeconds(decision.RetryAfter)
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		message := fmt.Sprintf("too many requests, retry in %d seconds", retryAfter)
+		if isAPIPath(r.URL.Path) {
+			writeAPIError(w, http.StatusTooManyRequests, message)
+			return
+		}
+		http.Error(w, message, http.StatusTooManyRequests)
+	})
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
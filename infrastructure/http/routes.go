@@ -3,13 +3,35 @@ package http
 import (
 	"net/http"
 
+	accessrequests "receipter/frontend/accessRequests"
+	adminapitokens "receipter/frontend/adminAPITokens"
+	admincomments "receipter/frontend/adminComments"
+	admindamagereasons "receipter/frontend/adminDamageReasons"
+	admindeliveries "receipter/frontend/adminDeliveries"
+	adminembeds "receipter/frontend/adminEmbeds"
+	adminhealth "receipter/frontend/adminHealth"
+	adminhelp "receipter/frontend/adminHelp"
+	adminkiosks "receipter/frontend/adminKiosks"
+	adminnotifications "receipter/frontend/adminNotifications"
+	adminsites "receipter/frontend/adminSites"
+	adminstorage "receipter/frontend/adminStorage"
+	adminsystem "receipter/frontend/adminSystem"
 	adminusers "receipter/frontend/adminUsers"
+	auditorpage "receipter/frontend/auditor"
+	bookingspage "receipter/frontend/bookings"
+	embedpage "receipter/frontend/embed"
 	exportspage "receipter/frontend/exports"
 	helppage "receipter/frontend/help"
+	"receipter/frontend/inboundmail"
+	kioskpage "receipter/frontend/kiosk"
 	"receipter/frontend/login"
+	palletattribution "receipter/frontend/pallets/attribution"
 	palletlabels "receipter/frontend/pallets/labels"
+	palletmove "receipter/frontend/pallets/move"
 	palletprogress "receipter/frontend/pallets/progress"
 	palletreceipt "receipter/frontend/pallets/receipt"
+	pallettransfer "receipter/frontend/pallets/transfer"
+	palletunknownsku "receipter/frontend/pallets/unknownsku"
 	projectspage "receipter/frontend/projects"
 	"receipter/frontend/settings"
 	"receipter/frontend/stock"
@@ -23,6 +45,52 @@ func (s *Server) RegisterLoginRoutes() {
 	s.router.Get("/login", login.GetLoginScreenHandler)
 	s.router.Post("/login", login.CreateLoginHandler(s.DB, s.SessionCache, s.UserCache))
 	s.router.Post("/logout", login.LogoutHandler(s.DB, s.SessionCache))
+	// Password resets write tokens and passwords without a session, so they
+	// are guarded here rather than by the session routes' middleware.
+	r := s.router.With(s.SchemaGuardMiddleware, s.MaintenanceMiddleware)
+	r.Get("/password/forgot", login.ForgotPasswordPageHandler(s.PasswordResets))
+	r.Post("/password/forgot", login.RequestPasswordResetHandler(s.PasswordResets))
+	r.Get("/password/reset", login.ResetPasswordPageHandler(s.PasswordResets))
+	r.Post("/password/reset", login.CompletePasswordResetHandler(s.PasswordResets, s.SessionCache))
+}
+
+// RegisterKioskRoutes registers the kiosk enrollment and PIN screens. They
+// authenticate with the kiosk device cookie rather than a session.
+func (s *Server) RegisterKioskRoutes() {
+	s.router.Get("/kiosk/enroll", kioskpage.EnrollPageQueryHandler())
+	s.router.Post("/kiosk/enroll", kioskpage.EnrollCommandHandler(s.DB, s.SessionCache))
+	s.router.Get("/kiosk", kioskpage.PINPageQueryHandler(s.DB))
+	s.router.Post("/kiosk/switch", kioskpage.SwitchUserCommandHandler(s.DB, s.SessionCache, s.UserCache, s.Audit))
+	s.router.Post("/kiosk/lock", kioskpage.LockCommandHandler(s.DB, s.SessionCache))
+}
+
+// RegisterEmbedRoutes registers the client summary widget and the warehouse
+// display board. They authenticate with the widget token in the URL rather
+// than a session.
+func (s *Server) RegisterEmbedRoutes() {
+	s.router.Get("/embed/{token}/summary", embedpage.SummaryWidgetQueryHandler(s.DB))
+	s.router.Get("/embed/{token}/summary.json", embedpage.SummaryJSONQueryHandler(s.DB))
+	s.router.Get("/embed/{token}/board", embedpage.BoardQueryHandler(s.DB))
+	s.router.Get("/embed/{token}/board.json", embedpage.BoardJSONQueryHandler(s.DB))
+}
+
+// RegisterAuditorRoutes registers the read-only project preview behind
+// auditor links. It authenticates with the link token in the URL rather than
+// a session and only serves GETs.
+func (s *Server) RegisterAuditorRoutes() {
+	r := s.router.With(s.SchemaGuardMiddleware, s.MaintenanceMiddleware)
+	r.Get("/audit/{token}", auditorpage.SKUsPageQueryHandler(s.DB, s.AccessLog))
+	r.Get("/audit/{token}/pallets", auditorpage.PalletsPageQueryHandler(s.DB, s.AccessLog))
+	r.Get("/audit/{token}/pallets/{id}", auditorpage.PalletPageQueryHandler(s.DB, s.AccessLog))
+	r.Get("/audit/{token}/logs", auditorpage.LogsPageQueryHandler(s.DB, s.AccessLog))
+}
+
+// RegisterInboundMailRoutes registers the mail provider's inbound webhook,
+// which client replies to comment emails arrive on. It authenticates with
+// the secret in the URL rather than a session.
+func (s *Server) RegisterInboundMailRoutes() {
+	s.router.With(s.SchemaGuardMiddleware, s.MaintenanceMiddleware).
+		Post("/inbound/email/{secret}", inboundmail.ReceiveCommandHandler(s.ReplyMail))
 }
 
 // RegisterAdminRoutes registers admin-only routes.
@@ -36,9 +104,91 @@ func (s *Server) RegisterAdminRoutes(r chi.Router) chi.Router {
 	s.Rbac.Add(rbac.RoleScanner, "PROJECTS_ACTIVATE", http.MethodPost, "/tasker/projects/*/activate")
 	r.Post("/projects/{id}/activate", projectspage.ActivateProjectCommandHandler(s.DB, s.SessionCache, s.Audit))
 	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_STATUS_EDIT", http.MethodPost, "/tasker/projects/*/status")
-	r.Post("/projects/{id}/status", projectspage.UpdateProjectStatusCommandHandler(s.DB, s.SessionCache, s.Audit))
+	r.Post("/projects/{id}/status", projectspage.UpdateProjectStatusCommandHandler(s.DB, s.SessionCache, s.Audit, s.ColdStorage))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_LABEL_LANGUAGE_EDIT", http.MethodPost, "/tasker/projects/*/label-language")
+	r.Post("/projects/{id}/label-language", projectspage.UpdateProjectLabelLanguageCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_LABEL_SYMBOLOGY_EDIT", http.MethodPost, "/tasker/projects/*/label-symbology")
+	r.Post("/projects/{id}/label-symbology", projectspage.UpdateProjectLabelSymbologyCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_PALLET_ALLOWANCE_EDIT", http.MethodPost, "/tasker/projects/*/pallet-allowance")
+	r.Post("/projects/{id}/pallet-allowance", projectspage.UpdateProjectPalletAllowanceCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_SITE_EDIT", http.MethodPost, "/tasker/projects/*/site")
+	r.Post("/projects/{id}/site", projectspage.UpdateProjectSiteCommandHandler(s.DB, s.Audit))
 	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_LOGS_VIEW", http.MethodGet, "/tasker/projects/*/logs")
 	r.Get("/projects/{id}/logs", projectspage.ProjectLogsPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_GLOBAL_SETTINGS_VIEW", http.MethodGet, "/tasker/projects/settings")
+	r.Get("/projects/settings", projectspage.GlobalSettingsPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_GLOBAL_SETTINGS_EDIT", http.MethodPost, "/tasker/projects/settings")
+	r.Post("/projects/settings", projectspage.SaveGlobalSettingsCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_SETTINGS_VIEW", http.MethodGet, "/tasker/projects/*/settings")
+	r.Get("/projects/{id}/settings", projectspage.ProjectSettingsPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_SETTINGS_EDIT", http.MethodPost, "/tasker/projects/*/settings")
+	r.Post("/projects/{id}/settings", projectspage.SaveProjectSettingsCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_SLA_VIEW", http.MethodGet, "/tasker/projects/*/sla")
+	r.Get("/projects/{id}/sla", projectspage.SLAReportPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_UNUSED_PALLETS_VIEW", http.MethodGet, "/tasker/projects/*/unused-pallets")
+	r.Get("/projects/{id}/unused-pallets", projectspage.UnusedPalletsPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_UNUSED_PALLETS_EXEMPT", http.MethodPost, "/tasker/projects/*/unused-pallets/*/exempt")
+	r.Post("/projects/{id}/unused-pallets/{palletID}/exempt", projectspage.SetPalletCleanupExemptCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_PHASES_VIEW", http.MethodGet, "/tasker/projects/*/phases")
+	r.Get("/projects/{id}/phases", projectspage.PhasesPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_PHASES_START", http.MethodPost, "/tasker/projects/*/phases")
+	r.Post("/projects/{id}/phases", projectspage.StartPhaseCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_PHASES_CLOSE", http.MethodPost, "/tasker/projects/*/phases/*/close")
+	r.Post("/projects/{id}/phases/{phaseID}/close", projectspage.ClosePhaseCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_AGING_VIEW", http.MethodGet, "/tasker/projects/*/aging")
+	r.Get("/projects/{id}/aging", projectspage.AgingReportPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_AGING_EXPORT", http.MethodGet, "/tasker/projects/*/aging/export.csv")
+	r.Get("/projects/{id}/aging/export.csv", projectspage.AgingExportCSVHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_CLAIMS_VIEW", http.MethodGet, "/tasker/projects/*/claims")
+	r.Get("/projects/{id}/claims", projectspage.ClaimsPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_CLAIMS_CREATE", http.MethodPost, "/tasker/projects/*/claims")
+	r.Post("/projects/{id}/claims", projectspage.CreateDamageClaimCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_CLAIMS_DOWNLOAD", http.MethodGet, "/tasker/projects/*/claims/*/download")
+	r.Get("/projects/{id}/claims/{claimID}/download", projectspage.ClaimPackDownloadHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_CUSTOMS_VIEW", http.MethodGet, "/tasker/projects/*/customs")
+	r.Get("/projects/{id}/customs", projectspage.CustomsReportPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_CUSTOMS_EXPORT", http.MethodGet, "/tasker/projects/*/customs/export.csv")
+	r.Get("/projects/{id}/customs/export.csv", projectspage.CustomsExportCSVHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_CUSTODY_EXPORT", http.MethodGet, "/tasker/projects/*/custody.pdf")
+	r.Get("/projects/{id}/custody.pdf", palletlabels.DeliveryCustodyPDFHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_ACCESS_LOG_VIEW", http.MethodGet, "/tasker/projects/*/access-log")
+	r.Get("/projects/{id}/access-log", projectspage.AccessLogPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_ACCESS_LOG_EXPORT", http.MethodGet, "/tasker/projects/*/access-log/export.csv")
+	r.Get("/projects/{id}/access-log/export.csv", projectspage.AccessLogExportCSVHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_AUDITOR_LINKS_VIEW", http.MethodGet, "/tasker/projects/*/auditors")
+	r.Get("/projects/{id}/auditors", projectspage.AuditorLinksPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_AUDITOR_LINKS_ISSUE", http.MethodPost, "/tasker/projects/*/auditors")
+	r.Post("/projects/{id}/auditors", projectspage.IssueAuditorLinkCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_AUDITOR_LINKS_REVOKE", http.MethodPost, "/tasker/projects/*/auditors/*/revoke")
+	r.Post("/projects/{id}/auditors/{linkID}/revoke", projectspage.RevokeAuditorLinkCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_CUSTOM_FIELDS_VIEW", http.MethodGet, "/tasker/projects/*/custom-fields")
+	r.Get("/projects/{id}/custom-fields", projectspage.CustomFieldsPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_CUSTOM_FIELDS_CREATE", http.MethodPost, "/tasker/projects/*/custom-fields")
+	r.Post("/projects/{id}/custom-fields", projectspage.CreateCustomFieldCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_CUSTOM_FIELDS_EDIT", http.MethodPost, "/tasker/projects/*/custom-fields/*/update")
+	r.Post("/projects/{id}/custom-fields/{fieldID}/update", projectspage.UpdateCustomFieldCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_WEBHOOKS_VIEW", http.MethodGet, "/tasker/projects/*/webhooks")
+	r.Get("/projects/{id}/webhooks", projectspage.WebhooksPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_WEBHOOKS_CREATE", http.MethodPost, "/tasker/projects/*/webhooks")
+	r.Post("/projects/{id}/webhooks", projectspage.CreateWebhookCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_WEBHOOKS_EDIT", http.MethodPost, "/tasker/projects/*/webhooks/*/update")
+	r.Post("/projects/{id}/webhooks/{webhookID}/update", projectspage.UpdateWebhookCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_WEBHOOKS_ROTATE_SECRET", http.MethodPost, "/tasker/projects/*/webhooks/*/rotate-secret")
+	r.Post("/projects/{id}/webhooks/{webhookID}/rotate-secret", projectspage.RotateWebhookSecretCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_WEBHOOKS_DELETE", http.MethodPost, "/tasker/projects/*/webhooks/*/delete")
+	r.Post("/projects/{id}/webhooks/{webhookID}/delete", projectspage.DeleteWebhookCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_BUNDLE_EXPORT", http.MethodGet, "/tasker/projects/*/bundle")
+	r.Get("/projects/{id}/bundle", projectspage.ExportBundleQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_RECONCILE_VIEW", http.MethodGet, "/tasker/projects/*/reconcile")
+	r.Get("/projects/{id}/reconcile", projectspage.ReconcilePageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_RECONCILE_UPLOAD", http.MethodPost, "/tasker/projects/*/reconcile")
+	r.Post("/projects/{id}/reconcile", projectspage.UploadWMSSnapshotCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_RECONCILE_EXPORT", http.MethodGet, "/tasker/projects/*/reconcile/*/export.csv")
+	r.Get("/projects/{id}/reconcile/{snapshotID}/export.csv", projectspage.ReconcileExportCSVHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_EXPIRY_CORRECTION_VIEW", http.MethodGet, "/tasker/projects/*/expiry-correction")
+	r.Get("/projects/{id}/expiry-correction", projectspage.ExpiryCorrectionPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PROJECTS_EXPIRY_CORRECTION_APPLY", http.MethodPost, "/tasker/projects/*/expiry-correction")
+	r.Post("/projects/{id}/expiry-correction", projectspage.ApplyExpiryCorrectionCommandHandler(s.DB, s.Audit, s.Live))
 
 	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_USERS_LIST_VIEW", http.MethodGet, "/tasker/admin/users")
 	r.Get("/admin/users", adminusers.UsersPageQueryHandler(s.DB, s.UserCache))
@@ -46,6 +196,119 @@ func (s *Server) RegisterAdminRoutes(r chi.Router) chi.Router {
 	r.Post("/admin/users", adminusers.CreateUserCommandHandler(s.DB, s.UserCache))
 	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_USERS_CLIENT_PROJECTS_EDIT", http.MethodPost, "/tasker/admin/users/client-project-access")
 	r.Post("/admin/users/client-project-access", adminusers.UpdateClientProjectAccessCommandHandler(s.DB, s.UserCache))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_USERS_CLIENT_EXPORTS_EDIT", http.MethodPost, "/tasker/admin/users/client-exports")
+	r.Post("/admin/users/client-exports", adminusers.UpdateClientExportsCommandHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_USERS_CLIENT_REPLY_EMAIL_EDIT", http.MethodPost, "/tasker/admin/users/client-reply-email")
+	r.Post("/admin/users/client-reply-email", adminusers.UpdateClientReplyEmailCommandHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_USERS_SITES_EDIT", http.MethodPost, "/tasker/admin/users/sites")
+	r.Post("/admin/users/sites", adminusers.UpdateUserSitesCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_USERS_BULK", http.MethodPost, "/tasker/admin/users/bulk")
+	r.Post("/admin/users/bulk", adminusers.BulkUsersCommandHandler(s.DB, s.Audit, s.SessionCache))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_USERS_DISABLE_PROJECT", http.MethodPost, "/tasker/admin/users/disable-project")
+	r.Post("/admin/users/disable-project", adminusers.DisableProjectUsersCommandHandler(s.DB, s.Audit, s.SessionCache))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_USERS_BULK_UNDO", http.MethodPost, "/tasker/admin/users/bulk-changes/*/undo")
+	r.Post("/admin/users/bulk-changes/{id}/undo", adminusers.UndoBulkChangeCommandHandler(s.DB, s.Audit, s.SessionCache))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_USERS_ACCESS_REQUEST_APPROVE", http.MethodPost, "/tasker/admin/users/access-requests/*/approve")
+	r.Post("/admin/users/access-requests/{id}/approve", adminusers.DecideAccessRequestCommandHandler(s.DB, s.Audit, true))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_USERS_ACCESS_REQUEST_DENY", http.MethodPost, "/tasker/admin/users/access-requests/*/deny")
+	r.Post("/admin/users/access-requests/{id}/deny", adminusers.DecideAccessRequestCommandHandler(s.DB, s.Audit, false))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_USERS_PASSWORD_RESET_CANCEL", http.MethodPost, "/tasker/admin/users/password-resets/*/cancel")
+	r.Post("/admin/users/password-resets/{id}/cancel", adminusers.CancelPasswordResetCommandHandler(s.DB, s.Audit))
+
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_DAMAGE_REASONS_VIEW", http.MethodGet, "/tasker/admin/damage-reasons")
+	r.Get("/admin/damage-reasons", admindamagereasons.DamageReasonsPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_DAMAGE_REASONS_CREATE", http.MethodPost, "/tasker/admin/damage-reasons")
+	r.Post("/admin/damage-reasons", admindamagereasons.CreateDamageReasonCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_DAMAGE_REASONS_EDIT", http.MethodPost, "/tasker/admin/damage-reasons/*/update")
+	r.Post("/admin/damage-reasons/{code}/update", admindamagereasons.UpdateDamageReasonCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_HELP_NOTICES_VIEW", http.MethodGet, "/tasker/admin/help")
+	r.Get("/admin/help", adminhelp.HelpNoticesPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_HELP_NOTICES_CREATE", http.MethodPost, "/tasker/admin/help")
+	r.Post("/admin/help", adminhelp.CreateHelpNoticeCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_HELP_NOTICES_EDIT", http.MethodPost, "/tasker/admin/help/*/update")
+	r.Post("/admin/help/{id}/update", adminhelp.UpdateHelpNoticeCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_HELP_NOTICES_DELETE", http.MethodPost, "/tasker/admin/help/*/delete")
+	r.Post("/admin/help/{id}/delete", adminhelp.DeleteHelpNoticeCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_COMMENTS_VIEW", http.MethodGet, "/tasker/admin/comments")
+	r.Get("/admin/comments", admincomments.CommentsPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_COMMENTS_DELETE", http.MethodPost, "/tasker/admin/comments/delete")
+	r.Post("/admin/comments/delete", admincomments.DeleteCommentsCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_NOTIFICATIONS_VIEW", http.MethodGet, "/tasker/admin/notifications")
+	r.Get("/admin/notifications", adminnotifications.NotificationsPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_NOTIFICATIONS_OPEN", http.MethodPost, "/tasker/admin/notifications/*/open")
+	r.Post("/admin/notifications/{id}/open", adminnotifications.OpenNotificationCommandHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_NOTIFICATIONS_READ_ALL", http.MethodPost, "/tasker/admin/notifications/read-all")
+	r.Post("/admin/notifications/read-all", adminnotifications.MarkAllReadCommandHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_API_TOKENS_VIEW", http.MethodGet, "/tasker/admin/api-tokens")
+	r.Get("/admin/api-tokens", adminapitokens.APITokensPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_API_TOKENS_CREATE", http.MethodPost, "/tasker/admin/api-tokens")
+	r.Post("/admin/api-tokens", adminapitokens.IssueAPITokenCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_API_TOKENS_REVOKE", http.MethodPost, "/tasker/admin/api-tokens/*/revoke")
+	r.Post("/admin/api-tokens/{id}/revoke", adminapitokens.RevokeAPITokenCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_EMBEDS_VIEW", http.MethodGet, "/tasker/admin/embeds")
+	r.Get("/admin/embeds", adminembeds.EmbedsPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_EMBEDS_CREATE", http.MethodPost, "/tasker/admin/embeds")
+	r.Post("/admin/embeds", adminembeds.IssueEmbedCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_EMBEDS_REVOKE", http.MethodPost, "/tasker/admin/embeds/*/revoke")
+	r.Post("/admin/embeds/{id}/revoke", adminembeds.RevokeEmbedCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_DELIVERIES_VIEW", http.MethodGet, "/tasker/admin/deliveries")
+	r.Get("/admin/deliveries", admindeliveries.DeliveriesPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_DELIVERIES_DETAIL", http.MethodGet, "/tasker/admin/deliveries/*")
+	r.Get("/admin/deliveries/{id}", admindeliveries.DeliveryDetailPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_DELIVERIES_RETRY", http.MethodPost, "/tasker/admin/deliveries/*/retry")
+	r.Post("/admin/deliveries/{id}/retry", admindeliveries.RetryDeliveryCommandHandler(s.DB, s.Audit, s.Deliveries))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_KIOSKS_VIEW", http.MethodGet, "/tasker/admin/kiosks")
+	r.Get("/admin/kiosks", adminkiosks.KiosksPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_KIOSKS_CREATE", http.MethodPost, "/tasker/admin/kiosks")
+	r.Post("/admin/kiosks", adminkiosks.CreateKioskCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_KIOSKS_REVOKE", http.MethodPost, "/tasker/admin/kiosks/*/revoke")
+	r.Post("/admin/kiosks/{id}/revoke", adminkiosks.RevokeKioskCommandHandler(s.DB, s.Audit, s.SessionCache))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_KIOSKS_PIN_EDIT", http.MethodPost, "/tasker/admin/kiosks/pins/*")
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_KIOSKS_SITE_EDIT", http.MethodPost, "/tasker/admin/kiosks/*/site")
+	r.Post("/admin/kiosks/{id}/site", adminkiosks.SetKioskSiteCommandHandler(s.DB, s.Audit))
+	r.Post("/admin/kiosks/pins/{id}", adminkiosks.SetPINCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_SITES_VIEW", http.MethodGet, "/tasker/admin/sites")
+	r.Get("/admin/sites", adminsites.SitesPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_SITES_CREATE", http.MethodPost, "/tasker/admin/sites")
+	r.Post("/admin/sites", adminsites.CreateSiteCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_SITES_EDIT", http.MethodPost, "/tasker/admin/sites/*/update")
+	r.Post("/admin/sites/{id}/update", adminsites.UpdateSiteCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_SITE_FLOOR_MAP_VIEW", http.MethodGet, "/tasker/admin/sites/*/floor-map")
+	r.Get("/admin/sites/{id}/floor-map", adminsites.FloorMapPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_SITE_FLOOR_MAP_EDIT", http.MethodPost, "/tasker/admin/sites/*/floor-map")
+	r.Post("/admin/sites/{id}/floor-map", adminsites.ConfigureFloorMapCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_SITE_FLOOR_MAP_EDIT", http.MethodPost, "/tasker/admin/sites/*/floor-map/zones")
+	r.Post("/admin/sites/{id}/floor-map/zones", adminsites.AddFloorMapZoneCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_SITE_FLOOR_MAP_EDIT", http.MethodPost, "/tasker/admin/sites/*/floor-map/zones/*/delete")
+	r.Post("/admin/sites/{id}/floor-map/zones/{zoneID}/delete", adminsites.DeleteFloorMapZoneCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_SITE_FLOOR_MAP_PLACE", http.MethodPost, "/tasker/admin/sites/*/floor-map/locations")
+	r.Post("/admin/sites/{id}/floor-map/locations", adminsites.PlacePalletCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_SITE_FLOOR_MAP_PLACE", http.MethodPost, "/tasker/admin/sites/*/floor-map/locations/*/delete")
+	r.Post("/admin/sites/{id}/floor-map/locations/{palletID}/delete", adminsites.RemovePalletLocationCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "SITE_SWITCH", http.MethodPost, "/tasker/sites/switch")
+	r.Post("/sites/switch", adminsites.SwitchSiteCommandHandler(s.DB, s.SessionCache))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_STORAGE_VIEW", http.MethodGet, "/tasker/admin/storage")
+	r.Get("/admin/storage", adminstorage.StoragePageQueryHandler(s.DB, s.ColdStorage))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_STORAGE_PHOTOS_COMPRESS", http.MethodPost, "/tasker/admin/storage/compress")
+	r.Post("/admin/storage/compress", adminstorage.CompressPhotosCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_STORAGE_PHOTOS_PRUNE", http.MethodPost, "/tasker/admin/storage/prune")
+	r.Post("/admin/storage/prune", adminstorage.PrunePhotosCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_STORAGE_VACUUM", http.MethodPost, "/tasker/admin/storage/vacuum")
+	r.Post("/admin/storage/vacuum", adminstorage.VacuumCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_STORAGE_COLD_ARCHIVE", http.MethodPost, "/tasker/admin/storage/cold/archive")
+	r.Post("/admin/storage/cold/archive", adminstorage.ArchiveProjectCommandHandler(s.ColdStorage))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_STORAGE_COLD_REHYDRATE", http.MethodPost, "/tasker/admin/storage/cold/rehydrate")
+	r.Post("/admin/storage/cold/rehydrate", adminstorage.RehydrateProjectCommandHandler(s.ColdStorage))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_HEALTH_VIEW", http.MethodGet, "/tasker/admin/health")
+	r.Get("/admin/health", adminhealth.HealthPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_HEALTH_RUN", http.MethodPost, "/tasker/admin/health/run")
+	r.Post("/admin/health/run", adminhealth.RunChecksCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_SYSTEM_VIEW", http.MethodGet, "/tasker/admin/system")
+	r.Get("/admin/system", adminsystem.SystemPageQueryHandler(s.Schema, s.Maintenance, s.RateLimit, s.LabelRenders))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_SYSTEM_MIGRATIONS_RETRY", http.MethodPost, "/tasker/admin/system/migrations/retry")
+	r.Post("/admin/system/migrations/retry", adminsystem.RetryMigrationsCommandHandler(s.DB, s.Audit, s.Schema))
+	s.Rbac.Add(rbac.RoleAdmin, "ADMIN_SYSTEM_MAINTENANCE", http.MethodPost, "/tasker/admin/system/maintenance")
+	r.Post("/admin/system/maintenance", adminsystem.MaintenanceCommandHandler(s.Audit, s.Maintenance))
 	return r
 }
 
@@ -54,16 +317,44 @@ func (s *Server) RegisterFrontendRoutes(r chi.Router) chi.Router {
 	s.RegisterPalletRoutes(r)
 	s.RegisterStockRoutes(r)
 	s.RegisterExportRoutes(r)
+	s.RegisterBookingRoutes(r)
 
 	s.Rbac.Add(rbac.RoleAdmin, "HELP_VIEW", http.MethodGet, "/tasker/help")
 	s.Rbac.Add(rbac.RoleScanner, "HELP_VIEW", http.MethodGet, "/tasker/help")
 	s.Rbac.Add(rbac.RoleClient, "HELP_VIEW", http.MethodGet, "/tasker/help")
-	r.Get("/help", helppage.HelpPageQueryHandler())
+	r.Get("/help", helppage.HelpPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "HELP_NOTICE_DISMISS", http.MethodPost, "/tasker/help/notices/*/dismiss")
+	s.Rbac.Add(rbac.RoleScanner, "HELP_NOTICE_DISMISS", http.MethodPost, "/tasker/help/notices/*/dismiss")
+	s.Rbac.Add(rbac.RoleKiosk, "HELP_NOTICE_DISMISS", http.MethodPost, "/tasker/help/notices/*/dismiss")
+	r.Post("/help/notices/{id}/dismiss", helppage.DismissNoticeCommandHandler(s.DB))
+
+	s.Rbac.Add(rbac.RoleClient, "CLIENT_ACCESS_REQUESTS_VIEW", http.MethodGet, "/tasker/access-requests")
+	r.Get("/access-requests", accessrequests.AccessRequestsPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleClient, "CLIENT_ACCESS_REQUESTS_CREATE", http.MethodPost, "/tasker/access-requests")
+	r.Post("/access-requests", accessrequests.CreateAccessRequestCommandHandler(s.DB, s.Audit))
 
 	s.Rbac.Add(rbac.RoleAdmin, "SETTINGS_NOTIFICATIONS_VIEW", http.MethodGet, "/tasker/settings/notifications")
 	r.Get("/settings/notifications", settings.NotificationSettingsPageHandler(s.DB))
 	s.Rbac.Add(rbac.RoleAdmin, "SETTINGS_NOTIFICATIONS_EDIT", http.MethodPost, "/tasker/settings/notifications")
 	r.Post("/settings/notifications", settings.NotificationSettingsUpdateHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "SETTINGS_PREFERENCES_VIEW", http.MethodGet, "/tasker/settings/preferences")
+	s.Rbac.Add(rbac.RoleScanner, "SETTINGS_PREFERENCES_VIEW", http.MethodGet, "/tasker/settings/preferences")
+	s.Rbac.Add(rbac.RoleClient, "SETTINGS_PREFERENCES_VIEW", http.MethodGet, "/tasker/settings/preferences")
+	r.Get("/settings/preferences", settings.PreferencesPageHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "SETTINGS_PREFERENCES_EDIT", http.MethodPost, "/tasker/settings/preferences")
+	s.Rbac.Add(rbac.RoleScanner, "SETTINGS_PREFERENCES_EDIT", http.MethodPost, "/tasker/settings/preferences")
+	s.Rbac.Add(rbac.RoleClient, "SETTINGS_PREFERENCES_EDIT", http.MethodPost, "/tasker/settings/preferences")
+	r.Post("/settings/preferences", settings.UpdatePreferencesHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "SETTINGS_COLUMNS_EDIT", http.MethodPost, "/tasker/settings/columns")
+	s.Rbac.Add(rbac.RoleScanner, "SETTINGS_COLUMNS_EDIT", http.MethodPost, "/tasker/settings/columns")
+	s.Rbac.Add(rbac.RoleClient, "SETTINGS_COLUMNS_EDIT", http.MethodPost, "/tasker/settings/columns")
+	r.Post("/settings/columns", settings.SaveColumnsHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "SETTINGS_LANDING_VIEW", http.MethodGet, "/tasker/settings/landing")
+	r.Get("/settings/landing", settings.LandingSettingsPageHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "SETTINGS_LANDING_ROLE_EDIT", http.MethodPost, "/tasker/settings/landing/roles/*")
+	r.Post("/settings/landing/roles/{role}", settings.UpdateRoleLandingHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "SETTINGS_LANDING_USER_EDIT", http.MethodPost, "/tasker/settings/landing/users/*")
+	r.Post("/settings/landing/users/{id}", settings.UpdateUserLandingHandler(s.DB, s.Audit))
 
 	return r
 }
@@ -71,6 +362,8 @@ func (s *Server) RegisterFrontendRoutes(r chi.Router) chi.Router {
 func (s *Server) RegisterPalletRoutes(r chi.Router) {
 	s.Rbac.Add(rbac.RoleScanner, "PALLET_PROGRESS_VIEW", http.MethodGet, "/tasker/pallets/progress")
 	r.Get("/pallets/progress", palletprogress.ProgressPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleScanner, "PALLET_CALENDAR_VIEW", http.MethodGet, "/tasker/pallets/calendar")
+	r.Get("/pallets/calendar", palletprogress.CalendarPageQueryHandler(s.DB))
 	s.Rbac.Add(rbac.RoleAdmin, "SKU_VIEW", http.MethodGet, "/tasker/pallets/sku-view")
 	s.Rbac.Add(rbac.RoleScanner, "SKU_VIEW", http.MethodGet, "/tasker/pallets/sku-view")
 	s.Rbac.Add(rbac.RoleClient, "SKU_VIEW", http.MethodGet, "/tasker/pallets/sku-view")
@@ -78,7 +371,18 @@ func (s *Server) RegisterPalletRoutes(r chi.Router) {
 	s.Rbac.Add(rbac.RoleAdmin, "SKU_DETAIL_VIEW", http.MethodGet, "/tasker/pallets/sku-view/detail")
 	s.Rbac.Add(rbac.RoleScanner, "SKU_DETAIL_VIEW", http.MethodGet, "/tasker/pallets/sku-view/detail")
 	s.Rbac.Add(rbac.RoleClient, "SKU_DETAIL_VIEW", http.MethodGet, "/tasker/pallets/sku-view/detail")
-	r.Get("/pallets/sku-view/detail", palletprogress.SKUDetailPageQueryHandler(s.DB))
+	r.Get("/pallets/sku-view/detail", palletprogress.SKUDetailPageQueryHandler(s.DB, s.ReplyMail))
+	s.Rbac.Add(rbac.RoleAdmin, "SKU_DETAIL_PHOTOS_VIEW", http.MethodGet, "/tasker/pallets/sku-view/detail/photos")
+	s.Rbac.Add(rbac.RoleScanner, "SKU_DETAIL_PHOTOS_VIEW", http.MethodGet, "/tasker/pallets/sku-view/detail/photos")
+	s.Rbac.Add(rbac.RoleClient, "SKU_DETAIL_PHOTOS_VIEW", http.MethodGet, "/tasker/pallets/sku-view/detail/photos")
+	r.Get("/pallets/sku-view/detail/photos", palletprogress.SKUPhotoGalleryFragmentQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "SKU_DETAIL_TREND_VIEW", http.MethodGet, "/tasker/pallets/sku-view/detail/trend.json")
+	s.Rbac.Add(rbac.RoleScanner, "SKU_DETAIL_TREND_VIEW", http.MethodGet, "/tasker/pallets/sku-view/detail/trend.json")
+	s.Rbac.Add(rbac.RoleClient, "SKU_DETAIL_TREND_VIEW", http.MethodGet, "/tasker/pallets/sku-view/detail/trend.json")
+	r.Get("/pallets/sku-view/detail/trend.json", palletprogress.SKUTrendJSONHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "SKU_DETAIL_PHOTOS_EXPORT", http.MethodGet, "/tasker/pallets/sku-view/detail/photos.zip")
+	s.Rbac.Add(rbac.RoleClient, "SKU_DETAIL_PHOTOS_EXPORT", http.MethodGet, "/tasker/pallets/sku-view/detail/photos.zip")
+	r.Get("/pallets/sku-view/detail/photos.zip", palletprogress.SKUPhotosZIPHandler(s.DB))
 	s.Rbac.Add(rbac.RoleAdmin, "SKU_SUMMARY_EXPORT", http.MethodGet, "/tasker/pallets/sku-view/export-summary.csv")
 	s.Rbac.Add(rbac.RoleClient, "SKU_SUMMARY_EXPORT", http.MethodGet, "/tasker/pallets/sku-view/export-summary.csv")
 	r.Get("/pallets/sku-view/export-summary.csv", palletprogress.SKUSummaryCSVHandler(s.DB))
@@ -87,20 +391,40 @@ func (s *Server) RegisterPalletRoutes(r chi.Router) {
 	r.Get("/pallets/sku-view/export-detail.csv", palletprogress.SKUDetailedCSVHandler(s.DB))
 	s.Rbac.Add(rbac.RoleClient, "SKU_CLIENT_COMMENT_CREATE", http.MethodPost, "/tasker/pallets/sku-view/detail/comment")
 	r.Post("/pallets/sku-view/detail/comment", palletprogress.CreateSKUClientCommentHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "UNKNOWN_SKU_QUEUE_VIEW", http.MethodGet, "/tasker/pallets/unknown-skus")
+	r.Get("/pallets/unknown-skus", palletunknownsku.UnknownSKUQueuePageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "UNKNOWN_SKU_RESOLVE", http.MethodPost, "/tasker/pallets/unknown-skus/*/resolve")
+	r.Post("/pallets/unknown-skus/{receiptID}/resolve", palletunknownsku.ResolveUnknownSKUCommandHandler(s.DB, s.Audit))
 
 	s.Rbac.Add(rbac.RoleAdmin, "PALLET_CREATE", http.MethodPost, "/tasker/pallets/new")
 	r.Post("/pallets/new", palletlabels.NewPalletCommandHandler(s.DB, s.Audit))
 	s.Rbac.Add(rbac.RoleAdmin, "PALLET_CREATE_BULK", http.MethodPost, "/tasker/pallets/new/bulk")
-	r.Post("/pallets/new/bulk", palletlabels.NewPalletBulkCommandHandler(s.DB, s.Audit))
+	r.Post("/pallets/new/bulk", palletlabels.NewPalletBulkCommandHandler(s.DB, s.Audit, s.LabelRenders))
 
 	s.Rbac.Add(rbac.RoleAdmin, "PALLET_LABEL_VIEW", http.MethodGet, "/tasker/pallets/*/label")
-	r.Get("/pallets/{id}/label", palletlabels.PalletLabelPageQueryHandler(s.DB))
+	r.Get("/pallets/{id}/label", palletlabels.PalletLabelPageQueryHandler(s.DB, s.LabelRenders))
+	s.Rbac.Add(rbac.RoleAdmin, "PALLET_LABEL_INSTANCES_VIEW", http.MethodGet, "/tasker/pallets/*/labels")
+	r.Get("/pallets/{id}/labels", palletlabels.PalletLabelInstancesPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PALLET_LABEL_VOID", http.MethodPost, "/tasker/pallets/*/labels/*/void")
+	r.Post("/pallets/{id}/labels/{serial}/void", palletlabels.VoidPalletLabelCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PALLET_LABEL_REISSUE", http.MethodPost, "/tasker/pallets/*/labels/reissue")
+	r.Post("/pallets/{id}/labels/reissue", palletlabels.ReissuePalletLabelCommandHandler(s.DB, s.Audit))
 	s.Rbac.Add(rbac.RoleAdmin, "PALLET_CLOSED_LABEL_VIEW", http.MethodGet, "/tasker/pallets/*/closed-label")
 	s.Rbac.Add(rbac.RoleScanner, "PALLET_CLOSED_LABEL_VIEW", http.MethodGet, "/tasker/pallets/*/closed-label")
-	r.Get("/pallets/{id}/closed-label", palletlabels.ClosedPalletLabelPDFQueryHandler(s.DB, s.Audit))
+	r.Get("/pallets/{id}/closed-label", palletlabels.ClosedPalletLabelPreviewPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PALLET_CLOSED_LABEL_PRINT", http.MethodPost, "/tasker/pallets/*/closed-label/print")
+	s.Rbac.Add(rbac.RoleScanner, "PALLET_CLOSED_LABEL_PRINT", http.MethodPost, "/tasker/pallets/*/closed-label/print")
+	r.Post("/pallets/{id}/closed-label/print", palletlabels.PrintClosedPalletLabelCommandHandler(s.DB, s.SessionCache, s.Audit, s.Deliveries, s.LabelRenders))
+	s.Rbac.Add(rbac.RoleAdmin, "PALLET_CLOSED_LABEL_BATCH_PRINT", http.MethodPost, "/tasker/pallets/closed-labels/print")
+	s.Rbac.Add(rbac.RoleScanner, "PALLET_CLOSED_LABEL_BATCH_PRINT", http.MethodPost, "/tasker/pallets/closed-labels/print")
+	r.Post("/pallets/closed-labels/print", palletlabels.PrintClosedPalletLabelsBatchCommandHandler(s.DB, s.SessionCache, s.Audit, s.Deliveries, s.LabelRenders))
 
 	s.Rbac.Add(rbac.RoleScanner, "PALLET_SCAN_VIEW", http.MethodGet, "/tasker/scan/pallet")
+	s.Rbac.Add(rbac.RoleKiosk, "PALLET_SCAN_VIEW", http.MethodGet, "/tasker/scan/pallet")
 	r.Get("/scan/pallet", palletlabels.ScanPalletPageQueryHandler())
+	s.Rbac.Add(rbac.RoleScanner, "PALLET_SCAN_LOOKUP", http.MethodGet, "/tasker/scan/pallet/lookup")
+	s.Rbac.Add(rbac.RoleKiosk, "PALLET_SCAN_LOOKUP", http.MethodGet, "/tasker/scan/pallet/lookup")
+	r.Get("/scan/pallet/lookup", palletlabels.PalletLookupQueryHandler(s.DB))
 
 	s.Rbac.Add(rbac.RoleAdmin, "PALLET_CONTENT_LABEL_VIEW", http.MethodGet, "/tasker/pallets/*/content-label")
 	s.Rbac.Add(rbac.RoleScanner, "PALLET_CONTENT_LABEL_VIEW", http.MethodGet, "/tasker/pallets/*/content-label")
@@ -110,9 +434,39 @@ func (s *Server) RegisterPalletRoutes(r chi.Router) {
 	s.Rbac.Add(rbac.RoleScanner, "PALLET_CONTENT_LINE_VIEW", http.MethodGet, "/tasker/pallets/*/content-line/*")
 	s.Rbac.Add(rbac.RoleClient, "PALLET_CONTENT_LINE_VIEW", http.MethodGet, "/tasker/pallets/*/content-line/*")
 	r.Get("/pallets/{id}/content-line/{receiptID}", palletlabels.PalletContentLineDetailPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PALLET_CONTENT_LINE_PHOTO_VISIBILITY", http.MethodPost, "/tasker/pallets/*/content-line/*/photo-visibility")
+	s.Rbac.Add(rbac.RoleScanner, "PALLET_CONTENT_LINE_PHOTO_VISIBILITY", http.MethodPost, "/tasker/pallets/*/content-line/*/photo-visibility")
+	r.Post("/pallets/{id}/content-line/{receiptID}/photo-visibility", palletlabels.SetContentLinePhotoVisibilityCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PALLET_TRANSFER_VIEW", http.MethodGet, "/tasker/pallets/*/transfer")
+	r.Get("/pallets/{id}/transfer", pallettransfer.TransferPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PALLET_TRANSFER", http.MethodPost, "/tasker/pallets/*/transfer")
+	r.Post("/pallets/{id}/transfer", pallettransfer.TransferCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PALLET_MOVE_VIEW", http.MethodGet, "/tasker/pallets/*/move")
+	r.Get("/pallets/{id}/move", palletmove.MovePageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PALLET_MOVE", http.MethodPost, "/tasker/pallets/*/move")
+	r.Post("/pallets/{id}/move", palletmove.MoveCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PALLET_SCANNED_BY_VIEW", http.MethodGet, "/tasker/pallets/*/scanned-by")
+	r.Get("/pallets/{id}/scanned-by", palletattribution.ScannedByPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PALLET_SCANNED_BY_REASSIGN", http.MethodPost, "/tasker/pallets/*/scanned-by")
+	r.Post("/pallets/{id}/scanned-by", palletattribution.ReassignScannedByCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "PALLET_CUSTODY_EXPORT", http.MethodGet, "/tasker/pallets/*/custody.pdf")
+	r.Get("/pallets/{id}/custody.pdf", palletlabels.PalletCustodyPDFHandler(s.DB))
 
 	s.Rbac.Add(rbac.RoleScanner, "PALLET_RECEIPT_VIEW", http.MethodGet, "/tasker/pallets/*/receipt")
+	s.Rbac.Add(rbac.RoleKiosk, "PALLET_RECEIPT_VIEW", http.MethodGet, "/tasker/pallets/*/receipt")
 	r.Get("/pallets/{id}/receipt", palletreceipt.ReceiptPageQueryHandler(s.DB, s.SessionCache))
+	s.Rbac.Add(rbac.RoleAdmin, "PALLET_RECEIPT_PHOTOS_REDACT_VIEW", http.MethodGet, "/tasker/pallets/*/receipts/*/photos/redact")
+	r.Get("/pallets/{id}/receipts/{receiptID}/photos/redact", palletreceipt.RedactPhotosPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PALLET_RECEIPT_PHOTOS_REDACT", http.MethodPost, "/tasker/pallets/*/receipts/*/photos/redact")
+	r.Post("/pallets/{id}/receipts/{receiptID}/photos/redact", palletreceipt.RedactPhotoCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleScanner, "PALLET_RECEIPT_LAYOUT_EDIT", http.MethodPost, "/tasker/pallets/*/receipt/layout")
+	s.Rbac.Add(rbac.RoleKiosk, "PALLET_RECEIPT_LAYOUT_EDIT", http.MethodPost, "/tasker/pallets/*/receipt/layout")
+	r.Post("/pallets/{id}/receipt/layout", palletreceipt.ReceiptLayoutCommandHandler())
+	s.Rbac.Add(rbac.RoleScanner, "PALLET_RECEIPT_LIVE", http.MethodGet, "/tasker/pallets/*/receipt/live")
+	s.Rbac.Add(rbac.RoleKiosk, "PALLET_RECEIPT_LIVE", http.MethodGet, "/tasker/pallets/*/receipt/live")
+	r.Get("/pallets/{id}/receipt/live", palletreceipt.ReceiptLiveStreamQueryHandler(s.DB, s.Live))
+	s.Rbac.Add(rbac.RoleScanner, "PALLET_MY_CAPTURES_EXPORT", http.MethodGet, "/tasker/pallets/my-captures.csv")
+	r.Get("/pallets/my-captures.csv", exportspage.MyCapturesCSVHandler(s.DB))
 	s.Rbac.Add(rbac.RoleAdmin, "PALLET_ITEM_UPLOAD_TEMPLATE_BULK_EXPORT", http.MethodGet, "/tasker/pallets/item-upload.csv")
 	s.Rbac.Add(rbac.RoleScanner, "PALLET_ITEM_UPLOAD_TEMPLATE_BULK_EXPORT", http.MethodGet, "/tasker/pallets/item-upload.csv")
 	r.Get("/pallets/item-upload.csv", palletreceipt.BulkItemUploadCSVTemplateHandler(s.DB))
@@ -125,33 +479,65 @@ func (s *Server) RegisterPalletRoutes(r chi.Router) {
 	r.Get("/pallets/{id}/receipt-upload.csv", palletreceipt.ReceiptUploadCSVTemplateHandler(s.DB))
 
 	s.Rbac.Add(rbac.RoleScanner, "PALLET_RECEIPT_CREATE", http.MethodPost, "/tasker/api/pallets/*/receipts")
-	r.Post("/api/pallets/{id}/receipts", palletreceipt.CreateReceiptCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleKiosk, "PALLET_RECEIPT_CREATE", http.MethodPost, "/tasker/api/pallets/*/receipts")
+	r.Post("/api/pallets/{id}/receipts", palletreceipt.CreateReceiptCommandHandler(s.DB, s.Audit, s.Live))
+	s.Rbac.Add(rbac.RoleScanner, "PALLET_RECEIPT_VALIDATE", http.MethodPost, "/tasker/api/pallets/*/receipts/validate")
+	s.Rbac.Add(rbac.RoleKiosk, "PALLET_RECEIPT_VALIDATE", http.MethodPost, "/tasker/api/pallets/*/receipts/validate")
+	r.Post("/api/pallets/{id}/receipts/validate", palletreceipt.ValidateReceiptCommandHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PALLET_RECEIPT_IMPORT", http.MethodPost, "/tasker/api/pallets/*/receipts/import")
+	r.Post("/api/pallets/{id}/receipts/import", palletreceipt.ImportReceiptLinesCommandHandler(s.DB, s.Audit, s.Live))
 	s.Rbac.Add(rbac.RoleScanner, "PALLET_RECEIPT_UPDATE", http.MethodPost, "/tasker/api/pallets/*/receipts/*/update")
-	r.Post("/api/pallets/{id}/receipts/{receiptID}/update", palletreceipt.UpdateReceiptLineCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleKiosk, "PALLET_RECEIPT_UPDATE", http.MethodPost, "/tasker/api/pallets/*/receipts/*/update")
+	r.Post("/api/pallets/{id}/receipts/{receiptID}/update", palletreceipt.UpdateReceiptLineCommandHandler(s.DB, s.Audit, s.Live))
 	s.Rbac.Add(rbac.RoleScanner, "PALLET_RECEIPT_DELETE", http.MethodPost, "/tasker/api/pallets/*/receipts/*/delete")
-	r.Post("/api/pallets/{id}/receipts/{receiptID}/delete", palletreceipt.DeleteReceiptLineCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleKiosk, "PALLET_RECEIPT_DELETE", http.MethodPost, "/tasker/api/pallets/*/receipts/*/delete")
+	r.Post("/api/pallets/{id}/receipts/{receiptID}/delete", palletreceipt.DeleteReceiptLineCommandHandler(s.DB, s.Audit, s.Live))
 
 	s.Rbac.Add(rbac.RoleScanner, "PALLET_RECEIPT_PHOTO_VIEW", http.MethodGet, "/tasker/api/pallets/*/receipts/*/photo")
+	s.Rbac.Add(rbac.RoleKiosk, "PALLET_RECEIPT_PHOTO_VIEW", http.MethodGet, "/tasker/api/pallets/*/receipts/*/photo")
 	s.Rbac.Add(rbac.RoleClient, "PALLET_RECEIPT_PHOTO_VIEW", http.MethodGet, "/tasker/api/pallets/*/receipts/*/photo")
 	r.Get("/api/pallets/{id}/receipts/{receiptID}/photo", palletreceipt.ReceiptPhotoQueryHandler(s.DB))
 
 	s.Rbac.Add(rbac.RoleScanner, "PALLET_RECEIPT_PHOTOS_VIEW", http.MethodGet, "/tasker/api/pallets/*/receipts/*/photos/*")
+	s.Rbac.Add(rbac.RoleKiosk, "PALLET_RECEIPT_PHOTOS_VIEW", http.MethodGet, "/tasker/api/pallets/*/receipts/*/photos/*")
 	s.Rbac.Add(rbac.RoleClient, "PALLET_RECEIPT_PHOTOS_VIEW", http.MethodGet, "/tasker/api/pallets/*/receipts/*/photos/*")
 	r.Get("/api/pallets/{id}/receipts/{receiptID}/photos/{photoID}", palletreceipt.ReceiptPhotosHandler(s.DB))
 
+	s.Rbac.Add(rbac.RoleScanner, "PALLET_RECEIPT_PHOTO_UPLOAD_STATUS", http.MethodGet, "/tasker/api/pallets/*/receipts/*/photo-uploads/*")
+	s.Rbac.Add(rbac.RoleKiosk, "PALLET_RECEIPT_PHOTO_UPLOAD_STATUS", http.MethodGet, "/tasker/api/pallets/*/receipts/*/photo-uploads/*")
+	r.Get("/api/pallets/{id}/receipts/{receiptID}/photo-uploads/{uploadID}", palletreceipt.PhotoUploadStatusQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleScanner, "PALLET_RECEIPT_PHOTO_UPLOAD_CHUNK", http.MethodPut, "/tasker/api/pallets/*/receipts/*/photo-uploads/*")
+	s.Rbac.Add(rbac.RoleKiosk, "PALLET_RECEIPT_PHOTO_UPLOAD_CHUNK", http.MethodPut, "/tasker/api/pallets/*/receipts/*/photo-uploads/*")
+	r.Put("/api/pallets/{id}/receipts/{receiptID}/photo-uploads/{uploadID}", palletreceipt.PhotoUploadChunkCommandHandler(s.DB, s.PhotoUploads))
+
+	s.Rbac.Add(rbac.RoleAdmin, "PALLET_VERIFY_VIEW", http.MethodGet, "/tasker/pallets/*/verify")
+	s.Rbac.Add(rbac.RoleScanner, "PALLET_VERIFY_VIEW", http.MethodGet, "/tasker/pallets/*/verify")
+	s.Rbac.Add(rbac.RoleKiosk, "PALLET_VERIFY_VIEW", http.MethodGet, "/tasker/pallets/*/verify")
+	r.Get("/pallets/{id}/verify", palletprogress.VerifyPalletPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "PALLET_VERIFY_SCAN", http.MethodPost, "/tasker/pallets/*/verify")
+	s.Rbac.Add(rbac.RoleScanner, "PALLET_VERIFY_SCAN", http.MethodPost, "/tasker/pallets/*/verify")
+	s.Rbac.Add(rbac.RoleKiosk, "PALLET_VERIFY_SCAN", http.MethodPost, "/tasker/pallets/*/verify")
+	r.Post("/pallets/{id}/verify", palletprogress.VerifyPalletScanCommandHandler(s.DB))
+
 	s.Rbac.Add(rbac.RoleAdmin, "PALLET_CLOSE", http.MethodPost, "/tasker/api/pallets/*/close")
 	s.Rbac.Add(rbac.RoleScanner, "PALLET_CLOSE", http.MethodPost, "/tasker/api/pallets/*/close")
-	r.Post("/api/pallets/{id}/close", palletprogress.ClosePalletCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleKiosk, "PALLET_CLOSE", http.MethodPost, "/tasker/api/pallets/*/close")
+	r.Post("/api/pallets/{id}/close", palletprogress.ClosePalletCommandHandler(s.DB, s.Audit, s.Deliveries))
 
 	s.Rbac.Add(rbac.RoleAdmin, "PALLET_REOPEN", http.MethodPost, "/tasker/api/pallets/*/reopen")
-	r.Post("/api/pallets/{id}/reopen", palletprogress.ReopenPalletCommandHandler(s.DB, s.Audit))
+	r.Post("/api/pallets/{id}/reopen", palletprogress.ReopenPalletCommandHandler(s.DB, s.Audit, s.Deliveries))
 	s.Rbac.Add(rbac.RoleAdmin, "PALLET_CANCEL", http.MethodPost, "/tasker/api/pallets/*/cancel")
-	r.Post("/api/pallets/{id}/cancel", palletprogress.CancelPalletCommandHandler(s.DB, s.Audit))
+	r.Post("/api/pallets/{id}/cancel", palletprogress.CancelPalletCommandHandler(s.DB, s.SessionCache, s.Audit, s.Deliveries))
 
 	s.Rbac.Add(rbac.RoleScanner, "STOCK_SEARCH", http.MethodGet, "/tasker/api/stock/search")
+	s.Rbac.Add(rbac.RoleKiosk, "STOCK_SEARCH", http.MethodGet, "/tasker/api/stock/search")
 	r.Get("/api/stock/search", palletreceipt.SearchStockQueryHandler(s.DB))
 	s.Rbac.Add(rbac.RoleScanner, "STOCK_SEARCH_OPTIONS", http.MethodGet, "/tasker/api/stock/search/options")
+	s.Rbac.Add(rbac.RoleKiosk, "STOCK_SEARCH_OPTIONS", http.MethodGet, "/tasker/api/stock/search/options")
 	r.Get("/api/stock/search/options", palletreceipt.SearchStockOptionsQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleScanner, "STOCK_BATCH_OPTIONS", http.MethodGet, "/tasker/api/stock/batches/options")
+	s.Rbac.Add(rbac.RoleKiosk, "STOCK_BATCH_OPTIONS", http.MethodGet, "/tasker/api/stock/batches/options")
+	r.Get("/api/stock/batches/options", palletreceipt.SearchBatchOptionsQueryHandler(s.DB))
 }
 
 func (s *Server) RegisterStockRoutes(r chi.Router) {
@@ -166,6 +552,35 @@ func (s *Server) RegisterStockRoutes(r chi.Router) {
 
 	s.Rbac.Add(rbac.RoleAdmin, "STOCK_DELETE_ONE", http.MethodPost, "/tasker/stock/delete/*")
 	r.Post("/stock/delete/{id}", stock.StockDeleteItemCommandHandler(s.DB, s.Audit))
+
+	s.Rbac.Add(rbac.RoleAdmin, "STOCK_HIGH_VALUE_EDIT", http.MethodPost, "/tasker/stock/*/high-value")
+	r.Post("/stock/{id}/high-value", stock.StockHighValueCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "STOCK_SERIAL_TRACKED_EDIT", http.MethodPost, "/tasker/stock/*/serial-tracked")
+	r.Post("/stock/{id}/serial-tracked", stock.StockSerialTrackedCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "STOCK_MERGE", http.MethodPost, "/tasker/stock/merge")
+	r.Post("/stock/merge", stock.StockMergeCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "STOCK_MERGE_UNDO", http.MethodPost, "/tasker/stock/merges/*/undo")
+	r.Post("/stock/merges/{id}/undo", stock.StockMergeUndoCommandHandler(s.DB, s.Audit))
+}
+
+// RegisterBookingRoutes registers delivery slot booking for admins and the
+// gatehouse check-in screen.
+func (s *Server) RegisterBookingRoutes(r chi.Router) {
+	s.Rbac.Add(rbac.RoleAdmin, "BOOKINGS_VIEW", http.MethodGet, "/tasker/bookings")
+	r.Get("/bookings", bookingspage.BookingsPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "BOOKINGS_CREATE", http.MethodPost, "/tasker/bookings")
+	r.Post("/bookings", bookingspage.CreateBookingCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "BOOKINGS_CANCEL", http.MethodPost, "/tasker/bookings/*/cancel")
+	r.Post("/bookings/{id}/cancel", bookingspage.CancelBookingCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "BOOKING_SLOTS_CREATE", http.MethodPost, "/tasker/bookings/slots")
+	r.Post("/bookings/slots", bookingspage.CreateSlotCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "BOOKING_SLOTS_DELETE", http.MethodPost, "/tasker/bookings/slots/*/delete")
+	r.Post("/bookings/slots/{id}/delete", bookingspage.DeleteSlotCommandHandler(s.DB, s.Audit))
+
+	s.Rbac.Add(rbac.RoleScanner, "GATEHOUSE_VIEW", http.MethodGet, "/tasker/gatehouse")
+	r.Get("/gatehouse", bookingspage.GatehousePageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleScanner, "GATEHOUSE_CHECK_IN", http.MethodPost, "/tasker/gatehouse/*/check-in")
+	r.Post("/gatehouse/{id}/check-in", bookingspage.CheckInCommandHandler(s.DB, s.Audit))
 }
 
 func (s *Server) RegisterExportRoutes(r chi.Router) {
@@ -174,10 +589,34 @@ func (s *Server) RegisterExportRoutes(r chi.Router) {
 
 	s.Rbac.Add(rbac.RoleAdmin, "EXPORT_PALLET", http.MethodGet, "/tasker/exports/pallet/*")
 	r.Get("/exports/pallet/{id}.csv", exportspage.PalletExportCSVHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "EXPORT_PALLET_BUNDLE", http.MethodPost, "/tasker/exports/pallet/*/bundle")
+	r.Post("/exports/pallet/{id}/bundle", exportspage.QueuePalletBundleCommandHandler(s.DB, s.ExportJobs))
+	s.Rbac.Add(rbac.RoleAdmin, "EXPORT_PROJECT_BUNDLE", http.MethodPost, "/tasker/exports/project-bundle")
+	r.Post("/exports/project-bundle", exportspage.QueueProjectBundleCommandHandler(s.DB, s.ExportJobs))
+	s.Rbac.Add(rbac.RoleAdmin, "EXPORT_JOB_DOWNLOAD", http.MethodGet, "/tasker/exports/jobs/*/download")
+	r.Get("/exports/jobs/{id}/download", exportspage.ExportJobDownloadHandler(s.DB))
 
 	s.Rbac.Add(rbac.RoleAdmin, "EXPORT_RECEIPTS", http.MethodGet, "/tasker/exports/receipts.csv")
 	r.Get("/exports/receipts.csv", exportspage.ReceiptsExportCSVHandler(s.DB))
 
 	s.Rbac.Add(rbac.RoleAdmin, "EXPORT_STATUS", http.MethodGet, "/tasker/exports/pallet-status.csv")
 	r.Get("/exports/pallet-status.csv", exportspage.PalletStatusCSVHandler(s.DB))
+
+	s.Rbac.Add(rbac.RoleAdmin, "EXPORT_RUNS_VIEW", http.MethodGet, "/tasker/exports/runs")
+	r.Get("/exports/runs", exportspage.ExportRunsPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "EXPORT_RUN_DETAIL_VIEW", http.MethodGet, "/tasker/exports/runs/*")
+	r.Get("/exports/runs/{id}", exportspage.ExportRunDetailPageQueryHandler(s.DB))
+	s.Rbac.Add(rbac.RoleAdmin, "EXPORT_RUN_DOWNLOAD", http.MethodGet, "/tasker/exports/runs/*/download")
+	r.Get("/exports/runs/{id}/download", exportspage.ExportRunDownloadHandler(s.DB))
+
+	s.Rbac.Add(rbac.RoleAdmin, "EXPORT_SCHEDULES_VIEW", http.MethodGet, "/tasker/exports/schedules")
+	r.Get("/exports/schedules", exportspage.ExportSchedulesPageQueryHandler(s.DB, s.SheetExports))
+	s.Rbac.Add(rbac.RoleAdmin, "EXPORT_SCHEDULE_CREATE", http.MethodPost, "/tasker/exports/schedules")
+	r.Post("/exports/schedules", exportspage.CreateExportScheduleCommandHandler(s.DB, s.Audit, s.SheetExports))
+	s.Rbac.Add(rbac.RoleAdmin, "EXPORT_SCHEDULE_TOGGLE", http.MethodPost, "/tasker/exports/schedules/*/toggle")
+	r.Post("/exports/schedules/{id}/toggle", exportspage.ToggleExportScheduleCommandHandler(s.DB, s.Audit))
+	s.Rbac.Add(rbac.RoleAdmin, "EXPORT_SCHEDULE_RUN", http.MethodPost, "/tasker/exports/schedules/*/run")
+	r.Post("/exports/schedules/{id}/run", exportspage.RunExportScheduleCommandHandler(s.DB, s.SheetExports))
+	s.Rbac.Add(rbac.RoleAdmin, "EXPORT_SCHEDULE_DELETE", http.MethodPost, "/tasker/exports/schedules/*/delete")
+	r.Post("/exports/schedules/{id}/delete", exportspage.DeleteExportScheduleCommandHandler(s.DB, s.Audit))
 }
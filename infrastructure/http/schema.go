@@ -0,0 +1,37 @@
+package http
+
+import (
+	"net/http"
+
+	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/rbac"
+)
+
+const schemaRetryPath = "/tasker/admin/system/migrations/retry"
+
+// SchemaGuardMiddleware blocks writes while any embedded migration is pending
+// or failed, so a half-migrated database is not written to in a shape the
+// code does not expect. Reads stay available and admin pages carry a banner
+// until the schema is current.
+func (s *Server) SchemaGuardMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := s.Schema.Status()
+		if !status.Behind() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if session, ok := sessioncontext.GetSessionFromContext(r.Context()); ok && hasRole(session.UserRoles, rbac.RoleAdmin) {
+			r = r.WithContext(sessioncontext.NewContextWithSchemaWarning(r.Context(), status.Summary()))
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if r.URL.Path != schemaRetryPath {
+				http.Error(w, "Writes are disabled: "+status.Summary()+". An admin must resolve this on /tasker/admin/system.", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -9,16 +9,41 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
 	"time"
 
+	exportspage "receipter/frontend/exports"
 	loginflow "receipter/frontend/login"
+	palletprogress "receipter/frontend/pallets/progress"
 	sessioncontext "receipter/frontend/shared/context"
+	"receipter/infrastructure/accesslog"
 	"receipter/infrastructure/audit"
 	"receipter/infrastructure/cache"
+	"receipter/infrastructure/coldstorage"
+	"receipter/infrastructure/delivery"
+	"receipter/infrastructure/exportjob"
+	"receipter/infrastructure/exportschedule"
+	"receipter/infrastructure/integrity"
+	kioskinfra "receipter/infrastructure/kiosk"
+	"receipter/infrastructure/kpi"
+	"receipter/infrastructure/landing"
+	"receipter/infrastructure/live"
+	"receipter/infrastructure/maintenance"
+	"receipter/infrastructure/notification"
+	"receipter/infrastructure/palletcleanup"
+	"receipter/infrastructure/palletsla"
+	"receipter/infrastructure/passwordreset"
+	"receipter/infrastructure/photoorphan"
+	"receipter/infrastructure/photoretention"
+	"receipter/infrastructure/photoupload"
 	projectinfra "receipter/infrastructure/project"
+	"receipter/infrastructure/ratelimit"
 	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/renderpool"
+	"receipter/infrastructure/replymail"
 	sessioncookie "receipter/infrastructure/session"
 	"receipter/infrastructure/sqlite"
+	"receipter/infrastructure/userprefs"
 	"receipter/models"
 
 	"github.com/go-chi/chi/v5"
@@ -38,15 +63,39 @@ type Server struct {
 	router *chi.Mux
 
 	DB           *sqlite.DB
-	SessionCache *cache.UserSessionCache
+	SessionCache cache.SessionStore
 	UserCache    *cache.UserCache
 	RbacCache    *cache.RbacRolesCache
 	Rbac         *rbac.Rbac
 	Audit        *audit.Service
+	Live         *live.Hub
+	PhotoUploads *photoupload.Worker
+	Deliveries   *delivery.Worker
+	ExportJobs   *exportjob.Worker
+	SheetExports *exportschedule.Runner
+	Integrity    *integrity.Scheduler
+	PalletSLA    *palletsla.Monitor
+	PalletSweep  *palletcleanup.Sweeper
+	PhotoSweeper *photoretention.Sweeper
+	PhotoOrphans *photoorphan.Sweeper
+	KPI          *kpi.Snapshotter
+	AccessLog    *accesslog.Recorder
+	Schema       *sqlite.SchemaMonitor
+	Maintenance  *maintenance.Monitor
+	RateLimit    *ratelimit.Limiter
+	ReplyMail    *replymail.Receiver
+	ColdStorage  *coldstorage.Store
+	ColdSweeper  *coldstorage.Sweeper
+	// LabelRenders renders label PDFs off the request goroutines, with
+	// bounded concurrency.
+	LabelRenders *renderpool.Pool
+	// PasswordResets emails client users links to reset a forgotten
+	// password.
+	PasswordResets *passwordreset.Service
 }
 
 // NewServer creates a new http server.
-func NewServer(addr string, db *sqlite.DB, sessionCache *cache.UserSessionCache, userCache *cache.UserCache, r *rbac.Rbac, rbacCache *cache.RbacRolesCache, auditSvc *audit.Service) *Server {
+func NewServer(addr string, db *sqlite.DB, sessionCache cache.SessionStore, userCache *cache.UserCache, r *rbac.Rbac, rbacCache *cache.RbacRolesCache, auditSvc *audit.Service) *Server {
 	s := &Server{
 		Addr:         addr,
 		router:       chi.NewRouter(),
@@ -56,10 +105,50 @@ func NewServer(addr string, db *sqlite.DB, sessionCache *cache.UserSessionCache,
 		RbacCache:    rbacCache,
 		Rbac:         r,
 		Audit:        auditSvc,
+		Live:         live.NewHub(),
 		server: &http.Server{
 			MaxHeaderBytes: 1 << 20,
 		},
 	}
+	s.PhotoUploads = photoupload.NewWorker(db, s.Live)
+	s.Deliveries = delivery.NewWorker(db, map[string]delivery.Sender{
+		delivery.KindWebhook: delivery.NewWebhookSender(nil),
+	})
+	s.ExportJobs = exportjob.NewWorker(db, map[string]exportjob.Builder{
+		exportjob.KindPalletBundle:  exportspage.BuildPalletBundle,
+		exportjob.KindProjectBundle: exportspage.BuildProjectBundle,
+	})
+	s.SheetExports = exportschedule.NewRunner(db, exportspage.BuildScheduledExport)
+	s.Integrity = integrity.NewScheduler(db, s.Deliveries)
+	s.PalletSLA = palletsla.NewMonitor(db, s.Deliveries)
+	s.PalletSweep = palletcleanup.NewSweeper(db, s.Deliveries)
+	s.PhotoSweeper = photoretention.NewSweeper(db)
+	s.PhotoOrphans = photoorphan.NewSweeper(db)
+	s.ColdStorage = coldstorage.NewStore(db, auditSvc)
+	s.ColdSweeper = coldstorage.NewSweeper(s.ColdStorage)
+	s.PasswordResets = passwordreset.NewService(db, auditSvc, s.Deliveries)
+	s.LabelRenders = renderpool.New()
+	s.KPI = kpi.NewSnapshotter(db)
+	s.AccessLog = accesslog.NewRecorder(db)
+	s.Schema = sqlite.NewSchemaMonitor(context.Background(), db)
+	s.Maintenance = maintenance.NewMonitor(context.Background(), db)
+	// Background writers stop with the request paths while maintenance is on.
+	s.PhotoUploads.Paused = s.Maintenance.Active
+	s.Deliveries.Paused = s.Maintenance.Active
+	s.ExportJobs.Paused = s.Maintenance.Active
+	s.SheetExports.Paused = s.Maintenance.Active
+	s.Integrity.Paused = s.Maintenance.Active
+	s.PalletSLA.Paused = s.Maintenance.Active
+	s.PalletSweep.Paused = s.Maintenance.Active
+	s.PhotoSweeper.Paused = s.Maintenance.Active
+	s.PhotoOrphans.Paused = s.Maintenance.Active
+	s.ColdSweeper.Paused = s.Maintenance.Active
+	s.KPI.Paused = s.Maintenance.Active
+	s.AccessLog.Paused = s.Maintenance.Active
+	s.RateLimit = ratelimit.New(ratelimit.DefaultLimits())
+	s.ReplyMail = replymail.NewReceiver(db, func(ctx context.Context, userID, projectID, palletID int64, sku, uom, batch, expiryISO, comment string) error {
+		return palletprogress.CreateSKUClientComment(ctx, db, userID, projectID, palletID, sku, uom, batch, expiryISO, comment)
+	})
 
 	// Secure headers first.
 	s.router.Use(func(next http.Handler) http.Handler {
@@ -93,11 +182,15 @@ func NewServer(addr string, db *sqlite.DB, sessionCache *cache.UserSessionCache,
 			return
 		}
 
-		if session.User.Role == rbac.RoleClient {
-			http.Redirect(w, r, "/tasker/pallets/sku-view", http.StatusSeeOther)
+		if session.Kiosk() {
+			http.Redirect(w, r, kioskinfra.HomePath, http.StatusSeeOther)
 			return
 		}
-		http.Redirect(w, r, "/tasker/projects", http.StatusSeeOther)
+		redirectTo, err := landing.Resolve(r.Context(), s.DB, session.UserID, session.User.Role)
+		if err != nil {
+			slog.Warn("landing page lookup failed; using role default", slog.Int64("user_id", session.UserID), slog.Any("err", err))
+		}
+		http.Redirect(w, r, redirectTo, http.StatusSeeOther)
 	})
 
 	s.router.Get("/health", func(w http.ResponseWriter, _ *http.Request) {
@@ -116,10 +209,26 @@ func NewServer(addr string, db *sqlite.DB, sessionCache *cache.UserSessionCache,
 	s.router.Handle("/assets/*", http.StripPrefix("/assets/", http.FileServer(http.FS(assetsFS))))
 
 	s.RegisterLoginRoutes()
+	s.RegisterKioskRoutes()
+	s.RegisterEmbedRoutes()
+	s.RegisterAuditorRoutes()
+	s.RegisterInboundMailRoutes()
+
+	s.router.Route("/api", func(r chi.Router) {
+		r.Use(s.APITokenMiddleware)
+		r.Use(s.RateLimitMiddleware)
+		r.Use(s.SchemaGuardMiddleware)
+		r.Use(s.MaintenanceMiddleware)
+		s.RegisterAPIRoutes(r)
+	})
 
 	s.router.Group(func(r chi.Router) {
 		r.Route("/tasker", func(r chi.Router) {
 			r.Use(s.AuthenticateMiddleware)
+			r.Use(s.RateLimitMiddleware)
+			r.Use(s.SchemaGuardMiddleware)
+			r.Use(s.MaintenanceMiddleware)
+			r.Use(s.AccessLogMiddleware)
 			s.RegisterFrontendRoutes(r)
 			s.RegisterAdminRoutes(r)
 		})
@@ -156,11 +265,27 @@ func (s *Server) AuthenticateMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		path := r.URL.Path
+		if name, repaired := s.repairDeactivatedSessionProject(r.Context(), &session, path); repaired {
+			message := fmt.Sprintf("Project %q was deactivated, so it is no longer your active project. Choose a project to continue.", name)
+			http.Redirect(w, r, "/tasker/projects?status="+url.QueryEscape(message), http.StatusSeeOther)
+			return
+		}
+
 		s.ensureSessionActiveProject(r.Context(), &session)
 
-		path := r.URL.Path
 		skipRBAC := path == "/login" || path == "/logout"
 
+		// Kiosk sessions stay on the scan and receipt screens whatever the
+		// user's own role allows.
+		if session.Kiosk() {
+			if !s.RbacValidation([]string{rbac.RoleKiosk}, path, r.Method) {
+				http.Redirect(w, r, "/kiosk", http.StatusSeeOther)
+				return
+			}
+			session.ScreenPermissions = s.buildRbacNamedRoutesMap([]string{rbac.RoleKiosk})
+		}
+
 		isAdmin := false
 		for _, role := range session.UserRoles {
 			if role == rbac.RoleAdmin {
@@ -188,7 +313,21 @@ func (s *Server) AuthenticateMiddleware(next http.Handler) http.Handler {
 			}
 		}
 
+		prefs, err := userprefs.Load(r.Context(), s.DB, session.UserID)
+		if err != nil {
+			slog.Error("load user preferences failed", slog.Int64("user_id", session.UserID), slog.Any("err", err))
+		}
 		ctx := sessioncontext.NewContextWithSession(r.Context(), session)
+		ctx = userprefs.NewContext(ctx, prefs)
+		// Only pages render the top bar, so only they need the bell count.
+		if isAdmin && r.Method == http.MethodGet {
+			unread, err := notification.UnreadCount(r.Context(), s.DB, session.UserID, time.Now().UTC())
+			if err != nil {
+				slog.Error("load unread notifications failed", slog.Int64("user_id", session.UserID), slog.Any("err", err))
+			} else {
+				ctx = notification.NewContext(ctx, unread)
+			}
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -211,6 +350,36 @@ func (s *Server) resolveSession(ctx context.Context, token string) (session mode
 	return dbSession, true
 }
 
+// repairDeactivatedSessionProject clears the active project of a staff
+// session when the project was deactivated after the session picked it, so
+// the user is sent to choose again instead of hitting read-only errors.
+// Client and kiosk sessions resolve their project elsewhere.
+func (s *Server) repairDeactivatedSessionProject(ctx context.Context, session *models.Session, path string) (string, bool) {
+	if session == nil || session.ID == "" || session.ActiveProjectID == nil || path == "/logout" {
+		return "", false
+	}
+	if session.User.Role == rbac.RoleClient || session.Kiosk() {
+		return "", false
+	}
+	name, deactivated, err := projectinfra.DeactivatedSessionProject(ctx, s.DB, session.ID)
+	if err != nil {
+		slog.Error("check session project status failed", slog.String("session_id", session.ID), slog.Any("err", err))
+		return "", false
+	}
+	if !deactivated {
+		return "", false
+	}
+	if err := projectinfra.SetSessionActiveProjectID(ctx, s.DB, session.ID, nil); err != nil {
+		slog.Error("clear deactivated session project failed", slog.String("session_id", session.ID), slog.Any("err", err))
+		return "", false
+	}
+	session.ActiveProjectID = nil
+	if s.SessionCache != nil {
+		s.SessionCache.AddSession(*session)
+	}
+	return name, true
+}
+
 func (s *Server) ensureSessionActiveProject(ctx context.Context, session *models.Session) {
 	if session == nil || session.ID == "" {
 		return
@@ -302,6 +471,19 @@ func (s *Server) Start() error {
 		return err
 	}
 	go s.server.Serve(s.ln)
+	s.PhotoUploads.Start()
+	s.Deliveries.Start()
+	s.ExportJobs.Start()
+	s.SheetExports.Start()
+	s.Integrity.Start()
+	s.PalletSLA.Start()
+	s.PalletSweep.Start()
+	s.PhotoSweeper.Start()
+	s.PhotoOrphans.Start()
+	s.ColdSweeper.Start()
+	s.LabelRenders.Start()
+	s.KPI.Start()
+	s.AccessLog.Start()
 	return nil
 }
 
@@ -310,12 +492,27 @@ func (s *Server) Stop() error {
 	if s.ln == nil {
 		return fmt.Errorf("HTTP server has not been started or is already stopped")
 	}
+	// Live streams never go idle on their own; end them so Shutdown can drain.
+	s.Live.Close()
 	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
 	defer cancel()
 	if err := s.server.Shutdown(ctx); err != nil {
 		return fmt.Errorf("failed to shutdown HTTP server: %v", err)
 	}
 	s.ln = nil
+	s.PhotoUploads.Stop()
+	s.Deliveries.Stop()
+	s.ExportJobs.Stop()
+	s.SheetExports.Stop()
+	s.Integrity.Stop()
+	s.PalletSLA.Stop()
+	s.PalletSweep.Stop()
+	s.PhotoSweeper.Stop()
+	s.PhotoOrphans.Stop()
+	s.ColdSweeper.Stop()
+	s.LabelRenders.Stop()
+	s.KPI.Stop()
+	s.AccessLog.Stop()
 	return nil
 }
 
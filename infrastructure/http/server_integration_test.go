@@ -1,34 +1,54 @@
 package http
 
 import (
+	"archive/zip"
+	"bufio"
 	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/uptrace/bun"
 
 	"receipter/frontend/login"
+	palletprogress "receipter/frontend/pallets/progress"
+	"receipter/infrastructure/apitoken"
 	"receipter/infrastructure/audit"
+	"receipter/infrastructure/auditorlink"
 	"receipter/infrastructure/cache"
+	"receipter/infrastructure/delivery"
+	"receipter/infrastructure/kpi"
+	"receipter/infrastructure/loadtest"
+	"receipter/infrastructure/projectbundle"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/ratelimit"
 	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/renderpool"
+	"receipter/infrastructure/replymail"
 	"receipter/infrastructure/sqlite"
 )
 
 type integrationEnv struct {
 	server *httptest.Server
 	db     *sqlite.DB
+	app    *Server
 }
 
 func setupIntegrationServer(t *testing.T) (*integrationEnv, *http.Client) {
@@ -72,7 +92,7 @@ VALUES ('Integration Default', 'Default project for integration tests', DATE('no
 
 	s := NewServer("127.0.0.1:0", db, sessionCache, userCache, rbacSvc, rbacCache, auditSvc)
 	ts := httptest.NewServer(s.router)
-	env := &integrationEnv{server: ts, db: db}
+	env := &integrationEnv{server: ts, db: db, app: s}
 	t.Cleanup(func() {
 		env.server.Close()
 		_ = env.db.Close()
@@ -207,6 +227,17 @@ func countReceiptRowsQty(t *testing.T, db *sqlite.DB, palletID int64) (rows int6
 	return rows, qty
 }
 
+func palletStatusByID(t *testing.T, db *sqlite.DB, palletID int64) string {
+	t.Helper()
+	var status string
+	if err := db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT status FROM pallets WHERE id = ?`, palletID).Scan(ctx, &status)
+	}); err != nil {
+		t.Fatalf("load pallet status: %v", err)
+	}
+	return status
+}
+
 func receiptLineIDBySKU(t *testing.T, db *sqlite.DB, palletID int64, sku string) int64 {
 	t.Helper()
 	var id int64
@@ -477,8 +508,8 @@ func TestScanPalletPageIncludesScannerModalHook(t *testing.T) {
 	if !strings.Contains(text, "openPalletScanModal('pallet_barcode')") {
 		t.Fatalf("expected scan trigger button hook on scan page")
 	}
-	if !strings.Contains(text, "/tasker/pallets/' + id + '/receipt") {
-		t.Fatalf("expected scan page redirect script to receipt route")
+	if !strings.Contains(text, "/tasker/scan/pallet/lookup?code=") || !strings.Contains(text, "body.receiptUrl") {
+		t.Fatalf("expected scan page to resolve codes through the pallet lookup")
 	}
 }
 
@@ -569,14 +600,15 @@ func TestReceiptLineEditAndDeleteWhenProjectActiveAndPalletOpen(t *testing.T) {
 	}
 
 	resp = postForm(t, scannerClient, env.server.URL, "/tasker/api/pallets/1/receipts/"+strconv.FormatInt(lineID, 10)+"/update", url.Values{
-		"sku":          {"SKU-EDIT-NEW"},
-		"description":  {"Editable Line Updated"},
-		"qty":          {"5"},
-		"case_size":    {"4"},
-		"damaged":      {"1"},
-		"damaged_qty":  {"1"},
-		"batch_number": {"E2"},
-		"expiry_date":  {"2029-04-02"},
+		"sku":           {"SKU-EDIT-NEW"},
+		"description":   {"Editable Line Updated"},
+		"qty":           {"5"},
+		"case_size":     {"4"},
+		"damaged":       {"1"},
+		"damaged_qty":   {"5"},
+		"damage_reason": {"crushed"},
+		"batch_number":  {"E2"},
+		"expiry_date":   {"2029-04-02"},
 	})
 	if resp.StatusCode != http.StatusSeeOther {
 		t.Fatalf("expected receipt line update 303, got %d", resp.StatusCode)
@@ -614,14 +646,15 @@ func TestReceiptCreateSplitsDamagedIntoSeparateLines(t *testing.T) {
 
 	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
 	resp = postForm(t, scannerClient, env.server.URL, "/tasker/api/pallets/1/receipts", url.Values{
-		"sku":          {"SKU-SPLIT"},
-		"description":  {"Split damaged"},
-		"qty":          {"3"},
-		"case_size":    {"1"},
-		"damaged":      {"1"},
-		"damaged_qty":  {"2"},
-		"batch_number": {"S1"},
-		"expiry_date":  {"2029-01-15"},
+		"sku":           {"SKU-SPLIT"},
+		"description":   {"Split damaged"},
+		"qty":           {"3"},
+		"case_size":     {"1"},
+		"damaged":       {"1"},
+		"damaged_qty":   {"2"},
+		"damage_reason": {"seal_broken"},
+		"batch_number":  {"S1"},
+		"expiry_date":   {"2029-01-15"},
 	})
 	if resp.StatusCode != http.StatusSeeOther {
 		t.Fatalf("expected receipt create 303, got %d", resp.StatusCode)
@@ -927,6 +960,179 @@ func TestPalletProgressAdminAndScannerShowViewButton(t *testing.T) {
 	_ = resp.Body.Close()
 }
 
+func TestReceiptCSVImport_AdminImportsLinesScannerCannot(t *testing.T) {
+	env, adminClient := setupIntegrationServer(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/pallets/1/receipt")
+	page, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(page), `/tasker/api/pallets/1/receipts/import`) {
+		t.Fatalf("expected the admin receipt page to offer the CSV import")
+	}
+
+	resp = postMultipartFile(t, adminClient, env.server.URL, "/tasker/api/pallets/1/receipts/import", "file", "packing.csv", []byte("sku,qty\nIMP-1,4\nIMP-2,0\n"))
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity || !strings.Contains(string(body), "qty must be greater than 0") {
+		t.Fatalf("expected the row error listed with 422, got %d", resp.StatusCode)
+	}
+
+	resp = postMultipartFile(t, adminClient, env.server.URL, "/tasker/api/pallets/1/receipts/import", "file", "packing.csv", []byte("sku,qty\nIMP-1,4\nIMP-2,1\nIMP-1,2\n"))
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=") {
+		t.Fatalf("expected import to redirect with a status, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	var lines, qty int64
+	err := env.db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT COUNT(*), COALESCE(SUM(qty), 0) FROM pallet_receipts WHERE pallet_id = 1`).Scan(ctx, &lines, &qty)
+	})
+	if err != nil {
+		t.Fatalf("count lines: %v", err)
+	}
+	if lines != 2 || qty != 7 {
+		t.Fatalf("expected 2 merged lines totalling 7, got %d totalling %d", lines, qty)
+	}
+
+	scannerClient := newHTTPClient(t)
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+	resp = get(t, scannerClient, env.server.URL, "/tasker/pallets/1/receipt")
+	page, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if strings.Contains(string(page), `/receipts/import`) {
+		t.Fatalf("scanner receipt page should not offer the CSV import")
+	}
+	resp = postMultipartFile(t, scannerClient, env.server.URL, "/tasker/api/pallets/1/receipts/import", "file", "packing.csv", []byte("sku,qty\nIMP-3,1\n"))
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "/login") {
+		t.Fatalf("expected scanner import denied, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	err = env.db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT COUNT(*) FROM pallet_receipts WHERE sku = 'IMP-3'`).Scan(ctx, &lines)
+	})
+	if err != nil || lines != 0 {
+		t.Fatalf("expected the scanner import to save nothing, got %d (%v)", lines, err)
+	}
+}
+
+func TestPalletLabelPrint_RefusedWithRetryWhileRenderPoolIsFull(t *testing.T) {
+	env, client := setupIntegrationServer(t)
+	loginAs(t, client, env.server.URL, "admin", "Admin123!Receipter")
+	resp := postForm(t, client, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+
+	env.app.LabelRenders.Workers = 1
+	env.app.LabelRenders.QueueSize = 0
+	env.app.LabelRenders.Start()
+	t.Cleanup(env.app.LabelRenders.Stop)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		// With no queue a render is only taken once the worker is waiting.
+		for {
+			err := env.app.LabelRenders.Do(context.Background(), func() error {
+				close(started)
+				<-release
+				return nil
+			})
+			if !errors.Is(err, renderpool.ErrBusy) {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	<-started
+
+	resp = get(t, client, env.server.URL, "/tasker/pallets/1/label")
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("expected 503 with Retry-After while rendering is saturated, got %d %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	var issued int64
+	if err := env.db.R.NewRaw(`SELECT COUNT(*) FROM pallet_label_instances`).Scan(context.Background(), &issued); err != nil {
+		t.Fatalf("count labels: %v", err)
+	}
+	if issued != 0 {
+		t.Fatalf("expected a refused print to issue no label, got %d", issued)
+	}
+
+	close(release)
+	resp = get(t, client, env.server.URL, "/tasker/pallets/1/label")
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/pdf" {
+		t.Fatalf("expected the retried print to render, got %d", resp.StatusCode)
+	}
+}
+
+func TestBatchClosedLabelPrint_PrintsSelectedPalletsInOrder(t *testing.T) {
+	env, client := setupIntegrationServer(t)
+	loginAs(t, client, env.server.URL, "admin", "Admin123!Receipter")
+	for i := 1; i <= 3; i++ {
+		resp := postForm(t, client, env.server.URL, "/tasker/pallets/new", nil)
+		_ = resp.Body.Close()
+	}
+	for _, id := range []string{"1", "2"} {
+		resp := postForm(t, client, env.server.URL, "/tasker/api/pallets/"+id+"/receipts", url.Values{
+			"sku":          {"SKU-BATCH-" + id},
+			"description":  {"Batch label line"},
+			"qty":          {"6"},
+			"case_size":    {"6"},
+			"batch_number": {"B-" + id},
+			"expiry_date":  {"2030-01-15"},
+		})
+		if resp.StatusCode != http.StatusSeeOther {
+			t.Fatalf("expected add receipt line 303, got %d", resp.StatusCode)
+		}
+		_ = resp.Body.Close()
+		resp = postForm(t, client, env.server.URL, "/tasker/api/pallets/"+id+"/close", nil)
+		_ = resp.Body.Close()
+	}
+
+	resp := get(t, client, env.server.URL, "/tasker/pallets/progress")
+	page, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(page), `id="bulk-closed-label-form"`) || !strings.Contains(string(page), `data-pallet-status="closed"`) {
+		t.Fatalf("expected progress page to offer batch closed label printing for closed pallets")
+	}
+
+	readPrints := func() []string {
+		t.Helper()
+		var rows []string
+		err := env.db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+			return tx.NewRaw(`
+SELECT clp.pallet_id || ':' || clp.batch_position || ':' || p.status
+FROM closed_label_prints clp
+JOIN pallets p ON p.id = clp.pallet_id
+ORDER BY clp.id`).Scan(ctx, &rows)
+		})
+		if err != nil {
+			t.Fatalf("read print runs: %v", err)
+		}
+		return rows
+	}
+
+	resp = postForm(t, client, env.server.URL, "/tasker/pallets/closed-labels/print", url.Values{"pallet_ids": {"2,1,3"}})
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 when an open pallet is selected, got %d", resp.StatusCode)
+	}
+	if prints := readPrints(); len(prints) != 0 {
+		t.Fatalf("expected a refused batch to record nothing, got %v", prints)
+	}
+
+	resp = postForm(t, client, env.server.URL, "/tasker/pallets/closed-labels/print", url.Values{"pallet_ids": {"2,1"}})
+	pdf, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "application/pdf") || !bytes.HasPrefix(pdf, []byte("%PDF")) {
+		t.Fatalf("expected one pdf, status=%d content-type=%s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if prints := strings.Join(readPrints(), ","); prints != "1:1:labelled,2:2:labelled" {
+		t.Fatalf("expected one print run per pallet in pallet order, got %s", prints)
+	}
+}
+
 func TestClosedPalletLabelVisibilityAndAccessByRole(t *testing.T) {
 	env, _ := setupIntegrationServer(t)
 	adminClient := newHTTPClient(t)
@@ -995,23 +1201,87 @@ func TestClosedPalletLabelVisibilityAndAccessByRole(t *testing.T) {
 
 	resp = get(t, scannerClient, env.server.URL, "/tasker/pallets/1/closed-label")
 	if resp.StatusCode != http.StatusOK {
-		t.Fatalf("expected scanner closed label route 200, got %d", resp.StatusCode)
+		t.Fatalf("expected scanner closed label preview 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.Contains(ct, "text/html") {
+		t.Fatalf("expected html content type from closed label preview, got %s", ct)
+	}
+	previewBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read closed label preview body: %v", err)
+	}
+	_ = resp.Body.Close()
+	if !strings.Contains(string(previewBody), "SKU-CLOSED-LABEL") || !strings.Contains(string(previewBody), "/tasker/pallets/1/closed-label/print") {
+		t.Fatalf("expected closed label preview to show label contents and print action")
+	}
+
+	readStatus := func() string {
+		t.Helper()
+		var status string
+		err := env.db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+			return tx.NewRaw(`SELECT status FROM pallets WHERE id = 1`).Scan(ctx, &status)
+		})
+		if err != nil {
+			t.Fatalf("read pallet status: %v", err)
+		}
+		return status
+	}
+	if status := readStatus(); status != "closed" {
+		t.Fatalf("expected pallet to stay closed after label preview, got %s", status)
+	}
+
+	resp = postForm(t, scannerClient, env.server.URL, "/tasker/pallets/1/closed-label/print", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected scanner closed label print 200, got %d", resp.StatusCode)
 	}
 	if ct := resp.Header.Get("Content-Type"); !strings.Contains(ct, "application/pdf") {
-		t.Fatalf("expected pdf content type from closed label route, got %s", ct)
+		t.Fatalf("expected pdf content type from closed label print, got %s", ct)
 	}
 	_ = resp.Body.Close()
 
-	var palletStatus string
-	err = env.db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
-		return tx.NewRaw(`SELECT status FROM pallets WHERE id = 1`).Scan(ctx, &palletStatus)
-	})
+	if status := readStatus(); status != "labelled" {
+		t.Fatalf("expected pallet status labelled after closed-label print, got %s", status)
+	}
+
+	resp = get(t, scannerClient, env.server.URL, "/tasker/pallets/1/closed-label?lang=xx")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected unsupported label language 400, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/projects/1/label-language", url.Values{"label_language": {"fr"}})
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected label language update 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, scannerClient, env.server.URL, "/tasker/pallets/1/closed-label")
+	frenchBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		t.Fatalf("read pallet status after closed-label print: %v", err)
+		t.Fatalf("read french closed label preview body: %v", err)
+	}
+	_ = resp.Body.Close()
+	if !strings.Contains(string(frenchBody), "Désignation") || !strings.Contains(string(frenchBody), `name="label_language" value="fr"`) {
+		t.Fatalf("expected closed label preview to use the project label language")
+	}
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/projects/1/label-symbology", url.Values{"label_symbology": {"ean13"}})
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "EAN-13") {
+		t.Fatalf("expected label symbology update 303, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/projects/1/label-symbology", url.Values{"label_symbology": {"pdf417"}})
+	if !strings.Contains(resp.Header.Get("Location"), url.QueryEscape("label barcode symbology is not supported")) {
+		t.Fatalf("expected unsupported symbology message, got %s", resp.Header.Get("Location"))
 	}
-	if palletStatus != "labelled" {
-		t.Fatalf("expected pallet status labelled after closed-label print, got %s", palletStatus)
+	_ = resp.Body.Close()
+
+	resp = postForm(t, scannerClient, env.server.URL, "/tasker/pallets/1/closed-label/print", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected closed label print with EAN-13 symbology 200, got %d", resp.StatusCode)
 	}
+	_ = resp.Body.Close()
 
 	clientPassword := "Client123!Receipter"
 	_ = seedClientUser(t, env.db, "client-closed-label", clientPassword, 1)
@@ -1038,6 +1308,12 @@ func TestClosedPalletLabelVisibilityAndAccessByRole(t *testing.T) {
 		t.Fatalf("expected client closed label route redirect to login, got %s", resp.Header.Get("Location"))
 	}
 	_ = resp.Body.Close()
+
+	resp = postForm(t, clientHTTP, env.server.URL, "/tasker/pallets/1/closed-label/print", nil)
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected client closed label print denied with 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
 }
 
 func TestProjectLogsPage_AdminAllowedScannerDenied(t *testing.T) {
@@ -1192,6 +1468,62 @@ func TestAdminClientProjectAccessRoute_AdminAllowedScannerDenied(t *testing.T) {
 	}
 }
 
+func TestAdminBulkDisableEndsSessionsBlocksLoginAndUndoRestores(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	adminClient := newHTTPClient(t)
+	scannerClient := newHTTPClient(t)
+
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+	scannerID := userIDByUsername(t, env.db, "scanner1")
+
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/admin/users/bulk", url.Values{
+		"user_ids":    {strconv.FormatInt(scannerID, 10)},
+		"bulk_action": {"disable"},
+	})
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "/tasker/admin/users?status=") {
+		t.Fatalf("expected bulk disable success redirect, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, scannerClient, env.server.URL, "/tasker/pallets/progress")
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "/login") {
+		t.Fatalf("expected disabled scanner session ended, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	freshClient := newHTTPClient(t)
+	resp = get(t, freshClient, env.server.URL, "/login")
+	_ = resp.Body.Close()
+	resp = postForm(t, freshClient, env.server.URL, "/login", url.Values{
+		"username": {"scanner1"},
+		"password": {"Scanner123!Receipter"},
+	})
+	if !strings.Contains(resp.Header.Get("Location"), "/login?error=") {
+		t.Fatalf("expected disabled scanner login rejected, got %s", resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/admin/users")
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), "Disabled 1 users") || !strings.Contains(string(body), "/undo") {
+		t.Fatalf("expected bulk change listed with undo on users page")
+	}
+
+	var changeID int64
+	if err := env.db.R.QueryRowContext(context.Background(), `SELECT id FROM user_bulk_changes ORDER BY id DESC LIMIT 1`).Scan(&changeID); err != nil {
+		t.Fatalf("load bulk change: %v", err)
+	}
+	resp = postForm(t, adminClient, env.server.URL, fmt.Sprintf("/tasker/admin/users/bulk-changes/%d/undo", changeID), url.Values{})
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "/tasker/admin/users?status=") {
+		t.Fatalf("expected undo success redirect, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	loginAs(t, newHTTPClient(t), env.server.URL, "scanner1", "Scanner123!Receipter")
+}
+
 func TestScannerRestrictedScreensAndProgressUsesScanView(t *testing.T) {
 	env, _ := setupIntegrationServer(t)
 	adminClient := newHTTPClient(t)
@@ -1487,6 +1819,25 @@ func TestPalletContentLabelFragmentIncludesScannerAndMorphTarget(t *testing.T) {
 	if !strings.Contains(detailText, "Photos") {
 		t.Fatalf("expected photos section in line detail")
 	}
+	if !strings.Contains(detailText, ">History<") || !strings.Contains(detailText, "Created") || !strings.Contains(detailText, "SKU-VIEW") {
+		t.Fatalf("expected line history with create entry in line detail")
+	}
+
+	seedClientUser(t, env.db, "client-history", "Client123!Receipter", 1)
+	clientHTTP := newHTTPClient(t)
+	loginAs(t, clientHTTP, env.server.URL, "client-history", "Client123!Receipter")
+	resp = get(t, clientHTTP, env.server.URL, "/tasker/pallets/1/content-line/1")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected client line detail status 200, got %d", resp.StatusCode)
+	}
+	clientBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read client line detail body: %v", err)
+	}
+	_ = resp.Body.Close()
+	if strings.Contains(string(clientBody), ">History<") {
+		t.Fatalf("expected line history hidden from clients")
+	}
 }
 
 func TestClosedPalletReceiptPermissions_ScannerDeniedAdminAllowed(t *testing.T) {
@@ -1619,6 +1970,119 @@ func TestCancelledPalletIsReadOnlyForAdminAndScanner(t *testing.T) {
 	}
 }
 
+func TestVerifyBeforeCloseBlocksUntilEveryLineIsScanned(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	adminClient := newHTTPClient(t)
+
+	if err := projectsettings.SaveProject(context.Background(), env.db, nil, 1, 1, map[string]string{
+		projectsettings.PalletVerifyBeforeClose: "true",
+	}); err != nil {
+		t.Fatalf("enable verification: %v", err)
+	}
+
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected new pallet 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/api/pallets/1/receipts", url.Values{
+		"sku":          {"SKU-VERIFY"},
+		"description":  {"Verify"},
+		"qty":          {"3"},
+		"batch_number": {"V1"},
+		"expiry_date":  {"2028-01-01"},
+	})
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected receipt 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/api/pallets/1/close", nil)
+	if resp.StatusCode != http.StatusSeeOther || !strings.HasPrefix(resp.Header.Get("Location"), "/tasker/pallets/1/verify?error=") {
+		t.Fatalf("expected unverified close sent to the verification page, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+	if status := palletStatusByID(t, env.db, 1); status != "open" {
+		t.Fatalf("expected pallet left open, got %q", status)
+	}
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/pallets/1/verify")
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "Not verified") {
+		t.Fatalf("expected verification page to highlight the unverified line, got %d", resp.StatusCode)
+	}
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/pallets/1/verify", url.Values{"barcode": {"SKU-VERIFY"}})
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=") {
+		t.Fatalf("expected verification scan accepted, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/api/pallets/1/close", nil)
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/tasker/pallets/progress" {
+		t.Fatalf("expected verified close accepted, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+	if status := palletStatusByID(t, env.db, 1); status != "closed" {
+		t.Fatalf("expected pallet closed, got %q", status)
+	}
+}
+
+func TestCancelPalletAsksForStepUpWhenProjectRequiresIt(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	adminClient := newHTTPClient(t)
+
+	if err := projectsettings.SaveProject(context.Background(), env.db, nil, 1, 1, map[string]string{
+		projectsettings.SecurityStepUp: "true",
+	}); err != nil {
+		t.Fatalf("enable step-up: %v", err)
+	}
+
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected new pallet 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/pallets/progress")
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), `name="step_up_secret"`) {
+		t.Fatalf("expected progress page to ask for password or PIN in the cancel dialog")
+	}
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/api/pallets/1/cancel", nil)
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "error=") {
+		t.Fatalf("expected cancel without step-up refused, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+	if status := palletStatusByID(t, env.db, 1); status != "created" {
+		t.Fatalf("expected pallet left created, got %q", status)
+	}
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/api/pallets/1/cancel", url.Values{"step_up_secret": {"Admin123!Receipter"}})
+	if resp.StatusCode != http.StatusSeeOther || strings.Contains(resp.Header.Get("Location"), "error=") {
+		t.Fatalf("expected cancel with step-up accepted, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+	if status := palletStatusByID(t, env.db, 1); status != "cancelled" {
+		t.Fatalf("expected pallet cancelled, got %q", status)
+	}
+
+	var stepUps int
+	if err := env.db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT COUNT(*) FROM audit_logs WHERE action = 'session.step_up' AND entity_type = 'pallets' AND entity_id = '1'`).Scan(ctx, &stepUps)
+	}); err != nil {
+		t.Fatalf("count step-up audit: %v", err)
+	}
+	if stepUps != 1 {
+		t.Fatalf("expected 1 step-up audit entry, got %d", stepUps)
+	}
+}
+
 func TestInactiveProjectPalletCannotBeModifiedByScannerOrAdmin(t *testing.T) {
 	env, _ := setupIntegrationServer(t)
 	adminClient := newHTTPClient(t)
@@ -1943,7 +2407,7 @@ func TestStockSearchOptionsEndpointRendersSuggestionMarkup(t *testing.T) {
 	if !strings.Contains(text, `id="sku_suggestions"`) {
 		t.Fatalf("expected suggestions morph target id in options response")
 	}
-	if !strings.Contains(text, `data-sku-suggestion="1"`) {
+	if !strings.Contains(text, `data-suggestion="1"`) {
 		t.Fatalf("expected clickable suggestion markers in options response")
 	}
 	if !strings.Contains(text, `data-sku="ZZ-100"`) {
@@ -1970,6 +2434,58 @@ func TestStockSearchOptionsEndpointRendersSuggestionMarkup(t *testing.T) {
 	}
 }
 
+func TestBatchOptionsSuggestEarlierBatchesForSKU(t *testing.T) {
+	env, client := setupIntegrationServer(t)
+	loginAs(t, client, env.server.URL, "admin", "Admin123!Receipter")
+	resp := postForm(t, client, env.server.URL, "/tasker/pallets/new", nil)
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected create pallet 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+	resp = postForm(t, client, env.server.URL, "/tasker/api/pallets/1/receipts", url.Values{
+		"sku":          {"SKU-B1"},
+		"description":  {"Batch SKU"},
+		"qty":          {"5"},
+		"batch_number": {"LOT-778899"},
+		"expiry_date":  {"2029-01-01"},
+	})
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected receipt create 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	scanner := newHTTPClient(t)
+	loginAs(t, scanner, env.server.URL, "scanner1", "Scanner123!Receipter")
+	resp = get(t, scanner, env.server.URL, "/tasker/api/stock/batches/options?sku=SKU-B1&q=7788")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected batch options 200, got %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatalf("read batch options body: %v", err)
+	}
+	text := string(body)
+	for _, want := range []string{`id="batch_suggestions"`, `data-batch="LOT-778899"`, `data-expiry="2029-01-01"`, "LOT-778899 (exp 01/01/2029)"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected %s in batch options, got %s", want, text)
+		}
+	}
+
+	resp = get(t, scanner, env.server.URL, "/tasker/api/stock/batches/options?sku=SKU-OTHER")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected batch options 200 for sku without batches, got %d", resp.StatusCode)
+	}
+	body, err = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatalf("read empty batch options body: %v", err)
+	}
+	if !strings.Contains(string(body), " hidden") || strings.Contains(string(body), "data-batch=") {
+		t.Fatalf("expected hidden empty batch list, got %s", string(body))
+	}
+}
+
 func TestExportRunLogged(t *testing.T) {
 	env, client := setupIntegrationServer(t)
 	loginAs(t, client, env.server.URL, "admin", "Admin123!Receipter")
@@ -1987,7 +2503,51 @@ func TestExportRunLogged(t *testing.T) {
 	}
 }
 
-func TestBulkPalletLabelGenerationReturnsSinglePDF(t *testing.T) {
+func TestExportRunHistoryAndRerun(t *testing.T) {
+	env, client := setupIntegrationServer(t)
+	loginAs(t, client, env.server.URL, "admin", "Admin123!Receipter")
+
+	resp := get(t, client, env.server.URL, "/tasker/exports/pallet-status.csv")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected export status 200, got %d", resp.StatusCode)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	var runID, rowCount int64
+	err := env.db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT id, row_count FROM export_runs WHERE export_type = 'pallet_status_csv' ORDER BY id DESC LIMIT 1`).Scan(ctx, &runID, &rowCount)
+	})
+	if err != nil {
+		t.Fatalf("load export run: %v", err)
+	}
+
+	resp = get(t, client, env.server.URL, "/tasker/exports/runs")
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "pallet_status_csv") {
+		t.Fatalf("expected export history to list run, status=%d", resp.StatusCode)
+	}
+
+	resp = get(t, client, env.server.URL, "/tasker/exports/runs/"+strconv.FormatInt(runID, 10))
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "/tasker/exports/pallet-status.csv?format_version=1") {
+		t.Fatalf("expected export run detail with re-run link, status=%d", resp.StatusCode)
+	}
+
+	resp = get(t, client, env.server.URL, "/tasker/exports/runs/"+strconv.FormatInt(runID, 10)+"/download")
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for run without retained file, got %d", resp.StatusCode)
+	}
+
+	if count := countExportRunsForUserType(t, env.db, "admin", "pallet_status_csv"); count != 1 {
+		t.Fatalf("expected 1 pallet status run, got %d", count)
+	}
+}
+
+func TestBulkPalletLabelGenerationReturnsSinglePDF(t *testing.T) {
 	env, client := setupIntegrationServer(t)
 	loginAs(t, client, env.server.URL, "admin", "Admin123!Receipter")
 
@@ -2314,6 +2874,51 @@ func TestClientSkuViewProjectScope_AllAndSpecific(t *testing.T) {
 	}
 	_ = resp.Body.Close()
 
+	resp = get(t, clientHTTP, env.server.URL, "/tasker/pallets/sku-view/detail/photos?project_scope="+strconv.FormatInt(project2ID, 10)+"&sku=SKU-SCOPE-B&uom=&batch=SB&expiry=2029-02-01&photo_page=2")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected project-specific photo gallery fragment 200, got %d", resp.StatusCode)
+	}
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read photo gallery fragment body: %v", err)
+	}
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), `id="sku-photo-gallery"`) || strings.Contains(string(body), "<html") {
+		t.Fatalf("expected bare photo gallery fragment, got %s", body)
+	}
+
+	resp = get(t, clientHTTP, env.server.URL, "/tasker/pallets/sku-view/detail/photos?project_scope=all&sku=SKU-SCOPE-B&uom=&batch=SB&expiry=2029-02-01")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected all-scope photo gallery request 400, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, clientHTTP, env.server.URL, "/tasker/pallets/sku-view/detail/trend.json?project_scope="+strconv.FormatInt(project2ID, 10)+"&sku=SKU-SCOPE-B&uom=&batch=SB&expiry=2029-02-01")
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		t.Fatalf("expected project-specific trend json 200, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	var trend struct {
+		SKU   string `json:"sku"`
+		Total int64  `json:"total"`
+		Days  []struct {
+			Date string `json:"date"`
+			Qty  int64  `json:"qty"`
+		} `json:"days"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&trend); err != nil {
+		t.Fatalf("decode trend json: %v", err)
+	}
+	_ = resp.Body.Close()
+	if trend.SKU != "SKU-SCOPE-B" || trend.Total <= 0 || len(trend.Days) < palletprogress.SKUTrendDays {
+		t.Fatalf("unexpected trend json: %+v", trend)
+	}
+
+	resp = get(t, clientHTTP, env.server.URL, "/tasker/pallets/sku-view/detail/trend.json?project_scope=all&sku=SKU-SCOPE-B&uom=&batch=SB&expiry=2029-02-01")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected all-scope trend request 400, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
 	resp = get(t, clientHTTP, env.server.URL, "/tasker/pallets/sku-view/export-summary.csv?project_scope=all")
 	if resp.StatusCode != http.StatusOK {
 		t.Fatalf("expected all-scope summary export 200, got %d", resp.StatusCode)
@@ -2477,3 +3082,3382 @@ func TestHelpPageRoleSpecificContent(t *testing.T) {
 		t.Fatalf("client help navigation should not expose admin/scanner links")
 	}
 }
+
+func postGraphQL(t *testing.T, baseURL, token, body string) (int, string) {
+	t.Helper()
+	return postAPIJSON(t, baseURL, "/api/graphql", token, body)
+}
+
+func postAPIJSON(t *testing.T, baseURL, path, token, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, baseURL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("build api request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST %s failed: %v", path, err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(raw)
+}
+
+func TestGraphQLAPI_TokenAuthMaskingAndProjectScope(t *testing.T) {
+	env, client := setupIntegrationServer(t)
+	loginAs(t, client, env.server.URL, "admin", "Admin123!Receipter")
+
+	resp := postForm(t, client, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+	resp = postForm(t, client, env.server.URL, "/tasker/api/pallets/1/receipts", url.Values{
+		"sku":          {"SKU-GQL"},
+		"description":  {"GraphQL item"},
+		"qty":          {"4"},
+		"case_size":    {"1"},
+		"batch_number": {"G1"},
+		"expiry_date":  {"2030-01-15"},
+	})
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected receipt create 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	otherProjectID := int64(0)
+	err := env.db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+INSERT INTO projects (name, description, project_date, client_name, code, status, created_at, updated_at)
+VALUES ('Other Client', 'other', DATE('now'), 'Other', 'other-client', 'active', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`)
+		if err != nil {
+			return err
+		}
+		otherProjectID, err = res.LastInsertId()
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed other project: %v", err)
+	}
+	seedClientUser(t, env.db, "client1", "Client123!Receipter", 1)
+
+	resp = postForm(t, client, env.server.URL, "/tasker/admin/api-tokens", url.Values{
+		"user_id": {strconv.FormatInt(userIDByUsername(t, env.db, "client1"), 10)},
+		"name":    {"Client BI"},
+	})
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected issue token page 200, got %d", resp.StatusCode)
+	}
+	clientToken := regexp.MustCompile(`rcpt_[0-9a-f]{48}`).FindString(string(body))
+	if clientToken == "" {
+		t.Fatalf("expected issued token to be shown once")
+	}
+	adminID := userIDByUsername(t, env.db, "admin")
+	adminToken, _, err := apitoken.Issue(context.Background(), env.db, nil, adminID, adminID, "Admin BI")
+	if err != nil {
+		t.Fatalf("issue admin token: %v", err)
+	}
+
+	if status, _ := postGraphQL(t, env.server.URL, "", `{"query":"{ projects { id } }"}`); status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", status)
+	}
+	if status, _ := postGraphQL(t, env.server.URL, "rcpt_nope", `{"query":"{ projects { id } }"}`); status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for invalid token, got %d", status)
+	}
+
+	query := `{"query":"query($p: Int!) { receipts(projectId: $p) { sku qty scannedBy } }","variables":{"p":1}}`
+	status, out := postGraphQL(t, env.server.URL, clientToken, query)
+	if status != http.StatusOK || !strings.Contains(out, `"sku":"SKU-GQL","qty":4,"scannedBy":null`) {
+		t.Fatalf("expected client to see masked receipts, status=%d body=%s", status, out)
+	}
+	status, out = postGraphQL(t, env.server.URL, adminToken, query)
+	if status != http.StatusOK || !strings.Contains(out, `"scannedBy":"admin"`) {
+		t.Fatalf("expected admin to see scannedBy, status=%d body=%s", status, out)
+	}
+
+	err = env.db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO receipt_photos (id, pallet_receipt_id, photo_blob, photo_mime) VALUES (1, 1, X'FFD8', 'image/jpeg'), (2, 1, X'FFD8', 'image/jpeg')`,
+			`INSERT INTO internal_photos (source, photo_id, pallet_receipt_id) VALUES ('receipt_photos', 2, 1)`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed photos: %v", err)
+	}
+	photoQuery := `{"query":"query($p: Int!) { receipts(projectId: $p) { photoCount } }","variables":{"p":1}}`
+	if status, out := postGraphQL(t, env.server.URL, clientToken, photoQuery); status != http.StatusOK || !strings.Contains(out, `"photoCount":1`) {
+		t.Fatalf("expected client photo count without the internal photo, status=%d body=%s", status, out)
+	}
+	if status, out := postGraphQL(t, env.server.URL, adminToken, photoQuery); status != http.StatusOK || !strings.Contains(out, `"photoCount":2`) {
+		t.Fatalf("expected admin photo count with the internal photo, status=%d body=%s", status, out)
+	}
+
+	status, out = postGraphQL(t, env.server.URL, clientToken, `{"query":"{ projects { id } }"}`)
+	if status != http.StatusOK || out != "{\"data\":{\"projects\":[{\"id\":1}]}}\n" {
+		t.Fatalf("expected client to see only assigned project, status=%d body=%s", status, out)
+	}
+	status, out = postGraphQL(t, env.server.URL, clientToken, `{"query":"{ pallets(projectId: `+strconv.FormatInt(otherProjectID, 10)+`) { id } }"}`)
+	if status != http.StatusOK || !strings.Contains(out, "project not found") {
+		t.Fatalf("expected client to be denied other project, status=%d body=%s", status, out)
+	}
+
+	status, out = postGraphQL(t, env.server.URL, adminToken, `{"query":"{ projects { pallets(first: 500) { receipts(first: 500) { id } } } }"}`)
+	if status != http.StatusBadRequest || !strings.Contains(out, "query cost") {
+		t.Fatalf("expected cost limit rejection, status=%d body=%s", status, out)
+	}
+
+	resp = postForm(t, client, env.server.URL, "/tasker/admin/api-tokens/1/revoke", nil)
+	_ = resp.Body.Close()
+	if status, _ := postGraphQL(t, env.server.URL, clientToken, `{"query":"{ projects { id } }"}`); status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for revoked token, got %d", status)
+	}
+}
+
+func TestUnknownSKUQueue_AdminResolvesScannerDenied(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	adminClient := newHTTPClient(t)
+	scannerClient := newHTTPClient(t)
+
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+	err := env.db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO pallet_receipts (project_id, pallet_id, sku, description, scanned_by_user_id, qty, unknown_sku, item_barcode, stock_photo_blob)
+SELECT project_id, id, 'UNKNOWN', 'Unidentifiable item', 1, 4, 1, '5011111111111', X'FFD8' FROM pallets WHERE id = 1`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed unknown line: %v", err)
+	}
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/pallets/progress")
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), "1 unknown SKU line is awaiting resolution.") {
+		t.Fatalf("expected unresolved count on progress dashboard")
+	}
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/pallets/unknown-skus")
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "5011111111111") {
+		t.Fatalf("expected unknown queue with line barcode, status=%d", resp.StatusCode)
+	}
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/pallets/unknown-skus/1/resolve", url.Values{
+		"sku":            {"SKU-FOUND"},
+		"description":    {"Found item"},
+		"add_to_catalog": {"1"},
+		"add_alias":      {"1"},
+		"alias_barcode":  {"5011111111111"},
+	})
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=") {
+		t.Fatalf("expected resolve redirect with status, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if id := stockItemIDBySKU(t, env.db, "SKU-FOUND"); id <= 0 {
+		t.Fatalf("expected resolved sku added to catalog")
+	}
+
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+	resp = get(t, scannerClient, env.server.URL, "/tasker/pallets/unknown-skus")
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "/login") {
+		t.Fatalf("expected scanner denied unknown sku queue, got %d", resp.StatusCode)
+	}
+}
+
+func TestReceiptLiveStream_PresenceAndPushedLines(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	adminClient := newHTTPClient(t)
+	scannerClient := newHTTPClient(t)
+
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected create pallet 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, scannerClient, env.server.URL, "/tasker/pallets/1/receipt")
+	pageBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read receipt page body: %v", err)
+	}
+	_ = resp.Body.Close()
+	if !strings.Contains(string(pageBody), `id="receipt-lines"`) || !strings.Contains(string(pageBody), `id="receipt-stats"`) || !strings.Contains(string(pageBody), "/tasker/pallets/1/receipt/live") {
+		t.Fatalf("expected receipt page to include live regions and stream subscription")
+	}
+
+	scannerEvents := openLiveStream(t, scannerClient, env.server.URL+"/tasker/pallets/1/receipt/live")
+	scannerEvents.waitFor(t, "presence", "")
+	adminEvents := openLiveStream(t, adminClient, env.server.URL+"/tasker/pallets/1/receipt/live")
+	adminEvents.waitFor(t, "presence", "scanner1 is also on this pallet.")
+	scannerEvents.waitFor(t, "presence", "admin is also on this pallet.")
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/api/pallets/1/receipts", url.Values{
+		"sku":       {"SKU-LIVE-1"},
+		"qty":       {"3"},
+		"case_size": {"1"},
+	})
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected add receipt line 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	scannerEvents.waitFor(t, "lines", "SKU-LIVE-1")
+	// The stats strip follows each lines event with the pallet's new totals.
+	scannerEvents.waitFor(t, "stats", ">3</div>")
+}
+
+type liveStream struct {
+	events chan [2]string
+}
+
+// openLiveStream reads server-sent events in the background until the test ends.
+func openLiveStream(t *testing.T, client *http.Client, streamURL string) *liveStream {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		t.Fatalf("build stream request: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("expected event stream 200, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	stream := &liveStream{events: make(chan [2]string, 16)}
+	go func() {
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		var event string
+		var data []string
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = append(data, strings.TrimPrefix(line, "data: "))
+			case line == "" && event != "":
+				stream.events <- [2]string{event, strings.Join(data, "\n")}
+				event, data = "", nil
+			}
+		}
+		close(stream.events)
+	}()
+	return stream
+}
+
+func (s *liveStream) waitFor(t *testing.T, event, contains string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case evt, ok := <-s.events:
+			if !ok {
+				t.Fatalf("stream closed while waiting for %s event containing %q", event, contains)
+			}
+			if evt[0] == event && strings.Contains(evt[1], contains) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s event containing %q", event, contains)
+		}
+	}
+}
+
+func TestCreatePalletsAPI_AdminTokenCreatesPalletsWithAttributes(t *testing.T) {
+	env, client := setupIntegrationServer(t)
+	seedClientUser(t, env.db, "client1", "Client123!Receipter", 1)
+
+	adminID := userIDByUsername(t, env.db, "admin")
+	adminToken, _, err := apitoken.Issue(context.Background(), env.db, nil, adminID, adminID, "Admin WMS")
+	if err != nil {
+		t.Fatalf("issue admin token: %v", err)
+	}
+	clientID := userIDByUsername(t, env.db, "client1")
+	clientToken, _, err := apitoken.Issue(context.Background(), env.db, nil, adminID, clientID, "Client WMS")
+	if err != nil {
+		t.Fatalf("issue client token: %v", err)
+	}
+
+	body := `{"projectId":1,"count":2,"palletType":"EUR","deliveryReference":"ASN-42"}`
+	if status, _ := postAPIJSON(t, env.server.URL, "/api/pallets", "", body); status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", status)
+	}
+	if status, _ := postAPIJSON(t, env.server.URL, "/api/pallets", clientToken, body); status != http.StatusForbidden {
+		t.Fatalf("expected 403 for client token, got %d", status)
+	}
+	status, out := postAPIJSON(t, env.server.URL, "/api/pallets", adminToken, `{"projectId":1,"count":0}`)
+	if status != http.StatusBadRequest || !strings.Contains(out, `"errors"`) {
+		t.Fatalf("expected 400 for zero count, status=%d body=%s", status, out)
+	}
+	if status, _ := postAPIJSON(t, env.server.URL, "/api/pallets", adminToken, `{"projectId":999}`); status != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown project, got %d", status)
+	}
+
+	status, out = postAPIJSON(t, env.server.URL, "/api/pallets", adminToken, body)
+	if status != http.StatusCreated {
+		t.Fatalf("expected 201, status=%d body=%s", status, out)
+	}
+	var created struct {
+		ProjectID int64 `json:"projectId"`
+		Pallets   []struct {
+			ID                int64  `json:"id"`
+			Code              string `json:"code"`
+			PalletType        string `json:"palletType"`
+			DeliveryReference string `json:"deliveryReference"`
+			LabelURL          string `json:"labelUrl"`
+		} `json:"pallets"`
+	}
+	if err := json.Unmarshal([]byte(out), &created); err != nil {
+		t.Fatalf("decode response: %v body=%s", err, out)
+	}
+	if created.ProjectID != 1 || len(created.Pallets) != 2 {
+		t.Fatalf("expected 2 pallets for project 1, got %+v", created)
+	}
+	first := created.Pallets[0]
+	if first.Code != fmt.Sprintf("P%08d", first.ID) || first.LabelURL != fmt.Sprintf("/tasker/pallets/%d/label", first.ID) {
+		t.Fatalf("unexpected pallet code or label url: %+v", first)
+	}
+	if first.PalletType != "EUR" || first.DeliveryReference != "ASN-42" {
+		t.Fatalf("unexpected pallet attributes: %+v", first)
+	}
+
+	loginAs(t, client, env.server.URL, "admin", "Admin123!Receipter")
+	resp := get(t, client, env.server.URL, fmt.Sprintf("/tasker/pallets/%d/receipt", first.ID))
+	page, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(page), "Delivery ASN-42") {
+		t.Fatalf("expected receipt page to show delivery reference, status=%d", resp.StatusCode)
+	}
+}
+
+func TestPalletsAPIV1_ScannerTokenReceiptsAndQueriesPallet(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	seedClientUser(t, env.db, "client1", "Client123!Receipter", 1)
+	adminID := userIDByUsername(t, env.db, "admin")
+	adminToken, _, err := apitoken.Issue(context.Background(), env.db, nil, adminID, adminID, "Admin WMS")
+	if err != nil {
+		t.Fatalf("issue admin token: %v", err)
+	}
+	scannerToken, _, err := apitoken.Issue(context.Background(), env.db, nil, adminID, userIDByUsername(t, env.db, "scanner1"), "Handheld app")
+	if err != nil {
+		t.Fatalf("issue scanner token: %v", err)
+	}
+	clientToken, _, err := apitoken.Issue(context.Background(), env.db, nil, adminID, userIDByUsername(t, env.db, "client1"), "Client WMS")
+	if err != nil {
+		t.Fatalf("issue client token: %v", err)
+	}
+
+	if status, _ := postAPIJSON(t, env.server.URL, "/api/v1/pallets", scannerToken, `{"projectId":1}`); status != http.StatusForbidden {
+		t.Fatalf("expected 403 for scanner creating pallets, got %d", status)
+	}
+	status, out := postAPIJSON(t, env.server.URL, "/api/v1/pallets", adminToken, `{"projectId":1,"deliveryReference":"ASN-7"}`)
+	if status != http.StatusCreated {
+		t.Fatalf("expected 201, status=%d body=%s", status, out)
+	}
+	var created struct {
+		Pallets []struct {
+			ID int64 `json:"id"`
+		} `json:"pallets"`
+	}
+	if err := json.Unmarshal([]byte(out), &created); err != nil || len(created.Pallets) != 1 {
+		t.Fatalf("decode created pallet: %v body=%s", err, out)
+	}
+	receiptsPath := fmt.Sprintf("/api/v1/pallets/%d/receipts", created.Pallets[0].ID)
+
+	status, out = postAPIJSON(t, env.server.URL, receiptsPath, scannerToken, `{"sku":"","qty":0,"damagedQty":1}`)
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for an invalid line, status=%d body=%s", status, out)
+	}
+	for _, want := range []string{`"field":"sku"`, `"field":"qty"`, `"field":"damageReason"`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %s in field errors, got %s", want, out)
+		}
+	}
+	if status, _ := postAPIJSON(t, env.server.URL, receiptsPath, clientToken, `{"sku":"SKU-API","qty":1}`); status != http.StatusForbidden {
+		t.Fatalf("expected 403 for client adding receipts, got %d", status)
+	}
+
+	line := `{"sku":"SKU-API","description":"API item","qty":6,"caseSize":2,"batchNumber":"B-1","expiryDate":"2030-01-15","idempotencyKey":"line-1"}`
+	status, out = postAPIJSON(t, env.server.URL, receiptsPath, scannerToken, line)
+	if status != http.StatusCreated || !strings.Contains(out, `"sku":"SKU-API"`) || !strings.Contains(out, `"expiryDate":"2030-01-15"`) {
+		t.Fatalf("expected the line back with 201, status=%d body=%s", status, out)
+	}
+	if status, out := postAPIJSON(t, env.server.URL, receiptsPath, scannerToken, line); status != http.StatusConflict {
+		t.Fatalf("expected a retried idempotency key to be refused, status=%d body=%s", status, out)
+	}
+
+	resp, out := getAPI(t, env.server.URL, "/api/v1/pallets?projectId=1", clientToken, "")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(out, `"deliveryReference":"ASN-7"`) || !strings.Contains(out, `"totalQty":6`) {
+		t.Fatalf("expected the client to list the pallet, status=%d body=%s", resp.StatusCode, out)
+	}
+	resp, out = getAPI(t, env.server.URL, fmt.Sprintf("/api/v1/pallets/%d", created.Pallets[0].ID), clientToken, "")
+	var pallet struct {
+		Pallet struct {
+			LineCount int64 `json:"lineCount"`
+		} `json:"pallet"`
+		Receipts []struct {
+			SKU string `json:"sku"`
+			Qty int64  `json:"qty"`
+		} `json:"receipts"`
+	}
+	if err := json.Unmarshal([]byte(out), &pallet); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("decode pallet: %v status=%d body=%s", err, resp.StatusCode, out)
+	}
+	if pallet.Pallet.LineCount != 1 || len(pallet.Receipts) != 1 || pallet.Receipts[0].Qty != 6 {
+		t.Fatalf("expected one line of 6 on the pallet, got %s", out)
+	}
+
+	if _, err := env.db.W.ExecContext(context.Background(), `DELETE FROM client_project_access`); err != nil {
+		t.Fatalf("revoke client access: %v", err)
+	}
+	if resp, _ := getAPI(t, env.server.URL, receiptsPath, clientToken, ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for a client without the project, got %d", resp.StatusCode)
+	}
+}
+
+func getAPI(t *testing.T, baseURL, path, token, etag string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, baseURL+path, nil)
+	if err != nil {
+		t.Fatalf("build api request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", path, err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	return resp, string(raw)
+}
+
+func TestProjectKPIAPI_ServesDailySnapshotsWithETag(t *testing.T) {
+	env, client := setupIntegrationServer(t)
+	loginAs(t, client, env.server.URL, "admin", "Admin123!Receipter")
+	resp := postForm(t, client, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+	resp = postForm(t, client, env.server.URL, "/tasker/api/pallets/1/receipts", url.Values{
+		"sku":          {"SKU-KPI"},
+		"description":  {"KPI item"},
+		"qty":          {"4"},
+		"case_size":    {"1"},
+		"batch_number": {"K1"},
+		"expiry_date":  {"2030-01-15"},
+	})
+	_ = resp.Body.Close()
+	if err := kpi.Capture(context.Background(), env.db, time.Now()); err != nil {
+		t.Fatalf("capture snapshots: %v", err)
+	}
+
+	seedClientUser(t, env.db, "client1", "Client123!Receipter", 1)
+	adminID := userIDByUsername(t, env.db, "admin")
+	adminToken, _, err := apitoken.Issue(context.Background(), env.db, nil, adminID, adminID, "Admin BI")
+	if err != nil {
+		t.Fatalf("issue admin token: %v", err)
+	}
+	clientToken, _, err := apitoken.Issue(context.Background(), env.db, nil, adminID, userIDByUsername(t, env.db, "client1"), "Client BI")
+	if err != nil {
+		t.Fatalf("issue client token: %v", err)
+	}
+
+	resp, out := getAPI(t, env.server.URL, "/api/projects/1/kpis", clientToken, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for assigned client, status=%d body=%s", resp.StatusCode, out)
+	}
+	var series struct {
+		Project struct {
+			ID int64 `json:"id"`
+		} `json:"project"`
+		Days []struct {
+			Date            string           `json:"date"`
+			UnitsReceived   int64            `json:"unitsReceived"`
+			PalletsByStatus map[string]int64 `json:"palletsByStatus"`
+			DamageRate      float64          `json:"damageRate"`
+		} `json:"days"`
+	}
+	if err := json.Unmarshal([]byte(out), &series); err != nil {
+		t.Fatalf("decode response: %v body=%s", err, out)
+	}
+	if series.Project.ID != 1 || len(series.Days) != 1 || series.Days[0].UnitsReceived != 4 || series.Days[0].PalletsByStatus["open"] != 1 {
+		t.Fatalf("expected today's snapshot with 4 units on 1 open pallet, got %s", out)
+	}
+
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatalf("expected an ETag")
+	}
+	if resp, _ := getAPI(t, env.server.URL, "/api/projects/1/kpis", clientToken, etag); resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected 304 for a current ETag, got %d", resp.StatusCode)
+	}
+	if resp, _ := getAPI(t, env.server.URL, "/api/projects/1/kpis?from=2020-01-01", adminToken, etag); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a range over a year, got %d", resp.StatusCode)
+	}
+
+	otherProjectID := int64(0)
+	if err := env.db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+INSERT INTO projects (name, description, project_date, client_name, code, status, created_at, updated_at)
+VALUES ('Other Client', 'other', DATE('now'), 'Other', 'other-client', 'active', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`)
+		if err != nil {
+			return err
+		}
+		otherProjectID, err = res.LastInsertId()
+		return err
+	}); err != nil {
+		t.Fatalf("seed other project: %v", err)
+	}
+	otherPath := fmt.Sprintf("/api/projects/%d/kpis", otherProjectID)
+	if resp, _ := getAPI(t, env.server.URL, otherPath, clientToken, ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unassigned project, got %d", resp.StatusCode)
+	}
+	if resp, _ := getAPI(t, env.server.URL, otherPath, adminToken, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected admin to read any project, got %d", resp.StatusCode)
+	}
+}
+
+func TestChangesAPI_StreamsProjectScopedAuditEvents(t *testing.T) {
+	env, client := setupIntegrationServer(t)
+	loginAs(t, client, env.server.URL, "admin", "Admin123!Receipter")
+	resp := postForm(t, client, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+	resp = postForm(t, client, env.server.URL, "/tasker/api/pallets/1/receipts", url.Values{
+		"sku":          {"SKU-FEED"},
+		"description":  {"Feed item"},
+		"qty":          {"2"},
+		"case_size":    {"1"},
+		"batch_number": {"F1"},
+		"expiry_date":  {"2030-01-15"},
+	})
+	_ = resp.Body.Close()
+	resp = postForm(t, client, env.server.URL, "/tasker/api/pallets/1/close", nil)
+	_ = resp.Body.Close()
+
+	seedClientUser(t, env.db, "client1", "Client123!Receipter", 1)
+	adminID := userIDByUsername(t, env.db, "admin")
+	clientToken, _, err := apitoken.Issue(context.Background(), env.db, nil, adminID, userIDByUsername(t, env.db, "client1"), "Client CDC")
+	if err != nil {
+		t.Fatalf("issue client token: %v", err)
+	}
+
+	type feedPage struct {
+		Events []struct {
+			ID         int64  `json:"id"`
+			Action     string `json:"action"`
+			EntityType string `json:"entityType"`
+			ProjectID  *int64 `json:"projectId"`
+		} `json:"events"`
+		NextCursor int64 `json:"nextCursor"`
+		HasMore    bool  `json:"hasMore"`
+	}
+	resp, out := getAPI(t, env.server.URL, "/api/changes?entity=pallets,pallet_receipts", clientToken, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, status=%d body=%s", resp.StatusCode, out)
+	}
+	var page feedPage
+	if err := json.Unmarshal([]byte(out), &page); err != nil {
+		t.Fatalf("decode response: %v body=%s", err, out)
+	}
+	actions := make([]string, 0, len(page.Events))
+	for i, event := range page.Events {
+		if event.ProjectID == nil || *event.ProjectID != 1 {
+			t.Fatalf("expected only project 1 events, got %s", out)
+		}
+		if i > 0 && event.ID <= page.Events[i-1].ID {
+			t.Fatalf("expected events in id order, got %s", out)
+		}
+		actions = append(actions, event.Action)
+	}
+	if !slices.Contains(actions, "receipt.create") || !slices.Contains(actions, "pallet.close") {
+		t.Fatalf("expected receipt creation and pallet close events, got %v", actions)
+	}
+
+	resp, out = getAPI(t, env.server.URL, "/api/changes?after="+strconv.FormatInt(page.NextCursor, 10), clientToken, "")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(out, `"events":[]`) {
+		t.Fatalf("expected no events after the cursor, status=%d body=%s", resp.StatusCode, out)
+	}
+	if resp, _ := getAPI(t, env.server.URL, "/api/changes?project=999", clientToken, ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unassigned project, got %d", resp.StatusCode)
+	}
+	if resp, _ := getAPI(t, env.server.URL, "/api/changes?entity=users", clientToken, ""); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown entity, got %d", resp.StatusCode)
+	}
+}
+
+func TestDeferredPhotoUpload_ReceiptAcceptedBeforePhotosArrive(t *testing.T) {
+	env, adminClient := setupIntegrationServer(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+
+	scannerClient := newHTTPClient(t)
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+
+	photo := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{9}, 40)...)
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	fields := [][2]string{
+		{"_csrf", csrfToken(t, scannerClient, env.server.URL)},
+		{"unknown_sku", "1"},
+		{"qty", "2"},
+		{"case_size", "1"},
+		{"deferred_photo_name", "label.png"},
+		{"deferred_photo_type", "image/png"},
+		{"deferred_photo_size", strconv.Itoa(len(photo))},
+	}
+	for _, field := range fields {
+		if err := writer.WriteField(field[0], field[1]); err != nil {
+			t.Fatalf("write field %s: %v", field[0], err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close multipart writer: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, env.server.URL+"/tasker/api/pallets/1/receipts", &body)
+	if err != nil {
+		t.Fatalf("build receipt request: %v", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Accept", "application/json")
+	resp, err = scannerClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST receipt failed: %v", err)
+	}
+	var saved struct {
+		ReceiptID int64  `json:"receiptId"`
+		Redirect  string `json:"redirect"`
+		Uploads   []struct {
+			URL    string `json:"url"`
+			Status string `json:"status"`
+		} `json:"uploads"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&saved)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || err != nil {
+		t.Fatalf("expected JSON receipt response, status=%d err=%v", resp.StatusCode, err)
+	}
+	if saved.ReceiptID <= 0 || saved.Redirect != "/tasker/pallets/1/receipt" || len(saved.Uploads) != 1 || saved.Uploads[0].Status != "uploading" {
+		t.Fatalf("unexpected receipt response: %+v", saved)
+	}
+
+	resp = get(t, scannerClient, env.server.URL, "/tasker/pallets/1/receipt")
+	page, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(page), "photos pending") {
+		t.Fatalf("expected line to show photos pending")
+	}
+
+	putChunk := func(offset int, chunk []byte) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPut, env.server.URL+saved.Uploads[0].URL+"?offset="+strconv.Itoa(offset), bytes.NewReader(chunk))
+		if err != nil {
+			t.Fatalf("build chunk request: %v", err)
+		}
+		req.Header.Set("X-CSRF-Token", csrfToken(t, scannerClient, env.server.URL))
+		resp, err := scannerClient.Do(req)
+		if err != nil {
+			t.Fatalf("PUT chunk failed: %v", err)
+		}
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(raw)
+	}
+	if status, out := putChunk(0, photo[:20]); status != http.StatusOK || !strings.Contains(out, `"receivedBytes":20`) {
+		t.Fatalf("expected first chunk accepted, status=%d body=%s", status, out)
+	}
+	if status, out := putChunk(0, photo[:20]); status != http.StatusConflict || !strings.Contains(out, `"receivedBytes":20`) {
+		t.Fatalf("expected repeated chunk to report resume offset, status=%d body=%s", status, out)
+	}
+	if status, out := putChunk(20, photo[20:]); status != http.StatusOK || !strings.Contains(out, `"status":"queued"`) {
+		t.Fatalf("expected upload queued after last chunk, status=%d body=%s", status, out)
+	}
+
+	if processed, err := env.app.PhotoUploads.ProcessPending(context.Background()); err != nil || processed != 1 {
+		t.Fatalf("expected one upload processed, got %d err=%v", processed, err)
+	}
+	resp = get(t, scannerClient, env.server.URL, saved.Uploads[0].URL)
+	raw, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(raw), `"status":"done"`) {
+		t.Fatalf("expected upload done, body=%s", raw)
+	}
+
+	resp = get(t, scannerClient, env.server.URL, "/tasker/pallets/1/receipt")
+	page, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if strings.Contains(string(page), "photos pending") {
+		t.Fatalf("expected photos pending badge to clear after processing")
+	}
+	if !strings.Contains(string(page), fmt.Sprintf("/tasker/api/pallets/1/receipts/%d/photos/", saved.ReceiptID)) {
+		t.Fatalf("expected processed photo link on the line")
+	}
+}
+
+func TestAdminStoragePage_AdminAllowedScannerDenied(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	adminClient := newHTTPClient(t)
+	scannerClient := newHTTPClient(t)
+
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp := get(t, adminClient, env.server.URL, "/tasker/admin/storage")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected admin storage page 200, got %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read storage body: %v", err)
+	}
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), "Photos by Project") || !strings.Contains(string(body), "pallet_receipts") {
+		t.Fatalf("expected storage report sections")
+	}
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/admin/storage/prune", url.Values{"project_id": {"1"}, "dry_run": {"1"}})
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected prune redirect 303, got %d", resp.StatusCode)
+	}
+	if location := resp.Header.Get("Location"); !strings.Contains(location, "error=") || !strings.Contains(location, "inactive") {
+		t.Fatalf("expected active project prune refused, got %s", location)
+	}
+	_ = resp.Body.Close()
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/admin/storage/vacuum", nil)
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=") {
+		t.Fatalf("expected vacuum success redirect, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+	resp = get(t, scannerClient, env.server.URL, "/tasker/admin/storage")
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected scanner storage page denied with 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+}
+
+func TestExportFormatVersion_PinnedAndUnsupported(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	client := newHTTPClient(t)
+	loginAs(t, client, env.server.URL, "admin", "Admin123!Receipter")
+
+	resp := get(t, client, env.server.URL, "/tasker/exports/receipts.csv?project_id=1&format_version=1")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected pinned export 200, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("X-Export-Format-Version"); got != "1" {
+		t.Fatalf("expected format version header 1, got %q", got)
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, client, env.server.URL, "/tasker/exports/receipts.csv?project_id=1&format_version=99")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected unsupported format version 400, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, client, env.server.URL, "/tasker/pallets/sku-view/export-summary.csv?project_id=1&format_version=abc")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected invalid sku format version 400, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	var params string
+	err := env.db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT params FROM export_runs WHERE export_type = 'receipts_csv' ORDER BY id DESC LIMIT 1`).Scan(ctx, &params)
+	})
+	if err != nil {
+		t.Fatalf("load export run: %v", err)
+	}
+	if params != "format_version=1" {
+		t.Fatalf("expected export run to record format version, got %q", params)
+	}
+}
+
+func TestProjectCustomFields_CapturedOnReceiptAndExported(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	adminClient := newHTTPClient(t)
+	scannerClient := newHTTPClient(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+
+	resp := postForm(t, scannerClient, env.server.URL, "/tasker/projects/1/custom-fields", url.Values{"label": {"Country of origin"}})
+	if resp.StatusCode != http.StatusSeeOther || strings.Contains(resp.Header.Get("Location"), "custom-fields") {
+		t.Fatalf("expected scanner to be denied, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/projects/1/custom-fields", url.Values{
+		"label":      {"Country of origin"},
+		"field_type": {"text"},
+		"required":   {"1"},
+		"sort_order": {"10"},
+	})
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=") {
+		t.Fatalf("expected custom field create redirect with status, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/projects/1/custom-fields")
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "country_of_origin") {
+		t.Fatalf("expected custom fields page to list the field, got %d", resp.StatusCode)
+	}
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+	resp = get(t, scannerClient, env.server.URL, "/tasker/pallets/1/receipt")
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), `name="custom_field_1"`) {
+		t.Fatalf("expected receipt form to render the custom field input")
+	}
+
+	receipt := url.Values{"sku": {"SKU-CF"}, "description": {"Custom"}, "qty": {"2"}, "case_size": {"1"}}
+	resp = postForm(t, scannerClient, env.server.URL, "/tasker/api/pallets/1/receipts", receipt)
+	if location := resp.Header.Get("Location"); !strings.Contains(location, "error=") || !strings.Contains(location, "required") {
+		t.Fatalf("expected missing required custom field error, got %q", location)
+	}
+	_ = resp.Body.Close()
+
+	receipt.Set("custom_field_1", "Viet Nam")
+	resp = postForm(t, scannerClient, env.server.URL, "/tasker/api/pallets/1/receipts", receipt)
+	if location := resp.Header.Get("Location"); resp.StatusCode != http.StatusSeeOther || strings.Contains(location, "error=") {
+		t.Fatalf("expected receipt create 303 without error, got %d %q", resp.StatusCode, location)
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, scannerClient, env.server.URL, "/tasker/pallets/1/receipt")
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), "Country of origin: Viet Nam") {
+		t.Fatalf("expected recorded line to show the custom field value")
+	}
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/exports/receipts.csv?project_id=1")
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "custom_country_of_origin") || !strings.Contains(string(body), "Viet Nam") {
+		t.Fatalf("expected latest receipts export to include custom field column, got %d %q", resp.StatusCode, body)
+	}
+	resp = get(t, adminClient, env.server.URL, "/tasker/exports/receipts.csv?project_id=1&format_version=1")
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if strings.Contains(string(body), "custom_country_of_origin") {
+		t.Fatalf("expected pinned v1 receipts export to omit custom field columns")
+	}
+}
+
+func TestProjectBundleExport_AdminDownloadsVerifiableBundle(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+
+	adminClient := newHTTPClient(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp := get(t, adminClient, env.server.URL, "/tasker/projects/1/bundle")
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/zip" {
+		t.Fatalf("expected bundle download, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	manifest, _, err := projectbundle.Verify(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("verify downloaded bundle: %v", err)
+	}
+	if manifest.SourceProjectID != 1 {
+		t.Fatalf("expected bundle for project 1, got %d", manifest.SourceProjectID)
+	}
+
+	scannerClient := newHTTPClient(t)
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+	resp = get(t, scannerClient, env.server.URL, "/tasker/projects/1/bundle")
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected scanner to be denied bundle export, got %d", resp.StatusCode)
+	}
+}
+
+func TestSchemaBehind_BlocksWritesAndWarnsAdminsUntilRetried(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+
+	if err := env.db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE schema_migrations SET status = 'failed', error = 'disk I/O error' WHERE version = '013_receipt_custom_fields.sql'`)
+		return err
+	}); err != nil {
+		t.Fatalf("mark migration failed: %v", err)
+	}
+	env.app.Schema.Refresh(context.Background())
+
+	adminClient := newHTTPClient(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	scannerClient := newHTTPClient(t)
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+
+	resp := postForm(t, scannerClient, env.server.URL, "/tasker/projects/1/activate", nil)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected write to be blocked with 503, got %d", resp.StatusCode)
+	}
+
+	resp = get(t, scannerClient, env.server.URL, "/tasker/projects")
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || strings.Contains(string(body), "Writes are blocked") {
+		t.Fatalf("expected scanner reads to work without the admin banner, got %d", resp.StatusCode)
+	}
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/projects")
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), "database schema is behind: 1 failed migrations") {
+		t.Fatalf("expected admin banner on projects page")
+	}
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/admin/system")
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "disk I/O error") {
+		t.Fatalf("expected system page to list the failed migration, got %d", resp.StatusCode)
+	}
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/admin/system/migrations/retry", nil)
+	_ = resp.Body.Close()
+	if location := resp.Header.Get("Location"); resp.StatusCode != http.StatusSeeOther || !strings.Contains(location, "up+to+date") {
+		t.Fatalf("expected retry to bring schema up to date, got %d %q", resp.StatusCode, location)
+	}
+
+	resp = postForm(t, scannerClient, env.server.URL, "/tasker/projects/1/activate", nil)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected writes to resume after retry, got %d", resp.StatusCode)
+	}
+}
+
+func TestMaintenanceMode_ReadOnlyUntilLifted(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	flagFile := filepath.Join(t.TempDir(), "maintenance")
+	env.app.Maintenance.FlagFile = flagFile
+
+	adminClient := newHTTPClient(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	scannerClient := newHTTPClient(t)
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+	adminID := userIDByUsername(t, env.db, "admin")
+	token, _, err := apitoken.Issue(context.Background(), env.db, nil, adminID, adminID, "Admin WMS")
+	if err != nil {
+		t.Fatalf("issue token: %v", err)
+	}
+
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/admin/system/maintenance", url.Values{
+		"enabled": {"1"},
+		"message": {"Nightly backup running"},
+	})
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected maintenance toggle redirect, got %d", resp.StatusCode)
+	}
+
+	resp = postForm(t, scannerClient, env.server.URL, "/tasker/projects/1/activate", nil)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || !strings.Contains(string(body), "Nightly backup running") {
+		t.Fatalf("expected friendly 503 for browser write, got %d", resp.StatusCode)
+	}
+	status, out := postAPIJSON(t, env.server.URL, "/api/pallets", token, `{"projectId":1,"count":1}`)
+	if status != http.StatusServiceUnavailable || !strings.Contains(out, `"errors"`) {
+		t.Fatalf("expected JSON 503 for API write, status=%d body=%s", status, out)
+	}
+	for _, path := range []string{"/password/forgot", "/password/reset"} {
+		anonymous := newHTTPClient(t)
+		resp = get(t, anonymous, env.server.URL, "/login")
+		_ = resp.Body.Close()
+		resp = postForm(t, anonymous, env.server.URL, path, url.Values{"username": {"client1"}, "token": {"x"}})
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("expected %s to be refused during maintenance, got %d", path, resp.StatusCode)
+		}
+	}
+
+	resp = get(t, scannerClient, env.server.URL, "/tasker/projects")
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "Nightly backup running") {
+		t.Fatalf("expected reads to work with the maintenance banner, got %d", resp.StatusCode)
+	}
+	resp = get(t, adminClient, env.server.URL, "/tasker/exports/receipts.csv")
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected exports to keep working, got %d", resp.StatusCode)
+	}
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/admin/system/maintenance", url.Values{"enabled": {"0"}})
+	_ = resp.Body.Close()
+	resp = postForm(t, scannerClient, env.server.URL, "/tasker/projects/1/activate", nil)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected writes to resume after maintenance ends, got %d", resp.StatusCode)
+	}
+
+	// The flag file keeps the app read-only regardless of the admin switch.
+	if err := os.WriteFile(flagFile, []byte("Restoring from backup\n"), 0o600); err != nil {
+		t.Fatalf("write flag file: %v", err)
+	}
+	resp = postForm(t, scannerClient, env.server.URL, "/tasker/projects/1/activate", nil)
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || !strings.Contains(string(body), "Restoring from backup") {
+		t.Fatalf("expected flag file to block writes, got %d", resp.StatusCode)
+	}
+	if err := os.Remove(flagFile); err != nil {
+		t.Fatalf("remove flag file: %v", err)
+	}
+	resp = postForm(t, scannerClient, env.server.URL, "/tasker/projects/1/activate", nil)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected writes to resume once the flag file is removed, got %d", resp.StatusCode)
+	}
+
+	var actions []string
+	if err := env.db.R.NewRaw(`SELECT action FROM audit_logs WHERE entity_type = 'system' ORDER BY id`).Scan(context.Background(), &actions); err != nil {
+		t.Fatalf("load audit: %v", err)
+	}
+	if strings.Join(actions, ",") != "maintenance.enable,maintenance.disable" {
+		t.Fatalf("unexpected maintenance audit actions %v", actions)
+	}
+}
+
+func TestDeliveryBooking_APIBookGatehouseCheckInAndDashboard(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	seedClientUser(t, env.db, "client1", "Client123!Receipter", 1)
+	adminClient := newHTTPClient(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	scannerClient := newHTTPClient(t)
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+
+	adminID := userIDByUsername(t, env.db, "admin")
+	adminToken, _, err := apitoken.Issue(context.Background(), env.db, nil, adminID, adminID, "Admin WMS")
+	if err != nil {
+		t.Fatalf("issue admin token: %v", err)
+	}
+	clientToken, _, err := apitoken.Issue(context.Background(), env.db, nil, adminID, userIDByUsername(t, env.db, "client1"), "Carrier portal")
+	if err != nil {
+		t.Fatalf("issue client token: %v", err)
+	}
+	if status, out := postAPIJSON(t, env.server.URL, "/api/pallets", adminToken, `{"projectId":1,"count":1,"deliveryReference":"ASN-42"}`); status != http.StatusCreated {
+		t.Fatalf("pre-create pallet status=%d body=%s", status, out)
+	}
+
+	today := time.Now().Format("2006-01-02")
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/bookings/slots", url.Values{
+		"date":       {today},
+		"start_time": {"08:00"},
+		"end_time":   {"09:00"},
+		"capacity":   {"1"},
+	})
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=") {
+		t.Fatalf("expected slot to open, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	resp, out := getAPI(t, env.server.URL, "/api/delivery-slots?date="+today, clientToken, "")
+	var listed struct {
+		Slots []struct {
+			ID        int64 `json:"id"`
+			Remaining int64 `json:"remaining"`
+		} `json:"slots"`
+	}
+	if err := json.Unmarshal([]byte(out), &listed); err != nil || resp.StatusCode != http.StatusOK || len(listed.Slots) != 1 || listed.Slots[0].Remaining != 1 {
+		t.Fatalf("unexpected slot list status=%d body=%s", resp.StatusCode, out)
+	}
+	slotID := listed.Slots[0].ID
+
+	if status, out := postAPIJSON(t, env.server.URL, "/api/delivery-bookings", clientToken, fmt.Sprintf(`{"slotId":%d,"projectId":999,"carrier":"DHL"}`, slotID)); status != http.StatusNotFound {
+		t.Fatalf("expected 404 for a project the client cannot see, status=%d body=%s", status, out)
+	}
+	status, out := postAPIJSON(t, env.server.URL, "/api/delivery-bookings", clientToken, fmt.Sprintf(`{"slotId":%d,"projectId":1,"carrier":"DHL","deliveryReference":"ASN-42","expectedPallets":1}`, slotID))
+	var booked struct {
+		ID        int64   `json:"id"`
+		PalletIDs []int64 `json:"palletIds"`
+	}
+	if err := json.Unmarshal([]byte(out), &booked); err != nil || status != http.StatusCreated || len(booked.PalletIDs) != 1 {
+		t.Fatalf("expected booking linked to the pre-created pallet, status=%d body=%s", status, out)
+	}
+	if status, out := postAPIJSON(t, env.server.URL, "/api/delivery-bookings", clientToken, fmt.Sprintf(`{"slotId":%d,"projectId":1,"carrier":"UPS"}`, slotID)); status != http.StatusConflict {
+		t.Fatalf("expected full slot to be refused, status=%d body=%s", status, out)
+	}
+
+	resp = postForm(t, scannerClient, env.server.URL, "/tasker/projects/1/activate", nil)
+	_ = resp.Body.Close()
+	resp = get(t, scannerClient, env.server.URL, "/tasker/pallets/progress")
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), "Today's Deliveries") || !strings.Contains(string(body), "0 of 1 arrived") {
+		t.Fatalf("expected today's deliveries on the dashboard, got %d", resp.StatusCode)
+	}
+
+	resp = get(t, scannerClient, env.server.URL, "/tasker/gatehouse")
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "DHL") {
+		t.Fatalf("expected booking on the gatehouse screen, got %d", resp.StatusCode)
+	}
+	resp = postForm(t, scannerClient, env.server.URL, fmt.Sprintf("/tasker/gatehouse/%d/check-in", booked.ID), nil)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "checked+in") {
+		t.Fatalf("expected check-in, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	resp = get(t, scannerClient, env.server.URL, "/tasker/pallets/progress")
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), "1 of 1 arrived") || !strings.Contains(string(body), fmt.Sprintf("/tasker/pallets/%d/receipt", booked.PalletIDs[0])) {
+		t.Fatalf("expected arrival and pallet link on the dashboard")
+	}
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/bookings?date="+today)
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "1 of 1 booked") {
+		t.Fatalf("expected admin bookings page to show the booked slot, got %d", resp.StatusCode)
+	}
+}
+
+func TestClientCommentRateLimitAndAdminModeration(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	adminClient := newHTTPClient(t)
+	clientHTTP := newHTTPClient(t)
+
+	clientPassword := "Client123!Receipter"
+	clientUserID := seedClientUser(t, env.db, "client1", clientPassword, 1)
+
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/api/pallets/1/receipts", url.Values{
+		"sku":          {"SKU-C1"},
+		"description":  {"Client SKU"},
+		"qty":          {"5"},
+		"batch_number": {"CB1"},
+		"expiry_date":  {"2029-01-01"},
+	})
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected admin receipt create 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	loginAs(t, clientHTTP, env.server.URL, "client1", clientPassword)
+	comment := func(text string) *http.Response {
+		return postForm(t, clientHTTP, env.server.URL, "/tasker/pallets/sku-view/detail/comment", url.Values{
+			"project_id": {"1"},
+			"sku":        {"SKU-C1"},
+			"batch":      {"CB1"},
+			"expiry":     {"2029-01-01"},
+			"pallet_id":  {"1"},
+			"comment":    {text},
+		})
+	}
+
+	resp = comment(strings.Repeat("x", 1001))
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "error=") {
+		t.Fatalf("expected oversized comment rejected with redirect, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	for i := 0; i < 5; i++ {
+		resp = comment(fmt.Sprintf("spam %d", i))
+		if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=comment+added") {
+			t.Fatalf("comment %d: expected success redirect, got %d %s", i, resp.StatusCode, resp.Header.Get("Location"))
+		}
+		_ = resp.Body.Close()
+	}
+	resp = comment("spam 5")
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 once the burst limit is hit, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("expected Retry-After header on rate-limited response")
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, clientHTTP, env.server.URL, "/tasker/admin/comments")
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected client denied moderation page 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/admin/comments?user=client1")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected admin moderation page 200, got %d", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if strings.Count(string(body), `name="comment_id"`) != 5 {
+		t.Fatalf("expected 5 selectable comments on moderation page")
+	}
+
+	var ids []string
+	err := env.db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT CAST(id AS TEXT) FROM sku_client_comments WHERE created_by_user_id = ?`, clientUserID).Scan(ctx, &ids)
+	})
+	if err != nil {
+		t.Fatalf("load comment ids: %v", err)
+	}
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/admin/comments/delete", url.Values{
+		"comment_id": ids,
+		"user":       {"client1"},
+	})
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "5+comments+deleted") {
+		t.Fatalf("expected bulk delete redirect, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	var remaining, audited int
+	err = env.db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM sku_client_comments`).Scan(ctx, &remaining); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT COUNT(1) FROM audit_logs WHERE action = 'sku_comment.delete'`).Scan(ctx, &audited)
+	})
+	if err != nil {
+		t.Fatalf("verify moderation: %v", err)
+	}
+	if remaining != 0 || audited != 5 {
+		t.Fatalf("expected all comments deleted with 5 audit rows, got remaining=%d audited=%d", remaining, audited)
+	}
+}
+
+func TestLandingPage_RoleSettingAndUserOverrideDriveLoginRedirect(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	adminClient := newHTTPClient(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+
+	scannerLogin := func() string {
+		t.Helper()
+		c := newHTTPClient(t)
+		resp := get(t, c, env.server.URL, "/login")
+		_ = resp.Body.Close()
+		resp = postForm(t, c, env.server.URL, "/login", url.Values{
+			"username": {"scanner1"},
+			"password": {"Scanner123!Receipter"},
+		})
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusSeeOther {
+			t.Fatalf("expected scanner login 303, got %d", resp.StatusCode)
+		}
+		return resp.Header.Get("Location")
+	}
+
+	if got := scannerLogin(); got != "/tasker/projects" {
+		t.Fatalf("expected default scanner landing, got %s", got)
+	}
+
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/settings/landing/roles/scanner", url.Values{"landing_page": {"progress"}})
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=") {
+		t.Fatalf("expected role landing saved, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+	if got := scannerLogin(); got != "/tasker/pallets/progress" {
+		t.Fatalf("expected scanner role landing, got %s", got)
+	}
+
+	scannerID := userIDByUsername(t, env.db, "scanner1")
+	resp = postForm(t, adminClient, env.server.URL, fmt.Sprintf("/tasker/settings/landing/users/%d", scannerID), url.Values{"landing_page": {"exports"}})
+	if !strings.Contains(resp.Header.Get("Location"), "error=") {
+		t.Fatalf("expected exports override rejected for scanner, got %s", resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+	resp = postForm(t, adminClient, env.server.URL, fmt.Sprintf("/tasker/settings/landing/users/%d", scannerID), url.Values{"landing_page": {"sku-view"}})
+	_ = resp.Body.Close()
+
+	scannerClient := newHTTPClient(t)
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+	resp = get(t, scannerClient, env.server.URL, "/")
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/tasker/pallets/sku-view" {
+		t.Fatalf("expected home to follow user override, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/settings/landing")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected landing settings page 200, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+	resp = get(t, scannerClient, env.server.URL, "/tasker/settings/landing")
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected scanner denied landing settings, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+}
+
+func TestClientAccessRequest_ApprovalGrantsProject(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	clientUserID := seedClientUser(t, env.db, "client1", "Client123!Receipter", 1)
+	if _, err := env.db.W.ExecContext(context.Background(), `
+INSERT INTO projects (id, name, description, project_date, client_name, code, status)
+VALUES (2, 'Second Site', 'second', DATE('now'), 'Acme', 'second-site', 'active')`); err != nil {
+		t.Fatalf("seed second project: %v", err)
+	}
+
+	clientHTTP := newHTTPClient(t)
+	loginAs(t, clientHTTP, env.server.URL, "client1", "Client123!Receipter")
+	resp := postForm(t, clientHTTP, env.server.URL, "/tasker/access-requests", url.Values{
+		"project_code": {"second-site"},
+		"note":         {"Covering for Sam"},
+	})
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=access+request+sent") {
+		t.Fatalf("expected request sent redirect, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	adminClient := newHTTPClient(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp = get(t, adminClient, env.server.URL, "/tasker/admin/users")
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), "Pending Access Requests") || !strings.Contains(string(body), "Covering for Sam") {
+		t.Fatalf("expected pending request on users page")
+	}
+
+	var requestID int64
+	if err := env.db.R.NewRaw(`SELECT id FROM client_access_requests WHERE user_id = ?`, clientUserID).Scan(context.Background(), &requestID); err != nil {
+		t.Fatalf("load request id: %v", err)
+	}
+	resp = postForm(t, clientHTTP, env.server.URL, fmt.Sprintf("/tasker/admin/users/access-requests/%d/approve", requestID), nil)
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "/login") {
+		t.Fatalf("expected client denied approval, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	resp = postForm(t, adminClient, env.server.URL, fmt.Sprintf("/tasker/admin/users/access-requests/%d/approve", requestID), nil)
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=") {
+		t.Fatalf("expected approval redirect, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	var granted int
+	if err := env.db.R.NewRaw(`SELECT COUNT(1) FROM client_project_access WHERE user_id = ? AND project_id = 2`, clientUserID).Scan(context.Background(), &granted); err != nil {
+		t.Fatalf("check access: %v", err)
+	}
+	if granted != 1 {
+		t.Fatalf("expected approval to grant project 2")
+	}
+
+	resp = get(t, clientHTTP, env.server.URL, "/tasker/access-requests")
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), "Approved") || !strings.Contains(string(body), "Second Site") {
+		t.Fatalf("expected client to see approved request and new project")
+	}
+}
+
+func TestAdminDeliveries_InspectAndRetryDeadDelivery(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+
+	var deliveryID int64
+	err := env.db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		deliveryID, err = delivery.Enqueue(ctx, tx, delivery.KindWebhook, "https://hooks.example.test/receipts", "pallet.closed", []byte(`{"pallet_id":42}`))
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE deliveries SET status = 'dead', attempts = max_attempts, last_error = 'endpoint returned 500' WHERE id = ?`, deliveryID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed dead delivery: %v", err)
+	}
+	detailPath := fmt.Sprintf("/tasker/admin/deliveries/%d", deliveryID)
+
+	scannerClient := newHTTPClient(t)
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+	resp := get(t, scannerClient, env.server.URL, detailPath)
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected scanner denied delivery detail 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	adminClient := newHTTPClient(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp = get(t, adminClient, env.server.URL, "/tasker/admin/deliveries?filter=dead")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected deliveries page 200, got %d", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), "endpoint returned 500") {
+		t.Fatalf("expected dead delivery listed with its last error")
+	}
+
+	resp = get(t, adminClient, env.server.URL, detailPath)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected delivery detail 200, got %d", resp.StatusCode)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), "&#34;pallet_id&#34;: 42") {
+		t.Fatalf("expected indented payload on detail page")
+	}
+
+	resp = postForm(t, adminClient, env.server.URL, detailPath+"/retry", nil)
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=delivery+queued+for+retry") {
+		t.Fatalf("expected retry redirect, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	var status string
+	var attempts int
+	err = env.db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.QueryRowContext(ctx, `SELECT status, attempts FROM deliveries WHERE id = ?`, deliveryID).Scan(&status, &attempts)
+	})
+	if err != nil {
+		t.Fatalf("load delivery: %v", err)
+	}
+	if status != delivery.StatusPending || attempts != 0 {
+		t.Fatalf("expected delivery requeued, got status=%s attempts=%d", status, attempts)
+	}
+}
+
+func TestKiosk_EnrollSwitchByPINAndStayOnReceiptRoutes(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	scannerID := userIDByUsername(t, env.db, "scanner1")
+
+	adminClient := newHTTPClient(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/admin/kiosks", url.Values{"name": {"Dock 3"}})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected kiosk create to render page 200, got %d", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	token := regexp.MustCompile(`kiosk_[0-9a-f]{48}`).FindString(string(body))
+	if token == "" {
+		t.Fatalf("expected enrollment link with device token on the page")
+	}
+	resp = postForm(t, adminClient, env.server.URL, fmt.Sprintf("/tasker/admin/kiosks/pins/%d", scannerID), url.Values{"pin": {"4821"}})
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=PIN+updated") {
+		t.Fatalf("expected PIN set redirect, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	tablet := newHTTPClient(t)
+	resp = get(t, tablet, env.server.URL, "/kiosk")
+	if resp.StatusCode != http.StatusSeeOther || !strings.HasPrefix(resp.Header.Get("Location"), "/login") {
+		t.Fatalf("expected unenrolled browser sent to login, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+	resp = get(t, tablet, env.server.URL, "/kiosk/enroll?token="+token)
+	_ = resp.Body.Close()
+	resp = postForm(t, tablet, env.server.URL, "/kiosk/enroll", url.Values{"token": {token}})
+	if resp.StatusCode != http.StatusSeeOther || !strings.HasPrefix(resp.Header.Get("Location"), "/kiosk?status=") {
+		t.Fatalf("expected enrollment redirect to PIN screen, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, tablet, env.server.URL, "/kiosk")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected PIN screen 200, got %d", resp.StatusCode)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), "scanner1") {
+		t.Fatalf("expected scanner with a PIN listed on the kiosk")
+	}
+
+	resp = postForm(t, tablet, env.server.URL, "/kiosk/switch", url.Values{"user_id": {fmt.Sprint(scannerID)}, "pin": {"0000"}})
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "error=incorrect+PIN") {
+		t.Fatalf("expected wrong PIN rejected, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+	resp = postForm(t, tablet, env.server.URL, "/kiosk/switch", url.Values{"user_id": {fmt.Sprint(scannerID)}, "pin": {"4821"}})
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/tasker/scan/pallet" {
+		t.Fatalf("expected PIN switch to land on scan page, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, tablet, env.server.URL, "/tasker/scan/pallet")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected kiosk session to reach scan page, got %d", resp.StatusCode)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), "Switch User") {
+		t.Fatalf("expected kiosk top bar with switch user button")
+	}
+	resp = get(t, tablet, env.server.URL, "/tasker/projects")
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/kiosk" {
+		t.Fatalf("expected kiosk session kept off projects page, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	var sessionUserID int64
+	var switches int
+	err := env.db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT user_id FROM sessions WHERE kiosk_device_id IS NOT NULL`).Scan(ctx, &sessionUserID); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT COUNT(1) FROM audit_logs WHERE action = 'kiosk.switch' AND user_id = ?`, scannerID).Scan(ctx, &switches)
+	})
+	if err != nil {
+		t.Fatalf("load kiosk session: %v", err)
+	}
+	if sessionUserID != scannerID || switches != 1 {
+		t.Fatalf("expected kiosk session for scanner1 with one switch audit, got user=%d switches=%d", sessionUserID, switches)
+	}
+
+	resp = postForm(t, tablet, env.server.URL, "/kiosk/lock", nil)
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/kiosk" {
+		t.Fatalf("expected lock to return to PIN screen, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+	resp = get(t, tablet, env.server.URL, "/tasker/scan/pallet")
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected locked kiosk to need a PIN again, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+}
+
+func TestBulkPalletLabelGenerationWarnsOverPalletAllowance(t *testing.T) {
+	env, client := setupIntegrationServer(t)
+	loginAs(t, client, env.server.URL, "admin", "Admin123!Receipter")
+
+	projectID := projectIDByCode(t, env.db, "it-default")
+	resp := postForm(t, client, env.server.URL, fmt.Sprintf("/tasker/projects/%d/pallet-allowance", projectID), url.Values{
+		"pallet_allowance": {"2"},
+	})
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected allowance update 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	before := palletCount(t, env.db)
+	resp = postForm(t, client, env.server.URL, "/tasker/pallets/new/bulk", url.Values{
+		"count": {"3"},
+	})
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected over-allowance bulk 409, got %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read warning body: %v", err)
+	}
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), "Generate Anyway") {
+		t.Fatalf("expected allowance warning page, got %s", string(body))
+	}
+	if after := palletCount(t, env.db); after != before {
+		t.Fatalf("expected no pallets created before confirmation; before=%d after=%d", before, after)
+	}
+
+	resp = postForm(t, client, env.server.URL, "/tasker/pallets/new/bulk", url.Values{
+		"count":                  {"3"},
+		"confirm_over_allowance": {"1"},
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected confirmed bulk labels 200, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	var printed int64
+	err = env.db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT COALESCE(SUM(lp.print_count), 0)
+FROM pallet_label_prints lp
+JOIN pallets p ON p.id = lp.pallet_id
+WHERE p.project_id = ?`, projectID).Scan(ctx, &printed)
+	})
+	if err != nil {
+		t.Fatalf("load label prints: %v", err)
+	}
+	if printed != 3 {
+		t.Fatalf("expected 3 label prints recorded, got %d", printed)
+	}
+}
+
+func TestEmbedSummaryWidgetIsFramableCachedAndRevocable(t *testing.T) {
+	env, client := setupIntegrationServer(t)
+	loginAs(t, client, env.server.URL, "admin", "Admin123!Receipter")
+
+	projectID := projectIDByCode(t, env.db, "it-default")
+	resp := postForm(t, client, env.server.URL, "/tasker/admin/embeds", url.Values{
+		"name":       {"Client intranet"},
+		"project_id": {fmt.Sprintf("%d", projectID)},
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected issue widget 200, got %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read issue body: %v", err)
+	}
+	_ = resp.Body.Close()
+	match := regexp.MustCompile(`/embed/(embed_[0-9a-f]+)/summary`).FindStringSubmatch(string(body))
+	if match == nil {
+		t.Fatalf("expected widget url in issue page")
+	}
+	widgetPath := "/embed/" + match[1] + "/summary"
+
+	anon := newHTTPClient(t)
+	resp = get(t, anon, env.server.URL, widgetPath)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected widget 200, got %d", resp.StatusCode)
+	}
+	if xfo := resp.Header.Get("X-Frame-Options"); xfo != "" {
+		t.Fatalf("expected widget to be framable, got X-Frame-Options %s", xfo)
+	}
+	if cc := resp.Header.Get("Cache-Control"); !strings.Contains(cc, "max-age=") {
+		t.Fatalf("expected widget cache headers, got %q", cc)
+	}
+	if len(resp.Cookies()) != 0 {
+		t.Fatalf("expected widget to set no cookies")
+	}
+
+	resp = get(t, anon, env.server.URL, widgetPath+".json")
+	var summary struct {
+		Projects []struct {
+			ProjectID int64 `json:"project_id"`
+		} `json:"projects"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		t.Fatalf("decode widget json: %v", err)
+	}
+	_ = resp.Body.Close()
+	if len(summary.Projects) != 1 || summary.Projects[0].ProjectID != projectID {
+		t.Fatalf("unexpected widget projects: %+v", summary.Projects)
+	}
+	etag := resp.Header.Get("ETag")
+	req, _ := http.NewRequest(http.MethodGet, env.server.URL+widgetPath+".json", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = anon.Do(req)
+	if err != nil {
+		t.Fatalf("revalidate widget: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected 304 for unchanged widget, got %d", resp.StatusCode)
+	}
+
+	boardPath := "/embed/" + match[1] + "/board"
+	resp = get(t, anon, env.server.URL, boardPath)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected board 200, got %d", resp.StatusCode)
+	}
+	resp = get(t, anon, env.server.URL, boardPath+".json")
+	var board struct {
+		Projects []struct {
+			ProjectID int64 `json:"project_id"`
+		} `json:"projects"`
+		OpenPallets []struct {
+			ID int64 `json:"id"`
+		} `json:"open_pallets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&board); err != nil {
+		t.Fatalf("decode board json: %v", err)
+	}
+	_ = resp.Body.Close()
+	if len(board.Projects) != 1 || board.Projects[0].ProjectID != projectID || board.OpenPallets == nil {
+		t.Fatalf("unexpected board: %+v", board)
+	}
+	if cc := resp.Header.Get("Cache-Control"); cc != "no-cache" {
+		t.Fatalf("expected board to revalidate every poll, got %q", cc)
+	}
+	req, _ = http.NewRequest(http.MethodGet, env.server.URL+boardPath+".json", nil)
+	req.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	resp, err = anon.Do(req)
+	if err != nil {
+		t.Fatalf("revalidate board: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected 304 for unchanged board, got %d", resp.StatusCode)
+	}
+
+	var tokenID int64
+	err = env.db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT id FROM embed_tokens LIMIT 1`).Scan(ctx, &tokenID)
+	})
+	if err != nil {
+		t.Fatalf("load widget id: %v", err)
+	}
+	resp = postForm(t, client, env.server.URL, fmt.Sprintf("/tasker/admin/embeds/%d/revoke", tokenID), nil)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected revoke 303, got %d", resp.StatusCode)
+	}
+
+	resp = get(t, anon, env.server.URL, widgetPath)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected revoked widget 404, got %d", resp.StatusCode)
+	}
+	resp = get(t, anon, env.server.URL, boardPath+".json")
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected revoked board 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestDeactivatedActiveProjectRedirectsOtherSessionsToProjectSelection(t *testing.T) {
+	env, adminClient := setupIntegrationServer(t)
+	scannerClient := newHTTPClient(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+
+	projectID := projectIDByCode(t, env.db, "it-default")
+	resp := postForm(t, scannerClient, env.server.URL, "/tasker/projects/"+strconv.FormatInt(projectID, 10)+"/activate", nil)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected scanner activate project 303, got %d", resp.StatusCode)
+	}
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/projects/"+strconv.FormatInt(projectID, 10)+"/status", url.Values{
+		"status": {"inactive"},
+	})
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected deactivate project 303, got %d", resp.StatusCode)
+	}
+
+	resp = get(t, scannerClient, env.server.URL, "/tasker/pallets/progress")
+	_ = resp.Body.Close()
+	location := resp.Header.Get("Location")
+	if resp.StatusCode != http.StatusSeeOther || !strings.HasPrefix(location, "/tasker/projects?status=") || !strings.Contains(location, "deactivated") {
+		t.Fatalf("expected redirect to project selection with message, got %d %s", resp.StatusCode, location)
+	}
+
+	var activeProjectID sql.NullInt64
+	if err := env.db.R.NewRaw(`SELECT s.active_project_id FROM sessions s JOIN users u ON u.id = s.user_id WHERE u.username = 'scanner1'`).Scan(context.Background(), &activeProjectID); err != nil {
+		t.Fatalf("load scanner session project: %v", err)
+	}
+	if activeProjectID.Valid && activeProjectID.Int64 == projectID {
+		t.Fatalf("expected scanner session moved off the deactivated project")
+	}
+
+	resp = get(t, scannerClient, env.server.URL, location)
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatalf("read projects page: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "was deactivated") {
+		t.Fatalf("expected projects page to explain the deactivation, got %d", resp.StatusCode)
+	}
+
+	// Opening an inactive project on purpose is not undone.
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/projects/"+strconv.FormatInt(projectID, 10)+"/activate", nil)
+	_ = resp.Body.Close()
+	resp = get(t, adminClient, env.server.URL, "/tasker/pallets/progress")
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected admin to stay on the chosen inactive project, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+}
+
+func TestPalletExportBundle_QueuedBuiltAndDownloadedByAdmin(t *testing.T) {
+	env, adminClient := setupIntegrationServer(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	projectID := projectIDByCode(t, env.db, "it-default")
+
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/api/pallets/1/receipts", url.Values{
+		"sku":          {"SKU-1"},
+		"description":  {"Item 1"},
+		"qty":          {"3"},
+		"batch_number": {"B100"},
+		"expiry_date":  {"2027-12-31"},
+	})
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected receipt create 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+	if _, err := env.db.W.ExecContext(context.Background(), `INSERT INTO receipt_photos (pallet_receipt_id, photo_blob, photo_mime, photo_name) VALUES (1, x'ffd8ff', 'image/jpeg', 'seal.jpg')`); err != nil {
+		t.Fatalf("seed photo: %v", err)
+	}
+
+	bundlePath := fmt.Sprintf("/tasker/exports/pallet/1/bundle?project_id=%d", projectID)
+	resp = postForm(t, adminClient, env.server.URL, bundlePath, nil)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/tasker/pallets/1/content-label" {
+		t.Fatalf("expected queue redirect to content page, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	resp = get(t, adminClient, env.server.URL, "/tasker/exports/jobs/1/download")
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected queued bundle to be not ready, got %d", resp.StatusCode)
+	}
+
+	if processed, err := env.app.ExportJobs.ProcessPending(context.Background()); err != nil || processed != 1 {
+		t.Fatalf("expected one bundle built, got %d %v", processed, err)
+	}
+	resp = get(t, adminClient, env.server.URL, "/tasker/pallets/1/content-label")
+	page, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(page), "Export Bundles") || !strings.Contains(string(page), "/tasker/exports/jobs/1/download") {
+		t.Fatalf("expected finished bundle listed on content page")
+	}
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/exports/jobs/1/download")
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/zip" {
+		t.Fatalf("expected bundle download, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("open bundle: %v", err)
+	}
+	files := make(map[string]string, len(zr.File))
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		data, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		files[f.Name] = string(data)
+	}
+	if !strings.Contains(files["lines.csv"], "SKU-1") {
+		t.Fatalf("expected lines.csv with the receipt line, got %q", files["lines.csv"])
+	}
+	if !strings.HasPrefix(files["events.csv"], "timestamp,user,action,details") {
+		t.Fatalf("expected events.csv header, got %q", files["events.csv"])
+	}
+	if !strings.Contains(files["photos/manifest.csv"], "photos/line-1-photo-1.jpg,1,1,false,SKU-1,B100") {
+		t.Fatalf("expected photo in manifest, got %q", files["photos/manifest.csv"])
+	}
+	if files["photos/line-1-photo-1.jpg"] != "\xff\xd8\xff" {
+		t.Fatalf("expected photo file in bundle")
+	}
+
+	scannerClient := newHTTPClient(t)
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+	resp = postForm(t, scannerClient, env.server.URL, bundlePath, nil)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || strings.Contains(resp.Header.Get("Location"), "content-label") {
+		t.Fatalf("expected scanner denied bundle export, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+}
+
+func TestProjectBundleExport_QueuedFromExportsPageAndDownloaded(t *testing.T) {
+	env, adminClient := setupIntegrationServer(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	projectID := projectIDByCode(t, env.db, "it-default")
+
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/api/pallets/1/receipts", url.Values{
+		"sku":         {"SKU-1"},
+		"description": {"Item 1"},
+		"qty":         {"3"},
+	})
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected receipt create 303, got %d", resp.StatusCode)
+	}
+	if _, err := env.db.W.ExecContext(context.Background(), `INSERT INTO receipt_photos (pallet_receipt_id, photo_blob, photo_mime, photo_name) VALUES (1, x'ffd8ff', 'image/jpeg', 'seal.jpg')`); err != nil {
+		t.Fatalf("seed photo: %v", err)
+	}
+
+	bundlePath := fmt.Sprintf("/tasker/exports/project-bundle?project_id=%d", projectID)
+	resp = postForm(t, adminClient, env.server.URL, bundlePath, nil)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || !strings.HasPrefix(resp.Header.Get("Location"), "/tasker/exports?") {
+		t.Fatalf("expected queue redirect to exports page, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if processed, err := env.app.ExportJobs.ProcessPending(context.Background()); err != nil || processed != 1 {
+		t.Fatalf("expected one bundle built, got %d %v", processed, err)
+	}
+	resp = get(t, adminClient, env.server.URL, fmt.Sprintf("/tasker/exports?project_id=%d", projectID))
+	page, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(page), "Project Bundles") || !strings.Contains(string(page), "/tasker/exports/jobs/1/download") {
+		t.Fatalf("expected finished bundle listed on exports page")
+	}
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/exports/jobs/1/download")
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected bundle download, got %d", resp.StatusCode)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("open bundle: %v", err)
+	}
+	names := make(map[string]bool, len(zr.File))
+	for _, f := range zr.File {
+		names[f.Name] = true
+	}
+	for _, name := range []string{"receipts.csv", "pallet-status.csv", "pallets/P00000001.csv", "sku-summary.csv", "sku-detail.csv", "photos/manifest.csv", "photos/P00000001/line-1/photo-1.jpg"} {
+		if !names[name] {
+			t.Fatalf("expected %s in project bundle, got %v", name, names)
+		}
+	}
+
+	scannerClient := newHTTPClient(t)
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+	resp = postForm(t, scannerClient, env.server.URL, bundlePath, nil)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || strings.HasPrefix(resp.Header.Get("Location"), "/tasker/exports") {
+		t.Fatalf("expected scanner denied project bundle, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+}
+
+func TestSQLiteSessionStore_SharedAcrossInstancesAndRestarts(t *testing.T) {
+	env, client := setupIntegrationServer(t)
+	newInstance := func() *httptest.Server {
+		rbacCache := cache.NewRbacRolesCache()
+		s := NewServer("127.0.0.1:0", env.db, cache.NewSQLiteSessionStore(env.db), cache.NewUserCache(), rbac.New(rbacCache), rbacCache, audit.NewService())
+		ts := httptest.NewServer(s.router)
+		t.Cleanup(ts.Close)
+		return ts
+	}
+	first, second := newInstance(), newInstance()
+
+	loginAs(t, client, first.URL, "scanner1", "Scanner123!Receipter")
+	resp := get(t, client, second.URL, "/tasker/projects")
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected session from the first instance to work on the second, got %d", resp.StatusCode)
+	}
+	restarted := newInstance()
+	resp = get(t, client, restarted.URL, "/tasker/projects")
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected session to survive a restart, got %d", resp.StatusCode)
+	}
+
+	// Replay the session cookie after logout, as the second instance would
+	// see it from a browser that missed the logout.
+	firstURL, _ := url.Parse(first.URL)
+	cookies := client.Jar.Cookies(firstURL)
+	resp = postForm(t, client, first.URL, "/logout", nil)
+	_ = resp.Body.Close()
+	stale := newHTTPClient(t)
+	stale.Jar.SetCookies(firstURL, cookies)
+	resp = get(t, stale, second.URL, "/tasker/projects")
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/login" {
+		t.Fatalf("expected logout on one instance to end the session on the other, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+}
+
+func TestAdminHealthPage_RunNowRecordsResults(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	adminClient := newHTTPClient(t)
+	scannerClient := newHTTPClient(t)
+
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/admin/health/run", nil)
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=") {
+		t.Fatalf("expected run now success redirect, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/admin/health")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected admin health page 200, got %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read health body: %v", err)
+	}
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), "Receipt lines without a pallet") || !strings.Contains(string(body), "manual") {
+		t.Fatalf("expected latest manual run results on health page")
+	}
+
+	var audits int
+	if err := env.db.R.NewRaw(`SELECT COUNT(1) FROM audit_logs WHERE action = 'integrity.run'`).Scan(context.Background(), &audits); err != nil {
+		t.Fatalf("count audit logs: %v", err)
+	}
+	if audits != 1 {
+		t.Fatalf("expected one integrity.run audit log, got %d", audits)
+	}
+
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+	resp = postForm(t, scannerClient, env.server.URL, "/tasker/admin/health/run", nil)
+	if resp.StatusCode != http.StatusSeeOther || strings.Contains(resp.Header.Get("Location"), "status=") {
+		t.Fatalf("expected scanner run now denied, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+}
+
+func TestPreferences_SavedPerUserAndAppliedOnRender(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	scannerClient := newHTTPClient(t)
+	adminClient := newHTTPClient(t)
+
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+	resp := postForm(t, scannerClient, env.server.URL, "/tasker/settings/preferences", url.Values{
+		"ui.theme":           {"dark"},
+		"ui.density":         {"compact"},
+		"progress.page_size": {"25"},
+	})
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=saved") {
+		t.Fatalf("expected preferences saved redirect, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	resp = postForm(t, scannerClient, env.server.URL, "/tasker/settings/preferences", url.Values{"ui.theme": {"neon"}})
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "error=") {
+		t.Fatalf("expected invalid preference refused, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, scannerClient, env.server.URL, "/tasker/settings/preferences")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected preferences page 200, got %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read preferences body: %v", err)
+	}
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), `data-theme="dark"`) || !strings.Contains(string(body), `data-density="compact"`) {
+		t.Fatalf("expected scanner theme and density applied to page")
+	}
+
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp = get(t, adminClient, env.server.URL, "/tasker/settings/preferences")
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read admin preferences body: %v", err)
+	}
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), `data-theme="light"`) {
+		t.Fatalf("expected admin to keep the default theme")
+	}
+}
+
+func TestColumnPreferences_HideAndResetProgressColumns(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	adminClient := newHTTPClient(t)
+	scannerClient := newHTTPClient(t)
+
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected create pallet 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	progressBody := func(client *http.Client) string {
+		t.Helper()
+		resp := get(t, client, env.server.URL, "/tasker/pallets/progress")
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("read progress body: %v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected progress page 200, got %d", resp.StatusCode)
+		}
+		return string(body)
+	}
+	if body := progressBody(adminClient); !strings.Contains(body, "<th>Reopened</th>") || !strings.Contains(body, "<th>Lines</th>") {
+		t.Fatalf("expected every progress column by default")
+	}
+
+	// Only the ticked columns show; the rest are hidden.
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/settings/columns", url.Values{
+		"table":     {"columns.progress"},
+		"return_to": {"/tasker/pallets/progress"},
+		"show":      {"status", "lines", "open_for", "created", "closed"},
+	})
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/tasker/pallets/progress" {
+		t.Fatalf("expected columns saved redirect, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+	if body := progressBody(adminClient); strings.Contains(body, "<th>Reopened</th>") || !strings.Contains(body, "<th>Lines</th>") {
+		t.Fatalf("expected only the reopened column hidden")
+	}
+
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+	if body := progressBody(scannerClient); !strings.Contains(body, "<th>Reopened</th>") {
+		t.Fatalf("expected another user's columns unaffected")
+	}
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/settings/columns", url.Values{
+		"table":     {"columns.progress"},
+		"return_to": {"https://example.com/"},
+		"reset":     {"1"},
+	})
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/tasker/settings/preferences?status=saved" {
+		t.Fatalf("expected reset redirect to preferences, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+	if body := progressBody(adminClient); !strings.Contains(body, "<th>Reopened</th>") {
+		t.Fatalf("expected reset to show every column again")
+	}
+}
+
+func TestWMSReconciliation_UploadViewAndExport(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	adminClient := newHTTPClient(t)
+	scannerClient := newHTTPClient(t)
+
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp := postMultipartFile(t, adminClient, env.server.URL, "/tasker/projects/1/reconcile", "file", "wms.csv", []byte("sku,qty\nSKU-1,5\n"))
+	location := resp.Header.Get("Location")
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(location, "snapshot=") {
+		t.Fatalf("expected upload redirect to snapshot, got %d %s", resp.StatusCode, location)
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, adminClient, env.server.URL, location)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read reconcile body: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "SKU-1") || !strings.Contains(string(body), "Short (1)") {
+		t.Fatalf("expected reconciliation with SKU-1 short, got %d", resp.StatusCode)
+	}
+
+	var snapshotID int64
+	if err := env.db.R.NewRaw(`SELECT id FROM wms_snapshots WHERE project_id = 1`).Scan(context.Background(), &snapshotID); err != nil {
+		t.Fatalf("load snapshot id: %v", err)
+	}
+	resp = get(t, adminClient, env.server.URL, fmt.Sprintf("/tasker/projects/1/reconcile/%d/export.csv", snapshotID))
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read export body: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "sku,batch_number,wms_qty,received_qty,difference,result\nSKU-1,,5,0,-5,short\n" {
+		t.Fatalf("unexpected reconciliation export %d %q", resp.StatusCode, body)
+	}
+
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+	resp = get(t, scannerClient, env.server.URL, "/tasker/projects/1/reconcile")
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		t.Fatalf("expected scanner denied reconciliation page")
+	}
+}
+
+func TestInternalPhotosAreHiddenFromClients(t *testing.T) {
+	env, adminClient := setupIntegrationServer(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+
+	scannerClient := newHTTPClient(t)
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+	photo := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{7}, 40)...)
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, field := range [][2]string{
+		{"_csrf", csrfToken(t, scannerClient, env.server.URL)},
+		{"sku", "SKU-1"},
+		{"description", "Item 1"},
+		{"qty", "2"},
+		{"case_size", "1"},
+		{"photos_internal", "1"},
+	} {
+		if err := writer.WriteField(field[0], field[1]); err != nil {
+			t.Fatalf("write field %s: %v", field[0], err)
+		}
+	}
+	part, err := writer.CreateFormFile("stock_photo", "damage.png")
+	if err != nil {
+		t.Fatalf("create photo field: %v", err)
+	}
+	if _, err := part.Write(photo); err != nil {
+		t.Fatalf("write photo: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close multipart writer: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, env.server.URL+"/tasker/api/pallets/1/receipts", &body)
+	if err != nil {
+		t.Fatalf("build receipt request: %v", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp, err = scannerClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST receipt failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected receipt create 303, got %d", resp.StatusCode)
+	}
+	if _, err := env.db.W.ExecContext(context.Background(), `INSERT INTO receipt_photos (id, pallet_receipt_id, photo_blob, photo_mime, photo_name) VALUES (1, 1, x'ffd8ff', 'image/jpeg', 'dock.jpg')`); err != nil {
+		t.Fatalf("seed photo: %v", err)
+	}
+
+	seedClientUser(t, env.db, "client1", "Client123!Receipter", 1)
+	clientClient := newHTTPClient(t)
+	loginAs(t, clientClient, env.server.URL, "client1", "Client123!Receipter")
+	status := func(client *http.Client, path string) int {
+		t.Helper()
+		resp := get(t, client, env.server.URL, path)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	if got := status(clientClient, "/tasker/api/pallets/1/receipts/1/photo"); got != http.StatusNotFound {
+		t.Fatalf("expected internal primary photo hidden from client, got %d", got)
+	}
+	if got := status(clientClient, "/tasker/api/pallets/1/receipts/1/photos/1"); got != http.StatusOK {
+		t.Fatalf("expected client-visible photo served to client, got %d", got)
+	}
+	if got := status(adminClient, "/tasker/api/pallets/1/receipts/1/photo"); got != http.StatusOK {
+		t.Fatalf("expected internal photo served to admin, got %d", got)
+	}
+
+	resp = get(t, clientClient, env.server.URL, "/tasker/pallets/1/content-line/1")
+	page, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if strings.Contains(string(page), "/receipts/1/photo\"") || !strings.Contains(string(page), "/receipts/1/photos/1") {
+		t.Fatalf("expected client line detail to list only the client-visible photo")
+	}
+	resp = get(t, adminClient, env.server.URL, "/tasker/pallets/1/content-line/1")
+	page, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(page), ">Internal</button>") || !strings.Contains(string(page), "/photo-visibility") {
+		t.Fatalf("expected admin line detail to offer the visibility toggle")
+	}
+
+	resp = postForm(t, clientClient, env.server.URL, "/tasker/pallets/1/content-line/1/photo-visibility", url.Values{
+		"source": {"pallet_receipts"}, "internal": {"0"},
+	})
+	_ = resp.Body.Close()
+	if got := status(clientClient, "/tasker/api/pallets/1/receipts/1/photo"); got != http.StatusNotFound {
+		t.Fatalf("expected client denied the visibility toggle, got photo status %d", got)
+	}
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/pallets/1/content-line/1/photo-visibility", url.Values{
+		"source": {"pallet_receipts"}, "internal": {"0"},
+	})
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected visibility toggle 303, got %d", resp.StatusCode)
+	}
+	if got := status(clientClient, "/tasker/api/pallets/1/receipts/1/photo"); got != http.StatusOK {
+		t.Fatalf("expected photo shown to client once visible, got %d", got)
+	}
+	var audited int
+	if err := env.db.R.NewRaw(`SELECT COUNT(*) FROM audit_logs WHERE action = 'receipt.photo_visibility' AND entity_id = '1'`).Scan(context.Background(), &audited); err != nil || audited != 1 {
+		t.Fatalf("expected one visibility audit entry, got %d (%v)", audited, err)
+	}
+}
+
+func TestPhotoRedaction_AdminDeletesPhotoAndStubIsKept(t *testing.T) {
+	env, adminClient := setupIntegrationServer(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/api/pallets/1/receipts", url.Values{
+		"sku":         {"SKU-1"},
+		"description": {"Item 1"},
+		"qty":         {"3"},
+	})
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected receipt create 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+	if _, err := env.db.W.ExecContext(context.Background(), `INSERT INTO receipt_photos (id, pallet_receipt_id, photo_blob, photo_mime, photo_name) VALUES (1, 1, x'ffd8ff', 'image/jpeg', 'dock.jpg')`); err != nil {
+		t.Fatalf("seed photo: %v", err)
+	}
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/pallets/1/receipt")
+	page, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(page), "/tasker/pallets/1/receipts/1/photos/redact") {
+		t.Fatalf("expected redact link on receipt page for admin")
+	}
+
+	redactPath := "/tasker/pallets/1/receipts/1/photos/redact"
+	resp = postForm(t, adminClient, env.server.URL, redactPath, url.Values{
+		"source":   {"receipt_photos"},
+		"photo_id": {"1"},
+		"action":   {"deleted"},
+		"note":     {"customer in frame"},
+	})
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=") {
+		t.Fatalf("expected redaction redirect with status, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	var photos int
+	if err := env.db.R.NewRaw(`SELECT COUNT(1) FROM receipt_photos`).Scan(context.Background(), &photos); err != nil {
+		t.Fatalf("count photos: %v", err)
+	}
+	if photos != 0 {
+		t.Fatalf("expected photo deleted, %d left", photos)
+	}
+	resp = get(t, adminClient, env.server.URL, redactPath)
+	page, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(page), "dock.jpg") || !strings.Contains(string(page), "customer in frame") {
+		t.Fatalf("expected redaction stub listed on redact page")
+	}
+
+	scannerClient := newHTTPClient(t)
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+	resp = get(t, scannerClient, env.server.URL, redactPath)
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		t.Fatalf("expected scanner denied redaction page")
+	}
+}
+
+func TestPalletCalendar_ShowsTodaysPalletsAndFragment(t *testing.T) {
+	env, adminClient := setupIntegrationServer(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+
+	today := time.Now().UTC().Format("2006-01-02")
+	resp = get(t, adminClient, env.server.URL, "/tasker/pallets/calendar?day="+today)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected calendar 200, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(string(body), "1 created") || !strings.Contains(string(body), "/tasker/pallets/1/receipt") {
+		t.Fatalf("expected today's pallet on the calendar")
+	}
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/pallets/calendar?fragment=1")
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), `id="pallet-calendar-page"`) || strings.Contains(strings.ToLower(string(body)), "<!doctype html>") {
+		t.Fatalf("expected calendar fragment without the html document")
+	}
+}
+
+func TestMyCapturesCSV_ScannerGetsOnlyOwnLines(t *testing.T) {
+	env, adminClient := setupIntegrationServer(t)
+	scannerClient := newHTTPClient(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/api/pallets/1/receipts", url.Values{
+		"sku": {"SKU-ADMIN"}, "description": {"Admin line"}, "qty": {"1"},
+	})
+	_ = resp.Body.Close()
+
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+	resp = postForm(t, scannerClient, env.server.URL, "/tasker/api/pallets/1/receipts", url.Values{
+		"sku": {"SKU-MINE"}, "description": {"Scanner line"}, "qty": {"2"},
+	})
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected scanner receipt create 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, scannerClient, env.server.URL, "/tasker/pallets/1/receipt")
+	page, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(page), "/tasker/pallets/my-captures.csv?pallet_id=1") {
+		t.Fatalf("expected own lines export link on scanner receipt page")
+	}
+
+	resp = get(t, scannerClient, env.server.URL, "/tasker/pallets/my-captures.csv?pallet_id=1")
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/csv" {
+		t.Fatalf("expected captures csv, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	csvText := string(body)
+	if !strings.Contains(csvText, "SKU-MINE") || strings.Contains(csvText, "SKU-ADMIN") {
+		t.Fatalf("expected only the scanner's own lines, got:\n%s", csvText)
+	}
+	if !strings.Contains(csvText, ",scanner1,") {
+		t.Fatalf("expected rows watermarked with the scanner's username")
+	}
+
+	resp = get(t, scannerClient, env.server.URL, "/tasker/pallets/my-captures.csv")
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected unscoped captures export 400, got %d", resp.StatusCode)
+	}
+	resp = get(t, scannerClient, env.server.URL, "/tasker/exports/receipts.csv")
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		t.Fatalf("expected scanner denied the full project export")
+	}
+}
+
+func TestRateLimit_ExportsReturn429PerUser(t *testing.T) {
+	env, adminClient := setupIntegrationServer(t)
+	env.app.RateLimit.SetLimit(ratelimit.ClassExport, ratelimit.Limit{Requests: 2, Per: time.Hour})
+	scannerClient := newHTTPClient(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+
+	for i, wantRemaining := range []string{"1", "0"} {
+		resp := get(t, adminClient, env.server.URL, "/tasker/exports/receipts.csv")
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("export %d: expected 200, got %d", i+1, resp.StatusCode)
+		}
+		if resp.Header.Get("X-RateLimit-Limit") != "2" || resp.Header.Get("X-RateLimit-Remaining") != wantRemaining {
+			t.Fatalf("export %d: limit headers %q/%q", i+1, resp.Header.Get("X-RateLimit-Limit"), resp.Header.Get("X-RateLimit-Remaining"))
+		}
+	}
+
+	resp := get(t, adminClient, env.server.URL, "/tasker/exports/receipts.csv")
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected third export 429, got %d", resp.StatusCode)
+	}
+	if retry, err := strconv.Atoi(resp.Header.Get("Retry-After")); err != nil || retry <= 0 {
+		t.Fatalf("expected Retry-After seconds, got %q", resp.Header.Get("Retry-After"))
+	}
+
+	// Other route classes and other users keep their own allowance.
+	resp = get(t, adminClient, env.server.URL, "/tasker/pallets/progress")
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-RateLimit-Limit") != "" {
+		t.Fatalf("expected unlimited progress page, got %d with limit %q", resp.StatusCode, resp.Header.Get("X-RateLimit-Limit"))
+	}
+	resp = get(t, scannerClient, env.server.URL, "/tasker/pallets/my-captures.csv?date="+time.Now().UTC().Format("2006-01-02"))
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		t.Fatalf("expected scanner export to use its own bucket")
+	}
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/admin/system")
+	page, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(page), "Rate Limits") || !strings.Contains(string(page), "user:") {
+		t.Fatalf("expected rate limit counters on the system page")
+	}
+}
+
+func TestReceiptPage_WarnsWhenPalletIsInUse(t *testing.T) {
+	env, adminClient := setupIntegrationServer(t)
+	scannerClient := newHTTPClient(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected create pallet 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	readPage := func(client *http.Client, path string) string {
+		t.Helper()
+		resp := get(t, client, env.server.URL, path)
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		return string(body)
+	}
+
+	if page := readPage(scannerClient, "/tasker/pallets/1/receipt"); strings.Contains(page, `id="receipt-claim"`) {
+		t.Fatalf("first scanner should hold the claim without a warning")
+	}
+	page := readPage(adminClient, "/tasker/pallets/1/receipt")
+	if !strings.Contains(page, `id="receipt-claim"`) || !strings.Contains(page, "In use by <strong>scanner1</strong>") {
+		t.Fatalf("expected second user to be warned the pallet is in use")
+	}
+	if progress := readPage(adminClient, "/tasker/pallets/progress"); !strings.Contains(progress, "in use by scanner1") {
+		t.Fatalf("expected progress list to show the claim")
+	}
+
+	// Closing the pallet releases the claim, so the warning goes away once
+	// it is reopened.
+	resp = postForm(t, scannerClient, env.server.URL, "/tasker/api/pallets/1/receipts", url.Values{
+		"sku":       {"SKU-CLAIM-1"},
+		"qty":       {"1"},
+		"case_size": {"1"},
+	})
+	_ = resp.Body.Close()
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/api/pallets/1/close", nil)
+	_ = resp.Body.Close()
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/api/pallets/1/reopen", nil)
+	_ = resp.Body.Close()
+	if page := readPage(adminClient, "/tasker/pallets/1/receipt"); strings.Contains(page, `id="receipt-claim"`) {
+		t.Fatalf("expected close to release the claim")
+	}
+}
+
+func TestClientViews_AppearInProjectAccessLog(t *testing.T) {
+	env, adminHTTP := setupIntegrationServer(t)
+	clientPassword := "Client123!Receipter"
+	_ = seedClientUser(t, env.db, "client-viewer", clientPassword, 1)
+
+	clientHTTP := newHTTPClient(t)
+	loginAs(t, clientHTTP, env.server.URL, "client-viewer", clientPassword)
+	resp := get(t, clientHTTP, env.server.URL, "/tasker/pallets/sku-view?q=widget")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected client sku view 200, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+	resp = get(t, clientHTTP, env.server.URL, "/tasker/pallets/sku-view/export-summary.csv")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected client summary export 200, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	// Staff views are not logged.
+	loginAs(t, adminHTTP, env.server.URL, "admin", "Admin123!Receipter")
+	resp = get(t, adminHTTP, env.server.URL, "/tasker/pallets/sku-view")
+	_ = resp.Body.Close()
+
+	if err := env.app.AccessLog.Flush(context.Background()); err != nil {
+		t.Fatalf("flush access log: %v", err)
+	}
+
+	resp = get(t, adminHTTP, env.server.URL, "/tasker/projects/1/access-log")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected access log page 200, got %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatalf("read access log page: %v", err)
+	}
+	page := string(body)
+	if !strings.Contains(page, "/tasker/pallets/sku-view?q=widget") || !strings.Contains(page, "/tasker/pallets/sku-view/export-summary.csv") {
+		t.Fatalf("expected client views in access log, got %s", page)
+	}
+
+	resp = get(t, adminHTTP, env.server.URL, "/tasker/projects/1/access-log/export.csv?kind=export")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected access log export 200, got %d", resp.StatusCode)
+	}
+	body, err = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatalf("read access log export: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], "client-viewer,export,/tasker/pallets/sku-view/export-summary.csv") {
+		t.Fatalf("expected one client export in csv, got %q", lines)
+	}
+
+	resp = get(t, clientHTTP, env.server.URL, "/tasker/projects/1/access-log")
+	if resp.StatusCode == http.StatusOK {
+		t.Fatalf("expected client to be refused the access log")
+	}
+	_ = resp.Body.Close()
+}
+
+func TestSiteSwitcherNarrowsProjectList(t *testing.T) {
+	env, client := setupIntegrationServer(t)
+	loginAs(t, client, env.server.URL, "admin", "Admin123!Receipter")
+
+	for _, name := range []string{"Leeds DC", "Hull DC"} {
+		resp := postForm(t, client, env.server.URL, "/tasker/admin/sites", url.Values{"name": {name}})
+		if resp.StatusCode != http.StatusSeeOther {
+			t.Fatalf("expected create site 303, got %d", resp.StatusCode)
+		}
+		_ = resp.Body.Close()
+	}
+	siteIDByCode := func(code string) string {
+		var id int64
+		if err := env.db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+			return tx.NewRaw(`SELECT id FROM sites WHERE code = ?`, code).Scan(ctx, &id)
+		}); err != nil {
+			t.Fatalf("load site %s: %v", code, err)
+		}
+		return strconv.FormatInt(id, 10)
+	}
+	leedsID := siteIDByCode("leeds-dc")
+	hullID := siteIDByCode("hull-dc")
+
+	resp := postForm(t, client, env.server.URL, "/tasker/projects", url.Values{
+		"name":         {"Hull Intake"},
+		"description":  {"Hull only project"},
+		"project_date": {"2026-03-02"},
+		"client_name":  {"Humber Foods"},
+		"code":         {"hull-intake"},
+		"status":       {"active"},
+		"site_id":      {hullID},
+	})
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected create project 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+
+	projectsPage := func() string {
+		resp := get(t, client, env.server.URL, "/tasker/projects")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected projects page 200, got %d", resp.StatusCode)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("read projects body: %v", err)
+		}
+		_ = resp.Body.Close()
+		return string(body)
+	}
+	switchSite := func(siteID string) {
+		resp := postForm(t, client, env.server.URL, "/tasker/sites/switch", url.Values{"site_id": {siteID}, "return_to": {"/tasker/projects"}})
+		if resp.StatusCode != http.StatusSeeOther {
+			t.Fatalf("expected site switch 303, got %d", resp.StatusCode)
+		}
+		if loc := resp.Header.Get("Location"); loc != "/tasker/projects" {
+			t.Fatalf("expected switch to return to projects, got %q", loc)
+		}
+		_ = resp.Body.Close()
+	}
+
+	if text := projectsPage(); !strings.Contains(text, "Hull Intake") || !strings.Contains(text, `action="/tasker/sites/switch"`) {
+		t.Fatalf("expected unswitched admin to see every project and the site switcher")
+	}
+
+	switchSite(leedsID)
+	if text := projectsPage(); strings.Contains(text, "Hull Intake") {
+		t.Fatalf("expected Leeds view to hide Hull project")
+	}
+
+	switchSite(hullID)
+	text := projectsPage()
+	if !strings.Contains(text, "Hull Intake") || strings.Contains(text, "Integration Default") {
+		t.Fatalf("expected Hull view to list only Hull projects")
+	}
+
+	switchSite("")
+	if text := projectsPage(); !strings.Contains(text, "Integration Default") {
+		t.Fatalf("expected all-sites view to list unassigned projects again")
+	}
+}
+
+func TestFloorMapPlacesPalletsInCells(t *testing.T) {
+	env, client := setupIntegrationServer(t)
+	loginAs(t, client, env.server.URL, "admin", "Admin123!Receipter")
+
+	resp := postForm(t, client, env.server.URL, "/tasker/admin/sites", url.Values{"name": {"Leeds DC"}})
+	_ = resp.Body.Close()
+	var siteID int64
+	if err := env.db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT id FROM sites WHERE code = 'leeds-dc'`).Scan(ctx, &siteID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE projects SET site_id = ? WHERE id = 1`, siteID)
+		return err
+	}); err != nil {
+		t.Fatalf("assign project to site: %v", err)
+	}
+	resp = postForm(t, client, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+
+	mapPath := fmt.Sprintf("/tasker/admin/sites/%d/floor-map", siteID)
+	resp = postForm(t, client, env.server.URL, mapPath, url.Values{"rows": {"3"}, "cols": {"4"}})
+	if resp.StatusCode != http.StatusSeeOther || strings.Contains(resp.Header.Get("Location"), "error=") {
+		t.Fatalf("expected floor map size saved, status=%d location=%q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+	resp = postForm(t, client, env.server.URL, mapPath+"/zones", url.Values{"code": {"dock"}, "name": {"Dock doors"}, "from_cell": {"A1"}, "to_cell": {"D1"}})
+	_ = resp.Body.Close()
+	resp = postForm(t, client, env.server.URL, mapPath+"/locations", url.Values{"pallet": {"P00000001"}, "cell": {"b2"}})
+	if loc := resp.Header.Get("Location"); resp.StatusCode != http.StatusSeeOther || !strings.Contains(loc, "cell=B2") || strings.Contains(loc, "error=") {
+		t.Fatalf("expected pallet placed in B2, status=%d location=%q", resp.StatusCode, loc)
+	}
+	_ = resp.Body.Close()
+	resp = postForm(t, client, env.server.URL, mapPath+"/locations", url.Values{"pallet": {"P00000001"}, "cell": {"E1"}})
+	if loc := resp.Header.Get("Location"); !strings.Contains(loc, "error=") {
+		t.Fatalf("expected a cell off the map to be refused, location=%q", loc)
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, client, env.server.URL, mapPath+"?cell=B2")
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	page := string(body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected floor map 200, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(page, `title="B2 · 1 pallet"`) || !strings.Contains(page, `data-status="created"`) || !strings.Contains(page, `data-zone="DOCK"`) {
+		t.Fatalf("expected B2 coloured by its created pallet and the dock zone outlined")
+	}
+	if !strings.Contains(page, "Cell B2") || !strings.Contains(page, "P00000001") {
+		t.Fatalf("expected the selected cell to list its pallet")
+	}
+
+	var action string
+	if err := env.db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT action FROM audit_logs WHERE entity_type = 'pallets' AND entity_id = '1' ORDER BY id DESC LIMIT 1`).Scan(ctx, &action)
+	}); err != nil || action != "pallet.locate" {
+		t.Fatalf("expected placement audited, got %q err=%v", action, err)
+	}
+
+	scannerClient := newHTTPClient(t)
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+	resp = get(t, scannerClient, env.server.URL, mapPath)
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		t.Fatalf("expected scanners to be kept off the floor map")
+	}
+}
+
+func TestLoadHarnessDrivesReceiptsAndProgress(t *testing.T) {
+	if testing.Short() {
+		t.Skip("load run skipped in short mode")
+	}
+	env, _ := setupIntegrationServer(t)
+
+	report, err := loadtest.Run(context.Background(), loadtest.Config{
+		BaseURL:         env.server.URL,
+		Scanners:        4,
+		Admins:          2,
+		Duration:        750 * time.Millisecond,
+		SKUs:            10,
+		AdminUsername:   "admin",
+		AdminPassword:   "Admin123!Receipter",
+		ScannerUsername: "scanner1",
+		ScannerPassword: "Scanner123!Receipter",
+	})
+	if err != nil {
+		t.Fatalf("load run: %v", err)
+	}
+	for _, op := range []string{loadtest.OpReceipt, loadtest.OpProgress, loadtest.OpSKUView} {
+		s := report.Ops[op]
+		if s.Count == 0 || s.Errors > 0 {
+			var buf bytes.Buffer
+			report.Write(&buf)
+			t.Fatalf("expected %s requests without errors:\n%s", op, buf.String())
+		}
+	}
+
+	var lines int64
+	if err := env.db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT COUNT(*) FROM pallet_receipts WHERE sku LIKE 'LOAD-%'`).Scan(ctx, &lines)
+	}); err != nil {
+		t.Fatalf("count load lines: %v", err)
+	}
+	if lines == 0 {
+		t.Fatalf("expected load run to save receipt lines")
+	}
+}
+
+func TestPalletLabelVoidWarnsAtScanLookup(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	adminClient := newHTTPClient(t)
+	scannerClient := newHTTPClient(t)
+
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected create pallet 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+	for i := 0; i < 2; i++ {
+		resp = get(t, adminClient, env.server.URL, "/tasker/pallets/1/label")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected label print 200, got %d", resp.StatusCode)
+		}
+		_ = resp.Body.Close()
+	}
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/pallets/1/labels/1/void", url.Values{"reason": {"torn"}})
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=") {
+		t.Fatalf("expected void redirect with status, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/pallets/1/labels")
+	page, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(page), "P00000001-1") || !strings.Contains(string(page), "torn") {
+		t.Fatalf("expected labels page to list voided label, status=%d", resp.StatusCode)
+	}
+
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+	resp = postForm(t, scannerClient, env.server.URL, "/tasker/pallets/1/labels/2/void", nil)
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/login" {
+		t.Fatalf("expected scanner void to be refused, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	lookup := func(code string) (int, map[string]any) {
+		t.Helper()
+		resp := get(t, scannerClient, env.server.URL, "/tasker/scan/pallet/lookup?code="+url.QueryEscape(code))
+		defer resp.Body.Close()
+		out := map[string]any{}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatalf("decode lookup %s: %v", code, err)
+		}
+		return resp.StatusCode, out
+	}
+	status, out := lookup("P00000001-1")
+	warning, _ := out["warning"].(string)
+	if status != http.StatusOK || !strings.Contains(warning, "voided") || !strings.Contains(warning, "P00000001-2") {
+		t.Fatalf("expected voided label warning, status=%d body=%v", status, out)
+	}
+	if status, out = lookup("P00000001-2"); status != http.StatusOK || out["warning"] != nil || out["receiptUrl"] != "/tasker/pallets/1/receipt" {
+		t.Fatalf("expected valid label lookup, status=%d body=%v", status, out)
+	}
+	if status, _ = lookup("P00000001-5"); status != http.StatusNotFound {
+		t.Fatalf("expected unprinted label 404, got %d", status)
+	}
+}
+
+func TestHelpNoticesShowOnHelpPageAndReceiptBanner(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	adminClient := newHTTPClient(t)
+	scannerClient := newHTTPClient(t)
+
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected create pallet 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/admin/help", url.Values{
+		"role":            {"scanner"},
+		"project_id":      {"1"},
+		"title":           {"Chilled loads"},
+		"body":            {"Always photograph **seal numbers**"},
+		"show_on_receipt": {"1"},
+		"active":          {"1"},
+	})
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=") {
+		t.Fatalf("expected notice create redirect with status, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/admin/help", url.Values{
+		"role":   {"scanner"},
+		"title":  {"Gloves"},
+		"body":   {"Wear gloves in the freezer"},
+		"active": {"1"},
+	})
+	_ = resp.Body.Close()
+
+	loginAs(t, scannerClient, env.server.URL, "scanner1", "Scanner123!Receipter")
+	resp = get(t, scannerClient, env.server.URL, "/tasker/help")
+	page, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(page), "Wear gloves in the freezer") {
+		t.Fatalf("expected scanner help page to show site notes, status=%d", resp.StatusCode)
+	}
+
+	resp = get(t, scannerClient, env.server.URL, "/tasker/pallets/1/receipt")
+	page, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(page), "<strong>seal numbers</strong>") || strings.Contains(string(page), "Wear gloves") {
+		t.Fatalf("expected receipt page to show only the receipt banner")
+	}
+
+	resp = postForm(t, scannerClient, env.server.URL, "/tasker/help/notices/1/dismiss", url.Values{"return_to": {"/tasker/pallets/1/receipt"}})
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/tasker/pallets/1/receipt" {
+		t.Fatalf("expected dismiss to return to receipt, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+	resp = get(t, scannerClient, env.server.URL, "/tasker/pallets/1/receipt")
+	page, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if strings.Contains(string(page), "seal numbers") {
+		t.Fatalf("expected dismissed banner to be hidden")
+	}
+
+	resp = postForm(t, scannerClient, env.server.URL, "/tasker/admin/help/1/delete", nil)
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/login" {
+		t.Fatalf("expected scanner notice delete to be refused, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+}
+
+type recordingSheets struct {
+	rows [][]string
+}
+
+func (s *recordingSheets) Replace(ctx context.Context, spreadsheetID, tab string, rows [][]string) error {
+	s.rows = rows
+	return nil
+}
+
+func (s *recordingSheets) Append(ctx context.Context, spreadsheetID, tab string, header []string, rows [][]string) error {
+	s.rows = append([][]string{header}, rows...)
+	return nil
+}
+
+func TestScheduledExportDeliversToSheetsAndRecordsDestination(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	adminClient := newHTTPClient(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/exports/schedules", url.Values{
+		"name":           {"Status feed"},
+		"project_id":     {"1"},
+		"export_type":    {"pallet_status_csv"},
+		"interval_hours": {"24"},
+		"spreadsheet":    {"https://docs.google.com/spreadsheets/d/sheetABC/edit#gid=0"},
+		"sheet_tab":      {"Pallets"},
+		"write_mode":     {"replace"},
+	})
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=") {
+		t.Fatalf("expected schedule create redirect with status, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	// Without credentials the run is recorded as failed on the schedule.
+	if _, err := env.app.SheetExports.RunDue(context.Background(), time.Now().UTC()); err != nil {
+		t.Fatalf("run due: %v", err)
+	}
+	resp = get(t, adminClient, env.server.URL, "/tasker/exports/schedules")
+	page, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(page), "sheetABC") || !strings.Contains(string(page), "google sheets is not configured") {
+		t.Fatalf("expected schedules page to show the schedule and its error, status=%d", resp.StatusCode)
+	}
+
+	sheets := &recordingSheets{}
+	env.app.SheetExports.Sheets = sheets
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/exports/schedules/1/run", nil)
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected run now 303, got %d", resp.StatusCode)
+	}
+	_ = resp.Body.Close()
+	if ran, err := env.app.SheetExports.RunDue(context.Background(), time.Now().UTC()); err != nil || ran != 1 {
+		t.Fatalf("run due = %d, %v", ran, err)
+	}
+	if len(sheets.rows) != 2 || sheets.rows[0][0] != "pallet_id" || sheets.rows[1][0] != "1" {
+		t.Fatalf("unexpected delivered rows %v", sheets.rows)
+	}
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/exports/runs")
+	page, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(page), "Google Sheets sheetABC, tab &#34;Pallets&#34; (replace)") {
+		t.Fatalf("expected export history to show the sheet destination")
+	}
+}
+
+func TestCatalogSyncAPI_UpsertsDeactivatesAndAuditsToken(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	seedClientUser(t, env.db, "client1", "Client123!Receipter", 1)
+	adminID := userIDByUsername(t, env.db, "admin")
+	clientToken, _, err := apitoken.Issue(context.Background(), env.db, nil, adminID, userIDByUsername(t, env.db, "client1"), "Item master sync")
+	if err != nil {
+		t.Fatalf("issue client token: %v", err)
+	}
+
+	status, out := postAPIJSON(t, env.server.URL, "/api/projects/1/stock-items/batch", clientToken, `{
+		"upsert": [
+			{"sku": "SKU-1", "description": "Widget", "uom": "EA"},
+			{"sku": "SKU-2", "description": "Gadget", "uom": "CS"},
+			{"sku": "SKU-3", "description": " ", "uom": "EA"}
+		],
+		"deactivate": ["SKU-404"]
+	}`)
+	if status != http.StatusOK {
+		t.Fatalf("expected batch 200, got %d body=%s", status, out)
+	}
+	var batch struct {
+		Summary struct {
+			Inserted int `json:"inserted"`
+			NotFound int `json:"notFound"`
+			Errors   int `json:"errors"`
+			Changes  []struct {
+				SKU    string `json:"sku"`
+				Result string `json:"result"`
+				Error  string `json:"error"`
+			} `json:"changes"`
+		} `json:"summary"`
+	}
+	if err := json.Unmarshal([]byte(out), &batch); err != nil {
+		t.Fatalf("decode batch: %v body=%s", err, out)
+	}
+	if batch.Summary.Inserted != 2 || batch.Summary.Errors != 1 || batch.Summary.NotFound != 1 || len(batch.Summary.Changes) != 4 {
+		t.Fatalf("unexpected batch summary %s", out)
+	}
+	if batch.Summary.Changes[2].Error != "description is required" {
+		t.Fatalf("expected CSV import validation message, got %+v", batch.Summary.Changes[2])
+	}
+
+	req, err := http.NewRequest(http.MethodPut, env.server.URL+"/api/projects/1/stock-items", strings.NewReader(`{"sku":"SKU-1","description":"Widget v2","uom":"EA"}`))
+	if err != nil {
+		t.Fatalf("build put: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+clientToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("put stock item: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"result":"updated"`) {
+		t.Fatalf("expected single upsert to update, got %d %s", resp.StatusCode, body)
+	}
+
+	status, out = postAPIJSON(t, env.server.URL, "/api/projects/1/stock-items/deactivate", clientToken, `{"sku":"SKU-2"}`)
+	if status != http.StatusOK || !strings.Contains(out, `"result":"deactivated"`) {
+		t.Fatalf("expected deactivate, got %d %s", status, out)
+	}
+	resp, out = getAPI(t, env.server.URL, "/api/projects/1/stock-items", clientToken, "")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(out, `"sku":"SKU-2","description":"Gadget","uom":"CS","active":false`) {
+		t.Fatalf("expected listing to show SKU-2 inactive, got %d %s", resp.StatusCode, out)
+	}
+
+	var audited int
+	if err := env.db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT COUNT(*) FROM audit_logs WHERE action IN ('stock.create', 'stock.update', 'stock.deactivate') AND after_json LIKE '%"apiTokenName":"Item master sync"%'`).Scan(ctx, &audited)
+	}); err != nil {
+		t.Fatalf("count audit: %v", err)
+	}
+	if audited != 4 {
+		t.Fatalf("expected 4 catalog audit entries attributed to the token, got %d", audited)
+	}
+
+	if err := env.db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO projects (name, description, project_date, client_name, code, status) VALUES ('Other', 'other', DATE('now'), 'Other', 'other-client', 'active')`)
+		return err
+	}); err != nil {
+		t.Fatalf("seed other project: %v", err)
+	}
+	if status, _ := postAPIJSON(t, env.server.URL, "/api/projects/2/stock-items/deactivate", clientToken, `{"sku":"SKU-1"}`); status != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unassigned project, got %d", status)
+	}
+}
+
+func TestUnusedPalletCleanupRespectsExemptionAndReports(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	adminClient := newHTTPClient(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+	if err := env.db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO project_settings (project_id, key, value) VALUES (1, 'pallet.unused_cancel_days', '3')`)
+		return err
+	}); err != nil {
+		t.Fatalf("set cleanup days: %v", err)
+	}
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/projects/1/unused-pallets/1/exempt", url.Values{"exempt": {"1"}})
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=") {
+		t.Fatalf("expected exemption redirect with status, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	later := time.Now().UTC().Add(4 * 24 * time.Hour)
+	if cancelled, err := env.app.PalletSweep.Sweep(context.Background(), later); err != nil || len(cancelled) != 0 {
+		t.Fatalf("exempt pallet swept: %+v, %v", cancelled, err)
+	}
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/projects/1/unused-pallets/1/exempt", url.Values{"exempt": {"0"}})
+	_ = resp.Body.Close()
+	if cancelled, err := env.app.PalletSweep.Sweep(context.Background(), later); err != nil || len(cancelled) != 1 {
+		t.Fatalf("expected the pallet cancelled once exemption was removed: %+v, %v", cancelled, err)
+	}
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/projects/1/unused-pallets")
+	page, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(page), "1 unused pallets have been cancelled") || !strings.Contains(string(page), "P00000001") {
+		t.Fatalf("expected report to list the cancelled pallet, status=%d", resp.StatusCode)
+	}
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/projects/1/unused-pallets/1/exempt", url.Values{"exempt": {"1"}})
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "error=") {
+		t.Fatalf("expected cancelled pallet exemption to be refused, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+}
+
+func TestProjectPhaseCloseLocksPalletsAndFiltersExports(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	adminClient := newHTTPClient(t)
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/projects/1/phases", url.Values{"name": {"Wave 1"}})
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=") {
+		t.Fatalf("expected phase start redirect with status, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/api/pallets/1/receipts", url.Values{
+		"sku": {"SKU-W1"}, "description": {"Wave one"}, "qty": {"2"}, "case_size": {"1"}, "damaged_qty": {"0"},
+	})
+	_ = resp.Body.Close()
+
+	var wave1 int64
+	if err := env.db.R.NewRaw(`SELECT phase_id FROM pallet_phases WHERE pallet_id = 1`).Scan(context.Background(), &wave1); err != nil {
+		t.Fatalf("expected pallet 1 in the current phase: %v", err)
+	}
+	resp = postForm(t, adminClient, env.server.URL, fmt.Sprintf("/tasker/projects/1/phases/%d/close", wave1), nil)
+	_ = resp.Body.Close()
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/projects/1/phases", url.Values{"name": {"Wave 2"}})
+	_ = resp.Body.Close()
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/api/pallets/1/receipts", url.Values{
+		"sku": {"SKU-LATE"}, "description": {"Too late"}, "qty": {"1"}, "case_size": {"1"}, "damaged_qty": {"0"},
+	})
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "phase+is+closed") {
+		t.Fatalf("expected receipt on a closed phase pallet to be refused, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/api/pallets/2/receipts", url.Values{
+		"sku": {"SKU-W2"}, "description": {"Wave two"}, "qty": {"5"}, "case_size": {"1"}, "damaged_qty": {"0"},
+	})
+	if resp.StatusCode != http.StatusSeeOther || strings.Contains(resp.Header.Get("Location"), "error=") {
+		t.Fatalf("expected receipt on the next phase to save, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/pallets/1/receipt")
+	page, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(page), "Wave 1 is closed. This pallet is read-only.") {
+		t.Fatalf("expected the receipt page to show the closed phase")
+	}
+
+	resp = get(t, adminClient, env.server.URL, fmt.Sprintf("/tasker/exports/receipts.csv?project_id=1&phase_id=%d", wave1))
+	csvBody, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(csvBody), "SKU-W1") || strings.Contains(string(csvBody), "SKU-W2") {
+		t.Fatalf("expected the phase export to hold only wave 1 lines, status=%d body=%q", resp.StatusCode, csvBody)
+	}
+	resp = get(t, adminClient, env.server.URL, "/tasker/exports/receipts.csv?project_id=1&phase_id=999")
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected unknown phase export 404, got %d", resp.StatusCode)
+	}
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/projects/1/phases")
+	page, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(page), "Wave 2") || !strings.Contains(string(page), "current") {
+		t.Fatalf("expected the phases page to list both phases, status=%d", resp.StatusCode)
+	}
+}
+
+func TestClientEmailReplyAddsComment(t *testing.T) {
+	env, _ := setupIntegrationServer(t)
+	env.app.ReplyMail.Secret = "inbound-secret"
+	env.app.ReplyMail.Address = "comments@receipter.example"
+	adminClient := newHTTPClient(t)
+	clientHTTP := newHTTPClient(t)
+
+	clientPassword := "Client123!Receipter"
+	clientUserID := seedClientUser(t, env.db, "client1", clientPassword, 1)
+
+	loginAs(t, adminClient, env.server.URL, "admin", "Admin123!Receipter")
+	resp := postForm(t, adminClient, env.server.URL, "/tasker/pallets/new", nil)
+	_ = resp.Body.Close()
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/api/pallets/1/receipts", url.Values{
+		"sku":          {"SKU-R1"},
+		"description":  {"Reply SKU"},
+		"qty":          {"5"},
+		"batch_number": {"RB1"},
+		"expiry_date":  {"2029-01-01"},
+	})
+	_ = resp.Body.Close()
+	resp = postForm(t, adminClient, env.server.URL, "/tasker/admin/users/client-reply-email", url.Values{
+		"reply_user_id": {fmt.Sprintf("%d", clientUserID)},
+		"reply_email":   {"Buyer@Client.example"},
+	})
+	if resp.StatusCode != http.StatusSeeOther || !strings.Contains(resp.Header.Get("Location"), "status=") {
+		t.Fatalf("expected reply email saved, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	_ = resp.Body.Close()
+
+	loginAs(t, clientHTTP, env.server.URL, "client1", clientPassword)
+	resp = postForm(t, clientHTTP, env.server.URL, "/tasker/pallets/sku-view/detail/comment", url.Values{
+		"project_id": {"1"},
+		"sku":        {"SKU-R1"},
+		"batch":      {"RB1"},
+		"expiry":     {"2029-01-01"},
+		"pallet_id":  {"1"},
+		"comment":    {"Is this the right batch?"},
+	})
+	_ = resp.Body.Close()
+
+	var token string
+	if err := env.db.R.NewRaw(`SELECT token FROM client_comment_threads WHERE pallet_id = 1 AND sku = 'SKU-R1' AND expiry_date = '2029-01-01'`).Scan(context.Background(), &token); err != nil {
+		t.Fatalf("load thread token: %v", err)
+	}
+	var replyKey string
+	if err := env.db.R.NewRaw(`SELECT reply_key FROM client_comment_threads WHERE token = ?`, token).Scan(context.Background(), &replyKey); err != nil {
+		t.Fatalf("load reply key: %v", err)
+	}
+	replyAddress := "comments+" + token + "." + replyKey + "@receipter.example"
+	resp = get(t, clientHTTP, env.server.URL, "/tasker/pallets/sku-view/detail?project_scope=1&sku=SKU-R1&uom=&batch=RB1&expiry=2029-01-01")
+	detail, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(detail), replyAddress) {
+		t.Fatalf("expected the client to see the thread's reply address %s", replyAddress)
+	}
+
+	inbound := func(secret, from, spf string) (*http.Response, string) {
+		resp, err := http.PostForm(env.server.URL+"/inbound/email/"+secret, url.Values{
+			"sender":        {from},
+			"recipient":     {"comments@receipter.example"},
+			"subject":       {"Re: Client comment " + replymail.Reference(token)},
+			"body-plain":    {"Yes, that batch is fine.\n\nOn Mon, 1 Jan 2029 at 09:00, Receipter wrote:\n> Is this the right batch?"},
+			"X-Mailgun-Spf": {spf},
+		})
+		if err != nil {
+			t.Fatalf("post inbound email: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return resp, string(body)
+	}
+
+	if resp, _ := inbound("wrong-secret", "buyer@client.example", "Pass"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected wrong secret 404, got %d", resp.StatusCode)
+	}
+	if resp, body := inbound("inbound-secret", "Someone Else <other@client.example>", "Pass"); resp.StatusCode != http.StatusOK || !strings.Contains(body, `"rejected"`) {
+		t.Fatalf("expected unknown sender rejected, got %d %s", resp.StatusCode, body)
+	}
+	if resp, body := inbound("inbound-secret", "Buyer <buyer@client.example>", "Fail"); resp.StatusCode != http.StatusOK || !strings.Contains(body, "could not be verified") {
+		t.Fatalf("expected a registered sender without an SPF pass rejected, got %d %s", resp.StatusCode, body)
+	}
+	if resp, body := inbound("inbound-secret", "Buyer <buyer@client.example>", "Pass"); resp.StatusCode != http.StatusOK || !strings.Contains(body, `"accepted"`) {
+		t.Fatalf("expected registered sender accepted, got %d %s", resp.StatusCode, body)
+	}
+	resp, err := http.PostForm(env.server.URL+"/inbound/email/inbound-secret", url.Values{
+		"sender":     {"buyer@client.example"},
+		"recipient":  {replyAddress},
+		"subject":    {"Re: Client comment"},
+		"body-plain": {"Sent to the reply address."},
+	})
+	if err != nil {
+		t.Fatalf("post inbound email: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), `"accepted"`) {
+		t.Fatalf("expected a reply to the thread's reply address accepted without a verdict, got %s", body)
+	}
+
+	var count int
+	if err := env.db.R.NewRaw(`SELECT COUNT(1) FROM sku_client_comments WHERE created_by_user_id = ?`, clientUserID).Scan(context.Background(), &count); err != nil {
+		t.Fatalf("count comments: %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("expected web and email comments, got %d", count)
+	}
+
+	resp = get(t, adminClient, env.server.URL, "/tasker/admin/comments")
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), "Yes, that batch is fine.") || strings.Contains(string(body), "&gt; Is this the right batch?") {
+		t.Fatalf("expected the reply without its quoted text on the moderation page")
+	}
+	if !strings.Contains(string(body), "other@client.example") || !strings.Contains(string(body), "not a registered client reply address") {
+		t.Fatalf("expected the rejected reply logged on the moderation page")
+	}
+}
+
+func TestAuditorLinkGrantsLoggedReadOnlyAccessUntilRevoked(t *testing.T) {
+	env, client := setupIntegrationServer(t)
+	loginAs(t, client, env.server.URL, "admin", "Admin123!Receipter")
+
+	projectID := projectIDByCode(t, env.db, "it-default")
+	auditorsPath := fmt.Sprintf("/tasker/projects/%d/auditors", projectID)
+	resp := postForm(t, client, env.server.URL, auditorsPath, url.Values{
+		"auditor_name": {"Jo Auditor"},
+		"days":         {"3"},
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected issue link 200, got %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read issue body: %v", err)
+	}
+	_ = resp.Body.Close()
+	match := regexp.MustCompile(`/audit/(audit_[0-9a-f]+)`).FindStringSubmatch(string(body))
+	if match == nil {
+		t.Fatalf("expected auditor link in issue page")
+	}
+	token := match[1]
+
+	anon := newHTTPClient(t)
+	for _, path := range []string{"/audit/" + token, "/audit/" + token + "/pallets", "/audit/" + token + "/logs"} {
+		resp = get(t, anon, env.server.URL, path)
+		page, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected %s 200, got %d", path, resp.StatusCode)
+		}
+		if !strings.Contains(string(page), "audit-watermark") || !strings.Contains(string(page), "Jo Auditor") {
+			t.Fatalf("expected %s to be watermarked for the auditor", path)
+		}
+		if cc := resp.Header.Get("Cache-Control"); cc != "no-store" {
+			t.Fatalf("expected %s not to be cached, got %q", path, cc)
+		}
+	}
+	resp = postForm(t, anon, env.server.URL, "/audit/"+token, nil)
+	_ = resp.Body.Close()
+	if resp.StatusCode < http.StatusBadRequest {
+		t.Fatalf("expected auditor link to refuse POST, got %d", resp.StatusCode)
+	}
+
+	if err := env.app.AccessLog.Flush(context.Background()); err != nil {
+		t.Fatalf("flush access log: %v", err)
+	}
+	var logged []struct {
+		Username string `bun:"username"`
+		Path     string `bun:"path"`
+	}
+	err = env.db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT username, path FROM client_access_log WHERE project_id = ? ORDER BY id`, projectID).Scan(ctx, &logged)
+	})
+	if err != nil {
+		t.Fatalf("load access log: %v", err)
+	}
+	if len(logged) != 3 {
+		t.Fatalf("expected 3 logged views, got %+v", logged)
+	}
+	for _, entry := range logged {
+		if entry.Username != "auditor: Jo Auditor" || strings.Contains(entry.Path, token) {
+			t.Fatalf("unexpected access log entry %+v", entry)
+		}
+	}
+	links, err := auditorlink.List(context.Background(), env.db, projectID, time.Now().UTC())
+	if err != nil || len(links) != 1 || links[0].Views != 3 {
+		t.Fatalf("expected the link to count 3 views, got %+v, %v", links, err)
+	}
+
+	var linkID int64
+	err = env.db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT id FROM auditor_links LIMIT 1`).Scan(ctx, &linkID)
+	})
+	if err != nil {
+		t.Fatalf("load link id: %v", err)
+	}
+	resp = postForm(t, client, env.server.URL, fmt.Sprintf("%s/%d/revoke", auditorsPath, linkID), nil)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("expected revoke 303, got %d", resp.StatusCode)
+	}
+	resp = get(t, anon, env.server.URL, "/audit/"+token+"/pallets")
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected revoked link 404, got %d", resp.StatusCode)
+	}
+}
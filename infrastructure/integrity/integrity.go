@@ -0,0 +1,317 @@
+// Package integrity checks the database for inconsistencies the schema does
+// not stop, or that slip in through manual edits: receipt lines pointing at
+// missing pallets, damaged quantities above the line quantity, photos left
+// behind by deleted lines and so on. Each run records a result per check so
+// the admin health page can show what failed and which rows to look at.
+package integrity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/delivery"
+	"receipter/infrastructure/sqlite"
+)
+
+const (
+	TriggerScheduled = "scheduled"
+	TriggerManual    = "manual"
+
+	// EventReport is the delivery event of emailed run summaries.
+	EventReport = "integrity.report"
+
+	// sampleLimit caps the offending row ids kept per check.
+	sampleLimit = 10
+	// runRetention is how many runs are kept.
+	runRetention = 90
+)
+
+// Check is one invariant. Query selects the id of every row that breaks it.
+type Check struct {
+	Key         string
+	Label       string
+	Description string
+	Query       string
+}
+
+// Checks lists every invariant in display order.
+var Checks = []Check{
+	{
+		Key:         "receipt_missing_pallet",
+		Label:       "Receipt lines without a pallet",
+		Description: "Receipt lines whose pallet no longer exists.",
+		Query:       `SELECT pr.id FROM pallet_receipts pr LEFT JOIN pallets p ON p.id = pr.pallet_id WHERE p.id IS NULL`,
+	},
+	{
+		Key:         "receipt_project_mismatch",
+		Label:       "Receipt lines on another project's pallet",
+		Description: "Receipt lines whose project differs from their pallet's project.",
+		Query:       `SELECT pr.id FROM pallet_receipts pr JOIN pallets p ON p.id = pr.pallet_id WHERE pr.project_id <> p.project_id`,
+	},
+	{
+		Key:         "receipt_bad_quantity",
+		Label:       "Receipt lines with impossible quantities",
+		Description: "Receipt lines with a quantity below 1, or a damaged quantity below 0 or above the quantity.",
+		Query:       `SELECT id FROM pallet_receipts WHERE qty <= 0 OR damaged_qty < 0 OR damaged_qty > qty`,
+	},
+	{
+		Key:         "receipt_damage_flag_mismatch",
+		Label:       "Damaged flag disagrees with damaged quantity",
+		Description: "Lines marked damaged with no damaged quantity, or with a damaged quantity but not marked damaged.",
+		Query:       `SELECT id FROM pallet_receipts WHERE (damaged = 1 AND damaged_qty = 0) OR (damaged = 0 AND damaged_qty > 0)`,
+	},
+	{
+		Key:         "receipt_missing_scanner",
+		Label:       "Receipt lines scanned by a missing user",
+		Description: "Receipt lines whose scanned-by user no longer exists.",
+		Query:       `SELECT pr.id FROM pallet_receipts pr LEFT JOIN users u ON u.id = pr.scanned_by_user_id WHERE u.id IS NULL`,
+	},
+	{
+		Key:         "pallet_missing_project",
+		Label:       "Pallets without a project",
+		Description: "Pallets whose project no longer exists.",
+		Query:       `SELECT p.id FROM pallets p LEFT JOIN projects pj ON pj.id = p.project_id WHERE pj.id IS NULL`,
+	},
+	{
+		Key:         "pallet_closed_without_time",
+		Label:       "Closed pallets without a close time",
+		Description: "Closed or labelled pallets with no closed_at.",
+		Query:       `SELECT id FROM pallets WHERE status IN ('closed', 'labelled') AND closed_at IS NULL`,
+	},
+	{
+		Key:         "orphan_photos",
+		Label:       "Orphan photos",
+		Description: "Receipt photos whose line no longer exists.",
+		Query:       `SELECT rp.id FROM receipt_photos rp LEFT JOIN pallet_receipts pr ON pr.id = rp.pallet_receipt_id WHERE pr.id IS NULL`,
+	},
+	{
+		Key:         "orphan_photo_uploads",
+		Label:       "Orphan photo uploads",
+		Description: "Photo uploads whose line no longer exists.",
+		Query:       `SELECT pu.id FROM photo_uploads pu LEFT JOIN pallet_receipts pr ON pr.id = pu.pallet_receipt_id WHERE pr.id IS NULL`,
+	},
+	{
+		Key:         "orphan_custom_values",
+		Label:       "Orphan custom field values",
+		Description: "Custom field values whose line or field no longer exists.",
+		Query: `SELECT rcv.pallet_receipt_id FROM receipt_custom_values rcv
+LEFT JOIN pallet_receipts pr ON pr.id = rcv.pallet_receipt_id
+LEFT JOIN project_custom_fields pcf ON pcf.id = rcv.field_id
+WHERE pr.id IS NULL OR pcf.id IS NULL`,
+	},
+}
+
+// LookupCheck returns the check with key.
+func LookupCheck(key string) (Check, bool) {
+	for _, c := range Checks {
+		if c.Key == key {
+			return c, true
+		}
+	}
+	return Check{}, false
+}
+
+// Result is one check's outcome in a run.
+type Result struct {
+	CheckKey   string `bun:"check_key"`
+	Violations int64  `bun:"violations"`
+	SampleIDs  string `bun:"sample_ids"`
+	Error      string `bun:"error"`
+}
+
+// Failed reports whether the check found problems or could not run.
+func (r Result) Failed() bool {
+	return r.Violations > 0 || r.Error != ""
+}
+
+// RunView is a recorded run.
+type RunView struct {
+	ID            int64      `bun:"id"`
+	Trigger       string     `bun:"trigger"`
+	TriggeredBy   string     `bun:"triggered_by"`
+	ChecksRun     int        `bun:"checks_run"`
+	ChecksFailed  int        `bun:"checks_failed"`
+	StartedAt     time.Time  `bun:"started_at"`
+	FinishedAt    *time.Time `bun:"finished_at"`
+	Results       []Result   `bun:"-"`
+	EmailQueuedTo string     `bun:"-"`
+}
+
+// Options control a run.
+type Options struct {
+	Trigger     string
+	ActorUserID int64
+	// EmailTo, when set, queues a summary email of the run.
+	EmailTo string
+}
+
+// Run executes every check and records the results.
+func Run(ctx context.Context, db *sqlite.DB, opts Options) (RunView, error) {
+	run := RunView{Trigger: opts.Trigger, StartedAt: time.Now().UTC(), Results: make([]Result, 0, len(Checks))}
+	if run.Trigger != TriggerManual {
+		run.Trigger = TriggerScheduled
+	}
+
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, check := range Checks {
+			run.Results = append(run.Results, runCheck(ctx, tx, check))
+		}
+		return nil
+	})
+	if err != nil {
+		return run, err
+	}
+	run.ChecksRun = len(run.Results)
+	for _, result := range run.Results {
+		if result.Failed() {
+			run.ChecksFailed++
+		}
+	}
+	finished := time.Now().UTC()
+	run.FinishedAt = &finished
+
+	err = db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var actor *int64
+		if opts.ActorUserID > 0 {
+			actor = &opts.ActorUserID
+		}
+		res, err := tx.ExecContext(ctx, `
+INSERT INTO integrity_runs (trigger, triggered_by_user_id, checks_run, checks_failed, started_at, finished_at)
+VALUES (?, ?, ?, ?, ?, ?)`, run.Trigger, actor, run.ChecksRun, run.ChecksFailed, run.StartedAt, finished)
+		if err != nil {
+			return err
+		}
+		if run.ID, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		for _, result := range run.Results {
+			if _, err := tx.ExecContext(ctx, `
+INSERT INTO integrity_results (run_id, check_key, violations, sample_ids, error)
+VALUES (?, ?, ?, ?, ?)`, run.ID, result.CheckKey, result.Violations, result.SampleIDs, result.Error); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `
+DELETE FROM integrity_runs
+WHERE id NOT IN (SELECT id FROM integrity_runs ORDER BY id DESC LIMIT ?)`, runRetention); err != nil {
+			return err
+		}
+		if opts.EmailTo == "" {
+			return nil
+		}
+		payload, err := json.Marshal(map[string]string{
+			"subject": run.Subject(),
+			"text":    run.Summary(),
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := delivery.Enqueue(ctx, tx, delivery.KindEmail, opts.EmailTo, EventReport, payload); err != nil {
+			return err
+		}
+		run.EmailQueuedTo = opts.EmailTo
+		return nil
+	})
+	return run, err
+}
+
+func runCheck(ctx context.Context, tx bun.Tx, check Check) Result {
+	result := Result{CheckKey: check.Key}
+	if err := tx.NewRaw(`SELECT COUNT(1) FROM (`+check.Query+`)`).Scan(ctx, &result.Violations); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if result.Violations == 0 {
+		return result
+	}
+	ids := make([]int64, 0, sampleLimit)
+	if err := tx.NewRaw(`SELECT * FROM (`+check.Query+`) ORDER BY 1 LIMIT ?`, sampleLimit).Scan(ctx, &ids); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, strconv.FormatInt(id, 10))
+	}
+	result.SampleIDs = strings.Join(parts, ", ")
+	return result
+}
+
+// Subject is the summary email subject.
+func (r RunView) Subject() string {
+	if r.ChecksFailed == 0 {
+		return "Receipter integrity check: all checks passed"
+	}
+	return fmt.Sprintf("Receipter integrity check: %d of %d checks failed", r.ChecksFailed, r.ChecksRun)
+}
+
+// Summary is a plain-text report of the run, listing failed checks first.
+func (r RunView) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Integrity run #%d (%s) at %s\n", r.ID, r.Trigger, r.StartedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "%d of %d checks failed.\n", r.ChecksFailed, r.ChecksRun)
+	for _, result := range r.Results {
+		if !result.Failed() {
+			continue
+		}
+		check, _ := LookupCheck(result.CheckKey)
+		if result.Error != "" {
+			fmt.Fprintf(&b, "\n- %s: could not run: %s", check.Label, result.Error)
+			continue
+		}
+		fmt.Fprintf(&b, "\n- %s: %d (ids %s)", check.Label, result.Violations, result.SampleIDs)
+	}
+	return b.String()
+}
+
+// LatestRun returns the most recent run with its results; ok is false when
+// nothing has run yet.
+func LatestRun(ctx context.Context, db *sqlite.DB) (RunView, bool, error) {
+	runs, err := ListRuns(ctx, db, 1)
+	if err != nil || len(runs) == 0 {
+		return RunView{}, false, err
+	}
+	run := runs[0]
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT check_key, violations, sample_ids, error
+FROM integrity_results
+WHERE run_id = ?`, run.ID).Scan(ctx, &run.Results)
+	})
+	if err != nil {
+		return run, true, err
+	}
+	// Show results in check order, whatever order they were stored in.
+	byKey := make(map[string]Result, len(run.Results))
+	for _, result := range run.Results {
+		byKey[result.CheckKey] = result
+	}
+	run.Results = run.Results[:0]
+	for _, check := range Checks {
+		if result, ok := byKey[check.Key]; ok {
+			run.Results = append(run.Results, result)
+		}
+	}
+	return run, true, nil
+}
+
+// ListRuns returns the most recent runs, newest first, without results.
+func ListRuns(ctx context.Context, db *sqlite.DB, limit int) ([]RunView, error) {
+	runs := make([]RunView, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT ir.id, ir.trigger, COALESCE(u.username, '') AS triggered_by,
+       ir.checks_run, ir.checks_failed, ir.started_at, ir.finished_at
+FROM integrity_runs ir
+LEFT JOIN users u ON u.id = ir.triggered_by_user_id
+ORDER BY ir.id DESC
+LIMIT ?`, limit).Scan(ctx, &runs)
+	})
+	return runs, err
+}
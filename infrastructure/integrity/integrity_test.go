@@ -0,0 +1,158 @@
+package integrity
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func openIntegrityTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "integrity-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'Inbound', 'd', '2026-02-01', 'Acme', 'inbound', 'active')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open')`,
+			`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, damaged, damaged_qty) VALUES (1, 1, 1, 'SKU-1', 'Good line', 1, 5, 1, 2)`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return db
+}
+
+func resultFor(t *testing.T, run RunView, key string) Result {
+	t.Helper()
+	for _, result := range run.Results {
+		if result.CheckKey == key {
+			return result
+		}
+	}
+	t.Fatalf("no result for %s", key)
+	return Result{}
+}
+
+func TestRunPassesOnConsistentData(t *testing.T) {
+	db := openIntegrityTestDB(t)
+	ctx := context.Background()
+
+	run, err := Run(ctx, db, Options{Trigger: TriggerManual, ActorUserID: 1})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if run.ChecksRun != len(Checks) || run.ChecksFailed != 0 {
+		t.Fatalf("expected %d passing checks, got %d run / %d failed: %s", len(Checks), run.ChecksRun, run.ChecksFailed, run.Summary())
+	}
+
+	latest, ok, err := LatestRun(ctx, db)
+	if err != nil || !ok {
+		t.Fatalf("latest run: ok=%v err=%v", ok, err)
+	}
+	if latest.ID != run.ID || latest.TriggeredBy != "admin" || len(latest.Results) != len(Checks) {
+		t.Fatalf("unexpected latest run %+v", latest)
+	}
+}
+
+func TestRunRecordsViolationsAndQueuesEmail(t *testing.T) {
+	db := openIntegrityTestDB(t)
+	ctx := context.Background()
+
+	// Plant the kind of rows manual edits leave behind. The write pool has a
+	// single connection, so the pragmas apply to these statements.
+	for _, stmt := range []string{
+		`PRAGMA foreign_keys = OFF`,
+		`PRAGMA ignore_check_constraints = ON`,
+		`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, damaged, damaged_qty) VALUES (2, 1, 99, 'SKU-2', 'No pallet', 1, 3, 0, 0)`,
+		`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, damaged, damaged_qty) VALUES (3, 1, 1, 'SKU-3', 'Too damaged', 1, 2, 1, 5)`,
+		`INSERT INTO receipt_photos (id, pallet_receipt_id, photo_blob, photo_mime, photo_name) VALUES (7, 404, x'00', 'image/jpeg', 'orphan.jpg')`,
+		`UPDATE pallets SET status = 'closed', closed_at = NULL WHERE id = 1`,
+		`PRAGMA ignore_check_constraints = OFF`,
+		`PRAGMA foreign_keys = ON`,
+	} {
+		if _, err := db.W.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("plant %q: %v", stmt, err)
+		}
+	}
+
+	run, err := Run(ctx, db, Options{Trigger: TriggerScheduled, EmailTo: "ops@example.com"})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := resultFor(t, run, "receipt_missing_pallet"); got.Violations != 1 || got.SampleIDs != "2" {
+		t.Fatalf("missing pallet result %+v", got)
+	}
+	if got := resultFor(t, run, "receipt_bad_quantity"); got.Violations != 1 || got.SampleIDs != "3" {
+		t.Fatalf("bad quantity result %+v", got)
+	}
+	if got := resultFor(t, run, "orphan_photos"); got.Violations != 1 || got.SampleIDs != "7" {
+		t.Fatalf("orphan photo result %+v", got)
+	}
+	if got := resultFor(t, run, "pallet_closed_without_time"); got.Violations != 1 {
+		t.Fatalf("closed pallet result %+v", got)
+	}
+	if got := resultFor(t, run, "orphan_custom_values"); got.Failed() {
+		t.Fatalf("expected custom values to pass, got %+v", got)
+	}
+	if run.ChecksFailed != 4 {
+		t.Fatalf("expected 4 failed checks, got %d: %s", run.ChecksFailed, run.Summary())
+	}
+
+	var endpoint, event, payload string
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT endpoint, event, CAST(payload AS TEXT) FROM deliveries WHERE kind = 'email'`).Scan(ctx, &endpoint, &event, &payload)
+	})
+	if err != nil {
+		t.Fatalf("load queued email: %v", err)
+	}
+	if endpoint != "ops@example.com" || event != EventReport || !strings.Contains(payload, "4 of 10 checks failed") {
+		t.Fatalf("unexpected email %s %s %s", endpoint, event, payload)
+	}
+}
+
+func TestSchedulerRunsOncePerNight(t *testing.T) {
+	db := openIntegrityTestDB(t)
+	ctx := context.Background()
+	s := NewScheduler(db, nil)
+
+	early := time.Date(2026, 3, 10, 1, 30, 0, 0, time.UTC)
+	if ran, err := s.RunIfDue(ctx, early); err != nil || ran {
+		t.Fatalf("expected no run before the run hour, ran=%v err=%v", ran, err)
+	}
+	// Runs record the real start time, so ask about today for the due check.
+	now := time.Now().UTC()
+	s.RunHour = now.Hour()
+	if ran, err := s.RunIfDue(ctx, now); err != nil || !ran {
+		t.Fatalf("expected a run, ran=%v err=%v", ran, err)
+	}
+	if ran, err := s.RunIfDue(ctx, now.Add(time.Minute)); err != nil || ran {
+		t.Fatalf("expected one run per night, ran=%v err=%v", ran, err)
+	}
+}
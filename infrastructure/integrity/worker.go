@@ -0,0 +1,119 @@
+package integrity
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+const (
+	schedulerPollInterval = time.Hour
+	// DefaultRunHour is the UTC hour the nightly run starts from.
+	DefaultRunHour = 2
+)
+
+// Notifier is woken after a run queues a summary email.
+type Notifier interface {
+	Notify()
+}
+
+// Scheduler runs the checks once a night.
+type Scheduler struct {
+	db         *sqlite.DB
+	deliveries Notifier
+
+	// EmailTo, when set before Start, receives a summary of every
+	// scheduled run.
+	EmailTo string
+	// RunHour is the UTC hour after which the nightly run is due.
+	RunHour int
+
+	// Paused, when set before Start, defers the nightly run while it
+	// returns true.
+	Paused func() bool
+
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	started atomic.Bool
+}
+
+func NewScheduler(db *sqlite.DB, deliveries Notifier) *Scheduler {
+	return &Scheduler{
+		db:         db,
+		deliveries: deliveries,
+		RunHour:    DefaultRunHour,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start checks every hour whether tonight's run is due until Stop.
+func (s *Scheduler) Start() {
+	s.started.Store(true)
+	go func() {
+		defer close(s.done)
+		ctx := context.Background()
+		ticker := time.NewTicker(schedulerPollInterval)
+		defer ticker.Stop()
+		for {
+			if s.Paused == nil || !s.Paused() {
+				if _, err := s.RunIfDue(ctx, time.Now().UTC()); err != nil {
+					slog.Error("integrity: scheduled run failed", slog.Any("err", err))
+				}
+			}
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends a started scheduler and waits for a running check to finish.
+func (s *Scheduler) Stop() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	if !s.started.Load() {
+		return
+	}
+	select {
+	case <-s.done:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+// RunIfDue runs the checks when now is past the run hour and no scheduled
+// run has started since. It reports whether a run happened.
+func (s *Scheduler) RunIfDue(ctx context.Context, now time.Time) (bool, error) {
+	due := time.Date(now.Year(), now.Month(), now.Day(), s.RunHour, 0, 0, 0, time.UTC)
+	if now.Before(due) {
+		return false, nil
+	}
+	var count int
+	err := s.db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT COUNT(1) FROM integrity_runs WHERE trigger = ? AND started_at >= ?`, TriggerScheduled, due).Scan(ctx, &count)
+	})
+	if err != nil || count > 0 {
+		return false, err
+	}
+	run, err := Run(ctx, s.db, Options{Trigger: TriggerScheduled, EmailTo: s.EmailTo})
+	if err != nil {
+		return false, err
+	}
+	if run.ChecksFailed > 0 {
+		slog.Warn("integrity: checks failed", slog.Int64("run_id", run.ID), slog.Int("failed", run.ChecksFailed))
+	}
+	if run.EmailQueuedTo != "" && s.deliveries != nil {
+		s.deliveries.Notify()
+	}
+	return true, nil
+}
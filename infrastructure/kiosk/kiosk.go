@@ -0,0 +1,355 @@
+// Package kiosk enrolls shared receiving tablets and lets scanners switch
+// onto them with a PIN. The device token lives in a long-lived cookie; each
+// PIN switch opens an ordinary session for the chosen user, tagged with the
+// device so the middleware can keep it on the scan and receipt screens.
+package kiosk
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/argon"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+const (
+	tokenPrefix = "kiosk_"
+
+	// HomePath is where a kiosk session lands after a PIN switch.
+	HomePath = "/tasker/scan/pallet"
+
+	// MaxPINFailures wrong PINs in a row lock the user out of kiosks for
+	// PINLockout; their password login is unaffected.
+	MaxPINFailures = 5
+	PINLockout     = 5 * time.Minute
+
+	minPINLength = 4
+	maxPINLength = 8
+)
+
+var (
+	ErrNameRequired    = errors.New("kiosk name is required")
+	ErrNotFound        = errors.New("kiosk not found")
+	ErrInvalidDevice   = errors.New("this device is not an enrolled kiosk")
+	ErrAlreadyEnrolled = errors.New("enrollment link has already been used")
+	ErrInvalidPINUser  = errors.New("kiosk PINs are only available to scanner users")
+	ErrPINFormat       = errors.New("PIN must be 4 to 8 digits")
+	ErrInvalidPIN      = errors.New("incorrect PIN")
+	ErrPINLocked       = errors.New("too many incorrect PINs; try again in a few minutes")
+	ErrWrongSite       = errors.New("this scanner works at another site")
+)
+
+// scannerAtSite matches scanners who may use a kiosk at the site given as
+// both arguments: those assigned to it and those with no site at all. A nil
+// site lets every scanner in.
+const scannerAtSite = `(? IS NULL
+	OR NOT EXISTS (SELECT 1 FROM user_sites us WHERE us.user_id = users.id)
+	OR EXISTS (SELECT 1 FROM user_sites us WHERE us.user_id = users.id AND us.site_id = ?))`
+
+// DeviceView is a kiosk device for admin listings.
+type DeviceView struct {
+	ID          int64      `bun:"id"`
+	Name        string     `bun:"name"`
+	TokenPrefix string     `bun:"token_prefix"`
+	CreatedAt   time.Time  `bun:"created_at"`
+	EnrolledAt  *time.Time `bun:"enrolled_at"`
+	LastSeenAt  *time.Time `bun:"last_seen_at"`
+	RevokedAt   *time.Time `bun:"revoked_at"`
+	SiteID      *int64     `bun:"site_id"`
+}
+
+// PINUser is a scanner who can be picked on the kiosk PIN screen.
+type PINUser struct {
+	ID       int64  `bun:"id"`
+	Username string `bun:"username"`
+	HasPIN   bool   `bun:"has_pin"`
+}
+
+func hashToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken() string {
+	buf := make([]byte, 24)
+	_, _ = rand.Read(buf)
+	return tokenPrefix + hex.EncodeToString(buf)
+}
+
+// Create registers a kiosk at siteID, which may be nil, and returns its
+// device token, which is only shown once inside the enrollment link.
+func Create(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID int64, name string, siteID *int64) (string, models.KioskDevice, error) {
+	var device models.KioskDevice
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", device, ErrNameRequired
+	}
+	plaintext := newToken()
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		device = models.KioskDevice{
+			Name:            name,
+			TokenHash:       hashToken(plaintext),
+			TokenPrefix:     plaintext[:len(tokenPrefix)+6],
+			CreatedByUserID: actorUserID,
+			SiteID:          siteID,
+		}
+		if _, err := tx.NewInsert().Model(&device).Exec(ctx); err != nil {
+			return err
+		}
+		return auditSvc.Write(ctx, tx, actorUserID, "kiosk.create", "kiosk_devices", strconv.FormatInt(device.ID, 10), nil, map[string]any{
+			"name":    device.Name,
+			"prefix":  device.TokenPrefix,
+			"site_id": device.SiteID,
+		})
+	})
+	if err != nil {
+		return "", models.KioskDevice{}, err
+	}
+	return plaintext, device, nil
+}
+
+// Enroll binds the browser holding plaintext as the kiosk. An enrollment
+// link works once, so a copy left in chat or email cannot enroll another
+// device later.
+func Enroll(ctx context.Context, db *sqlite.DB, plaintext string) (models.KioskDevice, error) {
+	var device models.KioskDevice
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		device, err = findActiveDevice(ctx, tx, plaintext)
+		if err != nil {
+			return err
+		}
+		if device.EnrolledAt != nil {
+			return ErrAlreadyEnrolled
+		}
+		now := time.Now().UTC()
+		device.EnrolledAt = &now
+		device.LastSeenAt = &now
+		_, err = tx.ExecContext(ctx, `UPDATE kiosk_devices SET enrolled_at = ?, last_seen_at = ? WHERE id = ?`, now, now, device.ID)
+		return err
+	})
+	return device, err
+}
+
+// AuthenticateDevice resolves an enrolled, unrevoked kiosk from its cookie
+// and records that it was seen.
+func AuthenticateDevice(ctx context.Context, db *sqlite.DB, plaintext string) (models.KioskDevice, error) {
+	var device models.KioskDevice
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		device, err = findActiveDevice(ctx, tx, plaintext)
+		if err != nil {
+			return err
+		}
+		if device.EnrolledAt == nil {
+			return ErrInvalidDevice
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE kiosk_devices SET last_seen_at = ? WHERE id = ?`, time.Now().UTC(), device.ID)
+		return err
+	})
+	return device, err
+}
+
+func findActiveDevice(ctx context.Context, tx bun.Tx, plaintext string) (models.KioskDevice, error) {
+	var device models.KioskDevice
+	plaintext = strings.TrimSpace(plaintext)
+	if !strings.HasPrefix(plaintext, tokenPrefix) {
+		return device, ErrInvalidDevice
+	}
+	err := tx.NewSelect().Model(&device).Where("token_hash = ?", hashToken(plaintext)).Where("revoked_at IS NULL").Limit(1).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return device, ErrInvalidDevice
+	}
+	return device, err
+}
+
+// Revoke disables a kiosk and ends its open sessions. It returns the ended
+// session tokens so the caller can drop them from the session cache.
+func Revoke(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID, deviceID int64) ([]string, error) {
+	var sessionIDs []string
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var device models.KioskDevice
+		if err := tx.NewSelect().Model(&device).Where("id = ?", deviceID).Scan(ctx); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		if device.RevokedAt != nil {
+			return nil
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE kiosk_devices SET revoked_at = ? WHERE id = ?`, time.Now().UTC(), deviceID); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT id FROM sessions WHERE kiosk_device_id = ?`, deviceID).Scan(ctx, &sessionIDs); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE kiosk_device_id = ?`, deviceID); err != nil {
+			return err
+		}
+		return auditSvc.Write(ctx, tx, actorUserID, "kiosk.revoke", "kiosk_devices", strconv.FormatInt(deviceID, 10),
+			map[string]any{"name": device.Name},
+			map[string]any{"name": device.Name, "ended_sessions": len(sessionIDs)})
+	})
+	return sessionIDs, err
+}
+
+func ListDevices(ctx context.Context, db *sqlite.DB) ([]DeviceView, error) {
+	devices := make([]DeviceView, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT id, name, token_prefix, created_at, enrolled_at, last_seen_at, revoked_at, site_id
+FROM kiosk_devices
+ORDER BY revoked_at IS NOT NULL, name COLLATE NOCASE, id`).Scan(ctx, &devices)
+	})
+	return devices, err
+}
+
+// ListPINUsers returns scanner users; withPINOnly limits it to those who
+// can switch onto a kiosk, and a siteID to those who work at that site.
+func ListPINUsers(ctx context.Context, db *sqlite.DB, withPINOnly bool, siteID *int64) ([]PINUser, error) {
+	users := make([]PINUser, 0)
+	query := `
+SELECT id, username, kiosk_pin_hash != '' AS has_pin
+FROM users
+WHERE role = ? AND disabled_at IS NULL AND ` + scannerAtSite
+	if withPINOnly {
+		query += ` AND kiosk_pin_hash != ''`
+	}
+	query += ` ORDER BY username COLLATE NOCASE`
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(query, rbac.RoleScanner, siteID, siteID).Scan(ctx, &users)
+	})
+	return users, err
+}
+
+// ValidatePIN checks PIN format: 4 to 8 digits.
+func ValidatePIN(pin string) error {
+	if len(pin) < minPINLength || len(pin) > maxPINLength {
+		return ErrPINFormat
+	}
+	for _, r := range pin {
+		if r < '0' || r > '9' {
+			return ErrPINFormat
+		}
+	}
+	return nil
+}
+
+// SetPIN sets a scanner's kiosk PIN, or clears it when pin is empty.
+func SetPIN(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID, userID int64, pin string) error {
+	pin = strings.TrimSpace(pin)
+	hash := ""
+	if pin != "" {
+		if err := ValidatePIN(pin); err != nil {
+			return err
+		}
+		var err error
+		if hash, err = argon.CreateHash(pin, argon.DefaultParams); err != nil {
+			return err
+		}
+	}
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var role string
+		if err := tx.NewRaw(`SELECT role FROM users WHERE id = ?`, userID).Scan(ctx, &role); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrInvalidPINUser
+			}
+			return err
+		}
+		if role != rbac.RoleScanner {
+			return ErrInvalidPINUser
+		}
+		if _, err := tx.ExecContext(ctx, `
+UPDATE users
+SET kiosk_pin_hash = ?, kiosk_pin_failures = 0, kiosk_pin_locked_until = NULL, updated_at = ?
+WHERE id = ?`, hash, time.Now().UTC(), userID); err != nil {
+			return err
+		}
+		action := "kiosk.pin_set"
+		if hash == "" {
+			action = "kiosk.pin_clear"
+		}
+		// Never write the PIN or its hash to the audit log.
+		return auditSvc.Write(ctx, tx, actorUserID, action, "users", strconv.FormatInt(userID, 10), nil, nil)
+	})
+}
+
+// VerifyPIN checks pin for a scanner picked on a kiosk at siteID. Failures
+// are counted per user and lock the user out of kiosks for PINLockout after
+// MaxPINFailures in a row. Scanners who work at another site are refused
+// before their PIN is checked.
+func VerifyPIN(ctx context.Context, db *sqlite.DB, userID int64, pin string, siteID *int64) (models.User, error) {
+	var user models.User
+	var pinHash string
+	var lockedUntil *time.Time
+	var atSite bool
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewSelect().Model(&user).Where("id = ?", userID).Scan(ctx); err != nil {
+			return err
+		}
+		return tx.QueryRowContext(ctx, `SELECT kiosk_pin_hash, kiosk_pin_locked_until, `+scannerAtSite+` FROM users WHERE id = ?`, siteID, siteID, userID).Scan(&pinHash, &lockedUntil, &atSite)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, ErrInvalidPIN
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	if user.Role != rbac.RoleScanner || pinHash == "" || user.DisabledAt != nil {
+		return models.User{}, ErrInvalidPIN
+	}
+	if !atSite {
+		return models.User{}, ErrWrongSite
+	}
+	now := time.Now().UTC()
+	if lockedUntil != nil && lockedUntil.After(now) {
+		return models.User{}, ErrPINLocked
+	}
+
+	ok, err := argon.ComparePasswordAndHash(strings.TrimSpace(pin), pinHash)
+	if err != nil {
+		return models.User{}, err
+	}
+	err = db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if ok {
+			_, err := tx.ExecContext(ctx, `UPDATE users SET kiosk_pin_failures = 0, kiosk_pin_locked_until = NULL WHERE id = ?`, userID)
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+UPDATE users
+SET kiosk_pin_failures = CASE WHEN kiosk_pin_failures + 1 >= ? THEN 0 ELSE kiosk_pin_failures + 1 END,
+    kiosk_pin_locked_until = CASE WHEN kiosk_pin_failures + 1 >= ? THEN ? ELSE kiosk_pin_locked_until END
+WHERE id = ?`, MaxPINFailures, MaxPINFailures, now.Add(PINLockout), userID)
+		return err
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	if !ok {
+		return models.User{}, ErrInvalidPIN
+	}
+	return user, nil
+}
+
+// RecordSwitch audits a PIN switch so captures on a shared tablet can be
+// traced back to the device as well as the user.
+func RecordSwitch(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, device models.KioskDevice, userID int64) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return auditSvc.Write(ctx, tx, userID, "kiosk.switch", "kiosk_devices", strconv.FormatInt(device.ID, 10), nil, map[string]any{
+			"kiosk": device.Name,
+		})
+	})
+}
@@ -0,0 +1,218 @@
+package kiosk
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+func openKioskTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	db, err := sqlite.OpenDB(filepath.Join(t.TempDir(), "kiosk-test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO users (id, username, password_hash, role) VALUES
+	(1, 'admin', 'x', 'admin'),
+	(2, 'scanner1', 'x', 'scanner'),
+	(3, 'scanner2', 'x', 'scanner')`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed users: %v", err)
+	}
+	return db
+}
+
+func TestEnrollmentLinkWorksOnce(t *testing.T) {
+	db := openKioskTestDB(t)
+	ctx := context.Background()
+
+	token, device, err := Create(ctx, db, audit.NewService(), 1, "Dock 3", nil)
+	if err != nil {
+		t.Fatalf("create kiosk: %v", err)
+	}
+	if _, err := AuthenticateDevice(ctx, db, token); !errors.Is(err, ErrInvalidDevice) {
+		t.Fatalf("expected unenrolled device rejected, got %v", err)
+	}
+	if _, err := Enroll(ctx, db, token); err != nil {
+		t.Fatalf("enroll: %v", err)
+	}
+	if _, err := Enroll(ctx, db, token); !errors.Is(err, ErrAlreadyEnrolled) {
+		t.Fatalf("expected second enrollment rejected, got %v", err)
+	}
+	got, err := AuthenticateDevice(ctx, db, token)
+	if err != nil || got.ID != device.ID {
+		t.Fatalf("expected enrolled device to authenticate, got %+v err=%v", got, err)
+	}
+	if _, err := AuthenticateDevice(ctx, db, "kiosk_bogus"); !errors.Is(err, ErrInvalidDevice) {
+		t.Fatalf("expected unknown token rejected, got %v", err)
+	}
+	if _, _, err := Create(ctx, db, audit.NewService(), 1, "  ", nil); !errors.Is(err, ErrNameRequired) {
+		t.Fatalf("expected ErrNameRequired, got %v", err)
+	}
+}
+
+func TestRevokeEndsKioskSessionsOnly(t *testing.T) {
+	db := openKioskTestDB(t)
+	ctx := context.Background()
+
+	token, device, err := Create(ctx, db, audit.NewService(), 1, "Dock 3", nil)
+	if err != nil {
+		t.Fatalf("create kiosk: %v", err)
+	}
+	if _, err := Enroll(ctx, db, token); err != nil {
+		t.Fatalf("enroll: %v", err)
+	}
+	err = db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO sessions (id, user_id, kiosk_device_id, expires_at) VALUES
+	('kiosk-session', 2, ?, datetime('now', '+1 hour')),
+	('desk-session', 3, NULL, datetime('now', '+1 hour'))`, device.ID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed sessions: %v", err)
+	}
+
+	ended, err := Revoke(ctx, db, audit.NewService(), 1, device.ID)
+	if err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if len(ended) != 1 || ended[0] != "kiosk-session" {
+		t.Fatalf("expected only the kiosk session ended, got %v", ended)
+	}
+	var remaining int
+	_ = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT COUNT(1) FROM sessions`).Scan(ctx, &remaining)
+	})
+	if remaining != 1 {
+		t.Fatalf("expected desk session kept, got %d sessions", remaining)
+	}
+	if _, err := AuthenticateDevice(ctx, db, token); !errors.Is(err, ErrInvalidDevice) {
+		t.Fatalf("expected revoked device rejected, got %v", err)
+	}
+}
+
+func TestSetPINValidatesFormatAndRole(t *testing.T) {
+	db := openKioskTestDB(t)
+	ctx := context.Background()
+	auditSvc := audit.NewService()
+
+	for _, pin := range []string{"123", "123456789", "12a4"} {
+		if err := SetPIN(ctx, db, auditSvc, 1, 2, pin); !errors.Is(err, ErrPINFormat) {
+			t.Fatalf("pin %q: expected ErrPINFormat, got %v", pin, err)
+		}
+	}
+	if err := SetPIN(ctx, db, auditSvc, 1, 1, "1234"); !errors.Is(err, ErrInvalidPINUser) {
+		t.Fatalf("expected admin PIN rejected, got %v", err)
+	}
+	if err := SetPIN(ctx, db, auditSvc, 1, 2, "4821"); err != nil {
+		t.Fatalf("set pin: %v", err)
+	}
+
+	users, err := ListPINUsers(ctx, db, true, nil)
+	if err != nil {
+		t.Fatalf("list pin users: %v", err)
+	}
+	if len(users) != 1 || users[0].Username != "scanner1" {
+		t.Fatalf("expected only scanner1 on the PIN screen, got %+v", users)
+	}
+
+	if err := SetPIN(ctx, db, auditSvc, 1, 2, ""); err != nil {
+		t.Fatalf("clear pin: %v", err)
+	}
+	if _, err := VerifyPIN(ctx, db, 2, "4821", nil); !errors.Is(err, ErrInvalidPIN) {
+		t.Fatalf("expected cleared PIN rejected, got %v", err)
+	}
+}
+
+func TestVerifyPINLocksAfterRepeatedFailures(t *testing.T) {
+	db := openKioskTestDB(t)
+	ctx := context.Background()
+	if err := SetPIN(ctx, db, audit.NewService(), 1, 2, "4821"); err != nil {
+		t.Fatalf("set pin: %v", err)
+	}
+
+	user, err := VerifyPIN(ctx, db, 2, "4821", nil)
+	if err != nil || user.Username != "scanner1" {
+		t.Fatalf("expected correct PIN accepted, got %+v err=%v", user, err)
+	}
+
+	for i := 0; i < MaxPINFailures; i++ {
+		if _, err := VerifyPIN(ctx, db, 2, "0000", nil); !errors.Is(err, ErrInvalidPIN) {
+			t.Fatalf("attempt %d: expected ErrInvalidPIN, got %v", i+1, err)
+		}
+	}
+	if _, err := VerifyPIN(ctx, db, 2, "4821", nil); !errors.Is(err, ErrPINLocked) {
+		t.Fatalf("expected lockout after %d failures, got %v", MaxPINFailures, err)
+	}
+	// The lockout is per user.
+	if err := SetPIN(ctx, db, audit.NewService(), 1, 3, "1111"); err != nil {
+		t.Fatalf("set pin: %v", err)
+	}
+	if _, err := VerifyPIN(ctx, db, 3, "1111", nil); err != nil {
+		t.Fatalf("expected other scanner unaffected, got %v", err)
+	}
+}
+
+func TestSiteKioskOnlyAdmitsScannersOfItsSite(t *testing.T) {
+	db := openKioskTestDB(t)
+	ctx := context.Background()
+	auditSvc := audit.NewService()
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO users (id, username, password_hash, role) VALUES (4, 'floater', 'x', 'scanner');
+INSERT INTO sites (id, code, name) VALUES (1, 'leeds', 'Leeds'), (2, 'york', 'York');
+INSERT INTO user_sites (user_id, site_id) VALUES (2, 1), (3, 2);`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed sites: %v", err)
+	}
+	for _, userID := range []int64{2, 3, 4} {
+		if err := SetPIN(ctx, db, auditSvc, 1, userID, "4821"); err != nil {
+			t.Fatalf("set pin for %d: %v", userID, err)
+		}
+	}
+
+	leeds := int64(1)
+	users, err := ListPINUsers(ctx, db, true, &leeds)
+	if err != nil {
+		t.Fatalf("list pin users: %v", err)
+	}
+	if len(users) != 2 || users[0].Username != "floater" || users[1].Username != "scanner1" {
+		t.Fatalf("expected Leeds and unassigned scanners, got %+v", users)
+	}
+
+	if _, err := VerifyPIN(ctx, db, 3, "4821", &leeds); !errors.Is(err, ErrWrongSite) {
+		t.Fatalf("expected York scanner refused at Leeds kiosk, got %v", err)
+	}
+	if _, err := VerifyPIN(ctx, db, 4, "4821", &leeds); err != nil {
+		t.Fatalf("expected unassigned scanner admitted, got %v", err)
+	}
+	if _, err := VerifyPIN(ctx, db, 3, "4821", nil); err != nil {
+		t.Fatalf("expected kiosk with no site to admit everyone, got %v", err)
+	}
+}
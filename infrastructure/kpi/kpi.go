@@ -0,0 +1,243 @@
+// Package kpi keeps a daily series of receiving figures per project for BI
+// tools. A snapshotter captures today's row for every active project each
+// hour; the last capture of a day stands as that day's snapshot.
+package kpi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+const (
+	// DateLayout is how snapshot dates are written and queried.
+	DateLayout = "2006-01-02"
+	// MaxRangeDays caps one series request.
+	MaxRangeDays = 366
+
+	captureInterval = time.Hour
+)
+
+var ErrInvalidRange = errors.New("from must be on or before to, at most 366 days apart")
+
+// Day is one project's snapshot for a UTC day. Receipt figures count lines
+// receipted that day on pallets that were not cancelled.
+type Day struct {
+	Date             string    `bun:"snapshot_date" json:"date"`
+	UnitsReceived    int64     `bun:"units_received" json:"unitsReceived"`
+	LinesReceived    int64     `bun:"lines_received" json:"linesReceived"`
+	DamagedUnits     int64     `bun:"damaged_units" json:"damagedUnits"`
+	UnknownLines     int64     `bun:"unknown_lines" json:"unknownLines"`
+	PalletsCreated   int64     `bun:"pallets_created" json:"-"`
+	PalletsOpen      int64     `bun:"pallets_open" json:"-"`
+	PalletsClosed    int64     `bun:"pallets_closed" json:"-"`
+	PalletsLabelled  int64     `bun:"pallets_labelled" json:"-"`
+	PalletsCancelled int64     `bun:"pallets_cancelled" json:"-"`
+	CapturedAt       time.Time `bun:"captured_at" json:"capturedAt"`
+
+	PalletsByStatus map[string]int64 `bun:"-" json:"palletsByStatus"`
+	// DamageRate is damaged units over units received, and UnknownRate
+	// unknown SKU lines over lines received, both as fractions rounded to
+	// four places. They are 0 on days with nothing received.
+	DamageRate  float64 `bun:"-" json:"damageRate"`
+	UnknownRate float64 `bun:"-" json:"unknownRate"`
+}
+
+// ParseRange reads a from/to date pair, defaulting to the 30 days up to
+// today.
+func ParseRange(from, to string, now time.Time) (time.Time, time.Time, error) {
+	end := startOfDay(now)
+	if to != "" {
+		t, err := time.Parse(DateLayout, to)
+		if err != nil {
+			return time.Time{}, time.Time{}, ErrInvalidRange
+		}
+		end = t
+	}
+	start := end.AddDate(0, 0, -29)
+	if from != "" {
+		t, err := time.Parse(DateLayout, from)
+		if err != nil {
+			return time.Time{}, time.Time{}, ErrInvalidRange
+		}
+		start = t
+	}
+	if start.After(end) || end.Sub(start) >= MaxRangeDays*24*time.Hour {
+		return time.Time{}, time.Time{}, ErrInvalidRange
+	}
+	return start, end, nil
+}
+
+// Series returns the project's snapshots from from to to inclusive, oldest
+// first. Days without a capture are left out.
+func Series(ctx context.Context, db *sqlite.DB, projectID int64, from, to time.Time) ([]Day, error) {
+	days := make([]Day, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT snapshot_date, units_received, lines_received, damaged_units, unknown_lines,
+       pallets_created, pallets_open, pallets_closed, pallets_labelled, pallets_cancelled, captured_at
+FROM project_kpi_snapshots
+WHERE project_id = ? AND snapshot_date >= ? AND snapshot_date <= ?
+ORDER BY snapshot_date ASC`, projectID, from.Format(DateLayout), to.Format(DateLayout)).Scan(ctx, &days)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range days {
+		d := &days[i]
+		d.PalletsByStatus = map[string]int64{
+			"created":   d.PalletsCreated,
+			"open":      d.PalletsOpen,
+			"closed":    d.PalletsClosed,
+			"labelled":  d.PalletsLabelled,
+			"cancelled": d.PalletsCancelled,
+		}
+		d.DamageRate = rate(d.DamagedUnits, d.UnitsReceived)
+		d.UnknownRate = rate(d.UnknownLines, d.LinesReceived)
+	}
+	return days, nil
+}
+
+// Capture writes today's snapshot for every active project and refreshes
+// yesterday's receipt figures, so lines receipted after yesterday's last
+// capture still count.
+func Capture(ctx context.Context, db *sqlite.DB, now time.Time) error {
+	today := startOfDay(now)
+	yesterday := today.AddDate(0, 0, -1)
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewRaw(`
+WITH r AS (`+receiptTotalsSQL+`),
+p AS (
+  SELECT project_id,
+         SUM(status = 'created') AS created,
+         SUM(status = 'open') AS open,
+         SUM(status = 'closed') AS closed,
+         SUM(status = 'labelled') AS labelled,
+         SUM(status = 'cancelled') AS cancelled
+  FROM pallets
+  GROUP BY project_id
+)
+INSERT INTO project_kpi_snapshots (
+  project_id, snapshot_date, units_received, lines_received, damaged_units, unknown_lines,
+  pallets_created, pallets_open, pallets_closed, pallets_labelled, pallets_cancelled, captured_at)
+SELECT pj.id, ?, COALESCE(r.units, 0), COALESCE(r.lines, 0), COALESCE(r.damaged, 0), COALESCE(r.unknown, 0),
+       COALESCE(p.created, 0), COALESCE(p.open, 0), COALESCE(p.closed, 0), COALESCE(p.labelled, 0), COALESCE(p.cancelled, 0), ?
+FROM projects pj
+LEFT JOIN r ON r.project_id = pj.id
+LEFT JOIN p ON p.project_id = pj.id
+WHERE pj.status = 'active'
+ON CONFLICT (project_id, snapshot_date) DO UPDATE SET
+  units_received = excluded.units_received,
+  lines_received = excluded.lines_received,
+  damaged_units = excluded.damaged_units,
+  unknown_lines = excluded.unknown_lines,
+  pallets_created = excluded.pallets_created,
+  pallets_open = excluded.pallets_open,
+  pallets_closed = excluded.pallets_closed,
+  pallets_labelled = excluded.pallets_labelled,
+  pallets_cancelled = excluded.pallets_cancelled,
+  captured_at = excluded.captured_at`, today, today.AddDate(0, 0, 1), today.Format(DateLayout), now.UTC()).Exec(ctx); err != nil {
+			return err
+		}
+		_, err := tx.NewRaw(`
+WITH r AS (`+receiptTotalsSQL+`)
+UPDATE project_kpi_snapshots
+SET units_received = COALESCE((SELECT units FROM r WHERE r.project_id = project_kpi_snapshots.project_id), 0),
+    lines_received = COALESCE((SELECT lines FROM r WHERE r.project_id = project_kpi_snapshots.project_id), 0),
+    damaged_units = COALESCE((SELECT damaged FROM r WHERE r.project_id = project_kpi_snapshots.project_id), 0),
+    unknown_lines = COALESCE((SELECT unknown FROM r WHERE r.project_id = project_kpi_snapshots.project_id), 0)
+WHERE snapshot_date = ?`, yesterday, today, yesterday.Format(DateLayout)).Exec(ctx)
+		return err
+	})
+}
+
+// receiptTotalsSQL sums receipts per project between two bound times, leaving
+// out lines on cancelled pallets.
+const receiptTotalsSQL = `
+  SELECT pr.project_id,
+         SUM(pr.qty) AS units,
+         COUNT(1) AS lines,
+         SUM(pr.damaged_qty) AS damaged,
+         SUM(pr.unknown_sku = 1) AS unknown
+  FROM pallet_receipts pr
+  JOIN pallets pl ON pl.id = pr.pallet_id AND pl.status <> 'cancelled'
+  WHERE julianday(pr.created_at) >= julianday(?) AND julianday(pr.created_at) < julianday(?)
+  GROUP BY pr.project_id`
+
+func rate(part, whole int64) float64 {
+	if whole <= 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(whole)*10000) / 10000
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Snapshotter captures snapshots every hour.
+type Snapshotter struct {
+	db *sqlite.DB
+
+	// Paused, when set before Start, skips captures while it returns true.
+	Paused func() bool
+
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	started atomic.Bool
+}
+
+func NewSnapshotter(db *sqlite.DB) *Snapshotter {
+	return &Snapshotter{
+		db:   db,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// Start captures snapshots until Stop.
+func (s *Snapshotter) Start() {
+	s.started.Store(true)
+	go func() {
+		defer close(s.done)
+		ctx := context.Background()
+		ticker := time.NewTicker(captureInterval)
+		defer ticker.Stop()
+		for {
+			if s.Paused == nil || !s.Paused() {
+				if err := Capture(ctx, s.db, time.Now()); err != nil {
+					slog.Error("kpi: snapshot capture failed", slog.Any("err", err))
+				}
+			}
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends a started snapshotter and waits for a running capture to finish.
+func (s *Snapshotter) Stop() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	if !s.started.Load() {
+		return
+	}
+	select {
+	case <-s.done:
+	case <-time.After(5 * time.Second):
+	}
+}
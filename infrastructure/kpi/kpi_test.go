@@ -0,0 +1,117 @@
+package kpi
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func openKPITestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "kpi-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	return db
+}
+
+func execAll(t *testing.T, db *sqlite.DB, stmts ...string) {
+	t.Helper()
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+}
+
+func TestCaptureAndSeries(t *testing.T) {
+	db := openKPITestDB(t)
+	ctx := context.Background()
+	execAll(t, db,
+		`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'scanner1', 'x', 'scanner')`,
+		`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+			(1, 'Active', 'Active', DATE('now'), 'Client', 'active', 'active'),
+			(2, 'Inactive', 'Inactive', DATE('now'), 'Client', 'inactive', 'inactive')`,
+		`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open'), (2, 1, 'closed'), (3, 1, 'cancelled')`,
+		`INSERT INTO pallet_receipts (project_id, pallet_id, sku, description, scanned_by_user_id, qty, damaged, damaged_qty, unknown_sku, created_at) VALUES
+			(1, 1, 'A', 'A', 1, 8, 1, 2, 0, '2026-03-02 09:00:00'),
+			(1, 2, 'B', 'B', 1, 2, 0, 0, 1, '2026-03-02 15:00:00'),
+			(1, 3, 'C', 'C', 1, 50, 0, 0, 0, '2026-03-02 10:00:00'),
+			(1, 1, 'D', 'D', 1, 5, 0, 0, 0, '2026-03-01 23:30:00')`,
+	)
+
+	// The capture on the 1st ran before the 23:30 line; the next day's
+	// capture still counts it.
+	if err := Capture(ctx, db, time.Date(2026, 3, 1, 23, 10, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("capture day 1: %v", err)
+	}
+	if err := Capture(ctx, db, time.Date(2026, 3, 2, 18, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("capture day 2: %v", err)
+	}
+
+	from, to, err := ParseRange("2026-03-01", "2026-03-31", time.Now())
+	if err != nil {
+		t.Fatalf("parse range: %v", err)
+	}
+	days, err := Series(ctx, db, 1, from, to)
+	if err != nil {
+		t.Fatalf("series: %v", err)
+	}
+	if len(days) != 2 {
+		t.Fatalf("expected 2 days, got %+v", days)
+	}
+	if days[0].Date != "2026-03-01" || days[0].UnitsReceived != 5 || days[0].LinesReceived != 1 {
+		t.Fatalf("expected late line counted on the 1st, got %+v", days[0])
+	}
+	day := days[1]
+	if day.UnitsReceived != 10 || day.LinesReceived != 2 || day.DamagedUnits != 2 || day.UnknownLines != 1 {
+		t.Fatalf("expected cancelled pallet left out of the 2nd, got %+v", day)
+	}
+	if day.DamageRate != 0.2 || day.UnknownRate != 0.5 {
+		t.Fatalf("expected rates 0.2 and 0.5, got %v and %v", day.DamageRate, day.UnknownRate)
+	}
+	if day.PalletsByStatus["open"] != 1 || day.PalletsByStatus["closed"] != 1 || day.PalletsByStatus["cancelled"] != 1 {
+		t.Fatalf("unexpected pallet counts %+v", day.PalletsByStatus)
+	}
+
+	if days, err := Series(ctx, db, 2, from, to); err != nil || len(days) != 0 {
+		t.Fatalf("expected no snapshots for an inactive project, got %+v err=%v", days, err)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	now := time.Date(2026, 3, 31, 15, 0, 0, 0, time.UTC)
+	from, to, err := ParseRange("", "", now)
+	if err != nil || from.Format(DateLayout) != "2026-03-02" || to.Format(DateLayout) != "2026-03-31" {
+		t.Fatalf("expected the last 30 days, got %v..%v err=%v", from, to, err)
+	}
+	for _, bad := range [][2]string{{"2026-03-05", "2026-03-01"}, {"2025-01-01", "2026-03-01"}, {"yesterday", ""}} {
+		if _, _, err := ParseRange(bad[0], bad[1], now); !errors.Is(err, ErrInvalidRange) {
+			t.Fatalf("expected ErrInvalidRange for %v, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Package labelbarcode renders the item barcode on closed pallet labels in the
+// symbology a project's customer scans with.
+package labelbarcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"strings"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/ean"
+	"github.com/boombuler/barcode/qr"
+	"github.com/boombuler/barcode/twooffive"
+
+	"receipter/infrastructure/gs1"
+)
+
+const (
+	Code128 = "code128"
+	EAN13   = "ean13"
+	ITF14   = "itf14"
+	QR      = "qr"
+
+	DefaultSymbology = Code128
+
+	// maxQRLength keeps QR codes at a size that still scans from a printed
+	// label cell.
+	maxQRLength = 300
+)
+
+var (
+	ErrUnsupportedSymbology = errors.New("barcode symbology is not supported")
+	ErrInvalidValue         = errors.New("barcode value does not fit symbology")
+)
+
+type Symbology struct {
+	Code string
+	Name string
+	// Square is set for 2D symbologies that must keep a 1:1 aspect ratio.
+	Square bool
+}
+
+var symbologies = []Symbology{
+	{Code: Code128, Name: "Code 128"},
+	{Code: EAN13, Name: "EAN-13"},
+	{Code: ITF14, Name: "ITF-14"},
+	{Code: QR, Name: "QR Code", Square: true},
+}
+
+// Symbologies returns the supported symbologies in display order.
+func Symbologies() []Symbology {
+	out := make([]Symbology, len(symbologies))
+	copy(out, symbologies)
+	return out
+}
+
+// Normalize returns the supported symbology code for raw, or "" when raw is
+// not a supported symbology.
+func Normalize(raw string) string {
+	code := strings.ToLower(strings.TrimSpace(raw))
+	for _, s := range symbologies {
+		if s.Code == code {
+			return code
+		}
+	}
+	return ""
+}
+
+// For returns the symbology for a code, falling back to Code 128.
+func For(code string) Symbology {
+	code = Normalize(code)
+	for _, s := range symbologies {
+		if s.Code == code {
+			return s
+		}
+	}
+	return symbologies[0]
+}
+
+// Name returns the display name for a symbology code.
+func Name(code string) string {
+	if Normalize(code) == "" {
+		return ""
+	}
+	return For(code).Name
+}
+
+// Validate reports whether value can be printed in the symbology. EAN-13 and
+// ITF-14 need the full GTIN including a correct check digit.
+func Validate(symbology, value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return fmt.Errorf("%w: empty value", ErrInvalidValue)
+	}
+	switch Normalize(symbology) {
+	case Code128:
+		for _, r := range value {
+			if r < 32 || r > 126 {
+				return fmt.Errorf("%w: Code 128 needs printable ASCII", ErrInvalidValue)
+			}
+		}
+		return nil
+	case EAN13:
+		return validateGTIN(value, 13, "EAN-13")
+	case ITF14:
+		return validateGTIN(value, 14, "ITF-14")
+	case QR:
+		if len(value) > maxQRLength {
+			return fmt.Errorf("%w: QR Code value longer than %d characters", ErrInvalidValue, maxQRLength)
+		}
+		return nil
+	}
+	return ErrUnsupportedSymbology
+}
+
+func validateGTIN(value string, length int, name string) error {
+	if len(value) != length {
+		return fmt.Errorf("%w: %s needs %d digits", ErrInvalidValue, name, length)
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return fmt.Errorf("%w: %s needs digits only", ErrInvalidValue, name)
+		}
+	}
+	if gs1.CheckDigit(value[:length-1]) != value[length-1] {
+		return fmt.Errorf("%w: %s check digit is wrong", ErrInvalidValue, name)
+	}
+	return nil
+}
+
+// FirstValid returns the first candidate that fits the symbology, or "".
+func FirstValid(symbology string, candidates ...string) string {
+	for _, candidate := range candidates {
+		candidate = strings.TrimSpace(candidate)
+		if candidate != "" && Validate(symbology, candidate) == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// Placeholder is printed in the barcode cell when no candidate fits.
+func Placeholder(symbology string) string {
+	return fmt.Sprintf("NO VALID %s BARCODE", strings.ToUpper(For(symbology).Name))
+}
+
+// RenderPNG encodes value and scales it to width x height pixels. Square
+// symbologies are scaled to the smaller of the two.
+func RenderPNG(symbology, value string, width, height int) ([]byte, error) {
+	symbology = Normalize(symbology)
+	value = strings.TrimSpace(value)
+	if err := Validate(symbology, value); err != nil {
+		return nil, err
+	}
+
+	var (
+		code barcode.Barcode
+		err  error
+	)
+	switch symbology {
+	case Code128:
+		code, err = code128.Encode(value)
+	case EAN13:
+		code, err = ean.Encode(value)
+	case ITF14:
+		code, err = twooffive.Encode(value, true)
+	case QR:
+		code, err = qr.Encode(value, qr.M, qr.Auto)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if For(symbology).Square {
+		width = min(width, height)
+		height = width
+	}
+	scaled, err := barcode.Scale(code, width, height)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := scaled.Bounds()
+	normalized := image.NewNRGBA(bounds)
+	draw.Draw(normalized, bounds, scaled, bounds.Min, draw.Src)
+	var out bytes.Buffer
+	if err := png.Encode(&out, normalized); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
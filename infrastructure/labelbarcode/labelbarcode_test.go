@@ -0,0 +1,82 @@
+package labelbarcode
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		symbology string
+		value     string
+		ok        bool
+	}{
+		{Code128, "ABC-123", true},
+		{Code128, "ABC\t123", false},
+		{EAN13, "5012345678900", true},
+		{EAN13, "5012345678901", false},
+		{EAN13, "501234567890", false},
+		{EAN13, "50123456789AB", false},
+		{ITF14, "15012345678907", true},
+		{ITF14, "15012345678900", false},
+		{ITF14, "5012345678900", false},
+		{QR, "https://example.com/p/1", true},
+		{QR, " ", false},
+	}
+	for _, tc := range cases {
+		err := Validate(tc.symbology, tc.value)
+		if tc.ok && err != nil {
+			t.Fatalf("Validate(%s, %q): unexpected error %v", tc.symbology, tc.value, err)
+		}
+		if !tc.ok && !errors.Is(err, ErrInvalidValue) {
+			t.Fatalf("Validate(%s, %q): expected ErrInvalidValue, got %v", tc.symbology, tc.value, err)
+		}
+	}
+	if err := Validate("pdf417", "x"); !errors.Is(err, ErrUnsupportedSymbology) {
+		t.Fatalf("expected ErrUnsupportedSymbology, got %v", err)
+	}
+}
+
+func TestFirstValidSkipsValuesThatDoNotFit(t *testing.T) {
+	t.Parallel()
+
+	if got := FirstValid(EAN13, "", "ITEM-1", "5012345678900"); got != "5012345678900" {
+		t.Fatalf("FirstValid(EAN13) = %q", got)
+	}
+	if got := FirstValid(ITF14, "ITEM-1", "5012345678900"); got != "" {
+		t.Fatalf("FirstValid(ITF14) = %q; want empty", got)
+	}
+	if got := Placeholder(EAN13); got != "NO VALID EAN-13 BARCODE" {
+		t.Fatalf("Placeholder(EAN13) = %q", got)
+	}
+}
+
+func TestRenderPNG_KeepsQRSquare(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range Symbologies() {
+		value := "5012345678900"
+		if s.Code == ITF14 {
+			value = "15012345678907"
+		}
+		data, err := RenderPNG(s.Code, value, 600, 200)
+		if err != nil {
+			t.Fatalf("RenderPNG(%s): %v", s.Code, err)
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("decode %s png: %v", s.Code, err)
+		}
+		b := img.Bounds()
+		if s.Square && b.Dx() != b.Dy() {
+			t.Fatalf("expected square %s image, got %dx%d", s.Code, b.Dx(), b.Dy())
+		}
+		if !s.Square && (b.Dx() != 600 || b.Dy() != 200) {
+			t.Fatalf("expected 600x200 %s image, got %dx%d", s.Code, b.Dx(), b.Dy())
+		}
+	}
+}
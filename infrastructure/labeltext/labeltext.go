@@ -0,0 +1,160 @@
+// Package labeltext holds the translated captions printed on closed pallet
+// labels so compliance wording can match the destination country.
+package labeltext
+
+import "strings"
+
+const DefaultLanguage = "en"
+
+type Language struct {
+	Code string
+	Name string
+}
+
+// Phrases are the fixed captions on a closed pallet label.
+type Phrases struct {
+	Pallet       string
+	Description  string
+	SKU          string
+	Expiry       string
+	PrintedDate  string
+	Barcode      string
+	BatchNumber  string
+	BoxCount     string
+	QtyPerCarton string
+	TotalQty     string
+}
+
+var languages = []Language{
+	{Code: "en", Name: "English"},
+	{Code: "de", Name: "Deutsch"},
+	{Code: "es", Name: "Español"},
+	{Code: "fr", Name: "Français"},
+	{Code: "it", Name: "Italiano"},
+	{Code: "nl", Name: "Nederlands"},
+	{Code: "pt", Name: "Português"},
+}
+
+// catalog only uses characters available in the PDF core fonts (cp1252).
+var catalog = map[string]Phrases{
+	"en": {
+		Pallet:       "PALLET",
+		Description:  "Description:",
+		SKU:          "SKU:",
+		Expiry:       "Expiry:",
+		PrintedDate:  "Printed Date:",
+		Barcode:      "Barcode:",
+		BatchNumber:  "Batch No:",
+		BoxCount:     "NO. OF BOXES",
+		QtyPerCarton: "QTY PER CARTON",
+		TotalQty:     "TOTAL QTY",
+	},
+	"de": {
+		Pallet:       "PALETTE",
+		Description:  "Beschreibung:",
+		SKU:          "Artikelnr.:",
+		Expiry:       "Mindestens haltbar bis:",
+		PrintedDate:  "Druckdatum:",
+		Barcode:      "Barcode:",
+		BatchNumber:  "Charge:",
+		BoxCount:     "ANZAHL KARTONS",
+		QtyPerCarton: "MENGE PRO KARTON",
+		TotalQty:     "GESAMTMENGE",
+	},
+	"es": {
+		Pallet:       "PALÉ",
+		Description:  "Descripción:",
+		SKU:          "Referencia:",
+		Expiry:       "Consumir preferentemente antes de:",
+		PrintedDate:  "Fecha de impresión:",
+		Barcode:      "Código de barras:",
+		BatchNumber:  "Lote:",
+		BoxCount:     "N.º DE CAJAS",
+		QtyPerCarton: "CANT. POR CAJA",
+		TotalQty:     "CANT. TOTAL",
+	},
+	"fr": {
+		Pallet:       "PALETTE",
+		Description:  "Désignation :",
+		SKU:          "Référence :",
+		Expiry:       "À consommer de préférence avant :",
+		PrintedDate:  "Date d'impression :",
+		Barcode:      "Code-barres :",
+		BatchNumber:  "Lot :",
+		BoxCount:     "NB DE CARTONS",
+		QtyPerCarton: "QTÉ PAR CARTON",
+		TotalQty:     "QTÉ TOTALE",
+	},
+	"it": {
+		Pallet:       "PALLET",
+		Description:  "Descrizione:",
+		SKU:          "Codice articolo:",
+		Expiry:       "Da consumarsi preferibilmente entro:",
+		PrintedDate:  "Data di stampa:",
+		Barcode:      "Codice a barre:",
+		BatchNumber:  "Lotto:",
+		BoxCount:     "N. CARTONI",
+		QtyPerCarton: "Q.TÀ PER CARTONE",
+		TotalQty:     "Q.TÀ TOTALE",
+	},
+	"nl": {
+		Pallet:       "PALLET",
+		Description:  "Omschrijving:",
+		SKU:          "Artikelnr.:",
+		Expiry:       "Ten minste houdbaar tot:",
+		PrintedDate:  "Afdrukdatum:",
+		Barcode:      "Streepjescode:",
+		BatchNumber:  "Partijnr.:",
+		BoxCount:     "AANTAL DOZEN",
+		QtyPerCarton: "AANTAL PER DOOS",
+		TotalQty:     "TOTAAL AANTAL",
+	},
+	"pt": {
+		Pallet:       "PALETE",
+		Description:  "Descrição:",
+		SKU:          "Referência:",
+		Expiry:       "Consumir de preferência antes de:",
+		PrintedDate:  "Data de impressão:",
+		Barcode:      "Código de barras:",
+		BatchNumber:  "Lote:",
+		BoxCount:     "N.º DE CAIXAS",
+		QtyPerCarton: "QTD. POR CAIXA",
+		TotalQty:     "QTD. TOTAL",
+	},
+}
+
+// Languages returns the supported label languages in display order.
+func Languages() []Language {
+	out := make([]Language, len(languages))
+	copy(out, languages)
+	return out
+}
+
+// Normalize returns the supported language code for raw, or "" when raw is
+// not a supported language.
+func Normalize(raw string) string {
+	code := strings.ToLower(strings.TrimSpace(raw))
+	if _, ok := catalog[code]; !ok {
+		return ""
+	}
+	return code
+}
+
+// For returns the captions for a language, falling back to English.
+func For(code string) Phrases {
+	if phrases, ok := catalog[Normalize(code)]; ok {
+		return phrases
+	}
+	return catalog[DefaultLanguage]
+}
+
+// Name returns the display name for a language code.
+func Name(code string) string {
+	code = Normalize(code)
+	for _, lang := range languages {
+		if lang.Code == code {
+			return lang.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package labeltext
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCatalogDefinesEveryPhraseForEveryLanguage(t *testing.T) {
+	t.Parallel()
+
+	for _, lang := range Languages() {
+		phrases, ok := catalog[lang.Code]
+		if !ok {
+			t.Fatalf("language %q is listed but has no catalog entry", lang.Code)
+		}
+		v := reflect.ValueOf(phrases)
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).String() == "" {
+				t.Fatalf("language %q is missing phrase %s", lang.Code, v.Type().Field(i).Name)
+			}
+		}
+	}
+	if len(catalog) != len(Languages()) {
+		t.Fatalf("catalog has %d entries but %d languages are listed", len(catalog), len(Languages()))
+	}
+}
+
+func TestNormalizeAndFallback(t *testing.T) {
+	t.Parallel()
+
+	if got := Normalize(" FR "); got != "fr" {
+		t.Fatalf("expected fr, got %q", got)
+	}
+	if got := Normalize("xx"); got != "" {
+		t.Fatalf("expected unsupported language to normalize to empty, got %q", got)
+	}
+	if got := For("xx").Expiry; got != "Expiry:" {
+		t.Fatalf("expected English fallback, got %q", got)
+	}
+	if got := For("de").BatchNumber; got != "Charge:" {
+		t.Fatalf("expected German batch caption, got %q", got)
+	}
+}
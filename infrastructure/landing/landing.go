@@ -0,0 +1,229 @@
+package landing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/sqlite"
+)
+
+var (
+	ErrUnknownPage    = errors.New("landing page is not recognised")
+	ErrPageNotAllowed = errors.New("landing page is not available to this role")
+	ErrUnknownRole    = errors.New("role is not recognised")
+	ErrUserNotFound   = errors.New("user not found")
+)
+
+// Page is a destination users can be sent to after login.
+type Page struct {
+	Key   string
+	Label string
+	Path  string
+	Roles []string
+}
+
+// pages lists the destinations in display order. Roles mirror the RBAC
+// grants on each path so a configured landing page never bounces to /login.
+var pages = []Page{
+	{Key: "projects", Label: "Projects", Path: "/tasker/projects", Roles: []string{rbac.RoleAdmin, rbac.RoleScanner}},
+	{Key: "progress", Label: "Pallet Progress", Path: "/tasker/pallets/progress", Roles: []string{rbac.RoleAdmin, rbac.RoleScanner}},
+	{Key: "scan", Label: "Scan Pallet", Path: "/tasker/scan/pallet", Roles: []string{rbac.RoleAdmin, rbac.RoleScanner}},
+	{Key: "sku-view", Label: "SKU View", Path: "/tasker/pallets/sku-view", Roles: []string{rbac.RoleAdmin, rbac.RoleScanner, rbac.RoleClient}},
+	{Key: "exports", Label: "Exports", Path: "/tasker/exports", Roles: []string{rbac.RoleAdmin}},
+	{Key: "help", Label: "Help", Path: "/tasker/help", Roles: []string{rbac.RoleAdmin, rbac.RoleScanner, rbac.RoleClient}},
+}
+
+var roles = []string{rbac.RoleAdmin, rbac.RoleScanner, rbac.RoleClient}
+
+// Roles returns the roles that have a configurable landing page.
+func Roles() []string {
+	return append([]string(nil), roles...)
+}
+
+// Pages returns every known landing page.
+func Pages() []Page {
+	return append([]Page(nil), pages...)
+}
+
+// PagesForRole returns the landing pages a role is allowed to open.
+func PagesForRole(role string) []Page {
+	out := make([]Page, 0, len(pages))
+	for _, p := range pages {
+		if p.allows(role) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// DefaultPage is the landing page used when nothing is configured.
+func DefaultPage(role string) string {
+	if role == rbac.RoleClient {
+		return "sku-view"
+	}
+	return "projects"
+}
+
+// Path returns the URL for a page key, or "" when it is unknown.
+func Path(key string) string {
+	if p, ok := find(key); ok {
+		return p.Path
+	}
+	return ""
+}
+
+// Validate normalises a page key for role. An empty key is valid and means
+// "fall back to the default".
+func Validate(role, key string) (string, error) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	if key == "" {
+		return "", nil
+	}
+	p, ok := find(key)
+	if !ok {
+		return "", ErrUnknownPage
+	}
+	if !p.allows(role) {
+		return "", ErrPageNotAllowed
+	}
+	return key, nil
+}
+
+// Resolve returns the post-login path for a user: their own override, then
+// the role setting, then the built-in default. Stale values that the role can
+// no longer open are skipped.
+func Resolve(ctx context.Context, db *sqlite.DB, userID int64, role string) (string, error) {
+	var configured struct {
+		UserPage string `bun:"user_page"`
+		RolePage string `bun:"role_page"`
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT
+	COALESCE((SELECT landing_page FROM user_settings WHERE user_id = ?), '') AS user_page,
+	COALESCE((SELECT landing_page FROM role_settings WHERE role = ?), '') AS role_page`, userID, role).Scan(ctx, &configured)
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Path(DefaultPage(role)), err
+	}
+	for _, key := range []string{configured.UserPage, configured.RolePage} {
+		if key, err := Validate(role, key); err == nil && key != "" {
+			return Path(key), nil
+		}
+	}
+	return Path(DefaultPage(role)), nil
+}
+
+// RolePages returns the configured landing page key per role; roles without
+// a setting are omitted.
+func RolePages(ctx context.Context, db *sqlite.DB) (map[string]string, error) {
+	out := make(map[string]string)
+	var rows []struct {
+		Role        string `bun:"role"`
+		LandingPage string `bun:"landing_page"`
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT role, landing_page FROM role_settings WHERE landing_page <> ''`).Scan(ctx, &rows)
+	})
+	for _, row := range rows {
+		out[row.Role] = row.LandingPage
+	}
+	return out, err
+}
+
+func SetRolePage(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorID int64, role, key string) error {
+	if !knownRole(role) {
+		return ErrUnknownRole
+	}
+	key, err := Validate(role, key)
+	if err != nil {
+		return err
+	}
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var before string
+		if err := tx.NewRaw(`SELECT COALESCE((SELECT landing_page FROM role_settings WHERE role = ?), '')`, role).Scan(ctx, &before); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO role_settings (role, landing_page, updated_at)
+VALUES (?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(role) DO UPDATE SET
+  landing_page = excluded.landing_page,
+  updated_at = CURRENT_TIMESTAMP`, role, key); err != nil {
+			return err
+		}
+		return auditSvc.Write(ctx, tx, actorID, "settings.role_landing_page", "role_settings", role,
+			map[string]any{"landing_page": before},
+			map[string]any{"landing_page": key})
+	})
+}
+
+// SetUserPage stores a per-user override; an empty key clears it.
+func SetUserPage(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorID, userID int64, key string) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var user struct {
+			Role    string `bun:"role"`
+			Current string `bun:"current"`
+		}
+		err := tx.NewRaw(`
+SELECT u.role, COALESCE(us.landing_page, '') AS current
+FROM users u
+LEFT JOIN user_settings us ON us.user_id = u.id
+WHERE u.id = ?`, userID).Scan(ctx, &user)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+		key, err := Validate(user.Role, key)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO user_settings (user_id, landing_page, updated_at)
+VALUES (?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(user_id) DO UPDATE SET
+  landing_page = excluded.landing_page,
+  updated_at = CURRENT_TIMESTAMP`, userID, key); err != nil {
+			return err
+		}
+		return auditSvc.Write(ctx, tx, actorID, "settings.user_landing_page", "users", strconv.FormatInt(userID, 10),
+			map[string]any{"landing_page": user.Current},
+			map[string]any{"landing_page": key})
+	})
+}
+
+func find(key string) (Page, bool) {
+	for _, p := range pages {
+		if p.Key == key {
+			return p, true
+		}
+	}
+	return Page{}, false
+}
+
+func (p Page) allows(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func knownRole(role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package landing
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+func openLandingTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	db, err := sqlite.OpenDB(filepath.Join(t.TempDir(), "landing-test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	if _, err := db.W.ExecContext(context.Background(), `INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'x', 'admin'), (2, 'lead', 'x', 'scanner'), (3, 'scanner2', 'x', 'scanner')`); err != nil {
+		t.Fatalf("seed users: %v", err)
+	}
+	return db
+}
+
+func TestValidate(t *testing.T) {
+	if key, err := Validate("scanner", " Progress "); err != nil || key != "progress" {
+		t.Fatalf("expected progress, got %q %v", key, err)
+	}
+	if key, err := Validate("client", ""); err != nil || key != "" {
+		t.Fatalf("expected empty key to be valid, got %q %v", key, err)
+	}
+	if _, err := Validate("client", "projects"); !errors.Is(err, ErrPageNotAllowed) {
+		t.Fatalf("expected ErrPageNotAllowed, got %v", err)
+	}
+	if _, err := Validate("admin", "nowhere"); !errors.Is(err, ErrUnknownPage) {
+		t.Fatalf("expected ErrUnknownPage, got %v", err)
+	}
+}
+
+func TestResolve_UserOverrideThenRoleThenDefault(t *testing.T) {
+	db := openLandingTestDB(t)
+	ctx := context.Background()
+	auditSvc := audit.NewService()
+
+	if got, err := Resolve(ctx, db, 2, "scanner"); err != nil || got != "/tasker/projects" {
+		t.Fatalf("expected built-in default, got %q %v", got, err)
+	}
+	if got, _ := Resolve(ctx, db, 99, "client"); got != "/tasker/pallets/sku-view" {
+		t.Fatalf("expected client default, got %q", got)
+	}
+
+	if err := SetRolePage(ctx, db, auditSvc, 1, "scanner", "scan"); err != nil {
+		t.Fatalf("set role page: %v", err)
+	}
+	if err := SetUserPage(ctx, db, auditSvc, 1, 2, "progress"); err != nil {
+		t.Fatalf("set user page: %v", err)
+	}
+	if got, _ := Resolve(ctx, db, 2, "scanner"); got != "/tasker/pallets/progress" {
+		t.Fatalf("expected user override, got %q", got)
+	}
+	if got, _ := Resolve(ctx, db, 3, "scanner"); got != "/tasker/scan/pallet" {
+		t.Fatalf("expected role setting, got %q", got)
+	}
+
+	if err := SetUserPage(ctx, db, auditSvc, 1, 2, "exports"); !errors.Is(err, ErrPageNotAllowed) {
+		t.Fatalf("expected scanner override to exports rejected, got %v", err)
+	}
+	if err := SetRolePage(ctx, db, auditSvc, 1, "supervisor", "projects"); !errors.Is(err, ErrUnknownRole) {
+		t.Fatalf("expected ErrUnknownRole, got %v", err)
+	}
+
+	if err := SetUserPage(ctx, db, auditSvc, 1, 2, ""); err != nil {
+		t.Fatalf("clear user page: %v", err)
+	}
+	if got, _ := Resolve(ctx, db, 2, "scanner"); got != "/tasker/scan/pallet" {
+		t.Fatalf("expected role setting after clearing override, got %q", got)
+	}
+
+	var audits int
+	if err := db.R.NewRaw(`SELECT COUNT(1) FROM audit_logs WHERE action LIKE 'settings.%landing_page'`).Scan(ctx, &audits); err != nil {
+		t.Fatalf("count audits: %v", err)
+	}
+	if audits != 3 {
+		t.Fatalf("expected 3 landing audit entries, got %d", audits)
+	}
+}
@@ -0,0 +1,150 @@
+// Package live fans out in-process pallet events to connected receipt pages so
+// operators working the same pallet see each other and each other's lines.
+package live
+
+import (
+	"sort"
+	"sync"
+)
+
+type EventKind string
+
+const (
+	// EventPresence is sent when someone opens or leaves a pallet.
+	EventPresence EventKind = "presence"
+	// EventLines is sent when a receipt line on the pallet is added, edited or removed.
+	EventLines EventKind = "lines"
+
+	eventKindCount = 2
+)
+
+// Subscriber is one open receipt page. Events are coalesced per kind: while
+// a kind is pending (received but not yet acknowledged) further events of
+// that kind are folded into it, so a slow reader never blocks publishers.
+type Subscriber struct {
+	PalletID int64
+	UserID   int64
+	Username string
+	C        <-chan EventKind
+
+	ch      chan EventKind
+	pending map[EventKind]bool
+}
+
+// Hub tracks subscribers per pallet.
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[int64]map[*Subscriber]struct{}
+	closed bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[int64]map[*Subscriber]struct{})}
+}
+
+// Join registers a subscriber for palletID and notifies the others. The
+// returned subscriber must be passed to Leave.
+func (h *Hub) Join(palletID, userID int64, username string) *Subscriber {
+	ch := make(chan EventKind, eventKindCount)
+	sub := &Subscriber{PalletID: palletID, UserID: userID, Username: username, C: ch, ch: ch, pending: make(map[EventKind]bool)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(sub.ch)
+		return sub
+	}
+	if h.subs[palletID] == nil {
+		h.subs[palletID] = make(map[*Subscriber]struct{})
+	}
+	h.subs[palletID][sub] = struct{}{}
+	h.publishLocked(palletID, EventPresence)
+	return sub
+}
+
+// Leave unregisters a subscriber and notifies the remaining ones.
+func (h *Hub) Leave(sub *Subscriber) {
+	if sub == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs, ok := h.subs[sub.PalletID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	close(sub.ch)
+	if len(subs) == 0 {
+		delete(h.subs, sub.PalletID)
+		return
+	}
+	h.publishLocked(sub.PalletID, EventPresence)
+}
+
+// Ack marks an event kind as handled so the next event of that kind is
+// delivered. Call it before rendering so no update is lost.
+func (h *Hub) Ack(sub *Subscriber, kind EventKind) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(sub.pending, kind)
+}
+
+// Publish notifies every subscriber of the pallet.
+func (h *Hub) Publish(palletID int64, kind EventKind) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.publishLocked(palletID, kind)
+}
+
+func (h *Hub) publishLocked(palletID int64, kind EventKind) {
+	for sub := range h.subs[palletID] {
+		if sub.pending[kind] {
+			continue
+		}
+		// One slot per kind, so this never blocks.
+		sub.pending[kind] = true
+		sub.ch <- kind
+	}
+}
+
+// Viewers returns the distinct usernames on a pallet, excluding excludeUserID.
+func (h *Hub) Viewers(palletID, excludeUserID int64) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	seen := make(map[string]struct{})
+	names := make([]string, 0)
+	for sub := range h.subs[palletID] {
+		if sub.UserID == excludeUserID {
+			continue
+		}
+		if _, ok := seen[sub.Username]; ok {
+			continue
+		}
+		seen[sub.Username] = struct{}{}
+		names = append(names, sub.Username)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close disconnects every subscriber so long-lived streams end on shutdown.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for _, subs := range h.subs {
+		for sub := range subs {
+			close(sub.ch)
+		}
+	}
+	h.subs = make(map[int64]map[*Subscriber]struct{})
+}
@@ -0,0 +1,71 @@
+package live
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHub_PresenceAndViewers(t *testing.T) {
+	t.Parallel()
+
+	hub := NewHub()
+	first := hub.Join(1, 10, "scanner1")
+	if kind := <-first.C; kind != EventPresence {
+		t.Fatalf("expected presence on join, got %s", kind)
+	}
+	hub.Ack(first, EventPresence)
+
+	second := hub.Join(1, 11, "scanner2")
+	other := hub.Join(2, 12, "scanner3")
+	if kind := <-first.C; kind != EventPresence {
+		t.Fatalf("expected presence when another scanner joins, got %s", kind)
+	}
+	hub.Ack(first, EventPresence)
+
+	if got := hub.Viewers(1, 10); !reflect.DeepEqual(got, []string{"scanner2"}) {
+		t.Fatalf("expected scanner2 as the other viewer, got %v", got)
+	}
+	if got := hub.Viewers(2, 12); len(got) != 0 {
+		t.Fatalf("expected no other viewers on pallet 2, got %v", got)
+	}
+
+	hub.Leave(second)
+	if kind := <-first.C; kind != EventPresence {
+		t.Fatalf("expected presence when a scanner leaves, got %s", kind)
+	}
+	for range second.C {
+		// Drains buffered events; the loop ends once Leave closed the channel.
+	}
+
+	hub.Close()
+	for range other.C {
+		// Ends once Close closed the channel.
+	}
+}
+
+func TestHub_CoalescesPendingEvents(t *testing.T) {
+	t.Parallel()
+
+	hub := NewHub()
+	sub := hub.Join(1, 10, "scanner1")
+	<-sub.C
+	hub.Ack(sub, EventPresence)
+
+	for i := 0; i < 10; i++ {
+		hub.Publish(1, EventLines)
+	}
+	if kind := <-sub.C; kind != EventLines {
+		t.Fatalf("expected lines event, got %s", kind)
+	}
+	select {
+	case kind := <-sub.C:
+		t.Fatalf("expected repeated lines events to be coalesced, got extra %s", kind)
+	default:
+	}
+
+	hub.Ack(sub, EventLines)
+	hub.Publish(1, EventLines)
+	if kind := <-sub.C; kind != EventLines {
+		t.Fatalf("expected lines event after ack, got %s", kind)
+	}
+}
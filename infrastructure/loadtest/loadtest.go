@@ -0,0 +1,415 @@
+// Package loadtest drives a running instance over HTTP the way a busy shift
+// does: scanners posting receipt lines onto their own pallets while admins
+// keep the progress and SKU pages open. It reports latency per operation so
+// the single SQLite writer's headroom can be measured before a site grows.
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operation names used in a Report.
+const (
+	OpReceipt  = "receipt"
+	OpProgress = "progress"
+	OpSKUView  = "sku-view"
+)
+
+// Config describes one run. Every virtual scanner signs in with the same
+// scanner account and gets a pallet of its own, created up front by the
+// admin account, so scanners never contend on one pallet's lines.
+type Config struct {
+	BaseURL string
+	// ProjectID is activated for the admin before pallets are created. When
+	// zero the admin's current project is used.
+	ProjectID int64
+
+	Scanners int
+	Admins   int
+	Duration time.Duration
+	// ScanInterval is the pause between a scanner's receipts and PollInterval
+	// between an admin's page loads. Zero runs flat out.
+	ScanInterval time.Duration
+	PollInterval time.Duration
+	// SKUs is how many distinct SKUs scanners pick from. A small pool makes
+	// lines merge; a large one grows the pallets.
+	SKUs int
+
+	AdminUsername   string
+	AdminPassword   string
+	ScannerUsername string
+	ScannerPassword string
+}
+
+// Stats summarises one operation's requests.
+type Stats struct {
+	Count  int
+	Errors int
+	P50    time.Duration
+	P95    time.Duration
+	P99    time.Duration
+	Max    time.Duration
+}
+
+// Report is the outcome of a run, keyed by operation.
+type Report struct {
+	Elapsed time.Duration
+	Ops     map[string]Stats
+	// FirstErrors keeps a few error messages to explain a failing run.
+	FirstErrors []string
+}
+
+// Throughput is the operation's successful requests per second.
+func (r Report) Throughput(op string) float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	s := r.Ops[op]
+	return float64(s.Count-s.Errors) / r.Elapsed.Seconds()
+}
+
+// Write prints the report as a table.
+func (r Report) Write(w io.Writer) {
+	fmt.Fprintf(w, "ran for %s\n", r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "  %-10s %8s %7s %9s %9s %9s %9s %9s\n", "op", "requests", "errors", "req/s", "p50", "p95", "p99", "max")
+	ops := make([]string, 0, len(r.Ops))
+	for op := range r.Ops {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		s := r.Ops[op]
+		fmt.Fprintf(w, "  %-10s %8d %7d %9.1f %9s %9s %9s %9s\n", op, s.Count, s.Errors, r.Throughput(op),
+			s.P50.Round(time.Microsecond*100), s.P95.Round(time.Microsecond*100), s.P99.Round(time.Microsecond*100), s.Max.Round(time.Microsecond*100))
+	}
+	for _, msg := range r.FirstErrors {
+		fmt.Fprintf(w, "  error: %s\n", msg)
+	}
+}
+
+func (c *Config) normalize() error {
+	c.BaseURL = strings.TrimRight(strings.TrimSpace(c.BaseURL), "/")
+	if c.BaseURL == "" {
+		return errors.New("base url is required")
+	}
+	if c.Scanners < 0 || c.Admins < 0 || c.Scanners+c.Admins == 0 {
+		return errors.New("at least one scanner or admin is required")
+	}
+	if c.Duration <= 0 {
+		return errors.New("duration must be greater than 0")
+	}
+	if c.SKUs <= 0 {
+		c.SKUs = 50
+	}
+	return nil
+}
+
+// Run signs in, creates a pallet per scanner and then drives load until
+// cfg.Duration passes or ctx is cancelled. Setup failures are returned as
+// errors; failures under load are counted in the report.
+func Run(ctx context.Context, cfg Config) (Report, error) {
+	if err := cfg.normalize(); err != nil {
+		return Report{}, err
+	}
+
+	admin, err := newSession(cfg.BaseURL)
+	if err != nil {
+		return Report{}, err
+	}
+	if err := admin.login(ctx, cfg.AdminUsername, cfg.AdminPassword); err != nil {
+		return Report{}, fmt.Errorf("admin login: %w", err)
+	}
+	if cfg.ProjectID > 0 {
+		if _, err := admin.post(ctx, fmt.Sprintf("/tasker/projects/%d/activate", cfg.ProjectID), nil); err != nil {
+			return Report{}, fmt.Errorf("activate project %d: %w", cfg.ProjectID, err)
+		}
+	}
+	palletIDs := make([]int64, 0, cfg.Scanners)
+	for i := 0; i < cfg.Scanners; i++ {
+		id, err := admin.createPallet(ctx)
+		if err != nil {
+			return Report{}, fmt.Errorf("create pallet: %w", err)
+		}
+		palletIDs = append(palletIDs, id)
+	}
+
+	scanners := make([]*session, 0, cfg.Scanners)
+	for i := 0; i < cfg.Scanners; i++ {
+		s, err := newSession(cfg.BaseURL)
+		if err != nil {
+			return Report{}, err
+		}
+		if err := s.login(ctx, cfg.ScannerUsername, cfg.ScannerPassword); err != nil {
+			return Report{}, fmt.Errorf("scanner login: %w", err)
+		}
+		scanners = append(scanners, s)
+	}
+	admins := make([]*session, 0, cfg.Admins)
+	for i := 0; i < cfg.Admins; i++ {
+		s, err := newSession(cfg.BaseURL)
+		if err != nil {
+			return Report{}, err
+		}
+		if err := s.login(ctx, cfg.AdminUsername, cfg.AdminPassword); err != nil {
+			return Report{}, fmt.Errorf("admin login: %w", err)
+		}
+		if cfg.ProjectID > 0 {
+			if _, err := s.post(ctx, fmt.Sprintf("/tasker/projects/%d/activate", cfg.ProjectID), nil); err != nil {
+				return Report{}, fmt.Errorf("activate project %d: %w", cfg.ProjectID, err)
+			}
+		}
+		admins = append(admins, s)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+	rec := newRecorder()
+	started := time.Now()
+	var wg sync.WaitGroup
+	for i, s := range scanners {
+		wg.Add(1)
+		go func(s *session, palletID int64, seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for ctx.Err() == nil {
+				t0 := time.Now()
+				err := s.postReceipt(ctx, palletID, rng, cfg.SKUs)
+				rec.add(ctx, OpReceipt, time.Since(t0), err)
+				pause(ctx, cfg.ScanInterval)
+			}
+		}(s, palletIDs[i], int64(i+1))
+	}
+	for _, s := range admins {
+		wg.Add(1)
+		go func(s *session) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				t0 := time.Now()
+				err := s.getOK(ctx, "/tasker/pallets/progress?fragment=1")
+				rec.add(ctx, OpProgress, time.Since(t0), err)
+
+				t0 = time.Now()
+				err = s.getOK(ctx, "/tasker/pallets/sku-view")
+				rec.add(ctx, OpSKUView, time.Since(t0), err)
+				pause(ctx, cfg.PollInterval)
+			}
+		}(s)
+	}
+	wg.Wait()
+	return rec.report(time.Since(started)), nil
+}
+
+func pause(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+// recorder collects latencies from every worker.
+type recorder struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	errors    map[string]int
+	messages  []string
+}
+
+func newRecorder() *recorder {
+	return &recorder{latencies: make(map[string][]time.Duration), errors: make(map[string]int)}
+}
+
+func (r *recorder) add(ctx context.Context, op string, d time.Duration, err error) {
+	// Requests cut off by the end of the run are not the server's fault.
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latencies[op] = append(r.latencies[op], d)
+	if err != nil {
+		r.errors[op]++
+		if len(r.messages) < 5 {
+			r.messages = append(r.messages, op+": "+err.Error())
+		}
+	}
+}
+
+func (r *recorder) report(elapsed time.Duration) Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rep := Report{Elapsed: elapsed, Ops: make(map[string]Stats, len(r.latencies)), FirstErrors: r.messages}
+	for op, ds := range r.latencies {
+		sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+		rep.Ops[op] = Stats{
+			Count:  len(ds),
+			Errors: r.errors[op],
+			P50:    percentile(ds, 50),
+			P95:    percentile(ds, 95),
+			P99:    percentile(ds, 99),
+			Max:    ds[len(ds)-1],
+		}
+	}
+	return rep
+}
+
+// percentile reads the nearest-rank percentile of sorted durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := (len(sorted)*p + 99) / 100
+	if idx < 1 {
+		idx = 1
+	}
+	return sorted[idx-1]
+}
+
+// session is one signed-in browser.
+type session struct {
+	baseURL string
+	client  *http.Client
+}
+
+func newSession(baseURL string) (*session, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &session{
+		baseURL: baseURL,
+		client: &http.Client{
+			Jar:     jar,
+			Timeout: 30 * time.Second,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}, nil
+}
+
+func (s *session) csrfToken() string {
+	u, err := url.Parse(s.baseURL)
+	if err != nil {
+		return ""
+	}
+	for _, c := range s.client.Jar.Cookies(u) {
+		if c.Name == "X-CSRF-Token" {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+func (s *session) do(ctx context.Context, method, path string, form url.Values) (*http.Response, error) {
+	var body io.Reader
+	if form != nil {
+		if token := s.csrfToken(); token != "" {
+			form.Set("_csrf", token)
+		}
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	return resp, nil
+}
+
+// post submits a form and expects the app's redirect-after-post. A redirect
+// carrying ?error= is the app refusing the form.
+func (s *session) post(ctx context.Context, path string, form url.Values) (string, error) {
+	if form == nil {
+		form = url.Values{}
+	}
+	resp, err := s.do(ctx, http.MethodPost, path, form)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusSeeOther {
+		return "", fmt.Errorf("POST %s: status %d", path, resp.StatusCode)
+	}
+	location := resp.Header.Get("Location")
+	if u, err := url.Parse(location); err == nil && u.Query().Get("error") != "" {
+		return location, fmt.Errorf("POST %s: %s", path, u.Query().Get("error"))
+	}
+	return location, nil
+}
+
+func (s *session) getOK(ctx context.Context, path string) error {
+	resp, err := s.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", path, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *session) login(ctx context.Context, username, password string) error {
+	// The login page sets the CSRF cookie the form post needs.
+	if err := s.getOK(ctx, "/login"); err != nil {
+		return err
+	}
+	location, err := s.post(ctx, "/login", url.Values{"username": {username}, "password": {password}})
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(location, "/login") {
+		return fmt.Errorf("sign in refused for %s", username)
+	}
+	return nil
+}
+
+func (s *session) createPallet(ctx context.Context) (int64, error) {
+	location, err := s.post(ctx, "/tasker/pallets/new", nil)
+	if err != nil {
+		return 0, err
+	}
+	// The app redirects to /tasker/pallets/{id}/label.
+	parts := strings.Split(strings.Trim(location, "/"), "/")
+	if len(parts) < 3 {
+		return 0, fmt.Errorf("unexpected redirect %q", location)
+	}
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected redirect %q", location)
+	}
+	return id, nil
+}
+
+func (s *session) postReceipt(ctx context.Context, palletID int64, rng *rand.Rand, skus int) error {
+	sku := fmt.Sprintf("LOAD-%04d", rng.Intn(skus))
+	_, err := s.post(ctx, fmt.Sprintf("/tasker/api/pallets/%d/receipts", palletID), url.Values{
+		"sku":          {sku},
+		"description":  {"Load test " + sku},
+		"qty":          {strconv.Itoa(1 + rng.Intn(24))},
+		"case_size":    {"1"},
+		"batch_number": {fmt.Sprintf("B%d", rng.Intn(4))},
+	})
+	return err
+}
@@ -0,0 +1,189 @@
+// Package maintenance is the read-only switch used during backups and
+// migrations. An admin can turn it on from the system page, or ops can drop a
+// flag file on the host; either way the app stays up, writes are refused and
+// every page carries a banner, while reads and exports keep working.
+package maintenance
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+// DefaultMessage is shown when maintenance was turned on without a message.
+const DefaultMessage = "Receipter is in read-only maintenance mode. You can view pages and download exports, but changes are paused until maintenance ends."
+
+// MaxMessageLength caps the admin banner message.
+const MaxMessageLength = 200
+
+// State is whether maintenance mode is on and why.
+type State struct {
+	Enabled bool
+	// FromFile is set when the flag file turned maintenance on; it can only
+	// be lifted by removing the file.
+	FromFile bool
+	Message  string
+	SetBy    string
+	Since    time.Time
+}
+
+// Banner is the text shown to users while maintenance is on.
+func (s State) Banner() string {
+	if !s.Enabled {
+		return ""
+	}
+	if s.Message != "" {
+		return s.Message
+	}
+	return DefaultMessage
+}
+
+// StoredTTL is how long the admin switch is cached before it is read from
+// the database again. Instances sharing a database pick up a switch flipped
+// on another instance within this long.
+const StoredTTL = 5 * time.Second
+
+// Monitor caches the admin switch so request middleware can check it without
+// a query per request, re-reading it once the cache is older than StoredTTL,
+// and checks the flag file on every call.
+type Monitor struct {
+	db *sqlite.DB
+	// FlagFile turns maintenance on while the file exists. Its first line, if
+	// any, is used as the banner message. Empty disables the check.
+	FlagFile string
+
+	mu          sync.RWMutex
+	stored      State
+	refreshedAt time.Time
+}
+
+func NewMonitor(ctx context.Context, db *sqlite.DB) *Monitor {
+	m := &Monitor{db: db}
+	_, _ = m.Refresh(ctx)
+	return m
+}
+
+// Status returns the current state. The flag file wins over the admin switch.
+func (m *Monitor) Status() State {
+	if state, ok := m.fileState(); ok {
+		return state
+	}
+	return m.Stored()
+}
+
+// Active reports whether maintenance mode is on. Background workers check it
+// before each pass so they stop writing while it is. Safe on a nil monitor.
+func (m *Monitor) Active() bool {
+	if m == nil {
+		return false
+	}
+	return m.Status().Enabled
+}
+
+// Stored returns the admin switch, ignoring the flag file.
+func (m *Monitor) Stored() State {
+	m.mu.RLock()
+	state, fresh := m.stored, time.Since(m.refreshedAt) < StoredTTL
+	m.mu.RUnlock()
+	if fresh {
+		return state
+	}
+	state, err := m.Refresh(context.Background())
+	if err != nil {
+		slog.Warn("maintenance: reload switch failed; using cached state", slog.Any("err", err))
+	}
+	return state
+}
+
+func (m *Monitor) fileState() (State, bool) {
+	if m.FlagFile == "" {
+		return State{}, false
+	}
+	info, err := os.Stat(m.FlagFile)
+	if err != nil || info.IsDir() {
+		return State{}, false
+	}
+	state := State{Enabled: true, FromFile: true, SetBy: "flag file", Since: info.ModTime()}
+	if content, err := os.ReadFile(m.FlagFile); err == nil {
+		line, _, _ := bufio.NewReader(bytes.NewReader(content)).ReadLine()
+		state.Message = truncate(strings.TrimSpace(string(line)))
+	}
+	return state, true
+}
+
+// Refresh reloads the admin switch from the database.
+func (m *Monitor) Refresh(ctx context.Context) (State, error) {
+	var state State
+	err := m.db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT mm.enabled, mm.message, COALESCE(u.username, ''), mm.updated_at
+FROM maintenance_mode mm
+LEFT JOIN users u ON u.id = mm.updated_by_user_id
+WHERE mm.id = 1`).Scan(ctx, &state.Enabled, &state.Message, &state.SetBy, &state.Since)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		state, err = State{}, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// A failed read keeps the cached state until the next retry.
+	m.refreshedAt = time.Now()
+	if err != nil {
+		return m.stored, err
+	}
+	m.stored = state
+	return state, nil
+}
+
+// Set turns the admin switch on or off, audits the change and refreshes the
+// cached state.
+func (m *Monitor) Set(ctx context.Context, auditSvc *audit.Service, userID int64, enabled bool, message string) (State, error) {
+	message = truncate(strings.TrimSpace(message))
+	if !enabled {
+		message = ""
+	}
+	before := m.Stored()
+	action := "maintenance.disable"
+	if enabled {
+		action = "maintenance.enable"
+	}
+	err := m.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO maintenance_mode (id, enabled, message, updated_by_user_id, updated_at)
+VALUES (1, ?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(id) DO UPDATE SET
+  enabled = excluded.enabled,
+  message = excluded.message,
+  updated_by_user_id = excluded.updated_by_user_id,
+  updated_at = CURRENT_TIMESTAMP`, enabled, message, userID); err != nil {
+			return err
+		}
+		return auditSvc.Write(ctx, tx, userID, action, "system", "maintenance",
+			map[string]any{"enabled": before.Enabled, "message": before.Message},
+			map[string]any{"enabled": enabled, "message": message})
+	})
+	if err != nil {
+		return before, err
+	}
+	return m.Refresh(ctx)
+}
+
+func truncate(message string) string {
+	runes := []rune(message)
+	if len(runes) <= MaxMessageLength {
+		return message
+	}
+	return string(runes[:MaxMessageLength])
+}
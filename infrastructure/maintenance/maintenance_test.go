@@ -0,0 +1,72 @@
+package maintenance
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+func openMaintenanceTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	db, err := sqlite.OpenDB(filepath.Join(t.TempDir(), "maintenance-test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin')`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return db
+}
+
+func TestStoredPicksUpSwitchFromAnotherInstanceAfterTTL(t *testing.T) {
+	ctx := context.Background()
+	db := openMaintenanceTestDB(t)
+	first := NewMonitor(ctx, db)
+	second := NewMonitor(ctx, db)
+
+	if _, err := first.Set(ctx, audit.NewService(), 1, true, "backup"); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if second.Active() {
+		t.Fatalf("expected second instance to serve its cached state inside the TTL")
+	}
+
+	second.mu.Lock()
+	second.refreshedAt = time.Now().Add(-StoredTTL)
+	second.mu.Unlock()
+	state := second.Status()
+	if !state.Enabled || state.Message != "backup" || state.SetBy != "admin" {
+		t.Fatalf("expected switch from first instance after TTL, got %+v", state)
+	}
+	if !second.Active() {
+		t.Fatalf("expected Active once the switch was re-read")
+	}
+}
+
+func TestActiveOnNilMonitor(t *testing.T) {
+	var m *Monitor
+	if m.Active() {
+		t.Fatalf("expected nil monitor to report inactive")
+	}
+}
@@ -0,0 +1,206 @@
+// Package notification is the admins' in-app notification centre. Workers
+// and handlers add a notification in the same transaction as the event it
+// reports: an SLA breach, a client comment, an unknown SKU, a failed
+// export or a project nearing its photo quota. Every admin sees every notification and read state is kept per
+// user. Notifications older than Retention drop out of the centre.
+package notification
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+const (
+	KindSLABreach     = "sla_breach"
+	KindClientComment = "client_comment"
+	KindUnknownSKU    = "unknown_sku"
+	KindExportFailed  = "export_failed"
+	KindPhotoQuota    = "photo_quota"
+
+	// Retention is how long a notification stays in the centre.
+	Retention = 30 * 24 * time.Hour
+
+	listLimit = 200
+)
+
+var ErrNotFound = errors.New("notification not found")
+
+// Kinds lists the notification kinds in filter order.
+var Kinds = []string{KindSLABreach, KindClientComment, KindUnknownSKU, KindExportFailed, KindPhotoQuota}
+
+var kindLabels = map[string]string{
+	KindSLABreach:     "SLA breach",
+	KindClientComment: "Client comment",
+	KindUnknownSKU:    "Unknown SKU",
+	KindExportFailed:  "Failed export",
+	KindPhotoQuota:    "Photo quota",
+}
+
+// KindLabel names a kind for display.
+func KindLabel(kind string) string {
+	if label, ok := kindLabels[kind]; ok {
+		return label
+	}
+	return kind
+}
+
+// Notification is an event to tell admins about. ProjectID and PalletID are
+// zero when the event has none; Link is where the notification opens.
+type Notification struct {
+	Kind      string
+	ProjectID int64
+	PalletID  int64
+	SKU       string
+	Title     string
+	Body      string
+	Link      string
+}
+
+// PalletLink is the content page of a pallet.
+func PalletLink(palletID int64) string {
+	return fmt.Sprintf("/tasker/pallets/%d/content-label", palletID)
+}
+
+// ReceiptLineLink is the detail page of one receipt line.
+func ReceiptLineLink(palletID, receiptID int64) string {
+	return fmt.Sprintf("/tasker/pallets/%d/content-line/%d", palletID, receiptID)
+}
+
+// Add records a notification in the caller's transaction.
+func Add(ctx context.Context, tx bun.IDB, n Notification) error {
+	var projectID, palletID *int64
+	if n.ProjectID > 0 {
+		projectID = &n.ProjectID
+	}
+	if n.PalletID > 0 {
+		palletID = &n.PalletID
+	}
+	_, err := tx.ExecContext(ctx, `
+INSERT INTO notifications (kind, project_id, pallet_id, sku, title, body, link, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`,
+		n.Kind, projectID, palletID, n.SKU, n.Title, n.Body, n.Link)
+	return err
+}
+
+// Item is a notification as one user sees it.
+type Item struct {
+	ID          int64     `bun:"id"`
+	Kind        string    `bun:"kind"`
+	ProjectCode string    `bun:"project_code"`
+	PalletID    int64     `bun:"pallet_id"`
+	SKU         string    `bun:"sku"`
+	Title       string    `bun:"title"`
+	Body        string    `bun:"body"`
+	Link        string    `bun:"link"`
+	CreatedAt   time.Time `bun:"created_at"`
+	Read        bool      `bun:"read"`
+}
+
+func (i Item) KindLabel() string {
+	return KindLabel(i.Kind)
+}
+
+// Filter narrows the list to one kind and/or to unread notifications.
+type Filter struct {
+	Kind       string
+	UnreadOnly bool
+}
+
+const itemSelect = `
+SELECT n.id, n.kind, COALESCE(p.code, '') AS project_code, COALESCE(n.pallet_id, 0) AS pallet_id,
+       n.sku, n.title, n.body, n.link, n.created_at,
+       EXISTS (SELECT 1 FROM notification_reads r WHERE r.notification_id = n.id AND r.user_id = ?) AS read
+FROM notifications n
+LEFT JOIN projects p ON p.id = n.project_id`
+
+// List returns the notifications of the last Retention at now for userID,
+// newest first.
+func List(ctx context.Context, db *sqlite.DB, userID int64, filter Filter, now time.Time) ([]Item, error) {
+	items := make([]Item, 0)
+	q := itemSelect + ` WHERE julianday(n.created_at) >= julianday(?)`
+	args := []any{userID, now.Add(-Retention)}
+	if filter.Kind != "" {
+		q += ` AND n.kind = ?`
+		args = append(args, filter.Kind)
+	}
+	if filter.UnreadOnly {
+		q += ` AND NOT EXISTS (SELECT 1 FROM notification_reads r WHERE r.notification_id = n.id AND r.user_id = ?)`
+		args = append(args, userID)
+	}
+	q += ` ORDER BY n.created_at DESC, n.id DESC LIMIT ?`
+	args = append(args, listLimit)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(q, args...).Scan(ctx, &items)
+	})
+	return items, err
+}
+
+// UnreadCount counts the notifications of the last Retention that userID has
+// not read.
+func UnreadCount(ctx context.Context, db *sqlite.DB, userID int64, now time.Time) (int64, error) {
+	var count int64
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT COUNT(1)
+FROM notifications n
+WHERE julianday(n.created_at) >= julianday(?)
+  AND NOT EXISTS (SELECT 1 FROM notification_reads r WHERE r.notification_id = n.id AND r.user_id = ?)`,
+			now.Add(-Retention), userID).Scan(ctx, &count)
+	})
+	return count, err
+}
+
+// MarkRead marks one notification read for userID and returns it.
+func MarkRead(ctx context.Context, db *sqlite.DB, userID, id int64) (Item, error) {
+	var item Item
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(itemSelect+` WHERE n.id = ?`, userID, id).Scan(ctx, &item); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO notification_reads (notification_id, user_id, read_at)
+VALUES (?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(notification_id, user_id) DO NOTHING`, id, userID)
+		return err
+	})
+	item.Read = err == nil
+	return item, err
+}
+
+// MarkAllRead marks every notification of the last Retention read for
+// userID.
+func MarkAllRead(ctx context.Context, db *sqlite.DB, userID int64, now time.Time) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO notification_reads (notification_id, user_id, read_at)
+SELECT n.id, ?, CURRENT_TIMESTAMP
+FROM notifications n
+WHERE julianday(n.created_at) >= julianday(?)
+ON CONFLICT(notification_id, user_id) DO NOTHING`, userID, now.Add(-Retention))
+		return err
+	})
+}
+
+type unreadKey struct{}
+
+// NewContext attaches an admin's unread count to ctx for the top bar.
+func NewContext(ctx context.Context, unread int64) context.Context {
+	return context.WithValue(ctx, unreadKey{}, unread)
+}
+
+// UnreadFromContext returns the unread count, and false when the request
+// has no notification centre, as for non-admins.
+func UnreadFromContext(ctx context.Context) (int64, bool) {
+	unread, ok := ctx.Value(unreadKey{}).(int64)
+	return unread, ok
+}
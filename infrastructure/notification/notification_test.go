@@ -0,0 +1,108 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func openNotificationTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "notification-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin'), (2, 'other', 'hash', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+			 (1, 'Inbound', 'd', '2026-02-01', 'Acme', 'inbound', 'active')`,
+			`INSERT INTO notifications (kind, title, link, created_at) VALUES ('export_failed', 'Old failure', '/tasker/exports', '2020-01-01 00:00:00')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		for _, n := range []Notification{
+			{Kind: KindSLABreach, ProjectID: 1, PalletID: 7, Title: "P00000007 breached its receiving SLA", Link: PalletLink(7)},
+			{Kind: KindUnknownSKU, ProjectID: 1, PalletID: 7, SKU: "MYSTERY", Title: "Unknown SKU MYSTERY received", Link: ReceiptLineLink(7, 3)},
+		} {
+			if err := Add(ctx, tx, n); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return db
+}
+
+func TestReadStateIsPerUser(t *testing.T) {
+	db := openNotificationTestDB(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	// The 2020 failure is past Retention and left out.
+	items, err := List(ctx, db, 1, Filter{}, now)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(items) != 2 || items[0].Kind != KindUnknownSKU || items[0].ProjectCode != "inbound" || items[0].Read {
+		t.Fatalf("unexpected items %+v", items)
+	}
+
+	item, err := MarkRead(ctx, db, 1, items[0].ID)
+	if err != nil || !item.Read || item.Link != "/tasker/pallets/7/content-line/3" {
+		t.Fatalf("mark read = %+v, %v", item, err)
+	}
+	if _, err := MarkRead(ctx, db, 1, items[0].ID); err != nil {
+		t.Fatalf("marking read twice: %v", err)
+	}
+	if _, err := MarkRead(ctx, db, 1, 999); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	for userID, want := range map[int64]int64{1: 1, 2: 2} {
+		if unread, err := UnreadCount(ctx, db, userID, now); err != nil || unread != want {
+			t.Fatalf("user %d unread = %d, %v; want %d", userID, unread, err, want)
+		}
+	}
+	unread, err := List(ctx, db, 1, Filter{UnreadOnly: true}, now)
+	if err != nil || len(unread) != 1 || unread[0].Kind != KindSLABreach {
+		t.Fatalf("unread only = %+v, %v", unread, err)
+	}
+	byKind, err := List(ctx, db, 2, Filter{Kind: KindUnknownSKU}, now)
+	if err != nil || len(byKind) != 1 || byKind[0].SKU != "MYSTERY" {
+		t.Fatalf("kind filter = %+v, %v", byKind, err)
+	}
+
+	if err := MarkAllRead(ctx, db, 2, now); err != nil {
+		t.Fatalf("mark all read: %v", err)
+	}
+	if unread, err := UnreadCount(ctx, db, 2, now); err != nil || unread != 0 {
+		t.Fatalf("unread after mark all = %d, %v", unread, err)
+	}
+	if unread, err := UnreadCount(ctx, db, 1, now); err != nil || unread != 1 {
+		t.Fatalf("another admin's mark all changed user 1's count to %d, %v", unread, err)
+	}
+}
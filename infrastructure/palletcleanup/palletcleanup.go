@@ -0,0 +1,264 @@
+// Package palletcleanup cancels pallets that were created but never used,
+// such as spare labels from a bulk print. A created pallet with no receipt
+// lines is cancelled once it is older than the project's
+// pallet.unused_cancel_days setting, unless an admin marked it exempt. Each
+// cancellation is recorded for the project's unused pallet report and sent to
+// client webhooks like a manual cancel.
+package palletcleanup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/clientwebhook"
+	"receipter/infrastructure/delivery"
+	"receipter/infrastructure/pallets"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/sqlite"
+)
+
+const (
+	// EventCancelled is the delivery event of cleanup alert emails.
+	EventCancelled = "pallet.unused_cancelled"
+
+	sweepInterval = time.Hour
+)
+
+// ErrNotCreated is returned when an exemption is changed on a pallet that is
+// no longer waiting for its first line.
+var ErrNotCreated = errors.New("only created pallets without lines can be exempted")
+
+// Cancelled is a pallet the sweeper cancelled.
+type Cancelled struct {
+	PalletID    int64  `bun:"pallet_id"`
+	ProjectID   int64  `bun:"project_id"`
+	ProjectCode string `bun:"project_code"`
+	IdleDays    int64  `bun:"-"`
+	CreatedAt   string `bun:"created_at"`
+}
+
+// Notifier is woken after cleanup alerts are queued.
+type Notifier interface {
+	Notify()
+}
+
+// Sweeper cancels unused pallets every hour.
+type Sweeper struct {
+	db         *sqlite.DB
+	deliveries Notifier
+
+	// EmailTo, when set before Start, receives an alert listing the
+	// pallets each sweep cancelled.
+	EmailTo string
+
+	// Paused, when set before Start, skips sweeps while it returns true.
+	Paused func() bool
+
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	started atomic.Bool
+}
+
+func NewSweeper(db *sqlite.DB, deliveries Notifier) *Sweeper {
+	return &Sweeper{
+		db:         db,
+		deliveries: deliveries,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start sweeps unused pallets until Stop.
+func (s *Sweeper) Start() {
+	s.started.Store(true)
+	go func() {
+		defer close(s.done)
+		ctx := context.Background()
+		ticker := time.NewTicker(sweepInterval)
+		defer ticker.Stop()
+		for {
+			if s.Paused == nil || !s.Paused() {
+				if _, err := s.Sweep(ctx, time.Now().UTC()); err != nil {
+					slog.Error("pallet cleanup: sweep failed", slog.Any("err", err))
+				}
+			}
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends a started sweeper and waits for a running sweep to finish.
+func (s *Sweeper) Stop() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	if !s.started.Load() {
+		return
+	}
+	select {
+	case <-s.done:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+// Sweep cancels every created, non-exempt pallet without lines on an active
+// project whose idle days have passed at now, and returns them. Pallets of a
+// closed phase are read-only and left alone.
+func (s *Sweeper) Sweep(ctx context.Context, now time.Time) ([]Cancelled, error) {
+	cancelled := make([]Cancelled, 0)
+	err := s.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		projectIDs := make([]int64, 0)
+		if err := tx.NewRaw(`SELECT id FROM projects WHERE status = 'active' ORDER BY id`).Scan(ctx, &projectIDs); err != nil {
+			return err
+		}
+		for _, projectID := range projectIDs {
+			settings, err := projectsettings.LoadTx(ctx, tx, projectID)
+			if err != nil {
+				return err
+			}
+			idleDays := settings.Int(projectsettings.PalletUnusedCancelDays)
+			if idleDays <= 0 {
+				continue
+			}
+			found := make([]Cancelled, 0)
+			if err := tx.NewRaw(`
+SELECT p.id AS pallet_id, p.project_id, pj.code AS project_code,
+       strftime('%d/%m/%Y', p.created_at) AS created_at
+FROM pallets p
+JOIN projects pj ON pj.id = p.project_id
+WHERE p.project_id = ?
+  AND p.status = 'created'
+  AND NOT EXISTS (SELECT 1 FROM pallet_cleanup_exemptions e WHERE e.pallet_id = p.id)
+  AND NOT EXISTS (
+    SELECT 1 FROM pallet_phases pp JOIN project_phases ph ON ph.id = pp.phase_id
+    WHERE pp.pallet_id = p.id AND ph.status = 'closed'
+  )
+  AND julianday(p.created_at) <= julianday(?) - ?
+  AND NOT EXISTS (SELECT 1 FROM pallet_receipts pr WHERE pr.pallet_id = p.id)
+ORDER BY p.id`, projectID, now, idleDays).Scan(ctx, &found); err != nil {
+				return err
+			}
+			for _, pallet := range found {
+				pallet.IdleDays = idleDays
+				if err := cancel(ctx, tx, pallet, now); err != nil {
+					return err
+				}
+				cancelled = append(cancelled, pallet)
+			}
+		}
+		if len(cancelled) == 0 || s.EmailTo == "" {
+			return nil
+		}
+		payload, err := json.Marshal(map[string]string{
+			"subject": alertSubject(cancelled),
+			"text":    alertText(cancelled),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = delivery.Enqueue(ctx, tx, delivery.KindEmail, s.EmailTo, EventCancelled, payload)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(cancelled) > 0 {
+		slog.Info("pallet cleanup: unused pallets cancelled", slog.Int("count", len(cancelled)))
+		if s.EmailTo != "" && s.deliveries != nil {
+			s.deliveries.Notify()
+		}
+	}
+	return cancelled, nil
+}
+
+func cancel(ctx context.Context, tx bun.Tx, pallet Cancelled, now time.Time) error {
+	if _, err := tx.ExecContext(ctx, `
+UPDATE pallets SET status = 'cancelled', closed_at = COALESCE(closed_at, ?), reopened_at = NULL
+WHERE id = ? AND status = 'created'`, now, pallet.PalletID); err != nil {
+		return err
+	}
+	if err := pallets.ReleaseClaim(ctx, tx, pallet.PalletID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO pallet_cleanups (pallet_id, project_id, idle_days, cancelled_at)
+VALUES (?, ?, ?, ?)`, pallet.PalletID, pallet.ProjectID, pallet.IdleDays, now); err != nil {
+		return err
+	}
+	return clientwebhook.EnqueuePalletEvent(ctx, tx, pallet.PalletID, clientwebhook.EventPalletCancelled)
+}
+
+// SetExempt marks a created pallet without lines as kept from, or again
+// subject to, automatic cancellation.
+func SetExempt(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID, palletID int64, exempt bool) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var current bool
+		err := tx.NewRaw(`
+SELECT EXISTS (SELECT 1 FROM pallet_cleanup_exemptions e WHERE e.pallet_id = p.id)
+FROM pallets p
+WHERE p.id = ? AND p.project_id = ? AND p.status = 'created'
+  AND NOT EXISTS (SELECT 1 FROM pallet_receipts pr WHERE pr.pallet_id = p.id)`, palletID, projectID).Scan(ctx, &current)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotCreated
+			}
+			return err
+		}
+		if current == exempt {
+			return nil
+		}
+		if exempt {
+			_, err = tx.ExecContext(ctx, `
+INSERT INTO pallet_cleanup_exemptions (pallet_id, exempted_by_user_id, exempted_at)
+VALUES (?, ?, CURRENT_TIMESTAMP)`, palletID, userID)
+		} else {
+			_, err = tx.ExecContext(ctx, `DELETE FROM pallet_cleanup_exemptions WHERE pallet_id = ?`, palletID)
+		}
+		if err != nil {
+			return err
+		}
+		if auditSvc == nil {
+			return nil
+		}
+		action := "pallet.cleanup_exempt"
+		if !exempt {
+			action = "pallet.cleanup_unexempt"
+		}
+		return auditSvc.Write(ctx, tx, userID, action, "pallets", strconv.FormatInt(palletID, 10),
+			map[string]any{"cleanupExempt": current}, map[string]any{"cleanupExempt": exempt})
+	})
+}
+
+func alertSubject(cancelled []Cancelled) string {
+	if len(cancelled) == 1 {
+		return fmt.Sprintf("Receipter: unused pallet P%08d cancelled", cancelled[0].PalletID)
+	}
+	return fmt.Sprintf("Receipter: %d unused pallets cancelled", len(cancelled))
+}
+
+func alertText(cancelled []Cancelled) string {
+	var b strings.Builder
+	b.WriteString("These pallets were created but never received any lines, and have been cancelled:\n")
+	for _, pallet := range cancelled {
+		fmt.Fprintf(&b, "\n- P%08d (%s): created %s, unused for %d days", pallet.PalletID, pallet.ProjectCode, pallet.CreatedAt, pallet.IdleDays)
+	}
+	b.WriteString("\n\nMark a pallet exempt on the project's unused pallet report to keep it.")
+	return b.String()
+}
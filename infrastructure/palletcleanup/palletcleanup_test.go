@@ -0,0 +1,137 @@
+package palletcleanup
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+type countingNotifier struct{ calls int }
+
+func (n *countingNotifier) Notify() { n.calls++ }
+
+func openCleanupTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "palletcleanup-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+			 (1, 'Inbound', 'd', '2026-02-01', 'Acme', 'inbound', 'active'),
+			 (2, 'Keep', 'd', '2026-02-01', 'Acme', 'keep', 'active'),
+			 (3, 'Done', 'd', '2026-02-01', 'Acme', 'done', 'inactive')`,
+			`INSERT INTO project_settings (project_id, key, value) VALUES (1, 'pallet.unused_cancel_days', '7'), (3, 'pallet.unused_cancel_days', '7')`,
+			`INSERT INTO pallets (id, project_id, status, created_at) VALUES
+			 (1, 1, 'created', '2026-03-01 08:00:00'),
+			 (2, 1, 'created', '2026-03-01 08:00:00'),
+			 (3, 1, 'created', '2026-03-01 08:00:00'),
+			 (4, 1, 'created', '2026-03-08 08:00:00'),
+			 (5, 1, 'open', '2026-03-01 08:00:00'),
+			 (6, 2, 'created', '2026-03-01 08:00:00'),
+			 (7, 3, 'created', '2026-03-01 08:00:00')`,
+			`INSERT INTO pallet_receipts (project_id, pallet_id, sku, description, scanned_by_user_id, qty) VALUES (1, 2, 'SKU-A', 'A', 1, 4)`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return db
+}
+
+func TestSweepCancelsOnlyUnusedPallets(t *testing.T) {
+	db := openCleanupTestDB(t)
+	ctx := context.Background()
+	if err := SetExempt(ctx, db, audit.NewService(), 1, 1, 3, true); err != nil {
+		t.Fatalf("set exempt: %v", err)
+	}
+	// Migrations run on every start and 003 rebuilds pallets; the exemption
+	// must survive that.
+	_, file, _, _ := runtime.Caller(0)
+	if err := sqlite.ApplyMigrations(ctx, db, filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")); err != nil {
+		t.Fatalf("reapply migrations: %v", err)
+	}
+	notifier := &countingNotifier{}
+	s := NewSweeper(db, notifier)
+	s.EmailTo = "ops@example.com"
+
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	cancelled, err := s.Sweep(ctx, now)
+	if err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	// Pallet 2 has a line, 3 is exempt, 4 is two days old, 5 is open, 6's
+	// project keeps unused pallets and 7's project is inactive.
+	if len(cancelled) != 1 || cancelled[0].PalletID != 1 || cancelled[0].IdleDays != 7 {
+		t.Fatalf("unexpected cancellations %+v", cancelled)
+	}
+	if notifier.calls != 1 {
+		t.Fatalf("expected deliveries notified once, got %d", notifier.calls)
+	}
+
+	if cancelled, err := s.Sweep(ctx, now.Add(time.Hour)); err != nil || len(cancelled) != 0 {
+		t.Fatalf("second sweep = %+v, %v; want nothing", cancelled, err)
+	}
+
+	var status, text string
+	var recorded, audits int
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT status FROM pallets WHERE id = 1`).Scan(ctx, &status); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM pallet_cleanups WHERE project_id = 1`).Scan(ctx, &recorded); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM audit_logs WHERE action = 'pallet.cleanup_exempt' AND entity_id = '3'`).Scan(ctx, &audits); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT CAST(payload AS TEXT) FROM deliveries WHERE event = ?`, EventCancelled).Scan(ctx, &text)
+	})
+	if err != nil {
+		t.Fatalf("load results: %v", err)
+	}
+	if status != "cancelled" || recorded != 1 || audits != 1 {
+		t.Fatalf("status %q, recorded %d, audits %d", status, recorded, audits)
+	}
+	if !strings.Contains(text, "P00000001") || !strings.Contains(text, "unused for 7 days") {
+		t.Fatalf("unexpected alert %s", text)
+	}
+}
+
+func TestSetExemptRejectsPalletsWithLines(t *testing.T) {
+	db := openCleanupTestDB(t)
+	ctx := context.Background()
+	if err := SetExempt(ctx, db, nil, 1, 1, 2, true); !errors.Is(err, ErrNotCreated) {
+		t.Fatalf("expected ErrNotCreated for a pallet with lines, got %v", err)
+	}
+	if err := SetExempt(ctx, db, nil, 1, 2, 1, true); !errors.Is(err, ErrNotCreated) {
+		t.Fatalf("expected ErrNotCreated for another project's pallet, got %v", err)
+	}
+}
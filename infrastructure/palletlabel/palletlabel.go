@@ -0,0 +1,231 @@
+// Package palletlabel tracks each printed pallet ID label. Every print gets
+// the next serial for its pallet, printed in the barcode as P00000042-3, so
+// a label voided after it was damaged or lost is recognised when scanned.
+// Labels printed before serials existed carry the bare pallet code and are
+// treated as valid.
+package palletlabel
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+const maxVoidReason = 200
+
+var (
+	ErrInvalidCode   = errors.New("not a pallet label barcode")
+	ErrNotFound      = errors.New("pallet label not found")
+	ErrAlreadyVoided = errors.New("pallet label is already void")
+	ErrReasonTooLong = errors.New("void reason must be 200 characters or less")
+)
+
+// codePattern matches P00000042, 00000042 or 42, each optionally followed by
+// -serial.
+var codePattern = regexp.MustCompile(`^[Pp]?0*([1-9][0-9]*)(?:-([1-9][0-9]*))?$`)
+
+// Instance is one printed label.
+type Instance struct {
+	ID         int64      `bun:"id"`
+	PalletID   int64      `bun:"pallet_id"`
+	Serial     int64      `bun:"serial"`
+	PrintedBy  string     `bun:"printed_by"`
+	PrintedAt  time.Time  `bun:"printed_at"`
+	VoidedAt   *time.Time `bun:"voided_at"`
+	VoidedBy   string     `bun:"voided_by"`
+	VoidReason string     `bun:"void_reason"`
+}
+
+// Voided reports whether the label was voided.
+func (i Instance) Voided() bool {
+	return i.VoidedAt != nil
+}
+
+// Code is the barcode value of a label.
+func (i Instance) Code() string {
+	return Code(i.PalletID, i.Serial)
+}
+
+// Code is the barcode value for a pallet's label serial. A serial of 0 gives
+// the bare pallet code.
+func Code(palletID, serial int64) string {
+	if serial <= 0 {
+		return fmt.Sprintf("P%08d", palletID)
+	}
+	return fmt.Sprintf("P%08d-%d", palletID, serial)
+}
+
+// ParseCode reads a scanned label barcode. The serial is 0 for a bare pallet
+// code.
+func ParseCode(raw string) (palletID, serial int64, err error) {
+	m := codePattern.FindStringSubmatch(strings.TrimSpace(raw))
+	if m == nil {
+		return 0, 0, ErrInvalidCode
+	}
+	if palletID, err = strconv.ParseInt(m[1], 10, 64); err != nil {
+		return 0, 0, ErrInvalidCode
+	}
+	if m[2] != "" {
+		if serial, err = strconv.ParseInt(m[2], 10, 64); err != nil {
+			return 0, 0, ErrInvalidCode
+		}
+	}
+	return palletID, serial, nil
+}
+
+// Issue records one new label for each pallet and returns the serials by
+// pallet ID.
+func Issue(ctx context.Context, db *sqlite.DB, userID int64, palletIDs []int64, now time.Time) (map[int64]int64, error) {
+	serials := make(map[int64]int64, len(palletIDs))
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, palletID := range palletIDs {
+			var serial int64
+			if err := tx.NewRaw(`SELECT COALESCE(MAX(serial), 0) + 1 FROM pallet_label_instances WHERE pallet_id = ?`, palletID).Scan(ctx, &serial); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `
+INSERT INTO pallet_label_instances (pallet_id, serial, printed_by_user_id, printed_at)
+VALUES (?, ?, ?, ?)`, palletID, serial, nullableUserID(userID), now.UTC()); err != nil {
+				return err
+			}
+			serials[palletID] = serial
+		}
+		return nil
+	})
+	return serials, err
+}
+
+// List returns a pallet's labels, newest first.
+func List(ctx context.Context, db *sqlite.DB, palletID int64) ([]Instance, error) {
+	instances := make([]Instance, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT li.id, li.pallet_id, li.serial, COALESCE(pu.username, '') AS printed_by, li.printed_at,
+       li.voided_at, COALESCE(vu.username, '') AS voided_by, li.void_reason
+FROM pallet_label_instances li
+LEFT JOIN users pu ON pu.id = li.printed_by_user_id
+LEFT JOIN users vu ON vu.id = li.voided_by_user_id
+WHERE li.pallet_id = ?
+ORDER BY li.serial DESC`, palletID).Scan(ctx, &instances)
+	})
+	return instances, err
+}
+
+// Void marks one label as no longer valid.
+func Void(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, palletID, serial int64, reason string) error {
+	reason = strings.TrimSpace(reason)
+	if len(reason) > maxVoidReason {
+		return ErrReasonTooLong
+	}
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var voidedAt *time.Time
+		if err := tx.NewRaw(`SELECT voided_at FROM pallet_label_instances WHERE pallet_id = ? AND serial = ?`, palletID, serial).Scan(ctx, &voidedAt); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		if voidedAt != nil {
+			return ErrAlreadyVoided
+		}
+		return voidTx(ctx, tx, auditSvc, userID, palletID, []int64{serial}, reason)
+	})
+}
+
+// VoidActive voids every label of a pallet that is still valid, before a
+// replacement is printed, and returns how many it voided.
+func VoidActive(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, palletID int64, reason string) (int, error) {
+	reason = strings.TrimSpace(reason)
+	if len(reason) > maxVoidReason {
+		return 0, ErrReasonTooLong
+	}
+	serials := make([]int64, 0)
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT serial FROM pallet_label_instances WHERE pallet_id = ? AND voided_at IS NULL ORDER BY serial`, palletID).Scan(ctx, &serials); err != nil {
+			return err
+		}
+		if len(serials) == 0 {
+			return nil
+		}
+		return voidTx(ctx, tx, auditSvc, userID, palletID, serials, reason)
+	})
+	return len(serials), err
+}
+
+func voidTx(ctx context.Context, tx bun.Tx, auditSvc *audit.Service, userID, palletID int64, serials []int64, reason string) error {
+	if _, err := tx.ExecContext(ctx, `
+UPDATE pallet_label_instances
+SET voided_at = ?, voided_by_user_id = ?, void_reason = ?
+WHERE pallet_id = ? AND serial IN (?)`, time.Now().UTC(), nullableUserID(userID), reason, palletID, bun.In(serials)); err != nil {
+		return err
+	}
+	if auditSvc == nil {
+		return nil
+	}
+	codes := make([]string, 0, len(serials))
+	for _, serial := range serials {
+		codes = append(codes, Code(palletID, serial))
+	}
+	return auditSvc.Write(ctx, tx, userID, "pallet.label_void", "pallets", strconv.FormatInt(palletID, 10), nil, map[string]any{
+		"labels": codes,
+		"reason": reason,
+	})
+}
+
+// Scan is what the pallet lookup learns from a scanned label.
+type Scan struct {
+	PalletID int64
+	Serial   int64
+	// Voided is set when the scanned label was voided; Label then holds it.
+	Voided bool
+	Label  Instance
+	// Current is the newest valid label of the pallet, if any.
+	Current *Instance
+}
+
+// Lookup checks a scanned label barcode against the labels printed for its
+// pallet. Unknown serials give ErrNotFound.
+func Lookup(ctx context.Context, db *sqlite.DB, raw string) (Scan, error) {
+	palletID, serial, err := ParseCode(raw)
+	if err != nil {
+		return Scan{}, err
+	}
+	scan := Scan{PalletID: palletID, Serial: serial}
+	instances, err := List(ctx, db, palletID)
+	if err != nil {
+		return Scan{}, err
+	}
+	found := serial == 0
+	for i := range instances {
+		inst := instances[i]
+		if inst.Serial == serial {
+			found = true
+			scan.Label = inst
+			scan.Voided = inst.Voided()
+		}
+		if scan.Current == nil && !inst.Voided() {
+			scan.Current = &inst
+		}
+	}
+	if !found {
+		return Scan{}, ErrNotFound
+	}
+	return scan, nil
+}
+
+func nullableUserID(userID int64) any {
+	if userID <= 0 {
+		return nil
+	}
+	return userID
+}
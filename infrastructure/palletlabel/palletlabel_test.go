@@ -0,0 +1,145 @@
+package palletlabel
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func openPalletLabelTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "palletlabel-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin1', 'x', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'P', 'P', DATE('now'), 'Client', 'p', 'active')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (42, 1, 'created'), (43, 1, 'created')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return db
+}
+
+func TestParseCode(t *testing.T) {
+	tests := []struct {
+		raw      string
+		palletID int64
+		serial   int64
+		wantErr  bool
+	}{
+		{raw: "P00000042", palletID: 42},
+		{raw: " p00000042-3 ", palletID: 42, serial: 3},
+		{raw: "42", palletID: 42},
+		{raw: "00000042-12", palletID: 42, serial: 12},
+		{raw: "P00000000", wantErr: true},
+		{raw: "P00000042-0", wantErr: true},
+		{raw: "P42-", wantErr: true},
+		{raw: "SKU-42", wantErr: true},
+		{raw: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		palletID, serial, err := ParseCode(tt.raw)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidCode) {
+				t.Fatalf("ParseCode(%q) err = %v, want ErrInvalidCode", tt.raw, err)
+			}
+			continue
+		}
+		if err != nil || palletID != tt.palletID || serial != tt.serial {
+			t.Fatalf("ParseCode(%q) = %d, %d, %v; want %d, %d", tt.raw, palletID, serial, err, tt.palletID, tt.serial)
+		}
+	}
+	if got := Code(42, 3); got != "P00000042-3" {
+		t.Fatalf("Code = %q", got)
+	}
+}
+
+func TestIssueVoidAndLookup(t *testing.T) {
+	db := openPalletLabelTestDB(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	serials, err := Issue(ctx, db, 1, []int64{42, 43}, now)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if serials[42] != 1 || serials[43] != 1 {
+		t.Fatalf("first serials = %v", serials)
+	}
+	if serials, err = Issue(ctx, db, 1, []int64{42}, now); err != nil || serials[42] != 2 {
+		t.Fatalf("second issue = %v, %v", serials, err)
+	}
+
+	if err := Void(ctx, db, nil, 1, 42, 1, "torn"); err != nil {
+		t.Fatalf("void: %v", err)
+	}
+	if err := Void(ctx, db, nil, 1, 42, 1, "again"); !errors.Is(err, ErrAlreadyVoided) {
+		t.Fatalf("void twice err = %v", err)
+	}
+	if err := Void(ctx, db, nil, 1, 42, 9, ""); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("void unknown err = %v", err)
+	}
+
+	scan, err := Lookup(ctx, db, "P00000042-1")
+	if err != nil {
+		t.Fatalf("lookup voided: %v", err)
+	}
+	if !scan.Voided || scan.Label.VoidReason != "torn" || scan.Label.VoidedBy != "admin1" {
+		t.Fatalf("voided scan = %+v", scan)
+	}
+	if scan.Current == nil || scan.Current.Serial != 2 {
+		t.Fatalf("current label = %+v", scan.Current)
+	}
+	if scan, err = Lookup(ctx, db, "P00000042-2"); err != nil || scan.Voided {
+		t.Fatalf("lookup valid = %+v, %v", scan, err)
+	}
+	if scan, err = Lookup(ctx, db, "P00000042"); err != nil || scan.Voided || scan.Serial != 0 {
+		t.Fatalf("lookup bare code = %+v, %v", scan, err)
+	}
+	if _, err := Lookup(ctx, db, "P00000042-7"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("lookup unprinted err = %v", err)
+	}
+
+	voided, err := VoidActive(ctx, db, nil, 1, 42, "reissued")
+	if err != nil || voided != 1 {
+		t.Fatalf("void active = %d, %v", voided, err)
+	}
+	labels, err := List(ctx, db, 42)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(labels) != 2 || labels[0].Serial != 2 || !labels[0].Voided() || !labels[1].Voided() {
+		t.Fatalf("labels = %+v", labels)
+	}
+	if scan, err = Lookup(ctx, db, "P00000042-2"); err != nil || !scan.Voided || scan.Current != nil {
+		t.Fatalf("lookup after reissue = %+v, %v", scan, err)
+	}
+}
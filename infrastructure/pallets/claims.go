@@ -0,0 +1,87 @@
+package pallets
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// ClaimWindow is how long a claim lasts after its holder last worked the
+// pallet. Each visit to the receipt page and each saved line renews it.
+const ClaimWindow = 15 * time.Minute
+
+// claimActiveSQL holds for a claim aliased c that has not lapsed at the
+// single bound time.
+var claimActiveSQL = fmt.Sprintf(`julianday(c.last_seen_at) > julianday(?, '-%d minutes')`, int(ClaimWindow/time.Minute))
+
+// ClaimedBySQL is the username of the live claim on a pallet aliased p at
+// the single bound time, or NULL when nobody holds it.
+var ClaimedBySQL = `(SELECT u.username FROM pallet_claims c JOIN users u ON u.id = c.user_id
+  WHERE c.pallet_id = p.id AND ` + claimActiveSQL + `)`
+
+// Claim marks a pallet as in use by one user, so a second scanner opening
+// the same pallet is warned off.
+type Claim struct {
+	PalletID   int64     `bun:"pallet_id"`
+	UserID     int64     `bun:"user_id"`
+	Username   string    `bun:"username"`
+	ClaimedAt  time.Time `bun:"claimed_at"`
+	LastSeenAt time.Time `bun:"last_seen_at"`
+}
+
+// IdleFor is how long the holder has been away from the pallet at now.
+func (c Claim) IdleFor(now time.Time) time.Duration {
+	return max(now.Sub(c.LastSeenAt), 0)
+}
+
+// TakeClaim claims the pallet for userID, or renews the user's own claim.
+// A live claim of someone else is left alone and returned, so the caller
+// can warn the user; a lapsed one is replaced.
+func TakeClaim(ctx context.Context, tx bun.Tx, palletID, userID int64, now time.Time) (Claim, error) {
+	if _, err := tx.NewRaw(`DELETE FROM pallet_claims AS c WHERE c.pallet_id = ? AND NOT (`+claimActiveSQL+`)`, palletID, now).Exec(ctx); err != nil {
+		return Claim{}, err
+	}
+	if _, err := tx.NewRaw(`
+INSERT INTO pallet_claims (pallet_id, user_id, claimed_at, last_seen_at) VALUES (?, ?, ?, ?)
+ON CONFLICT (pallet_id) DO UPDATE SET last_seen_at = excluded.last_seen_at
+WHERE pallet_claims.user_id = excluded.user_id`, palletID, userID, now, now).Exec(ctx); err != nil {
+		return Claim{}, err
+	}
+	return loadClaim(ctx, tx, palletID)
+}
+
+// ActiveClaim returns the live claim on a pallet, or ok false when nobody
+// holds it.
+func ActiveClaim(ctx context.Context, tx bun.Tx, palletID int64, now time.Time) (claim Claim, ok bool, err error) {
+	claim, err = loadClaim(ctx, tx, palletID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Claim{}, false, nil
+	}
+	if err != nil {
+		return Claim{}, false, err
+	}
+	if now.Sub(claim.LastSeenAt) >= ClaimWindow {
+		return Claim{}, false, nil
+	}
+	return claim, true, nil
+}
+
+// ReleaseClaim frees the pallet, whoever held it.
+func ReleaseClaim(ctx context.Context, tx bun.Tx, palletID int64) error {
+	_, err := tx.NewRaw(`DELETE FROM pallet_claims WHERE pallet_id = ?`, palletID).Exec(ctx)
+	return err
+}
+
+func loadClaim(ctx context.Context, tx bun.Tx, palletID int64) (Claim, error) {
+	var claim Claim
+	err := tx.NewRaw(`
+SELECT c.pallet_id, c.user_id, COALESCE(u.username, '') AS username, c.claimed_at, c.last_seen_at
+FROM pallet_claims c
+LEFT JOIN users u ON u.id = c.user_id
+WHERE c.pallet_id = ?`, palletID).Scan(ctx, &claim)
+	return claim, err
+}
@@ -0,0 +1,167 @@
+// Package pallets holds the pallet lifecycle rules shared by the web
+// handlers, the API and the import paths: which statuses accept receipt
+// lines and how a pallet moves between statuses.
+package pallets
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/clientwebhook"
+	"receipter/infrastructure/phase"
+	"receipter/infrastructure/project"
+	"receipter/models"
+)
+
+const (
+	StatusCreated   = "created"
+	StatusOpen      = "open"
+	StatusClosed    = "closed"
+	StatusLabelled  = "labelled"
+	StatusCancelled = "cancelled"
+)
+
+// IsValidStatus reports whether status is one a pallet can be in.
+func IsValidStatus(status string) bool {
+	switch status {
+	case StatusCreated, StatusOpen, StatusClosed, StatusLabelled, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// IsClosedLike reports whether the pallet has been closed, labelled or not.
+func IsClosedLike(status string) bool {
+	return status == StatusClosed || status == StatusLabelled
+}
+
+// CanReceive reports whether a user may add lines to a pallet. Closed and
+// labelled pallets are open to admins only.
+func CanReceive(projectStatus, palletStatus string, isAdmin bool) bool {
+	if projectStatus != project.StatusActive {
+		return false
+	}
+	switch palletStatus {
+	case StatusCreated, StatusOpen:
+		return true
+	case StatusClosed, StatusLabelled:
+		return isAdmin
+	}
+	return false
+}
+
+// CanManageLines reports whether existing lines on a pallet may be edited
+// or deleted.
+func CanManageLines(projectStatus, palletStatus string) bool {
+	if projectStatus != project.StatusActive {
+		return false
+	}
+	return palletStatus == StatusCreated || palletStatus == StatusOpen
+}
+
+// CheckTransition returns why a pallet in status from cannot move to to, or
+// nil when it can. Only close, reopen and cancel are user transitions.
+func CheckTransition(from, to string) error {
+	switch to {
+	case StatusClosed:
+		if from != StatusOpen {
+			return fmt.Errorf("pallet must be open to close")
+		}
+	case StatusOpen:
+		if !IsClosedLike(from) {
+			return fmt.Errorf("pallet must be closed or labelled to reopen")
+		}
+	case StatusCancelled:
+		if from == StatusCancelled {
+			return fmt.Errorf("pallet is already cancelled")
+		}
+	default:
+		return fmt.Errorf("invalid pallet status transition: %s", to)
+	}
+	return nil
+}
+
+// transitionAction is the audit action and client webhook event recorded
+// for a move to status to.
+func transitionAction(to string) (action, event string) {
+	switch to {
+	case StatusOpen:
+		return "pallet.reopen", clientwebhook.EventPalletReopened
+	case StatusCancelled:
+		return "pallet.cancel", clientwebhook.EventPalletCancelled
+	}
+	return "pallet.close", clientwebhook.EventPalletClosed
+}
+
+// Transition closes, reopens or cancels a pallet of an active project
+// inside tx, auditing the change and queueing the client webhook. Closing
+// or cancelling releases any claim on the pallet. Projects that verify
+// before close only let a pallet close once every line is verified.
+func Transition(ctx context.Context, tx bun.Tx, auditSvc *audit.Service, userID, projectID, palletID int64, to string) error {
+	var projectStatus string
+	if err := tx.NewRaw(`SELECT status FROM projects WHERE id = ?`, projectID).Scan(ctx, &projectStatus); err != nil {
+		return err
+	}
+	if err := project.CheckWritable(projectStatus); err != nil {
+		return err
+	}
+
+	var before models.Pallet
+	if err := tx.NewSelect().Model(&before).Where("id = ?", palletID).Where("project_id = ?", projectID).Limit(1).Scan(ctx); err != nil {
+		return err
+	}
+	if err := CheckTransition(before.Status, to); err != nil {
+		return err
+	}
+	if err := phase.CheckPalletTx(ctx, tx, palletID); err != nil {
+		return err
+	}
+	if to == StatusClosed {
+		if err := checkVerified(ctx, tx, auditSvc, userID, projectID, palletID); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	var err error
+	switch to {
+	case StatusClosed:
+		_, err = tx.NewRaw(`UPDATE pallets SET status = 'closed', closed_at = ?, reopened_at = NULL WHERE id = ?`, now, palletID).Exec(ctx)
+	case StatusOpen:
+		_, err = tx.NewRaw(`UPDATE pallets SET status = 'open', reopened_at = ? WHERE id = ?`, now, palletID).Exec(ctx)
+	case StatusCancelled:
+		_, err = tx.NewRaw(`UPDATE pallets SET status = 'cancelled', closed_at = COALESCE(closed_at, ?), reopened_at = NULL WHERE id = ?`, now, palletID).Exec(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	if to != StatusOpen {
+		if err := ReleaseClaim(ctx, tx, palletID); err != nil {
+			return err
+		}
+	}
+
+	var after models.Pallet
+	if err := tx.NewSelect().Model(&after).Where("id = ?", palletID).Where("project_id = ?", projectID).Limit(1).Scan(ctx); err != nil {
+		return err
+	}
+
+	action, event := transitionAction(to)
+	if auditSvc != nil {
+		if err := auditSvc.Write(ctx, tx, userID, action, "pallets", strconv.FormatInt(palletID, 10), before, after); err != nil {
+			return err
+		}
+	}
+	return clientwebhook.EnqueuePalletEvent(ctx, tx, palletID, event)
+}
+
+// PromoteToOpen opens a created pallet once its first line is saved.
+func PromoteToOpen(ctx context.Context, tx bun.Tx, projectID, palletID int64) error {
+	_, err := tx.NewRaw(`UPDATE pallets SET status = 'open', reopened_at = NULL WHERE id = ? AND project_id = ? AND status = 'created'`, palletID, projectID).Exec(ctx)
+	return err
+}
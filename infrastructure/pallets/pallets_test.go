@@ -0,0 +1,75 @@
+package pallets
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCanReceive_ClosedPalletsAreAdminOnly(t *testing.T) {
+	cases := []struct {
+		projectStatus string
+		palletStatus  string
+		isAdmin       bool
+		want          bool
+	}{
+		{"active", StatusCreated, false, true},
+		{"active", StatusOpen, false, true},
+		{"active", StatusClosed, false, false},
+		{"active", StatusClosed, true, true},
+		{"active", StatusLabelled, true, true},
+		{"active", StatusCancelled, true, false},
+		{"inactive", StatusOpen, true, false},
+		{"active", "unknown", true, false},
+	}
+	for _, tc := range cases {
+		if got := CanReceive(tc.projectStatus, tc.palletStatus, tc.isAdmin); got != tc.want {
+			t.Errorf("CanReceive(%q, %q, %v) = %v, want %v", tc.projectStatus, tc.palletStatus, tc.isAdmin, got, tc.want)
+		}
+	}
+}
+
+func TestCanManageLines_OnlyWhileOpen(t *testing.T) {
+	for _, status := range []string{StatusCreated, StatusOpen} {
+		if !CanManageLines("active", status) {
+			t.Errorf("CanManageLines(active, %q) = false", status)
+		}
+		if CanManageLines("inactive", status) {
+			t.Errorf("CanManageLines(inactive, %q) = true", status)
+		}
+	}
+	for _, status := range []string{StatusClosed, StatusLabelled, StatusCancelled} {
+		if CanManageLines("active", status) {
+			t.Errorf("CanManageLines(active, %q) = true", status)
+		}
+	}
+}
+
+func TestCheckTransition(t *testing.T) {
+	cases := []struct {
+		from, to  string
+		wantError string
+	}{
+		{StatusOpen, StatusClosed, ""},
+		{StatusCreated, StatusClosed, "pallet must be open to close"},
+		{StatusClosed, StatusClosed, "pallet must be open to close"},
+		{StatusClosed, StatusOpen, ""},
+		{StatusLabelled, StatusOpen, ""},
+		{StatusOpen, StatusOpen, "pallet must be closed or labelled to reopen"},
+		{StatusCreated, StatusCancelled, ""},
+		{StatusLabelled, StatusCancelled, ""},
+		{StatusCancelled, StatusCancelled, "pallet is already cancelled"},
+		{StatusClosed, StatusLabelled, "invalid pallet status transition"},
+	}
+	for _, tc := range cases {
+		err := CheckTransition(tc.from, tc.to)
+		if tc.wantError == "" {
+			if err != nil {
+				t.Errorf("%s -> %s: unexpected error %v", tc.from, tc.to, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+			t.Errorf("%s -> %s: expected error containing %q, got %v", tc.from, tc.to, tc.wantError, err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package pallets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/projectsettings"
+)
+
+var (
+	// ErrUnverified is returned when a pallet of a project that verifies
+	// before close still has lines nobody re-scanned.
+	ErrUnverified = errors.New("every line must be verified before the pallet is closed")
+	// ErrVerifyBarcode is returned for an empty verification scan.
+	ErrVerifyBarcode = errors.New("scan a carton barcode to verify")
+	// ErrNotVerifiable is returned for scans on a pallet that is not open.
+	ErrNotVerifiable = errors.New("pallet must be open to verify")
+)
+
+// verifyKeySQL is what a verification scan of a line aliased pr must match:
+// its carton barcode, or its SKU when the line has none.
+const verifyKeySQL = `UPPER(COALESCE(NULLIF(TRIM(pr.carton_barcode), ''), pr.sku))`
+
+// VerificationLine is one receipt line as seen by the verification scan.
+type VerificationLine struct {
+	ReceiptID   int64  `bun:"id"`
+	SKU         string `bun:"sku"`
+	Description string `bun:"description"`
+	BatchNumber string `bun:"batch_number"`
+	Qty         int64  `bun:"qty"`
+	// Barcode is what has to be scanned to verify the line.
+	Barcode  string `bun:"barcode"`
+	Verified bool   `bun:"verified"`
+}
+
+// Verification is the state of a pallet's verification scan. A line counts
+// as verified once a scan matches it after it was last changed, so a line
+// merged into or edited after its scan has to be scanned again.
+type Verification struct {
+	Lines []VerificationLine
+	Scans int
+	// Unmatched are scanned barcodes that match no line on the pallet,
+	// usually a carton that was put on the wrong pallet or never receipted.
+	Unmatched []string
+}
+
+// Outstanding is how many lines still need a scan.
+func (v Verification) Outstanding() int {
+	n := 0
+	for _, line := range v.Lines {
+		if !line.Verified {
+			n++
+		}
+	}
+	return n
+}
+
+// Complete reports whether every line has been verified.
+func (v Verification) Complete() bool {
+	return v.Outstanding() == 0
+}
+
+// VerifyRequired reports whether the project asks for a verification scan
+// before its pallets are closed.
+func VerifyRequired(ctx context.Context, tx bun.Tx, projectID int64) (bool, error) {
+	settings, err := projectsettings.LoadTx(ctx, tx, projectID)
+	if err != nil {
+		return false, err
+	}
+	return settings.Bool(projectsettings.PalletVerifyBeforeClose), nil
+}
+
+// RecordVerificationScan saves one verification scan of an open pallet and
+// returns how many lines it matched.
+func RecordVerificationScan(ctx context.Context, tx bun.Tx, palletID, userID int64, barcode string, now time.Time) (int, error) {
+	barcode = strings.TrimSpace(barcode)
+	if barcode == "" {
+		return 0, ErrVerifyBarcode
+	}
+	var status string
+	if err := tx.NewRaw(`SELECT status FROM pallets WHERE id = ?`, palletID).Scan(ctx, &status); err != nil {
+		return 0, err
+	}
+	if status != StatusOpen {
+		return 0, ErrNotVerifiable
+	}
+
+	var matched int
+	if err := tx.NewRaw(`SELECT COUNT(*) FROM pallet_receipts pr WHERE pr.pallet_id = ? AND `+verifyKeySQL+` = UPPER(?)`, palletID, barcode).Scan(ctx, &matched); err != nil {
+		return 0, err
+	}
+	if _, err := tx.NewRaw(`
+INSERT INTO pallet_verification_scans (pallet_id, barcode, matched_lines, scanned_by_user_id, scanned_at)
+VALUES (?, ?, ?, ?, ?)`, palletID, barcode, matched, userID, now).Exec(ctx); err != nil {
+		return 0, err
+	}
+	return matched, nil
+}
+
+// LoadVerification reads the verification state of a pallet's lines.
+func LoadVerification(ctx context.Context, tx bun.Tx, palletID int64) (Verification, error) {
+	v := Verification{Lines: make([]VerificationLine, 0), Unmatched: make([]string, 0)}
+	if err := tx.NewRaw(`
+SELECT pr.id, pr.sku, pr.description, COALESCE(pr.batch_number, '') AS batch_number, pr.qty,
+  COALESCE(NULLIF(TRIM(pr.carton_barcode), ''), pr.sku) AS barcode,
+  EXISTS (
+    SELECT 1 FROM pallet_verification_scans s
+    WHERE s.pallet_id = pr.pallet_id
+      AND UPPER(s.barcode) = `+verifyKeySQL+`
+      AND julianday(s.scanned_at) >= julianday(pr.updated_at)
+  ) AS verified
+FROM pallet_receipts pr
+WHERE pr.pallet_id = ?
+ORDER BY pr.sku COLLATE NOCASE ASC, pr.id ASC`, palletID).Scan(ctx, &v.Lines); err != nil {
+		return Verification{}, err
+	}
+	if err := tx.NewRaw(`SELECT COUNT(*) FROM pallet_verification_scans WHERE pallet_id = ?`, palletID).Scan(ctx, &v.Scans); err != nil {
+		return Verification{}, err
+	}
+	if err := tx.NewRaw(`
+SELECT DISTINCT s.barcode
+FROM pallet_verification_scans s
+WHERE s.pallet_id = ?
+  AND NOT EXISTS (SELECT 1 FROM pallet_receipts pr WHERE pr.pallet_id = s.pallet_id AND `+verifyKeySQL+` = UPPER(s.barcode))
+ORDER BY s.barcode`, palletID).Scan(ctx, &v.Unmatched); err != nil {
+		return Verification{}, err
+	}
+	return v, nil
+}
+
+// checkVerified refuses to close a pallet of a verifying project while lines
+// are outstanding, and records the verification result otherwise.
+func checkVerified(ctx context.Context, tx bun.Tx, auditSvc *audit.Service, userID, projectID, palletID int64) error {
+	required, err := VerifyRequired(ctx, tx, projectID)
+	if err != nil || !required {
+		return err
+	}
+	v, err := LoadVerification(ctx, tx, palletID)
+	if err != nil {
+		return err
+	}
+	if !v.Complete() {
+		return fmt.Errorf("%w: %d of %d lines not verified", ErrUnverified, v.Outstanding(), len(v.Lines))
+	}
+	if auditSvc == nil {
+		return nil
+	}
+	return auditSvc.Write(ctx, tx, userID, "pallet.verify", "pallets", strconv.FormatInt(palletID, 10), nil, map[string]any{
+		"lines":     len(v.Lines),
+		"scans":     v.Scans,
+		"unmatched": v.Unmatched,
+	})
+}
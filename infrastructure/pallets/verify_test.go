@@ -0,0 +1,161 @@
+package pallets
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/sqlite"
+)
+
+func openVerifyTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "verify-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'scanner1', 'x', 'scanner')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'Project', 'Project', DATE('now'), 'Client', 'project', 'active')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open')`,
+			`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, carton_barcode) VALUES
+				(1, 1, 1, 'SKU-A', 'A', 1, 4, '05012345678900'),
+				(2, 1, 1, 'SKU-B', 'B', 1, 6, NULL)`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	if err := projectsettings.SaveProject(context.Background(), db, nil, 1, 1, map[string]string{
+		projectsettings.PalletVerifyBeforeClose: "true",
+	}); err != nil {
+		t.Fatalf("enable verification: %v", err)
+	}
+	return db
+}
+
+func scanForVerify(t *testing.T, db *sqlite.DB, barcode string, now time.Time) int {
+	t.Helper()
+	var matched int
+	if err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		matched, err = RecordVerificationScan(ctx, tx, 1, 1, barcode, now)
+		return err
+	}); err != nil {
+		t.Fatalf("scan %q: %v", barcode, err)
+	}
+	return matched
+}
+
+func loadVerifyState(t *testing.T, db *sqlite.DB) Verification {
+	t.Helper()
+	var v Verification
+	if err := db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		v, err = LoadVerification(ctx, tx, 1)
+		return err
+	}); err != nil {
+		t.Fatalf("load verification: %v", err)
+	}
+	return v
+}
+
+func closeForVerify(db *sqlite.DB) error {
+	return db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return Transition(ctx, tx, audit.NewService(), 1, 1, 1, StatusClosed)
+	})
+}
+
+func TestCloseRequiresEveryLineVerified(t *testing.T) {
+	db := openVerifyTestDB(t)
+	now := time.Now()
+
+	if matched := scanForVerify(t, db, "05012345678900", now); matched != 1 {
+		t.Fatalf("expected carton barcode to match 1 line, got %d", matched)
+	}
+	if matched := scanForVerify(t, db, "9999", now); matched != 0 {
+		t.Fatalf("expected unknown barcode to match nothing, got %d", matched)
+	}
+
+	v := loadVerifyState(t, db)
+	if v.Outstanding() != 1 || v.Scans != 2 || len(v.Unmatched) != 1 || v.Unmatched[0] != "9999" {
+		t.Fatalf("expected SKU-B outstanding and 9999 unmatched, got %+v", v)
+	}
+	if err := closeForVerify(db); !errors.Is(err, ErrUnverified) {
+		t.Fatalf("expected ErrUnverified, got %v", err)
+	}
+
+	// Lines without a carton barcode are verified by SKU, in any case.
+	if matched := scanForVerify(t, db, "sku-b", now); matched != 1 {
+		t.Fatalf("expected SKU to match the line without a carton barcode, got %d", matched)
+	}
+	if err := closeForVerify(db); err != nil {
+		t.Fatalf("expected close once verified, got %v", err)
+	}
+
+	var audits int
+	if err := db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT COUNT(*) FROM audit_logs WHERE action = 'pallet.verify' AND entity_id = '1'`).Scan(ctx, &audits)
+	}); err != nil || audits != 1 {
+		t.Fatalf("expected the verification result audited once, got %d err=%v", audits, err)
+	}
+}
+
+func TestVerificationLapsesWhenLineChanges(t *testing.T) {
+	db := openVerifyTestDB(t)
+	scanForVerify(t, db, "05012345678900", time.Now().Add(-time.Hour))
+
+	if err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewRaw(`UPDATE pallet_receipts SET qty = 8, updated_at = ? WHERE id = 1`, time.Now()).Exec(ctx)
+		return err
+	}); err != nil {
+		t.Fatalf("update line: %v", err)
+	}
+	if v := loadVerifyState(t, db); v.Lines[0].Verified {
+		t.Fatalf("expected a line changed after its scan to need scanning again")
+	}
+}
+
+func TestVerificationScanNeedsOpenPallet(t *testing.T) {
+	db := openVerifyTestDB(t)
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		if _, err := RecordVerificationScan(ctx, tx, 1, 1, " ", time.Now()); !errors.Is(err, ErrVerifyBarcode) {
+			t.Fatalf("expected ErrVerifyBarcode, got %v", err)
+		}
+		if _, err := tx.NewRaw(`UPDATE pallets SET status = 'closed' WHERE id = 1`).Exec(ctx); err != nil {
+			return err
+		}
+		if _, err := RecordVerificationScan(ctx, tx, 1, 1, "SKU-A", time.Now()); !errors.Is(err, ErrNotVerifiable) {
+			t.Fatalf("expected ErrNotVerifiable, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("tx: %v", err)
+	}
+}
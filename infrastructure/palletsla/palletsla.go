@@ -0,0 +1,244 @@
+// Package palletsla tracks the receiving SLA: how long a pallet may stay open
+// after it is created, set per project with the pallet.sla_hours setting.
+// The monitor records each pallet the first time it runs past its SLA and
+// queues one alert for the newly late pallets, and notifies admins in the app.
+package palletsla
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/delivery"
+	"receipter/infrastructure/notification"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/sqlite"
+)
+
+const (
+	StateOK       = "ok"
+	StateWarning  = "warning"
+	StateBreached = "breached"
+
+	// WarnPercent of the SLA used marks a pallet as at risk.
+	WarnPercent = 75
+
+	// EventBreached is the delivery event of breach alert emails.
+	EventBreached = "pallet.sla_breached"
+
+	monitorPollInterval = 5 * time.Minute
+)
+
+// ElapsedMinutesSQL is the minutes a pallet aliased p has been open: up to
+// now (the single bound argument) while it is created or open, and up to
+// closed_at once it is closed or labelled. Cancelled pallets give NULL.
+const ElapsedMinutesSQL = `CASE
+  WHEN p.status IN ('created', 'open') THEN CAST((julianday(?) - julianday(p.created_at)) * 1440 AS INTEGER)
+  WHEN p.status IN ('closed', 'labelled') AND p.closed_at IS NOT NULL THEN CAST((julianday(p.closed_at) - julianday(p.created_at)) * 1440 AS INTEGER)
+END`
+
+// State grades elapsed minutes against an SLA of slaHours. It returns "" when
+// no SLA is set.
+func State(slaHours, elapsedMinutes int64) string {
+	if slaHours <= 0 {
+		return ""
+	}
+	limit := slaHours * 60
+	switch {
+	case elapsedMinutes >= limit:
+		return StateBreached
+	case elapsedMinutes*100 >= limit*WarnPercent:
+		return StateWarning
+	}
+	return StateOK
+}
+
+// FormatElapsed renders minutes as "3h 05m", or "2d 4h" past a day.
+func FormatElapsed(minutes int64) string {
+	if minutes < 0 {
+		minutes = 0
+	}
+	if minutes >= 24*60 {
+		return fmt.Sprintf("%dd %dh", minutes/(24*60), minutes%(24*60)/60)
+	}
+	return fmt.Sprintf("%dh %02dm", minutes/60, minutes%60)
+}
+
+// Breach is a pallet newly found past its SLA.
+type Breach struct {
+	PalletID       int64  `bun:"pallet_id"`
+	ProjectID      int64  `bun:"project_id"`
+	ProjectCode    string `bun:"project_code"`
+	SLAHours       int64  `bun:"-"`
+	ElapsedMinutes int64  `bun:"elapsed_minutes"`
+}
+
+// Notifier is woken after breach alerts are queued.
+type Notifier interface {
+	Notify()
+}
+
+// Monitor looks for late pallets every few minutes.
+type Monitor struct {
+	db         *sqlite.DB
+	deliveries Notifier
+
+	// EmailTo, when set before Start, receives an alert listing the
+	// pallets that breached since the last check.
+	EmailTo string
+
+	// Paused, when set before Start, skips breach checks while it returns
+	// true.
+	Paused func() bool
+
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	started atomic.Bool
+}
+
+func NewMonitor(db *sqlite.DB, deliveries Notifier) *Monitor {
+	return &Monitor{
+		db:         db,
+		deliveries: deliveries,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start checks for breaches until Stop.
+func (m *Monitor) Start() {
+	m.started.Store(true)
+	go func() {
+		defer close(m.done)
+		ctx := context.Background()
+		ticker := time.NewTicker(monitorPollInterval)
+		defer ticker.Stop()
+		for {
+			if m.Paused == nil || !m.Paused() {
+				if _, err := m.CheckBreaches(ctx, time.Now().UTC()); err != nil {
+					slog.Error("pallet sla: breach check failed", slog.Any("err", err))
+				}
+			}
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends a started monitor and waits for a running check to finish.
+func (m *Monitor) Stop() {
+	m.once.Do(func() {
+		close(m.stop)
+	})
+	if !m.started.Load() {
+		return
+	}
+	select {
+	case <-m.done:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+// CheckBreaches records every created or open pallet on an active project
+// that has passed its SLA at now and was not recorded before, and returns
+// them.
+func (m *Monitor) CheckBreaches(ctx context.Context, now time.Time) ([]Breach, error) {
+	breaches := make([]Breach, 0)
+	err := m.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		projectIDs := make([]int64, 0)
+		if err := tx.NewRaw(`SELECT id FROM projects WHERE status = 'active' ORDER BY id`).Scan(ctx, &projectIDs); err != nil {
+			return err
+		}
+		for _, projectID := range projectIDs {
+			settings, err := projectsettings.LoadTx(ctx, tx, projectID)
+			if err != nil {
+				return err
+			}
+			slaHours := settings.Int(projectsettings.PalletSLAHours)
+			if slaHours <= 0 {
+				continue
+			}
+			found := make([]Breach, 0)
+			if err := tx.NewRaw(`
+SELECT p.id AS pallet_id, p.project_id, pj.code AS project_code, `+ElapsedMinutesSQL+` AS elapsed_minutes
+FROM pallets p
+JOIN projects pj ON pj.id = p.project_id
+LEFT JOIN pallet_sla_breaches b ON b.pallet_id = p.id
+WHERE p.project_id = ?
+  AND p.status IN ('created', 'open')
+  AND b.pallet_id IS NULL
+  AND julianday(p.created_at) <= julianday(?) - ? / 24.0
+ORDER BY p.id`, now, projectID, now, slaHours).Scan(ctx, &found); err != nil {
+				return err
+			}
+			for _, breach := range found {
+				breach.SLAHours = slaHours
+				if _, err := tx.ExecContext(ctx, `
+INSERT INTO pallet_sla_breaches (pallet_id, project_id, sla_hours, breached_at)
+VALUES (?, ?, ?, ?)`, breach.PalletID, breach.ProjectID, slaHours, now); err != nil {
+					return err
+				}
+				if err := notification.Add(ctx, tx, notification.Notification{
+					Kind:      notification.KindSLABreach,
+					ProjectID: breach.ProjectID,
+					PalletID:  breach.PalletID,
+					Title:     fmt.Sprintf("P%08d breached its receiving SLA", breach.PalletID),
+					Body:      fmt.Sprintf("Open %s in %s, SLA %dh", FormatElapsed(breach.ElapsedMinutes), breach.ProjectCode, slaHours),
+					Link:      notification.PalletLink(breach.PalletID),
+				}); err != nil {
+					return err
+				}
+				breaches = append(breaches, breach)
+			}
+		}
+		if len(breaches) == 0 || m.EmailTo == "" {
+			return nil
+		}
+		payload, err := json.Marshal(map[string]string{
+			"subject": alertSubject(breaches),
+			"text":    alertText(breaches),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = delivery.Enqueue(ctx, tx, delivery.KindEmail, m.EmailTo, EventBreached, payload)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(breaches) > 0 {
+		slog.Warn("pallet sla: pallets breached", slog.Int("count", len(breaches)))
+		if m.EmailTo != "" && m.deliveries != nil {
+			m.deliveries.Notify()
+		}
+	}
+	return breaches, nil
+}
+
+func alertSubject(breaches []Breach) string {
+	if len(breaches) == 1 {
+		return fmt.Sprintf("Receipter: pallet P%08d breached its receiving SLA", breaches[0].PalletID)
+	}
+	return fmt.Sprintf("Receipter: %d pallets breached their receiving SLA", len(breaches))
+}
+
+func alertText(breaches []Breach) string {
+	var b strings.Builder
+	b.WriteString("These pallets are still open past their project's receiving SLA:\n")
+	for _, breach := range breaches {
+		fmt.Fprintf(&b, "\n- P%08d (%s): open %s, SLA %dh", breach.PalletID, breach.ProjectCode, FormatElapsed(breach.ElapsedMinutes), breach.SLAHours)
+	}
+	return b.String()
+}
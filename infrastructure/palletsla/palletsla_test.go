@@ -0,0 +1,147 @@
+package palletsla
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+type countingNotifier struct{ calls int }
+
+func (n *countingNotifier) Notify() { n.calls++ }
+
+func openSLATestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "palletsla-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+			 (1, 'Inbound', 'd', '2026-02-01', 'Acme', 'inbound', 'active'),
+			 (2, 'No SLA', 'd', '2026-02-01', 'Acme', 'no-sla', 'active')`,
+			`INSERT INTO project_settings (project_id, key, value) VALUES (1, 'pallet.sla_hours', '4')`,
+			`INSERT INTO pallets (id, project_id, status, created_at, closed_at) VALUES
+			 (1, 1, 'open', '2026-03-10 06:00:00', NULL),
+			 (2, 1, 'open', '2026-03-10 09:30:00', NULL),
+			 (3, 1, 'closed', '2026-03-10 05:00:00', '2026-03-10 11:00:00'),
+			 (4, 1, 'created', '2026-03-10 07:00:00', NULL),
+			 (5, 2, 'open', '2026-03-01 06:00:00', NULL)`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return db
+}
+
+func TestState(t *testing.T) {
+	cases := []struct {
+		sla, elapsed int64
+		want         string
+	}{
+		{0, 10_000, ""},
+		{4, 60, StateOK},
+		{4, 180, StateWarning},
+		{4, 239, StateWarning},
+		{4, 240, StateBreached},
+	}
+	for _, c := range cases {
+		if got := State(c.sla, c.elapsed); got != c.want {
+			t.Fatalf("State(%d, %d) = %q, want %q", c.sla, c.elapsed, got, c.want)
+		}
+	}
+	if got := FormatElapsed(185); got != "3h 05m" {
+		t.Fatalf("FormatElapsed(185) = %q", got)
+	}
+	if got := FormatElapsed(26 * 60); got != "1d 2h" {
+		t.Fatalf("FormatElapsed(26h) = %q", got)
+	}
+}
+
+func TestCheckBreachesRecordsEachPalletOnce(t *testing.T) {
+	db := openSLATestDB(t)
+	ctx := context.Background()
+	notifier := &countingNotifier{}
+	m := NewMonitor(db, notifier)
+	m.EmailTo = "ops@example.com"
+
+	now := time.Date(2026, 3, 10, 11, 0, 0, 0, time.UTC)
+	breaches, err := m.CheckBreaches(ctx, now)
+	if err != nil {
+		t.Fatalf("check breaches: %v", err)
+	}
+	// Pallet 1 is 5h open and pallet 4 4h; pallet 2 is inside its SLA, 3 is
+	// closed and 5's project has no SLA.
+	if len(breaches) != 2 || breaches[0].PalletID != 1 || breaches[1].PalletID != 4 {
+		t.Fatalf("unexpected breaches %+v", breaches)
+	}
+	if breaches[0].ElapsedMinutes != 300 || breaches[0].SLAHours != 4 {
+		t.Fatalf("unexpected breach detail %+v", breaches[0])
+	}
+	if notifier.calls != 1 {
+		t.Fatalf("expected deliveries notified once, got %d", notifier.calls)
+	}
+
+	breaches, err = m.CheckBreaches(ctx, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("check breaches again: %v", err)
+	}
+	if len(breaches) != 0 {
+		t.Fatalf("expected breaches recorded once, got %+v", breaches)
+	}
+
+	breaches, err = m.CheckBreaches(ctx, now.Add(2*time.Hour+30*time.Minute))
+	if err != nil {
+		t.Fatalf("check breaches later: %v", err)
+	}
+	if len(breaches) != 1 || breaches[0].PalletID != 2 {
+		t.Fatalf("expected pallet 2 to breach later, got %+v", breaches)
+	}
+
+	var emails, notifications int
+	var text string
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM deliveries WHERE kind = 'email' AND event = ?`, EventBreached).Scan(ctx, &emails); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM notifications WHERE kind = 'sla_breach'`).Scan(ctx, &notifications); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT CAST(payload AS TEXT) FROM deliveries ORDER BY id LIMIT 1`).Scan(ctx, &text)
+	})
+	if err != nil {
+		t.Fatalf("load alerts: %v", err)
+	}
+	if emails != 2 || !strings.Contains(text, "P00000001") || !strings.Contains(text, "2 pallets breached") {
+		t.Fatalf("unexpected alerts: %d %s", emails, text)
+	}
+	if notifications != 3 {
+		t.Fatalf("expected one notification per breached pallet, got %d", notifications)
+	}
+}
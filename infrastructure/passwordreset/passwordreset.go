@@ -0,0 +1,321 @@
+// Package passwordreset lets client users reset a forgotten password
+// themselves. A request by username or email queues a time-limited reset
+// link to the client's registered address; the link is single-use, and only
+// the newest one sent to a user works. Admins see outstanding requests and
+// can cancel them.
+package passwordreset
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/argon"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/delivery"
+	"receipter/infrastructure/sqlite"
+)
+
+const (
+	// Path is the reset page the emailed link opens.
+	Path = "/password/reset"
+
+	EventRequested = "password_reset.requested"
+
+	// DefaultTTL is how long a reset link works.
+	DefaultTTL = time.Hour
+	// resendAfter stops repeated requests from flooding a client's inbox:
+	// while the last link is younger than this, no new one is sent.
+	resendAfter = 5 * time.Minute
+)
+
+var (
+	ErrDisabled     = errors.New("password reset by email is not set up; ask an administrator to reset your password")
+	ErrInvalidToken = errors.New("this reset link is invalid, has been used or has expired; request a new one")
+	ErrNotFound     = errors.New("password reset request not found")
+)
+
+// Service issues and redeems reset links.
+type Service struct {
+	db         *sqlite.DB
+	audit      *audit.Service
+	deliveries *delivery.Worker
+	now        func() time.Time
+
+	// BaseURL is the site address links point at, such as
+	// https://receipter.example.com. Links are never built from the request's
+	// Host header, which the requester controls, so resets are off while it
+	// is blank.
+	BaseURL string
+	TTL     time.Duration
+}
+
+// NewService returns a service that queues reset emails through deliveries.
+func NewService(db *sqlite.DB, auditSvc *audit.Service, deliveries *delivery.Worker) *Service {
+	return &Service{
+		db:         db,
+		audit:      auditSvc,
+		deliveries: deliveries,
+		now:        func() time.Time { return time.Now().UTC() },
+		TTL:        DefaultTTL,
+	}
+}
+
+// Enabled reports whether reset links can be sent.
+func (s *Service) Enabled() bool {
+	return s != nil && strings.TrimSpace(s.BaseURL) != ""
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken() string {
+	buf := make([]byte, 32)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Request emails a reset link to the client user whose username or
+// registered email matches identifier. It returns nil whether or not a link
+// was sent, so the form cannot be used to find out which accounts exist.
+func (s *Service) Request(ctx context.Context, identifier, ip string) error {
+	if !s.Enabled() {
+		return ErrDisabled
+	}
+	identifier = strings.TrimSpace(identifier)
+	if identifier == "" {
+		return nil
+	}
+	token := newToken()
+	now := s.now()
+	queued := false
+	err := s.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var user struct {
+			ID       int64  `bun:"id"`
+			Username string `bun:"username"`
+			Email    string `bun:"email"`
+		}
+		err := tx.NewRaw(`
+SELECT u.id, u.username, a.email
+FROM users u
+JOIN client_reply_addresses a ON a.user_id = u.id
+WHERE u.role = 'client'
+  AND u.disabled_at IS NULL
+  AND (LOWER(u.username) = ? OR a.email = ?)
+LIMIT 1`, strings.ToLower(identifier), identifier).Scan(ctx, &user)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var recent bool
+		if err := tx.NewRaw(`
+SELECT COUNT(1) > 0 FROM password_resets
+WHERE user_id = ? AND used_at IS NULL AND cancelled_at IS NULL AND created_at > ?`, user.ID, now.Add(-resendAfter)).Scan(ctx, &recent); err != nil {
+			return err
+		}
+		if recent {
+			return nil
+		}
+		if _, err := tx.ExecContext(ctx, `
+UPDATE password_resets SET cancelled_at = ?
+WHERE user_id = ? AND used_at IS NULL AND cancelled_at IS NULL`, now, user.ID); err != nil {
+			return err
+		}
+
+		expiresAt := now.Add(s.TTL)
+		res, err := tx.ExecContext(ctx, `
+INSERT INTO password_resets (user_id, token_hash, email, requested_ip, created_at, expires_at)
+VALUES (?, ?, ?, ?, ?, ?)`, user.ID, hashToken(token), user.Email, ip, now, expiresAt)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		payload, err := json.Marshal(map[string]string{
+			"subject": "Reset your Receipter password",
+			"text":    s.emailText(user.Username, token),
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := delivery.Enqueue(ctx, tx, delivery.KindEmail, user.Email, EventRequested, payload); err != nil {
+			return err
+		}
+		queued = true
+		if s.audit != nil {
+			return s.audit.Write(ctx, tx, user.ID, "user.password_reset_request", "password_resets", strconv.FormatInt(id, 10), nil, map[string]any{
+				"email":      user.Email,
+				"ip":         ip,
+				"expires_at": expiresAt,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if queued {
+		s.deliveries.Notify()
+	}
+	return nil
+}
+
+func (s *Service) emailText(username, token string) string {
+	link := strings.TrimRight(strings.TrimSpace(s.BaseURL), "/") + Path + "?token=" + url.QueryEscape(token)
+	return fmt.Sprintf(`Hello %s,
+
+Someone asked to reset the password for your Receipter account. Open this link within %d minutes to choose a new password:
+
+%s
+
+If you did not ask for this, ignore this email and your password stays the same.
+`, username, int(s.TTL/time.Minute), link)
+}
+
+// Reset is an outstanding request found by its token.
+type Reset struct {
+	ID        int64     `bun:"id"`
+	UserID    int64     `bun:"user_id"`
+	Username  string    `bun:"username"`
+	ExpiresAt time.Time `bun:"expires_at"`
+}
+
+func findReset(ctx context.Context, tx bun.IDB, token string, now time.Time) (Reset, error) {
+	var reset Reset
+	err := tx.NewRaw(`
+SELECT pr.id, pr.user_id, u.username, pr.expires_at
+FROM password_resets pr
+JOIN users u ON u.id = pr.user_id
+WHERE pr.token_hash = ?
+  AND pr.used_at IS NULL
+  AND pr.cancelled_at IS NULL
+  AND pr.expires_at > ?
+  AND u.disabled_at IS NULL`, hashToken(strings.TrimSpace(token)), now).Scan(ctx, &reset)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Reset{}, ErrInvalidToken
+	}
+	return reset, err
+}
+
+// Lookup returns the outstanding request a link's token belongs to.
+func (s *Service) Lookup(ctx context.Context, token string) (Reset, error) {
+	var reset Reset
+	err := s.db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		reset, err = findReset(ctx, tx, token, s.now())
+		return err
+	})
+	return reset, err
+}
+
+// Complete sets the user's new password, which the caller has checked
+// against the password policy, and uses up the token. The user's sessions
+// are ended so a session opened by whoever knew the old password does not
+// survive; their IDs are returned for the session cache.
+func (s *Service) Complete(ctx context.Context, token, password string) ([]string, error) {
+	hash, err := argon.CreateHash(password, argon.DefaultParams)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	sessionIDs := make([]string, 0)
+	err = s.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		reset, err := findReset(ctx, tx, token, now)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?`, hash, now, reset.UserID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE password_resets SET used_at = ? WHERE id = ?`, now, reset.ID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+UPDATE password_resets SET cancelled_at = ?
+WHERE user_id = ? AND id <> ? AND used_at IS NULL AND cancelled_at IS NULL`, now, reset.UserID, reset.ID); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT id FROM sessions WHERE user_id = ?`, reset.UserID).Scan(ctx, &sessionIDs); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ?`, reset.UserID); err != nil {
+			return err
+		}
+		if s.audit != nil {
+			return s.audit.Write(ctx, tx, reset.UserID, "user.password_reset", "password_resets", strconv.FormatInt(reset.ID, 10), nil, map[string]any{
+				"sessions_ended": len(sessionIDs),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessionIDs, nil
+}
+
+// Outstanding is an unused, unexpired request, for the admin users page.
+type Outstanding struct {
+	ID          int64     `bun:"id"`
+	Username    string    `bun:"username"`
+	Email       string    `bun:"email"`
+	RequestedIP string    `bun:"requested_ip"`
+	CreatedAt   time.Time `bun:"created_at"`
+	ExpiresAt   time.Time `bun:"expires_at"`
+}
+
+// ListOutstanding returns the requests whose links still work, newest first.
+func ListOutstanding(ctx context.Context, db *sqlite.DB, now time.Time) ([]Outstanding, error) {
+	rows := make([]Outstanding, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT pr.id, u.username, pr.email, pr.requested_ip, pr.created_at, pr.expires_at
+FROM password_resets pr
+JOIN users u ON u.id = pr.user_id
+WHERE pr.used_at IS NULL
+  AND pr.cancelled_at IS NULL
+  AND pr.expires_at > ?
+ORDER BY pr.created_at DESC, pr.id DESC`, now.UTC()).Scan(ctx, &rows)
+	})
+	return rows, err
+}
+
+// Cancel stops an outstanding request's link from working.
+func Cancel(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID, id int64) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+UPDATE password_resets SET cancelled_at = ?
+WHERE id = ? AND used_at IS NULL AND cancelled_at IS NULL`, time.Now().UTC(), id)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		if auditSvc != nil {
+			return auditSvc.Write(ctx, tx, actorUserID, "user.password_reset_cancel", "password_resets", strconv.FormatInt(id, 10), nil, nil)
+		}
+		return nil
+	})
+}
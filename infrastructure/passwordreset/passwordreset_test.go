@@ -0,0 +1,149 @@
+package passwordreset
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"testing"
+	"time"
+
+	"receipter/infrastructure/argon"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+func openPasswordResetTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "passwordreset-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	return db
+}
+
+var linkToken = regexp.MustCompile(`/password/reset\?token=([0-9a-f]+)`)
+
+func TestRequestAndCompletePasswordReset(t *testing.T) {
+	db := openPasswordResetTestDB(t)
+	ctx := context.Background()
+	for _, stmt := range []string{
+		`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'P', 'd', '2026-01-01', 'C', 'p', 'active')`,
+		`INSERT INTO users (id, username, password_hash, role, client_project_id) VALUES (1, 'Buyer', 'old-hash', 'client', 1)`,
+		`INSERT INTO users (id, username, password_hash, role) VALUES (2, 'scanner', 'hash', 'scanner')`,
+		`INSERT INTO client_reply_addresses (user_id, email) VALUES (1, 'buyer@client.example')`,
+		`INSERT INTO sessions (id, user_id, expires_at) VALUES ('s1', 1, '2099-01-01 00:00:00')`,
+	} {
+		if _, err := db.W.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed %q: %v", stmt, err)
+		}
+	}
+
+	svc := NewService(db, audit.NewService(), nil)
+	if err := svc.Request(ctx, "buyer", "203.0.113.9"); !errors.Is(err, ErrDisabled) {
+		t.Fatalf("request without a base URL = %v, want ErrDisabled", err)
+	}
+	svc.BaseURL = "https://receipter.example/"
+	now := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	// Unknown accounts and non-client users get the same silent answer.
+	for _, identifier := range []string{"nobody", "scanner"} {
+		if err := svc.Request(ctx, identifier, "203.0.113.9"); err != nil {
+			t.Fatalf("request for %s: %v", identifier, err)
+		}
+	}
+	if err := svc.Request(ctx, "BUYER@client.example", "203.0.113.9"); err != nil {
+		t.Fatalf("request by email: %v", err)
+	}
+	// A repeat within the resend window sends nothing new.
+	now = now.Add(time.Minute)
+	if err := svc.Request(ctx, "buyer", "203.0.113.9"); err != nil {
+		t.Fatalf("repeat request: %v", err)
+	}
+
+	var emails []struct {
+		Endpoint string `bun:"endpoint"`
+		Payload  string `bun:"payload"`
+	}
+	if err := db.R.NewRaw(`SELECT endpoint, payload FROM deliveries WHERE event = ?`, EventRequested).Scan(ctx, &emails); err != nil {
+		t.Fatalf("load emails: %v", err)
+	}
+	if len(emails) != 1 || emails[0].Endpoint != "buyer@client.example" {
+		t.Fatalf("emails = %+v", emails)
+	}
+	var body map[string]string
+	if err := json.Unmarshal([]byte(emails[0].Payload), &body); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	match := linkToken.FindStringSubmatch(body["text"])
+	if match == nil || !regexp.MustCompile(`https://receipter\.example/password/reset`).MatchString(body["text"]) {
+		t.Fatalf("email text has no reset link: %q", body["text"])
+	}
+	token := match[1]
+
+	outstanding, err := ListOutstanding(ctx, db, now)
+	if err != nil || len(outstanding) != 1 || outstanding[0].Username != "Buyer" || outstanding[0].RequestedIP != "203.0.113.9" {
+		t.Fatalf("outstanding = %+v, %v", outstanding, err)
+	}
+	if reset, err := svc.Lookup(ctx, token); err != nil || reset.UserID != 1 {
+		t.Fatalf("lookup = %+v, %v", reset, err)
+	}
+
+	sessions, err := svc.Complete(ctx, token, "new-secret")
+	if err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0] != "s1" {
+		t.Fatalf("ended sessions = %v", sessions)
+	}
+	var hash string
+	if err := db.R.NewRaw(`SELECT password_hash FROM users WHERE id = 1`).Scan(ctx, &hash); err != nil {
+		t.Fatalf("load hash: %v", err)
+	}
+	if ok, err := argon.ComparePasswordAndHash("new-secret", hash); err != nil || !ok {
+		t.Fatalf("new password does not match: %v", err)
+	}
+	if _, err := svc.Complete(ctx, token, "again"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("reused token = %v, want ErrInvalidToken", err)
+	}
+	if outstanding, err := ListOutstanding(ctx, db, now); err != nil || len(outstanding) != 0 {
+		t.Fatalf("outstanding after reset = %+v, %v", outstanding, err)
+	}
+
+	// Links stop working once they expire.
+	now = now.Add(10 * time.Minute)
+	if err := svc.Request(ctx, "buyer", ""); err != nil {
+		t.Fatalf("second request: %v", err)
+	}
+	var payload string
+	if err := db.R.NewRaw(`SELECT payload FROM deliveries WHERE event = ? ORDER BY id DESC LIMIT 1`, EventRequested).Scan(ctx, &payload); err != nil {
+		t.Fatalf("load second email: %v", err)
+	}
+	second := linkToken.FindStringSubmatch(payload)
+	if second == nil {
+		t.Fatalf("second email has no link: %q", payload)
+	}
+	now = now.Add(DefaultTTL + time.Second)
+	if _, err := svc.Lookup(ctx, second[1]); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expired token = %v, want ErrInvalidToken", err)
+	}
+
+	var audits int
+	if err := db.R.NewRaw(`SELECT COUNT(1) FROM audit_logs WHERE action IN ('user.password_reset_request', 'user.password_reset')`).Scan(ctx, &audits); err != nil || audits != 3 {
+		t.Fatalf("audit entries = %d, %v", audits, err)
+	}
+}
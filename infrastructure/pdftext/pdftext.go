@@ -0,0 +1,45 @@
+// Package pdftext holds the text helpers shared by the generated PDF
+// documents, such as custody records and damage claim packs, which are set in
+// gofpdf's core fonts.
+package pdftext
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Translator converts UTF-8 text to the cp1252 encoding of the core fonts,
+// so names with accents print correctly.
+func Translator(pdf *gofpdf.Fpdf) func(string) string {
+	return pdf.UnicodeTranslatorFromDescriptor("")
+}
+
+// Fit shortens s with an ellipsis until it fits width at the current font.
+func Fit(pdf *gofpdf.Fpdf, s string, width float64) string {
+	if pdf.GetStringWidth(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && pdf.GetStringWidth(string(runes)+"...") > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// OrDash returns s, or "-" when it is blank.
+func OrDash(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "-"
+	}
+	return s
+}
+
+// FormatTime formats t as printed on documents, or "-" when it is unset.
+func FormatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("02/01/2006 15:04")
+}
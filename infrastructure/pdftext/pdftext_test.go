@@ -0,0 +1,38 @@
+package pdftext
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+func TestTranslatorAndFit(t *testing.T) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetFont("Helvetica", "", 10)
+
+	if got := Translator(pdf)("Café"); got != "Caf\xe9" {
+		t.Fatalf("Translator = %q", got)
+	}
+	if got := Fit(pdf, "short", 50); got != "short" {
+		t.Fatalf("Fit of short text = %q", got)
+	}
+	long := strings.Repeat("Pallet description ", 10)
+	got := Fit(pdf, long, 40)
+	if !strings.HasSuffix(got, "...") || pdf.GetStringWidth(got) > 40 {
+		t.Fatalf("Fit of long text = %q (width %.1f)", got, pdf.GetStringWidth(got))
+	}
+}
+
+func TestOrDashAndFormatTime(t *testing.T) {
+	if OrDash("  ") != "-" || OrDash("x") != "x" {
+		t.Fatalf("OrDash")
+	}
+	if FormatTime(time.Time{}) != "-" {
+		t.Fatalf("FormatTime of zero time")
+	}
+	if got := FormatTime(time.Date(2026, 3, 4, 5, 6, 0, 0, time.UTC)); got != "04/03/2026 05:06" {
+		t.Fatalf("FormatTime = %q", got)
+	}
+}
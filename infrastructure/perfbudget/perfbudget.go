@@ -0,0 +1,47 @@
+// Package perfbudget turns a benchmark into a test that fails once the
+// operation gets slower than its budget, so hot paths like saving a receipt
+// are guarded by a plain go test run rather than by someone remembering to
+// compare benchmark output.
+//
+// Budgets are set several times above what a developer laptop measures so
+// they only trip on real regressions. Slower machines scale them all with
+// PERF_BUDGET_SCALE, e.g. PERF_BUDGET_SCALE=3, and -short skips them.
+package perfbudget
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// EnvScale names the environment variable multiplying every budget.
+const EnvScale = "PERF_BUDGET_SCALE"
+
+// Check benchmarks fn and fails t when one iteration takes longer than
+// budget on average.
+func Check(t *testing.T, budget time.Duration, fn func(b *testing.B)) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("performance budgets skipped in short mode")
+	}
+	limit := time.Duration(float64(budget) * Scale())
+	result := testing.Benchmark(fn)
+	if result.N == 0 {
+		t.Fatalf("benchmark failed to run")
+	}
+	perOp := time.Duration(result.NsPerOp())
+	t.Logf("%s/op over %d runs, budget %s", perOp, result.N, limit)
+	if perOp > limit {
+		t.Fatalf("%s/op is over the %s budget", perOp, limit)
+	}
+}
+
+// Scale reads EnvScale, defaulting to 1.
+func Scale() float64 {
+	v, err := strconv.ParseFloat(os.Getenv(EnvScale), 64)
+	if err != nil || v <= 0 {
+		return 1
+	}
+	return v
+}
@@ -0,0 +1,217 @@
+// Package phase splits a long-running project into receiving phases, such
+// as wave 1 and wave 2. A pallet joins the project's current phase, the open
+// phase started last, when it is created. Closing a phase locks its pallets
+// and their receipt lines read-only while the project stays active for the
+// next phase. Pallets created while no phase was open join the next phase
+// started.
+package phase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/project"
+	"receipter/infrastructure/sqlite"
+)
+
+const (
+	StatusOpen   = "open"
+	StatusClosed = "closed"
+
+	maxNameLength = 100
+)
+
+var (
+	ErrClosed        = errors.New("this pallet's phase is closed; its pallets are read-only")
+	ErrNameRequired  = errors.New("phase name is required")
+	ErrNameTooLong   = fmt.Errorf("phase name must be %d characters or fewer", maxNameLength)
+	ErrNameTaken     = errors.New("the project already has a phase with this name")
+	ErrNotFound      = errors.New("phase not found")
+	ErrAlreadyClosed = errors.New("phase is already closed")
+)
+
+// Phase is a receiving phase of a project with its pallet and line counts.
+type Phase struct {
+	ID        int64  `bun:"id"`
+	ProjectID int64  `bun:"project_id"`
+	Name      string `bun:"name"`
+	Status    string `bun:"status"`
+	CreatedBy string `bun:"created_by"`
+	CreatedAt string `bun:"created_at"`
+	ClosedBy  string `bun:"closed_by"`
+	ClosedAt  string `bun:"closed_at"`
+	Pallets   int64  `bun:"pallets"`
+	Lines     int64  `bun:"lines"`
+	Units     int64  `bun:"units"`
+}
+
+// IsClosed reports whether the phase's pallets are locked.
+func (p Phase) IsClosed() bool {
+	return p.Status == StatusClosed
+}
+
+const selectPhases = `
+SELECT ph.id, ph.project_id, ph.name, ph.status,
+       COALESCE(cu.username, '') AS created_by,
+       strftime('%d/%m/%Y %H:%M', ph.created_at) AS created_at,
+       COALESCE(xu.username, '') AS closed_by,
+       COALESCE(strftime('%d/%m/%Y %H:%M', ph.closed_at), '') AS closed_at,
+       (SELECT COUNT(1) FROM pallet_phases pp WHERE pp.phase_id = ph.id) AS pallets,
+       (SELECT COUNT(1) FROM pallet_receipts pr JOIN pallet_phases pp ON pp.pallet_id = pr.pallet_id WHERE pp.phase_id = ph.id) AS lines,
+       (SELECT COALESCE(SUM(pr.qty), 0) FROM pallet_receipts pr JOIN pallet_phases pp ON pp.pallet_id = pr.pallet_id WHERE pp.phase_id = ph.id) AS units
+FROM project_phases ph
+LEFT JOIN users cu ON cu.id = ph.created_by_user_id
+LEFT JOIN users xu ON xu.id = ph.closed_by_user_id`
+
+// List returns a project's phases, oldest first.
+func List(ctx context.Context, db *sqlite.DB, projectID int64) ([]Phase, error) {
+	phases := make([]Phase, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(selectPhases+`
+WHERE ph.project_id = ?
+ORDER BY ph.id ASC`, projectID).Scan(ctx, &phases)
+	})
+	return phases, err
+}
+
+// Load returns one phase of a project, or ErrNotFound.
+func Load(ctx context.Context, db *sqlite.DB, projectID, phaseID int64) (Phase, error) {
+	var p Phase
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(selectPhases+`
+WHERE ph.id = ? AND ph.project_id = ?`, phaseID, projectID).Scan(ctx, &p)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, ErrNotFound
+	}
+	return p, err
+}
+
+// Start opens a new phase on an active project, which becomes the current
+// phase. The project's pallets that have no phase yet join it.
+func Start(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID int64, name string) (int64, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return 0, ErrNameRequired
+	}
+	if len(name) > maxNameLength {
+		return 0, ErrNameTooLong
+	}
+	var phaseID int64
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var projectStatus string
+		if err := tx.NewRaw(`SELECT status FROM projects WHERE id = ?`, projectID).Scan(ctx, &projectStatus); err != nil {
+			return err
+		}
+		if err := project.CheckWritable(projectStatus); err != nil {
+			return err
+		}
+		var taken bool
+		if err := tx.NewRaw(`SELECT EXISTS (SELECT 1 FROM project_phases WHERE project_id = ? AND name = ?)`, projectID, name).Scan(ctx, &taken); err != nil {
+			return err
+		}
+		if taken {
+			return ErrNameTaken
+		}
+		if err := tx.NewRaw(`
+INSERT INTO project_phases (project_id, name, status, created_by_user_id)
+VALUES (?, ?, 'open', ?)
+RETURNING id`, projectID, name, userID).Scan(ctx, &phaseID); err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, `
+INSERT INTO pallet_phases (pallet_id, phase_id)
+SELECT p.id, ?
+FROM pallets p
+WHERE p.project_id = ?
+  AND NOT EXISTS (SELECT 1 FROM pallet_phases pp WHERE pp.pallet_id = p.id)`, phaseID, projectID)
+		if err != nil {
+			return err
+		}
+		adopted, _ := res.RowsAffected()
+
+		if auditSvc == nil {
+			return nil
+		}
+		return auditSvc.Write(ctx, tx, userID, "phase.start", "project_phases", strconv.FormatInt(phaseID, 10), nil,
+			map[string]any{"projectId": projectID, "name": name, "adoptedPallets": adopted})
+	})
+	return phaseID, err
+}
+
+// Close locks a phase's pallets read-only. It cannot be reopened.
+func Close(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, projectID, phaseID int64) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var name, status string
+		if err := tx.NewRaw(`SELECT name, status FROM project_phases WHERE id = ? AND project_id = ?`, phaseID, projectID).Scan(ctx, &name, &status); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		if status == StatusClosed {
+			return ErrAlreadyClosed
+		}
+		if _, err := tx.ExecContext(ctx, `
+UPDATE project_phases SET status = 'closed', closed_by_user_id = ?, closed_at = CURRENT_TIMESTAMP
+WHERE id = ?`, userID, phaseID); err != nil {
+			return err
+		}
+
+		if auditSvc == nil {
+			return nil
+		}
+		return auditSvc.Write(ctx, tx, userID, "phase.close", "project_phases", strconv.FormatInt(phaseID, 10),
+			map[string]any{"name": name, "status": status}, map[string]any{"name": name, "status": StatusClosed})
+	})
+}
+
+// AssignTx puts new pallets of a project into its current phase. Pallets
+// stay without a phase when the project has no open phase.
+func AssignTx(ctx context.Context, tx bun.Tx, projectID int64, palletIDs ...int64) error {
+	if len(palletIDs) == 0 {
+		return nil
+	}
+	var current int64
+	err := tx.NewRaw(`
+SELECT id FROM project_phases
+WHERE project_id = ? AND status = 'open'
+ORDER BY id DESC
+LIMIT 1`, projectID).Scan(ctx, &current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+INSERT OR IGNORE INTO pallet_phases (pallet_id, phase_id)
+SELECT p.id, ? FROM pallets p WHERE p.id IN (?) AND p.project_id = ?`, current, bun.In(palletIDs), projectID)
+	return err
+}
+
+// CheckPalletTx returns ErrClosed when the pallet belongs to a closed
+// phase. Every write to a pallet or its receipt lines checks it next to the
+// project's own read-only check.
+func CheckPalletTx(ctx context.Context, tx bun.Tx, palletID int64) error {
+	var closed bool
+	if err := tx.NewRaw(`
+SELECT EXISTS (
+  SELECT 1 FROM pallet_phases pp
+  JOIN project_phases ph ON ph.id = pp.phase_id
+  WHERE pp.pallet_id = ? AND ph.status = 'closed'
+)`, palletID).Scan(ctx, &closed); err != nil {
+		return err
+	}
+	if closed {
+		return ErrClosed
+	}
+	return nil
+}
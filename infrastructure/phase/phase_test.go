@@ -0,0 +1,146 @@
+package phase
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+func migrationsDir(t *testing.T) string {
+	t.Helper()
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	return filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+}
+
+func openPhaseTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	db, err := sqlite.OpenDB(filepath.Join(t.TempDir(), "phase-test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir(t)); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	_, err = db.W.ExecContext(context.Background(), `
+INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin');
+INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+  (1, 'Inbound', 'd', '2026-01-01', 'Acme', 'inbound', 'active'),
+  (2, 'Done', 'd', '2026-01-01', 'Acme', 'done', 'inactive');
+INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open'), (2, 1, 'created'), (3, 2, 'closed');
+INSERT INTO pallet_receipts (project_id, pallet_id, sku, description, scanned_by_user_id, qty) VALUES (1, 1, 'SKU-A', 'A', 1, 4);
+`)
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return db
+}
+
+func assign(t *testing.T, db *sqlite.DB, projectID int64, palletIDs ...int64) {
+	t.Helper()
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return AssignTx(ctx, tx, projectID, palletIDs...)
+	})
+	if err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+}
+
+func checkPallet(t *testing.T, db *sqlite.DB, palletID int64) error {
+	t.Helper()
+	var checkErr error
+	err := db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		checkErr = CheckPalletTx(ctx, tx, palletID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("check pallet: %v", err)
+	}
+	return checkErr
+}
+
+func TestPhasesAssignPalletsAndCloseLocksThem(t *testing.T) {
+	db := openPhaseTestDB(t)
+	ctx := context.Background()
+
+	// Without an open phase new pallets stay ungrouped.
+	if _, err := db.W.ExecContext(ctx, `INSERT INTO pallets (id, project_id, status) VALUES (4, 1, 'created')`); err != nil {
+		t.Fatalf("insert pallet: %v", err)
+	}
+	assign(t, db, 1, 4)
+
+	wave1, err := Start(ctx, db, audit.NewService(), 1, 1, " Wave 1 ")
+	if err != nil {
+		t.Fatalf("start wave 1: %v", err)
+	}
+	if _, err := Start(ctx, db, nil, 1, 1, "Wave 1"); !errors.Is(err, ErrNameTaken) {
+		t.Fatalf("expected ErrNameTaken, got %v", err)
+	}
+	if _, err := Start(ctx, db, nil, 1, 2, "Wave 1"); err == nil {
+		t.Fatalf("expected a phase on an inactive project to be refused")
+	}
+
+	phases, err := List(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(phases) != 1 || phases[0].Name != "Wave 1" || phases[0].Pallets != 3 || phases[0].Lines != 1 || phases[0].Units != 4 {
+		t.Fatalf("expected wave 1 to adopt the project's three pallets, got %+v", phases)
+	}
+
+	if err := Close(ctx, db, audit.NewService(), 1, 1, wave1); err != nil {
+		t.Fatalf("close wave 1: %v", err)
+	}
+	if err := Close(ctx, db, nil, 1, 1, wave1); !errors.Is(err, ErrAlreadyClosed) {
+		t.Fatalf("expected ErrAlreadyClosed, got %v", err)
+	}
+	if err := Close(ctx, db, nil, 1, 2, wave1); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for another project, got %v", err)
+	}
+
+	wave2, err := Start(ctx, db, nil, 1, 1, "Wave 2")
+	if err != nil {
+		t.Fatalf("start wave 2: %v", err)
+	}
+	if _, err := db.W.ExecContext(ctx, `INSERT INTO pallets (id, project_id, status) VALUES (5, 1, 'created')`); err != nil {
+		t.Fatalf("insert pallet: %v", err)
+	}
+	assign(t, db, 1, 5)
+
+	// Migrations run on every start and 003 rebuilds pallets; the phase
+	// links must survive that.
+	if err := sqlite.ApplyMigrations(ctx, db, migrationsDir(t)); err != nil {
+		t.Fatalf("reapply migrations: %v", err)
+	}
+
+	for palletID, want := range map[int64]error{1: ErrClosed, 4: ErrClosed, 5: nil, 3: nil} {
+		if err := checkPallet(t, db, palletID); !errors.Is(err, want) {
+			t.Fatalf("pallet %d: err = %v, want %v", palletID, err, want)
+		}
+	}
+	loaded, err := Load(ctx, db, 1, wave2)
+	if err != nil {
+		t.Fatalf("load wave 2: %v", err)
+	}
+	if loaded.Pallets != 1 || loaded.IsClosed() {
+		t.Fatalf("unexpected wave 2 %+v", loaded)
+	}
+
+	var audits int
+	if err := db.R.NewRaw(`SELECT COUNT(1) FROM audit_logs WHERE action IN ('phase.start', 'phase.close')`).Scan(ctx, &audits); err != nil {
+		t.Fatalf("load audit: %v", err)
+	}
+	if audits != 2 {
+		t.Fatalf("audit entries = %d, want 2", audits)
+	}
+}
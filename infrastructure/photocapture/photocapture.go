@@ -0,0 +1,65 @@
+// Package photocapture applies a project's photo capture settings. The
+// receipt page's camera scales and compresses photos to them before upload,
+// and the server refuses photos larger than the configured maximum, which
+// also catches photos picked from the device or sent by older pages.
+package photocapture
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"receipter/infrastructure/projectsettings"
+)
+
+// ErrTooLarge is wrapped by the error returned for a photo over the limit.
+var ErrTooLarge = errors.New("photo resolution is too high")
+
+// qualities maps the photo quality setting to the JPEG quality the camera
+// uses. High matches what the camera used before it was configurable.
+var qualities = map[string]float64{
+	projectsettings.PhotoQualityHigh:   0.85,
+	projectsettings.PhotoQualityMedium: 0.7,
+	projectsettings.PhotoQualityLow:    0.55,
+}
+
+// Config is how the camera captures photos for a project.
+type Config struct {
+	// MaxDimension is the longest side in pixels; 0 means no limit.
+	MaxDimension int64
+	// Quality is the JPEG quality between 0 and 1.
+	Quality float64
+}
+
+// LoadConfig reads the capture settings from resolved project settings.
+func LoadConfig(settings projectsettings.Settings) Config {
+	quality, ok := qualities[settings.String(projectsettings.PhotoQuality)]
+	if !ok {
+		quality = qualities[projectsettings.PhotoQualityHigh]
+	}
+	return Config{
+		MaxDimension: settings.Int(projectsettings.PhotoMaxDimension),
+		Quality:      quality,
+	}
+}
+
+// Check refuses a photo whose longest side exceeds MaxDimension. Formats the
+// server cannot read, such as HEIC kept without a converter, are not
+// measured and pass.
+func (c Config) Check(data []byte) error {
+	if c.MaxDimension <= 0 {
+		return nil
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	if int64(max(cfg.Width, cfg.Height)) > c.MaxDimension {
+		return fmt.Errorf("%w: photo is %dx%d pixels, this project allows %d on the longest side", ErrTooLarge, cfg.Width, cfg.Height, c.MaxDimension)
+	}
+	return nil
+}
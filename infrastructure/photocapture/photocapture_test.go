@@ -0,0 +1,43 @@
+package photocapture
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"testing"
+
+	"receipter/infrastructure/projectsettings"
+)
+
+func pngBytes(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestLoadConfig_DefaultsKeepFullResolutionAtHighQuality(t *testing.T) {
+	config := LoadConfig(projectsettings.Defaults())
+	if config.MaxDimension != 0 || config.Quality != 0.85 {
+		t.Fatalf("default config = %+v", config)
+	}
+}
+
+func TestCheck_RefusesPhotosOverTheLongestSide(t *testing.T) {
+	config := Config{MaxDimension: 40, Quality: 0.7}
+	if err := config.Check(pngBytes(t, 40, 30)); err != nil {
+		t.Fatalf("photo at the limit refused: %v", err)
+	}
+	if err := config.Check(pngBytes(t, 20, 41)); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge for a tall photo, got %v", err)
+	}
+	if err := config.Check([]byte("not an image the server can read")); err != nil {
+		t.Fatalf("unreadable photo refused: %v", err)
+	}
+	if err := (Config{}).Check(pngBytes(t, 4000, 3000)); err != nil {
+		t.Fatalf("photo refused without a limit: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+// Package photoorphan removes photo data whose receipt line no longer
+// exists: gallery photos, staged photo uploads and their chunks. Line deletes
+// clean up after themselves, but rows written with foreign keys off, by
+// manual edits or by older code paths, can still be left behind. The sweeper
+// removes them every hour and records what each sweep reclaimed for the
+// storage dashboard.
+package photoorphan
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+// WHERE clauses matching the orphaned rows of each table.
+const (
+	orphanPhotosWhere  = `NOT EXISTS (SELECT 1 FROM pallet_receipts pr WHERE pr.id = receipt_photos.pallet_receipt_id)`
+	orphanUploadsWhere = `NOT EXISTS (SELECT 1 FROM pallet_receipts pr WHERE pr.id = photo_uploads.pallet_receipt_id)`
+	orphanChunksWhere  = `upload_id NOT IN (
+    SELECT pu.id FROM photo_uploads pu JOIN pallet_receipts pr ON pr.id = pu.pallet_receipt_id
+)`
+)
+
+// Report counts orphaned photo data and the bytes it holds.
+type Report struct {
+	Photos  int64 `bun:"photos_removed"`
+	Uploads int64 `bun:"uploads_removed"`
+	Chunks  int64 `bun:"chunks_removed"`
+	Bytes   int64 `bun:"bytes_reclaimed"`
+}
+
+// Empty reports whether nothing was found.
+func (r Report) Empty() bool {
+	return r.Photos == 0 && r.Uploads == 0 && r.Chunks == 0
+}
+
+// Run is a recorded sweep that removed orphans.
+type Run struct {
+	ID int64 `bun:"id"`
+	Report
+	SweptAt time.Time `bun:"swept_at"`
+}
+
+// Detect counts the orphaned photo data currently stored.
+func Detect(ctx context.Context, db *sqlite.DB) (Report, error) {
+	var report Report
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return detect(ctx, tx, &report)
+	})
+	return report, err
+}
+
+func detect(ctx context.Context, tx bun.Tx, report *Report) error {
+	var photoBytes, chunkBytes int64
+	if err := tx.NewRaw(`SELECT COUNT(1), COALESCE(SUM(LENGTH(photo_blob)), 0) FROM receipt_photos WHERE `+orphanPhotosWhere).Scan(ctx, &report.Photos, &photoBytes); err != nil {
+		return err
+	}
+	if err := tx.NewRaw(`SELECT COUNT(1) FROM photo_uploads WHERE `+orphanUploadsWhere).Scan(ctx, &report.Uploads); err != nil {
+		return err
+	}
+	if err := tx.NewRaw(`SELECT COUNT(1), COALESCE(SUM(LENGTH(data)), 0) FROM photo_upload_chunks WHERE `+orphanChunksWhere).Scan(ctx, &report.Chunks, &chunkBytes); err != nil {
+		return err
+	}
+	report.Bytes = photoBytes + chunkBytes
+	return nil
+}
+
+// Sweep deletes every orphaned photo, upload and chunk, records the sweep at
+// now when it removed anything, and returns what it removed.
+func Sweep(ctx context.Context, db *sqlite.DB, now time.Time) (Report, error) {
+	var report Report
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := detect(ctx, tx, &report); err != nil {
+			return err
+		}
+		if report.Empty() {
+			return nil
+		}
+		for _, stmt := range []string{
+			`DELETE FROM photo_upload_chunks WHERE ` + orphanChunksWhere,
+			`DELETE FROM photo_uploads WHERE ` + orphanUploadsWhere,
+			`DELETE FROM receipt_photos WHERE ` + orphanPhotosWhere,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO photo_orphan_sweeps (photos_removed, uploads_removed, chunks_removed, bytes_reclaimed, swept_at)
+VALUES (?, ?, ?, ?, ?)`, report.Photos, report.Uploads, report.Chunks, report.Bytes, now)
+		return err
+	})
+	return report, err
+}
+
+// ListRuns returns the latest sweeps that removed orphans, newest first, and
+// the bytes reclaimed by every recorded sweep.
+func ListRuns(ctx context.Context, db *sqlite.DB, limit int) ([]Run, int64, error) {
+	runs := make([]Run, 0)
+	var total int64
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT COALESCE(SUM(bytes_reclaimed), 0) FROM photo_orphan_sweeps`).Scan(ctx, &total); err != nil {
+			return err
+		}
+		return tx.NewRaw(`
+SELECT id, photos_removed, uploads_removed, chunks_removed, bytes_reclaimed, swept_at
+FROM photo_orphan_sweeps
+ORDER BY swept_at DESC, id DESC
+LIMIT ?`, limit).Scan(ctx, &runs)
+	})
+	return runs, total, err
+}
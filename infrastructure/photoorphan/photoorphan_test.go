@@ -0,0 +1,99 @@
+package photoorphan
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func openOrphanTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "photoorphan-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	return db
+}
+
+func TestSweepRemovesOnlyOrphansAndRecordsReclaimedBytes(t *testing.T) {
+	db := openOrphanTestDB(t)
+	ctx := context.Background()
+
+	// Line 1 is live; line 404 is gone but left its photo, an upload and
+	// the upload's chunk behind. The write pool has a single connection, so
+	// the pragmas apply to these statements.
+	for _, stmt := range []string{
+		`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin')`,
+		`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'P', 'd', '2026-01-01', 'C', 'p', 'active')`,
+		`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open')`,
+		`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty) VALUES (1, 1, 1, 'SKU-1', 'Live', 1, 1)`,
+		`INSERT INTO receipt_photos (id, pallet_receipt_id, photo_blob) VALUES (1, 1, x'0102')`,
+		`INSERT INTO photo_uploads (id, pallet_receipt_id, total_bytes, created_by_user_id) VALUES (1, 1, 2, 1)`,
+		`INSERT INTO photo_upload_chunks (upload_id, offset_bytes, data) VALUES (1, 0, x'01')`,
+		`PRAGMA foreign_keys = OFF`,
+		`INSERT INTO receipt_photos (id, pallet_receipt_id, photo_blob) VALUES (2, 404, x'010203')`,
+		`INSERT INTO photo_uploads (id, pallet_receipt_id, total_bytes, created_by_user_id) VALUES (2, 404, 4, 1)`,
+		`INSERT INTO photo_upload_chunks (upload_id, offset_bytes, data) VALUES (2, 0, x'01020304')`,
+		`PRAGMA foreign_keys = ON`,
+	} {
+		if _, err := db.W.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed %q: %v", stmt, err)
+		}
+	}
+
+	want := Report{Photos: 1, Uploads: 1, Chunks: 1, Bytes: 7}
+	found, err := Detect(ctx, db)
+	if err != nil {
+		t.Fatalf("detect: %v", err)
+	}
+	if found != want {
+		t.Fatalf("detect = %+v, want %+v", found, want)
+	}
+
+	now := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	removed, err := Sweep(ctx, db, now)
+	if err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if removed != want {
+		t.Fatalf("sweep = %+v, want %+v", removed, want)
+	}
+	if left, err := Detect(ctx, db); err != nil || !left.Empty() {
+		t.Fatalf("orphans left after sweep = %+v, %v", left, err)
+	}
+
+	var photos, uploads, chunks int
+	if err := db.R.NewRaw(`SELECT (SELECT COUNT(1) FROM receipt_photos), (SELECT COUNT(1) FROM photo_uploads), (SELECT COUNT(1) FROM photo_upload_chunks)`).Scan(ctx, &photos, &uploads, &chunks); err != nil {
+		t.Fatalf("count rows: %v", err)
+	}
+	if photos != 1 || uploads != 1 || chunks != 1 {
+		t.Fatalf("live line data removed: photos=%d uploads=%d chunks=%d", photos, uploads, chunks)
+	}
+
+	// A sweep that finds nothing is not recorded.
+	if again, err := Sweep(ctx, db, now.Add(time.Hour)); err != nil || !again.Empty() {
+		t.Fatalf("second sweep = %+v, %v", again, err)
+	}
+	runs, total, err := ListRuns(ctx, db, 10)
+	if err != nil {
+		t.Fatalf("list runs: %v", err)
+	}
+	if len(runs) != 1 || runs[0].Report != want || !runs[0].SweptAt.Equal(now) || total != 7 {
+		t.Fatalf("runs = %+v, total %d", runs, total)
+	}
+}
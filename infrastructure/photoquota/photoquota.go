@@ -0,0 +1,165 @@
+// Package photoquota applies a project's photo limits: how many photos one
+// receipt line may hold, and how much photo storage the whole project may
+// use. Uploads past either limit are refused, and admins are notified once
+// when a project's storage reaches AlertPercent of its quota.
+package photoquota
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/notification"
+	"receipter/infrastructure/projectsettings"
+)
+
+// AlertPercent is the share of the storage quota at which admins are told.
+const AlertPercent = 80
+
+// ErrExceeded is wrapped by the error returned for photos over a limit.
+var ErrExceeded = errors.New("photo quota exceeded")
+
+// Config is a project's photo limits.
+type Config struct {
+	// MaxPerLine is the most photos one receipt line may hold; 0 means no
+	// limit.
+	MaxPerLine int64
+	// QuotaBytes is the photo storage the project may use; 0 means no limit.
+	QuotaBytes int64
+}
+
+// LoadConfig reads the photo limits from resolved project settings.
+func LoadConfig(settings projectsettings.Settings) Config {
+	return Config{
+		MaxPerLine: settings.Int(projectsettings.PhotoMaxPerLine),
+		QuotaBytes: settings.Int(projectsettings.PhotoQuotaMB) << 20,
+	}
+}
+
+// Usage is the photo storage a project uses: its stored photos, and uploads
+// reserved but not yet stored at their declared size. Photos in cold storage
+// are not counted.
+type Usage struct {
+	Photos int64
+	Bytes  int64
+}
+
+// Percent is the share of quotaBytes used, or 0 when there is no quota.
+func (u Usage) Percent(quotaBytes int64) int64 {
+	if quotaBytes <= 0 {
+		return 0
+	}
+	return u.Bytes * 100 / quotaBytes
+}
+
+// UsageTx totals a project's photo storage.
+func UsageTx(ctx context.Context, tx bun.IDB, projectID int64) (Usage, error) {
+	var usage Usage
+	err := tx.NewRaw(`
+WITH photo_bytes AS (
+    SELECT LENGTH(rp.photo_blob) AS bytes
+    FROM receipt_photos rp
+    JOIN pallet_receipts pr ON pr.id = rp.pallet_receipt_id
+    WHERE pr.project_id = ? AND LENGTH(rp.photo_blob) > 0
+    UNION ALL
+    SELECT LENGTH(stock_photo_blob) AS bytes
+    FROM pallet_receipts
+    WHERE project_id = ? AND LENGTH(stock_photo_blob) > 0
+    UNION ALL
+    SELECT pu.total_bytes AS bytes
+    FROM photo_uploads pu
+    JOIN pallet_receipts pr ON pr.id = pu.pallet_receipt_id
+    WHERE pr.project_id = ? AND pu.status IN ('uploading', 'queued', 'processing')
+)
+SELECT COUNT(1), COALESCE(SUM(bytes), 0) FROM photo_bytes`, projectID, projectID, projectID).Scan(ctx, &usage.Photos, &usage.Bytes)
+	return usage, err
+}
+
+// lineCountTx counts a receipt line's photos: its primary photo, its gallery
+// photos and its uploads still in flight.
+func lineCountTx(ctx context.Context, tx bun.IDB, receiptID int64) (int64, error) {
+	var count int64
+	err := tx.NewRaw(`
+SELECT
+    (SELECT COUNT(1) FROM pallet_receipts WHERE id = ? AND LENGTH(stock_photo_blob) > 0)
+  + (SELECT COUNT(1) FROM receipt_photos WHERE pallet_receipt_id = ?)
+  + (SELECT COUNT(1) FROM photo_uploads WHERE pallet_receipt_id = ? AND status IN ('uploading', 'queued', 'processing'))`,
+		receiptID, receiptID, receiptID).Scan(ctx, &count)
+	return count, err
+}
+
+// CheckTx refuses adding photos totalling bytes to a receipt line of the
+// project. Pass 0 for receiptID when the line is not saved yet, and zero
+// photos and bytes to check photos already written in the transaction.
+func (c Config) CheckTx(ctx context.Context, tx bun.IDB, projectID, receiptID, photos, bytes int64) error {
+	if c.MaxPerLine > 0 {
+		count := photos
+		if receiptID > 0 {
+			existing, err := lineCountTx(ctx, tx, receiptID)
+			if err != nil {
+				return err
+			}
+			count += existing
+		}
+		if count > c.MaxPerLine {
+			return fmt.Errorf("%w: this project allows %d photos per line", ErrExceeded, c.MaxPerLine)
+		}
+	}
+	if c.QuotaBytes > 0 {
+		usage, err := UsageTx(ctx, tx, projectID)
+		if err != nil {
+			return err
+		}
+		if usage.Bytes+bytes > c.QuotaBytes {
+			return fmt.Errorf("%w: this project's photo storage is full (%d MB of %d MB used); ask an admin to raise the quota", ErrExceeded, (usage.Bytes+bytes)>>20, c.QuotaBytes>>20)
+		}
+	}
+	return nil
+}
+
+// AlertTx notifies admins the first time a project's storage reaches
+// AlertPercent of its quota. The alert is kept per quota, so raising the
+// quota or freeing space below the threshold lets it fire again.
+func (c Config) AlertTx(ctx context.Context, tx bun.IDB, projectID int64, now time.Time) error {
+	if c.QuotaBytes <= 0 {
+		return nil
+	}
+	usage, err := UsageTx(ctx, tx, projectID)
+	if err != nil {
+		return err
+	}
+	var alertedQuota int64
+	err = tx.NewRaw(`SELECT quota_bytes FROM photo_quota_alerts WHERE project_id = ?`, projectID).Scan(ctx, &alertedQuota)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	alerted := err == nil
+	if usage.Percent(c.QuotaBytes) < AlertPercent {
+		if alerted {
+			_, err := tx.ExecContext(ctx, `DELETE FROM photo_quota_alerts WHERE project_id = ?`, projectID)
+			return err
+		}
+		return nil
+	}
+	if alerted && alertedQuota == c.QuotaBytes {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO photo_quota_alerts (project_id, quota_bytes, usage_bytes, alerted_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (project_id) DO UPDATE SET quota_bytes = excluded.quota_bytes, usage_bytes = excluded.usage_bytes, alerted_at = excluded.alerted_at`,
+		projectID, c.QuotaBytes, usage.Bytes, now); err != nil {
+		return err
+	}
+	return notification.Add(ctx, tx, notification.Notification{
+		Kind:      notification.KindPhotoQuota,
+		ProjectID: projectID,
+		Title:     fmt.Sprintf("Photo storage at %d%% of quota", usage.Percent(c.QuotaBytes)),
+		Body:      fmt.Sprintf("%d MB of %d MB used. New photos are refused once the quota is reached.", usage.Bytes>>20, c.QuotaBytes>>20),
+		Link:      "/tasker/admin/storage",
+	})
+}
@@ -0,0 +1,158 @@
+package photoquota
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func openPhotoQuotaTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "photoquota-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	execAll(t, db,
+		`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'Inbound', 'one', DATE('now'), 'Client', 'inbound', 'active')`,
+		`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'scanner1', 'hash', 'scanner')`,
+		`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open')`,
+		`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, stock_photo_blob) VALUES
+			(10, 1, 1, 'SKU1', 'Item 1', 1, 4, zeroblob(1048576)),
+			(11, 1, 1, 'SKU2', 'Item 2', 1, 1, NULL)`,
+		`INSERT INTO receipt_photos (id, pallet_receipt_id, photo_blob) VALUES (100, 10, zeroblob(2097152))`,
+		`INSERT INTO photo_uploads (pallet_receipt_id, total_bytes, status, created_by_user_id) VALUES
+			(10, 1048576, 'uploading', 1),
+			(10, 4194304, 'failed', 1)`,
+	)
+	return db
+}
+
+func execAll(t *testing.T, db *sqlite.DB, stmts ...string) {
+	t.Helper()
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+}
+
+func check(t *testing.T, db *sqlite.DB, c Config, receiptID, photos, bytes int64) error {
+	t.Helper()
+	return db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return c.CheckTx(ctx, tx, 1, receiptID, photos, bytes)
+	})
+}
+
+func countNotifications(t *testing.T, db *sqlite.DB) int64 {
+	t.Helper()
+	var n int64
+	if err := db.R.NewRaw(`SELECT COUNT(*) FROM notifications WHERE kind = ?`, "photo_quota").Scan(context.Background(), &n); err != nil {
+		t.Fatalf("count notifications: %v", err)
+	}
+	return n
+}
+
+func TestUsageCountsStoredPhotosAndUploadsInFlight(t *testing.T) {
+	db := openPhotoQuotaTestDB(t)
+	var usage Usage
+	err := db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		usage, err = UsageTx(ctx, tx, 1)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("usage: %v", err)
+	}
+	if usage.Photos != 3 || usage.Bytes != 4<<20 {
+		t.Fatalf("expected 3 photos using 4MB, got %+v", usage)
+	}
+	if got := usage.Percent(5 << 20); got != 80 {
+		t.Fatalf("expected 80%% of a 5MB quota, got %d", got)
+	}
+}
+
+func TestCheckRefusesPhotosPastEitherLimit(t *testing.T) {
+	db := openPhotoQuotaTestDB(t)
+
+	if err := check(t, db, Config{}, 10, 50, 1<<30); err != nil {
+		t.Fatalf("expected no limits, got %v", err)
+	}
+	perLine := Config{MaxPerLine: 3}
+	if err := check(t, db, perLine, 10, 0, 0); err != nil {
+		t.Fatalf("expected line at its limit to pass, got %v", err)
+	}
+	if err := check(t, db, perLine, 10, 1, 0); !errors.Is(err, ErrExceeded) {
+		t.Fatalf("expected a fourth photo refused, got %v", err)
+	}
+	if err := check(t, db, perLine, 11, 3, 0); err != nil {
+		t.Fatalf("expected an empty line to take three photos, got %v", err)
+	}
+
+	quota := Config{QuotaBytes: 5 << 20}
+	if err := check(t, db, quota, 11, 1, 1<<20); err != nil {
+		t.Fatalf("expected the quota to be reachable, got %v", err)
+	}
+	if err := check(t, db, quota, 11, 1, 1<<20+1); !errors.Is(err, ErrExceeded) {
+		t.Fatalf("expected a photo past the quota refused, got %v", err)
+	}
+}
+
+func TestAlertFiresOncePerQuota(t *testing.T) {
+	db := openPhotoQuotaTestDB(t)
+	ctx := context.Background()
+	alert := func(c Config) {
+		t.Helper()
+		err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+			return c.AlertTx(ctx, tx, 1, time.Now().UTC())
+		})
+		if err != nil {
+			t.Fatalf("alert: %v", err)
+		}
+	}
+
+	alert(Config{QuotaBytes: 10 << 20})
+	if n := countNotifications(t, db); n != 0 {
+		t.Fatalf("expected no alert at 40%%, got %d", n)
+	}
+	alert(Config{QuotaBytes: 5 << 20})
+	alert(Config{QuotaBytes: 5 << 20})
+	if n := countNotifications(t, db); n != 1 {
+		t.Fatalf("expected one alert at 80%%, got %d", n)
+	}
+	alert(Config{QuotaBytes: 4 << 20})
+	if n := countNotifications(t, db); n != 2 {
+		t.Fatalf("expected a lowered quota to alert again, got %d", n)
+	}
+
+	execAll(t, db, `DELETE FROM receipt_photos WHERE id = 100`)
+	alert(Config{QuotaBytes: 4 << 20})
+	execAll(t, db, `INSERT INTO receipt_photos (id, pallet_receipt_id, photo_blob) VALUES (101, 10, zeroblob(2097152))`)
+	alert(Config{QuotaBytes: 4 << 20})
+	if n := countNotifications(t, db); n != 3 {
+		t.Fatalf("expected the alert to re-arm once usage fell below the threshold, got %d", n)
+	}
+}
@@ -0,0 +1,340 @@
+// Package photoretention removes receipt photos that may show people: by
+// hand, when an admin blurs or deletes a single photo, and automatically,
+// when a photo outlives its project's photos.retention_days setting. Every
+// removal leaves a stub in photo_redactions recording where the photo was,
+// who removed it and why.
+package photoretention
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/sqlite"
+)
+
+// Photo sources: gallery photos in receipt_photos, and the single primary
+// stock photo stored on the receipt line itself.
+const (
+	SourceGallery = "receipt_photos"
+	SourcePrimary = "pallet_receipts"
+)
+
+// Redaction actions recorded on a stub.
+const (
+	ActionBlurred = "blurred"
+	ActionDeleted = "deleted"
+	ActionExpired = "expired"
+)
+
+const (
+	// pixelBlocks is the number of blocks across the longest side of a
+	// blurred photo; faces are unrecognisable at this size.
+	pixelBlocks    = 16
+	blurredQuality = 70
+)
+
+var (
+	ErrNotFound      = errors.New("photo not found")
+	ErrInvalidAction = errors.New("redaction must be blur or delete")
+	ErrCannotBlur    = errors.New("this photo cannot be blurred; delete it instead")
+)
+
+// Ref identifies one stored photo. For SourcePrimary, ID is the receipt
+// line's id.
+type Ref struct {
+	Source string
+	ID     int64
+}
+
+type photoRow struct {
+	ProjectID int64  `bun:"project_id"`
+	PalletID  int64  `bun:"pallet_id"`
+	ReceiptID int64  `bun:"receipt_id"`
+	PhotoID   int64  `bun:"photo_id"`
+	Name      string `bun:"name"`
+	CreatedAt string `bun:"created_at"`
+}
+
+// photoRowsSQL lists every stored photo with its owner and age, as a
+// subquery aliased ph.
+const photoRowsSQL = `(
+    SELECT 'receipt_photos' AS source, pr.project_id, pr.pallet_id, pr.id AS receipt_id, rp.id AS photo_id,
+           rp.photo_name AS name, rp.created_at
+    FROM receipt_photos rp
+    JOIN pallet_receipts pr ON pr.id = rp.pallet_receipt_id
+    UNION ALL
+    SELECT 'pallet_receipts' AS source, project_id, pallet_id, id AS receipt_id, id AS photo_id,
+           COALESCE(stock_photo_name, 'photo.jpg') AS name, created_at
+    FROM pallet_receipts
+    WHERE stock_photo_blob IS NOT NULL
+) ph`
+
+// Redact blurs or deletes one photo and records a stub and an audit entry.
+// action is ActionBlurred or ActionDeleted.
+func Redact(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID int64, ref Ref, action, note string) error {
+	if action != ActionBlurred && action != ActionDeleted {
+		return ErrInvalidAction
+	}
+	if ref.Source != SourceGallery && ref.Source != SourcePrimary {
+		return ErrNotFound
+	}
+	note = strings.TrimSpace(note)
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var row photoRow
+		err := tx.NewRaw(`SELECT project_id, pallet_id, receipt_id, photo_id, name, created_at FROM `+photoRowsSQL+`
+WHERE ph.source = ? AND ph.photo_id = ?`, ref.Source, ref.ID).Scan(ctx, &row)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if action == ActionBlurred {
+			var blob []byte
+			if err := tx.NewRaw(blobSelectSQL(ref.Source), ref.ID).Scan(ctx, &blob); err != nil {
+				return err
+			}
+			blurred, ok := pixelate(blob)
+			if !ok {
+				return ErrCannotBlur
+			}
+			if _, err := tx.ExecContext(ctx, blobUpdateSQL(ref.Source), blurred, ref.ID); err != nil {
+				return err
+			}
+		} else if err := deletePhoto(ctx, tx, ref); err != nil {
+			return err
+		}
+
+		if err := insertStub(ctx, tx, ref.Source, row, action, note, &userID); err != nil {
+			return err
+		}
+		if auditSvc == nil {
+			return nil
+		}
+		return auditSvc.Write(ctx, tx, userID, "photo."+action, ref.Source, strconv.FormatInt(ref.ID, 10), nil, map[string]any{
+			"project_id":        row.ProjectID,
+			"pallet_id":         row.PalletID,
+			"pallet_receipt_id": row.ReceiptID,
+			"photo_name":        row.Name,
+			"note":              note,
+		})
+	})
+}
+
+// SweepExpired deletes every photo older than its project's retention period
+// at now and returns how many were removed.
+func SweepExpired(ctx context.Context, db *sqlite.DB, now time.Time) (int, error) {
+	removed := 0
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		projectIDs := make([]int64, 0)
+		if err := tx.NewRaw(`SELECT id FROM projects ORDER BY id`).Scan(ctx, &projectIDs); err != nil {
+			return err
+		}
+		for _, projectID := range projectIDs {
+			settings, err := projectsettings.LoadTx(ctx, tx, projectID)
+			if err != nil {
+				return err
+			}
+			days := settings.Int(projectsettings.PhotoRetentionDays)
+			if days <= 0 {
+				continue
+			}
+			rows := make([]struct {
+				Source string `bun:"source"`
+				photoRow
+			}, 0)
+			if err := tx.NewRaw(`SELECT ph.source, project_id, pallet_id, receipt_id, photo_id, name, created_at FROM `+photoRowsSQL+`
+WHERE ph.project_id = ? AND julianday(ph.created_at) <= julianday(?) - ?
+ORDER BY ph.source, ph.photo_id`, projectID, now, days).Scan(ctx, &rows); err != nil {
+				return err
+			}
+			for _, row := range rows {
+				if err := deletePhoto(ctx, tx, Ref{Source: row.Source, ID: row.PhotoID}); err != nil {
+					return err
+				}
+				if err := insertStub(ctx, tx, row.Source, row.photoRow, ActionExpired, fmt.Sprintf("retention period of %d days", days), nil); err != nil {
+					return err
+				}
+				removed++
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// Upcoming is a project's photos due for retention deletion soon.
+type Upcoming struct {
+	ProjectID     int64  `bun:"project_id"`
+	ProjectName   string `bun:"project_name"`
+	RetentionDays int64  `bun:"-"`
+	// DueWeek and DueMonth count photos deleted within 7 and 30 days.
+	DueWeek  int64 `bun:"due_week"`
+	DueMonth int64 `bun:"due_month"`
+	// NextDue is the date the oldest photo is deleted, or "" without photos.
+	NextDue string `bun:"next_due"`
+}
+
+// LoadUpcoming reports, for every project with a retention period, how many
+// photos the sweeper will delete over the next week and month from now.
+func LoadUpcoming(ctx context.Context, db *sqlite.DB, now time.Time) ([]Upcoming, error) {
+	upcoming := make([]Upcoming, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		projects := make([]struct {
+			ID   int64  `bun:"id"`
+			Name string `bun:"name"`
+		}, 0)
+		if err := tx.NewRaw(`SELECT id, name FROM projects ORDER BY name COLLATE NOCASE`).Scan(ctx, &projects); err != nil {
+			return err
+		}
+		for _, project := range projects {
+			settings, err := projectsettings.LoadTx(ctx, tx, project.ID)
+			if err != nil {
+				return err
+			}
+			days := settings.Int(projectsettings.PhotoRetentionDays)
+			if days <= 0 {
+				continue
+			}
+			u := Upcoming{ProjectID: project.ID, ProjectName: project.Name, RetentionDays: days}
+			if err := tx.NewRaw(`
+SELECT COALESCE(SUM(CASE WHEN julianday(ph.created_at) + ? <= julianday(?) + 7 THEN 1 ELSE 0 END), 0) AS due_week,
+       COALESCE(SUM(CASE WHEN julianday(ph.created_at) + ? <= julianday(?) + 30 THEN 1 ELSE 0 END), 0) AS due_month,
+       COALESCE(strftime('%d/%m/%Y', MIN(julianday(ph.created_at)) + ?), '') AS next_due
+FROM `+photoRowsSQL+`
+WHERE ph.project_id = ?`, days, now, days, now, days, project.ID).Scan(ctx, &u.DueWeek, &u.DueMonth, &u.NextDue); err != nil {
+				return err
+			}
+			upcoming = append(upcoming, u)
+		}
+		return nil
+	})
+	return upcoming, err
+}
+
+// Stub is a recorded redaction.
+type Stub struct {
+	ID              int64  `bun:"id"`
+	ProjectName     string `bun:"project_name"`
+	PalletID        int64  `bun:"pallet_id"`
+	PalletReceiptID int64  `bun:"pallet_receipt_id"`
+	PhotoName       string `bun:"photo_name"`
+	Action          string `bun:"action"`
+	Note            string `bun:"note"`
+	Username        string `bun:"username"`
+	CreatedAt       string `bun:"created_at"`
+}
+
+// ListStubs returns the latest redaction stubs, optionally for one receipt
+// line only (receiptID > 0).
+func ListStubs(ctx context.Context, db *sqlite.DB, receiptID int64, limit int) ([]Stub, error) {
+	stubs := make([]Stub, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT r.id, COALESCE(p.name, '') AS project_name, r.pallet_id, r.pallet_receipt_id, r.photo_name,
+       r.action, r.note, COALESCE(u.username, '') AS username,
+       strftime('%d/%m/%Y %H:%M', r.created_at) AS created_at
+FROM photo_redactions r
+LEFT JOIN projects p ON p.id = r.project_id
+LEFT JOIN users u ON u.id = r.user_id
+WHERE ? = 0 OR r.pallet_receipt_id = ?
+ORDER BY r.id DESC
+LIMIT ?`, receiptID, receiptID, limit).Scan(ctx, &stubs)
+	})
+	return stubs, err
+}
+
+func insertStub(ctx context.Context, tx bun.Tx, source string, row photoRow, action, note string, userID *int64) error {
+	_, err := tx.ExecContext(ctx, `
+INSERT INTO photo_redactions (project_id, pallet_id, pallet_receipt_id, source, photo_id, photo_name, photo_created_at, action, note, user_id)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		row.ProjectID, row.PalletID, row.ReceiptID, source, row.PhotoID, row.Name, row.CreatedAt, action, note, userID)
+	return err
+}
+
+func deletePhoto(ctx context.Context, tx bun.Tx, ref Ref) error {
+	if ref.Source == SourcePrimary {
+		_, err := tx.ExecContext(ctx, `UPDATE pallet_receipts SET stock_photo_blob = NULL, stock_photo_mime = NULL, stock_photo_name = NULL WHERE id = ?`, ref.ID)
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `DELETE FROM receipt_photos WHERE id = ?`, ref.ID)
+	return err
+}
+
+func blobSelectSQL(source string) string {
+	if source == SourcePrimary {
+		return `SELECT stock_photo_blob FROM pallet_receipts WHERE id = ?`
+	}
+	return `SELECT photo_blob FROM receipt_photos WHERE id = ?`
+}
+
+func blobUpdateSQL(source string) string {
+	if source == SourcePrimary {
+		return `UPDATE pallet_receipts SET stock_photo_blob = ?, stock_photo_mime = 'image/jpeg' WHERE id = ?`
+	}
+	return `UPDATE receipt_photos SET photo_blob = ?, photo_mime = 'image/jpeg' WHERE id = ?`
+}
+
+// pixelate replaces a JPEG or PNG with a coarse mosaic of itself at the same
+// size, encoded as JPEG.
+func pixelate(blob []byte) ([]byte, bool) {
+	switch http.DetectContentType(blob) {
+	case "image/jpeg", "image/png":
+	default:
+		return nil, false
+	}
+	src, _, err := image.Decode(bytes.NewReader(blob))
+	if err != nil {
+		return nil, false
+	}
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(img, img.Bounds(), src, bounds.Min, draw.Over)
+
+	block := max(max(w, h)/pixelBlocks, 1)
+	for by := 0; by < h; by += block {
+		for bx := 0; bx < w; bx += block {
+			x1, y1 := min(bx+block, w), min(by+block, h)
+			var r, g, b, n int
+			for y := by; y < y1; y++ {
+				for x := bx; x < x1; x++ {
+					p := img.Pix[y*img.Stride+x*4:]
+					r += int(p[0])
+					g += int(p[1])
+					b += int(p[2])
+					n++
+				}
+			}
+			for y := by; y < y1; y++ {
+				for x := bx; x < x1; x++ {
+					p := img.Pix[y*img.Stride+x*4:]
+					p[0], p[1], p[2], p[3] = uint8(r/n), uint8(g/n), uint8(b/n), 255
+				}
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, img, &jpeg.Options{Quality: blurredQuality}); err != nil {
+		return nil, false
+	}
+	return out.Bytes(), true
+}
@@ -0,0 +1,232 @@
+package photoretention
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+func openRetentionTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "photoretention-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+
+	// A checkerboard, so blurring visibly changes it.
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			if (x+y)%2 == 0 {
+				img.Set(x, y, color.Black)
+			} else {
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+	var photo bytes.Buffer
+	if err := png.Encode(&photo, img); err != nil {
+		t.Fatalf("encode photo: %v", err)
+	}
+
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'hash', 'admin')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+			 (1, 'Kept 30 Days', 'd', '2026-02-01', 'Acme', 'kept', 'active'),
+			 (2, 'Kept Forever', 'd', '2026-02-01', 'Acme', 'forever', 'active')`,
+			`INSERT INTO project_settings (project_id, key, value) VALUES (1, 'photos.retention_days', '30')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open'), (2, 2, 'open')`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, stock_photo_blob, stock_photo_mime, stock_photo_name, created_at) VALUES
+ (10, 1, 1, 'SKU-A', 'A', 1, 1, ?, 'image/png', 'primary.png', '2026-01-01 08:00:00'),
+ (11, 1, 1, 'SKU-B', 'B', 1, 1, NULL, NULL, NULL, '2026-03-01 08:00:00'),
+ (20, 2, 2, 'SKU-C', 'C', 1, 1, ?, 'image/png', 'old.png', '2025-01-01 08:00:00')`, photo.Bytes(), photo.Bytes()); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO receipt_photos (id, pallet_receipt_id, photo_blob, photo_mime, photo_name, created_at) VALUES
+ (100, 11, ?, 'image/png', 'gallery-1.png', '2026-03-01 08:00:00'),
+ (101, 11, ?, 'image/png', 'gallery-2.png', '2026-03-20 08:00:00')`, photo.Bytes(), photo.Bytes())
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return db
+}
+
+func TestRedact_BlurReplacesPhotoAndDeleteRemovesIt(t *testing.T) {
+	db := openRetentionTestDB(t)
+	ctx := context.Background()
+	auditSvc := audit.NewService()
+
+	if err := Redact(ctx, db, auditSvc, 1, Ref{Source: SourceGallery, ID: 100}, ActionBlurred, " face in frame "); err != nil {
+		t.Fatalf("blur: %v", err)
+	}
+	if err := Redact(ctx, db, auditSvc, 1, Ref{Source: SourcePrimary, ID: 10}, ActionDeleted, ""); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := Redact(ctx, db, auditSvc, 1, Ref{Source: SourceGallery, ID: 999}, ActionDeleted, ""); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing photo err = %v, want ErrNotFound", err)
+	}
+	if err := Redact(ctx, db, auditSvc, 1, Ref{Source: SourceGallery, ID: 101}, "crop", ""); !errors.Is(err, ErrInvalidAction) {
+		t.Fatalf("bad action err = %v, want ErrInvalidAction", err)
+	}
+
+	var mime string
+	var blob []byte
+	var primaryCount, auditCount int
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT photo_mime, photo_blob FROM receipt_photos WHERE id = 100`).Scan(ctx, &mime, &blob); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`SELECT COUNT(1) FROM pallet_receipts WHERE id = 10 AND stock_photo_blob IS NOT NULL`).Scan(ctx, &primaryCount); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT COUNT(1) FROM audit_logs WHERE action IN ('photo.blurred', 'photo.deleted')`).Scan(ctx, &auditCount)
+	})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if mime != "image/jpeg" {
+		t.Fatalf("blurred mime = %q, want image/jpeg", mime)
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(blob))
+	if err != nil {
+		t.Fatalf("decode blurred photo: %v", err)
+	}
+	// Neighbouring pixels fall in the same block once blurred.
+	r0, g0, b0, _ := decoded.At(0, 0).RGBA()
+	r1, g1, b1, _ := decoded.At(1, 0).RGBA()
+	if absDiff(r0, r1) > 0x1000 || absDiff(g0, g1) > 0x1000 || absDiff(b0, b1) > 0x1000 {
+		t.Fatalf("blurred photo still has the checkerboard: %v vs %v", decoded.At(0, 0), decoded.At(1, 0))
+	}
+	if primaryCount != 0 {
+		t.Fatalf("primary photo still stored")
+	}
+	if auditCount != 2 {
+		t.Fatalf("audit entries = %d, want 2", auditCount)
+	}
+
+	stubs, err := ListStubs(ctx, db, 0, 10)
+	if err != nil {
+		t.Fatalf("list stubs: %v", err)
+	}
+	if len(stubs) != 2 {
+		t.Fatalf("stubs = %d, want 2", len(stubs))
+	}
+	if stubs[1].Action != ActionBlurred || stubs[1].PhotoName != "gallery-1.png" || stubs[1].Note != "face in frame" || stubs[1].Username != "admin" {
+		t.Fatalf("blur stub = %+v", stubs[1])
+	}
+	if stubs[0].Action != ActionDeleted || stubs[0].PalletReceiptID != 10 {
+		t.Fatalf("delete stub = %+v", stubs[0])
+	}
+	lineStubs, err := ListStubs(ctx, db, 11, 10)
+	if err != nil {
+		t.Fatalf("list line stubs: %v", err)
+	}
+	if len(lineStubs) != 1 {
+		t.Fatalf("line stubs = %d, want 1", len(lineStubs))
+	}
+}
+
+func TestSweepExpired_DeletesOnlyPhotosPastProjectRetention(t *testing.T) {
+	db := openRetentionTestDB(t)
+	ctx := context.Background()
+	now := time.Date(2026, 4, 10, 12, 0, 0, 0, time.UTC)
+
+	removed, err := SweepExpired(ctx, db, now)
+	if err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	// Project 1 keeps 30 days: the January primary photo and the 1 March
+	// gallery photo go, the 20 March one stays. Project 2 keeps everything.
+	if removed != 2 {
+		t.Fatalf("removed = %d, want 2", removed)
+	}
+	var gallery []int64
+	var primaries []int64
+	err = db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT id FROM receipt_photos ORDER BY id`).Scan(ctx, &gallery); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT id FROM pallet_receipts WHERE stock_photo_blob IS NOT NULL ORDER BY id`).Scan(ctx, &primaries)
+	})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(gallery) != 1 || gallery[0] != 101 {
+		t.Fatalf("gallery photos left = %v, want [101]", gallery)
+	}
+	if len(primaries) != 1 || primaries[0] != 20 {
+		t.Fatalf("primary photos left = %v, want [20]", primaries)
+	}
+
+	stubs, err := ListStubs(ctx, db, 0, 10)
+	if err != nil {
+		t.Fatalf("list stubs: %v", err)
+	}
+	for _, stub := range stubs {
+		if stub.Action != ActionExpired || stub.Username != "" || stub.Note != "retention period of 30 days" {
+			t.Fatalf("expired stub = %+v", stub)
+		}
+	}
+
+	if removed, err := SweepExpired(ctx, db, now); err != nil || removed != 0 {
+		t.Fatalf("second sweep = %d, %v; want 0", removed, err)
+	}
+}
+
+func TestLoadUpcoming_CountsPhotosDueWithinWeekAndMonth(t *testing.T) {
+	db := openRetentionTestDB(t)
+	now := time.Date(2026, 3, 28, 12, 0, 0, 0, time.UTC)
+
+	upcoming, err := LoadUpcoming(context.Background(), db, now)
+	if err != nil {
+		t.Fatalf("load upcoming: %v", err)
+	}
+	if len(upcoming) != 1 {
+		t.Fatalf("upcoming = %+v, want project 1 only", upcoming)
+	}
+	got := upcoming[0]
+	// Due dates: primary 31/01 (overdue), gallery 31/03 and 19/04.
+	if got.ProjectID != 1 || got.RetentionDays != 30 || got.DueWeek != 2 || got.DueMonth != 3 || got.NextDue != "31/01/2026" {
+		t.Fatalf("upcoming = %+v", got)
+	}
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
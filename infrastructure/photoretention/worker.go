@@ -0,0 +1,74 @@
+package photoretention
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"receipter/infrastructure/sqlite"
+)
+
+const sweepInterval = time.Hour
+
+// Sweeper deletes expired photos every hour.
+type Sweeper struct {
+	db *sqlite.DB
+
+	// Paused, when set before Start, skips sweeps while it returns true.
+	Paused func() bool
+
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	started atomic.Bool
+}
+
+func NewSweeper(db *sqlite.DB) *Sweeper {
+	return &Sweeper{
+		db:   db,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// Start sweeps expired photos until Stop.
+func (s *Sweeper) Start() {
+	s.started.Store(true)
+	go func() {
+		defer close(s.done)
+		ctx := context.Background()
+		ticker := time.NewTicker(sweepInterval)
+		defer ticker.Stop()
+		for {
+			if s.Paused == nil || !s.Paused() {
+				removed, err := SweepExpired(ctx, s.db, time.Now().UTC())
+				if err != nil {
+					slog.Error("photo retention: sweep failed", slog.Any("err", err))
+				} else if removed > 0 {
+					slog.Info("photo retention: expired photos deleted", slog.Int("count", removed))
+				}
+			}
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends a started sweeper and waits for a running sweep to finish.
+func (s *Sweeper) Stop() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	if !s.started.Load() {
+		return
+	}
+	select {
+	case <-s.done:
+	case <-time.After(5 * time.Second):
+	}
+}
@@ -0,0 +1,176 @@
+// Package photoupload accepts receipt photos after their line has been saved.
+// Uploads are reserved alongside the receipt, filled in resumable chunks, and
+// moved into receipt_photos by a background Worker once complete.
+package photoupload
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+const (
+	StatusUploading  = "uploading"
+	StatusQueued     = "queued"
+	StatusProcessing = "processing"
+	StatusDone       = "done"
+	StatusFailed     = "failed"
+
+	// MaxPhotoBytes matches the limit for photos posted with the receipt form.
+	MaxPhotoBytes = 5 << 20
+	// MaxChunkBytes keeps each request short enough to survive flaky Wi-Fi.
+	MaxChunkBytes = 1 << 20
+)
+
+var (
+	ErrNotFound       = errors.New("photo upload not found")
+	ErrPhotoTooLarge  = errors.New("each photo must be 5MB or less")
+	ErrNotImage       = errors.New("photos must be image files")
+	ErrEmptyChunk     = errors.New("chunk must not be empty")
+	ErrChunkTooLarge  = errors.New("chunk must be 1MB or less")
+	ErrOffsetMismatch = errors.New("chunk offset does not match bytes received")
+	ErrNotUploading   = errors.New("photo upload is no longer accepting chunks")
+)
+
+// Pending describes a photo the client will upload after the receipt is saved.
+type Pending struct {
+	FileName string
+	MIMEType string
+	Size     int64
+	// Internal holds the photo back from client users once it is stored.
+	Internal bool
+}
+
+// Validate normalises the declared name and type and checks the size.
+func (p *Pending) Validate() error {
+	if p.Size <= 0 || p.Size > MaxPhotoBytes {
+		return ErrPhotoTooLarge
+	}
+	p.MIMEType = strings.ToLower(strings.TrimSpace(p.MIMEType))
+	// Browsers send HEIC photos with no type or as octet-stream. The worker
+	// sniffs the bytes, so only an explicitly non-image type is refused here.
+	if p.MIMEType == "" || p.MIMEType == "application/octet-stream" {
+		p.MIMEType = "image/jpeg"
+	}
+	if !strings.HasPrefix(p.MIMEType, "image/") {
+		return ErrNotImage
+	}
+	p.FileName = filepath.Base(strings.TrimSpace(p.FileName))
+	if p.FileName == "" || p.FileName == "." || p.FileName == "/" {
+		p.FileName = "photo.jpg"
+	}
+	return nil
+}
+
+// IsPending reports whether an upload still counts as "photos pending".
+func IsPending(status string) bool {
+	return status == StatusUploading || status == StatusQueued || status == StatusProcessing
+}
+
+// Reserve records uploads for a receipt line inside the caller's transaction
+// so the line is marked as having photos pending as soon as it is saved.
+func Reserve(ctx context.Context, tx bun.Tx, receiptID, userID int64, photos []Pending) ([]models.PhotoUpload, error) {
+	uploads := make([]models.PhotoUpload, 0, len(photos))
+	for _, p := range photos {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+		now := time.Now().UTC()
+		upload := models.PhotoUpload{
+			PalletReceiptID: receiptID,
+			FileName:        p.FileName,
+			MIMEType:        p.MIMEType,
+			TotalBytes:      p.Size,
+			Internal:        p.Internal,
+			Status:          StatusUploading,
+			CreatedByUserID: userID,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		}
+		if _, err := tx.NewInsert().Model(&upload).Exec(ctx); err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, nil
+}
+
+// Load returns an upload, checking it belongs to the given pallet and receipt line.
+func Load(ctx context.Context, db *sqlite.DB, palletID, receiptID, uploadID int64) (models.PhotoUpload, error) {
+	var upload models.PhotoUpload
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		upload, err = loadTx(ctx, tx, palletID, receiptID, uploadID)
+		return err
+	})
+	return upload, err
+}
+
+func loadTx(ctx context.Context, tx bun.Tx, palletID, receiptID, uploadID int64) (models.PhotoUpload, error) {
+	var upload models.PhotoUpload
+	err := tx.NewSelect().
+		Model(&upload).
+		Join("JOIN pallet_receipts AS pr ON pr.id = pu.pallet_receipt_id").
+		Where("pu.id = ?", uploadID).
+		Where("pu.pallet_receipt_id = ?", receiptID).
+		Where("pr.pallet_id = ?", palletID).
+		Limit(1).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return upload, ErrNotFound
+	}
+	return upload, err
+}
+
+// AppendChunk stores the next chunk of an upload. offset must equal the bytes
+// received so far; on ErrOffsetMismatch or ErrNotUploading the returned upload
+// carries the current state so the client can resume from ReceivedBytes.
+// The upload is queued for processing once the last byte arrives.
+func AppendChunk(ctx context.Context, db *sqlite.DB, palletID, receiptID, uploadID, offset int64, data []byte) (models.PhotoUpload, error) {
+	var upload models.PhotoUpload
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		upload, err = loadTx(ctx, tx, palletID, receiptID, uploadID)
+		if err != nil {
+			return err
+		}
+		if upload.Status != StatusUploading {
+			return ErrNotUploading
+		}
+		if offset != upload.ReceivedBytes {
+			return ErrOffsetMismatch
+		}
+		if len(data) == 0 {
+			return ErrEmptyChunk
+		}
+		if len(data) > MaxChunkBytes {
+			return ErrChunkTooLarge
+		}
+		if upload.ReceivedBytes+int64(len(data)) > upload.TotalBytes {
+			return ErrPhotoTooLarge
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO photo_upload_chunks (upload_id, offset_bytes, data) VALUES (?, ?, ?)`, upload.ID, offset, data); err != nil {
+			return err
+		}
+		upload.ReceivedBytes += int64(len(data))
+		if upload.ReceivedBytes == upload.TotalBytes {
+			upload.Status = StatusQueued
+		}
+		upload.UpdatedAt = time.Now().UTC()
+		_, err = tx.NewUpdate().
+			Model(&upload).
+			Column("received_bytes", "status", "updated_at").
+			WherePK().
+			Exec(ctx)
+		return err
+	})
+	return upload, err
+}
@@ -0,0 +1,225 @@
+package photoupload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/heic"
+	"receipter/infrastructure/live"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+// pngHeader is enough for http.DetectContentType to report image/png.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+func openPhotoUploadTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "photoupload-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO projects (id, name, description, project_date, client_name, code, status, created_at, updated_at)
+VALUES (1, 'Project One', 'one', DATE('now'), 'Client A', 'project-one', 'active', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO users (id, username, password_hash, role, created_at, updated_at) VALUES (1, 'scanner1', 'hash', 'scanner', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO pallets (id, project_id, status, created_at) VALUES (1, 1, 'open', CURRENT_TIMESTAMP)`); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, created_at, updated_at)
+VALUES (1, 1, 1, 'SKU1', 'Item 1', 1, 3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed test data: %v", err)
+	}
+	return db
+}
+
+func reserveTestUploads(t *testing.T, db *sqlite.DB, photos ...Pending) []models.PhotoUpload {
+	t.Helper()
+	var uploads []models.PhotoUpload
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		uploads, err = Reserve(ctx, tx, 1, 1, photos)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("reserve uploads: %v", err)
+	}
+	return uploads
+}
+
+func TestPendingValidate(t *testing.T) {
+	p := Pending{FileName: "../../evil.jpg", MIMEType: " IMAGE/JPEG ", Size: 10}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if p.FileName != "evil.jpg" || p.MIMEType != "image/jpeg" {
+		t.Fatalf("expected normalised name and type, got %+v", p)
+	}
+	if err := (&Pending{MIMEType: "image/jpeg", Size: MaxPhotoBytes + 1}).Validate(); !errors.Is(err, ErrPhotoTooLarge) {
+		t.Fatalf("expected ErrPhotoTooLarge, got %v", err)
+	}
+	if err := (&Pending{MIMEType: "application/pdf", Size: 10}).Validate(); !errors.Is(err, ErrNotImage) {
+		t.Fatalf("expected ErrNotImage, got %v", err)
+	}
+}
+
+func TestAppendChunk_ResumesFromReceivedBytesAndQueues(t *testing.T) {
+	db := openPhotoUploadTestDB(t)
+	photo := append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{7}, 12)...)
+	uploads := reserveTestUploads(t, db, Pending{FileName: "box.png", MIMEType: "image/png", Size: int64(len(photo))})
+	id := uploads[0].ID
+
+	upload, err := AppendChunk(context.Background(), db, 1, 1, id, 0, photo[:8])
+	if err != nil {
+		t.Fatalf("append first chunk: %v", err)
+	}
+	if upload.ReceivedBytes != 8 || upload.Status != StatusUploading {
+		t.Fatalf("unexpected state after first chunk: %+v", upload)
+	}
+
+	// A retried first chunk is rejected and reports where to resume.
+	upload, err = AppendChunk(context.Background(), db, 1, 1, id, 0, photo[:8])
+	if !errors.Is(err, ErrOffsetMismatch) || upload.ReceivedBytes != 8 {
+		t.Fatalf("expected offset mismatch at 8, got err=%v state=%+v", err, upload)
+	}
+	if _, err := AppendChunk(context.Background(), db, 2, 1, id, 8, photo[8:]); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for wrong pallet, got %v", err)
+	}
+
+	upload, err = AppendChunk(context.Background(), db, 1, 1, id, 8, photo[8:])
+	if err != nil {
+		t.Fatalf("append last chunk: %v", err)
+	}
+	if upload.Status != StatusQueued || upload.ReceivedBytes != upload.TotalBytes {
+		t.Fatalf("expected queued upload, got %+v", upload)
+	}
+	if _, err := AppendChunk(context.Background(), db, 1, 1, id, upload.ReceivedBytes, []byte{1}); !errors.Is(err, ErrNotUploading) {
+		t.Fatalf("expected ErrNotUploading after completion, got %v", err)
+	}
+}
+
+func TestWorkerProcessPending_MovesPhotoAndFailsNonImages(t *testing.T) {
+	db := openPhotoUploadTestDB(t)
+	photo := append(append([]byte{}, pngHeader...), 1, 2, 3)
+	notPhoto := []byte("plain text, not an image")
+	uploads := reserveTestUploads(t, db,
+		Pending{FileName: "good.png", MIMEType: "image/png", Size: int64(len(photo))},
+		Pending{FileName: "bad.jpg", MIMEType: "image/jpeg", Size: int64(len(notPhoto))},
+	)
+	if _, err := AppendChunk(context.Background(), db, 1, 1, uploads[0].ID, 0, photo); err != nil {
+		t.Fatalf("append good photo: %v", err)
+	}
+	if _, err := AppendChunk(context.Background(), db, 1, 1, uploads[1].ID, 0, notPhoto); err != nil {
+		t.Fatalf("append bad photo: %v", err)
+	}
+
+	hub := live.NewHub()
+	defer hub.Close()
+	sub := hub.Join(1, 1, "scanner1")
+	<-sub.C
+	hub.Ack(sub, live.EventPresence)
+
+	processed, err := NewWorker(db, hub).ProcessPending(context.Background())
+	if err != nil {
+		t.Fatalf("process pending: %v", err)
+	}
+	if processed != 2 {
+		t.Fatalf("expected 2 uploads processed, got %d", processed)
+	}
+	if kind := <-sub.C; kind != live.EventLines {
+		t.Fatalf("expected lines event, got %q", kind)
+	}
+
+	good, err := Load(context.Background(), db, 1, 1, uploads[0].ID)
+	if err != nil || good.Status != StatusDone {
+		t.Fatalf("expected good upload done, got %+v err=%v", good, err)
+	}
+	bad, err := Load(context.Background(), db, 1, 1, uploads[1].ID)
+	if err != nil || bad.Status != StatusFailed || bad.Error != ErrNotImage.Error() {
+		t.Fatalf("expected bad upload failed, got %+v err=%v", bad, err)
+	}
+
+	var stored struct {
+		Blob []byte `bun:"photo_blob"`
+		MIME string `bun:"photo_mime"`
+		Name string `bun:"photo_name"`
+	}
+	var chunks int
+	err = db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT photo_blob, photo_mime, photo_name FROM receipt_photos WHERE pallet_receipt_id = 1`).Scan(ctx, &stored); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT COUNT(*) FROM photo_upload_chunks`).Scan(ctx, &chunks)
+	})
+	if err != nil {
+		t.Fatalf("load stored photo: %v", err)
+	}
+	if !bytes.Equal(stored.Blob, photo) || stored.MIME != "image/png" || stored.Name != "good.png" {
+		t.Fatalf("unexpected stored photo: mime=%q name=%q len=%d", stored.MIME, stored.Name, len(stored.Blob))
+	}
+	if chunks != 0 {
+		t.Fatalf("expected staged chunks to be removed, got %d", chunks)
+	}
+}
+
+func TestWorkerProcessPending_ConvertsHEIC(t *testing.T) {
+	orig := heic.Convert
+	t.Cleanup(func() { heic.Convert = orig })
+	jpeg := []byte("\xff\xd8\xff\xe0 converted")
+	heic.Convert = func(ctx context.Context, data []byte) ([]byte, error) { return jpeg, nil }
+
+	db := openPhotoUploadTestDB(t)
+	// iPhones often upload HEIC with no type, which the browser sends as
+	// octet-stream.
+	photo := []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic....")
+	uploads := reserveTestUploads(t, db, Pending{FileName: "IMG_0042.HEIC", MIMEType: "application/octet-stream", Size: int64(len(photo))})
+	if _, err := AppendChunk(context.Background(), db, 1, 1, uploads[0].ID, 0, photo); err != nil {
+		t.Fatalf("append photo: %v", err)
+	}
+	hub := live.NewHub()
+	defer hub.Close()
+	if _, err := NewWorker(db, hub).ProcessPending(context.Background()); err != nil {
+		t.Fatalf("process pending: %v", err)
+	}
+
+	var stored struct {
+		Blob []byte `bun:"photo_blob"`
+		MIME string `bun:"photo_mime"`
+		Name string `bun:"photo_name"`
+	}
+	if err := db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT photo_blob, photo_mime, photo_name FROM receipt_photos WHERE pallet_receipt_id = 1`).Scan(ctx, &stored)
+	}); err != nil {
+		t.Fatalf("load stored photo: %v", err)
+	}
+	if !bytes.Equal(stored.Blob, jpeg) || stored.MIME != "image/jpeg" || stored.Name != "IMG_0042.jpg" {
+		t.Fatalf("expected HEIC stored as JPEG, got mime=%q name=%q len=%d", stored.MIME, stored.Name, len(stored.Blob))
+	}
+}
@@ -0,0 +1,274 @@
+package photoupload
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/heic"
+	"receipter/infrastructure/live"
+	"receipter/infrastructure/photocapture"
+	"receipter/infrastructure/photovisibility"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+const (
+	workerPollInterval = 30 * time.Second
+	// abandonAfter fails uploads whose client stopped sending chunks, so lines
+	// do not show photos pending forever.
+	abandonAfter = 24 * time.Hour
+)
+
+// Worker moves completed uploads into receipt_photos in the background and
+// tells open receipt pages when a line's photos have finished processing.
+type Worker struct {
+	db  *sqlite.DB
+	hub *live.Hub
+
+	// Paused, when set before Start, leaves queued uploads waiting while it
+	// returns true, such as during maintenance.
+	Paused func() bool
+
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	started atomic.Bool
+}
+
+func NewWorker(db *sqlite.DB, hub *live.Hub) *Worker {
+	return &Worker{
+		db:   db,
+		hub:  hub,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// Notify wakes the worker after an upload has been queued. Safe on a nil worker.
+func (w *Worker) Notify() {
+	if w == nil {
+		return
+	}
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the worker until Stop. Uploads left processing by a previous
+// run are queued again first.
+func (w *Worker) Start() {
+	w.started.Store(true)
+	go func() {
+		defer close(w.done)
+		ctx := context.Background()
+		if err := w.requeueInterrupted(ctx); err != nil {
+			slog.Error("photo uploads: requeue interrupted failed", slog.Any("err", err))
+		}
+		ticker := time.NewTicker(workerPollInterval)
+		defer ticker.Stop()
+		for {
+			if w.Paused == nil || !w.Paused() {
+				if _, err := w.ProcessPending(ctx); err != nil {
+					slog.Error("photo uploads: processing failed", slog.Any("err", err))
+				}
+				if err := w.failAbandoned(ctx, time.Now().UTC().Add(-abandonAfter)); err != nil {
+					slog.Error("photo uploads: expire abandoned failed", slog.Any("err", err))
+				}
+			}
+			select {
+			case <-w.stop:
+				return
+			case <-w.wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends a started worker and waits for the current upload to finish.
+func (w *Worker) Stop() {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+	if !w.started.Load() {
+		return
+	}
+	select {
+	case <-w.done:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+// ProcessPending processes queued uploads until none remain and returns how
+// many it handled.
+func (w *Worker) ProcessPending(ctx context.Context) (int, error) {
+	processed := 0
+	for {
+		upload, ok, err := w.claimNext(ctx)
+		if err != nil {
+			return processed, err
+		}
+		if !ok {
+			return processed, nil
+		}
+		if err := w.process(ctx, upload); err != nil {
+			return processed, err
+		}
+		processed++
+	}
+}
+
+func (w *Worker) claimNext(ctx context.Context) (models.PhotoUpload, bool, error) {
+	var upload models.PhotoUpload
+	err := w.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewSelect().
+			Model(&upload).
+			Where("status = ?", StatusQueued).
+			OrderExpr("id ASC").
+			Limit(1).
+			Scan(ctx); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE photo_uploads SET status = ?, updated_at = ? WHERE id = ?`, StatusProcessing, time.Now().UTC(), upload.ID)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return upload, false, nil
+	}
+	return upload, err == nil, err
+}
+
+func (w *Worker) process(ctx context.Context, upload models.PhotoUpload) error {
+	blob, err := w.assemble(ctx, upload.ID)
+	if err != nil {
+		return err
+	}
+	mimeType, validationErr := validatePhoto(upload, blob)
+	fileName := upload.FileName
+	if validationErr == nil && heic.IsMIME(mimeType) {
+		blob, mimeType, fileName = heic.Normalize(ctx, blob, fileName)
+	}
+
+	var palletID, projectID int64
+	err = w.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`SELECT pallet_id, project_id FROM pallet_receipts WHERE id = ?`, upload.PalletReceiptID).Scan(ctx, &palletID, &projectID); err != nil {
+			return err
+		}
+		if validationErr == nil {
+			settings, err := projectsettings.LoadTx(ctx, tx, projectID)
+			if err != nil {
+				return err
+			}
+			validationErr = photocapture.LoadConfig(settings).Check(blob)
+		}
+		status, message := StatusDone, ""
+		if validationErr != nil {
+			status, message = StatusFailed, validationErr.Error()
+		} else {
+			photo := models.ReceiptPhoto{
+				PalletReceiptID: upload.PalletReceiptID,
+				PhotoBlob:       blob,
+				PhotoMIME:       mimeType,
+				PhotoName:       fileName,
+			}
+			if _, err := tx.NewInsert().Model(&photo).Exec(ctx); err != nil {
+				return err
+			}
+			if upload.Internal {
+				if err := photovisibility.MarkTx(ctx, tx, upload.CreatedByUserID, upload.PalletReceiptID, photovisibility.SourceGallery, photo.ID, true); err != nil {
+					return err
+				}
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE photo_uploads SET status = ?, error = ?, updated_at = ? WHERE id = ?`, status, message, time.Now().UTC(), upload.ID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM photo_upload_chunks WHERE upload_id = ?`, upload.ID)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// The receipt line was deleted while the photo was in flight.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	w.hub.Publish(palletID, live.EventLines)
+	return nil
+}
+
+func (w *Worker) assemble(ctx context.Context, uploadID int64) ([]byte, error) {
+	var chunks [][]byte
+	err := w.db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT data FROM photo_upload_chunks WHERE upload_id = ? ORDER BY offset_bytes`, uploadID).Scan(ctx, &chunks)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Join(chunks, nil), nil
+}
+
+func validatePhoto(upload models.PhotoUpload, blob []byte) (string, error) {
+	if int64(len(blob)) != upload.TotalBytes {
+		return "", fmt.Errorf("photo upload incomplete: received %d of %d bytes", len(blob), upload.TotalBytes)
+	}
+	if len(blob) > MaxPhotoBytes {
+		return "", ErrPhotoTooLarge
+	}
+	mimeType := heic.DetectContentType(blob)
+	if !strings.HasPrefix(mimeType, "image/") {
+		return "", ErrNotImage
+	}
+	return mimeType, nil
+}
+
+func (w *Worker) requeueInterrupted(ctx context.Context) error {
+	return w.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE photo_uploads SET status = ? WHERE status = ?`, StatusQueued, StatusProcessing)
+		return err
+	})
+}
+
+func (w *Worker) failAbandoned(ctx context.Context, before time.Time) error {
+	var palletIDs []int64
+	err := w.db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`
+SELECT DISTINCT pr.pallet_id
+FROM photo_uploads pu
+JOIN pallet_receipts pr ON pr.id = pu.pallet_receipt_id
+WHERE pu.status = ? AND pu.updated_at < ?`, StatusUploading, before).Scan(ctx, &palletIDs); err != nil {
+			return err
+		}
+		if len(palletIDs) == 0 {
+			return nil
+		}
+		if _, err := tx.ExecContext(ctx, `
+DELETE FROM photo_upload_chunks
+WHERE upload_id IN (SELECT id FROM photo_uploads WHERE status = ? AND updated_at < ?)`, StatusUploading, before); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE photo_uploads SET status = ?, error = 'upload abandoned', updated_at = ? WHERE status = ? AND updated_at < ?`, StatusFailed, time.Now().UTC(), StatusUploading, before)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, palletID := range palletIDs {
+		w.hub.Publish(palletID, live.EventLines)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+// Package photovisibility decides which receipt photos client users may see.
+// Every photo is client-visible unless it is marked internal, either when it
+// is captured or later from the line detail page. Internal photos are still
+// shown to admins and scanners but never streamed or exported to a client.
+package photovisibility
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/sqlite"
+)
+
+// Photo sources: gallery photos in receipt_photos, and the single primary
+// stock photo stored on the receipt line itself, whose photo id is the line's.
+const (
+	SourceGallery = "receipt_photos"
+	SourcePrimary = "pallet_receipts"
+)
+
+var (
+	ErrNotFound      = errors.New("photo not found")
+	ErrInvalidSource = errors.New("photo source must be primary or gallery")
+)
+
+// HiddenFrom reports whether internal photos are withheld from a user with
+// these roles: client users who are not also staff.
+func HiddenFrom(userRoles []string) bool {
+	client := false
+	for _, role := range userRoles {
+		switch role {
+		case rbac.RoleAdmin, rbac.RoleScanner:
+			return false
+		case rbac.RoleClient:
+			client = true
+		}
+	}
+	return client
+}
+
+// ClientVisibleSQL is a condition true when the photo of source whose id is
+// idExpr is not internal, for queries that list photos for client users.
+func ClientVisibleSQL(source, idExpr string) string {
+	return fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM internal_photos ip WHERE ip.source = '%s' AND ip.photo_id = %s)`, source, idExpr)
+}
+
+// MarkTx records whether a photo of receiptID is internal inside the
+// caller's transaction. It is used when photos are captured, so it neither
+// checks the photo exists nor writes an audit entry.
+func MarkTx(ctx context.Context, tx bun.Tx, userID, receiptID int64, source string, photoID int64, internal bool) error {
+	if source != SourceGallery && source != SourcePrimary {
+		return ErrInvalidSource
+	}
+	if !internal {
+		_, err := tx.ExecContext(ctx, `DELETE FROM internal_photos WHERE source = ? AND photo_id = ?`, source, photoID)
+		return err
+	}
+	var markedBy any
+	if userID > 0 {
+		markedBy = userID
+	}
+	_, err := tx.ExecContext(ctx, `
+INSERT INTO internal_photos (source, photo_id, pallet_receipt_id, marked_by_user_id, marked_at)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (source, photo_id) DO NOTHING`, source, photoID, receiptID, markedBy, time.Now().UTC())
+	return err
+}
+
+// Set marks a stored photo of a pallet's receipt line internal or
+// client-visible and audits the change against the line.
+func Set(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, palletID, receiptID int64, source string, photoID int64, internal bool) error {
+	if source == SourcePrimary {
+		photoID = receiptID
+	}
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var projectID int64
+		var query string
+		args := []any{receiptID, palletID}
+		switch source {
+		case SourcePrimary:
+			query = `
+SELECT pr.project_id FROM pallet_receipts pr
+WHERE pr.id = ? AND pr.pallet_id = ? AND pr.stock_photo_blob IS NOT NULL AND length(pr.stock_photo_blob) > 0`
+		case SourceGallery:
+			query = `
+SELECT pr.project_id FROM pallet_receipts pr
+JOIN receipt_photos rp ON rp.pallet_receipt_id = pr.id
+WHERE pr.id = ? AND pr.pallet_id = ? AND rp.id = ?`
+			args = append(args, photoID)
+		default:
+			return ErrInvalidSource
+		}
+		if err := tx.NewRaw(query, args...).Scan(ctx, &projectID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		was, err := isInternalTx(ctx, tx, source, photoID)
+		if err != nil {
+			return err
+		}
+		if was == internal {
+			return nil
+		}
+		if err := MarkTx(ctx, tx, userID, receiptID, source, photoID, internal); err != nil {
+			return err
+		}
+		if auditSvc == nil {
+			return nil
+		}
+		snapshot := func(internal bool) map[string]any {
+			return map[string]any{
+				"project_id": projectID,
+				"pallet_id":  palletID,
+				"source":     source,
+				"photo_id":   photoID,
+				"internal":   internal,
+			}
+		}
+		return auditSvc.Write(ctx, tx, userID, "receipt.photo_visibility", "pallet_receipts", fmt.Sprintf("%d", receiptID), snapshot(was), snapshot(internal))
+	})
+}
+
+// IsInternal reports whether a photo is held back from client users.
+func IsInternal(ctx context.Context, db *sqlite.DB, source string, photoID int64) (bool, error) {
+	var internal bool
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		internal, err = isInternalTx(ctx, tx, source, photoID)
+		return err
+	})
+	return internal, err
+}
+
+func isInternalTx(ctx context.Context, tx bun.Tx, source string, photoID int64) (bool, error) {
+	var internal bool
+	err := tx.NewRaw(`SELECT EXISTS (SELECT 1 FROM internal_photos WHERE source = ? AND photo_id = ?)`, source, photoID).Scan(ctx, &internal)
+	return internal, err
+}
+
+// LoadLine returns which of a receipt line's photos are internal: its
+// primary photo, and its gallery photos by id.
+func LoadLine(ctx context.Context, tx bun.Tx, receiptID int64) (primary bool, gallery map[int64]bool, err error) {
+	rows := make([]struct {
+		Source  string `bun:"source"`
+		PhotoID int64  `bun:"photo_id"`
+	}, 0)
+	if err := tx.NewRaw(`SELECT source, photo_id FROM internal_photos WHERE pallet_receipt_id = ?`, receiptID).Scan(ctx, &rows); err != nil {
+		return false, nil, err
+	}
+	gallery = make(map[int64]bool)
+	for _, row := range rows {
+		if row.Source == SourcePrimary {
+			primary = row.PhotoID == receiptID
+			continue
+		}
+		gallery[row.PhotoID] = true
+	}
+	return primary, gallery, nil
+}
+
+// CopyLine marks the photos of toID internal where the matching photos of
+// fromID are, for a line whose photos were copied from another in id order.
+func CopyLine(ctx context.Context, tx bun.Tx, userID, fromID, toID int64) error {
+	primary, _, err := LoadLine(ctx, tx, fromID)
+	if err != nil {
+		return err
+	}
+	if primary {
+		if err := MarkTx(ctx, tx, userID, toID, SourcePrimary, toID, true); err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, `
+WITH src AS (
+	SELECT id, ROW_NUMBER() OVER (ORDER BY id) AS n FROM receipt_photos WHERE pallet_receipt_id = ?
+), dst AS (
+	SELECT id, ROW_NUMBER() OVER (ORDER BY id) AS n FROM receipt_photos WHERE pallet_receipt_id = ?
+)
+INSERT INTO internal_photos (source, photo_id, pallet_receipt_id, marked_by_user_id, marked_at)
+SELECT ?, dst.id, ?, ip.marked_by_user_id, ip.marked_at
+FROM src
+JOIN dst ON dst.n = src.n
+JOIN internal_photos ip ON ip.source = ? AND ip.photo_id = src.id
+WHERE true
+ON CONFLICT (source, photo_id) DO NOTHING`, fromID, toID, SourceGallery, toID, SourceGallery)
+	return err
+}
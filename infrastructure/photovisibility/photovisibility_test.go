@@ -0,0 +1,148 @@
+package photovisibility
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/rbac"
+	"receipter/infrastructure/sqlite"
+)
+
+func openPhotoVisibilityTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "photovisibility-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	execAll(t, db,
+		`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'Inbound', 'one', DATE('now'), 'Client', 'inbound', 'active')`,
+		`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'scanner1', 'hash', 'scanner')`,
+		`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open'), (2, 1, 'open')`,
+		`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, stock_photo_blob) VALUES
+			(10, 1, 1, 'SKU1', 'Item 1', 1, 4, X'FFD8FF'),
+			(11, 1, 2, 'SKU1', 'Item 1', 1, 2, X'FFD8FF')`,
+		`INSERT INTO receipt_photos (id, pallet_receipt_id, photo_blob) VALUES (100, 10, X'01'), (101, 10, X'02'), (102, 11, X'01'), (103, 11, X'02')`,
+	)
+	return db
+}
+
+func execAll(t *testing.T, db *sqlite.DB, stmts ...string) {
+	t.Helper()
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+}
+
+func loadLine(t *testing.T, db *sqlite.DB, receiptID int64) (bool, map[int64]bool) {
+	t.Helper()
+	var primary bool
+	var gallery map[int64]bool
+	err := db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		primary, gallery, err = LoadLine(ctx, tx, receiptID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("load line: %v", err)
+	}
+	return primary, gallery
+}
+
+func TestHiddenFrom(t *testing.T) {
+	cases := []struct {
+		roles  []string
+		hidden bool
+	}{
+		{[]string{rbac.RoleClient}, true},
+		{[]string{rbac.RoleClient, rbac.RoleAdmin}, false},
+		{[]string{rbac.RoleScanner}, false},
+		{[]string{rbac.RoleKiosk}, false},
+		{nil, false},
+	}
+	for _, tc := range cases {
+		if got := HiddenFrom(tc.roles); got != tc.hidden {
+			t.Fatalf("HiddenFrom(%v) = %v, want %v", tc.roles, got, tc.hidden)
+		}
+	}
+}
+
+func TestSetChecksThePhotoBelongsToTheLine(t *testing.T) {
+	db := openPhotoVisibilityTestDB(t)
+	ctx := context.Background()
+
+	if err := Set(ctx, db, nil, 1, 1, 10, SourceGallery, 102, true); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected another line's photo to be unknown, got %v", err)
+	}
+	if err := Set(ctx, db, nil, 1, 2, 10, SourcePrimary, 0, true); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected a line on another pallet to be unknown, got %v", err)
+	}
+	if err := Set(ctx, db, nil, 1, 1, 10, "elsewhere", 100, true); !errors.Is(err, ErrInvalidSource) {
+		t.Fatalf("expected invalid source, got %v", err)
+	}
+
+	if err := Set(ctx, db, nil, 1, 1, 10, SourceGallery, 101, true); err != nil {
+		t.Fatalf("mark gallery photo: %v", err)
+	}
+	if err := Set(ctx, db, nil, 1, 1, 10, SourcePrimary, 0, true); err != nil {
+		t.Fatalf("mark primary photo: %v", err)
+	}
+	primary, gallery := loadLine(t, db, 10)
+	if !primary || len(gallery) != 1 || !gallery[101] {
+		t.Fatalf("expected primary and photo 101 internal, got %v %v", primary, gallery)
+	}
+	if internal, err := IsInternal(ctx, db, SourceGallery, 100); err != nil || internal {
+		t.Fatalf("expected photo 100 client-visible, got %v %v", internal, err)
+	}
+
+	if err := Set(ctx, db, nil, 1, 1, 10, SourcePrimary, 0, false); err != nil {
+		t.Fatalf("unmark primary photo: %v", err)
+	}
+	if primary, _ := loadLine(t, db, 10); primary {
+		t.Fatalf("expected primary photo client-visible again")
+	}
+}
+
+func TestCopyLineFollowsPhotoOrder(t *testing.T) {
+	db := openPhotoVisibilityTestDB(t)
+	ctx := context.Background()
+	if err := Set(ctx, db, nil, 1, 1, 10, SourceGallery, 101, true); err != nil {
+		t.Fatalf("mark: %v", err)
+	}
+	if err := Set(ctx, db, nil, 1, 1, 10, SourcePrimary, 0, true); err != nil {
+		t.Fatalf("mark primary: %v", err)
+	}
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return CopyLine(ctx, tx, 1, 10, 11)
+	})
+	if err != nil {
+		t.Fatalf("copy line: %v", err)
+	}
+	primary, gallery := loadLine(t, db, 11)
+	if !primary || len(gallery) != 1 || !gallery[103] {
+		t.Fatalf("expected the copied line's primary and second photo internal, got %v %v", primary, gallery)
+	}
+}
@@ -0,0 +1,178 @@
+package project
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+const (
+	AccessRequestPending  = "pending"
+	AccessRequestApproved = "approved"
+	AccessRequestDenied   = "denied"
+
+	maxAccessRequestNoteLength = 500
+)
+
+var (
+	ErrAccessRequestCodeRequired   = errors.New("project code is required")
+	ErrAccessRequestUnknownProject = errors.New("no project matches that code")
+	ErrAccessRequestAlreadyGranted = errors.New("you already have access to that project")
+	ErrAccessRequestDuplicate      = errors.New("an access request for that project is already pending")
+	ErrAccessRequestNoteTooLong    = errors.New("note must be 500 characters or fewer")
+	ErrAccessRequestNotFound       = errors.New("access request not found")
+	ErrAccessRequestDecided        = errors.New("access request has already been decided")
+)
+
+// AccessRequest is a client user's request to see an additional project.
+type AccessRequest struct {
+	ID          int64  `bun:"id"`
+	UserID      int64  `bun:"user_id"`
+	Username    string `bun:"username"`
+	ProjectID   int64  `bun:"project_id"`
+	ProjectName string `bun:"project_name"`
+	ProjectCode string `bun:"project_code"`
+	Note        string `bun:"note"`
+	Status      string `bun:"status"`
+	DecidedBy   string `bun:"decided_by"`
+	CreatedAt   string `bun:"created_at"`
+	DecidedAt   string `bun:"decided_at"`
+}
+
+const accessRequestSelect = `
+SELECT r.id, r.user_id, COALESCE(u.username, '') AS username, r.project_id,
+       COALESCE(p.name, '') AS project_name, COALESCE(p.code, '') AS project_code,
+       r.note, r.status, COALESCE(d.username, '') AS decided_by,
+       CAST(r.created_at AS TEXT) AS created_at, COALESCE(CAST(r.decided_at AS TEXT), '') AS decided_at
+FROM client_access_requests r
+LEFT JOIN users u ON u.id = r.user_id
+LEFT JOIN projects p ON p.id = r.project_id
+LEFT JOIN users d ON d.id = r.decided_by_user_id`
+
+// RequestClientProjectAccess records a pending request from a client user for
+// the project with the given code.
+func RequestClientProjectAccess(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID int64, code, note string) (AccessRequest, error) {
+	var req AccessRequest
+	code = normalizeCode(code)
+	if code == "" {
+		return req, ErrAccessRequestCodeRequired
+	}
+	note = strings.TrimSpace(note)
+	if len([]rune(note)) > maxAccessRequestNoteLength {
+		return req, ErrAccessRequestNoteTooLong
+	}
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var projectID int64
+		err := tx.NewRaw(`SELECT id FROM projects WHERE code = ?`, code).Scan(ctx, &projectID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrAccessRequestUnknownProject
+		}
+		if err != nil {
+			return err
+		}
+
+		var counts struct {
+			Granted int `bun:"granted"`
+			Pending int `bun:"pending"`
+		}
+		if err := tx.NewRaw(`
+SELECT
+	(SELECT COUNT(1) FROM client_project_access WHERE user_id = ? AND project_id = ?) AS granted,
+	(SELECT COUNT(1) FROM client_access_requests WHERE user_id = ? AND project_id = ? AND status = 'pending') AS pending`,
+			userID, projectID, userID, projectID).Scan(ctx, &counts); err != nil {
+			return err
+		}
+		if counts.Granted > 0 {
+			return ErrAccessRequestAlreadyGranted
+		}
+		if counts.Pending > 0 {
+			return ErrAccessRequestDuplicate
+		}
+
+		res, err := tx.ExecContext(ctx, `
+INSERT INTO client_access_requests (user_id, project_id, note, status, created_at)
+VALUES (?, ?, ?, 'pending', CURRENT_TIMESTAMP)`, userID, projectID, note)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		if err := tx.NewRaw(accessRequestSelect+` WHERE r.id = ?`, id).Scan(ctx, &req); err != nil {
+			return err
+		}
+		return auditSvc.Write(ctx, tx, userID, "client_access.request", "client_access_requests", strconv.FormatInt(id, 10), nil,
+			map[string]any{"project_id": projectID, "note": note})
+	})
+	return req, err
+}
+
+// ListAccessRequests returns requests newest first. status and userID are
+// optional filters.
+func ListAccessRequests(ctx context.Context, db *sqlite.DB, status string, userID int64) ([]AccessRequest, error) {
+	out := make([]AccessRequest, 0)
+	where := []string{"1 = 1"}
+	args := make([]any, 0, 2)
+	if status != "" {
+		where = append(where, "r.status = ?")
+		args = append(args, status)
+	}
+	if userID > 0 {
+		where = append(where, "r.user_id = ?")
+		args = append(args, userID)
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(accessRequestSelect+`
+WHERE `+strings.Join(where, " AND ")+`
+ORDER BY r.created_at DESC, r.id DESC`, args...).Scan(ctx, &out)
+	})
+	return out, err
+}
+
+// DecideAccessRequest approves or denies a pending request. Approval adds the
+// project to the client's assignments in the same transaction.
+func DecideAccessRequest(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, adminID, requestID int64, approve bool) (AccessRequest, error) {
+	var req AccessRequest
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewRaw(accessRequestSelect+` WHERE r.id = ?`, requestID).Scan(ctx, &req)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrAccessRequestNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if req.Status != AccessRequestPending {
+			return ErrAccessRequestDecided
+		}
+
+		status := AccessRequestDenied
+		if approve {
+			status = AccessRequestApproved
+			if _, err := tx.ExecContext(ctx, `
+INSERT OR IGNORE INTO client_project_access (user_id, project_id, created_at)
+VALUES (?, ?, CURRENT_TIMESTAMP)`, req.UserID, req.ProjectID); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `
+UPDATE client_access_requests
+SET status = ?, decided_by_user_id = ?, decided_at = CURRENT_TIMESTAMP
+WHERE id = ?`, status, adminID, requestID); err != nil {
+			return err
+		}
+		before := map[string]any{"project_id": req.ProjectID, "user_id": req.UserID, "status": req.Status}
+		req.Status = status
+		return auditSvc.Write(ctx, tx, adminID, "client_access."+status, "client_access_requests", strconv.FormatInt(requestID, 10), before,
+			map[string]any{"project_id": req.ProjectID, "user_id": req.UserID, "status": status})
+	})
+	return req, err
+}
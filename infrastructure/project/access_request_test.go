@@ -0,0 +1,85 @@
+package project
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"receipter/infrastructure/audit"
+)
+
+func TestAccessRequest_RequestApproveAndDeny(t *testing.T) {
+	db := openProjectAccessTestDB(t)
+	seedProjectAccessFixtures(t, db)
+	ctx := context.Background()
+	auditSvc := audit.NewService()
+
+	if _, err := db.W.ExecContext(ctx, `
+INSERT INTO projects (id, name, description, project_date, client_name, code, status)
+VALUES (4, 'Project Four', 'four', DATE('now'), 'Client B', 'project-four', 'active'),
+       (5, 'Project Five', 'five', DATE('now'), 'Client B', 'project-five', 'active')`); err != nil {
+		t.Fatalf("seed extra projects: %v", err)
+	}
+
+	if _, err := RequestClientProjectAccess(ctx, db, auditSvc, 1, "no-such-code", ""); !errors.Is(err, ErrAccessRequestUnknownProject) {
+		t.Fatalf("expected ErrAccessRequestUnknownProject, got %v", err)
+	}
+	if _, err := RequestClientProjectAccess(ctx, db, auditSvc, 1, "project-one", ""); !errors.Is(err, ErrAccessRequestAlreadyGranted) {
+		t.Fatalf("expected ErrAccessRequestAlreadyGranted, got %v", err)
+	}
+
+	req, err := RequestClientProjectAccess(ctx, db, auditSvc, 1, " Project-Four ", "New buyer at Client B")
+	if err != nil {
+		t.Fatalf("request access: %v", err)
+	}
+	if req.ProjectID != 4 || req.Status != AccessRequestPending || req.Username != "client-user" {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+	if _, err := RequestClientProjectAccess(ctx, db, auditSvc, 1, "project-four", ""); !errors.Is(err, ErrAccessRequestDuplicate) {
+		t.Fatalf("expected ErrAccessRequestDuplicate, got %v", err)
+	}
+	denyReq, err := RequestClientProjectAccess(ctx, db, auditSvc, 1, "project-five", "")
+	if err != nil {
+		t.Fatalf("request second project: %v", err)
+	}
+
+	pending, err := ListAccessRequests(ctx, db, AccessRequestPending, 0)
+	if err != nil {
+		t.Fatalf("list pending: %v", err)
+	}
+	if len(pending) != 2 {
+		t.Fatalf("expected 2 pending requests, got %+v", pending)
+	}
+
+	if _, err := DecideAccessRequest(ctx, db, auditSvc, 2, req.ID, true); err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+	if _, err := DecideAccessRequest(ctx, db, auditSvc, 2, denyReq.ID, false); err != nil {
+		t.Fatalf("deny: %v", err)
+	}
+	if _, err := DecideAccessRequest(ctx, db, auditSvc, 2, req.ID, false); !errors.Is(err, ErrAccessRequestDecided) {
+		t.Fatalf("expected ErrAccessRequestDecided, got %v", err)
+	}
+
+	if ok, _ := ClientHasProjectAccess(ctx, db, 1, 4); !ok {
+		t.Fatalf("expected approval to grant project 4")
+	}
+	if ok, _ := ClientHasProjectAccess(ctx, db, 1, 5); ok {
+		t.Fatalf("expected denial to leave project 5 unassigned")
+	}
+
+	mine, err := ListAccessRequests(ctx, db, "", 1)
+	if err != nil {
+		t.Fatalf("list own requests: %v", err)
+	}
+	statuses := map[int64]string{}
+	for _, r := range mine {
+		statuses[r.ProjectID] = r.Status
+		if r.DecidedBy != "admin-user" {
+			t.Fatalf("expected decided_by admin-user, got %+v", r)
+		}
+	}
+	if statuses[4] != AccessRequestApproved || statuses[5] != AccessRequestDenied {
+		t.Fatalf("unexpected statuses: %v", statuses)
+	}
+}
@@ -0,0 +1,83 @@
+package project
+
+import (
+	"context"
+	"errors"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+var ErrInvalidPalletAllowance = errors.New("pallet allowance must be a whole number of 1 or more")
+
+// PalletAllowance compares a project's optional pallet allowance with the
+// pallet numbers used so far. Cancelled pallets still count: their number
+// label came off the same pre-printed stock.
+type PalletAllowance struct {
+	Allowance      *int64
+	PalletsCreated int64
+	LabelsPrinted  int64
+}
+
+// Tracked reports whether the project has an allowance set.
+func (a PalletAllowance) Tracked() bool {
+	return a.Allowance != nil
+}
+
+// Remaining is the number of pallet numbers left, negative once the
+// allowance has been overrun. It is zero when no allowance is tracked.
+func (a PalletAllowance) Remaining() int64 {
+	if a.Allowance == nil {
+		return 0
+	}
+	return *a.Allowance - a.PalletsCreated
+}
+
+// WouldExceed reports whether creating count more pallets goes over the
+// allowance.
+func (a PalletAllowance) WouldExceed(count int) bool {
+	return a.Allowance != nil && int64(count) > a.Remaining()
+}
+
+func LoadPalletAllowance(ctx context.Context, db *sqlite.DB, projectID int64) (PalletAllowance, error) {
+	var row struct {
+		Allowance      *int64 `bun:"pallet_allowance"`
+		PalletsCreated int64  `bun:"pallets_created"`
+		LabelsPrinted  int64  `bun:"labels_printed"`
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT pj.pallet_allowance,
+       (SELECT COUNT(1) FROM pallets p WHERE p.project_id = pj.id) AS pallets_created,
+       (SELECT COALESCE(SUM(lp.print_count), 0) FROM pallet_label_prints lp JOIN pallets p ON p.id = lp.pallet_id WHERE p.project_id = pj.id) AS labels_printed
+FROM projects pj
+WHERE pj.id = ?`, projectID).Scan(ctx, &row)
+	})
+	return PalletAllowance{Allowance: row.Allowance, PalletsCreated: row.PalletsCreated, LabelsPrinted: row.LabelsPrinted}, err
+}
+
+// SetPalletAllowance sets or, with nil, clears the project's allowance.
+func SetPalletAllowance(ctx context.Context, db *sqlite.DB, projectID int64, allowance *int64) error {
+	if allowance != nil && *allowance < 1 {
+		return ErrInvalidPalletAllowance
+	}
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE projects SET pallet_allowance = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, allowance, projectID)
+		return err
+	})
+}
+
+// RecordPalletLabelPrints counts one printed number label for each pallet.
+func RecordPalletLabelPrints(ctx context.Context, db *sqlite.DB, palletIDs []int64) error {
+	if len(palletIDs) == 0 {
+		return nil
+	}
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO pallet_label_prints (pallet_id, print_count)
+SELECT id, 1 FROM pallets WHERE id IN (?)
+ON CONFLICT (pallet_id) DO UPDATE SET print_count = print_count + 1`, bun.In(palletIDs))
+		return err
+	})
+}
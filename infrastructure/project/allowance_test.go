@@ -0,0 +1,89 @@
+package project
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func TestPalletAllowance_CountsCreatedPalletsAndPrints(t *testing.T) {
+	db := openProjectAccessTestDB(t)
+	seedProjectAccessFixtures(t, db)
+	ctx := context.Background()
+
+	allowance, err := LoadPalletAllowance(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("load allowance: %v", err)
+	}
+	if allowance.Tracked() || allowance.WouldExceed(1000) {
+		t.Fatalf("expected no allowance tracked by default, got %+v", allowance)
+	}
+
+	if err := SetPalletAllowance(ctx, db, 1, int64Ptr(0)); !errors.Is(err, ErrInvalidPalletAllowance) {
+		t.Fatalf("expected zero allowance rejected, got %v", err)
+	}
+	if err := SetPalletAllowance(ctx, db, 1, int64Ptr(5)); err != nil {
+		t.Fatalf("set allowance: %v", err)
+	}
+	if _, err := db.W.ExecContext(ctx, `
+INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open'), (2, 1, 'cancelled'), (3, 1, 'created'), (4, 2, 'created')`); err != nil {
+		t.Fatalf("seed pallets: %v", err)
+	}
+	if err := RecordPalletLabelPrints(ctx, db, []int64{1, 2, 3}); err != nil {
+		t.Fatalf("record prints: %v", err)
+	}
+	if err := RecordPalletLabelPrints(ctx, db, []int64{1}); err != nil {
+		t.Fatalf("record reprint: %v", err)
+	}
+
+	allowance, err = LoadPalletAllowance(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("load allowance: %v", err)
+	}
+	if allowance.PalletsCreated != 3 || allowance.LabelsPrinted != 4 || allowance.Remaining() != 2 {
+		t.Fatalf("unexpected allowance usage: %+v remaining=%d", allowance, allowance.Remaining())
+	}
+	if allowance.WouldExceed(2) || !allowance.WouldExceed(3) {
+		t.Fatalf("expected 2 more pallets to fit and 3 to exceed")
+	}
+
+	if err := SetPalletAllowance(ctx, db, 1, nil); err != nil {
+		t.Fatalf("clear allowance: %v", err)
+	}
+	p, err := LoadByID(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("load project: %v", err)
+	}
+	if p.PalletAllowance != nil {
+		t.Fatalf("expected allowance cleared, got %d", *p.PalletAllowance)
+	}
+}
+
+func TestPalletAllowance_PrintsSurviveRestart(t *testing.T) {
+	db := openProjectAccessTestDB(t)
+	seedProjectAccessFixtures(t, db)
+	ctx := context.Background()
+
+	if _, err := db.W.ExecContext(ctx, `INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open')`); err != nil {
+		t.Fatalf("seed pallet: %v", err)
+	}
+	if err := RecordPalletLabelPrints(ctx, db, []int64{1}); err != nil {
+		t.Fatalf("record print: %v", err)
+	}
+	// Migrations run again on every start, and 003 rebuilds pallets.
+	if err := sqlite.ApplyMigrations(ctx, db, ""); err != nil {
+		t.Fatalf("reapply migrations: %v", err)
+	}
+	if err := RecordPalletLabelPrints(ctx, db, []int64{1}); err != nil {
+		t.Fatalf("record print after restart: %v", err)
+	}
+	allowance, err := LoadPalletAllowance(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("load allowance after restart: %v", err)
+	}
+	if allowance.LabelsPrinted != 2 {
+		t.Fatalf("labels printed = %d, want 2", allowance.LabelsPrinted)
+	}
+}
@@ -181,3 +181,43 @@ func TestListClientProjectsAndAccessChecks(t *testing.T) {
 		t.Fatalf("expected no access to project 999")
 	}
 }
+
+func TestClientExports_DefaultToAllAndCanBeLimited(t *testing.T) {
+	db := openProjectAccessTestDB(t)
+	seedProjectAccessFixtures(t, db)
+	ctx := context.Background()
+
+	perms, err := LoadClientExports(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("load default exports: %v", err)
+	}
+	if perms != AllClientExports {
+		t.Fatalf("expected unlimited client to keep every export, got %+v", perms)
+	}
+
+	if err := SetClientExports(ctx, db, 1, ClientExports{SummaryCSV: true}); err != nil {
+		t.Fatalf("limit exports: %v", err)
+	}
+	perms, err = LoadClientExports(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("load limited exports: %v", err)
+	}
+	if !perms.SummaryCSV || perms.DetailCSV || perms.PhotoZIP {
+		t.Fatalf("expected summary csv only, got %+v", perms)
+	}
+
+	if err := SetClientExports(ctx, db, 1, ClientExports{}); err != nil {
+		t.Fatalf("remove exports: %v", err)
+	}
+	perms, err = LoadClientExports(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("load removed exports: %v", err)
+	}
+	if perms.Any() {
+		t.Fatalf("expected no exports, got %+v", perms)
+	}
+
+	if err := SetClientExports(ctx, db, 2, ClientExports{}); err == nil {
+		t.Fatalf("expected non-client user update to fail")
+	}
+}
@@ -0,0 +1,71 @@
+package project
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+// ClientExports is which SKU view exports a client user may download. Clients
+// that no admin has limited may download all of them.
+type ClientExports struct {
+	SummaryCSV bool `bun:"summary_csv"`
+	DetailCSV  bool `bun:"detail_csv"`
+	PhotoZIP   bool `bun:"photo_zip"`
+}
+
+// AllClientExports is the permission set of a client nobody has limited.
+var AllClientExports = ClientExports{SummaryCSV: true, DetailCSV: true, PhotoZIP: true}
+
+// Any reports whether the client may download at least one export.
+func (e ClientExports) Any() bool {
+	return e.SummaryCSV || e.DetailCSV || e.PhotoZIP
+}
+
+// LoadClientExports returns the exports the client user may download.
+func LoadClientExports(ctx context.Context, db *sqlite.DB, userID int64) (ClientExports, error) {
+	perms := AllClientExports
+	if userID <= 0 {
+		return perms, nil
+	}
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT summary_csv, detail_csv, photo_zip
+FROM client_export_permissions
+WHERE user_id = ?`, userID).Scan(ctx, &perms)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return AllClientExports, nil
+	}
+	return perms, err
+}
+
+// SetClientExports replaces the exports a client user may download.
+func SetClientExports(ctx context.Context, db *sqlite.DB, userID int64, perms ClientExports) error {
+	if userID <= 0 {
+		return fmt.Errorf("client user is required")
+	}
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		role := ""
+		if err := tx.NewRaw(`SELECT role FROM users WHERE id = ?`, userID).Scan(ctx, &role); err != nil {
+			return err
+		}
+		if role != "client" {
+			return fmt.Errorf("user must have client role")
+		}
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO client_export_permissions (user_id, summary_csv, detail_csv, photo_zip, updated_at)
+VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(user_id) DO UPDATE SET
+  summary_csv = excluded.summary_csv,
+  detail_csv = excluded.detail_csv,
+  photo_zip = excluded.photo_zip,
+  updated_at = CURRENT_TIMESTAMP`, userID, perms.SummaryCSV, perms.DetailCSV, perms.PhotoZIP)
+		return err
+	})
+}
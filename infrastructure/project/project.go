@@ -3,6 +3,7 @@ package project
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
@@ -10,6 +11,9 @@ import (
 
 	"github.com/uptrace/bun"
 
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/labelbarcode"
+	"receipter/infrastructure/labeltext"
 	"receipter/infrastructure/sqlite"
 	"receipter/models"
 )
@@ -19,13 +23,22 @@ const (
 	StatusInactive = "inactive"
 )
 
+var (
+	ErrReadOnly                  = errors.New("inactive projects are read-only")
+	ErrUnsupportedLabelLanguage  = errors.New("label language is not supported")
+	ErrUnsupportedLabelSymbology = errors.New("label barcode symbology is not supported")
+)
+
 type CreateInput struct {
-	Name        string
-	Description string
-	ProjectDate time.Time
-	ClientName  string
-	Code        string
-	Status      string
+	Name           string
+	Description    string
+	ProjectDate    time.Time
+	ClientName     string
+	Code           string
+	Status         string
+	LabelLanguage  string
+	LabelSymbology string
+	SiteID         *int64
 }
 
 type PalletCounts struct {
@@ -34,6 +47,15 @@ type PalletCounts struct {
 	ClosedCount  int
 }
 
+// CheckWritable returns ErrReadOnly unless a project with the given status
+// accepts changes to its pallets and receipt lines.
+func CheckWritable(status string) error {
+	if status != StatusActive {
+		return ErrReadOnly
+	}
+	return nil
+}
+
 func NormalizeStatus(status string) string {
 	switch strings.ToLower(strings.TrimSpace(status)) {
 	case StatusInactive:
@@ -101,14 +123,39 @@ func ResolveSessionActiveProjectID(ctx context.Context, db *sqlite.DB, current *
 func SetSessionActiveProjectID(ctx context.Context, db *sqlite.DB, sessionID string, projectID *int64) error {
 	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
 		if projectID == nil || *projectID <= 0 {
-			_, err := tx.ExecContext(ctx, `UPDATE sessions SET active_project_id = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, sessionID)
+			_, err := tx.ExecContext(ctx, `UPDATE sessions SET active_project_id = NULL, active_project_selected_at = `+nowMillis+`, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, sessionID)
 			return err
 		}
-		_, err := tx.ExecContext(ctx, `UPDATE sessions SET active_project_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, *projectID, sessionID)
+		_, err := tx.ExecContext(ctx, `UPDATE sessions SET active_project_id = ?, active_project_selected_at = `+nowMillis+`, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, *projectID, sessionID)
 		return err
 	})
 }
 
+// nowMillis is the current time with milliseconds, so a deactivation and a
+// project selection in the same second still compare in order.
+const nowMillis = `strftime('%Y-%m-%d %H:%M:%f', 'now')`
+
+// DeactivatedSessionProject reports whether the session's active project was
+// deactivated after the session picked it, returning the project name.
+// Sessions that picked an already inactive project are left alone.
+func DeactivatedSessionProject(ctx context.Context, db *sqlite.DB, sessionID string) (string, bool, error) {
+	names := make([]string, 0, 1)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT p.name
+FROM sessions s
+JOIN projects p ON p.id = s.active_project_id
+WHERE s.id = ?
+  AND p.status = ?
+  AND p.deactivated_at IS NOT NULL
+  AND julianday(p.deactivated_at) > julianday(COALESCE(s.active_project_selected_at, s.created_at))`, sessionID, StatusInactive).Scan(ctx, &names)
+	})
+	if err != nil || len(names) == 0 {
+		return "", false, err
+	}
+	return names[0], true, nil
+}
+
 func Create(ctx context.Context, db *sqlite.DB, input CreateInput) (models.Project, error) {
 	var project models.Project
 	name := strings.TrimSpace(input.Name)
@@ -130,6 +177,20 @@ func Create(ctx context.Context, db *sqlite.DB, input CreateInput) (models.Proje
 	}
 
 	status := NormalizeStatus(input.Status)
+	labelLanguage := labeltext.DefaultLanguage
+	if strings.TrimSpace(input.LabelLanguage) != "" {
+		labelLanguage = labeltext.Normalize(input.LabelLanguage)
+		if labelLanguage == "" {
+			return project, ErrUnsupportedLabelLanguage
+		}
+	}
+	labelSymbology := labelbarcode.DefaultSymbology
+	if strings.TrimSpace(input.LabelSymbology) != "" {
+		labelSymbology = labelbarcode.Normalize(input.LabelSymbology)
+		if labelSymbology == "" {
+			return project, ErrUnsupportedLabelSymbology
+		}
+	}
 	code := normalizeCode(input.Code)
 	if code == "" {
 		code = normalizeCode(name)
@@ -145,12 +206,15 @@ func Create(ctx context.Context, db *sqlite.DB, input CreateInput) (models.Proje
 		}
 
 		project = models.Project{
-			Name:        name,
-			Description: description,
-			ProjectDate: projectDate,
-			ClientName:  clientName,
-			Code:        uniqueCode,
-			Status:      status,
+			Name:           name,
+			Description:    description,
+			ProjectDate:    projectDate,
+			ClientName:     fieldcrypt.String(clientName),
+			Code:           uniqueCode,
+			Status:         status,
+			LabelLanguage:  labelLanguage,
+			LabelSymbology: labelSymbology,
+			SiteID:         input.SiteID,
 		}
 		_, err = tx.NewInsert().Model(&project).Exec(ctx)
 		return err
@@ -161,7 +225,40 @@ func Create(ctx context.Context, db *sqlite.DB, input CreateInput) (models.Proje
 func SetStatus(ctx context.Context, db *sqlite.DB, projectID int64, status string) error {
 	status = NormalizeStatus(status)
 	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
-		_, err := tx.ExecContext(ctx, `UPDATE projects SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, status, projectID)
+		_, err := tx.ExecContext(ctx, `
+UPDATE projects
+SET status = ?,
+    deactivated_at = CASE
+        WHEN ? <> ? THEN NULL
+        WHEN status = ? THEN deactivated_at
+        ELSE `+nowMillis+`
+    END,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?`, status, status, StatusInactive, StatusInactive, projectID)
+		return err
+	})
+}
+
+// SetLabelLanguage changes the default language for the project's closed pallet labels.
+func SetLabelLanguage(ctx context.Context, db *sqlite.DB, projectID int64, language string) error {
+	language = labeltext.Normalize(language)
+	if language == "" {
+		return ErrUnsupportedLabelLanguage
+	}
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE projects SET label_language = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, language, projectID)
+		return err
+	})
+}
+
+// SetLabelSymbology changes the barcode symbology printed on the project's closed pallet labels.
+func SetLabelSymbology(ctx context.Context, db *sqlite.DB, projectID int64, symbology string) error {
+	symbology = labelbarcode.Normalize(symbology)
+	if symbology == "" {
+		return ErrUnsupportedLabelSymbology
+	}
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE projects SET label_symbology = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, symbology, projectID)
 		return err
 	})
 }
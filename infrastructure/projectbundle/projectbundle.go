@@ -0,0 +1,740 @@
+// Package projectbundle moves a whole project between receipter instances.
+//
+// A bundle is a zip archive holding one JSON file per table plus the photo
+// blobs as separate files. manifest.json lists every file with its SHA-256 so
+// an import can refuse a truncated or edited archive before touching the
+// database. Imports never reuse source IDs: every row is inserted fresh and
+// foreign keys are rewritten through per-table ID maps.
+package projectbundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/fieldcrypt"
+	"receipter/infrastructure/sqlite"
+)
+
+// FormatVersion is written to every manifest. Bump it when the archive
+// layout changes in a way older importers cannot read.
+const FormatVersion = 1
+
+const (
+	manifestName = "manifest.json"
+	usersFile    = "users.json"
+	blobDir      = "blobs/"
+
+	// importedPasswordHash is stored for users created by an import. It is
+	// not a valid argon2 hash, so the account cannot sign in until an admin
+	// sets a password.
+	importedPasswordHash = "!imported"
+)
+
+var (
+	ErrProjectNotFound    = errors.New("project not found")
+	ErrUnsupportedVersion = errors.New("unsupported bundle format version")
+	ErrChecksumMismatch   = errors.New("bundle checksum mismatch")
+	ErrMissingFile        = errors.New("bundle file missing")
+	ErrUnexpectedFile     = errors.New("bundle contains a file not listed in its manifest")
+	ErrProjectCodeExists  = errors.New("project code already exists")
+	ErrDanglingReference  = errors.New("bundle row references a record that is not in the bundle")
+)
+
+// Manifest describes a bundle and the checksum of every file in it.
+type Manifest struct {
+	FormatVersion   int            `json:"format_version"`
+	ExportedAt      string         `json:"exported_at"`
+	SourceProjectID int64          `json:"source_project_id"`
+	ProjectCode     string         `json:"project_code"`
+	ProjectName     string         `json:"project_name"`
+	Files           []ManifestFile `json:"files"`
+}
+
+type ManifestFile struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	Rows   int    `json:"rows,omitempty"`
+}
+
+// ImportOptions controls how a bundle lands on the target instance.
+type ImportOptions struct {
+	// UserID is recorded against the project.import audit entry.
+	UserID int64
+	// Code replaces the bundle's project code, for when the target already
+	// has a project using it.
+	Code string
+}
+
+// ImportResult reports the new project and how source IDs were remapped.
+// PalletIDs matters operationally: labels printed at the source site carry
+// the old pallet IDs.
+type ImportResult struct {
+	ProjectID int64
+	Rows      map[string]int
+	PalletIDs map[int64]int64
+}
+
+// table describes how one table is selected for a project and how its
+// foreign keys are rewritten on import. Maps are keyed by table name.
+type table struct {
+	name  string
+	where string
+	// key is set when the table owns an ID that other rows reference.
+	key  bool
+	refs map[string]string
+	// sourceRefs are references whose target table is named by another
+	// column of the same row, keyed by the ID column.
+	sourceRefs map[string]string
+	blobs      []string
+	// encrypted columns are written to the bundle as plaintext and
+	// re-encrypted on import, since the two instances hold different keys.
+	encrypted []string
+	// optional tables were added to the bundle after its format was first
+	// released, so bundles from older instances may not include them.
+	optional bool
+}
+
+const receiptsInProject = `pallet_receipt_id IN (SELECT id FROM pallet_receipts WHERE project_id = ?)`
+
+// auditInProject mirrors the project logs page so the imported project keeps
+// the same history view.
+const auditInProject = `(entity_type = 'projects' AND entity_id = CAST(? AS TEXT))
+	OR (json_valid(before_json) = 1 AND (json_extract(before_json, '$.ProjectID') = ? OR json_extract(before_json, '$.project_id') = ?))
+	OR (json_valid(after_json) = 1 AND (json_extract(after_json, '$.ProjectID') = ? OR json_extract(after_json, '$.project_id') = ?))`
+
+// tables are listed parent first so imports satisfy foreign keys in order.
+var tables = []table{
+	{name: "projects", where: "id = ?", key: true, encrypted: []string{"client_name"}},
+	{name: "project_phases", where: "project_id = ?", key: true, refs: map[string]string{"project_id": "projects", "created_by_user_id": "users", "closed_by_user_id": "users"}, optional: true},
+	{name: "project_custom_fields", where: "project_id = ?", key: true, refs: map[string]string{"project_id": "projects"}},
+	{name: "stock_items", where: "project_id = ?", key: true, refs: map[string]string{"project_id": "projects"}},
+	{name: "stock_item_barcodes", where: "project_id = ?", key: true, refs: map[string]string{"project_id": "projects", "created_by_user_id": "users"}},
+	{name: "pallets", where: "project_id = ?", key: true, refs: map[string]string{"project_id": "projects"}},
+	{name: "pallet_attributes", where: "pallet_id IN (SELECT id FROM pallets WHERE project_id = ?)", refs: map[string]string{"pallet_id": "pallets"}},
+	{name: "pallet_phases", where: "pallet_id IN (SELECT id FROM pallets WHERE project_id = ?)", refs: map[string]string{"pallet_id": "pallets", "phase_id": "project_phases"}, optional: true},
+	{name: "pallet_receipts", where: "project_id = ?", key: true, refs: map[string]string{
+		"project_id":          "projects",
+		"pallet_id":           "pallets",
+		"scanned_by_user_id":  "users",
+		"resolved_by_user_id": "users",
+	}, blobs: []string{"stock_photo_blob"}},
+	{name: "receipt_photos", where: receiptsInProject, key: true, refs: map[string]string{"pallet_receipt_id": "pallet_receipts"}, blobs: []string{"photo_blob"}},
+	{name: "receipt_serials", where: "project_id = ?", key: true, refs: map[string]string{"project_id": "projects", "pallet_receipt_id": "pallet_receipts", "scanned_by_user_id": "users"}, optional: true},
+	{name: "internal_photos", where: receiptsInProject, refs: map[string]string{"pallet_receipt_id": "pallet_receipts", "marked_by_user_id": "users"}, sourceRefs: map[string]string{"photo_id": "source"}, optional: true},
+	{name: "receipt_custom_values", where: receiptsInProject, refs: map[string]string{"pallet_receipt_id": "pallet_receipts", "field_id": "project_custom_fields"}},
+	{name: "damage_claims", where: "project_id = ?", key: true, refs: map[string]string{"project_id": "projects", "created_by_user_id": "users"}},
+	{name: "damage_claim_lines", where: "claim_id IN (SELECT id FROM damage_claims WHERE project_id = ?)", refs: map[string]string{"claim_id": "damage_claims", "pallet_receipt_id": "pallet_receipts"}},
+	{name: "sku_client_comments", where: "project_id = ?", key: true, refs: map[string]string{"project_id": "projects", "pallet_id": "pallets", "created_by_user_id": "users"}, encrypted: []string{"comment"}},
+	{name: "client_access_log", where: "project_id = ?", refs: map[string]string{"project_id": "projects", "user_id": "users"}},
+	{name: "audit_logs", where: auditInProject, key: true, refs: map[string]string{"user_id": "users"}},
+}
+
+func (t table) file() string {
+	return t.name + ".json"
+}
+
+func (t table) args(projectID int64) []any {
+	n := strings.Count(t.where, "?")
+	args := make([]any, n)
+	for i := range args {
+		args[i] = projectID
+	}
+	return args
+}
+
+func (t table) isBlob(column string) bool {
+	for _, b := range t.blobs {
+		if b == column {
+			return true
+		}
+	}
+	return false
+}
+
+func (t table) isEncrypted(column string) bool {
+	for _, c := range t.encrypted {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+type row map[string]any
+
+type bundleUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// Export writes the bundle for projectID to w.
+func Export(ctx context.Context, db *sqlite.DB, projectID int64, w io.Writer) (Manifest, error) {
+	manifest := Manifest{
+		FormatVersion:   FormatVersion,
+		ExportedAt:      time.Now().UTC().Format(time.RFC3339),
+		SourceProjectID: projectID,
+	}
+	files := map[string][]byte{}
+	var names []string
+	add := func(name string, data []byte, rows int) {
+		if _, ok := files[name]; ok {
+			return
+		}
+		files[name] = data
+		names = append(names, name)
+		sum := sha256.Sum256(data)
+		manifest.Files = append(manifest.Files, ManifestFile{
+			Name:   name,
+			SHA256: hex.EncodeToString(sum[:]),
+			Size:   int64(len(data)),
+			Rows:   rows,
+		})
+	}
+
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		userIDs := map[int64]bool{}
+		for _, t := range tables {
+			rows, err := selectRows(ctx, tx, t, projectID)
+			if err != nil {
+				return err
+			}
+			if t.name == "projects" {
+				if len(rows) == 0 {
+					return ErrProjectNotFound
+				}
+				manifest.ProjectCode, _ = rows[0]["code"].(string)
+				manifest.ProjectName, _ = rows[0]["name"].(string)
+			}
+			for _, r := range rows {
+				for column, target := range t.refs {
+					if id, ok := toInt64(r[column]); ok && target == "users" {
+						userIDs[id] = true
+					}
+				}
+				for _, column := range t.blobs {
+					data, ok := r[column].([]byte)
+					if !ok {
+						continue
+					}
+					sum := sha256.Sum256(data)
+					name := blobDir + hex.EncodeToString(sum[:])
+					add(name, data, 0)
+					r[column] = name
+				}
+			}
+			data, err := json.MarshalIndent(rows, "", "  ")
+			if err != nil {
+				return err
+			}
+			add(t.file(), data, len(rows))
+		}
+
+		users, err := selectUsers(ctx, tx, userIDs)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(users, "", "  ")
+		if err != nil {
+			return err
+		}
+		add(usersFile, data, len(users))
+		return nil
+	})
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return Manifest{}, err
+	}
+	zw := zip.NewWriter(w)
+	if err := writeZipFile(zw, manifestName, manifestJSON); err != nil {
+		return Manifest{}, err
+	}
+	for _, name := range names {
+		if err := writeZipFile(zw, name, files[name]); err != nil {
+			return Manifest{}, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return Manifest{}, err
+	}
+	return manifest, nil
+}
+
+func writeZipFile(zw *zip.Writer, name string, data []byte) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(data)
+	return err
+}
+
+// selectRows reads every column of t for the project. Date columns are cast
+// to text so the stored value round-trips byte for byte instead of being
+// reparsed by the driver.
+func selectRows(ctx context.Context, tx bun.Tx, t table, projectID int64) ([]row, error) {
+	columns, err := tableColumns(ctx, tx, t.name)
+	if err != nil {
+		return nil, err
+	}
+	selects := make([]string, 0, len(columns))
+	names := make([]string, 0, len(columns))
+	for _, c := range columns {
+		names = append(names, c.name)
+		if c.isDate() {
+			selects = append(selects, fmt.Sprintf("CAST(%s AS TEXT) AS %s", c.name, c.name))
+			continue
+		}
+		selects = append(selects, c.name)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY rowid", strings.Join(selects, ", "), t.name, t.where)
+	rs, err := tx.QueryContext(ctx, query, t.args(projectID)...)
+	if err != nil {
+		return nil, fmt.Errorf("select %s: %w", t.name, err)
+	}
+	defer rs.Close()
+
+	out := []row{}
+	for rs.Next() {
+		values := make([]any, len(names))
+		ptrs := make([]any, len(names))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rs.Scan(ptrs...); err != nil {
+			return nil, fmt.Errorf("scan %s: %w", t.name, err)
+		}
+		r := row{}
+		for i, name := range names {
+			v := values[i]
+			if b, ok := v.([]byte); ok && !t.isBlob(name) {
+				v = string(b)
+			}
+			if s, ok := v.(string); ok && t.isEncrypted(name) {
+				plain, err := fieldcrypt.Decrypt(s)
+				if err != nil {
+					return nil, fmt.Errorf("decrypt %s.%s: %w", t.name, name, err)
+				}
+				v = plain
+			}
+			r[name] = v
+		}
+		out = append(out, r)
+	}
+	return out, rs.Err()
+}
+
+func selectUsers(ctx context.Context, tx bun.Tx, ids map[int64]bool) ([]bundleUser, error) {
+	users := []bundleUser{}
+	if len(ids) == 0 {
+		return users, nil
+	}
+	list := make([]int64, 0, len(ids))
+	for id := range ids {
+		list = append(list, id)
+	}
+	if err := tx.NewRaw(`SELECT id, username, role FROM users WHERE id IN (?) ORDER BY id`, bun.In(list)).
+		Scan(ctx, &users); err != nil {
+		return nil, fmt.Errorf("select users: %w", err)
+	}
+	return users, nil
+}
+
+type column struct {
+	name     string
+	declType string
+}
+
+func (c column) isDate() bool {
+	t := strings.ToUpper(c.declType)
+	return strings.Contains(t, "DATE") || strings.Contains(t, "TIME")
+}
+
+func tableColumns(ctx context.Context, idb bun.IDB, name string) ([]column, error) {
+	var rows []struct {
+		Name string `bun:"name"`
+		Type string `bun:"type"`
+	}
+	if err := idb.NewRaw(`SELECT name, type FROM pragma_table_info(?) ORDER BY cid`, name).Scan(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("columns %s: %w", name, err)
+	}
+	columns := make([]column, 0, len(rows))
+	for _, r := range rows {
+		columns = append(columns, column{name: r.Name, declType: r.Type})
+	}
+	return columns, nil
+}
+
+// Verify opens a bundle and checks every file against the manifest. It
+// returns the manifest and file contents only if nothing is missing, extra,
+// or altered.
+func Verify(r io.ReaderAt, size int64) (Manifest, map[string][]byte, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return Manifest{}, nil, fmt.Errorf("open bundle: %w", err)
+	}
+	contents := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return Manifest{}, nil, fmt.Errorf("open %s: %w", f.Name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return Manifest{}, nil, fmt.Errorf("read %s: %w", f.Name, err)
+		}
+		contents[f.Name] = data
+	}
+
+	raw, ok := contents[manifestName]
+	if !ok {
+		return Manifest{}, nil, fmt.Errorf("%w: %s", ErrMissingFile, manifestName)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return Manifest{}, nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	if manifest.FormatVersion != FormatVersion {
+		return Manifest{}, nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, manifest.FormatVersion)
+	}
+
+	listed := map[string]bool{manifestName: true}
+	for _, f := range manifest.Files {
+		listed[f.Name] = true
+		data, ok := contents[f.Name]
+		if !ok {
+			return Manifest{}, nil, fmt.Errorf("%w: %s", ErrMissingFile, f.Name)
+		}
+		sum := sha256.Sum256(data)
+		if int64(len(data)) != f.Size || hex.EncodeToString(sum[:]) != f.SHA256 {
+			return Manifest{}, nil, fmt.Errorf("%w: %s", ErrChecksumMismatch, f.Name)
+		}
+	}
+	for name := range contents {
+		if !listed[name] {
+			return Manifest{}, nil, fmt.Errorf("%w: %s", ErrUnexpectedFile, name)
+		}
+	}
+	delete(contents, manifestName)
+	return manifest, contents, nil
+}
+
+// Import verifies the bundle and inserts it as a new project in a single
+// transaction. Users are matched by username; unknown users are created
+// without a usable password so history keeps its attribution.
+func Import(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, r io.ReaderAt, size int64, opts ImportOptions) (ImportResult, error) {
+	manifest, contents, err := Verify(r, size)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	data := map[string][]row{}
+	for _, t := range tables {
+		raw, ok := contents[t.file()]
+		if !ok && t.optional {
+			continue
+		}
+		if !ok {
+			return ImportResult{}, fmt.Errorf("%w: %s", ErrMissingFile, t.file())
+		}
+		rows, err := decodeRows(raw)
+		if err != nil {
+			return ImportResult{}, fmt.Errorf("parse %s: %w", t.file(), err)
+		}
+		data[t.name] = rows
+	}
+	if len(data["projects"]) != 1 {
+		return ImportResult{}, ErrProjectNotFound
+	}
+	var users []bundleUser
+	if err := json.Unmarshal(contents[usersFile], &users); err != nil {
+		return ImportResult{}, fmt.Errorf("parse %s: %w", usersFile, err)
+	}
+
+	code := strings.TrimSpace(opts.Code)
+	if code == "" {
+		code = manifest.ProjectCode
+	}
+	data["projects"][0]["code"] = code
+	// Sites belong to the instance, so an imported project starts without one.
+	delete(data["projects"][0], "site_id")
+
+	result := ImportResult{Rows: map[string]int{}, PalletIDs: map[int64]int64{}}
+	ids := map[string]map[int64]int64{}
+	err = db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		exists, err := tx.NewSelect().Table("projects").Where("code = ?", code).Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("%w: %s", ErrProjectCodeExists, code)
+		}
+
+		for _, t := range tables {
+			if t.key {
+				ids[t.name] = map[int64]int64{}
+			}
+			targetColumns, err := tableColumns(ctx, tx, t.name)
+			if err != nil {
+				return err
+			}
+			for _, r := range data[t.name] {
+				if t.name == "audit_logs" {
+					remapAudit(r, ids)
+				}
+				oldID, _ := toInt64(r["id"])
+				newID, err := insertRow(ctx, tx, t, targetColumns, r, ids, contents)
+				if err != nil {
+					return err
+				}
+				if t.key {
+					ids[t.name][oldID] = newID
+				}
+			}
+			result.Rows[t.name] = len(data[t.name])
+
+			if t.name == "projects" {
+				// Client users are tied to a project, so they can only be
+				// created once the project row exists.
+				userIDs, err := mapUsers(ctx, tx, users, ids["projects"][manifest.SourceProjectID])
+				if err != nil {
+					return err
+				}
+				ids["users"] = userIDs
+			}
+		}
+
+		result.ProjectID = ids["projects"][manifest.SourceProjectID]
+		result.PalletIDs = ids["pallets"]
+		if opts.UserID <= 0 {
+			return nil
+		}
+		return auditSvc.Write(ctx, tx, opts.UserID, "project.import", "projects", strconv.FormatInt(result.ProjectID, 10), nil, map[string]any{
+			"project_id":        result.ProjectID,
+			"source_project_id": manifest.SourceProjectID,
+			"exported_at":       manifest.ExportedAt,
+			"rows":              result.Rows,
+		})
+	})
+	if err != nil {
+		return ImportResult{}, err
+	}
+	return result, nil
+}
+
+func decodeRows(raw []byte) ([]row, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var rows []row
+	if err := dec.Decode(&rows); err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		for k, v := range r {
+			if n, ok := v.(json.Number); ok {
+				if i, err := n.Int64(); err == nil {
+					r[k] = i
+				} else if f, err := n.Float64(); err == nil {
+					r[k] = f
+				}
+			}
+		}
+	}
+	return rows, nil
+}
+
+func mapUsers(ctx context.Context, tx bun.Tx, users []bundleUser, projectID int64) (map[int64]int64, error) {
+	out := map[int64]int64{}
+	for _, u := range users {
+		var id int64
+		err := tx.NewRaw(`SELECT id FROM users WHERE username = ?`, u.Username).Scan(ctx, &id)
+		if err == nil {
+			out[u.ID] = id
+			continue
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		role := "scanner"
+		var clientProjectID any
+		if u.Role == "client" {
+			role = "client"
+			clientProjectID = projectID
+		}
+		if err := tx.NewRaw(`
+INSERT INTO users (username, password_hash, role, client_project_id, created_at, updated_at)
+VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+RETURNING id`, u.Username, importedPasswordHash, role, clientProjectID).Scan(ctx, &id); err != nil {
+			return nil, fmt.Errorf("create user %s: %w", u.Username, err)
+		}
+		out[u.ID] = id
+	}
+	return out, nil
+}
+
+func insertRow(ctx context.Context, tx bun.Tx, t table, targetColumns []column, r row, ids map[string]map[int64]int64, contents map[string][]byte) (int64, error) {
+	columns := make([]string, 0, len(targetColumns))
+	args := make([]any, 0, len(targetColumns))
+	for _, c := range targetColumns {
+		v, ok := r[c.name]
+		if !ok || (t.key && c.name == "id") {
+			continue
+		}
+		if target, isRef := t.refs[c.name]; isRef && v != nil {
+			oldID, _ := toInt64(v)
+			newID, found := ids[target][oldID]
+			if !found {
+				return 0, fmt.Errorf("%w: %s.%s=%d", ErrDanglingReference, t.name, c.name, oldID)
+			}
+			v = newID
+		}
+		if sourceColumn, isRef := t.sourceRefs[c.name]; isRef && v != nil {
+			target, _ := r[sourceColumn].(string)
+			oldID, _ := toInt64(v)
+			newID, found := ids[target][oldID]
+			if !found {
+				return 0, fmt.Errorf("%w: %s.%s=%d", ErrDanglingReference, t.name, c.name, oldID)
+			}
+			v = newID
+		}
+		if t.isBlob(c.name) && v != nil {
+			name, _ := v.(string)
+			blob, found := contents[name]
+			if !found {
+				return 0, fmt.Errorf("%w: %s", ErrMissingFile, name)
+			}
+			v = blob
+		}
+		if s, ok := v.(string); ok && t.isEncrypted(c.name) {
+			v = fieldcrypt.String(s)
+		}
+		columns = append(columns, c.name)
+		args = append(args, v)
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", t.name, strings.Join(columns, ", "), placeholders)
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("insert %s: %w", t.name, err)
+	}
+	return res.LastInsertId()
+}
+
+// auditEntityMaps names the ID map for audit entity types whose rows are
+// part of the bundle. Entity IDs of other types are kept as exported.
+var auditEntityMaps = map[string]string{
+	"projects":              "projects",
+	"pallets":               "pallets",
+	"pallet_receipts":       "pallet_receipts",
+	"project_custom_fields": "project_custom_fields",
+	"stock_items":           "stock_items",
+	"stock_item_barcodes":   "stock_item_barcodes",
+	"sku_client_comments":   "sku_client_comments",
+}
+
+var auditJSONKeys = map[string]string{
+	"ProjectID":  "projects",
+	"project_id": "projects",
+	"PalletID":   "pallets",
+	"pallet_id":  "pallets",
+}
+
+// remapAudit rewrites the entity ID and the top-level ID fields of the
+// before/after payloads so the imported history points at the new rows.
+func remapAudit(r row, ids map[string]map[int64]int64) {
+	entityType, _ := r["entity_type"].(string)
+	target := auditEntityMaps[entityType]
+	if entityID, ok := r["entity_id"].(string); ok && target != "" {
+		if oldID, err := strconv.ParseInt(entityID, 10, 64); err == nil {
+			if newID, found := ids[target][oldID]; found {
+				r["entity_id"] = strconv.FormatInt(newID, 10)
+			}
+		}
+	}
+	for _, column := range []string{"before_json", "after_json"} {
+		raw, ok := r[column].(string)
+		if !ok || raw == "" {
+			continue
+		}
+		r[column] = remapAuditJSON(raw, target, ids)
+	}
+}
+
+func remapAuditJSON(raw, entityMap string, ids map[string]map[int64]int64) string {
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	var payload map[string]any
+	if err := dec.Decode(&payload); err != nil {
+		return raw
+	}
+	changed := false
+	keys := make([]string, 0, len(payload))
+	for k := range payload {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		target := auditJSONKeys[k]
+		if (k == "ID" || k == "id") && entityMap != "" {
+			target = entityMap
+		}
+		if target == "" {
+			continue
+		}
+		oldID, ok := toInt64(payload[k])
+		if !ok {
+			continue
+		}
+		if newID, found := ids[target][oldID]; found {
+			payload[k] = newID
+			changed = true
+		}
+	}
+	if !changed {
+		return raw
+	}
+	out, err := json.Marshal(payload)
+	if err != nil {
+		return raw
+	}
+	return string(out)
+}
+
+func toInt64(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,359 @@
+package projectbundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+func openBundleTestDB(t *testing.T, name string) *sqlite.DB {
+	t.Helper()
+	db, err := sqlite.OpenDB(filepath.Join(t.TempDir(), name))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	return db
+}
+
+func execAll(t *testing.T, db *sqlite.DB, statements ...string) {
+	t.Helper()
+	err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range statements {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+}
+
+func seedSourceProject(t *testing.T, db *sqlite.DB) {
+	t.Helper()
+	execAll(t, db,
+		`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'x', 'admin'), (2, 'site-scanner', 'x', 'scanner')`,
+		`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'Inbound', 'Site inbound', '2026-02-01', 'Acme', 'acme-inbound', 'active')`,
+		`INSERT INTO pallets (id, project_id, status, created_at, closed_at) VALUES (1, 1, 'closed', '2026-02-02 08:00:00', '2026-02-02 09:30:00')`,
+		`INSERT INTO pallet_attributes (pallet_id, pallet_type, delivery_reference) VALUES (1, 'EUR', 'DEL-1')`,
+		`INSERT INTO project_phases (id, project_id, name, status, created_by_user_id, closed_by_user_id, closed_at) VALUES (5, 1, 'Wave 1', 'closed', 1, 1, '2026-02-03 10:00:00')`,
+		`INSERT INTO pallet_phases (pallet_id, phase_id) VALUES (1, 5)`,
+		`INSERT INTO stock_items (id, project_id, sku, description) VALUES (4, 1, 'SKU1', 'Widget')`,
+		`INSERT INTO project_custom_fields (id, project_id, key, label, field_type) VALUES (3, 1, 'origin', 'Origin', 'text')`,
+		`INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty, expiry_date, created_at) VALUES (10, 1, 1, 'SKU1', 'Widget', 2, 5, '2027-01-31', '2026-02-02 08:15:00')`,
+		`INSERT INTO receipt_photos (id, pallet_receipt_id, photo_blob, photo_mime, photo_name) VALUES (9, 10, X'FFD8FF00AA', 'image/jpeg', 'a.jpg')`,
+		`INSERT INTO receipt_serials (project_id, pallet_receipt_id, serial, scanned_by_user_id) VALUES (1, 10, 'SN-0001', 2)`,
+		`INSERT INTO internal_photos (source, photo_id, pallet_receipt_id, marked_by_user_id) VALUES ('receipt_photos', 9, 10, 1), ('pallet_receipts', 10, 10, 1)`,
+		`INSERT INTO receipt_custom_values (pallet_receipt_id, field_id, value) VALUES (10, 3, 'UK')`,
+		`INSERT INTO sku_client_comments (project_id, pallet_id, sku, comment, created_by_user_id) VALUES (1, 1, 'SKU1', 'Check seal', 1)`,
+		`INSERT INTO audit_logs (user_id, action, entity_type, entity_id, after_json) VALUES (2, 'receipt.create', 'pallet_receipts', '10', '{"ID":10,"ProjectID":1,"PalletID":1}')`,
+	)
+}
+
+func exportBundle(t *testing.T, db *sqlite.DB, projectID int64) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := Export(context.Background(), db, projectID, &buf); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExportImport_RoundTripRemapsIDs(t *testing.T) {
+	ctx := context.Background()
+	source := openBundleTestDB(t, "source.db")
+	seedSourceProject(t, source)
+	bundle := exportBundle(t, source, 1)
+
+	target := openBundleTestDB(t, "target.db")
+	execAll(t, target,
+		`INSERT INTO users (id, username, password_hash, role) VALUES (7, 'admin', 'x', 'admin')`,
+		`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'Central', 'Existing', '2026-01-01', 'Other', 'central', 'active')`,
+		`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open'), (2, 1, 'open')`,
+	)
+
+	result, err := Import(ctx, target, audit.NewService(), bytes.NewReader(bundle), int64(len(bundle)), ImportOptions{UserID: 7})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if result.ProjectID == 1 {
+		t.Fatalf("expected a new project id, got %d", result.ProjectID)
+	}
+	newPallet := result.PalletIDs[1]
+	if newPallet != 3 {
+		t.Fatalf("expected source pallet 1 to become 3, got %v", result.PalletIDs)
+	}
+	if result.Rows["pallet_receipts"] != 1 || result.Rows["receipt_photos"] != 1 || result.Rows["audit_logs"] != 1 {
+		t.Fatalf("unexpected row counts: %v", result.Rows)
+	}
+
+	var got struct {
+		Code        string `bun:"code"`
+		PalletID    int64  `bun:"pallet_id"`
+		Scanner     string `bun:"scanner"`
+		ScannerHash string `bun:"scanner_hash"`
+		CreatedAt   string `bun:"created_at"`
+		Photo       []byte `bun:"photo_blob"`
+		Custom      string `bun:"custom"`
+		Delivery    string `bun:"delivery_reference"`
+		Commenter   string `bun:"commenter"`
+	}
+	err = target.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT p.code, pr.pallet_id, u.username AS scanner, u.password_hash AS scanner_hash,
+	CAST(pr.created_at AS TEXT) AS created_at, ph.photo_blob, cv.value AS custom,
+	pa.delivery_reference, cu.username AS commenter
+FROM projects p
+JOIN pallet_receipts pr ON pr.project_id = p.id
+JOIN users u ON u.id = pr.scanned_by_user_id
+JOIN receipt_photos ph ON ph.pallet_receipt_id = pr.id
+JOIN receipt_custom_values cv ON cv.pallet_receipt_id = pr.id
+JOIN project_custom_fields f ON f.id = cv.field_id AND f.project_id = p.id
+JOIN pallet_attributes pa ON pa.pallet_id = pr.pallet_id
+JOIN sku_client_comments c ON c.project_id = p.id AND c.pallet_id = pr.pallet_id
+JOIN users cu ON cu.id = c.created_by_user_id
+WHERE p.id = ?`, result.ProjectID).Scan(ctx, &got)
+	})
+	if err != nil {
+		t.Fatalf("load imported project: %v", err)
+	}
+	if got.Code != "acme-inbound" || got.PalletID != newPallet || got.CreatedAt != "2026-02-02 08:15:00" || got.Custom != "UK" || got.Delivery != "DEL-1" {
+		t.Fatalf("unexpected imported data: %+v", got)
+	}
+	if !bytes.Equal(got.Photo, []byte{0xFF, 0xD8, 0xFF, 0x00, 0xAA}) {
+		t.Fatalf("photo blob changed: %x", got.Photo)
+	}
+	if got.Scanner != "site-scanner" || got.ScannerHash != importedPasswordHash {
+		t.Fatalf("expected placeholder scanner user, got %s %s", got.Scanner, got.ScannerHash)
+	}
+	if got.Commenter != "admin" {
+		t.Fatalf("expected comment mapped to existing admin, got %s", got.Commenter)
+	}
+
+	var internal []struct {
+		Source   string `bun:"source"`
+		PhotoID  int64  `bun:"photo_id"`
+		MarkedBy string `bun:"marked_by"`
+	}
+	err = target.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT ip.source, ip.photo_id, u.username AS marked_by
+FROM internal_photos ip
+JOIN pallet_receipts pr ON pr.id = ip.pallet_receipt_id
+JOIN users u ON u.id = ip.marked_by_user_id
+WHERE pr.project_id = ?
+ORDER BY ip.source`, result.ProjectID).Scan(ctx, &internal)
+	})
+	if err != nil {
+		t.Fatalf("load internal photos: %v", err)
+	}
+	var newReceiptID, newPhotoID int64
+	_ = target.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT pr.id, rp.id FROM pallet_receipts pr JOIN receipt_photos rp ON rp.pallet_receipt_id = pr.id WHERE pr.project_id = ?`, result.ProjectID).Scan(ctx, &newReceiptID, &newPhotoID)
+	})
+	if len(internal) != 2 || internal[0].Source != "pallet_receipts" || internal[0].PhotoID != newReceiptID ||
+		internal[1].Source != "receipt_photos" || internal[1].PhotoID != newPhotoID || internal[1].MarkedBy != "admin" {
+		t.Fatalf("expected internal marks remapped to the imported photos, got %+v (receipt %d, photo %d)", internal, newReceiptID, newPhotoID)
+	}
+
+	var serial struct {
+		Serial  string `bun:"serial"`
+		Scanner string `bun:"scanner"`
+	}
+	err = target.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT rs.serial, u.username AS scanner
+FROM receipt_serials rs
+JOIN pallet_receipts pr ON pr.id = rs.pallet_receipt_id AND pr.project_id = rs.project_id
+JOIN users u ON u.id = rs.scanned_by_user_id
+WHERE rs.project_id = ?`, result.ProjectID).Scan(ctx, &serial)
+	})
+	if err != nil || serial.Serial != "SN-0001" || serial.Scanner != "site-scanner" {
+		t.Fatalf("expected serial carried over to the imported line, got %+v err=%v", serial, err)
+	}
+
+	var phases []struct {
+		Name     string `bun:"name"`
+		Status   string `bun:"status"`
+		PalletID int64  `bun:"pallet_id"`
+		ClosedBy string `bun:"closed_by"`
+	}
+	err = target.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT ph.name, ph.status, pp.pallet_id, u.username AS closed_by
+FROM project_phases ph
+JOIN pallet_phases pp ON pp.phase_id = ph.id
+JOIN users u ON u.id = ph.closed_by_user_id
+WHERE ph.project_id = ?`, result.ProjectID).Scan(ctx, &phases)
+	})
+	if err != nil {
+		t.Fatalf("load phases: %v", err)
+	}
+	if len(phases) != 1 || phases[0].Name != "Wave 1" || phases[0].Status != "closed" || phases[0].PalletID != newPallet || phases[0].ClosedBy != "admin" {
+		t.Fatalf("expected closed phase and its pallet carried over, got %+v", phases)
+	}
+
+	var logs []struct {
+		Action    string `bun:"action"`
+		EntityID  string `bun:"entity_id"`
+		AfterJSON string `bun:"after_json"`
+	}
+	err = target.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT action, entity_id, after_json FROM audit_logs ORDER BY id`).Scan(ctx, &logs)
+	})
+	if err != nil {
+		t.Fatalf("load audit: %v", err)
+	}
+	if len(logs) != 2 || logs[1].Action != "project.import" {
+		t.Fatalf("expected imported log plus project.import, got %+v", logs)
+	}
+	var receiptID int64
+	_ = target.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT id FROM pallet_receipts WHERE project_id = ?`, result.ProjectID).Scan(ctx, &receiptID)
+	})
+	wantJSON := `{"ID":` + strconv.FormatInt(receiptID, 10) + `,"PalletID":3,"ProjectID":` + strconv.FormatInt(result.ProjectID, 10) + `}`
+	if logs[0].EntityID != strconv.FormatInt(receiptID, 10) || logs[0].AfterJSON != wantJSON {
+		t.Fatalf("audit not remapped: %+v want %s", logs[0], wantJSON)
+	}
+
+	if _, err := Import(ctx, target, audit.NewService(), bytes.NewReader(bundle), int64(len(bundle)), ImportOptions{}); !errors.Is(err, ErrProjectCodeExists) {
+		t.Fatalf("expected ErrProjectCodeExists on second import, got %v", err)
+	}
+	if _, err := Import(ctx, target, audit.NewService(), bytes.NewReader(bundle), int64(len(bundle)), ImportOptions{Code: "acme-inbound-2"}); err != nil {
+		t.Fatalf("import with code override: %v", err)
+	}
+}
+
+func TestVerify_RejectsTamperedBundle(t *testing.T) {
+	source := openBundleTestDB(t, "source.db")
+	seedSourceProject(t, source)
+	bundle := exportBundle(t, source, 1)
+
+	if _, _, err := Verify(bytes.NewReader(bundle), int64(len(bundle))); err != nil {
+		t.Fatalf("verify untouched bundle: %v", err)
+	}
+
+	tampered := rewriteBundle(t, bundle, func(name string, data []byte) []byte {
+		if name == "pallet_receipts.json" {
+			return bytes.Replace(data, []byte(`"qty": 5`), []byte(`"qty": 50`), 1)
+		}
+		return data
+	})
+	if _, _, err := Verify(bytes.NewReader(tampered), int64(len(tampered))); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+
+	missing := rewriteBundle(t, bundle, func(name string, data []byte) []byte {
+		if name == "receipt_photos.json" {
+			return nil
+		}
+		return data
+	})
+	if _, _, err := Verify(bytes.NewReader(missing), int64(len(missing))); !errors.Is(err, ErrMissingFile) {
+		t.Fatalf("expected ErrMissingFile, got %v", err)
+	}
+}
+
+func TestImport_AcceptsBundleWithoutOptionalTables(t *testing.T) {
+	source := openBundleTestDB(t, "source.db")
+	seedSourceProject(t, source)
+	bundle := exportBundle(t, source, 1)
+
+	// Bundles from instances older than an optional table neither include
+	// its file nor list it in the manifest.
+	optional := map[string]bool{}
+	for _, tbl := range tables {
+		if tbl.optional {
+			optional[tbl.file()] = true
+		}
+	}
+	older := rewriteBundle(t, bundle, func(name string, data []byte) []byte {
+		switch {
+		case optional[name]:
+			return nil
+		case name == manifestName:
+			var manifest Manifest
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				t.Fatalf("parse manifest: %v", err)
+			}
+			files := manifest.Files[:0]
+			for _, f := range manifest.Files {
+				if !optional[f.Name] {
+					files = append(files, f)
+				}
+			}
+			manifest.Files = files
+			out, _ := json.Marshal(manifest)
+			return out
+		}
+		return data
+	})
+
+	target := openBundleTestDB(t, "target.db")
+	result, err := Import(context.Background(), target, audit.NewService(), bytes.NewReader(older), int64(len(older)), ImportOptions{})
+	if err != nil {
+		t.Fatalf("import older bundle: %v", err)
+	}
+	if result.Rows["pallet_receipts"] != 1 || result.Rows["internal_photos"] != 0 {
+		t.Fatalf("unexpected row counts: %v", result.Rows)
+	}
+}
+
+func TestExport_UnknownProject(t *testing.T) {
+	db := openBundleTestDB(t, "empty.db")
+	if _, err := Export(context.Background(), db, 99, io.Discard); !errors.Is(err, ErrProjectNotFound) {
+		t.Fatalf("expected ErrProjectNotFound, got %v", err)
+	}
+}
+
+// rewriteBundle copies a bundle through edit; returning nil drops the file.
+func rewriteBundle(t *testing.T, bundle []byte, edit func(name string, data []byte) []byte) []byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(bundle), int64(len(bundle)))
+	if err != nil {
+		t.Fatalf("open bundle: %v", err)
+	}
+	var out bytes.Buffer
+	zw := zip.NewWriter(&out)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		data = edit(f.Name, data)
+		if data == nil {
+			continue
+		}
+		fw, _ := zw.Create(f.Name)
+		_, _ = fw.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close bundle: %v", err)
+	}
+	return out.Bytes()
+}
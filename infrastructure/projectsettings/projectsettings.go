@@ -0,0 +1,507 @@
+// Package projectsettings holds the typed per-project behaviour settings.
+// Every key is defined here with its type and built-in default; admins can
+// change the global value, and override it per project. Handlers and db
+// logic read the resolved values through Load or LoadTx.
+package projectsettings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+const (
+	KindBool   = "bool"
+	KindInt    = "int"
+	KindChoice = "choice"
+)
+
+const (
+	// ReceiptMergeMode decides whether a scan matching an existing line adds
+	// to it ("merge") or is always saved as its own line ("separate").
+	ReceiptMergeMode = "receipt.merge_mode"
+	// ReceiptRequireBatch and ReceiptRequireExpiry reject receipts of known
+	// SKUs without a batch number or expiry date.
+	ReceiptRequireBatch  = "receipt.require_batch"
+	ReceiptRequireExpiry = "receipt.require_expiry"
+	// ReceiptMonthExpiry decides which day an expiry entered as a month and
+	// year is saved as: the last of the month ("end") or the first ("start").
+	ReceiptMonthExpiry = "receipt.month_expiry"
+	// PalletMaxLines caps the receipt lines on one pallet; 0 means no limit.
+	PalletMaxLines = "pallet.max_lines"
+	// PalletSLAHours is how long a pallet may stay open after it is
+	// created before it breaches the receiving SLA; 0 turns the SLA off.
+	PalletSLAHours = "pallet.sla_hours"
+	// PalletUnusedCancelDays is how many days a created pallet may stay
+	// without lines before it is cancelled automatically; 0 keeps them.
+	PalletUnusedCancelDays = "pallet.unused_cancel_days"
+	// PalletDailyCapacity is how many pallets the dock can receive in a
+	// day, shown against each day on the calendar; 0 hides the indicator.
+	PalletDailyCapacity = "pallet.daily_capacity"
+	// PalletVerifyBeforeClose has every line re-scanned by carton barcode
+	// before a pallet can be closed.
+	PalletVerifyBeforeClose = "pallet.verify_before_close"
+	// CustomsCountryOfOrigin and CustomsHSCode decide whether receipt lines
+	// capture a country of origin and an HS commodity code: "off",
+	// "optional" or "required".
+	CustomsCountryOfOrigin = "customs.country_of_origin"
+	CustomsHSCode          = "customs.hs_code"
+	// PhotoRetentionDays is how long receipt photos are kept before they are
+	// deleted automatically; 0 keeps them.
+	PhotoRetentionDays = "photos.retention_days"
+	// PhotoMaxDimension is the longest side, in pixels, of receipt photos.
+	// The camera scales captures down to it before upload and larger photos
+	// are refused; 0 keeps the full resolution.
+	PhotoMaxDimension = "photos.max_dimension"
+	// PhotoQuality is the JPEG quality the camera saves captures at: "high",
+	// "medium" or "low".
+	PhotoQuality = "photos.quality"
+	// PhotoMaxPerLine is the most photos one receipt line may hold, and
+	// PhotoQuotaMB the photo storage a project may use in megabytes; 0
+	// means no limit.
+	PhotoMaxPerLine = "photos.max_per_line"
+	PhotoQuotaMB    = "photos.quota_mb"
+	// AccessLogRetentionDays is how long client views stay in the project's
+	// access log; 0 keeps them.
+	AccessLogRetentionDays = "access_log.retention_days"
+	// SecurityStepUp asks for the user's password or kiosk PIN again before
+	// a closed label is printed or a pallet is cancelled.
+	SecurityStepUp = "security.step_up"
+	// SecurityStepUpMinutes is how long a re-authentication lasts before it
+	// is asked for again; 0 asks every time.
+	SecurityStepUpMinutes = "security.step_up_minutes"
+
+	MergeModeMerge    = "merge"
+	MergeModeSeparate = "separate"
+
+	MonthExpiryEnd   = "end"
+	MonthExpiryStart = "start"
+
+	CustomsOff      = "off"
+	CustomsOptional = "optional"
+	CustomsRequired = "required"
+
+	PhotoQualityHigh   = "high"
+	PhotoQualityMedium = "medium"
+	PhotoQualityLow    = "low"
+)
+
+// Sources of a resolved value.
+const (
+	SourceDefault = "default"
+	SourceGlobal  = "global"
+	SourceProject = "project"
+)
+
+var (
+	ErrUnknownKey = errors.New("unknown setting")
+	ErrInvalid    = errors.New("invalid setting value")
+
+	// ErrRule is wrapped by every error returned when a receipt breaks a
+	// project rule, so handlers can show the message to the user.
+	ErrRule = errors.New("project rule")
+)
+
+// Definition describes one setting.
+type Definition struct {
+	Key     string
+	Label   string
+	Help    string
+	Kind    string
+	Default string
+	Choices []string
+}
+
+// Definitions lists every setting in display order.
+var Definitions = []Definition{
+	{
+		Key:     ReceiptMergeMode,
+		Label:   "Merge mode",
+		Help:    "merge adds a repeat scan of the same SKU, batch and expiry to the existing line; separate saves every scan as its own line.",
+		Kind:    KindChoice,
+		Default: MergeModeMerge,
+		Choices: []string{MergeModeMerge, MergeModeSeparate},
+	},
+	{
+		Key:     ReceiptRequireBatch,
+		Label:   "Require batch number",
+		Help:    "Reject receipts of known SKUs without a batch number.",
+		Kind:    KindBool,
+		Default: "false",
+	},
+	{
+		Key:     ReceiptRequireExpiry,
+		Label:   "Require expiry date",
+		Help:    "Reject receipts of known SKUs without an expiry date.",
+		Kind:    KindBool,
+		Default: "false",
+	},
+	{
+		Key:     ReceiptMonthExpiry,
+		Label:   "Month-only expiry",
+		Help:    "end saves an expiry entered as MM/YYYY as the last day of that month; start saves it as the first day.",
+		Kind:    KindChoice,
+		Default: MonthExpiryEnd,
+		Choices: []string{MonthExpiryEnd, MonthExpiryStart},
+	},
+	{
+		Key:     PalletMaxLines,
+		Label:   "Max lines per pallet",
+		Help:    "Refuse new receipt lines once a pallet has this many. 0 means no limit.",
+		Kind:    KindInt,
+		Default: "0",
+	},
+	{
+		Key:     PalletSLAHours,
+		Label:   "Receiving SLA (hours)",
+		Help:    "Pallets should be closed within this many hours of being created. Late pallets are flagged on the progress page and alerted once. 0 turns the SLA off.",
+		Kind:    KindInt,
+		Default: "0",
+	},
+	{
+		Key:     PalletUnusedCancelDays,
+		Label:   "Cancel unused pallets after (days)",
+		Help:    "Cancel created pallets that still have no lines this many days after they were created, such as spare labels from a bulk print. Exempt pallets are kept. 0 keeps them.",
+		Kind:    KindInt,
+		Default: "0",
+	},
+	{
+		Key:     PalletDailyCapacity,
+		Label:   "Daily pallet capacity",
+		Help:    "Pallets the dock can receive in a day. The calendar marks days that reach it. 0 hides the indicator.",
+		Kind:    KindInt,
+		Default: "0",
+	},
+	{
+		Key:     PalletVerifyBeforeClose,
+		Label:   "Verify contents before close",
+		Help:    "Scanners re-scan each carton barcode on the pallet, or the SKU of lines without one, before it can be closed. Lines not scanned since they last changed are highlighted and block the close.",
+		Kind:    KindBool,
+		Default: "false",
+	},
+	{
+		Key:     CustomsCountryOfOrigin,
+		Label:   "Country of origin",
+		Help:    "Capture each line's ISO country of origin for customs. required rejects known SKUs without one; off hides the field.",
+		Kind:    KindChoice,
+		Default: CustomsOff,
+		Choices: []string{CustomsOff, CustomsOptional, CustomsRequired},
+	},
+	{
+		Key:     CustomsHSCode,
+		Label:   "HS commodity code",
+		Help:    "Capture each line's 6, 8 or 10 digit HS code for customs. required rejects known SKUs without one; off hides the field.",
+		Kind:    KindChoice,
+		Default: CustomsOff,
+		Choices: []string{CustomsOff, CustomsOptional, CustomsRequired},
+	},
+	{
+		Key:     PhotoRetentionDays,
+		Label:   "Photo retention (days)",
+		Help:    "Delete receipt photos this many days after they were taken, leaving a stub in the redaction log. 0 keeps photos.",
+		Kind:    KindInt,
+		Default: "0",
+	},
+	{
+		Key:     PhotoMaxDimension,
+		Label:   "Photo max size (pixels)",
+		Help:    "Longest side of receipt photos. The camera scales photos down to it before uploading, and larger uploads are refused. 0 keeps the full resolution.",
+		Kind:    KindInt,
+		Default: "0",
+	},
+	{
+		Key:     PhotoQuality,
+		Label:   "Photo quality",
+		Help:    "JPEG quality the camera saves photos at. Lower quality uploads faster over slow connections.",
+		Kind:    KindChoice,
+		Default: PhotoQualityHigh,
+		Choices: []string{PhotoQualityHigh, PhotoQualityMedium, PhotoQualityLow},
+	},
+	{
+		Key:     PhotoMaxPerLine,
+		Label:   "Max photos per line",
+		Help:    "Refuse photos that would take a receipt line past this many. 0 means no limit.",
+		Kind:    KindInt,
+		Default: "0",
+	},
+	{
+		Key:     PhotoQuotaMB,
+		Label:   "Photo storage quota (MB)",
+		Help:    "Refuse new photos once the project's photos use this much storage. Admins are notified at 80%. Photos in cold storage do not count. 0 means no limit.",
+		Kind:    KindInt,
+		Default: "0",
+	},
+	{
+		Key:     AccessLogRetentionDays,
+		Label:   "Client access log retention (days)",
+		Help:    "Delete client page views, exports and photo views from the access log this many days after they happened. 0 keeps them.",
+		Kind:    KindInt,
+		Default: "365",
+	},
+	{
+		Key:     SecurityStepUp,
+		Label:   "Re-authenticate for closed labels and cancels",
+		Help:    "Ask for the user's password or kiosk PIN again before printing a closed pallet label or cancelling a pallet.",
+		Kind:    KindBool,
+		Default: "false",
+	},
+	{
+		Key:     SecurityStepUpMinutes,
+		Label:   "Re-authentication lasts (minutes)",
+		Help:    "How long a re-authentication covers further prints and cancels before it is asked for again. 0 asks every time.",
+		Kind:    KindInt,
+		Default: "5",
+	},
+}
+
+// Lookup returns the definition for key.
+func Lookup(key string) (Definition, bool) {
+	for _, def := range Definitions {
+		if def.Key == key {
+			return def, true
+		}
+	}
+	return Definition{}, false
+}
+
+// Normalize checks raw against the definition's type and returns the value
+// as stored.
+func (d Definition) Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	switch d.Kind {
+	case KindBool:
+		switch strings.ToLower(raw) {
+		case "true", "1", "yes", "on":
+			return "true", nil
+		case "false", "0", "no", "off":
+			return "false", nil
+		}
+		return "", fmt.Errorf("%w: %s must be true or false", ErrInvalid, d.Label)
+	case KindInt:
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || v < 0 {
+			return "", fmt.Errorf("%w: %s must be a whole number of 0 or more", ErrInvalid, d.Label)
+		}
+		return strconv.FormatInt(v, 10), nil
+	case KindChoice:
+		raw = strings.ToLower(raw)
+		for _, choice := range d.Choices {
+			if raw == choice {
+				return raw, nil
+			}
+		}
+		return "", fmt.Errorf("%w: %s must be one of %s", ErrInvalid, d.Label, strings.Join(d.Choices, ", "))
+	}
+	return "", ErrUnknownKey
+}
+
+// Settings are the resolved values for one project.
+type Settings struct {
+	values  map[string]string
+	sources map[string]string
+}
+
+// String returns the resolved value of key, or "" for unknown keys.
+func (s Settings) String(key string) string {
+	if v, ok := s.values[key]; ok {
+		return v
+	}
+	def, _ := Lookup(key)
+	return def.Default
+}
+
+func (s Settings) Bool(key string) bool {
+	return s.String(key) == "true"
+}
+
+func (s Settings) Int(key string) int64 {
+	v, _ := strconv.ParseInt(s.String(key), 10, 64)
+	return v
+}
+
+// Source reports where the value of key came from.
+func (s Settings) Source(key string) string {
+	if src, ok := s.sources[key]; ok {
+		return src
+	}
+	return SourceDefault
+}
+
+// Defaults returns the built-in defaults, for callers without a project.
+func Defaults() Settings {
+	return Settings{}
+}
+
+func Load(ctx context.Context, db *sqlite.DB, projectID int64) (Settings, error) {
+	var settings Settings
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		settings, err = LoadTx(ctx, tx, projectID)
+		return err
+	})
+	return settings, err
+}
+
+// LoadTx resolves the project's settings inside an existing transaction.
+// A projectID of 0 resolves the global values only.
+func LoadTx(ctx context.Context, tx bun.Tx, projectID int64) (Settings, error) {
+	settings := Settings{values: make(map[string]string), sources: make(map[string]string)}
+	rows := make([]struct {
+		Key    string `bun:"key"`
+		Value  string `bun:"value"`
+		Source string `bun:"source"`
+	}, 0)
+	if err := tx.NewRaw(`
+SELECT key, value, 'global' AS source FROM global_settings
+UNION ALL
+SELECT key, value, 'project' AS source FROM project_settings WHERE project_id = ?`, projectID).Scan(ctx, &rows); err != nil {
+		return settings, err
+	}
+	for _, row := range rows {
+		def, ok := Lookup(row.Key)
+		if !ok {
+			continue
+		}
+		value, err := def.Normalize(row.Value)
+		if err != nil {
+			continue
+		}
+		if row.Source == SourceGlobal && settings.sources[row.Key] == SourceProject {
+			continue
+		}
+		settings.values[row.Key] = value
+		settings.sources[row.Key] = row.Source
+	}
+	return settings, nil
+}
+
+// RawGlobal returns the stored global values, without defaults.
+func RawGlobal(ctx context.Context, db *sqlite.DB) (map[string]string, error) {
+	return loadRaw(ctx, db, 0)
+}
+
+// RawProject returns the project's stored overrides, without inherited values.
+func RawProject(ctx context.Context, db *sqlite.DB, projectID int64) (map[string]string, error) {
+	return loadRaw(ctx, db, projectID)
+}
+
+func loadRaw(ctx context.Context, db *sqlite.DB, projectID int64) (map[string]string, error) {
+	var values map[string]string
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		values, err = loadRawTx(ctx, tx, projectID)
+		return err
+	})
+	return values, err
+}
+
+func loadRawTx(ctx context.Context, tx bun.Tx, projectID int64) (map[string]string, error) {
+	values := make(map[string]string)
+	rows := make([]struct {
+		Key   string `bun:"key"`
+		Value string `bun:"value"`
+	}, 0)
+	var err error
+	if projectID > 0 {
+		err = tx.NewRaw(`SELECT key, value FROM project_settings WHERE project_id = ?`, projectID).Scan(ctx, &rows)
+	} else {
+		err = tx.NewRaw(`SELECT key, value FROM global_settings`).Scan(ctx, &rows)
+	}
+	for _, row := range rows {
+		values[row.Key] = row.Value
+	}
+	return values, err
+}
+
+// SaveGlobal stores the global values. A blank value goes back to the
+// built-in default.
+func SaveGlobal(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID int64, values map[string]string) error {
+	return save(ctx, db, auditSvc, actorUserID, 0, values)
+}
+
+// SaveProject stores the project's overrides. A blank value inherits the
+// global value again.
+func SaveProject(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID, projectID int64, values map[string]string) error {
+	if projectID <= 0 {
+		return fmt.Errorf("invalid project id")
+	}
+	return save(ctx, db, auditSvc, actorUserID, projectID, values)
+}
+
+func save(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID, projectID int64, values map[string]string) error {
+	normalized := make(map[string]string, len(values))
+	for key, raw := range values {
+		def, ok := Lookup(key)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownKey, key)
+		}
+		if strings.TrimSpace(raw) == "" {
+			normalized[key] = ""
+			continue
+		}
+		value, err := def.Normalize(raw)
+		if err != nil {
+			return err
+		}
+		normalized[key] = value
+	}
+
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		before, err := loadRawTx(ctx, tx, projectID)
+		if err != nil {
+			return err
+		}
+		after := make(map[string]string, len(before))
+		for key, value := range before {
+			after[key] = value
+		}
+		for key, value := range normalized {
+			if value == "" {
+				delete(after, key)
+			} else {
+				after[key] = value
+			}
+			if err := writeValue(ctx, tx, actorUserID, projectID, key, value); err != nil {
+				return err
+			}
+		}
+		if projectID > 0 {
+			return auditSvc.Write(ctx, tx, actorUserID, "project_settings.update", "projects", strconv.FormatInt(projectID, 10), before, after)
+		}
+		return auditSvc.Write(ctx, tx, actorUserID, "global_settings.update", "global_settings", "global", before, after)
+	})
+}
+
+func writeValue(ctx context.Context, tx bun.Tx, actorUserID, projectID int64, key, value string) error {
+	var err error
+	switch {
+	case projectID > 0 && value == "":
+		_, err = tx.ExecContext(ctx, `DELETE FROM project_settings WHERE project_id = ? AND key = ?`, projectID, key)
+	case projectID > 0:
+		_, err = tx.ExecContext(ctx, `
+INSERT INTO project_settings (project_id, key, value, updated_by_user_id, updated_at)
+VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(project_id, key) DO UPDATE SET
+  value = excluded.value,
+  updated_by_user_id = excluded.updated_by_user_id,
+  updated_at = CURRENT_TIMESTAMP`, projectID, key, value, actorUserID)
+	case value == "":
+		_, err = tx.ExecContext(ctx, `DELETE FROM global_settings WHERE key = ?`, key)
+	default:
+		_, err = tx.ExecContext(ctx, `
+INSERT INTO global_settings (key, value, updated_by_user_id, updated_at)
+VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(key) DO UPDATE SET
+  value = excluded.value,
+  updated_by_user_id = excluded.updated_by_user_id,
+  updated_at = CURRENT_TIMESTAMP`, key, value, actorUserID)
+	}
+	return err
+}
@@ -0,0 +1,128 @@
+package projectsettings
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+)
+
+func openSettingsTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "projectsettings-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	if _, err := db.W.ExecContext(context.Background(), `
+INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'x', 'admin');
+INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+	(1, 'One', 'd', '2026-02-01', 'Acme', 'one', 'active'),
+	(2, 'Two', 'd', '2026-02-01', 'Acme', 'two', 'active');`); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return db
+}
+
+func TestDefinitionNormalize(t *testing.T) {
+	cases := []struct {
+		key     string
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{ReceiptRequireBatch, "on", "true", false},
+		{ReceiptRequireBatch, " FALSE ", "false", false},
+		{ReceiptRequireBatch, "maybe", "", true},
+		{PalletMaxLines, "012", "12", false},
+		{PalletMaxLines, "-1", "", true},
+		{PalletMaxLines, "ten", "", true},
+		{ReceiptMergeMode, "Separate", MergeModeSeparate, false},
+		{ReceiptMergeMode, "squash", "", true},
+	}
+	for _, tc := range cases {
+		def, ok := Lookup(tc.key)
+		if !ok {
+			t.Fatalf("missing definition %s", tc.key)
+		}
+		got, err := def.Normalize(tc.raw)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Fatalf("Normalize(%s, %q) = %q, %v; want %q, err=%v", tc.key, tc.raw, got, err, tc.want, tc.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrInvalid) {
+			t.Fatalf("expected ErrInvalid, got %v", err)
+		}
+	}
+}
+
+func TestLoad_ProjectOverridesGlobalOverridesDefault(t *testing.T) {
+	db := openSettingsTestDB(t)
+	ctx := context.Background()
+	auditSvc := audit.NewService()
+
+	settings, err := Load(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if settings.String(ReceiptMergeMode) != MergeModeMerge || settings.Int(PalletMaxLines) != 0 || settings.Source(PalletMaxLines) != SourceDefault {
+		t.Fatalf("expected built-in defaults, got merge=%s max=%d", settings.String(ReceiptMergeMode), settings.Int(PalletMaxLines))
+	}
+
+	if err := SaveGlobal(ctx, db, auditSvc, 1, map[string]string{PalletMaxLines: "40", ReceiptRequireBatch: "true"}); err != nil {
+		t.Fatalf("save global: %v", err)
+	}
+	if err := SaveProject(ctx, db, auditSvc, 1, 1, map[string]string{PalletMaxLines: "10", ReceiptMergeMode: "separate"}); err != nil {
+		t.Fatalf("save project: %v", err)
+	}
+	if err := SaveProject(ctx, db, auditSvc, 1, 1, map[string]string{"pallet.colour": "red"}); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected unknown key rejected, got %v", err)
+	}
+
+	one, err := Load(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("load project 1: %v", err)
+	}
+	if one.Int(PalletMaxLines) != 10 || one.Source(PalletMaxLines) != SourceProject || !one.Bool(ReceiptRequireBatch) || one.Source(ReceiptRequireBatch) != SourceGlobal || one.String(ReceiptMergeMode) != MergeModeSeparate {
+		t.Fatalf("unexpected project 1 settings: %+v", one)
+	}
+	two, err := Load(ctx, db, 2)
+	if err != nil {
+		t.Fatalf("load project 2: %v", err)
+	}
+	if two.Int(PalletMaxLines) != 40 || two.String(ReceiptMergeMode) != MergeModeMerge {
+		t.Fatalf("expected project 2 to inherit global values, got %+v", two)
+	}
+
+	if err := SaveProject(ctx, db, auditSvc, 1, 1, map[string]string{PalletMaxLines: ""}); err != nil {
+		t.Fatalf("clear override: %v", err)
+	}
+	one, err = Load(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("reload project 1: %v", err)
+	}
+	if one.Int(PalletMaxLines) != 40 || one.String(ReceiptMergeMode) != MergeModeSeparate {
+		t.Fatalf("expected cleared override to inherit global and keep others, got %+v", one)
+	}
+
+	var audits int
+	if err := db.R.QueryRowContext(ctx, `SELECT COUNT(1) FROM audit_logs WHERE action IN ('project_settings.update', 'global_settings.update')`).Scan(&audits); err != nil {
+		t.Fatalf("count audit: %v", err)
+	}
+	if audits != 3 {
+		t.Fatalf("expected 3 audited saves, got %d", audits)
+	}
+}
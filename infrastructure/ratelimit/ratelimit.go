@@ -0,0 +1,264 @@
+// Package ratelimit keeps one token bucket per caller and route class, so a
+// client integration hammering exports or photo streams is slowed down
+// before it starves the single SQLite writer. Each class has its own limit
+// and counters for the admin system page.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Route classes. ClassDefault covers every route not in another class.
+const (
+	ClassExport  = "export"
+	ClassPhoto   = "photo"
+	ClassAPI     = "api"
+	ClassDefault = "default"
+
+	// sweepInterval is how often buckets that have refilled are dropped.
+	sweepInterval = time.Minute
+)
+
+// Classes lists the route classes in display order.
+var Classes = []string{ClassExport, ClassPhoto, ClassAPI, ClassDefault}
+
+// Limit allows Requests per Per window, refilled evenly; a caller may spend
+// the whole window's allowance at once. The zero Limit is unlimited.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// Unlimited reports whether the limit lets every request through.
+func (l Limit) Unlimited() bool {
+	return l.Requests <= 0 || l.Per <= 0
+}
+
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+func (l Limit) String() string {
+	if l.Unlimited() {
+		return "off"
+	}
+	switch l.Per {
+	case time.Second:
+		return fmt.Sprintf("%d/s", l.Requests)
+	case time.Minute:
+		return fmt.Sprintf("%d/m", l.Requests)
+	case time.Hour:
+		return fmt.Sprintf("%d/h", l.Requests)
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Per)
+}
+
+// ParseLimit reads a limit written as "<requests>/<s|m|h>", such as "30/m".
+// "off" and "0" disable the limit.
+func ParseLimit(v string) (Limit, error) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if v == "off" || v == "0" {
+		return Limit{}, nil
+	}
+	count, unit, ok := strings.Cut(v, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("rate limit %q must look like 30/m", v)
+	}
+	requests, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || requests < 0 {
+		return Limit{}, fmt.Errorf("rate limit %q has an invalid request count", v)
+	}
+	var per time.Duration
+	switch strings.TrimSpace(unit) {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return Limit{}, fmt.Errorf("rate limit %q must be per s, m or h", v)
+	}
+	return Limit{Requests: requests, Per: per}, nil
+}
+
+// DefaultLimits are the limits a server starts with.
+func DefaultLimits() map[string]Limit {
+	return map[string]Limit{
+		ClassExport: {Requests: 30, Per: time.Minute},
+		ClassPhoto:  {Requests: 300, Per: time.Minute},
+		ClassAPI:    {Requests: 120, Per: time.Minute},
+	}
+}
+
+// Decision is the outcome of one request against its bucket.
+type Decision struct {
+	Allowed   bool
+	Unlimited bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until the next request would be allowed; zero
+	// when allowed. Reset is how long until the bucket is full again.
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+// ClassStats are the counters of one route class since the server started.
+type ClassStats struct {
+	Class   string
+	Limit   Limit
+	Allowed int64
+	Limited int64
+	// Callers counts the buckets currently tracked for the class.
+	Callers int
+	// LastLimitedKey and LastLimitedAt identify the most recent caller that
+	// was turned away.
+	LastLimitedKey string
+	LastLimitedAt  time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type counters struct {
+	allowed, limited int64
+	lastKey          string
+	lastAt           time.Time
+}
+
+// Limiter holds the buckets of every caller. It is safe for concurrent use.
+type Limiter struct {
+	mu        sync.Mutex
+	limits    map[string]Limit
+	buckets   map[string]map[string]*bucket
+	counters  map[string]*counters
+	lastSweep time.Time
+}
+
+func New(limits map[string]Limit) *Limiter {
+	l := &Limiter{
+		limits:   make(map[string]Limit),
+		buckets:  make(map[string]map[string]*bucket),
+		counters: make(map[string]*counters),
+	}
+	for class, limit := range limits {
+		l.limits[class] = limit
+	}
+	return l
+}
+
+// SetLimit replaces the limit of a class and forgets its buckets.
+func (l *Limiter) SetLimit(class string, limit Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits[class] = limit
+	delete(l.buckets, class)
+}
+
+// Allow spends one request of key's bucket in class.
+func (l *Limiter) Allow(class, key string, now time.Time) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c := l.counters[class]
+	if c == nil {
+		c = &counters{}
+		l.counters[class] = c
+	}
+	limit := l.limits[class]
+	if limit.Unlimited() {
+		c.allowed++
+		return Decision{Allowed: true, Unlimited: true}
+	}
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	buckets := l.buckets[class]
+	if buckets == nil {
+		buckets = make(map[string]*bucket)
+		l.buckets[class] = buckets
+	}
+	b := buckets[key]
+	burst := float64(limit.Requests)
+	if b == nil {
+		b = &bucket{tokens: burst, updated: now}
+		buckets[key] = b
+	}
+	rate := limit.rate()
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed*rate)
+	}
+	b.updated = now
+
+	d := Decision{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+		c.allowed++
+	} else {
+		d.RetryAfter = secondsDuration((1 - b.tokens) / rate)
+		c.limited++
+		c.lastKey = key
+		c.lastAt = now
+	}
+	d.Remaining = int(math.Floor(b.tokens))
+	d.Reset = secondsDuration((burst - b.tokens) / rate)
+	return d
+}
+
+// sweep drops buckets that have refilled, as they behave like new ones.
+func (l *Limiter) sweep(now time.Time) {
+	l.lastSweep = now
+	for class, buckets := range l.buckets {
+		per := l.limits[class].Per
+		for key, b := range buckets {
+			if now.Sub(b.updated) >= per {
+				delete(buckets, key)
+			}
+		}
+	}
+}
+
+// Stats returns the counters of every class, known classes first.
+func (l *Limiter) Stats() []ClassStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	seen := make(map[string]bool)
+	classes := append([]string(nil), Classes...)
+	for _, class := range Classes {
+		seen[class] = true
+	}
+	extra := make([]string, 0)
+	for class := range l.limits {
+		if !seen[class] {
+			extra = append(extra, class)
+		}
+	}
+	sort.Strings(extra)
+	classes = append(classes, extra...)
+
+	stats := make([]ClassStats, 0, len(classes))
+	for _, class := range classes {
+		s := ClassStats{Class: class, Limit: l.limits[class], Callers: len(l.buckets[class])}
+		if c := l.counters[class]; c != nil {
+			s.Allowed, s.Limited = c.allowed, c.limited
+			s.LastLimitedKey, s.LastLimitedAt = c.lastKey, c.lastAt
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
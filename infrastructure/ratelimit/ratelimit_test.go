@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter_BucketRefillsPerKeyAndClass(t *testing.T) {
+	l := New(map[string]Limit{ClassExport: {Requests: 2, Per: time.Minute}})
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		if d := l.Allow(ClassExport, "user:1", now); !d.Allowed || d.Remaining != 1-i {
+			t.Fatalf("request %d = %+v", i+1, d)
+		}
+	}
+	d := l.Allow(ClassExport, "user:1", now)
+	if d.Allowed || d.RetryAfter != 30*time.Second || d.Reset != time.Minute {
+		t.Fatalf("over limit = %+v, want retry in 30s", d)
+	}
+	if d := l.Allow(ClassExport, "user:2", now); !d.Allowed {
+		t.Fatalf("second user shares the first user's bucket: %+v", d)
+	}
+	if d := l.Allow(ClassPhoto, "user:1", now); !d.Allowed || !d.Unlimited {
+		t.Fatalf("class without a limit = %+v", d)
+	}
+
+	// One token is back after half the window.
+	if d := l.Allow(ClassExport, "user:1", now.Add(30*time.Second)); !d.Allowed || d.Remaining != 0 {
+		t.Fatalf("after refill = %+v", d)
+	}
+
+	stats := l.Stats()
+	if len(stats) != len(Classes) || stats[0].Class != ClassExport {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if stats[0].Allowed != 4 || stats[0].Limited != 1 || stats[0].Callers != 2 || stats[0].LastLimitedKey != "user:1" {
+		t.Fatalf("export stats = %+v", stats[0])
+	}
+
+	// Buckets that have refilled are dropped on the next sweep.
+	l.Allow(ClassExport, "user:3", now.Add(3*time.Minute))
+	if callers := l.Stats()[0].Callers; callers != 1 {
+		t.Fatalf("callers after sweep = %d, want 1", callers)
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	cases := map[string]Limit{
+		"30/m":  {Requests: 30, Per: time.Minute},
+		" 5/S ": {Requests: 5, Per: time.Second},
+		"100/h": {Requests: 100, Per: time.Hour},
+		"off":   {},
+		"0":     {},
+	}
+	for in, want := range cases {
+		got, err := ParseLimit(in)
+		if err != nil || got != want {
+			t.Errorf("ParseLimit(%q) = %+v, %v; want %+v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"30", "x/m", "-1/m", "30/d"} {
+		if _, err := ParseLimit(in); err == nil {
+			t.Errorf("ParseLimit(%q) accepted", in)
+		}
+	}
+	if s := (Limit{Requests: 30, Per: time.Minute}).String(); s != "30/m" {
+		t.Errorf("String() = %q", s)
+	}
+}
@@ -10,6 +10,10 @@ const (
 	RoleAdmin   = "admin"
 	RoleScanner = "scanner"
 	RoleClient  = "client"
+
+	// RoleKiosk is not a user role. Routes registered for it are the only
+	// ones a kiosk session may reach, on top of its user's own role.
+	RoleKiosk = "kiosk"
 )
 
 // Rbac stores route resources in cache.
@@ -0,0 +1,163 @@
+package receipts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/phase"
+	"receipter/infrastructure/sqlite"
+)
+
+const maxReassignReasonLength = 500
+
+var (
+	ErrNoLinesSelected = errors.New("select at least one line")
+	ErrReasonRequired  = errors.New("a reason is required")
+	ErrReasonTooLong   = errors.New("reason must be 500 characters or fewer")
+	ErrScannerNotFound = errors.New("choose an enabled scanner or admin to attribute the lines to")
+	ErrLineNotFound    = errors.New("receipt line not found")
+	ErrPalletNotFound  = errors.New("pallet not found")
+	ErrProjectMismatch = errors.New("pallet is not on this project")
+)
+
+// Reassignment moves the scanned-by attribution of ReceiptIDs, which must
+// all be on ProjectID and, when PalletID is set, on that pallet, to
+// ToUserID. The JSON form is the API request body; the project comes from
+// the URL.
+type Reassignment struct {
+	ProjectID  int64   `json:"-"`
+	PalletID   int64   `json:"palletId"`
+	ReceiptIDs []int64 `json:"receiptIds"`
+	ToUserID   int64   `json:"userId"`
+	Reason     string  `json:"reason"`
+}
+
+// Attribution is who a receipt line is credited to, as audited by a
+// reassignment.
+type Attribution struct {
+	ScannedByUserID int64  `bun:"scanned_by_user_id" json:"scanned_by_user_id"`
+	ScannedBy       string `bun:"scanned_by" json:"scanned_by"`
+	Reason          string `bun:"-" json:"reason,omitempty"`
+}
+
+// ReassignScannedBy credits the lines to another user, for when a scan was
+// made under a colleague's session. Reports and exports read scanned_by
+// live, so they follow straight away. Each changed line gets an audit entry
+// holding the original attribution; lines already credited to the user are
+// left alone. Lines on a pallet of a closed phase are refused with
+// phase.ErrClosed. It returns how many lines changed.
+func ReassignScannedBy(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID int64, in Reassignment) (int, error) {
+	in.Reason = strings.TrimSpace(in.Reason)
+	ids := uniqueIDs(in.ReceiptIDs)
+	switch {
+	case len(ids) == 0:
+		return 0, ErrNoLinesSelected
+	case in.Reason == "":
+		return 0, ErrReasonRequired
+	case len([]rune(in.Reason)) > maxReassignReasonLength:
+		return 0, ErrReasonTooLong
+	}
+
+	changed := 0
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if in.PalletID > 0 {
+			var projectID int64
+			err := tx.NewRaw(`SELECT project_id FROM pallets WHERE id = ?`, in.PalletID).Scan(ctx, &projectID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrPalletNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if projectID != in.ProjectID {
+				return ErrProjectMismatch
+			}
+		}
+
+		var to Attribution
+		err := tx.NewRaw(`
+SELECT id AS scanned_by_user_id, username AS scanned_by
+FROM users
+WHERE id = ? AND role IN ('admin', 'scanner') AND disabled_at IS NULL`, in.ToUserID).Scan(ctx, &to)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrScannerNotFound
+		}
+		if err != nil {
+			return err
+		}
+		to.Reason = in.Reason
+
+		var lines []struct {
+			ID       int64 `bun:"id"`
+			PalletID int64 `bun:"pallet_id"`
+			Attribution
+		}
+		if err := tx.NewRaw(`
+SELECT pr.id, pr.pallet_id, pr.scanned_by_user_id, COALESCE(u.username, '') AS scanned_by
+FROM pallet_receipts pr
+LEFT JOIN users u ON u.id = pr.scanned_by_user_id
+WHERE pr.project_id = ? AND pr.id IN (?)
+ORDER BY pr.id`, in.ProjectID, bun.In(ids)).Scan(ctx, &lines); err != nil {
+			return err
+		}
+		if len(lines) != len(ids) {
+			return ErrLineNotFound
+		}
+
+		checked := make(map[int64]bool)
+		for _, line := range lines {
+			if in.PalletID > 0 && line.PalletID != in.PalletID {
+				return ErrLineNotFound
+			}
+			if checked[line.PalletID] {
+				continue
+			}
+			if err := phase.CheckPalletTx(ctx, tx, line.PalletID); err != nil {
+				return err
+			}
+			checked[line.PalletID] = true
+		}
+
+		now := time.Now().UTC()
+		for _, line := range lines {
+			if line.ScannedByUserID == to.ScannedByUserID {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE pallet_receipts SET scanned_by_user_id = ?, updated_at = ? WHERE id = ?`, to.ScannedByUserID, now, line.ID); err != nil {
+				return err
+			}
+			changed++
+			if auditSvc == nil {
+				continue
+			}
+			if err := auditSvc.Write(ctx, tx, actorUserID, "receipt.reassign_scanned_by", "pallet_receipts", strconv.FormatInt(line.ID, 10), line.Attribution, to); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return changed, nil
+}
+
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	out := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id <= 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, id)
+	}
+	return out
+}
@@ -0,0 +1,159 @@
+package receipts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/phase"
+	"receipter/infrastructure/sqlite"
+)
+
+func openAttributionTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "attribution-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	if _, err := db.W.ExecContext(context.Background(), `
+INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES
+  (1, 'PO 100', 'd', '2026-01-01', 'Acme', 'po-100', 'active'),
+  (2, 'PO 200', 'd', '2026-01-01', 'Acme', 'po-200', 'active');
+INSERT INTO users (id, username, password_hash, role, client_project_id) VALUES
+  (1, 'admin', 'hash', 'admin', NULL),
+  (2, 'alice', 'hash', 'scanner', NULL),
+  (3, 'bob', 'hash', 'scanner', NULL),
+  (4, 'buyer', 'hash', 'client', 1);
+INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'closed'), (2, 1, 'open'), (3, 2, 'open');
+INSERT INTO pallet_receipts (id, project_id, pallet_id, sku, description, scanned_by_user_id, qty) VALUES
+  (1, 1, 1, 'SKU-A', 'Alpha', 2, 10),
+  (2, 1, 1, 'SKU-B', 'Bravo', 3, 4),
+  (3, 1, 2, 'SKU-C', 'Charlie', 2, 2),
+  (4, 2, 3, 'SKU-D', 'Delta', 2, 1);
+`); err != nil {
+		t.Fatalf("seed data: %v", err)
+	}
+	return db
+}
+
+func TestReassignScannedBy_CreditsLinesAndAuditsOriginal(t *testing.T) {
+	db := openAttributionTestDB(t)
+	ctx := context.Background()
+
+	changed, err := ReassignScannedBy(ctx, db, audit.NewService(), 1, Reassignment{
+		ProjectID:  1,
+		PalletID:   1,
+		ReceiptIDs: []int64{1, 2, 1},
+		ToUserID:   3,
+		Reason:     "  Scanned on alice's handheld  ",
+	})
+	if err != nil {
+		t.Fatalf("reassign: %v", err)
+	}
+	// Line 2 was already bob's.
+	if changed != 1 {
+		t.Fatalf("changed = %d, want 1", changed)
+	}
+
+	var scannedBy []int64
+	if err := db.R.NewRaw(`SELECT scanned_by_user_id FROM pallet_receipts ORDER BY id`).Scan(ctx, &scannedBy); err != nil {
+		t.Fatalf("load lines: %v", err)
+	}
+	if len(scannedBy) != 4 || scannedBy[0] != 3 || scannedBy[1] != 3 || scannedBy[2] != 2 || scannedBy[3] != 2 {
+		t.Fatalf("scanned_by = %v", scannedBy)
+	}
+
+	var entry struct {
+		UserID     int64  `bun:"user_id"`
+		EntityID   string `bun:"entity_id"`
+		BeforeJSON string `bun:"before_json"`
+		AfterJSON  string `bun:"after_json"`
+	}
+	if err := db.R.NewRaw(`SELECT user_id, entity_id, before_json, after_json FROM audit_logs WHERE action = 'receipt.reassign_scanned_by'`).Scan(ctx, &entry); err != nil {
+		t.Fatalf("load audit: %v", err)
+	}
+	var before, after Attribution
+	if err := json.Unmarshal([]byte(entry.BeforeJSON), &before); err != nil {
+		t.Fatalf("decode before: %v", err)
+	}
+	if err := json.Unmarshal([]byte(entry.AfterJSON), &after); err != nil {
+		t.Fatalf("decode after: %v", err)
+	}
+	if entry.UserID != 1 || entry.EntityID != "1" {
+		t.Fatalf("audit entry = %+v", entry)
+	}
+	if before.ScannedByUserID != 2 || before.ScannedBy != "alice" || before.Reason != "" {
+		t.Fatalf("audited before = %+v", before)
+	}
+	if after.ScannedByUserID != 3 || after.ScannedBy != "bob" || after.Reason != "Scanned on alice's handheld" {
+		t.Fatalf("audited after = %+v", after)
+	}
+}
+
+func TestReassignScannedBy_Refusals(t *testing.T) {
+	db := openAttributionTestDB(t)
+	ctx := context.Background()
+
+	cases := []struct {
+		name string
+		in   Reassignment
+		want error
+	}{
+		{"no lines", Reassignment{ProjectID: 1, ToUserID: 3, Reason: "r"}, ErrNoLinesSelected},
+		{"no reason", Reassignment{ProjectID: 1, ReceiptIDs: []int64{1}, ToUserID: 3, Reason: " "}, ErrReasonRequired},
+		{"client user", Reassignment{ProjectID: 1, ReceiptIDs: []int64{1}, ToUserID: 4, Reason: "r"}, ErrScannerNotFound},
+		{"unknown user", Reassignment{ProjectID: 1, ReceiptIDs: []int64{1}, ToUserID: 99, Reason: "r"}, ErrScannerNotFound},
+		{"other project's line", Reassignment{ProjectID: 1, ReceiptIDs: []int64{1, 4}, ToUserID: 3, Reason: "r"}, ErrLineNotFound},
+		{"other pallet's line", Reassignment{ProjectID: 1, PalletID: 1, ReceiptIDs: []int64{3}, ToUserID: 3, Reason: "r"}, ErrLineNotFound},
+		{"other project's pallet", Reassignment{ProjectID: 1, PalletID: 3, ReceiptIDs: []int64{1}, ToUserID: 3, Reason: "r"}, ErrProjectMismatch},
+	}
+	for _, tc := range cases {
+		if _, err := ReassignScannedBy(ctx, db, audit.NewService(), 1, tc.in); !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	var reassigned int
+	if err := db.R.NewRaw(`SELECT COUNT(1) FROM pallet_receipts WHERE scanned_by_user_id = 3`).Scan(ctx, &reassigned); err != nil || reassigned != 1 {
+		t.Fatalf("lines credited to bob = %d, %v; want only the seeded one", reassigned, err)
+	}
+}
+
+func TestReassignScannedBy_RefusesClosedPhasePallet(t *testing.T) {
+	db := openAttributionTestDB(t)
+	ctx := context.Background()
+	if _, err := db.W.ExecContext(ctx, `
+INSERT INTO project_phases (id, project_id, name, status, created_by_user_id) VALUES (1, 1, 'Wave 1', 'closed', 1);
+INSERT INTO pallet_phases (pallet_id, phase_id) VALUES (1, 1);`); err != nil {
+		t.Fatalf("seed phase: %v", err)
+	}
+
+	in := Reassignment{ProjectID: 1, ReceiptIDs: []int64{1, 3}, ToUserID: 3, Reason: "Scanned on alice's handheld"}
+	if _, err := ReassignScannedBy(ctx, db, audit.NewService(), 1, in); !errors.Is(err, phase.ErrClosed) {
+		t.Fatalf("expected closed phase refused, got %v", err)
+	}
+	var reassigned int
+	if err := db.R.NewRaw(`SELECT COUNT(1) FROM pallet_receipts WHERE scanned_by_user_id = 3`).Scan(ctx, &reassigned); err != nil || reassigned != 1 {
+		t.Fatalf("lines credited to bob = %d, %v; want only the seeded one", reassigned, err)
+	}
+
+	in.ReceiptIDs = []int64{3}
+	if changed, err := ReassignScannedBy(ctx, db, audit.NewService(), 1, in); err != nil || changed != 1 {
+		t.Fatalf("expected the open pallet's line reassigned, got %d, %v", changed, err)
+	}
+}
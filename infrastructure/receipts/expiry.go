@@ -0,0 +1,64 @@
+package receipts
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Expiries further from the receipt date than these are usually typing
+// mistakes, so they are refused unless the scanner confirms them.
+const (
+	MaxExpiryPastYears  = 1
+	MaxExpiryAheadYears = 10
+)
+
+var (
+	ErrInvalidExpiry     = errors.New("invalid expiry date")
+	ErrImplausibleExpiry = errors.New("expiry date is outside the usual range")
+)
+
+var (
+	dateLayouts      = []string{"2006-01-02", "2/1/2006", "2.1.2006"}
+	monthYearLayouts = []string{"2006-01", "1/2006", "1/06", "1.2006"}
+)
+
+// ParseExpiry reads an expiry as a full date (YYYY-MM-DD or DD/MM/YYYY) or
+// as a month and year (MM/YYYY, MM/YY or YYYY-MM), as printed on many packs.
+// A month and year becomes the last day of the month when endOfMonth is set,
+// otherwise the first. Blank input is no expiry.
+func ParseExpiry(raw string, endOfMonth bool) (*time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return &t, nil
+		}
+	}
+	for _, layout := range monthYearLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			if endOfMonth {
+				t = t.AddDate(0, 1, -1)
+			}
+			return &t, nil
+		}
+	}
+	return nil, ErrInvalidExpiry
+}
+
+// CheckExpiryRange reports ErrImplausibleExpiry when expiry is more than
+// MaxExpiryPastYears before now or MaxExpiryAheadYears after it.
+func CheckExpiryRange(expiry, now time.Time) error {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	day := time.Date(expiry.Year(), expiry.Month(), expiry.Day(), 0, 0, 0, 0, time.UTC)
+	switch {
+	case day.Before(today.AddDate(-MaxExpiryPastYears, 0, 0)):
+		return fmt.Errorf("%w: %s is more than %d year ago", ErrImplausibleExpiry, day.Format("02/01/2006"), MaxExpiryPastYears)
+	case day.After(today.AddDate(MaxExpiryAheadYears, 0, 0)):
+		return fmt.Errorf("%w: %s is more than %d years ahead", ErrImplausibleExpiry, day.Format("02/01/2006"), MaxExpiryAheadYears)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package receipts
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseExpiry_FullDatesAndMonthYear(t *testing.T) {
+	cases := []struct {
+		raw        string
+		endOfMonth bool
+		want       string
+	}{
+		{"2027-03-15", true, "2027-03-15"},
+		{"15/03/2027", true, "2027-03-15"},
+		{"5/3/2027", true, "2027-03-05"},
+		{"15.03.2027", true, "2027-03-15"},
+		{"02/2028", true, "2028-02-29"},
+		{"2/2027", true, "2027-02-28"},
+		{"12/27", true, "2027-12-31"},
+		{"2027-04", true, "2027-04-30"},
+		{"04/2027", false, "2027-04-01"},
+	}
+	for _, tc := range cases {
+		got, err := ParseExpiry(tc.raw, tc.endOfMonth)
+		if err != nil {
+			t.Fatalf("ParseExpiry(%q): %v", tc.raw, err)
+		}
+		if got == nil || got.Format("2006-01-02") != tc.want {
+			t.Fatalf("ParseExpiry(%q, %v) = %v, want %s", tc.raw, tc.endOfMonth, got, tc.want)
+		}
+	}
+
+	if got, err := ParseExpiry("  ", true); err != nil || got != nil {
+		t.Fatalf("blank expiry = %v, %v; want none", got, err)
+	}
+	for _, raw := range []string{"not-a-date", "13/2027", "31/02/2027"} {
+		if _, err := ParseExpiry(raw, true); !errors.Is(err, ErrInvalidExpiry) {
+			t.Fatalf("ParseExpiry(%q) error = %v, want ErrInvalidExpiry", raw, err)
+		}
+	}
+}
+
+func TestCheckExpiryRange(t *testing.T) {
+	now := time.Date(2026, 10, 16, 14, 0, 0, 0, time.UTC)
+	for _, ok := range []time.Time{
+		time.Date(2025, 10, 16, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2036, 10, 16, 0, 0, 0, 0, time.UTC),
+	} {
+		if err := CheckExpiryRange(ok, now); err != nil {
+			t.Fatalf("CheckExpiryRange(%s) = %v, want ok", ok.Format("2006-01-02"), err)
+		}
+	}
+	for _, bad := range []time.Time{
+		time.Date(2025, 10, 15, 0, 0, 0, 0, time.UTC),
+		time.Date(2036, 10, 17, 0, 0, 0, 0, time.UTC),
+	} {
+		if err := CheckExpiryRange(bad, now); !errors.Is(err, ErrImplausibleExpiry) {
+			t.Fatalf("CheckExpiryRange(%s) = %v, want ErrImplausibleExpiry", bad.Format("2006-01-02"), err)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+// Package receipts holds the receipt line rules shared by the web handlers,
+// the API and the import paths: validating a scanned line, splitting off
+// damaged stock, merging into an existing line and keeping the project's
+// stock catalog up to date.
+package receipts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/damage"
+	"receipter/models"
+)
+
+const (
+	// UnknownSKU and UnknownDescription stand in for an item the scanner
+	// could not identify.
+	UnknownSKU         = "UNKNOWN"
+	UnknownDescription = "Unidentifiable item"
+)
+
+// Draft is a receipt line as submitted, before it is saved.
+type Draft struct {
+	SKU          string
+	Description  string
+	UOM          string
+	Comment      string
+	Qty          int64
+	CaseSize     int64
+	UnknownSKU   bool
+	Damaged      bool
+	DamagedQty   int64
+	DamageReason string
+	// HasPhotos reports whether any photo came with the line; unknown SKUs
+	// need one.
+	HasPhotos bool
+}
+
+// Normalize trims the draft, fills in defaults and checks it is a line that
+// can be saved. It does not check the damage reason is active or the
+// project's own rules.
+func (d *Draft) Normalize() error {
+	d.SKU = strings.TrimSpace(d.SKU)
+	d.Description = strings.TrimSpace(d.Description)
+	d.UOM = strings.TrimSpace(d.UOM)
+	d.Comment = strings.TrimSpace(d.Comment)
+	if d.UnknownSKU {
+		if d.SKU == "" {
+			d.SKU = UnknownSKU
+		}
+		if d.Description == "" {
+			d.Description = UnknownDescription
+		}
+	} else if d.SKU == "" {
+		return fmt.Errorf("sku is required")
+	}
+	if d.UnknownSKU && !d.HasPhotos {
+		return fmt.Errorf("unknown sku requires at least one photo")
+	}
+	if d.Qty <= 0 {
+		return fmt.Errorf("qty must be greater than 0")
+	}
+	if d.CaseSize <= 0 {
+		d.CaseSize = 1
+	}
+	if d.DamagedQty < 0 {
+		return fmt.Errorf("damaged qty must be 0 or greater")
+	}
+	if d.Damaged && d.DamagedQty <= 0 {
+		return fmt.Errorf("damaged qty is required when damaged is selected")
+	}
+	if d.DamagedQty > d.Qty {
+		return fmt.Errorf("damaged qty cannot exceed qty")
+	}
+	d.DamageReason = damage.NormalizeCode(d.DamageReason)
+	if d.DamagedQty > 0 && d.DamageReason == "" {
+		return damage.ErrReasonRequired
+	}
+	if d.DamagedQty == 0 {
+		d.DamageReason = ""
+	}
+	return nil
+}
+
+// Segment is the part of a scanned quantity saved as one line.
+type Segment struct {
+	Qty     int64
+	Damaged bool
+}
+
+// Split separates the damaged part of a scanned quantity, so good and
+// damaged stock land on their own lines. The good segment comes first.
+func Split(qty, damagedQty int64) []Segment {
+	segments := make([]Segment, 0, 2)
+	if good := qty - damagedQty; good > 0 {
+		segments = append(segments, Segment{Qty: good})
+	}
+	if damagedQty > 0 {
+		segments = append(segments, Segment{Qty: damagedQty, Damaged: true})
+	}
+	return segments
+}
+
+// Merge adds line onto the matching existing line and returns the result.
+// The newer scan wins for the descriptive fields it sets and for who
+// scanned it; the damage state follows line.
+func Merge(existing, line models.PalletReceipt) models.PalletReceipt {
+	merged := existing
+	merged.Qty += line.Qty
+	merged.SKU = line.SKU
+	merged.UOM = line.UOM
+	merged.UnknownSKU = line.UnknownSKU
+	if line.Description != "" || merged.Description == "" {
+		merged.Description = line.Description
+	}
+	if line.Comment != "" {
+		merged.Comment = line.Comment
+	}
+	if line.Damaged {
+		merged.Damaged = true
+		merged.DamagedQty = merged.Qty
+		merged.DamageReason = line.DamageReason
+	} else {
+		merged.Damaged = false
+		merged.DamagedQty = 0
+		merged.DamageReason = ""
+	}
+	merged.ScannedByUserID = line.ScannedByUserID
+	if len(line.StockPhotoBlob) > 0 {
+		merged.StockPhotoBlob = line.StockPhotoBlob
+		merged.StockPhotoMIME = line.StockPhotoMIME
+		merged.StockPhotoName = line.StockPhotoName
+	}
+	return merged
+}
+
+// FindMatch finds the line on palletID that line would merge into if it
+// were scanned there. Lines on a damage claim are never added to.
+func FindMatch(ctx context.Context, tx bun.Tx, palletID int64, line models.PalletReceipt) (models.PalletReceipt, bool, error) {
+	var target models.PalletReceipt
+	query := tx.NewSelect().
+		Model(&target).
+		Where("pallet_id = ?", palletID).
+		Where("sku = ?", line.SKU).
+		Where("uom = ?", line.UOM).
+		Where("case_size = ?", line.CaseSize).
+		Where("unknown_sku = ?", line.UnknownSKU).
+		Where("damaged = ?", line.Damaged).
+		Where("damage_reason = ?", line.DamageReason).
+		Where("COALESCE(batch_number, '') = COALESCE(?, '')", line.BatchNumber).
+		Where("country_of_origin = ?", line.CountryOfOrigin).
+		Where("hs_code = ?", line.HSCode).
+		Where("NOT EXISTS (SELECT 1 FROM damage_claim_lines dcl WHERE dcl.pallet_receipt_id = pr.id)")
+	if line.ExpiryDate == nil {
+		query = query.Where("expiry_date IS NULL")
+	} else {
+		query = query.Where("date(expiry_date) = date(?)", line.ExpiryDate.Format("2006-01-02"))
+	}
+	if err := query.OrderExpr("id ASC").Limit(1).Scan(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return target, false, nil
+		}
+		return target, false, err
+	}
+	return target, true, nil
+}
+
+// catalogChanges applies a scanned description and UOM to a stock item and
+// returns the columns that changed. Blank values never clear the catalog.
+func catalogChanges(stock *models.StockItem, description, uom string) []string {
+	changed := make([]string, 0, 2)
+	if description != "" && stock.Description != description {
+		stock.Description = description
+		changed = append(changed, "description")
+	}
+	if uom != "" && stock.UOM != uom {
+		stock.UOM = uom
+		changed = append(changed, "uom")
+	}
+	return changed
+}
+
+// UpsertCatalog adds the SKU to the project's stock catalog, or refreshes
+// its description and UOM from the latest scan.
+func UpsertCatalog(ctx context.Context, tx bun.Tx, projectID int64, sku, description, uom string) error {
+	sku = strings.TrimSpace(sku)
+	description = strings.TrimSpace(description)
+	uom = strings.TrimSpace(uom)
+	if sku == "" {
+		return nil
+	}
+
+	var stock models.StockItem
+	err := tx.NewSelect().
+		Model(&stock).
+		Where("project_id = ?", projectID).
+		Where("sku = ?", sku).
+		Limit(1).
+		Scan(ctx)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		stock = models.StockItem{
+			ProjectID:   projectID,
+			SKU:         sku,
+			Description: description,
+			UOM:         uom,
+		}
+		_, err := tx.NewInsert().Model(&stock).Exec(ctx)
+		return err
+	}
+
+	updates := catalogChanges(&stock, description, uom)
+	if len(updates) == 0 {
+		return nil
+	}
+	stock.UpdatedAt = time.Now()
+	updates = append(updates, "updated_at")
+	_, err = tx.NewUpdate().Model(&stock).Column(updates...).WherePK().Exec(ctx)
+	return err
+}
+
+// DeleteLine deletes a receipt line together with its photos and any photo
+// uploads still staged for it. The schema cascades these deletes, but only
+// on connections with foreign keys enforced, so they are removed explicitly
+// rather than left for the orphan sweep.
+func DeleteLine(ctx context.Context, tx bun.Tx, receiptID int64) error {
+	for _, stmt := range []string{
+		`DELETE FROM photo_upload_chunks WHERE upload_id IN (SELECT id FROM photo_uploads WHERE pallet_receipt_id = ?)`,
+		`DELETE FROM photo_uploads WHERE pallet_receipt_id = ?`,
+		`DELETE FROM internal_photos WHERE pallet_receipt_id = ?`,
+		`DELETE FROM receipt_photos WHERE pallet_receipt_id = ?`,
+		`DELETE FROM pallet_receipts WHERE id = ?`,
+	} {
+		if _, err := tx.ExecContext(ctx, stmt, receiptID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package receipts
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"receipter/infrastructure/damage"
+	"receipter/models"
+)
+
+func TestDraftNormalize_DefaultsAndRules(t *testing.T) {
+	d := Draft{SKU: "  SKU-1 ", Description: " Widget ", UOM: " EA ", Qty: 3}
+	if err := d.Normalize(); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	if d.SKU != "SKU-1" || d.Description != "Widget" || d.UOM != "EA" || d.CaseSize != 1 {
+		t.Fatalf("normalized draft = %+v", d)
+	}
+
+	unknown := Draft{UnknownSKU: true, Qty: 1, HasPhotos: true}
+	if err := unknown.Normalize(); err != nil {
+		t.Fatalf("normalize unknown: %v", err)
+	}
+	if unknown.SKU != UnknownSKU || unknown.Description != UnknownDescription {
+		t.Fatalf("unknown draft = %+v", unknown)
+	}
+
+	cases := []struct {
+		name  string
+		draft Draft
+		want  string
+	}{
+		{"missing sku", Draft{Qty: 1}, "sku is required"},
+		{"unknown without photo", Draft{UnknownSKU: true, Qty: 1}, "unknown sku requires at least one photo"},
+		{"zero qty", Draft{SKU: "A"}, "qty must be greater than 0"},
+		{"negative damaged", Draft{SKU: "A", Qty: 1, DamagedQty: -1}, "damaged qty must be 0 or greater"},
+		{"damaged without qty", Draft{SKU: "A", Qty: 1, Damaged: true}, "damaged qty is required when damaged is selected"},
+		{"damaged over qty", Draft{SKU: "A", Qty: 1, DamagedQty: 2, DamageReason: "crushed"}, "damaged qty cannot exceed qty"},
+	}
+	for _, tc := range cases {
+		d := tc.draft
+		if err := d.Normalize(); err == nil || err.Error() != tc.want {
+			t.Errorf("%s: got %v, want %q", tc.name, err, tc.want)
+		}
+	}
+
+	noReason := Draft{SKU: "A", Qty: 2, DamagedQty: 1}
+	if err := noReason.Normalize(); !errors.Is(err, damage.ErrReasonRequired) {
+		t.Fatalf("expected ErrReasonRequired, got %v", err)
+	}
+	undamaged := Draft{SKU: "A", Qty: 2, DamageReason: "crushed"}
+	if err := undamaged.Normalize(); err != nil || undamaged.DamageReason != "" {
+		t.Fatalf("undamaged draft kept reason %q (err %v)", undamaged.DamageReason, err)
+	}
+}
+
+func TestSplit_SeparatesDamagedQty(t *testing.T) {
+	cases := []struct {
+		qty, damaged int64
+		want         []Segment
+	}{
+		{5, 0, []Segment{{Qty: 5}}},
+		{5, 2, []Segment{{Qty: 3}, {Qty: 2, Damaged: true}}},
+		{5, 5, []Segment{{Qty: 5, Damaged: true}}},
+	}
+	for _, tc := range cases {
+		if got := Split(tc.qty, tc.damaged); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Split(%d, %d) = %+v, want %+v", tc.qty, tc.damaged, got, tc.want)
+		}
+	}
+}
+
+func TestMerge_AddsQtyAndTakesNewerDetails(t *testing.T) {
+	existing := models.PalletReceipt{
+		ID: 7, SKU: "A", Description: "Old", Comment: "first", Qty: 4,
+		ScannedByUserID: 1, StockPhotoName: "old.jpg",
+	}
+
+	merged := Merge(existing, models.PalletReceipt{SKU: "A", Qty: 3, ScannedByUserID: 2})
+	if merged.ID != 7 || merged.Qty != 7 || merged.ScannedByUserID != 2 {
+		t.Fatalf("merged = %+v", merged)
+	}
+	if merged.Description != "Old" || merged.Comment != "first" || merged.StockPhotoName != "old.jpg" {
+		t.Fatalf("blank fields overwrote existing: %+v", merged)
+	}
+
+	damaged := Merge(existing, models.PalletReceipt{SKU: "A", Description: "New", Qty: 1, Damaged: true, DamageReason: "crushed"})
+	if !damaged.Damaged || damaged.DamagedQty != 5 || damaged.DamageReason != "crushed" || damaged.Description != "New" {
+		t.Fatalf("damaged merge = %+v", damaged)
+	}
+	if existing.Qty != 4 {
+		t.Fatalf("merge changed the existing line: %+v", existing)
+	}
+}
+
+func TestCatalogChanges_BlankValuesKeepCatalog(t *testing.T) {
+	stock := models.StockItem{SKU: "A", Description: "Widget", UOM: "EA"}
+	if changed := catalogChanges(&stock, "", ""); len(changed) != 0 {
+		t.Fatalf("blank scan changed %v", changed)
+	}
+	if changed := catalogChanges(&stock, "Widget", "CS"); !reflect.DeepEqual(changed, []string{"uom"}) || stock.UOM != "CS" {
+		t.Fatalf("changed = %v, stock = %+v", changed, stock)
+	}
+}
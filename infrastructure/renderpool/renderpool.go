@@ -0,0 +1,213 @@
+// Package renderpool runs label PDF rendering on a fixed number of workers
+// behind a bounded queue, so a burst of label prints cannot take the CPU
+// that receipt captures need. When the queue is full a render is refused
+// with ErrBusy rather than waiting.
+package renderpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultWorkers   = 2
+	DefaultQueueSize = 8
+
+	// RetryAfter is how long a refused caller is asked to wait.
+	RetryAfter = 5 * time.Second
+)
+
+var (
+	// ErrBusy is returned when every worker is rendering and the queue is full.
+	ErrBusy = errors.New("label printing is busy; try again in a few seconds")
+	// ErrStopped is returned by Do once the pool has been stopped.
+	ErrStopped = errors.New("label printing has stopped")
+)
+
+// A job is claimed exactly once, by the worker that runs it or by the
+// caller that gave up on it while it was still queued.
+const (
+	jobQueued int32 = iota
+	jobRunning
+	jobAbandoned
+)
+
+type job struct {
+	ctx   context.Context
+	fn    func() error
+	state *atomic.Int32
+	done  chan error
+}
+
+// Stats describes the pool for the admin system page.
+type Stats struct {
+	Workers   int
+	QueueSize int
+	Running   int64
+	Queued    int64
+	Completed int64
+	Refused   int64
+}
+
+// Pool runs render jobs. Workers and QueueSize are read by Start; a pool
+// that has not been started, or a nil pool, renders on the caller.
+type Pool struct {
+	Workers   int
+	QueueSize int
+
+	jobs      chan job
+	stop      chan struct{}
+	mu        sync.RWMutex
+	stopped   bool
+	wg        sync.WaitGroup
+	once      sync.Once
+	started   atomic.Bool
+	running   atomic.Int64
+	queued    atomic.Int64
+	completed atomic.Int64
+	refused   atomic.Int64
+}
+
+// New returns a pool with the default limits.
+func New() *Pool {
+	return &Pool{
+		Workers:   DefaultWorkers,
+		QueueSize: DefaultQueueSize,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Start runs the workers until Stop.
+func (p *Pool) Start() {
+	if p.Workers < 1 {
+		p.Workers = 1
+	}
+	if p.QueueSize < 0 {
+		p.QueueSize = 0
+	}
+	p.jobs = make(chan job, p.QueueSize)
+	for i := 0; i < p.Workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	p.started.Store(true)
+}
+
+// Stop ends the workers once the jobs already queued have run.
+func (p *Pool) Stop() {
+	p.once.Do(func() {
+		p.mu.Lock()
+		p.stopped = true
+		p.mu.Unlock()
+		close(p.stop)
+	})
+	if !p.started.Load() {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for {
+		select {
+		case j := <-p.jobs:
+			p.run(j)
+		case <-p.stop:
+			for {
+				select {
+				case j := <-p.jobs:
+					p.run(j)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (p *Pool) run(j job) {
+	p.queued.Add(-1)
+	// A caller that gave up while queued no longer wants its render.
+	if !j.state.CompareAndSwap(jobQueued, jobRunning) {
+		return
+	}
+	if err := j.ctx.Err(); err != nil {
+		j.done <- err
+		return
+	}
+	p.running.Add(1)
+	err := j.fn()
+	p.running.Add(-1)
+	p.completed.Add(1)
+	j.done <- err
+}
+
+// Do runs fn on a worker and waits for it. It returns ErrBusy at once when
+// the queue is full, ErrStopped once the pool has stopped, and ctx's error
+// if ctx ends while fn is still queued. A render that has started is always
+// waited for, so fn has either returned or never run when Do returns and
+// may safely set the caller's variables.
+func (p *Pool) Do(ctx context.Context, fn func() error) error {
+	if p == nil {
+		return fn()
+	}
+	// Holding the read lock across the enqueue means Stop cannot close the
+	// pool between the check and the send, so every accepted job is in the
+	// queue the workers drain before they exit.
+	p.mu.RLock()
+	if p.stopped {
+		p.mu.RUnlock()
+		return ErrStopped
+	}
+	if !p.started.Load() {
+		p.mu.RUnlock()
+		return fn()
+	}
+	j := job{ctx: ctx, fn: fn, state: new(atomic.Int32), done: make(chan error, 1)}
+	p.queued.Add(1)
+	select {
+	case p.jobs <- j:
+	default:
+		p.mu.RUnlock()
+		p.queued.Add(-1)
+		p.refused.Add(1)
+		return ErrBusy
+	}
+	p.mu.RUnlock()
+	select {
+	case err := <-j.done:
+		return err
+	case <-ctx.Done():
+		if j.state.CompareAndSwap(jobQueued, jobAbandoned) {
+			return ctx.Err()
+		}
+		return <-j.done
+	}
+}
+
+// Stats reports the pool's limits and what it is doing now.
+func (p *Pool) Stats() Stats {
+	if p == nil {
+		return Stats{}
+	}
+	return Stats{
+		Workers:   p.Workers,
+		QueueSize: p.QueueSize,
+		Running:   p.running.Load(),
+		Queued:    p.queued.Load(),
+		Completed: p.completed.Load(),
+		Refused:   p.refused.Load(),
+	}
+}
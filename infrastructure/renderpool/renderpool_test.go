@@ -0,0 +1,146 @@
+package renderpool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDoRefusesOnceWorkersAndQueueAreFull(t *testing.T) {
+	p := &Pool{Workers: 1, QueueSize: 1, stop: make(chan struct{})}
+	p.Start()
+	defer p.Stop()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	results := make(chan error, 2)
+	go func() {
+		results <- p.Do(context.Background(), func() error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+	go func() {
+		results <- p.Do(context.Background(), func() error { return nil })
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for p.Stats().Queued != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a queued render, got %+v", p.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := p.Do(context.Background(), func() error { return nil }); !errors.Is(err, ErrBusy) {
+		t.Fatalf("expected a full pool to refuse, got %v", err)
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Fatalf("expected accepted renders to finish, got %v", err)
+		}
+	}
+	if stats := p.Stats(); stats.Completed != 2 || stats.Refused != 1 || stats.Running != 0 || stats.Queued != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestDoSkipsRendersWhoseCallerHasGone(t *testing.T) {
+	p := &Pool{Workers: 1, QueueSize: 1, stop: make(chan struct{})}
+	p.Start()
+	defer p.Stop()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		_ = p.Do(context.Background(), func() error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	ran := false
+	if err := p.Do(ctx, func() error { ran = true; return nil }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the caller's deadline, got %v", err)
+	}
+	close(release)
+	p.Stop()
+	if ran {
+		t.Fatalf("expected the abandoned render to be skipped")
+	}
+}
+
+func TestDoRendersInlineWithoutAStartedPool(t *testing.T) {
+	var nilPool *Pool
+	for _, p := range []*Pool{nilPool, New()} {
+		ran := false
+		if err := p.Do(context.Background(), func() error { ran = true; return nil }); err != nil || !ran {
+			t.Fatalf("expected an inline render, got ran=%v err=%v", ran, err)
+		}
+	}
+}
+
+func TestDoWaitsForARenderThatHasStarted(t *testing.T) {
+	p := &Pool{Workers: 1, QueueSize: 1, stop: make(chan struct{})}
+	p.Start()
+	defer p.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	started := make(chan struct{})
+	failure := ""
+	result := make(chan error, 1)
+	go func() {
+		result <- p.Do(ctx, func() error {
+			close(started)
+			<-release
+			failure = "render failed"
+			return errors.New(failure)
+		})
+	}()
+	<-started
+	cancel()
+	select {
+	case err := <-result:
+		t.Fatalf("expected Do to wait for the running render, got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if err := <-result; err == nil || err.Error() != "render failed" {
+		t.Fatalf("expected the render's own error, got %v", err)
+	}
+	if failure != "render failed" {
+		t.Fatalf("expected the render's write to be visible, got %q", failure)
+	}
+}
+
+func TestDoRefusesOnceStopped(t *testing.T) {
+	for name, p := range map[string]*Pool{
+		"started":     {Workers: 1, QueueSize: 1, stop: make(chan struct{})},
+		"not started": New(),
+	} {
+		if name == "started" {
+			p.Start()
+		}
+		p.Stop()
+		done := make(chan error, 1)
+		go func() {
+			done <- p.Do(context.Background(), func() error { return nil })
+		}()
+		select {
+		case err := <-done:
+			if !errors.Is(err, ErrStopped) {
+				t.Fatalf("%s: expected ErrStopped, got %v", name, err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: Do hung after Stop", name)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+// Package replymail turns client replies to comment emails into SKU client
+// comments. Every pallet's client comments on a SKU instance form a thread
+// with a token that emails quote as [ref:token], either in the subject or
+// the body, or in a plus address such as comments+token@example.com. The mail
+// provider posts inbound messages to the server, and a reply is only accepted
+// when its sender is the registered address of an enabled client user with
+// access to the thread's project. Because the From header alone can be
+// forged, the provider must also report an SPF or DKIM pass for the message,
+// or it must be sent to the thread's reply address, which carries a second
+// key as in comments+token.key@example.com. Every message is logged with its
+// outcome.
+package replymail
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+// Outcomes recorded for inbound messages.
+const (
+	StatusAccepted = "accepted"
+	StatusRejected = "rejected"
+)
+
+var (
+	refPattern   = regexp.MustCompile(`(?i)\[ref:([0-9a-f]{16})\]`)
+	plusPattern  = regexp.MustCompile(`(?i)\+([0-9a-f]{16})(?:\.([0-9a-f]{16}))?@`)
+	wrotePattern = regexp.MustCompile(`^On .+ wrote:$`)
+)
+
+// Thread identifies one pallet's client comments on a SKU instance.
+type Thread struct {
+	Token     string `bun:"token"`
+	ProjectID int64  `bun:"project_id"`
+	PalletID  int64  `bun:"pallet_id"`
+	SKU       string `bun:"sku"`
+	UOM       string `bun:"uom"`
+	Batch     string `bun:"batch_number"`
+	// ExpiryISO is YYYY-MM-DD, or blank for lines without an expiry.
+	ExpiryISO string `bun:"expiry_date"`
+	// ReplyKey is only part of the thread's reply address. A reply sent to
+	// it is trusted without a provider SPF or DKIM pass.
+	ReplyKey string `bun:"reply_key"`
+}
+
+// Reference is how emails quote a thread token.
+func Reference(token string) string {
+	if token == "" {
+		return ""
+	}
+	return "[ref:" + token + "]"
+}
+
+// EnsureThread returns the token of the thread, creating it on first use.
+func EnsureThread(ctx context.Context, tx bun.Tx, t Thread) (string, error) {
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO client_comment_threads (token, reply_key, project_id, pallet_id, sku, uom, batch_number, expiry_date)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(project_id, pallet_id, sku, uom, batch_number, expiry_date) DO NOTHING`,
+		randomKey(), randomKey(), t.ProjectID, t.PalletID, t.SKU, t.UOM, t.Batch, t.ExpiryISO); err != nil {
+		return "", err
+	}
+	token := ""
+	err := tx.NewRaw(`
+SELECT token FROM client_comment_threads
+WHERE project_id = ? AND pallet_id = ? AND sku = ? AND uom = ? AND batch_number = ? AND expiry_date = ?`,
+		t.ProjectID, t.PalletID, t.SKU, t.UOM, t.Batch, t.ExpiryISO).Scan(ctx, &token)
+	return token, err
+}
+
+func randomKey() string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Message is an inbound email as posted by the mail provider.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	// SPF and DKIM are the provider's verdicts, such as Mailgun's "Pass" or
+	// SendGrid's "{@example.com : pass}". Blank when the provider sent none.
+	SPF  string
+	DKIM string
+}
+
+// Authenticated reports whether the provider passed the message's SPF check,
+// or a DKIM signature for the sender's domain. A DKIM verdict that names no
+// domain counts for any sender.
+func (m Message) Authenticated(sender string) bool {
+	if verdict, _, _ := strings.Cut(strings.TrimSpace(m.SPF), " "); strings.EqualFold(verdict, "pass") {
+		return true
+	}
+	_, domain, _ := strings.Cut(sender, "@")
+	for _, entry := range strings.Split(strings.Trim(strings.TrimSpace(m.DKIM), "{}"), ",") {
+		signer, verdict, found := strings.Cut(entry, ":")
+		if !found {
+			signer, verdict = "", signer
+		}
+		signer = strings.TrimPrefix(strings.TrimSpace(signer), "@")
+		if strings.EqualFold(strings.TrimSpace(verdict), "pass") && (signer == "" || strings.EqualFold(signer, domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindToken returns the thread token a message refers to, or "" when it has
+// none. A [ref:token] in the subject wins over one in the body, which wins
+// over a plus address.
+func FindToken(msg Message) string {
+	for _, s := range []string{msg.Subject, msg.Text} {
+		if m := refPattern.FindStringSubmatch(s); m != nil {
+			return strings.ToLower(m[1])
+		}
+	}
+	if m := plusPattern.FindStringSubmatch(msg.To); m != nil {
+		return strings.ToLower(m[1])
+	}
+	return ""
+}
+
+// FindReplyKey returns the thread reply key in the message's plus address,
+// or "" when it was not sent to a reply address.
+func FindReplyKey(msg Message) string {
+	if m := plusPattern.FindStringSubmatch(msg.To); m != nil {
+		return strings.ToLower(m[2])
+	}
+	return ""
+}
+
+// ReplyText returns the text the sender wrote, without the quoted message,
+// forwarded headers or signature that mail clients append below it.
+func ReplyText(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	kept := make([]string, 0)
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if line == "-- " || wrotePattern.MatchString(trimmed) ||
+			strings.HasPrefix(trimmed, "-----Original Message-----") ||
+			strings.HasPrefix(trimmed, "From:") {
+			break
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+		kept = append(kept, strings.TrimRight(line, " \t"))
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+// CommentFunc adds a client comment to a SKU instance on a pallet.
+type CommentFunc func(ctx context.Context, userID, projectID, palletID int64, sku, uom, batch, expiryISO, comment string) error
+
+// Receiver accepts inbound replies. Secret is the path secret the mail
+// provider posts to; inbound email is off while it is blank. Address is the
+// mailbox the provider receives replies on, such as comments@example.com;
+// thread reply addresses are only shown while it is set.
+type Receiver struct {
+	db         *sqlite.DB
+	Secret     string
+	Address    string
+	addComment CommentFunc
+}
+
+// NewReceiver returns a receiver that adds accepted replies with add.
+func NewReceiver(db *sqlite.DB, add CommentFunc) *Receiver {
+	return &Receiver{db: db, addComment: add}
+}
+
+// ReplyAddress returns the address that replies to the thread are trusted
+// from without a provider SPF or DKIM pass, or "" while Address is unset.
+func (r *Receiver) ReplyAddress(token, replyKey string) string {
+	local, domain, ok := strings.Cut(strings.TrimSpace(r.Address), "@")
+	if !ok || token == "" || replyKey == "" {
+		return ""
+	}
+	return local + "+" + token + "." + replyKey + "@" + domain
+}
+
+// Result is what became of an inbound message.
+type Result struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Receive verifies a message and adds its reply as a client comment on the
+// thread it refers to. Messages that cannot be accepted are rejected with a
+// reason rather than an error; errors are left for storage failures.
+func (r *Receiver) Receive(ctx context.Context, msg Message) (Result, error) {
+	sender := ""
+	if addr, err := mail.ParseAddress(msg.From); err == nil {
+		sender = strings.ToLower(addr.Address)
+	}
+	token := FindToken(msg)
+	userID, reason, err := r.accept(ctx, msg, sender, token)
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{Status: StatusAccepted}
+	if reason != "" {
+		result = Result{Status: StatusRejected, Reason: reason}
+	}
+
+	var userArg any
+	if userID > 0 {
+		userArg = userID
+	}
+	if sender == "" {
+		sender = strings.TrimSpace(msg.From)
+	}
+	_, err = r.db.W.ExecContext(ctx, `
+INSERT INTO inbound_emails (sender, subject, thread_token, status, reason, user_id)
+VALUES (?, ?, ?, ?, ?, ?)`, sender, strings.TrimSpace(msg.Subject), token, result.Status, result.Reason, userArg)
+	return result, err
+}
+
+// accept adds the reply when the message passes every check and otherwise
+// returns why it was rejected, along with the sender's user when known.
+func (r *Receiver) accept(ctx context.Context, msg Message, sender, token string) (int64, string, error) {
+	if sender == "" {
+		return 0, "sender address is missing or invalid", nil
+	}
+	if token == "" {
+		return 0, "message does not reference a comment thread", nil
+	}
+
+	var userID int64
+	var thread Thread
+	hasAccess := false
+	err := r.db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if err := tx.NewRaw(`
+SELECT u.id
+FROM client_reply_addresses a
+JOIN users u ON u.id = a.user_id
+WHERE a.email = ? AND u.role = 'client' AND u.disabled_at IS NULL`, sender).Scan(ctx, &userID); err != nil {
+			return err
+		}
+		if err := tx.NewRaw(`
+SELECT token, reply_key, project_id, pallet_id, sku, uom, batch_number, expiry_date
+FROM client_comment_threads
+WHERE token = ?`, token).Scan(ctx, &thread); err != nil {
+			return err
+		}
+		return tx.NewRaw(`SELECT COUNT(1) > 0 FROM client_project_access WHERE user_id = ? AND project_id = ?`, userID, thread.ProjectID).Scan(ctx, &hasAccess)
+	})
+	switch {
+	case errors.Is(err, sql.ErrNoRows) && userID == 0:
+		return 0, "sender is not a registered client reply address", nil
+	case errors.Is(err, sql.ErrNoRows):
+		return userID, "comment thread not found", nil
+	case err != nil:
+		return 0, "", err
+	}
+	if !hasAccess {
+		return userID, "sender has no access to the thread's project", nil
+	}
+	replyKey := FindReplyKey(msg)
+	sentToReplyAddress := replyKey != "" && thread.ReplyKey != "" &&
+		subtle.ConstantTimeCompare([]byte(replyKey), []byte(thread.ReplyKey)) == 1
+	if !sentToReplyAddress && !msg.Authenticated(sender) {
+		return userID, "sender could not be verified: no SPF or DKIM pass and not sent to the thread's reply address", nil
+	}
+
+	reply := ReplyText(msg.Text)
+	if reply == "" {
+		return userID, "reply is empty", nil
+	}
+	if err := r.addComment(ctx, userID, thread.ProjectID, thread.PalletID, thread.SKU, thread.UOM, thread.Batch, thread.ExpiryISO, reply); err != nil {
+		return userID, err.Error(), nil
+	}
+	return userID, "", nil
+}
+
+// SetClientAddress registers the address a client user replies from. A blank
+// address removes it.
+func SetClientAddress(ctx context.Context, db *sqlite.DB, userID int64, email string) error {
+	if userID <= 0 {
+		return fmt.Errorf("client user is required")
+	}
+	email = strings.TrimSpace(email)
+	if email != "" {
+		addr, err := mail.ParseAddress(email)
+		if err != nil || addr.Address != email {
+			return fmt.Errorf("enter a plain email address")
+		}
+		email = strings.ToLower(addr.Address)
+	}
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		role := ""
+		if err := tx.NewRaw(`SELECT role FROM users WHERE id = ?`, userID).Scan(ctx, &role); err != nil {
+			return err
+		}
+		if role != "client" {
+			return fmt.Errorf("user must have client role")
+		}
+		if email == "" {
+			_, err := tx.ExecContext(ctx, `DELETE FROM client_reply_addresses WHERE user_id = ?`, userID)
+			return err
+		}
+		taken := false
+		if err := tx.NewRaw(`SELECT COUNT(1) > 0 FROM client_reply_addresses WHERE email = ? AND user_id <> ?`, email, userID).Scan(ctx, &taken); err != nil {
+			return err
+		}
+		if taken {
+			return fmt.Errorf("%s is already registered for another client", email)
+		}
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO client_reply_addresses (user_id, email, updated_at)
+VALUES (?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(user_id) DO UPDATE SET
+  email = excluded.email,
+  updated_at = CURRENT_TIMESTAMP`, userID, email)
+		return err
+	})
+}
+
+// InboundEmail is a logged inbound message.
+type InboundEmail struct {
+	ID          int64     `bun:"id"`
+	Sender      string    `bun:"sender"`
+	Subject     string    `bun:"subject"`
+	ThreadToken string    `bun:"thread_token"`
+	Status      string    `bun:"status"`
+	Reason      string    `bun:"reason"`
+	Username    string    `bun:"username"`
+	ReceivedAt  time.Time `bun:"received_at"`
+}
+
+// ListRecent returns the latest inbound messages, newest first.
+func ListRecent(ctx context.Context, db *sqlite.DB, limit int) ([]InboundEmail, error) {
+	rows := make([]InboundEmail, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`
+SELECT ie.id, ie.sender, ie.subject, ie.thread_token, ie.status, ie.reason,
+       COALESCE(u.username, '') AS username, ie.received_at
+FROM inbound_emails ie
+LEFT JOIN users u ON u.id = ie.user_id
+ORDER BY ie.received_at DESC, ie.id DESC
+LIMIT ?`, limit).Scan(ctx, &rows)
+	})
+	return rows, err
+}
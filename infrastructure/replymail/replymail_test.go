@@ -0,0 +1,181 @@
+package replymail
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func openReplyTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "replymail-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	return db
+}
+
+func TestFindTokenAndReplyText(t *testing.T) {
+	cases := []struct {
+		msg  Message
+		want string
+	}{
+		{Message{Subject: "Re: SKU-1 [ref:0123456789ABCDEF]"}, "0123456789abcdef"},
+		{Message{Subject: "Re: SKU-1", Text: "ok\n> quoted [ref:00000000000000aa]"}, "00000000000000aa"},
+		{Message{To: "comments+00000000000000bb@example.com"}, "00000000000000bb"},
+		{Message{To: "comments+00000000000000bb.00000000000000cc@example.com"}, "00000000000000bb"},
+		{Message{Subject: "[ref:short]"}, ""},
+	}
+	for _, tc := range cases {
+		if got := FindToken(tc.msg); got != tc.want {
+			t.Fatalf("FindToken(%+v) = %q, want %q", tc.msg, got, tc.want)
+		}
+	}
+
+	if got := FindReplyKey(Message{To: "comments+00000000000000bb.00000000000000CC@example.com"}); got != "00000000000000cc" {
+		t.Fatalf("FindReplyKey = %q", got)
+	}
+	if got := FindReplyKey(Message{To: "comments+00000000000000bb@example.com"}); got != "" {
+		t.Fatalf("FindReplyKey without a key = %q", got)
+	}
+
+	text := "Please hold these.\r\nThanks\r\n\r\nOn Tue, 2 Jun 2026, Receipter <no-reply@example.com> wrote:\r\n> Client comment on SKU-1\r\n"
+	if got := ReplyText(text); got != "Please hold these.\nThanks" {
+		t.Fatalf("ReplyText = %q", got)
+	}
+	if got := ReplyText("> only quoted\n-----Original Message-----\nFrom: x"); got != "" {
+		t.Fatalf("ReplyText of quoted-only text = %q", got)
+	}
+}
+
+func TestMessageAuthenticated(t *testing.T) {
+	cases := []struct {
+		msg  Message
+		want bool
+	}{
+		{Message{}, false},
+		{Message{SPF: "Pass"}, true},
+		{Message{SPF: "softfail (domain of transitioning x does not designate y)"}, false},
+		{Message{DKIM: "Pass"}, true},
+		{Message{DKIM: "{@client.example : pass}"}, true},
+		{Message{DKIM: "{@attacker.example : pass}"}, false},
+		{Message{DKIM: "{@attacker.example : pass, @client.example : fail}"}, false},
+		{Message{SPF: "fail", DKIM: "{@mailer.example : fail, @Client.example : pass}"}, true},
+	}
+	for _, tc := range cases {
+		if got := tc.msg.Authenticated("buyer@client.example"); got != tc.want {
+			t.Fatalf("Authenticated(%+v) = %v, want %v", tc.msg, got, tc.want)
+		}
+	}
+}
+
+func TestReceiveVerifiesSenderAndLogsOutcome(t *testing.T) {
+	db := openReplyTestDB(t)
+	ctx := context.Background()
+
+	for _, stmt := range []string{
+		`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'P1', 'd', '2026-01-01', 'C', 'p1', 'active')`,
+		`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (2, 'P2', 'd', '2026-01-01', 'C', 'p2', 'active')`,
+		`INSERT INTO users (id, username, password_hash, role, client_project_id) VALUES (10, 'client1', 'hash', 'client', 1)`,
+		`INSERT INTO users (id, username, password_hash, role) VALUES (11, 'scanner1', 'hash', 'scanner')`,
+		`INSERT INTO client_project_access (user_id, project_id) VALUES (10, 1)`,
+		`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'open')`,
+		`INSERT INTO pallets (id, project_id, status) VALUES (2, 2, 'open')`,
+	} {
+		if _, err := db.W.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed %q: %v", stmt, err)
+		}
+	}
+	if err := SetClientAddress(ctx, db, 11, "scanner@example.com"); err == nil {
+		t.Fatalf("expected reply address refused for a non-client user")
+	}
+	if err := SetClientAddress(ctx, db, 10, "Client1@Example.com"); err != nil {
+		t.Fatalf("set client address: %v", err)
+	}
+
+	var own, ownKey, other string
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		if own, err = EnsureThread(ctx, tx, Thread{ProjectID: 1, PalletID: 1, SKU: "SKU-1", ExpiryISO: "2029-01-01"}); err != nil {
+			return err
+		}
+		again, err := EnsureThread(ctx, tx, Thread{ProjectID: 1, PalletID: 1, SKU: "SKU-1", ExpiryISO: "2029-01-01"})
+		if err != nil {
+			return err
+		}
+		if again != own {
+			t.Fatalf("expected the same thread token, got %q and %q", own, again)
+		}
+		if err := tx.NewRaw(`SELECT reply_key FROM client_comment_threads WHERE token = ?`, own).Scan(ctx, &ownKey); err != nil {
+			return err
+		}
+		other, err = EnsureThread(ctx, tx, Thread{ProjectID: 2, PalletID: 2, SKU: "SKU-2"})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("ensure threads: %v", err)
+	}
+
+	var added []string
+	receiver := NewReceiver(db, func(_ context.Context, userID, projectID, palletID int64, sku, _, _, expiryISO, comment string) error {
+		if userID != 10 || projectID != 1 || palletID != 1 || sku != "SKU-1" || expiryISO != "2029-01-01" {
+			t.Fatalf("comment added to the wrong thread: user %d project %d pallet %d %s %s", userID, projectID, palletID, sku, expiryISO)
+		}
+		added = append(added, comment)
+		return nil
+	})
+	receiver.Address = "comments@example.com"
+	if got := receiver.ReplyAddress(own, ownKey); got != "comments+"+own+"."+ownKey+"@example.com" {
+		t.Fatalf("ReplyAddress = %q", got)
+	}
+
+	cases := []struct {
+		msg    Message
+		status string
+	}{
+		{Message{From: "client1@example.com", Subject: "Re: comment", Text: "no reference", SPF: "pass"}, StatusRejected},
+		{Message{From: "stranger@example.com", Subject: Reference(own), Text: "hello", SPF: "pass"}, StatusRejected},
+		{Message{From: "client1@example.com", Subject: Reference(other), Text: "wrong project", SPF: "pass"}, StatusRejected},
+		{Message{From: "client1@example.com", Subject: Reference(own), Text: "> quoted only", SPF: "pass"}, StatusRejected},
+		{Message{From: "client1@example.com", Subject: Reference(own), Text: "forged sender"}, StatusRejected},
+		{Message{From: "client1@example.com", To: "comments+" + own + ".0000000000000000@example.com", Text: "guessed key"}, StatusRejected},
+		{Message{From: "Client One <CLIENT1@example.com>", Subject: "Re: " + Reference(own), Text: "Please recount.\n> quoted", SPF: "Pass"}, StatusAccepted},
+		{Message{From: "client1@example.com", To: receiver.ReplyAddress(own, ownKey), Subject: "Re: comment", Text: "Via the reply address."}, StatusAccepted},
+	}
+	for _, tc := range cases {
+		result, err := receiver.Receive(ctx, tc.msg)
+		if err != nil {
+			t.Fatalf("receive %+v: %v", tc.msg, err)
+		}
+		if result.Status != tc.status {
+			t.Fatalf("receive %+v = %+v, want %s", tc.msg, result, tc.status)
+		}
+	}
+	if len(added) != 2 || added[0] != "Please recount." || added[1] != "Via the reply address." {
+		t.Fatalf("added comments = %q", added)
+	}
+
+	logged, err := ListRecent(ctx, db, 10)
+	if err != nil {
+		t.Fatalf("list inbound emails: %v", err)
+	}
+	if len(logged) != len(cases) || logged[0].Status != StatusAccepted || logged[0].Username != "client1" || logged[0].Sender != "client1@example.com" {
+		t.Fatalf("logged inbound emails = %+v", logged)
+	}
+}
@@ -0,0 +1,108 @@
+// Package serials stores the per-unit serial numbers scanned into receipt
+// lines of serial-tracked SKUs. A serial can only be received once in a
+// project, so a repeated scan is refused with the pallet it is already on.
+package serials
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/uptrace/bun"
+)
+
+// MaxLength caps a single serial number.
+const MaxLength = 64
+
+var (
+	ErrRequired  = errors.New("this SKU is serial-tracked: scan a serial number for each unit")
+	ErrCount     = errors.New("qty must match the number of serials scanned")
+	ErrDuplicate = errors.New("serial number already received")
+	ErrTooLong   = fmt.Errorf("serial numbers can be at most %d characters", MaxLength)
+)
+
+// Parse splits submitted serials, one per line or separated by commas, and
+// drops blanks. Order is kept.
+func Parse(raw string) []string {
+	fields := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == '\n' || r == '\r' || r == ','
+	})
+	serials := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if serial := strings.TrimSpace(field); serial != "" {
+			serials = append(serials, serial)
+		}
+	}
+	return serials
+}
+
+// Check refuses serials that are too long, repeated in the list, or already
+// received anywhere in the project. Serials compare case-insensitively.
+func Check(ctx context.Context, tx bun.Tx, projectID int64, serials []string) error {
+	seen := make(map[string]bool, len(serials))
+	for _, serial := range serials {
+		if len(serial) > MaxLength {
+			return fmt.Errorf("%w: %s", ErrTooLong, serial)
+		}
+		key := strings.ToLower(serial)
+		if seen[key] {
+			return fmt.Errorf("%w: %s was scanned twice", ErrDuplicate, serial)
+		}
+		seen[key] = true
+
+		var palletID int64
+		err := tx.NewRaw(`
+SELECT pr.pallet_id
+FROM receipt_serials rs
+JOIN pallet_receipts pr ON pr.id = rs.pallet_receipt_id
+WHERE rs.project_id = ? AND rs.serial = ?`, projectID, serial).Scan(ctx, &palletID)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %s is on pallet P%08d", ErrDuplicate, serial, palletID)
+	}
+	return nil
+}
+
+// Add checks serials and records them against a receipt line.
+func Add(ctx context.Context, tx bun.Tx, projectID, receiptID, userID int64, serials []string) error {
+	if err := Check(ctx, tx, projectID, serials); err != nil {
+		return err
+	}
+	for _, serial := range serials {
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO receipt_serials (project_id, pallet_receipt_id, serial, scanned_by_user_id)
+VALUES (?, ?, ?, ?)`, projectID, receiptID, serial, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForReceipts returns the serials of each receipt line, in scan order.
+func ForReceipts(ctx context.Context, tx bun.IDB, receiptIDs []int64) (map[int64][]string, error) {
+	byReceipt := make(map[int64][]string)
+	if len(receiptIDs) == 0 {
+		return byReceipt, nil
+	}
+	var rows []struct {
+		ReceiptID int64  `bun:"pallet_receipt_id"`
+		Serial    string `bun:"serial"`
+	}
+	if err := tx.NewRaw(`
+SELECT pallet_receipt_id, serial
+FROM receipt_serials
+WHERE pallet_receipt_id IN (?)
+ORDER BY id`, bun.In(receiptIDs)).Scan(ctx, &rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		byReceipt[row.ReceiptID] = append(byReceipt[row.ReceiptID], row.Serial)
+	}
+	return byReceipt, nil
+}
@@ -22,3 +22,22 @@ func SessionCookie(value string, maxAge int) *http.Cookie {
 func DefaultExpiry() time.Time {
 	return time.Now().Add(12 * time.Hour)
 }
+
+// KioskCookieName holds the device token of an enrolled kiosk tablet. It
+// outlives user sessions so the PIN screen stays available between shifts.
+const KioskCookieName = "X-Kiosk-Device"
+
+// KioskCookieMaxAge keeps a kiosk enrolled for a year unless it is revoked.
+const KioskCookieMaxAge = 365 * 24 * 60 * 60
+
+func KioskCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     KioskCookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   false,
+	}
+}
@@ -0,0 +1,134 @@
+package site
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+// Scope is the part of the instance a user is looking at: the sites they can
+// switch between and the one picked, if any.
+type Scope struct {
+	// Sites are the active sites the user can switch between.
+	Sites []models.Site
+	// Restricted is set for users assigned to particular sites. They never
+	// see rows of other sites or rows without a site.
+	Restricted bool
+	// Active is the site picked in the switcher, or nil for all of Sites.
+	Active *models.Site
+}
+
+// ResolveScope loads the sites userID can see and applies the session's
+// picked site, ignoring it once it is no longer one of them.
+func ResolveScope(ctx context.Context, db *sqlite.DB, userID int64, activeSiteID *int64) (Scope, error) {
+	var scope Scope
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		assigned := make([]models.Site, 0)
+		if err := tx.NewSelect().Model(&assigned).
+			Where("st.active = 1").
+			Where("st.id IN (SELECT site_id FROM user_sites WHERE user_id = ?)", userID).
+			OrderExpr("st.name COLLATE NOCASE ASC, st.id ASC").
+			Scan(ctx); err != nil {
+			return err
+		}
+		restricted, err := tx.NewSelect().Table("user_sites").Where("user_id = ?", userID).Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if restricted {
+			scope.Sites = assigned
+			scope.Restricted = true
+			return nil
+		}
+		scope.Sites = make([]models.Site, 0)
+		return tx.NewSelect().Model(&scope.Sites).
+			Where("st.active = 1").
+			OrderExpr("st.name COLLATE NOCASE ASC, st.id ASC").
+			Scan(ctx)
+	})
+	if err != nil {
+		return Scope{}, err
+	}
+	if activeSiteID != nil {
+		for i := range scope.Sites {
+			if scope.Sites[i].ID == *activeSiteID {
+				scope.Active = &scope.Sites[i]
+				break
+			}
+		}
+	}
+	return scope, nil
+}
+
+// Switchable reports whether the user has more than one site to pick from.
+func (s Scope) Switchable() bool {
+	return len(s.Sites) > 1
+}
+
+// ActiveID is the picked site's ID, or nil.
+func (s Scope) ActiveID() *int64 {
+	if s.Active == nil {
+		return nil
+	}
+	id := s.Active.ID
+	return &id
+}
+
+// DefaultSiteID is the site new projects and kiosks are assigned to: the
+// picked site, or a restricted user's only site.
+func (s Scope) DefaultSiteID() *int64 {
+	if s.Active != nil {
+		return s.ActiveID()
+	}
+	if s.Restricted && len(s.Sites) == 1 {
+		id := s.Sites[0].ID
+		return &id
+	}
+	return nil
+}
+
+// Includes reports whether a row assigned to siteID is in view.
+func (s Scope) Includes(siteID *int64) bool {
+	if s.Active != nil {
+		return siteID != nil && *siteID == s.Active.ID
+	}
+	if !s.Restricted {
+		return true
+	}
+	return siteID != nil && s.has(*siteID)
+}
+
+// IncludesAny reports whether a row assigned to any of siteIDs is in view.
+// Rows with no sites are only in view of unrestricted, unswitched users.
+func (s Scope) IncludesAny(siteIDs []int64) bool {
+	if s.Active == nil && !s.Restricted {
+		return true
+	}
+	for _, id := range siteIDs {
+		if s.Includes(&id) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAssign reports whether the user may put a row on siteID. Only
+// unrestricted users may leave a row without a site.
+func (s Scope) CanAssign(siteID *int64) bool {
+	if siteID == nil {
+		return !s.Restricted
+	}
+	return s.has(*siteID)
+}
+
+func (s Scope) has(siteID int64) bool {
+	for _, st := range s.Sites {
+		if st.ID == siteID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,255 @@
+// Package site manages the warehouse sites run from one instance. Projects
+// and kiosk devices belong to at most one site and users can be assigned to
+// several. Users with no assignment see every site; assigned users only see
+// their own sites' rows, and admins narrow lists further with the site
+// switcher, which is stored on the session.
+package site
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+var (
+	ErrCodeRequired = errors.New("site code is required")
+	ErrNameRequired = errors.New("site name is required")
+	ErrCodeExists   = errors.New("site code already exists")
+	ErrNotFound     = errors.New("site not found")
+	ErrInactive     = errors.New("site is inactive")
+	ErrInvalidID    = errors.New("invalid site")
+)
+
+var codeRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// NormalizeCode converts free text into a site code, e.g. "Leeds DC" -> "leeds-dc".
+func NormalizeCode(raw string) string {
+	v := strings.ToLower(strings.TrimSpace(raw))
+	v = codeRegex.ReplaceAllString(v, "-")
+	v = strings.Trim(v, "-")
+	if len(v) > 32 {
+		v = strings.Trim(v[:32], "-")
+	}
+	return v
+}
+
+// ParseID reads a site picker value; blank means no site.
+func ParseID(raw string) (*int64, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id <= 0 {
+		return nil, ErrInvalidID
+	}
+	return &id, nil
+}
+
+// List returns sites ordered by name. Inactive sites are only included when
+// requested.
+func List(ctx context.Context, db *sqlite.DB, includeInactive bool) ([]models.Site, error) {
+	sites := make([]models.Site, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		q := tx.NewSelect().Model(&sites).OrderExpr("name COLLATE NOCASE ASC, id ASC")
+		if !includeInactive {
+			q = q.Where("active = 1")
+		}
+		return q.Scan(ctx)
+	})
+	return sites, err
+}
+
+func Create(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID int64, code, name string) (models.Site, error) {
+	var s models.Site
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return s, ErrNameRequired
+	}
+	code = NormalizeCode(code)
+	if code == "" {
+		code = NormalizeCode(name)
+	}
+	if code == "" {
+		return s, ErrCodeRequired
+	}
+
+	err := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		exists, err := tx.NewSelect().Model((*models.Site)(nil)).Where("code = ?", code).Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrCodeExists
+		}
+		s = models.Site{Code: code, Name: name, Active: true}
+		if _, err := tx.NewInsert().Model(&s).Exec(ctx); err != nil {
+			return err
+		}
+		if auditSvc != nil && userID > 0 {
+			return auditSvc.Write(ctx, tx, userID, "site.create", "sites", strconv.FormatInt(s.ID, 10), nil, s)
+		}
+		return nil
+	})
+	return s, err
+}
+
+// Update renames a site or retires it. Rows assigned to an inactive site keep
+// their assignment; the site just drops out of pickers and the switcher.
+func Update(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, userID, siteID int64, name string, active bool) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ErrNameRequired
+	}
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var existing models.Site
+		if err := tx.NewSelect().Model(&existing).Where("id = ?", siteID).Limit(1).Scan(ctx); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		before := existing
+		existing.Name = name
+		existing.Active = active
+		existing.UpdatedAt = time.Now()
+		if _, err := tx.NewUpdate().Model(&existing).WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		if auditSvc != nil && userID > 0 {
+			return auditSvc.Write(ctx, tx, userID, "site.update", "sites", strconv.FormatInt(siteID, 10), before, existing)
+		}
+		return nil
+	})
+}
+
+// UserSiteIDs returns the sites a user is assigned to, active or not.
+func UserSiteIDs(ctx context.Context, db *sqlite.DB, userID int64) ([]int64, error) {
+	ids := make([]int64, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT site_id FROM user_sites WHERE user_id = ? ORDER BY site_id`, userID).Scan(ctx, &ids)
+	})
+	return ids, err
+}
+
+// SetUserSites replaces a user's site assignments. An empty list makes the
+// user see every site again.
+func SetUserSites(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID, userID int64, siteIDs []int64) error {
+	siteIDs = normalizeIDs(siteIDs)
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		exists, err := tx.NewSelect().Table("users").Where("id = ?", userID).Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return errors.New("user not found")
+		}
+		if err := checkSitesExist(ctx, tx, siteIDs); err != nil {
+			return err
+		}
+		before := make([]int64, 0)
+		if err := tx.NewRaw(`SELECT site_id FROM user_sites WHERE user_id = ? ORDER BY site_id`, userID).Scan(ctx, &before); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM user_sites WHERE user_id = ?`, userID); err != nil {
+			return err
+		}
+		for _, siteID := range siteIDs {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO user_sites (user_id, site_id, created_at) VALUES (?, ?, CURRENT_TIMESTAMP)`, userID, siteID); err != nil {
+				return err
+			}
+		}
+		if auditSvc != nil && actorUserID > 0 {
+			return auditSvc.Write(ctx, tx, actorUserID, "user.sites", "users", strconv.FormatInt(userID, 10),
+				map[string]any{"site_ids": before}, map[string]any{"site_ids": siteIDs})
+		}
+		return nil
+	})
+}
+
+// SetProjectSite assigns a project to a site, or clears it when siteID is nil.
+func SetProjectSite(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID, projectID int64, siteID *int64) error {
+	return setRowSite(ctx, db, auditSvc, actorUserID, "projects", "project.site", projectID, siteID)
+}
+
+// SetKioskSite assigns a kiosk device to a site, or clears it when siteID is nil.
+func SetKioskSite(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID, deviceID int64, siteID *int64) error {
+	return setRowSite(ctx, db, auditSvc, actorUserID, "kiosk_devices", "kiosk.site", deviceID, siteID)
+}
+
+func setRowSite(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, actorUserID int64, table, action string, id int64, siteID *int64) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if siteID != nil {
+			if err := checkSitesExist(ctx, tx, []int64{*siteID}); err != nil {
+				return err
+			}
+		}
+		var before *int64
+		if err := tx.NewRaw(`SELECT site_id FROM `+table+` WHERE id = ?`, id).Scan(ctx, &before); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET site_id = ? WHERE id = ?`, siteID, id); err != nil {
+			return err
+		}
+		if auditSvc != nil && actorUserID > 0 {
+			return auditSvc.Write(ctx, tx, actorUserID, action, table, strconv.FormatInt(id, 10),
+				map[string]any{"site_id": before}, map[string]any{"site_id": siteID})
+		}
+		return nil
+	})
+}
+
+// checkSitesExist refuses unknown and inactive sites for new assignments.
+func checkSitesExist(ctx context.Context, tx bun.Tx, siteIDs []int64) error {
+	if len(siteIDs) == 0 {
+		return nil
+	}
+	var active []bool
+	if err := tx.NewRaw(`SELECT active FROM sites WHERE id IN (?)`, bun.In(siteIDs)).Scan(ctx, &active); err != nil {
+		return err
+	}
+	if len(active) != len(siteIDs) {
+		return ErrNotFound
+	}
+	for _, a := range active {
+		if !a {
+			return ErrInactive
+		}
+	}
+	return nil
+}
+
+// SetSessionActiveSiteID stores the site picked in the switcher; nil shows
+// every site the user can see.
+func SetSessionActiveSiteID(ctx context.Context, db *sqlite.DB, sessionID string, siteID *int64) error {
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE sessions SET active_site_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, siteID, sessionID)
+		return err
+	})
+}
+
+func normalizeIDs(ids []int64) []int64 {
+	seen := make(map[int64]struct{}, len(ids))
+	out := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id <= 0 {
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		out = append(out, id)
+	}
+	return out
+}
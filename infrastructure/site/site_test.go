@@ -0,0 +1,141 @@
+package site
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func openSiteTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "site-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	return db
+}
+
+func seedSiteTestUser(t *testing.T, db *sqlite.DB, username string) int64 {
+	t.Helper()
+	var id int64
+	if err := db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`INSERT INTO users (username, password_hash, role, created_at, updated_at) VALUES (?, 'x', 'admin', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP) RETURNING id`, username).Scan(ctx, &id)
+	}); err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+	return id
+}
+
+func TestNormalizeCode(t *testing.T) {
+	cases := map[string]string{
+		"Leeds DC":      "leeds-dc",
+		"  BRISTOL  ":   "bristol",
+		"--Hull / East": "hull-east",
+		"":              "",
+	}
+	for in, want := range cases {
+		if got := NormalizeCode(in); got != want {
+			t.Fatalf("NormalizeCode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCreateRejectsDuplicateCode(t *testing.T) {
+	db := openSiteTestDB(t)
+	ctx := context.Background()
+
+	created, err := Create(ctx, db, nil, 0, "", "Leeds DC")
+	if err != nil {
+		t.Fatalf("create site: %v", err)
+	}
+	if created.Code != "leeds-dc" || !created.Active {
+		t.Fatalf("expected active site with derived code, got %+v", created)
+	}
+	if _, err := Create(ctx, db, nil, 0, "LEEDS dc", "Leeds again"); !errors.Is(err, ErrCodeExists) {
+		t.Fatalf("expected ErrCodeExists, got %v", err)
+	}
+	if _, err := Create(ctx, db, nil, 0, "x", " "); !errors.Is(err, ErrNameRequired) {
+		t.Fatalf("expected ErrNameRequired, got %v", err)
+	}
+}
+
+func TestResolveScopeRestrictsAssignedUsers(t *testing.T) {
+	db := openSiteTestDB(t)
+	ctx := context.Background()
+
+	leeds, err := Create(ctx, db, nil, 0, "", "Leeds")
+	if err != nil {
+		t.Fatalf("create leeds: %v", err)
+	}
+	hull, err := Create(ctx, db, nil, 0, "", "Hull")
+	if err != nil {
+		t.Fatalf("create hull: %v", err)
+	}
+	userID := seedSiteTestUser(t, db, "site-admin")
+
+	scope, err := ResolveScope(ctx, db, userID, nil)
+	if err != nil {
+		t.Fatalf("resolve unrestricted scope: %v", err)
+	}
+	if scope.Restricted || !scope.Switchable() || !scope.Includes(nil) || !scope.CanAssign(nil) {
+		t.Fatalf("expected unrestricted switchable scope, got %+v", scope)
+	}
+
+	scope, err = ResolveScope(ctx, db, userID, &hull.ID)
+	if err != nil {
+		t.Fatalf("resolve switched scope: %v", err)
+	}
+	if scope.Active == nil || scope.Active.ID != hull.ID {
+		t.Fatalf("expected hull to be active, got %+v", scope.Active)
+	}
+	if scope.Includes(nil) || scope.Includes(&leeds.ID) || !scope.Includes(&hull.ID) {
+		t.Fatalf("expected switched scope to include hull only")
+	}
+
+	if err := SetUserSites(ctx, db, nil, 0, userID, []int64{leeds.ID, leeds.ID}); err != nil {
+		t.Fatalf("set user sites: %v", err)
+	}
+	scope, err = ResolveScope(ctx, db, userID, &hull.ID)
+	if err != nil {
+		t.Fatalf("resolve restricted scope: %v", err)
+	}
+	if !scope.Restricted || scope.Active != nil || scope.Switchable() {
+		t.Fatalf("expected restricted scope ignoring unassigned active site, got %+v", scope)
+	}
+	if scope.Includes(nil) || scope.Includes(&hull.ID) || !scope.Includes(&leeds.ID) {
+		t.Fatalf("expected restricted scope to include leeds only")
+	}
+	if scope.CanAssign(nil) || scope.CanAssign(&hull.ID) || !scope.CanAssign(&leeds.ID) {
+		t.Fatalf("expected restricted user to assign leeds only")
+	}
+	if !scope.IncludesAny([]int64{hull.ID, leeds.ID}) || scope.IncludesAny(nil) {
+		t.Fatalf("expected IncludesAny to match on any assigned site")
+	}
+	if got := scope.DefaultSiteID(); got == nil || *got != leeds.ID {
+		t.Fatalf("expected default site leeds, got %v", got)
+	}
+
+	if err := Update(ctx, db, nil, 0, hull.ID, "Hull", false); err != nil {
+		t.Fatalf("deactivate hull: %v", err)
+	}
+	if err := SetUserSites(ctx, db, nil, 0, userID, []int64{hull.ID}); !errors.Is(err, ErrInactive) {
+		t.Fatalf("expected ErrInactive assigning retired site, got %v", err)
+	}
+}
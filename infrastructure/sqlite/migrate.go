@@ -37,6 +37,9 @@ func ApplyMigrationsFromDir(ctx context.Context, db *DB, migrationsDir string) e
 }
 
 func applyMigrationsFromDir(ctx context.Context, db *DB, migrationsDir string) error {
+	if err := ensureMigrationTable(ctx, db); err != nil {
+		return err
+	}
 	entries, err := os.ReadDir(migrationsDir)
 	if err != nil {
 		return fmt.Errorf("read migrations dir: %w", err)
@@ -68,6 +71,9 @@ func applyMigrationsFromDir(ctx context.Context, db *DB, migrationsDir string) e
 }
 
 func applyMigrationsFromFS(ctx context.Context, db *DB, migrationsFS fs.FS, root string) error {
+	if err := ensureMigrationTable(ctx, db); err != nil {
+		return err
+	}
 	entries, err := fs.ReadDir(migrationsFS, root)
 	if err != nil {
 		return fmt.Errorf("read migrations fs: %w", err)
@@ -98,11 +104,24 @@ func applyMigrationsFromFS(ctx context.Context, db *DB, migrationsFS fs.FS, root
 }
 
 func applySingleMigration(ctx context.Context, db *DB, name string, sqlBytes []byte) error {
+	err := execMigration(ctx, db, sqlBytes)
+	if recordErr := recordMigration(ctx, db, name, sqlBytes, err); recordErr != nil && err == nil {
+		err = recordErr
+	}
+	if err != nil {
+		return fmt.Errorf("apply migration %s: %w", name, err)
+	}
+	return nil
+}
+
+func execMigration(ctx context.Context, db *DB, sqlBytes []byte) error {
 	sqlText := string(sqlBytes)
 	upper := strings.ToUpper(sqlText)
 	if strings.Contains(upper, "BEGIN TRANSACTION") || strings.Contains(upper, "BEGIN;") {
 		if _, err := db.WriteSQL.ExecContext(ctx, sqlText); err != nil {
-			return fmt.Errorf("apply migration %s: %w", name, err)
+			// Do not leave the script's own transaction open on the writer.
+			_, _ = db.WriteSQL.ExecContext(ctx, `ROLLBACK`)
+			return err
 		}
 		return nil
 	}
@@ -111,8 +130,14 @@ func applySingleMigration(ctx context.Context, db *DB, name string, sqlBytes []b
 		_, execErr := tx.ExecContext(ctx, sqlText)
 		return execErr
 	})
-	if err != nil {
-		return fmt.Errorf("apply migration %s: %w", name, err)
+	if isDuplicateColumnError(err) {
+		// SQLite has no ADD COLUMN IF NOT EXISTS. Column migrations run in a
+		// single transaction, so a duplicate column means it was applied before.
+		return nil
 	}
-	return nil
+	return err
+}
+
+func isDuplicateColumnError(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "duplicate column name")
 }
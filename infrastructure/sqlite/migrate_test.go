@@ -35,3 +35,33 @@ func TestApplyEmbeddedMigrations(t *testing.T) {
 		t.Fatalf("expected users table after embedded migrations, got %d", count)
 	}
 }
+
+func TestApplyEmbeddedMigrations_Rerun(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "embedded-rerun.db")
+	db, err := OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := ApplyEmbeddedMigrations(context.Background(), db); err != nil {
+			t.Fatalf("apply embedded migrations (run %d): %v", i+1, err)
+		}
+	}
+
+	var count int64
+	err = db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(
+			`SELECT COUNT(*) FROM pragma_table_info('pallet_receipts') WHERE name = 'damage_reason'`,
+		).Scan(ctx, &count)
+	})
+	if err != nil {
+		t.Fatalf("query table info: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected damage_reason column once, got %d", count)
+	}
+}
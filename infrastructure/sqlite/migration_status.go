@@ -0,0 +1,200 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MigrationApplied = "applied"
+	MigrationFailed  = "failed"
+	MigrationPending = "pending"
+)
+
+// MigrationRecord is one row of schema_migrations, or a pending embedded
+// migration that has no row yet.
+type MigrationRecord struct {
+	Version   string
+	Status    string
+	Checksum  string
+	Error     string
+	UpdatedAt time.Time
+	// Changed is set when the embedded file no longer matches the checksum
+	// recorded when it was applied.
+	Changed bool
+}
+
+// MigrationStatus compares the migrations embedded in this binary with the
+// ones recorded in the database.
+type MigrationStatus struct {
+	Migrations []MigrationRecord
+	Pending    int
+	Failed     int
+	// Err is set when the status itself could not be read.
+	Err error
+}
+
+// Behind reports whether the schema is missing or failed any migration this
+// binary expects.
+func (s MigrationStatus) Behind() bool {
+	return s.Err != nil || s.Pending > 0 || s.Failed > 0
+}
+
+// Summary is a one-line description for banners and blocked writes.
+func (s MigrationStatus) Summary() string {
+	if s.Err != nil {
+		return "database schema status is unavailable"
+	}
+	parts := make([]string, 0, 2)
+	if s.Failed > 0 {
+		parts = append(parts, fmt.Sprintf("%d failed", s.Failed))
+	}
+	if s.Pending > 0 {
+		parts = append(parts, fmt.Sprintf("%d pending", s.Pending))
+	}
+	if len(parts) == 0 {
+		return "database schema is up to date"
+	}
+	return "database schema is behind: " + strings.Join(parts, ", ") + " migrations"
+}
+
+func ensureMigrationTable(ctx context.Context, db *DB) error {
+	_, err := db.WriteSQL.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version TEXT PRIMARY KEY,
+    checksum TEXT NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('applied', 'failed')),
+    error TEXT NOT NULL DEFAULT '',
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+func migrationChecksum(sqlBytes []byte) string {
+	sum := sha256.Sum256(sqlBytes)
+	return hex.EncodeToString(sum[:])
+}
+
+// recordMigration stores the outcome of applying one migration. A later
+// successful run clears an earlier failure.
+func recordMigration(ctx context.Context, db *DB, name string, sqlBytes []byte, applyErr error) error {
+	status, message := MigrationApplied, ""
+	if applyErr != nil {
+		status, message = MigrationFailed, applyErr.Error()
+	}
+	_, err := db.WriteSQL.ExecContext(ctx, `
+INSERT INTO schema_migrations (version, checksum, status, error, updated_at)
+VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(version) DO UPDATE SET
+	checksum = excluded.checksum,
+	status = excluded.status,
+	error = excluded.error,
+	updated_at = excluded.updated_at`, name, migrationChecksum(sqlBytes), status, message)
+	if err != nil {
+		return fmt.Errorf("record migration %s: %w", name, err)
+	}
+	return nil
+}
+
+// LoadMigrationStatus reports the state of every embedded migration.
+func LoadMigrationStatus(ctx context.Context, db *DB) MigrationStatus {
+	return loadMigrationStatus(ctx, db, embeddedMigrations, "migrations")
+}
+
+func loadMigrationStatus(ctx context.Context, db *DB, migrationsFS fs.FS, root string) MigrationStatus {
+	var status MigrationStatus
+	entries, err := fs.ReadDir(migrationsFS, root)
+	if err != nil {
+		status.Err = fmt.Errorf("read migrations fs: %w", err)
+		return status
+	}
+
+	recorded := map[string]MigrationRecord{}
+	rows, err := db.ReadSQL.QueryContext(ctx, `SELECT version, checksum, status, error, updated_at FROM schema_migrations`)
+	if err != nil {
+		status.Err = fmt.Errorf("read schema_migrations: %w", err)
+		return status
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rec MigrationRecord
+		if err := rows.Scan(&rec.Version, &rec.Checksum, &rec.Status, &rec.Error, &rec.UpdatedAt); err != nil {
+			status.Err = fmt.Errorf("scan schema_migrations: %w", err)
+			return status
+		}
+		recorded[rec.Version] = rec
+	}
+	if err := rows.Err(); err != nil {
+		status.Err = err
+		return status
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".sql" {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		sqlBytes, err := fs.ReadFile(migrationsFS, path.Join(root, name))
+		if err != nil {
+			status.Err = fmt.Errorf("read migration %s: %w", name, err)
+			return status
+		}
+		rec, ok := recorded[name]
+		if !ok {
+			rec = MigrationRecord{Version: name, Status: MigrationPending}
+		}
+		rec.Changed = ok && rec.Checksum != migrationChecksum(sqlBytes)
+		switch rec.Status {
+		case MigrationPending:
+			status.Pending++
+		case MigrationFailed:
+			status.Failed++
+		}
+		status.Migrations = append(status.Migrations, rec)
+	}
+	return status
+}
+
+// SchemaMonitor caches the migration status so request middleware can check
+// it without a query per request. Refresh after applying migrations.
+type SchemaMonitor struct {
+	db     *DB
+	mu     sync.RWMutex
+	status MigrationStatus
+}
+
+func NewSchemaMonitor(ctx context.Context, db *DB) *SchemaMonitor {
+	m := &SchemaMonitor{db: db}
+	m.Refresh(ctx)
+	return m
+}
+
+func (m *SchemaMonitor) Status() MigrationStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status
+}
+
+func (m *SchemaMonitor) Refresh(ctx context.Context) MigrationStatus {
+	status := LoadMigrationStatus(ctx, m.db)
+	m.mu.Lock()
+	m.status = status
+	m.mu.Unlock()
+	return status
+}
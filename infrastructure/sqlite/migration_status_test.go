@@ -0,0 +1,66 @@
+package sqlite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrationStatus_TracksFailedAndPendingMigrations(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	dir := t.TempDir()
+	write := func(name, sql string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(sql), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	write("001_first.sql", `CREATE TABLE IF NOT EXISTS first_table (id INTEGER PRIMARY KEY);`)
+	write("002_broken.sql", `CREATE TABLE second_table (id INTEGER PRIMARY KEY, missing_comma TEXT NOT NULL DEFAULT '' CHECK`)
+	write("003_third.sql", `CREATE TABLE IF NOT EXISTS third_table (id INTEGER PRIMARY KEY);`)
+
+	if err := ApplyMigrationsFromDir(ctx, db, dir); err == nil {
+		t.Fatalf("expected broken migration to fail")
+	}
+
+	status := loadMigrationStatus(ctx, db, os.DirFS(dir), ".")
+	if status.Err != nil {
+		t.Fatalf("load status: %v", status.Err)
+	}
+	if !status.Behind() || status.Failed != 1 || status.Pending != 1 {
+		t.Fatalf("expected 1 failed and 1 pending migration, got %+v", status)
+	}
+	if status.Migrations[1].Status != MigrationFailed || status.Migrations[1].Error == "" {
+		t.Fatalf("expected 002 to be recorded as failed with an error, got %+v", status.Migrations[1])
+	}
+	if got := status.Summary(); got != "database schema is behind: 1 failed, 1 pending migrations" {
+		t.Fatalf("unexpected summary %q", got)
+	}
+
+	write("002_broken.sql", `CREATE TABLE IF NOT EXISTS second_table (id INTEGER PRIMARY KEY);`)
+	if err := ApplyMigrationsFromDir(ctx, db, dir); err != nil {
+		t.Fatalf("reapply fixed migrations: %v", err)
+	}
+	status = loadMigrationStatus(ctx, db, os.DirFS(dir), ".")
+	if status.Behind() {
+		t.Fatalf("expected schema to be current after fix, got %+v", status)
+	}
+
+	write("003_third.sql", `CREATE TABLE IF NOT EXISTS third_table (id INTEGER PRIMARY KEY, note TEXT);`)
+	status = loadMigrationStatus(ctx, db, os.DirFS(dir), ".")
+	if !status.Migrations[2].Changed || status.Behind() {
+		t.Fatalf("expected edited applied migration to be flagged as changed only, got %+v", status.Migrations[2])
+	}
+}
+
+func TestLoadMigrationStatus_EmbeddedUpToDate(t *testing.T) {
+	db := openTestDB(t)
+	if err := ApplyEmbeddedMigrations(context.Background(), db); err != nil {
+		t.Fatalf("apply embedded migrations: %v", err)
+	}
+	if status := LoadMigrationStatus(context.Background(), db); status.Behind() {
+		t.Fatalf("expected embedded migrations to be up to date, got %+v", status)
+	}
+}
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS damage_reasons (
+    code TEXT PRIMARY KEY,
+    label TEXT NOT NULL,
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    active BOOLEAN NOT NULL DEFAULT 1,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Default taxonomy. Admins can relabel, reorder or deactivate these, so
+-- existing rows are never overwritten.
+INSERT OR IGNORE INTO damage_reasons (code, label, sort_order, active) VALUES
+    ('crushed', 'Crushed', 10, 1),
+    ('wet', 'Wet', 20, 1),
+    ('seal_broken', 'Seal broken', 30, 1),
+    ('temperature_excursion', 'Temperature excursion', 40, 1),
+    ('other', 'Other', 90, 1);
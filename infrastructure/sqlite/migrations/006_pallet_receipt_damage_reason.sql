@@ -0,0 +1,3 @@
+ALTER TABLE pallet_receipts ADD COLUMN damage_reason TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_pallet_receipts_damage_reason ON pallet_receipts(project_id, damage_reason);
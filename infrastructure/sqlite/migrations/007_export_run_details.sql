@@ -0,0 +1,8 @@
+-- Export history: parameters, size and timing per run, plus an optional
+-- reference to a retained file for exports produced in the background.
+ALTER TABLE export_runs ADD COLUMN params TEXT NOT NULL DEFAULT '';
+ALTER TABLE export_runs ADD COLUMN row_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE export_runs ADD COLUMN duration_ms INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE export_runs ADD COLUMN file_ref TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_export_runs_created_at ON export_runs(created_at);
@@ -0,0 +1,19 @@
+-- UNKNOWN SKU resolution: admins assign a real SKU to lines captured as
+-- UNKNOWN. Resolved lines keep who/when for traceability, and scanned
+-- barcodes can be registered as aliases so the next scan finds the SKU.
+ALTER TABLE pallet_receipts ADD COLUMN resolved_at DATETIME;
+ALTER TABLE pallet_receipts ADD COLUMN resolved_by_user_id INTEGER REFERENCES users(id);
+
+CREATE TABLE IF NOT EXISTS stock_item_barcodes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL,
+    barcode TEXT NOT NULL,
+    sku TEXT NOT NULL,
+    created_by_user_id INTEGER NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (project_id) REFERENCES projects(id),
+    FOREIGN KEY (created_by_user_id) REFERENCES users(id),
+    UNIQUE(project_id, barcode)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pallet_receipts_unknown ON pallet_receipts(project_id, unknown_sku);
@@ -0,0 +1,3 @@
+-- Closed pallet labels print their captions in the project's label language;
+-- the print screen can override it per pallet.
+ALTER TABLE projects ADD COLUMN label_language TEXT NOT NULL DEFAULT 'en';
@@ -0,0 +1,11 @@
+-- Attributes supplied when pallets are pre-created by upstream systems. Kept
+-- in a side table because the pallets table is rebuilt by 003 on startup.
+CREATE TABLE IF NOT EXISTS pallet_attributes (
+    pallet_id INTEGER PRIMARY KEY,
+    pallet_type TEXT NOT NULL DEFAULT '',
+    delivery_reference TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (pallet_id) REFERENCES pallets(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pallet_attributes_delivery_reference ON pallet_attributes(delivery_reference);
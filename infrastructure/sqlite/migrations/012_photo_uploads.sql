@@ -0,0 +1,29 @@
+-- Photos uploaded after their receipt line was accepted. Chunks are staged
+-- until the upload completes, then a background worker validates the image
+-- and moves it into receipt_photos.
+CREATE TABLE IF NOT EXISTS photo_uploads (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    pallet_receipt_id INTEGER NOT NULL,
+    file_name TEXT NOT NULL DEFAULT 'photo.jpg',
+    mime_type TEXT NOT NULL DEFAULT 'image/jpeg',
+    total_bytes INTEGER NOT NULL,
+    received_bytes INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'uploading',
+    error TEXT NOT NULL DEFAULT '',
+    created_by_user_id INTEGER NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (pallet_receipt_id) REFERENCES pallet_receipts(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by_user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_photo_uploads_receipt ON photo_uploads(pallet_receipt_id);
+CREATE INDEX IF NOT EXISTS idx_photo_uploads_status ON photo_uploads(status);
+
+CREATE TABLE IF NOT EXISTS photo_upload_chunks (
+    upload_id INTEGER NOT NULL,
+    offset_bytes INTEGER NOT NULL,
+    data BLOB NOT NULL,
+    PRIMARY KEY (upload_id, offset_bytes),
+    FOREIGN KEY (upload_id) REFERENCES photo_uploads(id) ON DELETE CASCADE
+);
@@ -0,0 +1,28 @@
+-- Admin-defined extra fields captured on a project's receipt lines, e.g.
+-- country of origin or PO line. Keys are permanent once created so export
+-- columns stay stable; retire a field by deactivating it.
+CREATE TABLE IF NOT EXISTS project_custom_fields (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL,
+    key TEXT NOT NULL,
+    label TEXT NOT NULL,
+    field_type TEXT NOT NULL DEFAULT 'text',
+    required BOOLEAN NOT NULL DEFAULT 0,
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    active BOOLEAN NOT NULL DEFAULT 1,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (project_id, key),
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS receipt_custom_values (
+    pallet_receipt_id INTEGER NOT NULL,
+    field_id INTEGER NOT NULL,
+    value TEXT NOT NULL,
+    PRIMARY KEY (pallet_receipt_id, field_id),
+    FOREIGN KEY (pallet_receipt_id) REFERENCES pallet_receipts(id) ON DELETE CASCADE,
+    FOREIGN KEY (field_id) REFERENCES project_custom_fields(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_receipt_custom_values_field ON receipt_custom_values(field_id);
@@ -0,0 +1,3 @@
+-- Closed pallet labels print the item barcode in the symbology the project's
+-- customer scans with; values that do not fit print a placeholder instead.
+ALTER TABLE projects ADD COLUMN label_symbology TEXT NOT NULL DEFAULT 'code128';
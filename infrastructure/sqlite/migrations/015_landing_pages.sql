@@ -0,0 +1,9 @@
+-- Post-login landing page per role, with an optional per-user override held
+-- alongside the user's other settings. Empty means "use the default".
+CREATE TABLE IF NOT EXISTS role_settings (
+    role TEXT PRIMARY KEY,
+    landing_page TEXT NOT NULL DEFAULT '',
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE user_settings ADD COLUMN landing_page TEXT NOT NULL DEFAULT '';
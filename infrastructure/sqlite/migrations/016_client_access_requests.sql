@@ -0,0 +1,19 @@
+-- Client users can ask for access to another project by code; admins
+-- approve or deny from the users page.
+CREATE TABLE IF NOT EXISTS client_access_requests (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    project_id INTEGER NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'denied')),
+    decided_by_user_id INTEGER,
+    decided_at DATETIME,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+    FOREIGN KEY (decided_by_user_id) REFERENCES users(id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_client_access_requests_pending
+    ON client_access_requests(user_id, project_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_client_access_requests_status ON client_access_requests(status, created_at);
@@ -0,0 +1,21 @@
+-- Shared receiving tablets enrolled as kiosks. Scanners switch onto a kiosk
+-- with a short PIN instead of their password; kiosk sessions are limited to
+-- the scan and receipt screens.
+CREATE TABLE IF NOT EXISTS kiosk_devices (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    token_prefix TEXT NOT NULL,
+    created_by_user_id INTEGER NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    enrolled_at DATETIME,
+    last_seen_at DATETIME,
+    revoked_at DATETIME,
+    FOREIGN KEY (created_by_user_id) REFERENCES users(id)
+);
+
+ALTER TABLE users ADD COLUMN kiosk_pin_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN kiosk_pin_failures INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN kiosk_pin_locked_until DATETIME;
+
+ALTER TABLE sessions ADD COLUMN kiosk_device_id INTEGER REFERENCES kiosk_devices(id) ON DELETE CASCADE;
@@ -0,0 +1,3 @@
+-- Optional cap on how many pallet numbers a project may use, matching the
+-- label stock a site pre-printed. NULL means no allowance is tracked.
+ALTER TABLE projects ADD COLUMN pallet_allowance INTEGER;
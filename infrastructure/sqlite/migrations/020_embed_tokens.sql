@@ -0,0 +1,24 @@
+-- Read-only receiving summary widgets that clients embed on their own
+-- intranet. The token travels in the widget URL, so only its SHA-256 hash is
+-- stored; each token is scoped to one or more projects and can be revoked.
+CREATE TABLE IF NOT EXISTS embed_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    token_prefix TEXT NOT NULL,
+    created_by_user_id INTEGER NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME,
+    revoked_at DATETIME,
+    FOREIGN KEY (created_by_user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS embed_token_projects (
+    embed_token_id INTEGER NOT NULL,
+    project_id INTEGER NOT NULL,
+    PRIMARY KEY (embed_token_id, project_id),
+    FOREIGN KEY (embed_token_id) REFERENCES embed_tokens(id) ON DELETE CASCADE,
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_embed_token_projects_project_id ON embed_token_projects(project_id);
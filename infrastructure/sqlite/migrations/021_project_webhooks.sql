@@ -0,0 +1,26 @@
+-- Client-owned webhooks for pallet status changes, configured per project.
+-- The secret is field-encrypted and signs each payload so the client can
+-- verify it came from us.
+CREATE TABLE IF NOT EXISTS project_webhooks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT 1,
+    created_by_user_id INTEGER NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by_user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_project_webhooks_project_id ON project_webhooks(project_id);
+
+-- Deliveries raised by a project webhook keep the link for the per-project
+-- delivery log, and carry the signature computed when they were queued.
+ALTER TABLE deliveries ADD COLUMN project_id INTEGER REFERENCES projects(id) ON DELETE SET NULL;
+ALTER TABLE deliveries ADD COLUMN webhook_id INTEGER REFERENCES project_webhooks(id) ON DELETE SET NULL;
+ALTER TABLE deliveries ADD COLUMN signature TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_deliveries_project_id ON deliveries(project_id, id);
@@ -0,0 +1,6 @@
+-- When a project was last deactivated, and when each session last picked its
+-- active project. A session whose project was deactivated after it was picked
+-- is moved off it; an admin who opens an inactive project on purpose is not.
+-- Both are written with millisecond precision so same-second changes order.
+ALTER TABLE projects ADD COLUMN deactivated_at DATETIME;
+ALTER TABLE sessions ADD COLUMN active_project_selected_at DATETIME;
@@ -0,0 +1,23 @@
+-- Exports built in the background. The finished file is kept in the row until
+-- the job is pruned, like photos, so no separate file store is needed.
+CREATE TABLE IF NOT EXISTS export_jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,
+    project_id INTEGER NOT NULL,
+    pallet_id INTEGER,
+    requested_by_user_id INTEGER,
+    status TEXT NOT NULL DEFAULT 'queued',
+    error TEXT NOT NULL DEFAULT '',
+    file_name TEXT NOT NULL DEFAULT '',
+    file_blob BLOB,
+    file_size INTEGER NOT NULL DEFAULT 0,
+    row_count INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at DATETIME,
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+    FOREIGN KEY (pallet_id) REFERENCES pallets(id) ON DELETE CASCADE,
+    FOREIGN KEY (requested_by_user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_export_jobs_status ON export_jobs(status, id);
+CREATE INDEX IF NOT EXISTS idx_export_jobs_pallet ON export_jobs(pallet_id, id);
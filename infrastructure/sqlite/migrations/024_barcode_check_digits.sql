@@ -0,0 +1,3 @@
+-- Set when a receipt line was saved with an item or carton barcode whose GS1
+-- check digit is wrong, after the scanner chose to keep it anyway.
+ALTER TABLE pallet_receipts ADD COLUMN barcode_check_failed INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,28 @@
+-- Disabled users cannot log in, use API tokens or switch onto a kiosk.
+ALTER TABLE users ADD COLUMN disabled_at DATETIME;
+
+-- Each bulk change on the users page records the state it replaced for every
+-- user it touched, so the whole change can be undone together.
+CREATE TABLE IF NOT EXISTS user_bulk_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    action TEXT NOT NULL CHECK (action IN ('disable', 'enable', 'role', 'disable_project')),
+    new_role TEXT NOT NULL DEFAULT '',
+    project_id INTEGER,
+    performed_by_user_id INTEGER NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    undone_at DATETIME,
+    undone_by_user_id INTEGER,
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE SET NULL,
+    FOREIGN KEY (performed_by_user_id) REFERENCES users(id),
+    FOREIGN KEY (undone_by_user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS user_bulk_change_users (
+    bulk_change_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    previous_role TEXT NOT NULL,
+    previous_disabled_at DATETIME,
+    PRIMARY KEY (bulk_change_id, user_id),
+    FOREIGN KEY (bulk_change_id) REFERENCES user_bulk_changes(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
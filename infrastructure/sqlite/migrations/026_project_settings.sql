@@ -0,0 +1,18 @@
+-- Typed key/value settings for per-project receiving behaviour. A project
+-- value overrides the global value, which overrides the built-in default;
+-- the keys and their types are defined in code (infrastructure/projectsettings).
+CREATE TABLE IF NOT EXISTS global_settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated_by_user_id INTEGER REFERENCES users(id),
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS project_settings (
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    updated_by_user_id INTEGER REFERENCES users(id),
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, key)
+);
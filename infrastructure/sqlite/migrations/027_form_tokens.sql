@@ -0,0 +1,8 @@
+-- One-time tokens of forms that were submitted, so a double-tapped Save is
+-- recognised and ignored instead of saving the same receipt twice.
+CREATE TABLE IF NOT EXISTS form_tokens (
+    token TEXT PRIMARY KEY,
+    used_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_form_tokens_used_at ON form_tokens(used_at);
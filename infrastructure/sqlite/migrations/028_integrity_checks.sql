@@ -0,0 +1,20 @@
+-- Results of the data integrity checker: one run per night (or per manual
+-- "Run now"), with one row per invariant checked.
+CREATE TABLE IF NOT EXISTS integrity_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    trigger TEXT NOT NULL CHECK (trigger IN ('scheduled', 'manual')),
+    triggered_by_user_id INTEGER REFERENCES users(id),
+    checks_run INTEGER NOT NULL DEFAULT 0,
+    checks_failed INTEGER NOT NULL DEFAULT 0,
+    started_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS integrity_results (
+    run_id INTEGER NOT NULL REFERENCES integrity_runs(id) ON DELETE CASCADE,
+    check_key TEXT NOT NULL,
+    violations INTEGER NOT NULL DEFAULT 0,
+    sample_ids TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (run_id, check_key)
+);
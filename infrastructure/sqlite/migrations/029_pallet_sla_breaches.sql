@@ -0,0 +1,11 @@
+-- Pallets that stayed open past their project's receiving SLA. A row is
+-- written once, when the breach is first noticed, so each breach raises a
+-- single alert; sla_hours keeps the SLA that applied at the time.
+CREATE TABLE IF NOT EXISTS pallet_sla_breaches (
+    pallet_id INTEGER PRIMARY KEY REFERENCES pallets(id) ON DELETE CASCADE,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    sla_hours INTEGER NOT NULL CHECK (sla_hours > 0),
+    breached_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_pallet_sla_breaches_project ON pallet_sla_breaches(project_id, breached_at);
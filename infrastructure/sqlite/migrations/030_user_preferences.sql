@@ -0,0 +1,10 @@
+-- Per-user display and workflow preferences (theme, page sizes, default
+-- filters, scanner sounds). Keys and allowed values are defined in code
+-- (infrastructure/userprefs); a missing row means the built-in default.
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, key)
+);
@@ -0,0 +1,23 @@
+-- Stock snapshots exported from a client's WMS, uploaded to reconcile against
+-- what was receipted on the project. Lines are stored summed per SKU (and per
+-- batch when the file has a batch column).
+CREATE TABLE IF NOT EXISTS wms_snapshots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    file_name TEXT NOT NULL DEFAULT '',
+    has_batch BOOLEAN NOT NULL DEFAULT 0,
+    row_count INTEGER NOT NULL DEFAULT 0,
+    error_count INTEGER NOT NULL DEFAULT 0,
+    uploaded_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_wms_snapshots_project ON wms_snapshots(project_id, id);
+
+CREATE TABLE IF NOT EXISTS wms_snapshot_lines (
+    snapshot_id INTEGER NOT NULL REFERENCES wms_snapshots(id) ON DELETE CASCADE,
+    sku TEXT NOT NULL,
+    batch_number TEXT NOT NULL DEFAULT '',
+    qty INTEGER NOT NULL,
+    PRIMARY KEY (snapshot_id, sku, batch_number)
+);
@@ -0,0 +1,21 @@
+-- A stub for every photo blurred or deleted by hand, or deleted when its
+-- project's retention period ran out. The stub keeps where the photo was and
+-- why it went, never the image. Receipt and photo ids are kept as plain
+-- values so the stub outlives the rows it describes.
+CREATE TABLE IF NOT EXISTS photo_redactions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    pallet_id INTEGER NOT NULL,
+    pallet_receipt_id INTEGER NOT NULL,
+    source TEXT NOT NULL CHECK (source IN ('receipt_photos', 'pallet_receipts')),
+    photo_id INTEGER NOT NULL,
+    photo_name TEXT NOT NULL DEFAULT '',
+    photo_created_at DATETIME,
+    action TEXT NOT NULL CHECK (action IN ('blurred', 'deleted', 'expired')),
+    note TEXT NOT NULL DEFAULT '',
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_photo_redactions_project ON photo_redactions(project_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_photo_redactions_receipt ON photo_redactions(pallet_receipt_id);
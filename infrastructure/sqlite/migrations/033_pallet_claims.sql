@@ -0,0 +1,9 @@
+-- Who is receipting a pallet right now. A claim lasts while its holder keeps
+-- working the pallet and lapses after a quiet spell; closing or cancelling
+-- the pallet removes it.
+CREATE TABLE IF NOT EXISTS pallet_claims (
+    pallet_id INTEGER PRIMARY KEY REFERENCES pallets(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    claimed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
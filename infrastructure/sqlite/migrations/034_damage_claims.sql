@@ -0,0 +1,22 @@
+-- Insurance claims raised for damaged receipt lines. The register keeps which
+-- lines went into which claim, so a line is only claimed once and a claim
+-- pack can be regenerated later. A claim scoped to one delivery stores its
+-- delivery reference; an empty reference covers the whole project.
+CREATE TABLE IF NOT EXISTS damage_claims (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    delivery_reference TEXT NOT NULL DEFAULT '',
+    claim_reference TEXT NOT NULL DEFAULT '',
+    line_count INTEGER NOT NULL DEFAULT 0,
+    damaged_qty INTEGER NOT NULL DEFAULT 0,
+    created_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_damage_claims_project ON damage_claims(project_id, id);
+
+CREATE TABLE IF NOT EXISTS damage_claim_lines (
+    claim_id INTEGER NOT NULL REFERENCES damage_claims(id) ON DELETE CASCADE,
+    pallet_receipt_id INTEGER NOT NULL UNIQUE REFERENCES pallet_receipts(id) ON DELETE CASCADE,
+    PRIMARY KEY (claim_id, pallet_receipt_id)
+);
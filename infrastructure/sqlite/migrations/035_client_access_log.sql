@@ -0,0 +1,16 @@
+-- Pages, exports and photos viewed by client users, per project. Rows are
+-- written in batches by the access log recorder and deleted once they pass
+-- the project's access_log.retention_days setting. The username is kept so
+-- the log still reads after a user is deleted.
+CREATE TABLE IF NOT EXISTS client_access_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    username TEXT NOT NULL DEFAULT '',
+    kind TEXT NOT NULL,
+    path TEXT NOT NULL,
+    query TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_client_access_log_project ON client_access_log(project_id, created_at);
@@ -0,0 +1,27 @@
+-- Warehouse sites run from one instance. Projects and kiosk devices belong to
+-- at most one site; users can work at several. Unassigned rows are visible
+-- only to admins who are not restricted to particular sites.
+CREATE TABLE IF NOT EXISTS sites (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    active INTEGER NOT NULL DEFAULT 1,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_sites (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    site_id INTEGER NOT NULL REFERENCES sites(id) ON DELETE CASCADE,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, site_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sites_site ON user_sites(site_id);
+
+ALTER TABLE projects ADD COLUMN site_id INTEGER REFERENCES sites(id) ON DELETE SET NULL;
+ALTER TABLE kiosk_devices ADD COLUMN site_id INTEGER REFERENCES sites(id) ON DELETE SET NULL;
+
+-- The site switcher narrows admin lists to one site; NULL shows every site
+-- the user can see.
+ALTER TABLE sessions ADD COLUMN active_site_id INTEGER REFERENCES sites(id) ON DELETE SET NULL;
@@ -0,0 +1,2 @@
+-- Time of the session's last re-authentication for controlled actions.
+ALTER TABLE sessions ADD COLUMN step_up_at DATETIME;
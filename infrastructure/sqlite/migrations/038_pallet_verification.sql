@@ -0,0 +1,13 @@
+-- Verification scans made before closing a pallet, for projects that verify
+-- contents before close. A scan matches lines by carton barcode, or by SKU
+-- for lines without one; matched_lines keeps what it matched at the time.
+CREATE TABLE IF NOT EXISTS pallet_verification_scans (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    pallet_id INTEGER NOT NULL REFERENCES pallets(id) ON DELETE CASCADE,
+    barcode TEXT NOT NULL,
+    matched_lines INTEGER NOT NULL DEFAULT 0,
+    scanned_by_user_id INTEGER NOT NULL REFERENCES users(id),
+    scanned_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_pallet_verification_scans_pallet ON pallet_verification_scans(pallet_id, barcode);
@@ -0,0 +1,18 @@
+-- One row per project per UTC day for BI tools. Receipt figures count the
+-- lines receipted that day; pallet counts are the statuses at the last
+-- capture of the day, since pallets keep no status history.
+CREATE TABLE IF NOT EXISTS project_kpi_snapshots (
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    snapshot_date TEXT NOT NULL,
+    units_received INTEGER NOT NULL DEFAULT 0,
+    lines_received INTEGER NOT NULL DEFAULT 0,
+    damaged_units INTEGER NOT NULL DEFAULT 0,
+    unknown_lines INTEGER NOT NULL DEFAULT 0,
+    pallets_created INTEGER NOT NULL DEFAULT 0,
+    pallets_open INTEGER NOT NULL DEFAULT 0,
+    pallets_closed INTEGER NOT NULL DEFAULT 0,
+    pallets_labelled INTEGER NOT NULL DEFAULT 0,
+    pallets_cancelled INTEGER NOT NULL DEFAULT 0,
+    captured_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, snapshot_date)
+);
@@ -0,0 +1,14 @@
+-- Every printed pallet ID label, numbered per pallet. The serial is printed
+-- in the label's barcode, so a damaged label that was voided and reissued
+-- can be told apart from its replacement when scanned.
+CREATE TABLE IF NOT EXISTS pallet_label_instances (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    pallet_id INTEGER NOT NULL REFERENCES pallets(id) ON DELETE CASCADE,
+    serial INTEGER NOT NULL CHECK (serial > 0),
+    printed_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    printed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    voided_at DATETIME,
+    voided_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    void_reason TEXT NOT NULL DEFAULT '',
+    UNIQUE (pallet_id, serial)
+);
@@ -0,0 +1,29 @@
+-- Site-specific help written by admins. A notice targets one role, and
+-- either one project or every project (project_id NULL). It shows on that
+-- role's help page and, when show_on_receipt is set, as a banner on the
+-- receipt page until the user dismisses it. Each edit bumps revision and a
+-- dismissal records the revision it hid, so editing a notice shows it again
+-- to users who dismissed an earlier version.
+CREATE TABLE IF NOT EXISTS help_notices (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER REFERENCES projects(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('admin', 'scanner', 'client')),
+    title TEXT NOT NULL,
+    body TEXT NOT NULL DEFAULT '',
+    show_on_receipt INTEGER NOT NULL DEFAULT 0,
+    active INTEGER NOT NULL DEFAULT 1,
+    revision INTEGER NOT NULL DEFAULT 1,
+    updated_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_help_notices_role ON help_notices(role, active, project_id);
+
+CREATE TABLE IF NOT EXISTS help_notice_dismissals (
+    notice_id INTEGER NOT NULL REFERENCES help_notices(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL DEFAULT 1,
+    dismissed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (notice_id, user_id)
+);
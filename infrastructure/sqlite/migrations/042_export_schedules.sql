@@ -0,0 +1,26 @@
+-- Export presets that run on a schedule and deliver to a Google Sheets tab.
+-- replace mode rewrites the tab each run; append mode adds the run's rows
+-- below the existing ones. export_runs records where each run was sent.
+CREATE TABLE IF NOT EXISTS export_schedules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    export_type TEXT NOT NULL CHECK (export_type IN ('receipts_csv', 'pallet_status_csv')),
+    target TEXT NOT NULL DEFAULT 'google_sheets' CHECK (target IN ('google_sheets')),
+    spreadsheet_id TEXT NOT NULL,
+    sheet_tab TEXT NOT NULL,
+    write_mode TEXT NOT NULL DEFAULT 'replace' CHECK (write_mode IN ('append', 'replace')),
+    interval_hours INTEGER NOT NULL CHECK (interval_hours > 0),
+    active INTEGER NOT NULL DEFAULT 1,
+    next_run_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_run_at DATETIME,
+    last_success_at DATETIME,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_export_schedules_due ON export_schedules(active, next_run_at);
+
+ALTER TABLE export_runs ADD COLUMN destination TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- Catalog sync can deactivate stock items a client has dropped from their
+-- master file. Inactive items stay for history but are no longer offered
+-- when scanning; upserting the SKU again reactivates it.
+ALTER TABLE stock_items ADD COLUMN active INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE stock_items ADD COLUMN deactivated_at DATETIME;
@@ -0,0 +1,19 @@
+-- Unused pallet cleanup. An exemption keeps a created pallet from being
+-- cancelled automatically however long it stays empty; it is a side table
+-- because the pallets table is rebuilt by 003 on startup. pallet_cleanups
+-- records each pallet the sweeper cancelled, with the idle days setting that
+-- applied, for the per-project report.
+CREATE TABLE IF NOT EXISTS pallet_cleanup_exemptions (
+    pallet_id INTEGER PRIMARY KEY REFERENCES pallets(id) ON DELETE CASCADE,
+    exempted_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    exempted_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS pallet_cleanups (
+    pallet_id INTEGER PRIMARY KEY REFERENCES pallets(id) ON DELETE CASCADE,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    idle_days INTEGER NOT NULL CHECK (idle_days > 0),
+    cancelled_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_pallet_cleanups_project ON pallet_cleanups(project_id, cancelled_at);
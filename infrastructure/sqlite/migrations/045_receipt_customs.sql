@@ -0,0 +1,5 @@
+-- Customs data captured per receipt line when the project asks for it: the
+-- ISO 3166-1 alpha-2 country of origin and the HS commodity code, digits
+-- only. Empty when not captured.
+ALTER TABLE pallet_receipts ADD COLUMN country_of_origin TEXT NOT NULL DEFAULT '';
+ALTER TABLE pallet_receipts ADD COLUMN hs_code TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+-- Which exports a client user may download. A client without a row keeps
+-- every export, so existing clients are unaffected until an admin limits them.
+CREATE TABLE IF NOT EXISTS client_export_permissions (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    summary_csv BOOLEAN NOT NULL DEFAULT 1,
+    detail_csv BOOLEAN NOT NULL DEFAULT 1,
+    photo_zip BOOLEAN NOT NULL DEFAULT 1,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
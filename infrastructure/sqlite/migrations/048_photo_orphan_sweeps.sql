@@ -0,0 +1,12 @@
+-- Photo data found without its receipt line and removed by the orphan
+-- sweep. Only sweeps that removed something are recorded.
+CREATE TABLE IF NOT EXISTS photo_orphan_sweeps (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    photos_removed INTEGER NOT NULL DEFAULT 0,
+    uploads_removed INTEGER NOT NULL DEFAULT 0,
+    chunks_removed INTEGER NOT NULL DEFAULT 0,
+    bytes_reclaimed INTEGER NOT NULL DEFAULT 0,
+    swept_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_photo_orphan_sweeps_swept ON photo_orphan_sweeps(swept_at);
@@ -0,0 +1,10 @@
+-- The admin switch for read-only maintenance mode. There is only ever the
+-- one row; ops can also turn maintenance on with a flag file, which is not
+-- recorded here.
+CREATE TABLE IF NOT EXISTS maintenance_mode (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    enabled BOOLEAN NOT NULL DEFAULT 0,
+    message TEXT NOT NULL DEFAULT '',
+    updated_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,33 @@
+-- Arrival booking. Admins open delivery slots per day, each taking up to
+-- capacity bookings; carriers (through the API) and admins book deliveries
+-- against them and the gatehouse checks them in on arrival. A booking's
+-- delivery reference links it to the pallets pre-created for that delivery
+-- through pallet_attributes.
+CREATE TABLE IF NOT EXISTS delivery_slots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    slot_date TEXT NOT NULL,
+    start_time TEXT NOT NULL,
+    end_time TEXT NOT NULL,
+    capacity INTEGER NOT NULL DEFAULT 1 CHECK (capacity > 0),
+    created_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (slot_date, start_time)
+);
+
+CREATE TABLE IF NOT EXISTS delivery_bookings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    slot_id INTEGER NOT NULL REFERENCES delivery_slots(id) ON DELETE CASCADE,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    carrier TEXT NOT NULL,
+    delivery_reference TEXT NOT NULL DEFAULT '',
+    expected_pallets INTEGER NOT NULL DEFAULT 0 CHECK (expected_pallets >= 0),
+    status TEXT NOT NULL DEFAULT 'booked' CHECK (status IN ('booked', 'arrived', 'cancelled')),
+    source TEXT NOT NULL DEFAULT 'web' CHECK (source IN ('web', 'api')),
+    booked_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    arrived_at DATETIME,
+    checked_in_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_delivery_bookings_slot ON delivery_bookings(slot_id, status);
+CREATE INDEX IF NOT EXISTS idx_delivery_bookings_project ON delivery_bookings(project_id, status);
@@ -0,0 +1,36 @@
+-- Clients can answer comment emails instead of logging in. Each thread (one
+-- pallet's client comments on one SKU instance) has a token quoted in emails
+-- as [ref:token]. Replies are only accepted from the address registered for
+-- a client user, and every inbound message is logged with what became of it.
+CREATE TABLE IF NOT EXISTS client_comment_threads (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    token TEXT NOT NULL UNIQUE,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    pallet_id INTEGER NOT NULL REFERENCES pallets(id) ON DELETE CASCADE,
+    sku TEXT NOT NULL,
+    uom TEXT NOT NULL DEFAULT '',
+    batch_number TEXT NOT NULL DEFAULT '',
+    -- YYYY-MM-DD, or blank for lines without an expiry.
+    expiry_date TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (project_id, pallet_id, sku, uom, batch_number, expiry_date)
+);
+
+CREATE TABLE IF NOT EXISTS client_reply_addresses (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL UNIQUE COLLATE NOCASE,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS inbound_emails (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    sender TEXT NOT NULL DEFAULT '',
+    subject TEXT NOT NULL DEFAULT '',
+    thread_token TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL CHECK (status IN ('accepted', 'rejected')),
+    reason TEXT NOT NULL DEFAULT '',
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    received_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_inbound_emails_received ON inbound_emails(received_at);
@@ -0,0 +1,3 @@
+-- High-value stock items make the receipt page show the entered details in
+-- large type for the scanner to confirm before the line is saved.
+ALTER TABLE stock_items ADD COLUMN high_value INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,33 @@
+-- Cold storage moves an inactive project's photos out of the database into
+-- files under COLD_STORAGE_DIR. The photo rows stay and keep their name and
+-- type, but their blob is emptied; each archived photo has a reference here
+-- to the file holding it until the project is rehydrated.
+CREATE TABLE IF NOT EXISTS cold_storage_photos (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    -- receipt_photos for gallery photos, pallet_receipts for the stock photo.
+    source TEXT NOT NULL CHECK (source IN ('receipt_photos', 'pallet_receipts')),
+    photo_id INTEGER NOT NULL,
+    path TEXT NOT NULL,
+    bytes INTEGER NOT NULL,
+    sha256 TEXT NOT NULL,
+    archived_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (source, photo_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_cold_storage_photos_project ON cold_storage_photos(project_id);
+
+-- Every archive or rehydrate run, including the sweeper's (user_id NULL).
+CREATE TABLE IF NOT EXISTS cold_storage_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    action TEXT NOT NULL CHECK (action IN ('archive', 'rehydrate')),
+    photos INTEGER NOT NULL DEFAULT 0,
+    bytes INTEGER NOT NULL DEFAULT 0,
+    -- How much the database file shrank after an archive run's vacuum.
+    db_bytes_freed INTEGER NOT NULL DEFAULT 0,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_cold_storage_runs_created ON cold_storage_runs(created_at);
@@ -0,0 +1,15 @@
+-- Serial-tracked SKUs are receipted by scanning each unit's serial number.
+-- A serial can only be received once per project.
+CREATE TABLE IF NOT EXISTS receipt_serials (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    pallet_receipt_id INTEGER NOT NULL REFERENCES pallet_receipts(id) ON DELETE CASCADE,
+    serial TEXT NOT NULL COLLATE NOCASE,
+    scanned_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (project_id, serial)
+);
+
+CREATE INDEX IF NOT EXISTS idx_receipt_serials_receipt ON receipt_serials(pallet_receipt_id);
+
+ALTER TABLE stock_items ADD COLUMN serial_tracked INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,20 @@
+-- Time-boxed read-only links that let an external auditor browse one
+-- project without a user account. Like embed tokens, the token travels in
+-- the URL so only its SHA-256 hash is stored. A link stops working at
+-- expires_at or as soon as it is revoked; every page it opens is written to
+-- client_access_log under the auditor's name.
+CREATE TABLE IF NOT EXISTS auditor_links (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    auditor_name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    token_prefix TEXT NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_by_user_id INTEGER NOT NULL REFERENCES users(id),
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME,
+    revoked_at DATETIME,
+    revoked_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_auditor_links_project ON auditor_links(project_id, created_at);
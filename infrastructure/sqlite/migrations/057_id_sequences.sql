@@ -0,0 +1,15 @@
+-- Named counters for ids that are printed on labels and must never be
+-- handed out twice. Pallet ids were MAX(id)+1, which reuses the id of a
+-- deleted last pallet and leaves concurrent creators racing on the same
+-- value; they now come from the 'pallets' row. Re-running this at startup
+-- only ever moves the counter forward past rows written without it.
+CREATE TABLE IF NOT EXISTS id_sequences (
+    name TEXT PRIMARY KEY,
+    last_value INTEGER NOT NULL DEFAULT 0
+);
+
+INSERT OR IGNORE INTO id_sequences (name, last_value) VALUES ('pallets', 0);
+
+UPDATE id_sequences
+SET last_value = MAX(last_value, (SELECT COALESCE(MAX(id), 0) FROM pallets))
+WHERE name = 'pallets';
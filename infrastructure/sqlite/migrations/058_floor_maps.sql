@@ -0,0 +1,34 @@
+-- Floor maps lay a site out as a grid of cells, rows by columns. Zones name
+-- rectangles of the grid (an aisle, bulk storage, quarantine). A pallet is
+-- stored in at most one cell of its project's site; locations are a side
+-- table because the pallets table is rebuilt by 003 on startup.
+CREATE TABLE IF NOT EXISTS floor_maps (
+    site_id INTEGER PRIMARY KEY REFERENCES sites(id) ON DELETE CASCADE,
+    rows INTEGER NOT NULL CHECK (rows > 0),
+    cols INTEGER NOT NULL CHECK (cols > 0),
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS floor_map_zones (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    site_id INTEGER NOT NULL REFERENCES sites(id) ON DELETE CASCADE,
+    code TEXT NOT NULL,
+    name TEXT NOT NULL,
+    first_row INTEGER NOT NULL,
+    last_row INTEGER NOT NULL,
+    first_col INTEGER NOT NULL,
+    last_col INTEGER NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (site_id, code)
+);
+
+CREATE TABLE IF NOT EXISTS pallet_locations (
+    pallet_id INTEGER PRIMARY KEY REFERENCES pallets(id) ON DELETE CASCADE,
+    site_id INTEGER NOT NULL REFERENCES sites(id) ON DELETE CASCADE,
+    row_no INTEGER NOT NULL,
+    col_no INTEGER NOT NULL,
+    placed_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    placed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_pallet_locations_cell ON pallet_locations(site_id, row_no, col_no);
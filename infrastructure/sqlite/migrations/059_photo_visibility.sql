@@ -0,0 +1,16 @@
+-- Receipt photos held back from client users, such as damage investigation
+-- photos. A photo is client-visible unless it has a row here. Gallery photo
+-- ids are never reused, so a row left behind by a deleted photo is harmless.
+CREATE TABLE IF NOT EXISTS internal_photos (
+    source TEXT NOT NULL CHECK (source IN ('receipt_photos', 'pallet_receipts')),
+    photo_id INTEGER NOT NULL,
+    pallet_receipt_id INTEGER NOT NULL REFERENCES pallet_receipts(id) ON DELETE CASCADE,
+    marked_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    marked_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (source, photo_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_internal_photos_receipt ON internal_photos(pallet_receipt_id);
+
+-- Deferred uploads carry the capture choice until the worker stores them.
+ALTER TABLE photo_uploads ADD COLUMN internal INTEGER NOT NULL DEFAULT 0;
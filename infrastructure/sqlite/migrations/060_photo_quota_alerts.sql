@@ -0,0 +1,9 @@
+-- Projects whose photo storage has reached the alert share of their quota,
+-- so admins are notified once per quota. The row is removed when usage falls
+-- back below the threshold.
+CREATE TABLE IF NOT EXISTS photo_quota_alerts (
+    project_id INTEGER PRIMARY KEY REFERENCES projects(id) ON DELETE CASCADE,
+    quota_bytes INTEGER NOT NULL,
+    usage_bytes INTEGER NOT NULL,
+    alerted_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
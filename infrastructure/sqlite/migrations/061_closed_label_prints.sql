@@ -0,0 +1,13 @@
+-- One row each time a pallet's closed labels are printed. Pallets printed
+-- together in one PDF share a batch id; a single pallet print has none.
+CREATE TABLE IF NOT EXISTS closed_label_prints (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    pallet_id INTEGER NOT NULL REFERENCES pallets(id) ON DELETE CASCADE,
+    batch_id TEXT NOT NULL DEFAULT '',
+    batch_position INTEGER NOT NULL DEFAULT 1,
+    printed_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    printed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_closed_label_prints_pallet ON closed_label_prints(pallet_id);
+CREATE INDEX IF NOT EXISTS idx_closed_label_prints_batch ON closed_label_prints(batch_id) WHERE batch_id <> '';
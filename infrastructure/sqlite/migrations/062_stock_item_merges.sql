@@ -0,0 +1,34 @@
+-- Admins merge a duplicate stock item into the one it should have been,
+-- such as "SKU-A " into "SKU-A". The source item is deleted and rows naming
+-- its SKU are re-pointed at the target. Each merge keeps the source item as
+-- it was and the rows it re-pointed, so it can be undone.
+CREATE TABLE IF NOT EXISTS stock_item_merges (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    source_item_id INTEGER NOT NULL,
+    source_sku TEXT NOT NULL,
+    source_description TEXT NOT NULL,
+    source_uom TEXT NOT NULL DEFAULT '',
+    source_active INTEGER NOT NULL DEFAULT 1,
+    source_high_value INTEGER NOT NULL DEFAULT 0,
+    source_serial_tracked INTEGER NOT NULL DEFAULT 0,
+    source_created_at DATETIME NOT NULL,
+    target_item_id INTEGER NOT NULL,
+    target_sku TEXT NOT NULL,
+    -- The target's flags before the merge took on the source's.
+    target_high_value INTEGER NOT NULL DEFAULT 0,
+    target_serial_tracked INTEGER NOT NULL DEFAULT 0,
+    merged_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    merged_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    undone_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    undone_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_item_merges_project ON stock_item_merges(project_id, merged_at);
+
+CREATE TABLE IF NOT EXISTS stock_item_merge_rows (
+    merge_id INTEGER NOT NULL REFERENCES stock_item_merges(id) ON DELETE CASCADE,
+    source_table TEXT NOT NULL CHECK (source_table IN ('pallet_receipts', 'stock_item_barcodes', 'sku_client_comments', 'client_comment_threads')),
+    row_id INTEGER NOT NULL,
+    PRIMARY KEY (merge_id, source_table, row_id)
+);
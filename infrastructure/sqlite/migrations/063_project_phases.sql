@@ -0,0 +1,25 @@
+-- Receiving phases within a project, such as wave 1 and wave 2. Pallets
+-- join the current phase, the open phase started last, when they are
+-- created; closing a phase locks its pallets read-only while the project
+-- stays active for the next one. pallet_phases is a side table because the
+-- pallets table is rebuilt by 003 on startup.
+CREATE TABLE IF NOT EXISTS project_phases (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'closed')),
+    created_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    closed_by_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    closed_at DATETIME,
+    UNIQUE (project_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_project_phases_project ON project_phases(project_id, status);
+
+CREATE TABLE IF NOT EXISTS pallet_phases (
+    pallet_id INTEGER PRIMARY KEY REFERENCES pallets(id) ON DELETE CASCADE,
+    phase_id INTEGER NOT NULL REFERENCES project_phases(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_pallet_phases_phase ON pallet_phases(phase_id);
@@ -0,0 +1,7 @@
+-- How many times each pallet number label has been printed, so label stock
+-- used can be compared with pallets created. A side table because the
+-- pallets table is rebuilt by 003 on startup.
+CREATE TABLE IF NOT EXISTS pallet_label_prints (
+    pallet_id INTEGER PRIMARY KEY REFERENCES pallets(id) ON DELETE CASCADE,
+    print_count INTEGER NOT NULL DEFAULT 0 CHECK (print_count >= 0)
+);
@@ -0,0 +1,11 @@
+-- Receipt lines a stock item merge added onto a matching line of the target
+-- SKU on the same pallet, as a repeat scan would have. The snapshot keeps
+-- the combined line whole, with the photos, serials and custom values that
+-- moved across, so undoing the merge can split it back out.
+CREATE TABLE IF NOT EXISTS stock_item_merge_lines (
+    merge_id INTEGER NOT NULL REFERENCES stock_item_merges(id) ON DELETE CASCADE,
+    receipt_id INTEGER NOT NULL,
+    into_receipt_id INTEGER NOT NULL,
+    snapshot TEXT NOT NULL,
+    PRIMARY KEY (merge_id, receipt_id)
+);
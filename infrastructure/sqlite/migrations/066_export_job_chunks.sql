@@ -0,0 +1,9 @@
+-- Large export files, such as project handover bundles, are stored in chunks
+-- so neither building nor downloading them holds the whole file in memory.
+-- Small files stay in export_jobs.file_blob.
+CREATE TABLE IF NOT EXISTS export_job_chunks (
+    job_id INTEGER NOT NULL REFERENCES export_jobs(id) ON DELETE CASCADE,
+    seq INTEGER NOT NULL,
+    data BLOB NOT NULL,
+    PRIMARY KEY (job_id, seq)
+);
@@ -0,0 +1,7 @@
+-- The From header of an inbound reply can be forged, so a reply is only
+-- accepted when the mail provider reports an SPF or DKIM pass for it, or when
+-- it was sent to the thread's own reply address. That address carries a
+-- second, per-thread key that is never quoted in the subject or body.
+ALTER TABLE client_comment_threads ADD COLUMN reply_key TEXT NOT NULL DEFAULT '';
+
+UPDATE client_comment_threads SET reply_key = lower(hex(randomblob(8))) WHERE reply_key = '';
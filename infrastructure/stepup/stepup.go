@@ -0,0 +1,142 @@
+// Package stepup asks a signed-in user to prove it is still them before a
+// controlled action: printing a closed pallet label or cancelling a pallet.
+// Projects opt in through the security.step_up setting. The user re-enters
+// their password, or their kiosk PIN, and the step-up then covers further
+// actions on the session for security.step_up_minutes. Every attempt is
+// written to the audit log against the pallet it was for.
+package stepup
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/argon"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/kiosk"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+// Actions a step-up is asked for, recorded in the audit entry.
+const (
+	ActionPrintClosedLabel = "print_closed_label"
+	ActionCancelPallet     = "cancel_pallet"
+)
+
+var (
+	ErrRequired = errors.New("re-enter your password or PIN to continue")
+	ErrInvalid  = errors.New("password or PIN is incorrect")
+)
+
+// Needed reports whether the session must step up before a controlled
+// action in projectID.
+func Needed(ctx context.Context, db *sqlite.DB, session models.Session, projectID int64, now time.Time) (bool, error) {
+	settings, err := projectsettings.Load(ctx, db, projectID)
+	if err != nil {
+		return false, err
+	}
+	if !settings.Bool(projectsettings.SecurityStepUp) {
+		return false, nil
+	}
+	return !Fresh(session.StepUpAt, settings.Int(projectsettings.SecurityStepUpMinutes), now), nil
+}
+
+// Fresh reports whether a step-up made at stepUpAt still covers now.
+func Fresh(stepUpAt *time.Time, minutes int64, now time.Time) bool {
+	if stepUpAt == nil || minutes <= 0 {
+		return false
+	}
+	return now.Before(stepUpAt.Add(time.Duration(minutes) * time.Minute))
+}
+
+// Require is the gate for controlled actions. When the project asks for a
+// step-up and the session has none that is fresh, secret is checked and the
+// step-up recorded on the session; confirmed is then true and the caller
+// should refresh its cached copy of the session. It returns ErrRequired when
+// a secret is needed but none was given.
+func Require(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, session *models.Session, projectID, palletID int64, action, secret string) (confirmed bool, err error) {
+	now := time.Now()
+	needed, err := Needed(ctx, db, *session, projectID, now)
+	if err != nil || !needed {
+		return false, err
+	}
+	if strings.TrimSpace(secret) == "" {
+		return false, ErrRequired
+	}
+	if err := Confirm(ctx, db, auditSvc, session, palletID, action, secret, now); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UserError reports whether err is a step-up refusal to show the user.
+func UserError(err error) bool {
+	return errors.Is(err, ErrRequired) || errors.Is(err, ErrInvalid) || errors.Is(err, kiosk.ErrPINLocked)
+}
+
+// Confirm checks secret against the user's password, then their kiosk PIN,
+// and records the outcome. On success session.StepUpAt is set to now.
+func Confirm(ctx context.Context, db *sqlite.DB, auditSvc *audit.Service, session *models.Session, palletID int64, action, secret string, now time.Time) error {
+	method, err := verify(ctx, db, session.UserID, secret)
+	ok := err == nil
+	if err != nil && !errors.Is(err, ErrInvalid) && !errors.Is(err, kiosk.ErrPINLocked) {
+		return err
+	}
+
+	writeErr := db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		auditAction := "session.step_up"
+		if ok {
+			if _, err := tx.ExecContext(ctx, `UPDATE sessions SET step_up_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, now.UTC(), session.ID); err != nil {
+				return err
+			}
+		} else {
+			auditAction = "session.step_up_failed"
+		}
+		if auditSvc == nil {
+			return nil
+		}
+		return auditSvc.Write(ctx, tx, session.UserID, auditAction, "pallets", strconv.FormatInt(palletID, 10), nil, map[string]any{
+			"action": action,
+			"method": method,
+		})
+	})
+	if writeErr != nil {
+		return writeErr
+	}
+	if !ok {
+		return err
+	}
+	stepUpAt := now.UTC()
+	session.StepUpAt = &stepUpAt
+	return nil
+}
+
+// verify returns which secret matched: "password" or "pin". The PIN is only
+// tried for users who have one, and counts towards its lockout.
+func verify(ctx context.Context, db *sqlite.DB, userID int64, secret string) (string, error) {
+	var passwordHash, pinHash string
+	if err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.QueryRowContext(ctx, `SELECT password_hash, kiosk_pin_hash FROM users WHERE id = ?`, userID).Scan(&passwordHash, &pinHash)
+	}); err != nil {
+		return "", err
+	}
+	if ok, err := argon.ComparePasswordAndHash(secret, passwordHash); err == nil && ok {
+		return "password", nil
+	}
+	if pinHash == "" {
+		return "password", ErrInvalid
+	}
+	if _, err := kiosk.VerifyPIN(ctx, db, userID, secret, nil); err != nil {
+		if errors.Is(err, kiosk.ErrPINLocked) {
+			return "pin", err
+		}
+		return "pin", ErrInvalid
+	}
+	return "pin", nil
+}
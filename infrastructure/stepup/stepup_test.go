@@ -0,0 +1,167 @@
+package stepup
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/argon"
+	"receipter/infrastructure/audit"
+	"receipter/infrastructure/kiosk"
+	"receipter/infrastructure/projectsettings"
+	"receipter/infrastructure/sqlite"
+	"receipter/models"
+)
+
+func openStepUpTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "stepup-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+
+	hash, err := argon.CreateHash("Scanner123!", argon.DefaultParams)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		for _, stmt := range []string{
+			`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'x', 'admin'), (2, 'scanner1', '` + hash + `', 'scanner')`,
+			`INSERT INTO projects (id, name, description, project_date, client_name, code, status) VALUES (1, 'Project', 'Project', DATE('now'), 'Client', 'project', 'active')`,
+			`INSERT INTO pallets (id, project_id, status) VALUES (1, 1, 'closed')`,
+			`INSERT INTO sessions (id, user_id, active_project_id, expires_at) VALUES ('s1', 2, 1, DATETIME('now', '+1 hour'))`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return db
+}
+
+func enableStepUp(t *testing.T, db *sqlite.DB, minutes string) {
+	t.Helper()
+	err := projectsettings.SaveProject(context.Background(), db, nil, 1, 1, map[string]string{
+		projectsettings.SecurityStepUp:        "true",
+		projectsettings.SecurityStepUpMinutes: minutes,
+	})
+	if err != nil {
+		t.Fatalf("save settings: %v", err)
+	}
+}
+
+func countAudit(t *testing.T, db *sqlite.DB, action string) int {
+	t.Helper()
+	var n int
+	if err := db.WithReadTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT COUNT(*) FROM audit_logs WHERE action = ? AND entity_type = 'pallets' AND entity_id = '1'`, action).Scan(ctx, &n)
+	}); err != nil {
+		t.Fatalf("count audit: %v", err)
+	}
+	return n
+}
+
+func TestFresh(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	recent := now.Add(-4 * time.Minute)
+	old := now.Add(-6 * time.Minute)
+	if Fresh(nil, 5, now) {
+		t.Fatalf("expected no step-up to be stale")
+	}
+	if !Fresh(&recent, 5, now) {
+		t.Fatalf("expected step-up 4 minutes ago to cover a 5 minute window")
+	}
+	if Fresh(&old, 5, now) {
+		t.Fatalf("expected step-up 6 minutes ago to be stale")
+	}
+	if Fresh(&recent, 0, now) {
+		t.Fatalf("expected a 0 minute window to ask every time")
+	}
+}
+
+func TestRequireIsOffByDefault(t *testing.T) {
+	db := openStepUpTestDB(t)
+	session := models.Session{ID: "s1", UserID: 2}
+
+	confirmed, err := Require(context.Background(), db, audit.NewService(), &session, 1, 1, ActionCancelPallet, "")
+	if err != nil || confirmed {
+		t.Fatalf("expected no step-up without the setting, got confirmed=%v err=%v", confirmed, err)
+	}
+}
+
+func TestRequireChecksPasswordAndAudits(t *testing.T) {
+	db := openStepUpTestDB(t)
+	ctx := context.Background()
+	auditSvc := audit.NewService()
+	enableStepUp(t, db, "5")
+	session := models.Session{ID: "s1", UserID: 2}
+
+	if _, err := Require(ctx, db, auditSvc, &session, 1, 1, ActionPrintClosedLabel, ""); !errors.Is(err, ErrRequired) {
+		t.Fatalf("expected ErrRequired, got %v", err)
+	}
+	if _, err := Require(ctx, db, auditSvc, &session, 1, 1, ActionPrintClosedLabel, "wrong"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected ErrInvalid, got %v", err)
+	}
+	if got := countAudit(t, db, "session.step_up_failed"); got != 1 {
+		t.Fatalf("expected 1 failed step-up audit, got %d", got)
+	}
+
+	confirmed, err := Require(ctx, db, auditSvc, &session, 1, 1, ActionPrintClosedLabel, "Scanner123!")
+	if err != nil || !confirmed || session.StepUpAt == nil {
+		t.Fatalf("expected step-up confirmed, got confirmed=%v err=%v session=%+v", confirmed, err, session)
+	}
+	if got := countAudit(t, db, "session.step_up"); got != 1 {
+		t.Fatalf("expected 1 step-up audit, got %d", got)
+	}
+	var stored *time.Time
+	if err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT step_up_at FROM sessions WHERE id = 's1'`).Scan(ctx, &stored)
+	}); err != nil || stored == nil {
+		t.Fatalf("expected step_up_at stored, got %v err=%v", stored, err)
+	}
+
+	// Within the window the step-up covers the next action without a secret.
+	confirmed, err = Require(ctx, db, auditSvc, &session, 1, 1, ActionCancelPallet, "")
+	if err != nil || confirmed {
+		t.Fatalf("expected fresh step-up to cover the action, got confirmed=%v err=%v", confirmed, err)
+	}
+}
+
+func TestRequireAcceptsKioskPIN(t *testing.T) {
+	db := openStepUpTestDB(t)
+	ctx := context.Background()
+	auditSvc := audit.NewService()
+	enableStepUp(t, db, "0")
+	if err := kiosk.SetPIN(ctx, db, auditSvc, 1, 2, "4821"); err != nil {
+		t.Fatalf("set pin: %v", err)
+	}
+	session := models.Session{ID: "s1", UserID: 2}
+
+	if confirmed, err := Require(ctx, db, auditSvc, &session, 1, 1, ActionCancelPallet, "4821"); err != nil || !confirmed {
+		t.Fatalf("expected PIN accepted, got confirmed=%v err=%v", confirmed, err)
+	}
+	// A 0 minute window asks again for the next action.
+	if _, err := Require(ctx, db, auditSvc, &session, 1, 1, ActionCancelPallet, ""); !errors.Is(err, ErrRequired) {
+		t.Fatalf("expected ErrRequired with a 0 minute window, got %v", err)
+	}
+}
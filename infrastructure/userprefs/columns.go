@@ -0,0 +1,167 @@
+package userprefs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+// Column tables whose optional columns each user can hide. The stored value
+// is the comma-separated IDs of the hidden columns; no row shows them all.
+const (
+	ProgressColumns  = "columns.progress"
+	SKUViewColumns   = "columns.sku_view"
+	SKUDetailColumns = "columns.sku_detail"
+)
+
+// Column is an optional column of a data table. Identifying and action
+// columns are not listed and always show.
+type Column struct {
+	ID    string
+	Label string
+}
+
+// ColumnTable describes a data table with hideable columns.
+type ColumnTable struct {
+	Key     string
+	Label   string
+	Columns []Column
+}
+
+// ColumnTables lists every table with hideable columns.
+var ColumnTables = []ColumnTable{
+	{
+		Key:   ProgressColumns,
+		Label: "Pallet Progress",
+		Columns: []Column{
+			{ID: "status", Label: "Status"},
+			{ID: "lines", Label: "Lines"},
+			{ID: "open_for", Label: "Open For"},
+			{ID: "created", Label: "Created"},
+			{ID: "closed", Label: "Closed"},
+			{ID: "reopened", Label: "Reopened"},
+		},
+	},
+	{
+		Key:   SKUViewColumns,
+		Label: "SKU View",
+		Columns: []Column{
+			{ID: "description", Label: "Description"},
+			{ID: "uom", Label: "Unit of Measure"},
+			{ID: "batch", Label: "Batch"},
+			{ID: "expiry", Label: "Expiry"},
+			{ID: "expired", Label: "Expired"},
+			{ID: "total", Label: "Total"},
+			{ID: "trend", Label: "Trend"},
+			{ID: "success", Label: "Success"},
+			{ID: "unknown", Label: "Unknown"},
+			{ID: "damaged", Label: "Damaged"},
+			{ID: "comment", Label: "Comment"},
+			{ID: "client_comment", Label: "Client Comment"},
+			{ID: "photo", Label: "Photo"},
+		},
+	},
+	{
+		Key:   SKUDetailColumns,
+		Label: "SKU Pallet Breakdown",
+		Columns: []Column{
+			{ID: "total", Label: "Total"},
+			{ID: "success", Label: "Success"},
+			{ID: "unknown", Label: "Unknown"},
+			{ID: "damaged", Label: "Damaged"},
+			{ID: "comments", Label: "Comments"},
+		},
+	},
+}
+
+// LookupColumnTable returns the table for key.
+func LookupColumnTable(key string) (ColumnTable, bool) {
+	for _, table := range ColumnTables {
+		if table.Key == key {
+			return table, true
+		}
+	}
+	return ColumnTable{}, false
+}
+
+// NormalizeHidden returns the hidden column IDs as stored, in table order, or
+// ErrInvalid when one is not a column of the table.
+func (t ColumnTable) NormalizeHidden(ids []string) (string, error) {
+	hidden := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if id == "" {
+			continue
+		}
+		if !t.has(id) {
+			return "", fmt.Errorf("%w: %s has no column %s", ErrInvalid, t.Label, id)
+		}
+		hidden[id] = true
+	}
+	ordered := make([]string, 0, len(hidden))
+	for _, column := range t.Columns {
+		if hidden[column.ID] {
+			ordered = append(ordered, column.ID)
+		}
+	}
+	return strings.Join(ordered, ","), nil
+}
+
+func (t ColumnTable) has(id string) bool {
+	for _, column := range t.Columns {
+		if column.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ColumnVisible reports whether the user shows a table's column. Columns the
+// table does not list always show.
+func (p Prefs) ColumnVisible(tableKey, columnID string) bool {
+	for _, id := range p.HiddenColumns(tableKey) {
+		if id == columnID {
+			return false
+		}
+	}
+	return true
+}
+
+// HiddenColumns returns the IDs of the table's columns the user hid.
+func (p Prefs) HiddenColumns(tableKey string) []string {
+	stored := p.values[tableKey]
+	if stored == "" {
+		return nil
+	}
+	return strings.Split(stored, ",")
+}
+
+// SaveColumns stores which of a table's columns the user hides. Hiding none
+// removes the stored row, which is also how a table is reset to default.
+func SaveColumns(ctx context.Context, db *sqlite.DB, userID int64, tableKey string, hidden []string) error {
+	table, ok := LookupColumnTable(tableKey)
+	if !ok {
+		return fmt.Errorf("%w: unknown table %s", ErrInvalid, tableKey)
+	}
+	value, err := table.NormalizeHidden(hidden)
+	if err != nil {
+		return err
+	}
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if value == "" {
+			_, err := tx.ExecContext(ctx, `DELETE FROM user_preferences WHERE user_id = ? AND key = ?`, userID, tableKey)
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO user_preferences (user_id, key, value, updated_at)
+VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(user_id, key) DO UPDATE SET
+  value = excluded.value,
+  updated_at = CURRENT_TIMESTAMP`, userID, tableKey, value)
+		return err
+	})
+}
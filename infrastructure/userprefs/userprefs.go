@@ -0,0 +1,223 @@
+// Package userprefs stores each user's display and workflow preferences so
+// they survive across sessions and devices. The session middleware loads them
+// into the request context, and pages read them while rendering.
+package userprefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+const (
+	// Theme is the daisyUI theme pages render with.
+	Theme = "ui.theme"
+	// Density tightens table rows and card padding when compact.
+	Density = "ui.density"
+	// ProgressPageSize is the number of pallets per page on the progress
+	// page; "all" shows every pallet on one page.
+	ProgressPageSize = "progress.page_size"
+	// SKUViewFilter is the filter the SKU view opens with.
+	SKUViewFilter = "sku_view.filter"
+	// ScannerSound plays a tone on the receipt page when a line is saved or
+	// refused, at ScannerVolume.
+	ScannerSound  = "scanner.sound"
+	ScannerVolume = "scanner.volume"
+
+	ThemeLight         = "light"
+	ThemeDark          = "dark"
+	DensityComfortable = "comfortable"
+	DensityCompact     = "compact"
+	PageSizeAll        = "all"
+)
+
+var ErrInvalid = errors.New("invalid preference")
+
+// Definition describes one preference and the values it accepts.
+type Definition struct {
+	Key     string
+	Label   string
+	Help    string
+	Default string
+	Choices []string
+}
+
+// Definitions lists every preference in display order.
+var Definitions = []Definition{
+	{
+		Key:     Theme,
+		Label:   "Theme",
+		Default: ThemeLight,
+		Choices: []string{ThemeLight, ThemeDark},
+	},
+	{
+		Key:     Density,
+		Label:   "Density",
+		Help:    "compact fits more table rows on screen.",
+		Default: DensityComfortable,
+		Choices: []string{DensityComfortable, DensityCompact},
+	},
+	{
+		Key:     ProgressPageSize,
+		Label:   "Pallets per page",
+		Help:    "Pallets shown per page on Pallet Progress.",
+		Default: PageSizeAll,
+		Choices: []string{"25", "50", "100", "200", PageSizeAll},
+	},
+	{
+		Key:     SKUViewFilter,
+		Label:   "SKU view filter",
+		Help:    "The filter SKU View opens with.",
+		Default: "all",
+		Choices: []string{"all", "success", "unknown", "damaged", "expired"},
+	},
+	{
+		Key:     ScannerSound,
+		Label:   "Scanner sounds",
+		Help:    "Beep when a receipt line is saved, buzz when it is refused.",
+		Default: "off",
+		Choices: []string{"off", "on"},
+	},
+	{
+		Key:     ScannerVolume,
+		Label:   "Scanner volume",
+		Default: "medium",
+		Choices: []string{"low", "medium", "high"},
+	},
+}
+
+// Lookup returns the definition for key.
+func Lookup(key string) (Definition, bool) {
+	for _, def := range Definitions {
+		if def.Key == key {
+			return def, true
+		}
+	}
+	return Definition{}, false
+}
+
+// Normalize returns raw as stored, or ErrInvalid when it is not one of the
+// definition's choices.
+func (d Definition) Normalize(raw string) (string, error) {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	for _, choice := range d.Choices {
+		if raw == choice {
+			return raw, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s must be one of %s", ErrInvalid, d.Label, strings.Join(d.Choices, ", "))
+}
+
+// Prefs are one user's stored preferences.
+type Prefs struct {
+	values map[string]string
+}
+
+// String returns the stored value of key, or its default.
+func (p Prefs) String(key string) string {
+	if v, ok := p.values[key]; ok {
+		return v
+	}
+	def, _ := Lookup(key)
+	return def.Default
+}
+
+// Int returns the value of key as a number, or 0 when it is not one (such
+// as PageSizeAll).
+func (p Prefs) Int(key string) int {
+	v, _ := strconv.Atoi(p.String(key))
+	return v
+}
+
+// Stored reports whether the user has set key.
+func (p Prefs) Stored(key string) bool {
+	_, ok := p.values[key]
+	return ok
+}
+
+func Load(ctx context.Context, db *sqlite.DB, userID int64) (Prefs, error) {
+	prefs := Prefs{values: make(map[string]string)}
+	rows := make([]struct {
+		Key   string `bun:"key"`
+		Value string `bun:"value"`
+	}, 0)
+	err := db.WithReadTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewRaw(`SELECT key, value FROM user_preferences WHERE user_id = ?`, userID).Scan(ctx, &rows)
+	})
+	if err != nil {
+		return prefs, err
+	}
+	for _, row := range rows {
+		if table, ok := LookupColumnTable(row.Key); ok {
+			if value, err := table.NormalizeHidden(strings.Split(row.Value, ",")); err == nil && value != "" {
+				prefs.values[row.Key] = value
+			}
+			continue
+		}
+		def, ok := Lookup(row.Key)
+		if !ok {
+			continue
+		}
+		if value, err := def.Normalize(row.Value); err == nil {
+			prefs.values[row.Key] = value
+		}
+	}
+	return prefs, nil
+}
+
+// Save stores values for the user. A value equal to the default removes the
+// stored row, so later default changes reach the user.
+func Save(ctx context.Context, db *sqlite.DB, userID int64, values map[string]string) error {
+	normalized := make(map[string]string, len(values))
+	for key, raw := range values {
+		def, ok := Lookup(key)
+		if !ok {
+			return fmt.Errorf("%w: unknown key %s", ErrInvalid, key)
+		}
+		value, err := def.Normalize(raw)
+		if err != nil {
+			return err
+		}
+		normalized[key] = value
+	}
+	return db.WithWriteTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for key, value := range normalized {
+			def, _ := Lookup(key)
+			var err error
+			if value == def.Default {
+				_, err = tx.ExecContext(ctx, `DELETE FROM user_preferences WHERE user_id = ? AND key = ?`, userID, key)
+			} else {
+				_, err = tx.ExecContext(ctx, `
+INSERT INTO user_preferences (user_id, key, value, updated_at)
+VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(user_id, key) DO UPDATE SET
+  value = excluded.value,
+  updated_at = CURRENT_TIMESTAMP`, userID, key, value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type prefsKey struct{}
+
+// NewContext attaches prefs to ctx for rendering.
+func NewContext(ctx context.Context, prefs Prefs) context.Context {
+	return context.WithValue(ctx, prefsKey{}, prefs)
+}
+
+// FromContext returns the request user's prefs, or the defaults when there is
+// no signed-in user.
+func FromContext(ctx context.Context) Prefs {
+	prefs, _ := ctx.Value(prefsKey{}).(Prefs)
+	return prefs
+}
@@ -0,0 +1,158 @@
+package userprefs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/sqlite"
+)
+
+func openPrefsTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "userprefs-test.db")
+	db, err := sqlite.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatalf("runtime caller unavailable")
+	}
+	migrationsDir := filepath.Join(filepath.Dir(file), "..", "sqlite", "migrations")
+	if err := sqlite.ApplyMigrations(context.Background(), db, migrationsDir); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	err = db.WithWriteTx(context.Background(), func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO users (id, username, password_hash, role) VALUES (1, 'scanner', 'hash', 'scanner'), (2, 'other', 'hash', 'scanner')`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return db
+}
+
+func TestSaveAndLoad_PerUserWithDefaults(t *testing.T) {
+	db := openPrefsTestDB(t)
+	ctx := context.Background()
+
+	if err := Save(ctx, db, 1, map[string]string{Theme: "Dark", ProgressPageSize: "50", ScannerSound: "on"}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	prefs, err := Load(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if prefs.String(Theme) != ThemeDark || prefs.Int(ProgressPageSize) != 50 || prefs.String(ScannerSound) != "on" {
+		t.Fatalf("unexpected prefs: theme=%q page=%d sound=%q", prefs.String(Theme), prefs.Int(ProgressPageSize), prefs.String(ScannerSound))
+	}
+	if prefs.String(ScannerVolume) != "medium" || prefs.Stored(ScannerVolume) {
+		t.Fatalf("expected default volume not stored, got %q", prefs.String(ScannerVolume))
+	}
+
+	other, err := Load(ctx, db, 2)
+	if err != nil {
+		t.Fatalf("load other: %v", err)
+	}
+	if other.String(Theme) != ThemeLight || other.Int(ProgressPageSize) != 0 {
+		t.Fatalf("expected defaults for other user, got theme=%q page=%d", other.String(Theme), other.Int(ProgressPageSize))
+	}
+
+	// Saving the default removes the stored row.
+	if err := Save(ctx, db, 1, map[string]string{Theme: ThemeLight}); err != nil {
+		t.Fatalf("save default: %v", err)
+	}
+	var rows int
+	if err := db.R.NewRaw(`SELECT COUNT(1) FROM user_preferences WHERE user_id = 1 AND key = ?`, Theme).Scan(ctx, &rows); err != nil {
+		t.Fatalf("count rows: %v", err)
+	}
+	if rows != 0 {
+		t.Fatalf("expected default theme row removed, got %d", rows)
+	}
+}
+
+func TestSave_RejectsInvalidValues(t *testing.T) {
+	db := openPrefsTestDB(t)
+	ctx := context.Background()
+
+	for _, values := range []map[string]string{
+		{Theme: "neon"},
+		{ProgressPageSize: "7"},
+		{"ui.unknown": "x"},
+	} {
+		if err := Save(ctx, db, 1, values); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("expected ErrInvalid for %v, got %v", values, err)
+		}
+	}
+	prefs, err := Load(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if prefs.Stored(Theme) || prefs.Stored(ProgressPageSize) {
+		t.Fatalf("expected nothing stored after invalid saves")
+	}
+}
+
+func TestFromContext_DefaultsWithoutPrefs(t *testing.T) {
+	prefs := FromContext(context.Background())
+	if prefs.String(Theme) != ThemeLight || prefs.String(Density) != DensityComfortable {
+		t.Fatalf("expected default theme and density, got %q %q", prefs.String(Theme), prefs.String(Density))
+	}
+	ctx := NewContext(context.Background(), Prefs{values: map[string]string{Theme: ThemeDark}})
+	if FromContext(ctx).String(Theme) != ThemeDark {
+		t.Fatalf("expected prefs from context")
+	}
+}
+
+func TestSaveColumns_HideAndReset(t *testing.T) {
+	db := openPrefsTestDB(t)
+	ctx := context.Background()
+
+	if err := SaveColumns(ctx, db, 1, SKUViewColumns, []string{"photo", " Batch ", "batch"}); err != nil {
+		t.Fatalf("save columns: %v", err)
+	}
+	prefs, err := Load(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := prefs.HiddenColumns(SKUViewColumns); len(got) != 2 || got[0] != "batch" || got[1] != "photo" {
+		t.Fatalf("hidden columns = %v, want [batch photo]", got)
+	}
+	if prefs.ColumnVisible(SKUViewColumns, "batch") || !prefs.ColumnVisible(SKUViewColumns, "uom") || !prefs.ColumnVisible(ProgressColumns, "batch") {
+		t.Fatalf("unexpected column visibility for %v", prefs.HiddenColumns(SKUViewColumns))
+	}
+	if other, err := Load(ctx, db, 2); err != nil || !other.ColumnVisible(SKUViewColumns, "batch") {
+		t.Fatalf("expected other user to show every column, err %v", err)
+	}
+
+	for _, bad := range []struct {
+		table  string
+		hidden []string
+	}{
+		{SKUViewColumns, []string{"sku"}},
+		{"columns.unknown", []string{"batch"}},
+	} {
+		if err := SaveColumns(ctx, db, 1, bad.table, bad.hidden); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("expected ErrInvalid for %s %v, got %v", bad.table, bad.hidden, err)
+		}
+	}
+
+	// Hiding nothing resets the table to default.
+	if err := SaveColumns(ctx, db, 1, SKUViewColumns, nil); err != nil {
+		t.Fatalf("reset columns: %v", err)
+	}
+	prefs, err = Load(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if prefs.Stored(SKUViewColumns) || len(prefs.HiddenColumns(SKUViewColumns)) != 0 {
+		t.Fatalf("expected columns reset, got %v", prefs.HiddenColumns(SKUViewColumns))
+	}
+}
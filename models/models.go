@@ -4,19 +4,22 @@ import (
 	"time"
 
 	"github.com/uptrace/bun"
+
+	"receipter/infrastructure/fieldcrypt"
 )
 
 // User represents an authenticated app user.
 type User struct {
 	bun.BaseModel `bun:"table:users,alias:u"`
 
-	ID              int64     `bun:"id,pk,autoincrement"`
-	Username        string    `bun:"username,unique,notnull"`
-	PasswordHash    string    `bun:"password_hash,notnull"`
-	Role            string    `bun:"role,notnull"`
-	ClientProjectID *int64    `bun:"client_project_id"`
-	CreatedAt       time.Time `bun:"created_at,notnull,default:current_timestamp"`
-	UpdatedAt       time.Time `bun:"updated_at,notnull,default:current_timestamp"`
+	ID              int64      `bun:"id,pk,autoincrement"`
+	Username        string     `bun:"username,unique,notnull"`
+	PasswordHash    string     `bun:"password_hash,notnull"`
+	Role            string     `bun:"role,notnull"`
+	ClientProjectID *int64     `bun:"client_project_id"`
+	DisabledAt      *time.Time `bun:"disabled_at"`
+	CreatedAt       time.Time  `bun:"created_at,notnull,default:current_timestamp"`
+	UpdatedAt       time.Time  `bun:"updated_at,notnull,default:current_timestamp"`
 }
 
 // Session is used by middleware and auth handlers.
@@ -26,12 +29,22 @@ type Session struct {
 	ID                string         `bun:"id,pk"`
 	UserID            int64          `bun:"user_id,notnull"`
 	ActiveProjectID   *int64         `bun:"active_project_id"`
+	ActiveSiteID      *int64         `bun:"active_site_id"`
+	KioskDeviceID     *int64         `bun:"kiosk_device_id"`
 	User              User           `bun:"rel:belongs-to,join:user_id=id"`
 	UserRoles         []string       `bun:"-"`
 	ScreenPermissions map[string]int `bun:"-"`
 	ExpiresAt         time.Time      `bun:"expires_at,notnull"`
 	CreatedAt         time.Time      `bun:"created_at,notnull,default:current_timestamp"`
 	UpdatedAt         time.Time      `bun:"updated_at,notnull,default:current_timestamp"`
+	// StepUpAt is when the user last re-entered their password or PIN for a
+	// controlled action, such as printing a closed label.
+	StepUpAt *time.Time `bun:"step_up_at"`
+}
+
+// Kiosk reports whether the session was opened by PIN on a kiosk device.
+func (s Session) Kiosk() bool {
+	return s.KioskDeviceID != nil
 }
 
 // Expired returns true when the session expiry time has passed.
@@ -43,15 +56,19 @@ func (s Session) Expired() bool {
 type Project struct {
 	bun.BaseModel `bun:"table:projects,alias:pj"`
 
-	ID          int64     `bun:"id,pk,autoincrement"`
-	Name        string    `bun:"name,notnull"`
-	Description string    `bun:"description,notnull"`
-	ProjectDate time.Time `bun:"project_date,notnull"`
-	ClientName  string    `bun:"client_name,notnull"`
-	Code        string    `bun:"code,notnull,unique"`
-	Status      string    `bun:"status,notnull"`
-	CreatedAt   time.Time `bun:"created_at,notnull,default:current_timestamp"`
-	UpdatedAt   time.Time `bun:"updated_at,notnull,default:current_timestamp"`
+	ID              int64             `bun:"id,pk,autoincrement"`
+	Name            string            `bun:"name,notnull"`
+	Description     string            `bun:"description,notnull"`
+	ProjectDate     time.Time         `bun:"project_date,notnull"`
+	ClientName      fieldcrypt.String `bun:"client_name,notnull"`
+	Code            string            `bun:"code,notnull,unique"`
+	Status          string            `bun:"status,notnull"`
+	LabelLanguage   string            `bun:"label_language,notnull,default:'en'"`
+	LabelSymbology  string            `bun:"label_symbology,notnull,default:'code128'"`
+	PalletAllowance *int64            `bun:"pallet_allowance"`
+	SiteID          *int64            `bun:"site_id"`
+	CreatedAt       time.Time         `bun:"created_at,notnull,default:current_timestamp"`
+	UpdatedAt       time.Time         `bun:"updated_at,notnull,default:current_timestamp"`
 }
 
 // StockItem is the item master imported from CSV.
@@ -67,6 +84,18 @@ type StockItem struct {
 	UpdatedAt   time.Time `bun:"updated_at,notnull,default:current_timestamp"`
 }
 
+// StockItemBarcode maps a scanned barcode to a catalog SKU within a project.
+type StockItemBarcode struct {
+	bun.BaseModel `bun:"table:stock_item_barcodes,alias:sib"`
+
+	ID              int64     `bun:"id,pk,autoincrement"`
+	ProjectID       int64     `bun:"project_id,notnull"`
+	Barcode         string    `bun:"barcode,notnull"`
+	SKU             string    `bun:"sku,notnull"`
+	CreatedByUserID int64     `bun:"created_by_user_id,notnull"`
+	CreatedAt       time.Time `bun:"created_at,notnull,default:current_timestamp"`
+}
+
 // Pallet tracks lifecycle and label identity.
 type Pallet struct {
 	bun.BaseModel `bun:"table:pallets,alias:p"`
@@ -79,6 +108,16 @@ type Pallet struct {
 	ReopenedAt *time.Time `bun:"reopened_at"`
 }
 
+// PalletAttribute holds optional attributes supplied when a pallet is pre-created.
+type PalletAttribute struct {
+	bun.BaseModel `bun:"table:pallet_attributes,alias:pa"`
+
+	PalletID          int64     `bun:"pallet_id,pk"`
+	PalletType        string    `bun:"pallet_type,notnull"`
+	DeliveryReference string    `bun:"delivery_reference,notnull"`
+	CreatedAt         time.Time `bun:"created_at,notnull,default:current_timestamp"`
+}
+
 // PalletReceipt stores stock lines recorded against a pallet.
 type PalletReceipt struct {
 	bun.BaseModel `bun:"table:pallet_receipts,alias:pr"`
@@ -96,6 +135,7 @@ type PalletReceipt struct {
 	UnknownSKU      bool       `bun:"unknown_sku,notnull,default:false"`
 	Damaged         bool       `bun:"damaged,notnull,default:false"`
 	DamagedQty      int64      `bun:"damaged_qty,notnull,default:0"`
+	DamageReason    string     `bun:"damage_reason,notnull,default:''"`
 	BatchNumber     string     `bun:"batch_number"`
 	ExpiryDate      *time.Time `bun:"expiry_date"`
 	CartonBarcode   string     `bun:"carton_barcode"`
@@ -105,8 +145,30 @@ type PalletReceipt struct {
 	StockPhotoName  string     `bun:"stock_photo_name"`
 	NoOuterBarcode  bool       `bun:"no_outer_barcode,notnull,default:false"`
 	NoInnerBarcode  bool       `bun:"no_inner_barcode,notnull,default:false"`
-	CreatedAt       time.Time  `bun:"created_at,notnull,default:current_timestamp"`
-	UpdatedAt       time.Time  `bun:"updated_at,notnull,default:current_timestamp"`
+	// BarcodeCheckFailed is set when a barcode was kept despite a wrong GS1
+	// check digit.
+	BarcodeCheckFailed bool `bun:"barcode_check_failed,notnull,default:false"`
+	// CountryOfOrigin and HSCode are the customs data of the line, captured
+	// when the project's customs settings ask for them.
+	CountryOfOrigin string `bun:"country_of_origin,notnull,default:''"`
+	HSCode          string `bun:"hs_code,notnull,default:''"`
+	// ResolvedAt is set when an admin assigns a real SKU to an UNKNOWN line.
+	ResolvedAt       *time.Time `bun:"resolved_at"`
+	ResolvedByUserID *int64     `bun:"resolved_by_user_id"`
+	CreatedAt        time.Time  `bun:"created_at,notnull,default:current_timestamp"`
+	UpdatedAt        time.Time  `bun:"updated_at,notnull,default:current_timestamp"`
+}
+
+// DamageReason is an admin-managed cause recorded against damaged receipt lines.
+type DamageReason struct {
+	bun.BaseModel `bun:"table:damage_reasons,alias:dr"`
+
+	Code      string    `bun:"code,pk"`
+	Label     string    `bun:"label,notnull"`
+	SortOrder int       `bun:"sort_order,notnull,default:0"`
+	Active    bool      `bun:"active,notnull,default:true"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp"`
+	UpdatedAt time.Time `bun:"updated_at,notnull,default:current_timestamp"`
 }
 
 // ReceiptPhoto stores individual photos attached to a receipt line.
@@ -121,6 +183,129 @@ type ReceiptPhoto struct {
 	CreatedAt       time.Time `bun:"created_at,notnull,default:current_timestamp"`
 }
 
+// ProjectCustomField is an admin-defined extra field captured on a project's receipt lines.
+type ProjectCustomField struct {
+	bun.BaseModel `bun:"table:project_custom_fields,alias:pcf"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	ProjectID int64     `bun:"project_id,notnull"`
+	Key       string    `bun:"key,notnull"`
+	Label     string    `bun:"label,notnull"`
+	FieldType string    `bun:"field_type,notnull,default:'text'"`
+	Required  bool      `bun:"required,notnull,default:false"`
+	SortOrder int       `bun:"sort_order,notnull,default:0"`
+	Active    bool      `bun:"active,notnull,default:true"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp"`
+	UpdatedAt time.Time `bun:"updated_at,notnull,default:current_timestamp"`
+}
+
+// PhotoUpload tracks a receipt photo uploaded in chunks after its line was saved.
+type PhotoUpload struct {
+	bun.BaseModel `bun:"table:photo_uploads,alias:pu"`
+
+	ID              int64     `bun:"id,pk,autoincrement"`
+	PalletReceiptID int64     `bun:"pallet_receipt_id,notnull"`
+	FileName        string    `bun:"file_name,notnull"`
+	MIMEType        string    `bun:"mime_type,notnull"`
+	TotalBytes      int64     `bun:"total_bytes,notnull"`
+	ReceivedBytes   int64     `bun:"received_bytes,notnull"`
+	Internal        bool      `bun:"internal,notnull"`
+	Status          string    `bun:"status,notnull"`
+	Error           string    `bun:"error,notnull"`
+	CreatedByUserID int64     `bun:"created_by_user_id,notnull"`
+	CreatedAt       time.Time `bun:"created_at,notnull,default:current_timestamp"`
+	UpdatedAt       time.Time `bun:"updated_at,notnull,default:current_timestamp"`
+}
+
+// ExportJob is an export built in the background by the export worker. The
+// finished file is held in FileBlob, or in export_job_chunks when the builder
+// wrote it to a temporary file, until the job is pruned.
+type ExportJob struct {
+	bun.BaseModel `bun:"table:export_jobs,alias:ej"`
+
+	ID                int64      `bun:"id,pk,autoincrement"`
+	Kind              string     `bun:"kind,notnull"`
+	ProjectID         int64      `bun:"project_id,notnull"`
+	PalletID          *int64     `bun:"pallet_id"`
+	RequestedByUserID *int64     `bun:"requested_by_user_id"`
+	Status            string     `bun:"status,notnull"`
+	Error             string     `bun:"error,notnull"`
+	FileName          string     `bun:"file_name,notnull"`
+	FileBlob          []byte     `bun:"file_blob"`
+	FileSize          int64      `bun:"file_size,notnull"`
+	RowCount          int64      `bun:"row_count,notnull"`
+	CreatedAt         time.Time  `bun:"created_at,notnull,default:current_timestamp"`
+	FinishedAt        *time.Time `bun:"finished_at"`
+}
+
+// Delivery is one outbound webhook or email send, retried with backoff until
+// it is delivered or dead-lettered.
+type Delivery struct {
+	bun.BaseModel `bun:"table:deliveries,alias:d"`
+
+	ID            int64      `bun:"id,pk,autoincrement"`
+	Kind          string     `bun:"kind,notnull"`
+	Endpoint      string     `bun:"endpoint,notnull"`
+	Event         string     `bun:"event,notnull"`
+	Payload       string     `bun:"payload,notnull"`
+	Status        string     `bun:"status,notnull"`
+	Attempts      int        `bun:"attempts,notnull"`
+	MaxAttempts   int        `bun:"max_attempts,notnull"`
+	LastError     string     `bun:"last_error,notnull"`
+	NextAttemptAt time.Time  `bun:"next_attempt_at,notnull"`
+	DeliveredAt   *time.Time `bun:"delivered_at"`
+	ProjectID     *int64     `bun:"project_id"`
+	WebhookID     *int64     `bun:"webhook_id"`
+	Signature     string     `bun:"signature,notnull"`
+	CreatedAt     time.Time  `bun:"created_at,notnull,default:current_timestamp"`
+	UpdatedAt     time.Time  `bun:"updated_at,notnull,default:current_timestamp"`
+}
+
+// ProjectWebhook sends a project's pallet status events to a client system.
+// Events is a comma-separated list of event names.
+type ProjectWebhook struct {
+	bun.BaseModel `bun:"table:project_webhooks,alias:pw"`
+
+	ID              int64             `bun:"id,pk,autoincrement"`
+	ProjectID       int64             `bun:"project_id,notnull"`
+	URL             string            `bun:"url,notnull"`
+	Secret          fieldcrypt.String `bun:"secret,notnull"`
+	Events          string            `bun:"events,notnull"`
+	Active          bool              `bun:"active,notnull"`
+	CreatedByUserID int64             `bun:"created_by_user_id,notnull"`
+	CreatedAt       time.Time         `bun:"created_at,notnull,default:current_timestamp"`
+	UpdatedAt       time.Time         `bun:"updated_at,notnull,default:current_timestamp"`
+}
+
+// KioskDevice is a shared tablet enrolled to open PIN sessions.
+type KioskDevice struct {
+	bun.BaseModel `bun:"table:kiosk_devices,alias:kd"`
+
+	ID              int64      `bun:"id,pk,autoincrement"`
+	Name            string     `bun:"name,notnull"`
+	TokenHash       string     `bun:"token_hash,notnull"`
+	TokenPrefix     string     `bun:"token_prefix,notnull"`
+	CreatedByUserID int64      `bun:"created_by_user_id,notnull"`
+	CreatedAt       time.Time  `bun:"created_at,notnull,default:current_timestamp"`
+	EnrolledAt      *time.Time `bun:"enrolled_at"`
+	LastSeenAt      *time.Time `bun:"last_seen_at"`
+	RevokedAt       *time.Time `bun:"revoked_at"`
+	SiteID          *int64     `bun:"site_id"`
+}
+
+// Site is a warehouse run from this instance. Projects, kiosk devices and
+// users are assigned to sites so multi-site admins can work one at a time.
+type Site struct {
+	bun.BaseModel `bun:"table:sites,alias:st"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	Code      string    `bun:"code,notnull,unique"`
+	Name      string    `bun:"name,notnull"`
+	Active    bool      `bun:"active,notnull,default:true"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp"`
+	UpdatedAt time.Time `bun:"updated_at,notnull,default:current_timestamp"`
+}
+
 // AuditLog captures immutable change history for key operations.
 type AuditLog struct {
 	bun.BaseModel `bun:"table:audit_logs,alias:al"`
@@ -134,3 +319,51 @@ type AuditLog struct {
 	AfterJSON  string    `bun:"after_json"`
 	CreatedAt  time.Time `bun:"created_at,notnull,default:current_timestamp"`
 }
+
+// APIToken authenticates machine clients as a user; only the hash is stored.
+type APIToken struct {
+	bun.BaseModel `bun:"table:api_tokens,alias:at"`
+
+	ID              int64      `bun:"id,pk,autoincrement"`
+	UserID          int64      `bun:"user_id,notnull"`
+	Name            string     `bun:"name,notnull"`
+	TokenHash       string     `bun:"token_hash,notnull,unique"`
+	TokenPrefix     string     `bun:"token_prefix,notnull"`
+	CreatedByUserID int64      `bun:"created_by_user_id,notnull"`
+	CreatedAt       time.Time  `bun:"created_at,notnull,default:current_timestamp"`
+	LastUsedAt      *time.Time `bun:"last_used_at"`
+	RevokedAt       *time.Time `bun:"revoked_at"`
+}
+
+// EmbedToken grants read-only access to the receiving summary widget for the
+// projects listed in embed_token_projects; only the hash is stored.
+type EmbedToken struct {
+	bun.BaseModel `bun:"table:embed_tokens,alias:et"`
+
+	ID              int64      `bun:"id,pk,autoincrement"`
+	Name            string     `bun:"name,notnull"`
+	TokenHash       string     `bun:"token_hash,notnull,unique"`
+	TokenPrefix     string     `bun:"token_prefix,notnull"`
+	CreatedByUserID int64      `bun:"created_by_user_id,notnull"`
+	CreatedAt       time.Time  `bun:"created_at,notnull,default:current_timestamp"`
+	LastUsedAt      *time.Time `bun:"last_used_at"`
+	RevokedAt       *time.Time `bun:"revoked_at"`
+}
+
+// AuditorLink grants an external auditor read-only access to one project
+// until ExpiresAt; only the hash is stored.
+type AuditorLink struct {
+	bun.BaseModel `bun:"table:auditor_links,alias:aul"`
+
+	ID              int64      `bun:"id,pk,autoincrement"`
+	ProjectID       int64      `bun:"project_id,notnull"`
+	AuditorName     string     `bun:"auditor_name,notnull"`
+	TokenHash       string     `bun:"token_hash,notnull,unique"`
+	TokenPrefix     string     `bun:"token_prefix,notnull"`
+	ExpiresAt       time.Time  `bun:"expires_at,notnull"`
+	CreatedByUserID int64      `bun:"created_by_user_id,notnull"`
+	CreatedAt       time.Time  `bun:"created_at,notnull,default:current_timestamp"`
+	LastUsedAt      *time.Time `bun:"last_used_at"`
+	RevokedAt       *time.Time `bun:"revoked_at"`
+	RevokedByUserID *int64     `bun:"revoked_by_user_id"`
+}